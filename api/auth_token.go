@@ -1,5 +1,7 @@
 package api
 
+import "strings"
+
 // TokenAuth is used to perform token backend operations on Vault
 type TokenAuth struct {
 	c *Client
@@ -162,6 +164,129 @@ func (c *TokenAuth) RevokeTree(token string) error {
 	return nil
 }
 
+// ListRoles returns the names of the token store roles.
+func (c *TokenAuth) ListRoles() ([]string, error) {
+	r := c.c.NewRequest("GET", "/v1/auth/token/roles")
+	r.Params.Set("list", "true")
+	resp, err := c.c.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if resp != nil && resp.StatusCode == 404 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Data struct {
+			Keys []string `json:"keys"`
+		} `json:"data"`
+	}
+	err = resp.DecodeJSON(&result)
+	return result.Data.Keys, err
+}
+
+// ReadRole returns the named token store role, or nil if it does not exist.
+func (c *TokenAuth) ReadRole(name string) (*TokenRole, error) {
+	r := c.c.NewRequest("GET", "/v1/auth/token/roles/"+name)
+	resp, err := c.c.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if resp != nil && resp.StatusCode == 404 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Data *TokenRole `json:"data"`
+	}
+	err = resp.DecodeJSON(&result)
+	return result.Data, err
+}
+
+// WriteRole creates or updates a token store role, which lets the tokens
+// allowed to create tokens against it do so within the bounds of the role,
+// without sudo capability. Only the fields of role that are set are sent:
+// nil slices and pointers and zero values are left out, so that new roles
+// get the server's defaults for them and existing roles keep their values.
+// An empty, non-nil slice clears the corresponding list.
+func (c *TokenAuth) WriteRole(role *TokenRole) error {
+	body := make(map[string]interface{})
+	if role.AllowedPolicies != nil {
+		body["allowed_policies"] = strings.Join(role.AllowedPolicies, ",")
+	}
+	if role.DisallowedPolicies != nil {
+		body["disallowed_policies"] = strings.Join(role.DisallowedPolicies, ",")
+	}
+	if role.Orphan != nil {
+		body["orphan"] = *role.Orphan
+	}
+	if role.Period != 0 {
+		body["period"] = role.Period
+	}
+	if role.Renewable != nil {
+		body["renewable"] = *role.Renewable
+	}
+	if role.PathSuffix != "" {
+		body["path_suffix"] = role.PathSuffix
+	}
+	if role.ExplicitMaxTTL != 0 {
+		body["explicit_max_ttl"] = role.ExplicitMaxTTL
+	}
+	if role.TokenType != "" {
+		body["token_type"] = role.TokenType
+	}
+	if role.BoundCIDRs != nil {
+		body["bound_cidrs"] = strings.Join(role.BoundCIDRs, ",")
+	}
+	if role.NumUses != 0 {
+		body["num_uses"] = role.NumUses
+	}
+
+	r := c.c.NewRequest("POST", "/v1/auth/token/roles/"+role.Name)
+	if err := r.SetJSONBody(body); err != nil {
+		return err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+// DeleteRole removes a token store role.
+func (c *TokenAuth) DeleteRole(name string) error {
+	r := c.c.NewRequest("DELETE", "/v1/auth/token/roles/"+name)
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+// TokenRole is a token store role. Period and ExplicitMaxTTL are in
+// seconds. Orphan and Renewable are pointers so that WriteRole can tell
+// false apart from unset.
+type TokenRole struct {
+	Name               string   `json:"name"`
+	AllowedPolicies    []string `json:"allowed_policies"`
+	DisallowedPolicies []string `json:"disallowed_policies"`
+	Orphan             *bool    `json:"orphan"`
+	Period             int64    `json:"period"`
+	Renewable          *bool    `json:"renewable"`
+	PathSuffix         string   `json:"path_suffix"`
+	ExplicitMaxTTL     int64    `json:"explicit_max_ttl"`
+	TokenType          string   `json:"token_type"`
+	BoundCIDRs         []string `json:"bound_cidrs"`
+	NumUses            int      `json:"num_uses"`
+}
+
 // TokenCreateRequest is the options structure for creating a token.
 type TokenCreateRequest struct {
 	ID              string            `json:"id,omitempty"`
@@ -176,4 +301,6 @@ type TokenCreateRequest struct {
 	DisplayName     string            `json:"display_name"`
 	NumUses         int               `json:"num_uses"`
 	Renewable       *bool             `json:"renewable,omitempty"`
+	Type            string            `json:"type,omitempty"`
+	BoundCIDRs      []string          `json:"bound_cidrs,omitempty"`
 }
@@ -206,3 +206,94 @@ func TestAuthTokenRenew(t *testing.T) {
 		t.Error("expected lease to be renewable")
 	}
 }
+
+func TestAuthTokenRoles(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := http.TestServer(t, core)
+	defer ln.Close()
+
+	config := DefaultConfig()
+	config.Address = addr
+
+	client, err := NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetToken(token)
+	tokenAuth := client.Auth().Token()
+
+	roles, err := tokenAuth.ListRoles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 0 {
+		t.Fatalf("bad: %#v", roles)
+	}
+	role, err := tokenAuth.ReadRole("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role != nil {
+		t.Fatalf("bad: %#v", role)
+	}
+
+	// Fields that are not set get the server's defaults
+	orphan := true
+	if err := tokenAuth.WriteRole(&TokenRole{
+		Name:            "foo",
+		AllowedPolicies: []string{"default", "dev"},
+		Orphan:          &orphan,
+		Period:          3600,
+		BoundCIDRs:      []string{"127.0.0.1/32"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	role, err = tokenAuth.ReadRole("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role == nil || role.Name != "foo" || strings.Join(role.AllowedPolicies, ",") != "default,dev" ||
+		len(role.DisallowedPolicies) != 0 || role.Orphan == nil || !*role.Orphan || role.Period != 3600 ||
+		role.Renewable == nil || !*role.Renewable || role.TokenType != "service" ||
+		strings.Join(role.BoundCIDRs, ",") != "127.0.0.1/32" {
+		t.Fatalf("bad: %#v", role)
+	}
+
+	// Updating a role only changes the fields that are set
+	renewable := false
+	if err := tokenAuth.WriteRole(&TokenRole{
+		Name:       "foo",
+		Renewable:  &renewable,
+		BoundCIDRs: []string{},
+		NumUses:    5,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	role, err = tokenAuth.ReadRole("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role == nil || strings.Join(role.AllowedPolicies, ",") != "default,dev" || !*role.Orphan ||
+		role.Period != 3600 || *role.Renewable || len(role.BoundCIDRs) != 0 || role.NumUses != 5 {
+		t.Fatalf("bad: %#v", role)
+	}
+
+	roles, err = tokenAuth.ListRoles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(roles) != 1 || roles[0] != "foo" {
+		t.Fatalf("bad: %#v", roles)
+	}
+
+	if err := tokenAuth.DeleteRole("foo"); err != nil {
+		t.Fatal(err)
+	}
+	role, err = tokenAuth.ReadRole("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role != nil {
+		t.Fatalf("bad: %#v", role)
+	}
+}
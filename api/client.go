@@ -3,6 +3,7 @@ package api
 import (
 	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -25,6 +26,7 @@ const EnvVaultInsecure = "VAULT_SKIP_VERIFY"
 const EnvVaultTLSServerName = "VAULT_TLS_SERVER_NAME"
 const EnvVaultWrapTTL = "VAULT_WRAP_TTL"
 const EnvVaultMaxRetries = "VAULT_MAX_RETRIES"
+const EnvVaultNamespace = "VAULT_NAMESPACE"
 
 // WrappingLookupFunc is a function that, given an HTTP verb and a path,
 // returns an optional string duration to be used for response wrapping (e.g.
@@ -36,7 +38,8 @@ type WrappingLookupFunc func(operation, path string) string
 // Config is used to configure the creation of the client.
 type Config struct {
 	// Address is the address of the Vault server. This should be a complete
-	// URL such as "http://vault.example.com". If you need a custom SSL
+	// URL such as "http://vault.example.com", or the path of a UNIX domain
+	// socket such as "unix:///var/run/vault.sock". If you need a custom SSL
 	// cert or want to enable insecure mode, you need to specify a custom
 	// HttpClient.
 	Address string
@@ -225,6 +228,14 @@ type Client struct {
 	config             *Config
 	token              string
 	wrappingLookupFunc WrappingLookupFunc
+	mfaCreds           []string
+	namespace          string
+
+	// The state of the cluster after the last write, sent with the
+	// following requests when reading your writes
+	readYourWrites bool
+	indexLock      sync.Mutex
+	index          string
 }
 
 // NewClient returns a new client for the given configuration.
@@ -249,6 +260,10 @@ func NewClient(c *Config) (*Client, error) {
 		c.HttpClient = DefaultConfig().HttpClient
 	}
 
+	if u, err = configureUnixSocket(u, c.HttpClient); err != nil {
+		return nil, err
+	}
+
 	redirFunc := func() {
 		// Ensure redirects are not automatically followed
 		// Note that this is sane for the API client as it has its own
@@ -274,6 +289,10 @@ func NewClient(c *Config) (*Client, error) {
 		client.SetToken(token)
 	}
 
+	if namespace := os.Getenv(EnvVaultNamespace); namespace != "" {
+		client.SetNamespace(namespace)
+	}
+
 	return client, nil
 }
 
@@ -281,20 +300,81 @@ func NewClient(c *Config) (*Client, error) {
 // "<Scheme>://<Host>:<Port>". Setting this on a client will override the
 // value of VAULT_ADDR environment variable.
 func (c *Client) SetAddress(addr string) error {
-	var err error
-	if c.addr, err = url.Parse(addr); err != nil {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return fmt.Errorf("failed to set address: %v", err)
+	}
+	if u, err = configureUnixSocket(u, c.config.HttpClient); err != nil {
 		return fmt.Errorf("failed to set address: %v", err)
 	}
+	c.addr = u
 
 	return nil
 }
 
+// configureUnixSocket sets up client to send all requests over the UNIX
+// domain socket at the path of addr if its scheme is "unix", as in
+// "unix:///var/run/vault.sock". It returns the address to use for the
+// requests themselves, which is addr unless it is a socket address.
+func configureUnixSocket(addr *url.URL, client *http.Client) (*url.URL, error) {
+	if addr.Scheme != "unix" {
+		return addr, nil
+	}
+	if addr.Path == "" {
+		return nil, fmt.Errorf("missing socket path in address %q", addr.String())
+	}
+
+	transport, ok := client.Transport.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("UNIX domain socket addresses require the HTTP client to use an *http.Transport")
+	}
+	socketPath := addr.Path
+	transport.Dial = func(string, string) (net.Conn, error) {
+		return net.Dial("unix", socketPath)
+	}
+
+	return &url.URL{
+		Scheme: "http",
+		Host:   "localhost",
+	}, nil
+}
+
 // SetWrappingLookupFunc sets a lookup function that returns desired wrap TTLs
 // for a given operation and path
 func (c *Client) SetWrappingLookupFunc(lookupFunc WrappingLookupFunc) {
 	c.wrappingLookupFunc = lookupFunc
 }
 
+// SetMFACreds sets the MFA credentials sent with every request, each as
+// "<method name>:<passcode>", or just "<method name>" for the methods
+// without passcode such as Duo push notifications
+func (c *Client) SetMFACreds(creds []string) {
+	c.mfaCreds = creds
+}
+
+// SetNamespace sets the namespace the requests are made in, such as
+// "ns1/ns2". Request paths are then relative to the namespace.
+func (c *Client) SetNamespace(namespace string) {
+	c.namespace = namespace
+}
+
+// Namespace returns the namespace the requests are made in, or the empty
+// string for the root namespace
+func (c *Client) Namespace() string {
+	return c.namespace
+}
+
+// SetReadYourWrites makes the reads following a write see it, even when
+// served by a performance standby. The client sends the state of the
+// cluster returned by its last write with every request; a standby that has
+// not caught up to it forwards the read to the active node.
+func (c *Client) SetReadYourWrites(readYourWrites bool) {
+	c.indexLock.Lock()
+	defer c.indexLock.Unlock()
+	c.readYourWrites = readYourWrites
+	c.index = ""
+}
+
 // Token returns the access token being used by this client. It will
 // return the empty string if there is no token set.
 func (c *Client) Token() string {
@@ -323,9 +403,17 @@ func (c *Client) NewRequest(method, path string) *Request {
 			Host:   c.addr.Host,
 			Path:   path,
 		},
-		ClientToken: c.token,
-		Params:      make(map[string][]string),
+		ClientToken:    c.token,
+		Params:         make(map[string][]string),
+		MFAHeaderValue: c.mfaCreds,
+		Namespace:      c.namespace,
+	}
+
+	c.indexLock.Lock()
+	if c.readYourWrites {
+		req.Index = c.index
 	}
+	c.indexLock.Unlock()
 
 	if c.wrappingLookupFunc != nil {
 		var lookupPath string
@@ -410,5 +498,13 @@ START:
 		return result, err
 	}
 
+	if index := resp.Header.Get("X-Vault-Index"); index != "" {
+		c.indexLock.Lock()
+		if c.readYourWrites {
+			c.index = index
+		}
+		c.indexLock.Unlock()
+	}
+
 	return result, nil
 }
@@ -3,8 +3,11 @@ package api
 import (
 	"bytes"
 	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -59,6 +62,47 @@ func TestClientSetAddress(t *testing.T) {
 	}
 }
 
+func TestClientUnixSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	socketPath := filepath.Join(dir, "vault.sock")
+	ln, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	var host string
+	go (&http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		host = req.Host
+		w.Write([]byte("{}"))
+	})}).Serve(ln)
+
+	config := DefaultConfig()
+	config.Address = "unix://" + socketPath
+	client, err := NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := client.RawRequest(client.NewRequest("GET", "/v1/sys/health"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if host != "localhost" {
+		t.Fatalf("bad: %q", host)
+	}
+
+	if err := client.SetAddress("unix://"); err == nil {
+		t.Fatal("expected an error for an address without a socket path")
+	}
+}
+
 func TestClientToken(t *testing.T) {
 	tokenValue := "foo"
 	handler := func(w http.ResponseWriter, req *http.Request) {}
@@ -11,14 +11,22 @@ import (
 // Request is a raw request configuration structure used to initiate
 // API requests to the Vault server.
 type Request struct {
-	Method      string
-	URL         *url.URL
-	Params      url.Values
-	ClientToken string
-	WrapTTL     string
-	Obj         interface{}
-	Body        io.Reader
-	BodySize    int64
+	Method         string
+	URL            *url.URL
+	Params         url.Values
+	ClientToken    string
+	WrapTTL        string
+	MFAHeaderValue []string
+	Namespace      string
+	Index          string
+	Obj            interface{}
+	Body           io.Reader
+	BodySize       int64
+	ContentType    string
+
+	// rawBody is the body set by SetRawBody, kept to be sent again on a
+	// redirect
+	rawBody []byte
 }
 
 // SetJSONBody is used to set a request body that is a JSON-encoded value.
@@ -35,11 +43,24 @@ func (r *Request) SetJSONBody(val interface{}) error {
 	return nil
 }
 
+// SetRawBody is used to set a request body that is sent as it is, with the
+// given content type.
+func (r *Request) SetRawBody(contentType string, body []byte) {
+	r.ContentType = contentType
+	r.rawBody = body
+	r.Body = bytes.NewReader(body)
+	r.BodySize = int64(len(body))
+}
+
 // ResetJSONBody is used to reset the body for a redirect
 func (r *Request) ResetJSONBody() error {
 	if r.Body == nil {
 		return nil
 	}
+	if r.rawBody != nil {
+		r.SetRawBody(r.ContentType, r.rawBody)
+		return nil
+	}
 	return r.SetJSONBody(r.Obj)
 }
 
@@ -67,5 +88,21 @@ func (r *Request) ToHTTP() (*http.Request, error) {
 		req.Header.Set("X-Vault-Wrap-TTL", r.WrapTTL)
 	}
 
+	if r.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", r.Namespace)
+	}
+
+	if r.Index != "" {
+		req.Header.Set("X-Vault-Index", r.Index)
+	}
+
+	if r.ContentType != "" {
+		req.Header.Set("Content-Type", r.ContentType)
+	}
+
+	for _, creds := range r.MFAHeaderValue {
+		req.Header.Add("X-Vault-MFA", creds)
+	}
+
 	return req, nil
 }
@@ -61,3 +61,25 @@ func TestRequestResetJSONBody(t *testing.T) {
 		t.Fatalf("bad: %d", len(actual))
 	}
 }
+
+func TestRequestResetRawBody(t *testing.T) {
+	var r Request
+	r.SetRawBody("application/octet-stream", []byte("foo"))
+
+	var buf bytes.Buffer
+	if _, err := io.Copy(&buf, r.Body); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	if err := r.ResetJSONBody(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var buf2 bytes.Buffer
+	if _, err := io.Copy(&buf2, r.Body); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if buf2.String() != "foo" || r.BodySize != 3 {
+		t.Fatalf("bad: %q %d", buf2.String(), r.BodySize)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 
+	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/helper/jsonutil"
 )
 
@@ -62,11 +63,14 @@ func (r *Response) Error() error {
 		errBody.WriteString(fmt.Sprintf("* %s", err))
 	}
 
-	return fmt.Errorf(errBody.String())
+	// Attach the error code, if the server sent one, so that callers can
+	// retrieve it with errutil.CodeOf
+	return errutil.WithCode(errutil.Code(resp.ErrorCode), fmt.Errorf(errBody.String()))
 }
 
 // ErrorResponse is the raw structure of errors when they're returned by the
 // HTTP API.
 type ErrorResponse struct {
-	Errors []string
+	Errors    []string
+	ErrorCode string `json:"error_code"`
 }
@@ -0,0 +1,56 @@
+package api
+
+import "strings"
+
+func (c *Sys) CORSStatus() (*CORSResponse, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/config/cors")
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := new(CORSResponse)
+	err = resp.DecodeJSON(result)
+	return result, err
+}
+
+func (c *Sys) ConfigureCORS(req *CORSRequest) error {
+	body := map[string]interface{}{
+		"enabled":         req.Enabled,
+		"allowed_origins": strings.Join(req.AllowedOrigins, ","),
+		"allowed_headers": strings.Join(req.AllowedHeaders, ","),
+	}
+
+	r := c.c.NewRequest("PUT", "/v1/sys/config/cors")
+	if err := r.SetJSONBody(body); err != nil {
+		return err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+func (c *Sys) DisableCORS() error {
+	r := c.c.NewRequest("DELETE", "/v1/sys/config/cors")
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+type CORSRequest struct {
+	Enabled        bool
+	AllowedOrigins []string
+	AllowedHeaders []string
+}
+
+type CORSResponse struct {
+	Enabled        bool     `json:"enabled"`
+	AllowedOrigins []string `json:"allowed_origins"`
+	AllowedHeaders []string `json:"allowed_headers"`
+}
@@ -0,0 +1,69 @@
+package api
+
+import "time"
+
+// ControlGroupAuthorize approves the control group request with the given
+// wrapping token accessor, and returns whether the request is approved
+func (c *Sys) ControlGroupAuthorize(accessor string) (bool, error) {
+	body := map[string]string{
+		"accessor": accessor,
+	}
+
+	r := c.c.NewRequest("POST", "/v1/sys/control-group/authorize")
+	if err := r.SetJSONBody(body); err != nil {
+		return false, err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Approved bool `json:"approved"`
+	}
+	err = resp.DecodeJSON(&result)
+	return result.Approved, err
+}
+
+// ControlGroupRequest returns the status of the control group request with
+// the given wrapping token accessor
+func (c *Sys) ControlGroupRequest(accessor string) (*ControlGroupRequest, error) {
+	body := map[string]string{
+		"accessor": accessor,
+	}
+
+	r := c.c.NewRequest("POST", "/v1/sys/control-group/request")
+	if err := r.SetJSONBody(body); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := new(ControlGroupRequest)
+	err = resp.DecodeJSON(result)
+	return result, err
+}
+
+type ControlGroupRequest struct {
+	Approved          bool                         `json:"approved"`
+	RequestPath       string                       `json:"request_path"`
+	RequestOperation  string                       `json:"request_operation"`
+	RequestEntityID   string                       `json:"request_entity_id"`
+	GroupNames        []string                     `json:"group_names"`
+	ApprovalsRequired int                          `json:"approvals_required"`
+	Authorizations    []*ControlGroupAuthorization `json:"authorizations"`
+	CreationTime      time.Time                    `json:"creation_time"`
+	ExpireTime        time.Time                    `json:"expire_time"`
+}
+
+type ControlGroupAuthorization struct {
+	EntityID   string    `json:"entity_id"`
+	EntityName string    `json:"entity_name"`
+	Time       time.Time `json:"time"`
+}
@@ -0,0 +1,80 @@
+package api
+
+import "strings"
+
+func (c *Sys) ListEndpointPolicies() ([]string, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/policies/egp")
+	r.Params.Set("list", "true")
+	resp, err := c.c.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if resp != nil && resp.StatusCode == 404 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Keys []string `json:"keys"`
+	}
+	err = resp.DecodeJSON(&result)
+	return result.Keys, err
+}
+
+func (c *Sys) EndpointPolicy(name string) (*EndpointPolicy, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/policies/egp/"+name)
+	resp, err := c.c.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if resp != nil && resp.StatusCode == 404 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := new(EndpointPolicy)
+	err = resp.DecodeJSON(result)
+	return result, err
+}
+
+func (c *Sys) PutEndpointPolicy(policy *EndpointPolicy) error {
+	body := map[string]interface{}{
+		"paths":       strings.Join(policy.Paths, ","),
+		"bound_cidrs": strings.Join(policy.BoundCIDRs, ","),
+		"require_mfa": policy.RequireMFA,
+	}
+
+	r := c.c.NewRequest("PUT", "/v1/sys/policies/egp/"+policy.Name)
+	if err := r.SetJSONBody(body); err != nil {
+		return err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+func (c *Sys) DeleteEndpointPolicy(name string) error {
+	r := c.c.NewRequest("DELETE", "/v1/sys/policies/egp/"+name)
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+// EndpointPolicy is an endpoint governing policy: every request to Paths,
+// whatever its token, must come from BoundCIDRs if set, and with a token
+// from an MFA-verified login if RequireMFA is set.
+type EndpointPolicy struct {
+	Name       string   `json:"name"`
+	Paths      []string `json:"paths"`
+	BoundCIDRs []string `json:"bound_cidrs"`
+	RequireMFA bool     `json:"require_mfa"`
+}
@@ -0,0 +1,382 @@
+package api
+
+import (
+	"strings"
+	"time"
+)
+
+func (c *Sys) ListEntities() ([]string, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/identity/entity/id")
+	r.Params.Set("list", "true")
+	resp, err := c.c.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if resp != nil && resp.StatusCode == 404 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Keys []string `json:"keys"`
+	}
+	err = resp.DecodeJSON(&result)
+	return result.Keys, err
+}
+
+func (c *Sys) Entity(id string) (*Entity, error) {
+	return c.readEntity("/v1/sys/identity/entity/id/" + id)
+}
+
+func (c *Sys) EntityByName(name string) (*Entity, error) {
+	return c.readEntity("/v1/sys/identity/entity/name/" + name)
+}
+
+func (c *Sys) readEntity(path string) (*Entity, error) {
+	r := c.c.NewRequest("GET", path)
+	resp, err := c.c.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if resp != nil && resp.StatusCode == 404 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := new(Entity)
+	err = resp.DecodeJSON(result)
+	return result, err
+}
+
+// CreateEntity creates an entity and returns its ID. A name is generated if
+// name is empty.
+func (c *Sys) CreateEntity(name string, policies []string, metadata map[string]string) (string, error) {
+	body := map[string]interface{}{
+		"name":     name,
+		"policies": strings.Join(policies, ","),
+	}
+	if metadata != nil {
+		body["metadata"] = metadata
+	}
+
+	r := c.c.NewRequest("PUT", "/v1/sys/identity/entity")
+	if err := r.SetJSONBody(body); err != nil {
+		return "", err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		ID string `json:"id"`
+	}
+	err = resp.DecodeJSON(&result)
+	return result.ID, err
+}
+
+// UpdateEntity changes the name, policies and metadata of an entity. An
+// empty name and nil policies or metadata are left unchanged.
+func (c *Sys) UpdateEntity(id, name string, policies []string, metadata map[string]string) error {
+	body := map[string]interface{}{}
+	if name != "" {
+		body["name"] = name
+	}
+	if policies != nil {
+		body["policies"] = strings.Join(policies, ",")
+	}
+	if metadata != nil {
+		body["metadata"] = metadata
+	}
+
+	r := c.c.NewRequest("PUT", "/v1/sys/identity/entity/id/"+id)
+	if err := r.SetJSONBody(body); err != nil {
+		return err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+func (c *Sys) DeleteEntity(id string) error {
+	r := c.c.NewRequest("DELETE", "/v1/sys/identity/entity/id/"+id)
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+// MergeEntities merges the entities with the IDs fromIDs into the one with
+// the ID toID, and returns the resulting entity
+func (c *Sys) MergeEntities(toID string, fromIDs []string) (*Entity, error) {
+	body := map[string]interface{}{
+		"to_entity_id":    toID,
+		"from_entity_ids": strings.Join(fromIDs, ","),
+	}
+
+	r := c.c.NewRequest("PUT", "/v1/sys/identity/entity/merge")
+	if err := r.SetJSONBody(body); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := new(Entity)
+	err = resp.DecodeJSON(result)
+	return result, err
+}
+
+// CreateEntityAlias ties the principal with the given name in the auth
+// mount at mountPath to an entity, and returns the ID of the alias
+func (c *Sys) CreateEntityAlias(entityID, mountPath, name string) (string, error) {
+	body := map[string]interface{}{
+		"entity_id":  entityID,
+		"mount_path": mountPath,
+		"name":       name,
+	}
+
+	r := c.c.NewRequest("PUT", "/v1/sys/identity/entity-alias")
+	if err := r.SetJSONBody(body); err != nil {
+		return "", err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		ID string `json:"id"`
+	}
+	err = resp.DecodeJSON(&result)
+	return result.ID, err
+}
+
+func (c *Sys) DeleteEntityAlias(id string) error {
+	r := c.c.NewRequest("DELETE", "/v1/sys/identity/entity-alias/id/"+id)
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+func (c *Sys) ListGroups() ([]string, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/identity/group/id")
+	r.Params.Set("list", "true")
+	resp, err := c.c.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if resp != nil && resp.StatusCode == 404 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Keys []string `json:"keys"`
+	}
+	err = resp.DecodeJSON(&result)
+	return result.Keys, err
+}
+
+func (c *Sys) Group(id string) (*Group, error) {
+	return c.readGroup("/v1/sys/identity/group/id/" + id)
+}
+
+func (c *Sys) GroupByName(name string) (*Group, error) {
+	return c.readGroup("/v1/sys/identity/group/name/" + name)
+}
+
+func (c *Sys) readGroup(path string) (*Group, error) {
+	r := c.c.NewRequest("GET", path)
+	resp, err := c.c.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if resp != nil && resp.StatusCode == 404 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := new(Group)
+	err = resp.DecodeJSON(result)
+	return result, err
+}
+
+// CreateGroup creates a group of the type "internal" or "external" and
+// returns its ID. A name is generated if name is empty. Only internal
+// groups can be given members.
+func (c *Sys) CreateGroup(name, groupType string, policies []string, metadata map[string]string, memberEntityIDs []string) (string, error) {
+	body := map[string]interface{}{
+		"name":              name,
+		"policies":          strings.Join(policies, ","),
+		"member_entity_ids": strings.Join(memberEntityIDs, ","),
+	}
+	if groupType != "" {
+		body["type"] = groupType
+	}
+	if metadata != nil {
+		body["metadata"] = metadata
+	}
+
+	r := c.c.NewRequest("PUT", "/v1/sys/identity/group")
+	if err := r.SetJSONBody(body); err != nil {
+		return "", err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		ID string `json:"id"`
+	}
+	err = resp.DecodeJSON(&result)
+	return result.ID, err
+}
+
+// UpdateGroup changes the name, policies, metadata and members of a group.
+// An empty name and nil policies, metadata or members are left unchanged.
+func (c *Sys) UpdateGroup(id, name string, policies []string, metadata map[string]string, memberEntityIDs []string) error {
+	body := map[string]interface{}{}
+	if name != "" {
+		body["name"] = name
+	}
+	if policies != nil {
+		body["policies"] = strings.Join(policies, ",")
+	}
+	if metadata != nil {
+		body["metadata"] = metadata
+	}
+	if memberEntityIDs != nil {
+		body["member_entity_ids"] = strings.Join(memberEntityIDs, ",")
+	}
+
+	r := c.c.NewRequest("PUT", "/v1/sys/identity/group/id/"+id)
+	if err := r.SetJSONBody(body); err != nil {
+		return err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+func (c *Sys) DeleteGroup(id string) error {
+	r := c.c.NewRequest("DELETE", "/v1/sys/identity/group/id/"+id)
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+// CreateGroupAlias maps an external group to the group with the given name
+// in the auth mount at mountPath, and returns the ID of the alias
+func (c *Sys) CreateGroupAlias(groupID, mountPath, name string) (string, error) {
+	body := map[string]interface{}{
+		"group_id":   groupID,
+		"mount_path": mountPath,
+		"name":       name,
+	}
+
+	r := c.c.NewRequest("PUT", "/v1/sys/identity/group-alias")
+	if err := r.SetJSONBody(body); err != nil {
+		return "", err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		ID string `json:"id"`
+	}
+	err = resp.DecodeJSON(&result)
+	return result.ID, err
+}
+
+func (c *Sys) DeleteGroupAlias(id string) error {
+	r := c.c.NewRequest("DELETE", "/v1/sys/identity/group-alias/id/"+id)
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+// Entity is the identity of a principal across the auth mounts it logs in
+// through
+type Entity struct {
+	ID              string            `json:"id"`
+	Name            string            `json:"name"`
+	Policies        []string          `json:"policies"`
+	Metadata        map[string]string `json:"metadata"`
+	Aliases         []*EntityAlias    `json:"aliases"`
+	MergedEntityIDs []string          `json:"merged_entity_ids"`
+	GroupIDs        []string          `json:"group_ids"`
+	CreationTime    time.Time         `json:"creation_time"`
+	LastUpdateTime  time.Time         `json:"last_update_time"`
+}
+
+// EntityAlias is the identity of an entity within an auth mount
+type EntityAlias struct {
+	ID             string            `json:"id"`
+	EntityID       string            `json:"entity_id"`
+	MountPath      string            `json:"mount_path"`
+	MountType      string            `json:"mount_type"`
+	Name           string            `json:"name"`
+	Metadata       map[string]string `json:"metadata"`
+	CreationTime   time.Time         `json:"creation_time"`
+	LastUpdateTime time.Time         `json:"last_update_time"`
+}
+
+// Group is a set of entities whose policies are granted to the tokens of
+// its members
+type Group struct {
+	ID              string            `json:"id"`
+	Name            string            `json:"name"`
+	Type            string            `json:"type"`
+	Policies        []string          `json:"policies"`
+	Metadata        map[string]string `json:"metadata"`
+	MemberEntityIDs []string          `json:"member_entity_ids"`
+	Alias           *GroupAlias       `json:"alias"`
+	CreationTime    time.Time         `json:"creation_time"`
+	LastUpdateTime  time.Time         `json:"last_update_time"`
+}
+
+// GroupAlias maps an external group to a group of an auth mount
+type GroupAlias struct {
+	ID           string    `json:"id"`
+	GroupID      string    `json:"group_id"`
+	MountPath    string    `json:"mount_path"`
+	MountType    string    `json:"mount_type"`
+	Name         string    `json:"name"`
+	CreationTime time.Time `json:"creation_time"`
+}
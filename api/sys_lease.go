@@ -1,5 +1,7 @@
 package api
 
+import "time"
+
 func (c *Sys) Renew(id string, increment int) (*Secret, error) {
 	r := c.c.NewRequest("PUT", "/v1/sys/renew")
 
@@ -46,3 +48,79 @@ func (c *Sys) RevokeForce(id string) error {
 	}
 	return err
 }
+
+func (c *Sys) TidyLeases(dryRun bool) (*LeaseTidyResult, error) {
+	r := c.c.NewRequest("PUT", "/v1/sys/leases/tidy")
+
+	body := map[string]interface{}{
+		"dry_run": dryRun,
+	}
+	if err := r.SetJSONBody(body); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := new(LeaseTidyResult)
+	err = resp.DecodeJSON(result)
+	return result, err
+}
+
+// LeaseTidyResult lists the leases left behind by missing mounts and
+// revoked tokens
+type LeaseTidyResult struct {
+	DryRun       bool     `json:"dry_run"`
+	TotalLeases  int      `json:"total_leases"`
+	MissingMount []string `json:"missing_mount"`
+	RevokedToken []string `json:"revoked_token"`
+	Failed       []string `json:"failed"`
+}
+
+func (c *Sys) LeaseCounts() (*LeaseCounts, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/leases/count")
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := new(LeaseCounts)
+	err = resp.DecodeJSON(result)
+	return result, err
+}
+
+func (c *Sys) IrrevocableLeases() (*IrrevocableLeases, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/leases/irrevocable")
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := new(IrrevocableLeases)
+	err = resp.DecodeJSON(result)
+	return result, err
+}
+
+type LeaseCounts struct {
+	LeaseCount            int `json:"lease_count"`
+	IrrevocableLeaseCount int `json:"irrevocable_lease_count"`
+}
+
+// IrrevocableLeases lists the leases that could not be revoked. LeaseCount
+// is their total number, which may exceed the number of leases listed.
+type IrrevocableLeases struct {
+	Leases     []*IrrevocableLease `json:"leases"`
+	LeaseCount int                 `json:"lease_count"`
+}
+
+type IrrevocableLease struct {
+	LeaseID    string    `json:"lease_id"`
+	Path       string    `json:"path"`
+	ExpireTime time.Time `json:"expire_time"`
+	Error      string    `json:"error"`
+}
@@ -0,0 +1,133 @@
+package api
+
+import "strings"
+
+func (c *Sys) ListMFAMethods() ([]string, error) {
+	return c.listMFA("/v1/sys/mfa/method")
+}
+
+// PutMFAMethod creates an MFA method of the given type, "totp", "duo" or
+// "pingid", or changes the given settings of an existing one.
+func (c *Sys) PutMFAMethod(mfaType, name string, config map[string]interface{}) error {
+	r := c.c.NewRequest("PUT", "/v1/sys/mfa/method/"+mfaType+"/"+name)
+	if err := r.SetJSONBody(config); err != nil {
+		return err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+func (c *Sys) DeleteMFAMethod(mfaType, name string) error {
+	r := c.c.NewRequest("DELETE", "/v1/sys/mfa/method/"+mfaType+"/"+name)
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+// GenerateMFATOTPSecret generates the secret of the entity of the token for
+// a TOTP method, and returns the otpauth URL to enroll it.
+func (c *Sys) GenerateMFATOTPSecret(name string) (string, error) {
+	r := c.c.NewRequest("PUT", "/v1/sys/mfa/totp/"+name+"/generate")
+	resp, err := c.c.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var result struct {
+		URL string `json:"url"`
+	}
+	err = resp.DecodeJSON(&result)
+	return result.URL, err
+}
+
+func (c *Sys) ListMFAEnforcements() ([]string, error) {
+	return c.listMFA("/v1/sys/mfa/enforcement")
+}
+
+func (c *Sys) MFAEnforcement(name string) (*MFAEnforcement, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/mfa/enforcement/"+name)
+	resp, err := c.c.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if resp != nil && resp.StatusCode == 404 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := new(MFAEnforcement)
+	err = resp.DecodeJSON(result)
+	return result, err
+}
+
+func (c *Sys) PutMFAEnforcement(enforcement *MFAEnforcement) error {
+	body := map[string]interface{}{
+		"mfa_method_names":    strings.Join(enforcement.MFAMethodNames, ","),
+		"auth_mounts":         strings.Join(enforcement.AuthMounts, ","),
+		"identity_entity_ids": strings.Join(enforcement.IdentityEntityIDs, ","),
+		"paths":               strings.Join(enforcement.Paths, ","),
+	}
+
+	r := c.c.NewRequest("PUT", "/v1/sys/mfa/enforcement/"+enforcement.Name)
+	if err := r.SetJSONBody(body); err != nil {
+		return err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+func (c *Sys) DeleteMFAEnforcement(name string) error {
+	r := c.c.NewRequest("DELETE", "/v1/sys/mfa/enforcement/"+name)
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+func (c *Sys) listMFA(path string) ([]string, error) {
+	r := c.c.NewRequest("GET", path)
+	r.Params.Set("list", "true")
+	resp, err := c.c.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if resp != nil && resp.StatusCode == 404 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Keys []string `json:"keys"`
+	}
+	err = resp.DecodeJSON(&result)
+	return result.Keys, err
+}
+
+// MFAEnforcement requires each of MFAMethodNames for the logins through
+// AuthMounts and of IdentityEntityIDs, or for all logins if both are empty.
+// If Paths is set, the methods are instead required on requests to Paths.
+type MFAEnforcement struct {
+	Name              string   `json:"name"`
+	MFAMethodNames    []string `json:"mfa_method_names"`
+	AuthMounts        []string `json:"auth_mounts"`
+	IdentityEntityIDs []string `json:"identity_entity_ids"`
+	Paths             []string `json:"paths"`
+}
@@ -0,0 +1,42 @@
+package api
+
+func (c *Sys) ListNamespaces() ([]string, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/namespaces")
+	r.Params.Set("list", "true")
+	resp, err := c.c.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if resp != nil && resp.StatusCode == 404 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Keys []string `json:"keys"`
+	}
+	err = resp.DecodeJSON(&result)
+	return result.Keys, err
+}
+
+// CreateNamespace creates the namespace with the given name under the
+// namespace of the client
+func (c *Sys) CreateNamespace(name string) error {
+	r := c.c.NewRequest("PUT", "/v1/sys/namespaces/"+name)
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+func (c *Sys) DeleteNamespace(name string) error {
+	r := c.c.NewRequest("DELETE", "/v1/sys/namespaces/"+name)
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
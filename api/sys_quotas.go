@@ -0,0 +1,156 @@
+package api
+
+func (c *Sys) ListLeaseCountQuotas() ([]string, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/quotas/lease-count")
+	r.Params.Set("list", "true")
+	resp, err := c.c.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if resp != nil && resp.StatusCode == 404 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Keys []string `json:"keys"`
+	}
+	err = resp.DecodeJSON(&result)
+	return result.Keys, err
+}
+
+func (c *Sys) LeaseCountQuota(name string) (*LeaseCountQuota, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/quotas/lease-count/"+name)
+	resp, err := c.c.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if resp != nil && resp.StatusCode == 404 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := new(LeaseCountQuota)
+	err = resp.DecodeJSON(result)
+	return result, err
+}
+
+func (c *Sys) PutLeaseCountQuota(quota *LeaseCountQuota) error {
+	body := map[string]interface{}{
+		"path":       quota.Path,
+		"role":       quota.Role,
+		"max_leases": quota.MaxLeases,
+	}
+
+	r := c.c.NewRequest("PUT", "/v1/sys/quotas/lease-count/"+quota.Name)
+	if err := r.SetJSONBody(body); err != nil {
+		return err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+func (c *Sys) DeleteLeaseCountQuota(name string) error {
+	r := c.c.NewRequest("DELETE", "/v1/sys/quotas/lease-count/"+name)
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+// LeaseCountQuota caps the number of active leases issued under Path.
+// ActiveLeases is only set when reading a quota.
+type LeaseCountQuota struct {
+	Name         string `json:"name"`
+	Path         string `json:"path"`
+	Role         string `json:"role"`
+	MaxLeases    int    `json:"max_leases"`
+	ActiveLeases int    `json:"active_leases"`
+}
+
+func (c *Sys) ListRateLimitQuotas() ([]string, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/quotas/rate-limit")
+	r.Params.Set("list", "true")
+	resp, err := c.c.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if resp != nil && resp.StatusCode == 404 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Keys []string `json:"keys"`
+	}
+	err = resp.DecodeJSON(&result)
+	return result.Keys, err
+}
+
+func (c *Sys) RateLimitQuota(name string) (*RateLimitQuota, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/quotas/rate-limit/"+name)
+	resp, err := c.c.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if resp != nil && resp.StatusCode == 404 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := new(RateLimitQuota)
+	err = resp.DecodeJSON(result)
+	return result, err
+}
+
+func (c *Sys) PutRateLimitQuota(quota *RateLimitQuota) error {
+	body := map[string]interface{}{
+		"path":           quota.Path,
+		"rate":           quota.Rate,
+		"burst":          quota.Burst,
+		"block_interval": quota.BlockInterval,
+	}
+
+	r := c.c.NewRequest("PUT", "/v1/sys/quotas/rate-limit/"+quota.Name)
+	if err := r.SetJSONBody(body); err != nil {
+		return err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+func (c *Sys) DeleteRateLimitQuota(name string) error {
+	r := c.c.NewRequest("DELETE", "/v1/sys/quotas/rate-limit/"+name)
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+// RateLimitQuota limits the rate of the requests under Path to Rate per
+// second. BlockInterval is in seconds.
+type RateLimitQuota struct {
+	Name          string  `json:"name"`
+	Path          string  `json:"path"`
+	Rate          float64 `json:"rate"`
+	Burst         int     `json:"burst"`
+	BlockInterval int64   `json:"block_interval"`
+}
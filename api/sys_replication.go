@@ -0,0 +1,175 @@
+package api
+
+import (
+	"strings"
+	"time"
+)
+
+func (c *Sys) DRReplicationStatus() (*DRReplicationStatusResponse, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/replication/dr/status")
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result DRReplicationStatusResponse
+	err = resp.DecodeJSON(&result)
+	return &result, err
+}
+
+func (c *Sys) EnableDRPrimary() error {
+	return c.putDRReplication("/v1/sys/replication/dr/primary/enable", nil)
+}
+
+func (c *Sys) DisableDRPrimary() error {
+	return c.putDRReplication("/v1/sys/replication/dr/primary/disable", nil)
+}
+
+// DRSecondaryToken registers a DR secondary with the given ID, and returns
+// the activation token to enable it with. If primaryAPIAddr is empty, the
+// secondary reaches the primary at the redirect address of the active node.
+func (c *Sys) DRSecondaryToken(id, primaryAPIAddr string) (string, error) {
+	return c.DRSecondaryTokenWithFilter(id, primaryAPIAddr, nil)
+}
+
+// DRSecondaryTokenWithFilter is like DRSecondaryToken, but only the mounts
+// selected by the path filter are replicated to the secondary
+func (c *Sys) DRSecondaryTokenWithFilter(id, primaryAPIAddr string, filter *DRPathFilter) (string, error) {
+	body := map[string]interface{}{
+		"id":               id,
+		"primary_api_addr": primaryAPIAddr,
+	}
+	if filter != nil {
+		body["mode"] = filter.Mode
+		body["paths"] = strings.Join(filter.Paths, ",")
+	}
+
+	r := c.c.NewRequest("PUT", "/v1/sys/replication/dr/primary/secondary-token")
+	if err := r.SetJSONBody(body); err != nil {
+		return "", err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	secret, err := ParseSecret(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if secret == nil || secret.Data == nil {
+		return "", nil
+	}
+	token, _ := secret.Data["token"].(string)
+	return token, nil
+}
+
+func (c *Sys) RevokeDRSecondary(id string) error {
+	return c.putDRReplication("/v1/sys/replication/dr/primary/revoke-secondary", map[string]interface{}{
+		"id": id,
+	})
+}
+
+// EnableDRSecondary makes the cluster a DR secondary given the activation
+// token of the primary. The cluster is sealed and its data is replaced.
+func (c *Sys) EnableDRSecondary(token, primaryAPIAddr, caCert string) error {
+	return c.putDRReplication("/v1/sys/replication/dr/secondary/enable", map[string]interface{}{
+		"token":            token,
+		"primary_api_addr": primaryAPIAddr,
+		"ca_cert":          caCert,
+	})
+}
+
+func (c *Sys) DRFailoverTokenStatus() (*DRFailoverTokenStatusResponse, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/replication/dr/failover-token")
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result DRFailoverTokenStatusResponse
+	err = resp.DecodeJSON(&result)
+	return &result, err
+}
+
+func (c *Sys) DRFailoverTokenUpdate(shard string) (*DRFailoverTokenStatusResponse, error) {
+	body := map[string]interface{}{
+		"key": shard,
+	}
+
+	r := c.c.NewRequest("PUT", "/v1/sys/replication/dr/failover-token")
+	if err := r.SetJSONBody(body); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result DRFailoverTokenStatusResponse
+	err = resp.DecodeJSON(&result)
+	return &result, err
+}
+
+func (c *Sys) DRFailoverTokenCancel() error {
+	r := c.c.NewRequest("DELETE", "/v1/sys/replication/dr/failover-token")
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+func (c *Sys) PromoteDRSecondary(failoverToken string) error {
+	return c.putDRReplication("/v1/sys/replication/dr/promote", map[string]interface{}{
+		"failover_token": failoverToken,
+	})
+}
+
+func (c *Sys) putDRReplication(path string, body map[string]interface{}) error {
+	r := c.c.NewRequest("PUT", path)
+	if body != nil {
+		if err := r.SetJSONBody(body); err != nil {
+			return err
+		}
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+type DRReplicationStatusResponse struct {
+	Mode            string    `json:"mode"`
+	Epoch           string    `json:"epoch"`
+	Index           uint64    `json:"index"`
+	Secondaries     []string  `json:"secondaries"`
+	PrimaryAPIAddr  string    `json:"primary_api_addr"`
+	State           string    `json:"state"`
+	LastRemoteIndex uint64    `json:"last_remote_index"`
+	LastSync        time.Time `json:"last_sync"`
+	LastError       string    `json:"last_error"`
+}
+
+type DRFailoverTokenStatusResponse struct {
+	Progress      int    `json:"progress"`
+	Required      int    `json:"required"`
+	Complete      bool   `json:"complete"`
+	FailoverToken string `json:"failover_token"`
+}
+
+// DRPathFilter selects the mounts replicated to a DR secondary. Mode is
+// "allow" to only replicate the mounts under the paths, or "deny" to
+// replicate all the mounts but those.
+type DRPathFilter struct {
+	Mode  string
+	Paths []string
+}
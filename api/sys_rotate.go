@@ -24,7 +24,43 @@ func (c *Sys) KeyStatus() (*KeyStatus, error) {
 	return result, err
 }
 
+func (c *Sys) RotationConfig() (*RotationConfig, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/rotate/config")
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := new(RotationConfig)
+	err = resp.DecodeJSON(result)
+	return result, err
+}
+
+func (c *Sys) ConfigureRotation(config *RotationConfig) error {
+	r := c.c.NewRequest("PUT", "/v1/sys/rotate/config")
+	if err := r.SetJSONBody(config); err != nil {
+		return err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
 type KeyStatus struct {
 	Term        int       `json:"term"`
 	InstallTime time.Time `json:"install_time"`
+	Encryptions uint64    `json:"encryptions"`
+	Cipher      string    `json:"cipher"`
+}
+
+// RotationConfig is the policy for rotating the encryption key
+// automatically. Interval is in seconds.
+type RotationConfig struct {
+	Enabled       bool   `json:"enabled"`
+	MaxOperations uint64 `json:"max_operations"`
+	Interval      int64  `json:"interval"`
 }
@@ -49,11 +49,19 @@ func sealStatusRequest(c *Sys, r *Request) (*SealStatusResponse, error) {
 }
 
 type SealStatusResponse struct {
-	Sealed      bool   `json:"sealed"`
-	T           int    `json:"t"`
-	N           int    `json:"n"`
-	Progress    int    `json:"progress"`
-	Version     string `json:"version"`
-	ClusterName string `json:"cluster_name,omitempty"`
-	ClusterID   string `json:"cluster_id,omitempty"`
+	Type        string              `json:"type"`
+	Sealed      bool                `json:"sealed"`
+	T           int                 `json:"t"`
+	N           int                 `json:"n"`
+	Progress    int                 `json:"progress"`
+	Version     string              `json:"version"`
+	ClusterName string              `json:"cluster_name,omitempty"`
+	ClusterID   string              `json:"cluster_id,omitempty"`
+	SealHealth  *SealHealthResponse `json:"seal_health,omitempty"`
+}
+
+type SealHealthResponse struct {
+	Healthy     bool   `json:"healthy"`
+	LastChecked string `json:"last_checked"`
+	Error       string `json:"error,omitempty"`
 }
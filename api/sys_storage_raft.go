@@ -0,0 +1,101 @@
+package api
+
+import (
+	"io"
+	"io/ioutil"
+)
+
+// RaftPeer is a node of the raft cluster
+type RaftPeer struct {
+	NodeID  string `json:"node_id"`
+	Address string `json:"address"`
+	Leader  bool   `json:"leader"`
+	Voter   bool   `json:"voter"`
+}
+
+// RaftJoin adds the node with the given ID and raft address to the raft
+// cluster
+func (c *Sys) RaftJoin(nodeID, address string) error {
+	body := map[string]interface{}{
+		"node_id": nodeID,
+		"address": address,
+	}
+
+	r := c.c.NewRequest("PUT", "/v1/sys/storage/raft/join")
+	if err := r.SetJSONBody(body); err != nil {
+		return err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+// RaftConfiguration returns the nodes of the raft cluster
+func (c *Sys) RaftConfiguration() ([]*RaftPeer, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/storage/raft/configuration")
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Data struct {
+			Servers []*RaftPeer `json:"servers"`
+		} `json:"data"`
+	}
+	err = resp.DecodeJSON(&result)
+	return result.Data.Servers, err
+}
+
+// RaftRemovePeer removes the node with the given ID from the raft cluster
+func (c *Sys) RaftRemovePeer(nodeID string) error {
+	body := map[string]interface{}{
+		"node_id": nodeID,
+	}
+
+	r := c.c.NewRequest("PUT", "/v1/sys/storage/raft/remove-peer")
+	if err := r.SetJSONBody(body); err != nil {
+		return err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+// RaftSnapshot writes a snapshot of the raft storage to w
+func (c *Sys) RaftSnapshot(w io.Writer) error {
+	r := c.c.NewRequest("GET", "/v1/sys/storage/raft/snapshot")
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// RaftSnapshotRestore replaces the data of the raft cluster with the
+// snapshot read from snapshot. The active node is sealed afterwards.
+func (c *Sys) RaftSnapshotRestore(snapshot io.Reader) error {
+	body, err := ioutil.ReadAll(snapshot)
+	if err != nil {
+		return err
+	}
+
+	r := c.c.NewRequest("POST", "/v1/sys/storage/raft/snapshot")
+	r.SetRawBody("application/octet-stream", body)
+
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
@@ -0,0 +1,121 @@
+package api
+
+func (c *Sys) ListStorageSnapshotConfigs() ([]string, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/storage/snapshots/config")
+	r.Params.Set("list", "true")
+	resp, err := c.c.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if resp != nil && resp.StatusCode == 404 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Keys []string `json:"keys"`
+	}
+	err = resp.DecodeJSON(&result)
+	return result.Keys, err
+}
+
+func (c *Sys) StorageSnapshotConfig(name string) (*StorageSnapshotConfig, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/storage/snapshots/config/"+name)
+	resp, err := c.c.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if resp != nil && resp.StatusCode == 404 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := new(StorageSnapshotConfig)
+	err = resp.DecodeJSON(result)
+	return result, err
+}
+
+func (c *Sys) PutStorageSnapshotConfig(config *StorageSnapshotConfig) error {
+	r := c.c.NewRequest("PUT", "/v1/sys/storage/snapshots/config/"+config.Name)
+	if err := r.SetJSONBody(config); err != nil {
+		return err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+func (c *Sys) DeleteStorageSnapshotConfig(name string) error {
+	r := c.c.NewRequest("DELETE", "/v1/sys/storage/snapshots/config/"+name)
+	resp, err := c.c.RawRequest(r)
+	if err == nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+func (c *Sys) StorageSnapshotStatus(name string) (*StorageSnapshotStatus, error) {
+	r := c.c.NewRequest("GET", "/v1/sys/storage/snapshots/status/"+name)
+	resp, err := c.c.RawRequest(r)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if resp != nil && resp.StatusCode == 404 {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	result := new(StorageSnapshotStatus)
+	err = resp.DecodeJSON(result)
+	return result, err
+}
+
+// StorageSnapshotConfig configures snapshots of the storage taken every
+// Interval seconds and uploaded to StorageType. The secret keys are not
+// returned when reading a configuration.
+type StorageSnapshotConfig struct {
+	Name        string `json:"name"`
+	Interval    int64  `json:"interval"`
+	Retain      int    `json:"retain,omitempty"`
+	StorageType string `json:"storage_type"`
+	PathPrefix  string `json:"path_prefix,omitempty"`
+	FilePrefix  string `json:"file_prefix,omitempty"`
+
+	AWSS3Bucket         string `json:"aws_s3_bucket,omitempty"`
+	AWSS3Region         string `json:"aws_s3_region,omitempty"`
+	AWSS3Endpoint       string `json:"aws_s3_endpoint,omitempty"`
+	AWSS3ForcePathStyle bool   `json:"aws_s3_force_path_style,omitempty"`
+	AWSAccessKeyID      string `json:"aws_access_key_id,omitempty"`
+	AWSSecretAccessKey  string `json:"aws_secret_access_key,omitempty"`
+
+	GoogleGCSBucket             string `json:"google_gcs_bucket,omitempty"`
+	GoogleGCSEndpoint           string `json:"google_gcs_endpoint,omitempty"`
+	GoogleServiceAccountKeyFile string `json:"google_service_account_key_file,omitempty"`
+
+	AzureContainerName string `json:"azure_container_name,omitempty"`
+	AzureAccountName   string `json:"azure_account_name,omitempty"`
+	AzureAccountKey    string `json:"azure_account_key,omitempty"`
+}
+
+// StorageSnapshotStatus is the outcome of the automated snapshots of a
+// configuration. The times are in RFC 3339 format, and empty before the
+// first snapshot.
+type StorageSnapshotStatus struct {
+	LastSnapshotStart  string `json:"last_snapshot_start"`
+	LastSnapshotEnd    string `json:"last_snapshot_end"`
+	LastSnapshotURL    string `json:"last_snapshot_url"`
+	LastSnapshotSHA256 string `json:"last_snapshot_sha256"`
+	LastSnapshotKeys   int    `json:"last_snapshot_keys"`
+	LastSnapshotError  string `json:"last_snapshot_error"`
+	ConsecutiveErrors  int    `json:"consecutive_errors"`
+	NextSnapshotStart  string `json:"next_snapshot_start"`
+}
@@ -0,0 +1,102 @@
+package api
+
+func (c *Sys) TokenAccessors(filter *TokenFilter) (*TokenAccessors, error) {
+	r := c.c.NewRequest("PUT", "/v1/sys/tokens/accessors")
+	if err := r.SetJSONBody(filter.body()); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := new(TokenAccessors)
+	err = resp.DecodeJSON(result)
+	return result, err
+}
+
+func (c *Sys) RevokeTokens(filter *TokenFilter, dryRun bool) (*TokenRevokeResult, error) {
+	r := c.c.NewRequest("PUT", "/v1/sys/tokens/revoke")
+
+	body := filter.body()
+	body["dry_run"] = dryRun
+	if err := r.SetJSONBody(body); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.c.RawRequest(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := new(TokenRevokeResult)
+	err = resp.DecodeJSON(result)
+	return result, err
+}
+
+// TokenFilter selects tokens by their properties; empty fields match all
+// the tokens. CreatedAfter and CreatedBefore are RFC 3339 times, and the
+// TTLs are in seconds.
+type TokenFilter struct {
+	Policy        string
+	PathPrefix    string
+	CreatedAfter  string
+	CreatedBefore string
+	MinTTL        int
+	MaxTTL        int
+}
+
+func (f *TokenFilter) body() map[string]interface{} {
+	body := map[string]interface{}{}
+	if f == nil {
+		return body
+	}
+	if f.Policy != "" {
+		body["policy"] = f.Policy
+	}
+	if f.PathPrefix != "" {
+		body["path_prefix"] = f.PathPrefix
+	}
+	if f.CreatedAfter != "" {
+		body["created_after"] = f.CreatedAfter
+	}
+	if f.CreatedBefore != "" {
+		body["created_before"] = f.CreatedBefore
+	}
+	if f.MinTTL != 0 {
+		body["min_ttl"] = f.MinTTL
+	}
+	if f.MaxTTL != 0 {
+		body["max_ttl"] = f.MaxTTL
+	}
+	return body
+}
+
+type TokenAccessors struct {
+	Tokens     []*TokenAccessorInfo `json:"tokens"`
+	TokenCount int                  `json:"token_count"`
+}
+
+// TokenAccessorInfo describes a token listed by its accessor. CreationTTL
+// is in seconds.
+type TokenAccessorInfo struct {
+	Accessor     string   `json:"accessor"`
+	Path         string   `json:"path"`
+	Policies     []string `json:"policies"`
+	DisplayName  string   `json:"display_name"`
+	CreationTime int64    `json:"creation_time"`
+	CreationTTL  int64    `json:"creation_ttl"`
+}
+
+// TokenRevokeResult lists the accessors of the tokens revoked by filter.
+// Failed maps the accessors of the tokens that could not be revoked to the
+// error.
+type TokenRevokeResult struct {
+	DryRun  bool              `json:"dry_run"`
+	Revoked []string          `json:"revoked"`
+	Failed  map[string]string `json:"failed"`
+	Total   int               `json:"total"`
+}
@@ -0,0 +1,325 @@
+package audit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/hashicorp/vault/helper/strutil"
+)
+
+// FilterInput holds the values of a request a Filter is evaluated against
+type FilterInput struct {
+	// Path is the path of the request, such as "secret/foo"
+	Path string
+
+	// MountPath is the path of the mount serving the request, such as
+	// "secret/"
+	MountPath string
+
+	// Operation is the operation of the request, such as "read"
+	Operation string
+
+	// Policies are the policies of the token of the request
+	Policies []string
+
+	// Namespace is the path of the namespace of the request, such as
+	// "ns1/", or the empty string for the root namespace
+	Namespace string
+}
+
+// filterStringFields are the fields compared as strings
+var filterStringFields = map[string]func(*FilterInput) string{
+	"path":       func(in *FilterInput) string { return in.Path },
+	"mount_path": func(in *FilterInput) string { return in.MountPath },
+	"operation":  func(in *FilterInput) string { return in.Operation },
+	"namespace":  func(in *FilterInput) string { return in.Namespace },
+}
+
+// Filter is a boolean expression selecting the requests an audit backend
+// logs, such as:
+//
+//     not (operation == "read" and mount_path == "secret/")
+//
+// Comparisons are combined with "and", "or", "not" and parentheses. The
+// path, mount_path, operation and namespace fields support "==", "!=" and
+// "matches", which takes a pattern where "*" matches any characters. The
+// policies field supports "contains".
+type Filter struct {
+	raw  string
+	root filterNode
+}
+
+// ParseFilter parses a filter expression
+func ParseFilter(raw string) (*Filter, error) {
+	tokens, err := tokenizeFilter(raw)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("unexpected %q in filter", p.peek().text)
+	}
+	return &Filter{raw: raw, root: root}, nil
+}
+
+// String returns the expression the filter was parsed from
+func (f *Filter) String() string {
+	return f.raw
+}
+
+// Evaluate returns whether the request matches the filter
+func (f *Filter) Evaluate(in *FilterInput) bool {
+	return f.root.eval(in)
+}
+
+type filterNode interface {
+	eval(*FilterInput) bool
+}
+
+type filterAnd struct{ left, right filterNode }
+
+func (n *filterAnd) eval(in *FilterInput) bool { return n.left.eval(in) && n.right.eval(in) }
+
+type filterOr struct{ left, right filterNode }
+
+func (n *filterOr) eval(in *FilterInput) bool { return n.left.eval(in) || n.right.eval(in) }
+
+type filterNot struct{ node filterNode }
+
+func (n *filterNot) eval(in *FilterInput) bool { return !n.node.eval(in) }
+
+type filterCompare struct {
+	field func(*FilterInput) string
+	op    string
+	value string
+}
+
+func (n *filterCompare) eval(in *FilterInput) bool {
+	actual := n.field(in)
+	switch n.op {
+	case "==":
+		return actual == n.value
+	case "!=":
+		return actual != n.value
+	default:
+		return globMatch(n.value, actual)
+	}
+}
+
+type filterContains struct{ value string }
+
+func (n *filterContains) eval(in *FilterInput) bool {
+	return strutil.StrListContains(in.Policies, n.value)
+}
+
+// globMatch returns whether the value matches the pattern, where "*"
+// matches any characters
+func globMatch(pattern, value string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == value
+	}
+	if !strings.HasPrefix(value, parts[0]) {
+		return false
+	}
+	value = value[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(value, part)
+		if i < 0 {
+			return false
+		}
+		value = value[i+len(part):]
+	}
+	return len(value) >= len(last) && strings.HasSuffix(value, last)
+}
+
+type filterTokenKind int
+
+const (
+	filterTokenWord filterTokenKind = iota
+	filterTokenString
+	filterTokenOp
+	filterTokenParen
+)
+
+type filterToken struct {
+	kind filterTokenKind
+	text string
+}
+
+func tokenizeFilter(raw string) ([]filterToken, error) {
+	var tokens []filterToken
+	for i := 0; i < len(raw); {
+		c := raw[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')':
+			tokens = append(tokens, filterToken{filterTokenParen, string(c)})
+			i++
+		case c == '=' || c == '!':
+			if i+1 >= len(raw) || raw[i+1] != '=' {
+				return nil, fmt.Errorf("invalid operator at offset %d in filter", i)
+			}
+			tokens = append(tokens, filterToken{filterTokenOp, raw[i : i+2]})
+			i += 2
+		case c == '"':
+			end := i + 1
+			for ; end < len(raw) && raw[end] != '"'; end++ {
+				if raw[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(raw) {
+				return nil, fmt.Errorf("unterminated string at offset %d in filter", i)
+			}
+			value, err := strconv.Unquote(raw[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at offset %d in filter: %v", i, err)
+			}
+			tokens = append(tokens, filterToken{filterTokenString, value})
+			i = end + 1
+		case c == '_' || unicode.IsLetter(rune(c)):
+			end := i
+			for end < len(raw) && (raw[end] == '_' || unicode.IsLetter(rune(raw[end]))) {
+				end++
+			}
+			tokens = append(tokens, filterToken{filterTokenWord, raw[i:end]})
+			i = end
+		default:
+			return nil, fmt.Errorf("unexpected %q at offset %d in filter", c, i)
+		}
+	}
+	return tokens, nil
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *filterParser) peek() filterToken {
+	if p.done() {
+		return filterToken{}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *filterParser) next() (filterToken, error) {
+	if p.done() {
+		return filterToken{}, fmt.Errorf("unexpected end of filter")
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	return t, nil
+}
+
+func (p *filterParser) isWord(word string) bool {
+	t := p.peek()
+	return !p.done() && t.kind == filterTokenWord && t.text == word
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isWord("or") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &filterOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isWord("and") {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &filterAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filterNode, error) {
+	if p.isWord("not") {
+		p.pos++
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &filterNot{node}, nil
+	}
+
+	t, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if t.kind == filterTokenParen && t.text == "(" {
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t, err := p.next(); err != nil || t.kind != filterTokenParen || t.text != ")" {
+			return nil, fmt.Errorf("missing closing parenthesis in filter")
+		}
+		return node, nil
+	}
+	if t.kind != filterTokenWord {
+		return nil, fmt.Errorf("unexpected %q in filter, expected a field", t.text)
+	}
+	return p.parseComparison(t.text)
+}
+
+func (p *filterParser) parseComparison(field string) (filterNode, error) {
+	op, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	value, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if value.kind != filterTokenString {
+		return nil, fmt.Errorf("expected a quoted string after %s %s in filter", field, op.text)
+	}
+
+	if field == "policies" {
+		if op.kind != filterTokenWord || op.text != "contains" {
+			return nil, fmt.Errorf("policies only supports contains in filter")
+		}
+		return &filterContains{value.text}, nil
+	}
+
+	getter, ok := filterStringFields[field]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %q in filter", field)
+	}
+	switch {
+	case op.kind == filterTokenOp, op.kind == filterTokenWord && op.text == "matches":
+	default:
+		return nil, fmt.Errorf("%s does not support %q in filter", field, op.text)
+	}
+	return &filterCompare{field: getter, op: op.text, value: value.text}, nil
+}
@@ -0,0 +1,86 @@
+package audit
+
+import (
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	in := &FilterInput{
+		Path:      "secret/foo/bar",
+		MountPath: "secret/",
+		Operation: "read",
+		Policies:  []string{"default", "ops"},
+		Namespace: "ns1/",
+	}
+
+	cases := map[string]bool{
+		`operation == "read"`:                               true,
+		`operation != "read"`:                               false,
+		`mount_path == "secret/" and operation == "update"`: false,
+		`mount_path == "secret/" or operation == "update"`:  true,
+		`not mount_path == "secret/"`:                       false,
+		`not (operation == "read" and mount_path == "kv/")`: true,
+		`path matches "secret/*"`:                           true,
+		`path matches "*/foo/*"`:                            true,
+		`path matches "*bar"`:                               true,
+		`path matches "sys/*"`:                              false,
+		`policies contains "ops"`:                           true,
+		`policies contains "admin"`:                         false,
+		`namespace == "ns1/"`:                               true,
+		`namespace == "" or policies contains "ops"`:        true,
+		// "and" binds tighter than "or"
+		`operation == "read" or operation == "list" and path == "x"`:   true,
+		`operation == "list" and path == "x" or namespace == "ns1/"`:   true,
+		`operation == "list" and (path == "x" or namespace == "ns1/")`: false,
+	}
+	for raw, expected := range cases {
+		filter, err := ParseFilter(raw)
+		if err != nil {
+			t.Fatalf("err parsing %q: %v", raw, err)
+		}
+		if actual := filter.Evaluate(in); actual != expected {
+			t.Fatalf("bad result for %q: %v", raw, actual)
+		}
+	}
+}
+
+func TestParseFilter_invalid(t *testing.T) {
+	for _, raw := range []string{
+		`operation`,
+		`operation ==`,
+		`operation == read`,
+		`operation = "read"`,
+		`unknown == "x"`,
+		`policies == "ops"`,
+		`path contains "x"`,
+		`(operation == "read"`,
+		`operation == "read")`,
+		`operation == "read" and`,
+		`operation == "read`,
+	} {
+		if _, err := ParseFilter(raw); err == nil {
+			t.Fatalf("expected error parsing %q", raw)
+		}
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	cases := []struct {
+		pattern, value string
+		expected       bool
+	}{
+		{"abc", "abc", true},
+		{"abc", "abcd", false},
+		{"a*", "abc", true},
+		{"*c", "abc", true},
+		{"a*c", "ac", true},
+		{"a*b*c", "abbc", true},
+		{"ab*bc", "abc", false},
+		{"*", "", true},
+	}
+	for _, c := range cases {
+		if actual := globMatch(c.pattern, c.value); actual != c.expected {
+			t.Fatalf("bad result for %q %q: %v", c.pattern, c.value, actual)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 	"time"
 
+	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/logical"
 )
 
@@ -23,31 +24,38 @@ func (f *FormatJSON) FormatRequest(
 		auth = new(logical.Auth)
 	}
 	var errString string
+	var errCode errutil.Code
 	if err != nil {
 		errString = err.Error()
+		errCode = errutil.CodeOf(err)
 	}
 
 	// Encode!
 	enc := json.NewEncoder(w)
 	return enc.Encode(&JSONRequestEntry{
-		Time:  time.Now().UTC().Format(time.RFC3339Nano),
-		Type:  "request",
-		Error: errString,
+		Time:          time.Now().UTC().Format(time.RFC3339Nano),
+		Type:          "request",
+		SchemaVersion: SchemaVersion,
+		Error:         errString,
+		ErrorCode:     string(errCode),
 
 		Auth: JSONAuth{
 			DisplayName: auth.DisplayName,
 			Policies:    auth.Policies,
 			Metadata:    auth.Metadata,
+			EntityID:    auth.EntityID,
 		},
 
 		Request: JSONRequest{
-			ClientToken: req.ClientToken,
-			ID:          req.ID,
-			Operation:   req.Operation,
-			Path:        req.Path,
-			Data:        req.Data,
-			RemoteAddr:  getRemoteAddr(req),
-			WrapTTL:     int(req.WrapTTL / time.Second),
+			ClientToken:   req.ClientToken,
+			ID:            req.ID,
+			Operation:     req.Operation,
+			Path:          req.Path,
+			Data:          req.Data,
+			RemoteAddr:    getRemoteAddr(req),
+			WrapTTL:       int(req.WrapTTL / time.Second),
+			PolicyReasons: req.PolicyReasons,
+			MFAValidated:  req.MFAValidated,
 		},
 	})
 }
@@ -66,8 +74,10 @@ func (f *FormatJSON) FormatResponse(
 		resp = new(logical.Response)
 	}
 	var errString string
+	var errCode errutil.Code
 	if err != nil {
 		errString = err.Error()
+		errCode = errutil.CodeOf(err)
 	}
 
 	var respAuth *JSONAuth
@@ -78,6 +88,7 @@ func (f *FormatJSON) FormatResponse(
 			DisplayName: resp.Auth.DisplayName,
 			Policies:    resp.Auth.Policies,
 			Metadata:    resp.Auth.Metadata,
+			EntityID:    resp.Auth.EntityID,
 		}
 	}
 
@@ -94,6 +105,7 @@ func (f *FormatJSON) FormatResponse(
 			TTL:             int(resp.WrapInfo.TTL / time.Second),
 			Token:           resp.WrapInfo.Token,
 			CreationTime:    resp.WrapInfo.CreationTime,
+			Accessor:        resp.WrapInfo.Accessor,
 			WrappedAccessor: resp.WrapInfo.WrappedAccessor,
 		}
 	}
@@ -101,24 +113,29 @@ func (f *FormatJSON) FormatResponse(
 	// Encode!
 	enc := json.NewEncoder(w)
 	return enc.Encode(&JSONResponseEntry{
-		Time:  time.Now().UTC().Format(time.RFC3339Nano),
-		Type:  "response",
-		Error: errString,
+		Time:          time.Now().UTC().Format(time.RFC3339Nano),
+		Type:          "response",
+		SchemaVersion: SchemaVersion,
+		Error:         errString,
+		ErrorCode:     string(errCode),
 
 		Auth: JSONAuth{
 			DisplayName: auth.DisplayName,
 			Policies:    auth.Policies,
 			Metadata:    auth.Metadata,
+			EntityID:    auth.EntityID,
 		},
 
 		Request: JSONRequest{
-			ClientToken: req.ClientToken,
-			ID:          req.ID,
-			Operation:   req.Operation,
-			Path:        req.Path,
-			Data:        req.Data,
-			RemoteAddr:  getRemoteAddr(req),
-			WrapTTL:     int(req.WrapTTL / time.Second),
+			ClientToken:   req.ClientToken,
+			ID:            req.ID,
+			Operation:     req.Operation,
+			Path:          req.Path,
+			Data:          req.Data,
+			RemoteAddr:    getRemoteAddr(req),
+			WrapTTL:       int(req.WrapTTL / time.Second),
+			PolicyReasons: req.PolicyReasons,
+			MFAValidated:  req.MFAValidated,
 		},
 
 		Response: JSONResponse{
@@ -133,21 +150,25 @@ func (f *FormatJSON) FormatResponse(
 
 // JSONRequest is the structure of a request audit log entry in JSON.
 type JSONRequestEntry struct {
-	Time    string      `json:"time"`
-	Type    string      `json:"type"`
-	Auth    JSONAuth    `json:"auth"`
-	Request JSONRequest `json:"request"`
-	Error   string      `json:"error"`
+	Time          string      `json:"time"`
+	Type          string      `json:"type"`
+	SchemaVersion int         `json:"schema_version"`
+	Auth          JSONAuth    `json:"auth"`
+	Request       JSONRequest `json:"request"`
+	Error         string      `json:"error"`
+	ErrorCode     string      `json:"error_code,omitempty"`
 }
 
 // JSONResponseEntry is the structure of a response audit log entry in JSON.
 type JSONResponseEntry struct {
-	Time     string       `json:"time"`
-	Type     string       `json:"type"`
-	Error    string       `json:"error"`
-	Auth     JSONAuth     `json:"auth"`
-	Request  JSONRequest  `json:"request"`
-	Response JSONResponse `json:"response"`
+	Time          string       `json:"time"`
+	Type          string       `json:"type"`
+	SchemaVersion int          `json:"schema_version"`
+	Error         string       `json:"error"`
+	ErrorCode     string       `json:"error_code,omitempty"`
+	Auth          JSONAuth     `json:"auth"`
+	Request       JSONRequest  `json:"request"`
+	Response      JSONResponse `json:"response"`
 }
 
 type JSONRequest struct {
@@ -158,6 +179,14 @@ type JSONRequest struct {
 	Data        map[string]interface{} `json:"data"`
 	RemoteAddr  string                 `json:"remote_address"`
 	WrapTTL     int                    `json:"wrap_ttl"`
+
+	// PolicyReasons are the reasons the policy engines gave for their
+	// decision
+	PolicyReasons []string `json:"policy_reasons,omitempty"`
+
+	// MFAValidated are the names of the MFA methods validated for the
+	// request
+	MFAValidated []string `json:"mfa_validated,omitempty"`
 }
 
 type JSONResponse struct {
@@ -174,6 +203,7 @@ type JSONAuth struct {
 	DisplayName string            `json:"display_name"`
 	Policies    []string          `json:"policies"`
 	Metadata    map[string]string `json:"metadata"`
+	EntityID    string            `json:"entity_id,omitempty"`
 }
 
 type JSONSecret struct {
@@ -184,6 +214,7 @@ type JSONWrapInfo struct {
 	TTL             int       `json:"ttl"`
 	Token           string    `json:"token"`
 	CreationTime    time.Time `json:"creation_time"`
+	Accessor        string    `json:"accessor,omitempty"`
 	WrappedAccessor string    `json:"wrapped_accessor,omitempty"`
 }
 
@@ -9,6 +9,7 @@ import (
 
 	"errors"
 
+	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/helper/jsonutil"
 	"github.com/hashicorp/vault/logical"
 )
@@ -33,6 +34,18 @@ func TestFormatJSON_formatRequest(t *testing.T) {
 			errors.New("this is an error"),
 			testFormatJSONReqBasicStr,
 		},
+		"coded error": {
+			&logical.Auth{ClientToken: "foo", Policies: []string{"default"}},
+			&logical.Request{
+				Operation: logical.ReadOperation,
+				Path:      "secret/foo",
+				Connection: &logical.Connection{
+					RemoteAddr: "127.0.0.1",
+				},
+			},
+			errutil.WithCode(errutil.CodePolicyDenied, logical.ErrPermissionDenied),
+			testFormatJSONReqCodedStr,
+		},
 	}
 
 	for name, tc := range cases {
@@ -67,5 +80,8 @@ func TestFormatJSON_formatRequest(t *testing.T) {
 	}
 }
 
-const testFormatJSONReqBasicStr = `{"time":"2015-08-05T13:45:46Z","type":"request","auth":{"display_name":"","policies":["root"],"metadata":null},"request":{"operation":"update","path":"/foo","data":null,"wrap_ttl":60,"remote_address":"127.0.0.1"},"error":"this is an error"}
+const testFormatJSONReqBasicStr = `{"time":"2015-08-05T13:45:46Z","type":"request","schema_version":1,"auth":{"display_name":"","policies":["root"],"metadata":null},"request":{"operation":"update","path":"/foo","data":null,"wrap_ttl":60,"remote_address":"127.0.0.1"},"error":"this is an error"}
+`
+
+const testFormatJSONReqCodedStr = `{"time":"2015-08-05T13:45:46Z","type":"request","schema_version":1,"auth":{"display_name":"","policies":["default"],"metadata":null},"request":{"operation":"read","path":"secret/foo","data":null,"wrap_ttl":0,"remote_address":"127.0.0.1"},"error":"permission denied","error_code":"VAULT-403-POLICY-DENIED"}
 `
@@ -1,7 +1,10 @@
 package audit
 
 import (
+	"crypto/subtle"
+	"fmt"
 	"reflect"
+	"strconv"
 	"strings"
 
 	"github.com/hashicorp/vault/helper/salt"
@@ -10,18 +13,90 @@ import (
 	"github.com/mitchellh/reflectwalk"
 )
 
-// HashString hashes the given opaque string and returns it
+// HashString hashes the given opaque string with the current version of the
+// salt and returns it. Until the salt is first rotated this is the
+// unversioned form, e.g. "hmac-sha256:<hmac>", so that values hashed before
+// salts were versioned keep matching; afterwards it is the versioned form,
+// e.g. "hmac-sha256:v2:<hmac>".
 func HashString(salter *salt.Salt, data string) string {
-	return salter.GetIdentifiedHMAC(data)
+	return hashCallback(salter)(data)
+}
+
+// HashStringVersion is like HashString, using the given version of the salt.
+// This allows values logged before the salt was rotated to be looked up.
+// Version 1 values are in the unversioned form, as that is how they were
+// logged.
+func HashStringVersion(salter *salt.Salt, data string, version int) (string, error) {
+	if version != 1 {
+		return salter.GetIdentifiedHMACVersion(data, version)
+	}
+	hmacValue, err := salter.GetHMACVersion(data, version)
+	if err != nil {
+		return "", err
+	}
+	return salter.HMACType() + ":" + hmacValue, nil
+}
+
+// HashVersion returns the version of the salt the given audit hash was
+// computed with, read from its "v<version>:" tag. Hashes without a tag are
+// version 1.
+func HashVersion(salter *salt.Salt, hash string) (int, error) {
+	prefix := salter.HMACType() + ":"
+	if !strings.HasPrefix(hash, prefix) {
+		return 0, fmt.Errorf("hash is not of type %s", salter.HMACType())
+	}
+	rest := hash[len(prefix):]
+	if !strings.HasPrefix(rest, "v") {
+		return 1, nil
+	}
+	i := strings.Index(rest, ":")
+	if i < 0 {
+		return 0, fmt.Errorf("invalid hash version")
+	}
+	version, err := strconv.Atoi(rest[1:i])
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("invalid hash version %q", rest[1:i])
+	}
+	return version, nil
+}
+
+// VerifyHash returns whether the given audit hash is the hash of data with
+// the version of the salt the hash was computed with. That version is
+// returned as well, and must still be retained by the salter.
+func VerifyHash(salter *salt.Salt, data string, hash string) (bool, int, error) {
+	version, err := HashVersion(salter, hash)
+	if err != nil {
+		return false, 0, err
+	}
+	expected, err := HashStringVersion(salter, data, version)
+	if err != nil {
+		return false, version, err
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(hash)) == 1, version, nil
+}
+
+// hashCallback returns the callback hashing values with the current version
+// of the salt, as described on HashString
+func hashCallback(salter *salt.Salt) HashCallback {
+	version := salter.Version()
+	if version == 1 {
+		return salter.GetIdentifiedHMAC
+	}
+	return func(data string) string {
+		// The current version is always retained, so this cannot fail
+		hmacValue, _ := salter.GetIdentifiedHMACVersion(data, version)
+		return hmacValue
+	}
 }
 
 // Hash will hash the given type. This has built-in support for auth,
 // requests, and responses. If it is a type that isn't recognized, then
-// it will be passed through.
+// it will be passed through. The values of the given keys of the data of
+// requests and responses are not hashed.
 //
 // The structure is modified in-place.
-func Hash(salter *salt.Salt, raw interface{}) error {
-	fn := salter.GetIdentifiedHMAC
+func Hash(salter *salt.Salt, raw interface{}, nonHMACDataKeys ...string) error {
+	fn := hashCallback(salter)
 
 	switch s := raw.(type) {
 	case *logical.Auth:
@@ -49,12 +124,12 @@ func Hash(salter *salt.Salt, raw interface{}) error {
 			s.ClientToken = fn(s.ClientToken)
 		}
 
-		data, err := HashStructure(s.Data, fn)
+		data, err := hashData(s.Data, fn, nonHMACDataKeys)
 		if err != nil {
 			return err
 		}
 
-		s.Data = data.(map[string]interface{})
+		s.Data = data
 
 	case *logical.Response:
 		if s == nil {
@@ -73,12 +148,12 @@ func Hash(salter *salt.Salt, raw interface{}) error {
 			}
 		}
 
-		data, err := HashStructure(s.Data, fn)
+		data, err := hashData(s.Data, fn, nonHMACDataKeys)
 		if err != nil {
 			return err
 		}
 
-		s.Data = data.(map[string]interface{})
+		s.Data = data
 
 	case *logical.WrapInfo:
 		if s == nil {
@@ -87,6 +162,10 @@ func Hash(salter *salt.Salt, raw interface{}) error {
 
 		s.Token = fn(s.Token)
 
+		if s.Accessor != "" {
+			s.Accessor = fn(s.Accessor)
+		}
+
 		if s.WrappedAccessor != "" {
 			s.WrappedAccessor = fn(s.WrappedAccessor)
 		}
@@ -95,6 +174,37 @@ func Hash(salter *salt.Salt, raw interface{}) error {
 	return nil
 }
 
+// hashData hashes the values of the data, except those of the given keys
+func hashData(data map[string]interface{}, fn HashCallback, nonHMACKeys []string) (map[string]interface{}, error) {
+	var clear map[string]interface{}
+	for _, key := range nonHMACKeys {
+		value, ok := data[key]
+		if !ok {
+			continue
+		}
+		if clear == nil {
+			clear = make(map[string]interface{})
+			rest := make(map[string]interface{}, len(data))
+			for k, v := range data {
+				rest[k] = v
+			}
+			data = rest
+		}
+		clear[key] = value
+		delete(data, key)
+	}
+
+	hashed, err := HashStructure(data, fn)
+	if err != nil {
+		return nil, err
+	}
+	result := hashed.(map[string]interface{})
+	for k, v := range clear {
+		result[k] = v
+	}
+	return result, nil
+}
+
 // HashStructure takes an interface and hashes all the values within
 // the structure. Only _values_ are hashed: keys of objects are not.
 //
@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -108,6 +109,110 @@ func TestHashString(t *testing.T) {
 	}
 }
 
+func TestHashString_rotated(t *testing.T) {
+	inmemStorage := &logical.InmemStorage{}
+	inmemStorage.Put(&logical.StorageEntry{
+		Key:   "salt",
+		Value: []byte("foo"),
+	})
+	localSalt, err := salt.NewSalt(inmemStorage, &salt.Config{
+		HMAC:     sha256.New,
+		HMACType: "hmac-sha256",
+	})
+	if err != nil {
+		t.Fatalf("Error instantiating salt: %s", err)
+	}
+	original := "hmac-sha256:08ba357e274f528065766c770a639abf6809b39ccfd37c2a3157c7f51954da0a"
+
+	if _, err := localSalt.Rotate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// Values are now hashed with the new version, and say so
+	out := HashString(localSalt, "foo")
+	if !strings.HasPrefix(out, "hmac-sha256:v2:") || out == original {
+		t.Fatalf("bad: %s", out)
+	}
+	auth := &logical.Auth{ClientToken: "foo"}
+	if err := Hash(localSalt, auth); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if auth.ClientToken != out {
+		t.Fatalf("bad: %s", auth.ClientToken)
+	}
+
+	// Values logged before the rotation can still be looked up
+	out, err = HashStringVersion(localSalt, "foo", 1)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if out != original {
+		t.Fatalf("bad: %s", out)
+	}
+	out, err = HashStringVersion(localSalt, "foo", 2)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if out != HashString(localSalt, "foo") {
+		t.Fatalf("bad: %s", out)
+	}
+	if _, err := HashStringVersion(localSalt, "foo", 3); err == nil {
+		t.Fatal("expected error for unknown version")
+	}
+}
+
+func TestVerifyHash(t *testing.T) {
+	inmemStorage := &logical.InmemStorage{}
+	inmemStorage.Put(&logical.StorageEntry{
+		Key:   "salt",
+		Value: []byte("foo"),
+	})
+	localSalt, err := salt.NewSalt(inmemStorage, &salt.Config{
+		HMAC:     sha256.New,
+		HMACType: "hmac-sha256",
+	})
+	if err != nil {
+		t.Fatalf("Error instantiating salt: %s", err)
+	}
+	original := "hmac-sha256:08ba357e274f528065766c770a639abf6809b39ccfd37c2a3157c7f51954da0a"
+	if _, err := localSalt.Rotate(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	rotated := HashString(localSalt, "foo")
+
+	cases := []struct {
+		Data    string
+		Hash    string
+		Valid   bool
+		Version int
+	}{
+		{"foo", original, true, 1},
+		{"bar", original, false, 1},
+		{"foo", rotated, true, 2},
+		{"bar", rotated, false, 2},
+	}
+	for _, tc := range cases {
+		valid, version, err := VerifyHash(localSalt, tc.Data, tc.Hash)
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if valid != tc.Valid || version != tc.Version {
+			t.Fatalf("bad: %s %s: %v %d", tc.Data, tc.Hash, valid, version)
+		}
+	}
+
+	for _, hash := range []string{
+		"foo",
+		"hmac-sha512:08ba357e",
+		"hmac-sha256:vx:08ba357e",
+		"hmac-sha256:v3:08ba357e",
+	} {
+		if _, _, err := VerifyHash(localSalt, "foo", hash); err == nil {
+			t.Fatalf("expected error for %s", hash)
+		}
+	}
+}
+
 func TestHash(t *testing.T) {
 	now := time.Now()
 
@@ -142,6 +247,7 @@ func TestHash(t *testing.T) {
 					TTL:             60,
 					Token:           "bar",
 					CreationTime:    now,
+					Accessor:        "bar",
 					WrappedAccessor: "bar",
 				},
 			},
@@ -153,6 +259,7 @@ func TestHash(t *testing.T) {
 					TTL:             60,
 					Token:           "hmac-sha256:f9320baf0249169e73850cd6156ded0106e2bb6ad8cab01b7bbbebe6d1065317",
 					CreationTime:    now,
+					Accessor:        "hmac-sha256:f9320baf0249169e73850cd6156ded0106e2bb6ad8cab01b7bbbebe6d1065317",
 					WrappedAccessor: "hmac-sha256:f9320baf0249169e73850cd6156ded0106e2bb6ad8cab01b7bbbebe6d1065317",
 				},
 			},
@@ -204,6 +311,42 @@ func TestHash(t *testing.T) {
 	}
 }
 
+func TestHash_nonHMACDataKeys(t *testing.T) {
+	inmemStorage := &logical.InmemStorage{}
+	inmemStorage.Put(&logical.StorageEntry{
+		Key:   "salt",
+		Value: []byte("foo"),
+	})
+	localSalt, err := salt.NewSalt(inmemStorage, &salt.Config{
+		HMAC:     sha256.New,
+		HMACType: "hmac-sha256",
+	})
+	if err != nil {
+		t.Fatalf("Error instantiating salt: %s", err)
+	}
+
+	data := map[string]interface{}{
+		"username": "alice",
+		"password": "bar",
+	}
+	resp := &logical.Response{Data: data}
+	if err := Hash(localSalt, resp, "username", "missing"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expected := map[string]interface{}{
+		"username": "alice",
+		"password": "hmac-sha256:f9320baf0249169e73850cd6156ded0106e2bb6ad8cab01b7bbbebe6d1065317",
+	}
+	if !reflect.DeepEqual(resp.Data, expected) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// The original data is left untouched
+	if data["password"] != "bar" || len(data) != 2 {
+		t.Fatalf("bad: %#v", data)
+	}
+}
+
 func TestHashWalker(t *testing.T) {
 	replaceText := "foo"
 
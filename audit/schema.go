@@ -0,0 +1,147 @@
+package audit
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/vault/helper/jsonutil"
+)
+
+// SchemaVersion is the version of the format of the entries written by
+// FormatJSON, included in each entry as "schema_version". It is incremented
+// whenever a field is added, removed or changes meaning, and the JSON Schema
+// of the new version is added to schemas. The schemas of previous versions
+// are kept as they were, so that log pipelines can keep validating entries
+// written by older servers.
+const SchemaVersion = 1
+
+// schemas are the JSON Schema documents of each version of the entry format
+var schemas = map[int]string{
+	1: schemaV1,
+}
+
+// SchemaVersions returns the versions of the entry format a schema is
+// available for, in increasing order
+func SchemaVersions() []int {
+	versions := make([]int, 0, len(schemas))
+	for version := range schemas {
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+	return versions
+}
+
+// Schema returns the JSON Schema document of the given version of the entry
+// format
+func Schema(version int) (map[string]interface{}, error) {
+	raw, ok := schemas[version]
+	if !ok {
+		return nil, fmt.Errorf("unknown audit schema version %d", version)
+	}
+	var schema map[string]interface{}
+	if err := jsonutil.DecodeJSON([]byte(raw), &schema); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// schemaV1 describes the entries as of version 1. The data and metadata
+// objects hold the values of the request and response, and are open.
+const schemaV1 = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "title": "Vault audit log entry, schema version 1",
+  "oneOf": [
+    {"$ref": "#/definitions/request_entry"},
+    {"$ref": "#/definitions/response_entry"}
+  ],
+  "definitions": {
+    "request_entry": {
+      "type": "object",
+      "required": ["time", "type", "schema_version", "auth", "request", "error"],
+      "additionalProperties": false,
+      "properties": {
+        "time": {"type": "string", "format": "date-time"},
+        "type": {"const": "request"},
+        "schema_version": {"const": 1},
+        "auth": {"$ref": "#/definitions/auth"},
+        "request": {"$ref": "#/definitions/request"},
+        "error": {"type": "string"},
+        "error_code": {"type": "string"}
+      }
+    },
+    "response_entry": {
+      "type": "object",
+      "required": ["time", "type", "schema_version", "auth", "request", "response", "error"],
+      "additionalProperties": false,
+      "properties": {
+        "time": {"type": "string", "format": "date-time"},
+        "type": {"const": "response"},
+        "schema_version": {"const": 1},
+        "auth": {"$ref": "#/definitions/auth"},
+        "request": {"$ref": "#/definitions/request"},
+        "response": {"$ref": "#/definitions/response"},
+        "error": {"type": "string"},
+        "error_code": {"type": "string"}
+      }
+    },
+    "auth": {
+      "type": "object",
+      "required": ["display_name", "policies", "metadata"],
+      "additionalProperties": false,
+      "properties": {
+        "client_token": {"type": "string"},
+        "accessor": {"type": "string"},
+        "display_name": {"type": "string"},
+        "policies": {"type": ["array", "null"], "items": {"type": "string"}},
+        "metadata": {"type": ["object", "null"], "additionalProperties": {"type": "string"}},
+        "entity_id": {"type": "string"}
+      }
+    },
+    "request": {
+      "type": "object",
+      "required": ["id", "operation", "client_token", "path", "data", "remote_address", "wrap_ttl"],
+      "additionalProperties": false,
+      "properties": {
+        "id": {"type": "string"},
+        "operation": {"type": "string"},
+        "client_token": {"type": "string"},
+        "path": {"type": "string"},
+        "data": {"type": ["object", "null"]},
+        "remote_address": {"type": "string"},
+        "wrap_ttl": {"type": "integer"},
+        "policy_reasons": {"type": "array", "items": {"type": "string"}},
+        "mfa_validated": {"type": "array", "items": {"type": "string"}}
+      }
+    },
+    "response": {
+      "type": "object",
+      "required": ["secret", "data", "redirect"],
+      "additionalProperties": false,
+      "properties": {
+        "auth": {"$ref": "#/definitions/auth"},
+        "secret": {
+          "type": ["object", "null"],
+          "required": ["lease_id"],
+          "additionalProperties": false,
+          "properties": {
+            "lease_id": {"type": "string"}
+          }
+        },
+        "data": {"type": ["object", "null"]},
+        "redirect": {"type": "string"},
+        "wrap_info": {
+          "type": "object",
+          "required": ["ttl", "token", "creation_time"],
+          "additionalProperties": false,
+          "properties": {
+            "ttl": {"type": "integer"},
+            "token": {"type": "string"},
+            "creation_time": {"type": "string", "format": "date-time"},
+            "accessor": {"type": "string"},
+            "wrapped_accessor": {"type": "string"}
+          }
+        }
+      }
+    }
+  }
+}`
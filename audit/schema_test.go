@@ -0,0 +1,124 @@
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestSchema(t *testing.T) {
+	if versions := SchemaVersions(); !reflect.DeepEqual(versions, []int{1}) {
+		t.Fatalf("bad: %#v", versions)
+	}
+	if _, err := Schema(SchemaVersion); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if _, err := Schema(SchemaVersion + 1); err == nil {
+		t.Fatal("expected error for unknown version")
+	}
+}
+
+// TestSchema_current checks the entries written by FormatJSON, with every
+// field set, against the schema of the current version
+func TestSchema_current(t *testing.T) {
+	schema, err := Schema(SchemaVersion)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	definitions := schema["definitions"].(map[string]interface{})
+
+	auth := &logical.Auth{
+		ClientToken: "foo",
+		Accessor:    "bar",
+		DisplayName: "token",
+		Policies:    []string{"default"},
+		Metadata:    map[string]string{"user": "baz"},
+		EntityID:    "entity",
+	}
+	req := &logical.Request{
+		ID:            "id",
+		Operation:     logical.UpdateOperation,
+		ClientToken:   "foo",
+		Path:          "secret/foo",
+		Data:          map[string]interface{}{"value": "bar"},
+		Connection:    &logical.Connection{RemoteAddr: "127.0.0.1"},
+		WrapTTL:       time.Minute,
+		PolicyReasons: []string{"allowed"},
+		MFAValidated:  []string{"totp"},
+	}
+	resp := &logical.Response{
+		Auth:     auth,
+		Secret:   &logical.Secret{LeaseID: "lease"},
+		Data:     map[string]interface{}{"value": "bar"},
+		Redirect: "redirect",
+		WrapInfo: &logical.WrapInfo{
+			TTL:             time.Minute,
+			Token:           "token",
+			CreationTime:    time.Now(),
+			Accessor:        "accessor",
+			WrappedAccessor: "wrapped",
+		},
+	}
+
+	var format FormatJSON
+	var buf bytes.Buffer
+	if err := format.FormatRequest(&buf, auth, req, errors.New("error")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	checkSchema(t, definitions, definitions["request_entry"], buf.Bytes())
+
+	buf.Reset()
+	if err := format.FormatResponse(&buf, auth, req, resp, errors.New("error")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	checkSchema(t, definitions, definitions["response_entry"], buf.Bytes())
+}
+
+// checkSchema checks that the required properties of the objects of the
+// entry are present, and that they have no properties the schema does not
+// declare
+func checkSchema(t *testing.T, definitions map[string]interface{}, schema interface{}, entry []byte) {
+	var value interface{}
+	if err := jsonutil.DecodeJSON(entry, &value); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	var check func(path string, schema map[string]interface{}, value interface{})
+	check = func(path string, schema map[string]interface{}, value interface{}) {
+		if ref, ok := schema["$ref"].(string); ok {
+			schema = definitions[strings.TrimPrefix(ref, "#/definitions/")].(map[string]interface{})
+		}
+		properties, ok := schema["properties"].(map[string]interface{})
+		if !ok {
+			return
+		}
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			if value != nil {
+				t.Fatalf("%s is not an object: %#v", path, value)
+			}
+			return
+		}
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, ok := object[name.(string)]; !ok {
+					t.Fatalf("%s is missing %s", path, name)
+				}
+			}
+		}
+		for name, field := range object {
+			property, ok := properties[name]
+			if !ok {
+				t.Fatalf("%s.%s is not in the schema", path, name)
+			}
+			check(path+"."+name, property.(map[string]interface{}), field)
+		}
+	}
+	check("entry", schema.(map[string]interface{}), value)
+}
@@ -0,0 +1,294 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+)
+
+const (
+	// DefaultSpoolMaxBytes is used if no spool_max_size is given
+	DefaultSpoolMaxBytes = 64 * 1024 * 1024
+
+	// DefaultSpoolFlushInterval is used if no spool_flush_interval is given
+	DefaultSpoolFlushInterval = 5 * time.Second
+)
+
+// ErrSpoolFull is returned when an entry cannot be delivered and the spool
+// has no room left for it
+var ErrSpoolFull = errors.New("audit spool is full")
+
+// SpoolConfig configures a Spool
+type SpoolConfig struct {
+	// Path is the file the entries are queued in
+	Path string
+
+	// MaxBytes is the maximum size of the spool file
+	MaxBytes int64
+
+	// DropWhenFull discards the entries that do not fit in a full spool,
+	// letting the requests proceed. Otherwise ErrSpoolFull is returned,
+	// which fails the requests unless another audit backend logs them.
+	DropWhenFull bool
+
+	// FlushInterval is how often the queued entries are sent again
+	FlushInterval time.Duration
+}
+
+// ParseSpoolConfig reads the spool options of an audit backend. nil is
+// returned if spool_path is not set, in which case entries are not spooled.
+func ParseSpoolConfig(conf map[string]string) (*SpoolConfig, error) {
+	path, ok := conf["spool_path"]
+	if !ok || path == "" {
+		return nil, nil
+	}
+
+	config := &SpoolConfig{
+		Path:          path,
+		MaxBytes:      DefaultSpoolMaxBytes,
+		FlushInterval: DefaultSpoolFlushInterval,
+	}
+	if raw, ok := conf["spool_max_size"]; ok {
+		maxBytes, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || maxBytes <= 0 {
+			return nil, fmt.Errorf("invalid spool_max_size %q", raw)
+		}
+		config.MaxBytes = maxBytes
+	}
+	if raw, ok := conf["spool_flush_interval"]; ok {
+		interval, err := time.ParseDuration(raw)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid spool_flush_interval %q", raw)
+		}
+		config.FlushInterval = interval
+	}
+	switch behavior := conf["spool_full_behavior"]; behavior {
+	case "", "block":
+	case "drop":
+		config.DropWhenFull = true
+	default:
+		return nil, fmt.Errorf("invalid spool_full_behavior %q, must be block or drop", behavior)
+	}
+	return config, nil
+}
+
+// Spool delivers the entries of an audit backend to its sink, such as a
+// socket, queuing them in a local file while the sink is unreachable. The
+// queued entries are sent in order once it is reachable again, and entries
+// are queued behind them until then, so that the order is kept. Entries
+// must end with their only newline, as the JSON format does.
+type Spool struct {
+	config SpoolConfig
+	sink   func([]byte) error
+
+	// l protects the file and its size. flushLock prevents concurrent
+	// flushes.
+	l         sync.Mutex
+	f         *os.File
+	size      int64
+	flushLock sync.Mutex
+
+	stopCh chan struct{}
+	doneCh chan struct{}
+}
+
+// NewSpool opens the spool file, delivering the entries queued in it by a
+// previous run in the background
+func NewSpool(config *SpoolConfig, sink func([]byte) error) (*Spool, error) {
+	f, err := os.OpenFile(config.Path, os.O_APPEND|os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	s := &Spool{
+		config: *config,
+		sink:   sink,
+		f:      f,
+		size:   info.Size(),
+		stopCh: make(chan struct{}),
+		doneCh: make(chan struct{}),
+	}
+	go s.run()
+	return s, nil
+}
+
+// Write delivers the entry to the sink, or queues it if the sink fails or
+// entries are already queued
+func (s *Spool) Write(entry []byte) error {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if s.size == 0 {
+		if err := s.sink(entry); err == nil {
+			return nil
+		}
+	}
+
+	if s.size+int64(len(entry)) > s.config.MaxBytes {
+		if s.config.DropWhenFull {
+			metrics.IncrCounter([]string{"audit", "spool", "dropped"}, 1)
+			return nil
+		}
+		return ErrSpoolFull
+	}
+	if _, err := s.f.Write(entry); err != nil {
+		return err
+	}
+	if err := s.f.Sync(); err != nil {
+		return err
+	}
+	s.size += int64(len(entry))
+	metrics.IncrCounter([]string{"audit", "spool", "queued"}, 1)
+	metrics.SetGauge([]string{"audit", "spool", "bytes"}, float32(s.size))
+	return nil
+}
+
+// Size returns the size of the queued entries
+func (s *Spool) Size() int64 {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return s.size
+}
+
+// Flush sends the queued entries in order until the sink fails. New entries
+// are queued behind them meanwhile, without waiting for the flush.
+func (s *Spool) Flush() error {
+	s.flushLock.Lock()
+	defer s.flushLock.Unlock()
+
+	s.l.Lock()
+	size := s.size
+	s.l.Unlock()
+	if size == 0 {
+		return nil
+	}
+
+	// The file is only appended to while the flush reads the entries that
+	// were queued when it started
+	r, err := os.Open(s.config.Path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	var sent int64
+	var sinkErr error
+	br := bufio.NewReader(io.LimitReader(r, size))
+	for {
+		entry, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			sinkErr = err
+			break
+		}
+		if sinkErr = s.sink(entry); sinkErr != nil {
+			break
+		}
+		sent += int64(len(entry))
+	}
+
+	s.l.Lock()
+	defer s.l.Unlock()
+	if err := s.compact(sent); err != nil {
+		return err
+	}
+	metrics.SetGauge([]string{"audit", "spool", "bytes"}, float32(s.size))
+	return sinkErr
+}
+
+// compact removes the first n bytes of the spool file, which were sent. It
+// is called with the lock held.
+func (s *Spool) compact(n int64) error {
+	if n == 0 {
+		return nil
+	}
+	if n == s.size {
+		if err := s.f.Truncate(0); err != nil {
+			return err
+		}
+		s.size = 0
+		return nil
+	}
+
+	if _, err := s.f.Seek(n, io.SeekStart); err != nil {
+		return err
+	}
+	var rest bytes.Buffer
+	if _, err := io.Copy(&rest, s.f); err != nil {
+		return err
+	}
+
+	tmpPath := s.config.Path + ".tmp"
+	if err := writeFileSync(tmpPath, rest.Bytes()); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, s.config.Path); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.config.Path, os.O_APPEND|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	s.f.Close()
+	s.f = f
+	s.size = int64(rest.Len())
+	return nil
+}
+
+// Close stops the background flushes and closes the spool file. The queued
+// entries remain in the file for the next run.
+func (s *Spool) Close() error {
+	close(s.stopCh)
+	<-s.doneCh
+
+	s.l.Lock()
+	defer s.l.Unlock()
+	return s.f.Close()
+}
+
+// run flushes the spool periodically until closed
+func (s *Spool) run() {
+	defer close(s.doneCh)
+	ticker := time.NewTicker(s.config.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.Flush()
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// writeFileSync writes the file and syncs it to disk before returning
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,253 @@
+package audit
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testSink records the delivered entries and fails while down is set
+type testSink struct {
+	sync.Mutex
+	down    bool
+	entries []string
+}
+
+func (s *testSink) write(entry []byte) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.down {
+		return errors.New("unreachable")
+	}
+	s.entries = append(s.entries, string(entry))
+	return nil
+}
+
+func (s *testSink) setDown(down bool) {
+	s.Lock()
+	defer s.Unlock()
+	s.down = down
+}
+
+func (s *testSink) delivered() []string {
+	s.Lock()
+	defer s.Unlock()
+	return append([]string(nil), s.entries...)
+}
+
+func testSpoolConfig(t *testing.T) (*SpoolConfig, func()) {
+	dir, err := ioutil.TempDir("", "vault-spool")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	config := &SpoolConfig{
+		Path:     filepath.Join(dir, "spool"),
+		MaxBytes: DefaultSpoolMaxBytes,
+		// Flushes are triggered by the tests
+		FlushInterval: time.Hour,
+	}
+	return config, func() { os.RemoveAll(dir) }
+}
+
+func TestParseSpoolConfig(t *testing.T) {
+	config, err := ParseSpoolConfig(map[string]string{})
+	if err != nil || config != nil {
+		t.Fatalf("expected no spool, got %#v, %v", config, err)
+	}
+
+	config, err = ParseSpoolConfig(map[string]string{
+		"spool_path":           "/tmp/spool",
+		"spool_max_size":       "1024",
+		"spool_flush_interval": "1s",
+		"spool_full_behavior":  "drop",
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expected := &SpoolConfig{
+		Path:          "/tmp/spool",
+		MaxBytes:      1024,
+		DropWhenFull:  true,
+		FlushInterval: time.Second,
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Fatalf("bad: %#v", config)
+	}
+
+	for _, conf := range []map[string]string{
+		{"spool_path": "/tmp/spool", "spool_max_size": "-1"},
+		{"spool_path": "/tmp/spool", "spool_flush_interval": "soon"},
+		{"spool_path": "/tmp/spool", "spool_full_behavior": "wait"},
+	} {
+		if _, err := ParseSpoolConfig(conf); err == nil {
+			t.Fatalf("expected error for %#v", conf)
+		}
+	}
+}
+
+func TestSpool_queueAndFlush(t *testing.T) {
+	config, cleanup := testSpoolConfig(t)
+	defer cleanup()
+
+	sink := &testSink{}
+	s, err := NewSpool(config, sink.write)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer s.Close()
+
+	// Entries go straight to a reachable sink
+	if err := s.Write([]byte("one\n")); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if s.Size() != 0 {
+		t.Fatalf("bad: %d", s.Size())
+	}
+
+	// Entries are queued while it is unreachable
+	sink.setDown(true)
+	for _, entry := range []string{"two\n", "three\n"} {
+		if err := s.Write([]byte(entry)); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	if s.Size() != 10 {
+		t.Fatalf("bad: %d", s.Size())
+	}
+	if err := s.Flush(); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// Once it is reachable again, new entries are queued behind the
+	// others so that the order is kept
+	sink.setDown(false)
+	if err := s.Write([]byte("four\n")); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if s.Size() != 0 {
+		t.Fatalf("bad: %d", s.Size())
+	}
+	expected := []string{"one\n", "two\n", "three\n", "four\n"}
+	if actual := sink.delivered(); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestSpool_partialFlush(t *testing.T) {
+	config, cleanup := testSpoolConfig(t)
+	defer cleanup()
+
+	var sent []string
+	fail := false
+	sink := func(entry []byte) error {
+		if fail {
+			return errors.New("unreachable")
+		}
+		sent = append(sent, string(entry))
+		// Fail again after the first flushed entry
+		if string(entry) == "one\n" {
+			fail = true
+		}
+		return nil
+	}
+	fail = true
+	s, err := NewSpool(config, sink)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer s.Close()
+
+	for _, entry := range []string{"one\n", "two\n"} {
+		if err := s.Write([]byte(entry)); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	fail = false
+	if err := s.Flush(); err == nil {
+		t.Fatal("expected error")
+	}
+	if s.Size() != 4 {
+		t.Fatalf("bad: %d", s.Size())
+	}
+
+	fail = false
+	if err := s.Flush(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expected := []string{"one\n", "two\n"}
+	if !reflect.DeepEqual(sent, expected) {
+		t.Fatalf("bad: %#v", sent)
+	}
+}
+
+func TestSpool_full(t *testing.T) {
+	config, cleanup := testSpoolConfig(t)
+	defer cleanup()
+	config.MaxBytes = 8
+
+	sink := &testSink{down: true}
+	s, err := NewSpool(config, sink.write)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer s.Close()
+
+	if err := s.Write([]byte("one\n")); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := s.Write([]byte("three\n")); err != ErrSpoolFull {
+		t.Fatalf("expected full spool, got %v", err)
+	}
+
+	// Dropping lets the write succeed without queuing the entry
+	s.config.DropWhenFull = true
+	if err := s.Write([]byte("three\n")); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if s.Size() != 4 {
+		t.Fatalf("bad: %d", s.Size())
+	}
+}
+
+func TestSpool_reopen(t *testing.T) {
+	config, cleanup := testSpoolConfig(t)
+	defer cleanup()
+
+	sink := &testSink{down: true}
+	s, err := NewSpool(config, sink.write)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := s.Write([]byte("one\n")); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The queued entries survive a restart
+	sink.setDown(false)
+	s, err = NewSpool(config, sink.write)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer s.Close()
+	if s.Size() != 4 {
+		t.Fatalf("bad: %d", s.Size())
+	}
+	if err := s.Flush(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if actual := sink.delivered(); !reflect.DeepEqual(actual, []string{"one\n"}) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
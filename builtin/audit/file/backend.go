@@ -1,11 +1,13 @@
 package file
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/hashicorp/vault/audit"
 	"github.com/hashicorp/vault/helper/salt"
@@ -51,6 +53,15 @@ func Factory(conf *audit.BackendConfig) (audit.Backend, error) {
 		logRaw:       logRaw,
 		hmacAccessor: hmacAccessor,
 		salt:         conf.Salt,
+		mode:         0600,
+		uid:          -1,
+		gid:          -1,
+	}
+	if err := b.parseRotation(conf.Config); err != nil {
+		return nil, err
+	}
+	if err := b.parseOwnership(conf.Config); err != nil {
+		return nil, err
 	}
 
 	// Ensure that the file can be successfully opened for writing;
@@ -63,19 +74,32 @@ func Factory(conf *audit.BackendConfig) (audit.Backend, error) {
 	return b, nil
 }
 
-// Backend is the audit backend for the file-based audit store.
-//
-// NOTE: This audit backend is currently very simple: it appends to a file.
-// It doesn't do anything more at the moment to assist with rotation
-// or reset the write cursor, this should be done in the future.
+// Backend is the audit backend for the file-based audit store. It appends
+// to a file, which it rotates itself if configured to; see rotate.go.
 type Backend struct {
 	path         string
 	logRaw       bool
 	hmacAccessor bool
 	salt         *salt.Salt
 
-	once sync.Once
-	f    *os.File
+	// The permissions and ownership of the log files. uid and gid are -1
+	// if they are left unchanged.
+	mode os.FileMode
+	uid  int
+	gid  int
+
+	rotation rotationConfig
+
+	// l protects the file, its size and when it was opened
+	l      sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+
+	// wg tracks the compression and cleanup of the rotated files, which
+	// cleanupLock serializes
+	wg          sync.WaitGroup
+	cleanupLock sync.Mutex
 }
 
 func (b *Backend) GetHash(data string) string {
@@ -83,9 +107,6 @@ func (b *Backend) GetHash(data string) string {
 }
 
 func (b *Backend) LogRequest(auth *logical.Auth, req *logical.Request, outerErr error) error {
-	if err := b.open(); err != nil {
-		return err
-	}
 	if !b.logRaw {
 		// Before we copy the structure we must nil out some data
 		// otherwise we will cause reflection to panic and die
@@ -115,14 +136,18 @@ func (b *Backend) LogRequest(auth *logical.Auth, req *logical.Request, outerErr
 		if err := audit.Hash(b.salt, auth); err != nil {
 			return err
 		}
-		if err := audit.Hash(b.salt, req); err != nil {
+		if err := audit.Hash(b.salt, req, req.AuditNonHMACRequestKeys...); err != nil {
 			return err
 		}
 
 	}
 
+	var buf bytes.Buffer
 	var format audit.FormatJSON
-	return format.FormatRequest(b.f, auth, req, outerErr)
+	if err := format.FormatRequest(&buf, auth, req, outerErr); err != nil {
+		return err
+	}
+	return b.write(buf.Bytes())
 }
 
 func (b *Backend) LogResponse(
@@ -130,9 +155,6 @@ func (b *Backend) LogResponse(
 	req *logical.Request,
 	resp *logical.Response,
 	err error) error {
-	if err := b.open(); err != nil {
-		return err
-	}
 	if !b.logRaw {
 		// Before we copy the structure we must nil out some data
 		// otherwise we will cause reflection to panic and die
@@ -178,7 +200,7 @@ func (b *Backend) LogResponse(
 			auth.Accessor = accessor
 		}
 
-		if err := audit.Hash(b.salt, req); err != nil {
+		if err := audit.Hash(b.salt, req, req.AuditNonHMACRequestKeys...); err != nil {
 			return err
 		}
 
@@ -190,7 +212,7 @@ func (b *Backend) LogResponse(
 		if !b.hmacAccessor && resp != nil && resp.WrapInfo != nil && resp.WrapInfo.WrappedAccessor != "" {
 			wrappedAccessor = resp.WrapInfo.WrappedAccessor
 		}
-		if err := audit.Hash(b.salt, resp); err != nil {
+		if err := audit.Hash(b.salt, resp, req.AuditNonHMACResponseKeys...); err != nil {
 			return err
 		}
 		if accessor != "" {
@@ -201,11 +223,42 @@ func (b *Backend) LogResponse(
 		}
 	}
 
+	var buf bytes.Buffer
 	var format audit.FormatJSON
-	return format.FormatResponse(b.f, auth, req, resp, err)
+	if err := format.FormatResponse(&buf, auth, req, resp, err); err != nil {
+		return err
+	}
+	return b.write(buf.Bytes())
+}
+
+// write appends the entry to the file, rotating it first if needed
+func (b *Backend) write(entry []byte) error {
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	if err := b.openLocked(); err != nil {
+		return err
+	}
+	if b.shouldRotate(int64(len(entry)), time.Now()) {
+		if err := b.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := b.f.Write(entry)
+	b.size += int64(n)
+	return err
 }
 
 func (b *Backend) open() error {
+	b.l.Lock()
+	defer b.l.Unlock()
+	return b.openLocked()
+}
+
+// openLocked opens the file if it is not already. It is called with the
+// lock held.
+func (b *Backend) openLocked() error {
 	if b.f != nil {
 		return nil
 	}
@@ -213,11 +266,46 @@ func (b *Backend) open() error {
 		return err
 	}
 
-	var err error
-	b.f, err = os.OpenFile(b.path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+	f, err := os.OpenFile(b.path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, b.mode)
 	if err != nil {
 		return err
 	}
 
+	// The mode given when creating the file is subject to the umask, and
+	// the file may have existed already
+	if err := f.Chmod(b.mode); err != nil {
+		f.Close()
+		return err
+	}
+	if b.uid != -1 || b.gid != -1 {
+		if err := f.Chown(b.uid, b.gid); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	b.f = f
+	b.size = info.Size()
+	b.opened = time.Now()
 	return nil
 }
+
+// Close closes the file, waiting for the rotated files to be compressed
+func (b *Backend) Close() error {
+	b.l.Lock()
+	var err error
+	if b.f != nil {
+		err = b.f.Close()
+		b.f = nil
+	}
+	b.l.Unlock()
+
+	b.wg.Wait()
+	return err
+}
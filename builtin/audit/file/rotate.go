@@ -0,0 +1,291 @@
+package file
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rotatedTimeFormat is the format of the timestamp suffixed to the rotated
+// files, which sorts them by the time they were rotated at
+const rotatedTimeFormat = "20060102T150405.000000000Z"
+
+// rotationConfig configures the rotation of the log file. Rotation is
+// disabled if neither maxBytes nor interval are set.
+type rotationConfig struct {
+	// maxBytes is the size the file is rotated before exceeding
+	maxBytes int64
+
+	// interval is how long the file is written to before being rotated
+	interval time.Duration
+
+	// compress gzips the rotated files
+	compress bool
+
+	// maxAge and maxFiles limit how long and how many rotated files are
+	// kept, if set
+	maxAge   time.Duration
+	maxFiles int
+}
+
+func (c *rotationConfig) enabled() bool {
+	return c.maxBytes > 0 || c.interval > 0
+}
+
+// parseRotation reads the rotation and retention options
+func (b *Backend) parseRotation(conf map[string]string) error {
+	c := &b.rotation
+	if raw, ok := conf["rotate_max_bytes"]; ok {
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || value < 0 {
+			return fmt.Errorf("invalid rotate_max_bytes %q", raw)
+		}
+		c.maxBytes = value
+	}
+	if raw, ok := conf["rotate_interval"]; ok {
+		value, err := time.ParseDuration(raw)
+		if err != nil || value < 0 {
+			return fmt.Errorf("invalid rotate_interval %q", raw)
+		}
+		c.interval = value
+	}
+	if raw, ok := conf["rotate_compress"]; ok {
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		c.compress = value
+	}
+	if raw, ok := conf["retention_max_age"]; ok {
+		value, err := time.ParseDuration(raw)
+		if err != nil || value < 0 {
+			return fmt.Errorf("invalid retention_max_age %q", raw)
+		}
+		c.maxAge = value
+	}
+	if raw, ok := conf["retention_max_files"]; ok {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 0 {
+			return fmt.Errorf("invalid retention_max_files %q", raw)
+		}
+		c.maxFiles = value
+	}
+
+	if !c.enabled() && (c.compress || c.maxAge > 0 || c.maxFiles > 0) {
+		return fmt.Errorf("rotate_compress and the retention options require rotate_max_bytes or rotate_interval")
+	}
+	return nil
+}
+
+// parseOwnership reads the mode, owner and group options
+func (b *Backend) parseOwnership(conf map[string]string) error {
+	if raw, ok := conf["mode"]; ok {
+		value, err := strconv.ParseUint(raw, 8, 32)
+		if err != nil || value > 0777 {
+			return fmt.Errorf("invalid mode %q, must be octal permissions such as 0640", raw)
+		}
+		b.mode = os.FileMode(value)
+	}
+
+	if raw, ok := conf["owner"]; ok && raw != "" {
+		uid, err := strconv.Atoi(raw)
+		if err != nil {
+			u, err := user.Lookup(raw)
+			if err != nil {
+				return fmt.Errorf("invalid owner %q: %v", raw, err)
+			}
+			if uid, err = strconv.Atoi(u.Uid); err != nil {
+				return fmt.Errorf("owner %q has no numeric user ID", raw)
+			}
+		}
+		b.uid = uid
+	}
+
+	if raw, ok := conf["group"]; ok && raw != "" {
+		gid, err := strconv.Atoi(raw)
+		if err != nil {
+			g, err := user.LookupGroup(raw)
+			if err != nil {
+				return fmt.Errorf("invalid group %q: %v", raw, err)
+			}
+			if gid, err = strconv.Atoi(g.Gid); err != nil {
+				return fmt.Errorf("group %q has no numeric group ID", raw)
+			}
+		}
+		b.gid = gid
+	}
+	return nil
+}
+
+// shouldRotate returns whether the file must be rotated before writing n
+// bytes to it. It is called with the lock held.
+func (b *Backend) shouldRotate(n int64, now time.Time) bool {
+	// An empty file is never rotated, so that an entry larger than the
+	// maximum size is still written
+	if b.size == 0 {
+		return false
+	}
+	if b.rotation.maxBytes > 0 && b.size+n > b.rotation.maxBytes {
+		return true
+	}
+	return b.rotation.interval > 0 && now.Sub(b.opened) >= b.rotation.interval
+}
+
+// rotate renames the file with the time it is rotated at and opens a new
+// one. The rotated files are compressed and cleaned up in the background.
+// It is called with the lock held.
+func (b *Backend) rotate() error {
+	if err := b.f.Close(); err != nil {
+		return err
+	}
+	b.f = nil
+
+	rotated := b.path + "." + time.Now().UTC().Format(rotatedTimeFormat)
+	renameErr := os.Rename(b.path, rotated)
+
+	// Keep logging to the current file if it could not be renamed
+	if err := b.openLocked(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		b.cleanup()
+	}()
+	return nil
+}
+
+// rotatedFile is a file rotated by the backend
+type rotatedFile struct {
+	path      string
+	rotatedAt time.Time
+}
+
+// rotatedFiles returns the rotated files, oldest first
+func (b *Backend) rotatedFiles() ([]rotatedFile, error) {
+	dir, base := filepath.Split(b.path)
+	if dir == "" {
+		dir = "."
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []rotatedFile
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasPrefix(name, base+".") {
+			continue
+		}
+
+		// Only the files named by the backend are rotated files
+		suffix := strings.TrimSuffix(strings.TrimPrefix(name, base+"."), ".gz")
+		rotatedAt, err := time.Parse(rotatedTimeFormat, suffix)
+		if err != nil {
+			continue
+		}
+		files = append(files, rotatedFile{
+			path:      filepath.Join(dir, name),
+			rotatedAt: rotatedAt,
+		})
+	}
+	sort.Sort(byRotatedAt(files))
+	return files, nil
+}
+
+// cleanup compresses the rotated files and removes those beyond the
+// retention limits. A file that fails to be compressed is compressed again
+// at the next rotation.
+func (b *Backend) cleanup() {
+	// Rotations happening while cleaning up are handled afterwards
+	b.cleanupLock.Lock()
+	defer b.cleanupLock.Unlock()
+
+	files, err := b.rotatedFiles()
+	if err != nil {
+		return
+	}
+
+	if b.rotation.compress {
+		for i, file := range files {
+			if strings.HasSuffix(file.path, ".gz") {
+				continue
+			}
+			if err := b.compress(file.path); err == nil {
+				files[i].path = file.path + ".gz"
+			}
+		}
+	}
+
+	now := time.Now()
+	for i, file := range files {
+		expired := b.rotation.maxAge > 0 && now.Sub(file.rotatedAt) > b.rotation.maxAge
+		excess := b.rotation.maxFiles > 0 && len(files)-i > b.rotation.maxFiles
+		if expired || excess {
+			os.Remove(file.path)
+		}
+	}
+}
+
+// compress gzips the file, replacing it with the compressed file
+func (b *Backend) compress(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmpPath := path + ".gz.tmp"
+	dst, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, b.mode)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	err = func() error {
+		defer dst.Close()
+		if err := dst.Chmod(b.mode); err != nil {
+			return err
+		}
+		if b.uid != -1 || b.gid != -1 {
+			if err := dst.Chown(b.uid, b.gid); err != nil {
+				return err
+			}
+		}
+		gz := gzip.NewWriter(dst)
+		if _, err := io.Copy(gz, src); err != nil {
+			return err
+		}
+		if err := gz.Close(); err != nil {
+			return err
+		}
+		return dst.Sync()
+	}()
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path+".gz"); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+type byRotatedAt []rotatedFile
+
+func (s byRotatedAt) Len() int           { return len(s) }
+func (s byRotatedAt) Less(i, j int) bool { return s[i].rotatedAt.Before(s[j].rotatedAt) }
+func (s byRotatedAt) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,159 @@
+package file
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/helper/salt"
+	"github.com/hashicorp/vault/logical"
+)
+
+func testBackend(t *testing.T, config map[string]string) *Backend {
+	salter, err := salt.NewSalt(&logical.InmemStorage{}, &salt.Config{
+		HMAC:     sha256.New,
+		HMACType: "hmac-sha256",
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	b, err := Factory(&audit.BackendConfig{
+		Salt:   salter,
+		Config: config,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	return b.(*Backend)
+}
+
+func TestBackend_rotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-audit")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	b := testBackend(t, map[string]string{
+		"file_path":           path,
+		"rotate_max_bytes":    "5",
+		"rotate_compress":     "true",
+		"retention_max_files": "2",
+		"mode":                "0640",
+	})
+
+	// Each entry but the first exceeds the size of the file, rotating it
+	for _, entry := range []string{"one\n", "two\n", "three\n", "four\n", "five\n"} {
+		if err := b.write([]byte(entry)); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		// Make sure the rotated files have distinct names
+		time.Sleep(time.Millisecond)
+	}
+	if err := b.Close(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	current, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(current) != "five\n" {
+		t.Fatalf("bad: %q", current)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Fatalf("bad: %v", info.Mode())
+	}
+
+	// Only the two newest rotated files are kept, compressed
+	files, err := b.rotatedFiles()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("bad: %#v", files)
+	}
+	var contents []string
+	for _, file := range files {
+		if !strings.HasSuffix(file.path, ".gz") {
+			t.Fatalf("bad: %s", file.path)
+		}
+		f, err := os.Open(file.path)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		data, err := ioutil.ReadAll(gz)
+		f.Close()
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		contents = append(contents, string(data))
+	}
+	if contents[0] != "three\n" || contents[1] != "four\n" {
+		t.Fatalf("bad: %#v", contents)
+	}
+}
+
+func TestBackend_rotateInterval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-audit")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	b := testBackend(t, map[string]string{
+		"file_path":       path,
+		"rotate_interval": "1h",
+	})
+	defer b.Close()
+
+	now := time.Now()
+	if b.shouldRotate(10, now) {
+		t.Fatal("an empty file should not be rotated")
+	}
+	if err := b.write([]byte("one\n")); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if b.shouldRotate(10, now.Add(time.Minute)) {
+		t.Fatal("should not rotate before the interval")
+	}
+	if !b.shouldRotate(10, now.Add(time.Hour)) {
+		t.Fatal("should rotate after the interval")
+	}
+}
+
+func TestBackend_rotationConfig(t *testing.T) {
+	salter, _ := salt.NewSalt(&logical.InmemStorage{}, &salt.Config{
+		HMAC:     sha256.New,
+		HMACType: "hmac-sha256",
+	})
+	for _, config := range []map[string]string{
+		{"rotate_max_bytes": "-1"},
+		{"rotate_interval": "daily"},
+		{"retention_max_files": "2"},
+		{"rotate_compress": "true"},
+		{"mode": "0999"},
+		{"owner": "no-such-user-for-vault"},
+	} {
+		config["file_path"] = filepath.Join(os.TempDir(), "vault-audit-invalid.log")
+		if _, err := Factory(&audit.BackendConfig{Salt: salter, Config: config}); err == nil {
+			t.Fatalf("expected error for %#v", config)
+		}
+	}
+}
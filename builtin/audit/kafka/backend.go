@@ -0,0 +1,370 @@
+package kafka
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/helper/salt"
+	"github.com/hashicorp/vault/logical"
+	"github.com/mitchellh/copystructure"
+)
+
+func Factory(conf *audit.BackendConfig) (audit.Backend, error) {
+	if conf.Salt == nil {
+		return nil, fmt.Errorf("nil salt")
+	}
+
+	brokersRaw, ok := conf.Config["brokers"]
+	if !ok {
+		return nil, fmt.Errorf("brokers is required")
+	}
+	var brokers []string
+	for _, broker := range strings.Split(brokersRaw, ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			brokers = append(brokers, broker)
+		}
+	}
+	if len(brokers) == 0 {
+		return nil, fmt.Errorf("brokers is required")
+	}
+
+	topic, ok := conf.Config["topic"]
+	if !ok || topic == "" {
+		return nil, fmt.Errorf("topic is required")
+	}
+
+	// Get the partition key or default to none, which spreads the entries
+	// over the partitions
+	partitionKey := conf.Config["partition_key"]
+	switch partitionKey {
+	case "":
+		partitionKey = "none"
+	case "none", "entity_id", "mount":
+	default:
+		return nil, fmt.Errorf("invalid partition_key %q, must be none, entity_id or mount", partitionKey)
+	}
+
+	// Get the required acknowledgements or default to all in-sync replicas
+	acks := acksAll
+	switch requiredAcks := conf.Config["required_acks"]; requiredAcks {
+	case "", "all":
+	case "leader":
+		acks = acksLeader
+	case "none":
+		acks = acksNone
+	default:
+		return nil, fmt.Errorf("invalid required_acks %q, must be none, leader or all", requiredAcks)
+	}
+
+	// Get the timeout or default to 10 seconds
+	timeout := 10 * time.Second
+	if timeoutRaw, ok := conf.Config["timeout"]; ok {
+		value, err := time.ParseDuration(timeoutRaw)
+		if err != nil || value <= 0 {
+			return nil, fmt.Errorf("invalid timeout %q", timeoutRaw)
+		}
+		timeout = value
+	}
+
+	// Get the client ID or default to 'vault'
+	clientID, ok := conf.Config["client_id"]
+	if !ok {
+		clientID = "vault"
+	}
+
+	tlsConfig, err := parseTLSConfig(conf.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	saslUsername := conf.Config["sasl_username"]
+	switch mechanism := conf.Config["sasl_mechanism"]; mechanism {
+	case "":
+		if saslUsername != "" {
+			return nil, fmt.Errorf("sasl_mechanism is required with sasl_username")
+		}
+	case "PLAIN":
+		if saslUsername == "" {
+			return nil, fmt.Errorf("sasl_username is required with sasl_mechanism")
+		}
+	default:
+		return nil, fmt.Errorf("unsupported sasl_mechanism %q, only PLAIN is supported", mechanism)
+	}
+
+	// Check if hashing of accessor is disabled
+	hmacAccessor := true
+	if hmacAccessorRaw, ok := conf.Config["hmac_accessor"]; ok {
+		value, err := strconv.ParseBool(hmacAccessorRaw)
+		if err != nil {
+			return nil, err
+		}
+		hmacAccessor = value
+	}
+
+	// Check if raw logging is enabled
+	logRaw := false
+	if raw, ok := conf.Config["log_raw"]; ok {
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, err
+		}
+		logRaw = b
+	}
+
+	b := &Backend{
+		topic:        topic,
+		partitionBy:  partitionKey,
+		logRaw:       logRaw,
+		hmacAccessor: hmacAccessor,
+		salt:         conf.Salt,
+		producer: newProducer(producerConfig{
+			brokers:      brokers,
+			clientID:     clientID,
+			acks:         acks,
+			timeout:      timeout,
+			tlsConfig:    tlsConfig,
+			saslUsername: saslUsername,
+			saslPassword: conf.Config["sasl_password"],
+		}),
+	}
+
+	// Ensure that the brokers are reachable and the topic exists; otherwise
+	// every request would fail once the backend is enabled
+	if err := b.producer.Connect(topic); err != nil {
+		b.producer.Close()
+		return nil, fmt.Errorf("sanity check failed; unable to look up topic %s: %v", topic, err)
+	}
+
+	return b, nil
+}
+
+// parseTLSConfig returns the TLS configuration of the connections to the
+// brokers, or nil if TLS is not enabled
+func parseTLSConfig(conf map[string]string) (*tls.Config, error) {
+	enabled := false
+	if raw, ok := conf["tls_enabled"]; ok {
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, err
+		}
+		enabled = value
+	}
+	if !enabled {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+	if raw, ok := conf["tls_skip_verify"]; ok {
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.InsecureSkipVerify = value
+	}
+	if caPath, ok := conf["tls_ca_cert"]; ok {
+		pem, err := ioutil.ReadFile(caPath)
+		if err != nil {
+			return nil, fmt.Errorf("error reading tls_ca_cert: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in tls_ca_cert")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	certPath, hasCert := conf["tls_cert"]
+	keyPath, hasKey := conf["tls_key"]
+	if hasCert != hasKey {
+		return nil, fmt.Errorf("tls_cert and tls_key must be given together")
+	}
+	if hasCert {
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// Backend is the audit backend for the Kafka audit transport.
+type Backend struct {
+	producer    *producer
+	topic       string
+	partitionBy string
+
+	logRaw       bool
+	hmacAccessor bool
+	salt         *salt.Salt
+}
+
+func (b *Backend) GetHash(data string) string {
+	return audit.HashString(b.salt, data)
+}
+
+func (b *Backend) LogRequest(auth *logical.Auth, req *logical.Request, outerErr error) error {
+	key := b.partitionKey(auth, req)
+	if !b.logRaw {
+		// Before we copy the structure we must nil out some data
+		// otherwise we will cause reflection to panic and die
+		if req.Connection != nil && req.Connection.ConnState != nil {
+			origReq := req
+			origState := req.Connection.ConnState
+			req.Connection.ConnState = nil
+			defer func() {
+				origReq.Connection.ConnState = origState
+			}()
+		}
+
+		// Copy the structures
+		cp, err := copystructure.Copy(auth)
+		if err != nil {
+			return err
+		}
+		auth = cp.(*logical.Auth)
+
+		cp, err = copystructure.Copy(req)
+		if err != nil {
+			return err
+		}
+		req = cp.(*logical.Request)
+
+		// Hash any sensitive information
+		if err := audit.Hash(b.salt, auth); err != nil {
+			return err
+		}
+		if err := audit.Hash(b.salt, req, req.AuditNonHMACRequestKeys...); err != nil {
+			return err
+		}
+	}
+
+	// Encode the entry as JSON
+	var buf bytes.Buffer
+	var format audit.FormatJSON
+	if err := format.FormatRequest(&buf, auth, req, outerErr); err != nil {
+		return err
+	}
+
+	// Publish to the topic
+	return b.producer.Produce(b.topic, key, buf.Bytes())
+}
+
+func (b *Backend) LogResponse(auth *logical.Auth, req *logical.Request,
+	resp *logical.Response, err error) error {
+	key := b.partitionKey(auth, req)
+	if !b.logRaw {
+		// Before we copy the structure we must nil out some data
+		// otherwise we will cause reflection to panic and die
+		if req.Connection != nil && req.Connection.ConnState != nil {
+			origReq := req
+			origState := req.Connection.ConnState
+			req.Connection.ConnState = nil
+			defer func() {
+				origReq.Connection.ConnState = origState
+			}()
+		}
+
+		// Copy the structure
+		cp, err := copystructure.Copy(auth)
+		if err != nil {
+			return err
+		}
+		auth = cp.(*logical.Auth)
+
+		cp, err = copystructure.Copy(req)
+		if err != nil {
+			return err
+		}
+		req = cp.(*logical.Request)
+
+		cp, err = copystructure.Copy(resp)
+		if err != nil {
+			return err
+		}
+		resp = cp.(*logical.Response)
+
+		// Hash any sensitive information
+
+		// Cache and restore accessor in the auth
+		var accessor, wrappedAccessor string
+		if !b.hmacAccessor && auth != nil && auth.Accessor != "" {
+			accessor = auth.Accessor
+		}
+		if err := audit.Hash(b.salt, auth); err != nil {
+			return err
+		}
+		if accessor != "" {
+			auth.Accessor = accessor
+		}
+
+		if err := audit.Hash(b.salt, req, req.AuditNonHMACRequestKeys...); err != nil {
+			return err
+		}
+
+		// Cache and restore accessor in the response
+		accessor = ""
+		if !b.hmacAccessor && resp != nil && resp.Auth != nil && resp.Auth.Accessor != "" {
+			accessor = resp.Auth.Accessor
+		}
+		if !b.hmacAccessor && resp != nil && resp.WrapInfo != nil && resp.WrapInfo.WrappedAccessor != "" {
+			wrappedAccessor = resp.WrapInfo.WrappedAccessor
+		}
+		if err := audit.Hash(b.salt, resp, req.AuditNonHMACResponseKeys...); err != nil {
+			return err
+		}
+		if accessor != "" {
+			resp.Auth.Accessor = accessor
+		}
+		if wrappedAccessor != "" {
+			resp.WrapInfo.WrappedAccessor = wrappedAccessor
+		}
+	}
+
+	// Encode the entry as JSON
+	var buf bytes.Buffer
+	var format audit.FormatJSON
+	if err := format.FormatResponse(&buf, auth, req, resp, err); err != nil {
+		return err
+	}
+
+	// Publish to the topic
+	return b.producer.Produce(b.topic, key, buf.Bytes())
+}
+
+// partitionKey returns the key the entries of the request are partitioned
+// by, so that the entries with the same key are kept in order. It is read
+// before the request is hashed; entity IDs and mount points are not
+// sensitive.
+func (b *Backend) partitionKey(auth *logical.Auth, req *logical.Request) []byte {
+	var key string
+	switch b.partitionBy {
+	case "entity_id":
+		key = req.EntityID
+		if auth != nil && auth.EntityID != "" {
+			key = auth.EntityID
+		}
+	case "mount":
+		key = req.MountPoint
+	}
+	// Entries without a key, such as those of login requests when
+	// partitioning by entity, are spread over the partitions
+	if key == "" {
+		return nil
+	}
+	return []byte(key)
+}
+
+// Close closes the connections to the brokers
+func (b *Backend) Close() error {
+	return b.producer.Close()
+}
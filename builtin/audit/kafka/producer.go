@@ -0,0 +1,609 @@
+package kafka
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// The Kafka API keys and versions the producer speaks. Produce v3 with v2
+// record batches is supported by Kafka 0.11 and later.
+const (
+	apiKeyProduce          int16 = 0
+	apiKeyMetadata         int16 = 3
+	apiKeySaslHandshake    int16 = 17
+	apiKeySaslAuthenticate int16 = 36
+
+	apiVersionProduce          int16 = 3
+	apiVersionMetadata         int16 = 4
+	apiVersionSaslHandshake    int16 = 1
+	apiVersionSaslAuthenticate int16 = 1
+)
+
+// The acknowledgements a produce request can require
+const (
+	acksNone   int16 = 0
+	acksLeader int16 = 1
+	acksAll    int16 = -1
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// kafkaError is an error code returned by a broker
+type kafkaError int16
+
+func (e kafkaError) Error() string {
+	switch e {
+	case 2:
+		return "kafka: corrupt message"
+	case 3:
+		return "kafka: unknown topic or partition"
+	case 5:
+		return "kafka: leader not available"
+	case 6:
+		return "kafka: not leader for partition"
+	case 7:
+		return "kafka: request timed out"
+	case 10:
+		return "kafka: message too large"
+	case 19:
+		return "kafka: not enough replicas"
+	case 20:
+		return "kafka: not enough replicas after append"
+	case 29:
+		return "kafka: topic authorization failed"
+	case 33:
+		return "kafka: unsupported SASL mechanism"
+	case 58:
+		return "kafka: SASL authentication failed"
+	default:
+		return fmt.Sprintf("kafka: error code %d", int16(e))
+	}
+}
+
+// producerConfig configures a producer
+type producerConfig struct {
+	brokers   []string
+	clientID  string
+	acks      int16
+	timeout   time.Duration
+	tlsConfig *tls.Config
+
+	// The SASL PLAIN credentials, used if saslUsername is set
+	saslUsername string
+	saslPassword string
+}
+
+// producer publishes messages to Kafka topics. It implements only the
+// subset of the protocol the audit backend needs: it looks up the partition
+// leaders and sends each message in its own request, waiting for the
+// required acknowledgements.
+type producer struct {
+	config producerConfig
+
+	l             sync.Mutex
+	correlationID int32
+	conns         map[string]*brokerConn
+	brokers       map[int32]string
+	leaders       map[string][]int32
+	next          uint32
+}
+
+type brokerConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newProducer(config producerConfig) *producer {
+	return &producer{
+		config:  config,
+		conns:   make(map[string]*brokerConn),
+		brokers: make(map[int32]string),
+		leaders: make(map[string][]int32),
+	}
+}
+
+// Produce publishes the message to the topic. Messages with a key are sent
+// to the partition the key hashes to, the same one the Java client picks,
+// and the others to the partitions in turn. The partition leaders are looked
+// up again and the message resent once if it fails.
+func (p *producer) Produce(topic string, key, value []byte) error {
+	p.l.Lock()
+	defer p.l.Unlock()
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if attempt > 0 || p.leaders[topic] == nil {
+			if err = p.refreshMetadata(topic); err != nil {
+				continue
+			}
+		}
+
+		leaders := p.leaders[topic]
+		partition := p.partition(key, len(leaders))
+		addr, ok := p.brokers[leaders[partition]]
+		if !ok {
+			err = fmt.Errorf("no leader for partition %d of topic %s", partition, topic)
+			continue
+		}
+		if err = p.produce(addr, topic, partition, key, value); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// Connect looks up the partitions of the topic, ensuring the brokers are
+// reachable and the topic exists
+func (p *producer) Connect(topic string) error {
+	p.l.Lock()
+	defer p.l.Unlock()
+	return p.refreshMetadata(topic)
+}
+
+// Close closes the connections to the brokers
+func (p *producer) Close() error {
+	p.l.Lock()
+	defer p.l.Unlock()
+	for addr := range p.conns {
+		p.disconnect(addr)
+	}
+	return nil
+}
+
+// partition picks the partition of the message among n
+func (p *producer) partition(key []byte, n int) int32 {
+	if key == nil {
+		p.next++
+		return int32(p.next % uint32(n))
+	}
+	return (murmur2(key) & 0x7fffffff) % int32(n)
+}
+
+// refreshMetadata looks up the brokers and the partition leaders of the
+// topic, asking the configured brokers in turn
+func (p *producer) refreshMetadata(topic string) error {
+	var body encoder
+	body.int32(1)
+	body.string(topic)
+	// Do not create the topic, audit entries should not end up in a topic
+	// with the default settings of the cluster
+	body.int8(0)
+
+	var err error
+	for _, addr := range p.config.brokers {
+		var resp []byte
+		resp, err = p.request(addr, apiKeyMetadata, apiVersionMetadata, body.Bytes())
+		if err != nil {
+			continue
+		}
+		err = p.parseMetadata(topic, resp)
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+func (p *producer) parseMetadata(topic string, resp []byte) error {
+	d := &decoder{b: resp}
+	d.int32() // throttle time
+
+	brokers := make(map[int32]string)
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		nodeID := d.int32()
+		host := d.string()
+		port := d.int32()
+		d.nullableString() // rack
+		brokers[nodeID] = net.JoinHostPort(host, fmt.Sprintf("%d", port))
+	}
+	d.nullableString() // cluster ID
+	d.int32()          // controller ID
+
+	var leaders []int32
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		topicErr := d.int16()
+		name := d.string()
+		d.int8() // internal
+		var partitions []int32
+		var partitionLeaders []int32
+		for m := d.int32(); m > 0 && d.err == nil; m-- {
+			d.int16() // partition error, the leader is checked instead
+			partitions = append(partitions, d.int32())
+			partitionLeaders = append(partitionLeaders, d.int32())
+			d.int32Array() // replicas
+			d.int32Array() // in-sync replicas
+		}
+		if name != topic {
+			continue
+		}
+		if topicErr != 0 {
+			return kafkaError(topicErr)
+		}
+
+		// Index the leaders by partition
+		leaders = make([]int32, len(partitions))
+		for i := range leaders {
+			leaders[i] = -1
+		}
+		for i, partition := range partitions {
+			if partition >= 0 && int(partition) < len(leaders) {
+				leaders[partition] = partitionLeaders[i]
+			}
+		}
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if len(leaders) == 0 {
+		return kafkaError(3)
+	}
+
+	p.brokers = brokers
+	p.leaders[topic] = leaders
+	return nil
+}
+
+// produce sends the message to the leader of its partition
+func (p *producer) produce(addr, topic string, partition int32, key, value []byte) error {
+	var body encoder
+	body.int16(-1) // no transactional ID
+	body.int16(p.config.acks)
+	body.int32(int32(p.config.timeout / time.Millisecond))
+	body.int32(1)
+	body.string(topic)
+	body.int32(1)
+	body.int32(partition)
+	body.bytes(recordBatch(key, value, time.Now()))
+
+	resp, err := p.request(addr, apiKeyProduce, apiVersionProduce, body.Bytes())
+	if err != nil || p.config.acks == acksNone {
+		return err
+	}
+
+	d := &decoder{b: resp}
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		d.string() // topic
+		for m := d.int32(); m > 0 && d.err == nil; m-- {
+			d.int32() // partition
+			if code := d.int16(); code != 0 {
+				return kafkaError(code)
+			}
+			d.int64() // base offset
+			d.int64() // log append time
+		}
+	}
+	return d.err
+}
+
+// request sends the request to the broker and returns the body of its
+// response, which is nil for produce requests that require no
+// acknowledgement
+func (p *producer) request(addr string, apiKey, apiVersion int16, body []byte) ([]byte, error) {
+	bc, err := p.connect(addr)
+	if err != nil {
+		return nil, err
+	}
+	expectResponse := apiKey != apiKeyProduce || p.config.acks != acksNone
+	resp, err := p.roundTrip(bc, apiKey, apiVersion, body, expectResponse)
+	if err != nil {
+		p.disconnect(addr)
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (p *producer) roundTrip(bc *brokerConn, apiKey, apiVersion int16, body []byte, expectResponse bool) ([]byte, error) {
+	p.correlationID++
+	correlationID := p.correlationID
+
+	var req encoder
+	req.int32(0) // size, set below
+	req.int16(apiKey)
+	req.int16(apiVersion)
+	req.int32(correlationID)
+	req.string(p.config.clientID)
+	req.Write(body)
+	buf := req.Bytes()
+	binary.BigEndian.PutUint32(buf, uint32(len(buf)-4))
+
+	// Waiting for the acknowledgements can take up to the timeout the
+	// broker is given, on top of the network round trip
+	if err := bc.conn.SetDeadline(time.Now().Add(2 * p.config.timeout)); err != nil {
+		return nil, err
+	}
+	if _, err := bc.conn.Write(buf); err != nil {
+		return nil, err
+	}
+	if !expectResponse {
+		return nil, nil
+	}
+
+	var size int32
+	if err := binary.Read(bc.r, binary.BigEndian, &size); err != nil {
+		return nil, err
+	}
+	if size < 4 {
+		return nil, errors.New("kafka: invalid response size")
+	}
+	resp := make([]byte, size)
+	if _, err := io.ReadFull(bc.r, resp); err != nil {
+		return nil, err
+	}
+	if int32(binary.BigEndian.Uint32(resp)) != correlationID {
+		return nil, errors.New("kafka: response does not match the request")
+	}
+	return resp[4:], nil
+}
+
+// connect returns the connection to the broker, dialing and authenticating
+// if needed
+func (p *producer) connect(addr string) (*brokerConn, error) {
+	if bc, ok := p.conns[addr]; ok {
+		return bc, nil
+	}
+
+	dialer := &net.Dialer{Timeout: p.config.timeout}
+	var conn net.Conn
+	var err error
+	if p.config.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, p.config.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	bc := &brokerConn{conn: conn, r: bufio.NewReader(conn)}
+	if p.config.saslUsername != "" {
+		if err := p.authenticate(bc); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	p.conns[addr] = bc
+	return bc, nil
+}
+
+// authenticate performs a SASL PLAIN exchange on the connection
+func (p *producer) authenticate(bc *brokerConn) error {
+	var body encoder
+	body.string("PLAIN")
+	resp, err := p.roundTrip(bc, apiKeySaslHandshake, apiVersionSaslHandshake, body.Bytes(), true)
+	if err != nil {
+		return err
+	}
+	d := &decoder{b: resp}
+	if code := d.int16(); code != 0 {
+		return kafkaError(code)
+	}
+	if d.err != nil {
+		return d.err
+	}
+
+	body.Reset()
+	body.bytes([]byte("\x00" + p.config.saslUsername + "\x00" + p.config.saslPassword))
+	resp, err = p.roundTrip(bc, apiKeySaslAuthenticate, apiVersionSaslAuthenticate, body.Bytes(), true)
+	if err != nil {
+		return err
+	}
+	d = &decoder{b: resp}
+	code := d.int16()
+	message := d.nullableString()
+	if d.err != nil {
+		return d.err
+	}
+	if code != 0 {
+		if message != "" {
+			return fmt.Errorf("%v: %s", kafkaError(code), message)
+		}
+		return kafkaError(code)
+	}
+	return nil
+}
+
+func (p *producer) disconnect(addr string) {
+	if bc, ok := p.conns[addr]; ok {
+		bc.conn.Close()
+		delete(p.conns, addr)
+	}
+}
+
+// recordBatch encodes the message as a v2 record batch holding one record
+func recordBatch(key, value []byte, now time.Time) []byte {
+	var record encoder
+	record.int8(0)   // attributes
+	record.varint(0) // timestamp delta
+	record.varint(0) // offset delta
+	if key == nil {
+		record.varint(-1)
+	} else {
+		record.varint(int64(len(key)))
+		record.Write(key)
+	}
+	record.varint(int64(len(value)))
+	record.Write(value)
+	record.varint(0) // headers
+
+	timestamp := now.UnixNano() / int64(time.Millisecond)
+	var batch encoder
+	batch.int16(0) // attributes, no compression
+	batch.int32(0) // last offset delta
+	batch.int64(timestamp)
+	batch.int64(timestamp)
+	batch.int64(-1) // producer ID
+	batch.int16(-1) // producer epoch
+	batch.int32(-1) // base sequence
+	batch.int32(1)  // records
+	batch.varint(int64(record.Len()))
+	batch.Write(record.Bytes())
+
+	var e encoder
+	e.int64(0) // base offset
+	// The length counts the leader epoch, the magic byte and the CRC
+	e.int32(int32(4 + 1 + 4 + batch.Len()))
+	e.int32(-1) // partition leader epoch
+	e.int8(2)   // magic
+	e.int32(int32(crc32.Checksum(batch.Bytes(), castagnoli)))
+	e.Write(batch.Bytes())
+	return e.Bytes()
+}
+
+// murmur2 is the hash the Java client partitions keys with
+func murmur2(data []byte) int32 {
+	const (
+		seed uint32 = 0x9747b28c
+		m    uint32 = 0x5bd1e995
+		r           = 24
+	)
+
+	length := len(data)
+	h := seed ^ uint32(length)
+	for i := 0; i+4 <= length; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+
+	tail := data[length&^3:]
+	switch len(tail) {
+	case 3:
+		h ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(tail[0])
+		h *= m
+	}
+
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
+
+// encoder writes the big endian encoding of the protocol
+type encoder struct {
+	bytes.Buffer
+}
+
+func (e *encoder) int8(v int8) {
+	e.WriteByte(byte(v))
+}
+
+func (e *encoder) int16(v int16) {
+	var b [2]byte
+	binary.BigEndian.PutUint16(b[:], uint16(v))
+	e.Write(b[:])
+}
+
+func (e *encoder) int32(v int32) {
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(v))
+	e.Write(b[:])
+}
+
+func (e *encoder) int64(v int64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], uint64(v))
+	e.Write(b[:])
+}
+
+func (e *encoder) varint(v int64) {
+	var b [binary.MaxVarintLen64]byte
+	e.Write(b[:binary.PutVarint(b[:], v)])
+}
+
+func (e *encoder) string(s string) {
+	e.int16(int16(len(s)))
+	e.WriteString(s)
+}
+
+func (e *encoder) bytes(b []byte) {
+	e.int32(int32(len(b)))
+	e.Write(b)
+}
+
+// decoder reads the big endian encoding of the protocol, recording the
+// first error so that it is checked once
+type decoder struct {
+	b   []byte
+	err error
+}
+
+func (d *decoder) next(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || len(d.b) < n {
+		d.err = errors.New("kafka: truncated response")
+		return nil
+	}
+	b := d.b[:n]
+	d.b = d.b[n:]
+	return b
+}
+
+func (d *decoder) int8() int8 {
+	b := d.next(1)
+	if b == nil {
+		return 0
+	}
+	return int8(b[0])
+}
+
+func (d *decoder) int16() int16 {
+	b := d.next(2)
+	if b == nil {
+		return 0
+	}
+	return int16(binary.BigEndian.Uint16(b))
+}
+
+func (d *decoder) int32() int32 {
+	b := d.next(4)
+	if b == nil {
+		return 0
+	}
+	return int32(binary.BigEndian.Uint32(b))
+}
+
+func (d *decoder) int64() int64 {
+	b := d.next(8)
+	if b == nil {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(b))
+}
+
+func (d *decoder) string() string {
+	return string(d.next(int(d.int16())))
+}
+
+func (d *decoder) nullableString() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.next(int(n)))
+}
+
+func (d *decoder) int32Array() {
+	for n := d.int32(); n > 0 && d.err == nil; n-- {
+		d.int32()
+	}
+}
@@ -0,0 +1,283 @@
+package kafka
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMurmur2(t *testing.T) {
+	// The values the Java client computes
+	cases := map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+		"abc": 479470107,
+	}
+	for input, expected := range cases {
+		if actual := murmur2([]byte(input)); actual != expected {
+			t.Fatalf("bad hash of %q: %d", input, actual)
+		}
+	}
+}
+
+// testBroker is a single Kafka broker leading every partition of a topic,
+// recording the records produced to it
+type testBroker struct {
+	t          *testing.T
+	listener   net.Listener
+	topic      string
+	partitions int32
+	sasl       string
+
+	sync.Mutex
+	records []testRecord
+}
+
+type testRecord struct {
+	partition int32
+	key       []byte
+	value     []byte
+}
+
+func newTestBroker(t *testing.T, topic string, partitions int32) *testBroker {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	b := &testBroker{t: t, listener: ln, topic: topic, partitions: partitions}
+	go b.serve()
+	return b
+}
+
+func (b *testBroker) serve() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		go b.handle(conn)
+	}
+}
+
+func (b *testBroker) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		var size int32
+		if err := binary.Read(r, binary.BigEndian, &size); err != nil {
+			return
+		}
+		buf := make([]byte, size)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return
+		}
+		d := &decoder{b: buf}
+		apiKey := d.int16()
+		d.int16() // version
+		correlationID := d.int32()
+		d.nullableString() // client ID
+
+		var resp encoder
+		resp.int32(0)
+		resp.int32(correlationID)
+		switch apiKey {
+		case apiKeySaslHandshake:
+			resp.int16(0)
+			resp.int32(1)
+			resp.string("PLAIN")
+		case apiKeySaslAuthenticate:
+			d.int32()
+			if string(d.b) == b.sasl {
+				resp.int16(0)
+			} else {
+				resp.int16(58)
+			}
+			resp.int16(-1)
+			resp.int32(0)
+			resp.int64(0)
+		case apiKeyMetadata:
+			host, portRaw, _ := net.SplitHostPort(b.listener.Addr().String())
+			port, _ := strconv.Atoi(portRaw)
+			resp.int32(0)
+			resp.int32(1)
+			resp.int32(1)
+			resp.string(host)
+			resp.int32(int32(port))
+			resp.int16(-1)
+			resp.int16(-1)
+			resp.int32(1)
+			resp.int32(1)
+			resp.int16(0)
+			resp.string(b.topic)
+			resp.int8(0)
+			resp.int32(b.partitions)
+			for i := int32(0); i < b.partitions; i++ {
+				resp.int16(0)
+				resp.int32(i)
+				resp.int32(1)
+				resp.int32(0)
+				resp.int32(0)
+			}
+		case apiKeyProduce:
+			d.int16() // transactional ID
+			acks := d.int16()
+			d.int32()
+			d.int32()
+			d.string()
+			d.int32()
+			partition := d.int32()
+			d.int32()
+			b.record(partition, d.b)
+			if acks == acksNone {
+				continue
+			}
+			resp.int32(1)
+			resp.string(b.topic)
+			resp.int32(1)
+			resp.int32(partition)
+			resp.int16(0)
+			resp.int64(0)
+			resp.int64(-1)
+			resp.int32(0)
+		}
+		out := resp.Bytes()
+		binary.BigEndian.PutUint32(out, uint32(len(out)-4))
+		if _, err := conn.Write(out); err != nil {
+			return
+		}
+	}
+}
+
+// record decodes the record batch and records its record
+func (b *testBroker) record(partition int32, batch []byte) {
+	d := &decoder{b: batch}
+	d.int64()
+	if length := d.int32(); int(length) != len(d.b) {
+		b.t.Errorf("bad batch length: %d", length)
+	}
+	d.int32()
+	if magic := d.int8(); magic != 2 {
+		b.t.Errorf("bad magic: %d", magic)
+	}
+	crc := uint32(d.int32())
+	if crc32.Checksum(d.b, castagnoli) != crc {
+		b.t.Errorf("bad crc")
+	}
+	d.next(2 + 4 + 8 + 8 + 8 + 2 + 4 + 4)
+
+	varint := func() int64 {
+		v, n := binary.Varint(d.b)
+		d.b = d.b[n:]
+		return v
+	}
+	varint() // length
+	d.int8()
+	varint()
+	varint()
+	var rec testRecord
+	rec.partition = partition
+	if n := varint(); n >= 0 {
+		rec.key = d.next(int(n))
+	}
+	rec.value = d.next(int(varint()))
+
+	b.Lock()
+	defer b.Unlock()
+	b.records = append(b.records, rec)
+}
+
+func (b *testBroker) produced() []testRecord {
+	b.Lock()
+	defer b.Unlock()
+	return append([]testRecord(nil), b.records...)
+}
+
+func TestProducer(t *testing.T) {
+	broker := newTestBroker(t, "audit", 4)
+	defer broker.listener.Close()
+
+	p := newProducer(producerConfig{
+		brokers:  []string{broker.listener.Addr().String()},
+		clientID: "vault",
+		acks:     acksAll,
+		timeout:  5 * time.Second,
+	})
+	defer p.Close()
+
+	if err := p.Connect("missing"); err == nil {
+		t.Fatal("expected error for unknown topic")
+	}
+
+	// Keyed messages go to the partition of their key, the others are
+	// spread over the partitions
+	for i := 0; i < 2; i++ {
+		if err := p.Produce("audit", []byte("entity"), []byte("keyed")); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	for i := 0; i < 4; i++ {
+		if err := p.Produce("audit", nil, []byte("unkeyed")); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	records := broker.produced()
+	if len(records) != 6 {
+		t.Fatalf("bad: %#v", records)
+	}
+	expectedPartition := (murmur2([]byte("entity")) & 0x7fffffff) % 4
+	for _, rec := range records[:2] {
+		if rec.partition != expectedPartition || string(rec.key) != "entity" || string(rec.value) != "keyed" {
+			t.Fatalf("bad: %#v", rec)
+		}
+	}
+	seen := make(map[int32]bool)
+	for _, rec := range records[2:] {
+		if rec.key != nil || string(rec.value) != "unkeyed" {
+			t.Fatalf("bad: %#v", rec)
+		}
+		seen[rec.partition] = true
+	}
+	if len(seen) != 4 {
+		t.Fatalf("bad: %#v", records)
+	}
+}
+
+func TestProducer_sasl(t *testing.T) {
+	broker := newTestBroker(t, "audit", 1)
+	broker.sasl = "\x00vault\x00secret"
+	defer broker.listener.Close()
+
+	config := producerConfig{
+		brokers:      []string{broker.listener.Addr().String()},
+		clientID:     "vault",
+		acks:         acksLeader,
+		timeout:      5 * time.Second,
+		saslUsername: "vault",
+		saslPassword: "wrong",
+	}
+	p := newProducer(config)
+	if err := p.Connect("audit"); err == nil {
+		t.Fatal("expected authentication failure")
+	}
+	p.Close()
+
+	config.saslPassword = "secret"
+	p = newProducer(config)
+	defer p.Close()
+	if err := p.Produce("audit", nil, []byte("entry")); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if records := broker.produced(); len(records) != 1 {
+		t.Fatalf("bad: %#v", records)
+	}
+}
@@ -0,0 +1,304 @@
+package socket
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/helper/salt"
+	"github.com/hashicorp/vault/logical"
+	"github.com/mitchellh/copystructure"
+)
+
+func Factory(conf *audit.BackendConfig) (audit.Backend, error) {
+	if conf.Salt == nil {
+		return nil, fmt.Errorf("Nil salt passed in")
+	}
+
+	address, ok := conf.Config["address"]
+	if !ok {
+		return nil, fmt.Errorf("address is required")
+	}
+
+	// Get the socket type or default to tcp
+	socketType, ok := conf.Config["socket_type"]
+	if !ok {
+		socketType = "tcp"
+	}
+
+	// Get the write timeout or default to 2 seconds
+	writeTimeout := 2 * time.Second
+	if writeTimeoutRaw, ok := conf.Config["write_timeout"]; ok {
+		value, err := time.ParseDuration(writeTimeoutRaw)
+		if err != nil {
+			return nil, err
+		}
+		writeTimeout = value
+	}
+
+	// Check if hashing of accessor is disabled
+	hmacAccessor := true
+	if hmacAccessorRaw, ok := conf.Config["hmac_accessor"]; ok {
+		value, err := strconv.ParseBool(hmacAccessorRaw)
+		if err != nil {
+			return nil, err
+		}
+		hmacAccessor = value
+	}
+
+	// Check if raw logging is enabled
+	logRaw := false
+	if raw, ok := conf.Config["log_raw"]; ok {
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, err
+		}
+		logRaw = b
+	}
+
+	b := &Backend{
+		address:      address,
+		socketType:   socketType,
+		writeTimeout: writeTimeout,
+		logRaw:       logRaw,
+		hmacAccessor: hmacAccessor,
+		salt:         conf.Salt,
+	}
+
+	spoolConfig, err := audit.ParseSpoolConfig(conf.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ensure the socket is reachable. Without a spool the entries would be
+	// lost otherwise, while with one they are queued until it is.
+	b.Lock()
+	err = b.dial()
+	b.Unlock()
+	if err != nil && spoolConfig == nil {
+		return nil, fmt.Errorf("error connecting to %s: %v", address, err)
+	}
+
+	if spoolConfig != nil {
+		b.spool, err = audit.NewSpool(spoolConfig, b.send)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// Backend is the audit backend for the socket audit transport.
+type Backend struct {
+	sync.Mutex
+
+	address      string
+	socketType   string
+	writeTimeout time.Duration
+	connection   net.Conn
+
+	logRaw       bool
+	hmacAccessor bool
+	salt         *salt.Salt
+	spool        *audit.Spool
+}
+
+func (b *Backend) GetHash(data string) string {
+	return audit.HashString(b.salt, data)
+}
+
+func (b *Backend) LogRequest(auth *logical.Auth, req *logical.Request, outerErr error) error {
+	if !b.logRaw {
+		// Before we copy the structure we must nil out some data
+		// otherwise we will cause reflection to panic and die
+		if req.Connection != nil && req.Connection.ConnState != nil {
+			origReq := req
+			origState := req.Connection.ConnState
+			req.Connection.ConnState = nil
+			defer func() {
+				origReq.Connection.ConnState = origState
+			}()
+		}
+
+		// Copy the structures
+		cp, err := copystructure.Copy(auth)
+		if err != nil {
+			return err
+		}
+		auth = cp.(*logical.Auth)
+
+		cp, err = copystructure.Copy(req)
+		if err != nil {
+			return err
+		}
+		req = cp.(*logical.Request)
+
+		// Hash any sensitive information
+		if err := audit.Hash(b.salt, auth); err != nil {
+			return err
+		}
+		if err := audit.Hash(b.salt, req, req.AuditNonHMACRequestKeys...); err != nil {
+			return err
+		}
+	}
+
+	// Encode the entry as JSON
+	var buf bytes.Buffer
+	var format audit.FormatJSON
+	if err := format.FormatRequest(&buf, auth, req, outerErr); err != nil {
+		return err
+	}
+
+	// Write out to the socket
+	return b.write(buf.Bytes())
+}
+
+func (b *Backend) LogResponse(auth *logical.Auth, req *logical.Request,
+	resp *logical.Response, err error) error {
+	if !b.logRaw {
+		// Before we copy the structure we must nil out some data
+		// otherwise we will cause reflection to panic and die
+		if req.Connection != nil && req.Connection.ConnState != nil {
+			origReq := req
+			origState := req.Connection.ConnState
+			req.Connection.ConnState = nil
+			defer func() {
+				origReq.Connection.ConnState = origState
+			}()
+		}
+
+		// Copy the structure
+		cp, err := copystructure.Copy(auth)
+		if err != nil {
+			return err
+		}
+		auth = cp.(*logical.Auth)
+
+		cp, err = copystructure.Copy(req)
+		if err != nil {
+			return err
+		}
+		req = cp.(*logical.Request)
+
+		cp, err = copystructure.Copy(resp)
+		if err != nil {
+			return err
+		}
+		resp = cp.(*logical.Response)
+
+		// Hash any sensitive information
+
+		// Cache and restore accessor in the auth
+		var accessor, wrappedAccessor string
+		if !b.hmacAccessor && auth != nil && auth.Accessor != "" {
+			accessor = auth.Accessor
+		}
+		if err := audit.Hash(b.salt, auth); err != nil {
+			return err
+		}
+		if accessor != "" {
+			auth.Accessor = accessor
+		}
+
+		if err := audit.Hash(b.salt, req, req.AuditNonHMACRequestKeys...); err != nil {
+			return err
+		}
+
+		// Cache and restore accessor in the response
+		accessor = ""
+		if !b.hmacAccessor && resp != nil && resp.Auth != nil && resp.Auth.Accessor != "" {
+			accessor = resp.Auth.Accessor
+		}
+		if !b.hmacAccessor && resp != nil && resp.WrapInfo != nil && resp.WrapInfo.WrappedAccessor != "" {
+			wrappedAccessor = resp.WrapInfo.WrappedAccessor
+		}
+		if err := audit.Hash(b.salt, resp, req.AuditNonHMACResponseKeys...); err != nil {
+			return err
+		}
+		if accessor != "" {
+			resp.Auth.Accessor = accessor
+		}
+		if wrappedAccessor != "" {
+			resp.WrapInfo.WrappedAccessor = wrappedAccessor
+		}
+	}
+
+	// Encode the entry as JSON
+	var buf bytes.Buffer
+	var format audit.FormatJSON
+	if err := format.FormatResponse(&buf, auth, req, resp, err); err != nil {
+		return err
+	}
+
+	// Write out to the socket
+	return b.write(buf.Bytes())
+}
+
+// write sends the entry to the socket, through the spool if one is
+// configured
+func (b *Backend) write(entry []byte) error {
+	if b.spool != nil {
+		return b.spool.Write(entry)
+	}
+	return b.send(entry)
+}
+
+// send writes the entry to the socket, connecting first if needed. The
+// connection is dropped on failure so that the next entry reconnects.
+func (b *Backend) send(entry []byte) error {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.connection == nil {
+		if err := b.dial(); err != nil {
+			return err
+		}
+	}
+
+	if err := b.connection.SetWriteDeadline(time.Now().Add(b.writeTimeout)); err != nil {
+		b.reset()
+		return err
+	}
+	if _, err := b.connection.Write(entry); err != nil {
+		b.reset()
+		return err
+	}
+	return nil
+}
+
+// dial connects to the socket. It is called with the lock held.
+func (b *Backend) dial() error {
+	conn, err := net.DialTimeout(b.socketType, b.address, b.writeTimeout)
+	if err != nil {
+		return err
+	}
+	b.connection = conn
+	return nil
+}
+
+// reset closes the connection. It is called with the lock held.
+func (b *Backend) reset() {
+	if b.connection != nil {
+		b.connection.Close()
+		b.connection = nil
+	}
+}
+
+// Close closes the spool and the connection. The entries still queued in
+// the spool are sent once the backend is enabled again with the same
+// spool_path.
+func (b *Backend) Close() error {
+	var err error
+	if b.spool != nil {
+		err = b.spool.Close()
+	}
+
+	b.Lock()
+	defer b.Unlock()
+	b.reset()
+	return err
+}
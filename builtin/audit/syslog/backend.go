@@ -61,6 +61,22 @@ func Factory(conf *audit.BackendConfig) (audit.Backend, error) {
 		hmacAccessor: hmacAccessor,
 		salt:         conf.Salt,
 	}
+
+	// Queue the entries on disk while syslog is unreachable if a spool is
+	// configured
+	spoolConfig, err := audit.ParseSpoolConfig(conf.Config)
+	if err != nil {
+		return nil, err
+	}
+	if spoolConfig != nil {
+		b.spool, err = audit.NewSpool(spoolConfig, func(entry []byte) error {
+			_, err := logger.Write(entry)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
 	return b, nil
 }
 
@@ -70,6 +86,7 @@ type Backend struct {
 	logRaw       bool
 	hmacAccessor bool
 	salt         *salt.Salt
+	spool        *audit.Spool
 }
 
 func (b *Backend) GetHash(data string) string {
@@ -106,7 +123,7 @@ func (b *Backend) LogRequest(auth *logical.Auth, req *logical.Request, outerErr
 		if err := audit.Hash(b.salt, auth); err != nil {
 			return err
 		}
-		if err := audit.Hash(b.salt, req); err != nil {
+		if err := audit.Hash(b.salt, req, req.AuditNonHMACRequestKeys...); err != nil {
 			return err
 		}
 	}
@@ -119,8 +136,7 @@ func (b *Backend) LogRequest(auth *logical.Auth, req *logical.Request, outerErr
 	}
 
 	// Write out to syslog
-	_, err := b.logger.Write(buf.Bytes())
-	return err
+	return b.write(buf.Bytes())
 }
 
 func (b *Backend) LogResponse(auth *logical.Auth, req *logical.Request,
@@ -170,7 +186,7 @@ func (b *Backend) LogResponse(auth *logical.Auth, req *logical.Request,
 			auth.Accessor = accessor
 		}
 
-		if err := audit.Hash(b.salt, req); err != nil {
+		if err := audit.Hash(b.salt, req, req.AuditNonHMACRequestKeys...); err != nil {
 			return err
 		}
 
@@ -182,7 +198,7 @@ func (b *Backend) LogResponse(auth *logical.Auth, req *logical.Request,
 		if !b.hmacAccessor && resp != nil && resp.WrapInfo != nil && resp.WrapInfo.WrappedAccessor != "" {
 			wrappedAccessor = resp.WrapInfo.WrappedAccessor
 		}
-		if err := audit.Hash(b.salt, resp); err != nil {
+		if err := audit.Hash(b.salt, resp, req.AuditNonHMACResponseKeys...); err != nil {
 			return err
 		}
 		if accessor != "" {
@@ -200,7 +216,24 @@ func (b *Backend) LogResponse(auth *logical.Auth, req *logical.Request,
 		return err
 	}
 
-	// Write otu to syslog
-	_, err = b.logger.Write(buf.Bytes())
+	// Write out to syslog
+	return b.write(buf.Bytes())
+}
+
+// write sends the entry to syslog, through the spool if one is configured
+func (b *Backend) write(entry []byte) error {
+	if b.spool != nil {
+		return b.spool.Write(entry)
+	}
+	_, err := b.logger.Write(entry)
 	return err
 }
+
+// Close closes the spool. The entries still queued in it are sent once the
+// backend is enabled again with the same spool_path.
+func (b *Backend) Close() error {
+	if b.spool != nil {
+		return b.spool.Close()
+	}
+	return nil
+}
@@ -48,6 +48,13 @@ func (b *backend) pathLoginUpdate(req *logical.Request, data *framework.FieldDat
 		LeaseOptions: logical.LeaseOptions{
 			Renewable: true,
 		},
+		TokenType: role.TokenType,
+		Alias: &logical.Alias{
+			Name: role.RoleID,
+			Metadata: map[string]string{
+				"role_name": roleName,
+			},
+		},
 	}
 
 	// If 'Period' is set, use the value of 'Period' as the TTL.
@@ -53,6 +53,10 @@ type roleStorageEntry struct {
 	// value is not modified on the role. If the `Period` in the role is modified,
 	// a token will pick up the new value during its next renewal.
 	Period time.Duration `json:"period" mapstructure:"period" structs:"period"`
+
+	// The type of the tokens issued using this role, either "service" or
+	// "batch". Batch tokens are not persisted and cannot be renewed.
+	TokenType string `json:"token_type" mapstructure:"token_type" structs:"token_type"`
 }
 
 // roleIDStorageEntry represents the reverse mapping from RoleID to Role
@@ -141,6 +145,13 @@ TTL will be set to the value of this parameter.`,
 					Type:        framework.TypeString,
 					Description: "Identifier of the role. Defaults to a UUID.",
 				},
+				"token_type": &framework.FieldSchema{
+					Type:    framework.TypeString,
+					Default: "service",
+					Description: `The type of the issued tokens, either "service" or "batch". Batch
+tokens are not persisted and cannot be renewed, revoked or create child tokens.
+Defaults to "service".`,
+				},
 			},
 			ExistenceCheck: b.pathRoleExistenceCheck,
 			Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -634,6 +645,21 @@ func (b *backend) pathRoleCreateUpdate(req *logical.Request, data *framework.Fie
 		return logical.ErrorResponse(fmt.Sprintf("'period' of '%s' is greater than the backend's maximum lease TTL of '%s'", role.Period.String(), b.System().MaxLeaseTTL().String())), nil
 	}
 
+	if tokenTypeRaw, ok := data.GetOk("token_type"); ok {
+		role.TokenType = tokenTypeRaw.(string)
+	} else if req.Operation == logical.CreateOperation {
+		role.TokenType = data.Get("token_type").(string)
+	}
+	switch role.TokenType {
+	case "", "service":
+	case "batch":
+		if role.Period > time.Duration(0) {
+			return logical.ErrorResponse("batch tokens cannot be periodic"), nil
+		}
+	default:
+		return logical.ErrorResponse(fmt.Sprintf("invalid token_type %q", role.TokenType)), nil
+	}
+
 	if secretIDNumUsesRaw, ok := data.GetOk("secret_id_num_uses"); ok {
 		role.SecretIDNumUses = secretIDNumUsesRaw.(int)
 	} else if req.Operation == logical.CreateOperation {
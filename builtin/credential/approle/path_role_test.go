@@ -376,6 +376,7 @@ func TestAppRole_RoleCRUD(t *testing.T) {
 		"token_ttl":          400,
 		"token_max_ttl":      500,
 		"bound_cidr_list":    "127.0.0.1/32,127.0.0.1/16",
+		"token_type":         "service",
 	}
 	var expectedStruct roleStorageEntry
 	err = mapstructure.Decode(expected, &expectedStruct)
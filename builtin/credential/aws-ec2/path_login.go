@@ -398,6 +398,9 @@ func (b *backend) pathLoginUpdate(
 				"role":             roleName,
 				"ami_id":           identityDoc.AmiID,
 			},
+			Alias: &logical.Alias{
+				Name: identityDoc.InstanceID,
+			},
 			LeaseOptions: logical.LeaseOptions{
 				Renewable: true,
 				TTL:       roleEntry.TTL,
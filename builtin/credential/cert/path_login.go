@@ -75,6 +75,9 @@ func (b *backend) pathLogin(
 				"subject_key_id":   certutil.GetOctalFormatted(clientCerts[0].SubjectKeyId, ":"),
 				"authority_key_id": certutil.GetOctalFormatted(clientCerts[0].AuthorityKeyId, ":"),
 			},
+			Alias: &logical.Alias{
+				Name: clientCerts[0].Subject.CommonName,
+			},
 			LeaseOptions: logical.LeaseOptions{
 				Renewable: true,
 				TTL:       ttl,
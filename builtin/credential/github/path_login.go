@@ -51,6 +51,13 @@ func (b *backend) pathLogin(
 		return logical.ErrorResponse(fmt.Sprintf("[ERR]:%s", err)), nil
 	}
 
+	var groupAliases []*logical.Alias
+	for _, teamName := range verifyResp.TeamNames {
+		groupAliases = append(groupAliases, &logical.Alias{
+			Name: teamName,
+		})
+	}
+
 	return &logical.Response{
 		Auth: &logical.Auth{
 			InternalData: map[string]interface{}{
@@ -62,6 +69,10 @@ func (b *backend) pathLogin(
 				"org":      *verifyResp.Org.Login,
 			},
 			DisplayName: *verifyResp.User.Login,
+			Alias: &logical.Alias{
+				Name: *verifyResp.User.Login,
+			},
+			GroupAliases: groupAliases,
 			LeaseOptions: logical.LeaseOptions{
 				TTL:       ttl,
 				Renewable: true,
@@ -199,14 +210,16 @@ func (b *backend) verifyCredentials(req *logical.Request, token string) (*verify
 		return nil, nil, err
 	}
 	return &verifyCredentialsResp{
-		User:     user,
-		Org:      org,
-		Policies: policiesList,
+		User:      user,
+		Org:       org,
+		Policies:  policiesList,
+		TeamNames: teamNames,
 	}, nil, nil
 }
 
 type verifyCredentialsResp struct {
-	User     *github.User
-	Org      *github.Organization
-	Policies []string
+	User      *github.User
+	Org       *github.Organization
+	Policies  []string
+	TeamNames []string
 }
@@ -82,44 +82,46 @@ func EscapeLDAPValue(input string) string {
 	return input
 }
 
-func (b *backend) Login(req *logical.Request, username string, password string) ([]string, *logical.Response, error) {
+// Login authenticates the user and returns the policies of its groups, and
+// the names of the groups
+func (b *backend) Login(req *logical.Request, username string, password string) ([]string, []string, *logical.Response, error) {
 
 	cfg, err := b.Config(req)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 	if cfg == nil {
-		return nil, logical.ErrorResponse("ldap backend not configured"), nil
+		return nil, nil, logical.ErrorResponse("ldap backend not configured"), nil
 	}
 
 	c, err := cfg.DialLDAP()
 	if err != nil {
-		return nil, logical.ErrorResponse(err.Error()), nil
+		return nil, nil, logical.ErrorResponse(err.Error()), nil
 	}
 	if c == nil {
-		return nil, logical.ErrorResponse("invalid connection returned from LDAP dial"), nil
+		return nil, nil, logical.ErrorResponse("invalid connection returned from LDAP dial"), nil
 	}
 
 	bindDN, err := b.getBindDN(cfg, c, username)
 	if err != nil {
-		return nil, logical.ErrorResponse(err.Error()), nil
+		return nil, nil, logical.ErrorResponse(err.Error()), nil
 	}
 
 	b.Logger().Printf("[DEBUG] auth/ldap: BindDN for %s is %s", username, bindDN)
 
 	// Try to bind as the login user. This is where the actual authentication takes place.
 	if err = c.Bind(bindDN, password); err != nil {
-		return nil, logical.ErrorResponse(fmt.Sprintf("LDAP bind failed: %v", err)), nil
+		return nil, nil, logical.ErrorResponse(fmt.Sprintf("LDAP bind failed: %v", err)), nil
 	}
 
 	userDN, err := b.getUserDN(cfg, c, bindDN)
 	if err != nil {
-		return nil, logical.ErrorResponse(err.Error()), nil
+		return nil, nil, logical.ErrorResponse(err.Error()), nil
 	}
 
 	ldapGroups, err := b.getLdapGroups(cfg, c, userDN, username)
 	if err != nil {
-		return nil, logical.ErrorResponse(err.Error()), nil
+		return nil, nil, logical.ErrorResponse(err.Error()), nil
 	}
 	b.Logger().Printf("[DEBUG] auth/ldap: Server returned %d groups: %v", len(ldapGroups), ldapGroups)
 
@@ -159,10 +161,10 @@ func (b *backend) Login(req *logical.Request, username string, password string)
 		}
 
 		ldapResponse.Data["error"] = errStr
-		return nil, ldapResponse, nil
+		return nil, nil, ldapResponse, nil
 	}
 
-	return policies, ldapResponse, nil
+	return policies, allGroups, ldapResponse, nil
 }
 
 /*
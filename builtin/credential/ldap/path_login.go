@@ -39,7 +39,7 @@ func (b *backend) pathLogin(
 	username := d.Get("username").(string)
 	password := d.Get("password").(string)
 
-	policies, resp, err := b.Login(req, username, password)
+	policies, groupNames, resp, err := b.Login(req, username, password)
 	// Handle an internal error
 	if err != nil {
 		return nil, err
@@ -55,6 +55,13 @@ func (b *backend) pathLogin(
 
 	sort.Strings(policies)
 
+	var groupAliases []*logical.Alias
+	for _, groupName := range groupNames {
+		groupAliases = append(groupAliases, &logical.Alias{
+			Name: groupName,
+		})
+	}
+
 	resp.Auth = &logical.Auth{
 		Policies: policies,
 		Metadata: map[string]string{
@@ -65,6 +72,10 @@ func (b *backend) pathLogin(
 			"password": password,
 		},
 		DisplayName: username,
+		Alias: &logical.Alias{
+			Name: username,
+		},
+		GroupAliases: groupAliases,
 		LeaseOptions: logical.LeaseOptions{
 			Renewable: true,
 		},
@@ -78,7 +89,7 @@ func (b *backend) pathLoginRenew(
 	username := req.Auth.Metadata["username"]
 	password := req.Auth.InternalData["password"].(string)
 
-	loginPolicies, resp, err := b.Login(req, username, password)
+	loginPolicies, _, resp, err := b.Login(req, username, password)
 	if len(loginPolicies) == 0 {
 		return resp, err
 	}
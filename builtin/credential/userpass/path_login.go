@@ -73,6 +73,9 @@ func (b *backend) pathLogin(
 				"username": username,
 			},
 			DisplayName: username,
+			Alias: &logical.Alias{
+				Name: username,
+			},
 			LeaseOptions: logical.LeaseOptions{
 				TTL:       user.TTL,
 				Renewable: true,
@@ -0,0 +1,247 @@
+package kv
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/helper/locksutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	"github.com/mitchellh/mapstructure"
+)
+
+const (
+	// defaultMaxVersions is the number of versions of a key kept when
+	// neither the key nor the mount configure it
+	defaultMaxVersions = 10
+
+	metadataPrefix = "metadata/"
+	versionsPrefix = "versions/"
+)
+
+// Factory creates and configures the backend
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	b, err := Backend()
+	if err != nil {
+		return nil, err
+	}
+	return b.Setup(conf)
+}
+
+// Backend creates a new versioned key/value backend
+func Backend() (*backend, error) {
+	locks, err := locksutil.NewLockShards(256)
+	if err != nil {
+		return nil, err
+	}
+
+	var b backend
+	b.locks = locks
+	b.Backend = &framework.Backend{
+		Help: strings.TrimSpace(backendHelp),
+
+		Paths: []*framework.Path{
+			pathConfig(&b),
+			pathData(&b),
+			pathDelete(&b),
+			pathUndelete(&b),
+			pathDestroy(&b),
+			pathMetadata(&b),
+			pathSubkeys(&b),
+		},
+
+		Secrets: []*framework.Secret{},
+	}
+
+	return &b, nil
+}
+
+type backend struct {
+	*framework.Backend
+
+	// locks serialize the changes to each key, which read its metadata
+	// before writing it back
+	locks *locksutil.LockShards
+}
+
+// keyMetadata is the metadata of a key, holding the state of each of its
+// retained versions. It is stored under metadataPrefix and the key.
+type keyMetadata struct {
+	Key      string                   `json:"key"`
+	Versions map[int]*versionMetadata `json:"versions"`
+
+	// CurrentVersion is the latest version written, and OldestVersion the
+	// oldest one retained
+	CurrentVersion int `json:"current_version"`
+	OldestVersion  int `json:"oldest_version"`
+
+	// MaxVersions, CasRequired and DeleteVersionAfter override the mount
+	// configuration if set
+	MaxVersions        int           `json:"max_versions"`
+	CasRequired        bool          `json:"cas_required"`
+	DeleteVersionAfter time.Duration `json:"delete_version_after"`
+
+	CustomMetadata map[string]string `json:"custom_metadata"`
+
+	CreatedTime time.Time `json:"created_time"`
+	UpdatedTime time.Time `json:"updated_time"`
+}
+
+// versionMetadata is the state of a version of a key
+type versionMetadata struct {
+	CreatedTime time.Time `json:"created_time"`
+
+	// DeletionTime is when the version was or will be soft deleted, or zero
+	// if it is not scheduled to be. A soft deleted version can be undeleted.
+	DeletionTime time.Time `json:"deletion_time"`
+
+	// Destroyed is set when the data of the version has been removed
+	Destroyed bool `json:"destroyed"`
+}
+
+// deleted returns whether the version is soft deleted at the given time
+func (v *versionMetadata) deleted(now time.Time) bool {
+	return !v.DeletionTime.IsZero() && !v.DeletionTime.After(now)
+}
+
+// responseData returns the version metadata as returned to clients
+func (v *versionMetadata) responseData(version int, custom map[string]string) map[string]interface{} {
+	var deletionTime string
+	if !v.DeletionTime.IsZero() {
+		deletionTime = v.DeletionTime.Format(time.RFC3339Nano)
+	}
+	return map[string]interface{}{
+		"version":         version,
+		"created_time":    v.CreatedTime.Format(time.RFC3339Nano),
+		"deletion_time":   deletionTime,
+		"destroyed":       v.Destroyed,
+		"custom_metadata": custom,
+	}
+}
+
+// versionEntry is the data of a version of a key
+type versionEntry struct {
+	Data map[string]interface{} `json:"data"`
+}
+
+// config returns the configuration of the mount
+func (b *backend) config(s logical.Storage) (*configuration, error) {
+	entry, err := s.Get("config")
+	if err != nil {
+		return nil, err
+	}
+	config := &configuration{}
+	if entry == nil {
+		return config, nil
+	}
+	if err := entry.DecodeJSON(config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// metadata returns the metadata of the key, or nil if it does not exist
+func (b *backend) metadata(s logical.Storage, key string) (*keyMetadata, error) {
+	entry, err := s.Get(metadataPrefix + key)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+	var meta keyMetadata
+	if err := entry.DecodeJSON(&meta); err != nil {
+		return nil, err
+	}
+	if meta.Versions == nil {
+		meta.Versions = make(map[int]*versionMetadata)
+	}
+	return &meta, nil
+}
+
+func (b *backend) writeMetadata(s logical.Storage, meta *keyMetadata) error {
+	entry, err := logical.StorageEntryJSON(metadataPrefix+meta.Key, meta)
+	if err != nil {
+		return err
+	}
+	return s.Put(entry)
+}
+
+// versionPath returns the storage path of the data of a version of the key.
+// Keys are hashed so that the versions of a key cannot collide with those of
+// the keys below it.
+func versionPath(key string, version int) string {
+	sum := sha256.Sum256([]byte(key))
+	return versionsPrefix + hex.EncodeToString(sum[:]) + "/" + strconv.Itoa(version)
+}
+
+// maxVersions returns the number of versions of the key that are retained
+func (b *backend) maxVersions(config *configuration, meta *keyMetadata) int {
+	switch {
+	case meta.MaxVersions > 0:
+		return meta.MaxVersions
+	case config.MaxVersions > 0:
+		return config.MaxVersions
+	default:
+		return defaultMaxVersions
+	}
+}
+
+// trimVersions removes the versions of the key beyond the number retained,
+// oldest first. The metadata must be written afterwards.
+func (b *backend) trimVersions(s logical.Storage, config *configuration, meta *keyMetadata) error {
+	max := b.maxVersions(config, meta)
+	for meta.OldestVersion > 0 && meta.CurrentVersion-meta.OldestVersion >= max {
+		if err := s.Delete(versionPath(meta.Key, meta.OldestVersion)); err != nil {
+			return err
+		}
+		delete(meta.Versions, meta.OldestVersion)
+		meta.OldestVersion++
+	}
+	return nil
+}
+
+// parseVersions reads the versions given to the delete, undelete and
+// destroy paths, either as a list or as a comma separated string
+func parseVersions(d *framework.FieldData) ([]int, error) {
+	raw, ok := d.Raw["versions"]
+	if !ok {
+		return nil, fmt.Errorf("no versions provided")
+	}
+	if s, ok := raw.(string); ok {
+		var list []interface{}
+		for _, v := range strings.Split(s, ",") {
+			list = append(list, strings.TrimSpace(v))
+		}
+		raw = list
+	}
+
+	var versions []int
+	if err := mapstructure.WeakDecode(raw, &versions); err != nil {
+		return nil, fmt.Errorf("invalid versions: %v", err)
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("no versions provided")
+	}
+	for _, v := range versions {
+		if v <= 0 {
+			return nil, fmt.Errorf("invalid version %d", v)
+		}
+	}
+	return versions, nil
+}
+
+const backendHelp = `
+The kv backend stores versioned key/value secrets.
+
+Each write to a key under "data/" creates a new version of it. A number of
+previous versions are retained, and can be read, soft deleted, undeleted and
+destroyed individually. The metadata of each key, including the state of its
+versions, is managed under "metadata/", and the defaults for the mount under
+"config". The structure of a key, without its values, is read under
+"subkeys/".
+`
@@ -0,0 +1,376 @@
+package kv
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func testBackend(t *testing.T) (*backend, logical.Storage) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b, err := Backend()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+	return b, config.StorageView
+}
+
+func testRequest(t *testing.T, b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: op,
+		Path:      path,
+		Storage:   s,
+		Data:      data,
+	})
+	if err != nil {
+		t.Fatalf("bad: %s %s: err: %s", op, path, err)
+	}
+	return resp
+}
+
+func testWrite(t *testing.T, b *backend, s logical.Storage, path string, data map[string]interface{}) *logical.Response {
+	resp := testRequest(t, b, s, logical.UpdateOperation, path, data)
+	if resp != nil && resp.IsError() {
+		t.Fatalf("bad: %s: %#v", path, resp.Data)
+	}
+	return resp
+}
+
+// testReadData returns the data of the version of the key, or nil if it is
+// deleted or destroyed
+func testReadData(t *testing.T, b *backend, s logical.Storage, key string, version int) map[string]interface{} {
+	var data map[string]interface{}
+	if version != 0 {
+		data = map[string]interface{}{"version": version}
+	}
+	resp := testRequest(t, b, s, logical.ReadOperation, "data/"+key, data)
+	if resp == nil {
+		return nil
+	}
+	if resp.Data["data"] == nil {
+		return nil
+	}
+	return resp.Data["data"].(map[string]interface{})
+}
+
+func TestBackend_versions(t *testing.T) {
+	b, s := testBackend(t)
+
+	for _, value := range []string{"one", "two", "three"} {
+		testWrite(t, b, s, "data/foo", map[string]interface{}{
+			"data": map[string]interface{}{"value": value},
+		})
+	}
+
+	if data := testReadData(t, b, s, "foo", 0); data["value"] != "three" {
+		t.Fatalf("bad: %#v", data)
+	}
+	if data := testReadData(t, b, s, "foo", 1); data["value"] != "one" {
+		t.Fatalf("bad: %#v", data)
+	}
+	if resp := testRequest(t, b, s, logical.ReadOperation, "data/foo", map[string]interface{}{"version": 4}); resp != nil {
+		t.Fatalf("expected no version 4: %#v", resp)
+	}
+
+	// Soft deleting the key deletes its current version only
+	testRequest(t, b, s, logical.DeleteOperation, "data/foo", nil)
+	resp := testRequest(t, b, s, logical.ReadOperation, "data/foo", nil)
+	metadata := resp.Data["metadata"].(map[string]interface{})
+	if resp.Data["data"] != nil || metadata["version"] != 3 || metadata["deletion_time"] == "" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	testWrite(t, b, s, "undelete/foo", map[string]interface{}{"versions": []interface{}{3}})
+	if data := testReadData(t, b, s, "foo", 0); data["value"] != "three" {
+		t.Fatalf("bad: %#v", data)
+	}
+
+	testWrite(t, b, s, "delete/foo", map[string]interface{}{"versions": "1,2"})
+	if data := testReadData(t, b, s, "foo", 2); data != nil {
+		t.Fatalf("bad: %#v", data)
+	}
+
+	// Destroyed versions cannot be undeleted
+	testWrite(t, b, s, "destroy/foo", map[string]interface{}{"versions": []interface{}{"1"}})
+	testWrite(t, b, s, "undelete/foo", map[string]interface{}{"versions": "1,2"})
+	if data := testReadData(t, b, s, "foo", 1); data != nil {
+		t.Fatalf("bad: %#v", data)
+	}
+	if data := testReadData(t, b, s, "foo", 2); data["value"] != "two" {
+		t.Fatalf("bad: %#v", data)
+	}
+	if entry, err := s.Get(versionPath("foo", 1)); err != nil || entry != nil {
+		t.Fatalf("bad: %#v, %v", entry, err)
+	}
+
+	for _, versions := range []interface{}{nil, "", "0", []interface{}{"x"}} {
+		data := map[string]interface{}{"versions": versions}
+		if versions == nil {
+			data = nil
+		}
+		resp := testRequest(t, b, s, logical.UpdateOperation, "delete/foo", data)
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("expected error for %#v", versions)
+		}
+	}
+}
+
+func TestBackend_cas(t *testing.T) {
+	b, s := testBackend(t)
+
+	write := func(cas int) *logical.Response {
+		return testRequest(t, b, s, logical.UpdateOperation, "data/foo", map[string]interface{}{
+			"data":    map[string]interface{}{"value": "bar"},
+			"options": map[string]interface{}{"cas": cas},
+		})
+	}
+
+	if resp := write(1); resp == nil || !resp.IsError() {
+		t.Fatal("expected error for a key that does not exist")
+	}
+	if resp := write(0); resp.IsError() || resp.Data["version"] != 1 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if resp := write(0); resp == nil || !resp.IsError() {
+		t.Fatal("expected error for a key that exists")
+	}
+	if resp := write(1); resp.IsError() || resp.Data["version"] != 2 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Requiring check-and-set on the key rejects writes without it
+	testWrite(t, b, s, "metadata/foo", map[string]interface{}{"cas_required": true})
+	resp := testRequest(t, b, s, logical.UpdateOperation, "data/foo", map[string]interface{}{
+		"data": map[string]interface{}{"value": "bar"},
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected error without cas")
+	}
+
+	// As does requiring it on the mount
+	testWrite(t, b, s, "config", map[string]interface{}{"cas_required": true})
+	resp = testRequest(t, b, s, logical.UpdateOperation, "data/bar", map[string]interface{}{
+		"data": map[string]interface{}{"value": "bar"},
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatal("expected error without cas")
+	}
+}
+
+func TestBackend_maxVersions(t *testing.T) {
+	b, s := testBackend(t)
+	testWrite(t, b, s, "config", map[string]interface{}{"max_versions": 3})
+
+	for i := 0; i < 5; i++ {
+		testWrite(t, b, s, "data/foo", map[string]interface{}{
+			"data": map[string]interface{}{"value": i},
+		})
+	}
+	resp := testRequest(t, b, s, logical.ReadOperation, "metadata/foo", nil)
+	if resp.Data["current_version"] != 5 || resp.Data["oldest_version"] != 3 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if versions := resp.Data["versions"].(map[string]interface{}); len(versions) != 3 {
+		t.Fatalf("bad: %#v", versions)
+	}
+	if data := testReadData(t, b, s, "foo", 2); data != nil {
+		t.Fatalf("bad: %#v", data)
+	}
+	if entry, err := s.Get(versionPath("foo", 2)); err != nil || entry != nil {
+		t.Fatalf("bad: %#v, %v", entry, err)
+	}
+
+	// Lowering the maximum of the key trims it right away
+	testWrite(t, b, s, "metadata/foo", map[string]interface{}{"max_versions": 1})
+	resp = testRequest(t, b, s, logical.ReadOperation, "metadata/foo", nil)
+	if resp.Data["oldest_version"] != 5 || resp.Data["max_versions"] != 1 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if data := testReadData(t, b, s, "foo", 0); fmt.Sprint(data["value"]) != "4" {
+		t.Fatalf("bad: %#v", data)
+	}
+}
+
+func TestBackend_deleteVersionAfter(t *testing.T) {
+	b, s := testBackend(t)
+	testWrite(t, b, s, "config", map[string]interface{}{"delete_version_after": "1h"})
+	testWrite(t, b, s, "metadata/bar", map[string]interface{}{"delete_version_after": 1})
+
+	for _, key := range []string{"foo", "bar"} {
+		testWrite(t, b, s, "data/"+key, map[string]interface{}{
+			"data": map[string]interface{}{"value": key},
+		})
+	}
+
+	resp := testRequest(t, b, s, logical.ReadOperation, "data/foo", nil)
+	metadata := resp.Data["metadata"].(map[string]interface{})
+	if resp.Data["data"] == nil || metadata["deletion_time"] == "" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	if data := testReadData(t, b, s, "bar", 0); data != nil {
+		t.Fatalf("bad: %#v", data)
+	}
+	if data := testReadData(t, b, s, "foo", 0); data["value"] != "foo" {
+		t.Fatalf("bad: %#v", data)
+	}
+
+	// Undeleting cancels the scheduled deletion
+	testWrite(t, b, s, "undelete/bar", map[string]interface{}{"versions": "1"})
+	if data := testReadData(t, b, s, "bar", 0); data["value"] != "bar" {
+		t.Fatalf("bad: %#v", data)
+	}
+}
+
+func TestBackend_metadata(t *testing.T) {
+	b, s := testBackend(t)
+
+	testWrite(t, b, s, "metadata/foo/bar", map[string]interface{}{
+		"custom_metadata": map[string]interface{}{"owner": "ops"},
+	})
+	testWrite(t, b, s, "data/foo/bar", map[string]interface{}{
+		"data": map[string]interface{}{"value": "bar"},
+	})
+	testWrite(t, b, s, "data/foo/baz", map[string]interface{}{
+		"data": map[string]interface{}{"value": "baz"},
+	})
+	testWrite(t, b, s, "data/foo", map[string]interface{}{
+		"data": map[string]interface{}{"value": "foo"},
+	})
+
+	resp := testRequest(t, b, s, logical.ReadOperation, "data/foo/bar", nil)
+	metadata := resp.Data["metadata"].(map[string]interface{})
+	if !reflect.DeepEqual(metadata["custom_metadata"], map[string]string{"owner": "ops"}) {
+		t.Fatalf("bad: %#v", metadata)
+	}
+
+	resp = testRequest(t, b, s, logical.ListOperation, "metadata/", nil)
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"foo", "foo/"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	resp = testRequest(t, b, s, logical.ListOperation, "metadata/foo/", nil)
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"bar", "baz"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Deleting the metadata removes every version, leaving the other keys
+	testRequest(t, b, s, logical.DeleteOperation, "metadata/foo", nil)
+	if resp := testRequest(t, b, s, logical.ReadOperation, "data/foo", nil); resp != nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if entry, err := s.Get(versionPath("foo", 1)); err != nil || entry != nil {
+		t.Fatalf("bad: %#v, %v", entry, err)
+	}
+	if data := testReadData(t, b, s, "foo/bar", 0); data["value"] != "bar" {
+		t.Fatalf("bad: %#v", data)
+	}
+}
+
+func TestBackend_patch(t *testing.T) {
+	b, s := testBackend(t)
+
+	patch := func(data, options map[string]interface{}) *logical.Response {
+		return testRequest(t, b, s, logical.PatchOperation, "data/foo", map[string]interface{}{
+			"data":    data,
+			"options": options,
+		})
+	}
+
+	if resp := patch(map[string]interface{}{"a": "b"}, nil); resp == nil || !resp.IsError() {
+		t.Fatal("expected error for a key that does not exist")
+	}
+
+	testWrite(t, b, s, "data/foo", map[string]interface{}{
+		"data": map[string]interface{}{
+			"keep":   "value",
+			"remove": "value",
+			"nested": map[string]interface{}{"a": "1", "b": "2"},
+		},
+	})
+	resp := patch(map[string]interface{}{
+		"remove": nil,
+		"add":    "value",
+		"nested": map[string]interface{}{"a": nil, "c": "3"},
+	}, nil)
+	if resp.IsError() || resp.Data["version"] != 2 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	expected := map[string]interface{}{
+		"keep":   "value",
+		"add":    "value",
+		"nested": map[string]interface{}{"b": "2", "c": "3"},
+	}
+	if data := testReadData(t, b, s, "foo", 0); !reflect.DeepEqual(data, expected) {
+		t.Fatalf("bad: %#v", data)
+	}
+	if data := testReadData(t, b, s, "foo", 1); data["remove"] != "value" {
+		t.Fatalf("bad: %#v", data)
+	}
+
+	// Patches honor check-and-set
+	if resp := patch(map[string]interface{}{"a": "b"}, map[string]interface{}{"cas": 1}); resp == nil || !resp.IsError() {
+		t.Fatal("expected error for a stale cas")
+	}
+	if resp := patch(map[string]interface{}{"a": "b"}, map[string]interface{}{"cas": 2}); resp.IsError() || resp.Data["version"] != 3 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// A deleted current version cannot be patched
+	testRequest(t, b, s, logical.DeleteOperation, "data/foo", nil)
+	if resp := patch(map[string]interface{}{"a": "b"}, nil); resp == nil || !resp.IsError() {
+		t.Fatal("expected error for a deleted version")
+	}
+}
+
+func TestBackend_subkeys(t *testing.T) {
+	b, s := testBackend(t)
+
+	if resp := testRequest(t, b, s, logical.ReadOperation, "subkeys/foo", nil); resp != nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	testWrite(t, b, s, "data/foo", map[string]interface{}{
+		"data": map[string]interface{}{
+			"user": "app",
+			"nested": map[string]interface{}{
+				"password": "secret",
+				"deeper":   map[string]interface{}{"a": "1"},
+			},
+		},
+	})
+
+	cases := map[int]map[string]interface{}{
+		0: {
+			"user": nil,
+			"nested": map[string]interface{}{
+				"password": nil,
+				"deeper":   map[string]interface{}{"a": nil},
+			},
+		},
+		1: {"user": nil, "nested": nil},
+		2: {
+			"user":   nil,
+			"nested": map[string]interface{}{"password": nil, "deeper": nil},
+		},
+	}
+	for depth, expected := range cases {
+		resp := testRequest(t, b, s, logical.ReadOperation, "subkeys/foo", map[string]interface{}{"depth": depth})
+		if !reflect.DeepEqual(resp.Data["subkeys"], expected) {
+			t.Fatalf("bad: depth %d: %#v", depth, resp.Data["subkeys"])
+		}
+	}
+
+	// Deleted versions return their metadata only
+	testRequest(t, b, s, logical.DeleteOperation, "data/foo", nil)
+	resp := testRequest(t, b, s, logical.ReadOperation, "subkeys/foo", nil)
+	if resp.Data["subkeys"] != nil || resp.Data["metadata"] == nil {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
@@ -0,0 +1,103 @@
+package kv
+
+import (
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// configuration holds the defaults for the keys of the mount
+type configuration struct {
+	MaxVersions        int           `json:"max_versions"`
+	CasRequired        bool          `json:"cas_required"`
+	DeleteVersionAfter time.Duration `json:"delete_version_after"`
+}
+
+func pathConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config$",
+		Fields: map[string]*framework.FieldSchema{
+			"max_versions": &framework.FieldSchema{
+				Type: framework.TypeInt,
+				Description: `The number of versions kept for each key, unless set
+on the key. Defaults to 10.`,
+			},
+
+			"cas_required": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `If true, writes to every key must give the "cas"
+option.`,
+			},
+
+			"delete_version_after": &framework.FieldSchema{
+				Type: framework.TypeDurationSecond,
+				Description: `If set, each version is soft deleted this long after
+it is written, unless set on the key.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigRead,
+			logical.UpdateOperation: b.pathConfigWrite,
+		},
+
+		HelpSynopsis:    pathConfigHelpSyn,
+		HelpDescription: pathConfigHelpDesc,
+	}
+}
+
+func (b *backend) pathConfigRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"max_versions":         config.MaxVersions,
+			"cas_required":         config.CasRequired,
+			"delete_version_after": config.DeleteVersionAfter.String(),
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	config, err := b.config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if maxVersionsRaw, ok := d.GetOk("max_versions"); ok {
+		config.MaxVersions = maxVersionsRaw.(int)
+		if config.MaxVersions < 0 {
+			return logical.ErrorResponse("max_versions cannot be negative"), nil
+		}
+	}
+	if casRequiredRaw, ok := d.GetOk("cas_required"); ok {
+		config.CasRequired = casRequiredRaw.(bool)
+	}
+	if deleteAfterRaw, ok := d.GetOk("delete_version_after"); ok {
+		config.DeleteVersionAfter = time.Duration(deleteAfterRaw.(int)) * time.Second
+		if config.DeleteVersionAfter < 0 {
+			return logical.ErrorResponse("delete_version_after cannot be negative"), nil
+		}
+	}
+
+	entry, err := logical.StorageEntryJSON("config", config)
+	if err != nil {
+		return nil, err
+	}
+	return nil, req.Storage.Put(entry)
+}
+
+const pathConfigHelpSyn = `Configure the defaults for the keys of the backend`
+
+const pathConfigHelpDesc = `
+This path sets the number of versions kept for each key, whether writes must
+use check-and-set, and how long after being written versions are soft
+deleted. Each of these can also be set on a key through its metadata, which
+overrides the configuration here.
+`
@@ -0,0 +1,355 @@
+package kv
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	"github.com/mitchellh/mapstructure"
+)
+
+func pathData(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "data/(?P<path>.+)",
+		Fields: map[string]*framework.FieldSchema{
+			"path": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Location of the key",
+			},
+
+			"version": &framework.FieldSchema{
+				Type: framework.TypeInt,
+				Description: `The version to read. Defaults to the current
+version.`,
+			},
+
+			"data": &framework.FieldSchema{
+				Type:        framework.TypeMap,
+				Description: "The data of the new version of the key",
+			},
+
+			"options": &framework.FieldSchema{
+				Type: framework.TypeMap,
+				Description: `Options for the write. "cas" makes the write
+succeed only if the current version of the key is the given version, or if
+the key does not exist when 0 is given.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathDataRead,
+			logical.CreateOperation: b.pathDataWrite,
+			logical.UpdateOperation: b.pathDataWrite,
+			logical.PatchOperation:  b.pathDataPatch,
+			logical.DeleteOperation: b.pathDataDelete,
+		},
+
+		ExistenceCheck: b.pathDataExistenceCheck,
+
+		HelpSynopsis:    pathDataHelpSyn,
+		HelpDescription: pathDataHelpDesc,
+	}
+}
+
+func (b *backend) pathDataExistenceCheck(
+	req *logical.Request, d *framework.FieldData) (bool, error) {
+	meta, err := b.metadata(req.Storage, d.Get("path").(string))
+	if err != nil {
+		return false, err
+	}
+	return meta != nil && meta.CurrentVersion > 0, nil
+}
+
+func (b *backend) pathDataRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	key := d.Get("path").(string)
+
+	lock := b.locks.LockForKey(key)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	meta, err := b.metadata(req.Storage, key)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		return nil, nil
+	}
+
+	version := d.Get("version").(int)
+	if version == 0 {
+		version = meta.CurrentVersion
+	}
+	vm, ok := meta.Versions[version]
+	if !ok {
+		return nil, nil
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"data":     nil,
+			"metadata": vm.responseData(version, meta.CustomMetadata),
+		},
+	}
+
+	// The metadata of deleted and destroyed versions is still returned, so
+	// that clients can tell them from versions that do not exist
+	if vm.Destroyed || vm.deleted(time.Now()) {
+		return resp, nil
+	}
+
+	data, err := b.versionData(req.Storage, key, version)
+	if err != nil {
+		return nil, err
+	}
+	resp.Data["data"] = data
+
+	return resp, nil
+}
+
+func (b *backend) pathDataWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	key, data, cas, errResp := parseDataWrite(d)
+	if errResp != nil {
+		return errResp, nil
+	}
+
+	lock := b.locks.LockForKey(key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	config, err := b.config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := b.metadata(req.Storage, key)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		meta = &keyMetadata{
+			Key:         key,
+			Versions:    make(map[int]*versionMetadata),
+			CreatedTime: time.Now().UTC(),
+		}
+	}
+	if errResp := checkCAS(config, meta, cas); errResp != nil {
+		return errResp, nil
+	}
+
+	return b.writeVersion(req.Storage, config, meta, data)
+}
+
+// pathDataPatch writes a new version of the key, which is the current
+// version with the data merged into it as a JSON merge patch: null values
+// remove fields, objects are merged recursively and other values replace
+// the fields.
+func (b *backend) pathDataPatch(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	key, patch, cas, errResp := parseDataWrite(d)
+	if errResp != nil {
+		return errResp, nil
+	}
+
+	lock := b.locks.LockForKey(key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	config, err := b.config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := b.metadata(req.Storage, key)
+	if err != nil {
+		return nil, err
+	}
+	var current *versionMetadata
+	if meta != nil {
+		current = meta.Versions[meta.CurrentVersion]
+	}
+	if current == nil || current.Destroyed || current.deleted(time.Now()) {
+		return logical.ErrorResponse("the key has no current version to patch"), nil
+	}
+	if errResp := checkCAS(config, meta, cas); errResp != nil {
+		return errResp, nil
+	}
+
+	data, err := b.versionData(req.Storage, key, meta.CurrentVersion)
+	if err != nil {
+		return nil, err
+	}
+	mergePatch(data, patch)
+
+	return b.writeVersion(req.Storage, config, meta, data)
+}
+
+// parseDataWrite reads the key, data and check-and-set option of a write or
+// patch, returning an error response if they are invalid
+func parseDataWrite(d *framework.FieldData) (string, map[string]interface{}, *int, *logical.Response) {
+	key := d.Get("path").(string)
+	if strings.HasSuffix(key, "/") {
+		return "", nil, nil, logical.ErrorResponse("the key cannot end with a slash")
+	}
+
+	dataRaw, ok := d.GetOk("data")
+	if !ok {
+		return "", nil, nil, logical.ErrorResponse("no data provided")
+	}
+	data := dataRaw.(map[string]interface{})
+
+	var cas *int
+	if optionsRaw, ok := d.GetOk("options"); ok {
+		options := optionsRaw.(map[string]interface{})
+		if casRaw, ok := options["cas"]; ok {
+			var value int
+			if err := mapstructure.WeakDecode(casRaw, &value); err != nil {
+				return "", nil, nil, logical.ErrorResponse(fmt.Sprintf("invalid cas option: %v", err))
+			}
+			cas = &value
+		}
+	}
+	return key, data, cas, nil
+}
+
+// checkCAS returns an error response if the check-and-set option does not
+// match the current version of the key, or is missing while required
+func checkCAS(config *configuration, meta *keyMetadata, cas *int) *logical.Response {
+	switch {
+	case cas != nil:
+		if *cas != meta.CurrentVersion {
+			return logical.ErrorResponse(fmt.Sprintf(
+				"check-and-set parameter did not match the current version %d", meta.CurrentVersion))
+		}
+	case meta.CasRequired || config.CasRequired:
+		return logical.ErrorResponse("check-and-set parameter required for this call")
+	}
+	return nil
+}
+
+// versionData returns the data of a version of the key
+func (b *backend) versionData(s logical.Storage, key string, version int) (map[string]interface{}, error) {
+	entry, err := s.Get(versionPath(key, version))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("data of version %d of %s is missing", version, key)
+	}
+	var ve versionEntry
+	if err := entry.DecodeJSON(&ve); err != nil {
+		return nil, err
+	}
+	return ve.Data, nil
+}
+
+// writeVersion stores the data as the next version of the key and trims the
+// versions beyond those retained
+func (b *backend) writeVersion(s logical.Storage, config *configuration, meta *keyMetadata, data map[string]interface{}) (*logical.Response, error) {
+	version := meta.CurrentVersion + 1
+	entry, err := logical.StorageEntryJSON(versionPath(meta.Key, version), &versionEntry{
+		Data: data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Put(entry); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	vm := &versionMetadata{
+		CreatedTime: now,
+	}
+	deleteAfter := meta.DeleteVersionAfter
+	if deleteAfter == 0 {
+		deleteAfter = config.DeleteVersionAfter
+	}
+	if deleteAfter > 0 {
+		vm.DeletionTime = now.Add(deleteAfter)
+	}
+	meta.Versions[version] = vm
+	meta.CurrentVersion = version
+	if meta.OldestVersion == 0 {
+		meta.OldestVersion = version
+	}
+	meta.UpdatedTime = now
+
+	if err := b.trimVersions(s, config, meta); err != nil {
+		return nil, err
+	}
+	if err := b.writeMetadata(s, meta); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: vm.responseData(version, meta.CustomMetadata),
+	}, nil
+}
+
+// mergePatch applies the patch to the data as described in RFC 7386
+func mergePatch(data, patch map[string]interface{}) {
+	for k, v := range patch {
+		if v == nil {
+			delete(data, k)
+			continue
+		}
+		patchObject, ok := v.(map[string]interface{})
+		if !ok {
+			data[k] = v
+			continue
+		}
+		dataObject, ok := data[k].(map[string]interface{})
+		if !ok {
+			dataObject = make(map[string]interface{})
+		}
+		mergePatch(dataObject, patchObject)
+		data[k] = dataObject
+	}
+}
+
+// pathDataDelete soft deletes the current version of the key
+func (b *backend) pathDataDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	key := d.Get("path").(string)
+
+	lock := b.locks.LockForKey(key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	meta, err := b.metadata(req.Storage, key)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		return nil, nil
+	}
+
+	vm, ok := meta.Versions[meta.CurrentVersion]
+	now := time.Now().UTC()
+	if !ok || vm.Destroyed || vm.deleted(now) {
+		return nil, nil
+	}
+	vm.DeletionTime = now
+	meta.UpdatedTime = now
+
+	return nil, b.writeMetadata(req.Storage, meta)
+}
+
+const pathDataHelpSyn = `Read, write and delete the versions of a key`
+
+const pathDataHelpDesc = `
+Each write to a key creates a new version of it, and reads return the
+current version unless a version is given. The data of a write is given in
+"data", and the "cas" option in "options" makes the write conditional on the
+current version of the key.
+
+Patching a key writes a new version, which is the current version with the
+data merged into it as a JSON merge patch: null values remove fields, objects
+are merged and other values replace fields. Patches honor "cas" as writes do,
+and require the "patch" capability.
+
+Deleting a key soft deletes its current version, which can be undeleted.
+Reading a deleted or destroyed version returns its metadata with no data.
+`
@@ -0,0 +1,161 @@
+package kv
+
+import (
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// versionsFields are the fields of the paths changing the state of versions
+// of a key. The versions themselves are read by parseVersions, since they
+// can be given as a list, which the field schema has no type for.
+func versionsFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"path": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "Location of the key",
+		},
+	}
+}
+
+func pathDelete(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "delete/(?P<path>.+)",
+		Fields:  versionsFields(),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathVersionsUpdate(deleteVersion),
+		},
+
+		HelpSynopsis:    pathDeleteHelpSyn,
+		HelpDescription: pathDeleteHelpDesc,
+	}
+}
+
+func pathUndelete(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "undelete/(?P<path>.+)",
+		Fields:  versionsFields(),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathVersionsUpdate(undeleteVersion),
+		},
+
+		HelpSynopsis:    pathUndeleteHelpSyn,
+		HelpDescription: pathUndeleteHelpDesc,
+	}
+}
+
+func pathDestroy(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "destroy/(?P<path>.+)",
+		Fields:  versionsFields(),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathVersionsUpdate(destroyVersion),
+		},
+
+		HelpSynopsis:    pathDestroyHelpSyn,
+		HelpDescription: pathDestroyHelpDesc,
+	}
+}
+
+// versionUpdate changes the state of a version of a key, returning whether
+// the metadata of the key changed
+type versionUpdate func(s logical.Storage, key string, version int, vm *versionMetadata, now time.Time) (bool, error)
+
+func deleteVersion(s logical.Storage, key string, version int, vm *versionMetadata, now time.Time) (bool, error) {
+	if vm.Destroyed || vm.deleted(now) {
+		return false, nil
+	}
+	vm.DeletionTime = now
+	return true, nil
+}
+
+func undeleteVersion(s logical.Storage, key string, version int, vm *versionMetadata, now time.Time) (bool, error) {
+	if vm.Destroyed || vm.DeletionTime.IsZero() {
+		return false, nil
+	}
+	vm.DeletionTime = time.Time{}
+	return true, nil
+}
+
+func destroyVersion(s logical.Storage, key string, version int, vm *versionMetadata, now time.Time) (bool, error) {
+	if vm.Destroyed {
+		return false, nil
+	}
+	if err := s.Delete(versionPath(key, version)); err != nil {
+		return false, err
+	}
+	vm.Destroyed = true
+	return true, nil
+}
+
+// pathVersionsUpdate returns the callback applying the update to the given
+// versions of the key. Versions that do not exist are ignored.
+func (b *backend) pathVersionsUpdate(update versionUpdate) framework.OperationFunc {
+	return func(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+		key := d.Get("path").(string)
+		versions, err := parseVersions(d)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+
+		lock := b.locks.LockForKey(key)
+		lock.Lock()
+		defer lock.Unlock()
+
+		meta, err := b.metadata(req.Storage, key)
+		if err != nil {
+			return nil, err
+		}
+		if meta == nil {
+			return nil, nil
+		}
+
+		now := time.Now().UTC()
+		changed := false
+		for _, version := range versions {
+			vm, ok := meta.Versions[version]
+			if !ok {
+				continue
+			}
+			versionChanged, err := update(req.Storage, key, version, vm, now)
+			if err != nil {
+				return nil, err
+			}
+			changed = changed || versionChanged
+		}
+		if !changed {
+			return nil, nil
+		}
+		meta.UpdatedTime = now
+
+		return nil, b.writeMetadata(req.Storage, meta)
+	}
+}
+
+const pathDeleteHelpSyn = `Soft delete versions of a key`
+
+const pathDeleteHelpDesc = `
+The versions are given in "versions", as a list or a comma separated string.
+They are no longer returned by reads, but their data is kept so that they
+can be undeleted.
+`
+
+const pathUndeleteHelpSyn = `Undelete soft deleted versions of a key`
+
+const pathUndeleteHelpDesc = `
+The versions are given in "versions", as a list or a comma separated string.
+They are returned by reads again, which also cancels their deletion if
+delete_version_after scheduled one. Destroyed versions cannot be undeleted.
+`
+
+const pathDestroyHelpSyn = `Permanently remove versions of a key`
+
+const pathDestroyHelpDesc = `
+The versions are given in "versions", as a list or a comma separated string.
+Their data is removed and cannot be recovered, while their metadata is kept
+and marked as destroyed.
+`
@@ -0,0 +1,223 @@
+package kv
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	"github.com/mitchellh/mapstructure"
+)
+
+func pathMetadata(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "metadata/(?P<path>.*)",
+		Fields: map[string]*framework.FieldSchema{
+			"path": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Location of the key",
+			},
+
+			"max_versions": &framework.FieldSchema{
+				Type: framework.TypeInt,
+				Description: `The number of versions kept for the key. If unset,
+the mount configuration applies.`,
+			},
+
+			"cas_required": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `If true, writes to the key must give the "cas"
+option. Writes also require it if the mount configuration does.`,
+			},
+
+			"delete_version_after": &framework.FieldSchema{
+				Type: framework.TypeDurationSecond,
+				Description: `If set, each version of the key is soft deleted this
+long after it is written. If unset, the mount configuration applies.`,
+			},
+
+			"custom_metadata": &framework.FieldSchema{
+				Type:        framework.TypeMap,
+				Description: "String values describing the key, returned with its versions",
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathMetadataRead,
+			logical.CreateOperation: b.pathMetadataWrite,
+			logical.UpdateOperation: b.pathMetadataWrite,
+			logical.DeleteOperation: b.pathMetadataDelete,
+			logical.ListOperation:   b.pathMetadataList,
+		},
+
+		ExistenceCheck: b.pathMetadataExistenceCheck,
+
+		HelpSynopsis:    pathMetadataHelpSyn,
+		HelpDescription: pathMetadataHelpDesc,
+	}
+}
+
+func (b *backend) pathMetadataExistenceCheck(
+	req *logical.Request, d *framework.FieldData) (bool, error) {
+	meta, err := b.metadata(req.Storage, d.Get("path").(string))
+	if err != nil {
+		return false, err
+	}
+	return meta != nil, nil
+}
+
+func (b *backend) pathMetadataList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	key := d.Get("path").(string)
+	if key != "" && !strings.HasSuffix(key, "/") {
+		key += "/"
+	}
+
+	keys, err := req.Storage.List(metadataPrefix + key)
+	if err != nil {
+		return nil, err
+	}
+	return logical.ListResponse(keys), nil
+}
+
+func (b *backend) pathMetadataRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	key := d.Get("path").(string)
+
+	lock := b.locks.LockForKey(key)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	meta, err := b.metadata(req.Storage, key)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		return nil, nil
+	}
+
+	versions := make(map[string]interface{}, len(meta.Versions))
+	for version, vm := range meta.Versions {
+		data := vm.responseData(version, nil)
+		delete(data, "version")
+		delete(data, "custom_metadata")
+		versions[strconv.Itoa(version)] = data
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"versions":             versions,
+			"current_version":      meta.CurrentVersion,
+			"oldest_version":       meta.OldestVersion,
+			"max_versions":         meta.MaxVersions,
+			"cas_required":         meta.CasRequired,
+			"delete_version_after": meta.DeleteVersionAfter.String(),
+			"custom_metadata":      meta.CustomMetadata,
+			"created_time":         meta.CreatedTime.Format(time.RFC3339Nano),
+			"updated_time":         meta.UpdatedTime.Format(time.RFC3339Nano),
+		},
+	}, nil
+}
+
+func (b *backend) pathMetadataWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	key := d.Get("path").(string)
+	if key == "" || strings.HasSuffix(key, "/") {
+		return logical.ErrorResponse("the key cannot be empty or end with a slash"), nil
+	}
+
+	lock := b.locks.LockForKey(key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	config, err := b.config(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := b.metadata(req.Storage, key)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if meta == nil {
+		meta = &keyMetadata{
+			Key:         key,
+			Versions:    make(map[int]*versionMetadata),
+			CreatedTime: now,
+		}
+	}
+
+	if maxVersionsRaw, ok := d.GetOk("max_versions"); ok {
+		meta.MaxVersions = maxVersionsRaw.(int)
+		if meta.MaxVersions < 0 {
+			return logical.ErrorResponse("max_versions cannot be negative"), nil
+		}
+	}
+	if casRequiredRaw, ok := d.GetOk("cas_required"); ok {
+		meta.CasRequired = casRequiredRaw.(bool)
+	}
+	if deleteAfterRaw, ok := d.GetOk("delete_version_after"); ok {
+		meta.DeleteVersionAfter = time.Duration(deleteAfterRaw.(int)) * time.Second
+		if meta.DeleteVersionAfter < 0 {
+			return logical.ErrorResponse("delete_version_after cannot be negative"), nil
+		}
+	}
+	if customRaw, ok := d.GetOk("custom_metadata"); ok {
+		var custom map[string]string
+		if err := mapstructure.WeakDecode(customRaw, &custom); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("invalid custom_metadata: %v", err)), nil
+		}
+		meta.CustomMetadata = custom
+	}
+	meta.UpdatedTime = now
+
+	// Lowering max_versions removes the excess versions right away
+	if err := b.trimVersions(req.Storage, config, meta); err != nil {
+		return nil, err
+	}
+	return nil, b.writeMetadata(req.Storage, meta)
+}
+
+// pathMetadataDelete removes the key, with all of its versions
+func (b *backend) pathMetadataDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	key := d.Get("path").(string)
+
+	lock := b.locks.LockForKey(key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	meta, err := b.metadata(req.Storage, key)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		return nil, nil
+	}
+
+	for version, vm := range meta.Versions {
+		if vm.Destroyed {
+			continue
+		}
+		if err := req.Storage.Delete(versionPath(key, version)); err != nil {
+			return nil, err
+		}
+	}
+	return nil, req.Storage.Delete(metadataPrefix + key)
+}
+
+const pathMetadataHelpSyn = `Manage the metadata and settings of a key`
+
+const pathMetadataHelpDesc = `
+Reading the metadata of a key returns the state of each of its retained
+versions, along with its settings and custom metadata. Writing it sets the
+number of versions kept, whether writes require check-and-set, how long
+versions are kept before being soft deleted and the custom metadata, and can
+be done before the key is first written. Listing it lists the keys below the
+given path.
+
+Deleting the metadata of a key permanently removes the key and all of its
+versions.
+`
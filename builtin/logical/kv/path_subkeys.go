@@ -0,0 +1,117 @@
+package kv
+
+import (
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathSubkeys(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "subkeys/(?P<path>.+)",
+		Fields: map[string]*framework.FieldSchema{
+			"path": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Location of the key",
+			},
+
+			"version": &framework.FieldSchema{
+				Type: framework.TypeInt,
+				Description: `The version to read. Defaults to the current
+version.`,
+			},
+
+			"depth": &framework.FieldSchema{
+				Type: framework.TypeInt,
+				Description: `The number of levels of nesting returned. Objects
+deeper than this are returned as null. Defaults to 0, which returns every
+level.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathSubkeysRead,
+		},
+
+		HelpSynopsis:    pathSubkeysHelpSyn,
+		HelpDescription: pathSubkeysHelpDesc,
+	}
+}
+
+func (b *backend) pathSubkeysRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	key := d.Get("path").(string)
+	depth := d.Get("depth").(int)
+	if depth < 0 {
+		return logical.ErrorResponse("depth cannot be negative"), nil
+	}
+
+	lock := b.locks.LockForKey(key)
+	lock.RLock()
+	defer lock.RUnlock()
+
+	meta, err := b.metadata(req.Storage, key)
+	if err != nil {
+		return nil, err
+	}
+	if meta == nil {
+		return nil, nil
+	}
+
+	version := d.Get("version").(int)
+	if version == 0 {
+		version = meta.CurrentVersion
+	}
+	vm, ok := meta.Versions[version]
+	if !ok {
+		return nil, nil
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"subkeys":  nil,
+			"metadata": vm.responseData(version, meta.CustomMetadata),
+		},
+	}
+	if vm.Destroyed || vm.deleted(time.Now()) {
+		return resp, nil
+	}
+
+	data, err := b.versionData(req.Storage, key, version)
+	if err != nil {
+		return nil, err
+	}
+	resp.Data["subkeys"] = subkeys(data, depth)
+
+	return resp, nil
+}
+
+// subkeys returns the structure of the data with its values replaced by nil.
+// Objects nested deeper than depth are replaced by nil as well, unless depth
+// is 0.
+func subkeys(data map[string]interface{}, depth int) map[string]interface{} {
+	result := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		object, ok := v.(map[string]interface{})
+		if !ok || depth == 1 {
+			result[k] = nil
+			continue
+		}
+		next := depth
+		if next > 0 {
+			next--
+		}
+		result[k] = subkeys(object, next)
+	}
+	return result
+}
+
+const pathSubkeysHelpSyn = `Read the structure of a version of a key, without its values`
+
+const pathSubkeysHelpDesc = `
+The field names of the version are returned with null values, and nested
+objects are returned with the same structure up to the given depth. Since the
+values are not returned, this can be granted to clients that discover the
+fields of keys without granting them read access to "data/".
+`
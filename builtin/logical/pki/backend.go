@@ -25,8 +25,14 @@ func Backend() *backend {
 				"cert/*",
 				"ca/pem",
 				"ca",
+				"ca_chain",
 				"crl/pem",
 				"crl",
+				"crl/delta",
+				"crl/delta/pem",
+				"crl/issuer/*",
+				"ocsp",
+				"ocsp/*",
 			},
 		},
 
@@ -37,7 +43,11 @@ func Backend() *backend {
 			pathGenerateIntermediate(&b),
 			pathSetSignedIntermediate(&b),
 			pathSignIntermediate(&b),
+			pathCrossSign(&b),
 			pathConfigCA(&b),
+			pathConfigIssuers(&b),
+			pathListIssuers(&b),
+			pathIssuer(&b),
 			pathConfigCRL(&b),
 			pathConfigURLs(&b),
 			pathSignVerbatim(&b),
@@ -45,10 +55,15 @@ func Backend() *backend {
 			pathIssue(&b),
 			pathRotateCRL(&b),
 			pathFetchCA(&b),
+			pathFetchCAChain(&b),
 			pathFetchCRL(&b),
+			pathFetchDeltaCRL(&b),
+			pathFetchIssuerCRL(&b),
 			pathFetchCRLViaCertPath(&b),
 			pathFetchValid(&b),
 			pathFetchListCerts(&b),
+			pathOCSP(&b),
+			pathOCSPGet(&b),
 			pathRevoke(&b),
 			pathTidy(&b),
 		},
@@ -56,6 +71,8 @@ func Backend() *backend {
 		Secrets: []*framework.Secret{
 			secretCerts(&b),
 		},
+
+		PeriodicFunc: b.periodicFunc,
 	}
 
 	b.crlLifetime = time.Hour * 72
@@ -68,6 +85,10 @@ type backend struct {
 
 	crlLifetime       time.Duration
 	revokeStorageLock sync.RWMutex
+
+	// issuersLock serializes changes to the set of issuers and to the
+	// default issuer
+	issuersLock sync.Mutex
 }
 
 const backendHelp = `
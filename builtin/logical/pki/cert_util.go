@@ -8,6 +8,7 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/asn1"
+	"encoding/base64"
 	"encoding/pem"
 	"fmt"
 	"net"
@@ -55,7 +56,20 @@ type creationBundle struct {
 
 type caInfoBundle struct {
 	certutil.ParsedCertBundle
-	URLs *urlEntries
+	URLs     *urlEntries
+	IssuerID string
+}
+
+// caChain returns the chain of the certificates issued by the CA, from the
+// CA certificate up to the root
+func (c *caInfoBundle) caChain() []*certutil.CertBlock {
+	chain := []*certutil.CertBlock{
+		&certutil.CertBlock{
+			Certificate: c.Certificate,
+			Bytes:       c.CertificateBytes,
+		},
+	}
+	return append(chain, c.CAChain...)
 }
 
 var (
@@ -84,6 +98,19 @@ func getFormat(data *framework.FieldData) string {
 	return format
 }
 
+// caChainData returns the CA chain of an issued bundle in the format of the
+// response
+func caChainData(format string, parsedBundle *certutil.ParsedCertBundle, cb *certutil.CertBundle) []string {
+	if format != "der" {
+		return cb.CAChain
+	}
+	chain := make([]string, len(parsedBundle.CAChain))
+	for i, chainCert := range parsedBundle.CAChain {
+		chain[i] = base64.StdEncoding.EncodeToString(chainCert.Bytes)
+	}
+	return chain
+}
+
 func validateKeyTypeLength(keyType string, keyBits int) *logical.Response {
 	switch keyType {
 	case "rsa":
@@ -113,23 +140,38 @@ func validateKeyTypeLength(keyType string, keyBits int) *logical.Response {
 	return nil
 }
 
-// Fetches the CA info. Unlike other certificates, the CA info is stored
-// in the backend as a CertBundle, because we are storing its private key
-func fetchCAInfo(req *logical.Request) (*caInfoBundle, error) {
-	bundleEntry, err := req.Storage.Get("config/ca_bundle")
+// Fetches the CA info of an issuer, given by ID or name, or of the default
+// issuer if the reference is empty or "default". Unlike other certificates,
+// the CA info is stored in the backend as a CertBundle, because we are
+// storing its private key
+func fetchCAInfo(b *backend, req *logical.Request, issuerRef string) (*caInfoBundle, error) {
+	issuer, err := b.resolveIssuer(req.Storage, issuerRef)
 	if err != nil {
-		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to fetch local CA certificate/key: %v", err)}
+		return nil, err
 	}
-	if bundleEntry == nil {
-		return nil, errutil.UserError{Err: "backend must be configured with a CA certificate/key"}
+	return caInfoFromIssuer(req, issuer)
+}
+
+// fetchAllCAInfo fetches the CA info of every issuer
+func fetchAllCAInfo(b *backend, req *logical.Request) ([]*caInfoBundle, error) {
+	issuers, err := b.listIssuers(req.Storage)
+	if err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to fetch issuers: %v", err)}
 	}
 
-	var bundle certutil.CertBundle
-	if err := bundleEntry.DecodeJSON(&bundle); err != nil {
-		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to decode local CA certificate/key: %v", err)}
+	caInfos := make([]*caInfoBundle, 0, len(issuers))
+	for _, issuer := range issuers {
+		caInfo, err := caInfoFromIssuer(req, issuer)
+		if err != nil {
+			return nil, err
+		}
+		caInfos = append(caInfos, caInfo)
 	}
+	return caInfos, nil
+}
 
-	parsedBundle, err := bundle.ToParsedCertBundle()
+func caInfoFromIssuer(req *logical.Request, issuer *issuerEntry) (*caInfoBundle, error) {
+	parsedBundle, err := issuer.Bundle.ToParsedCertBundle()
 	if err != nil {
 		return nil, errutil.InternalError{Err: err.Error()}
 	}
@@ -138,7 +180,7 @@ func fetchCAInfo(req *logical.Request) (*caInfoBundle, error) {
 		return nil, errutil.InternalError{Err: "stored CA information not able to be parsed"}
 	}
 
-	caInfo := &caInfoBundle{*parsedBundle, nil}
+	caInfo := &caInfoBundle{*parsedBundle, nil, issuer.ID}
 
 	entries, err := getURLs(req)
 	if err != nil {
@@ -157,7 +199,7 @@ func fetchCAInfo(req *logical.Request) (*caInfoBundle, error) {
 }
 
 // Allows fetching certificates from the backend; it handles the slightly
-// separate pathing for CA, CRL, and revoked certificates.
+// separate pathing for revoked certificates.
 func fetchCertBySerial(req *logical.Request, prefix, serial string) (*logical.StorageEntry, error) {
 	var path string
 
@@ -166,10 +208,6 @@ func fetchCertBySerial(req *logical.Request, prefix, serial string) (*logical.St
 	// we actually want revocation info
 	case strings.HasPrefix(prefix, "revoked/"):
 		path = "revoked/" + strings.Replace(strings.ToLower(serial), "-", ":", -1)
-	case serial == "ca":
-		path = "ca"
-	case serial == "crl":
-		path = "crl"
 	default:
 		path = "certs/" + strings.Replace(strings.ToLower(serial), "-", ":", -1)
 	}
@@ -858,6 +896,7 @@ func createCertificate(creationInfo *creationBundle) (*certutil.ParsedCertBundle
 	if creationInfo.SigningBundle != nil {
 		result.IssuingCABytes = creationInfo.SigningBundle.CertificateBytes
 		result.IssuingCA = creationInfo.SigningBundle.Certificate
+		result.CAChain = creationInfo.SigningBundle.caChain()
 	} else {
 		result.IssuingCABytes = result.CertificateBytes
 		result.IssuingCA = result.Certificate
@@ -1013,6 +1052,7 @@ func signCertificate(creationInfo *creationBundle,
 
 	result.IssuingCABytes = creationInfo.SigningBundle.CertificateBytes
 	result.IssuingCA = creationInfo.SigningBundle.Certificate
+	result.CAChain = creationInfo.SigningBundle.caChain()
 
 	return result, nil
 }
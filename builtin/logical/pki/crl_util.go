@@ -1,9 +1,14 @@
 package pki
 
 import (
+	"crypto"
+	"crypto/ecdsa"
 	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"encoding/asn1"
 	"fmt"
 	"time"
 
@@ -104,7 +109,7 @@ func revokeCert(b *backend, req *logical.Request, serial string, fromLease bool)
 
 	}
 
-	crlErr := buildCRL(b, req)
+	crlErr := rebuildCRLsOnRevocation(b, req)
 	switch crlErr.(type) {
 	case errutil.UserError:
 		return logical.ErrorResponse(fmt.Sprintf("Error during CRL building: %s", crlErr)), nil
@@ -123,39 +128,95 @@ func revokeCert(b *backend, req *logical.Request, serial string, fromLease bool)
 	return resp, nil
 }
 
-// Builds a CRL by going through the list of revoked certificates and building
-// a new CRL with the stored revocation times and serial numbers.
-func buildCRL(b *backend, req *logical.Request) error {
+// rebuildCRLsOnRevocation brings the CRLs up to date after a revocation:
+// the CRL is rebuilt unless it is rebuilt periodically, in which case only
+// the delta CRL is, if enabled
+func rebuildCRLsOnRevocation(b *backend, req *logical.Request) error {
+	config, err := b.crlConfigOrDefault(req.Storage)
+	if err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("Error fetching CRL config information: %s", err)}
+	}
+	if !config.AutoRebuild {
+		return buildCRL(b, req)
+	}
+	if config.EnableDelta {
+		return buildDeltaCRL(b, req)
+	}
+	return nil
+}
+
+// crlState tracks the numbering and the freshness of the CRLs of an
+// issuer. CRLs and delta CRLs share the same sequence of CRL numbers.
+type crlState struct {
+	// The number of the latest CRL or delta CRL
+	Number int64 `json:"number"`
+
+	// The number of the latest CRL, which delta CRLs are relative to
+	BaseNumber int64 `json:"base_number"`
+
+	// When the latest CRL was built, and when it expires
+	LastBuild  time.Time `json:"last_build"`
+	NextUpdate time.Time `json:"next_update"`
+}
+
+func getCRLState(s logical.Storage, issuerID string) (*crlState, error) {
+	entry, err := s.Get("crl_states/" + issuerID)
+	if err != nil {
+		return nil, err
+	}
+	var state crlState
+	if entry != nil {
+		if err := entry.DecodeJSON(&state); err != nil {
+			return nil, err
+		}
+	}
+	return &state, nil
+}
+
+func putCRLState(s logical.Storage, issuerID string, state *crlState) error {
+	entry, err := logical.StorageEntryJSON("crl_states/"+issuerID, state)
+	if err != nil {
+		return err
+	}
+	return s.Put(entry)
+}
+
+// fetchRevokedCerts returns the certificates issued by the issuer that were
+// revoked, with the revocation times and serial numbers stored for them
+func fetchRevokedCerts(req *logical.Request, issuer *x509.Certificate) ([]pkix.RevokedCertificate, error) {
 	revokedSerials, err := req.Storage.List("revoked/")
 	if err != nil {
-		return errutil.InternalError{Err: fmt.Sprintf("Error fetching list of revoked certs: %s", err)}
+		return nil, errutil.InternalError{Err: fmt.Sprintf("Error fetching list of revoked certs: %s", err)}
 	}
 
-	revokedCerts := []pkix.RevokedCertificate{}
-	var revInfo revocationInfo
+	var revokedCerts []pkix.RevokedCertificate
 	for _, serial := range revokedSerials {
 		revokedEntry, err := req.Storage.Get("revoked/" + serial)
 		if err != nil {
-			return errutil.InternalError{Err: fmt.Sprintf("Unable to fetch revoked cert with serial %s: %s", serial, err)}
+			return nil, errutil.InternalError{Err: fmt.Sprintf("Unable to fetch revoked cert with serial %s: %s", serial, err)}
 		}
 		if revokedEntry == nil {
-			return errutil.InternalError{Err: fmt.Sprintf("Revoked certificate entry for serial %s is nil", serial)}
+			return nil, errutil.InternalError{Err: fmt.Sprintf("Revoked certificate entry for serial %s is nil", serial)}
 		}
 		if revokedEntry.Value == nil || len(revokedEntry.Value) == 0 {
 			// TODO: In this case, remove it and continue? How likely is this to
 			// happen? Alternately, could skip it entirely, or could implement a
 			// delete function so that there is a way to remove these
-			return errutil.InternalError{Err: fmt.Sprintf("Found revoked serial but actual certificate is empty")}
+			return nil, errutil.InternalError{Err: fmt.Sprintf("Found revoked serial but actual certificate is empty")}
 		}
 
+		var revInfo revocationInfo
 		err = revokedEntry.DecodeJSON(&revInfo)
 		if err != nil {
-			return errutil.InternalError{Err: fmt.Sprintf("Error decoding revocation entry for serial %s: %s", serial, err)}
+			return nil, errutil.InternalError{Err: fmt.Sprintf("Error decoding revocation entry for serial %s: %s", serial, err)}
 		}
 
 		revokedCert, err := x509.ParseCertificate(revInfo.CertificateBytes)
 		if err != nil {
-			return errutil.InternalError{Err: fmt.Sprintf("Unable to parse stored revoked certificate with serial %s: %s", serial, err)}
+			return nil, errutil.InternalError{Err: fmt.Sprintf("Unable to parse stored revoked certificate with serial %s: %s", serial, err)}
+		}
+		if !issuedBy(revokedCert, issuer) {
+			continue
 		}
 
 		// NOTE: We have to change this to UTC time because the CRL standard
@@ -171,12 +232,49 @@ func buildCRL(b *backend, req *logical.Request) error {
 		revokedCerts = append(revokedCerts, newRevCert)
 	}
 
-	signingBundle, caErr := fetchCAInfo(req)
+	return revokedCerts, nil
+}
+
+// fetchCAInfoForCRLs returns the CA info of every issuer, failing if there
+// is none, as there are no CRLs to build then
+func fetchCAInfoForCRLs(b *backend, req *logical.Request) ([]*caInfoBundle, error) {
+	caInfos, caErr := fetchAllCAInfo(b, req)
 	switch caErr.(type) {
 	case errutil.UserError:
-		return errutil.UserError{Err: fmt.Sprintf("Could not fetch the CA certificate: %s", caErr)}
+		return nil, errutil.UserError{Err: fmt.Sprintf("Could not fetch the CA certificate: %s", caErr)}
 	case errutil.InternalError:
-		return errutil.InternalError{Err: fmt.Sprintf("Error fetching CA certificate: %s", caErr)}
+		return nil, errutil.InternalError{Err: fmt.Sprintf("Error fetching CA certificate: %s", caErr)}
+	}
+	if len(caInfos) == 0 {
+		return nil, errutil.UserError{Err: "Could not fetch the CA certificate: backend must be configured with a CA certificate/key"}
+	}
+	return caInfos, nil
+}
+
+// Builds the CRL of each issuer by going through the list of revoked
+// certificates and building a new CRL with the stored revocation times and
+// serial numbers of those it issued. If delta CRLs are enabled, the delta
+// CRLs are rebuilt as well, as they are relative to the new CRLs.
+func buildCRL(b *backend, req *logical.Request) error {
+	caInfos, err := fetchCAInfoForCRLs(b, req)
+	if err != nil {
+		return err
+	}
+
+	for _, signingBundle := range caInfos {
+		if err := buildIssuerCRL(b, req, signingBundle); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildIssuerCRL builds the CRL of a single issuer, and its delta CRL if
+// delta CRLs are enabled
+func buildIssuerCRL(b *backend, req *logical.Request, signingBundle *caInfoBundle) error {
+	revokedCerts, err := fetchRevokedCerts(req, signingBundle.Certificate)
+	if err != nil {
+		return err
 	}
 
 	crlLifetime := b.crlLifetime
@@ -192,18 +290,270 @@ func buildCRL(b *backend, req *logical.Request) error {
 		crlLifetime = crlDur
 	}
 
-	crlBytes, err := signingBundle.Certificate.CreateCRL(rand.Reader, signingBundle.PrivateKey, revokedCerts, time.Now(), time.Now().Add(crlLifetime))
+	state, err := getCRLState(req.Storage, signingBundle.IssuerID)
+	if err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("Error fetching CRL state: %s", err)}
+	}
+
+	now := time.Now().UTC()
+	number := state.Number + 1
+	crlBytes, err := createCRL(signingBundle, revokedCerts, now, now.Add(crlLifetime), number, 0)
 	if err != nil {
 		return errutil.InternalError{Err: fmt.Sprintf("Error creating new CRL: %s", err)}
 	}
 
 	err = req.Storage.Put(&logical.StorageEntry{
-		Key:   "crl",
+		Key:   "crls/" + signingBundle.IssuerID,
 		Value: crlBytes,
 	})
 	if err != nil {
 		return errutil.InternalError{Err: fmt.Sprintf("Error storing CRL: %s", err)}
 	}
 
+	state.Number = number
+	state.BaseNumber = number
+	state.LastBuild = now
+	state.NextUpdate = now.Add(crlLifetime)
+	if err := putCRLState(req.Storage, signingBundle.IssuerID, state); err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("Error storing CRL state: %s", err)}
+	}
+
+	if crlInfo != nil && crlInfo.EnableDelta {
+		return buildIssuerDeltaCRL(b, req, signingBundle)
+	}
 	return nil
 }
+
+// buildDeltaCRL builds the delta CRL of each issuer, listing the
+// certificates it issued that were revoked since its CRL was last built
+func buildDeltaCRL(b *backend, req *logical.Request) error {
+	caInfos, err := fetchCAInfoForCRLs(b, req)
+	if err != nil {
+		return err
+	}
+
+	for _, signingBundle := range caInfos {
+		if err := buildIssuerDeltaCRL(b, req, signingBundle); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildIssuerDeltaCRL builds the delta CRL of a single issuer. It expires
+// along with the CRL it is relative to.
+func buildIssuerDeltaCRL(b *backend, req *logical.Request, signingBundle *caInfoBundle) error {
+	state, err := getCRLState(req.Storage, signingBundle.IssuerID)
+	if err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("Error fetching CRL state: %s", err)}
+	}
+	if state.BaseNumber == 0 {
+		// No CRL was built with a number yet, so build one first
+		return buildIssuerCRL(b, req, signingBundle)
+	}
+
+	revokedCerts, err := fetchRevokedCerts(req, signingBundle.Certificate)
+	if err != nil {
+		return err
+	}
+
+	// Revocation times only have a precision of seconds, so certificates
+	// revoked during the second the CRL was built are listed by both
+	var deltaCerts []pkix.RevokedCertificate
+	since := state.LastBuild.Truncate(time.Second)
+	for _, revokedCert := range revokedCerts {
+		if !revokedCert.RevocationTime.Before(since) {
+			deltaCerts = append(deltaCerts, revokedCert)
+		}
+	}
+
+	now := time.Now().UTC()
+	nextUpdate := state.NextUpdate
+	if !nextUpdate.After(now) {
+		nextUpdate = now.Add(b.crlLifetime)
+	}
+	number := state.Number + 1
+	crlBytes, err := createCRL(signingBundle, deltaCerts, now, nextUpdate, number, state.BaseNumber)
+	if err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("Error creating new delta CRL: %s", err)}
+	}
+
+	err = req.Storage.Put(&logical.StorageEntry{
+		Key:   "delta_crls/" + signingBundle.IssuerID,
+		Value: crlBytes,
+	})
+	if err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("Error storing delta CRL: %s", err)}
+	}
+
+	state.Number = number
+	if err := putCRLState(req.Storage, signingBundle.IssuerID, state); err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("Error storing CRL state: %s", err)}
+	}
+	return nil
+}
+
+// periodicFunc rebuilds the CRL of each issuer once it is within the grace
+// period of its expiry, if CRLs are configured to be rebuilt automatically
+func (b *backend) periodicFunc(req *logical.Request) error {
+	config, err := b.CRL(req.Storage)
+	if err != nil {
+		return err
+	}
+	if config == nil || !config.AutoRebuild {
+		return nil
+	}
+	gracePeriod, err := time.ParseDuration(config.AutoRebuildGracePeriod)
+	if err != nil {
+		return err
+	}
+
+	b.revokeStorageLock.Lock()
+	defer b.revokeStorageLock.Unlock()
+
+	caInfos, err := fetchAllCAInfo(b, req)
+	if err != nil {
+		return err
+	}
+	for _, signingBundle := range caInfos {
+		state, err := getCRLState(req.Storage, signingBundle.IssuerID)
+		if err != nil {
+			return err
+		}
+		if time.Now().Add(gracePeriod).Before(state.NextUpdate) {
+			continue
+		}
+		if err := buildIssuerCRL(b, req, signingBundle); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	oidExtensionAuthorityKeyId    = asn1.ObjectIdentifier{2, 5, 29, 35}
+	oidExtensionCRLNumber         = asn1.ObjectIdentifier{2, 5, 29, 20}
+	oidExtensionDeltaCRLIndicator = asn1.ObjectIdentifier{2, 5, 29, 27}
+
+	oidSignatureSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSignatureECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+)
+
+// tbsCertList is the to-be-signed part of a CRL. Unlike
+// pkix.TBSCertificateList, the issuer is kept as the raw subject of the CA
+// certificate, so that it matches the issuer of the certificates exactly.
+type tbsCertList struct {
+	Version             int
+	Signature           pkix.AlgorithmIdentifier
+	Issuer              asn1.RawValue
+	ThisUpdate          time.Time
+	NextUpdate          time.Time
+	RevokedCertificates []pkix.RevokedCertificate `asn1:"optional"`
+	Extensions          []pkix.Extension          `asn1:"tag:0,optional,explicit"`
+}
+
+type certificateList struct {
+	TBSCertList        asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	SignatureValue     asn1.BitString
+}
+
+type authorityKeyId struct {
+	ID []byte `asn1:"optional,tag:0"`
+}
+
+// createCRL creates a version 2 CRL with a CRL number. If deltaBase is not
+// zero, the CRL is a delta CRL relative to the CRL of that number.
+func createCRL(signingBundle *caInfoBundle, revokedCerts []pkix.RevokedCertificate,
+	now, nextUpdate time.Time, number, deltaBase int64) ([]byte, error) {
+	sigAlg, err := signatureAlgorithm(signingBundle.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	numberBytes, err := asn1.Marshal(number)
+	if err != nil {
+		return nil, err
+	}
+	extensions := []pkix.Extension{
+		pkix.Extension{
+			Id:    oidExtensionCRLNumber,
+			Value: numberBytes,
+		},
+	}
+	if len(signingBundle.Certificate.SubjectKeyId) > 0 {
+		akiBytes, err := asn1.Marshal(authorityKeyId{ID: signingBundle.Certificate.SubjectKeyId})
+		if err != nil {
+			return nil, err
+		}
+		extensions = append(extensions, pkix.Extension{
+			Id:    oidExtensionAuthorityKeyId,
+			Value: akiBytes,
+		})
+	}
+	if deltaBase != 0 {
+		baseBytes, err := asn1.Marshal(deltaBase)
+		if err != nil {
+			return nil, err
+		}
+		extensions = append(extensions, pkix.Extension{
+			Id:       oidExtensionDeltaCRLIndicator,
+			Critical: true,
+			Value:    baseBytes,
+		})
+	}
+
+	// An empty list of revoked certificates must be omitted rather than
+	// encoded as an empty sequence
+	if len(revokedCerts) == 0 {
+		revokedCerts = nil
+	}
+
+	tbs, err := asn1.Marshal(tbsCertList{
+		Version:             1,
+		Signature:           sigAlg,
+		Issuer:              asn1.RawValue{FullBytes: signingBundle.Certificate.RawSubject},
+		ThisUpdate:          now.UTC(),
+		NextUpdate:          nextUpdate.UTC(),
+		RevokedCertificates: revokedCerts,
+		Extensions:          extensions,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := signTBS(signingBundle.PrivateKey, tbs)
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(certificateList{
+		TBSCertList:        asn1.RawValue{FullBytes: tbs},
+		SignatureAlgorithm: sigAlg,
+		SignatureValue:     asn1.BitString{Bytes: signature, BitLength: len(signature) * 8},
+	})
+}
+
+// signatureAlgorithm returns the algorithm that signTBS signs with the key
+func signatureAlgorithm(key crypto.Signer) (pkix.AlgorithmIdentifier, error) {
+	switch key.Public().(type) {
+	case *rsa.PublicKey:
+		return pkix.AlgorithmIdentifier{
+			Algorithm:  oidSignatureSHA256WithRSA,
+			Parameters: asn1.RawValue{Tag: 5},
+		}, nil
+	case *ecdsa.PublicKey:
+		return pkix.AlgorithmIdentifier{
+			Algorithm: oidSignatureECDSAWithSHA256,
+		}, nil
+	default:
+		return pkix.AlgorithmIdentifier{}, fmt.Errorf("unsupported signing key type %T", key.Public())
+	}
+}
+
+// signTBS signs the DER-encoded to-be-signed part of a CRL or OCSP response
+// with the key, using SHA-256
+func signTBS(key crypto.Signer, tbs []byte) ([]byte, error) {
+	digest := sha256.Sum256(tbs)
+	return key.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
@@ -18,7 +18,7 @@ Defaults to false (CN is included).`,
 		Default: "pem",
 		Description: `Format for returned data. Can be "pem", "der",
 or "pem_bundle". If "pem_bundle" any private
-key and issuing cert will be appended to the
+key and the CA chain will be appended to the
 certificate pem. Defaults to "pem".`,
 	}
 
@@ -146,3 +146,26 @@ func addCAIssueFields(fields map[string]*framework.FieldSchema) map[string]*fram
 
 	return fields
 }
+
+// addIssuerRefField adds the field selecting the issuer that signs
+func addIssuerRefField(fields map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
+	fields["issuer_ref"] = &framework.FieldSchema{
+		Type:    framework.TypeString,
+		Default: defaultRef,
+		Description: `The ID or name of the issuer to sign with.
+Defaults to the default issuer.`,
+	}
+
+	return fields
+}
+
+// addIssuerNameField adds the field naming an issuer being added
+func addIssuerNameField(fields map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
+	fields["issuer_name"] = &framework.FieldSchema{
+		Type: framework.TypeString,
+		Description: `An optional name for the new issuer, by which
+it can be referred to instead of by its ID.`,
+	}
+
+	return fields
+}
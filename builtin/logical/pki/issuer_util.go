@@ -0,0 +1,358 @@
+package pki
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"regexp"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/certutil"
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+// defaultRef refers to the default issuer wherever an issuer can be given
+const defaultRef = "default"
+
+var issuerNameRegex = regexp.MustCompile(`^\w[\w-.]+\w$`)
+
+// issuerEntry is one of the CAs of the backend. Like other CA information,
+// it is stored as a CertBundle, because its private key is stored with it.
+type issuerEntry struct {
+	ID     string              `json:"id"`
+	Name   string              `json:"name"`
+	Bundle certutil.CertBundle `json:"bundle"`
+}
+
+// issuersConfig holds the issuer used wherever no issuer is given, such as
+// by roles that do not name one and by the "ca" and "crl" paths
+type issuersConfig struct {
+	Default string `json:"default"`
+}
+
+// certificateBytes returns the DER-encoded certificate of the issuer
+func (i *issuerEntry) certificateBytes() ([]byte, error) {
+	block, _ := pem.Decode([]byte(i.Bundle.Certificate))
+	if block == nil {
+		return nil, fmt.Errorf("unable to decode the certificate of issuer %s", i.ID)
+	}
+	return block.Bytes, nil
+}
+
+// getIssuersConfig returns the issuers configuration. Backends set up before
+// issuers existed are migrated on first use.
+func (b *backend) getIssuersConfig(s logical.Storage) (*issuersConfig, error) {
+	entry, err := s.Get("config/issuers")
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return b.migrateLegacyCA(s)
+	}
+
+	var config issuersConfig
+	if err := entry.DecodeJSON(&config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+func putIssuersConfig(s logical.Storage, config *issuersConfig) error {
+	entry, err := logical.StorageEntryJSON("config/issuers", config)
+	if err != nil {
+		return err
+	}
+	return s.Put(entry)
+}
+
+// migrateLegacyCA turns the single CA of backends set up before issuers
+// existed into the default issuer, along with its CRLs. A key generated for
+// an intermediate CA that was never set becomes the pending key.
+func (b *backend) migrateLegacyCA(s logical.Storage) (*issuersConfig, error) {
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	// Another request may have migrated the CA in the meantime
+	entry, err := s.Get("config/issuers")
+	if err != nil {
+		return nil, err
+	}
+	if entry != nil {
+		var config issuersConfig
+		if err := entry.DecodeJSON(&config); err != nil {
+			return nil, err
+		}
+		return &config, nil
+	}
+
+	config := &issuersConfig{}
+
+	bundleEntry, err := s.Get("config/ca_bundle")
+	if err != nil {
+		return nil, err
+	}
+	if bundleEntry != nil {
+		var bundle certutil.CertBundle
+		if err := bundleEntry.DecodeJSON(&bundle); err != nil {
+			return nil, fmt.Errorf("unable to decode the legacy CA bundle: %s", err)
+		}
+
+		if bundle.Certificate == "" {
+			pendingEntry, err := logical.StorageEntryJSON("config/pending_ca_key", bundle)
+			if err != nil {
+				return nil, err
+			}
+			if err := s.Put(pendingEntry); err != nil {
+				return nil, err
+			}
+		} else {
+			issuer, err := newIssuerEntry(bundle, "")
+			if err != nil {
+				return nil, err
+			}
+			if err := putIssuer(s, issuer); err != nil {
+				return nil, err
+			}
+			config.Default = issuer.ID
+
+			legacyCRLs := map[string]string{
+				"crl":       "crls/",
+				"delta_crl": "delta_crls/",
+				"crl_state": "crl_states/",
+			}
+			for legacyKey, prefix := range legacyCRLs {
+				legacyEntry, err := s.Get(legacyKey)
+				if err != nil {
+					return nil, err
+				}
+				if legacyEntry == nil {
+					continue
+				}
+				err = s.Put(&logical.StorageEntry{
+					Key:   prefix + issuer.ID,
+					Value: legacyEntry.Value,
+				})
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if err := putIssuersConfig(s, config); err != nil {
+		return nil, err
+	}
+
+	for _, legacyKey := range []string{"config/ca_bundle", "ca", "crl", "delta_crl", "crl_state"} {
+		if err := s.Delete(legacyKey); err != nil {
+			return nil, err
+		}
+	}
+
+	return config, nil
+}
+
+func newIssuerEntry(bundle certutil.CertBundle, name string) (*issuerEntry, error) {
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	return &issuerEntry{
+		ID:     id,
+		Name:   name,
+		Bundle: bundle,
+	}, nil
+}
+
+func putIssuer(s logical.Storage, issuer *issuerEntry) error {
+	entry, err := logical.StorageEntryJSON("issuers/"+issuer.ID, issuer)
+	if err != nil {
+		return err
+	}
+	return s.Put(entry)
+}
+
+func fetchIssuerByID(s logical.Storage, id string) (*issuerEntry, error) {
+	entry, err := s.Get("issuers/" + id)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var issuer issuerEntry
+	if err := entry.DecodeJSON(&issuer); err != nil {
+		return nil, err
+	}
+	return &issuer, nil
+}
+
+// listIssuers returns all of the issuers of the backend
+func (b *backend) listIssuers(s logical.Storage) ([]*issuerEntry, error) {
+	// Make sure a legacy CA is migrated before listing
+	if _, err := b.getIssuersConfig(s); err != nil {
+		return nil, err
+	}
+
+	ids, err := s.List("issuers/")
+	if err != nil {
+		return nil, err
+	}
+
+	issuers := make([]*issuerEntry, 0, len(ids))
+	for _, id := range ids {
+		issuer, err := fetchIssuerByID(s, id)
+		if err != nil {
+			return nil, err
+		}
+		if issuer != nil {
+			issuers = append(issuers, issuer)
+		}
+	}
+	return issuers, nil
+}
+
+// resolveIssuer returns the issuer with the given ID or name, or the default
+// issuer if the reference is empty or "default"
+func (b *backend) resolveIssuer(s logical.Storage, ref string) (*issuerEntry, error) {
+	if ref == "" || ref == defaultRef {
+		config, err := b.getIssuersConfig(s)
+		if err != nil {
+			return nil, errutil.InternalError{Err: fmt.Sprintf("unable to fetch the issuers configuration: %v", err)}
+		}
+		if config.Default == "" {
+			return nil, errutil.UserError{Err: "backend must be configured with a CA certificate/key"}
+		}
+		ref = config.Default
+	}
+
+	issuers, err := b.listIssuers(s)
+	if err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to fetch issuers: %v", err)}
+	}
+	for _, issuer := range issuers {
+		if issuer.ID == ref {
+			return issuer, nil
+		}
+	}
+	for _, issuer := range issuers {
+		if issuer.Name != "" && issuer.Name == ref {
+			return issuer, nil
+		}
+	}
+
+	return nil, errutil.UserError{Err: fmt.Sprintf("unknown issuer %q", ref)}
+}
+
+// validateIssuerName checks that the name can be given to the issuer with
+// the ID; an empty name is always valid
+func (b *backend) validateIssuerName(s logical.Storage, name, id string) error {
+	if name == "" {
+		return nil
+	}
+	if name == defaultRef {
+		return errutil.UserError{Err: fmt.Sprintf("%q cannot be used as an issuer name", defaultRef)}
+	}
+	if !issuerNameRegex.MatchString(name) {
+		return errutil.UserError{Err: fmt.Sprintf("invalid issuer name %q", name)}
+	}
+
+	issuers, err := b.listIssuers(s)
+	if err != nil {
+		return errutil.InternalError{Err: fmt.Sprintf("unable to fetch issuers: %v", err)}
+	}
+	for _, issuer := range issuers {
+		if issuer.ID != id && (issuer.Name == name || issuer.ID == name) {
+			return errutil.UserError{Err: fmt.Sprintf("issuer name %q is already in use", name)}
+		}
+	}
+	return nil
+}
+
+// importIssuer adds the CA certificate and key of the bundle as an issuer and
+// makes it the default issuer, as setting a CA replaced the CA of the backend
+// before issuers existed. If the certificate already belongs to an issuer,
+// that issuer becomes the default instead, and existing is set.
+func (b *backend) importIssuer(s logical.Storage, bundle *certutil.ParsedCertBundle, name string) (issuer *issuerEntry, existing bool, err error) {
+	cb, err := bundle.ToCertBundle()
+	if err != nil {
+		return nil, false, fmt.Errorf("error converting raw values into cert bundle: %s", err)
+	}
+
+	// Migrate any legacy CA before taking the lock, as migrating takes it
+	if _, err := b.getIssuersConfig(s); err != nil {
+		return nil, false, err
+	}
+
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	config, err := b.getIssuersConfig(s)
+	if err != nil {
+		return nil, false, err
+	}
+
+	issuers, err := b.listIssuers(s)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, issuer := range issuers {
+		certBytes, err := issuer.certificateBytes()
+		if err != nil {
+			return nil, false, err
+		}
+		if bytes.Equal(certBytes, bundle.CertificateBytes) {
+			if config.Default != issuer.ID {
+				config.Default = issuer.ID
+				if err := putIssuersConfig(s, config); err != nil {
+					return nil, false, err
+				}
+			}
+			return issuer, true, nil
+		}
+	}
+
+	if err := b.validateIssuerName(s, name, ""); err != nil {
+		return nil, false, err
+	}
+
+	issuer, err = newIssuerEntry(*cb, name)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := putIssuer(s, issuer); err != nil {
+		return nil, false, err
+	}
+
+	config.Default = issuer.ID
+	if err := putIssuersConfig(s, config); err != nil {
+		return nil, false, err
+	}
+
+	return issuer, false, nil
+}
+
+// deleteIssuer removes the issuer along with its CRLs
+func deleteIssuer(s logical.Storage, id string) error {
+	for _, prefix := range []string{"issuers/", "crls/", "delta_crls/", "crl_states/"} {
+		if err := s.Delete(prefix + id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// issuedBy returns whether the certificate was issued by the CA whose
+// certificate is given
+func issuedBy(cert, issuer *x509.Certificate) bool {
+	if !bytes.Equal(cert.RawIssuer, issuer.RawSubject) {
+		return false
+	}
+	if len(cert.AuthorityKeyId) > 0 && len(issuer.SubjectKeyId) > 0 {
+		return bytes.Equal(cert.AuthorityKeyId, issuer.SubjectKeyId)
+	}
+	return cert.CheckSignatureFrom(issuer) == nil
+}
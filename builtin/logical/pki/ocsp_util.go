@@ -0,0 +1,240 @@
+package pki
+
+import (
+	"bytes"
+	"crypto"
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+var (
+	oidOCSPBasicResponse = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+
+	oidHashSHA1   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidHashSHA256 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+)
+
+// The OCSP response statuses defined in RFC 6960, section 4.2.1
+const (
+	ocspSuccessful       asn1.Enumerated = 0
+	ocspMalformedRequest asn1.Enumerated = 1
+	ocspInternalError    asn1.Enumerated = 2
+	ocspUnauthorized     asn1.Enumerated = 6
+)
+
+// The certificate statuses of a single OCSP response
+const (
+	ocspGood = iota
+	ocspRevoked
+	ocspUnknown
+)
+
+type ocspRequest struct {
+	TBSRequest ocspTBSRequest
+	Signature  asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspTBSRequest struct {
+	Version       int           `asn1:"explicit,tag:0,default:0,optional"`
+	RequestorName asn1.RawValue `asn1:"explicit,tag:1,optional"`
+	RequestList   []ocspSingleRequest
+	Extensions    []pkix.Extension `asn1:"explicit,tag:2,optional"`
+}
+
+type ocspSingleRequest struct {
+	CertID     ocspCertID
+	Extensions []pkix.Extension `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspCertID struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	NameHash      []byte
+	IssuerKeyHash []byte
+	SerialNumber  *big.Int
+}
+
+type ocspResponse struct {
+	Status   asn1.Enumerated
+	Response ocspResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type ocspBasicResponse struct {
+	TBSResponseData    asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+}
+
+type ocspResponseData struct {
+	Version     int `asn1:"explicit,tag:0,default:0,optional"`
+	ResponderID asn1.RawValue
+	ProducedAt  time.Time `asn1:"generalized"`
+	Responses   []ocspSingleResponse
+}
+
+type ocspSingleResponse struct {
+	CertID     ocspCertID
+	Good       asn1.Flag        `asn1:"tag:0,optional"`
+	Revoked    ocspRevokedInfo  `asn1:"tag:1,optional"`
+	Unknown    asn1.Flag        `asn1:"tag:2,optional"`
+	ThisUpdate time.Time        `asn1:"generalized"`
+	NextUpdate time.Time        `asn1:"generalized,explicit,tag:0,optional"`
+	Extensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type ocspRevokedInfo struct {
+	RevocationTime time.Time `asn1:"generalized"`
+}
+
+// ocspCertStatus is the status of the certificate named by one request of
+// an OCSP request
+type ocspCertStatus struct {
+	CertID         ocspCertID
+	Status         int
+	RevocationTime time.Time
+}
+
+// parseOCSPRequest parses a DER-encoded OCSP request
+func parseOCSPRequest(der []byte) (*ocspRequest, error) {
+	var req ocspRequest
+	rest, err := asn1.Unmarshal(der, &req)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("trailing data in OCSP request")
+	}
+	if len(req.TBSRequest.RequestList) == 0 {
+		return nil, fmt.Errorf("OCSP request contains no certificate requests")
+	}
+	return &req, nil
+}
+
+// hashForOCSP returns the hash identified by the algorithm of a CertID
+func hashForOCSP(algorithm asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case algorithm.Equal(oidHashSHA1):
+		return crypto.SHA1, nil
+	case algorithm.Equal(oidHashSHA256):
+		return crypto.SHA256, nil
+	default:
+		return 0, fmt.Errorf("unsupported hash algorithm %s", algorithm)
+	}
+}
+
+// matchesIssuer returns whether the CertID names a certificate issued by
+// the CA whose certificate has the given subject and public key info
+func (id ocspCertID) matchesIssuer(rawSubject, rawSubjectPublicKeyInfo []byte) (bool, error) {
+	hash, err := hashForOCSP(id.HashAlgorithm.Algorithm)
+	if err != nil {
+		return false, err
+	}
+
+	var publicKeyInfo struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(rawSubjectPublicKeyInfo, &publicKeyInfo); err != nil {
+		return false, err
+	}
+
+	h := hash.New()
+	h.Write(rawSubject)
+	nameHash := h.Sum(nil)
+
+	h = hash.New()
+	h.Write(publicKeyInfo.PublicKey.RightAlign())
+	keyHash := h.Sum(nil)
+
+	return bytes.Equal(id.NameHash, nameHash) && bytes.Equal(id.IssuerKeyHash, keyHash), nil
+}
+
+// createOCSPResponse creates a successful OCSP response for the statuses,
+// signed by the CA. If nextUpdate is zero, it is left out of the response.
+func createOCSPResponse(signingBundle *caInfoBundle, statuses []ocspCertStatus,
+	now, nextUpdate time.Time) ([]byte, error) {
+	sigAlg, err := signatureAlgorithm(signingBundle.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	now = now.UTC().Truncate(time.Second)
+	if !nextUpdate.IsZero() {
+		nextUpdate = nextUpdate.UTC().Truncate(time.Second)
+	}
+
+	responses := make([]ocspSingleResponse, 0, len(statuses))
+	for _, status := range statuses {
+		response := ocspSingleResponse{
+			CertID:     status.CertID,
+			ThisUpdate: now,
+			NextUpdate: nextUpdate,
+		}
+		switch status.Status {
+		case ocspGood:
+			response.Good = true
+		case ocspRevoked:
+			response.Revoked = ocspRevokedInfo{
+				RevocationTime: status.RevocationTime.UTC().Truncate(time.Second),
+			}
+		default:
+			response.Unknown = true
+		}
+		responses = append(responses, response)
+	}
+
+	tbs, err := asn1.Marshal(ocspResponseData{
+		// The responder is identified by name, which is the subject of the
+		// CA certificate as the CA signs the responses itself
+		ResponderID: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        1,
+			IsCompound: true,
+			Bytes:      signingBundle.Certificate.RawSubject,
+		},
+		ProducedAt: now,
+		Responses:  responses,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := signTBS(signingBundle.PrivateKey, tbs)
+	if err != nil {
+		return nil, err
+	}
+
+	basicResponse, err := asn1.Marshal(ocspBasicResponse{
+		TBSResponseData:    asn1.RawValue{FullBytes: tbs},
+		SignatureAlgorithm: sigAlg,
+		Signature:          asn1.BitString{Bytes: signature, BitLength: len(signature) * 8},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(ocspResponse{
+		Status: ocspSuccessful,
+		Response: ocspResponseBytes{
+			ResponseType: oidOCSPBasicResponse,
+			Response:     basicResponse,
+		},
+	})
+}
+
+// createOCSPErrorResponse creates an unsuccessful OCSP response, which
+// carries only its status
+func createOCSPErrorResponse(status asn1.Enumerated) ([]byte, error) {
+	return asn1.Marshal(ocspResponse{
+		Status: status,
+	})
+}
@@ -10,7 +10,7 @@ import (
 )
 
 func pathConfigCA(b *backend) *framework.Path {
-	return &framework.Path{
+	ret := &framework.Path{
 		Pattern: "config/ca",
 		Fields: map[string]*framework.FieldSchema{
 			"pem_bundle": &framework.FieldSchema{
@@ -29,6 +29,10 @@ endpoint, just the signed certificate.`,
 		HelpSynopsis:    pathConfigCAHelpSyn,
 		HelpDescription: pathConfigCAHelpDesc,
 	}
+
+	ret.Fields = addIssuerNameField(ret.Fields)
+
+	return ret
 }
 
 func (b *backend) pathCAWrite(
@@ -75,32 +79,32 @@ func (b *backend) pathCAWrite(
 		return logical.ErrorResponse("the given certificate is not marked for CA use and cannot be used with this backend"), nil
 	}
 
-	cb, err := parsedBundle.ToCertBundle()
+	issuer, existing, err := b.importIssuer(req.Storage, parsedBundle, data.Get("issuer_name").(string))
 	if err != nil {
-		return nil, fmt.Errorf("error converting raw values into cert bundle: %s", err)
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), nil
+		default:
+			return nil, err
+		}
 	}
 
-	entry, err := logical.StorageEntryJSON("config/ca_bundle", cb)
-	if err != nil {
-		return nil, err
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"issuer_id": issuer.ID,
+		},
 	}
-	err = req.Storage.Put(entry)
-	if err != nil {
-		return nil, err
+	if existing {
+		resp.AddWarning("The certificate already belongs to an issuer, which is now the default issuer.")
+		return resp, nil
 	}
 
-	// For ease of later use, also store just the certificate at a known
-	// location, plus a fresh CRL
-	entry.Key = "ca"
-	entry.Value = parsedBundle.CertificateBytes
-	err = req.Storage.Put(entry)
-	if err != nil {
+	// Build a fresh CRL
+	if err := buildCRL(b, req); err != nil {
 		return nil, err
 	}
 
-	err = buildCRL(b, req)
-
-	return nil, err
+	return resp, nil
 }
 
 const pathConfigCAHelpSyn = `
@@ -108,9 +112,9 @@ Set the CA certificate and private key used for generated credentials.
 `
 
 const pathConfigCAHelpDesc = `
-This sets the CA information used for credentials generated by this
-by this mount. This must be a PEM-format, concatenated unencrypted
-secret key and certificate.
+This adds CA information used for credentials generated by this mount as a
+new issuer, which becomes the default issuer. This must
+be a PEM-format, concatenated unencrypted secret key and certificate.
 
 For security reasons, the secret key cannot be retrieved later.
 `
@@ -10,7 +10,19 @@ import (
 
 // CRLConfig holds basic CRL configuration information
 type crlConfig struct {
-	Expiry string `json:"expiry" mapstructure:"expiry" structs:"expiry"`
+	Expiry                 string `json:"expiry" mapstructure:"expiry" structs:"expiry"`
+	AutoRebuild            bool   `json:"auto_rebuild" mapstructure:"auto_rebuild" structs:"auto_rebuild"`
+	AutoRebuildGracePeriod string `json:"auto_rebuild_grace_period" mapstructure:"auto_rebuild_grace_period" structs:"auto_rebuild_grace_period"`
+	EnableDelta            bool   `json:"enable_delta" mapstructure:"enable_delta" structs:"enable_delta"`
+	OCSPDisable            bool   `json:"ocsp_disable" mapstructure:"ocsp_disable" structs:"ocsp_disable"`
+	OCSPExpiry             string `json:"ocsp_expiry" mapstructure:"ocsp_expiry" structs:"ocsp_expiry"`
+}
+
+// defaultCRLConfig is the configuration in effect until one is written
+var defaultCRLConfig = crlConfig{
+	Expiry:                 "72h",
+	AutoRebuildGracePeriod: "12h",
+	OCSPExpiry:             "12h",
 }
 
 func pathConfigCRL(b *backend) *framework.Path {
@@ -21,12 +33,48 @@ func pathConfigCRL(b *backend) *framework.Path {
 				Type: framework.TypeString,
 				Description: `The amount of time the generated CRL should be
 valid; defaults to 72 hours`,
-				Default: "72h",
+				Default: defaultCRLConfig.Expiry,
+			},
+
+			"auto_rebuild": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `If true, the CRL is rebuilt periodically before
+it expires, rather than each time a certificate
+is revoked. Defaults to false.`,
+			},
+
+			"auto_rebuild_grace_period": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `How long before its expiry the CRL is rebuilt
+when auto_rebuild is set; defaults to 12 hours`,
+				Default: defaultCRLConfig.AutoRebuildGracePeriod,
+			},
+
+			"enable_delta": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `If true, a delta CRL listing the certificates
+revoked since the last CRL was built is kept up
+to date with each revocation. Defaults to false.`,
+			},
+
+			"ocsp_disable": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `If true, the OCSP responder answers every
+request with an unauthorized status. Defaults to
+false.`,
+			},
+
+			"ocsp_expiry": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The amount of time OCSP responses should be
+valid; defaults to 12 hours. A value of 0 omits
+the next update time from responses.`,
+				Default: defaultCRLConfig.OCSPExpiry,
 			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
-			logical.ReadOperation:  b.pathCRLRead,
+			logical.ReadOperation:   b.pathCRLRead,
 			logical.UpdateOperation: b.pathCRLWrite,
 		},
 
@@ -44,7 +92,9 @@ func (b *backend) CRL(s logical.Storage) (*crlConfig, error) {
 		return nil, nil
 	}
 
-	var result crlConfig
+	// Fields missing from configurations written before they existed keep
+	// their defaults
+	result := defaultCRLConfig
 	if err := entry.DecodeJSON(&result); err != nil {
 		return nil, err
 	}
@@ -52,6 +102,20 @@ func (b *backend) CRL(s logical.Storage) (*crlConfig, error) {
 	return &result, nil
 }
 
+// crlConfigOrDefault returns the CRL configuration, or the default one if
+// none was written
+func (b *backend) crlConfigOrDefault(s logical.Storage) (*crlConfig, error) {
+	config, err := b.CRL(s)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		config = &crlConfig{}
+		*config = defaultCRLConfig
+	}
+	return config, nil
+}
+
 func (b *backend) pathCRLRead(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	config, err := b.CRL(req.Storage)
@@ -64,22 +128,59 @@ func (b *backend) pathCRLRead(
 
 	return &logical.Response{
 		Data: map[string]interface{}{
-			"expiry": config.Expiry,
+			"expiry":                    config.Expiry,
+			"auto_rebuild":              config.AutoRebuild,
+			"auto_rebuild_grace_period": config.AutoRebuildGracePeriod,
+			"enable_delta":              config.EnableDelta,
+			"ocsp_disable":              config.OCSPDisable,
+			"ocsp_expiry":               config.OCSPExpiry,
 		},
 	}, nil
 }
 
 func (b *backend) pathCRLWrite(
 	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	expiry := d.Get("expiry").(string)
+	config, err := b.crlConfigOrDefault(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	if expiryRaw, ok := d.GetOk("expiry"); ok {
+		config.Expiry = expiryRaw.(string)
+	}
+	if autoRebuildRaw, ok := d.GetOk("auto_rebuild"); ok {
+		config.AutoRebuild = autoRebuildRaw.(bool)
+	}
+	if gracePeriodRaw, ok := d.GetOk("auto_rebuild_grace_period"); ok {
+		config.AutoRebuildGracePeriod = gracePeriodRaw.(string)
+	}
+	if enableDeltaRaw, ok := d.GetOk("enable_delta"); ok {
+		config.EnableDelta = enableDeltaRaw.(bool)
+	}
+	if ocspDisableRaw, ok := d.GetOk("ocsp_disable"); ok {
+		config.OCSPDisable = ocspDisableRaw.(bool)
+	}
+	if ocspExpiryRaw, ok := d.GetOk("ocsp_expiry"); ok {
+		config.OCSPExpiry = ocspExpiryRaw.(string)
+	}
 
-	_, err := time.ParseDuration(expiry)
+	expiry, err := time.ParseDuration(config.Expiry)
 	if err != nil {
 		return logical.ErrorResponse(fmt.Sprintf("Given expiry could not be decoded: %s", err)), nil
 	}
-
-	config := &crlConfig{
-		Expiry: expiry,
+	gracePeriod, err := time.ParseDuration(config.AutoRebuildGracePeriod)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("Given auto_rebuild_grace_period could not be decoded: %s", err)), nil
+	}
+	if config.AutoRebuild && gracePeriod >= expiry {
+		return logical.ErrorResponse("auto_rebuild_grace_period must be shorter than expiry"), nil
+	}
+	ocspExpiry, err := time.ParseDuration(config.OCSPExpiry)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("Given ocsp_expiry could not be decoded: %s", err)), nil
+	}
+	if ocspExpiry < 0 {
+		return logical.ErrorResponse("ocsp_expiry must not be negative"), nil
 	}
 
 	entry, err := logical.StorageEntryJSON("config/crl", config)
@@ -91,13 +192,40 @@ func (b *backend) pathCRLWrite(
 		return nil, err
 	}
 
+	// Rebuild the CRLs so that they reflect the new configuration, for
+	// instance with delta CRLs once deltas are enabled. Without a CA there
+	// is nothing to build yet.
+	b.revokeStorageLock.Lock()
+	defer b.revokeStorageLock.Unlock()
+	issuers, err := b.listIssuers(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if len(issuers) == 0 {
+		return nil, nil
+	}
+	if err := buildCRL(b, req); err != nil {
+		return nil, fmt.Errorf("Error encountered during CRL building: %s", err)
+	}
+
 	return nil, nil
 }
 
 const pathConfigCRLHelpSyn = `
-Configure the CRL expiration.
+Configure the CRL expiration, rebuilding and delta CRLs, and the OCSP responder.
 `
 
 const pathConfigCRLHelpDesc = `
 This endpoint allows configuration of the CRL lifetime.
+
+With auto_rebuild set, revoking a certificate no longer rebuilds the CRL;
+instead, the CRL is rebuilt periodically once it is within the grace period
+of its expiry. With enable_delta set, a delta CRL listing the certificates
+revoked since the last CRL was built is rebuilt on every revocation, so that
+revocations reach clients that fetch delta CRLs without waiting for the next
+full CRL.
+
+The OCSP responder answers requests about certificates issued by any of the
+issuers of this backend, with responses valid for ocsp_expiry. Each issuer
+has its own CRL and delta CRL.
 `
@@ -1,8 +1,10 @@
 package pki
 
 import (
+	"bytes"
 	"encoding/pem"
 	"fmt"
+	"strings"
 
 	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/logical"
@@ -23,6 +25,20 @@ func pathFetchCA(b *backend) *framework.Path {
 	}
 }
 
+// Returns the CA chain, in raw format or, under cert/, in a non-raw format
+func pathFetchCAChain(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `(cert/)?ca_chain`,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathFetchCAChainRead,
+		},
+
+		HelpSynopsis:    pathFetchHelpSyn,
+		HelpDescription: pathFetchHelpDesc,
+	}
+}
+
 // Returns the CRL in raw format
 func pathFetchCRL(b *backend) *framework.Path {
 	return &framework.Path{
@@ -37,6 +53,40 @@ func pathFetchCRL(b *backend) *framework.Path {
 	}
 }
 
+// Returns the delta CRL in raw format
+func pathFetchDeltaCRL(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `crl/delta(/pem)?`,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathFetchRead,
+		},
+
+		HelpSynopsis:    pathFetchHelpSyn,
+		HelpDescription: pathFetchHelpDesc,
+	}
+}
+
+// Returns the CRL or the delta CRL of a given issuer in raw format
+func pathFetchIssuerCRL(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `crl/issuer/` + framework.GenericNameRegex("issuer_ref") + `(/delta)?(/pem)?`,
+		Fields: map[string]*framework.FieldSchema{
+			"issuer_ref": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `The ID or name of the issuer`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathFetchRead,
+		},
+
+		HelpSynopsis:    pathFetchHelpSyn,
+		HelpDescription: pathFetchHelpDesc,
+	}
+}
+
 // Returns any valid (non-revoked) cert. Since "ca" fits the pattern, this path
 // also handles returning the CA cert in a non-raw format.
 func pathFetchValid(b *backend) *framework.Path {
@@ -59,10 +109,10 @@ hyphen-separated octal`,
 	}
 }
 
-// This returns the CRL in a non-raw format
+// This returns the CRL or the delta CRL in a non-raw format
 func pathFetchCRLViaCertPath(b *backend) *framework.Path {
 	return &framework.Path{
-		Pattern: `cert/crl`,
+		Pattern: `cert/(crl|delta-crl)`,
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
 			logical.ReadOperation: b.pathFetchRead,
@@ -97,7 +147,7 @@ func (b *backend) pathFetchCertList(req *logical.Request, data *framework.FieldD
 }
 
 func (b *backend) pathFetchRead(req *logical.Request, data *framework.FieldData) (response *logical.Response, retErr error) {
-	var serial, pemType, contentType string
+	var serial, pemType, contentType, issuerRef string
 	var certEntry, revokedEntry *logical.StorageEntry
 	var funcErr error
 	var certificate []byte
@@ -111,7 +161,20 @@ func (b *backend) pathFetchRead(req *logical.Request, data *framework.FieldData)
 	// Errors don't cause an immediate exit, because the raw
 	// paths still need to return raw output.
 
+	// The CA, CRL and delta CRL are those of the default issuer, unless an
+	// issuer is given
 	switch {
+	case strings.HasPrefix(req.Path, "crl/issuer/"):
+		issuerRef = data.Get("issuer_ref").(string)
+		serial = "crl"
+		contentType = "application/pkix-crl"
+		suffix := strings.TrimPrefix(req.Path, "crl/issuer/"+issuerRef)
+		if strings.HasPrefix(suffix, "/delta") {
+			serial = "delta_crl"
+		}
+		if strings.HasSuffix(suffix, "/pem") {
+			pemType = "X509 CRL"
+		}
 	case req.Path == "ca" || req.Path == "ca/pem":
 		serial = "ca"
 		contentType = "application/pkix-cert"
@@ -124,9 +187,18 @@ func (b *backend) pathFetchRead(req *logical.Request, data *framework.FieldData)
 		if req.Path == "crl/pem" {
 			pemType = "X509 CRL"
 		}
+	case req.Path == "crl/delta" || req.Path == "crl/delta/pem":
+		serial = "delta_crl"
+		contentType = "application/pkix-crl"
+		if req.Path == "crl/delta/pem" {
+			pemType = "X509 CRL"
+		}
 	case req.Path == "cert/crl":
 		serial = "crl"
 		pemType = "X509 CRL"
+	case req.Path == "cert/delta-crl":
+		serial = "delta_crl"
+		pemType = "X509 CRL"
 	default:
 		serial = data.Get("serial").(string)
 		pemType = "CERTIFICATE"
@@ -135,8 +207,15 @@ func (b *backend) pathFetchRead(req *logical.Request, data *framework.FieldData)
 		response = logical.ErrorResponse("The serial number must be provided")
 		goto reply
 	}
+	if issuerRef == "" && (serial == "ca" || serial == "crl" || serial == "delta_crl") {
+		issuerRef = defaultRef
+	}
 
-	certEntry, funcErr = fetchCertBySerial(req, req.Path, serial)
+	if issuerRef != "" {
+		certEntry, funcErr = fetchIssuerEntry(b, req, issuerRef, serial)
+	} else {
+		certEntry, funcErr = fetchCertBySerial(req, req.Path, serial)
+	}
 	if funcErr != nil {
 		switch funcErr.(type) {
 		case errutil.UserError:
@@ -205,12 +284,89 @@ reply:
 	return
 }
 
+// fetchIssuerEntry fetches the certificate ("ca"), CRL ("crl") or delta CRL
+// ("delta_crl") of the issuer. Like fetchCertBySerial, it returns nil if
+// there is none, including when the issuer does not exist.
+func fetchIssuerEntry(b *backend, req *logical.Request, issuerRef, kind string) (*logical.StorageEntry, error) {
+	issuer, err := b.resolveIssuer(req.Storage, issuerRef)
+	if err != nil {
+		if _, ok := err.(errutil.UserError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var path string
+	switch kind {
+	case "ca":
+		certBytes, err := issuer.certificateBytes()
+		if err != nil {
+			return nil, errutil.InternalError{Err: err.Error()}
+		}
+		return &logical.StorageEntry{
+			Key:   "issuers/" + issuer.ID,
+			Value: certBytes,
+		}, nil
+	case "crl":
+		path = "crls/" + issuer.ID
+	case "delta_crl":
+		path = "delta_crls/" + issuer.ID
+	}
+
+	entry, err := req.Storage.Get(path)
+	if err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("error fetching %s of issuer %s: %s", kind, issuer.ID, err)}
+	}
+	if entry == nil || len(entry.Value) == 0 {
+		return nil, nil
+	}
+	return entry, nil
+}
+
+func (b *backend) pathFetchCAChainRead(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	caInfo, err := fetchCAInfo(b, req, defaultRef)
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), nil
+		default:
+			return nil, err
+		}
+	}
+
+	var chain bytes.Buffer
+	for _, chainCert := range caInfo.caChain() {
+		chain.Write(pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: chainCert.Bytes,
+		}))
+	}
+
+	if req.Path == "ca_chain" {
+		return &logical.Response{
+			Data: map[string]interface{}{
+				logical.HTTPContentType: "application/pem-certificate-chain",
+				logical.HTTPRawBody:     chain.Bytes(),
+				logical.HTTPStatusCode:  200,
+			},
+		}, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"certificate": chain.String(),
+		},
+	}, nil
+}
+
 const pathFetchHelpSyn = `
-Fetch a CA, CRL, or non-revoked certificate.
+Fetch a CA, CA chain, CRL, or non-revoked certificate.
 `
 
 const pathFetchHelpDesc = `
 This allows certificates to be fetched. If using the fetch/ prefix any non-revoked certificate can be fetched.
 
-Using "ca" or "crl" as the value fetches the appropriate information in DER encoding. Add "/pem" to either to get PEM encoding.
+Using "ca" or "crl" as the value fetches the appropriate information of the default issuer in DER encoding. Add "/pem" to either to get PEM encoding. The delta CRL, if enabled, is fetched with "crl/delta" or "cert/delta-crl". The CRL and delta CRL of any issuer are fetched with "crl/issuer/<issuer>" and "crl/issuer/<issuer>/delta".
+
+Using "ca_chain" fetches the CA certificate followed by the chain to its root, in PEM encoding.
 `
@@ -1,6 +1,7 @@
 package pki
 
 import (
+	"crypto/x509"
 	"encoding/base64"
 	"fmt"
 
@@ -38,7 +39,8 @@ func pathSetSignedIntermediate(b *backend) *framework.Path {
 				Description: `PEM-format certificate. This must be a CA
 certificate with a public key matching the
 previously-generated key from the generation
-endpoint.`,
+endpoint, or with the key of an existing issuer.
+It may be followed by the chain to its root.`,
 			},
 		},
 
@@ -50,6 +52,8 @@ endpoint.`,
 		HelpDescription: pathSetSignedIntermediateHelpDesc,
 	}
 
+	ret.Fields = addIssuerNameField(ret.Fields)
+
 	return ret
 }
 
@@ -106,11 +110,13 @@ func (b *backend) pathGenerateIntermediate(
 		}
 	}
 
+	// The key is kept pending until the signed certificate is set; the
+	// existing issuers are left alone, so that the CA can be rotated
 	cb := &certutil.CertBundle{}
 	cb.PrivateKey = csrb.PrivateKey
 	cb.PrivateKeyType = csrb.PrivateKeyType
 
-	entry, err := logical.StorageEntryJSON("config/ca_bundle", cb)
+	entry, err := logical.StorageEntryJSON("config/pending_ca_key", cb)
 	if err != nil {
 		return nil, err
 	}
@@ -130,106 +136,178 @@ func (b *backend) pathSetSignedIntermediate(
 		return logical.ErrorResponse("no certificate provided in the \"certficate\" parameter"), nil
 	}
 
-	inputBundle, err := certutil.ParsePEMBundle(cert)
+	inputCerts, err := certutil.ParsePEMCertificates(cert)
 	if err != nil {
-		switch err.(type) {
-		case errutil.InternalError:
-			return nil, err
-		default:
-			return logical.ErrorResponse(err.Error()), nil
-		}
+		return logical.ErrorResponse(err.Error()), nil
 	}
 
-	// If only one certificate is provided and it's a CA
-	// the parsing will assign it to the IssuingCA, so move it over
-	if inputBundle.Certificate == nil && inputBundle.IssuingCA != nil {
-		inputBundle.Certificate = inputBundle.IssuingCA
-		inputBundle.IssuingCA = nil
-		inputBundle.CertificateBytes = inputBundle.IssuingCABytes
-		inputBundle.IssuingCABytes = nil
-	}
-
-	if inputBundle.Certificate == nil {
-		return logical.ErrorResponse("supplied certificate could not be successfully parsed"), nil
-	}
+	issuerName := data.Get("issuer_name").(string)
 
-	cb := &certutil.CertBundle{}
-	entry, err := req.Storage.Get("config/ca_bundle")
+	// The key is the pending key generated for the intermediate CA or, for a
+	// certificate reissued for an existing issuer, the key of that issuer.
+	// Listing the issuers first migrates any legacy pending key.
+	issuers, err := b.listIssuers(req.Storage)
 	if err != nil {
 		return nil, err
 	}
-	if entry == nil {
-		return logical.ErrorResponse("could not find any existing entry with a private key"), nil
-	}
-
-	err = entry.DecodeJSON(cb)
+	var candidateKeys []*certutil.ParsedCertBundle
+	pendingKey, err := fetchPendingKey(req.Storage)
 	if err != nil {
 		return nil, err
 	}
-
-	if len(cb.PrivateKey) == 0 || cb.PrivateKeyType == "" {
-		return logical.ErrorResponse("could not find an existing private key"), nil
+	if pendingKey != nil {
+		candidateKeys = append(candidateKeys, pendingKey)
 	}
-
-	parsedCB, err := cb.ToParsedCertBundle()
-	if err != nil {
-		return nil, err
+	for _, issuer := range issuers {
+		issuerBundle, err := issuer.Bundle.ToParsedCertBundle()
+		if err != nil {
+			return nil, err
+		}
+		if issuerBundle.PrivateKey != nil {
+			candidateKeys = append(candidateKeys, issuerBundle)
+		}
 	}
-	if parsedCB.PrivateKey == nil {
-		return nil, fmt.Errorf("saved key could not be parsed successfully")
+	if len(candidateKeys) == 0 {
+		return logical.ErrorResponse("could not find an existing private key"), nil
 	}
 
-	equal, err := certutil.ComparePublicKeys(parsedCB.PrivateKey.Public(), inputBundle.Certificate.PublicKey)
-	if err != nil {
-		return logical.ErrorResponse(fmt.Sprintf(
-			"error matching public keys: %v", err)), nil
+	// The certificate is the first one whose key is one of the stored keys,
+	// and the others make up the chain to its root
+	inputBundle := &certutil.ParsedCertBundle{}
+	var keyBundle *certutil.ParsedCertBundle
+	var otherCerts []*x509.Certificate
+	for _, inputCert := range inputCerts {
+		if inputBundle.Certificate != nil {
+			otherCerts = append(otherCerts, inputCert)
+			continue
+		}
+		certPublicKey, err := certutil.CertificatePublicKey(inputCert)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf(
+				"error parsing certificate public key: %v", err)), nil
+		}
+		for _, candidate := range candidateKeys {
+			equal, err := certutil.ComparePublicKeys(candidate.PrivateKey.Public(), certPublicKey)
+			if err != nil {
+				return logical.ErrorResponse(fmt.Sprintf(
+					"error matching public keys: %v", err)), nil
+			}
+			if equal {
+				keyBundle = candidate
+				break
+			}
+		}
+		if keyBundle != nil {
+			inputBundle.Certificate = inputCert
+			inputBundle.CertificateBytes = inputCert.Raw
+		} else {
+			otherCerts = append(otherCerts, inputCert)
+		}
 	}
-	if !equal {
+	if inputBundle.Certificate == nil {
 		return logical.ErrorResponse("key in certificate does not match stored key"), nil
 	}
 
-	inputBundle.PrivateKey = parsedCB.PrivateKey
-	inputBundle.PrivateKeyType = parsedCB.PrivateKeyType
-	inputBundle.PrivateKeyBytes = parsedCB.PrivateKeyBytes
+	inputBundle.PrivateKey = keyBundle.PrivateKey
+	inputBundle.PrivateKeyType = keyBundle.PrivateKeyType
+	inputBundle.PrivateKeyBytes = keyBundle.PrivateKeyBytes
 
 	if !inputBundle.Certificate.IsCA {
 		return logical.ErrorResponse("the given certificate is not marked for CA use and cannot be used with this backend"), nil
 	}
 
-	cb, err = inputBundle.ToCertBundle()
+	if len(otherCerts) > 0 {
+		chainBuilder := certutil.NewChainBuilder()
+		chainBuilder.AddCertificates(otherCerts...)
+		chains, err := chainBuilder.Build(inputBundle.Certificate)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf(
+				"error building the chain of the certificate: %v", err)), nil
+		}
+		for _, chainCert := range chains[0][1:] {
+			inputBundle.CAChain = append(inputBundle.CAChain, &certutil.CertBlock{
+				Certificate: chainCert,
+				Bytes:       chainCert.Raw,
+			})
+		}
+		inputBundle.IssuingCA = inputBundle.CAChain[0].Certificate
+		inputBundle.IssuingCABytes = inputBundle.CAChain[0].Bytes
+	}
+
+	cb, err := inputBundle.ToCertBundle()
 	if err != nil {
 		return nil, fmt.Errorf("error converting raw values into cert bundle: %s", err)
 	}
 
-	entry, err = logical.StorageEntryJSON("config/ca_bundle", cb)
+	issuer, existing, err := b.importIssuer(req.Storage, inputBundle, issuerName)
 	if err != nil {
-		return nil, err
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), nil
+		default:
+			return nil, err
+		}
 	}
-	err = req.Storage.Put(entry)
+
+	if keyBundle == pendingKey {
+		if err := req.Storage.Delete("config/pending_ca_key"); err != nil {
+			return nil, err
+		}
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"issuer_id": issuer.ID,
+		},
+	}
+	if existing {
+		resp.AddWarning("The certificate already belongs to an issuer, which is now the default issuer.")
+		return resp, nil
+	}
+
+	err = req.Storage.Put(&logical.StorageEntry{
+		Key:   "certs/" + cb.SerialNumber,
+		Value: inputBundle.CertificateBytes,
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	entry.Key = "certs/" + cb.SerialNumber
-	entry.Value = inputBundle.CertificateBytes
-	err = req.Storage.Put(entry)
-	if err != nil {
+	// Build a fresh CRL
+	if err := buildCRL(b, req); err != nil {
 		return nil, err
 	}
 
-	// For ease of later use, also store just the certificate at a known
-	// location
-	entry.Key = "ca"
-	entry.Value = inputBundle.CertificateBytes
-	err = req.Storage.Put(entry)
+	return resp, nil
+}
+
+// fetchPendingKey returns the key generated for an intermediate CA whose
+// signed certificate was not set yet, if any
+func fetchPendingKey(s logical.Storage) (*certutil.ParsedCertBundle, error) {
+	entry, err := s.Get("config/pending_ca_key")
 	if err != nil {
 		return nil, err
 	}
+	if entry == nil {
+		return nil, nil
+	}
 
-	// Build a fresh CRL
-	err = buildCRL(b, req)
+	var cb certutil.CertBundle
+	if err := entry.DecodeJSON(&cb); err != nil {
+		return nil, err
+	}
+	if len(cb.PrivateKey) == 0 || cb.PrivateKeyType == "" {
+		return nil, nil
+	}
 
-	return nil, err
+	parsedCB, err := cb.ToParsedCertBundle()
+	if err != nil {
+		return nil, err
+	}
+	if parsedCB.PrivateKey == nil {
+		return nil, fmt.Errorf("saved key could not be parsed successfully")
+	}
+	return parsedCB, nil
 }
 
 const pathGenerateIntermediateHelpSyn = `
@@ -237,6 +315,9 @@ Generate a new CSR and private key used for signing.
 `
 
 const pathGenerateIntermediateHelpDesc = `
+The private key is kept until the signed certificate is set, which adds it as a
+new issuer; the existing issuers keep being used until then.
+
 See the API documentation for more information.
 `
 
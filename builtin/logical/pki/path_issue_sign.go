@@ -3,6 +3,7 @@ package pki
 import (
 	"encoding/base64"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/hashicorp/vault/helper/certutil"
@@ -73,6 +74,8 @@ taken verbatim from the CSR, except for
 basic constraints.`,
 	}
 
+	ret.Fields = addIssuerRefField(ret.Fields)
+
 	return ret
 }
 
@@ -125,6 +128,7 @@ func (b *backend) pathSignVerbatim(
 		AllowIPSANs:      true,
 		EnforceHostnames: false,
 		KeyType:          "any",
+		IssuerRef:        data.Get("issuer_ref").(string),
 	}
 
 	return b.pathIssueSignCert(req, data, role, true, true)
@@ -139,7 +143,7 @@ func (b *backend) pathIssueSignCert(
 	}
 
 	var caErr error
-	signingBundle, caErr := fetchCAInfo(req)
+	signingBundle, caErr := fetchCAInfo(b, req, role.IssuerRef)
 	switch caErr.(type) {
 	case errutil.UserError:
 		return nil, errutil.UserError{Err: fmt.Sprintf(
@@ -192,11 +196,11 @@ func (b *backend) pathIssueSignCert(
 
 	case "pem_bundle":
 		resp.Data["issuing_ca"] = cb.IssuingCA
-		resp.Data["certificate"] = fmt.Sprintf("%s\n%s", cb.Certificate, cb.IssuingCA)
+		resp.Data["certificate"] = fmt.Sprintf("%s\n%s", cb.Certificate, strings.Join(cb.CAChain, "\n"))
 		if !useCSR {
 			resp.Data["private_key"] = cb.PrivateKey
 			resp.Data["private_key_type"] = cb.PrivateKeyType
-			resp.Data["certificate"] = fmt.Sprintf("%s\n%s\n%s", cb.PrivateKey, cb.Certificate, cb.IssuingCA)
+			resp.Data["certificate"] = fmt.Sprintf("%s\n%s\n%s", cb.PrivateKey, cb.Certificate, strings.Join(cb.CAChain, "\n"))
 		}
 
 	case "der":
@@ -207,6 +211,8 @@ func (b *backend) pathIssueSignCert(
 		}
 	}
 
+	resp.Data["ca_chain"] = caChainData(format, parsedBundle, cb)
+
 	resp.Secret.TTL = parsedBundle.Certificate.NotAfter.Sub(time.Now())
 
 	err = req.Storage.Put(&logical.StorageEntry{
@@ -0,0 +1,292 @@
+package pki
+
+import (
+	"encoding/pem"
+	"fmt"
+
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func pathListIssuers(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "issuers/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathIssuerList,
+		},
+
+		HelpSynopsis:    pathListIssuersHelpSyn,
+		HelpDescription: pathListIssuersHelpDesc,
+	}
+}
+
+func pathIssuer(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "issuer/" + framework.GenericNameRegex("issuer_ref"),
+		Fields: map[string]*framework.FieldSchema{
+			"issuer_ref": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The ID or name of the issuer, or "default" for
+the default issuer`,
+			},
+
+			"issuer_name": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The name of the issuer, by which it can be
+referred to instead of by its ID. An empty
+name removes the name of the issuer.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathIssuerRead,
+			logical.UpdateOperation: b.pathIssuerWrite,
+			logical.DeleteOperation: b.pathIssuerDelete,
+		},
+
+		HelpSynopsis:    pathIssuerHelpSyn,
+		HelpDescription: pathIssuerHelpDesc,
+	}
+}
+
+func pathConfigIssuers(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "config/issuers",
+		Fields: map[string]*framework.FieldSchema{
+			"default": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The ID or name of the issuer to use wherever
+no issuer is given`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathConfigIssuersRead,
+			logical.UpdateOperation: b.pathConfigIssuersWrite,
+		},
+
+		HelpSynopsis:    pathConfigIssuersHelpSyn,
+		HelpDescription: pathConfigIssuersHelpDesc,
+	}
+}
+
+func (b *backend) pathIssuerList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	issuers, err := b.listIssuers(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(issuers))
+	for _, issuer := range issuers {
+		ids = append(ids, issuer.ID)
+	}
+	return logical.ListResponse(ids), nil
+}
+
+func (b *backend) pathIssuerRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	issuer, err := b.resolveIssuer(req.Storage, data.Get("issuer_ref").(string))
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+
+	caInfo, err := caInfoFromIssuer(req, issuer)
+	if err != nil {
+		return nil, err
+	}
+	config, err := b.getIssuersConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	var caChain []string
+	for _, chainCert := range caInfo.CAChain {
+		caChain = append(caChain, string(pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: chainCert.Bytes,
+		})))
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"issuer_id":     issuer.ID,
+			"issuer_name":   issuer.Name,
+			"is_default":    issuer.ID == config.Default,
+			"certificate":   issuer.Bundle.Certificate,
+			"serial_number": issuer.Bundle.SerialNumber,
+			"expiration":    caInfo.Certificate.NotAfter.Unix(),
+			"ca_chain":      caChain,
+		},
+	}, nil
+}
+
+func (b *backend) pathIssuerWrite(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// Resolve the issuer first, as migrating a legacy CA takes the lock
+	issuer, err := b.resolveIssuer(req.Storage, data.Get("issuer_ref").(string))
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), nil
+		default:
+			return nil, err
+		}
+	}
+
+	nameRaw, ok := data.GetOk("issuer_name")
+	if !ok {
+		return nil, nil
+	}
+	name := nameRaw.(string)
+
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	if err := b.validateIssuerName(req.Storage, name, issuer.ID); err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), nil
+		default:
+			return nil, err
+		}
+	}
+
+	issuer.Name = name
+	if err := putIssuer(req.Storage, issuer); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathIssuerDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	issuer, err := b.resolveIssuer(req.Storage, data.Get("issuer_ref").(string))
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	config, err := b.getIssuersConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	if issuer.ID == config.Default {
+		return logical.ErrorResponse("the default issuer cannot be deleted; set another issuer as the default first"), nil
+	}
+
+	if err := deleteIssuer(req.Storage, issuer.ID); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathConfigIssuersRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := b.getIssuersConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"default": config.Default,
+		},
+	}, nil
+}
+
+func (b *backend) pathConfigIssuersWrite(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	ref := data.Get("default").(string)
+	if ref == "" {
+		return logical.ErrorResponse("the default issuer must be given"), nil
+	}
+	if ref == defaultRef {
+		return logical.ErrorResponse(fmt.Sprintf("%q does not name an issuer", defaultRef)), nil
+	}
+
+	issuer, err := b.resolveIssuer(req.Storage, ref)
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), nil
+		default:
+			return nil, err
+		}
+	}
+
+	b.issuersLock.Lock()
+	defer b.issuersLock.Unlock()
+
+	// The issuer may have been deleted while the lock was not held
+	current, err := fetchIssuerByID(req.Storage, issuer.ID)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil {
+		return logical.ErrorResponse(fmt.Sprintf("unknown issuer %q", ref)), nil
+	}
+
+	config, err := b.getIssuersConfig(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	config.Default = issuer.ID
+	if err := putIssuersConfig(req.Storage, config); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"default": config.Default,
+		},
+	}, nil
+}
+
+const pathListIssuersHelpSyn = `
+List the IDs of the issuers of the backend.
+`
+
+const pathListIssuersHelpDesc = `
+Issuers are the CAs of the backend. Each can sign certificates, and has its
+own CRL.
+`
+
+const pathIssuerHelpSyn = `
+Read, rename or delete an issuer.
+`
+
+const pathIssuerHelpDesc = `
+This path reads the certificate of an issuer, along with its chain, and sets
+its name. Issuers can be referred to by name wherever an issuer can be given.
+
+Deleting an issuer removes its certificate, key and CRLs. The default issuer
+cannot be deleted.
+`
+
+const pathConfigIssuersHelpSyn = `
+Set the default issuer.
+`
+
+const pathConfigIssuersHelpDesc = `
+The default issuer signs certificates for roles that do not name an issuer,
+and its certificate and CRL are the ones served from the "ca" and "crl" paths.
+Changing the default issuer moves such roles to the new issuer, which is how
+the CA of the backend is rotated.
+`
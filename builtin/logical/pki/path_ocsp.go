@@ -0,0 +1,233 @@
+package pki
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"time"
+
+	"github.com/hashicorp/vault/helper/certutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// Answers OCSP requests POSTed in DER encoding
+func pathOCSP(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `ocsp`,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathOCSPUpdate,
+		},
+
+		HelpSynopsis:    pathOCSPHelpSyn,
+		HelpDescription: pathOCSPHelpDesc,
+	}
+}
+
+// Answers OCSP requests sent with GET, base64-encoded in the path
+func pathOCSPGet(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: `ocsp/(?P<req>.+)`,
+		Fields: map[string]*framework.FieldSchema{
+			"req": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `The base64 encoding of the DER-encoded OCSP request`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathOCSPRead,
+		},
+
+		HelpSynopsis:    pathOCSPHelpSyn,
+		HelpDescription: pathOCSPHelpDesc,
+	}
+}
+
+func (b *backend) pathOCSPRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	ocspReq, err := base64.StdEncoding.DecodeString(data.Get("req").(string))
+	if err != nil {
+		return ocspErrorResponse(ocspMalformedRequest)
+	}
+	return b.answerOCSP(req, ocspReq)
+}
+
+func (b *backend) pathOCSPUpdate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	ocspReq, _ := req.Data[logical.HTTPRawBody].([]byte)
+	if len(ocspReq) == 0 {
+		return ocspErrorResponse(ocspMalformedRequest)
+	}
+	return b.answerOCSP(req, ocspReq)
+}
+
+// answerOCSP returns the OCSP response to the DER-encoded request. Failures
+// are reported to the client in the status of the response, as OCSP clients
+// do not understand any other kind of error.
+func (b *backend) answerOCSP(req *logical.Request, der []byte) (*logical.Response, error) {
+	config, err := b.crlConfigOrDefault(req.Storage)
+	if err != nil {
+		b.Logger().Printf("[ERR] pki: error fetching CRL configuration for OCSP: %s", err)
+		return ocspErrorResponse(ocspInternalError)
+	}
+	if config.OCSPDisable {
+		return ocspErrorResponse(ocspUnauthorized)
+	}
+	ocspExpiry, err := time.ParseDuration(config.OCSPExpiry)
+	if err != nil {
+		b.Logger().Printf("[ERR] pki: error parsing OCSP expiry: %s", err)
+		return ocspErrorResponse(ocspInternalError)
+	}
+
+	ocspReq, err := parseOCSPRequest(der)
+	if err != nil {
+		return ocspErrorResponse(ocspMalformedRequest)
+	}
+
+	caInfos, err := fetchAllCAInfo(b, req)
+	if err != nil {
+		b.Logger().Printf("[ERR] pki: error fetching CAs for OCSP: %s", err)
+		return ocspErrorResponse(ocspInternalError)
+	}
+
+	b.revokeStorageLock.RLock()
+	defer b.revokeStorageLock.RUnlock()
+
+	// The response is signed by the issuer of the certificates, so all of
+	// them must have been issued by the same one
+	var signingBundle *caInfoBundle
+	statuses := make([]ocspCertStatus, 0, len(ocspReq.TBSRequest.RequestList))
+	for _, single := range ocspReq.TBSRequest.RequestList {
+		certID := single.CertID
+		if certID.SerialNumber == nil {
+			return ocspErrorResponse(ocspMalformedRequest)
+		}
+
+		// This responder only knows about the certificates issued by the
+		// backend's issuers
+		var issuer *caInfoBundle
+		for _, caInfo := range caInfos {
+			matches, err := certID.matchesIssuer(caInfo.Certificate.RawSubject,
+				caInfo.Certificate.RawSubjectPublicKeyInfo)
+			if err != nil {
+				return ocspErrorResponse(ocspUnauthorized)
+			}
+			if matches {
+				issuer = caInfo
+				break
+			}
+		}
+		if issuer == nil || (signingBundle != nil && issuer != signingBundle) {
+			return ocspErrorResponse(ocspUnauthorized)
+		}
+		signingBundle = issuer
+
+		status, err := certStatus(req, certID, issuer.Certificate)
+		if err != nil {
+			b.Logger().Printf("[ERR] pki: error fetching certificate status for OCSP: %s", err)
+			return ocspErrorResponse(ocspInternalError)
+		}
+		statuses = append(statuses, *status)
+	}
+
+	now := time.Now()
+	var nextUpdate time.Time
+	if ocspExpiry > 0 {
+		nextUpdate = now.Add(ocspExpiry)
+	}
+
+	ocspResp, err := createOCSPResponse(signingBundle, statuses, now, nextUpdate)
+	if err != nil {
+		b.Logger().Printf("[ERR] pki: error creating OCSP response: %s", err)
+		return ocspErrorResponse(ocspInternalError)
+	}
+
+	return ocspRawResponse(ocspResp), nil
+}
+
+// certStatus looks up the status of the certificate named by the CertID,
+// which is unknown unless the issuer issued it
+func certStatus(req *logical.Request, certID ocspCertID, issuer *x509.Certificate) (*ocspCertStatus, error) {
+	serial := certutil.GetOctalFormatted(certID.SerialNumber.Bytes(), ":")
+	status := &ocspCertStatus{
+		CertID: certID,
+		Status: ocspUnknown,
+	}
+
+	revokedEntry, err := fetchCertBySerial(req, "revoked/", serial)
+	if err != nil {
+		return nil, err
+	}
+	if revokedEntry != nil {
+		var revInfo revocationInfo
+		if err := revokedEntry.DecodeJSON(&revInfo); err != nil {
+			return nil, err
+		}
+		revokedCert, err := x509.ParseCertificate(revInfo.CertificateBytes)
+		if err != nil {
+			return nil, err
+		}
+		if !issuedBy(revokedCert, issuer) {
+			return status, nil
+		}
+		status.Status = ocspRevoked
+		status.RevocationTime = revInfo.RevocationTimeUTC
+		if status.RevocationTime.IsZero() {
+			status.RevocationTime = time.Unix(revInfo.RevocationTime, 0)
+		}
+		return status, nil
+	}
+
+	certEntry, err := fetchCertBySerial(req, "certs/", serial)
+	if err != nil {
+		return nil, err
+	}
+	if certEntry != nil {
+		cert, err := x509.ParseCertificate(certEntry.Value)
+		if err != nil {
+			return nil, err
+		}
+		if issuedBy(cert, issuer) {
+			status.Status = ocspGood
+		}
+	}
+
+	return status, nil
+}
+
+func ocspErrorResponse(status asn1.Enumerated) (*logical.Response, error) {
+	ocspResp, err := createOCSPErrorResponse(status)
+	if err != nil {
+		return nil, err
+	}
+	return ocspRawResponse(ocspResp), nil
+}
+
+func ocspRawResponse(ocspResp []byte) *logical.Response {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			logical.HTTPContentType: "application/ocsp-response",
+			logical.HTTPRawBody:     ocspResp,
+			logical.HTTPStatusCode:  200,
+		},
+	}
+}
+
+const pathOCSPHelpSyn = `
+Query the revocation status of certificates issued by the CA using OCSP.
+`
+
+const pathOCSPHelpDesc = `
+This endpoint is an OCSP responder, as described in RFC 6960, for all of the
+issuers of the backend. Requests are
+either POSTed to "ocsp" in DER encoding, with a Content-Type of
+"application/ocsp-request", or sent with GET to "ocsp/<request>", where the
+request is base64 encoded.
+
+Responses are signed by the issuer of the certificates and valid for the
+ocsp_expiry set in "config/crl". Requests about certificates not issued by
+one of the issuers, about certificates of several issuers at once, or any
+request while ocsp_disable is set, are answered with an unauthorized status.
+`
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/fatih/structs"
+	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 )
@@ -167,6 +168,14 @@ the common name in the CSR will be used. This
 does *not* include any requested Subject Alternative
 Names. Defaults to true.`,
 			},
+
+			"issuer_ref": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: defaultRef,
+				Description: `The ID or name of the issuer that signs the
+certificates of this role. Defaults to the
+default issuer, whichever it is at the time.`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -211,6 +220,10 @@ func (b *backend) getRole(s logical.Storage, n string) (*roleEntry, error) {
 		result.AllowBareDomains = true
 		modified = true
 	}
+	// Roles from before issuers existed use the default issuer
+	if result.IssuerRef == "" {
+		result.IssuerRef = defaultRef
+	}
 	if result.AllowedBaseDomain != "" {
 		found := false
 		allowedDomains := strings.Split(result.AllowedDomains, ",")
@@ -328,6 +341,7 @@ func (b *backend) pathRoleCreate(
 		KeyBits:             data.Get("key_bits").(int),
 		UseCSRCommonName:    data.Get("use_csr_common_name").(bool),
 		KeyUsage:            data.Get("key_usage").(string),
+		IssuerRef:           data.Get("issuer_ref").(string),
 	}
 
 	if entry.KeyType == "rsa" && entry.KeyBits < 2048 {
@@ -377,6 +391,18 @@ func (b *backend) pathRoleCreate(
 		return errResp, nil
 	}
 
+	// The default issuer may not be set yet, but any other issuer must exist
+	if entry.IssuerRef != defaultRef {
+		if _, err := b.resolveIssuer(req.Storage, entry.IssuerRef); err != nil {
+			switch err.(type) {
+			case errutil.UserError:
+				return logical.ErrorResponse(err.Error()), nil
+			default:
+				return nil, err
+			}
+		}
+	}
+
 	// Store it
 	jsonEntry, err := logical.StorageEntryJSON("role/"+name, entry)
 	if err != nil {
@@ -442,6 +468,7 @@ type roleEntry struct {
 	KeyBits               int    `json:"key_bits" structs:"key_bits" mapstructure:"key_bits"`
 	MaxPathLength         *int   `json:",omitempty" structs:",omitempty"`
 	KeyUsage              string `json:"key_usage" structs:"key_usage" mapstructure:"key_usage"`
+	IssuerRef             string `json:"issuer_ref" structs:"issuer_ref" mapstructure:"issuer_ref"`
 }
 
 const pathListRolesHelpSyn = `List the existing roles in this backend`
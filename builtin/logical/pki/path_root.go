@@ -1,9 +1,13 @@
 package pki
 
 import (
+	"crypto/rand"
+	"crypto/x509"
 	"encoding/base64"
 	"fmt"
+	"strings"
 
+	"github.com/hashicorp/vault/helper/certutil"
 	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
@@ -24,6 +28,7 @@ func pathGenerateRoot(b *backend) *framework.Path {
 	ret.Fields = addCACommonFields(map[string]*framework.FieldSchema{})
 	ret.Fields = addCAKeyGenerationFields(ret.Fields)
 	ret.Fields = addCAIssueFields(ret.Fields)
+	ret.Fields = addIssuerNameField(ret.Fields)
 
 	return ret
 }
@@ -42,6 +47,7 @@ func pathSignIntermediate(b *backend) *framework.Path {
 
 	ret.Fields = addCACommonFields(map[string]*framework.FieldSchema{})
 	ret.Fields = addCAIssueFields(ret.Fields)
+	ret.Fields = addIssuerRefField(ret.Fields)
 
 	ret.Fields["csr"] = &framework.FieldSchema{
 		Type:        framework.TypeString,
@@ -66,6 +72,41 @@ the non-repudiation flag.`,
 	return ret
 }
 
+func pathCrossSign(b *backend) *framework.Path {
+	ret := &framework.Path{
+		Pattern: "root/cross-sign",
+
+		Fields: map[string]*framework.FieldSchema{
+			"certificate": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `PEM-format CA certificate to cross-sign. The
+new certificate keeps its subject, key and
+extensions.`,
+			},
+
+			"format": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "pem",
+				Description: `Format for returned data. Can be "pem", "der",
+or "pem_bundle". If "pem_bundle" the CA chain
+will be appended to the certificate pem.
+Defaults to "pem".`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathCACrossSign,
+		},
+
+		HelpSynopsis:    pathCrossSignHelpSyn,
+		HelpDescription: pathCrossSignHelpDesc,
+	}
+
+	ret.Fields = addIssuerRefField(ret.Fields)
+
+	return ret
+}
+
 func (b *backend) pathCAGenerateRoot(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	var err error
@@ -81,6 +122,16 @@ func (b *backend) pathCAGenerateRoot(
 		role.MaxPathLength = &maxPathLength
 	}
 
+	issuerName := data.Get("issuer_name").(string)
+	if err := b.validateIssuerName(req.Storage, issuerName, ""); err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), nil
+		default:
+			return nil, err
+		}
+	}
+
 	parsedBundle, err := generateCert(b, role, nil, true, req, data)
 	if err != nil {
 		switch err.(type) {
@@ -132,15 +183,17 @@ func (b *backend) pathCAGenerateRoot(
 		}
 	}
 
-	// Store it as the CA bundle
-	entry, err := logical.StorageEntryJSON("config/ca_bundle", cb)
-	if err != nil {
-		return nil, err
-	}
-	err = req.Storage.Put(entry)
+	// Store it as a new issuer
+	issuer, _, err := b.importIssuer(req.Storage, parsedBundle, issuerName)
 	if err != nil {
-		return nil, err
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), nil
+		default:
+			return nil, err
+		}
 	}
+	resp.Data["issuer_id"] = issuer.ID
 
 	// Also store it as just the certificate identified by serial number, so it
 	// can be revoked
@@ -152,15 +205,6 @@ func (b *backend) pathCAGenerateRoot(
 		return nil, fmt.Errorf("Unable to store certificate locally")
 	}
 
-	// For ease of later use, also store just the certificate at a known
-	// location
-	entry.Key = "ca"
-	entry.Value = parsedBundle.CertificateBytes
-	err = req.Storage.Put(entry)
-	if err != nil {
-		return nil, err
-	}
-
 	// Build a fresh CRL
 	err = buildCRL(b, req)
 	if err != nil {
@@ -199,7 +243,7 @@ func (b *backend) pathCASignIntermediate(
 	}
 
 	var caErr error
-	signingBundle, caErr := fetchCAInfo(req)
+	signingBundle, caErr := fetchCAInfo(b, req, data.Get("issuer_ref").(string))
 	switch caErr.(type) {
 	case errutil.UserError:
 		return nil, errutil.UserError{Err: fmt.Sprintf(
@@ -245,7 +289,7 @@ func (b *backend) pathCASignIntermediate(
 		resp.Data["issuing_ca"] = cb.IssuingCA
 
 	case "pem_bundle":
-		resp.Data["certificate"] = fmt.Sprintf("%s\n%s", cb.Certificate, cb.IssuingCA)
+		resp.Data["certificate"] = fmt.Sprintf("%s\n%s", cb.Certificate, strings.Join(cb.CAChain, "\n"))
 		resp.Data["issuing_ca"] = cb.IssuingCA
 
 	case "der":
@@ -253,6 +297,8 @@ func (b *backend) pathCASignIntermediate(
 		resp.Data["issuing_ca"] = base64.StdEncoding.EncodeToString(parsedBundle.IssuingCABytes)
 	}
 
+	resp.Data["ca_chain"] = caChainData(format, parsedBundle, cb)
+
 	err = req.Storage.Put(&logical.StorageEntry{
 		Key:   "certs/" + cb.SerialNumber,
 		Value: parsedBundle.CertificateBytes,
@@ -268,11 +314,143 @@ func (b *backend) pathCASignIntermediate(
 	return resp, nil
 }
 
+func (b *backend) pathCACrossSign(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	format := getFormat(data)
+	if format == "" {
+		return logical.ErrorResponse(
+			`The "format" path parameter must be "pem", "der", or "pem_bundle"`,
+		), nil
+	}
+
+	certPEM := data.Get("certificate").(string)
+	if certPEM == "" {
+		return logical.ErrorResponse("no certificate provided in the \"certificate\" parameter"), nil
+	}
+	certs, err := certutil.ParsePEMCertificates(certPEM)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	if len(certs) != 1 {
+		return logical.ErrorResponse("exactly one certificate must be provided"), nil
+	}
+	cert := certs[0]
+	if !cert.IsCA {
+		return logical.ErrorResponse("the given certificate is not marked for CA use and cannot be cross-signed"), nil
+	}
+
+	signingBundle, caErr := fetchCAInfo(b, req, data.Get("issuer_ref").(string))
+	switch caErr.(type) {
+	case errutil.UserError:
+		return nil, errutil.UserError{Err: fmt.Sprintf(
+			"could not fetch the CA certificate (was one set?): %s", caErr)}
+	case errutil.InternalError:
+		return nil, errutil.InternalError{Err: fmt.Sprintf(
+			"error fetching CA certificate: %s", caErr)}
+	}
+	if signingBundle.Certificate.MaxPathLen == 0 && signingBundle.Certificate.MaxPathLenZero {
+		return logical.ErrorResponse("signing certificate has a max path length of zero, and cannot issue further CA certificates"), nil
+	}
+
+	publicKey, err := certutil.CertificatePublicKey(cert)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf(
+			"error parsing certificate public key: %v", err)), nil
+	}
+
+	// The raw subject of the certificate is kept, so that certificates it
+	// issued chain to the cross-signed certificate as well; the issuer
+	// information is replaced with that of this CA
+	template := *cert
+	template.SerialNumber, err = certutil.GenerateSerialNumber()
+	if err != nil {
+		return nil, err
+	}
+	template.AuthorityKeyId = signingBundle.Certificate.SubjectKeyId
+	template.IssuingCertificateURL = signingBundle.URLs.IssuingCertificates
+	template.CRLDistributionPoints = signingBundle.URLs.CRLDistributionPoints
+	template.OCSPServer = signingBundle.URLs.OCSPServers
+	template.SignatureAlgorithm = x509.UnknownSignatureAlgorithm
+	switch signingBundle.PrivateKeyType {
+	case certutil.RSAPrivateKey:
+		template.SignatureAlgorithm = x509.SHA256WithRSA
+	case certutil.ECPrivateKey:
+		template.SignatureAlgorithm = x509.ECDSAWithSHA256
+	}
+
+	var warning string
+	if template.NotAfter.After(signingBundle.Certificate.NotAfter) {
+		template.NotAfter = signingBundle.Certificate.NotAfter
+		warning = "The certificate expires after the CA certificate, so the cross-signed certificate expires with the CA certificate."
+	}
+
+	certBytes, err := x509.CreateCertificate(rand.Reader, &template, signingBundle.Certificate, publicKey, signingBundle.PrivateKey)
+	if err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to create certificate: %s", err)}
+	}
+	parsedCert, err := x509.ParseCertificate(certBytes)
+	if err != nil {
+		return nil, errutil.InternalError{Err: fmt.Sprintf("unable to parse created certificate: %s", err)}
+	}
+
+	parsedBundle := &certutil.ParsedCertBundle{
+		CertificateBytes: certBytes,
+		Certificate:      parsedCert,
+		IssuingCABytes:   signingBundle.CertificateBytes,
+		IssuingCA:        signingBundle.Certificate,
+		CAChain:          signingBundle.caChain(),
+	}
+	cb, err := parsedBundle.ToCertBundle()
+	if err != nil {
+		return nil, fmt.Errorf("Error converting raw cert bundle to cert bundle: %s", err)
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"expiration":    int64(parsedCert.NotAfter.Unix()),
+			"serial_number": cb.SerialNumber,
+		},
+	}
+
+	switch format {
+	case "pem":
+		resp.Data["certificate"] = cb.Certificate
+		resp.Data["issuing_ca"] = cb.IssuingCA
+
+	case "pem_bundle":
+		resp.Data["certificate"] = fmt.Sprintf("%s\n%s", cb.Certificate, strings.Join(cb.CAChain, "\n"))
+		resp.Data["issuing_ca"] = cb.IssuingCA
+
+	case "der":
+		resp.Data["certificate"] = base64.StdEncoding.EncodeToString(certBytes)
+		resp.Data["issuing_ca"] = base64.StdEncoding.EncodeToString(parsedBundle.IssuingCABytes)
+	}
+
+	resp.Data["ca_chain"] = caChainData(format, parsedBundle, cb)
+
+	err = req.Storage.Put(&logical.StorageEntry{
+		Key:   "certs/" + cb.SerialNumber,
+		Value: certBytes,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to store certificate locally")
+	}
+
+	if warning != "" {
+		resp.AddWarning(warning)
+	}
+
+	return resp, nil
+}
+
 const pathGenerateRootHelpSyn = `
 Generate a new CA certificate and private key used for signing.
 `
 
 const pathGenerateRootHelpDesc = `
+The new CA is added as an issuer of the backend, and becomes the default
+issuer.
+
 See the API documentation for more information.
 `
 
@@ -283,3 +461,16 @@ Issue an intermediate CA certificate based on the provided CSR.
 const pathSignIntermediateHelpDesc = `
 See the API documentation for more information.
 `
+
+const pathCrossSignHelpSyn = `
+Cross-sign a CA certificate with this CA.
+`
+
+const pathCrossSignHelpDesc = `
+This path issues a certificate with the subject, key and extensions of the
+given CA certificate, signed by the CA of this backend. Certificates issued by
+the given CA then chain to this CA as well, which allows moving a hierarchy to
+a new root, or trusting it through an existing one.
+
+See the API documentation for more information.
+`
@@ -0,0 +1,53 @@
+package transform
+
+import (
+	"strings"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// Factory creates and configures the backend
+func Factory(conf *logical.BackendConfig) (logical.Backend, error) {
+	return Backend().Setup(conf)
+}
+
+// Backend creates a new transform backend
+func Backend() *backend {
+	var b backend
+	b.Backend = &framework.Backend{
+		Help: strings.TrimSpace(backendHelp),
+
+		Paths: []*framework.Path{
+			pathListRoles(&b),
+			pathRoles(&b),
+			pathListTransformations(&b),
+			pathTransformations(&b),
+			pathListTemplates(&b),
+			pathTemplates(&b),
+			pathEncode(&b),
+			pathDecode(&b),
+		},
+
+		Secrets: []*framework.Secret{},
+	}
+
+	return &b
+}
+
+type backend struct {
+	*framework.Backend
+}
+
+const backendHelp = `
+The transform backend transforms data while keeping it usable by applications
+and schemas that expect data of a given format.
+
+Transformations are applied to values through roles, which list the
+transformations their clients can use. Format-preserving encryption ("fpe")
+encrypts the characters of a value matched by a template with FF3-1, so that
+the ciphertext has the same length and alphabet as the plaintext. Masking
+replaces these characters with a masking character, and cannot be reversed.
+Tokenization replaces the whole value with a token, storing the value so that
+the token can be decoded.
+`
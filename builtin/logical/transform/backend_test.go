@@ -0,0 +1,303 @@
+package transform
+
+import (
+	"encoding/base64"
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func testBackend(t *testing.T) (*backend, logical.Storage) {
+	config := logical.TestBackendConfig()
+	config.StorageView = &logical.InmemStorage{}
+	b := Backend()
+	if _, err := b.Setup(config); err != nil {
+		t.Fatal(err)
+	}
+	return b, config.StorageView
+}
+
+func testRequest(t *testing.T, b *backend, s logical.Storage, op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	resp, err := b.HandleRequest(&logical.Request{
+		Operation: op,
+		Path:      path,
+		Storage:   s,
+		Data:      data,
+	})
+	if err != nil && err != logical.ErrInvalidRequest {
+		t.Fatalf("bad: %s %s: err: %s", op, path, err)
+	}
+	return resp
+}
+
+func testWrite(t *testing.T, b *backend, s logical.Storage, path string, data map[string]interface{}) *logical.Response {
+	resp := testRequest(t, b, s, logical.UpdateOperation, path, data)
+	if resp != nil && resp.IsError() {
+		t.Fatalf("bad: %s: %#v", path, resp.Data)
+	}
+	return resp
+}
+
+func testWriteError(t *testing.T, b *backend, s logical.Storage, path string, data map[string]interface{}) {
+	resp := testRequest(t, b, s, logical.UpdateOperation, path, data)
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error: %s: %#v", path, resp)
+	}
+}
+
+func TestBackend_fpe(t *testing.T) {
+	b, s := testBackend(t)
+
+	testWrite(t, b, s, "transformation/ccn", map[string]interface{}{
+		"type":          "fpe",
+		"template":      "builtin/creditcardnumber",
+		"tweak_source":  "internal",
+		"allowed_roles": "payments",
+	})
+	testWrite(t, b, s, "role/payments", map[string]interface{}{
+		"transformations": "ccn",
+	})
+
+	// The encoded value keeps the format of the value
+	value := "4111-1111-1111-1111"
+	encoded := testWrite(t, b, s, "encode/payments", map[string]interface{}{
+		"value": value,
+	}).Data["encoded_value"].(string)
+	if encoded == value || !regexp.MustCompile(`^\d{4}-\d{4}-\d{4}-\d{4}$`).MatchString(encoded) {
+		t.Fatalf("bad: %s", encoded)
+	}
+	other := testWrite(t, b, s, "encode/payments", map[string]interface{}{
+		"value": value,
+	}).Data["encoded_value"]
+	if other != encoded {
+		t.Fatalf("expected a deterministic encoding with an internal tweak: %s", other)
+	}
+
+	decoded := testWrite(t, b, s, "decode/payments", map[string]interface{}{
+		"value": encoded,
+	}).Data["decoded_value"]
+	if decoded != value {
+		t.Fatalf("bad: %s", decoded)
+	}
+
+	testWriteError(t, b, s, "encode/payments", map[string]interface{}{
+		"value": "not a card number",
+	})
+
+	// Supplied tweaks are required and change the encoding
+	testWrite(t, b, s, "transformation/ssn", map[string]interface{}{
+		"type":          "fpe",
+		"template":      "builtin/socialsecuritynumber",
+		"allowed_roles": "*",
+	})
+	testWrite(t, b, s, "role/staff", map[string]interface{}{
+		"transformations": "ssn",
+	})
+	testWriteError(t, b, s, "encode/staff", map[string]interface{}{
+		"value": "123-45-6789",
+	})
+	tweak1 := base64.StdEncoding.EncodeToString([]byte("tweak-1"))
+	tweak2 := base64.StdEncoding.EncodeToString([]byte("tweak-2"))
+	encoded1 := testWrite(t, b, s, "encode/staff", map[string]interface{}{
+		"value": "123-45-6789",
+		"tweak": tweak1,
+	}).Data["encoded_value"]
+	encoded2 := testWrite(t, b, s, "encode/staff", map[string]interface{}{
+		"value": "123-45-6789",
+		"tweak": tweak2,
+	}).Data["encoded_value"]
+	if encoded1 == encoded2 {
+		t.Fatal("expected different encodings for different tweaks")
+	}
+	decoded = testWrite(t, b, s, "decode/staff", map[string]interface{}{
+		"value": encoded2,
+		"tweak": tweak2,
+	}).Data["decoded_value"]
+	if decoded != "123-45-6789" {
+		t.Fatalf("bad: %s", decoded)
+	}
+
+	// Generated tweaks are returned for decoding
+	testWrite(t, b, s, "template/accounts", map[string]interface{}{
+		"pattern":  `ACC-([A-Z0-9]{8})`,
+		"alphabet": "builtin/alphanumericupper",
+	})
+	testWrite(t, b, s, "transformation/accounts", map[string]interface{}{
+		"type":          "fpe",
+		"template":      "accounts",
+		"tweak_source":  "generated",
+		"allowed_roles": "staff",
+	})
+	testWrite(t, b, s, "role/staff", map[string]interface{}{
+		"transformations": "ssn,accounts",
+	})
+	testWriteError(t, b, s, "encode/staff", map[string]interface{}{
+		"value": "ACC-AB12CD34",
+	})
+	resp := testWrite(t, b, s, "encode/staff", map[string]interface{}{
+		"value":          "ACC-AB12CD34",
+		"transformation": "accounts",
+	})
+	encoded = resp.Data["encoded_value"].(string)
+	if !regexp.MustCompile(`^ACC-[A-Z0-9]{8}$`).MatchString(encoded) || resp.Data["tweak"] == nil {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	decoded = testWrite(t, b, s, "decode/staff", map[string]interface{}{
+		"value":          encoded,
+		"transformation": "accounts",
+		"tweak":          resp.Data["tweak"],
+	}).Data["decoded_value"]
+	if decoded != "ACC-AB12CD34" {
+		t.Fatalf("bad: %s", decoded)
+	}
+
+	// Transformations must be in the role and allow it
+	testWriteError(t, b, s, "encode/staff", map[string]interface{}{
+		"value":          value,
+		"transformation": "ccn",
+	})
+	testWrite(t, b, s, "role/staff", map[string]interface{}{
+		"transformations": "ccn",
+	})
+	testWriteError(t, b, s, "encode/staff", map[string]interface{}{
+		"value": value,
+	})
+}
+
+func TestBackend_masking(t *testing.T) {
+	b, s := testBackend(t)
+
+	testWriteError(t, b, s, "transformation/mask", map[string]interface{}{
+		"type":              "masking",
+		"template":          "builtin/creditcardnumber",
+		"masking_character": "##",
+	})
+	testWrite(t, b, s, "transformation/mask", map[string]interface{}{
+		"type":              "masking",
+		"template":          "builtin/creditcardnumber",
+		"masking_character": "#",
+		"allowed_roles":     "support",
+	})
+	testWrite(t, b, s, "role/support", map[string]interface{}{
+		"transformations": "mask",
+	})
+
+	encoded := testWrite(t, b, s, "encode/support", map[string]interface{}{
+		"value": "4111 1111 1111 1111",
+	}).Data["encoded_value"]
+	if encoded != "#### #### #### ####" {
+		t.Fatalf("bad: %s", encoded)
+	}
+	testWriteError(t, b, s, "decode/support", map[string]interface{}{
+		"value": encoded,
+	})
+}
+
+func TestBackend_tokenization(t *testing.T) {
+	b, s := testBackend(t)
+
+	testWrite(t, b, s, "transformation/tokens", map[string]interface{}{
+		"type":          "tokenization",
+		"allowed_roles": "app",
+	})
+	testWrite(t, b, s, "transformation/convergent", map[string]interface{}{
+		"type":          "tokenization",
+		"convergent":    true,
+		"allowed_roles": "app",
+	})
+	testWrite(t, b, s, "role/app", map[string]interface{}{
+		"transformations": "tokens,convergent",
+	})
+
+	encode := func(transformation, value string) string {
+		return testWrite(t, b, s, "encode/app", map[string]interface{}{
+			"value":          value,
+			"transformation": transformation,
+		}).Data["encoded_value"].(string)
+	}
+	decode := func(transformation, value string) string {
+		return testWrite(t, b, s, "decode/app", map[string]interface{}{
+			"value":          value,
+			"transformation": transformation,
+		}).Data["decoded_value"].(string)
+	}
+
+	for _, transformation := range []string{"tokens", "convergent"} {
+		token1, token2 := encode(transformation, "secret value"), encode(transformation, "secret value")
+		if (token1 == token2) != (transformation == "convergent") {
+			t.Fatalf("bad: %s: %s %s", transformation, token1, token2)
+		}
+		if decode(transformation, token1) != "secret value" || decode(transformation, token2) != "secret value" {
+			t.Fatalf("bad: %s", transformation)
+		}
+	}
+
+	// Tokens cannot be decoded once their transformation is deleted
+	token := encode("tokens", "secret value")
+	testWriteError(t, b, s, "decode/app", map[string]interface{}{
+		"value":          "unknown",
+		"transformation": "tokens",
+	})
+	testRequest(t, b, s, logical.DeleteOperation, "transformation/tokens", nil)
+	tokens, err := s.List(tokensPrefix + "tokens/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 0 {
+		t.Fatalf("bad: %v", tokens)
+	}
+	testWrite(t, b, s, "transformation/tokens", map[string]interface{}{
+		"type":          "tokenization",
+		"allowed_roles": "app",
+	})
+	testWriteError(t, b, s, "decode/app", map[string]interface{}{
+		"value":          token,
+		"transformation": "tokens",
+	})
+
+	// The type of a transformation cannot change
+	testWriteError(t, b, s, "transformation/tokens", map[string]interface{}{
+		"type": "fpe",
+	})
+}
+
+func TestBackend_templates(t *testing.T) {
+	b, s := testBackend(t)
+
+	for _, data := range []map[string]interface{}{
+		{"pattern": `\d+`, "alphabet": "builtin/numeric"},
+		{"pattern": `(\d+`, "alphabet": "builtin/numeric"},
+		{"pattern": `(\d+)`, "alphabet": "builtin/unknown"},
+		{"pattern": `(\d+)`, "alphabet": "a"},
+		{"pattern": `(\d+)`, "type": "glob", "alphabet": "builtin/numeric"},
+	} {
+		testWriteError(t, b, s, "template/bad", data)
+	}
+
+	testWrite(t, b, s, "template/phone", map[string]interface{}{
+		"pattern":  `\+1 \((\d{3})\) (\d{3})-(\d{4})`,
+		"alphabet": "0123456789",
+	})
+	resp := testRequest(t, b, s, logical.ListOperation, "template/", nil)
+	if keys := resp.Data["keys"].([]string); len(keys) != 1 || keys[0] != "phone" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	template, err := b.getTemplate(s, "phone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := template.apply("+1 (555) 123-4567", func(input string) (string, error) {
+		if input != "5551234567" {
+			t.Fatalf("bad: %s", input)
+		}
+		return "0987654321", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != "+1 (098) 765-4321" {
+		t.Fatalf("bad: %s", result)
+	}
+}
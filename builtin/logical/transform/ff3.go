@@ -0,0 +1,220 @@
+package transform
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// ff3TweakSize is the size in bytes of the 56-bit tweaks of FF3-1
+const ff3TweakSize = 7
+
+// ff3Cipher encrypts strings of an alphabet with FF3-1, the format-preserving
+// encryption mode of NIST SP 800-38G Revision 1. The ciphertext of a string
+// is a string of the same length and alphabet.
+type ff3Cipher struct {
+	block    cipher.Block
+	alphabet string
+	radix    *big.Int
+
+	// minLength and maxLength are the bounds of the length of the inputs:
+	// the domain must have at least a million strings, and half of the
+	// string must fit in the 96 bits of a round input
+	minLength int
+	maxLength int
+}
+
+// newFF3Cipher returns an FF3-1 cipher with the AES key for strings of the
+// alphabet, which must have at least two distinct characters
+func newFF3Cipher(key []byte, alphabet string) (*ff3Cipher, error) {
+	radix := len([]rune(alphabet))
+	if radix < 2 || radix > 1<<16 {
+		return nil, fmt.Errorf("alphabet must have between 2 and 65536 characters")
+	}
+	for i, r := range alphabet {
+		if strings.IndexRune(alphabet[i+len(string(r)):], r) >= 0 {
+			return nil, fmt.Errorf("alphabet has duplicate character %q", r)
+		}
+	}
+
+	// The key is used in reverse byte order
+	reversed := make([]byte, len(key))
+	for i, b := range key {
+		reversed[len(key)-1-i] = b
+	}
+	block, err := aes.NewCipher(reversed)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &ff3Cipher{
+		block:    block,
+		alphabet: alphabet,
+		radix:    big.NewInt(int64(radix)),
+	}
+
+	// minLength is the smallest length with radix^minLength >= 1000000,
+	// and maxLength is 2*floor(log_radix(2^96))
+	domain := big.NewInt(1)
+	for c.minLength = 0; domain.Cmp(big.NewInt(1000000)) < 0; c.minLength++ {
+		domain.Mul(domain, c.radix)
+	}
+	limit := new(big.Int).Lsh(big.NewInt(1), 96)
+	half := 0
+	for domain.SetInt64(1); ; half++ {
+		domain.Mul(domain, c.radix)
+		if domain.Cmp(limit) > 0 {
+			break
+		}
+	}
+	c.maxLength = 2 * half
+
+	return c, nil
+}
+
+// Encrypt returns the encryption of the input with the 7-byte tweak
+func (c *ff3Cipher) Encrypt(input string, tweak []byte) (string, error) {
+	return c.crypt(input, tweak, true)
+}
+
+// Decrypt returns the decryption of the input with the 7-byte tweak
+func (c *ff3Cipher) Decrypt(input string, tweak []byte) (string, error) {
+	return c.crypt(input, tweak, false)
+}
+
+func (c *ff3Cipher) crypt(input string, tweak []byte, encrypt bool) (string, error) {
+	if len(tweak) != ff3TweakSize {
+		return "", fmt.Errorf("tweak must be %d bytes long", ff3TweakSize)
+	}
+
+	// The 56-bit tweak is split into two 32-bit halves, the middle byte
+	// being shared between them
+	tL := []byte{tweak[0], tweak[1], tweak[2], tweak[3] & 0xf0}
+	tR := []byte{tweak[4], tweak[5], tweak[6], tweak[3] << 4}
+
+	numerals, err := c.numerals(input)
+	if err != nil {
+		return "", err
+	}
+	if len(numerals) < c.minLength || len(numerals) > c.maxLength {
+		return "", fmt.Errorf("input must be between %d and %d characters long", c.minLength, c.maxLength)
+	}
+
+	var output []int
+	if encrypt {
+		output = c.encrypt(numerals, tL, tR)
+	} else {
+		output = c.decrypt(numerals, tL, tR)
+	}
+
+	runes := []rune(c.alphabet)
+	result := make([]rune, len(output))
+	for i, n := range output {
+		result[i] = runes[n]
+	}
+	return string(result), nil
+}
+
+// numerals returns the positions in the alphabet of the characters of the
+// input
+func (c *ff3Cipher) numerals(input string) ([]int, error) {
+	runes := []rune(c.alphabet)
+	index := make(map[rune]int, len(runes))
+	for i, r := range runes {
+		index[r] = i
+	}
+
+	var numerals []int
+	for _, r := range input {
+		n, ok := index[r]
+		if !ok {
+			return nil, fmt.Errorf("character %q is not in the alphabet", r)
+		}
+		numerals = append(numerals, n)
+	}
+	return numerals, nil
+}
+
+// encrypt applies the eight Feistel rounds of FF3 to the numerals, with the
+// left and right halves of the tweak
+func (c *ff3Cipher) encrypt(x []int, tL, tR []byte) []int {
+	u := (len(x) + 1) / 2
+	a, b := x[:u], x[u:]
+	for i := 0; i < 8; i++ {
+		m, w := u, tR
+		if i%2 == 1 {
+			m, w = len(x)-u, tL
+		}
+		y := c.round(i, w, b)
+		n := new(big.Int).Add(c.num(a), y)
+		a, b = b, c.str(n.Mod(n, c.modulus(m)), m)
+	}
+	return append(append([]int{}, a...), b...)
+}
+
+// decrypt inverts encrypt
+func (c *ff3Cipher) decrypt(x []int, tL, tR []byte) []int {
+	u := (len(x) + 1) / 2
+	a, b := x[:u], x[u:]
+	for i := 7; i >= 0; i-- {
+		m, w := u, tR
+		if i%2 == 1 {
+			m, w = len(x)-u, tL
+		}
+		y := c.round(i, w, a)
+		n := new(big.Int).Sub(c.num(b), y)
+		b, a = a, c.str(n.Mod(n, c.modulus(m)), m)
+	}
+	return append(append([]int{}, a...), b...)
+}
+
+// round returns the output of the round function for round i, which
+// encrypts the tweak half and the numerals with AES
+func (c *ff3Cipher) round(i int, w []byte, x []int) *big.Int {
+	p := make([]byte, aes.BlockSize)
+	copy(p, w)
+	p[3] ^= byte(i)
+	n := c.num(x).Bytes()
+	copy(p[aes.BlockSize-len(n):], n)
+
+	// The block is encrypted in reverse byte order
+	reverseBytes(p)
+	c.block.Encrypt(p, p)
+	reverseBytes(p)
+	return new(big.Int).SetBytes(p)
+}
+
+// num returns the number the numerals represent, in reverse order
+func (c *ff3Cipher) num(x []int) *big.Int {
+	n := new(big.Int)
+	for i := len(x) - 1; i >= 0; i-- {
+		n.Mul(n, c.radix)
+		n.Add(n, big.NewInt(int64(x[i])))
+	}
+	return n
+}
+
+// str returns the m numerals representing n, in reverse order
+func (c *ff3Cipher) str(n *big.Int, m int) []int {
+	x := make([]int, m)
+	n = new(big.Int).Set(n)
+	digit := new(big.Int)
+	for i := 0; i < m; i++ {
+		n.DivMod(n, c.radix, digit)
+		x[i] = int(digit.Int64())
+	}
+	return x
+}
+
+// modulus returns radix^m
+func (c *ff3Cipher) modulus(m int) *big.Int {
+	return new(big.Int).Exp(c.radix, big.NewInt(int64(m)), nil)
+}
+
+func reverseBytes(b []byte) {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+}
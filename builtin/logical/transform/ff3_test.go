@@ -0,0 +1,93 @@
+package transform
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestFF3_vectors(t *testing.T) {
+	// The FF3 samples of NIST, which have 64-bit tweaks; FF3-1 only differs
+	// in how its 56-bit tweaks are split into the two halves
+	key, _ := hex.DecodeString("EF4359D8D580AA4F7F036D6F04FC6A94")
+	c, err := newFF3Cipher(key, "0123456789")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		tweak      string
+		plaintext  string
+		ciphertext string
+	}{
+		{"D8E7920AFA330A73", "890121234567890000", "750918814058654607"},
+		{"9A768A92F60E12D8", "890121234567890000", "018989839189395384"},
+		{"D8E7920AFA330A73", "89012123456789000000789000000", "48598367162252569629397416226"},
+		{"0000000000000000", "89012123456789000000789000000", "34695224821734535122613701434"},
+	}
+	for _, tc := range cases {
+		tweak, _ := hex.DecodeString(tc.tweak)
+		numerals, err := c.numerals(tc.plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		encrypted := c.encrypt(numerals, tweak[:4], tweak[4:])
+		if s := digits(encrypted); s != tc.ciphertext {
+			t.Fatalf("bad: expected %s, got %s", tc.ciphertext, s)
+		}
+		if s := digits(c.decrypt(encrypted, tweak[:4], tweak[4:])); s != tc.plaintext {
+			t.Fatalf("bad: expected %s, got %s", tc.plaintext, s)
+		}
+	}
+}
+
+func TestFF3_roundTrip(t *testing.T) {
+	key := make([]byte, 32)
+	c, err := newFF3Cipher(key, "abcdefghijklmnopqrstuvwxyz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tweak := []byte{1, 2, 3, 4, 5, 6, 7}
+
+	ciphertext, err := c.Encrypt("thequickbrownfox", tweak)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ciphertext) != len("thequickbrownfox") || ciphertext == "thequickbrownfox" {
+		t.Fatalf("bad: %s", ciphertext)
+	}
+	plaintext, err := c.Decrypt(ciphertext, tweak)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext != "thequickbrownfox" {
+		t.Fatalf("bad: %s", plaintext)
+	}
+
+	// The tweak changes the ciphertext
+	other, err := c.Encrypt("thequickbrownfox", []byte{7, 6, 5, 4, 3, 2, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == ciphertext {
+		t.Fatal("expected a different ciphertext for a different tweak")
+	}
+
+	// Inputs are checked against the alphabet and the length bounds
+	for _, input := range []string{"abc", "UPPERCASEINPUT", string(make([]byte, 100))} {
+		if _, err := c.Encrypt(input, tweak); err == nil {
+			t.Fatalf("expected an error for %q", input)
+		}
+	}
+	if _, err := newFF3Cipher(key, "aab"); err == nil {
+		t.Fatal("expected an error for an alphabet with duplicates")
+	}
+}
+
+func digits(numerals []int) string {
+	s := make([]byte, len(numerals))
+	for i, n := range numerals {
+		s[i] = byte('0' + n)
+	}
+	return string(s)
+}
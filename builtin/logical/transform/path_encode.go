@@ -0,0 +1,378 @@
+package transform
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// tokensPrefix is the storage prefix of the values of tokens, under which
+// they are stored by transformation
+const tokensPrefix = "tokens/"
+
+// tokenEntry is the encrypted value of a token
+type tokenEntry struct {
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+func encodeFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"role_name": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "Name of the role",
+		},
+
+		"value": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "The value to transform",
+		},
+
+		"transformation": &framework.FieldSchema{
+			Type: framework.TypeString,
+			Description: `The transformation to apply. Can be omitted when the
+role has a single transformation.`,
+		},
+
+		"tweak": &framework.FieldSchema{
+			Type: framework.TypeString,
+			Description: `The base64-encoded 7-byte tweak of "fpe"
+transformations whose tweak source is "supplied", or "generated" when
+decoding`,
+		},
+	}
+}
+
+func pathEncode(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "encode/" + framework.GenericNameRegex("role_name"),
+		Fields:  encodeFields(),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathEncodeWrite,
+		},
+
+		HelpSynopsis:    pathEncodeHelpSyn,
+		HelpDescription: pathEncodeHelpDesc,
+	}
+}
+
+func pathDecode(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "decode/" + framework.GenericNameRegex("role_name"),
+		Fields:  encodeFields(),
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathDecodeWrite,
+		},
+
+		HelpSynopsis:    pathDecodeHelpSyn,
+		HelpDescription: pathDecodeHelpDesc,
+	}
+}
+
+// transformationRequest returns the transformation that the encode or decode
+// request is for, after checking that the role can use it
+func (b *backend) transformationRequest(req *logical.Request, d *framework.FieldData) (string, *transformationEntry, error) {
+	roleName := d.Get("role_name").(string)
+	role, err := b.getRole(req.Storage, roleName)
+	if err != nil {
+		return "", nil, err
+	}
+	if role == nil {
+		return "", nil, errutil.UserError{Err: fmt.Sprintf("role %q not found", roleName)}
+	}
+
+	name := d.Get("transformation").(string)
+	if name == "" {
+		if len(role.Transformations) != 1 {
+			return "", nil, errutil.UserError{Err: "missing transformation, which is required when the role has several"}
+		}
+		name = role.Transformations[0]
+	}
+	found := false
+	for _, transformation := range role.Transformations {
+		found = found || transformation == name
+	}
+	if !found {
+		return "", nil, errutil.UserError{Err: fmt.Sprintf("transformation %q is not in the role", name)}
+	}
+
+	t, err := b.getTransformation(req.Storage, name)
+	if err != nil {
+		return "", nil, err
+	}
+	if t == nil {
+		return "", nil, errutil.UserError{Err: fmt.Sprintf("transformation %q not found", name)}
+	}
+	if !t.roleAllowed(roleName) {
+		return "", nil, errutil.UserError{Err: fmt.Sprintf("transformation %q does not allow the role", name)}
+	}
+	return name, t, nil
+}
+
+// tweak returns the tweak for format-preserving encryption with the
+// transformation, generating one if it is generated and encode is set
+func (t *transformationEntry) tweak(d *framework.FieldData, encode bool) ([]byte, bool, error) {
+	if t.TweakSource == tweakSourceInternal {
+		return t.InternalTweak, false, nil
+	}
+	if t.TweakSource == tweakSourceGenerated && encode {
+		tweak := make([]byte, ff3TweakSize)
+		if _, err := rand.Read(tweak); err != nil {
+			return nil, false, err
+		}
+		return tweak, true, nil
+	}
+
+	tweakRaw := d.Get("tweak").(string)
+	if tweakRaw == "" {
+		return nil, false, errutil.UserError{Err: "missing tweak"}
+	}
+	tweak, err := base64.StdEncoding.DecodeString(tweakRaw)
+	if err != nil {
+		return nil, false, errutil.UserError{Err: "failed to base64-decode tweak"}
+	}
+	if len(tweak) != ff3TweakSize {
+		return nil, false, errutil.UserError{Err: fmt.Sprintf("tweak must be %d bytes long", ff3TweakSize)}
+	}
+	return tweak, false, nil
+}
+
+// applyTemplate applies the cipher function to the value through the
+// template of the transformation
+func (b *backend) applyTemplate(s logical.Storage, t *transformationEntry, value string,
+	crypt func(c *ff3Cipher, input string) (string, error)) (string, error) {
+	template, err := b.getTemplate(s, t.Template)
+	if err != nil {
+		return "", err
+	}
+	if template == nil {
+		return "", errutil.InternalError{Err: fmt.Sprintf("template %q not found", t.Template)}
+	}
+
+	var c *ff3Cipher
+	if crypt != nil {
+		c, err = newFF3Cipher(t.Key, template.alphabet())
+		if err != nil {
+			return "", errutil.InternalError{Err: err.Error()}
+		}
+	}
+
+	result, err := template.apply(value, func(input string) (string, error) {
+		if crypt == nil {
+			return strings.Repeat(t.MaskingCharacter, len([]rune(input))), nil
+		}
+		return crypt(c, input)
+	})
+	if err != nil {
+		return "", errutil.UserError{Err: err.Error()}
+	}
+	return result, nil
+}
+
+// tokenPath returns the storage path of the value of the token
+func tokenPath(name string, t *transformationEntry, token string) string {
+	mac := hmac.New(sha256.New, t.HMACKey)
+	mac.Write([]byte(token))
+	return tokensPrefix + name + "/" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// tokenize stores the value and returns its token
+func (b *backend) tokenize(s logical.Storage, name string, t *transformationEntry, value string) (string, error) {
+	tokenBytes := make([]byte, 32)
+	if t.Convergent {
+		mac := hmac.New(sha256.New, t.HMACKey)
+		mac.Write([]byte("value:" + value))
+		tokenBytes = mac.Sum(nil)
+	} else if _, err := rand.Read(tokenBytes); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(tokenBytes)
+
+	gcm, err := tokenCipher(t)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	entry, err := logical.StorageEntryJSON(tokenPath(name, t, token), &tokenEntry{
+		Ciphertext: gcm.Seal(nonce, nonce, []byte(value), []byte(token)),
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := s.Put(entry); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// detokenize returns the value of the token
+func (b *backend) detokenize(s logical.Storage, name string, t *transformationEntry, token string) (string, error) {
+	raw, err := s.Get(tokenPath(name, t, token))
+	if err != nil {
+		return "", err
+	}
+	if raw == nil {
+		return "", errutil.UserError{Err: "token not found"}
+	}
+	var entry tokenEntry
+	if err := raw.DecodeJSON(&entry); err != nil {
+		return "", err
+	}
+
+	gcm, err := tokenCipher(t)
+	if err != nil {
+		return "", err
+	}
+	if len(entry.Ciphertext) < gcm.NonceSize() {
+		return "", errutil.InternalError{Err: "stored token value is too short"}
+	}
+	value, err := gcm.Open(nil, entry.Ciphertext[:gcm.NonceSize()], entry.Ciphertext[gcm.NonceSize():], []byte(token))
+	if err != nil {
+		return "", errutil.InternalError{Err: "failed to decrypt the value of the token"}
+	}
+	return string(value), nil
+}
+
+// tokenCipher returns the AEAD the values of the tokens of the
+// transformation are encrypted with
+func tokenCipher(t *transformationEntry) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(t.Key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (b *backend) pathEncodeWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	value := d.Get("value").(string)
+	if value == "" {
+		return logical.ErrorResponse("missing value"), logical.ErrInvalidRequest
+	}
+	name, t, err := b.transformationRequest(req, d)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{},
+	}
+	var encoded string
+	switch t.Type {
+	case transformationTypeFPE:
+		tweak, generated, err := t.tweak(d, true)
+		if err != nil {
+			return errorResponse(err)
+		}
+		encoded, err = b.applyTemplate(req.Storage, t, value, func(c *ff3Cipher, input string) (string, error) {
+			return c.Encrypt(input, tweak)
+		})
+		if err != nil {
+			return errorResponse(err)
+		}
+		if generated {
+			resp.Data["tweak"] = base64.StdEncoding.EncodeToString(tweak)
+		}
+
+	case transformationTypeMasking:
+		encoded, err = b.applyTemplate(req.Storage, t, value, nil)
+		if err != nil {
+			return errorResponse(err)
+		}
+
+	case transformationTypeTokenization:
+		encoded, err = b.tokenize(req.Storage, name, t, value)
+		if err != nil {
+			return nil, err
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown transformation type %s", t.Type)
+	}
+
+	resp.Data["encoded_value"] = encoded
+	return resp, nil
+}
+
+func (b *backend) pathDecodeWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	value := d.Get("value").(string)
+	if value == "" {
+		return logical.ErrorResponse("missing value"), logical.ErrInvalidRequest
+	}
+	name, t, err := b.transformationRequest(req, d)
+	if err != nil {
+		return errorResponse(err)
+	}
+
+	var decoded string
+	switch t.Type {
+	case transformationTypeFPE:
+		tweak, _, err := t.tweak(d, false)
+		if err != nil {
+			return errorResponse(err)
+		}
+		decoded, err = b.applyTemplate(req.Storage, t, value, func(c *ff3Cipher, input string) (string, error) {
+			return c.Decrypt(input, tweak)
+		})
+		if err != nil {
+			return errorResponse(err)
+		}
+
+	case transformationTypeMasking:
+		return logical.ErrorResponse("masked values cannot be decoded"), logical.ErrInvalidRequest
+
+	case transformationTypeTokenization:
+		decoded, err = b.detokenize(req.Storage, name, t, value)
+		if err != nil {
+			return errorResponse(err)
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown transformation type %s", t.Type)
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"decoded_value": decoded,
+		},
+	}, nil
+}
+
+// errorResponse returns user errors as error responses, and other errors as
+// is
+func errorResponse(err error) (*logical.Response, error) {
+	if _, ok := err.(errutil.UserError); ok {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	return nil, err
+}
+
+const pathEncodeHelpSyn = `Encode a value with a transformation of the role`
+
+const pathEncodeHelpDesc = `
+Applies the transformation to the value, returning it as encoded_value. The
+tweaks generated for "fpe" transformations whose tweak source is "generated"
+are returned as tweak, and must be given to decode the value.
+`
+
+const pathDecodeHelpSyn = `Decode a value with a transformation of the role`
+
+const pathDecodeHelpDesc = `
+Reverses the transformation of an encoded value, returning it as
+decoded_value. Masked values cannot be decoded.
+`
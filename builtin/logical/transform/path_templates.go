@@ -0,0 +1,274 @@
+package transform
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// builtinPrefix is the prefix of the names of the templates and alphabets
+// provided by the backend
+const builtinPrefix = "builtin/"
+
+// builtinAlphabets are the alphabets that templates can refer to by name
+var builtinAlphabets = map[string]string{
+	"builtin/numeric":           "0123456789",
+	"builtin/alphalower":        "abcdefghijklmnopqrstuvwxyz",
+	"builtin/alphaupper":        "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"builtin/alphanumericlower": "0123456789abcdefghijklmnopqrstuvwxyz",
+	"builtin/alphanumericupper": "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"builtin/alphanumeric":      "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz",
+}
+
+// builtinTemplates are the templates that transformations can use without
+// creating them
+var builtinTemplates = map[string]*templateEntry{
+	"builtin/creditcardnumber": &templateEntry{
+		Type:     "regex",
+		Pattern:  `(\d{4})[- ]?(\d{4})[- ]?(\d{4})[- ]?(\d{4})`,
+		Alphabet: "builtin/numeric",
+	},
+	"builtin/socialsecuritynumber": &templateEntry{
+		Type:     "regex",
+		Pattern:  `(\d{3})[- ]?(\d{2})[- ]?(\d{4})`,
+		Alphabet: "builtin/numeric",
+	},
+}
+
+func pathListTemplates(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "template/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathTemplateList,
+		},
+
+		HelpSynopsis:    pathListTemplatesHelpSyn,
+		HelpDescription: pathListTemplatesHelpDesc,
+	}
+}
+
+func pathTemplates(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "template/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the template",
+			},
+
+			"type": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Default:     "regex",
+				Description: `The type of the template. Only "regex" is supported.`,
+			},
+
+			"pattern": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The regular expression that values must match in
+full. The characters matched by its capture groups are transformed, while the
+others are left as is.`,
+			},
+
+			"alphabet": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The characters that can be matched by the capture
+groups, either given as is or as the name of a builtin alphabet`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathTemplateRead,
+			logical.UpdateOperation: b.pathTemplateWrite,
+			logical.DeleteOperation: b.pathTemplateDelete,
+		},
+
+		HelpSynopsis:    pathTemplateHelpSyn,
+		HelpDescription: pathTemplateHelpDesc,
+	}
+}
+
+// templateEntry is a template, stored under "template/" and its name
+type templateEntry struct {
+	Type     string `json:"type"`
+	Pattern  string `json:"pattern"`
+	Alphabet string `json:"alphabet"`
+}
+
+// alphabet returns the characters of the alphabet of the template
+func (t *templateEntry) alphabet() string {
+	if alphabet, ok := builtinAlphabets[t.Alphabet]; ok {
+		return alphabet
+	}
+	return t.Alphabet
+}
+
+// apply matches the value against the template, and replaces the characters
+// matched by the capture groups with the result of transform applied to
+// their concatenation, which must have as many characters
+func (t *templateEntry) apply(value string, transform func(string) (string, error)) (string, error) {
+	re, err := regexp.Compile("^(?:" + t.Pattern + ")$")
+	if err != nil {
+		return "", err
+	}
+	match := re.FindStringSubmatchIndex(value)
+	if match == nil {
+		return "", fmt.Errorf("value does not match the template")
+	}
+
+	// Gather the spans of the groups that matched
+	var spans [][2]int
+	var matched bytes.Buffer
+	end := 0
+	for i := 2; i < len(match); i += 2 {
+		if match[i] < 0 {
+			continue
+		}
+		if match[i] < end {
+			return "", fmt.Errorf("the capture groups of the template overlap")
+		}
+		spans = append(spans, [2]int{match[i], match[i+1]})
+		matched.WriteString(value[match[i]:match[i+1]])
+		end = match[i+1]
+	}
+	if len(spans) == 0 {
+		return "", fmt.Errorf("the template has no capture groups")
+	}
+
+	transformed, err := transform(matched.String())
+	if err != nil {
+		return "", err
+	}
+	replacement := []rune(transformed)
+	if len(replacement) != utf8.RuneCountInString(matched.String()) {
+		return "", fmt.Errorf("transformation did not preserve the length of the value")
+	}
+
+	var result bytes.Buffer
+	end = 0
+	for _, span := range spans {
+		result.WriteString(value[end:span[0]])
+		n := utf8.RuneCountInString(value[span[0]:span[1]])
+		result.WriteString(string(replacement[:n]))
+		replacement = replacement[n:]
+		end = span[1]
+	}
+	result.WriteString(value[end:])
+	return result.String(), nil
+}
+
+// getTemplate returns the builtin or stored template of the name
+func (b *backend) getTemplate(s logical.Storage, name string) (*templateEntry, error) {
+	if strings.HasPrefix(name, builtinPrefix) {
+		return builtinTemplates[name], nil
+	}
+
+	entry, err := s.Get("template/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result templateEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (b *backend) pathTemplateList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List("template/")
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathTemplateRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	template, err := b.getTemplate(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if template == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"type":     template.Type,
+			"pattern":  template.Pattern,
+			"alphabet": template.Alphabet,
+		},
+	}, nil
+}
+
+func (b *backend) pathTemplateWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	template := &templateEntry{
+		Type:     d.Get("type").(string),
+		Pattern:  d.Get("pattern").(string),
+		Alphabet: d.Get("alphabet").(string),
+	}
+
+	if template.Type != "regex" {
+		return logical.ErrorResponse(fmt.Sprintf("unsupported template type %s", template.Type)), nil
+	}
+	if template.Pattern == "" {
+		return logical.ErrorResponse("missing pattern"), nil
+	}
+	re, err := regexp.Compile(template.Pattern)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid pattern: %v", err)), nil
+	}
+	if re.NumSubexp() == 0 {
+		return logical.ErrorResponse("pattern must have at least one capture group"), nil
+	}
+	if strings.HasPrefix(template.Alphabet, builtinPrefix) && builtinAlphabets[template.Alphabet] == "" {
+		return logical.ErrorResponse(fmt.Sprintf("unknown builtin alphabet %s", template.Alphabet)), nil
+	}
+	if _, err := newFF3Cipher(make([]byte, 32), template.alphabet()); err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid alphabet: %v", err)), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("template/"+name, template)
+	if err != nil {
+		return nil, err
+	}
+	return nil, req.Storage.Put(entry)
+}
+
+func (b *backend) pathTemplateDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	return nil, req.Storage.Delete("template/" + d.Get("name").(string))
+}
+
+const pathListTemplatesHelpSyn = `List the existing templates in this backend`
+
+const pathListTemplatesHelpDesc = `
+Templates will be listed by name. The builtin templates,
+"builtin/creditcardnumber" and "builtin/socialsecuritynumber", are not
+listed.
+`
+
+const pathTemplateHelpSyn = `Manage the templates that values are matched against`
+
+const pathTemplateHelpDesc = `
+A template describes the format of the values a transformation applies to,
+with a regular expression that values must match in full. The characters
+matched by its capture groups are transformed, and must be part of the
+alphabet of the template. The alphabet is either given as is, or as the name
+of a builtin alphabet: "builtin/numeric", "builtin/alphalower",
+"builtin/alphaupper", "builtin/alphanumericlower", "builtin/alphanumericupper"
+or "builtin/alphanumeric".
+`
@@ -0,0 +1,301 @@
+package transform
+
+import (
+	"crypto/rand"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	transformationTypeFPE          = "fpe"
+	transformationTypeMasking      = "masking"
+	transformationTypeTokenization = "tokenization"
+
+	// The sources of the tweaks of format-preserving encryption: given by
+	// the client, generated when encoding and returned to the client, or
+	// held by the transformation
+	tweakSourceSupplied  = "supplied"
+	tweakSourceGenerated = "generated"
+	tweakSourceInternal  = "internal"
+)
+
+func pathListTransformations(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "transformation/?$",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ListOperation: b.pathTransformationList,
+		},
+
+		HelpSynopsis:    pathListTransformationsHelpSyn,
+		HelpDescription: pathListTransformationsHelpDesc,
+	}
+}
+
+func pathTransformations(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern: "transformation/" + framework.GenericNameRegex("name"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the transformation",
+			},
+
+			"type": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The type of the transformation, "fpe", "masking"
+or "tokenization". Cannot be changed once set.`,
+			},
+
+			"template": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The template of the values of "fpe" and "masking"
+transformations`,
+			},
+
+			"tweak_source": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: tweakSourceSupplied,
+				Description: `The source of the tweaks of "fpe" transformations,
+"supplied", "generated" or "internal". Defaults to "supplied".`,
+			},
+
+			"masking_character": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "*",
+				Description: `The character that "masking" transformations
+replace characters with. Defaults to "*".`,
+			},
+
+			"convergent": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Whether "tokenization" transformations return the
+same token for the same value`,
+			},
+
+			"allowed_roles": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `Comma-separated list of the roles allowed to use
+the transformation, or "*" for every role`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathTransformationRead,
+			logical.UpdateOperation: b.pathTransformationWrite,
+			logical.DeleteOperation: b.pathTransformationDelete,
+		},
+
+		HelpSynopsis:    pathTransformationHelpSyn,
+		HelpDescription: pathTransformationHelpDesc,
+	}
+}
+
+// transformationEntry is a transformation, stored under "transformation/"
+// and its name
+type transformationEntry struct {
+	Type             string   `json:"type"`
+	Template         string   `json:"template"`
+	TweakSource      string   `json:"tweak_source"`
+	MaskingCharacter string   `json:"masking_character"`
+	Convergent       bool     `json:"convergent"`
+	AllowedRoles     []string `json:"allowed_roles"`
+
+	// Key is the AES-256 key of format-preserving encryption, and of the
+	// encryption of the values of tokens
+	Key []byte `json:"key"`
+
+	// HMACKey derives the tokens of convergent tokenization and the storage
+	// paths of tokens
+	HMACKey []byte `json:"hmac_key"`
+
+	// InternalTweak is the tweak of the "internal" tweak source
+	InternalTweak []byte `json:"internal_tweak"`
+}
+
+// roleAllowed returns whether the role can use the transformation
+func (t *transformationEntry) roleAllowed(role string) bool {
+	return strutil.StrListContains(t.AllowedRoles, "*") ||
+		strutil.StrListContains(t.AllowedRoles, role)
+}
+
+func (b *backend) getTransformation(s logical.Storage, name string) (*transformationEntry, error) {
+	entry, err := s.Get("transformation/" + name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var result transformationEntry
+	if err := entry.DecodeJSON(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (b *backend) pathTransformationList(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entries, err := req.Storage.List("transformation/")
+	if err != nil {
+		return nil, err
+	}
+
+	return logical.ListResponse(entries), nil
+}
+
+func (b *backend) pathTransformationRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	t, err := b.getTransformation(req.Storage, d.Get("name").(string))
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, nil
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"type":          t.Type,
+			"allowed_roles": t.AllowedRoles,
+		},
+	}
+	switch t.Type {
+	case transformationTypeFPE:
+		resp.Data["template"] = t.Template
+		resp.Data["tweak_source"] = t.TweakSource
+	case transformationTypeMasking:
+		resp.Data["template"] = t.Template
+		resp.Data["masking_character"] = t.MaskingCharacter
+	case transformationTypeTokenization:
+		resp.Data["convergent"] = t.Convergent
+	}
+	return resp, nil
+}
+
+func (b *backend) pathTransformationWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	t, err := b.getTransformation(req.Storage, name)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		t = &transformationEntry{
+			Key:           make([]byte, 32),
+			HMACKey:       make([]byte, 32),
+			InternalTweak: make([]byte, ff3TweakSize),
+		}
+		for _, key := range [][]byte{t.Key, t.HMACKey, t.InternalTweak} {
+			if _, err := rand.Read(key); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// The type, and whether tokens are convergent, cannot change once the
+	// transformation has encoded values
+	transformationType := d.Get("type").(string)
+	if t.Type != "" && transformationType != "" && transformationType != t.Type {
+		return logical.ErrorResponse("the type of a transformation cannot be changed"), nil
+	}
+	if t.Type == "" {
+		t.Type = transformationType
+		t.Convergent = d.Get("convergent").(bool)
+	}
+	if templateRaw, ok := d.GetOk("template"); ok {
+		t.Template = templateRaw.(string)
+	}
+	if _, ok := d.GetOk("tweak_source"); ok || t.TweakSource == "" {
+		t.TweakSource = d.Get("tweak_source").(string)
+	}
+	if _, ok := d.GetOk("masking_character"); ok || t.MaskingCharacter == "" {
+		t.MaskingCharacter = d.Get("masking_character").(string)
+	}
+	if allowedRolesRaw, ok := d.GetOk("allowed_roles"); ok {
+		t.AllowedRoles = strutil.ParseDedupAndSortStrings(allowedRolesRaw.(string), ",")
+	}
+
+	switch t.Type {
+	case transformationTypeFPE, transformationTypeMasking:
+		template, err := b.getTemplate(req.Storage, t.Template)
+		if err != nil {
+			return nil, err
+		}
+		if template == nil {
+			return logical.ErrorResponse(fmt.Sprintf("template %q not found", t.Template)), nil
+		}
+		if t.Type == transformationTypeMasking && utf8.RuneCountInString(t.MaskingCharacter) != 1 {
+			return logical.ErrorResponse("masking_character must be a single character"), nil
+		}
+		if t.Type == transformationTypeFPE {
+			switch t.TweakSource {
+			case tweakSourceSupplied, tweakSourceGenerated, tweakSourceInternal:
+			default:
+				return logical.ErrorResponse(fmt.Sprintf("unknown tweak source %s", t.TweakSource)), nil
+			}
+		}
+	case transformationTypeTokenization:
+	case "":
+		return logical.ErrorResponse("missing type"), nil
+	default:
+		return logical.ErrorResponse(fmt.Sprintf("unknown transformation type %s", t.Type)), nil
+	}
+
+	entry, err := logical.StorageEntryJSON("transformation/"+name, t)
+	if err != nil {
+		return nil, err
+	}
+	return nil, req.Storage.Put(entry)
+}
+
+func (b *backend) pathTransformationDelete(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	// The tokens of the transformation can no longer be decoded
+	tokens, err := req.Storage.List(tokensPrefix + name + "/")
+	if err != nil {
+		return nil, err
+	}
+	for _, token := range tokens {
+		if err := req.Storage.Delete(tokensPrefix + name + "/" + token); err != nil {
+			return nil, err
+		}
+	}
+
+	return nil, req.Storage.Delete("transformation/" + name)
+}
+
+const pathListTransformationsHelpSyn = `List the existing transformations in this backend`
+
+const pathListTransformationsHelpDesc = `Transformations will be listed by name.`
+
+const pathTransformationHelpSyn = `Manage the transformations applied to values`
+
+const pathTransformationHelpDesc = `
+A transformation transforms values through the encode and decode paths of the
+roles it allows. Its type is one of:
+
+  * "fpe", which encrypts the characters matched by the capture groups of the
+    template with FF3-1 format-preserving encryption. The ciphertext has the
+    same format as the plaintext. Tweaks of 7 bytes are supplied by the
+    client, generated when encoding and returned, or held internally.
+
+  * "masking", which replaces the characters matched by the capture groups of
+    the template with the masking character. Masked values cannot be decoded.
+
+  * "tokenization", which replaces values with tokens, storing the encrypted
+    values. Convergent tokenization returns the same token for the same
+    value.
+
+The keys of a transformation are generated when it is created, and deleting
+it deletes its tokens, so that the values it encoded can no longer be
+decoded.
+`
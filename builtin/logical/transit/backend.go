@@ -1,6 +1,13 @@
 package transit
 
 import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 )
@@ -23,14 +30,23 @@ func Backend(conf *logical.BackendConfig) *backend {
 			// as the handler is greedy
 			b.pathConfig(),
 			b.pathRotate(),
+			b.pathTrim(),
 			b.pathRewrap(),
+			b.pathImport(),
 			b.pathKeys(),
 			b.pathEncrypt(),
 			b.pathDecrypt(),
 			b.pathDatakey(),
+			b.pathSign(),
+			b.pathVerify(),
+			b.pathHMAC(),
+			b.pathWrappingKey(),
+			b.pathExport(),
 		},
 
 		Secrets: []*framework.Secret{},
+
+		PeriodicFunc: b.periodicFunc,
 	}
 
 	b.lm = newLockManager(conf.System.CachingDisabled())
@@ -41,4 +57,46 @@ func Backend(conf *logical.BackendConfig) *backend {
 type backend struct {
 	*framework.Backend
 	lm *lockManager
+
+	// wrappingKeyLock guards the generation of the wrapping key
+	wrappingKeyLock sync.Mutex
+}
+
+// periodicFunc of the backend is invoked once a minute by the
+// RollbackManager. It rotates the keys whose automatic rotation period has
+// passed, so keys may be rotated up to a minute late.
+func (b *backend) periodicFunc(req *logical.Request) error {
+	names, err := req.Storage.List("policy/")
+	if err != nil {
+		return err
+	}
+
+	var result error
+	now := time.Now()
+	for _, name := range names {
+		if err := b.autoRotateKey(req.Storage, name, now); err != nil {
+			result = multierror.Append(result, errwrap.Wrapf(fmt.Sprintf("failed to rotate key %s: {{err}}", name), err))
+		}
+	}
+	return result
+}
+
+// autoRotateKey rotates the named key if its automatic rotation period has
+// passed
+func (b *backend) autoRotateKey(storage logical.Storage, name string, now time.Time) error {
+	p, lock, err := b.lm.GetPolicyExclusive(storage, name)
+	if lock != nil {
+		defer lock.Unlock()
+	}
+	if err != nil {
+		return err
+	}
+	if p == nil || !p.needsAutoRotation(now) {
+		return nil
+	}
+	if err := p.autoRotate(storage); err != nil {
+		return err
+	}
+	metrics.IncrCounter([]string{"transit", "auto_rotate"}, 1)
+	return nil
 }
@@ -1,6 +1,8 @@
 package transit
 
 import (
+	"crypto"
+	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
 	"math/rand"
@@ -592,6 +594,18 @@ func TestConvergentEncryption(t *testing.T) {
 		t.Fatalf("bad: got resp %#v", *resp)
 	}
 
+	// Keys created before the nonce was derived take it from requests
+	p, lock, err := b.lm.GetPolicyExclusive(storage, "testkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.ConvergentVersion = 1
+	err = p.Persist(storage)
+	lock.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+
 	// First, test using an invalid length of nonce
 	req.Path = "encrypt/testkey"
 	req.Data = map[string]interface{}{
@@ -858,3 +872,641 @@ func testPolicyFuzzingCommon(t *testing.T, be *backend) {
 	// Wait for them all to finish
 	wg.Wait()
 }
+
+func TestSignVerify(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend(&logical.BackendConfig{
+		StorageView: storage,
+		System:      logical.TestSystemView(),
+	})
+
+	request := func(path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(&logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+		})
+		if err != nil && err != logical.ErrInvalidRequest {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	input := base64.StdEncoding.EncodeToString([]byte(testPlaintext))
+	digest := sha256.Sum256([]byte(testPlaintext))
+	prehashed := base64.StdEncoding.EncodeToString(digest[:])
+
+	sign := func(name, path string, data map[string]interface{}) string {
+		resp := request("sign/"+name+path, data)
+		if resp == nil || resp.IsError() {
+			t.Fatalf("bad: %s: %#v", name, resp)
+		}
+		return resp.Data["signature"].(string)
+	}
+	verify := func(name, path, signature string, data map[string]interface{}) bool {
+		data["signature"] = signature
+		resp := request("verify/"+name+path, data)
+		if resp == nil || resp.IsError() {
+			t.Fatalf("bad: %s: %#v", name, resp)
+		}
+		return resp.Data["valid"].(bool)
+	}
+
+	type signCase struct {
+		path string
+		data map[string]interface{}
+	}
+	for _, keyType := range []string{keyTypeECDSAP256, keyTypeEd25519, keyTypeRSA2048} {
+		if resp := request("keys/"+keyType, map[string]interface{}{"type": keyType}); resp != nil {
+			t.Fatalf("bad: %#v", resp)
+		}
+
+		cases := []signCase{
+			{"", map[string]interface{}{}},
+			{"/sha2-512", map[string]interface{}{}},
+		}
+		switch keyType {
+		case keyTypeECDSAP256:
+			cases = append(cases,
+				signCase{"", map[string]interface{}{"marshaling_algorithm": "jws"}},
+				signCase{"", map[string]interface{}{"prehashed": true}})
+		case keyTypeRSA2048:
+			cases = append(cases,
+				signCase{"", map[string]interface{}{"signature_algorithm": "pkcs1v15"}},
+				signCase{"", map[string]interface{}{"prehashed": true}})
+		}
+
+		for _, tc := range cases {
+			signData := map[string]interface{}{"input": input}
+			verifyData := map[string]interface{}{"input": input}
+			for k, v := range tc.data {
+				signData[k] = v
+				verifyData[k] = v
+			}
+			if tc.data["prehashed"] == true {
+				signData["input"] = prehashed
+				verifyData["input"] = prehashed
+			}
+
+			signature := sign(keyType, tc.path, signData)
+			if !strings.HasPrefix(signature, "vault:v1:") {
+				t.Fatalf("bad: %s", signature)
+			}
+			if !verify(keyType, tc.path, signature, verifyData) {
+				t.Fatalf("bad: %s %#v: signature did not verify", keyType, tc)
+			}
+			verifyData["input"] = base64.StdEncoding.EncodeToString([]byte("tampered"))
+			if tc.data["prehashed"] == true {
+				tampered := sha256.Sum256([]byte("tampered"))
+				verifyData["input"] = base64.StdEncoding.EncodeToString(tampered[:])
+			}
+			if verify(keyType, tc.path, signature, verifyData) {
+				t.Fatalf("bad: %s %#v: tampered input verified", keyType, tc)
+			}
+		}
+
+		// Signing keys cannot encrypt
+		if resp := request("encrypt/"+keyType, map[string]interface{}{"plaintext": input}); resp == nil || !resp.IsError() {
+			t.Fatalf("bad: %#v", resp)
+		}
+
+		// Previous versions can be pinned until the minimum version excludes
+		// them
+		if resp := request("keys/"+keyType+"/rotate", nil); resp != nil {
+			t.Fatalf("bad: %#v", resp)
+		}
+		signature := sign(keyType, "", map[string]interface{}{"input": input, "key_version": 1})
+		if !strings.HasPrefix(signature, "vault:v1:") {
+			t.Fatalf("bad: %s", signature)
+		}
+		if signature := sign(keyType, "", map[string]interface{}{"input": input}); !strings.HasPrefix(signature, "vault:v2:") {
+			t.Fatalf("bad: %s", signature)
+		}
+		if !verify(keyType, "", signature, map[string]interface{}{"input": input}) {
+			t.Fatalf("bad: %s: signature of version 1 did not verify", keyType)
+		}
+		request("keys/"+keyType+"/config", map[string]interface{}{"min_decryption_version": 2})
+		resp := request("verify/"+keyType, map[string]interface{}{"input": input, "signature": signature})
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("bad: %#v", resp)
+		}
+		resp = request("sign/"+keyType, map[string]interface{}{"input": input, "key_version": 1})
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("bad: %#v", resp)
+		}
+	}
+
+	// Ed25519 keys sign the input itself
+	resp := request("sign/"+keyTypeEd25519, map[string]interface{}{"input": prehashed, "prehashed": true})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// Encryption keys cannot sign
+	request("keys/aes", nil)
+	if resp := request("sign/aes", map[string]interface{}{"input": input}); resp == nil || !resp.IsError() {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// Reading a signing key returns its public keys
+	resp, err := b.HandleRequest(&logical.Request{
+		Storage:   storage,
+		Operation: logical.ReadOperation,
+		Path:      "keys/" + keyTypeECDSAP256,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := resp.Data["keys"].(map[string]map[string]interface{})
+	if resp.Data["type"] != keyTypeECDSAP256 || !strings.HasPrefix(keys["2"]["public_key"].(string), "-----BEGIN PUBLIC KEY-----") {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
+
+func TestConvergentEncryption_derivedNonce(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend(&logical.BackendConfig{
+		StorageView: storage,
+		System:      logical.TestSystemView(),
+	})
+
+	request := func(path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(&logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+		})
+		if err != nil && err != logical.ErrInvalidRequest {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	encrypt := func(plaintext, context string) string {
+		resp := request("encrypt/testkey", map[string]interface{}{
+			"plaintext": plaintext,
+			"context":   context,
+		})
+		if resp == nil || resp.IsError() {
+			t.Fatalf("bad: %#v", resp)
+		}
+		return resp.Data["ciphertext"].(string)
+	}
+
+	request("keys/testkey", map[string]interface{}{
+		"derived":               true,
+		"convergent_encryption": true,
+	})
+
+	context1 := "pWZ6t/im3AORd0lVYE0zBdKpX6Bl3/SvFtoVTPWbdkzjG788XmMAnOlxandSdd7S"
+	context2 := "qV4h9iQyvn+raODOer4JNAsOhkXBwdT4HZ677Ql4KLqXSU+Jk4C/fXBWbv6xkSYT"
+	ciphertext1 := encrypt("emlwIHphcA==", context1) // "zip zap"
+	if ciphertext := encrypt("emlwIHphcA==", context1); ciphertext != ciphertext1 {
+		t.Fatalf("expected the same ciphertext but got %s and %s", ciphertext1, ciphertext)
+	}
+	if encrypt("emlwIHphcA==", context2) == ciphertext1 {
+		t.Fatal("expected different ciphertexts for different contexts")
+	}
+	if encrypt("Zm9vIGJhcg==", context1) == ciphertext1 { // "foo bar"
+		t.Fatal("expected different ciphertexts for different plaintexts")
+	}
+
+	// The nonce is stored in the ciphertext, so none is needed to decrypt
+	resp := request("decrypt/testkey", map[string]interface{}{
+		"ciphertext": ciphertext1,
+		"context":    context1,
+	})
+	if resp == nil || resp.IsError() || resp.Data["plaintext"] != "emlwIHphcA==" {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// Giving a nonce is an error, since it would not be used
+	resp = request("encrypt/testkey", map[string]interface{}{
+		"plaintext": "emlwIHphcA==",
+		"context":   context1,
+		"nonce":     "b25ldHdvdGhyZWVl",
+	})
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error response, got %#v", resp)
+	}
+
+	resp, err := b.HandleRequest(&logical.Request{
+		Storage:   storage,
+		Operation: logical.ReadOperation,
+		Path:      "keys/testkey",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data["convergent_encryption_version"] != convergentVersion {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend(&logical.BackendConfig{
+		StorageView: storage,
+		System:      logical.TestSystemView(),
+	})
+
+	request := func(path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(&logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+		})
+		if err != nil && err != logical.ErrInvalidRequest {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	batchResults := func(path string, items ...map[string]interface{}) []map[string]interface{} {
+		batchInput := make([]interface{}, len(items))
+		for i, item := range items {
+			batchInput[i] = item
+		}
+		resp := request(path, map[string]interface{}{"batch_input": batchInput})
+		if resp == nil || resp.IsError() {
+			t.Fatalf("bad: %s: %#v", path, resp.Data)
+		}
+		return resp.Data["batch_results"].([]map[string]interface{})
+	}
+
+	request("keys/test", nil)
+	plaintext1 := base64.StdEncoding.EncodeToString([]byte("one"))
+	plaintext2 := base64.StdEncoding.EncodeToString([]byte("two"))
+
+	// Items that fail report their error without failing the others
+	results := batchResults("encrypt/test",
+		map[string]interface{}{"plaintext": plaintext1},
+		map[string]interface{}{"plaintext": ""},
+		map[string]interface{}{"plaintext": plaintext2},
+	)
+	if len(results) != 3 || results[0]["ciphertext"] == nil || results[1]["error"] == nil || results[2]["ciphertext"] == nil {
+		t.Fatalf("bad: %#v", results)
+	}
+
+	results = batchResults("decrypt/test",
+		map[string]interface{}{"ciphertext": results[0]["ciphertext"]},
+		map[string]interface{}{"ciphertext": "vault:v1:garbage"},
+		map[string]interface{}{"ciphertext": results[2]["ciphertext"]},
+	)
+	if results[0]["plaintext"] != plaintext1 || results[1]["error"] == nil || results[2]["plaintext"] != plaintext2 {
+		t.Fatalf("bad: %#v", results)
+	}
+
+	// Rewrapping moves each item to the latest version
+	ciphertext := request("encrypt/test", map[string]interface{}{"plaintext": plaintext1}).Data["ciphertext"]
+	request("keys/test/rotate", nil)
+	results = batchResults("rewrap/test",
+		map[string]interface{}{"ciphertext": ciphertext},
+		map[string]interface{}{"ciphertext": ciphertext},
+	)
+	for _, result := range results {
+		if !strings.HasPrefix(result["ciphertext"].(string), "vault:v2:") {
+			t.Fatalf("bad: %#v", results)
+		}
+	}
+
+	// HMACs are deterministic for a version and algorithm
+	results = batchResults("hmac/test",
+		map[string]interface{}{"input": plaintext1},
+		map[string]interface{}{"input": plaintext2},
+		map[string]interface{}{"input": "not base64"},
+	)
+	hmac := request("hmac/test", map[string]interface{}{"input": plaintext1}).Data["hmac"]
+	if results[0]["hmac"] != hmac || results[1]["hmac"] == hmac || results[2]["error"] == nil {
+		t.Fatalf("bad: %#v", results)
+	}
+	if !strings.HasPrefix(hmac.(string), "vault:v2:") {
+		t.Fatalf("bad: %s", hmac)
+	}
+	if other := request("hmac/test/sha2-512", map[string]interface{}{"input": plaintext1}).Data["hmac"]; other == hmac {
+		t.Fatal("expected different HMACs for different algorithms")
+	}
+	if other := request("hmac/test", map[string]interface{}{"input": plaintext1, "key_version": 1}).Data["hmac"]; other == hmac || !strings.HasPrefix(other.(string), "vault:v1:") {
+		t.Fatalf("bad: %#v", other)
+	}
+
+	// A malformed or empty batch fails the request
+	for _, batchInput := range []interface{}{"foo", []interface{}{}} {
+		resp := request("encrypt/test", map[string]interface{}{"batch_input": batchInput})
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("bad: %#v", resp)
+		}
+	}
+}
+
+func TestImportExport(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend(&logical.BackendConfig{
+		StorageView: storage,
+		System:      logical.TestSystemView(),
+	})
+
+	request := func(op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(&logical.Request{
+			Storage:   storage,
+			Operation: op,
+			Path:      path,
+			Data:      data,
+		})
+		if err != nil && err != logical.ErrInvalidRequest {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	success := func(op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		resp := request(op, path, data)
+		if resp != nil && resp.IsError() {
+			t.Fatalf("bad: %s: %#v", path, resp.Data)
+		}
+		return resp
+	}
+	failure := func(op logical.Operation, path string, data map[string]interface{}) {
+		resp := request(op, path, data)
+		if resp == nil || !resp.IsError() {
+			t.Fatalf("expected an error: %s: %#v", path, resp)
+		}
+	}
+
+	wrappingKey := success(logical.ReadOperation, "wrapping_key", nil).Data["public_key"]
+	if other := success(logical.ReadOperation, "wrapping_key", nil).Data["public_key"]; other != wrappingKey {
+		t.Fatal("expected the wrapping key to be stable")
+	}
+	input := base64.StdEncoding.EncodeToString([]byte(testPlaintext))
+
+	for _, keyType := range []string{keyTypeAESGCM, keyTypeECDSAP256, keyTypeEd25519, keyTypeRSA2048} {
+		src, dst := "src-"+keyType, "dst-"+keyType
+		exportType := exportTypeSigningKey
+		if keyType == keyTypeAESGCM {
+			exportType = exportTypeEncryptionKey
+		}
+
+		// Keys can only be exported once exportable
+		success(logical.UpdateOperation, "keys/"+src, map[string]interface{}{"type": keyType})
+		failure(logical.ReadOperation, "export/"+exportType+"/"+src, nil)
+		success(logical.UpdateOperation, "keys/"+src+"/config", map[string]interface{}{"exportable": true})
+		failure(logical.UpdateOperation, "keys/"+src+"/config", map[string]interface{}{"exportable": false})
+
+		exported := success(logical.ReadOperation, "export/"+exportType+"/"+src+"/latest", nil).Data["keys"].(map[string]string)
+		if len(exported) != 1 || exported["1"] == "" {
+			t.Fatalf("bad: %#v", exported)
+		}
+
+		// Move the key to another name through the wrapping key
+		wrapped := success(logical.UpdateOperation, "export/"+exportType+"/"+src+"/1", map[string]interface{}{
+			"public_key": wrappingKey,
+		}).Data["keys"].(map[string]string)
+		success(logical.UpdateOperation, "keys/"+dst+"/import", map[string]interface{}{
+			"ciphertext": wrapped["1"],
+			"type":       keyType,
+		})
+		failure(logical.UpdateOperation, "keys/"+dst+"/import", map[string]interface{}{
+			"ciphertext": wrapped["1"],
+			"type":       keyType,
+		})
+		read := success(logical.ReadOperation, "keys/"+dst, nil)
+		if read.Data["imported"] != true || read.Data["exportable"] != false {
+			t.Fatalf("bad: %#v", read.Data)
+		}
+
+		if keyType == keyTypeAESGCM {
+			ciphertext := success(logical.UpdateOperation, "encrypt/"+src, map[string]interface{}{"plaintext": input}).Data["ciphertext"]
+			plaintext := success(logical.UpdateOperation, "decrypt/"+dst, map[string]interface{}{"ciphertext": ciphertext}).Data["plaintext"]
+			if plaintext != input {
+				t.Fatalf("bad: %#v", plaintext)
+			}
+		} else {
+			signature := success(logical.UpdateOperation, "sign/"+src, map[string]interface{}{"input": input}).Data["signature"]
+			valid := success(logical.UpdateOperation, "verify/"+dst, map[string]interface{}{"input": input, "signature": signature}).Data["valid"]
+			if valid != true {
+				t.Fatalf("bad: %#v", valid)
+			}
+		}
+
+		// HMAC keys are not imported with the key material
+		hmac := func(name string) interface{} {
+			return success(logical.UpdateOperation, "hmac/"+name, map[string]interface{}{"input": input}).Data["hmac"]
+		}
+		if hmac(src) == hmac(dst) {
+			t.Fatal("expected different HMAC keys")
+		}
+	}
+
+	// Imported keys are rotated only when allowed
+	failure(logical.UpdateOperation, "keys/dst-aes-gcm/rotate", nil)
+
+	material := make([]byte, 32)
+	wrappingPub, err := parseRSAPublicKeyPEM(wrappingKey.(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped, err := wrapKeyMaterial(wrappingPub, crypto.SHA1, material)
+	if err != nil {
+		t.Fatal(err)
+	}
+	success(logical.UpdateOperation, "keys/rotatable/import", map[string]interface{}{
+		"ciphertext":     base64.StdEncoding.EncodeToString(wrapped),
+		"hash_function":  "SHA1",
+		"allow_rotation": true,
+		"exportable":     true,
+	})
+	success(logical.UpdateOperation, "keys/rotatable/rotate", nil)
+	exported := success(logical.ReadOperation, "export/encryption-key/rotatable", nil).Data["keys"].(map[string]string)
+	if exported["1"] != base64.StdEncoding.EncodeToString(material) || exported["2"] == "" || exported["2"] == exported["1"] {
+		t.Fatalf("bad: %#v", exported)
+	}
+	if len(success(logical.ReadOperation, "export/hmac-key/rotatable/2", nil).Data["keys"].(map[string]string)["2"]) == 0 {
+		t.Fatal("expected an HMAC key")
+	}
+
+	// Material that does not match the type is rejected
+	failure(logical.UpdateOperation, "keys/mismatch/import", map[string]interface{}{
+		"ciphertext":    base64.StdEncoding.EncodeToString(wrapped),
+		"hash_function": "SHA1",
+		"type":          keyTypeEd25519,
+	})
+	failure(logical.UpdateOperation, "keys/mismatch/import", map[string]interface{}{
+		"ciphertext": base64.StdEncoding.EncodeToString(wrapped),
+	})
+	failure(logical.ReadOperation, "export/signing-key/rotatable", nil)
+}
+
+func TestAutoRotation(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend(&logical.BackendConfig{
+		StorageView: storage,
+		System:      logical.TestSystemView(),
+	})
+
+	request := func(op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(&logical.Request{
+			Storage:   storage,
+			Operation: op,
+			Path:      path,
+			Data:      data,
+		})
+		if err != nil && err != logical.ErrInvalidRequest {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	// backdate makes the latest version of the key look older by the duration
+	backdate := func(name string, d time.Duration) {
+		p, lock, err := b.lm.GetPolicyExclusive(storage, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer lock.Unlock()
+		entry := p.Keys[p.LatestVersion]
+		entry.CreationTime -= int64(d.Seconds())
+		p.Keys[p.LatestVersion] = entry
+		if err := p.Persist(storage); err != nil {
+			t.Fatal(err)
+		}
+	}
+	periodic := func() {
+		if err := b.periodicFunc(&logical.Request{Storage: storage}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	versions := func(name string) (int, int) {
+		resp := request(logical.ReadOperation, "keys/"+name, nil)
+		return resp.Data["latest_version"].(int), resp.Data["min_decryption_version"].(int)
+	}
+
+	request(logical.UpdateOperation, "keys/rotating", nil)
+	request(logical.UpdateOperation, "keys/static", nil)
+	if resp := request(logical.UpdateOperation, "keys/rotating/config", map[string]interface{}{"auto_rotate_period": 60}); resp == nil || !resp.IsError() {
+		t.Fatalf("expected an error for a period under an hour: %#v", resp)
+	}
+	if resp := request(logical.UpdateOperation, "keys/rotating/config", map[string]interface{}{
+		"auto_rotate_period":        "2h",
+		"auto_rotate_keep_versions": 2,
+	}); resp != nil && resp.IsError() {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if resp := request(logical.ReadOperation, "keys/rotating", nil); resp.Data["auto_rotate_period"] != int64(7200) || resp.Data["auto_rotate_keep_versions"] != 2 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Keys are only rotated once the period has passed
+	backdate("rotating", time.Hour)
+	backdate("static", 3*time.Hour)
+	periodic()
+	if latest, _ := versions("rotating"); latest != 1 {
+		t.Fatalf("bad: %d", latest)
+	}
+
+	for i := 2; i <= 4; i++ {
+		backdate("rotating", 2*time.Hour)
+		periodic()
+		latest, min := versions("rotating")
+		if latest != i {
+			t.Fatalf("bad: %d", latest)
+		}
+		// Only the last two versions remain decryptable
+		if expected := i - 1; min != expected {
+			t.Fatalf("bad: expected %d, got %d", expected, min)
+		}
+	}
+	if latest, min := versions("static"); latest != 1 || min != 1 {
+		t.Fatalf("bad: %d %d", latest, min)
+	}
+}
+
+func TestTrim(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	b := Backend(&logical.BackendConfig{
+		StorageView: storage,
+		System:      logical.TestSystemView(),
+	})
+
+	request := func(path string, data map[string]interface{}) *logical.Response {
+		resp, err := b.HandleRequest(&logical.Request{
+			Storage:   storage,
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			Data:      data,
+		})
+		if err != nil && err != logical.ErrInvalidRequest {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	isError := func(resp *logical.Response) bool {
+		return resp != nil && resp.IsError()
+	}
+
+	// Make five versions, with a ciphertext of each
+	request("keys/test", nil)
+	plaintext := base64.StdEncoding.EncodeToString([]byte(testPlaintext))
+	ciphertexts := map[int]interface{}{}
+	for i := 1; i <= 5; i++ {
+		if i > 1 {
+			request("keys/test/rotate", nil)
+		}
+		ciphertexts[i] = request("encrypt/test", map[string]interface{}{"plaintext": plaintext}).Data["ciphertext"]
+	}
+
+	// Only versions below the minimum decryption version can be trimmed
+	if !isError(request("keys/test/trim", map[string]interface{}{"min_available_version": 3})) {
+		t.Fatal("expected an error trimming decryptable versions")
+	}
+	if isError(request("keys/test/config", map[string]interface{}{"min_decryption_version": 4})) {
+		t.Fatal("failed to set the min decryption version")
+	}
+	if isError(request("keys/test/trim", map[string]interface{}{"min_available_version": 3})) {
+		t.Fatal("failed to trim")
+	}
+
+	p, lock, err := b.lm.GetPolicyShared(storage, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := p.loadArchive(storage)
+	lock.RUnlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 5; i++ {
+		if trimmed := archive.Keys[i].Key == nil; trimmed != (i < 3) {
+			t.Fatalf("bad: version %d trimmed: %v", i, trimmed)
+		}
+	}
+
+	// Trimmed versions cannot be made decryptable again, while the others can
+	if !isError(request("keys/test/config", map[string]interface{}{"min_decryption_version": 2})) {
+		t.Fatal("expected an error lowering the min decryption version to a trimmed version")
+	}
+	if isError(request("keys/test/config", map[string]interface{}{"min_decryption_version": 3})) {
+		t.Fatal("failed to lower the min decryption version")
+	}
+	resp := request("decrypt/test", map[string]interface{}{"ciphertext": ciphertexts[3]})
+	if isError(resp) || resp.Data["plaintext"] != plaintext {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	if !isError(request("keys/test/trim", map[string]interface{}{"min_available_version": 2})) {
+		t.Fatal("expected an error restoring trimmed versions")
+	}
+	if !isError(request("keys/test/trim", map[string]interface{}{"min_available_version": 4})) {
+		t.Fatal("expected an error trimming decryptable versions")
+	}
+
+	resp, err = b.HandleRequest(&logical.Request{
+		Storage:   storage,
+		Operation: logical.ReadOperation,
+		Path:      "keys/test",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Data["min_available_version"] != 3 || resp.Data["min_decryption_version"] != 3 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
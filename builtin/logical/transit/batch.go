@@ -0,0 +1,95 @@
+package transit
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+	"github.com/mitchellh/mapstructure"
+)
+
+// batchItem is an item of the batch_input of the encrypt, decrypt, rewrap
+// and hmac paths. Requests without batch_input are handled as a batch of a
+// single item, made of the fields of the request. The items are read from
+// the raw request data and batch_input is left out of the path fields, since
+// lists have no field type.
+type batchItem struct {
+	Plaintext  string `mapstructure:"plaintext"`
+	Ciphertext string `mapstructure:"ciphertext"`
+	Input      string `mapstructure:"input"`
+	Context    string `mapstructure:"context"`
+	Nonce      string `mapstructure:"nonce"`
+}
+
+// parseBatchInput returns the items of the batch_input of the request, or nil
+// if it has none
+func parseBatchInput(d *framework.FieldData) ([]batchItem, error) {
+	raw, ok := d.Raw["batch_input"]
+	if !ok {
+		return nil, nil
+	}
+
+	var items []batchItem
+	if err := mapstructure.Decode(raw, &items); err != nil {
+		return nil, fmt.Errorf("invalid batch_input: %v", err)
+	}
+	if len(items) == 0 {
+		return nil, fmt.Errorf("batch_input must contain at least one item")
+	}
+	return items, nil
+}
+
+// decode returns the base64-decoded context and nonce of the item
+func (item *batchItem) decode() ([]byte, []byte, error) {
+	var context, nonce []byte
+	var err error
+	if len(item.Context) != 0 {
+		context, err = base64.StdEncoding.DecodeString(item.Context)
+		if err != nil {
+			return nil, nil, errutil.UserError{Err: "failed to base64-decode context"}
+		}
+	}
+	if len(item.Nonce) != 0 {
+		nonce, err = base64.StdEncoding.DecodeString(item.Nonce)
+		if err != nil {
+			return nil, nil, errutil.UserError{Err: "failed to base64-decode nonce"}
+		}
+	}
+	return context, nonce, nil
+}
+
+// processBatch applies the operation to each item. With batch_input, the
+// user errors of the items are returned in their results, while without it
+// the user error of the single item is returned as an error response. Other
+// errors fail the whole request.
+func processBatch(items []batchItem, batch bool, op func(batchItem) (map[string]interface{}, error)) (*logical.Response, error) {
+	results := make([]map[string]interface{}, 0, len(items))
+	for _, item := range items {
+		result, err := op(item)
+		if err != nil {
+			if _, ok := err.(errutil.UserError); !ok {
+				return nil, err
+			}
+			if !batch {
+				return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+			}
+			result = map[string]interface{}{
+				"error": err.Error(),
+			}
+		}
+		results = append(results, result)
+	}
+
+	if !batch {
+		return &logical.Response{
+			Data: results[0],
+		}, nil
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"batch_results": results,
+		},
+	}, nil
+}
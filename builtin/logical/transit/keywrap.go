@@ -0,0 +1,243 @@
+package transit
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// Key material is wrapped for import and export the way PKCS#11 devices
+// wrap keys with CKM_RSA_AES_KEY_WRAP: an ephemeral AES-256 key is encrypted
+// with RSA-OAEP under the public key of the recipient, followed by the key
+// material wrapped with the ephemeral key using AES key wrap with padding
+// (RFC 5649).
+
+// wrapHashFunctions are the hash functions available for RSA-OAEP, by name
+var wrapHashFunctions = map[string]crypto.Hash{
+	"SHA1":   crypto.SHA1,
+	"SHA224": crypto.SHA224,
+	"SHA256": crypto.SHA256,
+	"SHA384": crypto.SHA384,
+	"SHA512": crypto.SHA512,
+}
+
+// kwpIV is the alternative initial value of RFC 5649
+var kwpIV = []byte{0xa6, 0x59, 0x59, 0xa6}
+
+// wrapKeyMaterial wraps the key material for the holder of the private key
+// of the public key
+func wrapKeyMaterial(pub *rsa.PublicKey, hash crypto.Hash, material []byte) ([]byte, error) {
+	ephemeral := make([]byte, 32)
+	if _, err := rand.Read(ephemeral); err != nil {
+		return nil, err
+	}
+	wrappedEphemeral, err := rsa.EncryptOAEP(hash.New(), rand.Reader, pub, ephemeral, nil)
+	if err != nil {
+		return nil, err
+	}
+	wrappedMaterial, err := kwpWrap(ephemeral, material)
+	if err != nil {
+		return nil, err
+	}
+	return append(wrappedEphemeral, wrappedMaterial...), nil
+}
+
+// unwrapKeyMaterial returns the key material wrapped by wrapKeyMaterial
+func unwrapKeyMaterial(priv *rsa.PrivateKey, hash crypto.Hash, wrapped []byte) ([]byte, error) {
+	size := (priv.N.BitLen() + 7) / 8
+	if len(wrapped) <= size {
+		return nil, fmt.Errorf("wrapped key material is too short")
+	}
+	ephemeral, err := rsa.DecryptOAEP(hash.New(), nil, priv, wrapped[:size], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt the ephemeral key: %v", err)
+	}
+	return kwpUnwrap(ephemeral, wrapped[size:])
+}
+
+// kwpWrap wraps the plaintext with AES key wrap with padding
+func kwpWrap(kek, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(plaintext) == 0 {
+		return nil, fmt.Errorf("cannot wrap empty key material")
+	}
+
+	aiv := make([]byte, 8)
+	copy(aiv, kwpIV)
+	binary.BigEndian.PutUint32(aiv[4:], uint32(len(plaintext)))
+	padded := make([]byte, (len(plaintext)+7)/8*8)
+	copy(padded, plaintext)
+
+	// A single block is encrypted with the initial value directly
+	if len(padded) == 8 {
+		out := make([]byte, 16)
+		block.Encrypt(out, append(aiv, padded...))
+		return out, nil
+	}
+
+	n := len(padded) / 8
+	a := aiv
+	r := padded
+	b := make([]byte, 16)
+	for j := 0; j < 6; j++ {
+		for i := 1; i <= n; i++ {
+			copy(b, a)
+			copy(b[8:], r[(i-1)*8:i*8])
+			block.Encrypt(b, b)
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(a, binary.BigEndian.Uint64(b[:8])^t)
+			copy(r[(i-1)*8:i*8], b[8:])
+		}
+	}
+	return append(a, r...), nil
+}
+
+// kwpUnwrap unwraps ciphertext wrapped with AES key wrap with padding
+func kwpUnwrap(kek, ciphertext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < 16 || len(ciphertext)%8 != 0 {
+		return nil, fmt.Errorf("invalid wrapped key material length")
+	}
+
+	n := len(ciphertext)/8 - 1
+	a := make([]byte, 8)
+	r := make([]byte, n*8)
+	if n == 1 {
+		b := make([]byte, 16)
+		block.Decrypt(b, ciphertext)
+		copy(a, b[:8])
+		copy(r, b[8:])
+	} else {
+		copy(a, ciphertext[:8])
+		copy(r, ciphertext[8:])
+		b := make([]byte, 16)
+		for j := 5; j >= 0; j-- {
+			for i := n; i >= 1; i-- {
+				t := uint64(n*j + i)
+				binary.BigEndian.PutUint64(b, binary.BigEndian.Uint64(a)^t)
+				copy(b[8:], r[(i-1)*8:i*8])
+				block.Decrypt(b, b)
+				copy(a, b[:8])
+				copy(r[(i-1)*8:i*8], b[8:])
+			}
+		}
+	}
+
+	// Check the initial value, the length and the padding
+	length := int(binary.BigEndian.Uint32(a[4:]))
+	valid := subtle.ConstantTimeCompare(a[:4], kwpIV) == 1 &&
+		length > 8*(n-1) && length <= 8*n
+	if valid {
+		for _, c := range r[length:] {
+			valid = valid && c == 0
+		}
+	}
+	if !valid {
+		return nil, fmt.Errorf("failed to unwrap key material")
+	}
+	return r[:length], nil
+}
+
+// pkcs8 is the ASN.1 structure of PKCS#8 private keys
+type pkcs8 struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+var (
+	oidPublicKeyRSA     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidPublicKeyECDSA   = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidPublicKeyEd25519 = asn1.ObjectIdentifier{1, 3, 101, 112}
+	oidNamedCurveP256   = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+)
+
+// marshalPKCS8PrivateKey returns the PKCS#8 encoding of the RSA, ECDSA or
+// Ed25519 private key
+func marshalPKCS8PrivateKey(key interface{}) ([]byte, error) {
+	var info pkcs8
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		info.Algo = pkix.AlgorithmIdentifier{
+			Algorithm:  oidPublicKeyRSA,
+			Parameters: asn1.RawValue{Tag: asn1.TagNull},
+		}
+		info.PrivateKey = x509.MarshalPKCS1PrivateKey(key)
+
+	case *ecdsa.PrivateKey:
+		if key.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("unsupported curve")
+		}
+		params, err := asn1.Marshal(oidNamedCurveP256)
+		if err != nil {
+			return nil, err
+		}
+		info.Algo = pkix.AlgorithmIdentifier{
+			Algorithm:  oidPublicKeyECDSA,
+			Parameters: asn1.RawValue{FullBytes: params},
+		}
+		info.PrivateKey, err = x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+
+	case ed25519.PrivateKey:
+		seed, err := asn1.Marshal(key[:32])
+		if err != nil {
+			return nil, err
+		}
+		info.Algo = pkix.AlgorithmIdentifier{
+			Algorithm: oidPublicKeyEd25519,
+		}
+		info.PrivateKey = seed
+
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return asn1.Marshal(info)
+}
+
+// parsePKCS8PrivateKey parses the PKCS#8 encoding of an RSA, ECDSA or
+// Ed25519 private key
+func parsePKCS8PrivateKey(der []byte) (interface{}, error) {
+	var info pkcs8
+	rest, err := asn1.Unmarshal(der, &info)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("trailing data after the private key")
+	}
+
+	// Ed25519 keys are parsed here, since x509 does not support them
+	if !info.Algo.Algorithm.Equal(oidPublicKeyEd25519) {
+		return x509.ParsePKCS8PrivateKey(der)
+	}
+	var seed []byte
+	if _, err := asn1.Unmarshal(info.PrivateKey, &seed); err != nil {
+		return nil, err
+	}
+	if len(seed) != 32 {
+		return nil, fmt.Errorf("invalid ed25519 private key length")
+	}
+	_, key, err := ed25519.GenerateKey(bytes.NewReader(seed))
+	return key, err
+}
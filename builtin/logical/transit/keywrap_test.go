@@ -0,0 +1,116 @@
+package transit
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+func TestKWP_vectors(t *testing.T) {
+	// The test vectors of RFC 5649
+	kek, _ := hex.DecodeString("5840df6e29b02af1ab493b705bf16ea1ae8338f4dcc176a8")
+	cases := []struct {
+		key     string
+		wrapped string
+	}{
+		{"c37b7e6492584340bed12207808941155068f738", "138bdeaa9b8fa7fc61f97742e72248ee5ae6ae5360d1ae6a5f54f373fa543b6a"},
+		{"466f7250617369", "afbeb0f07dfbf5419200f2ccb50bb24f"},
+	}
+
+	for _, c := range cases {
+		key, _ := hex.DecodeString(c.key)
+		wrapped, err := kwpWrap(kek, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(wrapped) != c.wrapped {
+			t.Fatalf("bad: %x", wrapped)
+		}
+
+		unwrapped, err := kwpUnwrap(kek, wrapped)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(unwrapped, key) {
+			t.Fatalf("bad: %x", unwrapped)
+		}
+
+		wrapped[len(wrapped)-1] ^= 1
+		if _, err := kwpUnwrap(kek, wrapped); err == nil {
+			t.Fatal("expected an error for tampered key material")
+		}
+	}
+}
+
+func TestWrapKeyMaterial(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	material := []byte("some key material")
+	wrapped, err := wrapKeyMaterial(&priv.PublicKey, crypto.SHA256, material)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unwrapped, err := unwrapKeyMaterial(priv, crypto.SHA256, wrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(unwrapped, material) {
+		t.Fatalf("bad: %q", unwrapped)
+	}
+
+	if _, err := unwrapKeyMaterial(priv, crypto.SHA1, wrapped); err == nil {
+		t.Fatal("expected an error for a different hash function")
+	}
+}
+
+func TestPKCS8_roundTrip(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []interface{}{rsaKey, ecdsaKey, ed25519Key} {
+		der, err := marshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := parsePKCS8PrivateKey(der)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		switch key := key.(type) {
+		case *rsa.PrivateKey:
+			if parsed.(*rsa.PrivateKey).D.Cmp(key.D) != 0 {
+				t.Fatal("bad: RSA key mismatch")
+			}
+		case *ecdsa.PrivateKey:
+			if parsed.(*ecdsa.PrivateKey).D.Cmp(key.D) != 0 {
+				t.Fatal("bad: ECDSA key mismatch")
+			}
+		default:
+			if !reflect.DeepEqual(parsed, key) {
+				t.Fatalf("bad: %T", parsed)
+			}
+		}
+	}
+}
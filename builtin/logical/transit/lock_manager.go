@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"sync"
 
+	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/helper/jsonutil"
 	"github.com/hashicorp/vault/logical"
 )
@@ -105,42 +106,42 @@ func (lm *lockManager) UnlockPolicy(lock *sync.RWMutex, lockType bool) {
 // is needed (for instance, for an upgrade/migration), give up the read lock,
 // call again with an exclusive lock, then swap back out for a read lock.
 func (lm *lockManager) GetPolicyShared(storage logical.Storage, name string) (*Policy, *sync.RWMutex, error) {
-	p, lock, _, err := lm.getPolicyCommon(storage, name, false, false, false, shared)
+	p, lock, _, err := lm.getPolicyCommon(storage, name, false, "", false, false, false, shared)
 	if err == nil ||
 		(err != nil && err != errNeedExclusiveLock) {
 		return p, lock, err
 	}
 
 	// Try again while asking for an exlusive lock
-	p, lock, _, err = lm.getPolicyCommon(storage, name, false, false, false, exclusive)
+	p, lock, _, err = lm.getPolicyCommon(storage, name, false, "", false, false, false, exclusive)
 	if err != nil || p == nil || lock == nil {
 		return p, lock, err
 	}
 
 	lock.Unlock()
 
-	p, lock, _, err = lm.getPolicyCommon(storage, name, false, false, false, shared)
+	p, lock, _, err = lm.getPolicyCommon(storage, name, false, "", false, false, false, shared)
 	return p, lock, err
 }
 
 // Get the policy with an exclusive lock
 func (lm *lockManager) GetPolicyExclusive(storage logical.Storage, name string) (*Policy, *sync.RWMutex, error) {
-	p, lock, _, err := lm.getPolicyCommon(storage, name, false, false, false, exclusive)
+	p, lock, _, err := lm.getPolicyCommon(storage, name, false, "", false, false, false, exclusive)
 	return p, lock, err
 }
 
 // Get the policy with a read lock; if it returns that an exclusive lock is
 // needed, retry. If successful, call one more time to get a read lock and
 // return the value.
-func (lm *lockManager) GetPolicyUpsert(storage logical.Storage, name string, derived, convergent bool) (*Policy, *sync.RWMutex, bool, error) {
-	p, lock, _, err := lm.getPolicyCommon(storage, name, true, derived, convergent, shared)
+func (lm *lockManager) GetPolicyUpsert(storage logical.Storage, name, keyType string, derived, convergent, exportable bool) (*Policy, *sync.RWMutex, bool, error) {
+	p, lock, _, err := lm.getPolicyCommon(storage, name, true, keyType, derived, convergent, exportable, shared)
 	if err == nil ||
 		(err != nil && err != errNeedExclusiveLock) {
 		return p, lock, false, err
 	}
 
 	// Try again while asking for an exlusive lock
-	p, lock, upserted, err := lm.getPolicyCommon(storage, name, true, derived, convergent, exclusive)
+	p, lock, upserted, err := lm.getPolicyCommon(storage, name, true, keyType, derived, convergent, exportable, exclusive)
 	if err != nil || p == nil || lock == nil {
 		return p, lock, upserted, err
 	}
@@ -148,14 +149,14 @@ func (lm *lockManager) GetPolicyUpsert(storage logical.Storage, name string, der
 	lock.Unlock()
 
 	// Now get a shared lock for the return, but preserve the value of upsert
-	p, lock, _, err = lm.getPolicyCommon(storage, name, true, derived, convergent, shared)
+	p, lock, _, err = lm.getPolicyCommon(storage, name, true, keyType, derived, convergent, exportable, shared)
 
 	return p, lock, upserted, err
 }
 
 // When the function returns, a lock will be held on the policy if err == nil.
 // It is the caller's responsibility to unlock.
-func (lm *lockManager) getPolicyCommon(storage logical.Storage, name string, upsert, derived, convergent, lockType bool) (*Policy, *sync.RWMutex, bool, error) {
+func (lm *lockManager) getPolicyCommon(storage logical.Storage, name string, upsert bool, keyType string, derived, convergent, exportable, lockType bool) (*Policy, *sync.RWMutex, bool, error) {
 	lock := lm.policyLock(name, lockType)
 
 	var p *Policy
@@ -195,15 +196,26 @@ func (lm *lockManager) getPolicyCommon(storage logical.Storage, name string, ups
 		if !derived && convergent {
 			return nil, nil, false, fmt.Errorf("convergent encryption requires derivation to be enabled")
 		}
+		if derived && keyType != keyTypeAESGCM {
+			lm.UnlockPolicy(lock, lockType)
+			return nil, nil, false, fmt.Errorf("key derivation is only supported by %s keys", keyTypeAESGCM)
+		}
 
 		p = &Policy{
 			Name:       name,
-			CipherMode: "aes-gcm",
+			Type:       keyType,
 			Derived:    derived,
+			Exportable: exportable,
+		}
+		if keyType == keyTypeAESGCM {
+			p.CipherMode = "aes-gcm"
 		}
 		if derived {
 			p.KDFMode = kdfMode
 			p.ConvergentEncryption = convergent
+			if convergent {
+				p.ConvergentVersion = convergentVersion
+			}
 		}
 
 		err = p.rotate(storage)
@@ -264,6 +276,33 @@ func (lm *lockManager) getPolicyCommon(storage logical.Storage, name string, ups
 	return p, lock, false, nil
 }
 
+// ImportPolicy stores the new policy, which must hold its key versions. It
+// returns an error if a policy of the same name exists.
+func (lm *lockManager) ImportPolicy(storage logical.Storage, p *Policy) error {
+	lock := lm.policyLock(p.Name, exclusive)
+	defer lock.Unlock()
+
+	existing, err := lm.getStoredPolicy(storage, p.Name)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return errutil.UserError{Err: fmt.Sprintf("key %s already exists", p.Name)}
+	}
+
+	if err := p.Persist(storage); err != nil {
+		return err
+	}
+
+	if lm.CacheActive() {
+		lm.cacheMutex.Lock()
+		lm.cache[p.Name] = p
+		lm.cacheMutex.Unlock()
+	}
+
+	return nil
+}
+
 func (lm *lockManager) DeletePolicy(storage logical.Storage, name string) error {
 	lm.cacheMutex.Lock()
 	lock := lm.policyLock(name, exclusive)
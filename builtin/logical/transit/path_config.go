@@ -2,6 +2,7 @@ package transit
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
@@ -26,6 +27,26 @@ to be decrypted.`,
 				Type:        framework.TypeBool,
 				Description: "Whether to allow deletion of the key",
 			},
+
+			"exportable": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Enables the export of the key material. Once
+enabled, it cannot be disabled.`,
+			},
+
+			"auto_rotate_period": &framework.FieldSchema{
+				Type: framework.TypeDurationSecond,
+				Description: `The age of the latest version of the key after
+which it is rotated automatically. Must be at least an hour, or 0 to disable
+automatic rotation.`,
+			},
+
+			"auto_rotate_keep_versions": &framework.FieldSchema{
+				Type: framework.TypeInt,
+				Description: `The number of the latest versions that remain
+decryptable after an automatic rotation, which advances the minimum decryption
+version. Defaults to 0, which does not advance it.`,
+			},
 		},
 
 		Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -78,6 +99,10 @@ func (b *backend) pathConfigWrite(
 				return logical.ErrorResponse(
 					fmt.Sprintf("cannot set min decryption version of %d, latest key version is %d", minDecryptionVersion, p.LatestVersion)), nil
 			}
+			if minDecryptionVersion < p.MinAvailableVersion {
+				return logical.ErrorResponse(
+					fmt.Sprintf("cannot set min decryption version of %d, versions before %d have been trimmed", minDecryptionVersion, p.MinAvailableVersion)), nil
+			}
 			p.MinDecryptionVersion = minDecryptionVersion
 			persistNeeded = true
 		}
@@ -92,6 +117,45 @@ func (b *backend) pathConfigWrite(
 		}
 	}
 
+	exportableRaw, ok := d.GetOk("exportable")
+	if ok {
+		exportable := exportableRaw.(bool)
+		if p.Exportable && !exportable {
+			return logical.ErrorResponse("exportable cannot be disabled once enabled"), nil
+		}
+		if exportable && !p.Exportable {
+			p.Exportable = true
+			persistNeeded = true
+		}
+	}
+
+	autoRotatePeriodRaw, ok := d.GetOk("auto_rotate_period")
+	if ok {
+		autoRotatePeriod := time.Duration(autoRotatePeriodRaw.(int)) * time.Second
+		if autoRotatePeriod != 0 && autoRotatePeriod < time.Hour {
+			return logical.ErrorResponse("auto rotate period must be at least an hour, or 0 to disable automatic rotation"), nil
+		}
+		if autoRotatePeriod != 0 && p.Imported && !p.AllowImportedKeyRotation {
+			return logical.ErrorResponse("imported key does not allow rotation"), nil
+		}
+		if autoRotatePeriod != p.AutoRotatePeriod {
+			p.AutoRotatePeriod = autoRotatePeriod
+			persistNeeded = true
+		}
+	}
+
+	keepVersionsRaw, ok := d.GetOk("auto_rotate_keep_versions")
+	if ok {
+		keepVersions := keepVersionsRaw.(int)
+		if keepVersions < 0 {
+			return logical.ErrorResponse("auto rotate keep versions cannot be negative"), nil
+		}
+		if keepVersions != p.AutoRotateKeepVersions {
+			p.AutoRotateKeepVersions = keepVersions
+			persistNeeded = true
+		}
+	}
+
 	// Add this as a guard here before persisting since we now require the min
 	// decryption version to start at 1; even if it's not explicitly set here,
 	// force the upgrade
@@ -116,5 +180,7 @@ const pathConfigHelpSyn = `Configure a named encryption key`
 const pathConfigHelpDesc = `
 This path is used to configure the named key. Currently, this
 supports adjusting the minimum version of the key allowed to
-be used for decryption via the min_decryption_version paramter.
+be used for decryption via the min_decryption_version paramter,
+and rotating the key automatically via the auto_rotate_period
+parameter.
 `
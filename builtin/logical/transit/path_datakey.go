@@ -32,7 +32,7 @@ ciphertext; "wrapped" will return the ciphertext only.`,
 
 			"nonce": &framework.FieldSchema{
 				Type:        framework.TypeString,
-				Description: "Nonce for when convergent encryption is used",
+				Description: "Nonce for when convergent encryption version 1 is used",
 			},
 
 			"bits": &framework.FieldSchema{
@@ -1,7 +1,6 @@
 package transit
 
 import (
-	"encoding/base64"
 	"fmt"
 
 	"github.com/hashicorp/vault/helper/errutil"
@@ -30,7 +29,7 @@ func (b *backend) pathDecrypt() *framework.Path {
 
 			"nonce": &framework.FieldSchema{
 				Type:        framework.TypeString,
-				Description: "Nonce for when convergent encryption is used",
+				Description: "Nonce for when convergent encryption version 1 is used",
 			},
 		},
 
@@ -46,31 +45,18 @@ func (b *backend) pathDecrypt() *framework.Path {
 func (b *backend) pathDecryptWrite(
 	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
 	name := d.Get("name").(string)
-	ciphertext := d.Get("ciphertext").(string)
-	if len(ciphertext) == 0 {
-		return logical.ErrorResponse("missing ciphertext to decrypt"), logical.ErrInvalidRequest
-	}
-
-	var err error
 
-	// Decode the context if any
-	contextRaw := d.Get("context").(string)
-	var context []byte
-	if len(contextRaw) != 0 {
-		context, err = base64.StdEncoding.DecodeString(contextRaw)
-		if err != nil {
-			return logical.ErrorResponse("failed to base64-decode context"), logical.ErrInvalidRequest
-		}
+	items, err := parseBatchInput(d)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
 	}
-
-	// Decode the nonce if any
-	nonceRaw := d.Get("nonce").(string)
-	var nonce []byte
-	if len(nonceRaw) != 0 {
-		nonce, err = base64.StdEncoding.DecodeString(nonceRaw)
-		if err != nil {
-			return logical.ErrorResponse("failed to base64-decode nonce"), logical.ErrInvalidRequest
-		}
+	batch := items != nil
+	if !batch {
+		items = []batchItem{{
+			Ciphertext: d.Get("ciphertext").(string),
+			Context:    d.Get("context").(string),
+			Nonce:      d.Get("nonce").(string),
+		}}
 	}
 
 	// Get the policy
@@ -85,29 +71,27 @@ func (b *backend) pathDecryptWrite(
 		return logical.ErrorResponse("policy not found"), logical.ErrInvalidRequest
 	}
 
-	plaintext, err := p.Decrypt(context, nonce, ciphertext)
-	if err != nil {
-		switch err.(type) {
-		case errutil.UserError:
-			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
-		case errutil.InternalError:
-			return nil, err
-		default:
+	return processBatch(items, batch, func(item batchItem) (map[string]interface{}, error) {
+		if len(item.Ciphertext) == 0 {
+			return nil, errutil.UserError{Err: "missing ciphertext to decrypt"}
+		}
+		context, nonce, err := item.decode()
+		if err != nil {
 			return nil, err
 		}
-	}
 
-	if plaintext == "" {
-		return nil, fmt.Errorf("empty plaintext returned")
-	}
+		plaintext, err := p.Decrypt(context, nonce, item.Ciphertext)
+		if err != nil {
+			return nil, err
+		}
+		if plaintext == "" {
+			return nil, fmt.Errorf("empty plaintext returned")
+		}
 
-	// Generate the response
-	resp := &logical.Response{
-		Data: map[string]interface{}{
+		return map[string]interface{}{
 			"plaintext": plaintext,
-		},
-	}
-	return resp, nil
+		}, nil
+	})
 }
 
 const pathDecryptHelpSyn = `Decrypt a ciphertext value using a named key`
@@ -115,4 +99,9 @@ const pathDecryptHelpSyn = `Decrypt a ciphertext value using a named key`
 const pathDecryptHelpDesc = `
 This path uses the named key from the request path to decrypt a user
 provided ciphertext. The plaintext is returned base64 encoded.
+
+Many ciphertexts can be decrypted in a single request by giving a list of
+items in "batch_input", each holding a ciphertext and, as needed, a context
+and nonce. The plaintexts are returned in "batch_results" in the same order,
+and items that fail hold their error in "error" instead.
 `
@@ -1,7 +1,6 @@
 package transit
 
 import (
-	"encoding/base64"
 	"fmt"
 	"sync"
 
@@ -31,7 +30,7 @@ func (b *backend) pathEncrypt() *framework.Path {
 
 			"nonce": &framework.FieldSchema{
 				Type:        framework.TypeString,
-				Description: "Nonce for when convergent encryption is used",
+				Description: "Nonce for when convergent encryption version 1 is used",
 			},
 		},
 
@@ -63,30 +62,30 @@ func (b *backend) pathEncryptExistenceCheck(
 func (b *backend) pathEncryptWrite(
 	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
 	name := d.Get("name").(string)
-	value := d.Get("plaintext").(string)
-	if len(value) == 0 {
-		return logical.ErrorResponse("missing plaintext to encrypt"), logical.ErrInvalidRequest
-	}
-
-	var err error
 
-	// Decode the context if any
-	contextRaw := d.Get("context").(string)
-	var context []byte
-	if len(contextRaw) != 0 {
-		context, err = base64.StdEncoding.DecodeString(contextRaw)
-		if err != nil {
-			return logical.ErrorResponse("failed to base64-decode context"), logical.ErrInvalidRequest
+	items, err := parseBatchInput(d)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	batch := items != nil
+	if !batch {
+		items = []batchItem{{
+			Plaintext: d.Get("plaintext").(string),
+			Context:   d.Get("context").(string),
+			Nonce:     d.Get("nonce").(string),
+		}}
+
+		// Checked before the key is upserted
+		if len(items[0].Plaintext) == 0 {
+			return logical.ErrorResponse("missing plaintext to encrypt"), logical.ErrInvalidRequest
 		}
 	}
 
-	// Decode the nonce if any
-	nonceRaw := d.Get("nonce").(string)
-	var nonce []byte
-	if len(nonceRaw) != 0 {
-		nonce, err = base64.StdEncoding.DecodeString(nonceRaw)
-		if err != nil {
-			return logical.ErrorResponse("failed to base64-decode nonce"), logical.ErrInvalidRequest
+	// An upserted key is derived if a context is given
+	derived := false
+	for _, item := range items {
+		if len(item.Context) != 0 {
+			derived = true
 		}
 	}
 
@@ -95,7 +94,7 @@ func (b *backend) pathEncryptWrite(
 	var lock *sync.RWMutex
 	var upserted bool
 	if req.Operation == logical.CreateOperation {
-		p, lock, upserted, err = b.lm.GetPolicyUpsert(req.Storage, name, len(context) != 0, false)
+		p, lock, upserted, err = b.lm.GetPolicyUpsert(req.Storage, name, keyTypeAESGCM, derived, false, false)
 	} else {
 		p, lock, err = b.lm.GetPolicyShared(req.Storage, name)
 	}
@@ -109,27 +108,29 @@ func (b *backend) pathEncryptWrite(
 		return logical.ErrorResponse("policy not found"), logical.ErrInvalidRequest
 	}
 
-	ciphertext, err := p.Encrypt(context, nonce, value)
-	if err != nil {
-		switch err.(type) {
-		case errutil.UserError:
-			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
-		case errutil.InternalError:
-			return nil, err
-		default:
+	resp, err := processBatch(items, batch, func(item batchItem) (map[string]interface{}, error) {
+		if len(item.Plaintext) == 0 {
+			return nil, errutil.UserError{Err: "missing plaintext to encrypt"}
+		}
+		context, nonce, err := item.decode()
+		if err != nil {
 			return nil, err
 		}
-	}
 
-	if ciphertext == "" {
-		return nil, fmt.Errorf("empty ciphertext returned")
-	}
+		ciphertext, err := p.Encrypt(context, nonce, item.Plaintext)
+		if err != nil {
+			return nil, err
+		}
+		if ciphertext == "" {
+			return nil, fmt.Errorf("empty ciphertext returned")
+		}
 
-	// Generate the response
-	resp := &logical.Response{
-		Data: map[string]interface{}{
+		return map[string]interface{}{
 			"ciphertext": ciphertext,
-		},
+		}, nil
+	})
+	if err != nil || resp.IsError() {
+		return resp, err
 	}
 
 	if req.Operation == logical.CreateOperation && !upserted {
@@ -144,4 +145,9 @@ const pathEncryptHelpSyn = `Encrypt a plaintext value using a named key`
 const pathEncryptHelpDesc = `
 This path uses the named key from the request path to encrypt a user
 provided plaintext. The plaintext must be base64 encoded.
+
+Many plaintexts can be encrypted in a single request by giving a list of
+items in "batch_input", each holding a plaintext and, as needed, a context
+and nonce. The ciphertexts are returned in "batch_results" in the same order,
+and items that fail hold their error in "error" instead.
 `
@@ -0,0 +1,229 @@
+package transit
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+const (
+	exportTypeEncryptionKey = "encryption-key"
+	exportTypeSigningKey    = "signing-key"
+	exportTypeHMACKey       = "hmac-key"
+)
+
+func (b *backend) pathExport() *framework.Path {
+	return &framework.Path{
+		Pattern: "export/(?P<type>encryption-key|signing-key|hmac-key)/" + framework.GenericNameRegex("name") + framework.OptionalParamRegex("version"),
+		Fields: map[string]*framework.FieldSchema{
+			"type": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The type of the exported key material,
+"encryption-key", "signing-key" or "hmac-key"`,
+			},
+
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the key",
+			},
+
+			"version": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The version of the key to export, or "latest".
+Defaults to every version.`,
+			},
+
+			"public_key": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The PEM-encoded RSA public key to wrap the key
+material with`,
+			},
+
+			"hash_function": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "SHA256",
+				Description: `The hash function used for RSA-OAEP when wrapping
+the key material, one of "SHA1", "SHA224", "SHA256", "SHA384" and "SHA512".
+Defaults to "SHA256".`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation:   b.pathExportRead,
+			logical.UpdateOperation: b.pathExportWrite,
+		},
+
+		HelpSynopsis:    pathExportHelpSyn,
+		HelpDescription: pathExportHelpDesc,
+	}
+}
+
+func (b *backend) pathExportRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	return b.exportKeys(req, d, func(exportType string, material []byte) (string, error) {
+		if exportType == exportTypeSigningKey {
+			return string(pem.EncodeToMemory(&pem.Block{
+				Type:  "PRIVATE KEY",
+				Bytes: material,
+			})), nil
+		}
+		return base64.StdEncoding.EncodeToString(material), nil
+	})
+}
+
+func (b *backend) pathExportWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	pub, err := parseRSAPublicKeyPEM(d.Get("public_key").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	hashFunction := d.Get("hash_function").(string)
+	hash, ok := wrapHashFunctions[strings.ToUpper(hashFunction)]
+	if !ok {
+		return logical.ErrorResponse(fmt.Sprintf("unsupported hash function %s", hashFunction)), logical.ErrInvalidRequest
+	}
+
+	return b.exportKeys(req, d, func(exportType string, material []byte) (string, error) {
+		wrapped, err := wrapKeyMaterial(pub, hash, material)
+		if err != nil {
+			return "", err
+		}
+		return base64.StdEncoding.EncodeToString(wrapped), nil
+	})
+}
+
+// parseRSAPublicKeyPEM parses a PEM-encoded RSA public key
+func parseRSAPublicKeyPEM(data string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, fmt.Errorf("missing or invalid PEM-encoded public key")
+	}
+	parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse the public key: %v", err)
+	}
+	pub, ok := parsed.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("the public key must be an RSA public key")
+	}
+	return pub, nil
+}
+
+// exportKeys returns the key material of the requested versions of the key,
+// each formatted by format
+func (b *backend) exportKeys(req *logical.Request, d *framework.FieldData,
+	format func(exportType string, material []byte) (string, error)) (*logical.Response, error) {
+	exportType := d.Get("type").(string)
+	name := d.Get("name").(string)
+
+	p, lock, err := b.lm.GetPolicyShared(req.Storage, name)
+	if lock != nil {
+		defer lock.RUnlock()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, nil
+	}
+	if !p.Exportable {
+		return logical.ErrorResponse("key is not exportable"), logical.ErrInvalidRequest
+	}
+
+	var versions []int
+	switch version := d.Get("version").(string); version {
+	case "":
+		for ver := range p.Keys {
+			versions = append(versions, ver)
+		}
+	case "latest":
+		versions = []int{p.LatestVersion}
+	default:
+		ver, err := strconv.Atoi(version)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("invalid version %s", version)), logical.ErrInvalidRequest
+		}
+		versions = []int{ver}
+	}
+
+	keys := make(map[string]string, len(versions))
+	for _, ver := range versions {
+		material, err := p.exportMaterial(exportType, ver)
+		if err != nil {
+			switch err.(type) {
+			case errutil.UserError:
+				return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+			default:
+				return nil, err
+			}
+		}
+		keys[strconv.Itoa(ver)], err = format(exportType, material)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name": p.Name,
+			"type": p.KeyType(),
+			"keys": keys,
+		},
+	}, nil
+}
+
+// exportMaterial returns the key material of the version of the key for the
+// export type: the raw bytes of AES and HMAC keys, or the PKCS#8 encoding of
+// private keys
+func (p *Policy) exportMaterial(exportType string, ver int) ([]byte, error) {
+	entry, ok := p.Keys[ver]
+	if !ok || ver < p.MinDecryptionVersion {
+		return nil, errutil.UserError{Err: fmt.Sprintf("version %d of the key is not available", ver)}
+	}
+
+	switch exportType {
+	case exportTypeEncryptionKey:
+		if !p.EncryptionSupported() {
+			return nil, errutil.UserError{Err: "the key does not support encryption"}
+		}
+		return entry.Key, nil
+
+	case exportTypeSigningKey:
+		if !p.SigningSupported() {
+			return nil, errutil.UserError{Err: "the key does not support signing"}
+		}
+		der, err := marshalPKCS8PrivateKey(entry.privateKey(p.KeyType()))
+		if err != nil {
+			return nil, errutil.InternalError{Err: err.Error()}
+		}
+		return der, nil
+
+	case exportTypeHMACKey:
+		if len(entry.HMACKey) == 0 {
+			return nil, errutil.UserError{Err: fmt.Sprintf("version %d of the key has no HMAC key", ver)}
+		}
+		return entry.HMACKey, nil
+	}
+
+	return nil, errutil.UserError{Err: fmt.Sprintf("unknown export type %s", exportType)}
+}
+
+const pathExportHelpSyn = `Export the key material of a named key`
+
+const pathExportHelpDesc = `
+Exports the encryption, signing or HMAC key material of the named key, which
+must be exportable. Encryption and HMAC keys are base64-encoded, and signing
+keys are PEM-encoded PKCS#8 private keys.
+
+Writing to the path with an RSA public_key returns the key material wrapped
+with the public key instead, in the format accepted by the import path of the
+keys, so that it can be escrowed or imported into another Vault.
+`
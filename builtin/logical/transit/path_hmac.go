@@ -0,0 +1,116 @@
+package transit
+
+import (
+	"encoding/base64"
+
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func (b *backend) pathHMAC() *framework.Path {
+	return &framework.Path{
+		Pattern: "hmac/" + framework.GenericNameRegex("name") + framework.OptionalParamRegex("urlalgorithm"),
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the key",
+			},
+
+			"input": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "The base64-encoded input data",
+			},
+
+			"algorithm": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "sha2-256",
+				Description: `Hash algorithm to use, one of "sha2-224", "sha2-256",
+"sha2-384" and "sha2-512". It can also be given in the URL. Defaults to
+"sha2-256".`,
+			},
+
+			"urlalgorithm": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: `Hash algorithm to use, given in the URL`,
+			},
+
+			"key_version": &framework.FieldSchema{
+				Type: framework.TypeInt,
+				Description: `The version of the key to use. Defaults to the
+latest version.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathHMACWrite,
+		},
+
+		HelpSynopsis:    pathHMACHelpSyn,
+		HelpDescription: pathHMACHelpDesc,
+	}
+}
+
+func (b *backend) pathHMACWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	ver := d.Get("key_version").(int)
+	algorithm := d.Get("algorithm").(string)
+	if urlAlgorithm := d.Get("urlalgorithm").(string); urlAlgorithm != "" {
+		algorithm = urlAlgorithm
+	}
+
+	items, err := parseBatchInput(d)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	batch := items != nil
+	if !batch {
+		items = []batchItem{{
+			Input: d.Get("input").(string),
+		}}
+	}
+
+	p, lock, err := b.lm.GetPolicyShared(req.Storage, name)
+	if lock != nil {
+		defer lock.RUnlock()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("policy not found"), logical.ErrInvalidRequest
+	}
+
+	return processBatch(items, batch, func(item batchItem) (map[string]interface{}, error) {
+		if len(item.Input) == 0 {
+			return nil, errutil.UserError{Err: "missing input"}
+		}
+		input, err := base64.StdEncoding.DecodeString(item.Input)
+		if err != nil {
+			return nil, errutil.UserError{Err: "failed to base64-decode input"}
+		}
+
+		hmac, err := p.HMAC(ver, input, algorithm)
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string]interface{}{
+			"hmac": hmac,
+		}, nil
+	})
+}
+
+const pathHMACHelpSyn = `Generate an HMAC for input data using the named key`
+
+const pathHMACHelpDesc = `
+Generates an HMAC of the given base64-encoded input using the named key and
+hash algorithm. Each version of the key has its own HMAC key, and the HMAC is
+prefixed with the version used.
+
+Many inputs can be processed in a single request by giving a list of items in
+"batch_input", each holding an input. The HMACs are returned in
+"batch_results" in the same order, and items that fail hold their error in
+"error" instead.
+`
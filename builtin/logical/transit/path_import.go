@@ -0,0 +1,245 @@
+package transit
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// wrappingKeyPath is the storage path of the RSA key that key material is
+// wrapped with for import
+const wrappingKeyPath = "wrapping_key"
+
+func (b *backend) pathWrappingKey() *framework.Path {
+	return &framework.Path{
+		Pattern: "wrapping_key",
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.ReadOperation: b.pathWrappingKeyRead,
+		},
+
+		HelpSynopsis:    pathWrappingKeyHelpSyn,
+		HelpDescription: pathWrappingKeyHelpDesc,
+	}
+}
+
+func (b *backend) pathImport() *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/" + framework.GenericNameRegex("name") + "/import",
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the key",
+			},
+
+			"ciphertext": &framework.FieldSchema{
+				Type: framework.TypeString,
+				Description: `The base64-encoded key material, wrapped with the
+public key of the wrapping_key path.`,
+			},
+
+			"hash_function": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: "SHA256",
+				Description: `The hash function used for RSA-OAEP when wrapping
+the ephemeral AES key, one of "SHA1", "SHA224", "SHA256", "SHA384" and
+"SHA512". Defaults to "SHA256".`,
+			},
+
+			"type": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: keyTypeAESGCM,
+				Description: `The type of the key, one of the types of the keys
+path. Defaults to "aes-gcm".`,
+			},
+
+			"derived": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Description: "Enables key derivation mode.",
+			},
+
+			"convergent_encryption": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Whether to support convergent encryption. Requires
+derived to be set.`,
+			},
+
+			"exportable": &framework.FieldSchema{
+				Type:        framework.TypeBool,
+				Description: "Enables the export of the key material.",
+			},
+
+			"allow_rotation": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Whether the key can be rotated, generating new
+versions in Vault. Defaults to false.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathImportWrite,
+		},
+
+		HelpSynopsis:    pathImportHelpSyn,
+		HelpDescription: pathImportHelpDesc,
+	}
+}
+
+// wrappingKey returns the wrapping key of the mount, generating it on first
+// use
+func (b *backend) wrappingKey(storage logical.Storage) (*KeyEntry, error) {
+	b.wrappingKeyLock.Lock()
+	defer b.wrappingKeyLock.Unlock()
+
+	raw, err := storage.Get(wrappingKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	if raw != nil {
+		var entry KeyEntry
+		if err := jsonutil.DecodeJSON(raw.Value, &entry); err != nil {
+			return nil, err
+		}
+		return &entry, nil
+	}
+
+	entry, err := generateKeyEntry(keyTypeRSA4096)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := json.Marshal(&entry)
+	if err != nil {
+		return nil, err
+	}
+	err = storage.Put(&logical.StorageEntry{
+		Key:   wrappingKeyPath,
+		Value: buf,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (b *backend) pathWrappingKeyRead(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	entry, err := b.wrappingKey(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"public_key": entry.FormattedPublicKey,
+		},
+	}, nil
+}
+
+func (b *backend) pathImportWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	keyType := d.Get("type").(string)
+	derived := d.Get("derived").(bool)
+	convergent := d.Get("convergent_encryption").(bool)
+
+	if err := validateKeyOptions(keyType, derived, convergent); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	hashFunction := d.Get("hash_function").(string)
+	hash, ok := wrapHashFunctions[strings.ToUpper(hashFunction)]
+	if !ok {
+		return logical.ErrorResponse(fmt.Sprintf("unsupported hash function %s", hashFunction)), logical.ErrInvalidRequest
+	}
+	ciphertextRaw := d.Get("ciphertext").(string)
+	if len(ciphertextRaw) == 0 {
+		return logical.ErrorResponse("missing ciphertext"), logical.ErrInvalidRequest
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(ciphertextRaw)
+	if err != nil {
+		return logical.ErrorResponse("failed to base64-decode ciphertext"), logical.ErrInvalidRequest
+	}
+
+	wrappingKey, err := b.wrappingKey(req.Storage)
+	if err != nil {
+		return nil, err
+	}
+	material, err := unwrapKeyMaterial(wrappingKey.RSAKey, hash, ciphertext)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	// AES keys are imported as raw bytes, and signing keys as PKCS#8
+	// encoded private keys
+	var key interface{} = material
+	if keyType != keyTypeAESGCM {
+		key, err = parsePKCS8PrivateKey(material)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("failed to parse the private key: %v", err)), logical.ErrInvalidRequest
+		}
+	}
+	entry, err := newKeyEntry(keyType, key)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	p := &Policy{
+		Name:                     name,
+		Type:                     keyType,
+		Keys:                     KeyEntryMap{1: entry},
+		LatestVersion:            1,
+		MinDecryptionVersion:     1,
+		Derived:                  derived,
+		Exportable:               d.Get("exportable").(bool),
+		Imported:                 true,
+		AllowImportedKeyRotation: d.Get("allow_rotation").(bool),
+	}
+	if keyType == keyTypeAESGCM {
+		p.CipherMode = "aes-gcm"
+	}
+	if derived {
+		p.KDFMode = kdfMode
+		p.ConvergentEncryption = convergent
+		if convergent {
+			p.ConvergentVersion = convergentVersion
+		}
+	}
+
+	if err := b.lm.ImportPolicy(req.Storage, p); err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		default:
+			return nil, err
+		}
+	}
+
+	return nil, nil
+}
+
+const pathWrappingKeyHelpSyn = `Returns the public key to wrap key material with for import`
+
+const pathWrappingKeyHelpDesc = `
+Returns the PEM-encoded public key of the RSA-4096 wrapping key of the mount,
+which is generated on first use. Key material imported through the import
+path of the keys must be wrapped with it.
+`
+
+const pathImportHelpSyn = `Imports key material as a new named key`
+
+const pathImportHelpDesc = `
+Creates the named key from key material generated outside of Vault, such as in
+an HSM. The material is wrapped the way CKM_RSA_AES_KEY_WRAP does: an
+ephemeral AES-256 key is encrypted with RSA-OAEP under the public key of the
+wrapping_key path, followed by the key material wrapped with the ephemeral key
+using AES key wrap with padding (RFC 5649). AES keys are wrapped as raw bytes,
+and signing keys as PKCS#8 encoded private keys.
+
+Imported keys cannot be rotated unless allow_rotation is set, since new
+versions would be generated in Vault rather than imported.
+`
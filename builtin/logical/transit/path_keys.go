@@ -17,26 +17,38 @@ func (b *backend) pathKeys() *framework.Path {
 				Description: "Name of the key",
 			},
 
+			"type": &framework.FieldSchema{
+				Type:    framework.TypeString,
+				Default: keyTypeAESGCM,
+				Description: `The type of key to create. "aes-gcm" keys
+encrypt and decrypt, while "ecdsa-p256", "ed25519", "rsa-2048" and
+"rsa-4096" keys sign and verify. Defaults to "aes-gcm".`,
+			},
+
 			"derived": &framework.FieldSchema{
 				Type: framework.TypeBool,
 				Description: `Enables key derivation mode. This
 allows for per-transaction unique keys.`,
 			},
 
+			"exportable": &framework.FieldSchema{
+				Type: framework.TypeBool,
+				Description: `Enables the export of the key material through
+the export paths. Once enabled, it cannot be disabled.`,
+			},
+
 			"convergent_encryption": &framework.FieldSchema{
 				Type: framework.TypeBool,
 				Description: `Whether to support convergent encryption.
 This is only supported when using a key with
-key derivation enabled and will require all
-requests to carry both a context and 96-bit
-(12-byte) nonce. The given nonce will be used
-in place of a randomly generated nonce. As a
-result, when the same context and nonce are
-supplied, the same ciphertext is generated. It
-is *very important* when using this mode that
-you ensure that all nonces are unique for a
-given context. Failing to do so will severely
-impact the ciphertext's security.`,
+key derivation enabled. The nonce is derived
+from the plaintext and the context, so the
+same plaintext and context always give the
+same ciphertext. Keys created before Vault
+derived the nonce are convergent encryption
+version 1 keys, and require all requests to
+carry a 96-bit (12-byte) nonce, which must be
+unique for a given context.`,
 			},
 		},
 
@@ -56,12 +68,14 @@ func (b *backend) pathPolicyWrite(
 	name := d.Get("name").(string)
 	derived := d.Get("derived").(bool)
 	convergent := d.Get("convergent_encryption").(bool)
+	keyType := d.Get("type").(string)
+	exportable := d.Get("exportable").(bool)
 
-	if !derived && convergent {
-		return logical.ErrorResponse("convergent encryption requires derivation to be enabled"), nil
+	if err := validateKeyOptions(keyType, derived, convergent); err != nil {
+		return logical.ErrorResponse(err.Error()), nil
 	}
 
-	p, lock, upserted, err := b.lm.GetPolicyUpsert(req.Storage, name, derived, convergent)
+	p, lock, upserted, err := b.lm.GetPolicyUpsert(req.Storage, name, keyType, derived, convergent, exportable)
 	if lock != nil {
 		defer lock.RUnlock()
 	}
@@ -80,6 +94,21 @@ func (b *backend) pathPolicyWrite(
 	return nil, nil
 }
 
+// validateKeyOptions returns an error if keys of the type cannot be created
+// with the options
+func validateKeyOptions(keyType string, derived, convergent bool) error {
+	if !validKeyType(keyType) {
+		return fmt.Errorf("unknown key type %s", keyType)
+	}
+	if !derived && convergent {
+		return fmt.Errorf("convergent encryption requires derivation to be enabled")
+	}
+	if derived && keyType != keyTypeAESGCM {
+		return fmt.Errorf("key derivation is only supported by %s keys", keyTypeAESGCM)
+	}
+	return nil
+}
+
 func (b *backend) pathPolicyRead(
 	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
 	name := d.Get("name").(string)
@@ -98,17 +127,41 @@ func (b *backend) pathPolicyRead(
 	// Return the response
 	resp := &logical.Response{
 		Data: map[string]interface{}{
-			"name":                   p.Name,
-			"cipher_mode":            p.CipherMode,
-			"derived":                p.Derived,
-			"deletion_allowed":       p.DeletionAllowed,
-			"min_decryption_version": p.MinDecryptionVersion,
-			"latest_version":         p.LatestVersion,
+			"name":                      p.Name,
+			"type":                      p.KeyType(),
+			"cipher_mode":               p.CipherMode,
+			"derived":                   p.Derived,
+			"deletion_allowed":          p.DeletionAllowed,
+			"min_decryption_version":    p.MinDecryptionVersion,
+			"min_available_version":     p.MinAvailableVersion,
+			"latest_version":            p.LatestVersion,
+			"supports_encryption":       p.EncryptionSupported(),
+			"supports_signing":          p.SigningSupported(),
+			"exportable":                p.Exportable,
+			"imported":                  p.Imported,
+			"auto_rotate_period":        int64(p.AutoRotatePeriod.Seconds()),
+			"auto_rotate_keep_versions": p.AutoRotateKeepVersions,
 		},
 	}
 	if p.Derived {
 		resp.Data["kdf_mode"] = p.KDFMode
 		resp.Data["convergent_encryption"] = p.ConvergentEncryption
+		if p.ConvergentEncryption {
+			resp.Data["convergent_encryption_version"] = p.ConvergentVersion
+		}
+	}
+
+	// The public keys of signing keys are returned with their versions
+	if p.SigningSupported() {
+		retKeys := map[string]map[string]interface{}{}
+		for k, v := range p.Keys {
+			retKeys[strconv.Itoa(k)] = map[string]interface{}{
+				"creation_time": v.CreationTime,
+				"public_key":    v.FormattedPublicKey,
+			}
+		}
+		resp.Data["keys"] = retKeys
+		return resp, nil
 	}
 
 	retKeys := map[string]int64{}
@@ -138,5 +191,7 @@ const pathPolicyHelpSyn = `Managed named encryption keys`
 const pathPolicyHelpDesc = `
 This path is used to manage the named keys that are available.
 Doing a write with no value against a new named key will create
-it using a randomly generated key.
+it using a randomly generated key. The type of the key decides
+whether it encrypts or signs. Reading a signing key returns the
+public key of each of its versions.
 `
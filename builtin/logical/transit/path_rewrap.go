@@ -1,7 +1,6 @@
 package transit
 
 import (
-	"encoding/base64"
 	"fmt"
 
 	"github.com/hashicorp/vault/helper/errutil"
@@ -30,7 +29,7 @@ func (b *backend) pathRewrap() *framework.Path {
 
 			"nonce": &framework.FieldSchema{
 				Type:        framework.TypeString,
-				Description: "Nonce for when convergent encryption is used",
+				Description: "Nonce for when convergent encryption version 1 is used",
 			},
 		},
 
@@ -47,31 +46,17 @@ func (b *backend) pathRewrapWrite(
 	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
 	name := d.Get("name").(string)
 
-	value := d.Get("ciphertext").(string)
-	if len(value) == 0 {
-		return logical.ErrorResponse("missing ciphertext to decrypt"), logical.ErrInvalidRequest
+	items, err := parseBatchInput(d)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
 	}
-
-	var err error
-
-	// Decode the context if any
-	contextRaw := d.Get("context").(string)
-	var context []byte
-	if len(contextRaw) != 0 {
-		context, err = base64.StdEncoding.DecodeString(contextRaw)
-		if err != nil {
-			return logical.ErrorResponse("failed to base64-decode context"), logical.ErrInvalidRequest
-		}
-	}
-
-	// Decode the nonce if any
-	nonceRaw := d.Get("nonce").(string)
-	var nonce []byte
-	if len(nonceRaw) != 0 {
-		nonce, err = base64.StdEncoding.DecodeString(nonceRaw)
-		if err != nil {
-			return logical.ErrorResponse("failed to base64-decode nonce"), logical.ErrInvalidRequest
-		}
+	batch := items != nil
+	if !batch {
+		items = []batchItem{{
+			Ciphertext: d.Get("ciphertext").(string),
+			Context:    d.Get("context").(string),
+			Nonce:      d.Get("nonce").(string),
+		}}
 	}
 
 	// Get the policy
@@ -87,45 +72,35 @@ func (b *backend) pathRewrapWrite(
 		return logical.ErrorResponse("policy not found"), logical.ErrInvalidRequest
 	}
 
-	plaintext, err := p.Decrypt(context, nonce, value)
-	if err != nil {
-		switch err.(type) {
-		case errutil.UserError:
-			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
-		case errutil.InternalError:
-			return nil, err
-		default:
+	return processBatch(items, batch, func(item batchItem) (map[string]interface{}, error) {
+		if len(item.Ciphertext) == 0 {
+			return nil, errutil.UserError{Err: "missing ciphertext to decrypt"}
+		}
+		context, nonce, err := item.decode()
+		if err != nil {
 			return nil, err
 		}
-	}
 
-	if plaintext == "" {
-		return nil, fmt.Errorf("empty plaintext returned during rewrap")
-	}
-
-	ciphertext, err := p.Encrypt(context, nonce, plaintext)
-	if err != nil {
-		switch err.(type) {
-		case errutil.UserError:
-			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
-		case errutil.InternalError:
-			return nil, err
-		default:
+		plaintext, err := p.Decrypt(context, nonce, item.Ciphertext)
+		if err != nil {
 			return nil, err
 		}
-	}
+		if plaintext == "" {
+			return nil, fmt.Errorf("empty plaintext returned during rewrap")
+		}
 
-	if ciphertext == "" {
-		return nil, fmt.Errorf("empty ciphertext returned")
-	}
+		ciphertext, err := p.Encrypt(context, nonce, plaintext)
+		if err != nil {
+			return nil, err
+		}
+		if ciphertext == "" {
+			return nil, fmt.Errorf("empty ciphertext returned")
+		}
 
-	// Generate the response
-	resp := &logical.Response{
-		Data: map[string]interface{}{
+		return map[string]interface{}{
 			"ciphertext": ciphertext,
-		},
-	}
-	return resp, nil
+		}, nil
+	})
 }
 
 const pathRewrapHelpSyn = `Rewrap ciphertext`
@@ -135,4 +110,7 @@ After key rotation, this function can be used to rewrap the
 given ciphertext with the latest version of the named key.
 If the given ciphertext is already using the latest version
 of the key, this function is a no-op.
+
+Many ciphertexts can be rewrapped in a single request by giving
+a list of items in "batch_input", as for decryption.
 `
@@ -40,6 +40,10 @@ func (b *backend) pathRotateWrite(
 		return logical.ErrorResponse("key not found"), logical.ErrInvalidRequest
 	}
 
+	if p.Imported && !p.AllowImportedKeyRotation {
+		return logical.ErrorResponse("imported key does not allow rotation"), logical.ErrInvalidRequest
+	}
+
 	// Rotate the policy
 	err = p.rotate(req.Storage)
 
@@ -0,0 +1,218 @@
+package transit
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+// signingFields are the fields shared by the sign and verify paths
+func signingFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"name": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "Name of the key",
+		},
+
+		"input": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: "The base64-encoded input data",
+		},
+
+		"hash_algorithm": &framework.FieldSchema{
+			Type:    framework.TypeString,
+			Default: "sha2-256",
+			Description: `Hash algorithm to use, one of "sha2-224", "sha2-256",
+"sha2-384" and "sha2-512". It can also be given in the URL. Ignored by
+ed25519 keys. Defaults to "sha2-256".`,
+		},
+
+		"urlalgorithm": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: `Hash algorithm to use, given in the URL`,
+		},
+
+		"prehashed": &framework.FieldSchema{
+			Type: framework.TypeBool,
+			Description: `If true, the input is already the digest made with
+the hash algorithm, and is not hashed again. Not supported by ed25519 keys.`,
+		},
+
+		"signature_algorithm": &framework.FieldSchema{
+			Type:    framework.TypeString,
+			Default: "pss",
+			Description: `The signature algorithm of RSA keys, "pss" or
+"pkcs1v15". Defaults to "pss".`,
+		},
+
+		"marshaling_algorithm": &framework.FieldSchema{
+			Type:    framework.TypeString,
+			Default: "asn1",
+			Description: `The encoding of the signatures of ECDSA keys, "asn1"
+for DER encoded signatures or "jws" for the fixed length, base64url encoded
+signatures of JSON Web Signatures. Defaults to "asn1".`,
+		},
+	}
+}
+
+func (b *backend) pathSign() *framework.Path {
+	fields := signingFields()
+	fields["key_version"] = &framework.FieldSchema{
+		Type: framework.TypeInt,
+		Description: `The version of the key to sign with. Defaults to the
+latest version.`,
+	}
+
+	return &framework.Path{
+		Pattern: "sign/" + framework.GenericNameRegex("name") + framework.OptionalParamRegex("urlalgorithm"),
+		Fields:  fields,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathSignWrite,
+		},
+
+		HelpSynopsis:    pathSignHelpSyn,
+		HelpDescription: pathSignHelpDesc,
+	}
+}
+
+func (b *backend) pathVerify() *framework.Path {
+	fields := signingFields()
+	fields["signature"] = &framework.FieldSchema{
+		Type:        framework.TypeString,
+		Description: "The signature, as returned by the sign path",
+	}
+
+	return &framework.Path{
+		Pattern: "verify/" + framework.GenericNameRegex("name") + framework.OptionalParamRegex("urlalgorithm"),
+		Fields:  fields,
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathVerifyWrite,
+		},
+
+		HelpSynopsis:    pathVerifyHelpSyn,
+		HelpDescription: pathVerifyHelpDesc,
+	}
+}
+
+// signingRequest reads the input and signing options of a sign or verify
+// request
+func signingRequest(d *framework.FieldData) ([]byte, *SigningOptions, error) {
+	inputRaw := d.Get("input").(string)
+	if len(inputRaw) == 0 {
+		return nil, nil, fmt.Errorf("missing input")
+	}
+	input, err := base64.StdEncoding.DecodeString(inputRaw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to base64-decode input")
+	}
+
+	hashAlgorithm := d.Get("hash_algorithm").(string)
+	if urlAlgorithm := d.Get("urlalgorithm").(string); urlAlgorithm != "" {
+		hashAlgorithm = urlAlgorithm
+	}
+
+	return input, &SigningOptions{
+		HashAlgorithm:       hashAlgorithm,
+		Prehashed:           d.Get("prehashed").(bool),
+		SignatureAlgorithm:  d.Get("signature_algorithm").(string),
+		MarshalingAlgorithm: d.Get("marshaling_algorithm").(string),
+	}, nil
+}
+
+func (b *backend) pathSignWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	input, opts, err := signingRequest(d)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	p, lock, err := b.lm.GetPolicyShared(req.Storage, name)
+	if lock != nil {
+		defer lock.RUnlock()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("policy not found"), logical.ErrInvalidRequest
+	}
+
+	signature, err := p.Sign(d.Get("key_version").(int), input, opts)
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		default:
+			return nil, err
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"signature": signature,
+		},
+	}, nil
+}
+
+func (b *backend) pathVerifyWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+	input, opts, err := signingRequest(d)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	signature := d.Get("signature").(string)
+	if len(signature) == 0 {
+		return logical.ErrorResponse("missing signature"), logical.ErrInvalidRequest
+	}
+
+	p, lock, err := b.lm.GetPolicyShared(req.Storage, name)
+	if lock != nil {
+		defer lock.RUnlock()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("policy not found"), logical.ErrInvalidRequest
+	}
+
+	valid, err := p.Verify(input, signature, opts)
+	if err != nil {
+		switch err.(type) {
+		case errutil.UserError:
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		default:
+			return nil, err
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"valid": valid,
+		},
+	}, nil
+}
+
+const pathSignHelpSyn = `Generate a signature for input data using the named key`
+
+const pathSignHelpDesc = `
+Generates a signature of the given base64-encoded input using the named key,
+which must be a signing key. Unless the input is prehashed, it is hashed with
+the hash algorithm first. The signature is prefixed with the version of the
+key used, which can be pinned with key_version.
+`
+
+const pathVerifyHelpSyn = `Verify a signature for input data created using the named key`
+
+const pathVerifyHelpDesc = `
+Verifies a signature of the given base64-encoded input using the named key
+and the version of it given in the signature. The hash, signature and
+marshaling algorithms must match the ones used for signing.
+`
@@ -0,0 +1,79 @@
+package transit
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/logical/framework"
+)
+
+func (b *backend) pathTrim() *framework.Path {
+	return &framework.Path{
+		Pattern: "keys/" + framework.GenericNameRegex("name") + "/trim",
+		Fields: map[string]*framework.FieldSchema{
+			"name": &framework.FieldSchema{
+				Type:        framework.TypeString,
+				Description: "Name of the key",
+			},
+
+			"min_available_version": &framework.FieldSchema{
+				Type: framework.TypeInt,
+				Description: `The minimum version of the key to keep. Older
+versions are permanently deleted. Cannot be greater than the minimum
+decryption version.`,
+			},
+		},
+
+		Callbacks: map[logical.Operation]framework.OperationFunc{
+			logical.UpdateOperation: b.pathTrimWrite,
+		},
+
+		HelpSynopsis:    pathTrimHelpSyn,
+		HelpDescription: pathTrimHelpDesc,
+	}
+}
+
+func (b *backend) pathTrimWrite(
+	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	name := d.Get("name").(string)
+
+	p, lock, err := b.lm.GetPolicyExclusive(req.Storage, name)
+	if lock != nil {
+		defer lock.Unlock()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return logical.ErrorResponse("key not found"), logical.ErrInvalidRequest
+	}
+
+	minAvailableVersion := d.Get("min_available_version").(int)
+	switch {
+	case minAvailableVersion < 1:
+		return logical.ErrorResponse("min available version must be at least 1"), logical.ErrInvalidRequest
+	case minAvailableVersion < p.MinAvailableVersion:
+		return logical.ErrorResponse(
+				fmt.Sprintf("cannot set min available version of %d, versions before %d have already been trimmed", minAvailableVersion, p.MinAvailableVersion)),
+			logical.ErrInvalidRequest
+	case minAvailableVersion > p.MinDecryptionVersion:
+		return logical.ErrorResponse(
+				fmt.Sprintf("cannot set min available version of %d, min decryption version is %d", minAvailableVersion, p.MinDecryptionVersion)),
+			logical.ErrInvalidRequest
+	case minAvailableVersion == p.MinAvailableVersion:
+		return nil, nil
+	}
+
+	return nil, p.trim(req.Storage, minAvailableVersion)
+}
+
+const pathTrimHelpSyn = `Trim old versions of the named key`
+
+const pathTrimHelpDesc = `
+This path is used to permanently delete the versions of the named key older
+than min_available_version, reclaiming the storage of keys that are rotated
+often. Only versions below the minimum decryption version can be trimmed, and
+the minimum decryption version cannot be lowered below the trimmed versions
+afterwards. Data encrypted with trimmed versions can no longer be decrypted,
+so it should be rewrapped first.
+`
@@ -1,16 +1,30 @@
 package transit
 
 import (
+	"crypto"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	_ "crypto/sha512"
+	"crypto/x509"
+	"encoding/asn1"
 	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"fmt"
+	"math/big"
 	"strconv"
 	"strings"
 	"time"
 
+	"golang.org/x/crypto/ed25519"
+
+	"github.com/armon/go-metrics"
 	uuid "github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/helper/jsonutil"
@@ -23,12 +37,85 @@ const (
 	kdfMode = "hmac-sha256-counter"
 
 	ErrTooOld = "ciphertext version is disallowed by policy (too old)"
+
+	// convergentVersion is the version of convergent encryption of new keys
+	convergentVersion = 2
+
+	ErrSignatureTooOld = "signature version is disallowed by policy (too old)"
+)
+
+// The types of keys. AES keys are used for encryption, and the others for
+// signing.
+const (
+	keyTypeAESGCM    = "aes-gcm"
+	keyTypeECDSAP256 = "ecdsa-p256"
+	keyTypeEd25519   = "ed25519"
+	keyTypeRSA2048   = "rsa-2048"
+	keyTypeRSA4096   = "rsa-4096"
 )
 
+// validKeyType returns whether keys of the type can be created
+func validKeyType(keyType string) bool {
+	switch keyType {
+	case keyTypeAESGCM, keyTypeECDSAP256, keyTypeEd25519, keyTypeRSA2048, keyTypeRSA4096:
+		return true
+	}
+	return false
+}
+
+// hashAlgorithms are the hash algorithms available for signing, by name
+var hashAlgorithms = map[string]crypto.Hash{
+	"sha2-224": crypto.SHA224,
+	"sha2-256": crypto.SHA256,
+	"sha2-384": crypto.SHA384,
+	"sha2-512": crypto.SHA512,
+}
+
+// SigningOptions are the options of signing and verifying. The hash
+// algorithm is ignored by Ed25519 keys, the signature algorithm only applies
+// to RSA keys and the marshaling algorithm only to ECDSA keys.
+type SigningOptions struct {
+	// HashAlgorithm names the hash algorithm, such as "sha2-256"
+	HashAlgorithm string
+
+	// Prehashed is true if the input is already a digest made with the
+	// hash algorithm
+	Prehashed bool
+
+	// SignatureAlgorithm is "pss" or "pkcs1v15"
+	SignatureAlgorithm string
+
+	// MarshalingAlgorithm is "asn1" for DER encoded signatures, or "jws"
+	// for the fixed length signatures of JSON Web Signatures
+	MarshalingAlgorithm string
+}
+
+// ecdsaSignature is the ASN.1 structure of ECDSA signatures
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
 // KeyEntry stores the key and metadata
 type KeyEntry struct {
+	// Key is the AES key, or the private key of Ed25519 keys
 	Key          []byte `json:"key"`
 	CreationTime int64  `json:"creation_time"`
+
+	// HMACKey is the key of HMACs made with the version. Versions created
+	// before HMACs were added have none.
+	HMACKey []byte `json:"hmac_key,omitempty"`
+
+	// The private key of ECDSA keys
+	ECX *big.Int `json:"ec_x,omitempty"`
+	ECY *big.Int `json:"ec_y,omitempty"`
+	ECD *big.Int `json:"ec_d,omitempty"`
+
+	// The private key of RSA keys
+	RSAKey *rsa.PrivateKey `json:"rsa_key,omitempty"`
+
+	// FormattedPublicKey is the public key of asymmetric keys, PEM encoded
+	// for ECDSA and RSA keys and base64 encoded for Ed25519 keys
+	FormattedPublicKey string `json:"public_key,omitempty"`
 }
 
 // KeyEntryMap is used to allow JSON marshal/unmarshal
@@ -67,6 +154,10 @@ type Policy struct {
 	Keys       KeyEntryMap `json:"keys"`
 	CipherMode string      `json:"cipher"`
 
+	// The type of the key. Keys created before types were added have none,
+	// and are AES keys.
+	Type string `json:"type"`
+
 	// Derived keys MUST provide a context and the master underlying key is
 	// never used. If convergent encryption is true, the context will be used
 	// as the nonce as well.
@@ -74,6 +165,11 @@ type Policy struct {
 	KDFMode              string `json:"kdf_mode"`
 	ConvergentEncryption bool   `json:"convergent_encryption"`
 
+	// The version of convergent encryption. Version 1 keys use the nonce
+	// given with each request, while later versions derive the nonce from
+	// the plaintext and store it in the ciphertext.
+	ConvergentVersion int `json:"convergent_version"`
+
 	// The minimum version of the key allowed to be used
 	// for decryption
 	MinDecryptionVersion int `json:"min_decryption_version"`
@@ -87,6 +183,28 @@ type Policy struct {
 
 	// Whether the key is allowed to be deleted
 	DeletionAllowed bool `json:"deletion_allowed"`
+
+	// Whether the key material can be exported. Once set, it cannot be
+	// unset.
+	Exportable bool `json:"exportable"`
+
+	// Whether the key material was imported rather than generated, and
+	// whether such a key can be rotated, which generates a new version
+	Imported                 bool `json:"imported"`
+	AllowImportedKeyRotation bool `json:"allow_imported_key_rotation"`
+
+	// The age of the latest version after which the key is rotated by the
+	// periodic function of the backend, or 0 to disable automatic rotation
+	AutoRotatePeriod time.Duration `json:"auto_rotate_period"`
+
+	// The number of the latest versions that remain decryptable after an
+	// automatic rotation, or 0 to leave the minimum decryption version as is
+	AutoRotateKeepVersions int `json:"auto_rotate_keep_versions"`
+
+	// The oldest version of the key that has not been trimmed. Older versions
+	// are deleted from the archive, so the minimum decryption version cannot
+	// be set below it.
+	MinAvailableVersion int `json:"min_available_version"`
 }
 
 // ArchivedKeys stores old keys. This is used to keep the key loading time sane
@@ -210,6 +328,31 @@ func (p *Policy) handleArchiving(storage logical.Storage) error {
 	return nil
 }
 
+// trim permanently deletes the versions of the key older than the minimum
+// available version, which must not be above the minimum decryption version.
+// Since older versions are only held in the archive, they are deleted from it
+// once the new minimum is persisted.
+func (p *Policy) trim(storage logical.Storage, minAvailableVersion int) error {
+	if minAvailableVersion > p.MinDecryptionVersion {
+		return fmt.Errorf("minimum available version of %d is greater than the minimum decryption version %d",
+			minAvailableVersion, p.MinDecryptionVersion)
+	}
+
+	p.MinAvailableVersion = minAvailableVersion
+	if err := p.Persist(storage); err != nil {
+		return err
+	}
+
+	archive, err := p.loadArchive(storage)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < minAvailableVersion && i < len(archive.Keys); i++ {
+		archive.Keys[i] = KeyEntry{}
+	}
+	return p.storeArchive(archive, storage)
+}
+
 func (p *Policy) Persist(storage logical.Storage) error {
 	err := p.handleArchiving(storage)
 	if err != nil {
@@ -260,6 +403,12 @@ func (p *Policy) needsUpgrade() bool {
 		return true
 	}
 
+	// Convergent keys created before convergent encryption was versioned
+	// use the nonces given with requests
+	if p.ConvergentEncryption && p.ConvergentVersion == 0 {
+		return true
+	}
+
 	return false
 }
 
@@ -289,6 +438,13 @@ func (p *Policy) upgrade(storage logical.Storage) error {
 		persistNeeded = true
 	}
 
+	// Convergent keys created before convergent encryption was versioned
+	// use the nonces given with requests
+	if p.ConvergentEncryption && p.ConvergentVersion == 0 {
+		p.ConvergentVersion = 1
+		persistNeeded = true
+	}
+
 	if persistNeeded {
 		err := p.Persist(storage)
 		if err != nil {
@@ -299,6 +455,28 @@ func (p *Policy) upgrade(storage logical.Storage) error {
 	return nil
 }
 
+// KeyType returns the type of the key
+func (p *Policy) KeyType() string {
+	if p.Type == "" {
+		return keyTypeAESGCM
+	}
+	return p.Type
+}
+
+// EncryptionSupported returns whether the key can encrypt and decrypt
+func (p *Policy) EncryptionSupported() bool {
+	return p.KeyType() == keyTypeAESGCM
+}
+
+// SigningSupported returns whether the key can sign and verify
+func (p *Policy) SigningSupported() bool {
+	switch p.KeyType() {
+	case keyTypeECDSAP256, keyTypeEd25519, keyTypeRSA2048, keyTypeRSA4096:
+		return true
+	}
+	return false
+}
+
 // DeriveKey is used to derive the encryption key that should
 // be used depending on the policy. If derivation is disabled the
 // raw key is used and no context is required, otherwise the KDF
@@ -333,6 +511,10 @@ func (p *Policy) DeriveKey(context []byte, ver int) ([]byte, error) {
 }
 
 func (p *Policy) Encrypt(context, nonce []byte, value string) (string, error) {
+	if !p.EncryptionSupported() {
+		return "", errutil.UserError{Err: fmt.Sprintf("keys of type %s do not support encryption", p.KeyType())}
+	}
+
 	// Decode the plaintext value
 	plaintext, err := base64.StdEncoding.DecodeString(value)
 	if err != nil {
@@ -364,11 +546,21 @@ func (p *Policy) Encrypt(context, nonce []byte, value string) (string, error) {
 		return "", errutil.InternalError{Err: err.Error()}
 	}
 
-	if p.ConvergentEncryption {
+	switch {
+	case p.ConvergentEncryption && p.ConvergentVersion == 1:
 		if len(nonce) != gcm.NonceSize() {
 			return "", errutil.UserError{Err: fmt.Sprintf("base64-decoded nonce must be %d bytes long when using convergent encryption with this key", gcm.NonceSize())}
 		}
-	} else {
+	case p.ConvergentEncryption:
+		// The nonce is derived from the plaintext, so that the same
+		// plaintext and context always give the same ciphertext
+		if len(nonce) != 0 {
+			return "", errutil.UserError{Err: "a nonce cannot be given with this key, which derives it from the plaintext"}
+		}
+		nonceHMAC := hmac.New(sha256.New, key)
+		nonceHMAC.Write(plaintext)
+		nonce = nonceHMAC.Sum(nil)[:gcm.NonceSize()]
+	default:
 		// Compute random nonce
 		nonce, err = uuid.GenerateRandomBytes(gcm.NonceSize())
 		if err != nil {
@@ -379,9 +571,10 @@ func (p *Policy) Encrypt(context, nonce []byte, value string) (string, error) {
 	// Encrypt and tag with GCM
 	out := gcm.Seal(nil, nonce, plaintext, nil)
 
-	// Place the encrypted data after the nonce
+	// Place the encrypted data after the nonce, unless the nonce is given
+	// with each request
 	full := out
-	if !p.ConvergentEncryption {
+	if !p.ConvergentEncryption || p.ConvergentVersion > 1 {
 		full = append(nonce, out...)
 	}
 
@@ -395,12 +588,17 @@ func (p *Policy) Encrypt(context, nonce []byte, value string) (string, error) {
 }
 
 func (p *Policy) Decrypt(context, nonce []byte, value string) (string, error) {
+	if !p.EncryptionSupported() {
+		return "", errutil.UserError{Err: fmt.Sprintf("keys of type %s do not support decryption", p.KeyType())}
+	}
+
 	// Verify the prefix
 	if !strings.HasPrefix(value, "vault:v") {
 		return "", errutil.UserError{Err: "invalid ciphertext: no prefix"}
 	}
 
-	if p.ConvergentEncryption && (nonce == nil || len(nonce) == 0) {
+	nonceGiven := p.ConvergentEncryption && p.ConvergentVersion == 1
+	if nonceGiven && len(nonce) == 0 {
 		return "", errutil.UserError{Err: "invalid convergent nonce supplied"}
 	}
 
@@ -428,6 +626,12 @@ func (p *Policy) Decrypt(context, nonce []byte, value string) (string, error) {
 		return "", errutil.UserError{Err: ErrTooOld}
 	}
 
+	// Count the ciphertexts of old versions, which remain to be rewrapped
+	// before the minimum decryption version can be advanced
+	if ver < p.LatestVersion {
+		metrics.IncrCounter([]string{"transit", "decrypt", "old_version", p.Name}, 1)
+	}
+
 	// Derive the key that should be used
 	key, err := p.DeriveKey(context, ver)
 	if err != nil {
@@ -461,9 +665,12 @@ func (p *Policy) Decrypt(context, nonce []byte, value string) (string, error) {
 
 	// Extract the nonce and ciphertext
 	var ciphertext []byte
-	if p.ConvergentEncryption {
+	if nonceGiven {
 		ciphertext = decoded
 	} else {
+		if len(decoded) < gcm.NonceSize() {
+			return "", errutil.UserError{Err: "invalid ciphertext: too short"}
+		}
 		nonce = decoded[:gcm.NonceSize()]
 		ciphertext = decoded[gcm.NonceSize():]
 	}
@@ -485,19 +692,13 @@ func (p *Policy) rotate(storage logical.Storage) error {
 		p.Keys = KeyEntryMap{}
 	}
 
-	// Generate a 256bit key
-	newKey := make([]byte, 32)
-	_, err := rand.Read(newKey)
+	entry, err := generateKeyEntry(p.KeyType())
 	if err != nil {
 		return err
 	}
 
 	p.LatestVersion += 1
-
-	p.Keys[p.LatestVersion] = KeyEntry{
-		Key:          newKey,
-		CreationTime: time.Now().Unix(),
-	}
+	p.Keys[p.LatestVersion] = entry
 
 	// This ensures that with new key creations min decryption version is set
 	// to 1 rather than the int default of 0, since keys start at 1 (either
@@ -511,6 +712,37 @@ func (p *Policy) rotate(storage logical.Storage) error {
 	return p.Persist(storage)
 }
 
+// needsAutoRotation returns whether the latest version of the key is older
+// than its automatic rotation period
+func (p *Policy) needsAutoRotation(now time.Time) bool {
+	if p.AutoRotatePeriod == 0 || (p.Imported && !p.AllowImportedKeyRotation) {
+		return false
+	}
+	latest, ok := p.Keys[p.LatestVersion]
+	if !ok {
+		return false
+	}
+	return now.Sub(time.Unix(latest.CreationTime, 0)) >= p.AutoRotatePeriod
+}
+
+// autoRotate rotates the key and advances the minimum decryption version so
+// that only the configured number of latest versions remain decryptable
+func (p *Policy) autoRotate(storage logical.Storage) error {
+	if err := p.rotate(storage); err != nil {
+		return err
+	}
+
+	if p.AutoRotateKeepVersions == 0 {
+		return nil
+	}
+	minDecryptionVersion := p.LatestVersion - p.AutoRotateKeepVersions + 1
+	if minDecryptionVersion <= p.MinDecryptionVersion {
+		return nil
+	}
+	p.MinDecryptionVersion = minDecryptionVersion
+	return p.Persist(storage)
+}
+
 func (p *Policy) migrateKeyToKeysMap() {
 	p.Keys = KeyEntryMap{
 		1: KeyEntry{
@@ -520,3 +752,341 @@ func (p *Policy) migrateKeyToKeysMap() {
 	}
 	p.Key = nil
 }
+
+// generateKeyEntry generates a new key of the type
+func generateKeyEntry(keyType string) (KeyEntry, error) {
+	var key interface{}
+	var err error
+	switch keyType {
+	case keyTypeAESGCM:
+		// Generate a 256bit key
+		aesKey := make([]byte, 32)
+		_, err = rand.Read(aesKey)
+		key = aesKey
+	case keyTypeECDSAP256:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case keyTypeEd25519:
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+	case keyTypeRSA2048:
+		key, err = rsa.GenerateKey(rand.Reader, 2048)
+	case keyTypeRSA4096:
+		key, err = rsa.GenerateKey(rand.Reader, 4096)
+	default:
+		return KeyEntry{}, fmt.Errorf("unsupported key type %s", keyType)
+	}
+	if err != nil {
+		return KeyEntry{}, err
+	}
+	return newKeyEntry(keyType, key)
+}
+
+// newKeyEntry returns a key entry holding the key, which is the []byte of
+// AES keys or the private key of signing keys, along with a new HMAC key. It
+// returns an error if the key does not match the key type.
+func newKeyEntry(keyType string, key interface{}) (KeyEntry, error) {
+	entry := KeyEntry{
+		CreationTime: time.Now().Unix(),
+		HMACKey:      make([]byte, 32),
+	}
+	if _, err := rand.Read(entry.HMACKey); err != nil {
+		return entry, err
+	}
+
+	var publicKey interface{}
+	switch key := key.(type) {
+	case []byte:
+		if keyType != keyTypeAESGCM || len(key) != 32 {
+			return entry, fmt.Errorf("%s keys must be 32 bytes long", keyTypeAESGCM)
+		}
+		entry.Key = key
+		return entry, nil
+
+	case *ecdsa.PrivateKey:
+		if keyType != keyTypeECDSAP256 {
+			return entry, fmt.Errorf("ECDSA private keys cannot be used as %s keys", keyType)
+		}
+		if key.Curve != elliptic.P256() {
+			return entry, fmt.Errorf("only ECDSA private keys on the P-256 curve are supported")
+		}
+		entry.ECX, entry.ECY, entry.ECD = key.X, key.Y, key.D
+		publicKey = &key.PublicKey
+
+	case ed25519.PrivateKey:
+		if keyType != keyTypeEd25519 {
+			return entry, fmt.Errorf("ed25519 private keys cannot be used as %s keys", keyType)
+		}
+		entry.Key = key
+		entry.FormattedPublicKey = base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+		return entry, nil
+
+	case *rsa.PrivateKey:
+		bits := key.N.BitLen()
+		if !(keyType == keyTypeRSA2048 && bits == 2048) && !(keyType == keyTypeRSA4096 && bits == 4096) {
+			return entry, fmt.Errorf("%d-bit RSA private keys cannot be used as %s keys", bits, keyType)
+		}
+		if err := key.Validate(); err != nil {
+			return entry, err
+		}
+		key.Precompute()
+		entry.RSAKey = key
+		publicKey = &key.PublicKey
+
+	default:
+		return entry, fmt.Errorf("unsupported key %T", key)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return entry, err
+	}
+	entry.FormattedPublicKey = string(pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: der,
+	}))
+	return entry, nil
+}
+
+// privateKey returns the key held by the entry of a key of the type: the
+// []byte of AES keys, or the private key of signing keys
+func (entry KeyEntry) privateKey(keyType string) interface{} {
+	switch keyType {
+	case keyTypeECDSAP256:
+		return &ecdsa.PrivateKey{
+			PublicKey: ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     entry.ECX,
+				Y:     entry.ECY,
+			},
+			D: entry.ECD,
+		}
+	case keyTypeEd25519:
+		return ed25519.PrivateKey(entry.Key)
+	case keyTypeRSA2048, keyTypeRSA4096:
+		return entry.RSAKey
+	}
+	return entry.Key
+}
+
+// signingKeyEntry returns the given version of the key for signing, or the
+// latest version if ver is 0
+func (p *Policy) signingKeyEntry(ver int) (int, KeyEntry, error) {
+	if !p.SigningSupported() {
+		return 0, KeyEntry{}, errutil.UserError{Err: fmt.Sprintf("keys of type %s do not support signing", p.KeyType())}
+	}
+	if ver == 0 {
+		ver = p.LatestVersion
+	}
+	if ver < 0 || ver > p.LatestVersion {
+		return 0, KeyEntry{}, errutil.UserError{Err: "invalid key version"}
+	}
+	if ver < p.MinDecryptionVersion {
+		return 0, KeyEntry{}, errutil.UserError{Err: ErrSignatureTooOld}
+	}
+	entry, ok := p.Keys[ver]
+	if !ok {
+		return 0, KeyEntry{}, errutil.InternalError{Err: fmt.Sprintf("version %d of the key is missing", ver)}
+	}
+	return ver, entry, nil
+}
+
+// digest returns the digest of the input to sign or verify. Prehashed input
+// is returned as is, once its length is checked.
+func digest(input []byte, opts *SigningOptions) (crypto.Hash, []byte, error) {
+	hash, ok := hashAlgorithms[opts.HashAlgorithm]
+	if !ok {
+		return 0, nil, errutil.UserError{Err: fmt.Sprintf("unsupported hash algorithm %s", opts.HashAlgorithm)}
+	}
+	if opts.Prehashed {
+		if len(input) != hash.Size() {
+			return 0, nil, errutil.UserError{Err: fmt.Sprintf("prehashed input must be %d bytes long for %s", hash.Size(), opts.HashAlgorithm)}
+		}
+		return hash, input, nil
+	}
+	h := hash.New()
+	h.Write(input)
+	return hash, h.Sum(nil), nil
+}
+
+// Sign signs the input with the given version of the key, or the latest
+// version if ver is 0. The signature is prefixed with the version of the key
+// like ciphertexts are.
+func (p *Policy) Sign(ver int, input []byte, opts *SigningOptions) (string, error) {
+	ver, entry, err := p.signingKeyEntry(ver)
+	if err != nil {
+		return "", err
+	}
+
+	var sig []byte
+	encoding := base64.StdEncoding
+	switch p.KeyType() {
+	case keyTypeECDSAP256:
+		_, sum, err := digest(input, opts)
+		if err != nil {
+			return "", err
+		}
+		key := entry.privateKey(keyTypeECDSAP256).(*ecdsa.PrivateKey)
+		r, s, err := ecdsa.Sign(rand.Reader, key, sum)
+		if err != nil {
+			return "", errutil.InternalError{Err: err.Error()}
+		}
+		switch opts.MarshalingAlgorithm {
+		case "asn1":
+			sig, err = asn1.Marshal(ecdsaSignature{R: r, S: s})
+			if err != nil {
+				return "", errutil.InternalError{Err: err.Error()}
+			}
+		case "jws":
+			size := (key.Curve.Params().BitSize + 7) / 8
+			sig = make([]byte, 2*size)
+			rBytes, sBytes := r.Bytes(), s.Bytes()
+			copy(sig[size-len(rBytes):size], rBytes)
+			copy(sig[2*size-len(sBytes):], sBytes)
+			encoding = base64.RawURLEncoding
+		default:
+			return "", errutil.UserError{Err: fmt.Sprintf("unsupported marshaling algorithm %s", opts.MarshalingAlgorithm)}
+		}
+
+	case keyTypeEd25519:
+		if opts.Prehashed {
+			return "", errutil.UserError{Err: "prehashed input is not supported by ed25519 keys"}
+		}
+		sig = ed25519.Sign(ed25519.PrivateKey(entry.Key), input)
+
+	case keyTypeRSA2048, keyTypeRSA4096:
+		hash, sum, err := digest(input, opts)
+		if err != nil {
+			return "", err
+		}
+		switch opts.SignatureAlgorithm {
+		case "pss":
+			sig, err = rsa.SignPSS(rand.Reader, entry.RSAKey, hash, sum, &rsa.PSSOptions{
+				SaltLength: rsa.PSSSaltLengthEqualsHash,
+			})
+		case "pkcs1v15":
+			sig, err = rsa.SignPKCS1v15(rand.Reader, entry.RSAKey, hash, sum)
+		default:
+			return "", errutil.UserError{Err: fmt.Sprintf("unsupported signature algorithm %s", opts.SignatureAlgorithm)}
+		}
+		if err != nil {
+			return "", errutil.InternalError{Err: err.Error()}
+		}
+	}
+
+	return "vault:v" + strconv.Itoa(ver) + ":" + encoding.EncodeToString(sig), nil
+}
+
+// Verify returns whether the signature made by Sign is valid for the input
+func (p *Policy) Verify(input []byte, signature string, opts *SigningOptions) (bool, error) {
+	if !strings.HasPrefix(signature, "vault:v") {
+		return false, errutil.UserError{Err: "invalid signature: no prefix"}
+	}
+	splitVerSignature := strings.SplitN(strings.TrimPrefix(signature, "vault:v"), ":", 2)
+	if len(splitVerSignature) != 2 {
+		return false, errutil.UserError{Err: "invalid signature: wrong number of fields"}
+	}
+	ver, err := strconv.Atoi(splitVerSignature[0])
+	if err != nil || ver == 0 {
+		return false, errutil.UserError{Err: "invalid signature: version number could not be decoded"}
+	}
+	ver, entry, err := p.signingKeyEntry(ver)
+	if err != nil {
+		return false, err
+	}
+
+	encoding := base64.StdEncoding
+	if p.KeyType() == keyTypeECDSAP256 && opts.MarshalingAlgorithm == "jws" {
+		encoding = base64.RawURLEncoding
+	}
+	sig, err := encoding.DecodeString(splitVerSignature[1])
+	if err != nil {
+		return false, errutil.UserError{Err: "invalid signature: could not decode base64"}
+	}
+
+	switch p.KeyType() {
+	case keyTypeECDSAP256:
+		_, sum, err := digest(input, opts)
+		if err != nil {
+			return false, err
+		}
+		var esig ecdsaSignature
+		switch opts.MarshalingAlgorithm {
+		case "asn1":
+			rest, err := asn1.Unmarshal(sig, &esig)
+			if err != nil || len(rest) != 0 {
+				return false, errutil.UserError{Err: "invalid signature: could not decode asn1"}
+			}
+		case "jws":
+			size := (elliptic.P256().Params().BitSize + 7) / 8
+			if len(sig) != 2*size {
+				return false, errutil.UserError{Err: "invalid signature: wrong length"}
+			}
+			esig.R = new(big.Int).SetBytes(sig[:size])
+			esig.S = new(big.Int).SetBytes(sig[size:])
+		default:
+			return false, errutil.UserError{Err: fmt.Sprintf("unsupported marshaling algorithm %s", opts.MarshalingAlgorithm)}
+		}
+		key := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     entry.ECX,
+			Y:     entry.ECY,
+		}
+		return ecdsa.Verify(key, sum, esig.R, esig.S), nil
+
+	case keyTypeEd25519:
+		if opts.Prehashed {
+			return false, errutil.UserError{Err: "prehashed input is not supported by ed25519 keys"}
+		}
+		key := ed25519.PrivateKey(entry.Key).Public().(ed25519.PublicKey)
+		return ed25519.Verify(key, input, sig), nil
+
+	case keyTypeRSA2048, keyTypeRSA4096:
+		hash, sum, err := digest(input, opts)
+		if err != nil {
+			return false, err
+		}
+		switch opts.SignatureAlgorithm {
+		case "pss":
+			err = rsa.VerifyPSS(&entry.RSAKey.PublicKey, hash, sum, sig, &rsa.PSSOptions{
+				SaltLength: rsa.PSSSaltLengthAuto,
+			})
+		case "pkcs1v15":
+			err = rsa.VerifyPKCS1v15(&entry.RSAKey.PublicKey, hash, sum, sig)
+		default:
+			return false, errutil.UserError{Err: fmt.Sprintf("unsupported signature algorithm %s", opts.SignatureAlgorithm)}
+		}
+		return err == nil, nil
+	}
+
+	return false, nil
+}
+
+// HMAC returns the HMAC of the input made with the given version of the key,
+// or the latest version if ver is 0. The HMAC is prefixed with the version of
+// the key like ciphertexts are.
+func (p *Policy) HMAC(ver int, input []byte, hashAlgorithm string) (string, error) {
+	if ver == 0 {
+		ver = p.LatestVersion
+	}
+	if ver < 0 || ver > p.LatestVersion {
+		return "", errutil.UserError{Err: "invalid key version"}
+	}
+	if ver < p.MinDecryptionVersion {
+		return "", errutil.UserError{Err: "key version is disallowed by policy (too old)"}
+	}
+	entry, ok := p.Keys[ver]
+	if !ok {
+		return "", errutil.InternalError{Err: fmt.Sprintf("version %d of the key is missing", ver)}
+	}
+	if len(entry.HMACKey) == 0 {
+		return "", errutil.UserError{Err: fmt.Sprintf("version %d of the key predates HMAC support; rotate the key to use it", ver)}
+	}
+
+	hash, ok := hashAlgorithms[hashAlgorithm]
+	if !ok {
+		return "", errutil.UserError{Err: fmt.Sprintf("unsupported hash algorithm %s", hashAlgorithm)}
+	}
+	mac := hmac.New(hash.New, entry.HMACKey)
+	mac.Write(input)
+
+	return "vault:v" + strconv.Itoa(ver) + ":" + base64.StdEncoding.EncodeToString(mac.Sum(nil)), nil
+}
@@ -20,9 +20,46 @@ func Test_KeyUpgrade(t *testing.T) {
 	testKeyUpgradeCommon(t, newLockManager(true))
 }
 
+func Test_ConvergentVersionUpgrade(t *testing.T) {
+	storage := &logical.InmemStorage{}
+	lm := newLockManager(true)
+	p, lock, _, err := lm.GetPolicyUpsert(storage, "test", keyTypeAESGCM, true, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.RUnlock()
+	if p.ConvergentVersion != convergentVersion {
+		t.Fatalf("bad: new key has convergent version %d", p.ConvergentVersion)
+	}
+
+	// Keys stored before convergent encryption was versioned are upgraded
+	// to version 1, which takes the nonces from requests
+	p.ConvergentVersion = 0
+	buf, err := p.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = storage.Put(&logical.StorageEntry{
+		Key:   "policy/" + p.Name,
+		Value: buf,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, lock, err = lm.GetPolicyShared(storage, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lock.RUnlock()
+	if p.ConvergentVersion != 1 {
+		t.Fatalf("bad: upgraded key has convergent version %d", p.ConvergentVersion)
+	}
+}
+
 func testKeyUpgradeCommon(t *testing.T, lm *lockManager) {
 	storage := &logical.InmemStorage{}
-	p, lock, upserted, err := lm.GetPolicyUpsert(storage, "test", false, false)
+	p, lock, upserted, err := lm.GetPolicyUpsert(storage, "test", keyTypeAESGCM, false, false, false)
 	if lock != nil {
 		defer lock.RUnlock()
 	}
@@ -68,7 +105,7 @@ func testArchivingUpgradeCommon(t *testing.T, lm *lockManager) {
 
 	storage := &logical.InmemStorage{}
 
-	p, lock, _, err := lm.GetPolicyUpsert(storage, "test", false, false)
+	p, lock, _, err := lm.GetPolicyUpsert(storage, "test", keyTypeAESGCM, false, false, false)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -198,7 +235,7 @@ func testArchivingCommon(t *testing.T, lm *lockManager) {
 
 	storage := &logical.InmemStorage{}
 
-	p, lock, _, err := lm.GetPolicyUpsert(storage, "test", false, false)
+	p, lock, _, err := lm.GetPolicyUpsert(storage, "test", keyTypeAESGCM, false, false, false)
 	if lock != nil {
 		defer lock.RUnlock()
 	}
@@ -4,6 +4,8 @@ import (
 	"os"
 
 	auditFile "github.com/hashicorp/vault/builtin/audit/file"
+	auditKafka "github.com/hashicorp/vault/builtin/audit/kafka"
+	auditSocket "github.com/hashicorp/vault/builtin/audit/socket"
 	auditSyslog "github.com/hashicorp/vault/builtin/audit/syslog"
 	"github.com/hashicorp/vault/command/server"
 	"github.com/hashicorp/vault/version"
@@ -19,6 +21,7 @@ import (
 	"github.com/hashicorp/vault/builtin/logical/aws"
 	"github.com/hashicorp/vault/builtin/logical/cassandra"
 	"github.com/hashicorp/vault/builtin/logical/consul"
+	"github.com/hashicorp/vault/builtin/logical/kv"
 	"github.com/hashicorp/vault/builtin/logical/mongodb"
 	"github.com/hashicorp/vault/builtin/logical/mssql"
 	"github.com/hashicorp/vault/builtin/logical/mysql"
@@ -26,6 +29,7 @@ import (
 	"github.com/hashicorp/vault/builtin/logical/postgresql"
 	"github.com/hashicorp/vault/builtin/logical/rabbitmq"
 	"github.com/hashicorp/vault/builtin/logical/ssh"
+	"github.com/hashicorp/vault/builtin/logical/transform"
 	"github.com/hashicorp/vault/builtin/logical/transit"
 
 	"github.com/hashicorp/vault/audit"
@@ -63,6 +67,8 @@ func Commands(metaPtr *meta.Meta) map[string]cli.CommandFactory {
 				Meta: *metaPtr,
 				AuditBackends: map[string]audit.Factory{
 					"file":   auditFile.Factory,
+					"kafka":  auditKafka.Factory,
+					"socket": auditSocket.Factory,
 					"syslog": auditSyslog.Factory,
 				},
 				CredentialBackends: map[string]logical.Factory{
@@ -86,6 +92,8 @@ func Commands(metaPtr *meta.Meta) map[string]cli.CommandFactory {
 					"mysql":      mysql.Factory,
 					"ssh":        ssh.Factory,
 					"rabbitmq":   rabbitmq.Factory,
+					"kv":         kv.Factory,
+					"transform":  transform.Factory,
 				},
 				ShutdownCh:  command.MakeShutdownCh(),
 				SighupCh:    command.MakeSighupCh(),
@@ -249,6 +257,18 @@ func Commands(metaPtr *meta.Meta) map[string]cli.CommandFactory {
 			}, nil
 		},
 
+		"operator migrate": func() (cli.Command, error) {
+			return &command.OperatorMigrateCommand{
+				Meta: *metaPtr,
+			}, nil
+		},
+
+		"operator inspect-storage": func() (cli.Command, error) {
+			return &command.OperatorInspectStorageCommand{
+				Meta: *metaPtr,
+			}, nil
+		},
+
 		"mount": func() (cli.Command, error) {
 			return &command.MountCommand{
 				Meta: *metaPtr,
@@ -23,7 +23,7 @@ func (c *InitCommand) Run(args []string) int {
 	var threshold, shares, storedShares, recoveryThreshold, recoveryShares int
 	var pgpKeys, recoveryPgpKeys pgpkeys.PubKeyFilesFlag
 	var auto, check bool
-	var consulServiceName string
+	var consulServiceName, barrierCipher string
 	flags := c.Meta.FlagSet("init", meta.FlagSetDefault)
 	flags.Usage = func() { c.Ui.Error(c.Help()) }
 	flags.IntVar(&shares, "key-shares", 5, "")
@@ -33,6 +33,7 @@ func (c *InitCommand) Run(args []string) int {
 	flags.IntVar(&recoveryShares, "recovery-shares", 5, "")
 	flags.IntVar(&recoveryThreshold, "recovery-threshold", 3, "")
 	flags.Var(&recoveryPgpKeys, "recovery-pgp-keys", "")
+	flags.StringVar(&barrierCipher, "barrier-cipher", "", "")
 	flags.BoolVar(&check, "check", false, "")
 	flags.BoolVar(&auto, "auto", false, "")
 	flags.StringVar(&consulServiceName, "consul-service", physical.DefaultServiceName, "")
@@ -48,6 +49,7 @@ func (c *InitCommand) Run(args []string) int {
 		RecoveryShares:    recoveryShares,
 		RecoveryThreshold: recoveryThreshold,
 		RecoveryPGPKeys:   recoveryPgpKeys,
+		BarrierCipher:     barrierCipher,
 	}
 
 	// If running in 'auto' mode, run service discovery based on environment
@@ -313,6 +315,11 @@ Init Options:
   -recovery-pgp-keys		If provided, behaves like "pgp-keys" but for the
 				recovery key shares. This is not normally available.
 
+  -barrier-cipher=aes-gcm	The cipher used to encrypt data in the barrier,
+				either "aes-gcm" or "chacha20-poly1305". The
+				latter is faster on platforms without AES hardware
+				support. It cannot be changed after initialization.
+
   -auto				If set, performs service discovery using Consul. When 
 				all the nodes of a Vault cluster are registered with
 				Consul, setting this flag will trigger service discovery
@@ -35,6 +35,8 @@ func (c *KeyStatusCommand) Run(args []string) int {
 
 	c.Ui.Output(fmt.Sprintf("Key Term: %d", status.Term))
 	c.Ui.Output(fmt.Sprintf("Installation Time: %v", status.InstallTime))
+	c.Ui.Output(fmt.Sprintf("Encryptions: %d", status.Encryptions))
+	c.Ui.Output(fmt.Sprintf("Cipher: %s", status.Cipher))
 	return 0
 }
 
@@ -0,0 +1,222 @@
+package command
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/vault/command/server"
+	"github.com/hashicorp/vault/helper/compressutil"
+	"github.com/hashicorp/vault/helper/flag-slice"
+	"github.com/hashicorp/vault/helper/password"
+	"github.com/hashicorp/vault/meta"
+	"github.com/hashicorp/vault/vault"
+)
+
+// OperatorInspectStorageCommand is a Command that decrypts entries of a
+// storage snapshot offline, without starting a server.
+type OperatorInspectStorageCommand struct {
+	meta.Meta
+
+	// logger is used by the seal and the in-memory storage, and discards
+	// their output if nil
+	logger *log.Logger
+}
+
+func (c *OperatorInspectStorageCommand) Run(args []string) int {
+	var snapshotPath, configPath string
+	var keys sliceflag.StringFlag
+	var list bool
+	flags := c.Meta.FlagSet("operator inspect-storage", meta.FlagSetNone)
+	flags.StringVar(&snapshotPath, "snapshot", "", "")
+	flags.StringVar(&configPath, "config", "", "")
+	flags.Var(&keys, "key", "")
+	flags.BoolVar(&list, "list", false, "")
+	flags.Usage = func() { c.Ui.Error(c.Help()) }
+	if err := flags.Parse(args); err != nil {
+		return 1
+	}
+
+	paths := flags.Args()
+	if snapshotPath == "" {
+		c.Ui.Error("The -snapshot flag is required")
+		flags.Usage()
+		return 1
+	}
+	if len(paths) == 0 {
+		c.Ui.Error("At least one storage path is required")
+		flags.Usage()
+		return 1
+	}
+
+	var sealConfig *server.Seal
+	if configPath != "" {
+		config, err := server.LoadConfig(configPath)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error loading configuration from %s: %s", configPath, err))
+			return 1
+		}
+		sealConfig = config.Seal
+	}
+	seal, err := newSeal(sealConfig)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error initializing seal of type %s: %s", sealConfig.Type, err))
+		return 1
+	}
+	defer func() {
+		if err := seal.Finalize(); err != nil {
+			c.Ui.Error(fmt.Sprintf("Error finalizing seal: %s", err))
+		}
+	}()
+
+	logger := c.logger
+	if logger == nil {
+		logger = log.New(ioutil.Discard, "", 0)
+	}
+	f, err := os.Open(snapshotPath)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error opening snapshot: %s", err))
+		return 1
+	}
+	inspector, err := vault.NewStorageInspector(f, seal, logger)
+	f.Close()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error loading snapshot: %s", err))
+		return 1
+	}
+
+	keyConfig, err := inspector.KeyConfig()
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error reading the seal configuration: %s", err))
+		return 1
+	}
+	for len(keys) < keyConfig.SecretThreshold {
+		fmt.Printf("Key %d of %d (will be hidden): ", len(keys)+1, keyConfig.SecretThreshold)
+		value, err := password.Read(os.Stdin)
+		fmt.Printf("\n")
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf(
+				"Error attempting to ask for a key: %s\n\n"+
+					"If this command is not run from a terminal, the keys can be\n"+
+					"given with the -key flag instead.", err))
+			return 1
+		}
+		keys = append(keys, value)
+	}
+
+	min, max := inspector.BarrierKeyLength()
+	decoded := make([][]byte, 0, len(keys))
+	for _, value := range keys {
+		key, err := decodeKey(strings.TrimSpace(value), min, max)
+		if err != nil {
+			c.Ui.Error(err.Error())
+			return 1
+		}
+		decoded = append(decoded, key)
+	}
+	if err := inspector.Unseal(decoded); err != nil {
+		c.Ui.Error(fmt.Sprintf("Error unsealing the snapshot: %s", err))
+		return 1
+	}
+
+	for _, path := range paths {
+		if len(paths) > 1 {
+			c.Ui.Output(fmt.Sprintf("==> %s", path))
+		}
+
+		if list {
+			entries, err := inspector.List(path)
+			if err != nil {
+				c.Ui.Error(fmt.Sprintf("Error listing %s: %s", path, err))
+				return 1
+			}
+			for _, entry := range entries {
+				c.Ui.Output(entry)
+			}
+			continue
+		}
+
+		entry, err := inspector.Get(path)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf("Error reading %s: %s", path, err))
+			return 1
+		}
+		if entry == nil {
+			c.Ui.Error(fmt.Sprintf("No entry found at %s", path))
+			return 1
+		}
+
+		// Entries such as the mount table may be stored compressed
+		value := entry.Value
+		if len(value) > 0 {
+			decompressed, notCompressed, err := compressutil.Decompress(value)
+			if err != nil {
+				c.Ui.Error(fmt.Sprintf("Error decompressing %s: %s", path, err))
+				return 1
+			}
+			if !notCompressed {
+				value = decompressed
+			}
+		}
+		c.Ui.Output(string(value))
+	}
+	return 0
+}
+
+// decodeKey decodes a key share, which is hex or base64 encoded. Hex is
+// only accepted for the length of a share, so that a base64 string that is
+// also valid hex is decoded as base64.
+func decodeKey(value string, min, max int) ([]byte, error) {
+	key, err := hex.DecodeString(value)
+	if err == nil && len(key) >= min && len(key) <= max {
+		return key, nil
+	}
+	key, err = base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("Keys must be valid hex or base64 strings")
+	}
+	return key, nil
+}
+
+func (c *OperatorInspectStorageCommand) Synopsis() string {
+	return "Decrypts entries of a storage snapshot offline"
+}
+
+func (c *OperatorInspectStorageCommand) Help() string {
+	helpText := `
+Usage: vault operator inspect-storage [options] path...
+
+  Decrypt and print the entries at the given storage paths of a storage
+  snapshot, such as core/mounts for the mount table. This helps recovering
+  from corrupted data without starting a Vault server.
+
+  The snapshot is read in memory and never modified. Its entries are
+  decrypted with the unseal keys, which are asked for unless given with
+  -key. For a snapshot of a Vault using an auto seal, the recovery keys are
+  given instead, and -config must point to a server configuration with the
+  seal block, since the seal decrypts the barrier with its stored keys.
+
+  Paths are storage paths, not API paths: the data of a mount is found
+  under logical/ followed by the UUID of the mount, as listed in the mount
+  table.
+
+Inspect Options:
+
+  -snapshot=path          The storage snapshot to read. Required.
+
+  -config=path            A server configuration file whose seal block is
+                          used to decrypt a snapshot taken with an auto seal.
+
+  -key=key                An unseal key, or a recovery key with an auto seal,
+                          hex or base64 encoded. Can be given once per key.
+                          The missing keys are asked for.
+
+  -list                   List the keys under the given paths instead of
+                          printing their values.
+`
+	return strings.TrimSpace(helpText)
+}
@@ -0,0 +1,62 @@
+package command
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/meta"
+	"github.com/hashicorp/vault/vault"
+	"github.com/mitchellh/cli"
+)
+
+func TestOperatorInspectStorageCommand_implements(t *testing.T) {
+	var _ cli.Command = &OperatorInspectStorageCommand{}
+}
+
+func TestOperatorInspectStorage(t *testing.T) {
+	core, key, _ := vault.TestCoreUnsealed(t)
+
+	dir, err := ioutil.TempDir("", "vault-inspect")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	snapshotPath := filepath.Join(dir, "snapshot.tar.gz")
+	if err := ioutil.WriteFile(snapshotPath, vault.TestCoreStorageSnapshot(t, core), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	run := func(args ...string) (int, *cli.MockUi) {
+		ui := new(cli.MockUi)
+		c := &OperatorInspectStorageCommand{Meta: meta.Meta{Ui: ui}}
+		return c.Run(append([]string{"-snapshot", snapshotPath}, args...)), ui
+	}
+
+	// The mount table is decompressed
+	code, ui := run("-key", hex.EncodeToString(key), "core/mounts")
+	if code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+	if !strings.Contains(ui.OutputWriter.String(), `"path":"secret/"`) {
+		t.Fatalf("bad: %s", ui.OutputWriter.String())
+	}
+
+	code, ui = run("-key", hex.EncodeToString(key), "-list", "core/")
+	if code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+	if !strings.Contains(ui.OutputWriter.String(), "mounts\n") {
+		t.Fatalf("bad: %s", ui.OutputWriter.String())
+	}
+
+	// A wrong key does not decrypt the snapshot
+	wrong := make([]byte, len(key))
+	code, ui = run("-key", hex.EncodeToString(wrong), "core/mounts")
+	if code == 0 || !strings.Contains(ui.ErrorWriter.String(), "Error unsealing") {
+		t.Fatalf("expected failure, got %d: %s", code, ui.ErrorWriter.String())
+	}
+}
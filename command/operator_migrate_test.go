@@ -0,0 +1,148 @@
+package command
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/meta"
+	"github.com/hashicorp/vault/physical"
+	"github.com/mitchellh/cli"
+)
+
+func TestOperatorMigrateCommand_implements(t *testing.T) {
+	var _ cli.Command = &OperatorMigrateCommand{}
+}
+
+func TestOperatorMigrate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-migrate")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	source, err := physical.NewBackend("file", nil, map[string]string{"path": filepath.Join(dir, "source")})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for i := 0; i < 50; i++ {
+		source.Put(&physical.Entry{Key: fmt.Sprintf("logical/%02d/value", i), Value: []byte{byte(i)}})
+	}
+	source.Put(&physical.Entry{Key: "core/keyring", Value: []byte("keyring")})
+	source.Put(&physical.Entry{Key: "core/lock", Value: []byte("lock")})
+
+	configPath := filepath.Join(dir, "migrate.hcl")
+	config := fmt.Sprintf(`
+storage_source "file" {
+  path = "%s"
+}
+
+storage_destination "file" {
+  path = "%s"
+}
+`, filepath.Join(dir, "source"), filepath.Join(dir, "dest"))
+	if err := ioutil.WriteFile(configPath, []byte(config), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	run := func(args ...string) (int, *cli.MockUi) {
+		ui := new(cli.MockUi)
+		c := &OperatorMigrateCommand{Meta: meta.Meta{Ui: ui}}
+		return c.Run(append([]string{"-config", configPath}, args...)), ui
+	}
+
+	// A dry run reports the keys without copying them
+	code, ui := run("-dry-run")
+	if code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+	if !strings.Contains(ui.OutputWriter.String(), "51 keys to copy") {
+		t.Fatalf("bad: %s", ui.OutputWriter.String())
+	}
+	dest, err := physical.NewBackend("file", nil, map[string]string{"path": filepath.Join(dir, "dest")})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if keys, _ := dest.List(""); len(keys) != 0 {
+		t.Fatalf("dry run wrote %v", keys)
+	}
+
+	// An interrupted migration resumes after the recorded progress
+	m := &migrator{source: source, dest: dest, maxParallel: 4, output: func(string) {}}
+	if err := m.storeProgress(&migrationProgress{LastKey: "logical/24/value"}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	code, ui = run("-max-parallel", "4")
+	if code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+	if !strings.Contains(ui.OutputWriter.String(), "Copied 25 keys") {
+		t.Fatalf("bad: %s", ui.OutputWriter.String())
+	}
+	if entry, _ := dest.Get("logical/10/value"); entry != nil {
+		t.Fatalf("copied key before the progress")
+	}
+
+	// Copying the rest from the start completes the migration
+	code, ui = run("-start", "core/")
+	if code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+	code, ui = run("-dry-run")
+	if code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+	if !strings.Contains(ui.OutputWriter.String(), "0 keys to copy") {
+		t.Fatalf("bad: %s", ui.OutputWriter.String())
+	}
+	for _, key := range []string{"core/lock", migrationProgressKey} {
+		if entry, _ := dest.Get(key); entry != nil {
+			t.Fatalf("unexpected key %s in destination", key)
+		}
+	}
+
+	// A destination with data is only copied over with -reset
+	code, ui = run()
+	if code == 0 || !strings.Contains(ui.ErrorWriter.String(), "not empty") {
+		t.Fatalf("expected failure, got %d: %s", code, ui.ErrorWriter.String())
+	}
+	code, ui = run("-reset")
+	if code != 0 {
+		t.Fatalf("bad: %d\n\n%s", code, ui.ErrorWriter.String())
+	}
+}
+
+func TestParseMigratorConfig(t *testing.T) {
+	config, err := parseMigratorConfig(`
+storage_source "consul" {
+  address = "127.0.0.1:8500"
+}
+
+storage_destination "postgresql" {
+  connection_url = "postgres://localhost/vault"
+}
+`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if config.Source.Type != "consul" || config.Source.Config["address"] != "127.0.0.1:8500" ||
+		config.Destination.Type != "postgresql" || config.Destination.Config["connection_url"] != "postgres://localhost/vault" {
+		t.Fatalf("bad: %#v %#v", config.Source, config.Destination)
+	}
+
+	for _, bad := range []string{
+		`storage_source "inmem" {}`,
+		`storage_source "file" { path = "a" }
+storage_destination "file" { path = "a" }`,
+		`storage_source "file" { path = "a" }
+storage_destination "file" { path = "b" }
+backend "inmem" {}`,
+	} {
+		if _, err := parseMigratorConfig(bad); err == nil {
+			t.Fatalf("expected error for %s", bad)
+		}
+	}
+}
@@ -22,12 +22,15 @@ import (
 	"github.com/armon/go-metrics/circonus"
 	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/go-multierror"
-	"github.com/hashicorp/logutils"
 	"github.com/hashicorp/vault/audit"
 	"github.com/hashicorp/vault/command/server"
 	"github.com/hashicorp/vault/helper/flag-slice"
 	"github.com/hashicorp/vault/helper/gated-writer"
+	"github.com/hashicorp/vault/helper/logutil"
+	"github.com/hashicorp/vault/helper/metricsutil"
 	"github.com/hashicorp/vault/helper/mlock"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/helper/tracing"
 	vaulthttp "github.com/hashicorp/vault/http"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/meta"
@@ -142,20 +145,34 @@ func (c *ServerCommand) Run(args []string) int {
 	}
 
 	// Create a logger. We wrap it in a gated writer so that it doesn't
-	// start logging too early.
+	// start logging too early. The router filters the output by level and
+	// can be reconfigured at runtime through sys/loggers.
 	logGate := &gatedwriter.Writer{Writer: os.Stderr}
-	c.logger = log.New(&logutils.LevelFilter{
-		Levels: []logutils.LogLevel{
-			"TRACE", "DEBUG", "INFO", "WARN", "ERR"},
-		MinLevel: logutils.LogLevel(strings.ToUpper(logLevel)),
-		Writer:   logGate,
-	}, "", log.LstdFlags)
-
-	if err := c.setupTelemetry(config); err != nil {
+	logRouter, err := logutil.NewRouter(logGate, logLevel)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf("Error initializing logging: %s", err))
+		return 1
+	}
+	defer logRouter.Close()
+	c.logger = log.New(logRouter, "", log.LstdFlags)
+
+	promSink, err := c.setupTelemetry(config)
+	if err != nil {
 		c.Ui.Error(fmt.Sprintf("Error initializing telemetry: %s", err))
 		return 1
 	}
 
+	if err := c.setupTracing(config); err != nil {
+		c.Ui.Error(fmt.Sprintf("Error initializing tracing: %s", err))
+		return 1
+	}
+	defer func() {
+		if tracer := tracing.GlobalTracer(); tracer != nil {
+			tracing.SetGlobalTracer(nil)
+			tracer.Shutdown()
+		}
+	}()
+
 	// Initialize the backend
 	backend, err := physical.NewBackend(
 		config.Backend.Type, c.logger, config.Backend.Config)
@@ -169,7 +186,13 @@ func (c *ServerCommand) Run(args []string) int {
 	infoKeys := make([]string, 0, 10)
 	info := make(map[string]string)
 
-	var seal vault.Seal = &vault.DefaultSeal{}
+	seal, err := newSeal(config.Seal)
+	if err != nil {
+		c.Ui.Error(fmt.Sprintf(
+			"Error initializing seal of type %s: %s",
+			config.Seal.Type, err))
+		return 1
+	}
 
 	// Ensure that the seal finalizer is called, even if using verify-only
 	defer func() {
@@ -190,9 +213,51 @@ func (c *ServerCommand) Run(args []string) int {
 		Logger:             c.logger,
 		DisableCache:       config.DisableCache,
 		DisableMlock:       config.DisableMlock,
+		LazyMounts:         config.LazyMounts,
+		LazyLeaseRestore:   config.LazyLeaseRestore,
+		EnableRaw:          config.EnableRawEndpoint,
+		MlockBestEffort:    config.MlockBestEffort,
+		MlockMinLimit:      uint64(config.MlockMinLimit),
 		MaxLeaseTTL:        config.MaxLeaseTTL,
 		DefaultLeaseTTL:    config.DefaultLeaseTTL,
 		ClusterName:        config.ClusterName,
+
+		ClusterForwardingCompression: config.ClusterForwardingCompression,
+		ClusterForwardingSigning:     config.ClusterForwardingSigning,
+		ClusterForwardingBatching:    config.ClusterForwardingBatching,
+		PerformanceStandby:           config.PerformanceStandby,
+		StorageCompression:           config.StorageCompression,
+		MaxRequestSize:               int64(config.MaxRequestSize),
+		PrometheusSink:               promSink,
+		LogRouter:                    logRouter,
+	}
+
+	if cache := config.Cache; cache != nil {
+		coreConfig.CacheSize = cache.Size
+		coreConfig.CacheMaxBytes = cache.MaxBytes
+		coreConfig.CacheTTL = cache.TTL
+		coreConfig.CacheDisableNegative = cache.DisableNegativeCaching
+		coreConfig.CacheBypassPrefixes = cache.BypassPrefixes
+	}
+
+	if st := config.StorageTimeouts; st != nil {
+		coreConfig.StorageTimeouts = &physical.TimeoutConfig{
+			Timeout:          st.Timeout,
+			MaxRetries:       st.MaxRetries,
+			RetryBudgetRatio: st.RetryBudgetRatio,
+			BreakerThreshold: st.BreakerThreshold,
+			BreakerCooldown:  st.BreakerCooldown,
+		}
+	}
+
+	if ac := config.AdmissionControl; ac != nil {
+		coreConfig.AdmissionControl = &vault.AdmissionControlConfig{
+			MaxInFlight:     ac.MaxInFlight,
+			QueueDepthRenew: ac.QueueDepthRenew,
+			QueueDepthRead:  ac.QueueDepthRead,
+			QueueDepthWrite: ac.QueueDepthWrite,
+			QueueTimeout:    ac.QueueTimeout,
+		}
 	}
 
 	var disableClustering bool
@@ -313,8 +378,16 @@ func (c *ServerCommand) Run(args []string) int {
 	info["mlock"] = fmt.Sprintf(
 		"supported: %v, enabled: %v",
 		mlock.Supported(), !config.DisableMlock)
+	if status := core.MlockStatus(); status != nil && status.Partial() {
+		info["mlock"] += ", partial: true"
+	}
 	infoKeys = append(infoKeys, "log level", "mlock", "backend")
 
+	if config.Seal != nil {
+		info["seal"] = config.Seal.Type
+		infoKeys = append(infoKeys, "seal")
+	}
+
 	if config.HABackend != nil {
 		info["HA backend"] = config.HABackend.Type
 		info["redirect address"] = coreConfig.RedirectAddr
@@ -344,6 +417,8 @@ func (c *ServerCommand) Run(args []string) int {
 
 	// Initialize the listeners
 	lns := make([]net.Listener, 0, len(config.Listeners))
+	handlerProps := make([]*vaulthttp.HandlerProperties, 0, len(config.Listeners))
+	httpServers := make([]*http.Server, 0, len(config.Listeners))
 	for i, lnConfig := range config.Listeners {
 		ln, props, reloadFunc, err := server.NewListener(lnConfig.Type, lnConfig.Config, logGate)
 		if err != nil {
@@ -355,6 +430,24 @@ func (c *ServerCommand) Run(args []string) int {
 
 		lns = append(lns, ln)
 
+		handlerProp, err := listenerHandlerProperties(lnConfig.Config, props)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf(
+				"Error configuring listener of type %s: %s",
+				lnConfig.Type, err))
+			return 1
+		}
+		handlerProps = append(handlerProps, handlerProp)
+
+		httpServer, err := server.NewHTTPServer(lnConfig.Config, props)
+		if err != nil {
+			c.Ui.Error(fmt.Sprintf(
+				"Error configuring listener of type %s: %s",
+				lnConfig.Type, err))
+			return 1
+		}
+		httpServers = append(httpServers, httpServer)
+
 		if reloadFunc != nil {
 			relSlice := c.ReloadFuncs["listener|"+lnConfig.Type]
 			relSlice = append(relSlice, reloadFunc)
@@ -497,11 +590,11 @@ func (c *ServerCommand) Run(args []string) int {
 		))
 	}
 
-	// Initialize the HTTP server
-	server := &http.Server{}
-	server.Handler = handler
-	for _, ln := range lns {
-		go server.Serve(ln)
+	// Start the HTTP servers, one per listener so that each can have its
+	// own handler properties and tuning
+	for i, ln := range lns {
+		httpServers[i].Handler = vaulthttp.HandlerWithProperties(core, handlerProps[i])
+		go httpServers[i].Serve(ln)
 	}
 
 	if newCoreError != nil {
@@ -698,8 +791,39 @@ func (c *ServerCommand) detectRedirect(detect physical.RedirectDetect,
 	return url.String(), nil
 }
 
-// setupTelemetry is used to setup the telemetry sub-systems
-func (c *ServerCommand) setupTelemetry(config *server.Config) error {
+// setupTracing is used to setup the tracing of requests, if configured
+func (c *ServerCommand) setupTracing(config *server.Config) error {
+	conf := config.Tracing
+	if conf == nil {
+		return nil
+	}
+
+	var exporter tracing.Exporter
+	switch conf.Exporter {
+	case "otlp":
+		exporter = tracing.NewOTLPExporter(conf.OTLPEndpoint, conf.OTLPHeaders)
+	case "stdout":
+		exporter = tracing.NewWriterExporter(os.Stdout)
+	default:
+		return fmt.Errorf("unknown exporter %q", conf.Exporter)
+	}
+
+	tracer, err := tracing.NewTracer(&tracing.TracerConfig{
+		ServiceName: conf.ServiceName,
+		SampleRatio: conf.SampleRatio,
+		Exporter:    exporter,
+		Logger:      c.logger,
+	})
+	if err != nil {
+		return err
+	}
+	tracing.SetGlobalTracer(tracer)
+	return nil
+}
+
+// setupTelemetry is used to setup the telemetry sub-systems. It returns
+// the sink whose metrics are served by sys/metrics.
+func (c *ServerCommand) setupTelemetry(config *server.Config) (*metricsutil.PrometheusSink, error) {
 	/* Setup telemetry
 	Aggregate on 10 second intervals for 1 minute. Expose the
 	metrics over stderr when there is a SIGUSR1 received.
@@ -722,7 +846,7 @@ func (c *ServerCommand) setupTelemetry(config *server.Config) error {
 	if telConfig.StatsiteAddr != "" {
 		sink, err := metrics.NewStatsiteSink(telConfig.StatsiteAddr)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		fanout = append(fanout, sink)
 	}
@@ -731,7 +855,7 @@ func (c *ServerCommand) setupTelemetry(config *server.Config) error {
 	if telConfig.StatsdAddr != "" {
 		sink, err := metrics.NewStatsdSink(telConfig.StatsdAddr)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		fanout = append(fanout, sink)
 	}
@@ -761,21 +885,128 @@ func (c *ServerCommand) setupTelemetry(config *server.Config) error {
 
 		sink, err := circonus.NewCirconusSink(cfg)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		sink.Start()
 		fanout = append(fanout, sink)
 	}
 
-	// Initialize the global sink
+	// Initialize the global sink. The Prometheus sink keeps cumulative
+	// values for sys/metrics, so it does not need the hostname in keys.
 	if len(fanout) > 0 {
 		fanout = append(fanout, inm)
-		metrics.NewGlobal(metricsConf, fanout)
 	} else {
 		metricsConf.EnableHostname = false
-		metrics.NewGlobal(metricsConf, inm)
+		fanout = metrics.FanoutSink{inm}
 	}
-	return nil
+	var hostname string
+	if metricsConf.EnableHostname {
+		hostname = metricsConf.HostName
+	}
+	promSink := metricsutil.NewPrometheusSink(hostname)
+	fanout = append(fanout, promSink)
+	metrics.NewGlobal(metricsConf, fanout)
+	return promSink, nil
+}
+
+// listenerHandlerProperties parses the options of a listener that
+// configure its HTTP handler. The options that are set are also added to
+// props, so that they are shown in the server information.
+func listenerHandlerProperties(config map[string]string, props map[string]string) (*vaulthttp.HandlerProperties, error) {
+	handlerProps := &vaulthttp.HandlerProperties{}
+
+	if v, ok := config["max_request_size"]; ok {
+		size, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid value for 'max_request_size': %q", v)
+		}
+		handlerProps.MaxRequestSize = size
+		props["max_request_size"] = v
+	}
+
+	rateLimits := []struct {
+		key   string
+		limit *vaulthttp.RateLimit
+	}{
+		{"rate_limit", &handlerProps.RateLimits.Listener},
+		{"rate_limit_per_client", &handlerProps.RateLimits.Client},
+		{"rate_limit_per_token", &handlerProps.RateLimits.Token},
+		{"rate_limit_per_mount", &handlerProps.RateLimits.Mount},
+	}
+	for _, rl := range rateLimits {
+		if v, ok := config[rl.key]; ok {
+			rate, err := strconv.ParseFloat(v, 64)
+			if err != nil || rate < 0 {
+				return nil, fmt.Errorf("invalid value for '%s': %q", rl.key, v)
+			}
+			rl.limit.Rate = rate
+			props[rl.key] = v
+		}
+
+		burstKey := rl.key + "_burst"
+		if v, ok := config[burstKey]; ok {
+			burst, err := strconv.Atoi(v)
+			if err != nil || burst < 0 {
+				return nil, fmt.Errorf("invalid value for '%s': %q", burstKey, v)
+			}
+			if rl.limit.Rate == 0 {
+				return nil, fmt.Errorf("'%s' requires '%s' to be set", burstKey, rl.key)
+			}
+			rl.limit.Burst = burst
+			props[burstKey] = v
+		}
+	}
+
+	if v, ok := config["x_forwarded_for_authorized_addrs"]; ok {
+		forwardedFor := &vaulthttp.ForwardedForConfig{
+			RejectNotAuthorized: true,
+			RejectNotPresent:    true,
+		}
+		for _, addr := range strutil.ParseStringSlice(v, ",") {
+			_, cidr, err := net.ParseCIDR(strings.TrimSpace(addr))
+			if err != nil {
+				return nil, fmt.Errorf("invalid CIDR block %q in 'x_forwarded_for_authorized_addrs': %v", addr, err)
+			}
+			forwardedFor.AuthorizedAddrs = append(forwardedFor.AuthorizedAddrs, cidr)
+		}
+		props["x_forwarded_for_authorized_addrs"] = v
+
+		if v, ok := config["x_forwarded_for_hop_skips"]; ok {
+			hopSkips, err := strconv.Atoi(v)
+			if err != nil || hopSkips < 0 {
+				return nil, fmt.Errorf("invalid value for 'x_forwarded_for_hop_skips': %q", v)
+			}
+			forwardedFor.HopSkips = hopSkips
+		}
+		if v, ok := config["x_forwarded_for_reject_not_authorized"]; ok {
+			reject, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for 'x_forwarded_for_reject_not_authorized': %q", v)
+			}
+			forwardedFor.RejectNotAuthorized = reject
+		}
+		if v, ok := config["x_forwarded_for_reject_not_present"]; ok {
+			reject, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value for 'x_forwarded_for_reject_not_present': %q", v)
+			}
+			forwardedFor.RejectNotPresent = reject
+		}
+
+		handlerProps.ForwardedFor = forwardedFor
+	} else {
+		for _, key := range []string{
+			"x_forwarded_for_hop_skips",
+			"x_forwarded_for_reject_not_authorized",
+			"x_forwarded_for_reject_not_present",
+		} {
+			if _, ok := config[key]; ok {
+				return nil, fmt.Errorf("'%s' requires 'x_forwarded_for_authorized_addrs' to be set", key)
+			}
+		}
+	}
+
+	return handlerProps, nil
 }
 
 func (c *ServerCommand) Reload(configPath []string) error {
@@ -818,6 +1049,28 @@ func (c *ServerCommand) Reload(configPath []string) error {
 	return reloadErrors.ErrorOrNil()
 }
 
+// newSeal returns the seal configured by the seal block of the server
+// configuration, or the default seal if there is none
+func newSeal(config *server.Seal) (vault.Seal, error) {
+	if config == nil {
+		return &vault.DefaultSeal{}, nil
+	}
+	switch config.Type {
+	case "awskms":
+		return vault.NewAWSKMSSeal(config.Config)
+	case "gcpckms":
+		return vault.NewGCPCKMSSeal(config.Config)
+	case "azurekeyvault":
+		return vault.NewAzureKeyVaultSeal(config.Config)
+	case "pkcs11":
+		return vault.NewPKCS11Seal(config.Config)
+	case "transit":
+		return vault.NewTransitSeal(config.Config)
+	default:
+		return nil, fmt.Errorf("unknown seal type")
+	}
+}
+
 func (c *ServerCommand) Synopsis() string {
 	return "Start a Vault server"
 }
@@ -24,9 +24,18 @@ type Config struct {
 	Listeners []*Listener `hcl:"-"`
 	Backend   *Backend    `hcl:"-"`
 	HABackend *Backend    `hcl:"-"`
+	Seal      *Seal       `hcl:"-"`
 
 	DisableCache bool `hcl:"disable_cache"`
 	DisableMlock bool `hcl:"disable_mlock"`
+	LazyMounts   bool `hcl:"lazy_mounts"`
+
+	LazyLeaseRestore bool `hcl:"lazy_lease_restore"`
+
+	EnableRawEndpoint bool `hcl:"raw_storage_endpoint"`
+
+	MlockBestEffort bool `hcl:"mlock_best_effort"`
+	MlockMinLimit   int  `hcl:"mlock_min_limit"`
 
 	Telemetry *Telemetry `hcl:"telemetry"`
 
@@ -36,13 +45,31 @@ type Config struct {
 	DefaultLeaseTTLRaw string        `hcl:"default_lease_ttl"`
 
 	ClusterName string `hcl:"cluster_name"`
+
+	ClusterForwardingCompression string `hcl:"cluster_forwarding_compression"`
+	ClusterForwardingSigning     bool   `hcl:"cluster_forwarding_signing"`
+	ClusterForwardingBatching    bool   `hcl:"cluster_forwarding_batching"`
+	PerformanceStandby           bool   `hcl:"performance_standby"`
+
+	StorageCompression string `hcl:"storage_compression"`
+
+	MaxRequestSize int `hcl:"max_request_size"`
+
+	AdmissionControl *AdmissionControl `hcl:"admission_control"`
+
+	Cache *Cache `hcl:"cache"`
+
+	StorageTimeouts *StorageTimeouts `hcl:"storage_timeouts"`
+
+	Tracing *Tracing `hcl:"tracing"`
 }
 
 // DevConfig is a Config that is used for dev mode of Vault.
 func DevConfig(ha bool) *Config {
 	ret := &Config{
-		DisableCache: false,
-		DisableMlock: true,
+		DisableCache:      false,
+		DisableMlock:      true,
+		EnableRawEndpoint: true,
 
 		Backend: &Backend{
 			Type: "inmem",
@@ -94,6 +121,16 @@ func (b *Backend) GoString() string {
 	return fmt.Sprintf("*%#v", *b)
 }
 
+// Seal is the seal configuration for the server.
+type Seal struct {
+	Type   string
+	Config map[string]string
+}
+
+func (s *Seal) GoString() string {
+	return fmt.Sprintf("*%#v", *s)
+}
+
 // Telemetry is the telemetry configuration for the server
 type Telemetry struct {
 	StatsiteAddr string `hcl:"statsite_address"`
@@ -170,6 +207,74 @@ func (s *Telemetry) GoString() string {
 	return fmt.Sprintf("*%#v", *s)
 }
 
+// AdmissionControl is the configuration of the admission control of
+// requests on the active node
+type AdmissionControl struct {
+	MaxInFlight     int `hcl:"max_in_flight"`
+	QueueDepthRenew int `hcl:"queue_depth_renew"`
+	QueueDepthRead  int `hcl:"queue_depth_read"`
+	QueueDepthWrite int `hcl:"queue_depth_write"`
+
+	QueueTimeout    time.Duration `hcl:"-"`
+	QueueTimeoutRaw string        `hcl:"queue_timeout"`
+}
+
+func (a *AdmissionControl) GoString() string {
+	return fmt.Sprintf("*%#v", *a)
+}
+
+// Cache is the configuration of the cache in front of the storage backend
+type Cache struct {
+	Size                   int      `hcl:"size"`
+	MaxBytes               int      `hcl:"max_bytes"`
+	DisableNegativeCaching bool     `hcl:"disable_negative_caching"`
+	BypassPrefixes         []string `hcl:"bypass_prefixes"`
+
+	TTL    time.Duration `hcl:"-"`
+	TTLRaw string        `hcl:"ttl"`
+}
+
+func (c *Cache) GoString() string {
+	return fmt.Sprintf("*%#v", *c)
+}
+
+// StorageTimeouts is the configuration of the timeouts, retries and circuit
+// breaker of the operations of the storage backend
+type StorageTimeouts struct {
+	MaxRetries       int     `hcl:"max_retries"`
+	RetryBudgetRatio float64 `hcl:"retry_budget_ratio"`
+	BreakerThreshold int     `hcl:"breaker_threshold"`
+
+	Timeout            time.Duration `hcl:"-"`
+	TimeoutRaw         string        `hcl:"timeout"`
+	BreakerCooldown    time.Duration `hcl:"-"`
+	BreakerCooldownRaw string        `hcl:"breaker_cooldown"`
+}
+
+func (s *StorageTimeouts) GoString() string {
+	return fmt.Sprintf("*%#v", *s)
+}
+
+// Tracing is the configuration of the tracing of requests
+type Tracing struct {
+	// Exporter is where spans are sent: "otlp" or "stdout"
+	Exporter string `hcl:"exporter"`
+
+	OTLPEndpoint string            `hcl:"otlp_endpoint"`
+	OTLPHeaders  map[string]string `hcl:"otlp_headers"`
+
+	ServiceName string `hcl:"service_name"`
+
+	// SampleRatioRaw is not a float64, as HCL only decodes float literals
+	// into floats and "sample_ratio = 1" should work
+	SampleRatio    float64     `hcl:"-"`
+	SampleRatioRaw interface{} `hcl:"sample_ratio"`
+}
+
+func (t *Tracing) GoString() string {
+	return fmt.Sprintf("*%#v", *t)
+}
+
 // Merge merges two configurations.
 func (c *Config) Merge(c2 *Config) *Config {
 	if c2 == nil {
@@ -194,6 +299,11 @@ func (c *Config) Merge(c2 *Config) *Config {
 		result.HABackend = c2.HABackend
 	}
 
+	result.Seal = c.Seal
+	if c2.Seal != nil {
+		result.Seal = c2.Seal
+	}
+
 	result.Telemetry = c.Telemetry
 	if c2.Telemetry != nil {
 		result.Telemetry = c2.Telemetry
@@ -210,6 +320,26 @@ func (c *Config) Merge(c2 *Config) *Config {
 		result.DisableMlock = c2.DisableMlock
 	}
 
+	result.LazyMounts = c.LazyMounts
+	if c2.LazyMounts {
+		result.LazyMounts = c2.LazyMounts
+	}
+
+	result.LazyLeaseRestore = c.LazyLeaseRestore
+	if c2.LazyLeaseRestore {
+		result.LazyLeaseRestore = c2.LazyLeaseRestore
+	}
+
+	result.EnableRawEndpoint = c.EnableRawEndpoint
+	if c2.EnableRawEndpoint {
+		result.EnableRawEndpoint = c2.EnableRawEndpoint
+	}
+
+	result.MlockBestEffort = c.MlockBestEffort
+	if c2.MlockBestEffort {
+		result.MlockBestEffort = c2.MlockBestEffort
+	}
+
 	// merge these integers via a MAX operation
 	result.MaxLeaseTTL = c.MaxLeaseTTL
 	if c2.MaxLeaseTTL > result.MaxLeaseTTL {
@@ -221,11 +351,66 @@ func (c *Config) Merge(c2 *Config) *Config {
 		result.DefaultLeaseTTL = c2.DefaultLeaseTTL
 	}
 
+	result.MlockMinLimit = c.MlockMinLimit
+	if c2.MlockMinLimit > result.MlockMinLimit {
+		result.MlockMinLimit = c2.MlockMinLimit
+	}
+
 	result.ClusterName = c.ClusterName
 	if c2.ClusterName != "" {
 		result.ClusterName = c2.ClusterName
 	}
 
+	result.ClusterForwardingCompression = c.ClusterForwardingCompression
+	if c2.ClusterForwardingCompression != "" {
+		result.ClusterForwardingCompression = c2.ClusterForwardingCompression
+	}
+
+	result.ClusterForwardingSigning = c.ClusterForwardingSigning
+	if c2.ClusterForwardingSigning {
+		result.ClusterForwardingSigning = c2.ClusterForwardingSigning
+	}
+
+	result.ClusterForwardingBatching = c.ClusterForwardingBatching
+	if c2.ClusterForwardingBatching {
+		result.ClusterForwardingBatching = c2.ClusterForwardingBatching
+	}
+
+	result.PerformanceStandby = c.PerformanceStandby
+	if c2.PerformanceStandby {
+		result.PerformanceStandby = c2.PerformanceStandby
+	}
+
+	result.StorageCompression = c.StorageCompression
+	if c2.StorageCompression != "" {
+		result.StorageCompression = c2.StorageCompression
+	}
+
+	result.MaxRequestSize = c.MaxRequestSize
+	if c2.MaxRequestSize != 0 {
+		result.MaxRequestSize = c2.MaxRequestSize
+	}
+
+	result.AdmissionControl = c.AdmissionControl
+	if c2.AdmissionControl != nil {
+		result.AdmissionControl = c2.AdmissionControl
+	}
+
+	result.Cache = c.Cache
+	if c2.Cache != nil {
+		result.Cache = c2.Cache
+	}
+
+	result.StorageTimeouts = c.StorageTimeouts
+	if c2.StorageTimeouts != nil {
+		result.StorageTimeouts = c2.StorageTimeouts
+	}
+
+	result.Tracing = c.Tracing
+	if c2.Tracing != nil {
+		result.Tracing = c2.Tracing
+	}
+
 	return result
 }
 
@@ -277,6 +462,12 @@ func ParseConfig(d string) (*Config, error) {
 			return nil, err
 		}
 	}
+	if result.MlockMinLimit < 0 {
+		return nil, fmt.Errorf("mlock_min_limit cannot be negative")
+	}
+	if result.MaxRequestSize < 0 {
+		return nil, fmt.Errorf("max_request_size cannot be negative")
+	}
 
 	list, ok := obj.Node.(*ast.ObjectList)
 	if !ok {
@@ -290,10 +481,26 @@ func ParseConfig(d string) (*Config, error) {
 		"listener",
 		"disable_cache",
 		"disable_mlock",
+		"lazy_mounts",
+		"lazy_lease_restore",
+		"raw_storage_endpoint",
+		"mlock_best_effort",
+		"mlock_min_limit",
 		"telemetry",
 		"default_lease_ttl",
 		"max_lease_ttl",
 		"cluster_name",
+		"cluster_forwarding_compression",
+		"cluster_forwarding_signing",
+		"cluster_forwarding_batching",
+		"performance_standby",
+		"storage_compression",
+		"max_request_size",
+		"admission_control",
+		"cache",
+		"storage_timeouts",
+		"tracing",
+		"seal",
 
 		// TODO: Remove in 0.6.0
 		// Deprecated keys
@@ -341,6 +548,12 @@ func ParseConfig(d string) (*Config, error) {
 		}
 	}
 
+	if o := list.Filter("seal"); len(o.Items) > 0 {
+		if err := parseSeal(&result, o); err != nil {
+			return nil, fmt.Errorf("error parsing 'seal': %s", err)
+		}
+	}
+
 	if o := list.Filter("listener"); len(o.Items) > 0 {
 		if err := parseListeners(&result, o); err != nil {
 			return nil, fmt.Errorf("error parsing 'listener': %s", err)
@@ -353,6 +566,30 @@ func ParseConfig(d string) (*Config, error) {
 		}
 	}
 
+	if o := list.Filter("cache"); len(o.Items) > 0 {
+		if err := parseCache(&result, o); err != nil {
+			return nil, fmt.Errorf("error parsing 'cache': %s", err)
+		}
+	}
+
+	if o := list.Filter("storage_timeouts"); len(o.Items) > 0 {
+		if err := parseStorageTimeouts(&result, o); err != nil {
+			return nil, fmt.Errorf("error parsing 'storage_timeouts': %s", err)
+		}
+	}
+
+	if o := list.Filter("admission_control"); len(o.Items) > 0 {
+		if err := parseAdmissionControl(&result, o); err != nil {
+			return nil, fmt.Errorf("error parsing 'admission_control': %s", err)
+		}
+	}
+
+	if o := list.Filter("tracing"); len(o.Items) > 0 {
+		if err := parseTracing(&result, o); err != nil {
+			return nil, fmt.Errorf("error parsing 'tracing': %s", err)
+		}
+	}
+
 	return &result, nil
 }
 
@@ -545,6 +782,31 @@ func parseHABackends(result *Config, list *ast.ObjectList) error {
 	return nil
 }
 
+func parseSeal(result *Config, list *ast.ObjectList) error {
+	if len(list.Items) > 1 {
+		return fmt.Errorf("only one 'seal' block is permitted")
+	}
+
+	// Get our item
+	item := list.Items[0]
+
+	key := "seal"
+	if len(item.Keys) > 0 {
+		key = item.Keys[0].Token.Value().(string)
+	}
+
+	var m map[string]string
+	if err := hcl.DecodeObject(&m, item.Val); err != nil {
+		return multierror.Prefix(err, fmt.Sprintf("seal.%s:", key))
+	}
+
+	result.Seal = &Seal{
+		Type:   strings.ToLower(key),
+		Config: m,
+	}
+	return nil
+}
+
 func parseListeners(result *Config, list *ast.ObjectList) error {
 	var foundAtlas bool
 
@@ -559,13 +821,36 @@ func parseListeners(result *Config, list *ast.ObjectList) error {
 			"address",
 			"cluster_address",
 			"endpoint",
+			"http_idle_timeout",
+			"http_keepalive_disable",
+			"http_read_timeout",
+			"http_write_timeout",
+			"http2_disable",
+			"http2_max_concurrent_streams",
 			"infrastructure",
+			"max_request_size",
 			"node_id",
+			"rate_limit",
+			"rate_limit_burst",
+			"rate_limit_per_client",
+			"rate_limit_per_client_burst",
+			"rate_limit_per_mount",
+			"rate_limit_per_mount_burst",
+			"rate_limit_per_token",
+			"rate_limit_per_token_burst",
+			"socket_group",
+			"socket_mode",
+			"socket_user",
+			"tcp_keepalive_period",
 			"tls_disable",
 			"tls_cert_file",
 			"tls_key_file",
 			"tls_min_version",
 			"token",
+			"x_forwarded_for_authorized_addrs",
+			"x_forwarded_for_hop_skips",
+			"x_forwarded_for_reject_not_authorized",
+			"x_forwarded_for_reject_not_present",
 		}
 		if err := checkHCLKeys(item.Val, valid); err != nil {
 			return multierror.Prefix(err, fmt.Sprintf("listeners.%s:", key))
@@ -649,6 +934,205 @@ func parseTelemetry(result *Config, list *ast.ObjectList) error {
 	return nil
 }
 
+func parseAdmissionControl(result *Config, list *ast.ObjectList) error {
+	if len(list.Items) > 1 {
+		return fmt.Errorf("only one 'admission_control' block is permitted")
+	}
+
+	// Get our one item
+	item := list.Items[0]
+
+	valid := []string{
+		"max_in_flight",
+		"queue_depth_renew",
+		"queue_depth_read",
+		"queue_depth_write",
+		"queue_timeout",
+	}
+	if err := checkHCLKeys(item.Val, valid); err != nil {
+		return multierror.Prefix(err, "admission_control:")
+	}
+
+	var a AdmissionControl
+	if err := hcl.DecodeObject(&a, item.Val); err != nil {
+		return multierror.Prefix(err, "admission_control:")
+	}
+
+	if a.MaxInFlight < 0 {
+		return fmt.Errorf("admission_control: max_in_flight cannot be negative")
+	}
+	if a.QueueTimeoutRaw != "" {
+		d, err := time.ParseDuration(a.QueueTimeoutRaw)
+		if err != nil {
+			return multierror.Prefix(err, "admission_control:")
+		}
+		if d < 0 {
+			return fmt.Errorf("admission_control: queue_timeout cannot be negative")
+		}
+		a.QueueTimeout = d
+	}
+
+	result.AdmissionControl = &a
+	return nil
+}
+
+func parseCache(result *Config, list *ast.ObjectList) error {
+	if len(list.Items) > 1 {
+		return fmt.Errorf("only one 'cache' block is permitted")
+	}
+
+	// Get our one item
+	item := list.Items[0]
+
+	valid := []string{
+		"size",
+		"max_bytes",
+		"ttl",
+		"disable_negative_caching",
+		"bypass_prefixes",
+	}
+	if err := checkHCLKeys(item.Val, valid); err != nil {
+		return multierror.Prefix(err, "cache:")
+	}
+
+	var c Cache
+	if err := hcl.DecodeObject(&c, item.Val); err != nil {
+		return multierror.Prefix(err, "cache:")
+	}
+
+	if c.Size < 0 {
+		return fmt.Errorf("cache: size cannot be negative")
+	}
+	if c.MaxBytes < 0 {
+		return fmt.Errorf("cache: max_bytes cannot be negative")
+	}
+	if c.TTLRaw != "" {
+		d, err := time.ParseDuration(c.TTLRaw)
+		if err != nil {
+			return multierror.Prefix(err, "cache:")
+		}
+		if d < 0 {
+			return fmt.Errorf("cache: ttl cannot be negative")
+		}
+		c.TTL = d
+	}
+
+	result.Cache = &c
+	return nil
+}
+
+func parseStorageTimeouts(result *Config, list *ast.ObjectList) error {
+	if len(list.Items) > 1 {
+		return fmt.Errorf("only one 'storage_timeouts' block is permitted")
+	}
+
+	// Get our one item
+	item := list.Items[0]
+
+	valid := []string{
+		"timeout",
+		"max_retries",
+		"retry_budget_ratio",
+		"breaker_threshold",
+		"breaker_cooldown",
+	}
+	if err := checkHCLKeys(item.Val, valid); err != nil {
+		return multierror.Prefix(err, "storage_timeouts:")
+	}
+
+	var s StorageTimeouts
+	if err := hcl.DecodeObject(&s, item.Val); err != nil {
+		return multierror.Prefix(err, "storage_timeouts:")
+	}
+
+	if s.MaxRetries < 0 || s.RetryBudgetRatio < 0 || s.BreakerThreshold < 0 {
+		return fmt.Errorf("storage_timeouts: max_retries, retry_budget_ratio and breaker_threshold cannot be negative")
+	}
+	if s.TimeoutRaw != "" {
+		d, err := time.ParseDuration(s.TimeoutRaw)
+		if err != nil {
+			return multierror.Prefix(err, "storage_timeouts:")
+		}
+		if d < 0 {
+			return fmt.Errorf("storage_timeouts: timeout cannot be negative")
+		}
+		s.Timeout = d
+	}
+	if s.BreakerCooldownRaw != "" {
+		d, err := time.ParseDuration(s.BreakerCooldownRaw)
+		if err != nil {
+			return multierror.Prefix(err, "storage_timeouts:")
+		}
+		if d < 0 {
+			return fmt.Errorf("storage_timeouts: breaker_cooldown cannot be negative")
+		}
+		s.BreakerCooldown = d
+	}
+
+	result.StorageTimeouts = &s
+	return nil
+}
+
+func parseTracing(result *Config, list *ast.ObjectList) error {
+	if len(list.Items) > 1 {
+		return fmt.Errorf("only one 'tracing' block is permitted")
+	}
+
+	// Get our one item
+	item := list.Items[0]
+
+	valid := []string{
+		"exporter",
+		"otlp_endpoint",
+		"otlp_headers",
+		"service_name",
+		"sample_ratio",
+	}
+	if err := checkHCLKeys(item.Val, valid); err != nil {
+		return multierror.Prefix(err, "tracing:")
+	}
+
+	var t Tracing
+	if err := hcl.DecodeObject(&t, item.Val); err != nil {
+		return multierror.Prefix(err, "tracing:")
+	}
+
+	// Every trace is sampled unless a ratio is set
+	switch ratio := t.SampleRatioRaw.(type) {
+	case nil:
+		t.SampleRatio = 1
+	case int:
+		t.SampleRatio = float64(ratio)
+	case float64:
+		t.SampleRatio = ratio
+	case string:
+		var err error
+		if t.SampleRatio, err = strconv.ParseFloat(ratio, 64); err != nil {
+			return fmt.Errorf("tracing: invalid sample_ratio %q", ratio)
+		}
+	default:
+		return fmt.Errorf("tracing: invalid sample_ratio %v", ratio)
+	}
+	if t.SampleRatio < 0 || t.SampleRatio > 1 {
+		return fmt.Errorf("tracing: sample_ratio must be between 0 and 1")
+	}
+
+	switch t.Exporter {
+	case "otlp":
+		if t.OTLPEndpoint == "" {
+			return fmt.Errorf("tracing: otlp_endpoint is required for the otlp exporter")
+		}
+	case "stdout":
+	case "":
+		return fmt.Errorf("tracing: exporter is required")
+	default:
+		return fmt.Errorf("tracing: unknown exporter %q", t.Exporter)
+	}
+
+	result.Tracing = &t
+	return nil
+}
+
 func checkHCLKeys(node ast.Node, valid []string) error {
 	var list *ast.ObjectList
 	switch n := node.(type) {
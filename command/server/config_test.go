@@ -292,3 +292,258 @@ telemetry {
 		t.Errorf("bad error: %q", err)
 	}
 }
+
+func TestParseConfig_admissionControl(t *testing.T) {
+	config, err := ParseConfig(strings.TrimSpace(`
+admission_control {
+	max_in_flight     = 64
+	queue_depth_write = -1
+	queue_timeout     = "2s"
+}
+`))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := &AdmissionControl{
+		MaxInFlight:     64,
+		QueueDepthWrite: -1,
+		QueueTimeout:    2 * time.Second,
+		QueueTimeoutRaw: "2s",
+	}
+	if !reflect.DeepEqual(config.AdmissionControl, expected) {
+		t.Fatalf("expected \n\n%#v\n\n to be \n\n%#v\n\n", config.AdmissionControl, expected)
+	}
+
+	_, err = ParseConfig(strings.TrimSpace(`
+admission_control {
+	max_in_flight = 64
+	bad           = "one"
+}
+`))
+	if err == nil || !strings.Contains(err.Error(), "admission_control: invalid key 'bad' on line 3") {
+		t.Errorf("bad error: %v", err)
+	}
+
+	_, err = ParseConfig(strings.TrimSpace(`
+admission_control {
+	max_in_flight = -1
+}
+`))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestParseConfig_rawStorageEndpoint(t *testing.T) {
+	config, err := ParseConfig(`raw_storage_endpoint = true`)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if !config.EnableRawEndpoint {
+		t.Fatalf("expected the raw endpoint to be enabled")
+	}
+
+	merged := (&Config{}).Merge(config)
+	if !merged.EnableRawEndpoint {
+		t.Fatalf("expected the raw endpoint to be enabled")
+	}
+}
+
+func TestParseConfig_cache(t *testing.T) {
+	config, err := ParseConfig(strings.TrimSpace(`
+cache {
+	size                     = 1024
+	max_bytes                = 1048576
+	ttl                      = "30s"
+	disable_negative_caching = true
+	bypass_prefixes          = ["sys/expire/"]
+}
+`))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := &Cache{
+		Size:                   1024,
+		MaxBytes:               1048576,
+		DisableNegativeCaching: true,
+		BypassPrefixes:         []string{"sys/expire/"},
+		TTL:                    30 * time.Second,
+		TTLRaw:                 "30s",
+	}
+	if !reflect.DeepEqual(config.Cache, expected) {
+		t.Fatalf("expected \n\n%#v\n\n to be \n\n%#v\n\n", config.Cache, expected)
+	}
+
+	_, err = ParseConfig(strings.TrimSpace(`
+cache {
+	size = 1024
+	bad  = "one"
+}
+`))
+	if err == nil || !strings.Contains(err.Error(), "cache: invalid key 'bad' on line 3") {
+		t.Errorf("bad error: %v", err)
+	}
+
+	_, err = ParseConfig(strings.TrimSpace(`
+cache {
+	ttl = "-1s"
+}
+`))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestParseConfig_storageTimeouts(t *testing.T) {
+	config, err := ParseConfig(strings.TrimSpace(`
+storage_timeouts {
+	timeout            = "5s"
+	max_retries        = 2
+	retry_budget_ratio = 0.2
+	breaker_threshold  = 10
+	breaker_cooldown   = "30s"
+}
+`))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := &StorageTimeouts{
+		MaxRetries:         2,
+		RetryBudgetRatio:   0.2,
+		BreakerThreshold:   10,
+		Timeout:            5 * time.Second,
+		TimeoutRaw:         "5s",
+		BreakerCooldown:    30 * time.Second,
+		BreakerCooldownRaw: "30s",
+	}
+	if !reflect.DeepEqual(config.StorageTimeouts, expected) {
+		t.Fatalf("expected \n\n%#v\n\n to be \n\n%#v\n\n", config.StorageTimeouts, expected)
+	}
+
+	_, err = ParseConfig(strings.TrimSpace(`
+storage_timeouts {
+	timeout = "5s"
+	bad     = "one"
+}
+`))
+	if err == nil || !strings.Contains(err.Error(), "storage_timeouts: invalid key 'bad' on line 3") {
+		t.Errorf("bad error: %v", err)
+	}
+
+	_, err = ParseConfig(strings.TrimSpace(`
+storage_timeouts {
+	breaker_threshold = -1
+}
+`))
+	if err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestParseConfig_tracing(t *testing.T) {
+	config, err := ParseConfig(strings.TrimSpace(`
+tracing {
+	exporter      = "otlp"
+	otlp_endpoint = "http://127.0.0.1:4318/v1/traces"
+	otlp_headers {
+		"x-api-key" = "foo"
+	}
+}
+`))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := &Tracing{
+		Exporter:     "otlp",
+		OTLPEndpoint: "http://127.0.0.1:4318/v1/traces",
+		OTLPHeaders:  map[string]string{"x-api-key": "foo"},
+		SampleRatio:  1,
+	}
+	if !reflect.DeepEqual(config.Tracing, expected) {
+		t.Fatalf("expected \n\n%#v\n\n to be \n\n%#v\n\n", config.Tracing, expected)
+	}
+
+	config, err = ParseConfig(strings.TrimSpace(`
+tracing {
+	exporter     = "stdout"
+	sample_ratio = 0
+}
+`))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if config.Tracing.SampleRatio != 0 {
+		t.Fatalf("bad: %#v", config.Tracing)
+	}
+
+	config, err = ParseConfig(strings.TrimSpace(`
+tracing {
+	exporter     = "stdout"
+	sample_ratio = 0.25
+}
+`))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if config.Tracing.SampleRatio != 0.25 {
+		t.Fatalf("bad: %#v", config.Tracing)
+	}
+
+	bad := []string{
+		`tracing {}`,
+		`tracing { exporter = "zipkin" }`,
+		`tracing { exporter = "otlp" }`,
+		`tracing {
+	exporter     = "stdout"
+	sample_ratio = 2
+}`,
+		`tracing {
+	exporter = "stdout"
+	bad      = "one"
+}`,
+	}
+	for _, config := range bad {
+		if _, err := ParseConfig(config); err == nil {
+			t.Fatalf("expected error for %s", config)
+		}
+	}
+}
+
+func TestParseConfig_seal(t *testing.T) {
+	config, err := ParseConfig(strings.TrimSpace(`
+seal "awskms" {
+	region     = "us-west-2"
+	kms_key_id = "alias/vault"
+}
+`))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	expected := &Seal{
+		Type: "awskms",
+		Config: map[string]string{
+			"region":     "us-west-2",
+			"kms_key_id": "alias/vault",
+		},
+	}
+	if !reflect.DeepEqual(config.Seal, expected) {
+		t.Fatalf("expected \n\n%#v\n\n to be \n\n%#v\n\n", config.Seal, expected)
+	}
+
+	_, err = ParseConfig(strings.TrimSpace(`
+seal "awskms" {
+	kms_key_id = "foo"
+}
+seal "awskms" {
+	kms_key_id = "bar"
+}
+`))
+	if err == nil || !strings.Contains(err.Error(), "only one 'seal' block is permitted") {
+		t.Errorf("bad error: %v", err)
+	}
+}
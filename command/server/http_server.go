@@ -0,0 +1,155 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/helper/duration"
+	"golang.org/x/net/http2"
+)
+
+// NewHTTPServer creates the HTTP server for a listener, tuned according to
+// the listener's configuration. The options that are set are added to
+// props. The caller sets the handler.
+func NewHTTPServer(config map[string]string, props map[string]string) (*http.Server, error) {
+	server := &http.Server{}
+
+	timeouts := []struct {
+		key     string
+		timeout *time.Duration
+	}{
+		{"http_read_timeout", &server.ReadTimeout},
+		{"http_write_timeout", &server.WriteTimeout},
+	}
+	for _, t := range timeouts {
+		if v, ok := config[t.key]; ok {
+			timeout, err := parseListenerDuration(t.key, v)
+			if err != nil {
+				return nil, err
+			}
+			*t.timeout = timeout
+			props[t.key] = timeout.String()
+		}
+	}
+
+	if v, ok := config["http_idle_timeout"]; ok {
+		timeout, err := parseListenerDuration("http_idle_timeout", v)
+		if err != nil {
+			return nil, err
+		}
+		if timeout > 0 {
+			server.ConnState = newIdleConnCloser(timeout).connState
+			props["http_idle_timeout"] = timeout.String()
+		}
+	}
+
+	if v, ok := config["http_keepalive_disable"]; ok {
+		disable, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for 'http_keepalive_disable': %v", err)
+		}
+		if disable {
+			server.SetKeepAlivesEnabled(false)
+			props["http_keepalive"] = "disabled"
+		}
+	}
+
+	http2Disabled, err := listenerHTTP2Disabled(config)
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := config["http2_max_concurrent_streams"]; ok {
+		if http2Disabled {
+			return nil, fmt.Errorf("'http2_max_concurrent_streams' cannot be set when HTTP/2 is disabled")
+		}
+		streams, err := strconv.ParseUint(v, 10, 32)
+		if err != nil || streams == 0 {
+			return nil, fmt.Errorf("invalid value for 'http2_max_concurrent_streams': %q", v)
+		}
+		if err := http2.ConfigureServer(server, &http2.Server{
+			MaxConcurrentStreams: uint32(streams),
+		}); err != nil {
+			return nil, fmt.Errorf("failed to configure HTTP/2: %v", err)
+		}
+		props["http2_max_concurrent_streams"] = v
+	}
+
+	return server, nil
+}
+
+// listenerHTTP2Disabled returns whether HTTP/2 is disabled for a listener
+func listenerHTTP2Disabled(config map[string]string) (bool, error) {
+	v, ok := config["http2_disable"]
+	if !ok {
+		return false, nil
+	}
+	disabled, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid value for 'http2_disable': %v", err)
+	}
+	return disabled, nil
+}
+
+// parseListenerDuration parses a non-negative duration given either with a
+// unit suffix or as a number of seconds
+func parseListenerDuration(key, value string) (time.Duration, error) {
+	d, err := duration.ParseDurationSecond(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value for '%s': %v", key, err)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("'%s' cannot be negative", key)
+	}
+	return d, nil
+}
+
+// idleConnCloser closes HTTP/1.x connections that have been waiting for a
+// new request for longer than a timeout. HTTP/2 connections are always
+// active as far as net/http is concerned, so they are not affected.
+type idleConnCloser struct {
+	timeout time.Duration
+
+	l      sync.Mutex
+	timers map[net.Conn]*time.Timer
+}
+
+func newIdleConnCloser(timeout time.Duration) *idleConnCloser {
+	return &idleConnCloser{
+		timeout: timeout,
+		timers:  make(map[net.Conn]*time.Timer),
+	}
+}
+
+// connState is installed as the ConnState hook of the server
+func (c *idleConnCloser) connState(conn net.Conn, state http.ConnState) {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	if timer, ok := c.timers[conn]; ok {
+		timer.Stop()
+		delete(c.timers, conn)
+	}
+	if state == http.StateIdle {
+		var timer *time.Timer
+		timer = time.AfterFunc(c.timeout, func() {
+			// Stop cannot prevent the timer from firing just as the
+			// connection becomes active again, so the connection is only
+			// closed if the timer has not been replaced in the meantime
+			c.l.Lock()
+			current := c.timers[conn] == timer
+			if current {
+				delete(c.timers, conn)
+			}
+			c.l.Unlock()
+
+			if current {
+				conn.Close()
+			}
+		})
+		c.timers[conn] = timer
+	}
+}
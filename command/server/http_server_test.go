@@ -0,0 +1,212 @@
+package server
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewHTTPServer(t *testing.T) {
+	props := make(map[string]string)
+	server, err := NewHTTPServer(map[string]string{
+		"http_read_timeout":            "30s",
+		"http_write_timeout":           "60",
+		"http_idle_timeout":            "5m",
+		"http2_max_concurrent_streams": "500",
+	}, props)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if server.ReadTimeout != 30*time.Second || server.WriteTimeout != time.Minute {
+		t.Fatalf("bad: %#v", server)
+	}
+	if server.ConnState == nil {
+		t.Fatal("expected the idle timeout to be set up")
+	}
+	if _, ok := server.TLSNextProto["h2"]; !ok {
+		t.Fatal("expected HTTP/2 to be configured")
+	}
+	if props["http_write_timeout"] != "1m0s" || props["http2_max_concurrent_streams"] != "500" {
+		t.Fatalf("bad: %#v", props)
+	}
+
+	bad := []map[string]string{
+		{"http_read_timeout": "-1s"},
+		{"http_idle_timeout": "soon"},
+		{"http_keepalive_disable": "maybe"},
+		{"http2_max_concurrent_streams": "0"},
+		{"http2_disable": "true", "http2_max_concurrent_streams": "100"},
+	}
+	for _, config := range bad {
+		if _, err := NewHTTPServer(config, make(map[string]string)); err == nil {
+			t.Fatalf("expected error for %#v", config)
+		}
+	}
+}
+
+func TestNewHTTPServer_IdleTimeout(t *testing.T) {
+	server, err := NewHTTPServer(map[string]string{
+		"http_idle_timeout": "100ms",
+	}, make(map[string]string))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer ln.Close()
+	go server.Serve(ln)
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// The server closes the connection once it has been idle for long
+	// enough, which ends the response stream
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := ioutil.ReadAll(conn); err != nil {
+		t.Fatalf("expected the connection to be closed by the server: %v", err)
+	}
+}
+
+// closeRecorder is a connection that records whether it has been closed
+type closeRecorder struct {
+	net.Conn
+
+	l      sync.Mutex
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.l.Lock()
+	defer c.l.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *closeRecorder) isClosed() bool {
+	c.l.Lock()
+	defer c.l.Unlock()
+	return c.closed
+}
+
+func TestIdleConnCloser(t *testing.T) {
+	closer := newIdleConnCloser(10 * time.Millisecond)
+
+	// An idle connection is closed, and forgotten, once the timeout expires
+	conn := &closeRecorder{}
+	closer.connState(conn, http.StateIdle)
+	time.Sleep(100 * time.Millisecond)
+	closer.l.Lock()
+	remaining := len(closer.timers)
+	closer.l.Unlock()
+	if !conn.isClosed() || remaining != 0 {
+		t.Fatalf("bad: closed %t, %d timers", conn.isClosed(), remaining)
+	}
+
+	// A timer that has been replaced does not close the connection when it
+	// fires, as happens when the connection becomes active just as the
+	// timer fires
+	conn = &closeRecorder{}
+	closer.connState(conn, http.StateIdle)
+	closer.l.Lock()
+	replacement := time.NewTimer(time.Hour)
+	defer replacement.Stop()
+	closer.timers[conn] = replacement
+	closer.l.Unlock()
+	time.Sleep(100 * time.Millisecond)
+	closer.l.Lock()
+	current := closer.timers[conn]
+	closer.l.Unlock()
+	if conn.isClosed() || current != replacement {
+		t.Fatalf("bad: closed %t", conn.isClosed())
+	}
+
+	// Connections that become active again are left open
+	conn = &closeRecorder{}
+	closer.connState(conn, http.StateIdle)
+	closer.connState(conn, http.StateActive)
+	time.Sleep(100 * time.Millisecond)
+	if conn.isClosed() {
+		t.Fatal("expected the active connection to be left open")
+	}
+}
+
+func TestTCPListener_keepAlive(t *testing.T) {
+	ln, props, _, err := tcpListenerFactory(map[string]string{
+		"address":              "127.0.0.1:0",
+		"tls_disable":          "1",
+		"tcp_keepalive_period": "0",
+	}, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer ln.Close()
+	if _, ok := ln.(tcpKeepAliveListener); ok || props["tcp_keepalive"] != "disabled" {
+		t.Fatalf("bad: %#v", props)
+	}
+
+	ln, _, _, err = tcpListenerFactory(map[string]string{
+		"address":              "127.0.0.1:0",
+		"tls_disable":          "1",
+		"tcp_keepalive_period": "30s",
+	}, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer ln.Close()
+	if kaln, ok := ln.(tcpKeepAliveListener); !ok || kaln.period != 30*time.Second {
+		t.Fatalf("bad: %#v", ln)
+	}
+}
+
+func TestTCPListener_http2Disable(t *testing.T) {
+	wd, _ := os.Getwd()
+	wd += "/test-fixtures/reload/"
+
+	ln, props, _, err := tcpListenerFactory(map[string]string{
+		"address":       "127.0.0.1:0",
+		"tls_cert_file": wd + "reload_foo.pem",
+		"tls_key_file":  wd + "reload_foo.key",
+		"http2_disable": "true",
+	}, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer ln.Close()
+	if props["http2"] != "disabled" {
+		t.Fatalf("bad: %#v", props)
+	}
+
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	conn, err := tls.Dial("tcp", ln.Addr().String(), &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"h2", "http/1.1"},
+	})
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer conn.Close()
+	if proto := conn.ConnectionState().NegotiatedProtocol; proto != "http/1.1" {
+		t.Fatalf("bad: %q", proto)
+	}
+}
@@ -20,6 +20,7 @@ type ListenerFactory func(map[string]string, io.Writer) (net.Listener, map[strin
 // BuiltinListeners is the list of built-in listener types.
 var BuiltinListeners = map[string]ListenerFactory{
 	"tcp":   tcpListenerFactory,
+	"unix":  unixListenerFactory,
 	"atlas": atlasListenerFactory,
 }
 
@@ -76,6 +77,14 @@ func listenerWrapTLS(
 	tlsConf := &tls.Config{}
 	tlsConf.GetCertificate = cg.getCertificate
 	tlsConf.NextProtos = []string{"h2", "http/1.1"}
+	http2Disabled, err := listenerHTTP2Disabled(config)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if http2Disabled {
+		tlsConf.NextProtos = []string{"http/1.1"}
+		props["http2"] = "disabled"
+	}
 	tlsConf.MinVersion, ok = tlsutil.TLSLookup[tlsvers]
 	if !ok {
 		return nil, nil, nil, fmt.Errorf("'tls_min_version' value %s not supported, please specify one of [tls10,tls11,tls12]", tlsvers)
@@ -17,8 +17,23 @@ func tcpListenerFactory(config map[string]string, _ io.Writer) (net.Listener, ma
 		return nil, nil, nil, err
 	}
 
-	ln = tcpKeepAliveListener{ln.(*net.TCPListener)}
 	props := map[string]string{"addr": addr}
+
+	keepAlivePeriod := 3 * time.Minute
+	if v, ok := config["tcp_keepalive_period"]; ok {
+		keepAlivePeriod, err = parseListenerDuration("tcp_keepalive_period", v)
+		if err != nil {
+			ln.Close()
+			return nil, nil, nil, err
+		}
+		props["tcp_keepalive_period"] = keepAlivePeriod.String()
+	}
+	if keepAlivePeriod > 0 {
+		ln = tcpKeepAliveListener{ln.(*net.TCPListener), keepAlivePeriod}
+	} else {
+		props["tcp_keepalive"] = "disabled"
+	}
+
 	return listenerWrapTLS(ln, props, config)
 }
 
@@ -27,9 +42,10 @@ func tcpListenerFactory(config map[string]string, _ io.Writer) (net.Listener, ma
 // dead TCP connections (e.g. closing laptop mid-download) eventually
 // go away.
 //
-// This is copied directly from the Go source code.
+// This is copied from the Go source code, with a configurable period.
 type tcpKeepAliveListener struct {
 	*net.TCPListener
+	period time.Duration
 }
 
 func (ln tcpKeepAliveListener) Accept() (c net.Conn, err error) {
@@ -38,6 +54,6 @@ func (ln tcpKeepAliveListener) Accept() (c net.Conn, err error) {
 		return
 	}
 	tc.SetKeepAlive(true)
-	tc.SetKeepAlivePeriod(3 * time.Minute)
+	tc.SetKeepAlivePeriod(ln.period)
 	return tc, nil
 }
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+)
+
+func unixListenerFactory(config map[string]string, _ io.Writer) (net.Listener, map[string]string, ReloadFunc, error) {
+	path, ok := config["address"]
+	if !ok || path == "" {
+		return nil, nil, nil, fmt.Errorf("'address' must be set to the path of the socket")
+	}
+
+	// Remove a socket left behind by a previous run, but never anything
+	// that is not a socket
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, nil, nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to remove stale socket %s: %v", path, err)
+		}
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	props := map[string]string{"addr": path}
+	if err := setSocketPermissions(path, config, props); err != nil {
+		ln.Close()
+		return nil, nil, nil, err
+	}
+
+	return listenerWrapTLS(ln, props, config)
+}
+
+// setSocketPermissions applies the ownership and mode options of a UNIX
+// domain socket listener to the socket file
+func setSocketPermissions(path string, config map[string]string, props map[string]string) error {
+	uid, gid := -1, -1
+	if v, ok := config["socket_user"]; ok {
+		id, err := lookupSocketID(v, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		if err != nil {
+			return fmt.Errorf("invalid value for 'socket_user': %v", err)
+		}
+		uid = id
+		props["socket_user"] = v
+	}
+	if v, ok := config["socket_group"]; ok {
+		id, err := lookupSocketID(v, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return fmt.Errorf("invalid value for 'socket_group': %v", err)
+		}
+		gid = id
+		props["socket_group"] = v
+	}
+	if uid != -1 || gid != -1 {
+		if err := os.Chown(path, uid, gid); err != nil {
+			return fmt.Errorf("failed to change the owner of %s: %v", path, err)
+		}
+	}
+
+	if v, ok := config["socket_mode"]; ok {
+		mode, err := strconv.ParseUint(v, 8, 32)
+		if err != nil || mode > 0777 {
+			return fmt.Errorf("invalid value for 'socket_mode': %q", v)
+		}
+		if err := os.Chmod(path, os.FileMode(mode)); err != nil {
+			return fmt.Errorf("failed to change the mode of %s: %v", path, err)
+		}
+		props["socket_mode"] = v
+	}
+
+	return nil
+}
+
+// lookupSocketID returns the numeric ID given, or looks it up by name
+func lookupSocketID(v string, lookup func(string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(v); err == nil {
+		if id < 0 {
+			return 0, fmt.Errorf("invalid ID %d", id)
+		}
+		return id, nil
+	}
+
+	idStr, err := lookup(v)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(idStr)
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUnixListener(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "vault.sock")
+
+	// A socket left behind by a previous run is replaced. Closing a
+	// listener removes its socket, so move it out of the way first.
+	stale, err := net.Listen("unix", path+".stale")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := os.Rename(path+".stale", path); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	stale.Close()
+	if _, err := os.Lstat(path); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	ln, props, _, err := unixListenerFactory(map[string]string{
+		"address":     path,
+		"tls_disable": "1",
+		"socket_mode": "0600",
+	}, nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer ln.Close()
+	if props["addr"] != path {
+		t.Fatalf("bad: %#v", props)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Fatalf("bad: %s", fi.Mode())
+	}
+
+	connFn := func(lnReal net.Listener) (net.Conn, error) {
+		return net.Dial("unix", path)
+	}
+
+	testListenerImpl(t, ln, connFn, "")
+}
+
+func TestUnixListener_notSocket(t *testing.T) {
+	f, err := ioutil.TempFile("", "vault-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	if _, _, _, err := unixListenerFactory(map[string]string{
+		"address":     f.Name(),
+		"tls_disable": "1",
+	}, nil); err == nil {
+		t.Fatal("expected an error for a path that is not a socket")
+	}
+	if _, err := os.Stat(f.Name()); err != nil {
+		t.Fatalf("expected the file to be kept: %v", err)
+	}
+
+	if _, _, _, err := unixListenerFactory(map[string]string{
+		"tls_disable": "1",
+	}, nil); err == nil {
+		t.Fatal("expected an error without an address")
+	}
+}
@@ -253,3 +253,54 @@ func TestServer_ReloadListener(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestServer_ListenerHandlerProperties(t *testing.T) {
+	props := make(map[string]string)
+	handlerProps, err := listenerHandlerProperties(map[string]string{
+		"max_request_size":            "1024",
+		"rate_limit":                  "100",
+		"rate_limit_per_client":       "0.5",
+		"rate_limit_per_client_burst": "5",
+	}, props)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if handlerProps.MaxRequestSize != 1024 {
+		t.Fatalf("bad: %#v", handlerProps)
+	}
+	limits := handlerProps.RateLimits
+	if limits.Listener.Rate != 100 || limits.Client.Rate != 0.5 || limits.Client.Burst != 5 || limits.Token.Rate != 0 {
+		t.Fatalf("bad: %#v", limits)
+	}
+	if props["rate_limit_per_client_burst"] != "5" {
+		t.Fatalf("bad: %#v", props)
+	}
+
+	handlerProps, err = listenerHandlerProperties(map[string]string{
+		"x_forwarded_for_authorized_addrs":   "10.0.0.0/8, 192.168.0.0/16",
+		"x_forwarded_for_hop_skips":          "1",
+		"x_forwarded_for_reject_not_present": "false",
+	}, props)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	forwardedFor := handlerProps.ForwardedFor
+	if len(forwardedFor.AuthorizedAddrs) != 2 || forwardedFor.AuthorizedAddrs[1].String() != "192.168.0.0/16" ||
+		forwardedFor.HopSkips != 1 || !forwardedFor.RejectNotAuthorized || forwardedFor.RejectNotPresent {
+		t.Fatalf("bad: %#v", forwardedFor)
+	}
+
+	bad := []map[string]string{
+		{"max_request_size": "-1"},
+		{"rate_limit": "fast"},
+		{"rate_limit_per_token": "-5"},
+		{"rate_limit_per_mount_burst": "5"},
+		{"x_forwarded_for_authorized_addrs": "10.0.0.1"},
+		{"x_forwarded_for_hop_skips": "1"},
+	}
+	for _, config := range bad {
+		if _, err := listenerHandlerProperties(config, make(map[string]string)); err == nil {
+			t.Fatalf("expected error for %#v", config)
+		}
+	}
+}
@@ -17,11 +17,11 @@ type TokenCreateCommand struct {
 
 func (c *TokenCreateCommand) Run(args []string) int {
 	var format string
-	var id, displayName, lease, ttl, explicitMaxTTL, period, role string
+	var id, displayName, lease, ttl, explicitMaxTTL, period, role, tokenType string
 	var orphan, noDefaultPolicy, renewable bool
 	var metadata map[string]string
 	var numUses int
-	var policies []string
+	var policies, boundCIDRs []string
 	flags := c.Meta.FlagSet("mount", meta.FlagSetDefault)
 	flags.StringVar(&format, "format", "table", "")
 	flags.StringVar(&displayName, "display-name", "", "")
@@ -31,12 +31,14 @@ func (c *TokenCreateCommand) Run(args []string) int {
 	flags.StringVar(&explicitMaxTTL, "explicit-max-ttl", "", "")
 	flags.StringVar(&period, "period", "", "")
 	flags.StringVar(&role, "role", "", "")
+	flags.StringVar(&tokenType, "type", "", "")
 	flags.BoolVar(&orphan, "orphan", false, "")
 	flags.BoolVar(&renewable, "renewable", true, "")
 	flags.BoolVar(&noDefaultPolicy, "no-default-policy", false, "")
 	flags.IntVar(&numUses, "use-limit", 0, "")
 	flags.Var((*kvFlag.Flag)(&metadata), "metadata", "")
 	flags.Var((*sliceflag.StringFlag)(&policies), "policy", "")
+	flags.Var((*sliceflag.StringFlag)(&boundCIDRs), "bound-cidr", "")
 	flags.Usage = func() { c.Ui.Error(c.Help()) }
 	if err := flags.Parse(args); err != nil {
 		return 1
@@ -73,6 +75,8 @@ func (c *TokenCreateCommand) Run(args []string) int {
 		Renewable:       new(bool),
 		ExplicitMaxTTL:  explicitMaxTTL,
 		Period:          period,
+		Type:            tokenType,
+		BoundCIDRs:      boundCIDRs,
 	}
 	*tcr.Renewable = renewable
 
@@ -164,6 +168,17 @@ Token Options:
   -use-limit=5            The number of times this token can be used until
                           it is automatically revoked.
 
+  -bound-cidr="10.0.0.0/8"
+                          A CIDR block or IP address the token can be used
+                          from. This can be specified multiple times. By
+                          default, child tokens are bound to the same blocks
+                          as your token.
+
+  -type="batch"           The type of the token, either "service" or "batch".
+                          Batch tokens are not persisted and cannot be
+                          renewed, revoked or create child tokens. Defaults
+                          to "service", or to the type set on the role.
+
   -format=table           The format for output. By default it is a whitespace-
                           delimited table. This can also be json or yaml.
 
@@ -56,6 +56,8 @@ func PrintRawField(ui cli.Ui, secret *api.Secret, field string) int {
 			val = secret.WrapInfo.TTL
 		case "wrapping_token_creation_time":
 			val = secret.WrapInfo.CreationTime.String()
+		case "wrapping_token_accessor":
+			val = secret.WrapInfo.Accessor
 		case "wrapped_accessor":
 			val = secret.WrapInfo.WrappedAccessor
 		default:
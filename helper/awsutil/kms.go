@@ -0,0 +1,117 @@
+package awsutil
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/private/protocol/jsonrpc"
+)
+
+// KMS is a client for the operations of the AWS Key Management Service
+// that Vault uses. It is built like the generated service clients of the
+// AWS SDK, which does not include a KMS client in the vendored version.
+type KMS struct {
+	*client.Client
+}
+
+// KMSServiceName is the name of the KMS service, used to resolve its
+// endpoint
+const KMSServiceName = "kms"
+
+// NewKMS creates a new KMS client with a session
+func NewKMS(p client.ConfigProvider, cfgs ...*aws.Config) *KMS {
+	c := p.ClientConfig(KMSServiceName, cfgs...)
+	svc := &KMS{
+		Client: client.New(
+			*c.Config,
+			metadata.ClientInfo{
+				ServiceName:   KMSServiceName,
+				SigningRegion: c.SigningRegion,
+				Endpoint:      c.Endpoint,
+				APIVersion:    "2014-11-01",
+				JSONVersion:   "1.1",
+				TargetPrefix:  "TrentService",
+			},
+			c.Handlers,
+		),
+	}
+
+	svc.Handlers.Sign.PushBackNamed(v4.SignRequestHandler)
+	svc.Handlers.Build.PushBackNamed(jsonrpc.BuildHandler)
+	svc.Handlers.Unmarshal.PushBackNamed(jsonrpc.UnmarshalHandler)
+	svc.Handlers.UnmarshalMeta.PushBackNamed(jsonrpc.UnmarshalMetaHandler)
+	svc.Handlers.UnmarshalError.PushBackNamed(jsonrpc.UnmarshalErrorHandler)
+
+	return svc
+}
+
+func (c *KMS) send(name string, input, output interface{}) error {
+	op := &request.Operation{
+		Name:       name,
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}
+	return c.NewRequest(op, input, output).Send()
+}
+
+// Encrypt encrypts up to 4 KB of data with a customer master key
+func (c *KMS) Encrypt(input *KMSEncryptInput) (*KMSEncryptOutput, error) {
+	output := &KMSEncryptOutput{}
+	return output, c.send("Encrypt", input, output)
+}
+
+// Decrypt decrypts data encrypted by Encrypt. The customer master key is
+// identified by the ciphertext.
+func (c *KMS) Decrypt(input *KMSDecryptInput) (*KMSDecryptOutput, error) {
+	output := &KMSDecryptOutput{}
+	return output, c.send("Decrypt", input, output)
+}
+
+// DescribeKey returns the metadata of a customer master key
+func (c *KMS) DescribeKey(input *KMSDescribeKeyInput) (*KMSDescribeKeyOutput, error) {
+	output := &KMSDescribeKeyOutput{}
+	return output, c.send("DescribeKey", input, output)
+}
+
+type KMSEncryptInput struct {
+	// KeyId is the ID, ARN or alias of the customer master key
+	KeyId             *string
+	Plaintext         []byte
+	EncryptionContext map[string]*string
+}
+
+type KMSEncryptOutput struct {
+	CiphertextBlob []byte
+
+	// KeyId is the ARN of the customer master key that was used
+	KeyId *string
+}
+
+type KMSDecryptInput struct {
+	CiphertextBlob    []byte
+	EncryptionContext map[string]*string
+}
+
+type KMSDecryptOutput struct {
+	Plaintext []byte
+
+	// KeyId is the ARN of the customer master key that was used
+	KeyId *string
+}
+
+type KMSDescribeKeyInput struct {
+	KeyId *string
+}
+
+type KMSDescribeKeyOutput struct {
+	KeyMetadata *KMSKeyMetadata
+}
+
+type KMSKeyMetadata struct {
+	Arn      *string
+	KeyId    *string
+	KeyState *string
+	Enabled  *bool
+}
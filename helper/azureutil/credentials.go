@@ -0,0 +1,201 @@
+package azureutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"golang.org/x/oauth2"
+)
+
+// defaultMSIEndpoint is the token endpoint of the instance metadata service
+// of Azure virtual machines
+const defaultMSIEndpoint = "http://169.254.169.254/metadata/identity/oauth2/token"
+
+// Environment describes the endpoints of an Azure cloud
+type Environment struct {
+	Name                    string
+	ActiveDirectoryEndpoint string
+	KeyVaultDNSSuffix       string
+	KeyVaultResource        string
+}
+
+var environments = map[string]*Environment{
+	"azurepubliccloud": &Environment{
+		Name:                    "AzurePublicCloud",
+		ActiveDirectoryEndpoint: "https://login.microsoftonline.com/",
+		KeyVaultDNSSuffix:       "vault.azure.net",
+		KeyVaultResource:        "https://vault.azure.net",
+	},
+	"azurechinacloud": &Environment{
+		Name:                    "AzureChinaCloud",
+		ActiveDirectoryEndpoint: "https://login.chinacloudapi.cn/",
+		KeyVaultDNSSuffix:       "vault.azure.cn",
+		KeyVaultResource:        "https://vault.azure.cn",
+	},
+	"azureusgovernmentcloud": &Environment{
+		Name:                    "AzureUSGovernmentCloud",
+		ActiveDirectoryEndpoint: "https://login.microsoftonline.us/",
+		KeyVaultDNSSuffix:       "vault.usgovcloudapi.net",
+		KeyVaultResource:        "https://vault.usgovcloudapi.net",
+	},
+	"azuregermancloud": &Environment{
+		Name:                    "AzureGermanCloud",
+		ActiveDirectoryEndpoint: "https://login.microsoftonline.de/",
+		KeyVaultDNSSuffix:       "vault.microsoftazure.de",
+		KeyVaultResource:        "https://vault.microsoftazure.de",
+	},
+}
+
+// EnvironmentFromName returns the Azure cloud of the given name, such as
+// "AzurePublicCloud". An empty name is the public cloud.
+func EnvironmentFromName(name string) (*Environment, error) {
+	if name == "" {
+		name = "AzurePublicCloud"
+	}
+	env, ok := environments[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown Azure environment %q", name)
+	}
+	return env, nil
+}
+
+// CredentialsConfig configures how Vault authenticates to Azure Active
+// Directory
+type CredentialsConfig struct {
+	Environment *Environment
+
+	// TenantID, ClientID and ClientSecret identify a service principal. If
+	// the secret is empty, the managed identity of the virtual machine is
+	// used instead; ClientID then selects a user-assigned identity.
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+
+	// Resource is the resource that tokens are requested for
+	Resource string
+
+	// HTTPClient is used to fetch tokens
+	HTTPClient *http.Client
+}
+
+// TokenSource returns a source of access tokens for the configured
+// credentials. Tokens are reused until they expire.
+func (c *CredentialsConfig) TokenSource() (oauth2.TokenSource, error) {
+	client := c.HTTPClient
+	if client == nil {
+		client = cleanhttp.DefaultClient()
+	}
+
+	var src oauth2.TokenSource
+	if c.ClientSecret != "" {
+		if c.TenantID == "" || c.ClientID == "" {
+			return nil, fmt.Errorf("tenant ID and client ID are required with a client secret")
+		}
+		src = &clientCredentialsTokenSource{
+			client:   client,
+			tokenURL: c.Environment.ActiveDirectoryEndpoint + c.TenantID + "/oauth2/token",
+			params: url.Values{
+				"grant_type":    {"client_credentials"},
+				"client_id":     {c.ClientID},
+				"client_secret": {c.ClientSecret},
+				"resource":      {c.Resource},
+			},
+		}
+	} else {
+		endpoint := os.Getenv("AZURE_MSI_ENDPOINT")
+		if endpoint == "" {
+			endpoint = defaultMSIEndpoint
+		}
+		params := url.Values{
+			"api-version": {"2018-02-01"},
+			"resource":    {c.Resource},
+		}
+		if c.ClientID != "" {
+			params.Set("client_id", c.ClientID)
+		}
+		src = &msiTokenSource{
+			client: client,
+			url:    endpoint + "?" + params.Encode(),
+		}
+	}
+
+	return oauth2.ReuseTokenSource(nil, src), nil
+}
+
+// clientCredentialsTokenSource fetches access tokens of a service principal
+// with the client credentials grant
+type clientCredentialsTokenSource struct {
+	client   *http.Client
+	tokenURL string
+	params   url.Values
+}
+
+func (s *clientCredentialsTokenSource) Token() (*oauth2.Token, error) {
+	resp, err := s.client.PostForm(s.tokenURL, s.params)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting access token: %v", err)
+	}
+	return parseTokenResponse(resp)
+}
+
+// msiTokenSource fetches access tokens of the managed identity of the
+// virtual machine from the instance metadata service
+type msiTokenSource struct {
+	client *http.Client
+	url    string
+}
+
+func (s *msiTokenSource) Token() (*oauth2.Token, error) {
+	req, err := http.NewRequest("GET", s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata", "true")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting access token from instance metadata service: %v", err)
+	}
+	return parseTokenResponse(resp)
+}
+
+func parseTokenResponse(resp *http.Response) (*oauth2.Token, error) {
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading access token response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error requesting access token: %s: %s", resp.Status, body)
+	}
+
+	// Azure Active Directory returns the expiry as a string
+	var out struct {
+		AccessToken string      `json:"access_token"`
+		TokenType   string      `json:"token_type"`
+		ExpiresIn   json.Number `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return nil, fmt.Errorf("error parsing access token response: %v", err)
+	}
+	if out.AccessToken == "" {
+		return nil, fmt.Errorf("no access token returned")
+	}
+
+	token := &oauth2.Token{
+		AccessToken: out.AccessToken,
+		TokenType:   out.TokenType,
+	}
+	if secs, err := strconv.ParseInt(out.ExpiresIn.String(), 10, 64); err == nil && secs > 0 {
+		token.Expiry = time.Now().Add(time.Duration(secs) * time.Second)
+	}
+	return token, nil
+}
@@ -0,0 +1,149 @@
+package azureutil
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"golang.org/x/oauth2"
+)
+
+const (
+	keyVaultAPIVersion = "2016-10-01"
+
+	// KeyWrapAlgorithm is the algorithm used to wrap keys with RSA keys
+	KeyWrapAlgorithm = "RSA-OAEP"
+)
+
+// KeyVault is a client for the key operations of an Azure Key Vault
+type KeyVault struct {
+	client *http.Client
+	url    string
+}
+
+// NewKeyVault creates a client for the vault at the given URL, such as
+// "https://example.vault.azure.net", authenticating with tokens from the
+// given source
+func NewKeyVault(vaultURL string, src oauth2.TokenSource) *KeyVault {
+	return &KeyVault{
+		client: &http.Client{
+			Transport: &oauth2.Transport{
+				Source: src,
+				Base:   cleanhttp.DefaultTransport(),
+			},
+		},
+		url: strings.TrimSuffix(vaultURL, "/"),
+	}
+}
+
+// CurrentKeyID returns the identifier of the current version of the named
+// key, which includes the version
+func (k *KeyVault) CurrentKeyID(name string) (string, error) {
+	var out struct {
+		Key struct {
+			Kid string `json:"kid"`
+		} `json:"key"`
+		Attributes struct {
+			Enabled *bool `json:"enabled"`
+		} `json:"attributes"`
+	}
+	if err := k.do("GET", k.url+"/keys/"+name, nil, &out); err != nil {
+		return "", err
+	}
+	if out.Key.Kid == "" {
+		return "", fmt.Errorf("no identifier returned for key %s", name)
+	}
+	if out.Attributes.Enabled != nil && !*out.Attributes.Enabled {
+		return "", fmt.Errorf("key %s is not enabled", name)
+	}
+	return out.Key.Kid, nil
+}
+
+// WrapKey encrypts a symmetric key with the given version of a key,
+// returning the wrapped key and the identifier of the version used
+func (k *KeyVault) WrapKey(kid string, value []byte) ([]byte, string, error) {
+	return k.keyOperation(kid, "wrapkey", value)
+}
+
+// UnwrapKey decrypts a symmetric key wrapped by WrapKey with the given
+// version of a key
+func (k *KeyVault) UnwrapKey(kid string, value []byte) ([]byte, error) {
+	out, _, err := k.keyOperation(kid, "unwrapkey", value)
+	return out, err
+}
+
+func (k *KeyVault) keyOperation(kid, op string, value []byte) ([]byte, string, error) {
+	// Key identifiers are URLs; only send requests, and our token, to the
+	// configured vault
+	if !strings.HasPrefix(kid, k.url+"/keys/") {
+		return nil, "", fmt.Errorf("key %s does not belong to vault %s", kid, k.url)
+	}
+
+	var out struct {
+		Kid   string `json:"kid"`
+		Value string `json:"value"`
+	}
+	err := k.do("POST", kid+"/"+op, map[string]string{
+		"alg":   KeyWrapAlgorithm,
+		"value": base64.RawURLEncoding.EncodeToString(value),
+	}, &out)
+	if err != nil {
+		return nil, "", err
+	}
+
+	buf, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(out.Value, "="))
+	if err != nil {
+		return nil, "", fmt.Errorf("error decoding %s result: %v", op, err)
+	}
+	return buf, out.Kid, nil
+}
+
+func (k *KeyVault) do(method, u string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		buf, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(buf)
+	}
+
+	req, err := http.NewRequest(method, u+"?api-version="+keyVaultAPIVersion, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(buf, &e); err == nil && e.Error.Message != "" {
+			return fmt.Errorf("%s: %s", e.Error.Code, e.Error.Message)
+		}
+		return fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+
+	return json.Unmarshal(buf, out)
+}
@@ -0,0 +1,129 @@
+package azureutil
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestKeyVault(t *testing.T) {
+	var vaultURL string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" || r.URL.Query().Get("api-version") != keyVaultAPIVersion {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var in map[string]string
+		if r.Method == "POST" {
+			if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if in["alg"] != KeyWrapAlgorithm {
+				t.Fatalf("bad: %#v", in)
+			}
+		}
+
+		kid := vaultURL + "/keys/unseal/1"
+		switch r.Method + " " + r.URL.Path {
+		case "GET /keys/unseal":
+			w.Write([]byte(`{"key": {"kid": "` + kid + `"}, "attributes": {"enabled": true}}`))
+		case "POST /keys/unseal/1/wrapkey":
+			value, _ := base64.RawURLEncoding.DecodeString(in["value"])
+			json.NewEncoder(w).Encode(map[string]string{
+				"kid":   kid,
+				"value": base64.RawURLEncoding.EncodeToString(append([]byte("wrapped:"), value...)),
+			})
+		case "POST /keys/unseal/1/unwrapkey":
+			value, _ := base64.RawURLEncoding.DecodeString(in["value"])
+			json.NewEncoder(w).Encode(map[string]string{
+				"kid":   kid,
+				"value": base64.RawURLEncoding.EncodeToString(value[len("wrapped:"):]),
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": {"code": "KeyNotFound", "message": "Key not found"}}`))
+		}
+	}))
+	defer ts.Close()
+	vaultURL = ts.URL
+
+	kv := NewKeyVault(ts.URL+"/", oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"}))
+
+	kid, err := kv.CurrentKeyID("unseal")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if kid != ts.URL+"/keys/unseal/1" {
+		t.Fatalf("bad: %s", kid)
+	}
+
+	wrapped, used, err := kv.WrapKey(kid, []byte("secret"))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if used != kid || string(wrapped) != "wrapped:secret" {
+		t.Fatalf("bad: %s %s", used, wrapped)
+	}
+
+	value, err := kv.UnwrapKey(kid, wrapped)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(value) != "secret" {
+		t.Fatalf("bad: %s", value)
+	}
+
+	if _, err := kv.CurrentKeyID("missing"); err == nil || err.Error() != "KeyNotFound: Key not found" {
+		t.Fatalf("bad: %v", err)
+	}
+
+	// Requests are only sent to the configured vault
+	if _, err := kv.UnwrapKey("https://evil.example.com/keys/unseal/1", wrapped); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestCredentialsConfig_clientCredentials(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/tenant/oauth2/token" || r.FormValue("grant_type") != "client_credentials" ||
+			r.FormValue("client_secret") != "secret" || r.FormValue("resource") != "https://vault.azure.net" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"access_token": "token", "token_type": "Bearer", "expires_in": "3599"}`))
+	}))
+	defer ts.Close()
+
+	env, err := EnvironmentFromName("")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	env = &Environment{
+		ActiveDirectoryEndpoint: ts.URL + "/",
+		KeyVaultResource:        env.KeyVaultResource,
+	}
+
+	creds := &CredentialsConfig{
+		Environment:  env,
+		TenantID:     "tenant",
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Resource:     env.KeyVaultResource,
+	}
+	src, err := creds.TokenSource()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	token, err := src.Token()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if token.AccessToken != "token" || token.Expiry.IsZero() {
+		t.Fatalf("bad: %#v", token)
+	}
+}
@@ -0,0 +1,348 @@
+package certutil
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/helper/errutil"
+)
+
+// ChainErrorKind describes why a certificate chain could not be built
+type ChainErrorKind string
+
+// Well-known ChainErrorKinds
+const (
+	// No certificate issued the certificate, so the chain cannot continue
+	ChainMissingIssuer ChainErrorKind = "missing_issuer"
+
+	// A certificate with a matching subject exists, but its key did not
+	// produce the certificate's signature
+	ChainInvalidSignature ChainErrorKind = "invalid_signature"
+
+	// The issuing certificate is not allowed to issue certificates, because
+	// it is not a CA, lacks the certificate signing key usage or its path
+	// length constraint is exceeded
+	ChainNotAuthorized ChainErrorKind = "not_authorized"
+
+	// The certificate is not valid at the verification time
+	ChainExpired ChainErrorKind = "expired"
+
+	// The chain ends in a self-signed certificate that is not one of the
+	// trusted roots
+	ChainUntrustedRoot ChainErrorKind = "untrusted_root"
+)
+
+// ChainError is returned by ChainBuilder when no valid chain could be built.
+// Certificate is the certificate whose link to its issuer failed; when
+// several candidate chains fail, the error describes the one that got
+// closest to a root.
+type ChainError struct {
+	Kind        ChainErrorKind
+	Certificate *x509.Certificate
+	Err         string
+}
+
+func (e *ChainError) Error() string {
+	return e.Err
+}
+
+// ChainBuilder orders and verifies certificate chains built from an
+// arbitrary, unordered set of certificates. Cross-signed intermediates, i.e.
+// several certificates with the same subject and key issued by different
+// CAs, are followed to every root they lead to.
+type ChainBuilder struct {
+	// The time at which certificates must be valid. Defaults to the current
+	// time.
+	CurrentTime time.Time
+
+	roots []*x509.Certificate
+	certs []*x509.Certificate
+}
+
+// NewChainBuilder returns an empty ChainBuilder
+func NewChainBuilder() *ChainBuilder {
+	return &ChainBuilder{}
+}
+
+// AddCertificates adds certificates that may be used as intermediates or,
+// if no roots are added, as roots when self-signed
+func (b *ChainBuilder) AddCertificates(certs ...*x509.Certificate) {
+	for _, cert := range certs {
+		if !containsCertificate(b.certs, cert) {
+			b.certs = append(b.certs, cert)
+		}
+	}
+}
+
+// AddRoots adds trusted roots. Once any roots are added, every chain must end
+// at one of them. Roots need not be self-signed.
+func (b *ChainBuilder) AddRoots(roots ...*x509.Certificate) {
+	for _, root := range roots {
+		if !containsCertificate(b.roots, root) {
+			b.roots = append(b.roots, root)
+		}
+	}
+}
+
+// AddPEM parses the certificates in a string of concatenated PEM blocks and
+// adds them with AddCertificates. Blocks that are not certificates, such as
+// private keys, are ignored.
+func (b *ChainBuilder) AddPEM(pemBundle string) error {
+	certs, err := ParsePEMCertificates(pemBundle)
+	if err != nil {
+		return err
+	}
+	b.AddCertificates(certs...)
+	return nil
+}
+
+// Build returns every valid chain from leaf to a root, each ordered from leaf
+// to root, shortest first. If no valid chain exists, the returned error is a
+// *ChainError.
+func (b *ChainBuilder) Build(leaf *x509.Certificate) ([][]*x509.Certificate, error) {
+	if leaf == nil {
+		return nil, errutil.UserError{Err: "no certificate given to build a chain for"}
+	}
+
+	now := b.CurrentTime
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	s := &chainSearch{
+		builder: b,
+		now:     now,
+	}
+	if err := s.checkValidity(leaf); err != nil {
+		return nil, err
+	}
+	s.search([]*x509.Certificate{leaf})
+
+	if len(s.chains) == 0 {
+		return nil, s.err
+	}
+	sort.Stable(byChainLength(s.chains))
+	return s.chains, nil
+}
+
+// byChainLength sorts chains from shortest to longest
+type byChainLength [][]*x509.Certificate
+
+func (c byChainLength) Len() int           { return len(c) }
+func (c byChainLength) Swap(i, j int)      { c[i], c[j] = c[j], c[i] }
+func (c byChainLength) Less(i, j int) bool { return len(c[i]) < len(c[j]) }
+
+// Order determines the leaf of the added certificates, which is the only
+// certificate that did not issue any of the others, and returns the
+// shortest valid chain from it.
+func (b *ChainBuilder) Order() ([]*x509.Certificate, error) {
+	var leaves []*x509.Certificate
+	for _, cert := range b.certs {
+		issuedOther := false
+		for _, other := range b.certs {
+			if other != cert && issuedBy(other, cert) {
+				issuedOther = true
+				break
+			}
+		}
+		if !issuedOther {
+			leaves = append(leaves, cert)
+		}
+	}
+
+	switch len(leaves) {
+	case 0:
+		return nil, errutil.UserError{Err: "unable to determine the leaf certificate of the bundle"}
+	case 1:
+	default:
+		names := make([]string, len(leaves))
+		for i, leaf := range leaves {
+			names[i] = fmt.Sprintf("%q", leaf.Subject.CommonName)
+		}
+		return nil, errutil.UserError{Err: fmt.Sprintf("bundle contains more than one leaf certificate: %s", strings.Join(names, ", "))}
+	}
+
+	chains, err := b.Build(leaves[0])
+	if err != nil {
+		return nil, err
+	}
+	return chains[0], nil
+}
+
+// chainSearch holds the state of a single Build
+type chainSearch struct {
+	builder *ChainBuilder
+	now     time.Time
+	chains  [][]*x509.Certificate
+
+	// The failure that got furthest, reported if no chain is found
+	err      *ChainError
+	errDepth int
+}
+
+func (s *chainSearch) fail(depth int, err *ChainError) {
+	if s.err == nil || depth > s.errDepth {
+		s.err = err
+		s.errDepth = depth
+	}
+}
+
+// search extends the chain, whose last element has been verified, toward
+// every root it can reach
+func (s *chainSearch) search(chain []*x509.Certificate) {
+	cert := chain[len(chain)-1]
+	depth := len(chain)
+
+	// A trusted root ends the chain
+	if len(s.builder.roots) > 0 && containsCertificate(s.builder.roots, cert) {
+		s.chains = append(s.chains, append([]*x509.Certificate(nil), chain...))
+		return
+	}
+
+	if isSelfSigned(cert) {
+		if len(s.builder.roots) == 0 {
+			s.chains = append(s.chains, append([]*x509.Certificate(nil), chain...))
+		} else {
+			s.fail(depth, &ChainError{
+				Kind:        ChainUntrustedRoot,
+				Certificate: cert,
+				Err:         fmt.Sprintf("certificate %q is self-signed but is not a trusted root", cert.Subject.CommonName),
+			})
+		}
+		return
+	}
+
+	found := false
+	for _, issuer := range s.candidates(cert) {
+		if containsCertificate(chain, issuer) {
+			continue
+		}
+		found = true
+
+		if err := cert.CheckSignatureFrom(issuer); err != nil {
+			kind := ChainInvalidSignature
+			if _, ok := err.(x509.ConstraintViolationError); ok {
+				kind = ChainNotAuthorized
+			}
+			s.fail(depth, &ChainError{
+				Kind:        kind,
+				Certificate: cert,
+				Err:         fmt.Sprintf("certificate %q cannot be verified by %q: %v", cert.Subject.CommonName, issuer.Subject.CommonName, err),
+			})
+			continue
+		}
+		if !issuer.IsCA {
+			s.fail(depth, &ChainError{
+				Kind:        ChainNotAuthorized,
+				Certificate: cert,
+				Err:         fmt.Sprintf("certificate %q was issued by %q, which is not a CA", cert.Subject.CommonName, issuer.Subject.CommonName),
+			})
+			continue
+		}
+		// The path length counts the intermediates below the issuer, not
+		// including the leaf
+		if issuer.MaxPathLen >= 0 && depth-1 > issuer.MaxPathLen {
+			s.fail(depth, &ChainError{
+				Kind:        ChainNotAuthorized,
+				Certificate: cert,
+				Err:         fmt.Sprintf("path length constraint of %q is exceeded", issuer.Subject.CommonName),
+			})
+			continue
+		}
+		if err := s.checkValidity(issuer); err != nil {
+			s.fail(depth+1, err)
+			continue
+		}
+
+		s.search(append(chain, issuer))
+	}
+
+	if !found {
+		s.fail(depth, &ChainError{
+			Kind:        ChainMissingIssuer,
+			Certificate: cert,
+			Err:         fmt.Sprintf("issuer %q of certificate %q was not found", cert.Issuer.CommonName, cert.Subject.CommonName),
+		})
+	}
+}
+
+// candidates returns the known certificates whose subject matches the
+// certificate's issuer
+func (s *chainSearch) candidates(cert *x509.Certificate) []*x509.Certificate {
+	var ret []*x509.Certificate
+	for _, pool := range [][]*x509.Certificate{s.builder.roots, s.builder.certs} {
+		for _, candidate := range pool {
+			if issuedBy(cert, candidate) && !containsCertificate(ret, candidate) {
+				ret = append(ret, candidate)
+			}
+		}
+	}
+	return ret
+}
+
+func (s *chainSearch) checkValidity(cert *x509.Certificate) *ChainError {
+	if s.now.Before(cert.NotBefore) || s.now.After(cert.NotAfter) {
+		return &ChainError{
+			Kind:        ChainExpired,
+			Certificate: cert,
+			Err:         fmt.Sprintf("certificate %q is only valid from %s to %s", cert.Subject.CommonName, cert.NotBefore.Format(time.RFC3339), cert.NotAfter.Format(time.RFC3339)),
+		}
+	}
+	return nil
+}
+
+// ParsePEMCertificates parses every certificate in a string of concatenated
+// PEM blocks, ignoring blocks of other types
+func ParsePEMCertificates(pemBundle string) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	rest := []byte(strings.TrimSpace(pemBundle))
+	for len(rest) > 0 {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		parsed, err := x509.ParseCertificates(block.Bytes)
+		if err != nil {
+			return nil, errutil.UserError{Err: fmt.Sprintf("error parsing certificate: %v", err)}
+		}
+		certs = append(certs, parsed...)
+	}
+	if len(certs) == 0 {
+		return nil, errutil.UserError{Err: "no certificates found in bundle"}
+	}
+	return certs, nil
+}
+
+// issuedBy returns whether cert names issuer as its issuer, by subject and,
+// where both are present, key ID
+func issuedBy(cert, issuer *x509.Certificate) bool {
+	if !bytes.Equal(cert.RawIssuer, issuer.RawSubject) {
+		return false
+	}
+	if len(cert.AuthorityKeyId) > 0 && len(issuer.SubjectKeyId) > 0 {
+		return bytes.Equal(cert.AuthorityKeyId, issuer.SubjectKeyId)
+	}
+	return true
+}
+
+func isSelfSigned(cert *x509.Certificate) bool {
+	return issuedBy(cert, cert) && cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature) == nil
+}
+
+func containsCertificate(certs []*x509.Certificate, cert *x509.Certificate) bool {
+	for _, c := range certs {
+		if c.Equal(cert) {
+			return true
+		}
+	}
+	return false
+}
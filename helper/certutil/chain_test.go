@@ -0,0 +1,262 @@
+package certutil
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testChainCert struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+var testChainSerial int64
+
+// testChainIssue creates a certificate for cn signed by issuer, or
+// self-signed if issuer is nil. If key is nil a new one is generated.
+func testChainIssue(t *testing.T, cn string, isCA bool, key crypto.Signer, issuer *testChainCert, modify func(*x509.Certificate)) *testChainCert {
+	if key == nil {
+		var err error
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	subjKeyID, err := GetSubjKeyID(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testChainSerial++
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(testChainSerial),
+		Subject:               pkix.Name{CommonName: cn},
+		SubjectKeyId:          subjKeyID,
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	if isCA {
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	} else {
+		template.KeyUsage = x509.KeyUsageDigitalSignature
+	}
+	if modify != nil {
+		modify(template)
+	}
+
+	parent, signer := template, key
+	if issuer != nil {
+		parent, signer = issuer.cert, issuer.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, key.Public(), signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testChainCert{cert: cert, key: key}
+}
+
+func testChainCNs(chain []*x509.Certificate) string {
+	cns := make([]string, len(chain))
+	for i, cert := range chain {
+		cns[i] = cert.Subject.CommonName
+	}
+	return strings.Join(cns, ",")
+}
+
+func TestChainBuilder_Build(t *testing.T) {
+	root := testChainIssue(t, "root", true, nil, nil, nil)
+	inter := testChainIssue(t, "inter", true, nil, root, nil)
+	leaf := testChainIssue(t, "leaf", false, nil, inter, nil)
+
+	// Unordered, and without trusted roots the self-signed root ends the chain
+	b := NewChainBuilder()
+	b.AddCertificates(root.cert, leaf.cert, inter.cert)
+	chains, err := b.Build(leaf.cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chains) != 1 || testChainCNs(chains[0]) != "leaf,inter,root" {
+		t.Fatalf("bad chains: %v", chains)
+	}
+
+	ordered, err := b.Order()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if testChainCNs(ordered) != "leaf,inter,root" {
+		t.Fatalf("bad order: %s", testChainCNs(ordered))
+	}
+
+	// A trusted intermediate ends the chain
+	b = NewChainBuilder()
+	b.AddRoots(inter.cert)
+	chains, err = b.Build(leaf.cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chains) != 1 || testChainCNs(chains[0]) != "leaf,inter" {
+		t.Fatalf("bad chains: %v", chains)
+	}
+}
+
+func TestChainBuilder_CrossSigned(t *testing.T) {
+	oldRoot := testChainIssue(t, "old root", true, nil, nil, nil)
+	newRoot := testChainIssue(t, "new root", true, nil, nil, nil)
+	// The new root cross-signed by the old one
+	cross := testChainIssue(t, "new root", true, newRoot.key, oldRoot, nil)
+	inter := testChainIssue(t, "inter", true, nil, newRoot, nil)
+	leaf := testChainIssue(t, "leaf", false, nil, inter, nil)
+
+	b := NewChainBuilder()
+	b.AddCertificates(leaf.cert, inter.cert, cross.cert, newRoot.cert, oldRoot.cert)
+	chains, err := b.Build(leaf.cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chains) != 2 || testChainCNs(chains[0]) != "leaf,inter,new root" || testChainCNs(chains[1]) != "leaf,inter,new root,old root" {
+		t.Fatalf("bad chains: %v", chains)
+	}
+	if !chains[1][2].Equal(cross.cert) {
+		t.Fatal("expected the cross-signed certificate in the longer chain")
+	}
+
+	// Trusting only the old root requires the cross-signed certificate
+	b = NewChainBuilder()
+	b.AddCertificates(leaf.cert, inter.cert, cross.cert, newRoot.cert)
+	b.AddRoots(oldRoot.cert)
+	chains, err = b.Build(leaf.cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chains) != 1 || testChainCNs(chains[0]) != "leaf,inter,new root,old root" {
+		t.Fatalf("bad chains: %v", chains)
+	}
+}
+
+func TestChainBuilder_Errors(t *testing.T) {
+	root := testChainIssue(t, "root", true, nil, nil, nil)
+	inter := testChainIssue(t, "inter", true, nil, root, nil)
+	leaf := testChainIssue(t, "leaf", false, nil, inter, nil)
+
+	checkErr := func(b *ChainBuilder, cert *x509.Certificate, kind ChainErrorKind, at string) {
+		_, err := b.Build(cert)
+		chainErr, ok := err.(*ChainError)
+		if !ok {
+			t.Fatalf("expected chain error, got %v", err)
+		}
+		if chainErr.Kind != kind || chainErr.Certificate.Subject.CommonName != at {
+			t.Fatalf("expected %s at %q, got %s at %q: %v", kind, at, chainErr.Kind, chainErr.Certificate.Subject.CommonName, err)
+		}
+	}
+
+	// Missing intermediate
+	b := NewChainBuilder()
+	b.AddCertificates(leaf.cert, root.cert)
+	checkErr(b, leaf.cert, ChainMissingIssuer, "leaf")
+
+	// Missing root
+	b = NewChainBuilder()
+	b.AddCertificates(leaf.cert, inter.cert)
+	checkErr(b, leaf.cert, ChainMissingIssuer, "inter")
+
+	// Untrusted root
+	otherRoot := testChainIssue(t, "other root", true, nil, nil, nil)
+	b = NewChainBuilder()
+	b.AddCertificates(leaf.cert, inter.cert, root.cert)
+	b.AddRoots(otherRoot.cert)
+	checkErr(b, leaf.cert, ChainUntrustedRoot, "root")
+
+	// An impostor with the same name but a different key
+	impostor := testChainIssue(t, "inter", true, nil, root, func(c *x509.Certificate) {
+		c.SubjectKeyId = inter.cert.SubjectKeyId
+	})
+	b = NewChainBuilder()
+	b.AddCertificates(leaf.cert, impostor.cert, root.cert)
+	checkErr(b, leaf.cert, ChainInvalidSignature, "leaf")
+
+	// Issued by a certificate that is not a CA
+	notCA := testChainIssue(t, "not ca", false, nil, root, nil)
+	badLeaf := testChainIssue(t, "bad leaf", false, nil, notCA, nil)
+	b = NewChainBuilder()
+	b.AddCertificates(badLeaf.cert, notCA.cert, root.cert)
+	checkErr(b, badLeaf.cert, ChainNotAuthorized, "bad leaf")
+
+	// Path length constraint
+	limited := testChainIssue(t, "limited", true, nil, root, func(c *x509.Certificate) {
+		c.MaxPathLenZero = true
+	})
+	sub := testChainIssue(t, "sub", true, nil, limited, nil)
+	subLeaf := testChainIssue(t, "sub leaf", false, nil, sub, nil)
+	b = NewChainBuilder()
+	b.AddCertificates(subLeaf.cert, sub.cert, limited.cert, root.cert)
+	checkErr(b, subLeaf.cert, ChainNotAuthorized, "sub")
+
+	// Expired intermediate
+	expired := testChainIssue(t, "expired", true, nil, root, func(c *x509.Certificate) {
+		c.NotAfter = time.Now().Add(-time.Minute)
+	})
+	expiredLeaf := testChainIssue(t, "expired leaf", false, nil, expired, nil)
+	b = NewChainBuilder()
+	b.AddCertificates(expiredLeaf.cert, expired.cert, root.cert)
+	checkErr(b, expiredLeaf.cert, ChainExpired, "expired")
+
+	// The same chain is valid at an earlier time
+	b.CurrentTime = time.Now().Add(-30 * time.Minute)
+	if _, err := b.Build(expiredLeaf.cert); err != nil {
+		t.Fatal(err)
+	}
+
+	// More than one leaf cannot be ordered
+	otherLeaf := testChainIssue(t, "other leaf", false, nil, inter, nil)
+	b = NewChainBuilder()
+	b.AddCertificates(leaf.cert, otherLeaf.cert, inter.cert, root.cert)
+	if _, err := b.Order(); err == nil || !strings.Contains(err.Error(), "more than one leaf") {
+		t.Fatalf("bad error: %v", err)
+	}
+}
+
+func TestChainBuilder_AddPEM(t *testing.T) {
+	root := testChainIssue(t, "root", true, nil, nil, nil)
+	leaf := testChainIssue(t, "leaf", false, nil, root, nil)
+
+	keyBytes, err := x509.MarshalECPrivateKey(leaf.key.(*ecdsa.PrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle := strings.Join([]string{
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyBytes})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: root.cert.Raw})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.cert.Raw})),
+	}, "")
+
+	b := NewChainBuilder()
+	if err := b.AddPEM(bundle); err != nil {
+		t.Fatal(err)
+	}
+	ordered, err := b.Order()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if testChainCNs(ordered) != "leaf,root" {
+		t.Fatalf("bad order: %s", testChainCNs(ordered))
+	}
+
+	if err := NewChainBuilder().AddPEM("not a bundle"); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/helper/jsonutil"
 	"github.com/mitchellh/mapstructure"
+	"golang.org/x/crypto/ed25519"
 )
 
 // GetOctalFormatted returns the byte buffer formatted in octal with
@@ -56,7 +57,7 @@ func GetSubjKeyID(privateKey crypto.Signer) ([]byte, error) {
 		return nil, errutil.InternalError{"passed-in private key is nil"}
 	}
 
-	marshaledKey, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+	marshaledKey, err := MarshalPKIXPublicKey(privateKey.Public())
 	if err != nil {
 		return nil, errutil.InternalError{fmt.Sprintf("error marshalling public key: %s", err)}
 	}
@@ -139,7 +140,7 @@ func ParsePEMBundle(pemBundle string) (*ParsedCertBundle, error) {
 			parsedBundle.PrivateKeyFormat = PKCS1Block
 			parsedBundle.PrivateKeyBytes = pemBlock.Bytes
 			parsedBundle.PrivateKey = signer
-		} else if signer, err := x509.ParsePKCS8PrivateKey(pemBlock.Bytes); err == nil {
+		} else if signer, err := ParsePKCS8PrivateKey(pemBlock.Bytes); err == nil {
 			parsedBundle.PrivateKeyFormat = PKCS8Block
 
 			if parsedBundle.PrivateKeyType != UnknownPrivateKey {
@@ -154,6 +155,12 @@ func ParsePEMBundle(pemBundle string) (*ParsedCertBundle, error) {
 				parsedBundle.PrivateKey = signer
 				parsedBundle.PrivateKeyType = ECPrivateKey
 				parsedBundle.PrivateKeyBytes = pemBlock.Bytes
+			case ed25519.PrivateKey:
+				parsedBundle.PrivateKey = signer
+				parsedBundle.PrivateKeyType = Ed25519PrivateKey
+				parsedBundle.PrivateKeyBytes = pemBlock.Bytes
+			case X25519PrivateKey:
+				return nil, errutil.UserError{"X25519 private keys cannot sign and are not supported in a bundle"}
 			}
 		} else if certificates, err := x509.ParseCertificates(pemBlock.Bytes); err == nil {
 			switch len(certificates) {
@@ -203,7 +210,8 @@ func ParsePEMBundle(pemBundle string) (*ParsedCertBundle, error) {
 	return parsedBundle, nil
 }
 
-// GeneratePrivateKey generates a private key with the specified type and key bits
+// GeneratePrivateKey generates a private key with the specified type and key
+// bits. Ed25519 keys have a fixed size, so keyBits is ignored for them.
 func GeneratePrivateKey(keyType string, keyBits int, container ParsedPrivateKeyContainer) error {
 	var err error
 	var privateKeyType PrivateKeyType
@@ -241,6 +249,17 @@ func GeneratePrivateKey(keyType string, keyBits int, container ParsedPrivateKeyC
 		if err != nil {
 			return errutil.InternalError{Err: fmt.Sprintf("error marshalling EC private key: %v", err)}
 		}
+	case "ed25519":
+		privateKeyType = Ed25519PrivateKey
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return errutil.InternalError{Err: fmt.Sprintf("error generating Ed25519 private key: %v", err)}
+		}
+		// Ed25519 keys have no encoding of their own, only PKCS#8
+		privateKeyBytes, err = MarshalPKCS8PrivateKey(privateKey)
+		if err != nil {
+			return errutil.InternalError{Err: fmt.Sprintf("error marshalling Ed25519 private key: %v", err)}
+		}
 	default:
 		return errutil.UserError{Err: fmt.Sprintf("unknown key type: %s", keyType)}
 	}
@@ -295,6 +314,22 @@ func ComparePublicKeys(key1Iface, key2Iface crypto.PublicKey) (bool, error) {
 		}
 		return true, nil
 
+	case ed25519.PublicKey:
+		key1 := key1Iface.(ed25519.PublicKey)
+		key2, ok := key2Iface.(ed25519.PublicKey)
+		if !ok {
+			return false, fmt.Errorf("key types do not match: %T and %T", key1Iface, key2Iface)
+		}
+		return bytes.Equal(key1, key2), nil
+
+	case X25519PublicKey:
+		key1 := key1Iface.(X25519PublicKey)
+		key2, ok := key2Iface.(X25519PublicKey)
+		if !ok {
+			return false, fmt.Errorf("key types do not match: %T and %T", key1Iface, key2Iface)
+		}
+		return bytes.Equal(key1, key2), nil
+
 	default:
 		return false, fmt.Errorf("cannot compare key with type %T", key1Iface)
 	}
@@ -0,0 +1,170 @@
+package certutil
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/ed25519"
+)
+
+// The algorithm identifiers of Ed25519 and X25519 keys, from RFC 8410. The
+// standard library does not know about either of them, so keys of these
+// types are encoded and decoded here.
+var (
+	oidEd25519 = asn1.ObjectIdentifier{1, 3, 101, 112}
+	oidX25519  = asn1.ObjectIdentifier{1, 3, 101, 110}
+)
+
+// X25519KeySize is the size in bytes of X25519 private and public keys
+const X25519KeySize = 32
+
+// X25519PrivateKey is an X25519 private key. X25519 keys are only used for
+// key agreement; they cannot sign and so cannot be used in a bundle.
+type X25519PrivateKey []byte
+
+// X25519PublicKey is an X25519 public key
+type X25519PublicKey []byte
+
+// Public returns the public key corresponding to the private key
+func (k X25519PrivateKey) Public() crypto.PublicKey {
+	var scalar, public [X25519KeySize]byte
+	copy(scalar[:], k)
+	curve25519.ScalarBaseMult(&public, &scalar)
+	return X25519PublicKey(public[:])
+}
+
+// GenerateX25519Key generates an X25519 private key using entropy from rand
+func GenerateX25519Key(rand io.Reader) (X25519PrivateKey, error) {
+	key := make([]byte, X25519KeySize)
+	if _, err := io.ReadFull(rand, key); err != nil {
+		return nil, err
+	}
+	return X25519PrivateKey(key), nil
+}
+
+// pkcs8 is the ASN.1 structure of a PKCS#8 private key. Attributes are
+// ignored.
+type pkcs8 struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+// subjectPublicKeyInfo is the ASN.1 structure of an X.509 public key
+type subjectPublicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// ParsePKCS8PrivateKey parses a PKCS#8 private key. Ed25519 keys are returned
+// as an ed25519.PrivateKey and X25519 keys as an X25519PrivateKey; all other
+// keys are parsed by x509.ParsePKCS8PrivateKey.
+func ParsePKCS8PrivateKey(der []byte) (interface{}, error) {
+	var privKey pkcs8
+	if _, err := asn1.Unmarshal(der, &privKey); err != nil {
+		return nil, err
+	}
+
+	isEd25519 := privKey.Algo.Algorithm.Equal(oidEd25519)
+	if !isEd25519 && !privKey.Algo.Algorithm.Equal(oidX25519) {
+		return x509.ParsePKCS8PrivateKey(der)
+	}
+
+	// The private key is itself an octet string, holding the seed for
+	// Ed25519 keys and the scalar for X25519 keys
+	var seed []byte
+	if _, err := asn1.Unmarshal(privKey.PrivateKey, &seed); err != nil {
+		return nil, fmt.Errorf("error parsing private key: %v", err)
+	}
+	if len(seed) != X25519KeySize {
+		return nil, fmt.Errorf("invalid private key length %d", len(seed))
+	}
+
+	if !isEd25519 {
+		return X25519PrivateKey(seed), nil
+	}
+	_, key, err := ed25519.GenerateKey(bytes.NewReader(seed))
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// MarshalPKCS8PrivateKey encodes an ed25519.PrivateKey or an
+// X25519PrivateKey in PKCS#8 form
+func MarshalPKCS8PrivateKey(key interface{}) ([]byte, error) {
+	var privKey pkcs8
+	var seed []byte
+	switch key := key.(type) {
+	case ed25519.PrivateKey:
+		if len(key) != ed25519.PrivateKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 private key length %d", len(key))
+		}
+		privKey.Algo.Algorithm = oidEd25519
+		seed = key[:X25519KeySize]
+	case X25519PrivateKey:
+		if len(key) != X25519KeySize {
+			return nil, fmt.Errorf("invalid X25519 private key length %d", len(key))
+		}
+		privKey.Algo.Algorithm = oidX25519
+		seed = key
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+
+	var err error
+	privKey.PrivateKey, err = asn1.Marshal(seed)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(privKey)
+}
+
+// MarshalPKIXPublicKey behaves like x509.MarshalPKIXPublicKey, except that it
+// also encodes ed25519.PublicKey and X25519PublicKey keys
+func MarshalPKIXPublicKey(pub crypto.PublicKey) ([]byte, error) {
+	var spki subjectPublicKeyInfo
+	switch pub := pub.(type) {
+	case ed25519.PublicKey:
+		spki.Algorithm.Algorithm = oidEd25519
+		spki.PublicKey.Bytes = pub
+	case X25519PublicKey:
+		spki.Algorithm.Algorithm = oidX25519
+		spki.PublicKey.Bytes = pub
+	default:
+		return x509.MarshalPKIXPublicKey(pub)
+	}
+	spki.PublicKey.BitLength = 8 * len(spki.PublicKey.Bytes)
+	return asn1.Marshal(spki)
+}
+
+// CertificatePublicKey returns the public key of the certificate. Unlike
+// cert.PublicKey, this includes Ed25519 and X25519 keys, which are returned
+// as an ed25519.PublicKey and an X25519PublicKey respectively.
+func CertificatePublicKey(cert *x509.Certificate) (crypto.PublicKey, error) {
+	var spki subjectPublicKeyInfo
+	if _, err := asn1.Unmarshal(cert.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case spki.Algorithm.Algorithm.Equal(oidEd25519):
+		if len(spki.PublicKey.Bytes) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 public key length %d", len(spki.PublicKey.Bytes))
+		}
+		return ed25519.PublicKey(spki.PublicKey.Bytes), nil
+	case spki.Algorithm.Algorithm.Equal(oidX25519):
+		if len(spki.PublicKey.Bytes) != X25519KeySize {
+			return nil, fmt.Errorf("invalid X25519 public key length %d", len(spki.PublicKey.Bytes))
+		}
+		return X25519PublicKey(spki.PublicKey.Bytes), nil
+	default:
+		return cert.PublicKey, nil
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"strings"
 
 	"github.com/hashicorp/vault/helper/errutil"
+	"golang.org/x/crypto/ed25519"
 )
 
 // Secret is used to attempt to unmarshal a Vault secret
@@ -25,8 +26,8 @@ type Secret struct {
 	Data map[string]interface{} `json:"data"`
 }
 
-// PrivateKeyType holds a string representation of the type of private key (ec
-// or rsa) referenced in CertBundle and ParsedCertBundle. This uses colloquial
+// PrivateKeyType holds a string representation of the type of private key (ec,
+// rsa or ed25519) referenced in CertBundle and ParsedCertBundle. This uses colloquial
 // names rather than official names, to eliminate confusion
 type PrivateKeyType string
 
@@ -35,6 +36,7 @@ const (
 	UnknownPrivateKey PrivateKeyType = ""
 	RSAPrivateKey     PrivateKeyType = "rsa"
 	ECPrivateKey      PrivateKeyType = "ec"
+	Ed25519PrivateKey PrivateKeyType = "ed25519"
 )
 
 // TLSUsage controls whether the intended usage of a *tls.Config
@@ -71,6 +73,7 @@ type CertBundle struct {
 	PrivateKeyType PrivateKeyType `json:"private_key_type" structs:"private_key_type" mapstructure:"private_key_type"`
 	Certificate    string         `json:"certificate" structs:"certificate" mapstructure:"certificate"`
 	IssuingCA      string         `json:"issuing_ca" structs:"issuing_ca" mapstructure:"issuing_ca"`
+	CAChain        []string       `json:"ca_chain" structs:"ca_chain" mapstructure:"ca_chain"`
 	PrivateKey     string         `json:"private_key" structs:"private_key" mapstructure:"private_key"`
 	SerialNumber   string         `json:"serial_number" structs:"serial_number" mapstructure:"serial_number"`
 }
@@ -84,10 +87,18 @@ type ParsedCertBundle struct {
 	PrivateKey       crypto.Signer
 	IssuingCABytes   []byte
 	IssuingCA        *x509.Certificate
+	CAChain          []*CertBlock
 	CertificateBytes []byte
 	Certificate      *x509.Certificate
 }
 
+// CertBlock contains the DER-encoded bytes of a certificate of a CA chain
+// along with the parsed certificate
+type CertBlock struct {
+	Certificate *x509.Certificate
+	Bytes       []byte
+}
+
 // CSRBundle contains a key type, a PEM-encoded private key,
 // and a PEM-encoded CSR
 type CSRBundle struct {
@@ -138,6 +149,8 @@ func (c *CertBundle) ToParsedCertBundle() (*ParsedCertBundle, error) {
 				c.PrivateKeyType = ECPrivateKey
 			case RSAPrivateKey:
 				c.PrivateKeyType = RSAPrivateKey
+			case Ed25519PrivateKey:
+				c.PrivateKeyType = Ed25519PrivateKey
 			}
 		default:
 			return nil, errutil.UserError{fmt.Sprintf("Unsupported key block type: %s", pemBlock.Type)}
@@ -173,6 +186,21 @@ func (c *CertBundle) ToParsedCertBundle() (*ParsedCertBundle, error) {
 		}
 	}
 
+	for _, chainCert := range c.CAChain {
+		pemBlock, _ = pem.Decode([]byte(chainCert))
+		if pemBlock == nil {
+			return nil, errutil.UserError{"Error decoding CA chain from cert bundle"}
+		}
+		parsedCert, err := x509.ParseCertificate(pemBlock.Bytes)
+		if err != nil {
+			return nil, errutil.UserError{fmt.Sprintf("Error parsing CA chain certificate: %s", err)}
+		}
+		result.CAChain = append(result.CAChain, &CertBlock{
+			Certificate: parsedCert,
+			Bytes:       pemBlock.Bytes,
+		})
+	}
+
 	if len(c.SerialNumber) == 0 && len(c.Certificate) > 0 {
 		c.SerialNumber = GetOctalFormatted(result.Certificate.SerialNumber.Bytes(), ":")
 	}
@@ -202,6 +230,11 @@ func (p *ParsedCertBundle) ToCertBundle() (*CertBundle, error) {
 		result.IssuingCA = strings.TrimSpace(string(pem.EncodeToMemory(&block)))
 	}
 
+	for _, chainCert := range p.CAChain {
+		block.Bytes = chainCert.Bytes
+		result.CAChain = append(result.CAChain, strings.TrimSpace(string(pem.EncodeToMemory(&block))))
+	}
+
 	if p.PrivateKeyBytes != nil && len(p.PrivateKeyBytes) > 0 {
 		block.Type = string(p.PrivateKeyFormat)
 		block.Bytes = p.PrivateKeyBytes
@@ -214,6 +247,8 @@ func (p *ParsedCertBundle) ToCertBundle() (*CertBundle, error) {
 				block.Type = string(ECBlock)
 			case RSAPrivateKey:
 				block.Type = string(PKCS1Block)
+			case Ed25519PrivateKey:
+				block.Type = string(PKCS8Block)
 			}
 		}
 
@@ -249,9 +284,9 @@ func (p *ParsedCertBundle) getSigner() (crypto.Signer, error) {
 		}
 
 	case PKCS8Block:
-		if k, err := x509.ParsePKCS8PrivateKey(p.PrivateKeyBytes); err == nil {
+		if k, err := ParsePKCS8PrivateKey(p.PrivateKeyBytes); err == nil {
 			switch k := k.(type) {
-			case *rsa.PrivateKey, *ecdsa.PrivateKey:
+			case *rsa.PrivateKey, *ecdsa.PrivateKey, ed25519.PrivateKey:
 				return k.(crypto.Signer), nil
 			default:
 				return nil, errutil.UserError{"Found unknown private key type in pkcs#8 wrapping"}
@@ -259,7 +294,7 @@ func (p *ParsedCertBundle) getSigner() (crypto.Signer, error) {
 		}
 		return nil, errutil.UserError{fmt.Sprintf("Failed to parse pkcs#8 key: %v", err)}
 	default:
-		return nil, errutil.UserError{"Unable to determine type of private key; only RSA and EC are supported"}
+		return nil, errutil.UserError{"Unable to determine type of private key; only RSA, EC and Ed25519 are supported"}
 	}
 	return signer, nil
 }
@@ -272,7 +307,7 @@ func (p *ParsedCertBundle) SetParsedPrivateKey(privateKey crypto.Signer, private
 }
 
 func getPKCS8Type(bs []byte) (PrivateKeyType, error) {
-	k, err := x509.ParsePKCS8PrivateKey(bs)
+	k, err := ParsePKCS8PrivateKey(bs)
 	if err != nil {
 		return UnknownPrivateKey, errutil.UserError{fmt.Sprintf("Failed to parse pkcs#8 key: %v", err)}
 	}
@@ -282,6 +317,8 @@ func getPKCS8Type(bs []byte) (PrivateKeyType, error) {
 		return ECPrivateKey, nil
 	case *rsa.PrivateKey:
 		return RSAPrivateKey, nil
+	case ed25519.PrivateKey:
+		return Ed25519PrivateKey, nil
 	default:
 		return UnknownPrivateKey, errutil.UserError{"Found unknown private key type in pkcs#8 wrapping"}
 	}
@@ -314,6 +351,9 @@ func (c *CSRBundle) ToParsedCSRBundle() (*ParsedCSRBundle, error) {
 			} else if _, err := x509.ParsePKCS1PrivateKey(pemBlock.Bytes); err == nil {
 				result.PrivateKeyType = RSAPrivateKey
 				c.PrivateKeyType = "rsa"
+			} else if t, err := getPKCS8Type(pemBlock.Bytes); err == nil && t == Ed25519PrivateKey {
+				result.PrivateKeyType = Ed25519PrivateKey
+				c.PrivateKeyType = "ed25519"
 			} else {
 				return nil, errutil.UserError{fmt.Sprintf("Unknown private key type in bundle: %s", c.PrivateKeyType)}
 			}
@@ -362,6 +402,9 @@ func (p *ParsedCSRBundle) ToCSRBundle() (*CSRBundle, error) {
 		case ECPrivateKey:
 			result.PrivateKeyType = "ec"
 			block.Type = "EC PRIVATE KEY"
+		case Ed25519PrivateKey:
+			result.PrivateKeyType = "ed25519"
+			block.Type = "PRIVATE KEY"
 		default:
 			return nil, errutil.InternalError{"Could not determine private key type when creating block"}
 		}
@@ -396,8 +439,19 @@ func (p *ParsedCSRBundle) getSigner() (crypto.Signer, error) {
 			return nil, errutil.UserError{fmt.Sprintf("Unable to parse CA's private RSA key: %s", err)}
 		}
 
+	case Ed25519PrivateKey:
+		k, err := ParsePKCS8PrivateKey(p.PrivateKeyBytes)
+		if err != nil {
+			return nil, errutil.UserError{fmt.Sprintf("Unable to parse CA's private Ed25519 key: %s", err)}
+		}
+		key, ok := k.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errutil.UserError{"Found unknown private key type in pkcs#8 wrapping"}
+		}
+		signer = key
+
 	default:
-		return nil, errutil.UserError{"Unable to determine type of private key; only RSA and EC are supported"}
+		return nil, errutil.UserError{"Unable to determine type of private key; only RSA, EC and Ed25519 are supported"}
 	}
 	return signer, nil
 }
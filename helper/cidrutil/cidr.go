@@ -0,0 +1,59 @@
+package cidrutil
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ParseCIDRs parses a list of CIDR blocks. Single IP addresses are accepted
+// and converted to blocks containing only them. The blocks are returned in
+// their canonical form.
+func ParseCIDRs(cidrs []string) ([]string, error) {
+	var parsed []string
+	for _, cidr := range cidrs {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+
+		if !strings.Contains(cidr, "/") {
+			ip := net.ParseIP(cidr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", cidr)
+			}
+			if ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR block %q", cidr)
+		}
+		parsed = append(parsed, ipNet.String())
+	}
+	return parsed, nil
+}
+
+// IPBelongsToCIDRs returns whether the given IP address belongs to one of
+// the CIDR blocks. Invalid addresses and blocks never match.
+func IPBelongsToCIDRs(ipAddr string, cidrs []string) bool {
+	ip := net.ParseIP(ipAddr)
+	if ip == nil {
+		return false
+	}
+
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			continue
+		}
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package cidrutil
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCIDRs(t *testing.T) {
+	parsed, err := ParseCIDRs([]string{"10.0.0.0/8", " 192.168.1.10 ", "", "10.1.2.3/16", "::1"})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expected := []string{"10.0.0.0/8", "192.168.1.10/32", "10.1.0.0/16", "::1/128"}
+	if !reflect.DeepEqual(parsed, expected) {
+		t.Fatalf("bad: %v", parsed)
+	}
+
+	for _, invalid := range []string{"10.0.0.0/33", "foo", "10.0.0/8"} {
+		if _, err := ParseCIDRs([]string{invalid}); err == nil {
+			t.Fatalf("%s: expected error", invalid)
+		}
+	}
+}
+
+func TestIPBelongsToCIDRs(t *testing.T) {
+	cidrs := []string{"10.0.0.0/8", "192.168.1.10/32"}
+
+	cases := map[string]bool{
+		"10.20.30.40":  true,
+		"192.168.1.10": true,
+		"192.168.1.11": false,
+		"127.0.0.1":    false,
+		"":             false,
+		"foo":          false,
+	}
+	for ip, expected := range cases {
+		if actual := IPBelongsToCIDRs(ip, cidrs); actual != expected {
+			t.Fatalf("%q: expected %v, got %v", ip, expected, actual)
+		}
+	}
+}
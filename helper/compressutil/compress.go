@@ -4,8 +4,13 @@ import (
 	"bytes"
 	"compress/gzip"
 	"compress/lzw"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/golang/snappy"
 )
 
 const (
@@ -20,9 +25,74 @@ const (
 	// Byte value used as canary when using Lzw format
 	CompressionCanaryLzw byte = 'L'
 
+	// Byte value used as canary when using Snappy format
+	CompressionCanarySnappy byte = 'S'
+
+	// Byte value used as canary when using Zstd format
+	CompressionCanaryZstd byte = 'Z'
+
 	CompressionTypeLzw = "lzw"
 
 	CompressionTypeGzip = "gzip"
+
+	CompressionTypeSnappy = "snappy"
+
+	CompressionTypeZstd = "zstd"
+)
+
+// Pools of compression writers for CompressWriter, and of readers for
+// DecompressReader. Gzip writers are pooled per
+// compression level, since the level cannot be changed on Reset.
+var (
+	gzipWriterPools = newGzipWriterPools()
+
+	snappyWriterPool = sync.Pool{
+		New: func() interface{} {
+			return snappy.NewBufferedWriter(nil)
+		},
+	}
+
+	gzipReaderPool = sync.Pool{
+		New: func() interface{} {
+			return new(gzip.Reader)
+		},
+	}
+
+	snappyReaderPool = sync.Pool{
+		New: func() interface{} {
+			return snappy.NewReader(nil)
+		},
+	}
+)
+
+func newGzipWriterPools() map[int]*sync.Pool {
+	pools := map[int]*sync.Pool{
+		gzip.DefaultCompression: newGzipWriterPool(gzip.DefaultCompression),
+	}
+	for level := gzip.BestSpeed; level <= gzip.BestCompression; level++ {
+		pools[level] = newGzipWriterPool(level)
+	}
+	return pools
+}
+
+func newGzipWriterPool(level int) *sync.Pool {
+	return &sync.Pool{
+		New: func() interface{} {
+			// The level has already been validated
+			w, _ := gzip.NewWriterLevel(ioutil.Discard, level)
+			return w
+		},
+	}
+}
+
+// ErrDecompressionLimitExceeded is returned by DecompressWithLimit when the
+// decompressed data is larger than the given limit
+var ErrDecompressionLimitExceeded = errors.New("decompressed data exceeds the size limit")
+
+var (
+	errWriterClosed    = errors.New("compression writer is closed")
+	errReaderClosed    = errors.New("decompression reader is closed")
+	errZstdUnsupported = errors.New("zstd compression requires Vault to be built with Go 1.9 or newer")
 )
 
 // CompressionConfig is used to select a compression type to be performed by
@@ -30,46 +100,100 @@ const (
 // Supported types are:
 // * CompressionTypeLzw
 // * CompressionTypeGzip
+// * CompressionTypeSnappy
+// * CompressionTypeZstd, if ZstdSupported
 //
 // When using CompressionTypeGzip, the compression levels can also be chosen:
 // * gzip.DefaultCompression
-// * gzip.BestSpeed
-// * gzip.BestCompression
+// * gzip.BestSpeed to gzip.BestCompression
+//
+// When using CompressionTypeZstd, the compression level is given on the scale
+// of the reference implementation, from 1 to 22, and mapped to the closest
+// level the encoder implements.
 type CompressionConfig struct {
 	// Type of the compression algorithm to be used
 	Type string
 
 	// When using Gzip format, the compression level to employ
 	GzipCompressionLevel int
+
+	// When using Zstd format, the compression level to employ. Zero uses
+	// the default level.
+	ZstdCompressionLevel int
 }
 
 // Compress places the canary byte in a buffer and uses the same buffer to fill
 // in the compressed information of the given input. The configuration supports
-// two type of compression: LZW and Gzip. When using Gzip compression format,
+// four types of compression: LZW, Gzip, Snappy and Zstd. When using Gzip compression format,
 // if GzipCompressionLevel is not specified, the 'gzip.DefaultCompression' will
 // be assumed.
 func Compress(data []byte, config *CompressionConfig) ([]byte, error) {
 	var buf bytes.Buffer
-	var writer io.WriteCloser
-	var err error
+	if err := CompressTo(&buf, data, config); err != nil {
+		return nil, err
+	}
 
+	// Return the compressed bytes with canary byte at the start
+	return buf.Bytes(), nil
+}
+
+// CompressTo behaves like Compress, except that the canary byte and the
+// compressed data are written to w. Gzip and Snappy writers are pooled and
+// reused between calls, which avoids allocating their internal buffers for
+// every input on hot paths.
+func CompressTo(w io.Writer, data []byte, config *CompressionConfig) error {
+	writer, err := CompressWriter(w, config)
+	if err != nil {
+		return err
+	}
+
+	// Compress the input and place it after the canary byte
+	if _, err = writer.Write(data); err != nil {
+		return fmt.Errorf("failed to compress input data; err: %v", err)
+	}
+
+	return writer.Close()
+}
+
+// CompressWriter returns a writer that compresses the data written to it into
+// w, after first writing the canary byte for the configured type. Close must
+// be called to flush the compressed data; it does not close w. The output is
+// identical to that of Compress, so it can be read with either Decompress or
+// DecompressReader.
+func CompressWriter(w io.Writer, config *CompressionConfig) (io.WriteCloser, error) {
 	if config == nil {
 		return nil, fmt.Errorf("config is nil")
 	}
 
-	// Write the canary into the buffer and create writer to compress the
-	// input data based on the configured type
+	// Write the canary and create writer to compress the input data based
+	// on the configured type
+	var canary byte
 	switch config.Type {
 	case CompressionTypeLzw:
-		buf.Write([]byte{CompressionCanaryLzw})
-
-		writer = lzw.NewWriter(&buf, lzw.LSB, 8)
+		canary = CompressionCanaryLzw
 	case CompressionTypeGzip:
-		buf.Write([]byte{CompressionCanaryGzip})
+		canary = CompressionCanaryGzip
+	case CompressionTypeSnappy:
+		canary = CompressionCanarySnappy
+	case CompressionTypeZstd:
+		if !ZstdSupported {
+			return nil, errZstdUnsupported
+		}
+		canary = CompressionCanaryZstd
+	default:
+		return nil, fmt.Errorf("unsupported compression type")
+	}
+	if _, err := w.Write([]byte{canary}); err != nil {
+		return nil, err
+	}
+
+	switch config.Type {
+	case CompressionTypeLzw:
+		return lzw.NewWriter(w, lzw.LSB, 8), nil
 
+	case CompressionTypeGzip:
 		switch {
-		case config.GzipCompressionLevel == gzip.BestCompression,
-			config.GzipCompressionLevel == gzip.BestSpeed,
+		case config.GzipCompressionLevel >= gzip.BestSpeed && config.GzipCompressionLevel <= gzip.BestCompression,
 			config.GzipCompressionLevel == gzip.DefaultCompression:
 			// These are valid compression levels
 		default:
@@ -77,31 +201,57 @@ func Compress(data []byte, config *CompressionConfig) ([]byte, error) {
 			// any invalid value, fallback to Defaultcompression
 			config.GzipCompressionLevel = gzip.DefaultCompression
 		}
-		writer, err = gzip.NewWriterLevel(&buf, config.GzipCompressionLevel)
+		pool := gzipWriterPools[config.GzipCompressionLevel]
+		gz := pool.Get().(*gzip.Writer)
+		gz.Reset(w)
+		return &pooledWriter{
+			WriteCloser: gz,
+			release: func() {
+				gz.Reset(ioutil.Discard)
+				pool.Put(gz)
+			},
+		}, nil
+
+	case CompressionTypeZstd:
+		return newZstdWriter(w, config.ZstdCompressionLevel)
+
 	default:
-		return nil, fmt.Errorf("unsupported compression type")
-	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to create a compression writer; err: %v", err)
+		sw := snappyWriterPool.Get().(*snappy.Writer)
+		sw.Reset(w)
+		return &pooledWriter{
+			WriteCloser: sw,
+			release: func() {
+				sw.Reset(nil)
+				snappyWriterPool.Put(sw)
+			},
+		}, nil
 	}
+}
 
-	if writer == nil {
-		return nil, fmt.Errorf("failed to create a compression writer")
-	}
+// pooledWriter returns a pooled compression writer to its pool once it has
+// been closed successfully
+type pooledWriter struct {
+	io.WriteCloser
+	release func()
+}
 
-	// Compress the input and place it in the same buffer containing the
-	// canary byte.
-	if _, err = writer.Write(data); err != nil {
-		return nil, fmt.Errorf("failed to compress input data; err: %v", err)
+func (w *pooledWriter) Write(p []byte) (int, error) {
+	if w.release == nil {
+		return 0, errWriterClosed
 	}
+	return w.WriteCloser.Write(p)
+}
 
-	// Close the io.WriteCloser
-	if err = writer.Close(); err != nil {
-		return nil, err
+func (w *pooledWriter) Close() error {
+	if w.release == nil {
+		return nil
 	}
-
-	// Return the compressed bytes with canary byte at the start
-	return buf.Bytes(), nil
+	if err := w.WriteCloser.Close(); err != nil {
+		return err
+	}
+	w.release()
+	w.release = nil
+	return nil
 }
 
 // Decompress checks if the first byte in the input matches the canary byte.
@@ -110,50 +260,146 @@ func Compress(data []byte, config *CompressionConfig) ([]byte, error) {
 // If the first byte isn't a canary byte, then the utility returns a boolean
 // value indicating that the input was not compressed.
 func Decompress(data []byte) ([]byte, bool, error) {
-	var err error
-	var reader io.ReadCloser
+	return DecompressWithLimit(data, 0)
+}
+
+// DecompressWithLimit behaves like Decompress, except that it stops and
+// returns ErrDecompressionLimitExceeded once the decompressed data exceeds
+// limit bytes. This protects callers decompressing untrusted input from
+// decompression bombs. A limit of zero or less disables the check.
+func DecompressWithLimit(data []byte, limit int64) ([]byte, bool, error) {
 	if data == nil || len(data) == 0 {
 		return nil, false, fmt.Errorf("'data' being decompressed is empty")
 	}
-
-	switch {
-	case data[0] == CompressionCanaryGzip:
-		// If the first byte matches the canary byte, remove the canary
-		// byte and try to decompress the data that is after the canary.
-		if len(data) < 2 {
-			return nil, false, fmt.Errorf("invalid 'data' after the canary")
-		}
-		data = data[1:]
-		reader, err = gzip.NewReader(bytes.NewReader(data))
-	case data[0] == CompressionCanaryLzw:
-		// If the first byte matches the canary byte, remove the canary
-		// byte and try to decompress the data that is after the canary.
-		if len(data) < 2 {
-			return nil, false, fmt.Errorf("invalid 'data' after the canary")
-		}
-		data = data[1:]
-		reader = lzw.NewReader(bytes.NewReader(data), lzw.LSB, 8)
-	default:
+	if !isCanary(data[0]) {
 		// If the first byte doesn't match the canary byte, it means
 		// that the content was not compressed at all. Indicate the
 		// caller that the input was not compressed.
 		return nil, true, nil
 	}
-	if err != nil {
-		return nil, false, fmt.Errorf("failed to create a compression reader; err: %v", err)
+
+	// If the first byte matches the canary byte, remove the canary
+	// byte and try to decompress the data that is after the canary.
+	if len(data) < 2 {
+		return nil, false, fmt.Errorf("invalid 'data' after the canary")
 	}
-	if reader == nil {
-		return nil, false, fmt.Errorf("failed to create a compression reader")
+	reader, err := newDecompressReader(data[0], bytes.NewReader(data[1:]))
+	if err != nil {
+		return nil, false, err
 	}
 
 	// Close the io.ReadCloser
 	defer reader.Close()
 
-	// Read all the compressed data into a buffer
+	// Read all the compressed data into a buffer, reading at most one byte
+	// past the limit so that exceeding it can be detected
+	var src io.Reader = reader
+	if limit > 0 {
+		src = io.LimitReader(reader, limit+1)
+	}
 	var buf bytes.Buffer
-	if _, err = io.Copy(&buf, reader); err != nil {
+	if _, err = io.Copy(&buf, src); err != nil {
 		return nil, false, err
 	}
+	if limit > 0 && int64(buf.Len()) > limit {
+		return nil, false, ErrDecompressionLimitExceeded
+	}
 
 	return buf.Bytes(), false, nil
 }
+
+// DecompressReader returns a reader that decompresses the data read from r,
+// as written by CompressWriter or Compress. If the stream does not start with
+// a canary byte, the returned boolean is true and the reader returns the
+// stream unchanged. Closing the returned reader does not close r.
+func DecompressReader(r io.Reader) (io.ReadCloser, bool, error) {
+	var canary [1]byte
+	if _, err := io.ReadFull(r, canary[:]); err != nil {
+		if err == io.EOF {
+			return nil, false, fmt.Errorf("'data' being decompressed is empty")
+		}
+		return nil, false, err
+	}
+	if !isCanary(canary[0]) {
+		return ioutil.NopCloser(io.MultiReader(bytes.NewReader(canary[:]), r)), true, nil
+	}
+
+	reader, err := newDecompressReader(canary[0], r)
+	if err != nil {
+		return nil, false, err
+	}
+	return reader, false, nil
+}
+
+func isCanary(b byte) bool {
+	switch b {
+	case CompressionCanaryGzip, CompressionCanaryLzw, CompressionCanarySnappy, CompressionCanaryZstd:
+		return true
+	default:
+		return false
+	}
+}
+
+// newDecompressReader returns a reader decompressing r, which follows the
+// given canary byte. Pooled readers are returned to their pool on Close.
+func newDecompressReader(canary byte, r io.Reader) (io.ReadCloser, error) {
+	switch canary {
+	case CompressionCanaryGzip:
+		gz := gzipReaderPool.Get().(*gzip.Reader)
+		if err := gz.Reset(r); err != nil {
+			gzipReaderPool.Put(gz)
+			return nil, fmt.Errorf("failed to create a compression reader; err: %v", err)
+		}
+		return &pooledReader{
+			Reader: gz,
+			release: func() {
+				gz.Close()
+				gzipReaderPool.Put(gz)
+			},
+		}, nil
+
+	case CompressionCanaryLzw:
+		return lzw.NewReader(r, lzw.LSB, 8), nil
+
+	case CompressionCanarySnappy:
+		sr := snappyReaderPool.Get().(*snappy.Reader)
+		sr.Reset(r)
+		return &pooledReader{
+			Reader: sr,
+			release: func() {
+				sr.Reset(nil)
+				snappyReaderPool.Put(sr)
+			},
+		}, nil
+
+	case CompressionCanaryZstd:
+		if !ZstdSupported {
+			return nil, errZstdUnsupported
+		}
+		return newZstdReader(r)
+
+	default:
+		return nil, fmt.Errorf("failed to create a compression reader")
+	}
+}
+
+// pooledReader returns a pooled decompression reader to its pool on Close
+type pooledReader struct {
+	io.Reader
+	release func()
+}
+
+func (r *pooledReader) Read(p []byte) (int, error) {
+	if r.release == nil {
+		return 0, errReaderClosed
+	}
+	return r.Reader.Read(p)
+}
+
+func (r *pooledReader) Close() error {
+	if r.release != nil {
+		r.release()
+		r.release = nil
+	}
+	return nil
+}
@@ -189,4 +189,242 @@ func TestCompressUtil_CompressDecompress(t *testing.T) {
 	if string(inputJSONBytes) != string(decompressedJSONBytes) {
 		t.Fatalf("bad: mismatch: inputJSONBytes: %s\n decompressedJSONBytes: %s", string(inputJSONBytes), string(decompressedJSONBytes))
 	}
+
+	// Compress input using Snappy format
+	compressedJSONBytes, err = Compress(inputJSONBytes, &CompressionConfig{
+		Type: CompressionTypeSnappy,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(compressedJSONBytes) == 0 {
+		t.Fatal("failed to compress data in snappy format")
+	}
+	// Check the presense of the canary
+	if compressedJSONBytes[0] != CompressionCanarySnappy {
+		t.Fatalf("bad: compression canary: expected: %d actual: %d",
+			CompressionCanarySnappy, compressedJSONBytes[0])
+	}
+
+	// Decompress the input and check the output
+	decompressedJSONBytes, uncompressed, err = Decompress(compressedJSONBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uncompressed {
+		t.Fatal("failed to recognize compressed data")
+	}
+	if len(decompressedJSONBytes) == 0 {
+		t.Fatal("failed to decompress snappy formatted data")
+	}
+
+	if string(inputJSONBytes) != string(decompressedJSONBytes) {
+		t.Fatalf("bad: mismatch: inputJSONBytes: %s\n decompressedJSONBytes: %s", string(inputJSONBytes), string(decompressedJSONBytes))
+	}
+}
+
+func TestCompressUtil_DecompressWithLimit(t *testing.T) {
+	input := bytes.Repeat([]byte("a"), 1024*1024)
+
+	for _, compressionType := range []string{CompressionTypeLzw, CompressionTypeGzip, CompressionTypeSnappy} {
+		compressed, err := Compress(input, &CompressionConfig{
+			Type: compressionType,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, _, err := DecompressWithLimit(compressed, 1024); err != ErrDecompressionLimitExceeded {
+			t.Fatalf("%s: expected limit error, got %v", compressionType, err)
+		}
+
+		decompressed, uncompressed, err := DecompressWithLimit(compressed, int64(len(input)))
+		if err != nil {
+			t.Fatalf("%s: %v", compressionType, err)
+		}
+		if uncompressed {
+			t.Fatalf("%s: failed to recognize compressed data", compressionType)
+		}
+		if !bytes.Equal(decompressed, input) {
+			t.Fatalf("%s: bad: mismatch", compressionType)
+		}
+	}
+}
+
+func TestCompressUtil_Streaming(t *testing.T) {
+	input := make([]byte, 1024*1024)
+	for i := range input {
+		input[i] = byte(i % 251)
+	}
+
+	for _, config := range []*CompressionConfig{
+		{Type: CompressionTypeLzw},
+		{Type: CompressionTypeGzip, GzipCompressionLevel: gzip.BestSpeed},
+		{Type: CompressionTypeGzip, GzipCompressionLevel: gzip.BestCompression},
+		{Type: CompressionTypeSnappy},
+	} {
+		// Write the input in pieces
+		var buf bytes.Buffer
+		w, err := CompressWriter(&buf, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rest := input; len(rest) > 0; {
+			n := 4000
+			if n > len(rest) {
+				n = len(rest)
+			}
+			if _, err := w.Write(rest[:n]); err != nil {
+				t.Fatalf("%s: %v", config.Type, err)
+			}
+			rest = rest[n:]
+		}
+		if err := w.Close(); err != nil {
+			t.Fatalf("%s: %v", config.Type, err)
+		}
+		if _, err := w.Write([]byte("more")); err == nil && config.Type != CompressionTypeLzw {
+			t.Fatalf("%s: expected error writing after close", config.Type)
+		}
+
+		// The stream can be decompressed whole
+		decompressed, uncompressed, err := Decompress(buf.Bytes())
+		if err != nil {
+			t.Fatalf("%s: %v", config.Type, err)
+		}
+		if uncompressed || !bytes.Equal(decompressed, input) {
+			t.Fatalf("%s: bad: mismatch", config.Type)
+		}
+
+		// Or incrementally
+		r, uncompressed, err := DecompressReader(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("%s: %v", config.Type, err)
+		}
+		if uncompressed {
+			t.Fatalf("%s: failed to recognize compressed data", config.Type)
+		}
+		var out bytes.Buffer
+		if _, err := out.ReadFrom(r); err != nil {
+			t.Fatalf("%s: %v", config.Type, err)
+		}
+		r.Close()
+		if !bytes.Equal(out.Bytes(), input) {
+			t.Fatalf("%s: bad: mismatch", config.Type)
+		}
+
+		// Data compressed whole can be read incrementally
+		compressed, err := Compress(input, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, _, err = DecompressReader(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatalf("%s: %v", config.Type, err)
+		}
+		out.Reset()
+		if _, err := out.ReadFrom(r); err != nil {
+			t.Fatalf("%s: %v", config.Type, err)
+		}
+		r.Close()
+		if !bytes.Equal(out.Bytes(), input) {
+			t.Fatalf("%s: bad: mismatch", config.Type)
+		}
+	}
+}
+
+func TestCompressUtil_DecompressReaderUncompressed(t *testing.T) {
+	input := []byte(`{"sample":"data"}`)
+	r, uncompressed, err := DecompressReader(bytes.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !uncompressed {
+		t.Fatal("expected data to be recognized as uncompressed")
+	}
+	var out bytes.Buffer
+	if _, err := out.ReadFrom(r); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(out.Bytes(), input) {
+		t.Fatalf("bad: %s", out.Bytes())
+	}
+
+	if _, _, err := DecompressReader(bytes.NewReader(nil)); err == nil {
+		t.Fatal("expected an error for empty input")
+	}
+	if _, err := CompressWriter(&out, &CompressionConfig{}); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestCompressUtil_Zstd(t *testing.T) {
+	if !ZstdSupported {
+		if _, err := Compress([]byte("input"), &CompressionConfig{Type: CompressionTypeZstd}); err != errZstdUnsupported {
+			t.Fatalf("expected unsupported error, got %v", err)
+		}
+		t.Skip("zstd is not supported by this Go version")
+	}
+
+	input := bytes.Repeat([]byte(`{"sample":"data","verification":"process"}`), 1000)
+	for _, level := range []int{0, 1, 3, 19} {
+		config := &CompressionConfig{
+			Type:                 CompressionTypeZstd,
+			ZstdCompressionLevel: level,
+		}
+		compressed, err := Compress(input, config)
+		if err != nil {
+			t.Fatalf("level %d: %v", level, err)
+		}
+		if compressed[0] != CompressionCanaryZstd {
+			t.Fatalf("level %d: bad canary %d", level, compressed[0])
+		}
+		if len(compressed) >= len(input) {
+			t.Fatalf("level %d: input was not compressed", level)
+		}
+
+		decompressed, uncompressed, err := Decompress(compressed)
+		if err != nil {
+			t.Fatalf("level %d: %v", level, err)
+		}
+		if uncompressed || !bytes.Equal(decompressed, input) {
+			t.Fatalf("level %d: bad: mismatch", level)
+		}
+
+		if _, _, err := DecompressWithLimit(compressed, int64(len(input)-1)); err != ErrDecompressionLimitExceeded {
+			t.Fatalf("level %d: expected limit error, got %v", level, err)
+		}
+
+		r, _, err := DecompressReader(bytes.NewReader(compressed))
+		if err != nil {
+			t.Fatalf("level %d: %v", level, err)
+		}
+		var out bytes.Buffer
+		if _, err := out.ReadFrom(r); err != nil {
+			t.Fatalf("level %d: %v", level, err)
+		}
+		r.Close()
+		if !bytes.Equal(out.Bytes(), input) {
+			t.Fatalf("level %d: bad: mismatch", level)
+		}
+	}
+}
+
+func TestCompressUtil_GzipLevels(t *testing.T) {
+	input := bytes.Repeat([]byte("data"), 1000)
+	for level := gzip.BestSpeed; level <= gzip.BestCompression; level++ {
+		compressed, err := Compress(input, &CompressionConfig{
+			Type:                 CompressionTypeGzip,
+			GzipCompressionLevel: level,
+		})
+		if err != nil {
+			t.Fatalf("level %d: %v", level, err)
+		}
+		decompressed, _, err := Decompress(compressed)
+		if err != nil {
+			t.Fatalf("level %d: %v", level, err)
+		}
+		if !bytes.Equal(decompressed, input) {
+			t.Fatalf("level %d: bad: mismatch", level)
+		}
+	}
 }
@@ -0,0 +1,70 @@
+// +build go1.9
+
+package compressutil
+
+import (
+	"io"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ZstdSupported is whether zstd compression is available. The zstd
+// implementation requires Go 1.9 or newer.
+const ZstdSupported = true
+
+// Pools of zstd encoders, per encoder level, since the level cannot be
+// changed on Reset
+var (
+	zstdWriterPoolsLock sync.Mutex
+	zstdWriterPools     = make(map[zstd.EncoderLevel]*sync.Pool)
+)
+
+func zstdWriterPool(level zstd.EncoderLevel) *sync.Pool {
+	zstdWriterPoolsLock.Lock()
+	defer zstdWriterPoolsLock.Unlock()
+
+	pool, ok := zstdWriterPools[level]
+	if !ok {
+		pool = &sync.Pool{
+			New: func() interface{} {
+				// The options are valid, so no error is returned
+				e, _ := zstd.NewWriter(nil, zstd.WithEncoderLevel(level), zstd.WithEncoderConcurrency(1))
+				return e
+			},
+		}
+		zstdWriterPools[level] = pool
+	}
+	return pool
+}
+
+// newZstdWriter returns a pooled zstd writer compressing into w at the given
+// level, on the scale of the reference implementation. A level of zero uses
+// the default level.
+func newZstdWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	encoderLevel := zstd.SpeedDefault
+	if level != 0 {
+		encoderLevel = zstd.EncoderLevelFromZstd(level)
+	}
+
+	pool := zstdWriterPool(encoderLevel)
+	e := pool.Get().(*zstd.Encoder)
+	e.Reset(w)
+	return &pooledWriter{
+		WriteCloser: e,
+		release: func() {
+			e.Reset(nil)
+			pool.Put(e)
+		},
+	}, nil
+}
+
+// newZstdReader returns a reader decompressing the zstd stream r. Closing the
+// reader releases the decoder's resources.
+func newZstdReader(r io.Reader) (io.ReadCloser, error) {
+	d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return d.IOReadCloser(), nil
+}
@@ -0,0 +1,19 @@
+// +build !go1.9
+
+package compressutil
+
+import (
+	"io"
+)
+
+// ZstdSupported is whether zstd compression is available. The zstd
+// implementation requires Go 1.9 or newer.
+const ZstdSupported = false
+
+func newZstdWriter(w io.Writer, level int) (io.WriteCloser, error) {
+	return nil, errZstdUnsupported
+}
+
+func newZstdReader(r io.Reader) (io.ReadCloser, error) {
+	return nil, errZstdUnsupported
+}
@@ -0,0 +1,163 @@
+package errutil
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+)
+
+// Code is a stable, machine-readable identifier of a class of error, of the
+// form VAULT-<HTTP status>-<NAME>. Codes are returned in HTTP error responses
+// and recorded in audit logs so that clients can act on them without parsing
+// error messages, which may change. Once published, a code is never changed
+// or reused.
+type Code string
+
+const (
+	// CodeInvalidRequest is used for malformed or invalid requests
+	CodeInvalidRequest Code = "VAULT-400-INVALID-REQUEST"
+
+	// CodePermissionDenied is used when access is denied for a reason not
+	// covered by a more specific code
+	CodePermissionDenied Code = "VAULT-403-PERMISSION-DENIED"
+
+	// CodeInvalidToken is used when the client token does not exist, has
+	// expired or has been revoked
+	CodeInvalidToken Code = "VAULT-403-INVALID-TOKEN"
+
+	// CodePolicyDenied is used when the policies of a valid token do not
+	// allow the request
+	CodePolicyDenied Code = "VAULT-403-POLICY-DENIED"
+
+	// CodeMFARequired is used when the MFA credentials required for the
+	// request are missing or invalid
+	CodeMFARequired Code = "VAULT-403-MFA-REQUIRED"
+
+	// CodeUnsupportedPath is used when no backend handles the request path
+	CodeUnsupportedPath Code = "VAULT-404-UNSUPPORTED-PATH"
+
+	// CodeUnsupportedOperation is used when the backend handling the path
+	// does not support the operation
+	CodeUnsupportedOperation Code = "VAULT-405-UNSUPPORTED-OPERATION"
+
+	// CodeRequestTooLarge is used when the request body exceeds the size
+	// limit
+	CodeRequestTooLarge Code = "VAULT-413-REQUEST-TOO-LARGE"
+
+	// CodeRateLimited is used when a rate limit rejects the request
+	CodeRateLimited Code = "VAULT-429-RATE-LIMITED"
+
+	// CodeLeaseQuotaExceeded is used when a lease count quota rejects the
+	// request
+	CodeLeaseQuotaExceeded Code = "VAULT-429-LEASE-QUOTA-EXCEEDED"
+
+	// CodeInternal is used for errors internal to Vault
+	CodeInternal Code = "VAULT-500-INTERNAL"
+
+	// CodeSealed is used when a request requires Vault to be unsealed
+	CodeSealed Code = "VAULT-503-SEALED"
+
+	// CodeStandby is used when a request requires the active node
+	CodeStandby Code = "VAULT-503-STANDBY"
+
+	// CodeOverloaded is used when admission control sheds the request
+	CodeOverloaded Code = "VAULT-503-OVERLOADED"
+)
+
+// StatusCode returns the HTTP status code embedded in the code, or zero if
+// the code is malformed
+func (c Code) StatusCode() int {
+	parts := strings.SplitN(string(c), "-", 3)
+	if len(parts) != 3 || parts[0] != "VAULT" {
+		return 0
+	}
+	status, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0
+	}
+	return status
+}
+
+// CodeForStatus returns the code used for an error with the given HTTP
+// status code when the error itself does not carry a code
+func CodeForStatus(status int) Code {
+	switch status {
+	case 400:
+		return CodeInvalidRequest
+	case 403:
+		return CodePermissionDenied
+	case 404:
+		return CodeUnsupportedPath
+	case 405:
+		return CodeUnsupportedOperation
+	case 413:
+		return CodeRequestTooLarge
+	case 429:
+		return CodeRateLimited
+	case 500:
+		return CodeInternal
+	default:
+		return Code(fmt.Sprintf("VAULT-%d-ERROR", status))
+	}
+}
+
+// CodedError is an error with a code attached. The message is that of the
+// wrapped error, so attaching a code does not change what users see.
+type CodedError struct {
+	Code Code
+	Err  error
+}
+
+func (e *CodedError) Error() string {
+	return e.Err.Error()
+}
+
+// WrappedErrors implements errwrap.Wrapper, so that the wrapped error can
+// still be found with errwrap.Contains and similar
+func (e *CodedError) WrappedErrors() []error {
+	return []error{e.Err}
+}
+
+// WithCode attaches the code to err. If err is nil, or code is empty, err is
+// returned as-is.
+func WithCode(code Code, err error) error {
+	if err == nil || code == "" {
+		return err
+	}
+	return &CodedError{
+		Code: code,
+		Err:  err,
+	}
+}
+
+// CodeOf returns the code of err. Wrapped errors, including those in a
+// multierror, are searched outermost first and the first code found is
+// returned. A UserError or InternalError without a code is given
+// CodeInvalidRequest or CodeInternal respectively. If no code is found, the
+// empty code is returned.
+func CodeOf(err error) Code {
+	var code, fallback Code
+	errwrap.Walk(err, func(err error) {
+		if code != "" {
+			return
+		}
+		switch err := err.(type) {
+		case *CodedError:
+			code = err.Code
+		case UserError:
+			if fallback == "" {
+				fallback = CodeInvalidRequest
+			}
+		case InternalError:
+			if fallback == "" {
+				fallback = CodeInternal
+			}
+		}
+	})
+	if code == "" {
+		code = fallback
+	}
+	return code
+}
@@ -0,0 +1,76 @@
+package errutil
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-multierror"
+)
+
+func TestCodeOf(t *testing.T) {
+	base := errors.New("permission denied")
+	coded := WithCode(CodePermissionDenied, base)
+
+	cases := []struct {
+		Err  error
+		Code Code
+	}{
+		{nil, ""},
+		{base, ""},
+		{coded, CodePermissionDenied},
+		{WithCode(CodePolicyDenied, coded), CodePolicyDenied},
+		{multierror.Append(nil, base, coded), CodePermissionDenied},
+		{errwrap.Wrapf("error reading: {{err}}", coded), CodePermissionDenied},
+		{UserError{Err: "bad input"}, CodeInvalidRequest},
+		{InternalError{Err: "oops"}, CodeInternal},
+		{WithCode(CodeSealed, InternalError{Err: "oops"}), CodeSealed},
+	}
+
+	for i, tc := range cases {
+		if code := CodeOf(tc.Err); code != tc.Code {
+			t.Fatalf("%d: expected %q, got %q", i, tc.Code, code)
+		}
+	}
+}
+
+func TestWithCode(t *testing.T) {
+	if WithCode(CodeInternal, nil) != nil {
+		t.Fatal("expected nil error")
+	}
+
+	base := errors.New("foo")
+	if WithCode("", base) != base {
+		t.Fatal("expected the error to be returned as-is")
+	}
+
+	err := WithCode(CodeInternal, base)
+	if err.Error() != "foo" {
+		t.Fatalf("bad: %s", err)
+	}
+	if !errwrap.Contains(multierror.Append(nil, err), "foo") {
+		t.Fatal("expected the wrapped error to be found")
+	}
+}
+
+func TestCode_StatusCode(t *testing.T) {
+	cases := map[Code]int{
+		CodeInvalidRequest:    400,
+		CodePolicyDenied:      403,
+		CodeStandby:           503,
+		CodeForStatus(418):    418,
+		CodeRateLimited:       429,
+		Code("VAULT-ABC-DEF"): 0,
+		Code("foo"):           0,
+	}
+
+	for code, status := range cases {
+		if actual := code.StatusCode(); actual != status {
+			t.Fatalf("%s: expected %d, got %d", code, status, actual)
+		}
+	}
+	if code := CodeForStatus(418); code != Code(fmt.Sprintf("VAULT-%d-ERROR", 418)) {
+		t.Fatalf("bad: %s", code)
+	}
+}
@@ -0,0 +1,249 @@
+package gcputil
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// defaultTokenURL is the OAuth 2.0 token endpoint of Google
+	defaultTokenURL = "https://oauth2.googleapis.com/token"
+
+	// defaultMetadataHost is the host of the metadata server of Compute
+	// Engine instances
+	defaultMetadataHost = "metadata.google.internal"
+)
+
+// CredentialsConfig configures how Vault authenticates to Google Cloud
+// APIs
+type CredentialsConfig struct {
+	// CredentialsFile is the path to the JSON key file of a service
+	// account. If it is not set, GOOGLE_APPLICATION_CREDENTIALS is used,
+	// and otherwise the service account of the Compute Engine instance.
+	CredentialsFile string
+
+	// Scopes are the OAuth 2.0 scopes requested for the access tokens
+	Scopes []string
+
+	// HTTPClient is used to fetch tokens
+	HTTPClient *http.Client
+}
+
+// ServiceAccountKey is the JSON key file of a service account
+type ServiceAccountKey struct {
+	Type         string `json:"type"`
+	ProjectID    string `json:"project_id"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	ClientEmail  string `json:"client_email"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// ReadServiceAccountKey reads and parses the JSON key file of a service
+// account
+func ReadServiceAccountKey(path string) (*ServiceAccountKey, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading credentials file: %v", err)
+	}
+
+	var key ServiceAccountKey
+	if err := json.Unmarshal(buf, &key); err != nil {
+		return nil, fmt.Errorf("error parsing credentials file: %v", err)
+	}
+	if key.Type != "service_account" {
+		return nil, fmt.Errorf("credentials file is of type %q, only service_account is supported", key.Type)
+	}
+	if key.ClientEmail == "" || key.PrivateKey == "" {
+		return nil, fmt.Errorf("credentials file is missing client_email or private_key")
+	}
+	return &key, nil
+}
+
+// TokenSource returns a source of access tokens for the configured
+// credentials. Tokens are reused until they expire.
+func (c *CredentialsConfig) TokenSource() (oauth2.TokenSource, error) {
+	client := c.HTTPClient
+	if client == nil {
+		client = cleanhttp.DefaultClient()
+	}
+
+	path := c.CredentialsFile
+	if path == "" {
+		path = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	}
+
+	var src oauth2.TokenSource
+	if path != "" {
+		key, err := ReadServiceAccountKey(path)
+		if err != nil {
+			return nil, err
+		}
+		src, err = newJWTTokenSource(client, key, c.Scopes)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		host := os.Getenv("GCE_METADATA_HOST")
+		if host == "" {
+			host = defaultMetadataHost
+		}
+		src = &metadataTokenSource{
+			client: client,
+			url:    fmt.Sprintf("http://%s/computeMetadata/v1/instance/service-accounts/default/token", host),
+		}
+	}
+
+	return oauth2.ReuseTokenSource(nil, src), nil
+}
+
+// jwtTokenSource exchanges a JWT signed by a service account key for an
+// access token, as described in RFC 7523
+type jwtTokenSource struct {
+	client *http.Client
+	key    *ServiceAccountKey
+	signer *rsa.PrivateKey
+	scopes []string
+}
+
+func newJWTTokenSource(client *http.Client, key *ServiceAccountKey, scopes []string) (*jwtTokenSource, error) {
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("private key of credentials file is not PEM encoded")
+	}
+
+	var signer *rsa.PrivateKey
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		signer, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing private key of credentials file: %v", err)
+		}
+	} else {
+		var ok bool
+		if signer, ok = parsed.(*rsa.PrivateKey); !ok {
+			return nil, fmt.Errorf("private key of credentials file is not an RSA key")
+		}
+	}
+
+	return &jwtTokenSource{
+		client: client,
+		key:    key,
+		signer: signer,
+		scopes: scopes,
+	}, nil
+}
+
+func (s *jwtTokenSource) Token() (*oauth2.Token, error) {
+	tokenURL := s.key.TokenURI
+	if tokenURL == "" {
+		tokenURL = defaultTokenURL
+	}
+
+	now := time.Now()
+	header, err := json.Marshal(map[string]string{
+		"alg": "RS256",
+		"typ": "JWT",
+		"kid": s.key.PrivateKeyID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   s.key.ClientEmail,
+		"scope": strings.Join(s.scopes, " "),
+		"aud":   tokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(payload))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, s.signer, crypto.SHA256, sum[:])
+	if err != nil {
+		return nil, fmt.Errorf("error signing token request: %v", err)
+	}
+	assertion := payload + "." + base64.RawURLEncoding.EncodeToString(sig)
+
+	resp, err := s.client.PostForm(tokenURL, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error requesting access token: %v", err)
+	}
+	return parseTokenResponse(resp)
+}
+
+// metadataTokenSource fetches access tokens of the service account of the
+// Compute Engine instance from the metadata server
+type metadataTokenSource struct {
+	client *http.Client
+	url    string
+}
+
+func (s *metadataTokenSource) Token() (*oauth2.Token, error) {
+	req, err := http.NewRequest("GET", s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting access token from metadata server: %v", err)
+	}
+	return parseTokenResponse(resp)
+}
+
+func parseTokenResponse(resp *http.Response) (*oauth2.Token, error) {
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading access token response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error requesting access token: %s: %s", resp.Status, body)
+	}
+
+	var out struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(body, &out); err != nil {
+		return nil, fmt.Errorf("error parsing access token response: %v", err)
+	}
+	if out.AccessToken == "" {
+		return nil, fmt.Errorf("no access token returned")
+	}
+
+	token := &oauth2.Token{
+		AccessToken: out.AccessToken,
+		TokenType:   out.TokenType,
+	}
+	if out.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(out.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
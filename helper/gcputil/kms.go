@@ -0,0 +1,165 @@
+package gcputil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// DefaultCloudKMSEndpoint is the base URL of the Cloud KMS REST API
+	DefaultCloudKMSEndpoint = "https://cloudkms.googleapis.com/v1/"
+
+	// CloudKMSScope is the OAuth 2.0 scope required by Cloud KMS
+	CloudKMSScope = "https://www.googleapis.com/auth/cloudkms"
+)
+
+// CloudKMS is a client for the operations of the Google Cloud Key
+// Management Service that Vault uses
+type CloudKMS struct {
+	client   *http.Client
+	endpoint string
+}
+
+// NewCloudKMS creates a new Cloud KMS client authenticating with tokens
+// from the given source. If endpoint is empty, DefaultCloudKMSEndpoint is
+// used.
+func NewCloudKMS(endpoint string, src oauth2.TokenSource) *CloudKMS {
+	if endpoint == "" {
+		endpoint = DefaultCloudKMSEndpoint
+	}
+	if !strings.HasSuffix(endpoint, "/") {
+		endpoint += "/"
+	}
+
+	return &CloudKMS{
+		client: &http.Client{
+			Transport: &oauth2.Transport{
+				Source: src,
+				Base:   cleanhttp.DefaultTransport(),
+			},
+		},
+		endpoint: endpoint,
+	}
+}
+
+// CryptoKeyName returns the resource name of a crypto key
+func CryptoKeyName(project, location, keyRing, cryptoKey string) string {
+	return fmt.Sprintf("projects/%s/locations/%s/keyRings/%s/cryptoKeys/%s",
+		project, location, keyRing, cryptoKey)
+}
+
+// CryptoKeyFromVersion returns the resource name of the crypto key of the
+// given crypto key version
+func CryptoKeyFromVersion(version string) string {
+	if idx := strings.Index(version, "/cryptoKeyVersions/"); idx != -1 {
+		return version[:idx]
+	}
+	return version
+}
+
+// Encrypt encrypts the plaintext with the primary version of the crypto
+// key, returning the ciphertext and the name of the version that was used.
+// The additional authenticated data must be given again to decrypt.
+func (c *CloudKMS) Encrypt(name string, plaintext, aad []byte) ([]byte, string, error) {
+	var out struct {
+		Name       string `json:"name"`
+		Ciphertext []byte `json:"ciphertext"`
+	}
+	err := c.do("POST", name+":encrypt", map[string]interface{}{
+		"plaintext":                   plaintext,
+		"additionalAuthenticatedData": aad,
+	}, &out)
+	if err != nil {
+		return nil, "", err
+	}
+	return out.Ciphertext, out.Name, nil
+}
+
+// Decrypt decrypts data encrypted by Encrypt. The version of the crypto key
+// is identified by the ciphertext.
+func (c *CloudKMS) Decrypt(name string, ciphertext, aad []byte) ([]byte, error) {
+	var out struct {
+		Plaintext []byte `json:"plaintext"`
+	}
+	err := c.do("POST", name+":decrypt", map[string]interface{}{
+		"ciphertext":                  ciphertext,
+		"additionalAuthenticatedData": aad,
+	}, &out)
+	if err != nil {
+		return nil, err
+	}
+	return out.Plaintext, nil
+}
+
+// PrimaryVersion returns the name of the primary version of the crypto key,
+// which is used by Encrypt
+func (c *CloudKMS) PrimaryVersion(name string) (string, error) {
+	var out struct {
+		Primary *struct {
+			Name  string `json:"name"`
+			State string `json:"state"`
+		} `json:"primary"`
+	}
+	if err := c.do("GET", name, nil, &out); err != nil {
+		return "", err
+	}
+	if out.Primary == nil {
+		return "", fmt.Errorf("crypto key %s has no primary version", name)
+	}
+	if out.Primary.State != "ENABLED" {
+		return "", fmt.Errorf("primary version of crypto key %s is %s", name, out.Primary.State)
+	}
+	return out.Primary.Name, nil
+}
+
+func (c *CloudKMS) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		buf, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(buf)
+	}
+
+	req, err := http.NewRequest(method, c.endpoint+path, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error struct {
+				Message string `json:"message"`
+				Status  string `json:"status"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(buf, &e); err == nil && e.Error.Message != "" {
+			return fmt.Errorf("%s: %s", e.Error.Status, e.Error.Message)
+		}
+		return fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+
+	return json.Unmarshal(buf, out)
+}
@@ -0,0 +1,82 @@
+package gcputil
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestCloudKMS(t *testing.T) {
+	name := CryptoKeyName("project", "global", "vault", "unseal")
+	version := name + "/cryptoKeyVersions/3"
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var in map[string][]byte
+		if r.Method == "POST" {
+			if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+				t.Fatalf("err: %v", err)
+			}
+		}
+
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v1/" + name:
+			w.Write([]byte(`{"name": "` + name + `", "primary": {"name": "` + version + `", "state": "ENABLED"}}`))
+		case "POST /v1/" + name + ":encrypt":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"name":       version,
+				"ciphertext": append([]byte("sealed:"), in["plaintext"]...),
+			})
+		case "POST /v1/" + name + ":decrypt":
+			if string(in["additionalAuthenticatedData"]) != "aad" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error": {"code": 400, "message": "Decryption failed", "status": "INVALID_ARGUMENT"}}`))
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"plaintext": in["ciphertext"][len("sealed:"):],
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	kms := NewCloudKMS(ts.URL+"/v1", oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"}))
+
+	primary, err := kms.PrimaryVersion(name)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if primary != version || CryptoKeyFromVersion(primary) != name {
+		t.Fatalf("bad: %s", primary)
+	}
+
+	ciphertext, used, err := kms.Encrypt(name, []byte("secret"), []byte("aad"))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if used != version || string(ciphertext) != "sealed:secret" {
+		t.Fatalf("bad: %s %s", used, ciphertext)
+	}
+
+	plaintext, err := kms.Decrypt(name, ciphertext, []byte("aad"))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(plaintext) != "secret" {
+		t.Fatalf("bad: %s", plaintext)
+	}
+
+	_, err = kms.Decrypt(name, ciphertext, []byte("other"))
+	if err == nil || err.Error() != "INVALID_ARGUMENT: Decryption failed" {
+		t.Fatalf("bad: %v", err)
+	}
+}
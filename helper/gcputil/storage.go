@@ -0,0 +1,139 @@
+package gcputil
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"golang.org/x/oauth2"
+)
+
+const (
+	// DefaultCloudStorageEndpoint is the base URL of the Cloud Storage JSON
+	// API
+	DefaultCloudStorageEndpoint = "https://storage.googleapis.com/"
+
+	// CloudStorageScope is the OAuth 2.0 scope required to read and write
+	// objects in Cloud Storage
+	CloudStorageScope = "https://www.googleapis.com/auth/devstorage.read_write"
+)
+
+// CloudStorage is a client for the operations on the objects of a Google
+// Cloud Storage bucket that Vault uses
+type CloudStorage struct {
+	client   *http.Client
+	endpoint string
+}
+
+// NewCloudStorage creates a new Cloud Storage client authenticating with
+// tokens from the given source. If endpoint is empty,
+// DefaultCloudStorageEndpoint is used.
+func NewCloudStorage(endpoint string, src oauth2.TokenSource) *CloudStorage {
+	if endpoint == "" {
+		endpoint = DefaultCloudStorageEndpoint
+	}
+	if !strings.HasSuffix(endpoint, "/") {
+		endpoint += "/"
+	}
+
+	return &CloudStorage{
+		client: &http.Client{
+			Transport: &oauth2.Transport{
+				Source: src,
+				Base:   cleanhttp.DefaultTransport(),
+			},
+		},
+		endpoint: endpoint,
+	}
+}
+
+// Upload creates or replaces the named object with the content of r
+func (c *CloudStorage) Upload(bucket, name string, r io.Reader, size int64) error {
+	query := url.Values{}
+	query.Set("uploadType", "media")
+	query.Set("name", name)
+	req, err := http.NewRequest("POST", c.endpoint+"upload/storage/v1/b/"+url.QueryEscape(bucket)+"/o?"+query.Encode(), r)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	return c.do(req, nil)
+}
+
+// List returns the names of the objects starting with the prefix
+func (c *CloudStorage) List(bucket, prefix string) ([]string, error) {
+	var names []string
+	var pageToken string
+	for {
+		query := url.Values{}
+		query.Set("prefix", prefix)
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+		req, err := http.NewRequest("GET", c.endpoint+"storage/v1/b/"+url.QueryEscape(bucket)+"/o?"+query.Encode(), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var out struct {
+			Items []struct {
+				Name string `json:"name"`
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}
+		if err := c.do(req, &out); err != nil {
+			return nil, err
+		}
+		for _, item := range out.Items {
+			names = append(names, item.Name)
+		}
+		if out.NextPageToken == "" {
+			return names, nil
+		}
+		pageToken = out.NextPageToken
+	}
+}
+
+// Delete removes the named object
+func (c *CloudStorage) Delete(bucket, name string) error {
+	req, err := http.NewRequest("DELETE", c.endpoint+"storage/v1/b/"+url.QueryEscape(bucket)+"/o/"+url.QueryEscape(name), nil)
+	if err != nil {
+		return err
+	}
+	return c.do(req, nil)
+}
+
+func (c *CloudStorage) do(req *http.Request, out interface{}) error {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var e struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(buf, &e); err == nil && e.Error.Message != "" {
+			return fmt.Errorf("%s: %s", resp.Status, e.Error.Message)
+		}
+		return fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(buf, out)
+}
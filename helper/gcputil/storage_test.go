@@ -0,0 +1,95 @@
+package gcputil
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/oauth2"
+)
+
+func TestCloudStorage(t *testing.T) {
+	objects := make(map[string][]byte)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/upload/storage/v1/b/backups/o":
+			if r.URL.Query().Get("uploadType") != "media" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			buf, _ := ioutil.ReadAll(r.Body)
+			objects[r.URL.Query().Get("name")] = buf
+			w.Write([]byte(`{}`))
+		case r.Method == "GET" && r.URL.Path == "/storage/v1/b/backups/o":
+			var names []string
+			for name := range objects {
+				if strings.HasPrefix(name, r.URL.Query().Get("prefix")) {
+					names = append(names, name)
+				}
+			}
+			sort.Strings(names)
+
+			// One object per page
+			page := 0
+			if r.URL.Query().Get("pageToken") != "" {
+				page = len(r.URL.Query().Get("pageToken"))
+			}
+			out := map[string]interface{}{}
+			if page < len(names) {
+				out["items"] = []map[string]string{{"name": names[page]}}
+			}
+			if page+1 < len(names) {
+				out["nextPageToken"] = strings.Repeat("x", page+1)
+			}
+			json.NewEncoder(w).Encode(out)
+		case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/storage/v1/b/backups/o/"):
+			name := strings.TrimPrefix(r.URL.Path, "/storage/v1/b/backups/o/")
+			if _, ok := objects[name]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"error": {"code": 404, "message": "No such object"}}`))
+				return
+			}
+			delete(objects, name)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	gcs := NewCloudStorage(ts.URL, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"}))
+
+	for _, name := range []string{"vault/a", "vault/b", "other/c"} {
+		if err := gcs.Upload("backups", name, strings.NewReader(name), int64(len(name))); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	if string(objects["vault/a"]) != "vault/a" {
+		t.Fatalf("bad: %#v", objects)
+	}
+
+	names, err := gcs.List("backups", "vault/")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(names, []string{"vault/a", "vault/b"}) {
+		t.Fatalf("bad: %#v", names)
+	}
+
+	if err := gcs.Delete("backups", "vault/a"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := gcs.Delete("backups", "vault/a"); err == nil || !strings.Contains(err.Error(), "No such object") {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package jsonutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// EncodeCanonicalJSON encodes the given object into a canonical form of JSON
+// suitable for signing: object keys are sorted, regardless of whether they
+// came from a map or a struct, there is no insignificant whitespace, strings
+// are escaped only where JSON requires it, and non-integer numbers are
+// formatted in a fixed way. The same value always encodes to the same bytes,
+// independent of the version of the standard library's encoder.
+func EncodeCanonicalJSON(in interface{}) ([]byte, error) {
+	if in == nil {
+		return nil, fmt.Errorf("input for encoding is nil")
+	}
+
+	// Round trip through the standard encoder so that struct tags and
+	// json.Marshaler implementations are respected
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(in); err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	dec := json.NewDecoder(&buf)
+	dec.UseNumber()
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	if err := writeCanonical(&out, value); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func writeCanonical(buf *bytes.Buffer, v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		buf.WriteString(strconv.FormatBool(v))
+	case json.Number:
+		n, err := canonicalNumber(v)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(n)
+	case string:
+		writeCanonicalString(buf, v)
+	case []interface{}:
+		buf.WriteByte('[')
+		for i, elem := range v {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			if err := writeCanonical(buf, elem); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		buf.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeCanonicalString(buf, k)
+			buf.WriteByte(':')
+			if err := writeCanonical(buf, v[k]); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+	default:
+		return fmt.Errorf("unexpected type %T in canonical JSON", v)
+	}
+	return nil
+}
+
+// canonicalNumber leaves integers as they are and formats all other numbers
+// as the shortest representation that parses back to the same float64
+func canonicalNumber(n json.Number) (string, error) {
+	s := n.String()
+	if !strings.ContainsAny(s, ".eE") {
+		if s == "-0" {
+			return "0", nil
+		}
+		return s, nil
+	}
+
+	f, err := n.Float64()
+	if err != nil {
+		return "", err
+	}
+	if f == float64(int64(f)) && f > -1e15 && f < 1e15 {
+		return strconv.FormatInt(int64(f), 10), nil
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64), nil
+}
+
+func writeCanonicalString(buf *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+
+	buf.WriteByte('"')
+	for i := 0; i < len(s); {
+		b := s[i]
+		if b < utf8.RuneSelf {
+			switch {
+			case b == '"' || b == '\\':
+				buf.WriteByte('\\')
+				buf.WriteByte(b)
+			case b == '\b':
+				buf.WriteString(`\b`)
+			case b == '\f':
+				buf.WriteString(`\f`)
+			case b == '\n':
+				buf.WriteString(`\n`)
+			case b == '\r':
+				buf.WriteString(`\r`)
+			case b == '\t':
+				buf.WriteString(`\t`)
+			case b < 0x20:
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hex[b>>4])
+				buf.WriteByte(hex[b&0xf])
+			default:
+				buf.WriteByte(b)
+			}
+			i++
+			continue
+		}
+
+		// The standard decoder has already replaced invalid UTF-8
+		r, size := utf8.DecodeRuneInString(s[i:])
+		buf.WriteRune(r)
+		i += size
+	}
+	buf.WriteByte('"')
+}
@@ -0,0 +1,68 @@
+package jsonutil
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestJSONUtil_EncodeCanonicalJSON(t *testing.T) {
+	type inner struct {
+		Zeta  string `json:"zeta"`
+		Alpha int    `json:"alpha"`
+	}
+	type outer struct {
+		Inner  inner                  `json:"inner"`
+		Map    map[string]interface{} `json:"map"`
+		Empty  []string               `json:"empty"`
+		Nil    *inner                 `json:"nil"`
+		Number float64                `json:"number"`
+	}
+
+	in := outer{
+		Inner: inner{Zeta: "<z>&\"\\\n é", Alpha: 1},
+		Map: map[string]interface{}{
+			"b": []interface{}{true, false, nil},
+			"a": json.Number("1.0"),
+			"c": 1.5e300,
+		},
+		Empty:  []string{},
+		Number: 100,
+	}
+
+	expected := `{"empty":[],"inner":{"alpha":1,"zeta":"<z>&\"\\\n` + " é" + `"},"map":{"a":1,"b":[true,false,null],"c":1.5e+300},"nil":null,"number":100}`
+
+	out, err := EncodeCanonicalJSON(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != expected {
+		t.Fatalf("bad:\nexpected: %s\nactual:   %s", expected, out)
+	}
+
+	// Equivalent values encode identically
+	var decoded interface{}
+	if err := DecodeJSON(out, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	again, err := EncodeCanonicalJSON(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != expected {
+		t.Fatalf("bad:\nexpected: %s\nactual:   %s", expected, again)
+	}
+
+	if _, err := EncodeCanonicalJSON(nil); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestJSONUtil_EncodeCanonicalJSONControl(t *testing.T) {
+	out, err := EncodeCanonicalJSON(map[string]string{"k": "\x01\t\x1f"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `{"k":"\u0001\t\u001f"}` {
+		t.Fatalf("bad: %s", out)
+	}
+}
@@ -0,0 +1,245 @@
+package jsonutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+
+	"github.com/hashicorp/vault/helper/compressutil"
+)
+
+const (
+	// DefaultMaxStrictSize is the default limit on the size of the input to
+	// DecodeJSONStrict, once decompressed
+	DefaultMaxStrictSize = 32 * 1024 * 1024
+
+	// DefaultMaxStrictDepth is the default limit on the nesting depth of
+	// objects and arrays in the input to DecodeJSONStrict
+	DefaultMaxStrictDepth = 64
+)
+
+// StrictConfig controls DecodeJSONStrict
+type StrictConfig struct {
+	// The maximum size in bytes of the input, once decompressed. Defaults to
+	// DefaultMaxStrictSize.
+	MaxSize int64
+
+	// The maximum nesting depth of objects and arrays. Defaults to
+	// DefaultMaxStrictDepth.
+	MaxDepth int
+
+	// If set, called with the decoder before decoding so that callers can
+	// adjust it further. Returning an error aborts decoding.
+	DecoderHook func(*json.Decoder) error
+}
+
+// DecodeJSONStrict behaves like DecodeJSON, except that it fails if the JSON
+// contains object keys that do not correspond to a field of the struct being
+// decoded into, if anything follows the JSON value, or if the input exceeds
+// the size and depth limits in config. As with DecodeJSON, numbers are
+// decoded as json.Number. If config is nil, the defaults described on
+// StrictConfig are used.
+func DecodeJSONStrict(data []byte, out interface{}, config *StrictConfig) error {
+	if data == nil || len(data) == 0 {
+		return fmt.Errorf("'data' being decoded is nil")
+	}
+	if out == nil {
+		return fmt.Errorf("output parameter 'out' is nil")
+	}
+	if config == nil {
+		config = &StrictConfig{}
+	}
+	maxSize := config.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultMaxStrictSize
+	}
+	maxDepth := config.MaxDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxStrictDepth
+	}
+
+	// Decompress the data if it was compressed in the first place
+	decompressedBytes, uncompressed, err := compressutil.DecompressWithLimit(data, maxSize)
+	switch {
+	case err == compressutil.ErrDecompressionLimitExceeded:
+		return fmt.Errorf("JSON exceeds the size limit of %d bytes", maxSize)
+	case err != nil:
+		return fmt.Errorf("failed to decompress JSON: err: %v", err)
+	case !uncompressed:
+		data = decompressedBytes
+	}
+	if int64(len(data)) > maxSize {
+		return fmt.Errorf("JSON exceeds the size limit of %d bytes", maxSize)
+	}
+
+	if depth := jsonDepth(data); depth > maxDepth {
+		return fmt.Errorf("JSON nesting depth of %d exceeds the limit of %d", depth, maxDepth)
+	}
+
+	// Unknown object keys are found by decoding into generic values first
+	// and comparing their keys against the fields of out's type
+	var generic interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&generic); err != nil {
+		return err
+	}
+	if err := checkUnknownFields(generic, reflect.TypeOf(out)); err != nil {
+		return err
+	}
+
+	dec = json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if config.DecoderHook != nil {
+		if err := config.DecoderHook(dec); err != nil {
+			return err
+		}
+	}
+
+	if err := dec.Decode(out); err != nil {
+		return err
+	}
+
+	// Only whitespace may follow the value
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("unexpected data after JSON value")
+	}
+
+	return nil
+}
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// checkUnknownFields returns an error if v, as decoded into an interface{},
+// contains an object key that would not be decoded into a field of a value
+// of type t. Values decoded by a json.Unmarshaler or into an interface{} are
+// not checked.
+func checkUnknownFields(v interface{}, t reflect.Type) error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.PtrTo(t).Implements(unmarshalerType) {
+		return nil
+	}
+
+	switch v := v.(type) {
+	case map[string]interface{}:
+		switch t.Kind() {
+		case reflect.Struct:
+			fields := jsonFields(t)
+			for k, elem := range v {
+				ft, ok := fields[k]
+				if !ok {
+					// Like encoding/json, fall back to a case-insensitive match
+					for name, nameType := range fields {
+						if strings.EqualFold(name, k) {
+							ft, ok = nameType, true
+							break
+						}
+					}
+				}
+				if !ok {
+					return fmt.Errorf("json: unknown field %q", k)
+				}
+				if err := checkUnknownFields(elem, ft); err != nil {
+					return err
+				}
+			}
+		case reflect.Map:
+			for _, elem := range v {
+				if err := checkUnknownFields(elem, t.Elem()); err != nil {
+					return err
+				}
+			}
+		}
+	case []interface{}:
+		switch t.Kind() {
+		case reflect.Slice, reflect.Array:
+			for _, elem := range v {
+				if err := checkUnknownFields(elem, t.Elem()); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// jsonFields returns the types of the fields of struct type t keyed by the
+// names encoding/json decodes them from, including promoted fields of
+// embedded structs
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	var embedded []reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := tag
+		if idx := strings.Index(tag, ","); idx != -1 {
+			name = tag[:idx]
+		}
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			embedded = append(embedded, ft)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+
+	// Fields of the outer struct take precedence over promoted ones
+	for _, et := range embedded {
+		for name, ft := range jsonFields(et) {
+			if _, ok := fields[name]; !ok {
+				fields[name] = ft
+			}
+		}
+	}
+	return fields
+}
+
+// jsonDepth returns the maximum nesting depth of objects and arrays in data,
+// skipping over strings. It does not validate the JSON, which is left to the
+// decoder.
+func jsonDepth(data []byte) int {
+	var depth, max int
+	var inString, escaped bool
+	for _, b := range data {
+		switch {
+		case escaped:
+			escaped = false
+		case inString:
+			switch b {
+			case '\\':
+				escaped = true
+			case '"':
+				inString = false
+			}
+		case b == '"':
+			inString = true
+		case b == '{' || b == '[':
+			depth++
+			if depth > max {
+				max = depth
+			}
+		case b == '}' || b == ']':
+			depth--
+		}
+	}
+	return max
+}
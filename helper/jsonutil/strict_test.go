@@ -0,0 +1,152 @@
+package jsonutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/compressutil"
+)
+
+type strictTestStruct struct {
+	Name  string      `json:"name"`
+	Count json.Number `json:"count"`
+	Tags  []string    `json:"tags"`
+}
+
+type strictTestEmbedded struct {
+	ID string `json:"id"`
+}
+
+type strictTestNested struct {
+	strictTestEmbedded
+	Child    *strictTestStruct            `json:"child"`
+	Children []strictTestStruct           `json:"children"`
+	ByName   map[string]*strictTestStruct `json:"by_name"`
+	Raw      json.RawMessage              `json:"raw"`
+	Any      interface{}                  `json:"any"`
+	Untagged string
+	Ignored  string `json:"-"`
+}
+
+func TestJSONUtil_DecodeJSONStrict(t *testing.T) {
+	var out strictTestStruct
+	if err := DecodeJSONStrict([]byte(`{"name":"foo","count":3,"tags":["a"]}`), &out, nil); err != nil {
+		t.Fatal(err)
+	}
+	if out.Name != "foo" || out.Count.String() != "3" || len(out.Tags) != 1 {
+		t.Fatalf("bad: %#v", out)
+	}
+
+	// Compressed input is decompressed first
+	compressed, err := EncodeJSONAndCompress(out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out = strictTestStruct{}
+	if err := DecodeJSONStrict(compressed, &out, nil); err != nil {
+		t.Fatal(err)
+	}
+	if out.Name != "foo" {
+		t.Fatalf("bad: %#v", out)
+	}
+
+	cases := map[string]string{
+		"unknown field": `{"name":"foo","cuont":3}`,
+		"trailing data": `{"name":"foo"} {"name":"bar"}`,
+		"too deep":      `{"tags":` + strings.Repeat("[", 10) + strings.Repeat("]", 10) + `}`,
+		"too large":     `{"name":"` + strings.Repeat("a", 1024) + `"}`,
+	}
+	for name, input := range cases {
+		var out strictTestStruct
+		err := DecodeJSONStrict([]byte(input), &out, &StrictConfig{
+			MaxSize:  512,
+			MaxDepth: 5,
+		})
+		if err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+
+	// Brackets within strings do not count toward the depth
+	out = strictTestStruct{}
+	input := fmt.Sprintf(`{"name":%q}`, strings.Repeat("[{", 10))
+	if err := DecodeJSONStrict([]byte(input), &out, &StrictConfig{MaxDepth: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Compressed input is limited once decompressed
+	compressed, err = compressutil.Compress([]byte(cases["too large"]), &compressutil.CompressionConfig{
+		Type: compressutil.CompressionTypeSnappy,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := DecodeJSONStrict(compressed, &out, &StrictConfig{MaxSize: 512}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestJSONUtil_DecodeJSONStrictNested(t *testing.T) {
+	var out strictTestNested
+	input := `{
+		"id": "foo",
+		"child": {"name": "a"},
+		"children": [{"name": "b"}],
+		"by_name": {"c": {"NAME": "c"}},
+		"raw": {"anything": true},
+		"any": {"anything": true},
+		"untagged": "d"
+	}`
+	if err := DecodeJSONStrict([]byte(input), &out, nil); err != nil {
+		t.Fatal(err)
+	}
+	if out.ID != "foo" || out.Child.Name != "a" || out.Children[0].Name != "b" ||
+		out.ByName["c"].Name != "c" || out.Untagged != "d" {
+		t.Fatalf("bad: %#v", out)
+	}
+
+	cases := map[string]string{
+		"struct field": `{"child":{"nmae":"a"}}`,
+		"slice elem":   `{"children":[{"name":"b"},{"nmae":"b"}]}`,
+		"map value":    `{"by_name":{"c":{"nmae":"c"}}}`,
+		"ignored":      `{"Ignored":"e"}`,
+	}
+	for name, input := range cases {
+		var out strictTestNested
+		err := DecodeJSONStrict([]byte(input), &out, nil)
+		if err == nil || !strings.Contains(err.Error(), "unknown field") {
+			t.Fatalf("%s: expected unknown field error, got %v", name, err)
+		}
+	}
+}
+
+func TestJSONUtil_DecodeJSONStrictHook(t *testing.T) {
+	var called bool
+	var out map[string]interface{}
+	err := DecodeJSONStrict([]byte(`{"count":3}`), &out, &StrictConfig{
+		DecoderHook: func(dec *json.Decoder) error {
+			called = true
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !called {
+		t.Fatal("expected hook to be called")
+	}
+	if _, ok := out["count"].(json.Number); !ok {
+		t.Fatalf("expected json.Number, got %T", out["count"])
+	}
+
+	err = DecodeJSONStrict([]byte(`{"count":3}`), &out, &StrictConfig{
+		DecoderHook: func(dec *json.Decoder) error {
+			return fmt.Errorf("rejected")
+		},
+	})
+	if err == nil || err.Error() != "rejected" {
+		t.Fatalf("expected hook error, got %v", err)
+	}
+}
@@ -1,7 +1,10 @@
 package locksutil
 
 import (
+	"context"
 	"fmt"
+	"hash/fnv"
+	"sort"
 	"sync"
 )
 
@@ -22,3 +25,68 @@ func CreateLocks(p map[string]*sync.RWMutex, count int64) error {
 
 	return nil
 }
+
+// LockShards is a fixed set of RWMutex shards, one of which is selected for
+// each key, so that operations on different keys rarely contend while the
+// number of locks stays bounded
+type LockShards struct {
+	shards []*RWMutex
+}
+
+// NewLockShards creates count shards, with the same limits as CreateLocks
+func NewLockShards(count int) (*LockShards, error) {
+	if count <= 0 || count > 256 {
+		return nil, fmt.Errorf("invalid count: %d", count)
+	}
+
+	l := &LockShards{
+		shards: make([]*RWMutex, count),
+	}
+	for i := range l.shards {
+		l.shards[i] = &RWMutex{}
+	}
+	return l, nil
+}
+
+// LockForKey returns the shard for the key. The same key always maps to the
+// same shard.
+func (l *LockShards) LockForKey(key string) *RWMutex {
+	return l.shards[l.index(key)]
+}
+
+func (l *LockShards) index(key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(l.shards)))
+}
+
+// LockKeysWithContext locks the shards of all the given keys for writing, in
+// a fixed order so that concurrent callers cannot deadlock. If the context is
+// done first, the shards locked so far are released and the context's error
+// is returned. Otherwise the returned function unlocks all of them.
+func (l *LockShards) LockKeysWithContext(ctx context.Context, keys ...string) (func(), error) {
+	indexes := make(map[int]struct{}, len(keys))
+	for _, key := range keys {
+		indexes[l.index(key)] = struct{}{}
+	}
+	sorted := make([]int, 0, len(indexes))
+	for index := range indexes {
+		sorted = append(sorted, index)
+	}
+	sort.Ints(sorted)
+
+	locked := make([]*RWMutex, 0, len(sorted))
+	unlock := func() {
+		for i := len(locked) - 1; i >= 0; i-- {
+			locked[i].Unlock()
+		}
+	}
+	for _, index := range sorted {
+		if err := l.shards[index].LockWithContext(ctx); err != nil {
+			unlock()
+			return nil, err
+		}
+		locked = append(locked, l.shards[index])
+	}
+	return unlock, nil
+}
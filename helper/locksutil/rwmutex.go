@@ -0,0 +1,157 @@
+package locksutil
+
+import (
+	"context"
+	"sync"
+)
+
+// RWMutex is a reader/writer mutual exclusion lock like sync.RWMutex, whose
+// acquisition can also be attempted without blocking, or abandoned when a
+// context is done so that waiting on a long-held lock does not block
+// shutdown or outlive a request's deadline. As with sync.RWMutex, a blocked
+// writer keeps new readers from acquiring the lock.
+//
+// The zero value is an unlocked mutex.
+type RWMutex struct {
+	l              sync.Mutex
+	readers        int
+	writer         bool
+	waitingWriters int
+
+	// Closed and replaced whenever the lock may have become available
+	changed chan struct{}
+}
+
+// Lock locks the mutex for writing, blocking until it is available
+func (m *RWMutex) Lock() {
+	m.LockWithContext(context.Background())
+}
+
+// LockWithContext locks the mutex for writing, blocking until it is
+// available or the context is done. In the latter case the context's error
+// is returned and the mutex is not locked.
+func (m *RWMutex) LockWithContext(ctx context.Context) error {
+	m.l.Lock()
+	for m.writer || m.readers > 0 {
+		m.waitingWriters++
+		err := m.waitLocked(ctx)
+		m.waitingWriters--
+		if err != nil {
+			// Readers held back by this writer may proceed
+			m.broadcastLocked()
+			m.l.Unlock()
+			return err
+		}
+	}
+	m.writer = true
+	m.l.Unlock()
+	return nil
+}
+
+// TryLock locks the mutex for writing if it is available and returns whether
+// it did
+func (m *RWMutex) TryLock() bool {
+	m.l.Lock()
+	defer m.l.Unlock()
+	if m.writer || m.readers > 0 {
+		return false
+	}
+	m.writer = true
+	return true
+}
+
+// Unlock unlocks the mutex for writing. It panics if the mutex is not locked
+// for writing.
+func (m *RWMutex) Unlock() {
+	m.l.Lock()
+	defer m.l.Unlock()
+	if !m.writer {
+		panic("locksutil: Unlock of unlocked RWMutex")
+	}
+	m.writer = false
+	m.broadcastLocked()
+}
+
+// RLock locks the mutex for reading, blocking until it is available
+func (m *RWMutex) RLock() {
+	m.RLockWithContext(context.Background())
+}
+
+// RLockWithContext locks the mutex for reading, blocking until it is
+// available or the context is done. In the latter case the context's error
+// is returned and the mutex is not locked.
+func (m *RWMutex) RLockWithContext(ctx context.Context) error {
+	m.l.Lock()
+	for m.writer || m.waitingWriters > 0 {
+		if err := m.waitLocked(ctx); err != nil {
+			m.l.Unlock()
+			return err
+		}
+	}
+	m.readers++
+	m.l.Unlock()
+	return nil
+}
+
+// TryRLock locks the mutex for reading if it is available and returns
+// whether it did
+func (m *RWMutex) TryRLock() bool {
+	m.l.Lock()
+	defer m.l.Unlock()
+	if m.writer || m.waitingWriters > 0 {
+		return false
+	}
+	m.readers++
+	return true
+}
+
+// RUnlock undoes a single RLock. It panics if the mutex is not locked for
+// reading.
+func (m *RWMutex) RUnlock() {
+	m.l.Lock()
+	defer m.l.Unlock()
+	if m.readers == 0 {
+		panic("locksutil: RUnlock of unlocked RWMutex")
+	}
+	m.readers--
+	if m.readers == 0 {
+		m.broadcastLocked()
+	}
+}
+
+// RLocker returns a sync.Locker that locks and unlocks the mutex for reading
+func (m *RWMutex) RLocker() sync.Locker {
+	return (*rlocker)(m)
+}
+
+// waitLocked waits, with m.l released, until the state of the lock changes
+// or the context is done. m.l is held again when it returns.
+func (m *RWMutex) waitLocked(ctx context.Context) error {
+	if m.changed == nil {
+		m.changed = make(chan struct{})
+	}
+	changed := m.changed
+	m.l.Unlock()
+
+	var err error
+	select {
+	case <-changed:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	m.l.Lock()
+	return err
+}
+
+func (m *RWMutex) broadcastLocked() {
+	if m.changed != nil {
+		close(m.changed)
+		m.changed = nil
+	}
+}
+
+type rlocker RWMutex
+
+func (r *rlocker) Lock()   { (*RWMutex)(r).RLock() }
+func (r *rlocker) Unlock() { (*RWMutex)(r).RUnlock() }
@@ -0,0 +1,149 @@
+package locksutil
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRWMutex_TryLock(t *testing.T) {
+	var m RWMutex
+
+	if !m.TryLock() {
+		t.Fatal("expected to lock an unlocked mutex")
+	}
+	if m.TryLock() || m.TryRLock() {
+		t.Fatal("expected locked mutex to be unavailable")
+	}
+	m.Unlock()
+
+	if !m.TryRLock() || !m.TryRLock() {
+		t.Fatal("expected multiple readers")
+	}
+	if m.TryLock() {
+		t.Fatal("expected write lock to be unavailable with readers")
+	}
+	m.RUnlock()
+	m.RUnlock()
+
+	if !m.TryLock() {
+		t.Fatal("expected to lock after readers are done")
+	}
+	m.Unlock()
+}
+
+func TestRWMutex_LockWithContext(t *testing.T) {
+	var m RWMutex
+	m.RLock()
+
+	// A writer gives up when its context is done
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := m.LockWithContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	// The abandoned writer no longer holds back readers
+	if !m.TryRLock() {
+		t.Fatal("expected read lock to be available")
+	}
+	m.RUnlock()
+
+	// A waiting writer holds back new readers until it is done
+	locked := make(chan struct{})
+	go func() {
+		m.Lock()
+		close(locked)
+	}()
+	deadline := time.Now().Add(time.Second)
+	for m.TryRLock() {
+		m.RUnlock()
+		if time.Now().After(deadline) {
+			t.Fatal("writer never started waiting")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel2()
+	if err := m.RLockWithContext(ctx2); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	m.RUnlock()
+	<-locked
+	m.Unlock()
+
+	if err := m.RLockWithContext(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	m.RUnlock()
+}
+
+func TestRWMutex_Concurrent(t *testing.T) {
+	var m RWMutex
+	var counter int
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			m.Lock()
+			counter++
+			m.Unlock()
+		}()
+		go func() {
+			defer wg.Done()
+			l := m.RLocker()
+			l.Lock()
+			_ = counter
+			l.Unlock()
+		}()
+	}
+	wg.Wait()
+	if counter != 50 {
+		t.Fatalf("bad counter: %d", counter)
+	}
+}
+
+func TestLockShards(t *testing.T) {
+	if _, err := NewLockShards(0); err == nil {
+		t.Fatal("expected an error")
+	}
+	if _, err := NewLockShards(257); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	shards, err := NewLockShards(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shards.LockForKey("foo") != shards.LockForKey("foo") {
+		t.Fatal("expected the same shard for the same key")
+	}
+
+	unlock, err := shards.LockKeysWithContext(context.Background(), "foo", "bar", "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if shards.LockForKey("foo").TryLock() || shards.LockForKey("bar").TryLock() {
+		t.Fatal("expected shards to be locked")
+	}
+
+	// Locking an overlapping set fails once the context is done and leaves
+	// nothing locked
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := shards.LockKeysWithContext(ctx, "bar", "baz"); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+
+	unlock()
+	for _, key := range []string{"foo", "bar", "baz"} {
+		l := shards.LockForKey(key)
+		if !l.TryLock() {
+			t.Fatalf("expected shard of %s to be unlocked", key)
+		}
+		l.Unlock()
+	}
+}
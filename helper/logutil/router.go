@@ -0,0 +1,295 @@
+package logutil
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Levels are the log levels, from the most to the least verbose
+var Levels = []string{"trace", "debug", "info", "warn", "err"}
+
+// Subsystems are the parts of Vault whose log level can be set separately
+// from the default level
+var Subsystems = []string{"core", "expiration", "audit", "physical"}
+
+// subsystemPrefixes maps the prefix of log messages, following their
+// level, to the subsystem that logged them
+var subsystemPrefixes = map[string]string{
+	"core":     "core",
+	"rollback": "core",
+	"sys":      "core",
+	"expire":   "expiration",
+	"audit":    "audit",
+	"physical": "physical",
+}
+
+// Router is an io.Writer for a log.Logger that filters each message by its
+// level, which is given in brackets as in "[INFO] core: ...", and copies
+// the messages to any number of sinks. The level can be set for each
+// subsystem, and both the levels and the sinks can be changed while
+// messages are being logged. Messages without a level are always written.
+type Router struct {
+	writer io.Writer
+
+	l          sync.RWMutex
+	level      int
+	subsystems map[string]int
+	sinks      map[string]*routerSink
+}
+
+type routerSink struct {
+	config *SinkConfig
+	sink   Sink
+
+	// level is -1 if the sink follows the level of the subsystems
+	level int
+}
+
+// NewRouter returns a Router that writes the messages at the given level
+// and above to w
+func NewRouter(w io.Writer, level string) (*Router, error) {
+	l, err := parseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Router{
+		writer:     w,
+		level:      l,
+		subsystems: make(map[string]int),
+		sinks:      make(map[string]*routerSink),
+	}, nil
+}
+
+// Write writes a single log message
+func (r *Router) Write(p []byte) (int, error) {
+	level, subsystem := parseMessage(p)
+
+	r.l.RLock()
+	defer r.l.RUnlock()
+
+	min := r.level
+	if l, ok := r.subsystems[subsystem]; ok {
+		min = l
+	}
+
+	// Errors from sinks are ignored, since there is nowhere to log them
+	for _, s := range r.sinks {
+		sinkMin := min
+		if s.level >= 0 {
+			sinkMin = s.level
+		}
+		if level < 0 || level >= sinkMin {
+			s.sink.WriteLevel(level, p)
+		}
+	}
+
+	if level >= 0 && level < min {
+		return len(p), nil
+	}
+	return r.writer.Write(p)
+}
+
+// Level returns the default level
+func (r *Router) Level() string {
+	r.l.RLock()
+	defer r.l.RUnlock()
+	return Levels[r.level]
+}
+
+// SetLevel sets the default level, which applies to the subsystems whose
+// level is not set
+func (r *Router) SetLevel(level string) error {
+	l, err := parseLevel(level)
+	if err != nil {
+		return err
+	}
+
+	r.l.Lock()
+	r.level = l
+	r.l.Unlock()
+	return nil
+}
+
+// SubsystemLevels returns the levels that are set for subsystems
+func (r *Router) SubsystemLevels() map[string]string {
+	r.l.RLock()
+	defer r.l.RUnlock()
+
+	levels := make(map[string]string, len(r.subsystems))
+	for name, l := range r.subsystems {
+		levels[name] = Levels[l]
+	}
+	return levels
+}
+
+// SetSubsystemLevel sets the level of a subsystem. An empty level reverts
+// the subsystem to the default level.
+func (r *Router) SetSubsystemLevel(subsystem, level string) error {
+	if !validSubsystem(subsystem) {
+		return fmt.Errorf("unknown subsystem %q", subsystem)
+	}
+
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	if level == "" {
+		delete(r.subsystems, subsystem)
+		return nil
+	}
+
+	l, err := parseLevel(level)
+	if err != nil {
+		return err
+	}
+	r.subsystems[subsystem] = l
+	return nil
+}
+
+// Sinks returns the configuration of the sinks by name
+func (r *Router) Sinks() map[string]*SinkConfig {
+	r.l.RLock()
+	defer r.l.RUnlock()
+
+	sinks := make(map[string]*SinkConfig, len(r.sinks))
+	for name, s := range r.sinks {
+		sinks[name] = s.config
+	}
+	return sinks
+}
+
+// SinkNames returns the sorted names of the sinks
+func (r *Router) SinkNames() []string {
+	r.l.RLock()
+	defer r.l.RUnlock()
+
+	names := make([]string, 0, len(r.sinks))
+	for name := range r.sinks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AddSink creates a sink and starts copying messages to it. A sink with the
+// same name is replaced and closed.
+func (r *Router) AddSink(name string, config *SinkConfig) error {
+	level := -1
+	if config.Level != "" {
+		l, err := parseLevel(config.Level)
+		if err != nil {
+			return err
+		}
+		level = l
+	}
+
+	sink, err := NewSink(config)
+	if err != nil {
+		return err
+	}
+
+	r.l.Lock()
+	old := r.sinks[name]
+	r.sinks[name] = &routerSink{
+		config: config,
+		sink:   sink,
+		level:  level,
+	}
+	r.l.Unlock()
+
+	if old != nil {
+		old.sink.Close()
+	}
+	return nil
+}
+
+// RemoveSink stops copying messages to a sink and closes it. It is not an
+// error if the sink does not exist.
+func (r *Router) RemoveSink(name string) error {
+	r.l.Lock()
+	old := r.sinks[name]
+	delete(r.sinks, name)
+	r.l.Unlock()
+
+	if old == nil {
+		return nil
+	}
+	return old.sink.Close()
+}
+
+// Close removes and closes all the sinks
+func (r *Router) Close() error {
+	r.l.Lock()
+	sinks := r.sinks
+	r.sinks = make(map[string]*routerSink)
+	r.l.Unlock()
+
+	var lastErr error
+	for _, s := range sinks {
+		if err := s.sink.Close(); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// ValidLevel returns whether level is one of the log levels
+func ValidLevel(level string) bool {
+	_, err := parseLevel(level)
+	return err == nil
+}
+
+func parseLevel(level string) (int, error) {
+	level = strings.ToLower(level)
+	for i, l := range Levels {
+		if l == level {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q", level)
+}
+
+func validSubsystem(subsystem string) bool {
+	for _, s := range Subsystems {
+		if s == subsystem {
+			return true
+		}
+	}
+	return false
+}
+
+// parseMessage returns the level and subsystem of a log message. The level
+// is -1 if the message has none, and the subsystem is empty if it is not
+// known.
+func parseMessage(p []byte) (int, string) {
+	x := bytes.IndexByte(p, '[')
+	if x < 0 {
+		return -1, ""
+	}
+	y := bytes.IndexByte(p[x:], ']')
+	if y < 0 {
+		return -1, ""
+	}
+
+	name := string(p[x+1 : x+y])
+	if name == "ERROR" {
+		name = "err"
+	}
+	level, err := parseLevel(name)
+	if err != nil {
+		return -1, ""
+	}
+
+	// The subsystem follows the level, as in "[INFO] core: " or
+	// "[DEBUG]: physical/consul: "
+	rest := bytes.TrimLeft(p[x+y+1:], ": ")
+	end := bytes.IndexAny(rest, ":/ ")
+	if end < 0 {
+		return level, ""
+	}
+	return level, subsystemPrefixes[string(rest[:end])]
+}
@@ -0,0 +1,123 @@
+package logutil
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRouter_Levels(t *testing.T) {
+	var buf bytes.Buffer
+	r, err := NewRouter(&buf, "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := log.New(r, "", 0)
+
+	logger.Printf("[DEBUG] core: hidden")
+	logger.Printf("[INFO] core: shown")
+	logger.Printf("no level")
+	if buf.String() != "[INFO] core: shown\nno level\n" {
+		t.Fatalf("bad: %q", buf.String())
+	}
+
+	buf.Reset()
+	if err := r.SetSubsystemLevel("physical", "trace"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetSubsystemLevel("expiration", "err"); err != nil {
+		t.Fatal(err)
+	}
+	logger.Printf("[TRACE]: physical/consul: shown")
+	logger.Printf("[WARN] expire: hidden")
+	logger.Printf("[ERROR] expire: shown")
+	logger.Printf("[DEBUG] core: hidden")
+	if buf.String() != "[TRACE]: physical/consul: shown\n[ERROR] expire: shown\n" {
+		t.Fatalf("bad: %q", buf.String())
+	}
+
+	levels := r.SubsystemLevels()
+	if len(levels) != 2 || levels["physical"] != "trace" || levels["expiration"] != "err" {
+		t.Fatalf("bad: %#v", levels)
+	}
+
+	buf.Reset()
+	if err := r.SetSubsystemLevel("physical", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.SetLevel("WARN"); err != nil {
+		t.Fatal(err)
+	}
+	if r.Level() != "warn" {
+		t.Fatalf("bad: %s", r.Level())
+	}
+	logger.Printf("[TRACE]: physical/consul: hidden")
+	logger.Printf("[INFO] core: hidden")
+	logger.Printf("[WARN] audit: shown")
+	if buf.String() != "[WARN] audit: shown\n" {
+		t.Fatalf("bad: %q", buf.String())
+	}
+
+	if err := r.SetLevel("verbose"); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := r.SetSubsystemLevel("nope", "info"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestRouter_FileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-logutil")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "vault.log")
+
+	var buf bytes.Buffer
+	r, err := NewRouter(&buf, "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := log.New(r, "", 0)
+
+	if err := r.AddSink("debug", &SinkConfig{Type: "file", Level: "debug", Options: map[string]string{"path": path}}); err != nil {
+		t.Fatal(err)
+	}
+	if names := r.SinkNames(); len(names) != 1 || names[0] != "debug" {
+		t.Fatalf("bad: %v", names)
+	}
+
+	logger.Printf("[TRACE] core: hidden")
+	logger.Printf("[DEBUG] core: sink only")
+	logger.Printf("[INFO] core: both")
+
+	if err := r.RemoveSink("debug"); err != nil {
+		t.Fatal(err)
+	}
+	logger.Printf("[INFO] core: main only")
+
+	out, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "[DEBUG] core: sink only\n[INFO] core: both\n" {
+		t.Fatalf("bad: %q", out)
+	}
+	if buf.String() != "[INFO] core: both\n[INFO] core: main only\n" {
+		t.Fatalf("bad: %q", buf.String())
+	}
+
+	if err := r.AddSink("bad", &SinkConfig{Type: "file"}); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := r.AddSink("bad", &SinkConfig{Type: "carrier-pigeon"}); err == nil {
+		t.Fatal("expected error")
+	}
+	if len(r.Sinks()) != 0 {
+		t.Fatalf("bad: %#v", r.Sinks())
+	}
+}
@@ -0,0 +1,104 @@
+package logutil
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/go-syslog"
+)
+
+// Sink is a destination for log messages in addition to the main output
+type Sink interface {
+	// WriteLevel writes a message at the given index in Levels, or -1 if
+	// the message has no level
+	WriteLevel(level int, p []byte) error
+
+	// Close closes the sink
+	Close() error
+}
+
+// SinkConfig is the configuration of a sink
+type SinkConfig struct {
+	// Type is either "file" or "syslog"
+	Type string `json:"type" structs:"type" mapstructure:"type"`
+
+	// Level is the minimum level of the messages written to the sink. If
+	// empty, the sink gets the same messages as the main output.
+	Level string `json:"level" structs:"level" mapstructure:"level"`
+
+	// Options configure the sink. A file sink requires a "path"; a syslog
+	// sink accepts a "facility" and a "tag".
+	Options map[string]string `json:"options" structs:"options" mapstructure:"options"`
+}
+
+// NewSink creates a sink from its configuration
+func NewSink(config *SinkConfig) (Sink, error) {
+	switch config.Type {
+	case "file":
+		path := config.Options["path"]
+		if path == "" {
+			return nil, fmt.Errorf("a path is required for a file sink")
+		}
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, err
+		}
+		return &fileSink{f: f}, nil
+
+	case "syslog":
+		facility := config.Options["facility"]
+		if facility == "" {
+			facility = "LOCAL0"
+		}
+		tag := config.Options["tag"]
+		if tag == "" {
+			tag = "vault"
+		}
+		logger, err := gsyslog.NewLogger(gsyslog.LOG_INFO, facility, tag)
+		if err != nil {
+			return nil, err
+		}
+		return &syslogSink{logger: logger}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown sink type %q", config.Type)
+	}
+}
+
+type fileSink struct {
+	f *os.File
+}
+
+func (s *fileSink) WriteLevel(level int, p []byte) error {
+	_, err := s.f.Write(p)
+	return err
+}
+
+func (s *fileSink) Close() error {
+	return s.f.Close()
+}
+
+// syslogPriorities maps the index of a level to a syslog priority
+var syslogPriorities = []gsyslog.Priority{
+	gsyslog.LOG_DEBUG,
+	gsyslog.LOG_DEBUG,
+	gsyslog.LOG_INFO,
+	gsyslog.LOG_WARNING,
+	gsyslog.LOG_ERR,
+}
+
+type syslogSink struct {
+	logger gsyslog.Syslogger
+}
+
+func (s *syslogSink) WriteLevel(level int, p []byte) error {
+	priority := gsyslog.LOG_NOTICE
+	if level >= 0 && level < len(syslogPriorities) {
+		priority = syslogPriorities[level]
+	}
+	return s.logger.WriteLevel(priority, p)
+}
+
+func (s *syslogSink) Close() error {
+	return s.logger.Close()
+}
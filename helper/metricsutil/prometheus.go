@@ -0,0 +1,185 @@
+package metricsutil
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PrometheusContentType is the content type of the Prometheus text
+// exposition format written by PrometheusSink
+const PrometheusContentType = "text/plain; version=0.0.4"
+
+// PrometheusSink is a metrics.MetricSink that keeps cumulative values for
+// all the metrics it receives, so that they can be scraped in the
+// Prometheus text exposition format. Unlike the in-memory sink, values are
+// never reset: counters and samples accumulate for the life of the process
+// and gauges keep the last value set.
+type PrometheusSink struct {
+	hostname string
+
+	l        sync.Mutex
+	gauges   map[string]float64
+	counters map[string]float64
+	samples  map[string]*prometheusSummary
+}
+
+type prometheusSummary struct {
+	count uint64
+	sum   float64
+}
+
+// NewPrometheusSink returns a new PrometheusSink. If hostname is not empty,
+// it is removed from the keys of gauges, where go-metrics inserts it after
+// the service name; the hostname is already known to the Prometheus server
+// scraping the metrics.
+func NewPrometheusSink(hostname string) *PrometheusSink {
+	return &PrometheusSink{
+		hostname: hostname,
+		gauges:   make(map[string]float64),
+		counters: make(map[string]float64),
+		samples:  make(map[string]*prometheusSummary),
+	}
+}
+
+// SetGauge is used to set the value of a gauge
+func (p *PrometheusSink) SetGauge(key []string, val float32) {
+	if p.hostname != "" && len(key) > 1 && key[1] == p.hostname {
+		key = append([]string{key[0]}, key[2:]...)
+	}
+	name := prometheusName(key)
+
+	p.l.Lock()
+	p.gauges[name] = float64(val)
+	p.l.Unlock()
+}
+
+// EmitKey is used to emit a key/value pair, which is kept as a gauge
+func (p *PrometheusSink) EmitKey(key []string, val float32) {
+	name := prometheusName(key)
+
+	p.l.Lock()
+	p.gauges[name] = float64(val)
+	p.l.Unlock()
+}
+
+// IncrCounter is used to increment a counter
+func (p *PrometheusSink) IncrCounter(key []string, val float32) {
+	name := prometheusName(key) + "_total"
+
+	p.l.Lock()
+	p.counters[name] += float64(val)
+	p.l.Unlock()
+}
+
+// AddSample is used to add a sample to a summary
+func (p *PrometheusSink) AddSample(key []string, val float32) {
+	name := prometheusName(key)
+
+	p.l.Lock()
+	s, ok := p.samples[name]
+	if !ok {
+		s = &prometheusSummary{}
+		p.samples[name] = s
+	}
+	s.count++
+	s.sum += float64(val)
+	p.l.Unlock()
+}
+
+// WriteTo writes all the metrics to w in the Prometheus text exposition
+// format, sorted by name
+func (p *PrometheusSink) WriteTo(w io.Writer) (int64, error) {
+	type metric struct {
+		name string
+		typ  string
+		val  float64
+		sum  *prometheusSummary
+	}
+
+	p.l.Lock()
+	all := make([]metric, 0, len(p.gauges)+len(p.counters)+len(p.samples))
+	for name, val := range p.gauges {
+		all = append(all, metric{name: name, typ: "gauge", val: val})
+	}
+	for name, val := range p.counters {
+		all = append(all, metric{name: name, typ: "counter", val: val})
+	}
+	for name, s := range p.samples {
+		all = append(all, metric{name: name, typ: "summary", sum: &prometheusSummary{
+			count: s.count,
+			sum:   s.sum,
+		}})
+	}
+	p.l.Unlock()
+
+	names := make([]string, 0, len(all))
+	byName := make(map[string]metric, len(all))
+	for _, m := range all {
+		// A name can only have a single type; the first one wins
+		if _, ok := byName[m.name]; ok {
+			continue
+		}
+		names = append(names, m.name)
+		byName[m.name] = m
+	}
+	sort.Strings(names)
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, name := range names {
+		m := byName[name]
+		fmt.Fprintf(bw, "# TYPE %s %s\n", name, m.typ)
+		if m.sum != nil {
+			fmt.Fprintf(bw, "%s_sum %s\n", name, formatPrometheusValue(m.sum.sum))
+			fmt.Fprintf(bw, "%s_count %d\n", name, m.sum.count)
+			continue
+		}
+		fmt.Fprintf(bw, "%s %s\n", name, formatPrometheusValue(m.val))
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// prometheusName joins the parts of a key into a valid Prometheus metric
+// name, replacing any invalid character with an underscore
+func prometheusName(key []string) string {
+	name := strings.Join(key, "_")
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == ':':
+			return r
+		default:
+			return '_'
+		}
+	}, name)
+}
+
+func formatPrometheusValue(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
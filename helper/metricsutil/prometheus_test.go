@@ -0,0 +1,60 @@
+package metricsutil
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPrometheusSink(t *testing.T) {
+	sink := NewPrometheusSink("myhost")
+
+	sink.SetGauge([]string{"vault", "myhost", "expire", "num_leases"}, 3)
+	sink.SetGauge([]string{"vault", "myhost", "expire", "num_leases"}, 5)
+	sink.IncrCounter([]string{"vault", "core", "admission", "read", "rejected"}, 1)
+	sink.IncrCounter([]string{"vault", "core", "admission", "read", "rejected"}, 2)
+	sink.AddSample([]string{"vault", "barrier", "get"}, 1.5)
+	sink.AddSample([]string{"vault", "barrier", "get"}, 2.5)
+	sink.AddSample([]string{"vault", "core", "seal-internal"}, 4)
+	sink.EmitKey([]string{"vault", "some.key"}, 7)
+
+	var buf bytes.Buffer
+	n, err := sink.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Fatalf("bad: wrote %d, counted %d", buf.Len(), n)
+	}
+
+	expected := `# TYPE vault_barrier_get summary
+vault_barrier_get_sum 4
+vault_barrier_get_count 2
+# TYPE vault_core_admission_read_rejected_total counter
+vault_core_admission_read_rejected_total 3
+# TYPE vault_core_seal_internal summary
+vault_core_seal_internal_sum 4
+vault_core_seal_internal_count 1
+# TYPE vault_expire_num_leases gauge
+vault_expire_num_leases 5
+# TYPE vault_some_key gauge
+vault_some_key 7
+`
+	if buf.String() != expected {
+		t.Fatalf("bad:\n%s\nexpected:\n%s", buf.String(), expected)
+	}
+}
+
+func TestPrometheusSink_NoHostname(t *testing.T) {
+	sink := NewPrometheusSink("")
+	sink.SetGauge([]string{"vault", "runtime", "num_goroutines"}, 10)
+
+	var buf bytes.Buffer
+	if _, err := sink.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "# TYPE vault_runtime_num_goroutines gauge\nvault_runtime_num_goroutines 10\n"
+	if buf.String() != expected {
+		t.Fatalf("bad: %q", buf.String())
+	}
+}
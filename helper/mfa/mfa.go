@@ -78,7 +78,13 @@ func (b *backend) wrapLoginHandler(loginHandler framework.OperationFunc) framewo
 		// perform multi-factor authentication if type supported
 		handler, ok := handlers[mfa_config.Type]
 		if ok {
-			return handler(req, d, resp)
+			resp, err := handler(req, d, resp)
+			// record the method in the token metadata, so that policies
+			// can require a second factor
+			if err == nil && resp != nil && resp.Auth != nil && resp.Auth.Metadata != nil {
+				resp.Auth.Metadata["mfa_method"] = mfa_config.Type
+			}
+			return resp, err
 		} else {
 			return resp, err
 		}
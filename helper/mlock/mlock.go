@@ -1,9 +1,44 @@
 package mlock
 
+import "errors"
+
 // This should be set by the OS-specific packages to tell whether LockMemory
 // is supported or not.
 var supported bool
 
+// ErrNotReported is returned by LockedBytes and Limit when the system does
+// not report the requested value.
+var ErrNotReported = errors.New("not reported by this system")
+
+// Unlimited is the limit returned by Limit when the amount of memory that
+// may be locked is not limited.
+const Unlimited = ^uint64(0)
+
+// Status describes the outcome of LockMemoryStatus.
+type Status struct {
+	// Current is true if the memory mapped at the time of the call was
+	// locked.
+	Current bool
+
+	// Future is true if memory mapped after the call will be locked as
+	// well. If Current is true and Future is false, only part of the memory
+	// used by the process over its lifetime is locked.
+	Future bool
+
+	// LockedBytes is the amount of memory locked after the call, as
+	// reported by the system, or zero if it is not reported.
+	LockedBytes uint64
+
+	// Limit is the maximum amount of memory that the process may lock,
+	// Unlimited if there is no limit, or zero if it is not reported.
+	Limit uint64
+}
+
+// Partial returns true if some, but not all, memory is locked.
+func (s *Status) Partial() bool {
+	return s.Current && !s.Future
+}
+
 // Supported returns true if LockMemory is functional on this system.
 func Supported() bool {
 	return supported
@@ -13,3 +48,23 @@ func Supported() bool {
 func LockMemory() error {
 	return lockMemory()
 }
+
+// LockMemoryStatus is like LockMemory, but reports how much of the memory
+// was locked. If all memory cannot be locked, it falls back to locking
+// only the memory currently mapped and returns the error from the first
+// attempt, so that the caller can decide whether partial locking is
+// acceptable. The returned status is never nil.
+func LockMemoryStatus() (*Status, error) {
+	return lockMemoryStatus()
+}
+
+// LockedBytes returns the amount of memory currently locked by the process.
+func LockedBytes() (uint64, error) {
+	return lockedBytes()
+}
+
+// Limit returns the maximum amount of memory that the process may lock, as
+// set by the memlock ulimit, or Unlimited.
+func Limit() (uint64, error) {
+	return limit()
+}
@@ -0,0 +1,61 @@
+package mlock
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// rlimitMemlock is RLIMIT_MEMLOCK, which is not defined by the unix package
+const rlimitMemlock = 8
+
+func lockedBytes() (uint64, error) {
+	f, err := os.Open("/proc/self/status")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	return parseLockedBytes(f)
+}
+
+// parseLockedBytes returns the value of the VmLck field of the contents of
+// /proc/<pid>/status, which is the amount of locked memory in kB
+func parseLockedBytes(r io.Reader) (uint64, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "VmLck:") {
+			continue
+		}
+
+		fields := strings.Fields(strings.TrimPrefix(line, "VmLck:"))
+		if len(fields) != 2 || fields[1] != "kB" {
+			return 0, ErrNotReported
+		}
+		kb, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return kb * 1024, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	return 0, ErrNotReported
+}
+
+func limit() (uint64, error) {
+	var rlim unix.Rlimit
+	if err := unix.Getrlimit(rlimitMemlock, &rlim); err != nil {
+		return 0, err
+	}
+
+	// RLIM_INFINITY is all ones on Linux, which is the same as Unlimited
+	return rlim.Cur, nil
+}
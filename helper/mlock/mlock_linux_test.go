@@ -0,0 +1,36 @@
+package mlock
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseLockedBytes(t *testing.T) {
+	cases := []struct {
+		Input    string
+		Expected uint64
+		Err      bool
+	}{
+		{"Name:\tvault\nVmPeak:\t  12345 kB\nVmLck:\t    2048 kB\nVmPin:\t       0 kB\n", 2048 * 1024, false},
+		{"Name:\tvault\nVmLck:\t       0 kB\n", 0, false},
+		{"Name:\tvault\nVmPeak:\t  12345 kB\n", 0, true},
+		{"VmLck:\t    abc kB\n", 0, true},
+		{"VmLck:\t    2048 MB\n", 0, true},
+	}
+
+	for i, tc := range cases {
+		actual, err := parseLockedBytes(strings.NewReader(tc.Input))
+		if (err != nil) != tc.Err {
+			t.Fatalf("%d: bad error: %v", i, err)
+		}
+		if actual != tc.Expected {
+			t.Fatalf("%d: expected %d, got %d", i, tc.Expected, actual)
+		}
+	}
+}
+
+func TestLimit(t *testing.T) {
+	if _, err := Limit(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
@@ -0,0 +1,11 @@
+// +build !linux
+
+package mlock
+
+func lockedBytes() (uint64, error) {
+	return 0, ErrNotReported
+}
+
+func limit() (uint64, error) {
+	return 0, ErrNotReported
+}
@@ -16,3 +16,22 @@ func lockMemory() error {
 	// Mlockall prevents all current and future pages from being swapped out.
 	return unix.Mlockall(syscall.MCL_CURRENT | syscall.MCL_FUTURE)
 }
+
+func lockMemoryStatus() (*Status, error) {
+	status := &Status{}
+	err := lockMemory()
+	if err == nil {
+		status.Current = true
+		status.Future = true
+	} else if unix.Mlockall(syscall.MCL_CURRENT) == nil {
+		// Memory mapped from now on may still be swapped out, but at least
+		// what has been mapped so far cannot be
+		status.Current = true
+	}
+
+	// Both values are informational, so don't fail if they are unavailable
+	status.LockedBytes, _ = lockedBytes()
+	status.Limit, _ = limit()
+
+	return status, err
+}
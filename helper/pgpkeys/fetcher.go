@@ -0,0 +1,184 @@
+package pgpkeys
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/keybase/go-crypto/openpgp"
+)
+
+const (
+	// EnvPGPKeyserver sets the keyserver used to resolve "hkp:" entries
+	EnvPGPKeyserver = "VAULT_PGP_KEYSERVER"
+
+	// EnvPGPKeyring sets the keyring file used to resolve "keyring:" entries
+	EnvPGPKeyring = "VAULT_PGP_KEYRING"
+
+	// The maximum size of a key fetched over the network
+	maxFetchedKeySize = 1024 * 1024
+)
+
+// KeyFetcher resolves entries of a PGP key list that start with a particular
+// prefix, such as "keybase:jefferai", into public keys
+type KeyFetcher interface {
+	// Prefix returns the prefix of the entries handled by the fetcher,
+	// including the trailing colon
+	Prefix() string
+
+	// FetchKeys returns the base64-encoded serialized public key for each
+	// of the given entries, keyed by the entry including its prefix. It
+	// returns an error if any key cannot be fetched.
+	FetchKeys(entries []string) (map[string]string, error)
+}
+
+// DefaultKeyFetchers returns the fetchers used by PubKeyFilesFlag: Keybase,
+// WKD, HKP using the keyserver set in VAULT_PGP_KEYSERVER, and the local
+// keyring file set in VAULT_PGP_KEYRING
+func DefaultKeyFetchers() []KeyFetcher {
+	return []KeyFetcher{
+		&KeybaseFetcher{},
+		&WKDFetcher{},
+		&HKPFetcher{
+			Keyserver: os.Getenv(EnvPGPKeyserver),
+		},
+		&KeyringFetcher{
+			Path: os.Getenv(EnvPGPKeyring),
+		},
+	}
+}
+
+// FetchPubkeys resolves every entry of input that has the prefix of one of
+// the fetchers. Each fetcher is called once with all of its entries. Entries
+// without a known prefix are ignored.
+func FetchPubkeys(input []string, fetchers []KeyFetcher) (map[string]string, error) {
+	byFetcher := make(map[KeyFetcher][]string)
+	for _, entry := range input {
+		if fetcher := fetcherFor(entry, fetchers); fetcher != nil {
+			byFetcher[fetcher] = append(byFetcher[fetcher], entry)
+		}
+	}
+
+	ret := make(map[string]string, len(input))
+	for _, fetcher := range fetchers {
+		entries := byFetcher[fetcher]
+		if len(entries) == 0 {
+			continue
+		}
+		keys, err := fetcher.FetchKeys(entries)
+		if err != nil {
+			return nil, err
+		}
+		for entry, key := range keys {
+			ret[entry] = key
+		}
+	}
+
+	return ret, nil
+}
+
+func fetcherFor(entry string, fetchers []KeyFetcher) KeyFetcher {
+	for _, fetcher := range fetchers {
+		if strings.HasPrefix(entry, fetcher.Prefix()) {
+			return fetcher
+		}
+	}
+	return nil
+}
+
+// fetchURL returns the body of a successful GET request to u
+func fetchURL(client *http.Client, u string) ([]byte, error) {
+	resp, err := client.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status %d", u, resp.StatusCode)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxFetchedKeySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxFetchedKeySize {
+		return nil, fmt.Errorf("%s returned more than %d bytes", u, maxFetchedKeySize)
+	}
+	return data, nil
+}
+
+// readKeyRing parses an armored keyring, falling back to a binary one
+func readKeyRing(data []byte) (openpgp.EntityList, error) {
+	entityList, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	if err == nil {
+		return entityList, nil
+	}
+	return openpgp.ReadKeyRing(bytes.NewReader(data))
+}
+
+// validateQuery checks that query, as given for an hkp: or keyring: entry,
+// is either an email address or a full fingerprint. Key IDs are not
+// accepted, since they are short enough for other keys to collide with.
+func validateQuery(query string) error {
+	if strings.Contains(query, "@") {
+		return nil
+	}
+	id := strings.TrimPrefix(strings.TrimPrefix(query, "0x"), "0X")
+	if _, err := hex.DecodeString(id); err != nil || len(id) != 40 {
+		return fmt.Errorf("%s is not an email address or a full 40 character fingerprint", query)
+	}
+	return nil
+}
+
+// selectEntity returns the only entity in the list matching query, which is
+// either an email address of one of its identities or the (0x-prefixed or
+// not) fingerprint of its primary key
+func selectEntity(entityList openpgp.EntityList, query string) (*openpgp.Entity, error) {
+	if err := validateQuery(query); err != nil {
+		return nil, err
+	}
+
+	var matches []*openpgp.Entity
+	for _, entity := range entityList {
+		if entity != nil && entityMatches(entity, query) {
+			matches = append(matches, entity)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("no key found for %s", query)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("more than one key found for %s", query)
+	}
+}
+
+func entityMatches(entity *openpgp.Entity, query string) bool {
+	if strings.Contains(query, "@") {
+		for _, identity := range entity.Identities {
+			if identity.UserId != nil && strings.EqualFold(identity.UserId.Email, query) {
+				return true
+			}
+		}
+		return false
+	}
+
+	id := strings.ToLower(strings.TrimPrefix(strings.TrimPrefix(query, "0x"), "0X"))
+	return hex.EncodeToString(entity.PrimaryKey.Fingerprint[:]) == id
+}
+
+func serializeEntity(entity *openpgp.Entity) (string, error) {
+	serializedEntity := bytes.NewBuffer(nil)
+	if err := entity.Serialize(serializedEntity); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(serializedEntity.Bytes()), nil
+}
@@ -0,0 +1,254 @@
+package pgpkeys
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/keybase/go-crypto/openpgp"
+	"github.com/keybase/go-crypto/openpgp/armor"
+	"github.com/keybase/go-crypto/openpgp/packet"
+)
+
+func testEntity(t *testing.T, email string) (*openpgp.Entity, []byte) {
+	entity, err := openpgp.NewEntity("Vault Test", "", email, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Serializing the private key creates the self-signatures
+	if err := entity.SerializePrivate(ioutil.Discard, nil); err != nil {
+		t.Fatal(err)
+	}
+	buf := bytes.NewBuffer(nil)
+	w, err := armor.Encode(buf, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	return entity, buf.Bytes()
+}
+
+func testFingerprint(t *testing.T, key string) string {
+	data, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entity, err := openpgp.ReadEntity(packet.NewReader(bytes.NewBuffer(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(entity.PrimaryKey.Fingerprint[:])
+}
+
+func TestWKDURLs(t *testing.T) {
+	// Example from the Web Key Directory draft
+	urls, err := wkdURLs("Joe.Doe@Example.ORG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{
+		"https://openpgpkey.example.org/.well-known/openpgpkey/example.org/hu/iy9q119eutrkn8s1mk4r39qejnbu3n5q?l=Joe.Doe",
+		"https://example.org/.well-known/openpgpkey/hu/iy9q119eutrkn8s1mk4r39qejnbu3n5q?l=Joe.Doe",
+	}
+	if len(urls) != 2 || urls[0] != exp[0] || urls[1] != exp[1] {
+		t.Fatalf("bad urls: %v", urls)
+	}
+
+	if _, err := wkdURLs("not-an-address"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestWKDFetcher(t *testing.T) {
+	entity, _ := testEntity(t, "user@example.com")
+	binaryKey := bytes.NewBuffer(nil)
+	if err := entity.Serialize(binaryKey); err != nil {
+		t.Fatal(err)
+	}
+
+	urls, err := wkdURLs("user@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	directPath := strings.TrimPrefix(strings.SplitN(urls[1], "?", 2)[0], "https://example.com")
+
+	// Only the direct method is served, so the advanced method must fail over
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != directPath || r.URL.Query().Get("l") != "user" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(binaryKey.Bytes())
+	}))
+	defer server.Close()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, server.Listener.Addr().String())
+			},
+		},
+	}
+
+	f := &WKDFetcher{Client: client}
+	keys, err := f.FetchKeys([]string{"wkd:user@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fp := testFingerprint(t, keys["wkd:user@example.com"]); fp != hex.EncodeToString(entity.PrimaryKey.Fingerprint[:]) {
+		t.Fatalf("bad fingerprint: %s", fp)
+	}
+
+	// The key must belong to the address
+	if _, err := f.FetchKeys([]string{"wkd:other@example.com"}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestHKPFetcher(t *testing.T) {
+	entity, armoredKey := testEntity(t, "user@example.com")
+	fingerprint := hex.EncodeToString(entity.PrimaryKey.Fingerprint[:])
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if r.URL.Path != "/pks/lookup" || q.Get("op") != "get" || q.Get("options") != "mr" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		// Like a real keyserver, match loosely
+		if q.Get("search") == "0x"+strings.Repeat("00", 20) {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(armoredKey)
+	}))
+	defer server.Close()
+
+	f := &HKPFetcher{Keyserver: server.URL}
+	entries := []string{"hkp:0x" + strings.ToUpper(fingerprint), "hkp:" + fingerprint, "hkp:user@example.com"}
+	keys, err := f.FetchKeys(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if fp := testFingerprint(t, keys[entry]); fp != fingerprint {
+			t.Fatalf("%s: bad fingerprint: %s", entry, fp)
+		}
+	}
+
+	// A key that does not match what was asked for is rejected
+	if _, err := f.FetchKeys([]string{"hkp:0x" + strings.Repeat("ab", 20)}); err == nil || !strings.Contains(err.Error(), "no key found") {
+		t.Fatalf("bad error: %v", err)
+	}
+	if _, err := f.FetchKeys([]string{"hkp:0x" + strings.Repeat("00", 20)}); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Fatalf("bad error: %v", err)
+	}
+
+	// Key IDs are rejected, even though they match the key
+	for _, entry := range []string{"hkp:0x" + fingerprint[24:], "hkp:" + fingerprint[32:]} {
+		if _, err := f.FetchKeys([]string{entry}); err == nil || !strings.Contains(err.Error(), "full 40 character fingerprint") {
+			t.Fatalf("%s: bad error: %v", entry, err)
+		}
+	}
+}
+
+func TestHKPBaseURL(t *testing.T) {
+	cases := map[string]string{
+		"":                          "https://keys.openpgp.org",
+		"hkp://keys.example.com":    "http://keys.example.com:11371",
+		"hkp://keys.example.com:80": "http://keys.example.com:80",
+		"hkps://keys.example.com/":  "https://keys.example.com",
+		"http://127.0.0.1:8080":     "http://127.0.0.1:8080",
+	}
+	for in, exp := range cases {
+		out, err := hkpBaseURL(in)
+		if err != nil {
+			t.Fatalf("%q: %v", in, err)
+		}
+		if out != exp {
+			t.Fatalf("%q: expected %q, got %q", in, exp, out)
+		}
+	}
+
+	if _, err := hkpBaseURL("ldap://keys.example.com"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestKeyringFetcher(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "vault-test")
+	if err != nil {
+		t.Fatalf("Error creating temporary directory: %s", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// A binary keyring of two of the test keys
+	keyring := bytes.NewBuffer(nil)
+	for _, key := range []string{pubKey1, pubKey2} {
+		data, err := base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyring.Write(data)
+	}
+	path := filepath.Join(tempDir, "pubring.gpg")
+	if err := ioutil.WriteFile(path, keyring.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fp1, fp2 := testFingerprint(t, pubKey1), testFingerprint(t, pubKey2)
+	entries := []string{"keyring:" + fp2, "keyring:0x" + strings.ToUpper(fp1)}
+
+	f := &KeyringFetcher{Path: path}
+	keys, err := f.FetchKeys(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if testFingerprint(t, keys[entries[0]]) != fp2 || testFingerprint(t, keys[entries[1]]) != fp1 {
+		t.Fatalf("bad keys: %v", keys)
+	}
+
+	if _, err := f.FetchKeys([]string{"keyring:user@example.com"}); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := f.FetchKeys([]string{"keyring:0x" + fp1[24:]}); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := (&KeyringFetcher{}).FetchKeys(entries); err == nil || !strings.Contains(err.Error(), EnvPGPKeyring) {
+		t.Fatalf("bad error: %v", err)
+	}
+
+	// The flag resolves keyring entries alongside files
+	pubFile := filepath.Join(tempDir, "pubkey3")
+	if err := ioutil.WriteFile(pubFile, []byte(pubKey3), 0644); err != nil {
+		t.Fatal(err)
+	}
+	oldKeyring := os.Getenv(EnvPGPKeyring)
+	os.Setenv(EnvPGPKeyring, path)
+	defer os.Setenv(EnvPGPKeyring, oldKeyring)
+
+	pkf := new(PubKeyFilesFlag)
+	if err := pkf.Set(strings.Join([]string{entries[0], pubFile, entries[1]}, ",")); err != nil {
+		t.Fatal(err)
+	}
+	if len(*pkf) != 3 {
+		t.Fatalf("bad number of keys: %d", len(*pkf))
+	}
+	if testFingerprint(t, (*pkf)[0]) != fp2 || (*pkf)[1] != pubKey3 || testFingerprint(t, (*pkf)[2]) != fp1 {
+		t.Fatalf("bad keys: %v", *pkf)
+	}
+}
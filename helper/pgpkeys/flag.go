@@ -26,18 +26,19 @@ func (p *PubKeyFilesFlag) Set(value string) error {
 
 	splitValues := strings.Split(value, ",")
 
-	keybaseMap, err := FetchKeybasePubkeys(splitValues)
+	fetchers := DefaultKeyFetchers()
+	keyMap, err := FetchPubkeys(splitValues, fetchers)
 	if err != nil {
 		return err
 	}
 
-	// Now go through the actual flag, and substitute in resolved keybase
-	// entries where appropriate
+	// Now go through the actual flag, and substitute in fetched keys, such
+	// as keybase entries, where appropriate
 	for _, keyfile := range splitValues {
-		if strings.HasPrefix(keyfile, kbPrefix) {
-			key := keybaseMap[keyfile]
+		if fetcher := fetcherFor(keyfile, fetchers); fetcher != nil {
+			key := keyMap[keyfile]
 			if key == "" {
-				return fmt.Errorf("key for keybase user %s was not found in the map", strings.TrimPrefix(keyfile, kbPrefix))
+				return fmt.Errorf("key for %s was not found in the map", keyfile)
 			}
 			*p = append(*p, key)
 			continue
@@ -0,0 +1,113 @@
+package pgpkeys
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/go-cleanhttp"
+)
+
+const (
+	hkpPrefix = "hkp:"
+
+	// DefaultKeyserver is the keyserver used by HKPFetcher if none is set
+	DefaultKeyserver = "hkps://keys.openpgp.org"
+)
+
+// HKPFetcher fetches keys for entries such as
+// "hkp:0x91A6E7F85D05C65630BEF18951852D87348FFC4C" or "hkp:user@example.com"
+// from an HKP keyserver. Lookups by fingerprint are preferred, since
+// keyservers do not verify email addresses. Key IDs are not accepted.
+type HKPFetcher struct {
+	// The keyserver, as an hkp://, hkps://, http:// or https:// URL.
+	// Defaults to DefaultKeyserver.
+	Keyserver string
+
+	// The client used for lookups. Defaults to a clean client.
+	Client *http.Client
+}
+
+func (f *HKPFetcher) Prefix() string {
+	return hkpPrefix
+}
+
+func (f *HKPFetcher) FetchKeys(entries []string) (map[string]string, error) {
+	base, err := hkpBaseURL(f.Keyserver)
+	if err != nil {
+		return nil, err
+	}
+	client := f.Client
+	if client == nil {
+		client = cleanhttp.DefaultClient()
+	}
+
+	ret := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		query := strings.TrimPrefix(entry, hkpPrefix)
+		if err := validateQuery(query); err != nil {
+			return nil, err
+		}
+		search := query
+		if !strings.Contains(query, "@") && !strings.HasPrefix(strings.ToLower(query), "0x") {
+			search = "0x" + query
+		}
+
+		u := base + "/pks/lookup?" + url.Values{
+			"op":      []string{"get"},
+			"options": []string{"mr"},
+			"search":  []string{search},
+		}.Encode()
+		data, err := fetchURL(client, u)
+		if err != nil {
+			return nil, fmt.Errorf("unable to fetch key for %s from keyserver: %s", query, err)
+		}
+		entityList, err := readKeyRing(data)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing key for %s from keyserver: %s", query, err)
+		}
+
+		// Keyservers match loosely, so check that the key is the one asked for
+		entity, err := selectEntity(entityList, query)
+		if err != nil {
+			return nil, err
+		}
+		ret[entry], err = serializeEntity(entity)
+		if err != nil {
+			return nil, fmt.Errorf("error serializing entity for %s: %s", query, err)
+		}
+	}
+
+	return ret, nil
+}
+
+// hkpBaseURL converts a keyserver address to the base URL for lookups
+func hkpBaseURL(keyserver string) (string, error) {
+	if keyserver == "" {
+		keyserver = DefaultKeyserver
+	}
+	u, err := url.Parse(keyserver)
+	if err != nil {
+		return "", fmt.Errorf("invalid keyserver %q: %s", keyserver, err)
+	}
+
+	switch u.Scheme {
+	case "hkp":
+		u.Scheme = "http"
+		if _, _, err := net.SplitHostPort(u.Host); err != nil {
+			u.Host += ":11371"
+		}
+	case "hkps":
+		u.Scheme = "https"
+	case "http", "https":
+	default:
+		return "", fmt.Errorf("invalid keyserver %q: unsupported scheme", keyserver)
+	}
+	if u.Host == "" {
+		return "", fmt.Errorf("invalid keyserver %q: missing host", keyserver)
+	}
+
+	return strings.TrimSuffix(u.String(), "/"), nil
+}
@@ -15,6 +15,18 @@ const (
 	kbPrefix = "keybase:"
 )
 
+// KeybaseFetcher fetches keys for entries such as "keybase:jefferai" from
+// Keybase
+type KeybaseFetcher struct{}
+
+func (f *KeybaseFetcher) Prefix() string {
+	return kbPrefix
+}
+
+func (f *KeybaseFetcher) FetchKeys(entries []string) (map[string]string, error) {
+	return FetchKeybasePubkeys(entries)
+}
+
 // FetchKeybasePubkeys fetches public keys from Keybase given a set of
 // usernames, which are derived from correctly formatted input entries. It
 // doesn't use their client code due to both the API and the fact that it is
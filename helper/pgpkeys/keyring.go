@@ -0,0 +1,54 @@
+package pgpkeys
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+const (
+	keyringPrefix = "keyring:"
+)
+
+// KeyringFetcher fetches keys for entries such as "keyring:user@example.com"
+// or "keyring:0x91A6E7F85D05C65630BEF18951852D87348FFC4C" from a local
+// keyring file, such as one exported with "gpg --export", without network
+// access
+type KeyringFetcher struct {
+	// The path to an armored or binary keyring file
+	Path string
+}
+
+func (f *KeyringFetcher) Prefix() string {
+	return keyringPrefix
+}
+
+func (f *KeyringFetcher) FetchKeys(entries []string) (map[string]string, error) {
+	if f.Path == "" {
+		return nil, fmt.Errorf("no keyring file set; set %s to the path of a keyring file", EnvPGPKeyring)
+	}
+
+	data, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	entityList, err := readKeyRing(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing keyring file %s: %s", f.Path, err)
+	}
+
+	ret := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		query := strings.TrimPrefix(entry, keyringPrefix)
+		entity, err := selectEntity(entityList, query)
+		if err != nil {
+			return nil, fmt.Errorf("error finding key in keyring file %s: %s", f.Path, err)
+		}
+		ret[entry], err = serializeEntity(entity)
+		if err != nil {
+			return nil, fmt.Errorf("error serializing entity for %s: %s", query, err)
+		}
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,117 @@
+package pgpkeys
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/hashicorp/go-cleanhttp"
+)
+
+const (
+	wkdPrefix = "wkd:"
+
+	zbase32Alphabet = "ybndrfg8ejkmcpqxot1uwisza345h769"
+)
+
+// WKDFetcher fetches keys for entries such as "wkd:user@example.com" from the
+// Web Key Directory of the address's domain, trying the advanced method and
+// then the direct method. The key must have an identity with the address.
+type WKDFetcher struct {
+	// The client used for lookups. Defaults to a clean client.
+	Client *http.Client
+}
+
+func (f *WKDFetcher) Prefix() string {
+	return wkdPrefix
+}
+
+func (f *WKDFetcher) FetchKeys(entries []string) (map[string]string, error) {
+	client := f.Client
+	if client == nil {
+		client = cleanhttp.DefaultClient()
+	}
+
+	ret := make(map[string]string, len(entries))
+	for _, entry := range entries {
+		email := strings.TrimPrefix(entry, wkdPrefix)
+		urls, err := wkdURLs(email)
+		if err != nil {
+			return nil, err
+		}
+
+		var errs []string
+		for _, u := range urls {
+			key, err := fetchWKDKey(client, u, email)
+			if err != nil {
+				errs = append(errs, err.Error())
+				continue
+			}
+			ret[entry] = key
+			break
+		}
+		if _, ok := ret[entry]; !ok {
+			return nil, fmt.Errorf("unable to fetch key for %s from WKD: %s", email, strings.Join(errs, "; "))
+		}
+	}
+
+	return ret, nil
+}
+
+func fetchWKDKey(client *http.Client, u, email string) (string, error) {
+	data, err := fetchURL(client, u)
+	if err != nil {
+		return "", err
+	}
+	entityList, err := readKeyRing(data)
+	if err != nil {
+		return "", fmt.Errorf("error parsing key from %s: %s", u, err)
+	}
+	entity, err := selectEntity(entityList, email)
+	if err != nil {
+		return "", err
+	}
+	return serializeEntity(entity)
+}
+
+// wkdURLs returns the URLs of the key for the address using the advanced
+// and the direct method
+func wkdURLs(email string) ([]string, error) {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 {
+		return nil, fmt.Errorf("invalid email address %q", email)
+	}
+	local, domain := email[:at], strings.ToLower(email[at+1:])
+
+	hash := sha1.Sum([]byte(strings.ToLower(local)))
+	hu := zbase32Encode(hash[:])
+	query := url.Values{"l": []string{local}}.Encode()
+
+	return []string{
+		fmt.Sprintf("https://openpgpkey.%s/.well-known/openpgpkey/%s/hu/%s?%s", domain, domain, hu, query),
+		fmt.Sprintf("https://%s/.well-known/openpgpkey/hu/%s?%s", domain, hu, query),
+	}, nil
+}
+
+// zbase32Encode encodes data with the human-oriented base32 encoding used by
+// WKD
+func zbase32Encode(data []byte) string {
+	var ret bytes.Buffer
+	var buf uint
+	var bits uint
+	for _, b := range data {
+		buf = buf<<8 | uint(b)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			ret.WriteByte(zbase32Alphabet[(buf>>bits)&0x1f])
+		}
+	}
+	if bits > 0 {
+		ret.WriteByte(zbase32Alphabet[(buf<<(5-bits))&0x1f])
+	}
+	return ret.String()
+}
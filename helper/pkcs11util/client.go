@@ -0,0 +1,651 @@
+// +build cgo,!windows
+
+package pkcs11util
+
+/*
+#cgo linux LDFLAGS: -ldl
+
+#include <dlfcn.h>
+#include <stdlib.h>
+#include <string.h>
+
+// The subset of the PKCS#11 v2.40 types used here, declared locally so that
+// no vendor header is needed
+
+typedef unsigned char CK_BYTE;
+typedef unsigned long CK_ULONG;
+
+typedef struct {
+	CK_BYTE major;
+	CK_BYTE minor;
+} CK_VERSION;
+
+typedef struct {
+	CK_BYTE label[32];
+	CK_BYTE manufacturerID[32];
+	CK_BYTE model[16];
+	CK_BYTE serialNumber[16];
+	CK_ULONG flags;
+	CK_ULONG ulMaxSessionCount;
+	CK_ULONG ulSessionCount;
+	CK_ULONG ulMaxRwSessionCount;
+	CK_ULONG ulRwSessionCount;
+	CK_ULONG ulMaxPinLen;
+	CK_ULONG ulMinPinLen;
+	CK_ULONG ulTotalPublicMemory;
+	CK_ULONG ulFreePublicMemory;
+	CK_ULONG ulTotalPrivateMemory;
+	CK_ULONG ulFreePrivateMemory;
+	CK_VERSION hardwareVersion;
+	CK_VERSION firmwareVersion;
+	CK_BYTE utcTime[16];
+} CK_TOKEN_INFO;
+
+typedef struct {
+	CK_ULONG type;
+	void *pValue;
+	CK_ULONG ulValueLen;
+} CK_ATTRIBUTE;
+
+typedef struct {
+	CK_ULONG mechanism;
+	void *pParameter;
+	CK_ULONG ulParameterLen;
+} CK_MECHANISM;
+
+typedef struct {
+	CK_BYTE *pIv;
+	CK_ULONG ulIvLen;
+	CK_ULONG ulIvBits;
+	CK_BYTE *pAAD;
+	CK_ULONG ulAADLen;
+	CK_ULONG ulTagBits;
+} CK_GCM_PARAMS;
+
+typedef struct {
+	void *CreateMutex;
+	void *DestroyMutex;
+	void *LockMutex;
+	void *UnlockMutex;
+	CK_ULONG flags;
+	void *pReserved;
+} CK_C_INITIALIZE_ARGS;
+
+typedef struct {
+	CK_VERSION version;
+	CK_ULONG (*C_Initialize)(void *);
+	CK_ULONG (*C_Finalize)(void *);
+	void *C_GetInfo;
+	void *C_GetFunctionList;
+	CK_ULONG (*C_GetSlotList)(CK_BYTE, CK_ULONG *, CK_ULONG *);
+	void *C_GetSlotInfo;
+	CK_ULONG (*C_GetTokenInfo)(CK_ULONG, CK_TOKEN_INFO *);
+	void *C_GetMechanismList;
+	void *C_GetMechanismInfo;
+	void *C_InitToken;
+	void *C_InitPIN;
+	void *C_SetPIN;
+	CK_ULONG (*C_OpenSession)(CK_ULONG, CK_ULONG, void *, void *, CK_ULONG *);
+	CK_ULONG (*C_CloseSession)(CK_ULONG);
+	void *C_CloseAllSessions;
+	void *C_GetSessionInfo;
+	void *C_GetOperationState;
+	void *C_SetOperationState;
+	CK_ULONG (*C_Login)(CK_ULONG, CK_ULONG, CK_BYTE *, CK_ULONG);
+	void *C_Logout;
+	void *C_CreateObject;
+	void *C_CopyObject;
+	void *C_DestroyObject;
+	void *C_GetObjectSize;
+	void *C_GetAttributeValue;
+	void *C_SetAttributeValue;
+	CK_ULONG (*C_FindObjectsInit)(CK_ULONG, CK_ATTRIBUTE *, CK_ULONG);
+	CK_ULONG (*C_FindObjects)(CK_ULONG, CK_ULONG *, CK_ULONG, CK_ULONG *);
+	CK_ULONG (*C_FindObjectsFinal)(CK_ULONG);
+	CK_ULONG (*C_EncryptInit)(CK_ULONG, CK_MECHANISM *, CK_ULONG);
+	CK_ULONG (*C_Encrypt)(CK_ULONG, CK_BYTE *, CK_ULONG, CK_BYTE *, CK_ULONG *);
+	void *C_EncryptUpdate;
+	void *C_EncryptFinal;
+	CK_ULONG (*C_DecryptInit)(CK_ULONG, CK_MECHANISM *, CK_ULONG);
+	CK_ULONG (*C_Decrypt)(CK_ULONG, CK_BYTE *, CK_ULONG, CK_BYTE *, CK_ULONG *);
+	void *C_DecryptUpdate;
+	void *C_DecryptFinal;
+	void *C_DigestInit;
+	void *C_Digest;
+	void *C_DigestUpdate;
+	void *C_DigestKey;
+	void *C_DigestFinal;
+	void *C_SignInit;
+	void *C_Sign;
+	void *C_SignUpdate;
+	void *C_SignFinal;
+	void *C_SignRecoverInit;
+	void *C_SignRecover;
+	void *C_VerifyInit;
+	void *C_Verify;
+	void *C_VerifyUpdate;
+	void *C_VerifyFinal;
+	void *C_VerifyRecoverInit;
+	void *C_VerifyRecover;
+	void *C_DigestEncryptUpdate;
+	void *C_DecryptDigestUpdate;
+	void *C_SignEncryptUpdate;
+	void *C_DecryptVerifyUpdate;
+	CK_ULONG (*C_GenerateKey)(CK_ULONG, CK_MECHANISM *, CK_ATTRIBUTE *, CK_ULONG, CK_ULONG *);
+} CK_FUNCTION_LIST;
+
+#define CKF_RW_SESSION     0x2
+#define CKF_SERIAL_SESSION 0x4
+#define CKF_OS_LOCKING_OK  0x2
+#define CKU_USER           1
+
+static void *ck_open(const char *path, CK_FUNCTION_LIST **f, const char **err) {
+	void *handle = dlopen(path, RTLD_NOW | RTLD_LOCAL);
+	if (handle == NULL) {
+		*err = dlerror();
+		return NULL;
+	}
+	CK_ULONG (*getFunctionList)(CK_FUNCTION_LIST **) = dlsym(handle, "C_GetFunctionList");
+	if (getFunctionList == NULL || getFunctionList(f) != 0 || *f == NULL) {
+		*err = "library does not provide a PKCS#11 function list";
+		dlclose(handle);
+		return NULL;
+	}
+	return handle;
+}
+
+static void ck_close(void *handle) {
+	dlclose(handle);
+}
+
+static CK_ULONG ck_initialize(CK_FUNCTION_LIST *f) {
+	CK_C_INITIALIZE_ARGS args;
+	memset(&args, 0, sizeof(args));
+	args.flags = CKF_OS_LOCKING_OK;
+	return f->C_Initialize(&args);
+}
+
+static CK_ULONG ck_finalize(CK_FUNCTION_LIST *f) {
+	return f->C_Finalize(NULL);
+}
+
+static CK_ULONG ck_get_slot_list(CK_FUNCTION_LIST *f, CK_ULONG *slots, CK_ULONG *count) {
+	return f->C_GetSlotList(1, slots, count);
+}
+
+static CK_ULONG ck_get_token_info(CK_FUNCTION_LIST *f, CK_ULONG slot, CK_TOKEN_INFO *info) {
+	return f->C_GetTokenInfo(slot, info);
+}
+
+static CK_ULONG ck_open_session(CK_FUNCTION_LIST *f, CK_ULONG slot, CK_ULONG *session) {
+	return f->C_OpenSession(slot, CKF_SERIAL_SESSION | CKF_RW_SESSION, NULL, NULL, session);
+}
+
+static CK_ULONG ck_close_session(CK_FUNCTION_LIST *f, CK_ULONG session) {
+	return f->C_CloseSession(session);
+}
+
+static CK_ULONG ck_login(CK_FUNCTION_LIST *f, CK_ULONG session, CK_BYTE *pin, CK_ULONG len) {
+	return f->C_Login(session, CKU_USER, pin, len);
+}
+
+static CK_ULONG ck_find_objects(CK_FUNCTION_LIST *f, CK_ULONG session, CK_ATTRIBUTE *template, CK_ULONG count, CK_ULONG *objects, CK_ULONG max, CK_ULONG *found) {
+	CK_ULONG rv = f->C_FindObjectsInit(session, template, count);
+	if (rv != 0) {
+		return rv;
+	}
+	rv = f->C_FindObjects(session, objects, max, found);
+	CK_ULONG rv2 = f->C_FindObjectsFinal(session);
+	return rv != 0 ? rv : rv2;
+}
+
+static CK_ULONG ck_generate_key(CK_FUNCTION_LIST *f, CK_ULONG session, CK_ULONG mechanism, CK_ATTRIBUTE *template, CK_ULONG count, CK_ULONG *key) {
+	CK_MECHANISM mech = { mechanism, NULL, 0 };
+	return f->C_GenerateKey(session, &mech, template, count, key);
+}
+
+static CK_ULONG ck_crypt(CK_FUNCTION_LIST *f, int encrypt, CK_ULONG session, CK_ULONG key, CK_ULONG mechanism, int gcm,
+		CK_BYTE *iv, CK_ULONG ivLen, CK_BYTE *in, CK_ULONG inLen, CK_BYTE *out, CK_ULONG *outLen) {
+	CK_GCM_PARAMS params;
+	CK_MECHANISM mech;
+	memset(&params, 0, sizeof(params));
+	mech.mechanism = mechanism;
+	if (gcm) {
+		params.pIv = iv;
+		params.ulIvLen = ivLen;
+		params.ulIvBits = ivLen * 8;
+		params.ulTagBits = 128;
+		mech.pParameter = &params;
+		mech.ulParameterLen = sizeof(params);
+	} else {
+		mech.pParameter = iv;
+		mech.ulParameterLen = ivLen;
+	}
+
+	CK_ULONG rv;
+	if (encrypt) {
+		rv = f->C_EncryptInit(session, &mech, key);
+		if (rv != 0) {
+			return rv;
+		}
+		return f->C_Encrypt(session, in, inLen, out, outLen);
+	}
+	rv = f->C_DecryptInit(session, &mech, key);
+	if (rv != 0) {
+		return rv;
+	}
+	return f->C_Decrypt(session, in, inLen, out, outLen);
+}
+
+static CK_ATTRIBUTE *ck_new_template(int count) {
+	return calloc(count, sizeof(CK_ATTRIBUTE));
+}
+
+static void ck_set_attribute(CK_ATTRIBUTE *template, int i, CK_ULONG type, void *value, CK_ULONG len) {
+	template[i].type = type;
+	template[i].pValue = value;
+	template[i].ulValueLen = len;
+}
+*/
+import "C"
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+const (
+	ckoSecretKey = 0x4
+	ckkAES       = 0x1F
+
+	ckaClass       = 0x0
+	ckaToken       = 0x1
+	ckaPrivate     = 0x2
+	ckaLabel       = 0x3
+	ckaKeyType     = 0x100
+	ckaSensitive   = 0x103
+	ckaEncrypt     = 0x104
+	ckaDecrypt     = 0x105
+	ckaValueLen    = 0x161
+	ckaExtractable = 0x162
+
+	ckmAESKeyGen = 0x1080
+	ckmAESCBCPad = 0x1085
+	ckmAESGCM    = 0x1087
+
+	ckrUserAlreadyLoggedIn        = 0x100
+	ckrCryptokiAlreadyInitialized = 0x191
+)
+
+// Client holds a session with a PKCS#11 token, opening it again if it is
+// lost. It is safe for concurrent use.
+type Client struct {
+	config *Config
+
+	l       sync.Mutex
+	handle  unsafe.Pointer
+	funcs   *C.CK_FUNCTION_LIST
+	slot    C.CK_ULONG
+	session C.CK_ULONG
+	open    bool
+}
+
+// NewClient loads and initializes the PKCS#11 library. The session with
+// the token is opened on first use.
+func NewClient(config *Config) (*Client, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	path := C.CString(config.Lib)
+	defer C.free(unsafe.Pointer(path))
+
+	var funcs *C.CK_FUNCTION_LIST
+	var cerr *C.char
+	handle := C.ck_open(path, &funcs, &cerr)
+	if handle == nil {
+		return nil, fmt.Errorf("error loading PKCS#11 library %s: %s", config.Lib, C.GoString(cerr))
+	}
+
+	if rv := C.ck_initialize(funcs); rv != 0 && rv != ckrCryptokiAlreadyInitialized {
+		C.ck_close(handle)
+		return nil, fmt.Errorf("error initializing PKCS#11 library: %v", Error(rv))
+	}
+
+	return &Client{
+		config: config,
+		handle: handle,
+		funcs:  funcs,
+	}, nil
+}
+
+// Close closes the session and unloads the library
+func (c *Client) Close() error {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	c.closeSession()
+	if c.funcs != nil {
+		C.ck_finalize(c.funcs)
+		C.ck_close(c.handle)
+		c.funcs = nil
+	}
+	return nil
+}
+
+func (c *Client) closeSession() {
+	if c.open {
+		C.ck_close_session(c.funcs, c.session)
+		c.open = false
+	}
+}
+
+// findSlot returns the slot of the token with the configured label
+func (c *Client) findSlot() (C.CK_ULONG, error) {
+	if c.config.TokenLabel == "" {
+		return C.CK_ULONG(c.config.Slot), nil
+	}
+
+	var count C.CK_ULONG
+	if rv := C.ck_get_slot_list(c.funcs, nil, &count); rv != 0 {
+		return 0, fmt.Errorf("error listing slots: %v", Error(rv))
+	}
+	if count == 0 {
+		return 0, fmt.Errorf("no tokens present")
+	}
+	slots := make([]C.CK_ULONG, count)
+	if rv := C.ck_get_slot_list(c.funcs, &slots[0], &count); rv != 0 {
+		return 0, fmt.Errorf("error listing slots: %v", Error(rv))
+	}
+
+	for _, slot := range slots[:count] {
+		var info C.CK_TOKEN_INFO
+		if rv := C.ck_get_token_info(c.funcs, slot, &info); rv != 0 {
+			continue
+		}
+		if paddedString(info.label[:]) == c.config.TokenLabel {
+			return slot, nil
+		}
+	}
+	return 0, fmt.Errorf("no token with label %q", c.config.TokenLabel)
+}
+
+// withSession runs fn with a logged in session, opening it again and
+// retrying once if it was lost
+func (c *Client) withSession(fn func(C.CK_ULONG) error) error {
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	if c.funcs == nil {
+		return fmt.Errorf("PKCS#11 client is closed")
+	}
+
+	for attempt := 0; ; attempt++ {
+		if !c.open {
+			if err := c.openSession(); err != nil {
+				return err
+			}
+		}
+
+		err := fn(c.session)
+		if e, ok := err.(Error); ok && e.sessionLost() && attempt == 0 {
+			c.closeSession()
+			continue
+		}
+		return err
+	}
+}
+
+func (c *Client) openSession() error {
+	slot, err := c.findSlot()
+	if err != nil {
+		return err
+	}
+
+	var session C.CK_ULONG
+	if rv := C.ck_open_session(c.funcs, slot, &session); rv != 0 {
+		return fmt.Errorf("error opening session: %v", Error(rv))
+	}
+
+	pin := []byte(c.config.PIN)
+	rv := C.ck_login(c.funcs, session, (*C.CK_BYTE)(unsafe.Pointer(&pin[0])), C.CK_ULONG(len(pin)))
+	if rv != 0 && rv != ckrUserAlreadyLoggedIn {
+		C.ck_close_session(c.funcs, session)
+		return fmt.Errorf("error logging in: %v", Error(rv))
+	}
+
+	c.slot = slot
+	c.session = session
+	c.open = true
+	return nil
+}
+
+// template is a PKCS#11 attribute template in C memory, since the
+// attributes point to their values
+type template struct {
+	attrs  *C.CK_ATTRIBUTE
+	values []unsafe.Pointer
+	count  int
+}
+
+func newTemplate(count int) *template {
+	return &template{
+		attrs: C.ck_new_template(C.int(count)),
+	}
+}
+
+func (t *template) add(typ uint, value []byte) {
+	v := C.CBytes(value)
+	t.values = append(t.values, v)
+	C.ck_set_attribute(t.attrs, C.int(t.count), C.CK_ULONG(typ), v, C.CK_ULONG(len(value)))
+	t.count++
+}
+
+func (t *template) addBool(typ uint, value bool) {
+	if value {
+		t.add(typ, []byte{1})
+	} else {
+		t.add(typ, []byte{0})
+	}
+}
+
+func (t *template) addULong(typ uint, value uint) {
+	v := C.CK_ULONG(value)
+	t.add(typ, C.GoBytes(unsafe.Pointer(&v), C.int(unsafe.Sizeof(v))))
+}
+
+func (t *template) free() {
+	for _, v := range t.values {
+		C.free(v)
+	}
+	C.free(unsafe.Pointer(t.attrs))
+}
+
+func (c *Client) findKey(session C.CK_ULONG, label string) (C.CK_ULONG, bool, error) {
+	t := newTemplate(2)
+	defer t.free()
+	t.addULong(ckaClass, ckoSecretKey)
+	t.add(ckaLabel, []byte(label))
+
+	var objects [2]C.CK_ULONG
+	var found C.CK_ULONG
+	if rv := C.ck_find_objects(c.funcs, session, t.attrs, C.CK_ULONG(t.count), &objects[0], 2, &found); rv != 0 {
+		return 0, false, Error(rv)
+	}
+	switch found {
+	case 0:
+		return 0, false, nil
+	case 1:
+		return objects[0], true, nil
+	default:
+		return 0, false, fmt.Errorf("more than one key with label %q", label)
+	}
+}
+
+// KeyExists returns whether the token holds a secret key with the label
+func (c *Client) KeyExists(label string) (bool, error) {
+	var exists bool
+	err := c.withSession(func(session C.CK_ULONG) error {
+		var err error
+		_, exists, err = c.findKey(session, label)
+		return err
+	})
+	return exists, err
+}
+
+// GenerateKey generates a 256-bit AES key with the label inside the token.
+// The key cannot be extracted from the token.
+func (c *Client) GenerateKey(label string) error {
+	return c.withSession(func(session C.CK_ULONG) error {
+		if _, exists, err := c.findKey(session, label); err != nil {
+			return err
+		} else if exists {
+			return fmt.Errorf("a key with label %q already exists", label)
+		}
+
+		t := newTemplate(10)
+		defer t.free()
+		t.addULong(ckaClass, ckoSecretKey)
+		t.addULong(ckaKeyType, ckkAES)
+		t.addULong(ckaValueLen, 32)
+		t.add(ckaLabel, []byte(label))
+		t.addBool(ckaToken, true)
+		t.addBool(ckaPrivate, true)
+		t.addBool(ckaSensitive, true)
+		t.addBool(ckaExtractable, false)
+		t.addBool(ckaEncrypt, true)
+		t.addBool(ckaDecrypt, true)
+
+		var key C.CK_ULONG
+		if rv := C.ck_generate_key(c.funcs, session, ckmAESKeyGen, t.attrs, C.CK_ULONG(t.count), &key); rv != 0 {
+			return Error(rv)
+		}
+		return nil
+	})
+}
+
+func (c *Client) mechanism() (C.CK_ULONG, C.int, int) {
+	if c.config.Mechanism == MechanismAESCBCPad {
+		return ckmAESCBCPad, 0, 16
+	}
+	return ckmAESGCM, 1, 12
+}
+
+// Encrypt encrypts the plaintext with the key with the label, returning
+// the IV followed by the ciphertext
+func (c *Client) Encrypt(label string, plaintext []byte) ([]byte, error) {
+	mech, gcm, ivLen := c.mechanism()
+
+	iv := make([]byte, ivLen)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	var out []byte
+	err := c.withSession(func(session C.CK_ULONG) error {
+		key, exists, err := c.findKey(session, label)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("no key with label %q", label)
+		}
+
+		cin := C.CBytes(plaintext)
+		defer C.free(cin)
+		civ := C.CBytes(iv)
+		defer C.free(civ)
+		outLen := C.CK_ULONG(len(plaintext) + 32)
+		cout := C.malloc(C.size_t(outLen))
+		defer C.free(cout)
+
+		rv := C.ck_crypt(c.funcs, 1, session, key, mech, gcm,
+			(*C.CK_BYTE)(civ), C.CK_ULONG(ivLen),
+			(*C.CK_BYTE)(cin), C.CK_ULONG(len(plaintext)),
+			(*C.CK_BYTE)(cout), &outLen)
+		if rv != 0 {
+			return Error(rv)
+		}
+		out = append(iv, C.GoBytes(cout, C.int(outLen))...)
+		return nil
+	})
+	return out, err
+}
+
+// Decrypt decrypts data encrypted by Encrypt with the key with the label
+func (c *Client) Decrypt(label string, ciphertext []byte) ([]byte, error) {
+	mech, gcm, ivLen := c.mechanism()
+	if len(ciphertext) <= ivLen {
+		return nil, fmt.Errorf("ciphertext is too short")
+	}
+
+	var out []byte
+	err := c.withSession(func(session C.CK_ULONG) error {
+		key, exists, err := c.findKey(session, label)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("no key with label %q", label)
+		}
+
+		civ := C.CBytes(ciphertext[:ivLen])
+		defer C.free(civ)
+		cin := C.CBytes(ciphertext[ivLen:])
+		defer C.free(cin)
+		outLen := C.CK_ULONG(len(ciphertext))
+		cout := C.malloc(C.size_t(outLen))
+		defer C.free(cout)
+
+		rv := C.ck_crypt(c.funcs, 0, session, key, mech, gcm,
+			(*C.CK_BYTE)(civ), C.CK_ULONG(ivLen),
+			(*C.CK_BYTE)(cin), C.CK_ULONG(len(ciphertext)-ivLen),
+			(*C.CK_BYTE)(cout), &outLen)
+		if rv != 0 {
+			return Error(rv)
+		}
+		out = C.GoBytes(cout, C.int(outLen))
+		return nil
+	})
+	return out, err
+}
+
+// Status describes the token and opens a session with it if there is none
+func (c *Client) Status() *Status {
+	status := &Status{
+		Lib:        c.config.Lib,
+		Slot:       c.config.Slot,
+		TokenLabel: c.config.TokenLabel,
+	}
+
+	err := c.withSession(func(session C.CK_ULONG) error {
+		var info C.CK_TOKEN_INFO
+		if rv := C.ck_get_token_info(c.funcs, c.slot, &info); rv != 0 {
+			return Error(rv)
+		}
+		status.Slot = uint(c.slot)
+		status.TokenLabel = paddedString(info.label[:])
+		status.Manufacturer = paddedString(info.manufacturerID[:])
+		status.Model = paddedString(info.model[:])
+		status.SerialNumber = paddedString(info.serialNumber[:])
+		return nil
+	})
+	if err != nil {
+		status.Error = err.Error()
+	} else {
+		status.Connected = true
+	}
+	return status
+}
+
+// paddedString converts a blank padded PKCS#11 string
+func paddedString(b []C.CK_BYTE) string {
+	buf := make([]byte, len(b))
+	for i, c := range b {
+		buf[i] = byte(c)
+	}
+	return strings.TrimRight(string(buf), " \x00")
+}
@@ -0,0 +1,41 @@
+// +build !cgo windows
+
+package pkcs11util
+
+import (
+	"fmt"
+)
+
+// Client holds a session with a PKCS#11 token. PKCS#11 support requires
+// cgo, and is not available on Windows.
+type Client struct{}
+
+var errUnsupported = fmt.Errorf("PKCS#11 support requires a build of Vault with cgo enabled")
+
+func NewClient(config *Config) (*Client, error) {
+	return nil, errUnsupported
+}
+
+func (c *Client) Close() error {
+	return errUnsupported
+}
+
+func (c *Client) KeyExists(label string) (bool, error) {
+	return false, errUnsupported
+}
+
+func (c *Client) GenerateKey(label string) error {
+	return errUnsupported
+}
+
+func (c *Client) Encrypt(label string, plaintext []byte) ([]byte, error) {
+	return nil, errUnsupported
+}
+
+func (c *Client) Decrypt(label string, ciphertext []byte) ([]byte, error) {
+	return nil, errUnsupported
+}
+
+func (c *Client) Status() *Status {
+	return &Status{Error: errUnsupported.Error()}
+}
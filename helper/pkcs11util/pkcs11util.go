@@ -0,0 +1,117 @@
+package pkcs11util
+
+import (
+	"fmt"
+)
+
+const (
+	// MechanismAESGCM encrypts with AES-GCM and a random 96-bit IV. It is
+	// the default mechanism.
+	MechanismAESGCM = "CKM_AES_GCM"
+
+	// MechanismAESCBCPad encrypts with AES-CBC, PKCS#7 padding and a random
+	// IV, for HSMs that do not support GCM
+	MechanismAESCBCPad = "CKM_AES_CBC_PAD"
+)
+
+// Config configures the connection to a PKCS#11 token
+type Config struct {
+	// Lib is the path to the PKCS#11 library of the HSM
+	Lib string
+
+	// Slot is the ID of the slot of the token. If TokenLabel is set, the
+	// slot of the token with that label is used instead.
+	Slot       uint
+	TokenLabel string
+
+	// PIN is the PIN of the user of the token
+	PIN string
+
+	// Mechanism is the encryption mechanism, MechanismAESGCM or
+	// MechanismAESCBCPad. It defaults to MechanismAESGCM.
+	Mechanism string
+}
+
+// Validate checks the configuration and sets defaults
+func (c *Config) Validate() error {
+	if c.Lib == "" {
+		return fmt.Errorf("the path to the PKCS#11 library must be set")
+	}
+	if c.PIN == "" {
+		return fmt.Errorf("the PIN must be set")
+	}
+	switch c.Mechanism {
+	case "":
+		c.Mechanism = MechanismAESGCM
+	case MechanismAESGCM, MechanismAESCBCPad:
+	default:
+		return fmt.Errorf("unsupported mechanism %q", c.Mechanism)
+	}
+	return nil
+}
+
+// Status describes the token and whether a session with it could be opened
+type Status struct {
+	Lib          string
+	Slot         uint
+	TokenLabel   string
+	Manufacturer string
+	Model        string
+	SerialNumber string
+	Connected    bool
+	Error        string
+}
+
+// Error is a PKCS#11 return value other than CKR_OK
+type Error uint
+
+var errorNames = map[Error]string{
+	0x00000001: "CKR_CANCEL",
+	0x00000002: "CKR_HOST_MEMORY",
+	0x00000003: "CKR_SLOT_ID_INVALID",
+	0x00000005: "CKR_GENERAL_ERROR",
+	0x00000006: "CKR_FUNCTION_FAILED",
+	0x00000007: "CKR_ARGUMENTS_BAD",
+	0x00000030: "CKR_DEVICE_ERROR",
+	0x00000031: "CKR_DEVICE_MEMORY",
+	0x00000032: "CKR_DEVICE_REMOVED",
+	0x00000040: "CKR_ENCRYPTED_DATA_INVALID",
+	0x00000041: "CKR_ENCRYPTED_DATA_LEN_RANGE",
+	0x00000060: "CKR_KEY_HANDLE_INVALID",
+	0x00000068: "CKR_KEY_FUNCTION_NOT_PERMITTED",
+	0x00000070: "CKR_MECHANISM_INVALID",
+	0x00000071: "CKR_MECHANISM_PARAM_INVALID",
+	0x000000A0: "CKR_PIN_INCORRECT",
+	0x000000A4: "CKR_PIN_LOCKED",
+	0x000000B0: "CKR_SESSION_CLOSED",
+	0x000000B1: "CKR_SESSION_COUNT",
+	0x000000B3: "CKR_SESSION_HANDLE_INVALID",
+	0x000000C0: "CKR_SIGNATURE_INVALID",
+	0x000000D0: "CKR_TEMPLATE_INCOMPLETE",
+	0x000000D1: "CKR_TEMPLATE_INCONSISTENT",
+	0x000000E0: "CKR_TOKEN_NOT_PRESENT",
+	0x000000E1: "CKR_TOKEN_NOT_RECOGNIZED",
+	0x00000100: "CKR_USER_ALREADY_LOGGED_IN",
+	0x00000101: "CKR_USER_NOT_LOGGED_IN",
+	0x00000102: "CKR_USER_PIN_NOT_INITIALIZED",
+	0x00000150: "CKR_BUFFER_TOO_SMALL",
+	0x00000190: "CKR_CRYPTOKI_NOT_INITIALIZED",
+	0x00000191: "CKR_CRYPTOKI_ALREADY_INITIALIZED",
+}
+
+func (e Error) Error() string {
+	if name, ok := errorNames[e]; ok {
+		return name
+	}
+	return fmt.Sprintf("CKR_0x%08X", uint(e))
+}
+
+// sessionLost returns whether the error means that the session must be
+// opened again, such as after the HSM restarted
+func (e Error) sessionLost() bool {
+	switch e {
+	case 0x30, 0x32, 0xB0, 0xB3, 0xE0, 0x101:
+		return true
+	}
+	return false
+}
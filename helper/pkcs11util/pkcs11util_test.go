@@ -0,0 +1,95 @@
+package pkcs11util
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	c := &Config{Lib: "/usr/lib/libhsm.so", PIN: "1234"}
+	if err := c.Validate(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if c.Mechanism != MechanismAESGCM {
+		t.Fatalf("bad: %s", c.Mechanism)
+	}
+
+	for _, c := range []*Config{
+		{PIN: "1234"},
+		{Lib: "/usr/lib/libhsm.so"},
+		{Lib: "/usr/lib/libhsm.so", PIN: "1234", Mechanism: "CKM_DES"},
+	} {
+		if err := c.Validate(); err == nil {
+			t.Fatalf("expected error: %#v", c)
+		}
+	}
+}
+
+func TestError(t *testing.T) {
+	if s := Error(0xA0).Error(); s != "CKR_PIN_INCORRECT" {
+		t.Fatalf("bad: %s", s)
+	}
+	if s := Error(0x80000001).Error(); s != "CKR_0x80000001" {
+		t.Fatalf("bad: %s", s)
+	}
+	if !Error(0xB3).sessionLost() || Error(0xA0).sessionLost() {
+		t.Fatal("bad")
+	}
+}
+
+// TestClient runs against a real token, such as one of SoftHSM, configured
+// with PKCS11_LIB, PKCS11_SLOT and PKCS11_PIN
+func TestClient(t *testing.T) {
+	lib := os.Getenv("PKCS11_LIB")
+	if lib == "" {
+		t.Skip("PKCS11_LIB not set")
+	}
+	slot, _ := strconv.Atoi(os.Getenv("PKCS11_SLOT"))
+
+	for _, mechanism := range []string{MechanismAESGCM, MechanismAESCBCPad} {
+		client, err := NewClient(&Config{
+			Lib:       lib,
+			Slot:      uint(slot),
+			PIN:       os.Getenv("PKCS11_PIN"),
+			Mechanism: mechanism,
+		})
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+
+		status := client.Status()
+		if !status.Connected {
+			t.Fatalf("bad: %#v", status)
+		}
+
+		label := "vault-test-" + mechanism
+		exists, err := client.KeyExists(label)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if !exists {
+			if err := client.GenerateKey(label); err != nil {
+				t.Fatalf("err: %v", err)
+			}
+		}
+
+		plaintext := []byte("vault master key")
+		ciphertext, err := client.Encrypt(label, plaintext)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		out, err := client.Decrypt(label, ciphertext)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if !bytes.Equal(out, plaintext) {
+			t.Fatalf("bad: %q", out)
+		}
+
+		if err := client.Close(); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+}
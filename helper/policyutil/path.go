@@ -0,0 +1,156 @@
+package policyutil
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// SegmentWildcard is a path segment that matches exactly one segment
+	SegmentWildcard = "+"
+
+	// GlobWildcard at the end of a path matches any suffix
+	GlobWildcard = "*"
+)
+
+// PathPattern is a parsed ACL path. A path may contain segments consisting
+// only of SegmentWildcard, such as "secret/+/config", which match any single
+// non-empty segment, and may end in GlobWildcard, which matches any suffix,
+// such as "secret/+/config*".
+type PathPattern struct {
+	// The path as given, without a leading slash
+	Path string
+
+	// The path split on slashes, without the glob
+	segments []string
+	glob     bool
+
+	// The number of segment wildcards, and the index in Path of the first
+	// wildcard of either kind, or len(Path) if there is none
+	wildcards     int
+	firstWildcard int
+}
+
+// ParsePathPattern parses a path, which may contain segment wildcards and a
+// trailing glob
+func ParsePathPattern(path string) (*PathPattern, error) {
+	path = strings.TrimPrefix(path, "/")
+	p := &PathPattern{
+		Path:          path,
+		firstWildcard: len(path),
+	}
+
+	trimmed := path
+	if strings.HasSuffix(trimmed, GlobWildcard) {
+		trimmed = strings.TrimSuffix(trimmed, GlobWildcard)
+		p.glob = true
+		p.firstWildcard = len(trimmed)
+	}
+	if strings.Contains(trimmed, GlobWildcard) {
+		return nil, fmt.Errorf("path %q: %q is only allowed at the end of a path", path, GlobWildcard)
+	}
+
+	p.segments = strings.Split(trimmed, "/")
+	offset := 0
+	for _, segment := range p.segments {
+		switch {
+		case segment == SegmentWildcard:
+			if p.wildcards == 0 && offset < p.firstWildcard {
+				p.firstWildcard = offset
+			}
+			p.wildcards++
+		case strings.Contains(segment, SegmentWildcard):
+			return nil, fmt.Errorf("path %q: %q must be an entire path segment", path, SegmentWildcard)
+		}
+		offset += len(segment) + 1
+	}
+
+	return p, nil
+}
+
+// HasSegmentWildcards returns whether the path contains segment wildcards
+func (p *PathPattern) HasSegmentWildcards() bool {
+	return p.wildcards > 0
+}
+
+// IsGlob returns whether the path ends in a glob
+func (p *PathPattern) IsGlob() bool {
+	return p.glob
+}
+
+// Match returns whether the pattern matches the path
+func (p *PathPattern) Match(path string) bool {
+	parts := strings.Split(path, "/")
+	last := len(p.segments) - 1
+	for i, segment := range p.segments {
+		if i >= len(parts) {
+			return false
+		}
+
+		if i == last {
+			if p.glob {
+				if segment == SegmentWildcard {
+					return parts[i] != ""
+				}
+				return strings.HasPrefix(strings.Join(parts[i:], "/"), segment)
+			}
+			if len(parts) != len(p.segments) {
+				return false
+			}
+		}
+
+		if segment == SegmentWildcard {
+			if parts[i] == "" {
+				return false
+			}
+			continue
+		}
+		if parts[i] != segment {
+			return false
+		}
+	}
+	return true
+}
+
+// ComparePathPatterns returns a negative number if a has lower precedence
+// than b when both match a path, a positive number if it has higher
+// precedence, and zero if they are the same pattern. Lower precedence is
+// given, in order, to the pattern
+//
+//  1. whose first wildcard or glob occurs earlier
+//  2. that ends in a glob, if the other does not
+//  3. that has more segment wildcards
+//  4. that is shorter
+//  5. that is lexicographically smaller
+//
+// An exact path thus always takes precedence over a pattern, and of two
+// globs without segment wildcards the longer one wins.
+func ComparePathPatterns(a, b *PathPattern) int {
+	switch {
+	case a.firstWildcard != b.firstWildcard:
+		return a.firstWildcard - b.firstWildcard
+	case a.glob != b.glob:
+		if a.glob {
+			return -1
+		}
+		return 1
+	case a.wildcards != b.wildcards:
+		return b.wildcards - a.wildcards
+	case len(a.Path) != len(b.Path):
+		return len(a.Path) - len(b.Path)
+	default:
+		return strings.Compare(a.Path, b.Path)
+	}
+}
+
+// MostSpecificMatch returns the pattern with the highest precedence among
+// those matching the path, or nil if none match
+func MostSpecificMatch(patterns []*PathPattern, path string) *PathPattern {
+	var best *PathPattern
+	for _, p := range patterns {
+		if p.Match(path) && (best == nil || ComparePathPatterns(p, best) > 0) {
+			best = p
+		}
+	}
+	return best
+}
@@ -0,0 +1,149 @@
+package policyutil
+
+import (
+	"testing"
+)
+
+func TestParsePathPattern(t *testing.T) {
+	for _, path := range []string{"", "secret/foo", "/secret/foo", "secret/*", "secret/+/config", "+/+", "secret/+/conf*", "*"} {
+		if _, err := ParsePathPattern(path); err != nil {
+			t.Fatalf("%q: %v", path, err)
+		}
+	}
+	for _, path := range []string{"secret/*/config", "secret/a+/config", "secret/+b", "secret/**"} {
+		if _, err := ParsePathPattern(path); err == nil {
+			t.Fatalf("%q: expected error", path)
+		}
+	}
+
+	p, err := ParsePathPattern("/secret/+/config*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Path != "secret/+/config*" || !p.HasSegmentWildcards() || !p.IsGlob() {
+		t.Fatalf("bad pattern: %#v", p)
+	}
+}
+
+func TestPathPattern_Match(t *testing.T) {
+	cases := []struct {
+		pattern string
+		path    string
+		match   bool
+	}{
+		{"secret/foo", "secret/foo", true},
+		{"secret/foo", "secret/foo/bar", false},
+		{"secret/foo", "secret/fo", false},
+		{"secret/*", "secret/", true},
+		{"secret/*", "secret/foo/bar", true},
+		{"secret/*", "secret", false},
+		{"secret*", "secretive/foo", true},
+		{"*", "anything/at/all", true},
+		{"secret/+/config", "secret/app/config", true},
+		{"secret/+/config", "secret//config", false},
+		{"secret/+/config", "secret/app/config/extra", false},
+		{"secret/+/config", "secret/app/other/config", false},
+		{"secret/+/config", "secret/app", false},
+		{"secret/+", "secret/app", true},
+		{"secret/+", "secret/", false},
+		{"secret/+", "secret/app/config", false},
+		{"+/+/config", "secret/app/config", true},
+		{"secret/+/conf*", "secret/app/config", true},
+		{"secret/+/conf*", "secret/app/conf/extra", true},
+		{"secret/+/conf*", "secret/app/other", false},
+		{"secret/+/*", "secret/app/", true},
+		{"secret/+/*", "secret/app", false},
+		{"secret/+*", "secret/app/config", true},
+		{"secret/+*", "secret/", false},
+	}
+	for _, c := range cases {
+		p, err := ParsePathPattern(c.pattern)
+		if err != nil {
+			t.Fatalf("%q: %v", c.pattern, err)
+		}
+		if p.Match(c.path) != c.match {
+			t.Fatalf("%q matching %q: expected %t", c.pattern, c.path, c.match)
+		}
+	}
+}
+
+func TestComparePathPatterns(t *testing.T) {
+	// Each pair is ordered from lower to higher precedence
+	cases := []struct {
+		lower  string
+		higher string
+	}{
+		// The first wildcard occurs earlier
+		{"secret/*", "secret/foo"},
+		{"secret/+/config", "secret/app/config"},
+		{"secret/+/config", "secret/app/+"},
+		{"+/app/config", "secret/+/config"},
+		{"secret/*", "secret/app/*"},
+		{"secret/+/config", "secret/app*"},
+
+		// Ends in a glob
+		{"secret/app/*", "secret/app/+"},
+		{"secret/+/*", "secret/+/+"},
+
+		// More segment wildcards
+		{"secret/+/+/config", "secret/+/data/config"},
+		{"secret/+/+", "secret/+/data"},
+
+		// Shorter
+		{"secret/+/config", "secret/+/configs"},
+		{"secret/+/a/*", "secret/+/a/b/*"},
+
+		// Lexicographically smaller
+		{"secret/+/aaa", "secret/+/bbb"},
+	}
+	for _, c := range cases {
+		lower, err := ParsePathPattern(c.lower)
+		if err != nil {
+			t.Fatal(err)
+		}
+		higher, err := ParsePathPattern(c.higher)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ComparePathPatterns(lower, higher) >= 0 || ComparePathPatterns(higher, lower) <= 0 {
+			t.Fatalf("expected %q to have lower precedence than %q", c.lower, c.higher)
+		}
+	}
+
+	p, err := ParsePathPattern("secret/+/config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ComparePathPatterns(p, p) != 0 {
+		t.Fatal("expected a pattern to compare equal to itself")
+	}
+}
+
+func TestMostSpecificMatch(t *testing.T) {
+	var patterns []*PathPattern
+	for _, path := range []string{"secret/*", "secret/+/config", "secret/+/+", "secret/app/*", "secret/app/config"} {
+		p, err := ParsePathPattern(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		patterns = append(patterns, p)
+	}
+
+	cases := map[string]string{
+		"secret/app/config":   "secret/app/config",
+		"secret/app/other":    "secret/app/*",
+		"secret/other/config": "secret/+/config",
+		"secret/other/data":   "secret/+/+",
+		"secret/other":        "secret/*",
+	}
+	for path, exp := range cases {
+		best := MostSpecificMatch(patterns, path)
+		if best == nil || best.Path != exp {
+			t.Fatalf("%q: expected %q, got %#v", path, exp, best)
+		}
+	}
+
+	if best := MostSpecificMatch(patterns, "sys/mounts"); best != nil {
+		t.Fatalf("expected no match, got %q", best.Path)
+	}
+}
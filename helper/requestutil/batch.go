@@ -0,0 +1,238 @@
+package requestutil
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+)
+
+const (
+	// FeatureBatching indicates that a node accepts batches of forwarded
+	// requests
+	FeatureBatching = "batching"
+
+	// DefaultMaxBatchRequests is the default limit on the number of requests
+	// in a forwarded batch
+	DefaultMaxBatchRequests = 256
+
+	contentTypeBatch         = "application/x-vault-forwarded-batch"
+	contentTypeBatchResponse = "application/x-vault-forwarded-batch-response"
+)
+
+// BatchedRequest is one of the requests in a forwarded batch
+type BatchedRequest struct {
+	// Identifies the request within the batch; the response to the request
+	// carries the same ID
+	ID string
+
+	Request *http.Request
+
+	// Set by GenerateForwardedBatch if the request could not be forwarded,
+	// in which case it is left out of the batch, and by ParseForwardedBatch
+	// if the request could not be reconstructed, in which case Request is nil
+	Err error
+}
+
+// forwardedBatch is the payload of a forwarded batch
+type forwardedBatch struct {
+	Version  int                    `json:"version" codec:"version"`
+	Requests []*forwardedBatchEntry `json:"requests" codec:"requests"`
+}
+
+type forwardedBatchEntry struct {
+	ID      string            `json:"id" codec:"id"`
+	Request *ForwardedRequest `json:"request" codec:"request"`
+}
+
+// forwardedBatchResponse is the payload of the response to a forwarded batch
+type forwardedBatchResponse struct {
+	Version   int                           `json:"version" codec:"version"`
+	Responses map[string]*ForwardedResponse `json:"responses" codec:"responses"`
+}
+
+// GenerateForwardedBatch generates a single http.Request carrying all of the
+// given requests, which must have distinct IDs. Each request's body is read
+// in full, so batches should only be used for small requests, and each
+// request's deadline and metadata are forwarded individually. A request that
+// cannot be forwarded, e.g. because its deadline has already passed, has Err
+// set and does not fail the rest of the batch. Batches are never streamed. If
+// config is nil, the defaults described on ForwardingConfig are used.
+func GenerateForwardedBatch(reqs []*BatchedRequest, addr string, config *ForwardingConfig) (*http.Request, error) {
+	if config == nil {
+		config = &ForwardingConfig{}
+	}
+	if err := config.checkAddr(addr); err != nil {
+		return nil, err
+	}
+	encoding := config.encoding()
+
+	batch := &forwardedBatch{
+		Version:  ForwardedRequestVersion,
+		Requests: make([]*forwardedBatchEntry, 0, len(reqs)),
+	}
+	ids := make(map[string]bool, len(reqs))
+	for _, breq := range reqs {
+		if ids[breq.ID] {
+			return nil, fmt.Errorf("duplicate request ID %q in forwarded batch", breq.ID)
+		}
+		ids[breq.ID] = true
+
+		fq, err := newForwardedRequest(breq.Request, config)
+		if err != nil {
+			breq.Err = err
+			continue
+		}
+		if breq.Request.Body != nil {
+			fq.Body, err = ioutil.ReadAll(breq.Request.Body)
+			if err != nil {
+				breq.Err = err
+				continue
+			}
+		}
+		batch.Requests = append(batch.Requests, &forwardedBatchEntry{
+			ID:      breq.ID,
+			Request: fq,
+		})
+	}
+
+	payload := getBuffer()
+	contentType, _, err := encodePayloadTo(payload, batch, encoding, config.compressionType())
+	if err != nil {
+		putBuffer(payload)
+		return nil, err
+	}
+	body := &pooledBody{
+		buf: payload,
+	}
+
+	ret, err := http.NewRequest("POST", addr, body)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	ret.ContentLength = int64(payload.Len())
+	ret.Header.Set("Content-Type", mime.FormatMediaType(contentTypeBatch, map[string]string{
+		"encoding": contentType,
+	}))
+	setAcceptForwardedResponse(ret, encoding)
+	if config.SigningKey != nil {
+		if err := signRequest(ret, config.SigningKey, config.SigningKeyID, payload.Bytes()); err != nil {
+			body.Close()
+			return nil, err
+		}
+	}
+
+	return ret, nil
+}
+
+// ParseForwardedBatch reconstructs the requests in a forwarded batch. The
+// size limit applies to the batch as a whole, while the header and
+// certificate limits apply to each request; a request exceeding them has Err
+// set rather than failing the batch. Each returned request's context is
+// derived from the given request's context, as with ParseForwardedRequest,
+// and is released when its body is closed. If config is nil, the defaults
+// described on ParseConfig are used.
+func ParseForwardedBatch(req *http.Request, config *ParseConfig) ([]*BatchedRequest, error) {
+	if config == nil {
+		config = &ParseConfig{}
+	}
+
+	mediaType, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil || mediaType != contentTypeBatch {
+		return nil, InvalidRequestError{Err: fmt.Sprintf("invalid content type for forwarded batch: %q", req.Header.Get("Content-Type"))}
+	}
+
+	// Decoding copies everything it needs out of the payload
+	payload := getBuffer()
+	defer putBuffer(payload)
+	if err := readLimitedTo(payload, req.Body, config.maxRequestSize()); err != nil {
+		return nil, err
+	}
+
+	var batch forwardedBatch
+	if _, err := decodePayload(params["encoding"], payload.Bytes(), config.maxRequestSize(), config.Strict, &batch); err != nil {
+		return nil, err
+	}
+	if len(batch.Requests) > config.maxBatchRequests() {
+		return nil, InvalidRequestError{Err: fmt.Sprintf("forwarded batch has %d requests, exceeding the limit of %d", len(batch.Requests), config.maxBatchRequests())}
+	}
+
+	ret := make([]*BatchedRequest, 0, len(batch.Requests))
+	ids := make(map[string]bool, len(batch.Requests))
+	for _, entry := range batch.Requests {
+		if entry == nil || entry.Request == nil {
+			return nil, InvalidRequestError{Err: "forwarded batch has an empty request"}
+		}
+		if ids[entry.ID] {
+			return nil, InvalidRequestError{Err: fmt.Sprintf("forwarded batch has duplicate request ID %q", entry.ID)}
+		}
+		ids[entry.ID] = true
+
+		breq := &BatchedRequest{
+			ID: entry.ID,
+		}
+		if err := config.validate(entry.Request); err != nil {
+			breq.Err = err
+		} else {
+			breq.Request, breq.Err = newRequest(req, entry.Request, bufCloser{
+				Buffer: bytes.NewBuffer(entry.Request.Body),
+			}, config)
+		}
+		ret = append(ret, breq)
+	}
+
+	return ret, nil
+}
+
+// WriteForwardedBatchResponse writes the responses to a forwarded batch,
+// keyed by request ID, using the encoding returned by
+// ForwardedResponseEncoding for the batch
+func WriteForwardedBatchResponse(w http.ResponseWriter, encoding string, responses map[string]*ForwardedResponse) error {
+	for _, fr := range responses {
+		if fr.Version == 0 {
+			fr.Version = ForwardedResponseVersion
+		}
+	}
+
+	payload := getBuffer()
+	defer putBuffer(payload)
+	contentType, _, err := encodePayloadTo(payload, &forwardedBatchResponse{
+		Version:   ForwardedResponseVersion,
+		Responses: responses,
+	}, encoding, CompressionTypeNone)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", mime.FormatMediaType(contentTypeBatchResponse, map[string]string{
+		"encoding": contentType,
+	}))
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(payload.Bytes())
+	return err
+}
+
+// ParseForwardedBatchResponse reads the responses to a forwarded batch,
+// keyed by request ID. The response body is read but not closed.
+func ParseForwardedBatchResponse(resp *http.Response) (map[string]*ForwardedResponse, error) {
+	mediaType, params, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != contentTypeBatchResponse {
+		// The active node rejected the batch as a whole
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("forwarded batch failed with status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+
+	payload := getBuffer()
+	defer putBuffer(payload)
+	if _, err := payload.ReadFrom(resp.Body); err != nil {
+		return nil, err
+	}
+
+	var batch forwardedBatchResponse
+	if _, err := decodePayload(params["encoding"], payload.Bytes(), 0, false, &batch); err != nil {
+		return nil, err
+	}
+	return batch.Responses, nil
+}
@@ -0,0 +1,224 @@
+package requestutil
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testBatchedRequests(t *testing.T, n int) []*BatchedRequest {
+	reqs := make([]*BatchedRequest, n)
+	for i := range reqs {
+		req, err := http.NewRequest("PUT", fmt.Sprintf("https://pushit.real.good:9281/v1/secret/%d", i), bytes.NewBufferString(fmt.Sprintf(`{"value":%d}`, i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Vault-Token", fmt.Sprintf("token-%d", i))
+		reqs[i] = &BatchedRequest{
+			ID:      fmt.Sprintf("id-%d", i),
+			Request: req,
+		}
+	}
+	return reqs
+}
+
+func TestForwardedBatch_RoundTrip(t *testing.T) {
+	for _, encoding := range SupportedEncodings {
+		for _, compressionType := range SupportedCompressionTypes {
+			reqs := testBatchedRequests(t, 10)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			reqs[3].Request = reqs[3].Request.WithContext(ctx)
+
+			freq, err := GenerateForwardedBatch(reqs, "https://bloopety.bloop:8201", &ForwardingConfig{
+				Encoding:        encoding,
+				CompressionType: compressionType,
+			})
+			if err != nil {
+				t.Fatalf("%s/%s: %v", encoding, compressionType, err)
+			}
+
+			// Active node
+			parsed, err := ParseForwardedBatch(freq, &ParseConfig{
+				SetRequestURI: true,
+			})
+			if err != nil {
+				t.Fatalf("%s/%s: %v", encoding, compressionType, err)
+			}
+			if len(parsed) != len(reqs) {
+				t.Fatalf("%s/%s: bad number of requests: %d", encoding, compressionType, len(parsed))
+			}
+
+			responses := make(map[string]*ForwardedResponse)
+			for i, breq := range parsed {
+				if breq.Err != nil {
+					t.Fatalf("%s/%s: %v", encoding, compressionType, breq.Err)
+				}
+				if breq.ID != reqs[i].ID {
+					t.Fatalf("%s/%s: bad ID: %s", encoding, compressionType, breq.ID)
+				}
+				r := breq.Request
+				if r.RequestURI != fmt.Sprintf("/v1/secret/%d", i) || r.Header.Get("X-Vault-Token") != fmt.Sprintf("token-%d", i) {
+					t.Fatalf("%s/%s: bad request: %#v", encoding, compressionType, r)
+				}
+				if _, ok := r.Context().Deadline(); ok != (i == 3) {
+					t.Fatalf("%s/%s: request %d has unexpected deadline", encoding, compressionType, i)
+				}
+				body, err := ioutil.ReadAll(r.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				r.Body.Close()
+
+				rw := NewForwardedResponseWriter()
+				rw.Header().Set("X-Request", breq.ID)
+				rw.Write(body)
+				responses[breq.ID] = rw.Response()
+			}
+			cancel()
+
+			respEncoding, ok := ForwardedResponseEncoding(freq)
+			if !ok || respEncoding != encoding {
+				t.Fatalf("%s/%s: bad response encoding %q", encoding, compressionType, respEncoding)
+			}
+			rec := httptest.NewRecorder()
+			if err := WriteForwardedBatchResponse(rec, respEncoding, responses); err != nil {
+				t.Fatalf("%s/%s: %v", encoding, compressionType, err)
+			}
+
+			// Standby
+			results, err := ParseForwardedBatchResponse(rec.Result())
+			if err != nil {
+				t.Fatalf("%s/%s: %v", encoding, compressionType, err)
+			}
+			for i, breq := range reqs {
+				fr, ok := results[breq.ID]
+				if !ok {
+					t.Fatalf("%s/%s: missing response for %s", encoding, compressionType, breq.ID)
+				}
+				if fr.StatusCode != http.StatusOK || fr.Header.Get("X-Request") != breq.ID || string(fr.Body) != fmt.Sprintf(`{"value":%d}`, i) {
+					t.Fatalf("%s/%s: bad response: %#v", encoding, compressionType, fr)
+				}
+			}
+		}
+	}
+}
+
+func TestForwardedBatch_Signed(t *testing.T) {
+	key := []byte("signing-key")
+	freq, err := GenerateForwardedBatch(testBatchedRequests(t, 3), "https://bloopety.bloop:8201", &ForwardingConfig{
+		SigningKey: key,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewSignatureVerifier(0).Verify(freq, key, nil); err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseForwardedBatch(freq, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != 3 {
+		t.Fatalf("bad number of requests: %d", len(parsed))
+	}
+}
+
+func TestForwardedBatch_Limits(t *testing.T) {
+	// Too many requests fails the whole batch
+	freq, err := GenerateForwardedBatch(testBatchedRequests(t, 5), "https://bloopety.bloop:8201", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ParseForwardedBatch(freq, &ParseConfig{
+		MaxBatchRequests: 4,
+	})
+	if _, ok := err.(InvalidRequestError); !ok {
+		t.Fatalf("expected invalid request error, got %v", err)
+	}
+
+	// A single request exceeding the header limits only fails that request
+	reqs := testBatchedRequests(t, 3)
+	for i := 0; i < 10; i++ {
+		reqs[1].Request.Header.Add("X-Extra", "extra")
+	}
+	freq, err = GenerateForwardedBatch(reqs, "https://bloopety.bloop:8201", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := ParseForwardedBatch(freq, &ParseConfig{
+		MaxHeaderCount: 5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, breq := range parsed {
+		if (breq.Err != nil) != (i == 1) {
+			t.Fatalf("request %d: unexpected error state: %v", i, breq.Err)
+		}
+	}
+	if _, ok := parsed[1].Err.(InvalidRequestError); !ok {
+		t.Fatalf("expected invalid request error, got %v", parsed[1].Err)
+	}
+
+	// Duplicate IDs are rejected when generating
+	reqs = testBatchedRequests(t, 2)
+	reqs[1].ID = reqs[0].ID
+	if _, err := GenerateForwardedBatch(reqs, "https://bloopety.bloop:8201", nil); err == nil {
+		t.Fatal("expected error for duplicate IDs")
+	}
+
+	// An unbatched forwarded request is not a batch
+	req, err := http.NewRequest("GET", "https://pushit.real.good:9281/v1/sys/health", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	freq, err = GenerateForwardedRequest(req, "https://bloopety.bloop:8201", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseForwardedBatch(freq, nil); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestForwardedBatchResponse_Rejected(t *testing.T) {
+	rec := httptest.NewRecorder()
+	rec.Header().Set("Content-Type", "application/json")
+	rec.WriteHeader(http.StatusForbidden)
+	rec.Write([]byte(`{"Errors":["forwarded request is not signed"]}`))
+
+	_, err := ParseForwardedBatchResponse(rec.Result())
+	if err == nil || !strings.Contains(err.Error(), "403") || !strings.Contains(err.Error(), "not signed") {
+		t.Fatalf("bad error: %v", err)
+	}
+}
+
+func TestForwardedBatch_Expired(t *testing.T) {
+	reqs := testBatchedRequests(t, 3)
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	reqs[1].Request = reqs[1].Request.WithContext(ctx)
+
+	// The expired request is left out without failing the others
+	freq, err := GenerateForwardedBatch(reqs, "https://bloopety.bloop:8201", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reqs[1].Err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", reqs[1].Err)
+	}
+	parsed, err := ParseForwardedBatch(freq, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != 2 || parsed[0].ID != reqs[0].ID || parsed[1].ID != reqs[2].ID {
+		t.Fatalf("bad requests: %#v", parsed)
+	}
+}
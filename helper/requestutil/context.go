@@ -0,0 +1,74 @@
+package requestutil
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+type contextMetadataKey struct{}
+
+// ContextWithMetadata returns a copy of ctx carrying the given metadata.
+// Metadata is opaque to request forwarding; it is intended for values such
+// as a W3C traceparent that must follow a request to the active node.
+// GenerateForwardedRequest includes the metadata from the original
+// request's context and ParseForwardedRequest attaches it to the context of
+// the reconstructed request.
+func ContextWithMetadata(ctx context.Context, metadata map[string]string) context.Context {
+	return context.WithValue(ctx, contextMetadataKey{}, metadata)
+}
+
+// MetadataFromContext returns the metadata attached to ctx with
+// ContextWithMetadata, or nil if there is none
+func MetadataFromContext(ctx context.Context) map[string]string {
+	metadata, _ := ctx.Value(contextMetadataKey{}).(map[string]string)
+	return metadata
+}
+
+// setForwardedContext records the deadline and metadata of ctx in fq. The
+// deadline is sent as the time remaining rather than an absolute time so
+// that clock skew between nodes does not affect it.
+func setForwardedContext(ctx context.Context, fq *ForwardedRequest) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout := deadline.Sub(time.Now())
+		if timeout <= 0 {
+			return context.DeadlineExceeded
+		}
+		fq.Timeout = timeout
+	}
+	fq.ContextMetadata = MetadataFromContext(ctx)
+	return nil
+}
+
+// forwardedContext derives a context for the reconstructed request from the
+// context of the forwarded request, so that the reconstructed request is
+// canceled if the standby gives up on it. The returned body releases the
+// deadline's resources when closed.
+func forwardedContext(req *http.Request, fq *ForwardedRequest, body io.ReadCloser) (context.Context, io.ReadCloser) {
+	ctx := req.Context()
+	if fq.ContextMetadata != nil {
+		ctx = ContextWithMetadata(ctx, fq.ContextMetadata)
+	}
+	if fq.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, fq.Timeout)
+		body = &cancelBody{
+			ReadCloser: body,
+			cancel:     cancel,
+		}
+	}
+	return ctx, body
+}
+
+// cancelBody cancels the request context once the body has been closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,132 @@
+package requestutil
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestForwardedRequest_Context(t *testing.T) {
+	metadata := map[string]string{
+		"traceparent": "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+	}
+
+	smallBody := []byte(`{"foo":"bar"}`)
+	largeBody := make([]byte, 3*streamChunkSize)
+	if _, err := rand.Read(largeBody); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, body := range [][]byte{smallBody, largeBody} {
+		for _, encoding := range SupportedEncodings {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			ctx = ContextWithMetadata(ctx, metadata)
+
+			req, err := http.NewRequest("PUT", "https://pushit.real.good:9281/v1/secret/foo", bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.ContentLength = -1
+			req = req.WithContext(ctx)
+
+			freq, err := GenerateForwardedRequest(req, "https://bloopety.bloop:8201", &ForwardingConfig{
+				Encoding:  encoding,
+				Streaming: true,
+			})
+			if err != nil {
+				t.Fatalf("%s: %v", encoding, err)
+			}
+			if freq.Context() != ctx {
+				t.Fatalf("%s: expected forwarded request to use the original context", encoding)
+			}
+
+			// The active node receives the request without the standby's context
+			finalReq, err := ParseForwardedRequest(freq.WithContext(context.Background()), nil)
+			if err != nil {
+				t.Fatalf("%s: %v", encoding, err)
+			}
+
+			deadline, ok := finalReq.Context().Deadline()
+			if !ok {
+				t.Fatalf("%s: expected deadline on reconstructed request", encoding)
+			}
+			if remaining := deadline.Sub(time.Now()); remaining <= 0 || remaining > time.Minute {
+				t.Fatalf("%s: bad deadline, %s remaining", encoding, remaining)
+			}
+			if md := MetadataFromContext(finalReq.Context()); !reflect.DeepEqual(md, metadata) {
+				t.Fatalf("%s: bad metadata: %#v", encoding, md)
+			}
+
+			finalReq.Body.Close()
+			if finalReq.Context().Err() == nil {
+				t.Fatalf("%s: expected context to be released when the body is closed", encoding)
+			}
+			cancel()
+		}
+	}
+}
+
+func TestForwardedRequest_ContextNoDeadline(t *testing.T) {
+	req, err := http.NewRequest("GET", "https://pushit.real.good:9281/v1/sys/health", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	freq, err := GenerateForwardedRequest(req, "https://bloopety.bloop:8201", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	finalReq, err := ParseForwardedRequest(freq, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := finalReq.Context().Deadline(); ok {
+		t.Fatal("expected no deadline")
+	}
+	if md := MetadataFromContext(finalReq.Context()); md != nil {
+		t.Fatalf("expected no metadata, got %#v", md)
+	}
+}
+
+func TestForwardedRequest_ContextCancellation(t *testing.T) {
+	req, err := http.NewRequest("GET", "https://pushit.real.good:9281/v1/sys/health", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	freq, err := GenerateForwardedRequest(req, "https://bloopety.bloop:8201", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Canceling the incoming request on the active node, e.g. because the
+	// standby disconnected, cancels the reconstructed request
+	ctx, cancel := context.WithCancel(context.Background())
+	finalReq, err := ParseForwardedRequest(freq.WithContext(ctx), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if finalReq.Context().Err() != context.Canceled {
+		t.Fatalf("expected canceled context, got %v", finalReq.Context().Err())
+	}
+}
+
+func TestForwardedRequest_ContextExpired(t *testing.T) {
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	req, err := http.NewRequest("GET", "https://pushit.real.good:9281/v1/sys/health", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = GenerateForwardedRequest(req.WithContext(ctx), "https://bloopety.bloop:8201", nil)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package requestutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hashicorp/go-msgpack/codec"
+	"github.com/hashicorp/vault/helper/compressutil"
+	"github.com/hashicorp/vault/helper/jsonutil"
+)
+
+const (
+	contentTypeJSON    = "application/json"
+	contentTypeMsgpack = "application/x-msgpack"
+)
+
+// Handles are safe for concurrent use once configured, so they are shared
+// rather than allocated for every payload
+var (
+	msgpackEncodeHandle       = &codec.MsgpackHandle{WriteExt: true}
+	msgpackDecodeHandle       = &codec.MsgpackHandle{}
+	msgpackStrictDecodeHandle = &codec.MsgpackHandle{
+		BasicHandle: codec.BasicHandle{
+			DecodeOptions: codec.DecodeOptions{
+				ErrorIfNoField: true,
+			},
+		},
+	}
+)
+
+// encodePayload encodes and compresses the given forwarded request or
+// response, returning the content type identifying the encoding along with
+// the encoded bytes
+func encodePayload(v interface{}, encoding, compressionType string) (string, []byte, error) {
+	var buf bytes.Buffer
+	contentType, _, err := encodePayloadTo(&buf, v, encoding, compressionType)
+	if err != nil {
+		return "", nil, err
+	}
+	return contentType, buf.Bytes(), nil
+}
+
+// encodePayloadTo behaves like encodePayload, except that the encoded bytes
+// are written to buf. The uncompressed encoding is staged in a pooled buffer,
+// and its size is returned along with the content type.
+func encodePayloadTo(buf *bytes.Buffer, v interface{}, encoding, compressionType string) (string, int, error) {
+	if compressionType == CompressionTypeNone {
+		start := buf.Len()
+		contentType, err := encodeTo(buf, v, encoding)
+		return contentType, buf.Len() - start, err
+	}
+
+	encoded := getBuffer()
+	defer putBuffer(encoded)
+
+	contentType, err := encodeTo(encoded, v, encoding)
+	if err != nil {
+		return "", 0, err
+	}
+
+	err = compressutil.CompressTo(buf, encoded.Bytes(), &compressutil.CompressionConfig{
+		Type: compressionType,
+	})
+	if err != nil {
+		return "", 0, err
+	}
+
+	return contentType, encoded.Len(), nil
+}
+
+// encodeTo encodes v into buf using the given encoding, returning the
+// content type identifying it
+func encodeTo(buf *bytes.Buffer, v interface{}, encoding string) (string, error) {
+	switch encoding {
+	case EncodingJSON:
+		// Equivalent to jsonutil.EncodeJSON, without the intermediate buffer
+		return contentTypeJSON, json.NewEncoder(buf).Encode(v)
+	case EncodingMsgpack:
+		return contentTypeMsgpack, codec.NewEncoder(buf, msgpackEncodeHandle).Encode(v)
+	default:
+		return "", fmt.Errorf("unsupported forwarded request encoding %q", encoding)
+	}
+}
+
+// decodePayload decompresses the given payload, if necessary, and decodes it
+// into a forwarded request or response based on the content type. An empty
+// content type is sent by older nodes, which always use JSON. The
+// decompressed payload may be at most limit bytes; a limit of zero disables
+// the check. If strict is set, fields that v does not have are an error. The
+// size of the decompressed payload is returned.
+func decodePayload(contentType string, payload []byte, limit int64, strict bool, v interface{}) (int, error) {
+	if len(payload) == 0 {
+		return 0, InvalidRequestError{Err: "forwarded request payload is empty"}
+	}
+
+	decompressed, uncompressed, err := compressutil.DecompressWithLimit(payload, limit)
+	switch {
+	case err == compressutil.ErrDecompressionLimitExceeded:
+		return 0, RequestTooLargeError{Err: fmt.Sprintf("decompressed forwarded request exceeds the size limit of %d bytes", limit)}
+	case err != nil:
+		return 0, InvalidRequestError{Err: fmt.Sprintf("failed to decompress forwarded request: %v", err)}
+	case !uncompressed:
+		payload = decompressed
+	}
+
+	switch contentType {
+	case contentTypeMsgpack:
+		handle := msgpackDecodeHandle
+		if strict {
+			handle = msgpackStrictDecodeHandle
+		}
+		dec := codec.NewDecoder(bytes.NewReader(payload), handle)
+		err = dec.Decode(v)
+	case "", contentTypeJSON:
+		if strict {
+			err = jsonutil.DecodeJSONStrict(payload, v, &jsonutil.StrictConfig{
+				MaxSize: limit,
+			})
+		} else {
+			err = jsonutil.DecodeJSONFromReader(bytes.NewReader(payload), v)
+		}
+	default:
+		return 0, InvalidRequestError{Err: fmt.Sprintf("unsupported forwarded request content type %q", contentType)}
+	}
+	if err != nil {
+		return 0, InvalidRequestError{Err: fmt.Sprintf("failed to decode forwarded request: %v", err)}
+	}
+
+	return len(payload), nil
+}
@@ -2,15 +2,101 @@ package requestutil
 
 import (
 	"bytes"
-	"crypto/tls"
 	"crypto/x509"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
 	"net/url"
+	"time"
 
+	"github.com/armon/go-metrics"
 	"github.com/hashicorp/vault/helper/compressutil"
-	"github.com/hashicorp/vault/helper/jsonutil"
 )
 
+const (
+	// ForwardedRequestVersion is the version of the forwarded request payload
+	// generated by this node. Payloads without a version were generated by
+	// older nodes and are always LZW-compressed JSON.
+	ForwardedRequestVersion = 2
+)
+
+// ForwardingConfig controls how GenerateForwardedRequest encodes a request
+type ForwardingConfig struct {
+	// The compression type to use for the encoded request; one of
+	// SupportedCompressionTypes. Defaults to LZW, which every node that
+	// supports request forwarding can decode.
+	CompressionType string
+
+	// The encoding to use for the request; one of SupportedEncodings.
+	// Defaults to JSON, which every node that supports request forwarding
+	// can decode.
+	Encoding string
+
+	// Whether to stream the request body to the active node in chunks rather
+	// than buffering it. Only set this if the active node advertises
+	// FeatureStreaming. Small bodies of known length are always buffered.
+	Streaming bool
+
+	// Whether to omit the client's TLS peer certificates from the forwarded
+	// request. By default they are included so that the active node can
+	// authenticate the client with them.
+	DisablePeerCertificates bool
+
+	// Whether to allow forwarding to an address that is not https. Forwarded
+	// requests carry client tokens, so this should only be set when the
+	// cluster connection is secured by other means.
+	Insecure bool
+
+	// If set, the request is signed with this key so that the active node
+	// can verify it with a SignatureVerifier. Signed requests are never
+	// streamed, since the signature covers the whole payload.
+	SigningKey []byte
+
+	// An identifier for SigningKey sent along with the signature, which the
+	// active node can use to select the key to verify it with
+	SigningKeyID string
+
+	// The filter applied to the client's headers. Defaults to
+	// DefaultHeaderFilter, which removes hop-by-hop headers.
+	HeaderFilter *HeaderFilter
+}
+
+// ParseConfig controls how ParseForwardedRequest reconstructs a request
+type ParseConfig struct {
+	// Whether to set RequestURI on the reconstructed request, as the HTTP
+	// server does for incoming requests. The original request-target is used
+	// if the standby sent it; otherwise it is rebuilt from the URL.
+	SetRequestURI bool
+
+	// The maximum size in bytes of the forwarded request, applied both to
+	// the payload as received and once decompressed. For streamed requests
+	// the limit also applies to the body. Defaults to DefaultMaxRequestSize.
+	MaxRequestSize int64
+
+	// The maximum number of header values. Defaults to
+	// DefaultMaxHeaderCount.
+	MaxHeaderCount int
+
+	// The maximum combined size in bytes of the header names and values.
+	// Defaults to DefaultMaxHeaderBytes.
+	MaxHeaderBytes int
+
+	// The maximum number of client certificates. Defaults to
+	// DefaultMaxPeerCertificates.
+	MaxPeerCertificates int
+
+	// The maximum number of requests in a forwarded batch. Defaults to
+	// DefaultMaxBatchRequests.
+	MaxBatchRequests int
+
+	// Whether to reject payloads containing fields this node does not
+	// understand rather than ignoring them. This catches malformed requests,
+	// but also rejects requests from standbys running newer versions that
+	// add fields.
+	Strict bool
+}
+
 type bufCloser struct {
 	*bytes.Buffer
 }
@@ -21,111 +107,297 @@ func (b bufCloser) Close() error {
 }
 
 type ForwardedRequest struct {
+	// The version of the payload format
+	Version int `json:"version,omitempty" codec:"version,omitempty"`
+
 	// The original method
-	Method string `json:"method"`
+	Method string `json:"method" codec:"method"`
 
 	// The original URL object
-	URL *url.URL `json:"url"`
+	URL *ForwardedURL `json:"url" codec:"url"`
+
+	// The original unmodified request-target sent by the client
+	RequestURI string `json:"request_uri,omitempty" codec:"request_uri,omitempty"`
 
 	// The original headers
-	Header http.Header `json:"header"`
+	Header http.Header `json:"header" codec:"header"`
 
 	// The request body
-	Body []byte `json:"body"`
+	Body []byte `json:"body" codec:"body"`
 
 	// The specified host
-	Host string `json:"host"`
+	Host string `json:"host" codec:"host"`
 
 	// The remote address
-	RemoteAddr string `json:"remote_addr"`
+	RemoteAddr string `json:"remote_addr" codec:"remote_addr"`
 
 	// The client's TLS peer certificates
-	PeerCertificates [][]byte `json:"peer_certificates"`
+	PeerCertificates [][]byte `json:"peer_certificates" codec:"peer_certificates"`
+
+	// The remaining parameters of the client's TLS connection
+	TLS *ForwardedConnectionState `json:"tls,omitempty" codec:"tls,omitempty"`
+
+	// The time remaining until the original request's deadline, if it had one
+	Timeout time.Duration `json:"timeout,omitempty" codec:"timeout,omitempty"`
+
+	// Opaque metadata from the original request's context
+	ContextMetadata map[string]string `json:"context_metadata,omitempty" codec:"context_metadata,omitempty"`
 }
 
 // GenerateForwardedRequest generates a new http.Request that contains the
-// original requests's information in the new request's body.
-func GenerateForwardedRequest(req *http.Request, addr string) (*http.Request, error) {
-	fq := ForwardedRequest{
+// original requests's information in the new request's body. The new request
+// uses the original request's context, and the context's deadline and
+// metadata are forwarded along with the request. The new request asks the
+// active node to envelope its response; see ParseForwardedResponse. If config
+// is nil, the defaults described on ForwardingConfig are used.
+func GenerateForwardedRequest(req *http.Request, addr string, config *ForwardingConfig) (*http.Request, error) {
+	defer metrics.MeasureSince([]string{"forwarding", "generate"}, time.Now())
+
+	ret, err := generateForwardedRequest(req, addr, config)
+	if err != nil {
+		metrics.IncrCounter([]string{"forwarding", "generate", "error"}, 1)
+	}
+	return ret, err
+}
+
+func generateForwardedRequest(req *http.Request, addr string, config *ForwardingConfig) (*http.Request, error) {
+	if config == nil {
+		config = &ForwardingConfig{}
+	}
+	if err := config.checkAddr(addr); err != nil {
+		return nil, err
+	}
+	compressionType := config.compressionType()
+	encoding := config.encoding()
+
+	fq, err := newForwardedRequest(req, config)
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Streaming && config.SigningKey == nil && req.Body != nil && (req.ContentLength < 0 || req.ContentLength > streamChunkSize) {
+		ret, err := generateStreamingRequest(req.Body, fq, addr, encoding, compressionType)
+		if err != nil {
+			return nil, err
+		}
+		setAcceptForwardedResponse(ret, encoding)
+		metrics.IncrCounter([]string{"forwarding", "generate", "streamed"}, 1)
+		return ret.WithContext(req.Context()), nil
+	}
+
+	// The body is only needed until it has been encoded
+	if req.Body != nil {
+		buf := getBuffer()
+		defer putBuffer(buf)
+		_, err := buf.ReadFrom(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		fq.Body = buf.Bytes()
+	}
+
+	// The encoded payload is returned to the pool once the transport closes
+	// the request body
+	payload := getBuffer()
+	contentType, encodedSize, err := encodePayloadTo(payload, fq, encoding, compressionType)
+	if err != nil {
+		putBuffer(payload)
+		return nil, err
+	}
+	metrics.AddSample([]string{"forwarding", "generate", "encoded_size"}, float32(encodedSize))
+	metrics.AddSample([]string{"forwarding", "generate", "payload_size"}, float32(payload.Len()))
+	body := &pooledBody{
+		buf: payload,
+	}
+
+	ret, err := http.NewRequest("POST", addr, body)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	ret.ContentLength = int64(payload.Len())
+	ret.Header.Set("Content-Type", contentType)
+	setAcceptForwardedResponse(ret, encoding)
+	if config.SigningKey != nil {
+		if err := signRequest(ret, config.SigningKey, config.SigningKeyID, payload.Bytes()); err != nil {
+			body.Close()
+			return nil, err
+		}
+	}
+
+	return ret.WithContext(req.Context()), nil
+}
+
+// newForwardedRequest returns the ForwardedRequest describing req, without
+// its body
+func newForwardedRequest(req *http.Request, config *ForwardingConfig) (*ForwardedRequest, error) {
+	fq := &ForwardedRequest{
+		Version:    ForwardedRequestVersion,
 		Method:     req.Method,
-		URL:        req.URL,
-		Header:     req.Header,
+		URL:        NewForwardedURL(req.URL),
+		RequestURI: req.RequestURI,
+		Header:     config.headerFilter().Filter(req.Header),
 		Host:       req.Host,
 		RemoteAddr: req.RemoteAddr,
+		TLS:        NewForwardedConnectionState(req.TLS),
 	}
 
-	if req.TLS.PeerCertificates != nil && len(req.TLS.PeerCertificates) > 0 {
+	if err := setForwardedContext(req.Context(), fq); err != nil {
+		return nil, err
+	}
+
+	// The request may not have arrived over TLS at all, e.g. on a listener
+	// with TLS disabled
+	if req.TLS != nil && len(req.TLS.PeerCertificates) > 0 && !config.DisablePeerCertificates {
 		fq.PeerCertificates = make([][]byte, len(req.TLS.PeerCertificates))
 		for i, cert := range req.TLS.PeerCertificates {
 			fq.PeerCertificates[i] = cert.Raw
 		}
 	}
 
-	buf := bytes.NewBuffer(nil)
-	_, err := buf.ReadFrom(req.Body)
+	return fq, nil
+}
+
+// checkAddr rejects forwarding addresses that are not https unless Insecure
+// is set
+func (c *ForwardingConfig) checkAddr(addr string) error {
+	if c.Insecure {
+		return nil
+	}
+	u, err := url.Parse(addr)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("error parsing forwarding address: %v", err)
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("refusing to forward request to non-https address %q", addr)
 	}
-	fq.Body = buf.Bytes()
+	return nil
+}
 
-	newBody, err := jsonutil.EncodeJSONAndCompress(&fq, &compressutil.CompressionConfig{
-		Type: compressutil.CompressionTypeLzw,
-	})
-	if err != nil {
-		return nil, err
+func (c *ForwardingConfig) compressionType() string {
+	if c.CompressionType != "" {
+		return c.CompressionType
 	}
+	return compressutil.CompressionTypeLzw
+}
 
-	ret, err := http.NewRequest("POST", addr, bytes.NewBuffer(newBody))
-	if err != nil {
-		return nil, err
+func (c *ForwardingConfig) encoding() string {
+	if c.Encoding != "" {
+		return c.Encoding
 	}
+	return EncodingJSON
+}
 
-	return ret, nil
+func (c *ForwardingConfig) headerFilter() *HeaderFilter {
+	if c.HeaderFilter != nil {
+		return c.HeaderFilter
+	}
+	return DefaultHeaderFilter
 }
 
 // ParseForwardedRequest generates a new http.Request that is comprised of the
 // values in the given request's body, assuming it correctly parses into a
-// ForwardedRequest.
-func ParseForwardedRequest(req *http.Request) (*http.Request, error) {
-	buf := bufCloser{
-		Buffer: bytes.NewBuffer(nil),
-	}
-	_, err := buf.ReadFrom(req.Body)
+// ForwardedRequest. The encoding is taken from the request's Content-Type;
+// requests without one come from older nodes and are decoded as JSON. For
+// streamed requests the returned request's body reads directly from the given
+// request's body. The returned request's context is derived from the given
+// request's context and carries the forwarded deadline and metadata; closing
+// the returned request's body releases it. If config is nil, the defaults
+// described on ParseConfig are used.
+func ParseForwardedRequest(req *http.Request, config *ParseConfig) (*http.Request, error) {
+	defer metrics.MeasureSince([]string{"forwarding", "parse"}, time.Now())
+
+	ret, err := parseForwardedRequest(req, config)
 	if err != nil {
-		return nil, err
+		metrics.IncrCounter([]string{"forwarding", "parse", "error"}, 1)
+	}
+	return ret, err
+}
+
+func parseForwardedRequest(req *http.Request, config *ParseConfig) (*http.Request, error) {
+	if config == nil {
+		config = &ParseConfig{}
+	}
+
+	mediaType, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil && req.Header.Get("Content-Type") != "" {
+		return nil, InvalidRequestError{Err: fmt.Sprintf("invalid content type: %v", err)}
 	}
 
 	var fq ForwardedRequest
-	err = jsonutil.DecodeJSON(buf.Bytes(), &fq)
-	if err != nil {
-		return nil, err
+	var body io.ReadCloser
+	switch mediaType {
+	case contentTypeStream:
+		body, err = parseStreamingRequest(req.Body, params["encoding"], config.maxRequestSize(), config.Strict, &fq)
+		if err != nil {
+			return nil, err
+		}
+		metrics.IncrCounter([]string{"forwarding", "parse", "streamed"}, 1)
+
+	default:
+		// Decoding copies everything it needs out of the payload
+		payload := getBuffer()
+		defer putBuffer(payload)
+		if err := readLimitedTo(payload, req.Body, config.maxRequestSize()); err != nil {
+			return nil, err
+		}
+
+		decodedSize, err := decodePayload(mediaType, payload.Bytes(), config.maxRequestSize(), config.Strict, &fq)
+		if err != nil {
+			return nil, err
+		}
+		metrics.AddSample([]string{"forwarding", "parse", "payload_size"}, float32(payload.Len()))
+		metrics.AddSample([]string{"forwarding", "parse", "decoded_size"}, float32(decodedSize))
+
+		body = bufCloser{
+			Buffer: bytes.NewBuffer(fq.Body),
+		}
 	}
 
-	buf.Reset()
-	_, err = buf.Write(fq.Body)
-	if err != nil {
+	if err := config.validate(&fq); err != nil {
 		return nil, err
 	}
 
+	return newRequest(req, &fq, body, config)
+}
+
+// newRequest reconstructs the request described by fq, with the given body,
+// as a child of the request that carried it
+func newRequest(req *http.Request, fq *ForwardedRequest, body io.ReadCloser, config *ParseConfig) (*http.Request, error) {
+	ctx, body := forwardedContext(req, fq, body)
+
 	ret := &http.Request{
 		Method:     fq.Method,
-		URL:        fq.URL,
+		URL:        fq.URL.URL(),
 		Header:     fq.Header,
-		Body:       buf,
+		Body:       body,
 		Host:       fq.Host,
 		RemoteAddr: fq.RemoteAddr,
 	}
+	ret = ret.WithContext(ctx)
 
-	if fq.PeerCertificates != nil && len(fq.PeerCertificates) > 0 {
-		ret.TLS = &tls.ConnectionState{
-			PeerCertificates: make([]*x509.Certificate, len(fq.PeerCertificates)),
+	if config.SetRequestURI {
+		switch {
+		case fq.RequestURI != "":
+			ret.RequestURI = fq.RequestURI
+		case ret.URL != nil:
+			ret.RequestURI = ret.URL.RequestURI()
 		}
+	}
+
+	if fq.TLS != nil || len(fq.PeerCertificates) > 0 {
+		ret.TLS = fq.TLS.ConnectionState()
+	}
+
+	if fq.PeerCertificates != nil && len(fq.PeerCertificates) > 0 {
+		ret.TLS.PeerCertificates = make([]*x509.Certificate, len(fq.PeerCertificates))
 		for i, certBytes := range fq.PeerCertificates {
 			cert, err := x509.ParseCertificate(certBytes)
 			if err != nil {
-				return nil, err
+				body.Close()
+				return nil, InvalidRequestError{Err: fmt.Sprintf("failed to parse peer certificate: %v", err)}
 			}
-			req.TLS.PeerCertificates[i] = cert
+			ret.TLS.PeerCertificates[i] = cert
 		}
 	}
 
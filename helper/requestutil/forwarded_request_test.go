@@ -3,6 +3,7 @@ package requestutil
 import (
 	"bufio"
 	"bytes"
+	"crypto/rand"
 	"crypto/tls"
 	"net/http"
 	"reflect"
@@ -37,7 +38,7 @@ func TestForwardedRequestGenerateParse(t *testing.T) {
 	}
 
 	// Generate the request with the forwarded request in the body
-	req, err = GenerateForwardedRequest(initialReq, "https://bloopety.bloop:8201")
+	req, err = GenerateForwardedRequest(initialReq, "https://bloopety.bloop:8201", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -55,7 +56,7 @@ func TestForwardedRequestGenerateParse(t *testing.T) {
 	}
 
 	// Now extract the forwarded request to generate a final request for processing
-	finalReq, err := ParseForwardedRequest(intreq)
+	finalReq, err := ParseForwardedRequest(intreq, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -91,3 +92,103 @@ func TestForwardedRequestGenerateParse(t *testing.T) {
 		}
 	}
 }
+
+func TestForwardedRequestGenerateParse_Encodings(t *testing.T) {
+	body := []byte(`{ "foo": "bar", "zip": { "argle": "bargle", neet: 0 } }`)
+
+	for _, encoding := range SupportedEncodings {
+		for _, compressionType := range SupportedCompressionTypes {
+			testForwardedRequestRoundTrip(t, body, encoding, compressionType)
+		}
+	}
+
+	req, err := http.NewRequest("PUT", "https://pushit.real.good:9281/", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.TLS = &tls.ConnectionState{}
+	if _, err := GenerateForwardedRequest(req, "https://bloopety.bloop:8201", &ForwardingConfig{
+		CompressionType: "bogus",
+	}); err == nil {
+		t.Fatal("expected error for unsupported compression type")
+	}
+	if _, err := GenerateForwardedRequest(req, "https://bloopety.bloop:8201", &ForwardingConfig{
+		Encoding: "bogus",
+	}); err == nil {
+		t.Fatal("expected error for unsupported encoding")
+	}
+}
+
+func testForwardedRequestRoundTrip(t *testing.T, body []byte, encoding, compressionType string) {
+	name := encoding + "/" + compressionType
+
+	req, err := http.NewRequest("PUT", "https://pushit.real.good:9281/snicketysnack?furbleburble=bloopetybloop", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.TLS = &tls.ConnectionState{}
+
+	freq, err := GenerateForwardedRequest(req, "https://bloopety.bloop:8201", &ForwardingConfig{
+		CompressionType: compressionType,
+		Encoding:        encoding,
+	})
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+
+	finalReq, err := ParseForwardedRequest(freq, nil)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+
+	if finalReq.Method != req.Method {
+		t.Fatalf("%s: bad method: %s", name, finalReq.Method)
+	}
+	if !reflect.DeepEqual(finalReq.URL, req.URL) {
+		t.Fatalf("%s: bad url: %#v", name, *finalReq.URL)
+	}
+	finBuf := bytes.NewBuffer(nil)
+	if _, err := finBuf.ReadFrom(finalReq.Body); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(finBuf.Bytes(), body) {
+		t.Fatalf("%s: bad body: %s", name, finBuf.String())
+	}
+}
+
+func BenchmarkForwardedRequest_JSON(b *testing.B) {
+	benchmarkForwardedRequest(b, EncodingJSON)
+}
+
+func BenchmarkForwardedRequest_Msgpack(b *testing.B) {
+	benchmarkForwardedRequest(b, EncodingMsgpack)
+}
+
+func benchmarkForwardedRequest(b *testing.B, encoding string) {
+	// Simulate a large KV write
+	body := make([]byte, 1024*1024)
+	if _, err := rand.Read(body); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		req, err := http.NewRequest("PUT", "https://pushit.real.good:9281/v1/secret/foo", bytes.NewReader(body))
+		if err != nil {
+			b.Fatal(err)
+		}
+		req.TLS = &tls.ConnectionState{}
+
+		freq, err := GenerateForwardedRequest(req, "https://bloopety.bloop:8201", &ForwardingConfig{
+			CompressionType: CompressionTypeNone,
+			Encoding:        encoding,
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := ParseForwardedRequest(freq, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package requestutil
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const (
+	// ForwardedResponseVersion is the version of the forwarded response
+	// payload generated by this node
+	ForwardedResponseVersion = 1
+
+	contentTypeResponse = "application/x-vault-forwarded-response"
+
+	// trailerPrefix marks a header set by a handler as a trailer that was
+	// not declared before the header was written. This is the same
+	// convention as net/http uses in newer Go versions.
+	trailerPrefix = "Trailer:"
+)
+
+// ForwardedResponse carries the response to a forwarded request from the
+// active node back to the standby that forwarded it. Unlike a plain proxied
+// response it preserves the headers and trailers set by the active node's
+// handler exactly.
+type ForwardedResponse struct {
+	// The version of the payload format
+	Version int `json:"version" codec:"version"`
+
+	// The status code written by the handler
+	StatusCode int `json:"status_code" codec:"status_code"`
+
+	// The headers written by the handler
+	Header http.Header `json:"header" codec:"header"`
+
+	// The response body
+	Body []byte `json:"body" codec:"body"`
+
+	// The trailers set by the handler after writing the body
+	Trailer http.Header `json:"trailer,omitempty" codec:"trailer,omitempty"`
+}
+
+// ForwardedResponseEncoding returns the encoding in which the standby that
+// sent the given forwarded request would like the response enveloped. The
+// returned boolean is false for requests from older standbys, which expect
+// the response to be written directly.
+func ForwardedResponseEncoding(req *http.Request) (string, bool) {
+	for _, accept := range strings.Split(req.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(accept)
+		if err != nil || mediaType != contentTypeResponse {
+			continue
+		}
+		if ValidEncoding(params["encoding"]) {
+			return params["encoding"], true
+		}
+	}
+	return "", false
+}
+
+// setAcceptForwardedResponse marks the forwarded request as accepting an
+// enveloped response in the given encoding
+func setAcceptForwardedResponse(req *http.Request, encoding string) {
+	req.Header.Set("Accept", mime.FormatMediaType(contentTypeResponse, map[string]string{
+		"encoding": encoding,
+	}))
+}
+
+// WriteForwardedResponse writes the enveloped response to the standby using
+// the given encoding, as returned by ForwardedResponseEncoding
+func WriteForwardedResponse(w http.ResponseWriter, encoding string, fr *ForwardedResponse) error {
+	if fr.Version == 0 {
+		fr.Version = ForwardedResponseVersion
+	}
+
+	payload := getBuffer()
+	defer putBuffer(payload)
+	contentType, _, err := encodePayloadTo(payload, fr, encoding, CompressionTypeNone)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", mime.FormatMediaType(contentTypeResponse, map[string]string{
+		"encoding": contentType,
+	}))
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(payload.Bytes())
+	return err
+}
+
+// ParseForwardedResponse reads the response to a forwarded request. If the
+// active node did not envelope the response, as older nodes do not, the
+// response is used as-is. The response body is read but not closed.
+func ParseForwardedResponse(resp *http.Response) (*ForwardedResponse, error) {
+	mediaType, params, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != contentTypeResponse {
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return &ForwardedResponse{
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header,
+			Body:       body,
+			Trailer:    resp.Trailer,
+		}, nil
+	}
+
+	payload := getBuffer()
+	defer putBuffer(payload)
+	if _, err := payload.ReadFrom(resp.Body); err != nil {
+		return nil, err
+	}
+
+	var fr ForwardedResponse
+	if _, err := decodePayload(params["encoding"], payload.Bytes(), 0, false, &fr); err != nil {
+		return nil, err
+	}
+	return &fr, nil
+}
+
+// CopyForwardedResponse writes the forwarded response to w, including any
+// trailers
+func CopyForwardedResponse(w http.ResponseWriter, fr *ForwardedResponse) {
+	header := w.Header()
+	for k, v := range fr.Header {
+		// The length of the body is set when it is written
+		if k == "Content-Length" {
+			continue
+		}
+		header[k] = v
+	}
+	for k := range fr.Trailer {
+		header.Add("Trailer", k)
+	}
+
+	statusCode := fr.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	w.WriteHeader(statusCode)
+	w.Write(fr.Body)
+
+	for k, v := range fr.Trailer {
+		header[k] = v
+	}
+}
+
+// ForwardedResponseWriter is an http.ResponseWriter that records the
+// response written by a handler so that it can be returned to a standby as
+// a ForwardedResponse
+type ForwardedResponseWriter struct {
+	header      http.Header
+	wroteHeader bool
+	statusCode  int
+
+	// The headers as they were when the status was written; later changes
+	// are trailers
+	snapshot http.Header
+	body     bytes.Buffer
+}
+
+// NewForwardedResponseWriter returns a new ForwardedResponseWriter
+func NewForwardedResponseWriter() *ForwardedResponseWriter {
+	return &ForwardedResponseWriter{
+		header: make(http.Header),
+	}
+}
+
+func (w *ForwardedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *ForwardedResponseWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.statusCode = statusCode
+	w.snapshot = cloneHeader(w.header)
+}
+
+func (w *ForwardedResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.body.Write(p)
+}
+
+// Response returns the recorded response
+func (w *ForwardedResponseWriter) Response() *ForwardedResponse {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	fr := &ForwardedResponse{
+		Version:    ForwardedResponseVersion,
+		StatusCode: w.statusCode,
+		Header:     make(http.Header, len(w.snapshot)),
+		Body:       w.body.Bytes(),
+	}
+
+	// Trailers are either declared in the Trailer header before the status
+	// is written, or set with the trailerPrefix afterwards
+	declared := make(map[string]bool)
+	for _, v := range w.snapshot["Trailer"] {
+		for _, k := range strings.Split(v, ",") {
+			declared[http.CanonicalHeaderKey(strings.TrimSpace(k))] = true
+		}
+	}
+	for k, v := range w.snapshot {
+		if k == "Trailer" || declared[k] || strings.HasPrefix(k, trailerPrefix) {
+			continue
+		}
+		fr.Header[k] = v
+	}
+	for k, v := range w.header {
+		var trailer string
+		switch {
+		case strings.HasPrefix(k, trailerPrefix):
+			trailer = http.CanonicalHeaderKey(strings.TrimPrefix(k, trailerPrefix))
+		case declared[k]:
+			trailer = k
+		default:
+			continue
+		}
+		if fr.Trailer == nil {
+			fr.Trailer = make(http.Header)
+		}
+		fr.Trailer[trailer] = v
+	}
+
+	return fr
+}
+
+func cloneHeader(h http.Header) http.Header {
+	ret := make(http.Header, len(h))
+	for k, v := range h {
+		ret[k] = append([]string(nil), v...)
+	}
+	return ret
+}
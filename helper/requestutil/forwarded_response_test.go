@@ -0,0 +1,151 @@
+package requestutil
+
+import (
+	"bufio"
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func testForwardedResponseHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Vault-Index", "abcd")
+	w.Header().Add("Warning", "one")
+	w.Header().Add("Warning", "two")
+	w.Header().Set("Trailer", "X-Declared")
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte(`{"foo":"bar"}`))
+	w.Header().Set("X-Declared", "declared")
+	w.Header().Set(trailerPrefix+"X-Undeclared", "undeclared")
+}
+
+func TestForwardedResponse_RoundTrip(t *testing.T) {
+	for _, encoding := range SupportedEncodings {
+		req, err := http.NewRequest("GET", "https://pushit.real.good:9281/v1/sys/health", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		freq, err := GenerateForwardedRequest(req, "https://bloopety.bloop:8201", &ForwardingConfig{
+			Encoding: encoding,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Active node
+		respEncoding, ok := ForwardedResponseEncoding(freq)
+		if !ok || respEncoding != encoding {
+			t.Fatalf("%s: bad response encoding %q", encoding, respEncoding)
+		}
+		rw := NewForwardedResponseWriter()
+		testForwardedResponseHandler(rw, req)
+		rec := httptest.NewRecorder()
+		if err := WriteForwardedResponse(rec, respEncoding, rw.Response()); err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+
+		// Standby
+		fr, err := ParseForwardedResponse(rec.Result())
+		if err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+		if fr.StatusCode != http.StatusAccepted {
+			t.Fatalf("%s: bad status code: %d", encoding, fr.StatusCode)
+		}
+		if fr.Header.Get("X-Vault-Index") != "abcd" {
+			t.Fatalf("%s: bad header: %#v", encoding, fr.Header)
+		}
+		if !reflect.DeepEqual(fr.Header["Warning"], []string{"one", "two"}) {
+			t.Fatalf("%s: bad warnings: %#v", encoding, fr.Header["Warning"])
+		}
+		if _, ok := fr.Header["Trailer"]; ok {
+			t.Fatalf("%s: trailer declaration should not be a header", encoding)
+		}
+		expectedTrailer := http.Header{
+			"X-Declared":   []string{"declared"},
+			"X-Undeclared": []string{"undeclared"},
+		}
+		if !reflect.DeepEqual(fr.Trailer, expectedTrailer) {
+			t.Fatalf("%s: bad trailer: %#v", encoding, fr.Trailer)
+		}
+
+		// Copy it out through a real server so that trailers are sent
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			CopyForwardedResponse(w, fr)
+		}))
+		resp, err := http.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := bytes.NewBuffer(nil)
+		body.ReadFrom(resp.Body)
+		resp.Body.Close()
+		server.Close()
+
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("%s: bad status code: %d", encoding, resp.StatusCode)
+		}
+		if body.String() != `{"foo":"bar"}` {
+			t.Fatalf("%s: bad body: %s", encoding, body.String())
+		}
+		if resp.Header.Get("X-Vault-Index") != "abcd" || resp.Header.Get("Content-Type") != "application/json" {
+			t.Fatalf("%s: bad headers: %#v", encoding, resp.Header)
+		}
+		if resp.Trailer.Get("X-Declared") != "declared" || resp.Trailer.Get("X-Undeclared") != "undeclared" {
+			t.Fatalf("%s: bad trailers: %#v", encoding, resp.Trailer)
+		}
+	}
+}
+
+func TestForwardedResponse_Legacy(t *testing.T) {
+	// Requests from older standbys do not ask for an envelope
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewBufferString("POST / HTTP/1.1\r\nHost: bloopety.bloop\r\nContent-Length: 0\r\n\r\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := ForwardedResponseEncoding(req); ok {
+		t.Fatal("expected no response encoding")
+	}
+
+	// Responses from older active nodes are written directly
+	rec := httptest.NewRecorder()
+	testForwardedResponseHandler(rec, req)
+	fr, err := ParseForwardedResponse(rec.Result())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fr.StatusCode != http.StatusAccepted {
+		t.Fatalf("bad status code: %d", fr.StatusCode)
+	}
+	if fr.Header.Get("X-Vault-Index") != "abcd" {
+		t.Fatalf("bad header: %#v", fr.Header)
+	}
+	if string(fr.Body) != `{"foo":"bar"}` {
+		t.Fatalf("bad body: %s", fr.Body)
+	}
+}
+
+func TestForwardedResponseWriter_DefaultStatus(t *testing.T) {
+	rw := NewForwardedResponseWriter()
+	fr := rw.Response()
+	if fr.StatusCode != http.StatusOK {
+		t.Fatalf("bad status code: %d", fr.StatusCode)
+	}
+
+	rw = NewForwardedResponseWriter()
+	rw.Header().Set("X-Before", "before")
+	rw.Write([]byte("hi"))
+	rw.Header().Set("X-After", "after")
+	fr = rw.Response()
+	if fr.StatusCode != http.StatusOK || string(fr.Body) != "hi" {
+		t.Fatalf("bad response: %#v", fr)
+	}
+	if fr.Header.Get("X-Before") != "before" || fr.Header.Get("X-After") != "" {
+		t.Fatalf("headers changed after writing should be ignored: %#v", fr.Header)
+	}
+	if fr.Trailer != nil {
+		t.Fatalf("expected no trailers: %#v", fr.Trailer)
+	}
+}
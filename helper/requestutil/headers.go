@@ -0,0 +1,83 @@
+package requestutil
+
+import (
+	"net/http"
+	"strings"
+)
+
+// hopByHopHeaders are the headers that apply only to a single connection and
+// are never forwarded, as described in RFC 7230 section 6.1
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// DefaultHeaderFilter is the filter used when a ForwardingConfig does not
+// specify one. It forwards every header except hop-by-hop headers.
+var DefaultHeaderFilter = &HeaderFilter{}
+
+// HeaderFilter controls which of the client's headers are included in a
+// forwarded request. Hop-by-hop headers, including any named in the
+// client's Connection header, are always removed.
+type HeaderFilter struct {
+	// If set, only these headers are forwarded
+	Allow []string
+
+	// Headers that are never forwarded. Deny takes precedence over Allow.
+	Deny []string
+
+	// Whether to remove the client's cookies. Vault does not use cookies, but
+	// a load balancer in front of the standby may add its own.
+	RedactCookies bool
+}
+
+// Filter returns a copy of header containing only the headers that should be
+// forwarded. The given header is not modified.
+func (f *HeaderFilter) Filter(header http.Header) http.Header {
+	if header == nil {
+		return nil
+	}
+
+	denied := make(map[string]bool, len(hopByHopHeaders)+len(f.Deny)+1)
+	for _, k := range hopByHopHeaders {
+		denied[k] = true
+	}
+	for _, v := range header["Connection"] {
+		for _, k := range strings.Split(v, ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				denied[http.CanonicalHeaderKey(k)] = true
+			}
+		}
+	}
+	for _, k := range f.Deny {
+		denied[http.CanonicalHeaderKey(k)] = true
+	}
+	if f.RedactCookies {
+		denied["Cookie"] = true
+	}
+
+	var allowed map[string]bool
+	if len(f.Allow) > 0 {
+		allowed = make(map[string]bool, len(f.Allow))
+		for _, k := range f.Allow {
+			allowed[http.CanonicalHeaderKey(k)] = true
+		}
+	}
+
+	ret := make(http.Header, len(header))
+	for k, v := range header {
+		ck := http.CanonicalHeaderKey(k)
+		if denied[ck] || (allowed != nil && !allowed[ck]) {
+			continue
+		}
+		ret[k] = v
+	}
+	return ret
+}
@@ -0,0 +1,97 @@
+package requestutil
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func testFilterHeader() http.Header {
+	return http.Header{
+		"Connection":        []string{"keep-alive, X-Hop"},
+		"Keep-Alive":        []string{"timeout=5"},
+		"Transfer-Encoding": []string{"chunked"},
+		"Upgrade":           []string{"h2c"},
+		"X-Hop":             []string{"hop"},
+		"X-Vault-Token":     []string{"foo"},
+		"Content-Type":      []string{"application/json"},
+		"Cookie":            []string{"lb=1"},
+	}
+}
+
+func TestHeaderFilter(t *testing.T) {
+	cases := []struct {
+		Name     string
+		Filter   *HeaderFilter
+		Expected []string
+	}{
+		{
+			"default",
+			DefaultHeaderFilter,
+			[]string{"Content-Type", "Cookie", "X-Vault-Token"},
+		},
+		{
+			"redact cookies",
+			&HeaderFilter{RedactCookies: true},
+			[]string{"Content-Type", "X-Vault-Token"},
+		},
+		{
+			"deny",
+			&HeaderFilter{Deny: []string{"content-type"}},
+			[]string{"Cookie", "X-Vault-Token"},
+		},
+		{
+			"allow",
+			&HeaderFilter{Allow: []string{"x-vault-token", "x-hop", "cookie"}},
+			[]string{"Cookie", "X-Vault-Token"},
+		},
+		{
+			"allow and deny",
+			&HeaderFilter{Allow: []string{"X-Vault-Token", "Cookie"}, Deny: []string{"Cookie"}},
+			[]string{"X-Vault-Token"},
+		},
+	}
+
+	for _, tc := range cases {
+		header := testFilterHeader()
+		filtered := tc.Filter.Filter(header)
+
+		expected := make(http.Header)
+		for _, k := range tc.Expected {
+			expected[k] = header[k]
+		}
+		if !reflect.DeepEqual(filtered, expected) {
+			t.Fatalf("%s: bad headers: %#v", tc.Name, filtered)
+		}
+		if !reflect.DeepEqual(header, testFilterHeader()) {
+			t.Fatalf("%s: original headers were modified", tc.Name)
+		}
+	}
+}
+
+func TestForwardedRequest_HeaderFilter(t *testing.T) {
+	req, err := http.NewRequest("GET", "https://pushit.real.good:9281/v1/sys/health", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header = testFilterHeader()
+
+	freq, err := GenerateForwardedRequest(req, "https://bloopety.bloop:8201", &ForwardingConfig{
+		HeaderFilter: &HeaderFilter{RedactCookies: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	finalReq, err := ParseForwardedRequest(freq, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := http.Header{
+		"Content-Type":  []string{"application/json"},
+		"X-Vault-Token": []string{"foo"},
+	}
+	if !reflect.DeepEqual(finalReq.Header, expected) {
+		t.Fatalf("bad headers: %#v", finalReq.Header)
+	}
+}
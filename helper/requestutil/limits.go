@@ -0,0 +1,167 @@
+package requestutil
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+const (
+	// DefaultMaxRequestSize is the default limit on the size of a forwarded
+	// request, both as received and once decompressed
+	DefaultMaxRequestSize = 32 * 1024 * 1024
+
+	// DefaultMaxHeaderCount is the default limit on the number of header
+	// values in a forwarded request
+	DefaultMaxHeaderCount = 256
+
+	// DefaultMaxHeaderBytes is the default limit on the combined size of the
+	// header names and values in a forwarded request
+	DefaultMaxHeaderBytes = 1024 * 1024
+
+	// DefaultMaxPeerCertificates is the default limit on the number of client
+	// certificates in a forwarded request
+	DefaultMaxPeerCertificates = 16
+)
+
+// RequestTooLargeError is returned by ParseForwardedRequest when the
+// forwarded request exceeds the configured size limit. It corresponds to an
+// HTTP 413 response.
+type RequestTooLargeError struct {
+	Err string
+}
+
+func (e RequestTooLargeError) Error() string {
+	return e.Err
+}
+
+// InvalidRequestError is returned by ParseForwardedRequest when the forwarded
+// request cannot be decoded or exceeds one of the configured header or
+// certificate limits. It corresponds to an HTTP 400 response.
+type InvalidRequestError struct {
+	Err string
+}
+
+func (e InvalidRequestError) Error() string {
+	return e.Err
+}
+
+// UnauthorizedRequestError is returned by SignatureVerifier when a forwarded
+// request's signature is missing, invalid, stale or replayed. It corresponds
+// to an HTTP 403 response.
+type UnauthorizedRequestError struct {
+	Err string
+}
+
+func (e UnauthorizedRequestError) Error() string {
+	return e.Err
+}
+
+// ErrorStatusCode returns the HTTP status code appropriate for an error
+// returned by ParseForwardedRequest
+func ErrorStatusCode(err error) int {
+	switch err.(type) {
+	case RequestTooLargeError:
+		return http.StatusRequestEntityTooLarge
+	case InvalidRequestError:
+		return http.StatusBadRequest
+	case UnauthorizedRequestError:
+		return http.StatusForbidden
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+func (c *ParseConfig) maxRequestSize() int64 {
+	if c.MaxRequestSize > 0 {
+		return c.MaxRequestSize
+	}
+	return DefaultMaxRequestSize
+}
+
+func (c *ParseConfig) maxHeaderCount() int {
+	if c.MaxHeaderCount > 0 {
+		return c.MaxHeaderCount
+	}
+	return DefaultMaxHeaderCount
+}
+
+func (c *ParseConfig) maxHeaderBytes() int {
+	if c.MaxHeaderBytes > 0 {
+		return c.MaxHeaderBytes
+	}
+	return DefaultMaxHeaderBytes
+}
+
+func (c *ParseConfig) maxPeerCertificates() int {
+	if c.MaxPeerCertificates > 0 {
+		return c.MaxPeerCertificates
+	}
+	return DefaultMaxPeerCertificates
+}
+
+func (c *ParseConfig) maxBatchRequests() int {
+	if c.MaxBatchRequests > 0 {
+		return c.MaxBatchRequests
+	}
+	return DefaultMaxBatchRequests
+}
+
+// validate checks the decoded forwarded request against the configured
+// header and certificate limits
+func (c *ParseConfig) validate(fq *ForwardedRequest) error {
+	if fq.Method == "" {
+		return InvalidRequestError{Err: "forwarded request is missing a method"}
+	}
+	if fq.URL == nil {
+		return InvalidRequestError{Err: "forwarded request is missing a url"}
+	}
+
+	var count, size int
+	for k, values := range fq.Header {
+		count += len(values)
+		for _, v := range values {
+			size += len(k) + len(v)
+		}
+	}
+	// Context metadata is carried in headers by most protocols, so it counts
+	// toward the same limits
+	for k, v := range fq.ContextMetadata {
+		count++
+		size += len(k) + len(v)
+	}
+	if count > c.maxHeaderCount() {
+		return InvalidRequestError{Err: fmt.Sprintf("forwarded request has %d header values, exceeding the limit of %d", count, c.maxHeaderCount())}
+	}
+	if size > c.maxHeaderBytes() {
+		return InvalidRequestError{Err: fmt.Sprintf("forwarded request headers total %d bytes, exceeding the limit of %d", size, c.maxHeaderBytes())}
+	}
+
+	if len(fq.PeerCertificates) > c.maxPeerCertificates() {
+		return InvalidRequestError{Err: fmt.Sprintf("forwarded request has %d peer certificates, exceeding the limit of %d", len(fq.PeerCertificates), c.maxPeerCertificates())}
+	}
+
+	return nil
+}
+
+// readLimited reads all of r, failing with a RequestTooLargeError if it
+// contains more than limit bytes
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := readLimitedTo(&buf, r, limit); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// readLimitedTo behaves like readLimited, except that r is read into buf
+func readLimitedTo(buf *bytes.Buffer, r io.Reader, limit int64) error {
+	if _, err := buf.ReadFrom(io.LimitReader(r, limit+1)); err != nil {
+		return err
+	}
+	if int64(buf.Len()) > limit {
+		return RequestTooLargeError{Err: fmt.Sprintf("forwarded request exceeds the size limit of %d bytes", limit)}
+	}
+	return nil
+}
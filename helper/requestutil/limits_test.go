@@ -0,0 +1,208 @@
+package requestutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func generateTestForwardedRequest(t *testing.T, body []byte, header http.Header, config *ForwardingConfig) *http.Request {
+	req, err := http.NewRequest("PUT", "https://pushit.real.good:9281/v1/secret/foo", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.TLS = &tls.ConnectionState{}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	freq, err := GenerateForwardedRequest(req, "https://bloopety.bloop:8201", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return freq
+}
+
+func TestParseForwardedRequest_DecompressionBomb(t *testing.T) {
+	// Highly compressible, so the payload on the wire is far smaller than
+	// the limit while the decoded request is far larger
+	body := bytes.Repeat([]byte("a"), 4*1024*1024)
+
+	for _, compressionType := range []string{"gzip", "snappy", "lzw"} {
+		freq := generateTestForwardedRequest(t, body, nil, &ForwardingConfig{
+			CompressionType: compressionType,
+			Encoding:        EncodingMsgpack,
+		})
+
+		_, err := ParseForwardedRequest(freq, &ParseConfig{
+			MaxRequestSize: 1024 * 1024,
+		})
+		if _, ok := err.(RequestTooLargeError); !ok {
+			t.Fatalf("%s: expected RequestTooLargeError, got %#v", compressionType, err)
+		}
+		if ErrorStatusCode(err) != http.StatusRequestEntityTooLarge {
+			t.Fatalf("%s: bad status code: %d", compressionType, ErrorStatusCode(err))
+		}
+	}
+}
+
+func TestParseForwardedRequest_PayloadTooLarge(t *testing.T) {
+	body := make([]byte, 2*1024*1024)
+	if _, err := rand.Read(body); err != nil {
+		t.Fatal(err)
+	}
+
+	freq := generateTestForwardedRequest(t, body, nil, &ForwardingConfig{
+		CompressionType: CompressionTypeNone,
+		Encoding:        EncodingMsgpack,
+	})
+	_, err := ParseForwardedRequest(freq, &ParseConfig{
+		MaxRequestSize: 1024 * 1024,
+	})
+	if _, ok := err.(RequestTooLargeError); !ok {
+		t.Fatalf("expected RequestTooLargeError, got %#v", err)
+	}
+}
+
+func TestParseForwardedRequest_StreamTooLarge(t *testing.T) {
+	body := make([]byte, 4*streamChunkSize)
+	if _, err := rand.Read(body); err != nil {
+		t.Fatal(err)
+	}
+
+	freq := generateTestForwardedRequest(t, body, nil, &ForwardingConfig{
+		Streaming: true,
+	})
+	finalReq, err := ParseForwardedRequest(freq, &ParseConfig{
+		MaxRequestSize: 2 * streamChunkSize,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ioutil.ReadAll(finalReq.Body)
+	if _, ok := err.(RequestTooLargeError); !ok {
+		t.Fatalf("expected RequestTooLargeError, got %#v", err)
+	}
+}
+
+func TestParseForwardedRequest_HeaderLimits(t *testing.T) {
+	header := http.Header{}
+	for i := 0; i < 10; i++ {
+		header.Set(fmt.Sprintf("X-Test-%d", i), "foo")
+	}
+
+	_, err := ParseForwardedRequest(generateTestForwardedRequest(t, nil, header, nil), &ParseConfig{
+		MaxHeaderCount: 5,
+	})
+	if _, ok := err.(InvalidRequestError); !ok {
+		t.Fatalf("expected InvalidRequestError, got %#v", err)
+	}
+	if ErrorStatusCode(err) != http.StatusBadRequest {
+		t.Fatalf("bad status code: %d", ErrorStatusCode(err))
+	}
+
+	_, err = ParseForwardedRequest(generateTestForwardedRequest(t, nil, header, nil), &ParseConfig{
+		MaxHeaderBytes: 32,
+	})
+	if _, ok := err.(InvalidRequestError); !ok {
+		t.Fatalf("expected InvalidRequestError, got %#v", err)
+	}
+
+	if _, err := ParseForwardedRequest(generateTestForwardedRequest(t, nil, header, nil), nil); err != nil {
+		t.Fatalf("expected default limits to allow request: %v", err)
+	}
+}
+
+func TestParseForwardedRequest_PeerCertificateLimit(t *testing.T) {
+	fq := &ForwardedRequest{
+		Method:           "GET",
+		URL:              &ForwardedURL{Path: "/v1/sys/health"},
+		PeerCertificates: make([][]byte, DefaultMaxPeerCertificates+1),
+	}
+	contentType, payload, err := encodePayload(fq, EncodingJSON, CompressionTypeNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("POST", "https://bloopety.bloop:8201", bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	_, err = ParseForwardedRequest(req, nil)
+	if _, ok := err.(InvalidRequestError); !ok {
+		t.Fatalf("expected InvalidRequestError, got %#v", err)
+	}
+}
+
+func TestParseForwardedRequest_Malformed(t *testing.T) {
+	for _, payload := range [][]byte{nil, []byte("{not json"), []byte(`{"method":"GET"}`)} {
+		req, err := http.NewRequest("POST", "https://bloopety.bloop:8201", bytes.NewReader(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = ParseForwardedRequest(req, nil)
+		if _, ok := err.(InvalidRequestError); !ok {
+			t.Fatalf("%q: expected InvalidRequestError, got %#v", payload, err)
+		}
+	}
+}
+
+func TestParseForwardedRequest_Strict(t *testing.T) {
+	fq := map[string]interface{}{
+		"version": ForwardedRequestVersion,
+		"method":  "GET",
+		"url": map[string]interface{}{
+			"path": "/v1/sys/health",
+		},
+		"methd": "PUT",
+	}
+
+	for _, encoding := range SupportedEncodings {
+		contentType, payload, err := encodePayload(fq, encoding, CompressionTypeNone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		newReq := func() *http.Request {
+			req, err := http.NewRequest("POST", "https://bloopety.bloop:8201", bytes.NewReader(payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", contentType)
+			return req
+		}
+
+		// Unknown fields are ignored by default
+		if _, err := ParseForwardedRequest(newReq(), nil); err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+
+		_, err = ParseForwardedRequest(newReq(), &ParseConfig{
+			Strict: true,
+		})
+		if _, ok := err.(InvalidRequestError); !ok {
+			t.Fatalf("%s: expected InvalidRequestError, got %#v", encoding, err)
+		}
+	}
+
+	// Requests generated by this node pass strict parsing
+	req, err := http.NewRequest("PUT", "https://pushit.real.good:9281/v1/secret/foo", bytes.NewBufferString(`{"foo":"bar"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, encoding := range SupportedEncodings {
+		freq, err := GenerateForwardedRequest(req, "https://bloopety.bloop:8201", &ForwardingConfig{
+			Encoding: encoding,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ParseForwardedRequest(freq, &ParseConfig{Strict: true}); err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package requestutil
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/armon/go-metrics"
+)
+
+func TestForwardedRequest_Metrics(t *testing.T) {
+	inm := metrics.NewInmemSink(time.Minute, time.Minute)
+	conf := metrics.DefaultConfig("vault")
+	conf.EnableHostname = false
+	conf.EnableRuntimeMetrics = false
+	if _, err := metrics.NewGlobal(conf, inm); err != nil {
+		t.Fatal(err)
+	}
+	defer metrics.NewGlobal(conf, &metrics.BlackholeSink{})
+
+	body := bytes.Repeat([]byte("a"), 4096)
+	req, err := http.NewRequest("PUT", "https://pushit.real.good:9281/v1/secret/foo", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	freq, err := GenerateForwardedRequest(req, "https://bloopety.bloop:8201", &ForwardingConfig{
+		Encoding:        EncodingMsgpack,
+		CompressionType: "gzip",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseForwardedRequest(freq, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Failures
+	if _, err := GenerateForwardedRequest(req, "http://bloopety.bloop:8201", nil); err == nil {
+		t.Fatal("expected error")
+	}
+	bad, err := http.NewRequest("POST", "https://bloopety.bloop:8201", bytes.NewBufferString("bad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ParseForwardedRequest(bad, nil); err == nil {
+		t.Fatal("expected error")
+	}
+
+	data := inm.Data()
+	if len(data) != 1 {
+		t.Fatalf("bad intervals: %d", len(data))
+	}
+	intv := data[0]
+
+	for _, key := range []string{
+		"vault.forwarding.generate",
+		"vault.forwarding.parse",
+	} {
+		if s, ok := intv.Samples[key]; !ok || s.Count != 2 {
+			t.Fatalf("bad timer %s: %v", key, s)
+		}
+	}
+	for _, key := range []string{
+		"vault.forwarding.generate.error",
+		"vault.forwarding.parse.error",
+	} {
+		if c, ok := intv.Counters[key]; !ok || c.Count != 1 {
+			t.Fatalf("bad counter %s: %v", key, c)
+		}
+	}
+
+	encoded := intv.Samples["vault.forwarding.generate.encoded_size"]
+	payload := intv.Samples["vault.forwarding.generate.payload_size"]
+	if encoded == nil || payload == nil {
+		t.Fatalf("missing size samples: %#v", intv.Samples)
+	}
+	if encoded.Sum <= float64(len(body)) || payload.Sum >= encoded.Sum {
+		t.Fatalf("bad sizes: encoded %v, payload %v", encoded.Sum, payload.Sum)
+	}
+	received := intv.Samples["vault.forwarding.parse.payload_size"]
+	decoded := intv.Samples["vault.forwarding.parse.decoded_size"]
+	if received == nil || decoded == nil {
+		t.Fatalf("missing size samples: %#v", intv.Samples)
+	}
+	if received.Sum != payload.Sum || decoded.Sum != encoded.Sum {
+		t.Fatalf("bad sizes: received %v, decoded %v", received.Sum, decoded.Sum)
+	}
+}
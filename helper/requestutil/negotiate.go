@@ -0,0 +1,103 @@
+package requestutil
+
+import (
+	"github.com/hashicorp/vault/helper/compressutil"
+)
+
+const (
+	// CompressionTypeNone disables compression of the forwarded request
+	CompressionTypeNone = "none"
+
+	// EncodingJSON encodes the forwarded request as JSON. Every node that
+	// supports request forwarding can decode it.
+	EncodingJSON = "json"
+
+	// EncodingMsgpack encodes the forwarded request as msgpack, which avoids
+	// the base64 expansion of the request body that JSON incurs.
+	EncodingMsgpack = "msgpack"
+)
+
+// SupportedCompressionTypes are the compression types that
+// ParseForwardedRequest understands, in order of preference. The active node
+// advertises these so that standbys can pick a type both sides support.
+var SupportedCompressionTypes = supportedCompressionTypes()
+
+func supportedCompressionTypes() []string {
+	types := []string{
+		compressutil.CompressionTypeGzip,
+		compressutil.CompressionTypeSnappy,
+		compressutil.CompressionTypeLzw,
+	}
+	if compressutil.ZstdSupported {
+		types = append(types, compressutil.CompressionTypeZstd)
+	}
+	return append(types, CompressionTypeNone)
+}
+
+// SupportedEncodings are the payload encodings that ParseForwardedRequest
+// understands, in order of preference.
+var SupportedEncodings = []string{
+	EncodingMsgpack,
+	EncodingJSON,
+}
+
+// ValidCompressionType returns whether the given compression type can be
+// used for forwarded requests
+func ValidCompressionType(compressionType string) bool {
+	return contains(SupportedCompressionTypes, compressionType)
+}
+
+// ValidEncoding returns whether the given encoding can be used for forwarded
+// requests
+func ValidEncoding(encoding string) bool {
+	return contains(SupportedEncodings, encoding)
+}
+
+// NegotiateCompressionType returns the compression type to use when
+// forwarding to a node advertising the given supported types. The preferred
+// type is used if the peer supports it; otherwise the first mutually
+// supported type is used. Peers that advertise nothing predate negotiation and
+// only understand LZW.
+func NegotiateCompressionType(preferred string, peerTypes []string) string {
+	return negotiate(preferred, SupportedCompressionTypes, peerTypes, compressutil.CompressionTypeLzw)
+}
+
+// NegotiateEncoding returns the payload encoding to use when forwarding to a
+// node advertising the given supported encodings, following the same rules
+// as NegotiateCompressionType. Peers that advertise nothing only understand
+// JSON.
+func NegotiateEncoding(preferred string, peerEncodings []string) string {
+	return negotiate(preferred, SupportedEncodings, peerEncodings, EncodingJSON)
+}
+
+// NegotiateFeature returns whether the given optional feature may be used
+// when forwarding to a node advertising the given features
+func NegotiateFeature(feature string, peerFeatures []string) bool {
+	return contains(SupportedFeatures, feature) && contains(peerFeatures, feature)
+}
+
+func negotiate(preferred string, local, peer []string, fallback string) string {
+	if len(peer) == 0 {
+		return fallback
+	}
+
+	if preferred != "" && contains(local, preferred) && contains(peer, preferred) {
+		return preferred
+	}
+	for _, l := range local {
+		if contains(peer, l) {
+			return l
+		}
+	}
+
+	return fallback
+}
+
+func contains(haystack []string, needle string) bool {
+	for _, item := range haystack {
+		if item == needle {
+			return true
+		}
+	}
+	return false
+}
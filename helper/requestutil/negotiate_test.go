@@ -0,0 +1,71 @@
+package requestutil
+
+import (
+	"testing"
+)
+
+func TestNegotiateCompressionType(t *testing.T) {
+	cases := []struct {
+		preferred string
+		peer      []string
+		expected  string
+	}{
+		// Peers that predate negotiation only understand LZW
+		{"gzip", nil, "lzw"},
+		{"", nil, "lzw"},
+		// Preferred type supported by the peer
+		{"snappy", SupportedCompressionTypes, "snappy"},
+		{"none", SupportedCompressionTypes, "none"},
+		// No preference; use our first choice
+		{"", SupportedCompressionTypes, "gzip"},
+		// Preference not supported by the peer
+		{"snappy", []string{"lzw", "gzip"}, "gzip"},
+		// Nothing in common
+		{"gzip", []string{"brotli"}, "lzw"},
+	}
+
+	for _, c := range cases {
+		actual := NegotiateCompressionType(c.preferred, c.peer)
+		if actual != c.expected {
+			t.Fatalf("preferred %q, peer %v: expected %q, got %q", c.preferred, c.peer, c.expected, actual)
+		}
+	}
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	cases := []struct {
+		preferred string
+		peer      []string
+		expected  string
+	}{
+		// Peers that predate negotiation only understand JSON
+		{"", nil, "json"},
+		{"msgpack", nil, "json"},
+		// No preference; use our first choice
+		{"", SupportedEncodings, "msgpack"},
+		{"json", SupportedEncodings, "json"},
+		// Preference not supported by the peer
+		{"msgpack", []string{"json"}, "json"},
+		// Preference not supported locally
+		{"protobuf", []string{"protobuf", "json"}, "json"},
+	}
+
+	for _, c := range cases {
+		actual := NegotiateEncoding(c.preferred, c.peer)
+		if actual != c.expected {
+			t.Fatalf("preferred %q, peer %v: expected %q, got %q", c.preferred, c.peer, c.expected, actual)
+		}
+	}
+}
+
+func TestNegotiateFeature(t *testing.T) {
+	if NegotiateFeature(FeatureStreaming, nil) {
+		t.Fatal("streaming should not be used with peers that predate it")
+	}
+	if !NegotiateFeature(FeatureStreaming, SupportedFeatures) {
+		t.Fatal("streaming should be used when supported by both sides")
+	}
+	if NegotiateFeature("teleportation", []string{"teleportation"}) {
+		t.Fatal("unknown features should never be used")
+	}
+}
@@ -0,0 +1,62 @@
+package requestutil
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// The largest buffer returned to the pool. Larger buffers are left for the
+// garbage collector so that an occasional large request does not pin its
+// memory for the life of the process.
+const maxPooledBufferSize = 1024 * 1024
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// getBuffer returns an empty buffer from the pool
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// putBuffer returns a buffer to the pool. The buffer must not be used
+// afterwards.
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	bufferPool.Put(buf)
+}
+
+// pooledBody is a request body reading from a pooled buffer, which is
+// returned to the pool when the body is closed. The transport may close the
+// body from a different goroutine than the one reading it, so access is
+// serialized.
+type pooledBody struct {
+	l   sync.Mutex
+	buf *bytes.Buffer
+}
+
+func (b *pooledBody) Read(p []byte) (int, error) {
+	b.l.Lock()
+	defer b.l.Unlock()
+	if b.buf == nil {
+		return 0, io.EOF
+	}
+	return b.buf.Read(p)
+}
+
+func (b *pooledBody) Close() error {
+	b.l.Lock()
+	defer b.l.Unlock()
+	if b.buf != nil {
+		putBuffer(b.buf)
+		b.buf = nil
+	}
+	return nil
+}
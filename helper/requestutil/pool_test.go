@@ -0,0 +1,124 @@
+package requestutil
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestPooledBody(t *testing.T) {
+	buf := getBuffer()
+	buf.WriteString("payload")
+	body := &pooledBody{buf: buf}
+
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "payload" {
+		t.Fatalf("bad body: %s", data)
+	}
+
+	body.Close()
+	body.Close()
+	if n, err := body.Read(make([]byte, 1)); n != 0 || err == nil {
+		t.Fatalf("expected EOF after close, got %d, %v", n, err)
+	}
+}
+
+func TestForwardedRequest_PooledBuffersReused(t *testing.T) {
+	// Generating and parsing many requests concurrently must not let a
+	// pooled buffer be shared between requests
+	done := make(chan error)
+	for i := 0; i < 8; i++ {
+		go func(i int) {
+			var err error
+			for j := 0; j < 100 && err == nil; j++ {
+				body := bytes.Repeat([]byte{byte('a' + i)}, 512+j)
+				err = testForwardedRequestPoolRoundTrip(body)
+			}
+			done <- err
+		}(i)
+	}
+	for i := 0; i < 8; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func testForwardedRequestPoolRoundTrip(body []byte) error {
+	req, err := http.NewRequest("PUT", "https://pushit.real.good:9281/v1/secret/foo", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	freq, err := GenerateForwardedRequest(req, "https://bloopety.bloop:8201", &ForwardingConfig{
+		CompressionType: "snappy",
+		Encoding:        EncodingMsgpack,
+	})
+	if err != nil {
+		return err
+	}
+	defer freq.Body.Close()
+
+	finalReq, err := ParseForwardedRequest(freq, nil)
+	if err != nil {
+		return err
+	}
+	finalBody, err := ioutil.ReadAll(finalReq.Body)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(finalBody, body) {
+		return fmt.Errorf("bad body: expected %d bytes of %q, got %q", len(body), body[0], finalBody)
+	}
+	return nil
+}
+
+func BenchmarkForwardedRequest_Small(b *testing.B) {
+	for _, compressionType := range []string{"snappy", "gzip", CompressionTypeNone} {
+		for _, encoding := range SupportedEncodings {
+			b.Run(compressionType+"/"+encoding, func(b *testing.B) {
+				benchmarkForwardedRequestSmall(b, compressionType, encoding)
+			})
+		}
+	}
+}
+
+// benchmarkForwardedRequestSmall simulates sustained standby load of small
+// requests such as token lookups
+func benchmarkForwardedRequestSmall(b *testing.B, compressionType, encoding string) {
+	body := []byte(`{"token":"6c0d3770-f1b6-7f8e-fb1c-e2a1d0f2b2c3"}`)
+	header := http.Header{
+		"X-Vault-Token": []string{"6c0d3770-f1b6-7f8e-fb1c-e2a1d0f2b2c3"},
+		"Content-Type":  []string{"application/json"},
+		"User-Agent":    []string{"Go-http-client/1.1"},
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			req, err := http.NewRequest("POST", "https://pushit.real.good:9281/v1/auth/token/lookup", bytes.NewReader(body))
+			if err != nil {
+				b.Fatal(err)
+			}
+			req.Header = header
+
+			freq, err := GenerateForwardedRequest(req, "https://bloopety.bloop:8201", &ForwardingConfig{
+				CompressionType: compressionType,
+				Encoding:        encoding,
+			})
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := ParseForwardedRequest(freq, nil); err != nil {
+				b.Fatal(err)
+			}
+			// The transport closes the body once the request is sent
+			freq.Body.Close()
+		}
+	})
+}
@@ -0,0 +1,156 @@
+package requestutil
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+)
+
+const (
+	// FeatureSigning indicates that a node requires forwarded requests to be
+	// signed
+	FeatureSigning = "signing"
+
+	// DefaultSignatureWindow is how far a signed request's timestamp may be
+	// from the verifying node's clock
+	DefaultSignatureWindow = 30 * time.Second
+
+	headerSignature          = "X-Vault-Forwarded-Signature"
+	headerSignatureKeyID     = "X-Vault-Forwarded-Key-ID"
+	headerSignatureTimestamp = "X-Vault-Forwarded-Timestamp"
+	headerSignatureNonce     = "X-Vault-Forwarded-Nonce"
+)
+
+// SigningKeyID returns the ID of the key a forwarded request claims to be
+// signed with, so that the verifying node can look the key up. The ID is
+// covered by the signature.
+func SigningKeyID(req *http.Request) string {
+	return req.Header.Get(headerSignatureKeyID)
+}
+
+// signRequest signs the encoded payload of a forwarded request with key. The
+// signature covers the key ID, a timestamp and a random nonce, which the
+// verifying node uses to reject stale and replayed requests.
+func signRequest(req *http.Request, key []byte, keyID string, payload []byte) error {
+	nonce, err := uuid.GenerateUUID()
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	if keyID != "" {
+		req.Header.Set(headerSignatureKeyID, keyID)
+	}
+	req.Header.Set(headerSignatureTimestamp, timestamp)
+	req.Header.Set(headerSignatureNonce, nonce)
+	req.Header.Set(headerSignature, base64.StdEncoding.EncodeToString(
+		requestSignature(key, keyID, timestamp, nonce, req.Header.Get("Content-Type"), payload)))
+	return nil
+}
+
+func requestSignature(key []byte, keyID, timestamp, nonce, contentType string, payload []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(keyID))
+	mac.Write([]byte{0})
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte{0})
+	mac.Write([]byte(nonce))
+	mac.Write([]byte{0})
+	mac.Write([]byte(contentType))
+	mac.Write([]byte{0})
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// SignatureVerifier verifies signed forwarded requests. It remembers the
+// nonces of the requests it has accepted for the length of the signature
+// window so that a captured request cannot be replayed.
+type SignatureVerifier struct {
+	window time.Duration
+
+	l         sync.Mutex
+	nonces    map[string]time.Time
+	lastPrune time.Time
+}
+
+// NewSignatureVerifier returns a verifier accepting requests whose timestamp
+// is within window of the local clock. A window of zero uses
+// DefaultSignatureWindow.
+func NewSignatureVerifier(window time.Duration) *SignatureVerifier {
+	if window <= 0 {
+		window = DefaultSignatureWindow
+	}
+	return &SignatureVerifier{
+		window: window,
+		nonces: make(map[string]time.Time),
+	}
+}
+
+// Verify checks the signature on a forwarded request against key. The body
+// is read, up to the request size limit of config, and replaced so that the
+// request can still be passed to ParseForwardedRequest with the same config.
+// Streamed requests are never signed.
+func (v *SignatureVerifier) Verify(req *http.Request, key []byte, config *ParseConfig) error {
+	if config == nil {
+		config = &ParseConfig{}
+	}
+
+	timestamp := req.Header.Get(headerSignatureTimestamp)
+	nonce := req.Header.Get(headerSignatureNonce)
+	signature, err := base64.StdEncoding.DecodeString(req.Header.Get(headerSignature))
+	switch {
+	case err != nil:
+		return UnauthorizedRequestError{Err: "forwarded request has a malformed signature"}
+	case len(signature) == 0 || timestamp == "" || nonce == "":
+		return UnauthorizedRequestError{Err: "forwarded request is not signed"}
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return UnauthorizedRequestError{Err: "forwarded request has a malformed signature timestamp"}
+	}
+	issued := time.Unix(0, ts)
+	now := time.Now()
+	if issued.Before(now.Add(-v.window)) || issued.After(now.Add(v.window)) {
+		return UnauthorizedRequestError{Err: "forwarded request signature has expired"}
+	}
+
+	payload, err := readLimited(req.Body, config.maxRequestSize())
+	if err != nil {
+		return err
+	}
+	req.Body = bufCloser{
+		Buffer: bytes.NewBuffer(payload),
+	}
+
+	expected := requestSignature(key, SigningKeyID(req), timestamp, nonce, req.Header.Get("Content-Type"), payload)
+	if !hmac.Equal(signature, expected) {
+		return UnauthorizedRequestError{Err: "forwarded request has an invalid signature"}
+	}
+
+	v.l.Lock()
+	defer v.l.Unlock()
+	if now.Sub(v.lastPrune) > time.Second {
+		for n, expires := range v.nonces {
+			if now.After(expires) {
+				delete(v.nonces, n)
+			}
+		}
+		v.lastPrune = now
+	}
+	if _, ok := v.nonces[nonce]; ok {
+		return UnauthorizedRequestError{Err: "forwarded request has already been received"}
+	}
+	// The nonce only needs to be remembered until the timestamp falls
+	// outside of the window, after which the request is rejected anyways
+	v.nonces[nonce] = issued.Add(v.window)
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package requestutil
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func testSignedForwardedRequest(t *testing.T, key []byte) *http.Request {
+	body := bytes.Repeat([]byte("a"), 3*streamChunkSize)
+	req, err := http.NewRequest("PUT", "https://pushit.real.good:9281/v1/secret/foo", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.ContentLength = -1
+
+	freq, err := GenerateForwardedRequest(req, "https://bloopety.bloop:8201", &ForwardingConfig{
+		Streaming:    true,
+		SigningKey:   key,
+		SigningKeyID: "1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return freq
+}
+
+func TestForwardedRequest_Signing(t *testing.T) {
+	key := []byte("cluster-signing-key")
+	verifier := NewSignatureVerifier(0)
+
+	freq := testSignedForwardedRequest(t, key)
+	if freq.Header.Get("Content-Type") == contentTypeStream {
+		t.Fatal("signed requests should not be streamed")
+	}
+	if SigningKeyID(freq) != "1" {
+		t.Fatalf("bad key id: %q", SigningKeyID(freq))
+	}
+	if err := verifier.Verify(freq, key, nil); err != nil {
+		t.Fatal(err)
+	}
+	finalReq, err := ParseForwardedRequest(freq, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if finalReq.URL.Path != "/v1/secret/foo" {
+		t.Fatalf("bad path: %s", finalReq.URL.Path)
+	}
+}
+
+func TestForwardedRequest_SigningRejected(t *testing.T) {
+	key := []byte("cluster-signing-key")
+
+	cases := map[string]func(*http.Request){
+		"unsigned": func(req *http.Request) {
+			req.Header.Del(headerSignature)
+		},
+		"malformed": func(req *http.Request) {
+			req.Header.Set(headerSignature, "%%%")
+		},
+		"tampered timestamp": func(req *http.Request) {
+			ts, _ := strconv.ParseInt(req.Header.Get(headerSignatureTimestamp), 10, 64)
+			req.Header.Set(headerSignatureTimestamp, strconv.FormatInt(ts+1, 10))
+		},
+		"tampered key id": func(req *http.Request) {
+			req.Header.Set(headerSignatureKeyID, "2")
+		},
+		"tampered nonce": func(req *http.Request) {
+			req.Header.Set(headerSignatureNonce, "nonce")
+		},
+		"tampered content type": func(req *http.Request) {
+			req.Header.Set("Content-Type", contentTypeMsgpack)
+		},
+		"tampered payload": func(req *http.Request) {
+			var buf bytes.Buffer
+			buf.ReadFrom(req.Body)
+			payload := buf.Bytes()
+			payload[len(payload)/2] ^= 0xff
+			req.Body = bufCloser{Buffer: bytes.NewBuffer(payload)}
+		},
+		"wrong key": func(req *http.Request) {
+			*req = *testSignedForwardedRequest(t, []byte("other-key"))
+		},
+	}
+
+	for name, tamper := range cases {
+		freq := testSignedForwardedRequest(t, key)
+		tamper(freq)
+		err := NewSignatureVerifier(0).Verify(freq, key, nil)
+		if _, ok := err.(UnauthorizedRequestError); !ok {
+			t.Fatalf("%s: expected unauthorized error, got %v", name, err)
+		}
+		if ErrorStatusCode(err) != http.StatusForbidden {
+			t.Fatalf("%s: bad status code %d", name, ErrorStatusCode(err))
+		}
+	}
+}
+
+func TestForwardedRequest_SigningReplay(t *testing.T) {
+	key := []byte("cluster-signing-key")
+	verifier := NewSignatureVerifier(0)
+
+	freq := testSignedForwardedRequest(t, key)
+	var buf bytes.Buffer
+	buf.ReadFrom(freq.Body)
+	payload := buf.Bytes()
+
+	replay := func() error {
+		freq.Body = bufCloser{Buffer: bytes.NewBuffer(append([]byte(nil), payload...))}
+		return verifier.Verify(freq, key, nil)
+	}
+	if err := replay(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := replay().(UnauthorizedRequestError); !ok {
+		t.Fatal("expected replayed request to be rejected")
+	}
+}
+
+func TestForwardedRequest_SigningExpired(t *testing.T) {
+	key := []byte("cluster-signing-key")
+	verifier := NewSignatureVerifier(time.Second)
+
+	freq, err := http.NewRequest("POST", "https://bloopety.bloop:8201", bytes.NewReader([]byte("payload")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := signRequest(freq, key, "", []byte("payload")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Re-sign with a timestamp outside of the window
+	timestamp := strconv.FormatInt(time.Now().Add(-2*time.Second).UnixNano(), 10)
+	nonce := freq.Header.Get(headerSignatureNonce)
+	freq.Header.Set(headerSignatureTimestamp, timestamp)
+	freq.Header.Set(headerSignature, base64.StdEncoding.EncodeToString(requestSignature(key, "", timestamp, nonce, freq.Header.Get("Content-Type"), []byte("payload"))))
+
+	if _, ok := verifier.Verify(freq, key, nil).(UnauthorizedRequestError); !ok {
+		t.Fatal("expected stale request to be rejected")
+	}
+}
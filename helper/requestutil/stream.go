@@ -0,0 +1,188 @@
+package requestutil
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+)
+
+const (
+	// FeatureStreaming indicates that a node accepts streamed forwarded
+	// requests
+	FeatureStreaming = "streaming"
+
+	contentTypeStream = "application/x-vault-forwarded-stream"
+
+	// The size of the body chunks sent in a streamed request. Bodies of known
+	// length smaller than this are never streamed.
+	streamChunkSize = 64 * 1024
+)
+
+// SupportedFeatures are the optional forwarding features this node accepts.
+// The active node advertises these so that standbys only use features it
+// understands.
+var SupportedFeatures = []string{
+	FeatureStreaming,
+	FeatureBatching,
+}
+
+// A streamed request is a sequence of frames, each a four byte big-endian
+// length followed by that many bytes. The first frame carries the encoded
+// ForwardedRequest without its body; subsequent frames carry chunks of the
+// body, and a zero-length frame marks the end of the body.
+
+// generateStreamingRequest returns a request whose body streams the header
+// frame built from fq followed by the contents of body
+func generateStreamingRequest(body io.ReadCloser, fq *ForwardedRequest, addr, encoding, compressionType string) (*http.Request, error) {
+	header := getBuffer()
+	contentType, _, err := encodePayloadTo(header, fq, encoding, compressionType)
+	if err != nil {
+		putBuffer(header)
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	ret, err := http.NewRequest("POST", addr, pr)
+	if err != nil {
+		putBuffer(header)
+		return nil, err
+	}
+	ret.Header.Set("Content-Type", mime.FormatMediaType(contentTypeStream, map[string]string{
+		"encoding": contentType,
+	}))
+
+	go func() {
+		defer putBuffer(header)
+		pw.CloseWithError(writeStream(pw, header.Bytes(), body))
+	}()
+
+	return ret, nil
+}
+
+// writeStream writes the header frame followed by body frames and the
+// terminating frame
+func writeStream(w io.Writer, header []byte, body io.ReadCloser) error {
+	defer body.Close()
+
+	if err := writeFrame(w, header); err != nil {
+		return err
+	}
+
+	chunk := make([]byte, streamChunkSize)
+	for {
+		n, err := io.ReadFull(body, chunk)
+		if n > 0 {
+			if werr := writeFrame(w, chunk[:n]); werr != nil {
+				return werr
+			}
+		}
+		switch err {
+		case nil:
+		case io.EOF, io.ErrUnexpectedEOF:
+			return writeFrame(w, nil)
+		default:
+			return err
+		}
+	}
+}
+
+// parseStreamingRequest reads the header frame from r into fq and returns a
+// body that reads the remaining frames. Neither the header nor the body may
+// exceed limit bytes.
+func parseStreamingRequest(r io.ReadCloser, contentType string, limit int64, strict bool, fq *ForwardedRequest) (io.ReadCloser, error) {
+	header, err := readFrame(r, limit)
+	if err != nil {
+		return nil, err
+	}
+	if len(header) == 0 {
+		return nil, InvalidRequestError{Err: "forwarded request stream has an empty header"}
+	}
+
+	if _, err := decodePayload(contentType, header, limit, strict, fq); err != nil {
+		return nil, err
+	}
+
+	return &streamBody{
+		r:         r,
+		remaining: limit,
+	}, nil
+}
+
+func writeFrame(w io.Writer, p []byte) error {
+	var length [4]byte
+	binary.BigEndian.PutUint32(length[:], uint32(len(p)))
+	if _, err := w.Write(length[:]); err != nil {
+		return err
+	}
+	if len(p) == 0 {
+		return nil
+	}
+	_, err := w.Write(p)
+	return err
+}
+
+func readFrame(r io.Reader, max int64) ([]byte, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+
+	n := binary.BigEndian.Uint32(length[:])
+	if int64(n) > max {
+		return nil, RequestTooLargeError{Err: fmt.Sprintf("forwarded request stream frame of %d bytes exceeds the limit of %d", n, max)}
+	}
+	if n == 0 {
+		return nil, nil
+	}
+
+	frame := make([]byte, n)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// streamBody reads the body frames of a streamed request
+type streamBody struct {
+	r    io.ReadCloser
+	cur  []byte
+	done bool
+
+	// The number of body bytes that may still be read before the size limit
+	// is exceeded
+	remaining int64
+}
+
+func (s *streamBody) Read(p []byte) (int, error) {
+	for len(s.cur) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+
+		frame, err := readFrame(s.r, streamChunkSize)
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		if len(frame) == 0 {
+			s.done = true
+		}
+		s.remaining -= int64(len(frame))
+		if s.remaining < 0 {
+			return 0, RequestTooLargeError{Err: "forwarded request body exceeds the size limit"}
+		}
+		s.cur = frame
+	}
+
+	n := copy(p, s.cur)
+	s.cur = s.cur[n:]
+	return n, nil
+}
+
+func (s *streamBody) Close() error {
+	return s.r.Close()
+}
@@ -0,0 +1,109 @@
+package requestutil
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestForwardedRequest_Streaming(t *testing.T) {
+	body := make([]byte, 3*streamChunkSize+17)
+	if _, err := rand.Read(body); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, encoding := range SupportedEncodings {
+		req, err := http.NewRequest("PUT", "https://pushit.real.good:9281/v1/secret/foo", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.TLS = &tls.ConnectionState{}
+		req.Header.Set("X-Vault-Token", "foo")
+
+		freq, err := GenerateForwardedRequest(req, "https://bloopety.bloop:8201", &ForwardingConfig{
+			Encoding:  encoding,
+			Streaming: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(freq.Header.Get("Content-Type"), contentTypeStream) {
+			t.Fatalf("%s: expected streamed request, got content type %q", encoding, freq.Header.Get("Content-Type"))
+		}
+
+		finalReq, err := ParseForwardedRequest(freq, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+		if finalReq.Header.Get("X-Vault-Token") != "foo" {
+			t.Fatalf("%s: bad header: %#v", encoding, finalReq.Header)
+		}
+		finalBody, err := ioutil.ReadAll(finalReq.Body)
+		if err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+		if !bytes.Equal(finalBody, body) {
+			t.Fatalf("%s: body mismatch: got %d bytes, expected %d", encoding, len(finalBody), len(body))
+		}
+	}
+}
+
+func TestForwardedRequest_StreamingSmallBody(t *testing.T) {
+	req, err := http.NewRequest("PUT", "https://pushit.real.good:9281/v1/secret/foo", strings.NewReader(`{"foo":"bar"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.TLS = &tls.ConnectionState{}
+
+	freq, err := GenerateForwardedRequest(req, "https://bloopety.bloop:8201", &ForwardingConfig{
+		Streaming: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if freq.Header.Get("Content-Type") != contentTypeJSON {
+		t.Fatalf("expected small body to be buffered, got content type %q", freq.Header.Get("Content-Type"))
+	}
+}
+
+func TestForwardedRequest_StreamingTruncated(t *testing.T) {
+	var buf bytes.Buffer
+	_, header, err := encodePayload(&ForwardedRequest{Method: "PUT", URL: &ForwardedURL{Path: "/"}}, EncodingJSON, CompressionTypeNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFrame(&buf, header); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFrame(&buf, []byte("partial")); err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("POST", "https://bloopety.bloop:8201", &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", mime.FormatMediaType(contentTypeStream, map[string]string{
+		"encoding": contentTypeJSON,
+	}))
+
+	finalReq, err := ParseForwardedRequest(req, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(finalReq.Body); err == nil {
+		t.Fatal("expected error reading truncated stream")
+	}
+}
+
+func TestForwardedRequest_StreamingOversizedFrame(t *testing.T) {
+	buf := bytes.NewBuffer([]byte{0xff, 0xff, 0xff, 0xff})
+	if _, err := readFrame(buf, DefaultMaxRequestSize); err == nil {
+		t.Fatal("expected error reading oversized frame")
+	}
+}
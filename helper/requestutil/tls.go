@@ -0,0 +1,67 @@
+package requestutil
+
+import (
+	"crypto/tls"
+)
+
+// ForwardedConnectionState holds the parameters of the client's TLS
+// connection to the standby so that the active node can enforce policies on,
+// and audit, the connection the client actually made. Peer certificates are
+// carried separately in ForwardedRequest.PeerCertificates.
+type ForwardedConnectionState struct {
+	// The TLS version negotiated with the client, e.g. tls.VersionTLS12
+	Version uint16 `json:"version" codec:"version"`
+
+	HandshakeComplete bool `json:"handshake_complete" codec:"handshake_complete"`
+
+	DidResume bool `json:"did_resume,omitempty" codec:"did_resume,omitempty"`
+
+	// The cipher suite negotiated with the client, e.g.
+	// tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+	CipherSuite uint16 `json:"cipher_suite" codec:"cipher_suite"`
+
+	NegotiatedProtocol string `json:"negotiated_protocol,omitempty" codec:"negotiated_protocol,omitempty"`
+
+	// The server name requested by the client via SNI
+	ServerName string `json:"server_name,omitempty" codec:"server_name,omitempty"`
+
+	// The stapled OCSP response provided to the client, if any
+	OCSPResponse []byte `json:"ocsp_response,omitempty" codec:"ocsp_response,omitempty"`
+}
+
+// NewForwardedConnectionState returns the forwardable parameters of the given
+// connection state, or nil if there is none
+func NewForwardedConnectionState(cs *tls.ConnectionState) *ForwardedConnectionState {
+	if cs == nil {
+		return nil
+	}
+
+	return &ForwardedConnectionState{
+		Version:            cs.Version,
+		HandshakeComplete:  cs.HandshakeComplete,
+		DidResume:          cs.DidResume,
+		CipherSuite:        cs.CipherSuite,
+		NegotiatedProtocol: cs.NegotiatedProtocol,
+		ServerName:         cs.ServerName,
+		OCSPResponse:       cs.OCSPResponse,
+	}
+}
+
+// ConnectionState returns a tls.ConnectionState holding the forwarded
+// parameters. A nil ForwardedConnectionState, as sent by older nodes, yields
+// an empty connection state.
+func (f *ForwardedConnectionState) ConnectionState() *tls.ConnectionState {
+	if f == nil {
+		return &tls.ConnectionState{}
+	}
+
+	return &tls.ConnectionState{
+		Version:            f.Version,
+		HandshakeComplete:  f.HandshakeComplete,
+		DidResume:          f.DidResume,
+		CipherSuite:        f.CipherSuite,
+		NegotiatedProtocol: f.NegotiatedProtocol,
+		ServerName:         f.ServerName,
+		OCSPResponse:       f.OCSPResponse,
+	}
+}
@@ -0,0 +1,179 @@
+package requestutil
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func testClientCertificate(t *testing.T) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			CommonName: "client.example.com",
+		},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter:  time.Now().Add(time.Hour),
+	}
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(certBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestForwardedRequest_TLSState(t *testing.T) {
+	cert := testClientCertificate(t)
+
+	connState := &tls.ConnectionState{
+		Version:            tls.VersionTLS12,
+		HandshakeComplete:  true,
+		CipherSuite:        tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		NegotiatedProtocol: "h2",
+		ServerName:         "vault.example.com",
+		OCSPResponse:       []byte("stapled"),
+		PeerCertificates:   []*x509.Certificate{cert},
+	}
+
+	for _, encoding := range SupportedEncodings {
+		req, err := http.NewRequest("GET", "https://vault.example.com:8200/v1/sys/health", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.TLS = connState
+
+		freq, err := GenerateForwardedRequest(req, "https://bloopety.bloop:8201", &ForwardingConfig{
+			Encoding: encoding,
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+		finalReq, err := ParseForwardedRequest(freq, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+
+		final := finalReq.TLS
+		switch {
+		case final == nil:
+			t.Fatalf("%s: missing tls state", encoding)
+		case final.Version != connState.Version:
+			t.Fatalf("%s: bad version: %x", encoding, final.Version)
+		case final.HandshakeComplete != connState.HandshakeComplete:
+			t.Fatalf("%s: bad handshake complete: %t", encoding, final.HandshakeComplete)
+		case final.CipherSuite != connState.CipherSuite:
+			t.Fatalf("%s: bad cipher suite: %x", encoding, final.CipherSuite)
+		case final.NegotiatedProtocol != connState.NegotiatedProtocol:
+			t.Fatalf("%s: bad negotiated protocol: %s", encoding, final.NegotiatedProtocol)
+		case final.ServerName != connState.ServerName:
+			t.Fatalf("%s: bad server name: %s", encoding, final.ServerName)
+		case !bytes.Equal(final.OCSPResponse, connState.OCSPResponse):
+			t.Fatalf("%s: bad ocsp response: %s", encoding, final.OCSPResponse)
+		case len(final.PeerCertificates) != 1 || !final.PeerCertificates[0].Equal(cert):
+			t.Fatalf("%s: bad peer certificates: %#v", encoding, final.PeerCertificates)
+		}
+	}
+}
+
+func TestForwardedConnectionState_Nil(t *testing.T) {
+	if NewForwardedConnectionState(nil) != nil {
+		t.Fatal("expected nil forwarded state for nil connection state")
+	}
+
+	var f *ForwardedConnectionState
+	if cs := f.ConnectionState(); cs == nil || cs.Version != 0 {
+		t.Fatalf("expected empty connection state, got %#v", cs)
+	}
+}
+
+func TestForwardedRequest_NilTLS(t *testing.T) {
+	for _, encoding := range SupportedEncodings {
+		req, err := http.NewRequest("GET", "http://vault.example.com:8200/v1/sys/health", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.TLS = nil
+
+		freq, err := GenerateForwardedRequest(req, "https://bloopety.bloop:8201", &ForwardingConfig{
+			Encoding: encoding,
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+		finalReq, err := ParseForwardedRequest(freq, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", encoding, err)
+		}
+		if finalReq.TLS != nil {
+			t.Fatalf("%s: expected nil tls state, got %#v", encoding, finalReq.TLS)
+		}
+	}
+}
+
+func TestForwardedRequest_DisablePeerCertificates(t *testing.T) {
+	req, err := http.NewRequest("GET", "https://vault.example.com:8200/v1/sys/health", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.TLS = &tls.ConnectionState{
+		Version:          tls.VersionTLS12,
+		PeerCertificates: []*x509.Certificate{testClientCertificate(t)},
+	}
+
+	freq, err := GenerateForwardedRequest(req, "https://bloopety.bloop:8201", &ForwardingConfig{
+		DisablePeerCertificates: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	finalReq, err := ParseForwardedRequest(freq, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if finalReq.TLS == nil || finalReq.TLS.Version != tls.VersionTLS12 {
+		t.Fatalf("expected tls state to be forwarded, got %#v", finalReq.TLS)
+	}
+	if len(finalReq.TLS.PeerCertificates) != 0 {
+		t.Fatalf("expected no peer certificates, got %d", len(finalReq.TLS.PeerCertificates))
+	}
+}
+
+func TestForwardedRequest_Insecure(t *testing.T) {
+	req, err := http.NewRequest("GET", "http://vault.example.com:8200/v1/sys/health", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := GenerateForwardedRequest(req, "http://bloopety.bloop:8201", nil); err == nil {
+		t.Fatal("expected error forwarding to a plaintext address")
+	}
+
+	freq, err := GenerateForwardedRequest(req, "http://bloopety.bloop:8201", &ForwardingConfig{
+		Insecure: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if freq.URL.Scheme != "http" {
+		t.Fatalf("bad scheme: %s", freq.URL.Scheme)
+	}
+	if _, err := ParseForwardedRequest(freq, nil); err != nil {
+		t.Fatal(err)
+	}
+}
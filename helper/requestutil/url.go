@@ -0,0 +1,86 @@
+package requestutil
+
+import (
+	"net/url"
+)
+
+// ForwardedURL holds every field of a url.URL. url.URL cannot be encoded
+// directly: its Userinfo has no exported fields, and msgpack encodes it via
+// MarshalBinary, which re-parses the URL and loses fields such as Opaque. The
+// field names match the JSON encoding of url.URL so that older nodes decoding
+// the URL into a url.URL continue to work.
+type ForwardedURL struct {
+	Scheme     string             `json:"Scheme" codec:"Scheme"`
+	Opaque     string             `json:"Opaque" codec:"Opaque"`
+	User       *ForwardedUserinfo `json:"User" codec:"User"`
+	Host       string             `json:"Host" codec:"Host"`
+	Path       string             `json:"Path" codec:"Path"`
+	RawPath    string             `json:"RawPath" codec:"RawPath"`
+	ForceQuery bool               `json:"ForceQuery" codec:"ForceQuery"`
+	RawQuery   string             `json:"RawQuery" codec:"RawQuery"`
+	Fragment   string             `json:"Fragment" codec:"Fragment"`
+}
+
+// ForwardedUserinfo holds the contents of a url.Userinfo
+type ForwardedUserinfo struct {
+	Username    string `json:"username" codec:"username"`
+	Password    string `json:"password,omitempty" codec:"password,omitempty"`
+	PasswordSet bool   `json:"password_set,omitempty" codec:"password_set,omitempty"`
+}
+
+// NewForwardedURL returns a ForwardedURL holding the values of the given URL
+func NewForwardedURL(u *url.URL) *ForwardedURL {
+	if u == nil {
+		return nil
+	}
+
+	ret := &ForwardedURL{
+		Scheme:     u.Scheme,
+		Opaque:     u.Opaque,
+		Host:       u.Host,
+		Path:       u.Path,
+		RawPath:    u.RawPath,
+		ForceQuery: u.ForceQuery,
+		RawQuery:   u.RawQuery,
+		Fragment:   u.Fragment,
+	}
+
+	if u.User != nil {
+		password, passwordSet := u.User.Password()
+		ret.User = &ForwardedUserinfo{
+			Username:    u.User.Username(),
+			Password:    password,
+			PasswordSet: passwordSet,
+		}
+	}
+
+	return ret
+}
+
+// URL returns the url.URL represented by the ForwardedURL
+func (f *ForwardedURL) URL() *url.URL {
+	if f == nil {
+		return nil
+	}
+
+	ret := &url.URL{
+		Scheme:     f.Scheme,
+		Opaque:     f.Opaque,
+		Host:       f.Host,
+		Path:       f.Path,
+		RawPath:    f.RawPath,
+		ForceQuery: f.ForceQuery,
+		RawQuery:   f.RawQuery,
+		Fragment:   f.Fragment,
+	}
+
+	switch {
+	case f.User == nil:
+	case f.User.PasswordSet:
+		ret.User = url.UserPassword(f.User.Username, f.User.Password)
+	default:
+		ret.User = url.User(f.User.Username)
+	}
+
+	return ret
+}
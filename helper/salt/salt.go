@@ -7,8 +7,12 @@ import (
 	"encoding/hex"
 	"fmt"
 	"hash"
+	"sort"
+	"strconv"
+	"sync"
 
 	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/jsonutil"
 	"github.com/hashicorp/vault/logical"
 )
 
@@ -16,17 +20,39 @@ const (
 	// DefaultLocation is the path in the view we store our key salt
 	// if no other path is provided.
 	DefaultLocation = "salt"
+
+	// versionsSuffix is appended to the location to store the versions of
+	// a salt once it has been rotated
+	versionsSuffix = "/versions"
 )
 
+// saltVersions is the stored form of a rotated salt. The entry at the
+// location itself always holds the current salt, so a salt that has never
+// been rotated is version 1 without any versions entry.
+type saltVersions struct {
+	Current int            `json:"current"`
+	Salts   map[int]string `json:"salts"`
+}
+
 // Salt is used to manage a persistent salt key which is used to
 // hash values. This allows keys to be generated and recovered
 // using the global salt. Primarily, this allows paths in the storage
 // backend to be obfuscated if they may contain sensitive information.
+//
+// A salt can be rotated, which makes a new salt the current version while
+// previous versions are retained read-only, so that values hashed with
+// them can still be reproduced, e.g. to correlate historical audit entries.
 type Salt struct {
 	config    *Config
+	view      logical.Storage
 	salt      string
 	generated bool
 	hmacType  string
+
+	// The current version, and the salt of every version including it
+	version  int
+	versions map[int]string
+	l        sync.RWMutex
 }
 
 type HashFunc func([]byte) []byte
@@ -65,18 +91,38 @@ func NewSalt(view logical.Storage, config *Config) (*Salt, error) {
 
 	// Create the salt
 	s := &Salt{
-		config: config,
+		config:  config,
+		view:    view,
+		version: 1,
 	}
 
-	// Look for the salt
-	raw, err := view.Get(config.Location)
+	// Look for the versions, which exist once the salt has been rotated
+	raw, err := view.Get(config.Location + versionsSuffix)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read salt: %v", err)
+		return nil, fmt.Errorf("failed to read salt versions: %v", err)
 	}
-
-	// Restore the salt if it exists
 	if raw != nil {
-		s.salt = string(raw.Value)
+		var versions saltVersions
+		if err := jsonutil.DecodeJSON(raw.Value, &versions); err != nil {
+			return nil, fmt.Errorf("failed to decode salt versions: %v", err)
+		}
+		if versions.Salts[versions.Current] == "" {
+			return nil, fmt.Errorf("current salt version %d is missing", versions.Current)
+		}
+		s.version = versions.Current
+		s.versions = versions.Salts
+		s.salt = versions.Salts[versions.Current]
+	} else {
+		// Look for the salt
+		raw, err = view.Get(config.Location)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read salt: %v", err)
+		}
+
+		// Restore the salt if it exists
+		if raw != nil {
+			s.salt = string(raw.Value)
+		}
 	}
 
 	// Generate a new salt if necessary
@@ -97,6 +143,12 @@ func NewSalt(view logical.Storage, config *Config) (*Salt, error) {
 		}
 	}
 
+	if s.versions == nil {
+		s.versions = map[int]string{
+			s.version: s.salt,
+		}
+	}
+
 	if config.HMAC != nil {
 		if len(config.HMACType) == 0 {
 			return nil, fmt.Errorf("HMACType must be defined")
@@ -110,15 +162,17 @@ func NewSalt(view logical.Storage, config *Config) (*Salt, error) {
 // SaltID is used to apply a salt and hash function to an ID to make sure
 // it is not reversible
 func (s *Salt) SaltID(id string) string {
+	s.l.RLock()
+	defer s.l.RUnlock()
 	return SaltID(s.salt, id, s.config.HashFunc)
 }
 
 // GetHMAC is used to apply a salt and hash function to data to make sure it is
 // not reversible, with an additional HMAC
 func (s *Salt) GetHMAC(data string) string {
-	hm := hmac.New(s.config.HMAC, []byte(s.salt))
-	hm.Write([]byte(data))
-	return hex.EncodeToString(hm.Sum(nil))
+	s.l.RLock()
+	defer s.l.RUnlock()
+	return HMACValue(s.salt, data, s.config.HMAC)
 }
 
 // GetIdentifiedHMAC is used to apply a salt and hash function to data to make
@@ -127,6 +181,123 @@ func (s *Salt) GetIdentifiedHMAC(data string) string {
 	return s.hmacType + ":" + s.GetHMAC(data)
 }
 
+// HMACType returns the ID prepended to identified HMACs
+func (s *Salt) HMACType() string {
+	return s.hmacType
+}
+
+// Version returns the current version of the salt
+func (s *Salt) Version() int {
+	s.l.RLock()
+	defer s.l.RUnlock()
+	return s.version
+}
+
+// Versions returns every retained version of the salt in ascending order
+func (s *Salt) Versions() []int {
+	s.l.RLock()
+	defer s.l.RUnlock()
+	ret := make([]int, 0, len(s.versions))
+	for version := range s.versions {
+		ret = append(ret, version)
+	}
+	sort.Ints(ret)
+	return ret
+}
+
+// SaltIDVersion is like SaltID, using the given version of the salt
+func (s *Salt) SaltIDVersion(id string, version int) (string, error) {
+	salt, err := s.versionSalt(version)
+	if err != nil {
+		return "", err
+	}
+	return SaltID(salt, id, s.config.HashFunc), nil
+}
+
+// GetHMACVersion is like GetHMAC, using the given version of the salt
+func (s *Salt) GetHMACVersion(data string, version int) (string, error) {
+	salt, err := s.versionSalt(version)
+	if err != nil {
+		return "", err
+	}
+	return HMACValue(salt, data, s.config.HMAC), nil
+}
+
+// GetIdentifiedHMACVersion is like GetIdentifiedHMAC, using the given version
+// of the salt. The version is included after the ID, as in
+// "hmac-sha256:v2:<hmac>", so that the salt a value was hashed with can be
+// told from the value itself.
+func (s *Salt) GetIdentifiedHMACVersion(data string, version int) (string, error) {
+	hmacValue, err := s.GetHMACVersion(data, version)
+	if err != nil {
+		return "", err
+	}
+	return s.hmacType + ":v" + strconv.Itoa(version) + ":" + hmacValue, nil
+}
+
+func (s *Salt) versionSalt(version int) (string, error) {
+	s.l.RLock()
+	defer s.l.RUnlock()
+	salt, ok := s.versions[version]
+	if !ok {
+		return "", fmt.Errorf("unknown salt version %d", version)
+	}
+	return salt, nil
+}
+
+// Rotate generates a new salt and makes it the current version, returning
+// the new version. Previous versions are retained and can be used with the
+// Version methods. Salts used to derive storage paths, such as with SaltID,
+// should only be rotated if lookups also try previous versions.
+func (s *Salt) Rotate() (int, error) {
+	if s.view == nil {
+		return 0, fmt.Errorf("cannot rotate a salt without storage")
+	}
+
+	newSalt, err := uuid.GenerateUUID()
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate uuid: %v", err)
+	}
+
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	newVersion := s.version + 1
+	versions := &saltVersions{
+		Current: newVersion,
+		Salts:   make(map[int]string, len(s.versions)+1),
+	}
+	for version, salt := range s.versions {
+		versions.Salts[version] = salt
+	}
+	versions.Salts[newVersion] = newSalt
+
+	// Persist the versions first; the entry at the location is only a copy
+	// of the current salt for readers that predate versioning
+	buf, err := jsonutil.EncodeJSON(versions)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode salt versions: %v", err)
+	}
+	if err := s.view.Put(&logical.StorageEntry{
+		Key:   s.config.Location + versionsSuffix,
+		Value: buf,
+	}); err != nil {
+		return 0, fmt.Errorf("failed to persist salt versions: %v", err)
+	}
+	if err := s.view.Put(&logical.StorageEntry{
+		Key:   s.config.Location,
+		Value: []byte(newSalt),
+	}); err != nil {
+		return 0, fmt.Errorf("failed to persist salt: %v", err)
+	}
+
+	s.version = newVersion
+	s.versions = versions.Salts
+	s.salt = newSalt
+
+	return newVersion, nil
+}
+
 // DidGenerate returns if the underlying salt value was generated
 // on initialization or if an existing salt value was loaded
 func (s *Salt) DidGenerate() bool {
@@ -3,6 +3,7 @@ package salt
 import (
 	"crypto/sha1"
 	"crypto/sha256"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/go-uuid"
@@ -85,3 +86,119 @@ func TestSaltID(t *testing.T) {
 		t.Fatalf("mismatch")
 	}
 }
+
+func TestSalt_Rotate(t *testing.T) {
+	inm := &logical.InmemStorage{}
+	conf := &Config{
+		HMAC:     sha256.New,
+		HMACType: "hmac-sha256",
+	}
+
+	salt, err := NewSalt(inm, conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if salt.Version() != 1 {
+		t.Fatalf("bad version: %d", salt.Version())
+	}
+
+	data := "foobarbaz"
+	hmac1 := salt.GetIdentifiedHMAC(data)
+	id1 := salt.SaltID(data)
+
+	version, err := salt.Rotate()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if version != 2 || salt.Version() != 2 {
+		t.Fatalf("bad version: %d", version)
+	}
+	hmac2 := salt.GetIdentifiedHMAC(data)
+	if hmac2 == hmac1 || salt.SaltID(data) == id1 {
+		t.Fatalf("expected values to change after rotation")
+	}
+
+	// Previous versions are still available
+	old, err := salt.GetIdentifiedHMACVersion(data, 1)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if old != "hmac-sha256:v1:"+strings.TrimPrefix(hmac1, "hmac-sha256:") {
+		t.Fatalf("mismatch: %s %s", old, hmac1)
+	}
+	current, err := salt.GetIdentifiedHMACVersion(data, 2)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if current != "hmac-sha256:v2:"+strings.TrimPrefix(hmac2, "hmac-sha256:") {
+		t.Fatalf("mismatch: %s %s", current, hmac2)
+	}
+	oldID, err := salt.SaltIDVersion(data, 1)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if oldID != id1 {
+		t.Fatalf("mismatch: %s %s", oldID, id1)
+	}
+	if _, err := salt.GetHMACVersion(data, 3); err == nil {
+		t.Fatalf("expected error for unknown version")
+	}
+
+	// The legacy location holds the current salt
+	out, err := inm.Get(DefaultLocation)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(out.Value) != salt.salt {
+		t.Fatalf("legacy salt was not updated")
+	}
+
+	// Versions are restored, and the restored salt can rotate further
+	salt2, err := NewSalt(inm, conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if salt2.DidGenerate() {
+		t.Fatalf("unexpected generation")
+	}
+	if salt2.Version() != 2 || salt2.GetIdentifiedHMAC(data) != hmac2 {
+		t.Fatalf("bad restored salt: version %d", salt2.Version())
+	}
+	if old, err := salt2.GetHMACVersion(data, 1); err != nil || old != strings.TrimPrefix(hmac1, "hmac-sha256:") {
+		t.Fatalf("bad restored version 1: %s, %v", old, err)
+	}
+	if _, err := salt2.Rotate(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	versions := salt2.Versions()
+	if len(versions) != 3 || versions[0] != 1 || versions[2] != 3 {
+		t.Fatalf("bad versions: %v", versions)
+	}
+}
+
+func TestSalt_RotateLegacy(t *testing.T) {
+	// A salt persisted before versioning existed
+	inm := &logical.InmemStorage{}
+	if err := inm.Put(&logical.StorageEntry{
+		Key:   DefaultLocation,
+		Value: []byte("legacy-salt"),
+	}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	salt, err := NewSalt(inm, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if salt.DidGenerate() || salt.salt != "legacy-salt" || salt.Version() != 1 {
+		t.Fatalf("bad legacy salt: %#v", salt)
+	}
+	id := salt.SaltID("foo")
+
+	if _, err := salt.Rotate(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if oldID, err := salt.SaltIDVersion("foo", 1); err != nil || oldID != id {
+		t.Fatalf("bad legacy version: %s, %v", oldID, err)
+	}
+}
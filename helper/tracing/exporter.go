@@ -0,0 +1,208 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+)
+
+// OTLPExporter exports spans to an OpenTelemetry collector using the JSON
+// encoding of the OTLP/HTTP protocol
+type OTLPExporter struct {
+	// Endpoint is the URL the spans are posted to, usually ending in
+	// /v1/traces
+	Endpoint string
+
+	// Headers are added to each export request, for example to
+	// authenticate to the collector
+	Headers map[string]string
+
+	client *http.Client
+}
+
+// NewOTLPExporter returns an exporter posting spans to the given endpoint
+func NewOTLPExporter(endpoint string, headers map[string]string) *OTLPExporter {
+	client := cleanhttp.DefaultClient()
+	client.Timeout = 10 * time.Second
+	return &OTLPExporter{
+		Endpoint: endpoint,
+		Headers:  headers,
+		client:   client,
+	}
+}
+
+// ExportSpans implements Exporter
+func (e *OTLPExporter) ExportSpans(serviceName string, spans []*SpanData) error {
+	body, err := json.Marshal(otlpRequest(serviceName, spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", e.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected response from %s: %s", e.Endpoint, resp.Status)
+	}
+	return nil
+}
+
+// WriterExporter writes spans to an io.Writer as OTLP JSON, one export
+// request per line. It is meant for debugging.
+type WriterExporter struct {
+	l sync.Mutex
+	w io.Writer
+}
+
+// NewWriterExporter returns an exporter writing spans to w
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+// ExportSpans implements Exporter
+func (e *WriterExporter) ExportSpans(serviceName string, spans []*SpanData) error {
+	e.l.Lock()
+	defer e.l.Unlock()
+	return json.NewEncoder(e.w).Encode(otlpRequest(serviceName, spans))
+}
+
+// The following types are the JSON encoding of an OTLP
+// ExportTraceServiceRequest
+
+type otlpExportRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+type otlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+const (
+	otlpSpanKindInternal = 1
+
+	otlpStatusCodeUnset = 0
+	otlpStatusCodeError = 2
+)
+
+func otlpRequest(serviceName string, spans []*SpanData) *otlpExportRequest {
+	out := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		s := otlpSpan{
+			TraceID:           span.TraceID.String(),
+			SpanID:            span.SpanID.String(),
+			Name:              span.Name,
+			Kind:              otlpSpanKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(span.Attributes),
+			Status:            otlpStatus{Code: otlpStatusCodeUnset},
+		}
+		if span.ParentSpanID != (SpanID{}) {
+			s.ParentSpanID = span.ParentSpanID.String()
+		}
+		if span.Error != "" {
+			s.Status = otlpStatus{
+				Code:    otlpStatusCodeError,
+				Message: span.Error,
+			}
+		}
+		out = append(out, s)
+	}
+
+	return &otlpExportRequest{
+		ResourceSpans: []otlpResourceSpans{
+			{
+				Resource: otlpResource{
+					Attributes: otlpAttributes(map[string]string{
+						"service.name": serviceName,
+					}),
+				},
+				ScopeSpans: []otlpScopeSpans{
+					{
+						Scope: otlpScope{Name: "github.com/hashicorp/vault"},
+						Spans: out,
+					},
+				},
+			},
+		},
+	}
+}
+
+func otlpAttributes(attributes map[string]string) []otlpAttribute {
+	keys := make([]string, 0, len(attributes))
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := make([]otlpAttribute, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, otlpAttribute{
+			Key:   k,
+			Value: otlpAnyValue{StringValue: attributes[k]},
+		})
+	}
+	return out
+}
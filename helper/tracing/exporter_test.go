@@ -0,0 +1,91 @@
+package tracing
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOTLPExporter(t *testing.T) {
+	var body map[string]interface{}
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("err: %v", err)
+		}
+	}))
+	defer server.Close()
+
+	start := time.Unix(1, 0)
+	span := &SpanData{
+		Name:       "foo",
+		TraceID:    TraceID{1},
+		SpanID:     SpanID{2},
+		Start:      start,
+		End:        start.Add(time.Second),
+		Attributes: map[string]string{"foo": "bar"},
+		Error:      "failed",
+	}
+
+	exporter := NewOTLPExporter(server.URL, map[string]string{"Authorization": "Bearer foo"})
+	if err := exporter.ExportSpans("vault", []*SpanData{span}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if auth != "Bearer foo" {
+		t.Fatalf("bad: %q", auth)
+	}
+
+	resourceSpans := body["resourceSpans"].([]interface{})[0].(map[string]interface{})
+	service := resourceSpans["resource"].(map[string]interface{})["attributes"].([]interface{})[0].(map[string]interface{})
+	if service["key"] != "service.name" || service["value"].(map[string]interface{})["stringValue"] != "vault" {
+		t.Fatalf("bad: %#v", service)
+	}
+
+	spans := resourceSpans["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+	actual := spans[0].(map[string]interface{})
+	expected := map[string]interface{}{
+		"traceId":           "01000000000000000000000000000000",
+		"spanId":            "0200000000000000",
+		"name":              "foo",
+		"kind":              float64(1),
+		"startTimeUnixNano": "1000000000",
+		"endTimeUnixNano":   "2000000000",
+		"attributes": []interface{}{
+			map[string]interface{}{
+				"key":   "foo",
+				"value": map[string]interface{}{"stringValue": "bar"},
+			},
+		},
+		"status": map[string]interface{}{
+			"code":    float64(2),
+			"message": "failed",
+		},
+	}
+	for k, v := range expected {
+		if b1, _ := json.Marshal(actual[k]); string(b1) != mustJSON(t, v) {
+			t.Fatalf("%s: expected %s, got %s", k, mustJSON(t, v), b1)
+		}
+	}
+	if _, ok := actual["parentSpanId"]; ok {
+		t.Fatal("expected no parent span ID")
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	if err := NewOTLPExporter(failing.URL, nil).ExportSpans("vault", []*SpanData{span}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func mustJSON(t *testing.T, v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	return string(b)
+}
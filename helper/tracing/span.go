@@ -0,0 +1,291 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/helper/requestutil"
+)
+
+const (
+	// TraceparentHeaderName is the W3C Trace Context header that carries the
+	// parent of a request's spans from the client
+	TraceparentHeaderName = "traceparent"
+
+	// traceparentMetadataKey is the key of the traceparent in the metadata
+	// of a request context, which request forwarding carries to the active
+	// node
+	traceparentMetadataKey = "traceparent"
+)
+
+// TraceID identifies a trace, which is the tree of spans of a request
+type TraceID [16]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// SpanContext is the part of a span that is propagated to its children,
+// including those in other processes
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// Traceparent returns the span context in the format of the W3C Trace
+// Context traceparent header
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceparent parses a span context in the format of the W3C Trace
+// Context traceparent header
+func ParseTraceparent(value string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		(parts[0] == "00" && len(parts) != 4) {
+		return sc, fmt.Errorf("invalid traceparent %q", value)
+	}
+
+	fields := []struct {
+		value string
+		dst   []byte
+	}{
+		{parts[1], sc.TraceID[:]},
+		{parts[2], sc.SpanID[:]},
+	}
+	for _, f := range fields {
+		if len(f.value) != 2*len(f.dst) {
+			return sc, fmt.Errorf("invalid traceparent %q", value)
+		}
+		if _, err := hex.Decode(f.dst, []byte(f.value)); err != nil {
+			return sc, fmt.Errorf("invalid traceparent %q", value)
+		}
+	}
+	if sc.TraceID == (TraceID{}) || sc.SpanID == (SpanID{}) {
+		return sc, fmt.Errorf("invalid traceparent %q", value)
+	}
+
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || len(flags) != 1 {
+		return sc, fmt.Errorf("invalid traceparent %q", value)
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, nil
+}
+
+// Span is a timed operation within a trace. Spans that are not sampled are
+// not recorded, and all methods of a nil *Span are no-ops, so callers never
+// need to check whether tracing is enabled.
+type Span struct {
+	tracer   *Tracer
+	name     string
+	context  SpanContext
+	parentID SpanID
+	start    time.Time
+
+	l          sync.Mutex
+	end        time.Time
+	attributes map[string]string
+	err        error
+	ended      bool
+}
+
+// Context returns the span context, or the zero value for a nil span
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.context
+}
+
+// SetAttribute records a key/value pair describing the operation
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil || !s.context.Sampled {
+		return
+	}
+	s.l.Lock()
+	defer s.l.Unlock()
+	if s.attributes == nil {
+		s.attributes = make(map[string]string)
+	}
+	s.attributes[key] = value
+}
+
+// SetError marks the operation as failed, if err is not nil
+func (s *Span) SetError(err error) {
+	if s == nil || !s.context.Sampled || err == nil {
+		return
+	}
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.err = err
+}
+
+// End ends the span and queues it for export. Calls after the first have no
+// effect.
+func (s *Span) End() {
+	if s == nil || !s.context.Sampled {
+		return
+	}
+	s.l.Lock()
+	if s.ended {
+		s.l.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	data := &SpanData{
+		Name:         s.name,
+		TraceID:      s.context.TraceID,
+		SpanID:       s.context.SpanID,
+		ParentSpanID: s.parentID,
+		Start:        s.start,
+		End:          s.end,
+		Attributes:   s.attributes,
+	}
+	if s.err != nil {
+		data.Error = s.err.Error()
+	}
+	s.l.Unlock()
+
+	s.tracer.enqueue(data)
+}
+
+// SpanData is the record of an ended span that is exported
+type SpanData struct {
+	Name         string
+	TraceID      TraceID
+	SpanID       SpanID
+	ParentSpanID SpanID
+	Start        time.Time
+	End          time.Time
+	Attributes   map[string]string
+
+	// Error is the message of the error the operation failed with, if any
+	Error string
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpan returns a copy of ctx carrying the span, so that spans
+// started from it are its children
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	ctx = context.WithValue(ctx, spanContextKey{}, span)
+
+	// Carry the span over to the active node if the request is forwarded
+	metadata := map[string]string{}
+	for k, v := range requestutil.MetadataFromContext(ctx) {
+		metadata[k] = v
+	}
+	metadata[traceparentMetadataKey] = span.Context().Traceparent()
+	return requestutil.ContextWithMetadata(ctx, metadata)
+}
+
+// SpanFromContext returns the span carried by ctx, or nil if there is none
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanContextKey{}).(*Span)
+	return span
+}
+
+// ContextWithTraceparent returns a copy of ctx whose spans are the children
+// of the span in the given traceparent, unless ctx already has a parent.
+// Invalid values are ignored.
+func ContextWithTraceparent(ctx context.Context, traceparent string) context.Context {
+	if traceparent == "" || SpanFromContext(ctx) != nil {
+		return ctx
+	}
+	if _, ok := remoteParent(ctx); ok {
+		return ctx
+	}
+	if _, err := ParseTraceparent(traceparent); err != nil {
+		return ctx
+	}
+
+	metadata := map[string]string{}
+	for k, v := range requestutil.MetadataFromContext(ctx) {
+		metadata[k] = v
+	}
+	metadata[traceparentMetadataKey] = traceparent
+	return requestutil.ContextWithMetadata(ctx, metadata)
+}
+
+// remoteParent returns the parent of the spans of a request that came from
+// another process, such as a standby that forwarded the request
+func remoteParent(ctx context.Context) (SpanContext, bool) {
+	value, ok := requestutil.MetadataFromContext(ctx)[traceparentMetadataKey]
+	if !ok {
+		return SpanContext{}, false
+	}
+	sc, err := ParseTraceparent(value)
+	if err != nil {
+		return SpanContext{}, false
+	}
+	return sc, true
+}
+
+// StartSpan starts a span named after the operation. The span is the child
+// of the span in ctx, if any, or else of the remote parent of the request.
+// The returned context carries the new span. If tracing is disabled, ctx is
+// returned with a nil span.
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	t := GlobalTracer()
+	if t == nil {
+		return ctx, nil
+	}
+
+	span := &Span{
+		tracer: t,
+		name:   name,
+		start:  time.Now(),
+	}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.context.TraceID = parent.context.TraceID
+		span.context.Sampled = parent.context.Sampled
+		span.parentID = parent.context.SpanID
+	} else if parent, ok := remoteParent(ctx); ok {
+		span.context.TraceID = parent.TraceID
+		span.context.Sampled = parent.Sampled
+		span.parentID = parent.SpanID
+	} else {
+		if _, err := io.ReadFull(rand.Reader, span.context.TraceID[:]); err != nil {
+			return ctx, nil
+		}
+		span.context.Sampled = t.sample(span.context.TraceID)
+	}
+	if _, err := io.ReadFull(rand.Reader, span.context.SpanID[:]); err != nil {
+		return ctx, nil
+	}
+
+	return ContextWithSpan(ctx, span), span
+}
+
+// StartChildSpan is like StartSpan, but only starts a span if ctx already
+// carries one. It is used for operations that are only worth tracing as
+// part of a request, such as storage operations, which are also performed
+// in the background.
+func StartChildSpan(ctx context.Context, name string) (context.Context, *Span) {
+	if SpanFromContext(ctx) == nil {
+		return ctx, nil
+	}
+	return StartSpan(ctx, name)
+}
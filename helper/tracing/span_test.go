@@ -0,0 +1,146 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/requestutil"
+)
+
+func TestTraceparent(t *testing.T) {
+	value := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceparent(value)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" ||
+		sc.SpanID.String() != "00f067aa0ba902b7" || !sc.Sampled {
+		t.Fatalf("bad: %#v", sc)
+	}
+	if sc.Traceparent() != value {
+		t.Fatalf("bad: %s", sc.Traceparent())
+	}
+
+	sc, err = ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if sc.Sampled {
+		t.Fatal("expected span not to be sampled")
+	}
+
+	// Later versions may add fields
+	if _, err := ParseTraceparent(value + "-foo"); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-foo"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	bad := []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-1",
+	}
+	for _, value := range bad {
+		if _, err := ParseTraceparent(value); err == nil {
+			t.Fatalf("expected error for %q", value)
+		}
+	}
+}
+
+func TestStartSpan(t *testing.T) {
+	// Nothing is traced without a tracer
+	ctx, span := StartSpan(context.Background(), "foo")
+	if span != nil || SpanFromContext(ctx) != nil {
+		t.Fatal("expected no span")
+	}
+	span.SetAttribute("foo", "bar")
+	span.End()
+
+	exporter, done := TestGlobalTracer(t)
+
+	if _, span := StartChildSpan(context.Background(), "orphan"); span != nil {
+		t.Fatal("expected no span without a parent")
+	}
+
+	ctx, root := StartSpan(context.Background(), "root")
+	_, child := StartChildSpan(ctx, "child")
+	child.SetAttribute("foo", "bar")
+	child.SetError(errors.New("failed"))
+	child.End()
+	child.End()
+	root.End()
+
+	// The root span is carried to the active node by request forwarding
+	metadata := requestutil.MetadataFromContext(ctx)
+	if metadata["traceparent"] != root.Context().Traceparent() {
+		t.Fatalf("bad: %#v", metadata)
+	}
+
+	// A remote parent is used when there is no local one
+	remote := ContextWithTraceparent(context.Background(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	_, continued := StartSpan(remote, "continued")
+	continued.End()
+
+	// Traces not sampled upstream are not recorded
+	unsampled := ContextWithTraceparent(context.Background(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	_, skipped := StartSpan(unsampled, "skipped")
+	skipped.End()
+
+	done()
+
+	spans := exporter.Spans()
+	if len(spans) != 3 {
+		t.Fatalf("bad: %#v", spans)
+	}
+	c, r, cont := spans[0], spans[1], spans[2]
+	if c.Name != "child" || r.Name != "root" || cont.Name != "continued" {
+		t.Fatalf("bad: %#v", spans)
+	}
+	if c.TraceID != r.TraceID || c.ParentSpanID != r.SpanID || r.ParentSpanID != (SpanID{}) {
+		t.Fatalf("bad: %#v %#v", c, r)
+	}
+	if c.Attributes["foo"] != "bar" || c.Error != "failed" {
+		t.Fatalf("bad: %#v", c)
+	}
+	if cont.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" ||
+		cont.ParentSpanID.String() != "00f067aa0ba902b7" {
+		t.Fatalf("bad: %#v", cont)
+	}
+}
+
+func TestTracer_sample(t *testing.T) {
+	tracer, err := NewTracer(&TracerConfig{
+		SampleRatio: 0.25,
+		Exporter:    &TestExporter{},
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer tracer.Shutdown()
+
+	var id TraceID
+	if !tracer.sample(id) {
+		t.Fatal("expected trace to be sampled")
+	}
+	for i := range id {
+		id[i] = 0xff
+	}
+	if tracer.sample(id) {
+		t.Fatal("expected trace not to be sampled")
+	}
+
+	if _, err := NewTracer(&TracerConfig{SampleRatio: 2, Exporter: &TestExporter{}}); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := NewTracer(&TracerConfig{}); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,47 @@
+package tracing
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestExporter records the spans it exports, for use in tests
+type TestExporter struct {
+	l     sync.Mutex
+	spans []*SpanData
+}
+
+// ExportSpans implements Exporter
+func (e *TestExporter) ExportSpans(serviceName string, spans []*SpanData) error {
+	e.l.Lock()
+	defer e.l.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+// Spans returns the spans exported so far
+func (e *TestExporter) Spans() []*SpanData {
+	e.l.Lock()
+	defer e.l.Unlock()
+	return append([]*SpanData(nil), e.spans...)
+}
+
+// TestGlobalTracer sets a global tracer that samples every trace and
+// exports to the returned exporter. Calling the returned function exports
+// the remaining spans and disables tracing again.
+func TestGlobalTracer(t *testing.T) (*TestExporter, func()) {
+	exporter := &TestExporter{}
+	tracer, err := NewTracer(&TracerConfig{
+		SampleRatio: 1,
+		Exporter:    exporter,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	SetGlobalTracer(tracer)
+
+	return exporter, func() {
+		SetGlobalTracer(nil)
+		tracer.Shutdown()
+	}
+}
@@ -0,0 +1,197 @@
+package tracing
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+)
+
+const (
+	// DefaultBatchSize is the default maximum number of spans exported at
+	// once
+	DefaultBatchSize = 512
+
+	// DefaultBatchTimeout is the default time after which ended spans are
+	// exported even if the batch is not full
+	DefaultBatchTimeout = 5 * time.Second
+
+	// spanQueueSize is the number of ended spans waiting to be exported
+	// beyond which spans are dropped
+	spanQueueSize = 4096
+)
+
+// Exporter sends ended spans to a tracing system
+type Exporter interface {
+	ExportSpans(serviceName string, spans []*SpanData) error
+}
+
+// TracerConfig is the configuration of a Tracer
+type TracerConfig struct {
+	// ServiceName identifies the process in the exported spans
+	ServiceName string
+
+	// SampleRatio is the fraction of the traces started by this process
+	// that are recorded, between 0 and 1. Traces continued from a parent in
+	// another process follow the sampling decision of the parent.
+	SampleRatio float64
+
+	// Exporter receives the ended spans. Required.
+	Exporter Exporter
+
+	// BatchSize and BatchTimeout control how often spans are exported.
+	// They default to DefaultBatchSize and DefaultBatchTimeout.
+	BatchSize    int
+	BatchTimeout time.Duration
+
+	// Logger is used to report export failures
+	Logger *log.Logger
+}
+
+// Tracer records spans and exports them in batches in the background
+type Tracer struct {
+	serviceName  string
+	sampleRatio  float64
+	exporter     Exporter
+	batchSize    int
+	batchTimeout time.Duration
+	logger       *log.Logger
+
+	queue        chan *SpanData
+	shutdownCh   chan struct{}
+	doneCh       chan struct{}
+	shutdownOnce sync.Once
+}
+
+// NewTracer returns a tracer that exports spans with the configured
+// exporter until it is shut down
+func NewTracer(conf *TracerConfig) (*Tracer, error) {
+	if conf.Exporter == nil {
+		return nil, fmt.Errorf("an exporter is required")
+	}
+	if conf.SampleRatio < 0 || conf.SampleRatio > 1 {
+		return nil, fmt.Errorf("sample ratio must be between 0 and 1")
+	}
+
+	t := &Tracer{
+		serviceName:  conf.ServiceName,
+		sampleRatio:  conf.SampleRatio,
+		exporter:     conf.Exporter,
+		batchSize:    conf.BatchSize,
+		batchTimeout: conf.BatchTimeout,
+		logger:       conf.Logger,
+		queue:        make(chan *SpanData, spanQueueSize),
+		shutdownCh:   make(chan struct{}),
+		doneCh:       make(chan struct{}),
+	}
+	if t.serviceName == "" {
+		t.serviceName = "vault"
+	}
+	if t.batchSize <= 0 {
+		t.batchSize = DefaultBatchSize
+	}
+	if t.batchTimeout <= 0 {
+		t.batchTimeout = DefaultBatchTimeout
+	}
+	if t.logger == nil {
+		t.logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+
+	go t.run()
+	return t, nil
+}
+
+// Shutdown exports the spans that have ended and stops the tracer
+func (t *Tracer) Shutdown() {
+	t.shutdownOnce.Do(func() {
+		close(t.shutdownCh)
+	})
+	<-t.doneCh
+}
+
+// sample decides whether to record a new trace. The decision only depends
+// on the trace ID, so that it is the same everywhere for a given trace.
+func (t *Tracer) sample(id TraceID) bool {
+	if t.sampleRatio >= 1 {
+		return true
+	}
+	x := binary.BigEndian.Uint64(id[8:]) >> 11
+	return float64(x)/(1<<53) < t.sampleRatio
+}
+
+func (t *Tracer) enqueue(span *SpanData) {
+	select {
+	case t.queue <- span:
+	default:
+		metrics.IncrCounter([]string{"tracing", "dropped"}, 1)
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.doneCh)
+
+	ticker := time.NewTicker(t.batchTimeout)
+	defer ticker.Stop()
+
+	batch := make([]*SpanData, 0, t.batchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.exporter.ExportSpans(t.serviceName, batch); err != nil {
+			metrics.IncrCounter([]string{"tracing", "export", "error"}, 1)
+			t.logger.Printf("[ERR] tracing: failed to export %d spans: %v", len(batch), err)
+		}
+		batch = make([]*SpanData, 0, t.batchSize)
+	}
+
+	for {
+		select {
+		case span := <-t.queue:
+			batch = append(batch, span)
+			if len(batch) >= t.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.shutdownCh:
+			for {
+				select {
+				case span := <-t.queue:
+					batch = append(batch, span)
+					if len(batch) >= t.batchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+var (
+	globalTracer     *Tracer
+	globalTracerLock sync.RWMutex
+)
+
+// SetGlobalTracer sets the tracer used by StartSpan. Tracing is disabled if
+// it is nil, which is the default.
+func SetGlobalTracer(t *Tracer) {
+	globalTracerLock.Lock()
+	defer globalTracerLock.Unlock()
+	globalTracer = t
+}
+
+// GlobalTracer returns the tracer used by StartSpan, or nil if tracing is
+// disabled
+func GlobalTracer() *Tracer {
+	globalTracerLock.RLock()
+	defer globalTracerLock.RUnlock()
+	return globalTracer
+}
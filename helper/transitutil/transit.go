@@ -0,0 +1,230 @@
+package transitutil
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/go-rootcerts"
+)
+
+// NamespaceHeader is the header that selects the namespace of a request to
+// a Vault Enterprise server
+const NamespaceHeader = "X-Vault-Namespace"
+
+// Config configures the connection to the Vault server that holds the
+// transit key
+type Config struct {
+	// Address is the URL of the Vault server, such as
+	// "https://vault.example.com:8200"
+	Address string
+
+	// Token authenticates requests
+	Token string
+
+	// Namespace is the namespace of the transit mount, if any
+	Namespace string
+
+	// CACert, CAPath, ClientCert, ClientKey, TLSServerName and Insecure
+	// configure TLS as the VAULT_* environment variables of the CLI do
+	CACert        string
+	CAPath        string
+	ClientCert    string
+	ClientKey     string
+	TLSServerName string
+	Insecure      bool
+}
+
+// Client is a client for the transit secret backend and the token
+// endpoints of a Vault server
+type Client struct {
+	client    *http.Client
+	addr      string
+	namespace string
+	token     string
+}
+
+// NewClient creates a client for the given configuration
+func NewClient(c *Config) (*Client, error) {
+	if c.Address == "" {
+		return nil, fmt.Errorf("the address of the Vault server must be set")
+	}
+	if c.Token == "" {
+		return nil, fmt.Errorf("a token must be set")
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         c.TLSServerName,
+		InsecureSkipVerify: c.Insecure,
+	}
+	err := rootcerts.ConfigureTLS(tlsConfig, &rootcerts.Config{
+		CAFile: c.CACert,
+		CAPath: c.CAPath,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if c.ClientCert != "" || c.ClientKey != "" {
+		cert, err := tls.LoadX509KeyPair(c.ClientCert, c.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	client := cleanhttp.DefaultClient()
+	client.Timeout = 60 * time.Second
+	transport := client.Transport.(*http.Transport)
+	transport.TLSHandshakeTimeout = 10 * time.Second
+	transport.TLSClientConfig = tlsConfig
+
+	return &Client{
+		client:    client,
+		addr:      strings.TrimSuffix(c.Address, "/"),
+		namespace: c.Namespace,
+		token:     c.Token,
+	}, nil
+}
+
+// Encrypt encrypts the plaintext with the latest version of the named key
+// of the transit backend at the given mount path, returning the ciphertext
+// in the "vault:v<version>:" format
+func (c *Client) Encrypt(mount, key string, plaintext []byte) (string, error) {
+	var out struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+	err := c.do("POST", mount+"/encrypt/"+key, map[string]string{
+		"plaintext": base64.StdEncoding.EncodeToString(plaintext),
+	}, &out)
+	if err != nil {
+		return "", err
+	}
+	if out.Data.Ciphertext == "" {
+		return "", fmt.Errorf("no ciphertext returned")
+	}
+	return out.Data.Ciphertext, nil
+}
+
+// Decrypt decrypts a ciphertext returned by Encrypt
+func (c *Client) Decrypt(mount, key, ciphertext string) ([]byte, error) {
+	var out struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+	err := c.do("POST", mount+"/decrypt/"+key, map[string]string{
+		"ciphertext": ciphertext,
+	}, &out)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := base64.StdEncoding.DecodeString(out.Data.Plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("error decoding plaintext: %v", err)
+	}
+	return plaintext, nil
+}
+
+// LatestVersion returns the version of the named key that new data is
+// encrypted with
+func (c *Client) LatestVersion(mount, key string) (int, error) {
+	var out struct {
+		Data struct {
+			LatestVersion int `json:"latest_version"`
+		} `json:"data"`
+	}
+	if err := c.do("GET", mount+"/keys/"+key, nil, &out); err != nil {
+		return 0, err
+	}
+	if out.Data.LatestVersion == 0 {
+		return 0, fmt.Errorf("no version returned for key %s", key)
+	}
+	return out.Data.LatestVersion, nil
+}
+
+// LookupSelf returns the remaining TTL of the token and whether it can be
+// renewed. A TTL of zero means that the token does not expire.
+func (c *Client) LookupSelf() (time.Duration, bool, error) {
+	var out struct {
+		Data struct {
+			TTL       int  `json:"ttl"`
+			Renewable bool `json:"renewable"`
+		} `json:"data"`
+	}
+	if err := c.do("GET", "auth/token/lookup-self", nil, &out); err != nil {
+		return 0, false, err
+	}
+	return time.Duration(out.Data.TTL) * time.Second, out.Data.Renewable, nil
+}
+
+// RenewSelf renews the token, returning its new TTL and whether it can be
+// renewed again
+func (c *Client) RenewSelf() (time.Duration, bool, error) {
+	var out struct {
+		Auth struct {
+			LeaseDuration int  `json:"lease_duration"`
+			Renewable     bool `json:"renewable"`
+		} `json:"auth"`
+	}
+	if err := c.do("POST", "auth/token/renew-self", map[string]string{}, &out); err != nil {
+		return 0, false, err
+	}
+	return time.Duration(out.Auth.LeaseDuration) * time.Second, out.Auth.Renewable, nil
+}
+
+func (c *Client) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		buf, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(buf)
+	}
+
+	req, err := http.NewRequest(method, c.addr+"/v1/"+strings.Trim(path, "/"), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", c.token)
+	if c.namespace != "" {
+		req.Header.Set(NamespaceHeader, c.namespace)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Errors []string `json:"errors"`
+		}
+		if err := json.Unmarshal(buf, &e); err == nil && len(e.Errors) > 0 {
+			return fmt.Errorf("%s: %s", resp.Status, strings.Join(e.Errors, ", "))
+		}
+		return fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+
+	return json.Unmarshal(buf, out)
+}
@@ -0,0 +1,134 @@
+package transitutil
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func testServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.token" || r.Header.Get(NamespaceHeader) != "ops" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+
+		var in map[string]string
+		if r.Method == "POST" {
+			if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var out interface{}
+		switch r.Method + " " + r.URL.Path {
+		case "POST /v1/transit/encrypt/unseal":
+			out = map[string]interface{}{
+				"data": map[string]interface{}{"ciphertext": "vault:v2:" + in["plaintext"]},
+			}
+		case "POST /v1/transit/decrypt/unseal":
+			out = map[string]interface{}{
+				"data": map[string]interface{}{"plaintext": in["ciphertext"][len("vault:v2:"):]},
+			}
+		case "GET /v1/transit/keys/unseal":
+			out = map[string]interface{}{
+				"data": map[string]interface{}{"latest_version": 2},
+			}
+		case "GET /v1/auth/token/lookup-self":
+			out = map[string]interface{}{
+				"data": map[string]interface{}{"ttl": 3600, "renewable": true},
+			}
+		case "POST /v1/auth/token/renew-self":
+			out = map[string]interface{}{
+				"auth": map[string]interface{}{"lease_duration": 7200, "renewable": true},
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errors":[]}`))
+			return
+		}
+		json.NewEncoder(w).Encode(out)
+	}))
+}
+
+func TestClient(t *testing.T) {
+	ts := testServer(t)
+	defer ts.Close()
+
+	client, err := NewClient(&Config{
+		Address:   ts.URL,
+		Token:     "s.token",
+		Namespace: "ops",
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	ciphertext, err := client.Encrypt("transit", "unseal", []byte("key"))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if ciphertext != "vault:v2:a2V5" {
+		t.Fatalf("bad: %s", ciphertext)
+	}
+	plaintext, err := client.Decrypt("transit", "unseal", ciphertext)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(plaintext) != "key" {
+		t.Fatalf("bad: %q", plaintext)
+	}
+
+	version, err := client.LatestVersion("transit", "unseal")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if version != 2 {
+		t.Fatalf("bad: %d", version)
+	}
+	if _, err := client.LatestVersion("transit", "missing"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	ttl, renewable, err := client.LookupSelf()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if ttl != time.Hour || !renewable {
+		t.Fatalf("bad: %s %t", ttl, renewable)
+	}
+	ttl, renewable, err = client.RenewSelf()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if ttl != 2*time.Hour || !renewable {
+		t.Fatalf("bad: %s %t", ttl, renewable)
+	}
+}
+
+func TestClient_errors(t *testing.T) {
+	ts := testServer(t)
+	defer ts.Close()
+
+	client, err := NewClient(&Config{
+		Address: ts.URL,
+		Token:   "s.other",
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	_, err = client.Encrypt("transit", "unseal", []byte("key"))
+	if err == nil || err.Error() != "403 Forbidden: permission denied" {
+		t.Fatalf("bad: %v", err)
+	}
+
+	if _, err := NewClient(&Config{Token: "s.token"}); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := NewClient(&Config{Address: ts.URL}); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,99 @@
+package http
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/vault"
+)
+
+func TestHandler_CORS(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	client := cleanhttp.DefaultClient()
+	corsRequest := func(method, origin string) *http.Response {
+		req, err := http.NewRequest(method, addr+"/v1/sys/mounts", nil)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		req.Header.Set(AuthHeaderName, token)
+		req.Header.Set("Origin", origin)
+		if method == "OPTIONS" {
+			req.Header.Set("Access-Control-Request-Method", "GET")
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		return resp
+	}
+
+	// Requests are passed through unchanged while CORS is disabled
+	resp := corsRequest("GET", "https://www.example.com")
+	testResponseStatus(t, resp, 200)
+	if v := resp.Header.Get("Access-Control-Allow-Origin"); v != "" {
+		t.Fatalf("bad: %q", v)
+	}
+
+	resp = testHttpPut(t, token, addr+"/v1/sys/config/cors", map[string]interface{}{
+		"allowed_origins": "https://www.example.com",
+		"allowed_headers": "x-custom",
+	})
+	testResponseStatus(t, resp, 204)
+
+	resp = testHttpGet(t, token, addr+"/v1/sys/config/cors")
+	var actual map[string]interface{}
+	testResponseStatus(t, resp, 200)
+	testResponseBody(t, resp, &actual)
+	expected := map[string]interface{}{
+		"enabled":         true,
+		"allowed_origins": []interface{}{"https://www.example.com"},
+		"allowed_headers": []interface{}{},
+	}
+	for _, header := range append(vault.StdAllowedHeaders, "X-Custom") {
+		expected["allowed_headers"] = append(expected["allowed_headers"].([]interface{}), header)
+	}
+	if !reflect.DeepEqual(actual["data"], expected) {
+		t.Fatalf("bad:\nexpected: %#v\nactual: %#v", expected, actual["data"])
+	}
+
+	resp = corsRequest("GET", "https://www.example.com")
+	testResponseStatus(t, resp, 200)
+	if v := resp.Header.Get("Access-Control-Allow-Origin"); v != "https://www.example.com" {
+		t.Fatalf("bad: %q", v)
+	}
+
+	resp = corsRequest("OPTIONS", "https://www.example.com")
+	testResponseStatus(t, resp, 204)
+	if v := resp.Header.Get("Access-Control-Allow-Headers"); !strings.Contains(v, "X-Vault-Token") || !strings.Contains(v, "X-Custom") {
+		t.Fatalf("bad: %q", v)
+	}
+	if v := resp.Header.Get("Access-Control-Allow-Methods"); !strings.Contains(v, "LIST") {
+		t.Fatalf("bad: %q", v)
+	}
+
+	resp = corsRequest("GET", "https://evil.example.com")
+	testResponseStatus(t, resp, 403)
+
+	// Requests without an origin are not cross-origin requests
+	resp = testHttpGet(t, token, addr+"/v1/sys/mounts")
+	testResponseStatus(t, resp, 200)
+
+	// An origin is required when enabling CORS
+	resp = testHttpPut(t, token, addr+"/v1/sys/config/cors", map[string]interface{}{
+		"enabled": true,
+	})
+	testResponseStatus(t, resp, 400)
+
+	resp = testHttpDelete(t, token, addr+"/v1/sys/config/cors")
+	testResponseStatus(t, resp, 204)
+
+	resp = corsRequest("GET", "https://evil.example.com")
+	testResponseStatus(t, resp, 200)
+}
@@ -0,0 +1,51 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/vault"
+)
+
+// handleEndpointPolicies wraps handler so that the endpoint governing
+// policies are enforced on every request, including the requests to the
+// endpoints that are not handled by the core, such as sys/seal
+func handleEndpointPolicies(core *vault.Core, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, ok := stripPrefix("/v1/", r.URL.Path)
+		if !ok {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		op, statusCode := requestOperation(r)
+		if r.URL.Query().Get("help") != "" || r.Method == "HELP" {
+			op, statusCode = logical.HelpOperation, 0
+		}
+		if statusCode != 0 {
+			// The handler rejects the request anyway
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		requestID, err := uuid.GenerateUUID()
+		if err != nil {
+			respondError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		req := requestAuth(r, &logical.Request{
+			ID:         requestID,
+			Operation:  op,
+			Path:       path,
+			Connection: getConnection(r),
+		})
+		if err := core.CheckEndpointPolicies(req); err != nil {
+			respondError(w, http.StatusForbidden, err)
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,37 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/vault"
+)
+
+func TestEndpointPolicies_seal(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	resp := testHttpPut(t, token, addr+"/v1/sys/policies/egp/seal", map[string]interface{}{
+		"paths":       "sys/seal",
+		"bound_cidrs": "10.0.0.0/8",
+	})
+	testResponseStatus(t, resp, 204)
+
+	// The test server is reached from the loopback address
+	resp = testHttpPut(t, token, addr+"/v1/sys/seal", nil)
+	testResponseStatus(t, resp, 403)
+	if sealed, err := core.Sealed(); err != nil || sealed {
+		t.Fatalf("bad: %v %v", sealed, err)
+	}
+
+	resp = testHttpPut(t, token, addr+"/v1/sys/policies/egp/seal", map[string]interface{}{
+		"bound_cidrs": "127.0.0.0/8",
+	})
+	testResponseStatus(t, resp, 204)
+
+	resp = testHttpPut(t, token, addr+"/v1/sys/seal", nil)
+	testResponseStatus(t, resp, 204)
+	if sealed, err := core.Sealed(); err != nil || !sealed {
+		t.Fatalf("bad: %v %v", sealed, err)
+	}
+}
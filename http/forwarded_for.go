@@ -0,0 +1,119 @@
+package http
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	// ForwardedForHeaderName is the name of the header listing the addresses
+	// a request was proxied for
+	ForwardedForHeaderName = "X-Forwarded-For"
+)
+
+// ForwardedForConfig configures which proxies are trusted to set the
+// X-Forwarded-For header. When a request from a trusted proxy has the
+// header, the client address taken from it replaces the remote address of
+// the request everywhere it is used, such as in audit logs and CIDR
+// restrictions.
+type ForwardedForConfig struct {
+	// AuthorizedAddrs are the networks of the trusted proxies. The header
+	// is only used if this is not empty.
+	AuthorizedAddrs []*net.IPNet
+
+	// HopSkips is the number of addresses to skip from the end of the
+	// header, for deployments with more than one proxy in front of Vault.
+	// With zero, the last address in the header is used.
+	HopSkips int
+
+	// RejectNotAuthorized rejects requests that have the header but do not
+	// come from a trusted proxy, rather than ignoring the header
+	RejectNotAuthorized bool
+
+	// RejectNotPresent rejects requests from a trusted proxy that do not
+	// have the header, rather than using the address of the proxy
+	RejectNotPresent bool
+}
+
+func (c *ForwardedForConfig) enabled() bool {
+	return c != nil && len(c.AuthorizedAddrs) > 0
+}
+
+func (c *ForwardedForConfig) isAuthorized(ip net.IP) bool {
+	for _, cidr := range c.AuthorizedAddrs {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientAddr returns the address of the client according to the values of
+// the header, which may be repeated and each hold a list of addresses
+func (c *ForwardedForConfig) clientAddr(values []string) (string, error) {
+	var addrs []string
+	for _, value := range values {
+		for _, addr := range strings.Split(value, ",") {
+			addrs = append(addrs, strings.TrimSpace(addr))
+		}
+	}
+
+	idx := len(addrs) - 1 - c.HopSkips
+	if idx < 0 {
+		return "", fmt.Errorf("%s header has %d addresses, too few to skip %d hops",
+			ForwardedForHeaderName, len(addrs), c.HopSkips)
+	}
+	ip := net.ParseIP(addrs[idx])
+	if ip == nil {
+		return "", fmt.Errorf("invalid address %q in %s header", addrs[idx], ForwardedForHeaderName)
+	}
+	return ip.String(), nil
+}
+
+// handleForwardedFor wraps handler so that the remote address of requests
+// from trusted proxies is replaced with the client address given in the
+// X-Forwarded-For header. The port of the proxy connection is kept.
+func handleForwardedFor(config *ForwardedForConfig, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		values, present := r.Header[ForwardedForHeaderName]
+
+		host, port, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			// Not a network address, so there is nothing to replace
+			handler.ServeHTTP(w, r)
+			return
+		}
+		ip := net.ParseIP(host)
+
+		if ip == nil || !config.isAuthorized(ip) {
+			if present && config.RejectNotAuthorized {
+				respondError(w, http.StatusForbidden, fmt.Errorf(
+					"client address not authorized for %s", ForwardedForHeaderName))
+				return
+			}
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		if !present {
+			if config.RejectNotPresent {
+				respondError(w, http.StatusForbidden, fmt.Errorf(
+					"missing %s header from a trusted proxy", ForwardedForHeaderName))
+				return
+			}
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		clientAddr, err := config.clientAddr(values)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+		r.RemoteAddr = net.JoinHostPort(clientAddr, port)
+
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,126 @@
+package http
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler_ForwardedFor(t *testing.T) {
+	_, cidr, err := net.ParseCIDR("10.0.0.0/8")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	var remoteAddr string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remoteAddr = r.RemoteAddr
+	})
+
+	cases := []struct {
+		name       string
+		config     ForwardedForConfig
+		remoteAddr string
+		header     []string
+		status     int
+		expected   string
+	}{
+		{
+			"trusted proxy",
+			ForwardedForConfig{RejectNotAuthorized: true, RejectNotPresent: true},
+			"10.0.0.1:1234",
+			[]string{"192.168.0.1"},
+			200,
+			"192.168.0.1:1234",
+		},
+		{
+			"multiple values",
+			ForwardedForConfig{},
+			"10.0.0.1:1234",
+			[]string{"192.168.0.1, 192.168.0.2", "192.168.0.3"},
+			200,
+			"192.168.0.3:1234",
+		},
+		{
+			"hop skips",
+			ForwardedForConfig{HopSkips: 1},
+			"10.0.0.1:1234",
+			[]string{"192.168.0.1, 192.168.0.2", "192.168.0.3"},
+			200,
+			"192.168.0.2:1234",
+		},
+		{
+			"too many hop skips",
+			ForwardedForConfig{HopSkips: 2},
+			"10.0.0.1:1234",
+			[]string{"192.168.0.1"},
+			400,
+			"",
+		},
+		{
+			"invalid address",
+			ForwardedForConfig{},
+			"10.0.0.1:1234",
+			[]string{"foo"},
+			400,
+			"",
+		},
+		{
+			"untrusted proxy rejected",
+			ForwardedForConfig{RejectNotAuthorized: true},
+			"127.0.0.1:1234",
+			[]string{"192.168.0.1"},
+			403,
+			"",
+		},
+		{
+			"untrusted proxy ignored",
+			ForwardedForConfig{},
+			"127.0.0.1:1234",
+			[]string{"192.168.0.1"},
+			200,
+			"127.0.0.1:1234",
+		},
+		{
+			"missing header rejected",
+			ForwardedForConfig{RejectNotPresent: true},
+			"10.0.0.1:1234",
+			nil,
+			403,
+			"",
+		},
+		{
+			"missing header allowed",
+			ForwardedForConfig{},
+			"10.0.0.1:1234",
+			nil,
+			200,
+			"10.0.0.1:1234",
+		},
+	}
+
+	for _, tc := range cases {
+		config := tc.config
+		config.AuthorizedAddrs = []*net.IPNet{cidr}
+
+		remoteAddr = ""
+		req, err := http.NewRequest("GET", "/v1/sys/health", nil)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		req.RemoteAddr = tc.remoteAddr
+		for _, value := range tc.header {
+			req.Header.Add(ForwardedForHeaderName, value)
+		}
+
+		w := httptest.NewRecorder()
+		handleForwardedFor(&config, handler).ServeHTTP(w, req)
+		if w.Code != tc.status {
+			t.Fatalf("%s: expected status %d, got %d: %s", tc.name, tc.status, w.Code, w.Body.String())
+		}
+		if remoteAddr != tc.expected {
+			t.Fatalf("%s: expected remote address %q, got %q", tc.name, tc.expected, remoteAddr)
+		}
+	}
+}
@@ -519,3 +519,84 @@ func TestHTTP_Forwarding_ClientTLS(t *testing.T) {
 		}
 	}
 }
+
+func TestHTTP_PerformanceStandby(t *testing.T) {
+	handler1 := http.NewServeMux()
+	handler2 := http.NewServeMux()
+	handler3 := http.NewServeMux()
+
+	coreConfig := &vault.CoreConfig{
+		PerformanceStandby: true,
+	}
+
+	cores := vault.TestCluster(t, []http.Handler{handler1, handler2, handler3}, coreConfig, true)
+	for _, core := range cores {
+		defer core.CloseListeners()
+	}
+	handler1.Handle("/", Handler(cores[0].Core))
+	handler2.Handle("/", Handler(cores[1].Core))
+	handler3.Handle("/", Handler(cores[2].Core))
+
+	vault.TestWaitActive(t, cores[0].Core)
+	root := cores[0].Root
+
+	deadline := time.Now().Add(10 * time.Second)
+	for !cores[1].PerformanceStandby() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the performance standby")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	config := api.DefaultConfig()
+	config.Address = fmt.Sprintf("https://127.0.0.1:%d", cores[1].Listeners[0].Address.Port)
+	config.HttpClient = cleanhttp.DefaultClient()
+	config.HttpClient.Transport.(*http.Transport).TLSClientConfig = cores[0].TLSConfig
+	client, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetToken(root)
+
+	// The write is forwarded to the active node, the read is served by the
+	// standby once the write reached it
+	client.SetReadYourWrites(true)
+	if _, err := client.Logical().Write("secret/foo", map[string]interface{}{
+		"value": "bar",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	secret, err := client.Logical().Read("secret/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret == nil || secret.Data["value"] != "bar" {
+		t.Fatalf("bad: %#v", secret)
+	}
+
+	// A read of a state the standby has not caught up to fails if asked to
+	index := cores[0].WriteLogState()
+	if index == "" {
+		t.Fatal("expected the active node to return its state")
+	}
+	r := client.NewRequest("GET", "/v1/secret/foo")
+	r.Index = base64.RawURLEncoding.EncodeToString([]byte("unknown:1"))
+	req, err := r.ToHTTP()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(InconsistentHeaderName, "fail")
+	resp, err := config.HttpClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("bad: %d", resp.StatusCode)
+	}
+
+	// Reads the standby does not serve are forwarded
+	if _, err := client.Logical().List("sys/leases/lookup/"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,17 +1,20 @@
 package http
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/vault/helper/duration"
+	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/requestutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/vault"
 )
@@ -24,14 +27,72 @@ const (
 	// response.
 	WrapTTLHeaderName = "X-Vault-Wrap-TTL"
 
+	// MFAHeaderName is the name of the header containing the credentials of
+	// an MFA method, as "<method name>:<passcode>" or just "<method name>"
+	// for methods without passcode. It can be given once per method.
+	MFAHeaderName = "X-Vault-MFA"
+
+	// NamespaceHeaderName is the name of the header containing the
+	// namespace of the request, such as "ns1/ns2". The request path is then
+	// relative to the namespace.
+	NamespaceHeaderName = "X-Vault-Namespace"
+
 	// NoRequestForwardingHeaderName is the name of the header telling Vault
 	// not to use request forwarding
 	NoRequestForwardingHeaderName = "X-Vault-No-Request-Forwarding"
+
+	// IndexHeaderName is the name of the header containing the state of the
+	// cluster after a write. A read sent with it to a performance standby is
+	// only served once the standby caught up to the write.
+	IndexHeaderName = "X-Vault-Index"
+
+	// InconsistentHeaderName is the name of the header telling a performance
+	// standby what to do with a read it has not caught up to:
+	// "forward-active-node", the default, or "fail"
+	InconsistentHeaderName = "X-Vault-Inconsistent"
 )
 
+// indexWait is how long a performance standby waits to catch up to the
+// state of a read before forwarding it
+const indexWait = 2 * time.Second
+
+// HandlerProperties are the settings of the handler returned by
+// HandlerWithProperties, which can differ between listeners.
+type HandlerProperties struct {
+	// MaxRequestSize is the maximum size, in bytes, of the body of a request
+	// to a logical path. If zero, the core's server-wide limit is used. A
+	// limit set on the mount the path belongs to takes precedence over both.
+	MaxRequestSize int64
+
+	// RateLimits are the rate limits enforced on requests received by the
+	// handler. They are disabled by default.
+	RateLimits RateLimits
+
+	// ForwardedFor configures the proxies trusted to set the
+	// X-Forwarded-For header. If nil, the header is ignored.
+	ForwardedFor *ForwardedForConfig
+}
+
+func (p *HandlerProperties) maxRequestSize() int64 {
+	if p == nil {
+		return 0
+	}
+	return p.MaxRequestSize
+}
+
 // Handler returns an http.Handler for the API. This can be used on
 // its own to mount the Vault API within another web server.
 func Handler(core *vault.Core) http.Handler {
+	return HandlerWithProperties(core, nil)
+}
+
+// HandlerWithProperties is like Handler, but applies the given properties
+// to the returned handler. If props is nil, the defaults are used.
+func HandlerWithProperties(core *vault.Core, props *HandlerProperties) http.Handler {
+	if props == nil {
+		props = &HandlerProperties{}
+	}
+
 	// Create the muxer to handle the actual endpoints
 	mux := http.NewServeMux()
 	mux.Handle("/v1/sys/init", handleSysInit(core))
@@ -39,23 +100,49 @@ func Handler(core *vault.Core) http.Handler {
 	mux.Handle("/v1/sys/seal", handleSysSeal(core))
 	mux.Handle("/v1/sys/step-down", handleSysStepDown(core))
 	mux.Handle("/v1/sys/unseal", handleSysUnseal(core))
-	mux.Handle("/v1/sys/renew", handleRequestForwarding(core, handleLogical(core, false, nil)))
-	mux.Handle("/v1/sys/renew/", handleRequestForwarding(core, handleLogical(core, false, nil)))
+	mux.Handle("/v1/sys/renew", handleRequestForwarding(core, handleLogical(core, props, false, nil)))
+	mux.Handle("/v1/sys/renew/", handleRequestForwarding(core, handleLogical(core, props, false, nil)))
 	mux.Handle("/v1/sys/leader", handleSysLeader(core))
 	mux.Handle("/v1/sys/health", handleSysHealth(core))
+	mux.Handle("/v1/sys/events", handleSysEvents(core))
 	mux.Handle("/v1/sys/generate-root/attempt", handleRequestForwarding(core, handleSysGenerateRootAttempt(core)))
 	mux.Handle("/v1/sys/generate-root/update", handleRequestForwarding(core, handleSysGenerateRootUpdate(core)))
 	mux.Handle("/v1/sys/rekey/init", handleRequestForwarding(core, handleSysRekeyInit(core, false)))
 	mux.Handle("/v1/sys/rekey/update", handleRequestForwarding(core, handleSysRekeyUpdate(core, false)))
 	mux.Handle("/v1/sys/rekey-recovery-key/init", handleRequestForwarding(core, handleSysRekeyInit(core, true)))
 	mux.Handle("/v1/sys/rekey-recovery-key/update", handleRequestForwarding(core, handleSysRekeyUpdate(core, true)))
-	mux.Handle("/v1/sys/capabilities-self", handleRequestForwarding(core, handleLogical(core, true, sysCapabilitiesSelfCallback)))
-	mux.Handle("/v1/sys/", handleRequestForwarding(core, handleLogical(core, true, nil)))
-	mux.Handle("/v1/", handleRequestForwarding(core, handleLogical(core, false, nil)))
+	mux.Handle("/v1/sys/seal-migrate/init", handleRequestForwarding(core, handleSysSealMigrateInit(core)))
+	mux.Handle("/v1/sys/seal-migrate/update", handleRequestForwarding(core, handleSysSealMigrateUpdate(core)))
+	mux.Handle("/v1/sys/replication/dr/status", handleSysReplicationDRStatus(core))
+	mux.Handle("/v1/sys/replication/dr/failover-token", handleSysReplicationDRFailoverToken(core))
+	mux.Handle("/v1/sys/replication/dr/promote", handleSysReplicationDRPromote(core))
+	mux.Handle("/v1/sys/capabilities-self", handleRequestForwarding(core, handleLogical(core, props, true, sysCapabilitiesSelfCallback)))
+	mux.Handle("/v1/sys/", handlePerformanceStandbyReads(core, handleLogical(core, props, true, nil)))
+	mux.Handle("/v1/", handlePerformanceStandbyReads(core, handleLogical(core, props, false, nil)))
 
 	// Wrap the handler in another handler to trigger all help paths.
 	handler := handleHelpHandler(mux, core)
 
+	// The endpoint governing policies apply to every endpoint, help
+	// included
+	handler = handleEndpointPolicies(core, handler)
+
+	if props.RateLimits.enabled() {
+		handler = handleRateLimit(core, props.RateLimits, handler)
+	}
+
+	handler = handleTracing(handler)
+
+	// The client address must be known before the rate limits are applied
+	// and the request is traced
+	if props.ForwardedFor.enabled() {
+		handler = handleForwardedFor(props.ForwardedFor, handler)
+	}
+
+	// CORS is handled before anything else, so that every response,
+	// including rejections by the rate limits, carries the CORS headers
+	handler = handleCORS(core, handler)
+
 	return handler
 }
 
@@ -94,6 +181,76 @@ func parseRequest(r *http.Request, out interface{}) error {
 	return err
 }
 
+// limitRequestBody replaces the body of r with one that fails once more
+// than limit bytes have been read, and returns it so that the caller can
+// tell whether a failure to read the body was due to the limit. Requests
+// whose declared length is already over the limit are rejected
+// immediately, without reading any of the body.
+func limitRequestBody(r *http.Request, limit int64) (*limitedBody, error) {
+	if r.ContentLength > limit {
+		return nil, requestTooLargeError(limit)
+	}
+	body := &limitedBody{
+		ReadCloser: r.Body,
+		remaining:  limit,
+		limit:      limit,
+	}
+	r.Body = body
+	return body, nil
+}
+
+// limitedBody is the request body installed by limitRequestBody
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+	limit     int64
+
+	// exceeded is set once a read has gone over the limit
+	exceeded bool
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		// Only fail if there actually is more data, so that a body of
+		// exactly the limit can still be read to EOF
+		var probe [1]byte
+		if n, err := b.ReadCloser.Read(probe[:]); n == 0 {
+			return 0, err
+		}
+		b.exceeded = true
+		return 0, requestTooLargeError(b.limit)
+	}
+
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
+
+// requestTooLargeError returns the error for a request body over limit
+func requestTooLargeError(limit int64) error {
+	return errutil.WithCode(errutil.CodeRequestTooLarge,
+		fmt.Errorf("request body exceeds the size limit of %d bytes", limit))
+}
+
+// parseRequestStrict behaves like parseRequest, except that fields in the
+// JSON input that out does not have are an error
+func parseRequestStrict(r *http.Request, out interface{}) error {
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, jsonutil.DefaultMaxStrictSize+1))
+	if err != nil {
+		return fmt.Errorf("Failed to read request body: %s", err)
+	}
+	if len(body) == 0 {
+		return io.EOF
+	}
+	if err := jsonutil.DecodeJSONStrict(body, out, nil); err != nil {
+		return fmt.Errorf("Failed to parse JSON input: %s", err)
+	}
+	return nil
+}
+
 // handleRequestForwarding determines whether to forward a request or not,
 // falling back on the older behavior of redirecting the client
 func handleRequestForwarding(core *vault.Core, handler http.Handler) http.Handler {
@@ -149,24 +306,107 @@ func handleRequestForwarding(core *vault.Core, handler http.Handler) http.Handle
 			handler.ServeHTTP(w, r)
 			return
 		}
-		defer resp.Body.Close()
 
-		// Read the body into a buffer so we can write it back out to the
-		// original requestor
-		buf := bytes.NewBuffer(nil)
-		_, err = buf.ReadFrom(resp.Body)
-		if err != nil {
-			core.Logger().Printf("[ERR] http/handleRequestForwarding: error reading response body: %v", err)
-			respondError(w, http.StatusInternalServerError, err)
+		// Write the response back out to the original requestor along with
+		// the headers the active node set
+		requestutil.CopyForwardedResponse(w, resp)
+		return
+	})
+}
+
+// handlePerformanceStandbyReads serves the reads it can locally when the
+// node is a performance standby, and forwards the other requests to the
+// active node
+func handlePerformanceStandbyReads(core *vault.Core, handler http.Handler) http.Handler {
+	forwarding := handleRequestForwarding(core, handler)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.Method != "GET" && r.Method != "LIST") || !core.PerformanceStandby() {
+			forwarding.ServeHTTP(w, r)
 			return
 		}
 
-		w.WriteHeader(resp.StatusCode)
-		w.Write(buf.Bytes())
-		return
+		// A read following a write is served once the standby caught up to
+		// it
+		if state := r.Header.Get(IndexHeaderName); state != "" && !core.WaitForWriteLogState(state, indexWait) {
+			if r.Header.Get(InconsistentHeaderName) == "fail" {
+				respondError(w, http.StatusPreconditionFailed, fmt.Errorf("node has not caught up to the requested state"))
+				return
+			}
+			forwarding.ServeHTTP(w, r)
+			return
+		}
+
+		// A request the standby does not serve is redirected to the active
+		// node, and must be forwarded instead. Which one it is is known
+		// from the status, so the others are streamed through as written.
+		sw := &perfStandbyResponseWriter{
+			w:      w,
+			header: make(http.Header),
+		}
+		handler.ServeHTTP(sw, r)
+		if sw.redirected {
+			forwarding.ServeHTTP(w, r)
+		}
 	})
 }
 
+// perfStandbyResponseWriter passes the response of a performance standby
+// through, unless it is a redirect to the active node, which is discarded.
+// The headers are kept apart until the status is known. It can be flushed
+// and notifies of closed connections whenever the wrapped ResponseWriter
+// does, so that streamed responses keep working.
+type perfStandbyResponseWriter struct {
+	w           http.ResponseWriter
+	header      http.Header
+	wroteHeader bool
+	redirected  bool
+}
+
+func (w *perfStandbyResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *perfStandbyResponseWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if statusCode == http.StatusTemporaryRedirect {
+		w.redirected = true
+		return
+	}
+	for k, v := range w.header {
+		w.w.Header()[k] = v
+	}
+	w.w.WriteHeader(statusCode)
+}
+
+func (w *perfStandbyResponseWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.redirected {
+		return len(p), nil
+	}
+	return w.w.Write(p)
+}
+
+func (w *perfStandbyResponseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if flusher, ok := w.w.(http.Flusher); ok && !w.redirected {
+		flusher.Flush()
+	}
+}
+
+func (w *perfStandbyResponseWriter) CloseNotify() <-chan bool {
+	if notifier, ok := w.w.(http.CloseNotifier); ok {
+		return notifier.CloseNotify()
+	}
+	return nil
+}
+
 // request is a helper to perform a request and properly exit in the
 // case of an error.
 func request(core *vault.Core, w http.ResponseWriter, rawReq *http.Request, r *logical.Request) (*logical.Response, bool) {
@@ -235,6 +475,40 @@ func requestAuth(r *http.Request, req *logical.Request) *logical.Request {
 	return req
 }
 
+// requestNamespacePath prefixes the path of the request with the namespace
+// given in the namespace header, if any
+func requestNamespacePath(r *http.Request, path string) string {
+	namespace := strings.Trim(r.Header.Get(NamespaceHeaderName), "/")
+	if namespace == "" {
+		return path
+	}
+	return namespace + "/" + path
+}
+
+// requestMFACreds adds the MFA credentials to the logical.Request if there
+// are any
+func requestMFACreds(r *http.Request, req *logical.Request) *logical.Request {
+	values := r.Header[MFAHeaderName]
+	if len(values) == 0 {
+		return req
+	}
+
+	req.MFACreds = make(map[string][]string, len(values))
+	for _, v := range values {
+		parts := strings.SplitN(v, ":", 2)
+		name := strings.TrimSpace(parts[0])
+		if name == "" {
+			continue
+		}
+		if len(parts) == 2 {
+			req.MFACreds[name] = append(req.MFACreds[name], parts[1])
+		} else if _, ok := req.MFACreds[name]; !ok {
+			req.MFACreds[name] = []string{}
+		}
+	}
+	return req
+}
+
 // requestWrapTTL adds the WrapTTL value to the logical.Request if it
 // exists.
 func requestWrapTTL(r *http.Request, req *logical.Request) (*logical.Request, error) {
@@ -258,9 +532,14 @@ func requestWrapTTL(r *http.Request, req *logical.Request) (*logical.Request, er
 }
 
 func respondError(w http.ResponseWriter, status int, err error) {
+	errCode := errutil.CodeOf(err)
+
 	// Adjust status code when sealed
 	if errwrap.Contains(err, vault.ErrSealed.Error()) {
 		status = http.StatusServiceUnavailable
+		if errCode == "" {
+			errCode = errutil.CodeSealed
+		}
 	}
 
 	// Allow HTTPCoded error passthrough to specify a code
@@ -268,10 +547,18 @@ func respondError(w http.ResponseWriter, status int, err error) {
 		status = t.Code()
 	}
 
+	// Errors without a code of their own get the generic one for the status
+	if errCode == "" {
+		errCode = errutil.CodeForStatus(status)
+	}
+
 	w.Header().Add("Content-Type", "application/json")
 	w.WriteHeader(status)
 
-	resp := &ErrorResponse{Errors: make([]string, 0, 1)}
+	resp := &ErrorResponse{
+		Errors:    make([]string, 0, 1),
+		ErrorCode: string(errCode),
+	}
 	if err != nil {
 		resp.Errors = append(resp.Errors, err.Error())
 	}
@@ -308,11 +595,17 @@ func respondErrorCommon(w http.ResponseWriter, resp *logical.Response, err error
 			statusCode = http.StatusNotFound
 		case errwrap.Contains(err, logical.ErrInvalidRequest.Error()):
 			statusCode = http.StatusBadRequest
+		case errutil.CodeOf(err) == errutil.CodeOverloaded:
+			statusCode = http.StatusServiceUnavailable
+		case errutil.CodeOf(err) == errutil.CodeLeaseQuotaExceeded,
+			errutil.CodeOf(err) == errutil.CodeRateLimited:
+			statusCode = http.StatusTooManyRequests
 		}
 	}
 
 	if resp != nil && resp.IsError() {
-		err = fmt.Errorf("%s", resp.Data["error"].(string))
+		// Keep the code of the original error, if any
+		err = errutil.WithCode(errutil.CodeOf(err), fmt.Errorf("%s", resp.Data["error"].(string)))
 	}
 
 	respondError(w, statusCode, err)
@@ -332,5 +625,6 @@ func respondOk(w http.ResponseWriter, body interface{}) {
 }
 
 type ErrorResponse struct {
-	Errors []string `json:"errors"`
+	Errors    []string `json:"errors"`
+	ErrorCode string   `json:"error_code,omitempty"`
 }
@@ -6,9 +6,12 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/vault"
 )
@@ -46,7 +49,9 @@ func TestSysMounts_headerAuth(t *testing.T) {
 				"config": map[string]interface{}{
 					"default_lease_ttl": json.Number("0"),
 					"max_lease_ttl":     json.Number("0"),
+					"max_request_size":  json.Number("0"),
 				},
+				"ready": true,
 			},
 			"sys/": map[string]interface{}{
 				"description": "system endpoints used for control, policy and debugging",
@@ -54,7 +59,9 @@ func TestSysMounts_headerAuth(t *testing.T) {
 				"config": map[string]interface{}{
 					"default_lease_ttl": json.Number("0"),
 					"max_lease_ttl":     json.Number("0"),
+					"max_request_size":  json.Number("0"),
 				},
+				"ready": true,
 			},
 			"cubbyhole/": map[string]interface{}{
 				"description": "per-token private secret storage",
@@ -62,7 +69,9 @@ func TestSysMounts_headerAuth(t *testing.T) {
 				"config": map[string]interface{}{
 					"default_lease_ttl": json.Number("0"),
 					"max_lease_ttl":     json.Number("0"),
+					"max_request_size":  json.Number("0"),
 				},
+				"ready": true,
 			},
 		},
 		"secret/": map[string]interface{}{
@@ -71,7 +80,9 @@ func TestSysMounts_headerAuth(t *testing.T) {
 			"config": map[string]interface{}{
 				"default_lease_ttl": json.Number("0"),
 				"max_lease_ttl":     json.Number("0"),
+				"max_request_size":  json.Number("0"),
 			},
+			"ready": true,
 		},
 		"sys/": map[string]interface{}{
 			"description": "system endpoints used for control, policy and debugging",
@@ -79,7 +90,9 @@ func TestSysMounts_headerAuth(t *testing.T) {
 			"config": map[string]interface{}{
 				"default_lease_ttl": json.Number("0"),
 				"max_lease_ttl":     json.Number("0"),
+				"max_request_size":  json.Number("0"),
 			},
+			"ready": true,
 		},
 		"cubbyhole/": map[string]interface{}{
 			"description": "per-token private secret storage",
@@ -87,7 +100,9 @@ func TestSysMounts_headerAuth(t *testing.T) {
 			"config": map[string]interface{}{
 				"default_lease_ttl": json.Number("0"),
 				"max_lease_ttl":     json.Number("0"),
+				"max_request_size":  json.Number("0"),
 			},
+			"ready": true,
 		},
 	}
 	testResponseStatus(t, resp, 200)
@@ -142,6 +157,12 @@ func TestSysMounts_headerAuth_Wrapped(t *testing.T) {
 	}
 	expected["wrap_info"].(map[string]interface{})["token"] = actualToken
 
+	actualAccessor, ok := actual["wrap_info"].(map[string]interface{})["accessor"]
+	if !ok || actualAccessor == "" {
+		t.Fatal("accessor missing in wrap info")
+	}
+	expected["wrap_info"].(map[string]interface{})["accessor"] = actualAccessor
+
 	actualCreationTime, ok := actual["wrap_info"].(map[string]interface{})["creation_time"]
 	if !ok || actualCreationTime == "" {
 		t.Fatal("creation_time missing in wrap info")
@@ -197,3 +218,108 @@ func TestHandler_error(t *testing.T) {
 	}
 
 }
+
+func TestHandler_errorCode(t *testing.T) {
+	cases := []struct {
+		Status int
+		Resp   *logical.Response
+		Err    error
+		Code   errutil.Code
+	}{
+		{500, nil, errors.New("Test Error"), errutil.CodeInternal},
+		{400, nil, vault.ErrSealed, errutil.CodeSealed},
+		{403, nil, logical.ErrPermissionDenied, errutil.CodePermissionDenied},
+		{400, nil, logical.CodedError(409, "conflict"), "VAULT-409-ERROR"},
+		{0, nil, multierror.Append(nil, logical.ErrUnsupportedPath), errutil.CodeUnsupportedPath},
+		{0, logical.ErrorResponse("bad input"), nil, errutil.CodeInvalidRequest},
+		{
+			0,
+			logical.ErrorResponse("permission denied"),
+			multierror.Append(nil, errutil.WithCode(errutil.CodePolicyDenied, logical.ErrPermissionDenied)),
+			errutil.CodePolicyDenied,
+		},
+	}
+
+	for i, tc := range cases {
+		w := httptest.NewRecorder()
+		if tc.Status != 0 {
+			respondError(w, tc.Status, tc.Err)
+		} else if !respondErrorCommon(w, tc.Resp, tc.Err) {
+			t.Fatalf("%d: expected an error response", i)
+		}
+
+		var actual ErrorResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &actual); err != nil {
+			t.Fatalf("%d: err: %v", i, err)
+		}
+		if actual.ErrorCode != string(tc.Code) {
+			t.Fatalf("%d: expected code %q, got %q", i, tc.Code, actual.ErrorCode)
+		}
+		if status := tc.Code.StatusCode(); w.Code != status {
+			t.Fatalf("%d: expected status %d, got %d", i, status, w.Code)
+		}
+	}
+}
+
+func TestHandler_namespaceHeader(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	resp := testHttpPut(t, token, addr+"/v1/sys/namespaces/ns1", nil)
+	testResponseStatus(t, resp, 204)
+
+	req, err := http.NewRequest("PUT", addr+"/v1/sys/mounts/secret", strings.NewReader(`{"type": "generic"}`))
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	req.Header.Set(AuthHeaderName, token)
+	req.Header.Set(NamespaceHeaderName, "ns1/")
+	resp, err = cleanhttp.DefaultClient().Do(req)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	testResponseStatus(t, resp, 204)
+
+	// The mount is in the namespace
+	resp = testHttpGet(t, token, addr+"/v1/ns1/sys/mounts")
+	var actual map[string]interface{}
+	testResponseStatus(t, resp, 200)
+	testResponseBody(t, resp, &actual)
+	if _, ok := actual["data"].(map[string]interface{})["secret/"]; !ok {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+func TestPerfStandbyResponseWriter(t *testing.T) {
+	// A response is streamed through as it is written
+	rec := httptest.NewRecorder()
+	w := &perfStandbyResponseWriter{w: rec, header: make(http.Header)}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write([]byte("foo"))
+	w.Flush()
+	if rec.Code != 200 || rec.Body.String() != "foo" || !rec.Flushed {
+		t.Fatalf("bad: %d %q %v", rec.Code, rec.Body.String(), rec.Flushed)
+	}
+	if v := rec.Header().Get("Content-Type"); v != "application/octet-stream" {
+		t.Fatalf("bad: %q", v)
+	}
+	if w.redirected {
+		t.Fatal("should not be redirected")
+	}
+
+	// A redirect to the active node is discarded
+	rec = httptest.NewRecorder()
+	w = &perfStandbyResponseWriter{w: rec, header: make(http.Header)}
+	w.Header().Set("Location", "https://active:8200/v1/secret/foo")
+	w.WriteHeader(http.StatusTemporaryRedirect)
+	w.Write([]byte("bar"))
+	w.Flush()
+	if !w.redirected {
+		t.Fatal("should be redirected")
+	}
+	if rec.Body.Len() != 0 || rec.Flushed || rec.Header().Get("Location") != "" {
+		t.Fatalf("bad: %q %v %#v", rec.Body.String(), rec.Flushed, rec.Header())
+	}
+}
@@ -2,20 +2,23 @@ package http
 
 import (
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 
 	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/vault"
 )
 
 type PrepareRequestFunc func(req *logical.Request) error
 
-func buildLogicalRequest(w http.ResponseWriter, r *http.Request) (*logical.Request, int, error) {
+func buildLogicalRequest(core *vault.Core, props *HandlerProperties, w http.ResponseWriter, r *http.Request) (*logical.Request, int, error) {
 	// Determine the path...
 	if !strings.HasPrefix(r.URL.Path, "/v1/") {
 		return nil, http.StatusNotFound, nil
@@ -24,38 +27,50 @@ func buildLogicalRequest(w http.ResponseWriter, r *http.Request) (*logical.Reque
 	if path == "" {
 		return nil, http.StatusNotFound, nil
 	}
+	path = requestNamespacePath(r, path)
 
 	// Determine the operation
-	var op logical.Operation
-	switch r.Method {
-	case "DELETE":
-		op = logical.DeleteOperation
-	case "GET":
-		op = logical.ReadOperation
-		// Need to call ParseForm to get query params loaded
-		queryVals := r.URL.Query()
-		listStr := queryVals.Get("list")
-		if listStr != "" {
-			list, err := strconv.ParseBool(listStr)
-			if err != nil {
-				return nil, http.StatusBadRequest, nil
-			}
-			if list {
-				op = logical.ListOperation
-			}
-		}
-	case "POST", "PUT":
-		op = logical.UpdateOperation
-	case "LIST":
-		op = logical.ListOperation
-	default:
-		return nil, http.StatusMethodNotAllowed, nil
+	op, statusCode := requestOperation(r)
+	if statusCode != 0 {
+		return nil, statusCode, nil
+	}
+
+	var err error
+	request_id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, http.StatusBadRequest, errwrap.Wrapf("failed to generate identifier for the request: {{err}}", err)
 	}
 
 	// Parse the request if we can
 	var data map[string]interface{}
-	if op == logical.UpdateOperation {
-		err := parseRequest(r, &data)
+	if op == logical.UpdateOperation || op == logical.PatchOperation {
+		// Enforce the size limit before decoding, as the decoded form of
+		// the body takes up several times as much memory
+		body, err := limitRequestBody(r, core.MaxRequestSize(path, props.maxRequestSize()))
+		if err == nil {
+			if isRawRequest(r) {
+				data, err = parseRawRequest(r)
+			} else {
+				err = parseRequest(r, &data)
+			}
+			if body.exceeded {
+				err = requestTooLargeError(body.limit)
+			}
+		}
+		if errutil.CodeOf(err) == errutil.CodeRequestTooLarge {
+			// The request never reaches the core, so audit the rejection
+			// here to make it visible
+			rejected := requestAuth(r, &logical.Request{
+				ID:         request_id,
+				Operation:  op,
+				Path:       path,
+				Connection: getConnection(r),
+			})
+			if auditErr := core.AuditRejectedRequest(rejected, err); auditErr != nil {
+				return nil, http.StatusInternalServerError, vault.ErrInternalError
+			}
+			return nil, http.StatusRequestEntityTooLarge, err
+		}
 		if err == io.EOF {
 			data = nil
 			err = nil
@@ -63,12 +78,10 @@ func buildLogicalRequest(w http.ResponseWriter, r *http.Request) (*logical.Reque
 		if err != nil {
 			return nil, http.StatusBadRequest, err
 		}
-	}
-
-	var err error
-	request_id, err := uuid.GenerateUUID()
-	if err != nil {
-		return nil, http.StatusBadRequest, errwrap.Wrapf("failed to generate identifier for the request: {{err}}", err)
+	} else if op == logical.ReadOperation {
+		// The query parameters of reads are their data, such as the version
+		// of a key to read
+		data = parseQuery(r.URL.Query())
 	}
 
 	req := requestAuth(r, &logical.Request{
@@ -78,17 +91,111 @@ func buildLogicalRequest(w http.ResponseWriter, r *http.Request) (*logical.Reque
 		Data:       data,
 		Connection: getConnection(r),
 	})
+	req = requestMFACreds(r, req)
 	req, err = requestWrapTTL(r, req)
 	if err != nil {
 		return nil, http.StatusBadRequest, errwrap.Wrapf("error parsing X-Vault-Wrap-TTL header: {{err}}", err)
 	}
+	req.SetContext(r.Context())
 
 	return req, 0, nil
 }
 
-func handleLogical(core *vault.Core, dataOnly bool, prepareRequestCallback PrepareRequestFunc) http.Handler {
+// rawRequestContentTypes are the content types of request bodies that are
+// not JSON and are handed to the backend as they are, such as the DER
+// encoded requests sent to an OCSP responder or the raft snapshots being
+// restored
+var rawRequestContentTypes = []string{
+	"application/ocsp-request",
+	"application/octet-stream",
+}
+
+// isRawRequest returns whether the body of r should be passed to the
+// backend undecoded
+func isRawRequest(r *http.Request) bool {
+	contentType := r.Header.Get("Content-Type")
+	if idx := strings.Index(contentType, ";"); idx != -1 {
+		contentType = contentType[:idx]
+	}
+	contentType = strings.TrimSpace(contentType)
+	for _, rawType := range rawRequestContentTypes {
+		if strings.EqualFold(contentType, rawType) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRawRequest returns request data holding the body of r under
+// logical.HTTPRawBody
+func parseRawRequest(r *http.Request) (map[string]interface{}, error) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(body) == 0 {
+		return nil, io.EOF
+	}
+	return map[string]interface{}{
+		logical.HTTPRawBody: body,
+	}, nil
+}
+
+// parseQuery returns the query parameters as request data. Parameters given
+// once are strings, and those given several times lists of strings.
+func parseQuery(values url.Values) map[string]interface{} {
+	var data map[string]interface{}
+	for k, v := range values {
+		// The list parameter selects the operation rather than being data
+		if k == "list" || len(v) == 0 {
+			continue
+		}
+		if data == nil {
+			data = make(map[string]interface{})
+		}
+		if len(v) == 1 {
+			data[k] = v[0]
+		} else {
+			data[k] = v
+		}
+	}
+	return data
+}
+
+// requestOperation returns the operation of a request, or the status code
+// to respond with if the method or the list parameter is invalid
+func requestOperation(r *http.Request) (logical.Operation, int) {
+	switch r.Method {
+	case "DELETE":
+		return logical.DeleteOperation, 0
+	case "GET":
+		// Need to call ParseForm to get query params loaded
+		queryVals := r.URL.Query()
+		listStr := queryVals.Get("list")
+		if listStr != "" {
+			list, err := strconv.ParseBool(listStr)
+			if err != nil {
+				return "", http.StatusBadRequest
+			}
+			if list {
+				return logical.ListOperation, 0
+			}
+		}
+		return logical.ReadOperation, 0
+	case "POST", "PUT":
+		return logical.UpdateOperation, 0
+	case "PATCH":
+		return logical.PatchOperation, 0
+	case "LIST":
+		return logical.ListOperation, 0
+	default:
+		return "", http.StatusMethodNotAllowed
+	}
+}
+
+func handleLogical(core *vault.Core, props *HandlerProperties, dataOnly bool, prepareRequestCallback PrepareRequestFunc) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		req, statusCode, err := buildLogicalRequest(w, r)
+		req, statusCode, err := buildLogicalRequest(core, props, w, r)
 		if err != nil || statusCode != 0 {
 			respondError(w, statusCode, err)
 			return
@@ -111,6 +218,15 @@ func handleLogical(core *vault.Core, dataOnly bool, prepareRequestCallback Prepa
 		if !ok {
 			return
 		}
+
+		// Return the state after a write, for the client to read it on a
+		// performance standby
+		if req.Operation != logical.ReadOperation && req.Operation != logical.ListOperation {
+			if state := core.WriteLogState(); state != "" {
+				w.Header().Set(IndexHeaderName, state)
+			}
+		}
+
 		switch {
 		case req.Operation == logical.ReadOperation:
 			if resp == nil {
@@ -158,6 +274,12 @@ func respondLogical(w http.ResponseWriter, r *http.Request, req *logical.Request
 			return
 		}
 
+		// Check if this is a streamed response
+		if resp.Stream != nil {
+			respondStream(w, resp)
+			return
+		}
+
 		// Check if this is a raw response
 		if _, ok := resp.Data[logical.HTTPContentType]; ok {
 			respondRaw(w, r, req.Path, resp)
@@ -170,6 +292,7 @@ func respondLogical(w http.ResponseWriter, r *http.Request, req *logical.Request
 					Token:           resp.WrapInfo.Token,
 					TTL:             int(resp.WrapInfo.TTL.Seconds()),
 					CreationTime:    resp.WrapInfo.CreationTime,
+					Accessor:        resp.WrapInfo.Accessor,
 					WrappedAccessor: resp.WrapInfo.WrappedAccessor,
 				},
 			}
@@ -245,6 +368,61 @@ func respondRaw(w http.ResponseWriter, r *http.Request, path string, resp *logic
 	w.Write(body)
 }
 
+// respondStream is used when the response has a Stream, which is copied to
+// the client as it is read. Since the length is not known in advance, the
+// body is sent with chunked transfer encoding, and each chunk is flushed so
+// that the client receives data as soon as it is available.
+func respondStream(w http.ResponseWriter, resp *logical.Response) {
+	stream := resp.Stream
+	defer stream.Body.Close()
+
+	// Ensure this is never a secret or auth response
+	if resp.Secret != nil || resp.Auth != nil {
+		respondError(w, http.StatusInternalServerError, nil)
+		return
+	}
+
+	status := stream.StatusCode
+	if status == 0 {
+		status = http.StatusOK
+	}
+	contentType := stream.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := stream.Body.Read(buf)
+		if n > 0 {
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			// The status has already been sent, so the only way to tell
+			// the client that the body is incomplete is to close the
+			// connection before the final chunk is written
+			if hijacker, ok := w.(http.Hijacker); ok {
+				if conn, _, err := hijacker.Hijack(); err == nil {
+					conn.Close()
+				}
+			}
+			return
+		}
+	}
+}
+
 // getConnection is used to format the connection information for
 // attaching to a logical request
 func getConnection(r *http.Request) (connection *logical.Connection) {
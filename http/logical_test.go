@@ -5,12 +5,17 @@ import (
 	"encoding/json"
 	"io"
 	"log"
+	"net/http"
+	"net/url"
 	"os"
 	"reflect"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/physical"
 	"github.com/hashicorp/vault/vault"
 )
@@ -145,6 +150,7 @@ func TestLogical_StandbyRedirect(t *testing.T) {
 			"ttl":              json.Number("0"),
 			"creation_ttl":     json.Number("0"),
 			"explicit_max_ttl": json.Number("0"),
+			"type":             "service",
 		},
 		"warnings":  nilWarnings,
 		"wrap_info": nil,
@@ -232,3 +238,112 @@ func TestLogical_RawHTTP(t *testing.T) {
 		t.Fatalf("Bad: %s", body.Bytes())
 	}
 }
+
+func TestLogical_StreamHTTP(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	resp := testHttpPost(t, token, addr+"/v1/sys/mounts/foo", map[string]interface{}{
+		"type": "http",
+	})
+	testResponseStatus(t, resp, 204)
+
+	resp = testHttpGet(t, token, addr+"/v1/foo/stream")
+	testResponseStatus(t, resp, 200)
+
+	if resp.Header.Get("Content-Type") != "plain/text" {
+		t.Fatalf("Bad: %#v", resp.Header)
+	}
+	if len(resp.TransferEncoding) != 1 || resp.TransferEncoding[0] != "chunked" {
+		t.Fatalf("Bad: %#v", resp.TransferEncoding)
+	}
+
+	body := new(bytes.Buffer)
+	io.Copy(body, resp.Body)
+	if body.String() != strings.Repeat("hello world", 10000) {
+		t.Fatalf("Bad: %d bytes", body.Len())
+	}
+
+	// Streamed responses cannot be wrapped
+	req, err := http.NewRequest("GET", addr+"/v1/foo/stream", nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req.Header.Set(AuthHeaderName, token)
+	req.Header.Set(WrapTTLHeaderName, "60s")
+	resp, err = cleanhttp.DefaultClient().Do(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	testResponseStatus(t, resp, 400)
+}
+
+func TestLogical_MaxRequestSize(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestListener(t)
+	defer ln.Close()
+	go (&http.Server{
+		Handler: HandlerWithProperties(core, &HandlerProperties{MaxRequestSize: 64}),
+	}).Serve(ln)
+
+	resp := testHttpPut(t, token, addr+"/v1/secret/foo", map[string]interface{}{
+		"data": "bar",
+	})
+	testResponseStatus(t, resp, 204)
+
+	resp = testHttpPut(t, token, addr+"/v1/secret/foo", map[string]interface{}{
+		"data": strings.Repeat("a", 64),
+	})
+	testResponseStatus(t, resp, 413)
+
+	var actual ErrorResponse
+	testResponseBody(t, resp, &actual)
+	if actual.ErrorCode != string(errutil.CodeRequestTooLarge) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// Bodies of unknown length are cut off at the limit
+	req, err := http.NewRequest("PUT", addr+"/v1/secret/foo", io.MultiReader(
+		strings.NewReader(`{"data": "`),
+		strings.NewReader(strings.Repeat("a", 64)),
+		strings.NewReader(`"}`)))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req.Header.Set(AuthHeaderName, token)
+	resp, err = cleanhttp.DefaultClient().Do(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	testResponseStatus(t, resp, 413)
+
+	// A mount's limit overrides the listener's
+	resp = testHttpPost(t, token, addr+"/v1/sys/mounts/secret/tune", map[string]interface{}{
+		"max_request_size": 1024,
+	})
+	testResponseStatus(t, resp, 204)
+
+	resp = testHttpPut(t, token, addr+"/v1/secret/foo", map[string]interface{}{
+		"data": strings.Repeat("a", 64),
+	})
+	testResponseStatus(t, resp, 204)
+}
+
+func TestLogical_parseQuery(t *testing.T) {
+	values, err := url.ParseQuery("version=2&list=false&tag=a&tag=b")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expected := map[string]interface{}{
+		"version": "2",
+		"tag":     []string{"a", "b"},
+	}
+	if actual := parseQuery(values); !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("bad: %#v", actual)
+	}
+	if actual := parseQuery(url.Values{}); actual != nil {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
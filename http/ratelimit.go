@@ -0,0 +1,278 @@
+package http
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/helper/salt"
+	"github.com/hashicorp/vault/vault"
+)
+
+const (
+	// rateLimitSweepInterval is how often buckets that have refilled
+	// completely, and are therefore no different from new ones, are removed
+	rateLimitSweepInterval = time.Minute
+)
+
+// RateLimit is the limit of a token bucket: requests are allowed at Rate
+// per second on average, with bursts of up to Burst requests. A Rate of
+// zero disables the limit.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+func (l RateLimit) enabled() bool {
+	return l.Rate > 0
+}
+
+// burst returns the size of the bucket, which defaults to one second's
+// worth of requests
+func (l RateLimit) burst() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return math.Max(1, math.Ceil(l.Rate))
+}
+
+// RateLimits are the rate limits of a handler. Each of the limits is
+// enforced separately, and a request is only allowed if all of them allow
+// it.
+type RateLimits struct {
+	// Listener limits all requests received by the handler
+	Listener RateLimit
+
+	// Client limits the requests from each client IP address
+	Client RateLimit
+
+	// Token limits the requests made with each valid token, identified by
+	// a salted hash of the token. Requests with an unknown token are limited
+	// by client IP address instead, and requests without a token are not
+	// subject to it.
+	Token RateLimit
+
+	// Mount limits the requests to each mount path
+	Mount RateLimit
+}
+
+func (l RateLimits) enabled() bool {
+	return l.Listener.enabled() || l.Client.enabled() || l.Token.enabled() || l.Mount.enabled()
+}
+
+// tokenBucket is the state of a single token bucket
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// refill adds the tokens accumulated since the bucket was last used
+func (b *tokenBucket) refill(limit RateLimit, now time.Time) {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed > 0 {
+		b.tokens = math.Min(limit.burst(), b.tokens+elapsed*limit.Rate)
+	}
+	b.last = now
+}
+
+// full returns whether the bucket would have refilled completely by now
+func (b *tokenBucket) full(limit RateLimit, now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*limit.Rate >= limit.burst()
+}
+
+// rateLimitKeys identify the buckets a request is counted against. Empty
+// keys are skipped.
+type rateLimitKeys struct {
+	client string
+	token  string
+	mount  string
+}
+
+// rateLimiter keeps the token buckets of a set of rate limits
+type rateLimiter struct {
+	limits RateLimits
+
+	l         sync.Mutex
+	listener  *tokenBucket
+	clients   map[string]*tokenBucket
+	tokens    map[string]*tokenBucket
+	mounts    map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func newRateLimiter(limits RateLimits) *rateLimiter {
+	return &rateLimiter{
+		limits:  limits,
+		clients: make(map[string]*tokenBucket),
+		tokens:  make(map[string]*tokenBucket),
+		mounts:  make(map[string]*tokenBucket),
+	}
+}
+
+// allow takes a token from every bucket the request is counted against. If
+// any of them is empty, no tokens are taken, and the name of the limit that
+// rejected the request is returned along with how long to wait before
+// retrying.
+func (r *rateLimiter) allow(keys rateLimitKeys, now time.Time) (string, time.Duration) {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	if r.lastSweep.IsZero() {
+		r.lastSweep = now
+	}
+	if now.Sub(r.lastSweep) >= rateLimitSweepInterval {
+		r.sweep(now)
+	}
+
+	type check struct {
+		name   string
+		limit  RateLimit
+		bucket *tokenBucket
+	}
+	checks := make([]check, 0, 4)
+	if r.limits.Listener.enabled() {
+		if r.listener == nil {
+			r.listener = newTokenBucket(r.limits.Listener, now)
+		}
+		checks = append(checks, check{"listener", r.limits.Listener, r.listener})
+	}
+	if r.limits.Client.enabled() && keys.client != "" {
+		checks = append(checks, check{"client", r.limits.Client, r.bucket(r.clients, keys.client, r.limits.Client, now)})
+	}
+	if r.limits.Token.enabled() && keys.token != "" {
+		checks = append(checks, check{"token", r.limits.Token, r.bucket(r.tokens, keys.token, r.limits.Token, now)})
+	}
+	if r.limits.Mount.enabled() && keys.mount != "" {
+		checks = append(checks, check{"mount", r.limits.Mount, r.bucket(r.mounts, keys.mount, r.limits.Mount, now)})
+	}
+
+	var rejectedBy string
+	var wait time.Duration
+	for _, c := range checks {
+		c.bucket.refill(c.limit, now)
+		if c.bucket.tokens >= 1 {
+			continue
+		}
+		if rejectedBy == "" {
+			rejectedBy = c.name
+		}
+		if w := time.Duration((1 - c.bucket.tokens) / c.limit.Rate * float64(time.Second)); w > wait {
+			wait = w
+		}
+	}
+	if rejectedBy != "" {
+		return rejectedBy, wait
+	}
+
+	for _, c := range checks {
+		c.bucket.tokens--
+	}
+	return "", 0
+}
+
+// newTokenBucket returns a full bucket for the given limit
+func newTokenBucket(limit RateLimit, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		tokens: limit.burst(),
+		last:   now,
+	}
+}
+
+// bucket returns the bucket for key, creating it if needed
+func (r *rateLimiter) bucket(buckets map[string]*tokenBucket, key string, limit RateLimit, now time.Time) *tokenBucket {
+	b, ok := buckets[key]
+	if !ok {
+		b = newTokenBucket(limit, now)
+		buckets[key] = b
+	}
+	return b
+}
+
+// sweep removes the buckets that have refilled completely, so that the
+// number of buckets does not grow with every client and token ever seen
+func (r *rateLimiter) sweep(now time.Time) {
+	sweepBuckets := func(buckets map[string]*tokenBucket, limit RateLimit) {
+		for key, b := range buckets {
+			if b.full(limit, now) {
+				delete(buckets, key)
+			}
+		}
+	}
+	sweepBuckets(r.clients, r.limits.Client)
+	sweepBuckets(r.tokens, r.limits.Token)
+	sweepBuckets(r.mounts, r.limits.Mount)
+	r.lastSweep = now
+}
+
+// handleRateLimit wraps handler so that requests over the given limits are
+// rejected with a 429 status code
+func handleRateLimit(core *vault.Core, limits RateLimits, handler http.Handler) http.Handler {
+	limiter := newRateLimiter(limits)
+
+	// Token buckets are keyed by a salted hash of the token rather than by
+	// its accessor, so that batch tokens, which have no accessor, are
+	// limited as well. Without a salt, the hashes could be matched against
+	// known tokens, so no request is served.
+	tokenSalt, err := uuid.GenerateUUID()
+	if err != nil {
+		core.Logger().Printf("[ERR] http/handleRateLimit: failed to generate token salt: %v", err)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			respondError(w, http.StatusInternalServerError, fmt.Errorf("rate limiting is unavailable"))
+		})
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Health checks are exempt so that load balancers do not take a
+		// busy node out of service
+		if r.URL.Path == "/v1/sys/health" {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+
+		var keys rateLimitKeys
+		if limits.Client.enabled() {
+			keys.client = host
+		}
+		if limits.Token.enabled() {
+			// Only valid tokens get a bucket of their own, so that requests
+			// with made-up tokens cannot grow the buckets without bound;
+			// the others share the bucket of their client
+			if token := r.Header.Get(AuthHeaderName); token != "" {
+				if core.ValidToken(token) {
+					keys.token = salt.SaltID(tokenSalt, token, salt.SHA256Hash)
+				} else {
+					keys.token = host
+				}
+			}
+		}
+		if limits.Mount.enabled() {
+			if path, ok := stripPrefix("/v1/", r.URL.Path); ok {
+				keys.mount = core.MatchingMount(path)
+			}
+		}
+
+		rejectedBy, wait := limiter.allow(keys, time.Now())
+		if rejectedBy != "" {
+			metrics.IncrCounter([]string{"http", "rate_limit", rejectedBy, "rejected"}, 1)
+
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			respondError(w, http.StatusTooManyRequests, errutil.WithCode(errutil.CodeRateLimited,
+				fmt.Errorf("%s rate limit exceeded", rejectedBy)))
+			return
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
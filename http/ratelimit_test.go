@@ -0,0 +1,148 @@
+package http
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/vault"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	limiter := newRateLimiter(RateLimits{
+		Listener: RateLimit{Rate: 10, Burst: 5},
+		Client:   RateLimit{Rate: 1, Burst: 2},
+	})
+	now := time.Now()
+	foo := rateLimitKeys{client: "foo"}
+	bar := rateLimitKeys{client: "bar"}
+
+	// The client bucket runs out first
+	for i := 0; i < 2; i++ {
+		if rejectedBy, _ := limiter.allow(foo, now); rejectedBy != "" {
+			t.Fatalf("request %d rejected by %s", i, rejectedBy)
+		}
+	}
+	rejectedBy, wait := limiter.allow(foo, now)
+	if rejectedBy != "client" {
+		t.Fatalf("bad: %q", rejectedBy)
+	}
+	if wait != time.Second {
+		t.Fatalf("bad: %s", wait)
+	}
+
+	// Other clients are only limited by the listener bucket, which still
+	// has three tokens, as the rejected request did not take one
+	for i := 0; i < 2; i++ {
+		if rejectedBy, _ := limiter.allow(bar, now); rejectedBy != "" {
+			t.Fatalf("request %d rejected by %s", i, rejectedBy)
+		}
+	}
+	if rejectedBy, _ := limiter.allow(rateLimitKeys{client: "baz"}, now); rejectedBy != "" {
+		t.Fatalf("rejected by %s", rejectedBy)
+	}
+	if rejectedBy, _ := limiter.allow(rateLimitKeys{client: "baz"}, now); rejectedBy != "listener" {
+		t.Fatalf("bad: %q", rejectedBy)
+	}
+
+	// Both buckets refill over time
+	now = now.Add(time.Second)
+	if rejectedBy, _ := limiter.allow(foo, now); rejectedBy != "" {
+		t.Fatalf("rejected by %s", rejectedBy)
+	}
+	if rejectedBy, _ := limiter.allow(foo, now); rejectedBy != "client" {
+		t.Fatalf("bad: %q", rejectedBy)
+	}
+}
+
+func TestRateLimiter_Sweep(t *testing.T) {
+	limiter := newRateLimiter(RateLimits{
+		Client: RateLimit{Rate: 0.1, Burst: 10},
+	})
+	now := time.Now()
+	limiter.allow(rateLimitKeys{client: "foo"}, now)
+	limiter.allow(rateLimitKeys{client: "bar"}, now.Add(55*time.Second))
+	if len(limiter.clients) != 2 {
+		t.Fatalf("bad: %#v", limiter.clients)
+	}
+
+	// Only the bucket that has refilled completely is removed
+	limiter.allow(rateLimitKeys{client: "baz"}, now.Add(rateLimitSweepInterval))
+	if _, ok := limiter.clients["foo"]; ok {
+		t.Fatal("expected the bucket of foo to be removed")
+	}
+	if len(limiter.clients) != 2 {
+		t.Fatalf("bad: %#v", limiter.clients)
+	}
+}
+
+func TestHandler_RateLimit(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestListener(t)
+	defer ln.Close()
+	go (&http.Server{
+		Handler: HandlerWithProperties(core, &HandlerProperties{
+			RateLimits: RateLimits{
+				Token: RateLimit{Rate: 0.001, Burst: 2},
+			},
+		}),
+	}).Serve(ln)
+
+	for i := 0; i < 2; i++ {
+		resp := testHttpGet(t, token, addr+"/v1/sys/mounts")
+		testResponseStatus(t, resp, 200)
+	}
+
+	resp := testHttpGet(t, token, addr+"/v1/sys/mounts")
+	testResponseStatus(t, resp, 429)
+	if v := resp.Header.Get("Retry-After"); v != "1000" {
+		t.Fatalf("bad: %q", v)
+	}
+	var actual ErrorResponse
+	testResponseBody(t, resp, &actual)
+	if actual.ErrorCode != string(errutil.CodeRateLimited) {
+		t.Fatalf("bad: %#v", actual)
+	}
+
+	// Health checks and requests without a token are not limited
+	resp = testHttpGet(t, "", addr+"/v1/sys/health")
+	testResponseStatus(t, resp, 200)
+	resp = testHttpGet(t, "", addr+"/v1/sys/seal-status")
+	testResponseStatus(t, resp, 200)
+}
+
+func TestHandler_RateLimitBatchToken(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestListener(t)
+	defer ln.Close()
+	go (&http.Server{
+		Handler: HandlerWithProperties(core, &HandlerProperties{
+			RateLimits: RateLimits{
+				Token: RateLimit{Rate: 0.001, Burst: 1},
+			},
+		}),
+	}).Serve(ln)
+
+	// The root token uses up its own bucket creating the batch token
+	resp := testHttpPost(t, token, addr+"/v1/auth/token/create", map[string]interface{}{
+		"type":     "batch",
+		"policies": []string{"default"},
+	})
+	testResponseStatus(t, resp, 200)
+	var result map[string]interface{}
+	testResponseBody(t, resp, &result)
+	batch := result["auth"].(map[string]interface{})["client_token"].(string)
+
+	// Batch tokens have no accessor, and are limited all the same
+	resp = testHttpGet(t, batch, addr+"/v1/auth/token/lookup-self")
+	testResponseStatus(t, resp, 200)
+	resp = testHttpGet(t, batch, addr+"/v1/auth/token/lookup-self")
+	testResponseStatus(t, resp, 429)
+
+	// Unknown tokens share the bucket of their client
+	resp = testHttpGet(t, "foo", addr+"/v1/sys/mounts")
+	testResponseStatus(t, resp, 403)
+	resp = testHttpGet(t, "bar", addr+"/v1/sys/mounts")
+	testResponseStatus(t, resp, 429)
+}
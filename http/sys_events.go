@@ -0,0 +1,134 @@
+package http
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/vault"
+)
+
+const (
+	// eventsHeartbeatInterval is how often a comment is sent on an idle
+	// event stream, so that proxies do not close the connection
+	eventsHeartbeatInterval = 30 * time.Second
+)
+
+// handleSysEvents streams the events published by the core as server-sent
+// events. Streams cannot be forwarded, so standbys redirect clients to the
+// active node.
+func handleSysEvents(core *vault.Core) http.Handler {
+	return handleSysEventsHeartbeat(core, eventsHeartbeatInterval)
+}
+
+func handleSysEventsHeartbeat(core *vault.Core, heartbeat time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			respondError(w, http.StatusMethodNotAllowed, nil)
+			return
+		}
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			respondError(w, http.StatusInternalServerError,
+				fmt.Errorf("streaming is not supported by the connection"))
+			return
+		}
+
+		req, statusCode, err := buildLogicalRequest(core, nil, w, r)
+		if err != nil || statusCode != 0 {
+			respondError(w, statusCode, err)
+			return
+		}
+		if req.Operation != logical.ReadOperation {
+			respondError(w, http.StatusMethodNotAllowed, nil)
+			return
+		}
+
+		// Check that the token may subscribe, which also audits the request
+		if _, ok := request(core, w, r, req); !ok {
+			return
+		}
+
+		sub, err := core.SubscribeEvents()
+		switch {
+		case err == vault.ErrStandby:
+			respondStandby(core, w, r.URL)
+			return
+		case err != nil:
+			respondError(w, http.StatusInternalServerError, err)
+			return
+		}
+		defer sub.Close()
+
+		types := eventTypeFilter(r)
+
+		var closed <-chan bool
+		if notifier, ok := w.(http.CloseNotifier); ok {
+			closed = notifier.CloseNotify()
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case event, ok := <-sub.Events:
+				if !ok {
+					return
+				}
+				if types != nil && !types[event.Type] {
+					continue
+				}
+				if err := writeEvent(w, event); err != nil {
+					return
+				}
+			case <-ticker.C:
+				if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+					return
+				}
+			case <-closed:
+				return
+			}
+			flusher.Flush()
+		}
+	})
+}
+
+// eventTypeFilter returns the event types requested with the "type" query
+// parameter, which can be repeated or hold a comma-separated list, or nil if
+// all events are wanted
+func eventTypeFilter(r *http.Request) map[string]bool {
+	var types map[string]bool
+	for _, value := range r.URL.Query()["type"] {
+		for _, t := range strings.Split(value, ",") {
+			t = strings.TrimSpace(t)
+			if t == "" {
+				continue
+			}
+			if types == nil {
+				types = make(map[string]bool)
+			}
+			types[t] = true
+		}
+	}
+	return types
+}
+
+// writeEvent writes a single event in the server-sent events format
+func writeEvent(w http.ResponseWriter, event *vault.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+	return err
+}
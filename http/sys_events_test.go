@@ -0,0 +1,124 @@
+package http
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/vault"
+)
+
+// testReadEvent reads the next event from a server-sent events stream,
+// skipping comments
+func testReadEvent(t *testing.T, r *bufio.Reader) (string, map[string]interface{}) {
+	var eventType string
+	var event map[string]interface{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if eventType != "" {
+				return eventType, event
+			}
+		case strings.HasPrefix(line, "event: "):
+			eventType = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+				t.Fatalf("err: %s", err)
+			}
+		}
+	}
+}
+
+func TestSysEvents(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	resp := testHttpGet(t, "", addr+"/v1/sys/events")
+	testResponseStatus(t, resp, 400)
+
+	req, err := http.NewRequest("GET", addr+"/v1/sys/events?type=mount-enabled,policy-updated", nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	req.Header.Set(AuthHeaderName, token)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer resp.Body.Close()
+	testResponseStatus(t, resp, 200)
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("bad: %s", ct)
+	}
+
+	// Filtered out
+	resp2 := testHttpPost(t, token, addr+"/v1/sys/auth/foo", map[string]interface{}{
+		"type": "noop",
+	})
+	testResponseStatus(t, resp2, 204)
+
+	resp2 = testHttpPost(t, token, addr+"/v1/sys/mounts/foo", map[string]interface{}{
+		"type": "generic",
+	})
+	testResponseStatus(t, resp2, 204)
+
+	events := bufio.NewReader(resp.Body)
+	eventType, event := testReadEvent(t, events)
+	if eventType != vault.EventMountEnabled {
+		t.Fatalf("bad: %s", eventType)
+	}
+	data := event["data"].(map[string]interface{})
+	if data["path"] != "foo/" || data["type"] != "generic" {
+		t.Fatalf("bad: %#v", event)
+	}
+
+	resp2 = testHttpPut(t, token, addr+"/v1/sys/policy/foo", map[string]interface{}{
+		"rules": `path "foo/" { policy = "read" }`,
+	})
+	testResponseStatus(t, resp2, 204)
+
+	eventType, event = testReadEvent(t, events)
+	if eventType != vault.EventPolicyUpdated {
+		t.Fatalf("bad: %s", eventType)
+	}
+	if event["data"].(map[string]interface{})["name"] != "foo" {
+		t.Fatalf("bad: %#v", event)
+	}
+}
+
+func TestSysEvents_heartbeat(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestListener(t)
+	defer ln.Close()
+	go http.Serve(ln, handleSysEventsHeartbeat(core, 10*time.Millisecond))
+
+	req, err := http.NewRequest("GET", addr+"/v1/sys/events", nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	req.Header.Set(AuthHeaderName, token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer resp.Body.Close()
+	testResponseStatus(t, resp, 200)
+
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if line != ": heartbeat\n" {
+		t.Fatalf("bad: %q", line)
+	}
+}
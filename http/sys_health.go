@@ -89,6 +89,13 @@ func getSysHealth(core *vault.Core, r *http.Request) (int, *HealthResponse, erro
 		standbyCode = code
 	}
 
+	degradedCode := http.StatusServiceUnavailable
+	if code, found, ok := fetchStatusCode(r, "degradedcode"); !ok {
+		return http.StatusBadRequest, nil, nil
+	} else if found {
+		degradedCode = code
+	}
+
 	activeCode := http.StatusOK
 	if code, found, ok := fetchStatusCode(r, "activecode"); !ok {
 		return http.StatusBadRequest, nil, nil
@@ -99,6 +106,7 @@ func getSysHealth(core *vault.Core, r *http.Request) (int, *HealthResponse, erro
 	// Check system status
 	sealed, _ := core.Sealed()
 	standby, _ := core.Standby()
+	degraded := core.StorageDegraded()
 	init, err := core.Initialized()
 	if err != nil {
 		return http.StatusInternalServerError, nil, err
@@ -111,6 +119,8 @@ func getSysHealth(core *vault.Core, r *http.Request) (int, *HealthResponse, erro
 		code = http.StatusInternalServerError
 	case sealed:
 		code = sealedCode
+	case degraded:
+		code = degradedCode
 	case !standbyOK && standby:
 		code = standbyCode
 	}
@@ -138,16 +148,38 @@ func getSysHealth(core *vault.Core, r *http.Request) (int, *HealthResponse, erro
 		Version:       version.GetVersion().String(),
 		ClusterName:   clusterName,
 		ClusterID:     clusterID,
+		Warnings:      core.MlockWarnings(),
+
+		StorageDegraded: degraded,
+	}
+	if restored, total, done, ok := core.LeaseRestoreProgress(); ok {
+		body.LeaseRestore = &LeaseRestoreStatus{
+			Restored: restored,
+			Total:    total,
+			Complete: done,
+		}
 	}
 	return code, body, nil
 }
 
 type HealthResponse struct {
-	Initialized   bool   `json:"initialized"`
-	Sealed        bool   `json:"sealed"`
-	Standby       bool   `json:"standby"`
-	ServerTimeUTC int64  `json:"server_time_utc"`
-	Version       string `json:"version"`
-	ClusterName   string `json:"cluster_name,omitempty"`
-	ClusterID     string `json:"cluster_id,omitempty"`
+	Initialized   bool     `json:"initialized"`
+	Sealed        bool     `json:"sealed"`
+	Standby       bool     `json:"standby"`
+	ServerTimeUTC int64    `json:"server_time_utc"`
+	Version       string   `json:"version"`
+	ClusterName   string   `json:"cluster_name,omitempty"`
+	ClusterID     string   `json:"cluster_id,omitempty"`
+	Warnings      []string `json:"warnings,omitempty"`
+
+	StorageDegraded bool                `json:"storage_degraded,omitempty"`
+	LeaseRestore    *LeaseRestoreStatus `json:"lease_restore,omitempty"`
+}
+
+// LeaseRestoreStatus is the progress of restoring the leases on the active
+// node after it was unsealed
+type LeaseRestoreStatus struct {
+	Restored int  `json:"restored"`
+	Total    int  `json:"total"`
+	Complete bool `json:"complete"`
 }
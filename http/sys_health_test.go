@@ -1,6 +1,7 @@
 package http
 
 import (
+	"encoding/json"
 	"io/ioutil"
 
 	"net/http"
@@ -26,6 +27,11 @@ func TestSysHealth_get(t *testing.T) {
 		"initialized": true,
 		"sealed":      false,
 		"standby":     false,
+		"lease_restore": map[string]interface{}{
+			"restored": json.Number("0"),
+			"total":    json.Number("0"),
+			"complete": true,
+		},
 	}
 	testResponseStatus(t, resp, 200)
 	testResponseBody(t, resp, &actual)
@@ -96,6 +102,11 @@ func TestSysHealth_customcodes(t *testing.T) {
 		"initialized": true,
 		"sealed":      false,
 		"standby":     false,
+		"lease_restore": map[string]interface{}{
+			"restored": json.Number("0"),
+			"total":    json.Number("0"),
+			"complete": true,
+		},
 	}
 	testResponseStatus(t, resp, 202)
 	testResponseBody(t, resp, &actual)
@@ -38,7 +38,7 @@ func handleSysInitGet(core *vault.Core, w http.ResponseWriter, r *http.Request)
 func handleSysInitPut(core *vault.Core, w http.ResponseWriter, r *http.Request) {
 	// Parse the request
 	var req InitRequest
-	if err := parseRequest(r, &req); err != nil {
+	if err := parseRequestStrict(r, &req); err != nil {
 		respondError(w, http.StatusBadRequest, err)
 		return
 	}
@@ -49,6 +49,7 @@ func handleSysInitPut(core *vault.Core, w http.ResponseWriter, r *http.Request)
 		SecretThreshold: req.SecretThreshold,
 		StoredShares:    req.StoredShares,
 		PGPKeys:         req.PGPKeys,
+		BarrierCipher:   req.BarrierCipher,
 	}
 
 	recoveryConfig := &vault.SealConfig{
@@ -128,6 +129,7 @@ type InitRequest struct {
 	RecoveryShares    int      `json:"recovery_shares"`
 	RecoveryThreshold int      `json:"recovery_threshold"`
 	RecoveryPGPKeys   []string `json:"recovery_pgp_keys"`
+	BarrierCipher     string   `json:"barrier_cipher"`
 }
 
 type InitResponse struct {
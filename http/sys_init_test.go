@@ -94,3 +94,24 @@ func TestSysInit_put(t *testing.T) {
 		t.Fatal("should not be sealed")
 	}
 }
+
+func TestSysInit_put_unknownField(t *testing.T) {
+	core := vault.TestCore(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	// A misspelled field should not silently fall back to the default
+	resp := testHttpPut(t, "", addr+"/v1/sys/init", map[string]interface{}{
+		"secret_shares":   5,
+		"secret_treshold": 3,
+	})
+	testResponseStatus(t, resp, 400)
+
+	init, err := core.Initialized()
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if init {
+		t.Fatal("should not be initialized")
+	}
+}
@@ -32,7 +32,9 @@ func TestSysMounts(t *testing.T) {
 				"config": map[string]interface{}{
 					"default_lease_ttl": json.Number("0"),
 					"max_lease_ttl":     json.Number("0"),
+					"max_request_size":  json.Number("0"),
 				},
+				"ready": true,
 			},
 			"sys/": map[string]interface{}{
 				"description": "system endpoints used for control, policy and debugging",
@@ -40,7 +42,9 @@ func TestSysMounts(t *testing.T) {
 				"config": map[string]interface{}{
 					"default_lease_ttl": json.Number("0"),
 					"max_lease_ttl":     json.Number("0"),
+					"max_request_size":  json.Number("0"),
 				},
+				"ready": true,
 			},
 			"cubbyhole/": map[string]interface{}{
 				"description": "per-token private secret storage",
@@ -48,7 +52,9 @@ func TestSysMounts(t *testing.T) {
 				"config": map[string]interface{}{
 					"default_lease_ttl": json.Number("0"),
 					"max_lease_ttl":     json.Number("0"),
+					"max_request_size":  json.Number("0"),
 				},
+				"ready": true,
 			},
 		},
 		"secret/": map[string]interface{}{
@@ -57,7 +63,9 @@ func TestSysMounts(t *testing.T) {
 			"config": map[string]interface{}{
 				"default_lease_ttl": json.Number("0"),
 				"max_lease_ttl":     json.Number("0"),
+				"max_request_size":  json.Number("0"),
 			},
+			"ready": true,
 		},
 		"sys/": map[string]interface{}{
 			"description": "system endpoints used for control, policy and debugging",
@@ -65,7 +73,9 @@ func TestSysMounts(t *testing.T) {
 			"config": map[string]interface{}{
 				"default_lease_ttl": json.Number("0"),
 				"max_lease_ttl":     json.Number("0"),
+				"max_request_size":  json.Number("0"),
 			},
+			"ready": true,
 		},
 		"cubbyhole/": map[string]interface{}{
 			"description": "per-token private secret storage",
@@ -73,7 +83,9 @@ func TestSysMounts(t *testing.T) {
 			"config": map[string]interface{}{
 				"default_lease_ttl": json.Number("0"),
 				"max_lease_ttl":     json.Number("0"),
+				"max_request_size":  json.Number("0"),
 			},
+			"ready": true,
 		},
 	}
 	testResponseStatus(t, resp, 200)
@@ -113,7 +125,9 @@ func TestSysMount(t *testing.T) {
 				"config": map[string]interface{}{
 					"default_lease_ttl": json.Number("0"),
 					"max_lease_ttl":     json.Number("0"),
+					"max_request_size":  json.Number("0"),
 				},
+				"ready": true,
 			},
 			"secret/": map[string]interface{}{
 				"description": "generic secret storage",
@@ -121,7 +135,9 @@ func TestSysMount(t *testing.T) {
 				"config": map[string]interface{}{
 					"default_lease_ttl": json.Number("0"),
 					"max_lease_ttl":     json.Number("0"),
+					"max_request_size":  json.Number("0"),
 				},
+				"ready": true,
 			},
 			"sys/": map[string]interface{}{
 				"description": "system endpoints used for control, policy and debugging",
@@ -129,7 +145,9 @@ func TestSysMount(t *testing.T) {
 				"config": map[string]interface{}{
 					"default_lease_ttl": json.Number("0"),
 					"max_lease_ttl":     json.Number("0"),
+					"max_request_size":  json.Number("0"),
 				},
+				"ready": true,
 			},
 			"cubbyhole/": map[string]interface{}{
 				"description": "per-token private secret storage",
@@ -137,7 +155,9 @@ func TestSysMount(t *testing.T) {
 				"config": map[string]interface{}{
 					"default_lease_ttl": json.Number("0"),
 					"max_lease_ttl":     json.Number("0"),
+					"max_request_size":  json.Number("0"),
 				},
+				"ready": true,
 			},
 		},
 		"foo/": map[string]interface{}{
@@ -146,7 +166,9 @@ func TestSysMount(t *testing.T) {
 			"config": map[string]interface{}{
 				"default_lease_ttl": json.Number("0"),
 				"max_lease_ttl":     json.Number("0"),
+				"max_request_size":  json.Number("0"),
 			},
+			"ready": true,
 		},
 		"secret/": map[string]interface{}{
 			"description": "generic secret storage",
@@ -154,7 +176,9 @@ func TestSysMount(t *testing.T) {
 			"config": map[string]interface{}{
 				"default_lease_ttl": json.Number("0"),
 				"max_lease_ttl":     json.Number("0"),
+				"max_request_size":  json.Number("0"),
 			},
+			"ready": true,
 		},
 		"sys/": map[string]interface{}{
 			"description": "system endpoints used for control, policy and debugging",
@@ -162,7 +186,9 @@ func TestSysMount(t *testing.T) {
 			"config": map[string]interface{}{
 				"default_lease_ttl": json.Number("0"),
 				"max_lease_ttl":     json.Number("0"),
+				"max_request_size":  json.Number("0"),
 			},
+			"ready": true,
 		},
 		"cubbyhole/": map[string]interface{}{
 			"description": "per-token private secret storage",
@@ -170,7 +196,9 @@ func TestSysMount(t *testing.T) {
 			"config": map[string]interface{}{
 				"default_lease_ttl": json.Number("0"),
 				"max_lease_ttl":     json.Number("0"),
+				"max_request_size":  json.Number("0"),
 			},
+			"ready": true,
 		},
 	}
 	testResponseStatus(t, resp, 200)
@@ -232,7 +260,9 @@ func TestSysRemount(t *testing.T) {
 				"config": map[string]interface{}{
 					"default_lease_ttl": json.Number("0"),
 					"max_lease_ttl":     json.Number("0"),
+					"max_request_size":  json.Number("0"),
 				},
+				"ready": true,
 			},
 			"secret/": map[string]interface{}{
 				"description": "generic secret storage",
@@ -240,7 +270,9 @@ func TestSysRemount(t *testing.T) {
 				"config": map[string]interface{}{
 					"default_lease_ttl": json.Number("0"),
 					"max_lease_ttl":     json.Number("0"),
+					"max_request_size":  json.Number("0"),
 				},
+				"ready": true,
 			},
 			"sys/": map[string]interface{}{
 				"description": "system endpoints used for control, policy and debugging",
@@ -248,7 +280,9 @@ func TestSysRemount(t *testing.T) {
 				"config": map[string]interface{}{
 					"default_lease_ttl": json.Number("0"),
 					"max_lease_ttl":     json.Number("0"),
+					"max_request_size":  json.Number("0"),
 				},
+				"ready": true,
 			},
 			"cubbyhole/": map[string]interface{}{
 				"description": "per-token private secret storage",
@@ -256,7 +290,9 @@ func TestSysRemount(t *testing.T) {
 				"config": map[string]interface{}{
 					"default_lease_ttl": json.Number("0"),
 					"max_lease_ttl":     json.Number("0"),
+					"max_request_size":  json.Number("0"),
 				},
+				"ready": true,
 			},
 		},
 		"bar/": map[string]interface{}{
@@ -265,7 +301,9 @@ func TestSysRemount(t *testing.T) {
 			"config": map[string]interface{}{
 				"default_lease_ttl": json.Number("0"),
 				"max_lease_ttl":     json.Number("0"),
+				"max_request_size":  json.Number("0"),
 			},
+			"ready": true,
 		},
 		"secret/": map[string]interface{}{
 			"description": "generic secret storage",
@@ -273,7 +311,9 @@ func TestSysRemount(t *testing.T) {
 			"config": map[string]interface{}{
 				"default_lease_ttl": json.Number("0"),
 				"max_lease_ttl":     json.Number("0"),
+				"max_request_size":  json.Number("0"),
 			},
+			"ready": true,
 		},
 		"sys/": map[string]interface{}{
 			"description": "system endpoints used for control, policy and debugging",
@@ -281,7 +321,9 @@ func TestSysRemount(t *testing.T) {
 			"config": map[string]interface{}{
 				"default_lease_ttl": json.Number("0"),
 				"max_lease_ttl":     json.Number("0"),
+				"max_request_size":  json.Number("0"),
 			},
+			"ready": true,
 		},
 		"cubbyhole/": map[string]interface{}{
 			"description": "per-token private secret storage",
@@ -289,7 +331,9 @@ func TestSysRemount(t *testing.T) {
 			"config": map[string]interface{}{
 				"default_lease_ttl": json.Number("0"),
 				"max_lease_ttl":     json.Number("0"),
+				"max_request_size":  json.Number("0"),
 			},
+			"ready": true,
 		},
 	}
 	testResponseStatus(t, resp, 200)
@@ -332,7 +376,9 @@ func TestSysUnmount(t *testing.T) {
 				"config": map[string]interface{}{
 					"default_lease_ttl": json.Number("0"),
 					"max_lease_ttl":     json.Number("0"),
+					"max_request_size":  json.Number("0"),
 				},
+				"ready": true,
 			},
 			"sys/": map[string]interface{}{
 				"description": "system endpoints used for control, policy and debugging",
@@ -340,7 +386,9 @@ func TestSysUnmount(t *testing.T) {
 				"config": map[string]interface{}{
 					"default_lease_ttl": json.Number("0"),
 					"max_lease_ttl":     json.Number("0"),
+					"max_request_size":  json.Number("0"),
 				},
+				"ready": true,
 			},
 			"cubbyhole/": map[string]interface{}{
 				"description": "per-token private secret storage",
@@ -348,7 +396,9 @@ func TestSysUnmount(t *testing.T) {
 				"config": map[string]interface{}{
 					"default_lease_ttl": json.Number("0"),
 					"max_lease_ttl":     json.Number("0"),
+					"max_request_size":  json.Number("0"),
 				},
+				"ready": true,
 			},
 		},
 		"secret/": map[string]interface{}{
@@ -357,7 +407,9 @@ func TestSysUnmount(t *testing.T) {
 			"config": map[string]interface{}{
 				"default_lease_ttl": json.Number("0"),
 				"max_lease_ttl":     json.Number("0"),
+				"max_request_size":  json.Number("0"),
 			},
+			"ready": true,
 		},
 		"sys/": map[string]interface{}{
 			"description": "system endpoints used for control, policy and debugging",
@@ -365,7 +417,9 @@ func TestSysUnmount(t *testing.T) {
 			"config": map[string]interface{}{
 				"default_lease_ttl": json.Number("0"),
 				"max_lease_ttl":     json.Number("0"),
+				"max_request_size":  json.Number("0"),
 			},
+			"ready": true,
 		},
 		"cubbyhole/": map[string]interface{}{
 			"description": "per-token private secret storage",
@@ -373,7 +427,9 @@ func TestSysUnmount(t *testing.T) {
 			"config": map[string]interface{}{
 				"default_lease_ttl": json.Number("0"),
 				"max_lease_ttl":     json.Number("0"),
+				"max_request_size":  json.Number("0"),
 			},
+			"ready": true,
 		},
 	}
 	testResponseStatus(t, resp, 200)
@@ -413,7 +469,9 @@ func TestSysTuneMount(t *testing.T) {
 				"config": map[string]interface{}{
 					"default_lease_ttl": json.Number("0"),
 					"max_lease_ttl":     json.Number("0"),
+					"max_request_size":  json.Number("0"),
 				},
+				"ready": true,
 			},
 			"secret/": map[string]interface{}{
 				"description": "generic secret storage",
@@ -421,7 +479,9 @@ func TestSysTuneMount(t *testing.T) {
 				"config": map[string]interface{}{
 					"default_lease_ttl": json.Number("0"),
 					"max_lease_ttl":     json.Number("0"),
+					"max_request_size":  json.Number("0"),
 				},
+				"ready": true,
 			},
 			"sys/": map[string]interface{}{
 				"description": "system endpoints used for control, policy and debugging",
@@ -429,7 +489,9 @@ func TestSysTuneMount(t *testing.T) {
 				"config": map[string]interface{}{
 					"default_lease_ttl": json.Number("0"),
 					"max_lease_ttl":     json.Number("0"),
+					"max_request_size":  json.Number("0"),
 				},
+				"ready": true,
 			},
 			"cubbyhole/": map[string]interface{}{
 				"description": "per-token private secret storage",
@@ -437,7 +499,9 @@ func TestSysTuneMount(t *testing.T) {
 				"config": map[string]interface{}{
 					"default_lease_ttl": json.Number("0"),
 					"max_lease_ttl":     json.Number("0"),
+					"max_request_size":  json.Number("0"),
 				},
+				"ready": true,
 			},
 		},
 		"foo/": map[string]interface{}{
@@ -446,7 +510,9 @@ func TestSysTuneMount(t *testing.T) {
 			"config": map[string]interface{}{
 				"default_lease_ttl": json.Number("0"),
 				"max_lease_ttl":     json.Number("0"),
+				"max_request_size":  json.Number("0"),
 			},
+			"ready": true,
 		},
 		"secret/": map[string]interface{}{
 			"description": "generic secret storage",
@@ -454,7 +520,9 @@ func TestSysTuneMount(t *testing.T) {
 			"config": map[string]interface{}{
 				"default_lease_ttl": json.Number("0"),
 				"max_lease_ttl":     json.Number("0"),
+				"max_request_size":  json.Number("0"),
 			},
+			"ready": true,
 		},
 		"sys/": map[string]interface{}{
 			"description": "system endpoints used for control, policy and debugging",
@@ -462,7 +530,9 @@ func TestSysTuneMount(t *testing.T) {
 			"config": map[string]interface{}{
 				"default_lease_ttl": json.Number("0"),
 				"max_lease_ttl":     json.Number("0"),
+				"max_request_size":  json.Number("0"),
 			},
+			"ready": true,
 		},
 		"cubbyhole/": map[string]interface{}{
 			"description": "per-token private secret storage",
@@ -470,7 +540,9 @@ func TestSysTuneMount(t *testing.T) {
 			"config": map[string]interface{}{
 				"default_lease_ttl": json.Number("0"),
 				"max_lease_ttl":     json.Number("0"),
+				"max_request_size":  json.Number("0"),
 			},
+			"ready": true,
 		},
 	}
 	testResponseStatus(t, resp, 200)
@@ -531,7 +603,9 @@ func TestSysTuneMount(t *testing.T) {
 				"config": map[string]interface{}{
 					"default_lease_ttl": json.Number("259196400"),
 					"max_lease_ttl":     json.Number("259200000"),
+					"max_request_size":  json.Number("0"),
 				},
+				"ready": true,
 			},
 			"secret/": map[string]interface{}{
 				"description": "generic secret storage",
@@ -539,7 +613,9 @@ func TestSysTuneMount(t *testing.T) {
 				"config": map[string]interface{}{
 					"default_lease_ttl": json.Number("0"),
 					"max_lease_ttl":     json.Number("0"),
+					"max_request_size":  json.Number("0"),
 				},
+				"ready": true,
 			},
 			"sys/": map[string]interface{}{
 				"description": "system endpoints used for control, policy and debugging",
@@ -547,7 +623,9 @@ func TestSysTuneMount(t *testing.T) {
 				"config": map[string]interface{}{
 					"default_lease_ttl": json.Number("0"),
 					"max_lease_ttl":     json.Number("0"),
+					"max_request_size":  json.Number("0"),
 				},
+				"ready": true,
 			},
 			"cubbyhole/": map[string]interface{}{
 				"description": "per-token private secret storage",
@@ -555,7 +633,9 @@ func TestSysTuneMount(t *testing.T) {
 				"config": map[string]interface{}{
 					"default_lease_ttl": json.Number("0"),
 					"max_lease_ttl":     json.Number("0"),
+					"max_request_size":  json.Number("0"),
 				},
+				"ready": true,
 			},
 		},
 		"foo/": map[string]interface{}{
@@ -564,7 +644,9 @@ func TestSysTuneMount(t *testing.T) {
 			"config": map[string]interface{}{
 				"default_lease_ttl": json.Number("259196400"),
 				"max_lease_ttl":     json.Number("259200000"),
+				"max_request_size":  json.Number("0"),
 			},
+			"ready": true,
 		},
 		"secret/": map[string]interface{}{
 			"description": "generic secret storage",
@@ -572,7 +654,9 @@ func TestSysTuneMount(t *testing.T) {
 			"config": map[string]interface{}{
 				"default_lease_ttl": json.Number("0"),
 				"max_lease_ttl":     json.Number("0"),
+				"max_request_size":  json.Number("0"),
 			},
+			"ready": true,
 		},
 		"sys/": map[string]interface{}{
 			"description": "system endpoints used for control, policy and debugging",
@@ -580,7 +664,9 @@ func TestSysTuneMount(t *testing.T) {
 			"config": map[string]interface{}{
 				"default_lease_ttl": json.Number("0"),
 				"max_lease_ttl":     json.Number("0"),
+				"max_request_size":  json.Number("0"),
 			},
+			"ready": true,
 		},
 		"cubbyhole/": map[string]interface{}{
 			"description": "per-token private secret storage",
@@ -588,7 +674,9 @@ func TestSysTuneMount(t *testing.T) {
 			"config": map[string]interface{}{
 				"default_lease_ttl": json.Number("0"),
 				"max_lease_ttl":     json.Number("0"),
+				"max_request_size":  json.Number("0"),
 			},
+			"ready": true,
 		},
 	}
 
@@ -612,9 +700,11 @@ func TestSysTuneMount(t *testing.T) {
 		"data": map[string]interface{}{
 			"default_lease_ttl": json.Number("259196400"),
 			"max_lease_ttl":     json.Number("259200000"),
+			"max_request_size":  json.Number("0"),
 		},
 		"default_lease_ttl": json.Number("259196400"),
 		"max_lease_ttl":     json.Number("259200000"),
+		"max_request_size":  json.Number("0"),
 	}
 
 	testResponseStatus(t, resp, 200)
@@ -643,9 +733,11 @@ func TestSysTuneMount(t *testing.T) {
 		"data": map[string]interface{}{
 			"default_lease_ttl": json.Number("40"),
 			"max_lease_ttl":     json.Number("80"),
+			"max_request_size":  json.Number("0"),
 		},
 		"default_lease_ttl": json.Number("40"),
 		"max_lease_ttl":     json.Number("80"),
+		"max_request_size":  json.Number("0"),
 	}
 
 	testResponseStatus(t, resp, 200)
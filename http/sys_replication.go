@@ -0,0 +1,154 @@
+package http
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/vault"
+)
+
+// handleSysReplicationDRStatus returns the DR replication status. It is
+// served while sealed, as a DR secondary stays sealed until promoted.
+func handleSysReplicationDRStatus(core *vault.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			respondError(w, http.StatusMethodNotAllowed, nil)
+			return
+		}
+
+		respondOk(w, core.DRReplicationStatus())
+	})
+}
+
+func handleSysReplicationDRFailoverToken(core *vault.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			handleSysReplicationDRFailoverTokenGet(core, w, r)
+		case "POST", "PUT":
+			handleSysReplicationDRFailoverTokenPut(core, w, r)
+		case "DELETE":
+			handleSysReplicationDRFailoverTokenDelete(core, w, r)
+		default:
+			respondError(w, http.StatusMethodNotAllowed, nil)
+		}
+	})
+}
+
+func handleSysReplicationDRFailoverTokenGet(core *vault.Core, w http.ResponseWriter, r *http.Request) {
+	progress, required, err := core.DRFailoverTokenProgress()
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	respondOk(w, &DRFailoverTokenStatusResponse{
+		Progress: progress,
+		Required: required,
+	})
+}
+
+func handleSysReplicationDRFailoverTokenPut(core *vault.Core, w http.ResponseWriter, r *http.Request) {
+	// Parse the request
+	var req DRFailoverTokenUpdateRequest
+	if err := parseRequest(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Key == "" {
+		respondError(
+			w, http.StatusBadRequest,
+			errors.New("'key' must specified in request body as JSON"))
+		return
+	}
+
+	// Decode the key, which is base64 or hex encoded
+	min, max := core.BarrierKeyLength()
+	key, err := hex.DecodeString(req.Key)
+	// We check min and max here to ensure that a string that is base64
+	// encoded but also valid hex will not be valid and we instead base64
+	// decode it
+	if err != nil || len(key) < min || len(key) > max {
+		key, err = base64.StdEncoding.DecodeString(req.Key)
+		if err != nil {
+			respondError(
+				w, http.StatusBadRequest,
+				errors.New("'key' must be a valid hex or base64 string"))
+			return
+		}
+	}
+
+	result, err := core.DRFailoverTokenUpdate(key)
+	if err != nil {
+		if errwrap.ContainsType(err, new(vault.ErrInvalidKey)) {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	respondOk(w, &DRFailoverTokenStatusResponse{
+		Progress:      result.Progress,
+		Required:      result.Required,
+		Complete:      result.FailoverToken != "",
+		FailoverToken: result.FailoverToken,
+	})
+}
+
+func handleSysReplicationDRFailoverTokenDelete(core *vault.Core, w http.ResponseWriter, r *http.Request) {
+	if err := core.DRFailoverTokenCancel(); err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondOk(w, nil)
+}
+
+// handleSysReplicationDRPromote promotes a DR secondary given a failover
+// token
+func handleSysReplicationDRPromote(core *vault.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "PUT", "POST":
+		default:
+			respondError(w, http.StatusMethodNotAllowed, nil)
+			return
+		}
+
+		var req DRPromoteRequest
+		if err := parseRequest(r, &req); err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+		if req.FailoverToken == "" {
+			respondError(
+				w, http.StatusBadRequest,
+				errors.New("'failover_token' must specified in request body as JSON"))
+			return
+		}
+
+		if err := core.PromoteDRSecondary(req.FailoverToken); err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+		respondOk(w, nil)
+	})
+}
+
+type DRFailoverTokenUpdateRequest struct {
+	Key string
+}
+
+type DRFailoverTokenStatusResponse struct {
+	Progress      int    `json:"progress"`
+	Required      int    `json:"required"`
+	Complete      bool   `json:"complete"`
+	FailoverToken string `json:"failover_token,omitempty"`
+}
+
+type DRPromoteRequest struct {
+	FailoverToken string `json:"failover_token"`
+}
@@ -0,0 +1,98 @@
+package http
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/vault"
+)
+
+func TestSysReplicationDR_Promote(t *testing.T) {
+	primary, key, root := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, primary)
+	defer ln.Close()
+
+	resp := testHttpPut(t, root, addr+"/v1/secret/foo", map[string]interface{}{
+		"value": "bar",
+	})
+	testResponseStatus(t, resp, 204)
+	resp = testHttpPost(t, root, addr+"/v1/sys/replication/dr/primary/enable", nil)
+	testResponseStatus(t, resp, 204)
+	resp = testHttpPost(t, root, addr+"/v1/sys/replication/dr/primary/secondary-token", map[string]interface{}{
+		"id":               "dr1",
+		"primary_api_addr": addr,
+	})
+	var tokenResp map[string]interface{}
+	testResponseStatus(t, resp, 200)
+	testResponseBody(t, resp, &tokenResp)
+	token := tokenResp["data"].(map[string]interface{})["token"].(string)
+
+	secondary, _, secondaryRoot := vault.TestCoreUnsealed(t)
+	defer secondary.Shutdown()
+	ln2, addr2 := TestServer(t, secondary)
+	defer ln2.Close()
+
+	resp = testHttpPost(t, secondaryRoot, addr2+"/v1/sys/replication/dr/secondary/enable", map[string]interface{}{
+		"token": token,
+	})
+	testResponseStatus(t, resp, 204)
+
+	// The status is served while sealed
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		var status map[string]interface{}
+		resp = testHttpGet(t, "", addr2+"/v1/sys/replication/dr/status")
+		testResponseStatus(t, resp, 200)
+		testResponseBody(t, resp, &status)
+		if status["mode"] == "secondary" && status["state"] == "stream" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("bad: %#v", status)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	resp = testHttpPut(t, "", addr2+"/v1/sys/replication/dr/failover-token", map[string]interface{}{
+		"key": hex.EncodeToString(key),
+	})
+	var failover map[string]interface{}
+	testResponseStatus(t, resp, 200)
+	testResponseBody(t, resp, &failover)
+	if failover["complete"] != true || failover["progress"] != json.Number("1") {
+		t.Fatalf("bad: %#v", failover)
+	}
+
+	resp = testHttpPut(t, "", addr2+"/v1/sys/replication/dr/promote", map[string]interface{}{
+		"failover_token": failover["failover_token"],
+	})
+	testResponseStatus(t, resp, 204)
+
+	resp = testHttpPut(t, "", addr2+"/v1/sys/unseal", map[string]interface{}{
+		"key": hex.EncodeToString(key),
+	})
+	testResponseStatus(t, resp, 200)
+
+	var secret map[string]interface{}
+	resp = testHttpGet(t, root, addr2+"/v1/secret/foo")
+	testResponseStatus(t, resp, 200)
+	testResponseBody(t, resp, &secret)
+	if secret["data"].(map[string]interface{})["value"] != "bar" {
+		t.Fatalf("bad: %#v", secret)
+	}
+}
+
+func TestSysReplicationDR_FailoverToken_NotSecondary(t *testing.T) {
+	core, _, _ := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+
+	resp := testHttpGet(t, "", addr+"/v1/sys/replication/dr/failover-token")
+	testResponseStatus(t, resp, 400)
+	resp = testHttpPut(t, "", addr+"/v1/sys/replication/dr/promote", map[string]interface{}{
+		"failover_token": "foo",
+	})
+	testResponseStatus(t, resp, 400)
+}
@@ -28,9 +28,13 @@ func TestSysRotate(t *testing.T) {
 		"warnings":       nil,
 		"auth":           nil,
 		"data": map[string]interface{}{
-			"term": json.Number("2"),
+			"term":        json.Number("2"),
+			"encryptions": json.Number("0"),
+			"cipher":      "aes-gcm",
 		},
-		"term": json.Number("2"),
+		"term":        json.Number("2"),
+		"encryptions": json.Number("0"),
+		"cipher":      "aes-gcm",
 	}
 
 	testResponseStatus(t, resp, 200)
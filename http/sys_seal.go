@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/vault/logical"
@@ -15,7 +16,7 @@ import (
 
 func handleSysSeal(core *vault.Core) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		req, statusCode, err := buildLogicalRequest(w, r)
+		req, statusCode, err := buildLogicalRequest(core, nil, w, r)
 		if err != nil || statusCode != 0 {
 			respondError(w, statusCode, err)
 			return
@@ -40,7 +41,7 @@ func handleSysSeal(core *vault.Core) http.Handler {
 
 func handleSysStepDown(core *vault.Core) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		req, statusCode, err := buildLogicalRequest(w, r)
+		req, statusCode, err := buildLogicalRequest(core, nil, w, r)
 		if err != nil || statusCode != 0 {
 			respondError(w, statusCode, err)
 			return
@@ -175,7 +176,8 @@ func handleSysSealStatusRaw(core *vault.Core, w http.ResponseWriter, r *http.Req
 		clusterID = cluster.ID
 	}
 
-	respondOk(w, &SealStatusResponse{
+	resp := &SealStatusResponse{
+		Type:        sealConfig.Type,
 		Sealed:      sealed,
 		T:           sealConfig.SecretThreshold,
 		N:           sealConfig.SecretShares,
@@ -183,17 +185,33 @@ func handleSysSealStatusRaw(core *vault.Core, w http.ResponseWriter, r *http.Req
 		Version:     version.GetVersion().String(),
 		ClusterName: clusterName,
 		ClusterID:   clusterID,
-	})
+	}
+	if health := core.SealAccess().Health(); health != nil {
+		resp.SealHealth = &SealHealthResponse{
+			Healthy:     health.Healthy,
+			LastChecked: health.LastChecked.UTC().Format(time.RFC3339),
+			Error:       health.Error,
+		}
+	}
+	respondOk(w, resp)
 }
 
 type SealStatusResponse struct {
-	Sealed      bool   `json:"sealed"`
-	T           int    `json:"t"`
-	N           int    `json:"n"`
-	Progress    int    `json:"progress"`
-	Version     string `json:"version"`
-	ClusterName string `json:"cluster_name,omitempty"`
-	ClusterID   string `json:"cluster_id,omitempty"`
+	Type        string              `json:"type"`
+	Sealed      bool                `json:"sealed"`
+	T           int                 `json:"t"`
+	N           int                 `json:"n"`
+	Progress    int                 `json:"progress"`
+	Version     string              `json:"version"`
+	ClusterName string              `json:"cluster_name,omitempty"`
+	ClusterID   string              `json:"cluster_id,omitempty"`
+	SealHealth  *SealHealthResponse `json:"seal_health,omitempty"`
+}
+
+type SealHealthResponse struct {
+	Healthy     bool   `json:"healthy"`
+	LastChecked string `json:"last_checked"`
+	Error       string `json:"error,omitempty"`
 }
 
 type UnsealRequest struct {
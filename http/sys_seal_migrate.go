@@ -0,0 +1,209 @@
+package http
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+
+	"github.com/hashicorp/vault/helper/pgpkeys"
+	"github.com/hashicorp/vault/vault"
+)
+
+func handleSysSealMigrateInit(core *vault.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			handleSysSealMigrateInitGet(core, w, r)
+		case "POST", "PUT":
+			handleSysSealMigrateInitPut(core, w, r)
+		case "DELETE":
+			handleSysSealMigrateInitDelete(core, w, r)
+		default:
+			respondError(w, http.StatusMethodNotAllowed, nil)
+		}
+	})
+}
+
+func handleSysSealMigrateInitGet(core *vault.Core, w http.ResponseWriter, r *http.Request) {
+	status, err := core.SealMigrationStatus()
+	if err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Format the status
+	resp := &SealMigrateStatusResponse{
+		Started:      status.Started,
+		Nonce:        status.Nonce,
+		Type:         status.Type,
+		Progress:     status.Progress,
+		Required:     status.Required,
+		RecoveryKeys: status.RecoveryKeys,
+	}
+	if conf := status.BarrierConfig; conf != nil {
+		resp.T = conf.SecretThreshold
+		resp.N = conf.SecretShares
+		resp.StoredShares = conf.StoredShares
+		if len(conf.PGPKeys) != 0 {
+			pgpFingerprints, err := pgpkeys.GetFingerprints(conf.PGPKeys, nil)
+			if err != nil {
+				respondError(w, http.StatusInternalServerError, err)
+				return
+			}
+			resp.PGPFingerprints = pgpFingerprints
+		}
+	}
+	if conf := status.RecoveryConfig; conf != nil {
+		resp.RecoveryT = conf.SecretThreshold
+		resp.RecoveryN = conf.SecretShares
+	}
+	respondOk(w, resp)
+}
+
+func handleSysSealMigrateInitPut(core *vault.Core, w http.ResponseWriter, r *http.Request) {
+	// Parse the request
+	var req SealMigrateRequest
+	if err := parseRequest(r, &req); err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	barrierConfig := &vault.SealConfig{
+		SecretShares:    req.SecretShares,
+		SecretThreshold: req.SecretThreshold,
+		StoredShares:    req.StoredShares,
+		PGPKeys:         req.PGPKeys,
+	}
+
+	var recoveryConfig *vault.SealConfig
+	if req.RecoveryShares > 0 {
+		recoveryConfig = &vault.SealConfig{
+			SecretShares:    req.RecoveryShares,
+			SecretThreshold: req.RecoveryThreshold,
+			PGPKeys:         req.RecoveryPGPKeys,
+		}
+	}
+
+	// Initialize the migration
+	if err := core.SealMigrationInit(barrierConfig, recoveryConfig); err != nil {
+		respondError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	handleSysSealMigrateInitGet(core, w, r)
+}
+
+func handleSysSealMigrateInitDelete(core *vault.Core, w http.ResponseWriter, r *http.Request) {
+	if err := core.SealMigrationCancel(); err != nil {
+		respondError(w, http.StatusInternalServerError, err)
+		return
+	}
+	respondOk(w, nil)
+}
+
+func handleSysSealMigrateUpdate(core *vault.Core) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" && r.Method != "PUT" {
+			respondError(w, http.StatusMethodNotAllowed, nil)
+			return
+		}
+
+		// Parse the request
+		var req SealMigrateUpdateRequest
+		if err := parseRequest(r, &req); err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+		if req.Key == "" {
+			respondError(
+				w, http.StatusBadRequest,
+				errors.New("'key' must specified in request body as JSON"))
+			return
+		}
+
+		// Decode the key, which is base64 or hex encoded
+		min, max := core.BarrierKeyLength()
+		key, err := hex.DecodeString(req.Key)
+		// We check min and max here to ensure that a string that is base64
+		// encoded but also valid hex will not be valid and we instead base64
+		// decode it
+		if err != nil || len(key) < min || len(key) > max {
+			key, err = base64.StdEncoding.DecodeString(req.Key)
+			if err != nil {
+				respondError(
+					w, http.StatusBadRequest,
+					errors.New("'key' must be a valid hex or base64 string"))
+				return
+			}
+		}
+
+		// Use the key to make progress on the migration
+		result, err := core.SealMigrationUpdate(key, req.Nonce)
+		if err != nil {
+			respondError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		// Format the response
+		resp := &SealMigrateUpdateResponse{}
+		if result != nil {
+			resp.Complete = true
+			resp.Nonce = req.Nonce
+			resp.Type = result.Type
+			resp.Keys, resp.KeysB64 = encodeSealMigrateKeys(result.SecretShares)
+			resp.RecoveryKeys, resp.RecoveryKeysB64 = encodeSealMigrateKeys(result.RecoveryShares)
+		}
+		respondOk(w, resp)
+	})
+}
+
+func encodeSealMigrateKeys(shares [][]byte) ([]string, []string) {
+	keys := make([]string, 0, len(shares))
+	keysB64 := make([]string, 0, len(shares))
+	for _, k := range shares {
+		keys = append(keys, hex.EncodeToString(k))
+		keysB64 = append(keysB64, base64.StdEncoding.EncodeToString(k))
+	}
+	return keys, keysB64
+}
+
+type SealMigrateRequest struct {
+	SecretShares      int      `json:"secret_shares"`
+	SecretThreshold   int      `json:"secret_threshold"`
+	StoredShares      int      `json:"stored_shares"`
+	PGPKeys           []string `json:"pgp_keys"`
+	RecoveryShares    int      `json:"recovery_shares"`
+	RecoveryThreshold int      `json:"recovery_threshold"`
+	RecoveryPGPKeys   []string `json:"recovery_pgp_keys"`
+}
+
+type SealMigrateStatusResponse struct {
+	Nonce           string   `json:"nonce"`
+	Started         bool     `json:"started"`
+	Type            string   `json:"type"`
+	T               int      `json:"t"`
+	N               int      `json:"n"`
+	StoredShares    int      `json:"stored_shares"`
+	RecoveryT       int      `json:"recovery_t"`
+	RecoveryN       int      `json:"recovery_n"`
+	Progress        int      `json:"progress"`
+	Required        int      `json:"required"`
+	RecoveryKeys    bool     `json:"recovery_keys"`
+	PGPFingerprints []string `json:"pgp_fingerprints"`
+}
+
+type SealMigrateUpdateRequest struct {
+	Nonce string
+	Key   string
+}
+
+type SealMigrateUpdateResponse struct {
+	Nonce           string   `json:"nonce"`
+	Complete        bool     `json:"complete"`
+	Type            string   `json:"type"`
+	Keys            []string `json:"keys"`
+	KeysB64         []string `json:"keys_base64"`
+	RecoveryKeys    []string `json:"recovery_keys"`
+	RecoveryKeysB64 []string `json:"recovery_keys_base64"`
+}
@@ -0,0 +1,79 @@
+package http
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/vault"
+)
+
+func TestSysSealMigrate(t *testing.T) {
+	core, key, token := vault.TestCoreUnsealedWithMigrationSeal(t, vault.NewTestAutoSeal())
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	resp := testHttpPut(t, token, addr+"/v1/sys/seal-migrate/init", map[string]interface{}{
+		"secret_shares":      1,
+		"secret_threshold":   1,
+		"stored_shares":      1,
+		"recovery_shares":    3,
+		"recovery_threshold": 2,
+	})
+
+	var actual map[string]interface{}
+	expected := map[string]interface{}{
+		"started":          true,
+		"type":             "test-auto",
+		"t":                json.Number("1"),
+		"n":                json.Number("1"),
+		"stored_shares":    json.Number("1"),
+		"recovery_t":       json.Number("2"),
+		"recovery_n":       json.Number("3"),
+		"progress":         json.Number("0"),
+		"required":         json.Number("1"),
+		"recovery_keys":    false,
+		"pgp_fingerprints": interface{}(nil),
+	}
+	testResponseStatus(t, resp, 200)
+	testResponseBody(t, resp, &actual)
+	if actual["nonce"].(string) == "" {
+		t.Fatalf("nonce was empty")
+	}
+	expected["nonce"] = actual["nonce"]
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("\nexpected: %#v\nactual: %#v", expected, actual)
+	}
+
+	resp = testHttpPut(t, token, addr+"/v1/sys/seal-migrate/update", map[string]interface{}{
+		"nonce": actual["nonce"].(string),
+		"key":   hex.EncodeToString(key),
+	})
+
+	actual = map[string]interface{}{}
+	testResponseStatus(t, resp, 200)
+	testResponseBody(t, resp, &actual)
+	if actual["complete"] != true || actual["type"] != "test-auto" {
+		t.Fatalf("bad: %#v", actual)
+	}
+	if keys := actual["keys"].([]interface{}); len(keys) != 0 {
+		t.Fatalf("bad: %#v", keys)
+	}
+	if keys := actual["recovery_keys"].([]interface{}); len(keys) != 3 {
+		t.Fatalf("bad: %#v", keys)
+	}
+
+	resp, err := http.Get(addr + "/v1/sys/seal-migrate/init")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	actual = map[string]interface{}{}
+	testResponseStatus(t, resp, 200)
+	testResponseBody(t, resp, &actual)
+	if actual["started"] != false || actual["type"] != "shamir" || actual["recovery_keys"] != true {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
@@ -25,6 +25,7 @@ func TestSysSealStatus(t *testing.T) {
 
 	var actual map[string]interface{}
 	expected := map[string]interface{}{
+		"type":     "shamir",
 		"sealed":   true,
 		"t":        json.Number("1"),
 		"n":        json.Number("1"),
@@ -111,6 +112,7 @@ func TestSysUnseal(t *testing.T) {
 
 	var actual map[string]interface{}
 	expected := map[string]interface{}{
+		"type":     "shamir",
 		"sealed":   false,
 		"t":        json.Number("1"),
 		"n":        json.Number("1"),
@@ -149,6 +151,7 @@ func TestSysUnseal_badKey(t *testing.T) {
 
 	var actual map[string]interface{}
 	expected := map[string]interface{}{
+		"type":     "shamir",
 		"sealed":   true,
 		"t":        json.Number("1"),
 		"n":        json.Number("1"),
@@ -204,6 +207,7 @@ func TestSysUnseal_Reset(t *testing.T) {
 
 		var actual map[string]interface{}
 		expected := map[string]interface{}{
+			"type":     "shamir",
 			"sealed":   true,
 			"t":        json.Number("3"),
 			"n":        json.Number("5"),
@@ -236,6 +240,7 @@ func TestSysUnseal_Reset(t *testing.T) {
 
 	actual = map[string]interface{}{}
 	expected := map[string]interface{}{
+		"type":     "shamir",
 		"sealed":   true,
 		"t":        json.Number("3"),
 		"n":        json.Number("5"),
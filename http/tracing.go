@@ -0,0 +1,74 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/hashicorp/vault/helper/tracing"
+)
+
+// handleTracing wraps handler so that each request is traced, from the time
+// the listener hands it over. A W3C traceparent header from the client, or
+// the trace of the standby for a forwarded request, is used as the parent.
+func handleTracing(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tracing.GlobalTracer() == nil {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := tracing.ContextWithTraceparent(r.Context(), r.Header.Get(tracing.TraceparentHeaderName))
+		ctx, span := tracing.StartSpan(ctx, "http.request")
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.target", r.URL.Path)
+		span.SetAttribute("http.client_addr", r.RemoteAddr)
+
+		sw := &statusResponseWriter{
+			ResponseWriter: w,
+			statusCode:     http.StatusOK,
+		}
+		handler.ServeHTTP(sw, r.WithContext(ctx))
+
+		span.SetAttribute("http.status_code", strconv.Itoa(sw.statusCode))
+		if sw.statusCode >= 500 {
+			span.SetError(fmt.Errorf("%d %s", sw.statusCode, http.StatusText(sw.statusCode)))
+		}
+		span.End()
+	})
+}
+
+// statusResponseWriter records the status code of a response. It can be
+// flushed and notifies of closed connections whenever the wrapped
+// ResponseWriter does, so that streamed responses keep working.
+type statusResponseWriter struct {
+	http.ResponseWriter
+	statusCode  int
+	wroteHeader bool
+}
+
+func (w *statusResponseWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.statusCode = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *statusResponseWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *statusResponseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *statusResponseWriter) CloseNotify() <-chan bool {
+	if notifier, ok := w.ResponseWriter.(http.CloseNotifier); ok {
+		return notifier.CloseNotify()
+	}
+	return nil
+}
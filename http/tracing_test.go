@@ -0,0 +1,63 @@
+package http
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/tracing"
+	"github.com/hashicorp/vault/vault"
+)
+
+func TestHandler_tracing(t *testing.T) {
+	core, _, token := vault.TestCoreUnsealed(t)
+	ln, addr := TestServer(t, core)
+	defer ln.Close()
+	TestServerAuth(t, addr, token)
+
+	exporter, done := tracing.TestGlobalTracer(t)
+
+	req, err := http.NewRequest("GET", addr+"/v1/secret/foo", nil)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	req.Header.Set(AuthHeaderName, token)
+	req.Header.Set(tracing.TraceparentHeaderName, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	testResponseStatus(t, resp, 404)
+	done()
+
+	spans := make(map[string]*tracing.SpanData)
+	for _, span := range exporter.Spans() {
+		spans[span.Name] = span
+	}
+
+	root, ok := spans["http.request"]
+	if !ok {
+		t.Fatalf("missing request span: %#v", spans)
+	}
+	if root.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" ||
+		root.ParentSpanID.String() != "00f067aa0ba902b7" {
+		t.Fatalf("bad: %#v", root)
+	}
+	expected := map[string]string{
+		"http.method":      "GET",
+		"http.target":      "/v1/secret/foo",
+		"http.status_code": "404",
+	}
+	for k, v := range expected {
+		if root.Attributes[k] != v {
+			t.Fatalf("bad: %#v", root.Attributes)
+		}
+	}
+
+	coreSpan, ok := spans["vault.handle_request"]
+	if !ok {
+		t.Fatalf("missing core span: %#v", spans)
+	}
+	if coreSpan.TraceID != root.TraceID || coreSpan.ParentSpanID != root.SpanID {
+		t.Fatalf("bad: %#v", coreSpan)
+	}
+}
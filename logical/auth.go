@@ -48,6 +48,38 @@ type Auth struct {
 	// should never expire. The token should be renewed within the duration
 	// specified by this period.
 	Period time.Duration `json:"period" mapstructure:"period" structs:"period"`
+
+	// TokenType is the type of the token generated using this Auth object,
+	// "service" if empty. Batch tokens are not persisted and cannot be
+	// renewed, so a Period set along with it has no effect.
+	TokenType string `json:"token_type" mapstructure:"token_type" structs:"token_type"`
+
+	// Alias identifies the authenticated principal within the backend,
+	// such as a user name. Vault ties it to an identity entity, so that a
+	// principal authenticating through several backends is tracked as one
+	// identity. Tokens of logins without an alias have no entity.
+	Alias *Alias `json:"alias" mapstructure:"alias" structs:"alias"`
+
+	// GroupAliases are the groups of the principal within the backend, such
+	// as LDAP groups. The entity is made a member of the external identity
+	// groups mapped to them, and removed from the other external groups of
+	// the mount.
+	GroupAliases []*Alias `json:"group_aliases" mapstructure:"group_aliases" structs:"group_aliases"`
+
+	// EntityID is the ID of the identity entity the token is tied to. This
+	// will be filled in by Vault core; setting it manually has no effect.
+	EntityID string `json:"entity_id" mapstructure:"entity_id" structs:"entity_id"`
+}
+
+// Alias is the identity of a principal within an auth backend
+type Alias struct {
+	// Name uniquely identifies the principal within the auth mount, such
+	// as a user name or a role ID
+	Name string `json:"name" mapstructure:"name" structs:"name"`
+
+	// Metadata is attached to the alias of the entity, and updated on
+	// every login
+	Metadata map[string]string `json:"metadata" mapstructure:"metadata" structs:"metadata"`
 }
 
 func (a *Auth) GoString() string {
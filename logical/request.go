@@ -1,9 +1,12 @@
 package logical
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
+
+	"github.com/hashicorp/vault/helper/errutil"
 )
 
 // Request is a struct that stores the parameters and context
@@ -52,6 +55,32 @@ type Request struct {
 	// name, but is useful for operators.
 	DisplayName string `json:"display_name" structs:"display_name" mapstructure:"display_name"`
 
+	// EntityID is the ID of the identity entity the client token is tied
+	// to, if any. It is set by the core along with DisplayName.
+	EntityID string `json:"entity_id" structs:"entity_id" mapstructure:"entity_id"`
+
+	// PolicyReasons are the reasons the policy engines gave for allowing or
+	// denying the request, which are recorded in the audit logs. They are
+	// set by the core.
+	PolicyReasons []string `json:"policy_reasons" structs:"policy_reasons" mapstructure:"policy_reasons"`
+
+	// MFACreds are the MFA credentials given with the request, by MFA method
+	// name. They are only seen by the core, and never audited.
+	MFACreds map[string][]string `json:"-" structs:"-" mapstructure:"-"`
+
+	// MFAValidated are the names of the MFA methods the core validated for
+	// the request, which are recorded in the audit logs
+	MFAValidated []string `json:"mfa_validated" structs:"mfa_validated" mapstructure:"mfa_validated"`
+
+	// AuditNonHMACRequestKeys and AuditNonHMACResponseKeys are the keys of
+	// the request and response data the audit backends log without hashing
+	// their values. AuditElideResponseKeys are the keys of the response data
+	// whose values are replaced by their size in the audit logs. They are
+	// tuned on the mount serving the request and set by the core.
+	AuditNonHMACRequestKeys  []string `json:"-" structs:"-" mapstructure:"-"`
+	AuditNonHMACResponseKeys []string `json:"-" structs:"-" mapstructure:"-"`
+	AuditElideResponseKeys   []string `json:"-" structs:"-" mapstructure:"-"`
+
 	// MountPoint is provided so that a logical backend can generate
 	// paths relative to itself. The `Path` is effectively the client
 	// request path with the MountPoint trimmed off.
@@ -60,6 +89,23 @@ type Request struct {
 	// WrapTTL contains the requested TTL of the token used to wrap the
 	// response in a cubbyhole.
 	WrapTTL time.Duration `json:"wrap_ttl" struct:"wrap_ttl" mapstructure:"wrap_ttl"`
+
+	// ctx is the context of the request, such as its tracing span. It is
+	// not serialized.
+	ctx context.Context
+}
+
+// Context returns the context of the request, which is never nil
+func (r *Request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// SetContext sets the context of the request
+func (r *Request) SetContext(ctx context.Context) {
+	r.ctx = ctx
 }
 
 // Get returns a data field and guards for nil Data
@@ -136,6 +182,10 @@ const (
 	ListOperation             = "list"
 	HelpOperation             = "help"
 
+	// PatchOperation merges the request data into the existing value,
+	// rather than replacing it
+	PatchOperation = "patch"
+
 	// The operations below are called globally, the path is less relevant.
 	RevokeOperation   Operation = "revoke"
 	RenewOperation              = "renew"
@@ -145,15 +195,15 @@ const (
 var (
 	// ErrUnsupportedOperation is returned if the operation is not supported
 	// by the logical backend.
-	ErrUnsupportedOperation = errors.New("unsupported operation")
+	ErrUnsupportedOperation = errutil.WithCode(errutil.CodeUnsupportedOperation, errors.New("unsupported operation"))
 
 	// ErrUnsupportedPath is returned if the path is not supported
 	// by the logical backend.
-	ErrUnsupportedPath = errors.New("unsupported path")
+	ErrUnsupportedPath = errutil.WithCode(errutil.CodeUnsupportedPath, errors.New("unsupported path"))
 
 	// ErrInvalidRequest is returned if the request is invalid
-	ErrInvalidRequest = errors.New("invalid request")
+	ErrInvalidRequest = errutil.WithCode(errutil.CodeInvalidRequest, errors.New("invalid request"))
 
 	// ErrPermissionDenied is returned if the client is not authorized
-	ErrPermissionDenied = errors.New("permission denied")
+	ErrPermissionDenied = errutil.WithCode(errutil.CodePermissionDenied, errors.New("permission denied"))
 )
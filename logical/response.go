@@ -3,6 +3,7 @@ package logical
 import (
 	"errors"
 	"fmt"
+	"io"
 	"reflect"
 	"time"
 
@@ -40,6 +41,9 @@ type WrapInfo struct {
 	// expected expiration.
 	CreationTime time.Time `json:"creation_time" structs:"creation_time" mapstructure:"cration_time"`
 
+	// The accessor of the wrapping token
+	Accessor string `json:"accessor" structs:"accessor" mapstructure:"accessor"`
+
 	// If the contained response is the output of a token creation call, the
 	// created token's accessor will be accessible here
 	WrappedAccessor string `json:"wrapped_accessor" structs:"wrapped_accessor" mapstructure:"wrapped_accessor"`
@@ -76,6 +80,29 @@ type Response struct {
 
 	// Information for wrapping the response in a cubbyhole
 	WrapInfo *WrapInfo `json:"wrap_info" structs:"wrap_info" mapstructure:"wrap_info"`
+
+	// Stream, if not nil, is sent to the client as the raw body of the HTTP
+	// response while it is being read, rather than the whole response being
+	// built in memory first. Like HTTPRawBody, this can only be used for
+	// non-secrets, and such responses cannot be wrapped.
+	Stream *ResponseStream `json:"-" structs:"-" mapstructure:"-"`
+}
+
+// ResponseStream is the body of a streamed response. Backends opt in to
+// streaming on a per-path basis by returning one, which is worthwhile for
+// payloads large enough that buffering them would be costly.
+type ResponseStream struct {
+	// StatusCode is the HTTP status code of the response. If zero, 200 is
+	// used.
+	StatusCode int
+
+	// ContentType is the value of the Content-Type header of the response.
+	// If empty, "application/octet-stream" is used.
+	ContentType string
+
+	// Body is read until EOF and then closed by the HTTP layer, which also
+	// closes it if the response is never sent.
+	Body io.ReadCloser
 }
 
 func init() {
@@ -83,6 +110,10 @@ func init() {
 		input := v.(Response)
 		ret := Response{
 			Redirect: input.Redirect,
+
+			// The stream can only be read once, so it is shared rather than
+			// copied
+			Stream: input.Stream,
 		}
 
 		if input.Secret != nil {
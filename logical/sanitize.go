@@ -63,6 +63,7 @@ type HTTPWrapInfo struct {
 	Token           string    `json:"token"`
 	TTL             int       `json:"ttl"`
 	CreationTime    time.Time `json:"creation_time"`
+	Accessor        string    `json:"accessor"`
 	WrappedAccessor string    `json:"wrapped_accessor,omitempty"`
 }
 
@@ -2,8 +2,11 @@ package physical
 
 import (
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/hashicorp/golang-lru"
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/golang-lru/simplelru"
 )
 
 const (
@@ -11,48 +14,125 @@ const (
 	DefaultCacheSize = 32 * 1024
 )
 
+// CacheConfig configures a Cache. The zero value is a cache of
+// DefaultCacheSize entries without other limits.
+type CacheConfig struct {
+	// Size is the maximum number of cached entries. DefaultCacheSize is
+	// used if it is not positive.
+	Size int
+
+	// MaxBytes is the maximum total size of the cached values. The least
+	// recently used entries are evicted beyond it. Unlimited if zero.
+	MaxBytes int
+
+	// TTL is how long an entry is served from the cache before it is read
+	// from the backend again, for backends that are written by other
+	// processes as well. Unlimited if zero.
+	TTL time.Duration
+
+	// DisableNegativeCaching stops caching that keys do not exist
+	DisableNegativeCaching bool
+
+	// BypassPrefixes are the prefixes of the keys which are never cached
+	BypassPrefixes []string
+}
+
 // Cache is used to wrap an underlying physical backend
 // and provide an LRU cache layer on top. Most of the reads done by
 // Vault are for policy objects so there is a large read reduction
 // by using a simple write-through cache.
 type Cache struct {
 	backend Backend
-	lru     *lru.TwoQueueCache
+	config  CacheConfig
+
+	// lru holds the cached entries and bytes their total size. l protects
+	// them.
+	lru   *simplelru.LRU
+	bytes int
+	l     sync.Mutex
+}
+
+// cacheEntry is a cached entry, nil if the key does not exist
+type cacheEntry struct {
+	entry *Entry
+	added time.Time
+}
+
+func (e *cacheEntry) size() int {
+	if e.entry == nil {
+		return 0
+	}
+	return len(e.entry.Value)
 }
 
 // NewCache returns a physical cache of the given size.
 // If no size is provided, the default size is used.
 func NewCache(b Backend, size int) *Cache {
-	if size <= 0 {
-		size = DefaultCacheSize
-	}
-	cache, _ := lru.New2Q(size)
+	return NewCacheWithConfig(b, &CacheConfig{Size: size})
+}
+
+// NewCacheWithConfig returns a physical cache with the given limits
+func NewCacheWithConfig(b Backend, config *CacheConfig) *Cache {
 	c := &Cache{
 		backend: b,
-		lru:     cache,
+		config:  *config,
 	}
+	if c.config.Size <= 0 {
+		c.config.Size = DefaultCacheSize
+	}
+	c.lru, _ = simplelru.NewLRU(c.config.Size, c.onEvict)
 	return c
 }
 
+// onEvict keeps track of the total size of the cached values. It is called
+// with the lock held.
+func (c *Cache) onEvict(key interface{}, value interface{}) {
+	c.bytes -= value.(*cacheEntry).size()
+}
+
 // Purge is used to clear the cache
 func (c *Cache) Purge() {
+	c.l.Lock()
+	defer c.l.Unlock()
 	c.lru.Purge()
 }
 
+// Invalidate removes a key from the cache, so that it is read from the
+// backend again. It is used when another node wrote the key.
+func (c *Cache) Invalidate(key string) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	c.lru.Remove(key)
+}
+
 func (c *Cache) Put(entry *Entry) error {
 	err := c.backend.Put(entry)
-	c.lru.Add(entry.Key, entry)
-	return err
+	if err != nil {
+		// The write may have partially happened, so the cached value is
+		// stale either way
+		c.Invalidate(entry.Key)
+		return err
+	}
+	c.add(entry.Key, entry)
+	return nil
 }
 
 func (c *Cache) Get(key string) (*Entry, error) {
 	// Check the LRU first
-	if raw, ok := c.lru.Get(key); ok {
-		if raw == nil {
-			return nil, nil
-		} else {
-			return raw.(*Entry), nil
+	if !c.bypass(key) {
+		c.l.Lock()
+		raw, ok := c.lru.Get(key)
+		if ok {
+			cached := raw.(*cacheEntry)
+			if c.config.TTL == 0 || time.Since(cached.added) < c.config.TTL {
+				c.l.Unlock()
+				metrics.IncrCounter([]string{"cache", "hit"}, 1)
+				return cached.entry, nil
+			}
+			c.lru.Remove(key)
 		}
+		c.l.Unlock()
+		metrics.IncrCounter([]string{"cache", "miss"}, 1)
 	}
 
 	// Read from the underlying backend
@@ -66,19 +146,81 @@ func (c *Cache) Get(key string) (*Entry, error) {
 	// race conditions upstream. The primary issue is with the HA mode,
 	// we could potentially negatively cache the leader entry and cause
 	// leader discovery to fail.
-	if ent != nil || !strings.HasPrefix(key, "core/") {
-		c.lru.Add(key, ent)
+	if ent != nil || (!c.config.DisableNegativeCaching && !strings.HasPrefix(key, "core/")) {
+		c.add(key, ent)
 	}
 	return ent, err
 }
 
 func (c *Cache) Delete(key string) error {
 	err := c.backend.Delete(key)
-	c.lru.Remove(key)
+	c.Invalidate(key)
 	return err
 }
 
+// Transaction applies the operations atomically if the underlying backend
+// supports it, keeping the cache consistent with its result
+func (c *Cache) Transaction(txns []*TxnEntry) error {
+	if err := validateTxns(txns); err != nil {
+		return err
+	}
+	if err := Transaction(c.backend, txns); err != nil {
+		// Some of the operations may have been applied
+		for _, txn := range txns {
+			c.Invalidate(txn.Entry.Key)
+		}
+		return err
+	}
+	for _, txn := range txns {
+		switch txn.Operation {
+		case PutOperation:
+			c.add(txn.Entry.Key, txn.Entry)
+		case DeleteOperation:
+			c.Invalidate(txn.Entry.Key)
+		}
+	}
+	return nil
+}
+
 func (c *Cache) List(prefix string) ([]string, error) {
 	// Always pass-through as this would be difficult to cache.
 	return c.backend.List(prefix)
 }
+
+// add caches the entry of the key, nil if the key does not exist, evicting
+// the least recently used entries beyond the size limits
+func (c *Cache) add(key string, entry *Entry) {
+	if c.bypass(key) {
+		return
+	}
+
+	cached := &cacheEntry{entry: entry, added: time.Now()}
+	if c.config.MaxBytes > 0 && cached.size() > c.config.MaxBytes {
+		// Too large to cache at all, but a previous value may be cached
+		c.Invalidate(key)
+		return
+	}
+
+	c.l.Lock()
+	defer c.l.Unlock()
+
+	c.lru.Remove(key)
+	c.lru.Add(key, cached)
+	c.bytes += cached.size()
+	for c.config.MaxBytes > 0 && c.bytes > c.config.MaxBytes {
+		if _, _, ok := c.lru.RemoveOldest(); !ok {
+			break
+		}
+	}
+	metrics.SetGauge([]string{"cache", "bytes"}, float32(c.bytes))
+}
+
+// bypass returns whether the key is never cached
+func (c *Cache) bypass(key string) bool {
+	for _, prefix := range c.config.BypassPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
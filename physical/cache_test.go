@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"testing"
+	"time"
 )
 
 func TestCache(t *testing.T) {
@@ -12,6 +13,7 @@ func TestCache(t *testing.T) {
 	cache := NewCache(inm, 0)
 	testBackend(t, cache)
 	testBackend_ListPrefix(t, cache)
+	testTransactionalBackend(t, cache)
 }
 
 func TestCache_Purge(t *testing.T) {
@@ -52,3 +54,129 @@ func TestCache_Purge(t *testing.T) {
 		t.Fatalf("should not have key")
 	}
 }
+
+func TestCache_Invalidate(t *testing.T) {
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	inm := NewInmem(logger)
+	cache := NewCache(inm, 0)
+
+	if err := cache.Put(&Entry{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := cache.Put(&Entry{Key: "baz", Value: []byte("qux")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Write from under
+	inm.Put(&Entry{Key: "foo", Value: []byte("updated")})
+	inm.Delete("baz")
+
+	// Only the invalidated key is read again
+	cache.Invalidate("foo")
+	out, err := cache.Get("foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out == nil || string(out.Value) != "updated" {
+		t.Fatalf("bad: %#v", out)
+	}
+	out, err = cache.Get("baz")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out == nil {
+		t.Fatalf("should have key")
+	}
+}
+
+func TestCache_Config(t *testing.T) {
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	inm := NewInmem(logger)
+	cache := NewCacheWithConfig(inm, &CacheConfig{
+		MaxBytes:               8,
+		DisableNegativeCaching: true,
+		BypassPrefixes:         []string{"sys/expire/"},
+	})
+	testBackend(t, cache)
+
+	// cached reports whether the key is served from the cache, by deleting
+	// it from under and restoring it
+	cached := func(key string) bool {
+		ent, err := inm.Get(key)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		inm.Delete(key)
+		out, err := cache.Get(key)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if ent != nil {
+			inm.Put(ent)
+		}
+		return out != nil
+	}
+
+	for _, key := range []string{"a", "b", "sys/expire/c"} {
+		if err := cache.Put(&Entry{Key: key, Value: []byte("1234")}); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	if !cached("a") || !cached("b") || cached("sys/expire/c") {
+		t.Fatalf("bad: a and b should be cached, not sys/expire/c")
+	}
+
+	// Beyond the byte limit, the least recently used entry is evicted
+	if err := cache.Put(&Entry{Key: "d", Value: []byte("1234")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if cached("a") || !cached("d") {
+		t.Fatalf("bad: a should be evicted")
+	}
+
+	// Values larger than the limit are not cached
+	if err := cache.Put(&Entry{Key: "e", Value: []byte("123456789")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if cached("e") {
+		t.Fatalf("bad: e should not be cached")
+	}
+
+	// Missing keys are not cached
+	if out, _ := cache.Get("missing"); out != nil {
+		t.Fatalf("bad: %#v", out)
+	}
+	inm.Put(&Entry{Key: "missing", Value: []byte("1")})
+	if out, _ := cache.Get("missing"); out == nil {
+		t.Fatalf("missing key should not be cached")
+	}
+}
+
+func TestCache_TTL(t *testing.T) {
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	inm := NewInmem(logger)
+	cache := NewCacheWithConfig(inm, &CacheConfig{TTL: 50 * time.Millisecond})
+
+	if err := cache.Put(&Entry{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	inm.Put(&Entry{Key: "foo", Value: []byte("updated")})
+
+	out, err := cache.Get("foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(out.Value) != "bar" {
+		t.Fatalf("bad: %#v", out)
+	}
+
+	// Expired entries are read again
+	time.Sleep(100 * time.Millisecond)
+	out, err = cache.Get("foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(out.Value) != "updated" {
+		t.Fatalf("bad: %#v", out)
+	}
+}
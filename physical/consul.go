@@ -20,11 +20,16 @@ import (
 	"github.com/hashicorp/consul/lib"
 	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/helper/tlsutil"
 )
 
 const (
+	// consulMaxTransactionOps is the maximum number of operations of a
+	// Consul transaction
+	consulMaxTransactionOps = 64
+
 	// checkJitterFactor specifies the jitter factor used to stagger checks
 	checkJitterFactor = 16
 
@@ -293,6 +298,53 @@ func (c *ConsulBackend) Delete(key string) error {
 	return err
 }
 
+// Transaction is used to apply several operations atomically
+func (c *ConsulBackend) Transaction(txns []*TxnEntry) error {
+	defer metrics.MeasureSince([]string{"consul", "transaction"}, time.Now())
+
+	if err := validateTxns(txns); err != nil {
+		return err
+	}
+	if len(txns) > consulMaxTransactionOps {
+		return fmt.Errorf("consul transactions are limited to %d operations", consulMaxTransactionOps)
+	}
+
+	ops := make(api.KVTxnOps, 0, len(txns))
+	for _, txn := range txns {
+		op := &api.KVTxnOp{
+			Key: c.path + txn.Entry.Key,
+		}
+		switch txn.Operation {
+		case PutOperation:
+			op.Verb = string(api.KVSet)
+			op.Value = txn.Entry.Value
+		case DeleteOperation:
+			op.Verb = api.KVDelete
+		}
+		ops = append(ops, op)
+	}
+
+	c.permitPool.Acquire()
+	defer c.permitPool.Release()
+
+	ok, resp, _, err := c.kv.Txn(ops, nil)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return nil
+	}
+
+	var retErr *multierror.Error
+	for _, txnErr := range resp.Errors {
+		retErr = multierror.Append(retErr, fmt.Errorf("operation %d: %s", txnErr.OpIndex, txnErr.What))
+	}
+	if retErr == nil {
+		return fmt.Errorf("consul transaction was rolled back")
+	}
+	return retErr
+}
+
 // List is used to list all the keys under a given
 // prefix, up to the next prefix.
 func (c *ConsulBackend) List(prefix string) ([]string, error) {
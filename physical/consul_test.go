@@ -409,6 +409,7 @@ func TestConsulBackend(t *testing.T) {
 
 	testBackend(t, b)
 	testBackend_ListPrefix(t, b)
+	testTransactionalBackend(t, b)
 }
 
 func TestConsulHABackend(t *testing.T) {
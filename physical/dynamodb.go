@@ -18,6 +18,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/credentials/ec2rolecreds"
 	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
@@ -56,6 +57,11 @@ const (
 	// DynamoDBWatchRetryInterval is the amount of time to wait
 	// if a watch fails before trying again.
 	DynamoDBWatchRetryInterval = 5 * time.Second
+
+	// DynamoDBMaxTransactionItems is the maximum number of items written
+	// by a TransactWriteItems request, including the records of the
+	// 'folders' of the keys written.
+	DynamoDBMaxTransactionItems = 100
 )
 
 // DynamoDBBackend is a physical backend that stores data in
@@ -70,6 +76,41 @@ type DynamoDBBackend struct {
 	permitPool *PermitPool
 }
 
+// dynamoDBTransactWriteItemsInput is the input of a TransactWriteItems
+// request, which the vendored SDK predates
+type dynamoDBTransactWriteItemsInput struct {
+	_ struct{} `type:"structure"`
+
+	TransactItems []*dynamoDBTransactWriteItem `type:"list"`
+}
+
+// dynamoDBTransactWriteItem is one of the writes of a TransactWriteItems
+// request, either a put or a delete
+type dynamoDBTransactWriteItem struct {
+	_ struct{} `type:"structure"`
+
+	Put    *dynamoDBTransactPut    `type:"structure"`
+	Delete *dynamoDBTransactDelete `type:"structure"`
+}
+
+type dynamoDBTransactPut struct {
+	_ struct{} `type:"structure"`
+
+	Item      map[string]*dynamodb.AttributeValue `type:"map"`
+	TableName *string                             `type:"string"`
+}
+
+type dynamoDBTransactDelete struct {
+	_ struct{} `type:"structure"`
+
+	Key       map[string]*dynamodb.AttributeValue `type:"map"`
+	TableName *string                             `type:"string"`
+}
+
+type dynamoDBTransactWriteItemsOutput struct {
+	_ struct{} `type:"structure"`
+}
+
 // DynamoDBRecord is the representation of a vault entry in
 // DynamoDB. The vault key is split up into two components
 // (Path and Key) in order to allow more efficient listings.
@@ -355,6 +396,137 @@ func (d *DynamoDBBackend) List(prefix string) ([]string, error) {
 	return keys, nil
 }
 
+// Transaction is used to apply several operations atomically, with a
+// TransactWriteItems request. The records of the 'folders' left empty by
+// the deletes are removed after the transaction.
+func (d *DynamoDBBackend) Transaction(txns []*TxnEntry) error {
+	defer metrics.MeasureSince([]string{"dynamodb", "transaction"}, time.Now())
+
+	if err := validateTxns(txns); err != nil {
+		return err
+	}
+
+	// A request cannot include two operations on the same item, so only the
+	// last operation on a key is kept, which has the same outcome
+	last := make(map[string]int, len(txns))
+	for i, txn := range txns {
+		last[txn.Entry.Key] = i
+	}
+
+	var items []*dynamoDBTransactWriteItem
+	var deleted []string
+	folders := make(map[string]struct{})
+	for i, txn := range txns {
+		if last[txn.Entry.Key] != i {
+			continue
+		}
+		key := map[string]*dynamodb.AttributeValue{
+			"Path": {S: aws.String(recordPathForVaultKey(txn.Entry.Key))},
+			"Key":  {S: aws.String(recordKeyForVaultKey(txn.Entry.Key))},
+		}
+
+		if txn.Operation == DeleteOperation {
+			items = append(items, &dynamoDBTransactWriteItem{
+				Delete: &dynamoDBTransactDelete{
+					Key:       key,
+					TableName: aws.String(d.table),
+				},
+			})
+			deleted = append(deleted, txn.Entry.Key)
+			continue
+		}
+
+		item, err := dynamodbattribute.ConvertToMap(DynamoDBRecord{
+			Path:  recordPathForVaultKey(txn.Entry.Key),
+			Key:   recordKeyForVaultKey(txn.Entry.Key),
+			Value: txn.Entry.Value,
+		})
+		if err != nil {
+			return fmt.Errorf("could not convert record to DynamoDB item: %s", err)
+		}
+		items = append(items, &dynamoDBTransactWriteItem{
+			Put: &dynamoDBTransactPut{
+				Item:      item,
+				TableName: aws.String(d.table),
+			},
+		})
+		for _, prefix := range prefixes(txn.Entry.Key) {
+			folders[prefix] = struct{}{}
+		}
+	}
+
+	for prefix := range folders {
+		item, err := dynamodbattribute.ConvertToMap(DynamoDBRecord{
+			Path: recordPathForVaultKey(prefix),
+			Key:  fmt.Sprintf("%s/", recordKeyForVaultKey(prefix)),
+		})
+		if err != nil {
+			return fmt.Errorf("could not convert prefix record to DynamoDB item: %s", err)
+		}
+		items = append(items, &dynamoDBTransactWriteItem{
+			Put: &dynamoDBTransactPut{
+				Item:      item,
+				TableName: aws.String(d.table),
+			},
+		})
+	}
+
+	if len(items) > DynamoDBMaxTransactionItems {
+		return fmt.Errorf("transaction writes %d DynamoDB items, more than the limit of %d", len(items), DynamoDBMaxTransactionItems)
+	}
+
+	d.permitPool.Acquire()
+	req := d.client.NewRequest(&request.Operation{
+		Name:       "TransactWriteItems",
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}, &dynamoDBTransactWriteItemsInput{
+		TransactItems: items,
+	}, &dynamoDBTransactWriteItemsOutput{})
+	err := req.Send()
+	d.permitPool.Release()
+	if err != nil {
+		return err
+	}
+
+	// The transaction is applied, so failing to clean up only leaves
+	// empty 'folders' in the listings
+	for _, key := range deleted {
+		if err := d.cleanupFolders(key); err != nil && d.logger != nil {
+			d.logger.Printf("[WARN]: physical/dynamodb: failed to clean up the folders of %s: %v", key, err)
+		}
+	}
+	return nil
+}
+
+// cleanupFolders deletes the records of the 'folders' of a deleted key
+// which are now empty, from the deepest one up
+func (d *DynamoDBBackend) cleanupFolders(key string) error {
+	prefixes := prefixes(key)
+	sort.Sort(sort.Reverse(sort.StringSlice(prefixes)))
+	for _, prefix := range prefixes {
+		items, err := d.List(prefix)
+		if err != nil {
+			return err
+		}
+		if len(items) > 0 {
+			return nil
+		}
+		err = d.batchWriteRequests([]*dynamodb.WriteRequest{{
+			DeleteRequest: &dynamodb.DeleteRequest{
+				Key: map[string]*dynamodb.AttributeValue{
+					"Path": {S: aws.String(recordPathForVaultKey(prefix))},
+					"Key":  {S: aws.String(fmt.Sprintf("%s/", recordKeyForVaultKey(prefix)))},
+				},
+			},
+		}})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // LockWith is used for mutual exclusion based on the given key.
 func (d *DynamoDBBackend) LockWith(key, value string) (Lock, error) {
 	return &DynamoDBLock{
@@ -1,10 +1,16 @@
 package physical
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"reflect"
+	"sort"
 	"testing"
 	"time"
 
@@ -61,6 +67,7 @@ func TestDynamoDBBackend(t *testing.T) {
 
 	testBackend(t, b)
 	testBackend_ListPrefix(t, b)
+	testTransactionalBackend(t, b)
 }
 
 func TestDynamoDBHABackend(t *testing.T) {
@@ -114,3 +121,73 @@ func TestDynamoDBHABackend(t *testing.T) {
 	}
 	testHABackend(t, ha, ha)
 }
+
+func TestDynamoDBBackend_Transaction(t *testing.T) {
+	var target string
+	var body struct {
+		TransactItems []struct {
+			Put *struct {
+				Item      map[string]map[string]interface{}
+				TableName string
+			}
+			Delete *struct {
+				Key       map[string]map[string]interface{}
+				TableName string
+			}
+		}
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		target = r.Header.Get("X-Amz-Target")
+		raw, _ := ioutil.ReadAll(r.Body)
+		if err := json.Unmarshal(raw, &body); err != nil {
+			t.Errorf("err: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/x-amz-json-1.0")
+		w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+
+	d := &DynamoDBBackend{
+		table: "vault",
+		client: dynamodb.New(session.New(&aws.Config{
+			Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+			Endpoint:    aws.String(srv.URL),
+			Region:      aws.String("us-east-1"),
+			MaxRetries:  aws.Int(0),
+		})),
+		permitPool: NewPermitPool(1),
+	}
+
+	err := d.Transaction([]*TxnEntry{
+		{Operation: PutOperation, Entry: &Entry{Key: "foo/bar", Value: []byte("one")}},
+		{Operation: PutOperation, Entry: &Entry{Key: "foo/baz", Value: []byte("two")}},
+		{Operation: PutOperation, Entry: &Entry{Key: "top", Value: []byte("three")}},
+		{Operation: DeleteOperation, Entry: &Entry{Key: "top"}},
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if target != "DynamoDB_20120810.TransactWriteItems" {
+		t.Fatalf("bad target: %s", target)
+	}
+
+	// The last operation on a key wins, and the folder is written once
+	var puts, deletes []string
+	for _, item := range body.TransactItems {
+		switch {
+		case item.Put != nil && item.Put.TableName == "vault":
+			puts = append(puts, fmt.Sprintf("%s|%s", item.Put.Item["Path"]["S"], item.Put.Item["Key"]["S"]))
+		case item.Delete != nil && item.Delete.TableName == "vault":
+			deletes = append(deletes, fmt.Sprintf("%s|%s", item.Delete.Key["Path"]["S"], item.Delete.Key["Key"]["S"]))
+		default:
+			t.Fatalf("bad item: %#v", item)
+		}
+	}
+	sort.Strings(puts)
+	if expected := []string{" |foo/", "foo|bar", "foo|baz"}; !reflect.DeepEqual(puts, expected) {
+		t.Fatalf("bad puts: %v", puts)
+	}
+	if expected := []string{" |top"}; !reflect.DeepEqual(deletes, expected) {
+		t.Fatalf("bad deletes: %v", deletes)
+	}
+}
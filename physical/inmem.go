@@ -65,6 +65,29 @@ func (i *InmemBackend) Delete(key string) error {
 	return nil
 }
 
+// Transaction is used to apply several operations atomically
+func (i *InmemBackend) Transaction(txns []*TxnEntry) error {
+	if err := validateTxns(txns); err != nil {
+		return err
+	}
+
+	i.permitPool.Acquire()
+	defer i.permitPool.Release()
+
+	i.l.Lock()
+	defer i.l.Unlock()
+
+	for _, txn := range txns {
+		switch txn.Operation {
+		case PutOperation:
+			i.root.Insert(txn.Entry.Key, txn.Entry)
+		case DeleteOperation:
+			i.root.Delete(txn.Entry.Key)
+		}
+	}
+	return nil
+}
+
 // List is used ot list all the keys under a given
 // prefix, up to the next prefix.
 func (i *InmemBackend) List(prefix string) ([]string, error) {
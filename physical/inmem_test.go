@@ -11,4 +11,5 @@ func TestInmem(t *testing.T) {
 	inm := NewInmem(logger)
 	testBackend(t, inm)
 	testBackend_ListPrefix(t, inm)
+	testTransactionalBackend(t, inm)
 }
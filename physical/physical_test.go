@@ -203,6 +203,66 @@ func testBackend_ListPrefix(t *testing.T, b Backend) {
 
 }
 
+func testTransactionalBackend(t *testing.T, b Backend) {
+	tb, ok := b.(Transactional)
+	if !ok {
+		t.Fatalf("backend is not transactional")
+	}
+
+	if err := b.Put(&Entry{Key: "txn/old", Value: []byte("old")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	err := tb.Transaction([]*TxnEntry{
+		{Operation: PutOperation, Entry: &Entry{Key: "txn/foo", Value: []byte("foo")}},
+		{Operation: PutOperation, Entry: &Entry{Key: "txn/nested/bar", Value: []byte("bar")}},
+		{Operation: DeleteOperation, Entry: &Entry{Key: "txn/old"}},
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	for key, value := range map[string]string{"txn/foo": "foo", "txn/nested/bar": "bar"} {
+		out, err := b.Get(key)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if out == nil || string(out.Value) != value {
+			t.Fatalf("bad %s: %#v", key, out)
+		}
+	}
+	if out, err := b.Get("txn/old"); err != nil || out != nil {
+		t.Fatalf("expected deleted key, got %#v, %v", out, err)
+	}
+
+	keys, err := b.List("txn/")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	sort.Strings(keys)
+	if !reflect.DeepEqual(keys, []string{"foo", "nested/"}) {
+		t.Fatalf("bad: %v", keys)
+	}
+
+	// An invalid operation fails the whole transaction
+	err = tb.Transaction([]*TxnEntry{
+		{Operation: DeleteOperation, Entry: &Entry{Key: "txn/foo"}},
+		{Operation: Operation("rename"), Entry: &Entry{Key: "txn/nested/bar"}},
+	})
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if out, err := b.Get("txn/foo"); err != nil || out == nil {
+		t.Fatalf("expected key to remain, got %#v, %v", out, err)
+	}
+
+	for _, key := range []string{"txn/foo", "txn/nested/bar"} {
+		if err := b.Delete(key); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+}
+
 func testHABackend(t *testing.T, b HABackend, b2 HABackend) {
 	// Get the lock
 	lock, err := b.LockWith("foo", "bar")
@@ -4,13 +4,30 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/armon/go-metrics"
+	"github.com/hashicorp/go-uuid"
 	"github.com/lib/pq"
 )
 
+const (
+	// PostgreSQLLockTTL is how long a lock is valid without being renewed.
+	// Another node takes over the lock once it expires.
+	PostgreSQLLockTTL = 15 * time.Second
+
+	// PostgreSQLLockRenewInterval is how often the holder of a lock renews
+	// it
+	PostgreSQLLockRenewInterval = 5 * time.Second
+
+	// PostgreSQLLockRetryInterval is the amount of time to wait if a lock
+	// is held by another node before trying again
+	PostgreSQLLockRetryInterval = time.Second
+)
+
 // PostgreSQL Backend is a physical backend that stores data
 // within a PostgreSQL database.
 type PostgreSQLBackend struct {
@@ -20,7 +37,33 @@ type PostgreSQLBackend struct {
 	get_query    string
 	delete_query string
 	list_query   string
-	logger     *log.Logger
+	logger       *log.Logger
+
+	// haEnabled is whether the backend supports HA, with the locks held in
+	// haTable
+	haEnabled        bool
+	haTable          string
+	lock_query       string
+	unlock_query     string
+	lock_value_query string
+}
+
+// PostgreSQLLock implements a lock as a row of the HA table which is valid
+// for PostgreSQLLockTTL, renewed by the holder. The expiry is evaluated by
+// PostgreSQL, so the clocks of the nodes do not matter.
+type PostgreSQLLock struct {
+	backend    *PostgreSQLBackend
+	key, value string
+
+	// identity distinguishes the holder of the lock from the other
+	// instances using the same key and value
+	identity string
+
+	held bool
+	lock sync.Mutex
+
+	// stopRenewCh stops the renewal of the lock once released
+	stopRenewCh chan struct{}
 }
 
 // newPostgreSQLBackend constructs a PostgreSQL backend using the given
@@ -62,6 +105,23 @@ func newPostgreSQLBackend(conf map[string]string, logger *log.Logger) (Backend,
 			" UPDATE SET (parent_path, path, key, value) = ($1, $2, $3, $4)"
 	}
 
+	haEnabled := false
+	if haEnabledRaw, ok := conf["ha_enabled"]; ok {
+		haEnabled, err = strconv.ParseBool(haEnabledRaw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse ha_enabled: %v", err)
+		}
+	}
+	if haEnabled && upsert_required {
+		return nil, fmt.Errorf("ha_enabled requires PostgreSQL 9.5 or later")
+	}
+
+	unquoted_ha_table, ok := conf["ha_table"]
+	if !ok {
+		unquoted_ha_table = "vault_ha_locks"
+	}
+	quoted_ha_table := pq.QuoteIdentifier(unquoted_ha_table)
+
 	// Setup the backend.
 	m := &PostgreSQLBackend{
 		table:        quoted_table,
@@ -69,9 +129,20 @@ func newPostgreSQLBackend(conf map[string]string, logger *log.Logger) (Backend,
 		put_query:    put_query,
 		get_query:    "SELECT value FROM " + quoted_table + " WHERE path = $1 AND key = $2",
 		delete_query: "DELETE FROM " + quoted_table + " WHERE path = $1 AND key = $2",
-		list_query:  "SELECT key FROM " + quoted_table + " WHERE path = $1" +
+		list_query: "SELECT key FROM " + quoted_table + " WHERE path = $1" +
 			"UNION SELECT substr(path, length($1)+1) FROM " + quoted_table + "WHERE parent_path = $1",
-		logger:     logger,
+		logger:    logger,
+		haEnabled: haEnabled,
+		haTable:   quoted_ha_table,
+		// The lock is taken when it has expired or is already held by the
+		// same identity, which renews it
+		lock_query: "INSERT INTO " + quoted_ha_table + " (ha_key, ha_identity, ha_value, valid_until)" +
+			" VALUES ($1, $2, $3, NOW() + $4::integer * INTERVAL '1 second')" +
+			" ON CONFLICT (ha_key) DO UPDATE SET (ha_identity, ha_value, valid_until) =" +
+			" ($2, $3, NOW() + $4::integer * INTERVAL '1 second')" +
+			" WHERE " + quoted_ha_table + ".valid_until < NOW() OR " + quoted_ha_table + ".ha_identity = $2",
+		unlock_query:     "DELETE FROM " + quoted_ha_table + " WHERE ha_key = $1 AND ha_identity = $2",
+		lock_value_query: "SELECT ha_value FROM " + quoted_ha_table + " WHERE ha_key = $1 AND valid_until >= NOW()",
 	}
 
 	return m, nil
@@ -149,12 +220,41 @@ func (m *PostgreSQLBackend) Delete(fullPath string) error {
 	return nil
 }
 
+// Transaction is used to apply several operations atomically, in a
+// database transaction
+func (m *PostgreSQLBackend) Transaction(txns []*TxnEntry) error {
+	defer metrics.MeasureSince([]string{"postgres", "transaction"}, time.Now())
+
+	if err := validateTxns(txns); err != nil {
+		return err
+	}
+
+	tx, err := m.client.Begin()
+	if err != nil {
+		return err
+	}
+	for _, txn := range txns {
+		parentPath, path, key := m.splitKey(txn.Entry.Key)
+		switch txn.Operation {
+		case PutOperation:
+			_, err = tx.Exec(m.put_query, parentPath, path, key, txn.Entry.Value)
+		case DeleteOperation:
+			_, err = tx.Exec(m.delete_query, path, key)
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
 // List is used to list all the keys under a given
 // prefix, up to the next prefix.
 func (m *PostgreSQLBackend) List(prefix string) ([]string, error) {
 	defer metrics.MeasureSince([]string{"postgres", "list"}, time.Now())
 
-	rows, err := m.client.Query(m.list_query, "/" + prefix)
+	rows, err := m.client.Query(m.list_query, "/"+prefix)
 	if err != nil {
 		return nil, err
 	}
@@ -173,3 +273,129 @@ func (m *PostgreSQLBackend) List(prefix string) ([]string, error) {
 
 	return keys, nil
 }
+
+// LockWith is used for mutual exclusion based on the given key.
+func (m *PostgreSQLBackend) LockWith(key, value string) (Lock, error) {
+	identity, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	return &PostgreSQLLock{
+		backend:  m,
+		key:      key,
+		value:    value,
+		identity: identity,
+	}, nil
+}
+
+// HAEnabled indicates whether the HA functionality should be exposed.
+func (m *PostgreSQLBackend) HAEnabled() bool {
+	return m.haEnabled
+}
+
+// Lock tries to acquire the lock every PostgreSQLLockRetryInterval until it
+// succeeds or the stop channel is closed. The returned channel is closed
+// once the lock cannot be renewed before it expires.
+func (l *PostgreSQLLock) Lock(stopCh <-chan struct{}) (<-chan struct{}, error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.held {
+		return nil, fmt.Errorf("lock already held")
+	}
+
+	for {
+		acquired, err := l.tryToLock()
+		if err != nil {
+			return nil, err
+		}
+		if acquired {
+			break
+		}
+
+		select {
+		case <-time.After(PostgreSQLLockRetryInterval):
+		case <-stopCh:
+			return nil, nil
+		}
+	}
+
+	l.held = true
+	l.stopRenewCh = make(chan struct{})
+	leaderCh := make(chan struct{})
+	go l.renew(l.stopRenewCh, leaderCh)
+	return leaderCh, nil
+}
+
+// Unlock releases the lock by deleting its row, if still held by this
+// instance.
+func (l *PostgreSQLLock) Unlock() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if !l.held {
+		return nil
+	}
+
+	l.held = false
+	close(l.stopRenewCh)
+	_, err := l.backend.client.Exec(l.backend.unlock_query, l.key, l.identity)
+	return err
+}
+
+// Value checks whether or not the lock is held by any instance of
+// PostgreSQLLock, including this one, and returns the current value.
+func (l *PostgreSQLLock) Value() (bool, string, error) {
+	var value string
+	err := l.backend.client.QueryRow(l.backend.lock_value_query, l.key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return false, "", nil
+	}
+	if err != nil {
+		return false, "", err
+	}
+	return true, value, nil
+}
+
+// tryToLock takes or renews the lock, returning whether it is held
+func (l *PostgreSQLLock) tryToLock() (bool, error) {
+	result, err := l.backend.client.Exec(l.backend.lock_query,
+		l.key, l.identity, l.value, int(PostgreSQLLockTTL.Seconds()))
+	if err != nil {
+		return false, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// renew renews the lock every PostgreSQLLockRenewInterval until stopped,
+// and closes the leader channel once the lock is lost: taken by another
+// instance, or not renewed before it expires because of errors.
+func (l *PostgreSQLLock) renew(stopCh, leaderCh chan struct{}) {
+	defer close(leaderCh)
+
+	lastRenewal := time.Now()
+	ticker := time.NewTicker(PostgreSQLLockRenewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		held, err := l.tryToLock()
+		switch {
+		case err != nil:
+			l.backend.logger.Printf("[WARN] physical/postgresql: failed to renew lock: %v", err)
+			if time.Since(lastRenewal) >= PostgreSQLLockTTL-PostgreSQLLockRenewInterval {
+				return
+			}
+		case !held:
+			return
+		default:
+			lastRenewal = time.Now()
+		}
+	}
+}
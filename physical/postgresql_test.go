@@ -40,5 +40,44 @@ func TestPostgreSQLBackend(t *testing.T) {
 
 	testBackend(t, b)
 	testBackend_ListPrefix(t, b)
+	testTransactionalBackend(t, b)
+}
+
+func TestPostgreSQLHABackend(t *testing.T) {
+	connURL := os.Getenv("PGURL")
+	if connURL == "" {
+		t.SkipNow()
+	}
+
+	haTable := os.Getenv("PGHATABLE")
+	if haTable == "" {
+		haTable = "vault_ha_locks"
+	}
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	b, err := NewBackend("postgresql", logger, map[string]string{
+		"connection_url": connURL,
+		"ha_enabled":     "true",
+		"ha_table":       haTable,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create new backend: %v", err)
+	}
+
+	defer func() {
+		pg := b.(*PostgreSQLBackend)
+		_, err := pg.client.Exec("TRUNCATE TABLE " + pg.haTable)
+		if err != nil {
+			t.Fatalf("Failed to truncate table: %v", err)
+		}
+	}()
 
+	ha, ok := b.(HABackend)
+	if !ok {
+		t.Fatalf("PostgreSQL does not implement HABackend")
+	}
+	if !ha.HAEnabled() {
+		t.Fatalf("HA is not enabled")
+	}
+	testHABackend(t, ha, ha)
 }
@@ -0,0 +1,935 @@
+package physical
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/boltdb/bolt"
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/raft"
+	"github.com/hashicorp/raft-boltdb"
+	"github.com/hashicorp/vault/helper/tlsutil"
+)
+
+const (
+	// raftDefaultAddress is the address raft listens on and advertises to
+	// the other nodes if none is configured
+	raftDefaultAddress = "127.0.0.1:8202"
+
+	// raftApplyTimeout bounds how long a write waits to be committed
+	raftApplyTimeout = 10 * time.Second
+
+	// raftBootstrapTimeout bounds how long bootstrapping a cluster waits
+	// for the node to become the leader
+	raftBootstrapTimeout = 30 * time.Second
+
+	// raftTransportTimeout bounds the I/O between the nodes
+	raftTransportTimeout = 10 * time.Second
+
+	// raftTransportMaxPool is the number of connections kept open to each
+	// of the other nodes
+	raftTransportMaxPool = 3
+
+	// raftSnapshotsRetained is the number of snapshots kept on disk
+	raftSnapshotsRetained = 2
+
+	// raftNodeIDFile stores the generated node ID within the path
+	raftNodeIDFile = "node-id"
+)
+
+// raftDataBucket is the bolt bucket holding the entries
+var raftDataBucket = []byte("data")
+
+// errRaftNotRunning is returned by the operations needing raft while it
+// is stopped
+var errRaftNotRunning = errors.New("raft is not running")
+
+// RaftBackend is a physical backend that replicates the entries between
+// several Vault servers with the raft consensus protocol, and stores them on
+// the local disk of each of them. It needs no external storage system and
+// provides HA: the active Vault is the server which is the raft leader.
+//
+// Writes are only accepted by the leader; reads are served from the local
+// copy of the data, also while raft is stopped.
+type RaftBackend struct {
+	path   string
+	nodeID string
+	logger *log.Logger
+
+	fsm       *raftFSM
+	logStore  *raftboltdb.BoltStore
+	snapStore raft.SnapshotStore
+
+	// raft and transport are only set while raft runs, as stopping raft
+	// closes the transport
+	l            sync.RWMutex
+	raft         *raft.Raft
+	transport    raft.Transport
+	raftConf     *raft.Config
+	newTransport func() (raft.Transport, error)
+
+	notifyCh   chan bool
+	shutdownCh chan struct{}
+
+	// leaderChangeCh is closed and replaced each time the node gains or
+	// loses the leadership
+	leaderLock     sync.Mutex
+	isLeader       bool
+	leaderChangeCh chan struct{}
+}
+
+// RaftPeer is a node of the raft cluster
+type RaftPeer struct {
+	NodeID  string
+	Address string
+	Leader  bool
+	Voter   bool
+}
+
+// newRaftBackend constructs a raft backend storing its data in the
+// configured directory. Raft is started right away on a node without any
+// raft state, which waits until it is either bootstrapped as a new cluster
+// by initializing Vault, or joined to an existing cluster. Otherwise it is
+// started once Vault is unsealed.
+func newRaftBackend(conf map[string]string, logger *log.Logger) (Backend, error) {
+	path, ok := conf["path"]
+	if !ok {
+		return nil, fmt.Errorf("'path' must be set")
+	}
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return nil, err
+	}
+
+	nodeID, ok := conf["node_id"]
+	if !ok {
+		var err error
+		nodeID, err = raftNodeID(path)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed to get the node ID: {{err}}", err)
+		}
+	}
+	logger.Printf("[DEBUG]: physical/raft: config node_id set to %s", nodeID)
+
+	bindAddr, ok := conf["address"]
+	if !ok {
+		bindAddr = raftDefaultAddress
+	}
+	logger.Printf("[DEBUG]: physical/raft: config address set to %s", bindAddr)
+
+	// The address the transport listens on is advertised unless another
+	// one is configured
+	var advertise net.Addr
+	if advertiseAddr, ok := conf["advertise_address"]; ok {
+		addr, err := net.ResolveTCPAddr("tcp", advertiseAddr)
+		if err != nil {
+			return nil, errwrap.Wrapf("failed to resolve advertise_address: {{err}}", err)
+		}
+		advertise = addr
+	}
+
+	// The traffic between the nodes carries the data and the changes to the
+	// cluster, so it is only left unencrypted when it cannot leave the host
+	newTransport := func() (raft.Transport, error) {
+		return raft.NewTCPTransportWithLogger(bindAddr, advertise, raftTransportMaxPool, raftTransportTimeout, logger)
+	}
+	if _, ok := conf["tls_cert_file"]; !ok {
+		if !raftLoopbackAddr(bindAddr) {
+			return nil, fmt.Errorf("'tls_cert_file' must be set unless 'address' is a loopback address")
+		}
+		if advertise != nil && !advertise.(*net.TCPAddr).IP.IsLoopback() {
+			return nil, fmt.Errorf("'tls_cert_file' must be set unless 'advertise_address' is a loopback address")
+		}
+	} else {
+		tlsConfig, err := raftTLSConfig(conf)
+		if err != nil {
+			return nil, err
+		}
+		newTransport = func() (raft.Transport, error) {
+			listener, err := tls.Listen("tcp", bindAddr, tlsConfig)
+			if err != nil {
+				return nil, err
+			}
+			stream := &raftTLSStreamLayer{
+				Listener:  listener,
+				advertise: advertise,
+				config:    tlsConfig,
+			}
+			if advertise == nil {
+				stream.advertise = listener.Addr()
+			}
+			return raft.NewNetworkTransportWithLogger(stream, raftTransportMaxPool, raftTransportTimeout, logger), nil
+		}
+		logger.Printf("[DEBUG]: physical/raft: configured TLS")
+	}
+
+	fsm, err := newRaftFSM(filepath.Join(path, "vault.db"))
+	if err != nil {
+		return nil, err
+	}
+
+	raftPath := filepath.Join(path, "raft")
+	if err := os.MkdirAll(raftPath, 0700); err != nil {
+		fsm.db.Close()
+		return nil, err
+	}
+	logStore, err := raftboltdb.NewBoltStore(filepath.Join(raftPath, "raft.db"))
+	if err != nil {
+		fsm.db.Close()
+		return nil, err
+	}
+	snapStore, err := raft.NewFileSnapshotStoreWithLogger(raftPath, raftSnapshotsRetained, logger)
+	if err != nil {
+		fsm.db.Close()
+		logStore.Close()
+		return nil, err
+	}
+
+	b := &RaftBackend{
+		path:           path,
+		nodeID:         nodeID,
+		logger:         logger,
+		fsm:            fsm,
+		logStore:       logStore,
+		snapStore:      snapStore,
+		newTransport:   newTransport,
+		notifyCh:       make(chan bool, 1),
+		shutdownCh:     make(chan struct{}),
+		leaderChangeCh: make(chan struct{}),
+	}
+
+	b.raftConf = raft.DefaultConfig()
+	b.raftConf.LocalID = raft.ServerID(nodeID)
+	b.raftConf.NotifyCh = b.notifyCh
+	b.raftConf.Logger = logger
+
+	hasState, err := raft.HasExistingState(logStore, logStore, snapStore)
+	if err == nil && !hasState {
+		err = b.startRaft()
+	}
+	if err != nil {
+		fsm.db.Close()
+		logStore.Close()
+		return nil, err
+	}
+	go b.observeLeadership()
+
+	return b, nil
+}
+
+// raftNodeID returns the ID of the node stored within path, generating one
+// the first time
+func raftNodeID(path string) (string, error) {
+	idPath := filepath.Join(path, raftNodeIDFile)
+	id, err := ioutil.ReadFile(idPath)
+	if err == nil {
+		return strings.TrimSpace(string(id)), nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	nodeID, err := uuid.GenerateUUID()
+	if err != nil {
+		return "", err
+	}
+	if err := ioutil.WriteFile(idPath, []byte(nodeID), 0600); err != nil {
+		return "", err
+	}
+	return nodeID, nil
+}
+
+// raftLoopbackAddr returns whether the host of the address only resolves
+// to loopback addresses
+func raftLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil || host == "" {
+		return false
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.IsLoopback()
+	}
+
+	ips, err := net.LookupIP(host)
+	if err != nil || len(ips) == 0 {
+		return false
+	}
+	for _, ip := range ips {
+		if !ip.IsLoopback() {
+			return false
+		}
+	}
+	return true
+}
+
+// raftTLSConfig builds the mutual TLS configuration of the connections
+// between the nodes. The nodes present the same certificate both as server
+// and as client, and it must be issued by the configured CA.
+func raftTLSConfig(conf map[string]string) (*tls.Config, error) {
+	certFile, okCert := conf["tls_cert_file"]
+	keyFile, okKey := conf["tls_key_file"]
+	caFile, okCA := conf["tls_ca_file"]
+	if !okCert || !okKey || !okCA {
+		return nil, fmt.Errorf("'tls_cert_file', 'tls_key_file' and 'tls_ca_file' must all be set to use TLS")
+	}
+
+	tlsMinVersionStr, ok := conf["tls_min_version"]
+	if !ok {
+		tlsMinVersionStr = "tls12"
+	}
+	tlsMinVersion, ok := tlsutil.TLSLookup[tlsMinVersionStr]
+	if !ok {
+		return nil, fmt.Errorf("invalid 'tls_min_version'")
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("raft tls setup failed: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %v", err)
+	}
+	caPool := x509.NewCertPool()
+	if !caPool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("failed to parse CA certificate")
+	}
+
+	return &tls.Config{
+		MinVersion:   tlsMinVersion,
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      caPool,
+		ClientCAs:    caPool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}, nil
+}
+
+// raftTLSStreamLayer carries the raft traffic over mutual TLS
+type raftTLSStreamLayer struct {
+	net.Listener
+	advertise net.Addr
+	config    *tls.Config
+}
+
+// Dial connects to another node, verifying that its certificate is valid
+// for the host of its address
+func (s *raftTLSStreamLayer) Dial(address raft.ServerAddress, timeout time.Duration) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	return tls.DialWithDialer(dialer, "tcp", string(address), s.config)
+}
+
+// Addr returns the address advertised to the other nodes
+func (s *raftTLSStreamLayer) Addr() net.Addr {
+	return s.advertise
+}
+
+// observeLeadership tracks the leadership changes notified by raft
+func (b *RaftBackend) observeLeadership() {
+	for {
+		select {
+		case isLeader := <-b.notifyCh:
+			// Ignore a late notification of a raft which was stopped
+			if _, err := b.getRaft(); err != nil && isLeader {
+				continue
+			}
+			b.setLeader(isLeader)
+			b.logger.Printf("[INFO]: physical/raft: leadership changed, leader: %v", isLeader)
+		case <-b.shutdownCh:
+			return
+		}
+	}
+}
+
+// setLeader records whether the node is the leader
+func (b *RaftBackend) setLeader(isLeader bool) {
+	b.leaderLock.Lock()
+	defer b.leaderLock.Unlock()
+	if b.isLeader == isLeader {
+		return
+	}
+	b.isLeader = isLeader
+	close(b.leaderChangeCh)
+	b.leaderChangeCh = make(chan struct{})
+}
+
+// leadership returns whether the node is the leader, and a channel closed
+// when that changes
+func (b *RaftBackend) leadership() (bool, <-chan struct{}) {
+	b.leaderLock.Lock()
+	defer b.leaderLock.Unlock()
+	return b.isLeader, b.leaderChangeCh
+}
+
+// startRaft starts raft unless it runs. The caller must hold the lock if
+// the backend is shared.
+func (b *RaftBackend) startRaft() error {
+	if b.raft != nil {
+		return nil
+	}
+
+	transport, err := b.newTransport()
+	if err != nil {
+		return err
+	}
+	r, err := raft.NewRaft(b.raftConf, b.fsm, b.logStore, b.logStore, b.snapStore, transport)
+	if err != nil {
+		transport.(io.Closer).Close()
+		return err
+	}
+	b.raft = r
+	b.transport = transport
+	return nil
+}
+
+// getRaft returns raft if it runs
+func (b *RaftBackend) getRaft() (*raft.Raft, error) {
+	b.l.RLock()
+	defer b.l.RUnlock()
+	if b.raft == nil {
+		return nil, errRaftNotRunning
+	}
+	return b.raft, nil
+}
+
+// SetupCluster starts raft, so that the node takes part in the cluster. It
+// is called when Vault is unsealed.
+func (b *RaftBackend) SetupCluster() error {
+	b.l.Lock()
+	defer b.l.Unlock()
+	return b.startRaft()
+}
+
+// TeardownCluster stops raft, so that another node takes over as the
+// leader while this one is sealed. The data can still be read.
+func (b *RaftBackend) TeardownCluster() error {
+	b.l.Lock()
+	defer b.l.Unlock()
+	if b.raft == nil {
+		return nil
+	}
+
+	err := b.raft.Shutdown().Error()
+	b.raft = nil
+	b.transport = nil
+	b.setLeader(false)
+	return err
+}
+
+// Bootstrap starts a new cluster made of this node, unless the node is
+// already part of one, and waits until it is the leader. It is called when
+// Vault is initialized.
+func (b *RaftBackend) Bootstrap() error {
+	b.l.Lock()
+	err := b.startRaft()
+	if err != nil {
+		b.l.Unlock()
+		return err
+	}
+	hasState, err := raft.HasExistingState(b.logStore, b.logStore, b.snapStore)
+	if err == nil && !hasState {
+		b.logger.Printf("[INFO]: physical/raft: bootstrapping a new cluster")
+		future := b.raft.BootstrapCluster(raft.Configuration{
+			Servers: []raft.Server{
+				{
+					Suffrage: raft.Voter,
+					ID:       raft.ServerID(b.nodeID),
+					Address:  b.transport.LocalAddr(),
+				},
+			},
+		})
+		if err = future.Error(); err != nil {
+			err = errwrap.Wrapf("failed to bootstrap the cluster: {{err}}", err)
+		}
+	}
+	b.l.Unlock()
+	if err != nil {
+		return err
+	}
+
+	timeout := time.After(raftBootstrapTimeout)
+	for {
+		isLeader, changeCh := b.leadership()
+		if isLeader {
+			return nil
+		}
+		select {
+		case <-changeCh:
+		case <-timeout:
+			return fmt.Errorf("timed out waiting for the node to become the raft leader")
+		}
+	}
+}
+
+// Address returns the address of the node advertised to the other nodes,
+// or an empty string if raft is not running
+func (b *RaftBackend) Address() string {
+	b.l.RLock()
+	defer b.l.RUnlock()
+	if b.transport == nil {
+		return ""
+	}
+	return string(b.transport.LocalAddr())
+}
+
+// AddPeer adds a node to the cluster as a voter. It must be called on the
+// leader, and the node must be running without any raft state.
+func (b *RaftBackend) AddPeer(nodeID, address string) error {
+	r, err := b.getRaft()
+	if err != nil {
+		return err
+	}
+	b.logger.Printf("[INFO]: physical/raft: adding peer %s at %s", nodeID, address)
+	return r.AddVoter(raft.ServerID(nodeID), raft.ServerAddress(address), 0, raftApplyTimeout).Error()
+}
+
+// RemovePeer removes a node from the cluster. It must be called on the
+// leader.
+func (b *RaftBackend) RemovePeer(nodeID string) error {
+	r, err := b.getRaft()
+	if err != nil {
+		return err
+	}
+	b.logger.Printf("[INFO]: physical/raft: removing peer %s", nodeID)
+	return r.RemoveServer(raft.ServerID(nodeID), 0, raftApplyTimeout).Error()
+}
+
+// Peers returns the nodes of the cluster
+func (b *RaftBackend) Peers() ([]RaftPeer, error) {
+	r, err := b.getRaft()
+	if err != nil {
+		return nil, err
+	}
+	future := r.GetConfiguration()
+	if err := future.Error(); err != nil {
+		return nil, err
+	}
+
+	leader := r.Leader()
+	servers := future.Configuration().Servers
+	peers := make([]RaftPeer, 0, len(servers))
+	for _, server := range servers {
+		peers = append(peers, RaftPeer{
+			NodeID:  string(server.ID),
+			Address: string(server.Address),
+			Leader:  server.Address == leader,
+			Voter:   server.Suffrage == raft.Voter,
+		})
+	}
+	return peers, nil
+}
+
+// Snapshot writes a snapshot of the data to w. The snapshot starts with a
+// line holding its JSON encoded raft metadata.
+func (b *RaftBackend) Snapshot(w io.Writer) error {
+	r, err := b.getRaft()
+	if err != nil {
+		return err
+	}
+
+	// A snapshot cannot be taken until the latest configuration change is
+	// applied, which the leader can wait for
+	if isLeader, _ := b.leadership(); isLeader {
+		if err := r.Barrier(raftApplyTimeout).Error(); err != nil {
+			return err
+		}
+	}
+
+	future := r.Snapshot()
+	if err := future.Error(); err != nil {
+		return err
+	}
+	meta, snapshot, err := future.Open()
+	if err != nil {
+		return err
+	}
+	defer snapshot.Close()
+
+	if err := json.NewEncoder(w).Encode(meta); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, snapshot)
+	return err
+}
+
+// Restore replaces the data of the cluster with a snapshot written by
+// Snapshot. It must be called on the leader.
+func (b *RaftBackend) Restore(snapshot io.Reader) error {
+	r, err := b.getRaft()
+	if err != nil {
+		return err
+	}
+
+	br := bufio.NewReader(snapshot)
+	line, err := br.ReadBytes('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read the snapshot metadata: %v", err)
+	}
+	var meta raft.SnapshotMeta
+	if err := json.Unmarshal(line, &meta); err != nil {
+		return fmt.Errorf("failed to decode the snapshot metadata: %v", err)
+	}
+
+	b.logger.Printf("[INFO]: physical/raft: restoring snapshot at index %d", meta.Index)
+	return r.Restore(&meta, br, 0)
+}
+
+// Close stops raft and closes the stores
+func (b *RaftBackend) Close() error {
+	err := b.TeardownCluster()
+	close(b.shutdownCh)
+	b.logStore.Close()
+	b.fsm.db.Close()
+	return err
+}
+
+// apply commits the operations through raft and waits until they are
+// applied to the local data
+func (b *RaftBackend) apply(txns []*TxnEntry) error {
+	r, err := b.getRaft()
+	if err != nil {
+		return err
+	}
+	cmd, err := json.Marshal(txns)
+	if err != nil {
+		return err
+	}
+
+	future := r.Apply(cmd, raftApplyTimeout)
+	if err := future.Error(); err != nil {
+		return err
+	}
+	if err, ok := future.Response().(error); ok {
+		return err
+	}
+	return nil
+}
+
+// Put is used to insert or update an entry
+func (b *RaftBackend) Put(entry *Entry) error {
+	defer metrics.MeasureSince([]string{"raft", "put"}, time.Now())
+	return b.apply([]*TxnEntry{
+		{
+			Operation: PutOperation,
+			Entry:     entry,
+		},
+	})
+}
+
+// Get is used to fetch an entry
+func (b *RaftBackend) Get(key string) (*Entry, error) {
+	defer metrics.MeasureSince([]string{"raft", "get"}, time.Now())
+
+	var entry *Entry
+	err := b.fsm.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(raftDataBucket).Get([]byte(key))
+		if value == nil {
+			return nil
+		}
+
+		// The value is only valid during the transaction
+		entry = &Entry{
+			Key:   key,
+			Value: append([]byte(nil), value...),
+		}
+		return nil
+	})
+	return entry, err
+}
+
+// Delete is used to permanently delete an entry
+func (b *RaftBackend) Delete(key string) error {
+	defer metrics.MeasureSince([]string{"raft", "delete"}, time.Now())
+	return b.apply([]*TxnEntry{
+		{
+			Operation: DeleteOperation,
+			Entry:     &Entry{Key: key},
+		},
+	})
+}
+
+// List is used to list all the keys under a given
+// prefix, up to the next prefix.
+func (b *RaftBackend) List(prefix string) ([]string, error) {
+	defer metrics.MeasureSince([]string{"raft", "list"}, time.Now())
+
+	var keys []string
+	err := b.fsm.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(raftDataBucket).Cursor()
+		p := []byte(prefix)
+		for k, _ := c.Seek(p); k != nil && bytes.HasPrefix(k, p); k, _ = c.Next() {
+			key := string(k[len(p):])
+			i := strings.Index(key, "/")
+			if i == -1 {
+				keys = append(keys, key)
+				continue
+			}
+
+			// Skip the other keys of the folder, which sort before the
+			// first key after "folder0", as '0' follows '/'
+			keys = append(keys, key[:i+1])
+			k, _ = c.Seek([]byte(prefix + key[:i] + "0"))
+			if k == nil || !bytes.HasPrefix(k, p) {
+				break
+			}
+			c.Prev()
+		}
+		return nil
+	})
+	return keys, err
+}
+
+// Transaction applies the operations in order, atomically
+func (b *RaftBackend) Transaction(txns []*TxnEntry) error {
+	defer metrics.MeasureSince([]string{"raft", "transaction"}, time.Now())
+	if err := validateTxns(txns); err != nil {
+		return err
+	}
+	return b.apply(txns)
+}
+
+// LockWith is used for mutual exclusion based on the given key. The lock
+// is held by the raft leader.
+func (b *RaftBackend) LockWith(key, value string) (Lock, error) {
+	return &RaftLock{
+		b:     b,
+		key:   key,
+		value: value,
+	}, nil
+}
+
+// HAEnabled indicates whether the HA functionality should be exposed.
+// Currently always returns true.
+func (b *RaftBackend) HAEnabled() bool {
+	return true
+}
+
+// RaftLock is the Lock implementation of the raft backend. It is acquired
+// once the node becomes the raft leader, and lost with the leadership.
+// Releasing it does not give up the leadership, so another node can only
+// take over once this one stops being the leader.
+type RaftLock struct {
+	b     *RaftBackend
+	key   string
+	value string
+
+	held   bool
+	stopCh chan struct{}
+	l      sync.Mutex
+}
+
+func (l *RaftLock) Lock(stopCh <-chan struct{}) (<-chan struct{}, error) {
+	l.l.Lock()
+	defer l.l.Unlock()
+	if l.held {
+		return nil, fmt.Errorf("lock already held")
+	}
+
+	// Wait for the leadership
+	for {
+		isLeader, changeCh := l.b.leadership()
+		if isLeader {
+			break
+		}
+		select {
+		case <-changeCh:
+		case <-stopCh:
+			return nil, nil
+		}
+	}
+
+	// Make sure every entry of the previous leader has been applied before
+	// advertising the new value
+	r, err := l.b.getRaft()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.Barrier(raftApplyTimeout).Error(); err != nil {
+		return nil, err
+	}
+	if err := l.b.Put(&Entry{Key: l.key, Value: []byte(l.value)}); err != nil {
+		return nil, err
+	}
+
+	leaderCh := make(chan struct{})
+	l.stopCh = make(chan struct{})
+	go l.monitor(leaderCh, l.stopCh)
+
+	l.held = true
+	return leaderCh, nil
+}
+
+// monitor closes leaderCh once the node loses the leadership
+func (l *RaftLock) monitor(leaderCh chan struct{}, stopCh chan struct{}) {
+	defer close(leaderCh)
+	for {
+		isLeader, changeCh := l.b.leadership()
+		if !isLeader {
+			return
+		}
+		select {
+		case <-changeCh:
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+func (l *RaftLock) Unlock() error {
+	l.l.Lock()
+	defer l.l.Unlock()
+
+	if !l.held {
+		return nil
+	}
+
+	close(l.stopCh)
+	l.stopCh = nil
+	l.held = false
+
+	// Only the leader can clear the value
+	if isLeader, _ := l.b.leadership(); isLeader {
+		return l.b.Delete(l.key)
+	}
+	return nil
+}
+
+func (l *RaftLock) Value() (bool, string, error) {
+	r, err := l.b.getRaft()
+	if err != nil || r.Leader() == "" {
+		return false, "", nil
+	}
+
+	entry, err := l.b.Get(l.key)
+	if err != nil || entry == nil {
+		return false, "", err
+	}
+	return true, string(entry.Value), nil
+}
+
+// raftFSM applies the committed operations to a bolt database
+type raftFSM struct {
+	db *bolt.DB
+}
+
+func newRaftFSM(path string) (*raftFSM, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(raftDataBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &raftFSM{db: db}, nil
+}
+
+// Apply applies a committed log. The returned error, if any, is the
+// response of the write.
+func (f *raftFSM) Apply(l *raft.Log) interface{} {
+	var txns []*TxnEntry
+	if err := json.Unmarshal(l.Data, &txns); err != nil {
+		return err
+	}
+
+	return f.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(raftDataBucket)
+		for _, txn := range txns {
+			var err error
+			switch txn.Operation {
+			case PutOperation:
+				err = bucket.Put([]byte(txn.Entry.Key), txn.Entry.Value)
+			case DeleteOperation:
+				err = bucket.Delete([]byte(txn.Entry.Key))
+			default:
+				err = fmt.Errorf("unknown operation %q", txn.Operation)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Snapshot opens a read transaction, which the snapshot is written from
+func (f *raftFSM) Snapshot() (raft.FSMSnapshot, error) {
+	tx, err := f.db.Begin(false)
+	if err != nil {
+		return nil, err
+	}
+	return &raftFSMSnapshot{tx: tx}, nil
+}
+
+// Restore replaces the data with the entries of a snapshot
+func (f *raftFSM) Restore(r io.ReadCloser) error {
+	defer r.Close()
+
+	return f.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(raftDataBucket); err != nil {
+			return err
+		}
+		bucket, err := tx.CreateBucket(raftDataBucket)
+		if err != nil {
+			return err
+		}
+
+		dec := json.NewDecoder(r)
+		for {
+			var entry Entry
+			err := dec.Decode(&entry)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(entry.Key), entry.Value); err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// raftFSMSnapshot writes the entries as a stream of JSON objects
+type raftFSMSnapshot struct {
+	tx *bolt.Tx
+}
+
+func (s *raftFSMSnapshot) Persist(sink raft.SnapshotSink) error {
+	enc := json.NewEncoder(sink)
+	err := s.tx.Bucket(raftDataBucket).ForEach(func(k, v []byte) error {
+		return enc.Encode(&Entry{
+			Key:   string(k),
+			Value: v,
+		})
+	})
+	if err != nil {
+		sink.Cancel()
+		return err
+	}
+	return sink.Close()
+}
+
+func (s *raftFSMSnapshot) Release() {
+	s.tx.Rollback()
+}
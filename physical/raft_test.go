@@ -0,0 +1,229 @@
+package physical
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+func testRaftBackend(t *testing.T, nodeID string) (*RaftBackend, func()) {
+	dir, err := ioutil.TempDir("", "vault")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	b, err := NewBackend("raft", logger, map[string]string{
+		"path":    dir,
+		"node_id": nodeID,
+		"address": "127.0.0.1:0",
+	})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("err: %s", err)
+	}
+
+	rb := b.(*RaftBackend)
+	return rb, func() {
+		rb.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestRaftBackend(t *testing.T) {
+	b, cleanup := testRaftBackend(t, "node1")
+	defer cleanup()
+
+	if err := b.Bootstrap(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	testBackend(t, b)
+	testBackend_ListPrefix(t, b)
+	testTransactionalBackend(t, b)
+}
+
+func TestRaftBackend_Lock(t *testing.T) {
+	b, cleanup := testRaftBackend(t, "node1")
+	defer cleanup()
+
+	// The lock is only acquired by the leader
+	lock, err := b.LockWith("foo", "bar")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	stopCh := make(chan struct{})
+	time.AfterFunc(50*time.Millisecond, func() {
+		close(stopCh)
+	})
+	leaderCh, err := lock.Lock(stopCh)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if leaderCh != nil {
+		t.Fatalf("should not get leader ch")
+	}
+
+	if err := b.Bootstrap(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	leaderCh, err = lock.Lock(nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if leaderCh == nil {
+		t.Fatalf("failed to get leader ch")
+	}
+
+	held, val, err := lock.Value()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !held || val != "bar" {
+		t.Fatalf("bad: %v %q", held, val)
+	}
+
+	lock.Unlock()
+	select {
+	case <-leaderCh:
+	case <-time.After(time.Second):
+		t.Fatalf("leader ch should be closed")
+	}
+	held, _, err = lock.Value()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if held {
+		t.Fatalf("should not be held")
+	}
+}
+
+func TestRaftBackend_Snapshot(t *testing.T) {
+	b, cleanup := testRaftBackend(t, "node1")
+	defer cleanup()
+
+	if err := b.Bootstrap(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := b.Put(&Entry{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	var snapshot bytes.Buffer
+	if err := b.Snapshot(&snapshot); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Change the data, then go back to the snapshot
+	if err := b.Put(&Entry{Key: "foo", Value: []byte("baz")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := b.Put(&Entry{Key: "zip", Value: []byte("zap")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := b.Restore(&snapshot); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	entry, err := b.Get("foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if entry == nil || string(entry.Value) != "bar" {
+		t.Fatalf("bad: %#v", entry)
+	}
+	entry, err = b.Get("zip")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if entry != nil {
+		t.Fatalf("bad: %#v", entry)
+	}
+
+	// A truncated snapshot is rejected
+	var truncated bytes.Buffer
+	if err := b.Snapshot(&truncated); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	truncated.Truncate(truncated.Len() - 1)
+	if err := b.Restore(&truncated); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestRaftBackend_Peers(t *testing.T) {
+	b, cleanup := testRaftBackend(t, "node1")
+	defer cleanup()
+	b2, cleanup2 := testRaftBackend(t, "node2")
+	defer cleanup2()
+
+	if err := b.Bootstrap(); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if err := b.Put(&Entry{Key: "foo", Value: []byte("bar")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if err := b.AddPeer("node2", b2.Address()); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	peers, err := b.Peers()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(peers) != 2 || peers[0].NodeID != "node1" || !peers[0].Leader || peers[1].NodeID != "node2" || peers[1].Leader {
+		t.Fatalf("bad: %#v", peers)
+	}
+
+	// The data is replicated to the new node, which does not accept writes
+	var entry *Entry
+	for i := 0; i < 50 && entry == nil; i++ {
+		time.Sleep(100 * time.Millisecond)
+		entry, err = b2.Get("foo")
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	if entry == nil || string(entry.Value) != "bar" {
+		t.Fatalf("bad: %#v", entry)
+	}
+	if err := b2.Put(&Entry{Key: "foo", Value: []byte("baz")}); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	if err := b.RemovePeer("node2"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	peers, err = b.Peers()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(peers) != 1 || peers[0].NodeID != "node1" {
+		t.Fatalf("bad: %#v", peers)
+	}
+}
+
+func TestRaftBackend_RequiresTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Without TLS, the nodes can only be reached from the same host
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	for _, conf := range []map[string]string{
+		{"address": "0.0.0.0:0"},
+		{"address": ":0"},
+		{"address": "127.0.0.1:0", "advertise_address": "10.0.0.1:8202"},
+	} {
+		conf["path"] = dir
+		conf["node_id"] = "node1"
+		if _, err := NewBackend("raft", logger, conf); err == nil {
+			t.Fatalf("%v: expected error", conf)
+		}
+	}
+}
@@ -4,9 +4,11 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -24,6 +26,11 @@ type S3Backend struct {
 	bucket string
 	client *s3.S3
 	logger *log.Logger
+
+	// sse is the server-side encryption of the objects, if any, and
+	// kmsKeyID the KMS key used with aws:kms encryption
+	sse      string
+	kmsKeyID string
 }
 
 // newS3Backend constructs a S3 backend using a pre-existing
@@ -63,6 +70,43 @@ func newS3Backend(conf map[string]string, logger *log.Logger) (Backend, error) {
 		}
 	}
 
+	// Objects are encrypted with aws:kms when a KMS key is given
+	kmsKeyID := conf["kms_key_id"]
+	sse := conf["server_side_encryption"]
+	if sse == "" && kmsKeyID != "" {
+		sse = s3.ServerSideEncryptionAwsKms
+	}
+	switch sse {
+	case "", s3.ServerSideEncryptionAes256:
+		if kmsKeyID != "" {
+			return nil, fmt.Errorf("'kms_key_id' requires 'server_side_encryption' to be %q", s3.ServerSideEncryptionAwsKms)
+		}
+	case s3.ServerSideEncryptionAwsKms:
+	default:
+		return nil, fmt.Errorf("'server_side_encryption' must be %q or %q",
+			s3.ServerSideEncryptionAes256, s3.ServerSideEncryptionAwsKms)
+	}
+
+	// Path-style addressing is required by most S3-compatible stores
+	forcePathStyle := false
+	if v, ok := conf["s3_force_path_style"]; ok {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed parsing s3_force_path_style parameter: %v", err)
+		}
+		forcePathStyle = b
+	}
+
+	// Failed requests are retried with an exponential backoff and jitter
+	maxRetries := aws.UseServiceDefaultRetries
+	if v, ok := conf["max_retries"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("'max_retries' must be a non-negative integer")
+		}
+		maxRetries = n
+	}
+
 	credsConfig := &awsutil.CredentialsConfig{
 		AccessKey:    accessKey,
 		SecretKey:    secretKey,
@@ -74,9 +118,11 @@ func newS3Backend(conf map[string]string, logger *log.Logger) (Backend, error) {
 	}
 
 	s3conn := s3.New(session.New(&aws.Config{
-		Credentials: creds,
-		Endpoint:    aws.String(endpoint),
-		Region:      aws.String(region),
+		Credentials:      creds,
+		Endpoint:         aws.String(endpoint),
+		Region:           aws.String(region),
+		S3ForcePathStyle: aws.Bool(forcePathStyle),
+		MaxRetries:       aws.Int(maxRetries),
 	}))
 
 	_, err = s3conn.HeadBucket(&s3.HeadBucketInput{Bucket: &bucket})
@@ -85,9 +131,11 @@ func newS3Backend(conf map[string]string, logger *log.Logger) (Backend, error) {
 	}
 
 	s := &S3Backend{
-		client: s3conn,
-		bucket: bucket,
-		logger: logger,
+		client:   s3conn,
+		bucket:   bucket,
+		logger:   logger,
+		sse:      sse,
+		kmsKeyID: kmsKeyID,
 	}
 	return s, nil
 }
@@ -96,11 +144,19 @@ func newS3Backend(conf map[string]string, logger *log.Logger) (Backend, error) {
 func (s *S3Backend) Put(entry *Entry) error {
 	defer metrics.MeasureSince([]string{"s3", "put"}, time.Now())
 
-	_, err := s.client.PutObject(&s3.PutObjectInput{
+	input := &s3.PutObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(entry.Key),
 		Body:   bytes.NewReader(entry.Value),
-	})
+	}
+	if s.sse != "" {
+		input.ServerSideEncryption = aws.String(s.sse)
+	}
+	if s.kmsKeyID != "" {
+		input.SSEKMSKeyId = aws.String(s.kmsKeyID)
+	}
+
+	_, err := s.client.PutObject(input)
 
 	if err != nil {
 		return err
@@ -132,8 +188,16 @@ func (s *S3Backend) Get(key string) (*Entry, error) {
 		return nil, fmt.Errorf("got nil response from S3 but no error")
 	}
 
-	data := make([]byte, *resp.ContentLength)
-	_, err = io.ReadFull(resp.Body, data)
+	defer resp.Body.Close()
+
+	// Some S3-compatible stores omit the length
+	var data []byte
+	if resp.ContentLength != nil {
+		data = make([]byte, *resp.ContentLength)
+		_, err = io.ReadFull(resp.Body, data)
+	} else {
+		data, err = ioutil.ReadAll(resp.Body)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -163,32 +227,29 @@ func (s *S3Backend) Delete(key string) error {
 }
 
 // List is used to list all the keys under a given
-// prefix, up to the next prefix.
+// prefix, up to the next prefix. The objects are listed
+// one 'folder' at a time, across as many pages as needed.
 func (s *S3Backend) List(prefix string) ([]string, error) {
 	defer metrics.MeasureSince([]string{"s3", "list"}, time.Now())
 
-	resp, err := s.client.ListObjects(&s3.ListObjectsInput{
-		Bucket: aws.String(s.bucket),
-		Prefix: aws.String(prefix),
-	})
-	if err != nil {
-		return nil, err
-	}
-	if resp == nil {
-		return nil, fmt.Errorf("nil response from S3 but no error")
-	}
-
 	keys := []string{}
-	for _, key := range resp.Contents {
-		key := strings.TrimPrefix(*key.Key, prefix)
-
-		if i := strings.Index(key, "/"); i == -1 {
-			// Add objects only from the current 'folder'
-			keys = append(keys, key)
-		} else if i != -1 {
+	err := s.client.ListObjectsPages(&s3.ListObjectsInput{
+		Bucket:    aws.String(s.bucket),
+		Prefix:    aws.String(prefix),
+		Delimiter: aws.String("/"),
+	}, func(page *s3.ListObjectsOutput, lastPage bool) bool {
+		for _, commonPrefix := range page.CommonPrefixes {
 			// Add truncated 'folder' paths
-			keys = appendIfMissing(keys, key[:i+1])
+			keys = appendIfMissing(keys, strings.TrimPrefix(*commonPrefix.Prefix, prefix))
+		}
+		for _, key := range page.Contents {
+			// Add objects only from the current 'folder'
+			keys = append(keys, strings.TrimPrefix(*key.Key, prefix))
 		}
+		return true
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	sort.Strings(keys)
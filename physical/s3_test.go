@@ -1,10 +1,17 @@
 package physical
 
 import (
+	"encoding/xml"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -88,3 +95,193 @@ func TestS3Backend(t *testing.T) {
 	testBackend_ListPrefix(t, b)
 
 }
+
+func TestS3Backend_Compatible(t *testing.T) {
+	fake := newFakeS3("vault")
+	ts := httptest.NewServer(fake)
+	defer ts.Close()
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	conf := map[string]string{
+		"access_key":          "access",
+		"secret_key":          "secret",
+		"bucket":              "vault",
+		"endpoint":            ts.URL,
+		"s3_force_path_style": "true",
+		"kms_key_id":          "alias/vault",
+	}
+	b, err := NewBackend("s3", logger, conf)
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+
+	// A failed request is retried
+	fake.failNext(2)
+
+	testBackend(t, b)
+	testBackend_ListPrefix(t, b)
+
+	fake.Lock()
+	if fake.sse != "aws:kms" || fake.kmsKeyID != "alias/vault" {
+		t.Fatalf("bad encryption: %q %q", fake.sse, fake.kmsKeyID)
+	}
+	if fake.failures != 0 {
+		t.Fatalf("requests not retried")
+	}
+	fake.Unlock()
+
+	// Listings span several pages
+	for i := 0; i < 10; i++ {
+		if err := b.Put(&Entry{Key: fmt.Sprintf("page/%02d", i)}); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+		if err := b.Put(&Entry{Key: fmt.Sprintf("page/%02d/sub", i)}); err != nil {
+			t.Fatalf("err: %s", err)
+		}
+	}
+	keys, err := b.List("page/")
+	if err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	if len(keys) != 20 || keys[0] != "00" || keys[1] != "00/" {
+		t.Fatalf("bad: %v", keys)
+	}
+
+	for _, bad := range []map[string]string{
+		{"server_side_encryption": "AES256", "kms_key_id": "alias/vault"},
+		{"server_side_encryption": "none"},
+		{"s3_force_path_style": "maybe"},
+		{"max_retries": "-1"},
+	} {
+		c := map[string]string{"bucket": "vault", "endpoint": ts.URL}
+		for k, v := range bad {
+			c[k] = v
+		}
+		if _, err := NewBackend("s3", logger, c); err == nil {
+			t.Fatalf("expected error for %v", bad)
+		}
+	}
+}
+
+// fakeS3 is an S3-compatible store serving a single bucket with path-style
+// addressing, and listing two entries per page
+type fakeS3 struct {
+	sync.Mutex
+	bucket   string
+	objects  map[string][]byte
+	failures int
+
+	// sse and kmsKeyID are the encryption headers of the last upload
+	sse      string
+	kmsKeyID string
+}
+
+func newFakeS3(bucket string) *fakeS3 {
+	return &fakeS3{bucket: bucket, objects: make(map[string][]byte)}
+}
+
+func (f *fakeS3) failNext(n int) {
+	f.Lock()
+	defer f.Unlock()
+	f.failures = n
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+
+	if !strings.HasPrefix(r.URL.Path, "/"+f.bucket) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	key := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/"+f.bucket), "/")
+
+	if f.failures > 0 && key != "" {
+		f.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(`<Error><Code>SlowDown</Code><Message>Slow down</Message></Error>`))
+		return
+	}
+
+	switch {
+	case r.Method == "HEAD" && key == "":
+	case r.Method == "GET" && key == "":
+		f.list(w, r)
+	case r.Method == "PUT":
+		buf, _ := ioutil.ReadAll(r.Body)
+		f.objects[key] = buf
+		f.sse = r.Header.Get("X-Amz-Server-Side-Encryption")
+		f.kmsKeyID = r.Header.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id")
+	case r.Method == "GET":
+		value, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`<Error><Code>NoSuchKey</Code><Message>Not found</Message></Error>`))
+			return
+		}
+		w.Write(value)
+	case r.Method == "DELETE":
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3) list(w http.ResponseWriter, r *http.Request) {
+	prefix := r.URL.Query().Get("prefix")
+	delimiter := r.URL.Query().Get("delimiter")
+	marker := r.URL.Query().Get("marker")
+
+	// Objects and common prefixes are listed together, in order
+	seen := make(map[string]bool)
+	var items []string
+	for key := range f.objects {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		item := key
+		if i := strings.Index(key[len(prefix):], delimiter); delimiter != "" && i != -1 {
+			item = key[:len(prefix)+i+1]
+		}
+		if item > marker && !seen[item] {
+			seen[item] = true
+			items = append(items, item)
+		}
+	}
+	sort.Strings(items)
+
+	type content struct {
+		Key string
+	}
+	type commonPrefix struct {
+		Prefix string
+	}
+	result := struct {
+		XMLName        xml.Name `xml:"ListBucketResult"`
+		Name           string
+		Prefix         string
+		IsTruncated    bool
+		NextMarker     string         `xml:",omitempty"`
+		Contents       []content      `xml:",omitempty"`
+		CommonPrefixes []commonPrefix `xml:",omitempty"`
+	}{
+		Name:   f.bucket,
+		Prefix: prefix,
+	}
+	if len(items) > 2 {
+		items = items[:2]
+		result.IsTruncated = true
+		result.NextMarker = items[1]
+	}
+	for _, item := range items {
+		if delimiter != "" && strings.HasSuffix(item, delimiter) {
+			result.CommonPrefixes = append(result.CommonPrefixes, commonPrefix{Prefix: item})
+		} else {
+			result.Contents = append(result.Contents, content{Key: item})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	xml.NewEncoder(w).Encode(result)
+}
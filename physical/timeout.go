@@ -0,0 +1,274 @@
+package physical
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+)
+
+const (
+	// DefaultRetryBudgetRatio is used if no retry budget ratio is specified
+	// for NewTimeoutBackend
+	DefaultRetryBudgetRatio = 0.1
+
+	// DefaultBreakerCooldown is used if no cooldown is specified for
+	// NewTimeoutBackend
+	DefaultBreakerCooldown = 10 * time.Second
+
+	// timeoutRetryBudgetMax is the number of retries the budget can hold,
+	// so that a burst of failures after a quiet period is not retried
+	// without limit
+	timeoutRetryBudgetMax = 10
+)
+
+var (
+	// ErrTimeout is returned if an operation takes longer than the timeout
+	ErrTimeout = errors.New("storage operation timed out")
+
+	// ErrCircuitOpen is returned without calling the backend while the
+	// circuit breaker is open
+	ErrCircuitOpen = errors.New("storage circuit breaker is open")
+)
+
+// timeoutRetryBackoff is the wait before the first retry, doubled for
+// each retry after it
+var timeoutRetryBackoff = 100 * time.Millisecond
+
+// TimeoutConfig configures a TimeoutBackend. Every limit is disabled if
+// zero.
+type TimeoutConfig struct {
+	// Timeout is how long an operation can take before it fails with
+	// ErrTimeout. The backend call itself cannot be interrupted and keeps
+	// running in the background.
+	Timeout time.Duration
+
+	// MaxRetries is the number of times a failed read or list is retried.
+	// Writes and deletes are never retried, since a timed out write may
+	// still complete after a later one.
+	MaxRetries int
+
+	// RetryBudgetRatio is the number of retries earned by each operation,
+	// which limits retries to this share of the operations. Defaults to
+	// DefaultRetryBudgetRatio.
+	RetryBudgetRatio float64
+
+	// BreakerThreshold is the number of consecutive failed operations after
+	// which the circuit breaker opens and operations fail fast
+	BreakerThreshold int
+
+	// BreakerCooldown is how long the circuit breaker stays open before a
+	// single operation is let through to test the backend. Defaults to
+	// DefaultBreakerCooldown.
+	BreakerCooldown time.Duration
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// TimeoutBackend is used to wrap an underlying physical backend so that a
+// hung or failing backend makes its operations fail quickly instead of
+// holding up every request waiting on storage.
+type TimeoutBackend struct {
+	backend Backend
+	config  TimeoutConfig
+	logger  *log.Logger
+
+	// l protects the retry budget and the state of the circuit breaker
+	l           sync.Mutex
+	retryBudget float64
+	failures    int
+	state       breakerState
+	openedAt    time.Time
+}
+
+// NewTimeoutBackend returns a physical backend enforcing the given limits
+// on the operations of the backend
+func NewTimeoutBackend(b Backend, config *TimeoutConfig, logger *log.Logger) *TimeoutBackend {
+	t := &TimeoutBackend{
+		backend:     b,
+		config:      *config,
+		logger:      logger,
+		retryBudget: timeoutRetryBudgetMax,
+	}
+	if t.config.RetryBudgetRatio <= 0 {
+		t.config.RetryBudgetRatio = DefaultRetryBudgetRatio
+	}
+	if t.config.BreakerCooldown <= 0 {
+		t.config.BreakerCooldown = DefaultBreakerCooldown
+	}
+	return t
+}
+
+// Degraded returns whether the circuit breaker is open, so that operations
+// fail without reaching the backend
+func (t *TimeoutBackend) Degraded() bool {
+	t.l.Lock()
+	defer t.l.Unlock()
+	return t.state != breakerClosed
+}
+
+func (t *TimeoutBackend) Put(entry *Entry) error {
+	_, err := t.do(false, func() (interface{}, error) {
+		return nil, t.backend.Put(entry)
+	})
+	return err
+}
+
+func (t *TimeoutBackend) Get(key string) (*Entry, error) {
+	raw, err := t.do(true, func() (interface{}, error) {
+		return t.backend.Get(key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return raw.(*Entry), nil
+}
+
+func (t *TimeoutBackend) Delete(key string) error {
+	_, err := t.do(false, func() (interface{}, error) {
+		return nil, t.backend.Delete(key)
+	})
+	return err
+}
+
+func (t *TimeoutBackend) List(prefix string) ([]string, error) {
+	raw, err := t.do(true, func() (interface{}, error) {
+		return t.backend.List(prefix)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return raw.([]string), nil
+}
+
+func (t *TimeoutBackend) Transaction(txns []*TxnEntry) error {
+	_, err := t.do(false, func() (interface{}, error) {
+		return nil, Transaction(t.backend, txns)
+	})
+	return err
+}
+
+// do runs the operation through the circuit breaker, retrying it within
+// the budget if it may be retried
+func (t *TimeoutBackend) do(retryable bool, op func() (interface{}, error)) (interface{}, error) {
+	t.l.Lock()
+	t.retryBudget += t.config.RetryBudgetRatio
+	if t.retryBudget > timeoutRetryBudgetMax {
+		t.retryBudget = timeoutRetryBudgetMax
+	}
+	t.l.Unlock()
+
+	backoff := timeoutRetryBackoff
+	for attempt := 0; ; attempt++ {
+		if err := t.allow(); err != nil {
+			return nil, err
+		}
+		result, err := t.run(op)
+		t.record(err)
+		if err == nil {
+			return result, nil
+		}
+		if !retryable || attempt >= t.config.MaxRetries || !t.takeRetry() {
+			return nil, err
+		}
+
+		metrics.IncrCounter([]string{"physical", "retry"}, 1)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// run calls the operation, giving up on it after the timeout
+func (t *TimeoutBackend) run(op func() (interface{}, error)) (interface{}, error) {
+	if t.config.Timeout <= 0 {
+		return op()
+	}
+
+	type result struct {
+		value interface{}
+		err   error
+	}
+
+	// The channel is buffered so that an abandoned operation does not
+	// block once it completes
+	doneCh := make(chan result, 1)
+	go func() {
+		value, err := op()
+		doneCh <- result{value, err}
+	}()
+
+	timer := time.NewTimer(t.config.Timeout)
+	defer timer.Stop()
+	select {
+	case r := <-doneCh:
+		return r.value, r.err
+	case <-timer.C:
+		metrics.IncrCounter([]string{"physical", "timeout"}, 1)
+		return nil, ErrTimeout
+	}
+}
+
+// takeRetry takes a retry from the budget, returning false if it is spent
+func (t *TimeoutBackend) takeRetry() bool {
+	t.l.Lock()
+	defer t.l.Unlock()
+	if t.retryBudget < 1 {
+		return false
+	}
+	t.retryBudget--
+	return true
+}
+
+// allow returns ErrCircuitOpen if the operation must not reach the
+// backend. Once the cooldown is over, a single operation is let through
+// and the others are refused until its result is known.
+func (t *TimeoutBackend) allow() error {
+	t.l.Lock()
+	defer t.l.Unlock()
+	switch {
+	case t.state == breakerClosed:
+		return nil
+	case t.state == breakerOpen && time.Since(t.openedAt) >= t.config.BreakerCooldown:
+		t.state = breakerHalfOpen
+		return nil
+	}
+	metrics.IncrCounter([]string{"physical", "circuit_open"}, 1)
+	return ErrCircuitOpen
+}
+
+// record updates the circuit breaker with the result of an operation
+func (t *TimeoutBackend) record(err error) {
+	t.l.Lock()
+	defer t.l.Unlock()
+
+	if err == nil {
+		if t.state != breakerClosed && t.logger != nil {
+			t.logger.Printf("[INFO]: physical: storage recovered, closing the circuit breaker")
+		}
+		t.state = breakerClosed
+		t.failures = 0
+		return
+	}
+
+	t.failures++
+	switch {
+	case t.state == breakerHalfOpen:
+	case t.state == breakerClosed && t.config.BreakerThreshold > 0 && t.failures >= t.config.BreakerThreshold:
+	default:
+		return
+	}
+	if t.logger != nil {
+		t.logger.Printf("[ERR]: physical: opening the circuit breaker for %s after %d consecutive failures: %v",
+			t.config.BreakerCooldown, t.failures, err)
+	}
+	t.state = breakerOpen
+	t.openedAt = time.Now()
+}
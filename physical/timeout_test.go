@@ -0,0 +1,138 @@
+package physical
+
+import (
+	"errors"
+	"log"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// faultyBackend is a backend whose operations hang or fail on demand
+type faultyBackend struct {
+	Backend
+	hang  chan struct{}
+	fail  int32
+	calls int32
+}
+
+func (f *faultyBackend) Get(key string) (*Entry, error) {
+	atomic.AddInt32(&f.calls, 1)
+	if f.hang != nil {
+		<-f.hang
+	}
+	if atomic.LoadInt32(&f.fail) != 0 {
+		return nil, errors.New("unavailable")
+	}
+	return f.Backend.Get(key)
+}
+
+func TestTimeoutBackend(t *testing.T) {
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	inm := NewInmem(logger)
+	b := NewTimeoutBackend(inm, &TimeoutConfig{
+		Timeout:          time.Second,
+		MaxRetries:       2,
+		BreakerThreshold: 5,
+	}, logger)
+	testBackend(t, b)
+	testBackend_ListPrefix(t, b)
+	testTransactionalBackend(t, b)
+}
+
+func TestTimeoutBackend_Timeout(t *testing.T) {
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	faulty := &faultyBackend{Backend: NewInmem(logger), hang: make(chan struct{})}
+	defer close(faulty.hang)
+	b := NewTimeoutBackend(faulty, &TimeoutConfig{
+		Timeout:          10 * time.Millisecond,
+		BreakerThreshold: 2,
+		BreakerCooldown:  time.Hour,
+	}, logger)
+
+	for i := 0; i < 2; i++ {
+		if _, err := b.Get("foo"); err != ErrTimeout {
+			t.Fatalf("expected timeout, got %v", err)
+		}
+	}
+
+	// The breaker is open, so the backend is not called anymore
+	if !b.Degraded() {
+		t.Fatalf("expected degraded backend")
+	}
+	if _, err := b.Get("foo"); err != ErrCircuitOpen {
+		t.Fatalf("expected open circuit, got %v", err)
+	}
+	if calls := atomic.LoadInt32(&faulty.calls); calls != 2 {
+		t.Fatalf("bad: %d calls", calls)
+	}
+}
+
+func TestTimeoutBackend_Breaker(t *testing.T) {
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	faulty := &faultyBackend{Backend: NewInmem(logger), fail: 1}
+	b := NewTimeoutBackend(faulty, &TimeoutConfig{
+		BreakerThreshold: 3,
+		BreakerCooldown:  50 * time.Millisecond,
+	}, logger)
+
+	for i := 0; i < 3; i++ {
+		if _, err := b.Get("foo"); err == nil || err == ErrCircuitOpen {
+			t.Fatalf("expected backend error, got %v", err)
+		}
+	}
+	if _, err := b.Get("foo"); err != ErrCircuitOpen {
+		t.Fatalf("expected open circuit, got %v", err)
+	}
+
+	// After the cooldown a failed trial opens the breaker again
+	time.Sleep(50 * time.Millisecond)
+	if _, err := b.Get("foo"); err == nil || err == ErrCircuitOpen {
+		t.Fatalf("expected backend error, got %v", err)
+	}
+	if _, err := b.Get("foo"); err != ErrCircuitOpen {
+		t.Fatalf("expected open circuit, got %v", err)
+	}
+
+	// A successful trial closes it
+	atomic.StoreInt32(&faulty.fail, 0)
+	time.Sleep(50 * time.Millisecond)
+	if _, err := b.Get("foo"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if b.Degraded() {
+		t.Fatalf("expected healthy backend")
+	}
+}
+
+func TestTimeoutBackend_RetryBudget(t *testing.T) {
+	backoff := timeoutRetryBackoff
+	timeoutRetryBackoff = time.Millisecond
+	defer func() {
+		timeoutRetryBackoff = backoff
+	}()
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	faulty := &faultyBackend{Backend: NewInmem(logger), fail: 1}
+	b := NewTimeoutBackend(faulty, &TimeoutConfig{
+		MaxRetries: 3,
+	}, logger)
+
+	// The budget starts full and each failed read is retried until it
+	// is spent
+	for i := 0; i < 9; i++ {
+		b.Get("foo")
+	}
+	if calls := atomic.LoadInt32(&faulty.calls); calls != 9+timeoutRetryBudgetMax {
+		t.Fatalf("bad: %d calls", calls)
+	}
+
+	// Once it is spent, failed reads are not retried until operations earn
+	// a retry again
+	atomic.StoreInt32(&faulty.calls, 0)
+	b.Get("foo")
+	if calls := atomic.LoadInt32(&faulty.calls); calls != 1 {
+		t.Fatalf("bad: %d calls", calls)
+	}
+}
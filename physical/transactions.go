@@ -0,0 +1,107 @@
+package physical
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// Operation is the type of an operation of a transaction
+type Operation string
+
+const (
+	PutOperation    Operation = "put"
+	DeleteOperation Operation = "delete"
+)
+
+// TxnEntry is an operation of a transaction. Only the key of the entry is
+// used by a delete.
+type TxnEntry struct {
+	Operation Operation
+	Entry     *Entry
+}
+
+// Transactional is an optional interface for backends that can apply
+// several puts and deletes atomically, so that either all of them or none
+// are applied.
+type Transactional interface {
+	// Transaction applies the operations in order, atomically
+	Transaction(txns []*TxnEntry) error
+}
+
+// Transaction applies the operations atomically if the backend is
+// Transactional, or one by one otherwise, undoing the operations already
+// applied if one fails.
+func Transaction(b Backend, txns []*TxnEntry) error {
+	if t, ok := b.(Transactional); ok {
+		return t.Transaction(txns)
+	}
+	return GenericTransactionHandler(b, txns)
+}
+
+// GenericTransactionHandler applies the operations one by one on a backend
+// without transactions. If one fails, the previous values of the keys
+// already written are restored as far as possible, which makes a partial
+// write unlikely but not impossible.
+func GenericTransactionHandler(b Backend, txns []*TxnEntry) error {
+	if err := validateTxns(txns); err != nil {
+		return err
+	}
+
+	// Read the current values first, to be able to undo the operations
+	previous := make([]*Entry, len(txns))
+	for i, txn := range txns {
+		entry, err := b.Get(txn.Entry.Key)
+		if err != nil {
+			return err
+		}
+		previous[i] = entry
+	}
+
+	for i, txn := range txns {
+		var err error
+		switch txn.Operation {
+		case PutOperation:
+			err = b.Put(txn.Entry)
+		case DeleteOperation:
+			err = b.Delete(txn.Entry.Key)
+		}
+		if err == nil {
+			continue
+		}
+
+		// Undo in reverse order, so that a key written twice gets the value
+		// it had before the transaction
+		var retErr *multierror.Error
+		retErr = multierror.Append(retErr, err)
+		for j := i - 1; j >= 0; j-- {
+			var undoErr error
+			if previous[j] == nil {
+				undoErr = b.Delete(txns[j].Entry.Key)
+			} else {
+				undoErr = b.Put(previous[j])
+			}
+			if undoErr != nil {
+				retErr = multierror.Append(retErr, fmt.Errorf("failed to roll back %s of %s: %v",
+					txns[j].Operation, txns[j].Entry.Key, undoErr))
+			}
+		}
+		return retErr.ErrorOrNil()
+	}
+	return nil
+}
+
+// validateTxns checks the operations of a transaction before any is applied
+func validateTxns(txns []*TxnEntry) error {
+	for _, txn := range txns {
+		if txn == nil || txn.Entry == nil {
+			return fmt.Errorf("transaction operation without an entry")
+		}
+		switch txn.Operation {
+		case PutOperation, DeleteOperation:
+		default:
+			return fmt.Errorf("unknown transaction operation %q", txn.Operation)
+		}
+	}
+	return nil
+}
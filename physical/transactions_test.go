@@ -0,0 +1,59 @@
+package physical
+
+import (
+	"errors"
+	"log"
+	"os"
+	"testing"
+)
+
+// failingPutBackend is a backend without transactions failing the puts of
+// one key
+type failingPutBackend struct {
+	Backend
+	failKey string
+}
+
+func (f *failingPutBackend) Put(entry *Entry) error {
+	if entry.Key == f.failKey {
+		return errors.New("unavailable")
+	}
+	return f.Backend.Put(entry)
+}
+
+func TestGenericTransactionHandler(t *testing.T) {
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	b := &failingPutBackend{Backend: NewInmem(logger)}
+	testBackend(t, b)
+
+	if err := GenericTransactionHandler(b, []*TxnEntry{
+		{Operation: PutOperation, Entry: &Entry{Key: "foo", Value: []byte("foo")}},
+		{Operation: PutOperation, Entry: &Entry{Key: "bar", Value: []byte("bar")}},
+	}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// A failed operation undoes those applied before it
+	b.failKey = "baz"
+	err := GenericTransactionHandler(b, []*TxnEntry{
+		{Operation: PutOperation, Entry: &Entry{Key: "foo", Value: []byte("new")}},
+		{Operation: DeleteOperation, Entry: &Entry{Key: "bar"}},
+		{Operation: PutOperation, Entry: &Entry{Key: "new", Value: []byte("new")}},
+		{Operation: PutOperation, Entry: &Entry{Key: "baz", Value: []byte("baz")}},
+	})
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	for key, value := range map[string]string{"foo": "foo", "bar": "bar"} {
+		out, err := b.Get(key)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if out == nil || string(out.Value) != value {
+			t.Fatalf("bad %s: %#v", key, out)
+		}
+	}
+	if out, _ := b.Get("new"); out != nil {
+		t.Fatalf("expected key to be removed")
+	}
+}
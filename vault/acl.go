@@ -2,6 +2,7 @@ package vault
 
 import (
 	"github.com/armon/go-radix"
+	"github.com/hashicorp/vault/helper/policyutil"
 	"github.com/hashicorp/vault/logical"
 )
 
@@ -14,6 +15,10 @@ type ACL struct {
 	// globRules contains the path policies that glob
 	globRules *radix.Tree
 
+	// segmentRules contains the path policies with segment wildcards,
+	// keyed by path
+	segmentRules map[string]*segmentRule
+
 	// root is enabled if the "root" named policy is present.
 	root bool
 }
@@ -22,9 +27,10 @@ type ACL struct {
 func NewACL(policies []*Policy) (*ACL, error) {
 	// Initialize
 	a := &ACL{
-		exactRules: radix.New(),
-		globRules:  radix.New(),
-		root:       false,
+		exactRules:   radix.New(),
+		globRules:    radix.New(),
+		segmentRules: make(map[string]*segmentRule),
+		root:         false,
 	}
 
 	// Inject each policy
@@ -38,6 +44,24 @@ func NewACL(policies []*Policy) (*ACL, error) {
 			a.root = true
 		}
 		for _, pc := range policy.Paths {
+			rule := &aclRule{
+				capabilities: pc.CapabilitiesBitmap,
+				permissions:  pc.Permissions,
+			}
+
+			// Patterns are kept apart from the trees
+			if pc.Pattern != nil {
+				if existing, ok := a.segmentRules[pc.Prefix]; ok {
+					existing.rule = mergeRules(existing.rule, rule)
+				} else {
+					a.segmentRules[pc.Prefix] = &segmentRule{
+						pattern: pc.Pattern,
+						rule:    rule,
+					}
+				}
+				continue
+			}
+
 			// Check which tree to use
 			tree := a.exactRules
 			if pc.Glob {
@@ -47,53 +71,110 @@ func NewACL(policies []*Policy) (*ACL, error) {
 			// Check for an existing policy
 			raw, ok := tree.Get(pc.Prefix)
 			if !ok {
-				tree.Insert(pc.Prefix, pc.CapabilitiesBitmap)
+				tree.Insert(pc.Prefix, rule)
 				continue
 			}
-			existing := raw.(uint32)
+			tree.Insert(pc.Prefix, mergeRules(raw.(*aclRule), rule))
+		}
+	}
+	return a, nil
+}
 
-			switch {
-			case existing&DenyCapabilityInt > 0:
-				// If we are explicitly denied in the existing capability set,
-				// don't save anything else
+// aclRule is the combination of the policies for a path
+type aclRule struct {
+	capabilities uint32
 
-			case pc.CapabilitiesBitmap&DenyCapabilityInt > 0:
-				// If this new policy explicitly denies, only save the deny value
-				tree.Insert(pc.Prefix, DenyCapabilityInt)
+	// permissions restricts the parameters of writes, or is nil
+	permissions *PathPermissions
+}
 
-			default:
-				// Insert the capabilities in this new policy into the existing
-				// value
-				tree.Insert(pc.Prefix, existing|pc.CapabilitiesBitmap)
-			}
-		}
+// segmentRule is a path policy with segment wildcards
+type segmentRule struct {
+	pattern *policyutil.PathPattern
+	rule    *aclRule
+}
+
+// mergeRules combines the rules of two policies for the same path
+func mergeRules(existing, new *aclRule) *aclRule {
+	capabilities := mergeCapabilities(existing.capabilities, new.capabilities)
+	if capabilities&DenyCapabilityInt > 0 {
+		return &aclRule{capabilities: capabilities}
+	}
+	return &aclRule{
+		capabilities: capabilities,
+		permissions:  mergePathPermissions(existing.permissions, new.permissions),
 	}
-	return a, nil
 }
 
-func (a *ACL) Capabilities(path string) (pathCapabilities []string) {
-	// Fast-path root
-	if a.root {
-		return []string{RootCapability}
+// mergeCapabilities combines the capabilities of two policies for the same
+// path
+func mergeCapabilities(existing, new uint32) uint32 {
+	switch {
+	case existing&DenyCapabilityInt > 0:
+		// If we are explicitly denied in the existing capability set,
+		// don't save anything else
+		return existing
+
+	case new&DenyCapabilityInt > 0:
+		// If this new policy explicitly denies, only save the deny value
+		return DenyCapabilityInt
+
+	default:
+		// Insert the capabilities in this new policy into the existing
+		// value
+		return existing | new
 	}
+}
 
+// matchRule returns the rule matching the path: an exact rule if there is
+// one, otherwise the glob or segment wildcard rule with the highest
+// precedence
+func (a *ACL) matchRule(path string) (*aclRule, bool) {
 	// Find an exact matching rule, look for glob if no match
-	var capabilities uint32
 	raw, ok := a.exactRules.Get(path)
 	if ok {
-		capabilities = raw.(uint32)
-		goto CHECK
+		return raw.(*aclRule), true
+	}
+
+	var best *policyutil.PathPattern
+	var rule *aclRule
+	prefix, raw, ok := a.globRules.LongestPrefix(path)
+	if ok {
+		rule = raw.(*aclRule)
+		if len(a.segmentRules) == 0 {
+			return rule, true
+		}
+		best, _ = policyutil.ParsePathPattern(prefix + policyutil.GlobWildcard)
+		if best == nil {
+			// Not expressible as a pattern, so no pattern can be more
+			// specific
+			return rule, true
+		}
+	}
+
+	for _, segment := range a.segmentRules {
+		if segment.pattern.Match(path) && (best == nil || policyutil.ComparePathPatterns(segment.pattern, best) > 0) {
+			best = segment.pattern
+			rule = segment.rule
+		}
+	}
+
+	return rule, best != nil
+}
+
+func (a *ACL) Capabilities(path string) (pathCapabilities []string) {
+	// Fast-path root
+	if a.root {
+		return []string{RootCapability}
 	}
 
-	// Find a glob rule, default deny if no match
-	_, raw, ok = a.globRules.LongestPrefix(path)
+	// Find a matching rule, default deny if no match
+	rule, ok := a.matchRule(path)
 	if !ok {
 		return []string{DenyCapability}
-	} else {
-		capabilities = raw.(uint32)
 	}
+	capabilities := rule.capabilities
 
-CHECK:
 	if capabilities&SudoCapabilityInt > 0 {
 		pathCapabilities = append(pathCapabilities, SudoCapability)
 	}
@@ -112,6 +193,9 @@ CHECK:
 	if capabilities&CreateCapabilityInt > 0 {
 		pathCapabilities = append(pathCapabilities, CreateCapability)
 	}
+	if capabilities&PatchCapabilityInt > 0 {
+		pathCapabilities = append(pathCapabilities, PatchCapability)
+	}
 
 	// If "deny" is explicitly set or if the path has no capabilities at all,
 	// set the path capabilities to "deny"
@@ -121,37 +205,72 @@ CHECK:
 	return
 }
 
+// ControlGroup returns the control group holding the requests to the
+// path, or nil
+func (a *ACL) ControlGroup(path string) *ControlGroup {
+	if a.root {
+		return nil
+	}
+	rule, ok := a.matchRule(path)
+	if !ok || rule.permissions == nil {
+		return nil
+	}
+	return rule.permissions.ControlGroup
+}
+
 // AllowOperation is used to check if the given operation is permitted. The
 // first bool indicates if an op is allowed, the second whether sudo priviliges
-// exist for that op and path.
+// exist for that op and path. The parameters of the operation are not
+// checked; see AllowRequest.
 func (a *ACL) AllowOperation(op logical.Operation, path string) (allowed bool, sudo bool) {
+	allowed, sudo, _ = a.allowOperation(op, path)
+	return
+}
+
+// AllowRequest is used to check if the given request is permitted, including
+// the parameters it writes and the wrapping of its response. The first bool indicates if the request is
+// allowed, the second whether sudo priviliges exist for its operation and
+// path.
+func (a *ACL) AllowRequest(req *logical.Request) (allowed bool, sudo bool) {
+	allowed, sudo, rule := a.allowOperation(req.Operation, req.Path)
+	if !allowed || rule == nil || rule.permissions == nil {
+		return
+	}
+
+	if !rule.permissions.allowsWrapping(req.WrapTTL) {
+		return false, sudo
+	}
+
+	// Only writes are restricted by parameters
+	switch req.Operation {
+	case logical.CreateOperation, logical.UpdateOperation, logical.PatchOperation:
+		if !rule.permissions.allows(req.Data) {
+			return false, sudo
+		}
+	}
+	return
+}
+
+// allowOperation checks if the given operation is permitted, and returns
+// the rule matching the path, if any
+func (a *ACL) allowOperation(op logical.Operation, path string) (allowed bool, sudo bool, rule *aclRule) {
 	// Fast-path root
 	if a.root {
-		return true, true
+		return true, true, nil
 	}
 
 	// Help is always allowed
 	if op == logical.HelpOperation {
-		return true, false
-	}
-
-	// Find an exact matching rule, look for glob if no match
-	var capabilities uint32
-	raw, ok := a.exactRules.Get(path)
-	if ok {
-		capabilities = raw.(uint32)
-		goto CHECK
+		return true, false, nil
 	}
 
-	// Find a glob rule, default deny if no match
-	_, raw, ok = a.globRules.LongestPrefix(path)
+	// Find a matching rule, default deny if no match
+	rule, ok := a.matchRule(path)
 	if !ok {
-		return false, false
-	} else {
-		capabilities = raw.(uint32)
+		return false, false, nil
 	}
+	capabilities := rule.capabilities
 
-CHECK:
 	// Check if the minimum permissions are met
 	// If "deny" has been explicitly set, only deny will be in the map, so we
 	// only need to check for the existence of other values
@@ -167,13 +286,15 @@ CHECK:
 		allowed = capabilities&DeleteCapabilityInt > 0
 	case logical.CreateOperation:
 		allowed = capabilities&CreateCapabilityInt > 0
+	case logical.PatchOperation:
+		allowed = capabilities&PatchCapabilityInt > 0
 
 	// These three re-use UpdateCapabilityInt since that's the most appropriate capability/operation mapping
 	case logical.RevokeOperation, logical.RenewOperation, logical.RollbackOperation:
 		allowed = capabilities&UpdateCapabilityInt > 0
 
 	default:
-		return false, false
+		return false, false, nil
 	}
 	return
 }
@@ -3,6 +3,7 @@ package vault
 import (
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/vault/logical"
 )
@@ -199,6 +200,60 @@ func testLayeredACL(t *testing.T, acl *ACL) {
 	}
 }
 
+func TestACL_SegmentWildcards(t *testing.T) {
+	policy1, err := Parse(segmentPolicy1)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	policy2, err := Parse(segmentPolicy2)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	acl, err := NewACL([]*Policy{policy1, policy2})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	type tcase struct {
+		path     string
+		expected []string
+	}
+	tcases := []tcase{
+		// Exact paths take precedence over patterns
+		{"secret/admin/config", []string{"sudo", "read"}},
+		// A segment wildcard beats a glob whose wildcard occurs earlier
+		{"secret/app/config", []string{"read", "update"}},
+		{"secret/app/other", []string{"read"}},
+		// A glob whose wildcard occurs later beats the segment wildcard
+		{"secret/team/config", []string{"list"}},
+		// Capabilities for the same pattern are merged across policies
+		{"kv/app/data", []string{"read", "create"}},
+		{"kv/app/data/nested", []string{"deny"}},
+		{"kv/app/denied", []string{"deny"}},
+		// Segment wildcards do not match empty segments
+		{"secret//config", []string{"read"}},
+		{"other/path", []string{"deny"}},
+		// Without segment_wildcards a "+" segment is literal
+		{"literal/+/path", []string{"read"}},
+		{"literal/app/path", []string{"deny"}},
+	}
+	for _, tc := range tcases {
+		actual := acl.Capabilities(tc.path)
+		if !reflect.DeepEqual(actual, tc.expected) {
+			t.Fatalf("bad: path:%s\ngot\n%#v\nexpected\n%#v\n", tc.path, actual, tc.expected)
+		}
+	}
+
+	allowed, _ := acl.AllowOperation(logical.UpdateOperation, "secret/app/config")
+	if !allowed {
+		t.Fatal("expected update to be allowed")
+	}
+	allowed, _ = acl.AllowOperation(logical.ReadOperation, "kv/app/denied")
+	if allowed {
+		t.Fatal("expected read to be denied")
+	}
+}
+
 var tokenCreationPolicy = `
 name = "tokenCreation"
 path "auth/token/create*" {
@@ -255,3 +310,279 @@ path "foo/bar" {
 	capabilities = ["deny"]
 }
 `
+
+var segmentPolicy1 = `
+name = "segment1"
+path "secret/*" {
+	capabilities = ["read"]
+}
+path "secret/+/config" {
+	segment_wildcards = true
+	capabilities = ["read", "update"]
+}
+path "secret/team/*" {
+	capabilities = ["list"]
+}
+path "secret/admin/config" {
+	capabilities = ["read", "sudo"]
+}
+path "kv/+/data" {
+	segment_wildcards = true
+	capabilities = ["read"]
+}
+path "kv/+/denied" {
+	segment_wildcards = true
+	capabilities = ["read"]
+}
+path "literal/+/path" {
+	capabilities = ["read"]
+}
+`
+
+var segmentPolicy2 = `
+name = "segment2"
+path "kv/+/data" {
+	segment_wildcards = true
+	capabilities = ["create"]
+}
+path "kv/+/denied" {
+	segment_wildcards = true
+	capabilities = ["deny"]
+}
+`
+
+func TestACL_Parameters(t *testing.T) {
+	policy1, err := Parse(parameterPolicy1)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	policy2, err := Parse(parameterPolicy2)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	acl, err := NewACL([]*Policy{policy1, policy2})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	type tcase struct {
+		op      logical.Operation
+		path    string
+		data    map[string]interface{}
+		allowed bool
+	}
+	tcases := []tcase{
+		// Only the allowed parameters may be written
+		{logical.UpdateOperation, "db/roles/app", map[string]interface{}{"password": "s3cr3t"}, true},
+		{logical.UpdateOperation, "db/roles/app", map[string]interface{}{"password": "s3cr3t", "username": "root"}, false},
+		// Listed values restrict the value, including within lists
+		{logical.UpdateOperation, "db/roles/app", map[string]interface{}{"password": "a", "ttl": "1h"}, true},
+		{logical.UpdateOperation, "db/roles/app", map[string]interface{}{"password": "a", "ttl": 3600}, true},
+		{logical.UpdateOperation, "db/roles/app", map[string]interface{}{"password": "a", "ttl": "24h"}, false},
+		{logical.UpdateOperation, "db/roles/app", map[string]interface{}{"password": "a", "ttl": []interface{}{"1h", "2h"}}, false},
+		// Required parameters must be present
+		{logical.UpdateOperation, "db/roles/app", map[string]interface{}{"ttl": "1h"}, false},
+		// Reads are not restricted by parameters
+		{logical.ReadOperation, "db/roles/app", nil, true},
+		// The wildcard allows the parameters that are not denied
+		{logical.CreateOperation, "kv/app", map[string]interface{}{"foo": "bar"}, true},
+		{logical.CreateOperation, "kv/app", map[string]interface{}{"admin": "false"}, true},
+		{logical.CreateOperation, "kv/app", map[string]interface{}{"admin": true}, false},
+		// Allowed parameters of several policies are combined, while denied
+		// parameters always apply
+		{logical.UpdateOperation, "secret/shared", map[string]interface{}{"a": "1", "b": "2"}, true},
+		{logical.UpdateOperation, "secret/shared", map[string]interface{}{"c": "3"}, false},
+		{logical.UpdateOperation, "secret/shared", map[string]interface{}{"a": "1", "owner": "me"}, false},
+	}
+	for i, tc := range tcases {
+		req := &logical.Request{
+			Operation: tc.op,
+			Path:      tc.path,
+			Data:      tc.data,
+		}
+		if allowed, _ := acl.AllowRequest(req); allowed != tc.allowed {
+			t.Fatalf("bad: case %d: %#v: %v", i, tc, allowed)
+		}
+	}
+
+	// Operations alone are not checked against parameters
+	if allowed, _ := acl.AllowOperation(logical.UpdateOperation, "db/roles/app"); !allowed {
+		t.Fatal("expected update to be allowed")
+	}
+}
+
+var parameterPolicy1 = `
+name = "parameters1"
+path "db/roles/app" {
+	capabilities = ["read", "update"]
+	allowed_parameters = {
+		"password" = []
+		"ttl" = ["1h", 3600]
+	}
+	required_parameters = ["password"]
+}
+path "kv/*" {
+	capabilities = ["create"]
+	allowed_parameters = {
+		"*" = []
+	}
+	denied_parameters = {
+		"admin" = ["true"]
+	}
+}
+path "secret/shared" {
+	capabilities = ["update"]
+	allowed_parameters = {
+		"a" = []
+	}
+}
+`
+
+var parameterPolicy2 = `
+name = "parameters2"
+path "secret/shared" {
+	capabilities = ["update"]
+	allowed_parameters = {
+		"b" = []
+		"owner" = []
+	}
+	denied_parameters = {
+		"owner" = []
+	}
+}
+`
+
+func TestACL_WrappingTTL(t *testing.T) {
+	policy1, err := Parse(wrappingPolicy1)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	policy2, err := Parse(wrappingPolicy2)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	acl, err := NewACL([]*Policy{policy1, policy2})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	type tcase struct {
+		path    string
+		wrapTTL time.Duration
+		allowed bool
+	}
+	tcases := []tcase{
+		// Responses must be wrapped, within the bounds
+		{"pki/issue/web", 0, false},
+		{"pki/issue/web", 30 * time.Second, false},
+		{"pki/issue/web", 5 * time.Minute, true},
+		{"pki/issue/web", 2 * time.Hour, false},
+		// A minimum alone requires wrapping
+		{"secret/wrapped", 0, false},
+		{"secret/wrapped", 24 * time.Hour, true},
+		// Bounds of several policies are widened, and wrapping stays
+		// required
+		{"secret/shared", 0, false},
+		{"secret/shared", 2 * time.Minute, true},
+		{"secret/shared", 20 * time.Minute, true},
+		{"secret/shared", 2 * time.Hour, false},
+		// Other paths are not affected
+		{"secret/plain", 0, true},
+	}
+	for i, tc := range tcases {
+		req := &logical.Request{
+			Operation: logical.ReadOperation,
+			Path:      tc.path,
+			WrapTTL:   tc.wrapTTL,
+		}
+		if allowed, _ := acl.AllowRequest(req); allowed != tc.allowed {
+			t.Fatalf("bad: case %d: %#v: %v", i, tc, allowed)
+		}
+	}
+}
+
+var wrappingPolicy1 = `
+name = "wrapping1"
+path "pki/issue/*" {
+	capabilities = ["read"]
+	min_wrapping_ttl = "1m"
+	max_wrapping_ttl = 3600
+}
+path "secret/wrapped" {
+	capabilities = ["read"]
+	min_wrapping_ttl = "10s"
+}
+path "secret/shared" {
+	capabilities = ["read"]
+	min_wrapping_ttl = "5m"
+	max_wrapping_ttl = "1h"
+}
+path "secret/plain" {
+	capabilities = ["read"]
+}
+`
+
+var wrappingPolicy2 = `
+name = "wrapping2"
+path "secret/shared" {
+	capabilities = ["read"]
+	min_wrapping_ttl = "1m"
+	max_wrapping_ttl = "30m"
+}
+`
+
+func TestACL_Patch(t *testing.T) {
+	policy, err := Parse(patchPolicy)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	acl, err := NewACL([]*Policy{policy})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	type tcase struct {
+		op      logical.Operation
+		path    string
+		allowed bool
+	}
+	tcases := []tcase{
+		// Patching requires its own capability, distinct from update
+		{logical.PatchOperation, "kv/data/patch", true},
+		{logical.UpdateOperation, "kv/data/patch", false},
+		{logical.PatchOperation, "kv/data/update", false},
+		{logical.UpdateOperation, "kv/data/update", true},
+		// Patches are restricted by parameters as writes are
+		{logical.PatchOperation, "kv/data/restricted", false},
+	}
+	for i, tc := range tcases {
+		req := &logical.Request{
+			Operation: tc.op,
+			Path:      tc.path,
+			Data:      map[string]interface{}{"data": "foo"},
+		}
+		if allowed, _ := acl.AllowRequest(req); allowed != tc.allowed {
+			t.Fatalf("bad: case %d: %#v: %v", i, tc, allowed)
+		}
+	}
+
+	if actual := acl.Capabilities("kv/data/patch"); !reflect.DeepEqual(actual, []string{"read", "patch"}) {
+		t.Fatalf("bad: %#v", actual)
+	}
+}
+
+var patchPolicy = `
+name = "patch"
+path "kv/data/patch" {
+	capabilities = ["read", "patch"]
+}
+path "kv/data/update" {
+	capabilities = ["update"]
+}
+path "kv/data/restricted" {
+	capabilities = ["patch"]
+	denied_parameters = {
+		"data" = []
+	}
+}
+`
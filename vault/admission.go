@@ -0,0 +1,202 @@
+package vault
+
+import (
+	"container/list"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// defaultAdmissionQueueTimeout is how long a request waits in the queue
+	// by default before it is rejected
+	defaultAdmissionQueueTimeout = 5 * time.Second
+)
+
+// admissionClass is the priority class of a request. Lower values have a
+// higher priority.
+type admissionClass int
+
+const (
+	// admissionClassRenew holds lease and token renewals, which keep
+	// existing clients working and so are served first
+	admissionClassRenew admissionClass = iota
+
+	// admissionClassRead holds the requests that do not change anything
+	admissionClassRead
+
+	// admissionClassWrite holds all other requests, including logins
+	admissionClassWrite
+
+	numAdmissionClasses
+)
+
+func (c admissionClass) String() string {
+	switch c {
+	case admissionClassRenew:
+		return "renew"
+	case admissionClassRead:
+		return "read"
+	default:
+		return "write"
+	}
+}
+
+// requestAdmissionClass classifies a request. Health checks are answered by
+// the HTTP layer without entering the core, so they are never held back.
+func requestAdmissionClass(req *logical.Request) admissionClass {
+	switch {
+	case req.Operation == logical.RenewOperation,
+		req.Path == "sys/renew",
+		strings.HasPrefix(req.Path, "sys/renew/"),
+		strings.HasPrefix(req.Path, "auth/token/renew"):
+		return admissionClassRenew
+	case req.Operation == logical.ReadOperation,
+		req.Operation == logical.ListOperation,
+		req.Operation == logical.HelpOperation:
+		return admissionClassRead
+	default:
+		return admissionClassWrite
+	}
+}
+
+// AdmissionControlConfig configures the admission control of requests.
+// Once MaxInFlight requests are being handled, further requests wait in a
+// queue for their class, and are rejected when the queue is full or they
+// have waited for QueueTimeout. Renewals are admitted before reads, and
+// reads before writes.
+type AdmissionControlConfig struct {
+	// MaxInFlight is the number of requests handled at once. Admission
+	// control is disabled if it is zero.
+	MaxInFlight int
+
+	// QueueDepthRenew, QueueDepthRead and QueueDepthWrite are the number of
+	// requests of each class that can wait to be handled. They default to
+	// MaxInFlight; a negative depth disables queueing for the class.
+	QueueDepthRenew int
+	QueueDepthRead  int
+	QueueDepthWrite int
+
+	// QueueTimeout is how long a request can wait. Defaults to five seconds.
+	QueueTimeout time.Duration
+}
+
+// admissionController limits the number of requests handled at once. A nil
+// admissionController admits every request.
+type admissionController struct {
+	maxInFlight  int
+	queueDepths  [numAdmissionClasses]int
+	queueTimeout time.Duration
+
+	l        sync.Mutex
+	inFlight int
+	queues   [numAdmissionClasses]*list.List
+}
+
+func newAdmissionController(conf *AdmissionControlConfig) (*admissionController, error) {
+	if conf == nil || conf.MaxInFlight == 0 {
+		return nil, nil
+	}
+	if conf.MaxInFlight < 0 {
+		return nil, fmt.Errorf("maximum number of in-flight requests cannot be negative")
+	}
+	if conf.QueueTimeout < 0 {
+		return nil, fmt.Errorf("admission queue timeout cannot be negative")
+	}
+
+	a := &admissionController{
+		maxInFlight:  conf.MaxInFlight,
+		queueTimeout: conf.QueueTimeout,
+	}
+	if a.queueTimeout == 0 {
+		a.queueTimeout = defaultAdmissionQueueTimeout
+	}
+	depths := []int{conf.QueueDepthRenew, conf.QueueDepthRead, conf.QueueDepthWrite}
+	for i, depth := range depths {
+		switch {
+		case depth == 0:
+			depth = conf.MaxInFlight
+		case depth < 0:
+			depth = 0
+		}
+		a.queueDepths[i] = depth
+		a.queues[i] = list.New()
+	}
+	return a, nil
+}
+
+// admit waits until a request of the given class can be handled. On
+// success, the returned function must be called once the request is done.
+func (a *admissionController) admit(class admissionClass) (func(), error) {
+	if a == nil {
+		return func() {}, nil
+	}
+
+	a.l.Lock()
+	if a.inFlight < a.maxInFlight {
+		a.inFlight++
+		metrics.SetGauge([]string{"core", "admission", "in_flight"}, float32(a.inFlight))
+		a.l.Unlock()
+		return a.release, nil
+	}
+
+	queue := a.queues[class]
+	if queue.Len() >= a.queueDepths[class] {
+		a.l.Unlock()
+		return nil, a.reject(class, "queue is full")
+	}
+	ready := make(chan struct{})
+	elem := queue.PushBack(ready)
+	a.l.Unlock()
+
+	metrics.IncrCounter([]string{"core", "admission", class.String(), "queued"}, 1)
+	defer metrics.MeasureSince([]string{"core", "admission", class.String(), "queue_time"}, time.Now())
+
+	timer := time.NewTimer(a.queueTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-ready:
+		return a.release, nil
+	case <-timer.C:
+	}
+
+	a.l.Lock()
+	defer a.l.Unlock()
+	select {
+	case <-ready:
+		// Handed a slot while timing out, so use it
+		return a.release, nil
+	default:
+	}
+	queue.Remove(elem)
+	return nil, a.reject(class, "timed out waiting in queue")
+}
+
+// release hands the slot of a finished request over to the highest-priority
+// request that is waiting, if any
+func (a *admissionController) release() {
+	a.l.Lock()
+	defer a.l.Unlock()
+
+	for _, queue := range a.queues {
+		if elem := queue.Front(); elem != nil {
+			queue.Remove(elem)
+			close(elem.Value.(chan struct{}))
+			return
+		}
+	}
+	a.inFlight--
+	metrics.SetGauge([]string{"core", "admission", "in_flight"}, float32(a.inFlight))
+}
+
+func (a *admissionController) reject(class admissionClass, reason string) error {
+	metrics.IncrCounter([]string{"core", "admission", class.String(), "rejected"}, 1)
+	return errutil.WithCode(errutil.CodeOverloaded,
+		fmt.Errorf("Vault is overloaded, %s request rejected: %s", class, reason))
+}
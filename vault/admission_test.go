@@ -0,0 +1,177 @@
+package vault
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestRequestAdmissionClass(t *testing.T) {
+	cases := []struct {
+		op       logical.Operation
+		path     string
+		expected admissionClass
+	}{
+		{logical.UpdateOperation, "sys/renew/foo/bar", admissionClassRenew},
+		{logical.UpdateOperation, "auth/token/renew-self", admissionClassRenew},
+		{logical.RenewOperation, "secret/foo", admissionClassRenew},
+		{logical.ReadOperation, "secret/foo", admissionClassRead},
+		{logical.ListOperation, "secret/", admissionClassRead},
+		{logical.UpdateOperation, "secret/foo", admissionClassWrite},
+		{logical.DeleteOperation, "secret/foo", admissionClassWrite},
+		{logical.UpdateOperation, "auth/userpass/login/foo", admissionClassWrite},
+	}
+	for _, c := range cases {
+		req := &logical.Request{Operation: c.op, Path: c.path}
+		if class := requestAdmissionClass(req); class != c.expected {
+			t.Fatalf("%s %s: expected %s, got %s", c.op, c.path, c.expected, class)
+		}
+	}
+}
+
+func TestAdmissionController_disabled(t *testing.T) {
+	a, err := newAdmissionController(&AdmissionControlConfig{})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if a != nil {
+		t.Fatal("expected admission control to be disabled")
+	}
+	done, err := a.admit(admissionClassWrite)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	done()
+
+	if _, err := newAdmissionController(&AdmissionControlConfig{MaxInFlight: -1}); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestAdmissionController_priority(t *testing.T) {
+	a, err := newAdmissionController(&AdmissionControlConfig{
+		MaxInFlight:  1,
+		QueueTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	done, err := a.admit(admissionClassWrite)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Queue a write, then a renewal, which must be admitted first
+	admitted := make(chan admissionClass, 2)
+	queue := func(class admissionClass) {
+		go func() {
+			done, err := a.admit(class)
+			if err != nil {
+				t.Errorf("err: %v", err)
+				return
+			}
+			admitted <- class
+			done()
+		}()
+	}
+	waitQueued := func(class admissionClass) {
+		for i := 0; i < 100; i++ {
+			a.l.Lock()
+			n := a.queues[class].Len()
+			a.l.Unlock()
+			if n > 0 {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("%s request not queued", class)
+	}
+	queue(admissionClassWrite)
+	waitQueued(admissionClassWrite)
+	queue(admissionClassRenew)
+	waitQueued(admissionClassRenew)
+
+	done()
+	for _, expected := range []admissionClass{admissionClassRenew, admissionClassWrite} {
+		select {
+		case class := <-admitted:
+			if class != expected {
+				t.Fatalf("expected %s, got %s", expected, class)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out")
+		}
+	}
+
+	a.l.Lock()
+	defer a.l.Unlock()
+	if a.inFlight != 0 {
+		t.Fatalf("bad: %d", a.inFlight)
+	}
+}
+
+func TestAdmissionController_reject(t *testing.T) {
+	a, err := newAdmissionController(&AdmissionControlConfig{
+		MaxInFlight:     1,
+		QueueDepthWrite: -1,
+		QueueTimeout:    10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	done, err := a.admit(admissionClassRead)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer done()
+
+	// Writes are not queued at all
+	if _, err := a.admit(admissionClassWrite); errutil.CodeOf(err) != errutil.CodeOverloaded {
+		t.Fatalf("bad: %v", err)
+	}
+
+	// Reads give up once the timeout passes
+	if _, err := a.admit(admissionClassRead); errutil.CodeOf(err) != errutil.CodeOverloaded {
+		t.Fatalf("bad: %v", err)
+	}
+	if n := a.queues[admissionClassRead].Len(); n != 0 {
+		t.Fatalf("bad: %d", n)
+	}
+}
+
+func TestCore_HandleRequest_AdmissionControl(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+	var err error
+	c.admission, err = newAdmissionController(&AdmissionControlConfig{
+		MaxInFlight:     1,
+		QueueDepthWrite: -1,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req := &logical.Request{
+		Operation:   logical.UpdateOperation,
+		Path:        "secret/foo",
+		Data:        map[string]interface{}{"foo": "bar"},
+		ClientToken: root,
+	}
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Take the only slot, so that the next write is shed
+	done, err := c.admission.admit(admissionClassRead)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer done()
+
+	if _, err := c.HandleRequest(req); errutil.CodeOf(err) != errutil.CodeOverloaded {
+		t.Fatalf("bad: %v", err)
+	}
+}
@@ -2,10 +2,13 @@ package vault
 
 import (
 	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"reflect"
 	"strings"
 	"sync"
 	"time"
@@ -76,7 +79,11 @@ func (c *Core) enableAudit(entry *MountEntry) error {
 	view := NewBarrierView(c.barrier, auditBarrierPrefix+entry.UUID+"/")
 
 	// Lookup the new backend
-	backend, err := c.newAuditBackend(entry.Type, view, entry.Options)
+	filter, err := auditFilter(entry)
+	if err != nil {
+		return err
+	}
+	backend, salter, err := c.newAuditBackend(entry.Type, view, entry.Options)
 	if err != nil {
 		return err
 	}
@@ -90,7 +97,7 @@ func (c *Core) enableAudit(entry *MountEntry) error {
 	c.audit = newTable
 
 	// Register the backend
-	c.auditBroker.Register(entry.Path, backend, view)
+	c.auditBroker.Register(entry.Path, backend, view, salter, filter)
 	c.logger.Printf("[INFO] core: enabled audit backend '%s' type: %s",
 		entry.Path, entry.Type)
 	return nil
@@ -238,16 +245,27 @@ func (c *Core) setupAudits() error {
 		view := NewBarrierView(c.barrier, auditBarrierPrefix+entry.UUID+"/")
 
 		// Initialize the backend
-		audit, err := c.newAuditBackend(entry.Type, view, entry.Options)
+		audit, salter, err := c.newAuditBackend(entry.Type, view, entry.Options)
 		if err != nil {
 			c.logger.Printf(
 				"[ERR] core: failed to create audit entry %s: %v",
 				entry.Path, err)
 			return errLoadAuditFailed
 		}
+		filter, err := auditFilter(entry)
+		if err != nil {
+			c.logger.Printf(
+				"[ERR] core: failed to parse the filter of audit entry %s: %v",
+				entry.Path, err)
+			return errLoadAuditFailed
+		}
 
 		// Mount the backend
-		broker.Register(entry.Path, audit, view)
+		broker.Register(entry.Path, audit, view, salter, filter)
+	}
+	broker.namespacePath = func(path string) string {
+		ns, _ := c.resolveNamespace(path)
+		return namespacePath(ns)
 	}
 	c.auditBroker = broker
 	return nil
@@ -259,28 +277,53 @@ func (c *Core) teardownAudits() error {
 	c.auditLock.Lock()
 	defer c.auditLock.Unlock()
 
+	if c.auditBroker != nil {
+		c.auditBroker.closeAll()
+	}
 	c.audit = nil
 	c.auditBroker = nil
 	return nil
 }
 
-// newAuditBackend is used to create and configure a new audit backend by name
-func (c *Core) newAuditBackend(t string, view logical.Storage, conf map[string]string) (audit.Backend, error) {
+// auditFilter parses the filter option of an audit entry, returning nil if
+// the backend logs every request
+func auditFilter(entry *MountEntry) (*audit.Filter, error) {
+	raw := entry.Options["filter"]
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	filter, err := audit.ParseFilter(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter: %v", err)
+	}
+	return filter, nil
+}
+
+// newAuditBackend is used to create and configure a new audit backend by
+// name. The salt the backend hashes values with is returned along with it.
+func (c *Core) newAuditBackend(t string, view logical.Storage, conf map[string]string) (audit.Backend, *salt.Salt, error) {
 	f, ok := c.auditBackends[t]
 	if !ok {
-		return nil, fmt.Errorf("unknown backend type: %s", t)
+		return nil, nil, fmt.Errorf("unknown backend type: %s", t)
 	}
 	salter, err := salt.NewSalt(view, &salt.Config{
 		HMAC:     sha256.New,
 		HMACType: "hmac-sha256",
 	})
 	if err != nil {
-		return nil, fmt.Errorf("[ERR] core: unable to generate salt: %v", err)
+		return nil, nil, fmt.Errorf("[ERR] core: unable to generate salt: %v", err)
 	}
-	return f(&audit.BackendConfig{
+	config := &audit.BackendConfig{
 		Salt:   salter,
 		Config: conf,
-	})
+	}
+	backend, err := f(config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The factory may have replaced the salt
+	return backend, config.Salt, nil
 }
 
 // defaultAuditTable creates a default audit table
@@ -294,6 +337,10 @@ func defaultAuditTable() *MountTable {
 type backendEntry struct {
 	backend audit.Backend
 	view    *BarrierView
+	salt    *salt.Salt
+
+	// filter selects the requests the backend logs, nil for all of them
+	filter *audit.Filter
 }
 
 // AuditBroker is used to provide a single ingest interface to auditable
@@ -302,6 +349,11 @@ type AuditBroker struct {
 	l        sync.RWMutex
 	backends map[string]backendEntry
 	logger   *log.Logger
+
+	// namespacePath returns the path of the namespace of a request path,
+	// for the filters of the backends. Requests are in the root namespace
+	// if it is nil.
+	namespacePath func(path string) string
 }
 
 // NewAuditBroker creates a new audit broker
@@ -313,23 +365,53 @@ func NewAuditBroker(log *log.Logger) *AuditBroker {
 	return b
 }
 
-// Register is used to add new audit backend to the broker
-func (a *AuditBroker) Register(name string, b audit.Backend, v *BarrierView) {
+// Register is used to add new audit backend to the broker, along with the
+// salt it hashes values with and the filter selecting the requests it logs,
+// which is nil if it logs every request
+func (a *AuditBroker) Register(name string, b audit.Backend, v *BarrierView, salter *salt.Salt, filter *audit.Filter) {
 	a.l.Lock()
 	defer a.l.Unlock()
 	a.backends[name] = backendEntry{
 		backend: b,
 		view:    v,
+		salt:    salter,
+		filter:  filter,
 	}
 }
 
-// Deregister is used to remove an audit backend from the broker
+// Deregister is used to remove an audit backend from the broker. Backends
+// holding resources, such as a spool, are closed.
 func (a *AuditBroker) Deregister(name string) {
 	a.l.Lock()
 	defer a.l.Unlock()
+	if be, ok := a.backends[name]; ok {
+		a.closeBackend(name, be.backend)
+	}
 	delete(a.backends, name)
 }
 
+// closeAll closes the backends holding resources when the audit table is
+// torn down
+func (a *AuditBroker) closeAll() {
+	a.l.Lock()
+	defer a.l.Unlock()
+	for name, be := range a.backends {
+		a.closeBackend(name, be.backend)
+	}
+}
+
+// closeBackend closes the backend if it implements io.Closer. It is called
+// with the lock held.
+func (a *AuditBroker) closeBackend(name string, b audit.Backend) {
+	closer, ok := b.(io.Closer)
+	if !ok {
+		return
+	}
+	if err := closer.Close(); err != nil {
+		a.logger.Printf("[ERR] audit: failed to close backend %s: %v", name, err)
+	}
+}
+
 // IsRegistered is used to check if a given audit backend is registered
 func (a *AuditBroker) IsRegistered(name string) bool {
 	a.l.RLock()
@@ -350,6 +432,62 @@ func (a *AuditBroker) GetHash(name string, input string) (string, error) {
 	return be.backend.GetHash(input), nil
 }
 
+// GetHashVersion returns a hash using the given version of the salt of the
+// given backend, so that values logged before the salt was rotated can be
+// looked up. A version of zero uses the current version, as GetHash does.
+func (a *AuditBroker) GetHashVersion(name string, input string, version int) (string, error) {
+	if version == 0 {
+		return a.GetHash(name, input)
+	}
+
+	a.l.RLock()
+	defer a.l.RUnlock()
+	be, ok := a.backends[name]
+	if !ok {
+		return "", fmt.Errorf("unknown audit backend %s", name)
+	}
+	if be.salt == nil {
+		return "", fmt.Errorf("audit backend %s does not support salt versions", name)
+	}
+
+	return audit.HashStringVersion(be.salt, input, version)
+}
+
+// VerifyHash returns whether the given hash, as logged by the given backend,
+// is the hash of input, along with the version of the salt it was hashed
+// with
+func (a *AuditBroker) VerifyHash(name string, input string, hash string) (bool, int, error) {
+	a.l.RLock()
+	defer a.l.RUnlock()
+	be, ok := a.backends[name]
+	if !ok {
+		return false, 0, fmt.Errorf("unknown audit backend %s", name)
+	}
+	if be.salt == nil {
+		expected := be.backend.GetHash(input)
+		return subtle.ConstantTimeCompare([]byte(expected), []byte(hash)) == 1, 1, nil
+	}
+
+	return audit.VerifyHash(be.salt, input, hash)
+}
+
+// RotateSalt rotates the salt of the given backend, returning the new
+// version. Values are hashed with the new version from then on, while
+// previous versions remain available to GetHashVersion.
+func (a *AuditBroker) RotateSalt(name string) (int, error) {
+	a.l.RLock()
+	defer a.l.RUnlock()
+	be, ok := a.backends[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown audit backend %s", name)
+	}
+	if be.salt == nil {
+		return 0, fmt.Errorf("audit backend %s does not support salt rotation", name)
+	}
+
+	return be.salt.Rotate()
+}
+
 // LogRequest is used to ensure all the audit backends have an opportunity to
 // log the given request and that *at least one* succeeds.
 func (a *AuditBroker) LogRequest(auth *logical.Auth, req *logical.Request, outerErr error) (retErr error) {
@@ -370,9 +508,23 @@ func (a *AuditBroker) LogRequest(auth *logical.Auth, req *logical.Request, outer
 	//	return
 	//}
 
-	// Ensure at least one backend logs
+	// Ensure at least one backend logs, unless every backend filters the
+	// request out
 	anyLogged := false
+	anyAttempted := false
+	var in *audit.FilterInput
 	for name, be := range a.backends {
+		if be.filter != nil {
+			if in == nil {
+				in = a.filterInput(auth, req)
+			}
+			if !be.filter.Evaluate(in) {
+				metrics.IncrCounter([]string{"audit", name, "filtered"}, 1)
+				continue
+			}
+		}
+		anyAttempted = true
+
 		start := time.Now()
 		err := be.backend.LogRequest(auth, req, outerErr)
 		metrics.MeasureSince([]string{"audit", name, "log_request"}, start)
@@ -382,7 +534,7 @@ func (a *AuditBroker) LogRequest(auth *logical.Auth, req *logical.Request, outer
 			anyLogged = true
 		}
 	}
-	if !anyLogged && len(a.backends) > 0 {
+	if !anyLogged && anyAttempted {
 		retErr = multierror.Append(retErr, fmt.Errorf("no audit backend succeeded in logging the request"))
 		return
 	}
@@ -403,9 +555,26 @@ func (a *AuditBroker) LogResponse(auth *logical.Auth, req *logical.Request,
 		}
 	}()
 
-	// Ensure at least one backend logs
+	// Elide the response values tuned on the mount, without modifying the
+	// response sent to the client
+	resp = elideResponse(resp, req.AuditElideResponseKeys)
+
+	// Ensure at least one backend logs, unless every backend filters the
+	// request out
 	anyLogged := false
+	anyAttempted := false
+	var in *audit.FilterInput
 	for name, be := range a.backends {
+		if be.filter != nil {
+			if in == nil {
+				in = a.filterInput(auth, req)
+			}
+			if !be.filter.Evaluate(in) {
+				continue
+			}
+		}
+		anyAttempted = true
+
 		start := time.Now()
 		err := be.backend.LogResponse(auth, req, resp, err)
 		metrics.MeasureSince([]string{"audit", name, "log_response"}, start)
@@ -415,8 +584,64 @@ func (a *AuditBroker) LogResponse(auth *logical.Auth, req *logical.Request,
 			anyLogged = true
 		}
 	}
-	if !anyLogged && len(a.backends) > 0 {
+	if !anyLogged && anyAttempted {
 		return fmt.Errorf("no audit backend succeeded in logging the response")
 	}
 	return nil
 }
+
+// elideResponse returns a copy of the response whose values of the given
+// data keys are replaced by their size: the number of elements of lists and
+// maps, and the length of strings. Other values are removed.
+func elideResponse(resp *logical.Response, keys []string) *logical.Response {
+	if resp == nil || len(resp.Data) == 0 {
+		return resp
+	}
+
+	var data map[string]interface{}
+	for _, key := range keys {
+		value, ok := resp.Data[key]
+		if !ok {
+			continue
+		}
+		if data == nil {
+			data = make(map[string]interface{}, len(resp.Data))
+			for k, v := range resp.Data {
+				data[k] = v
+			}
+		}
+
+		data[key] = nil
+		if value == nil {
+			continue
+		}
+		switch v := reflect.ValueOf(value); v.Kind() {
+		case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+			data[key] = v.Len()
+		}
+	}
+	if data == nil {
+		return resp
+	}
+
+	elided := *resp
+	elided.Data = data
+	return &elided
+}
+
+// filterInput returns the values of the request the filters of the
+// backends are evaluated against
+func (a *AuditBroker) filterInput(auth *logical.Auth, req *logical.Request) *audit.FilterInput {
+	in := &audit.FilterInput{
+		Path:      req.Path,
+		MountPath: req.MountPoint,
+		Operation: string(req.Operation),
+	}
+	if auth != nil {
+		in.Policies = auth.Policies
+	}
+	if a.namespacePath != nil {
+		in.Namespace = a.namespacePath(req.Path)
+	}
+	return in
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -46,7 +47,7 @@ func (n *NoopAudit) LogResponse(a *logical.Auth, r *logical.Request, re *logical
 }
 
 func (n *NoopAudit) GetHash(data string) string {
-	return n.Config.Salt.GetIdentifiedHMAC(data)
+	return audit.HashString(n.Config.Salt, data)
 }
 
 func TestCore_EnableAudit(t *testing.T) {
@@ -210,8 +211,8 @@ func TestAuditBroker_LogRequest(t *testing.T) {
 	b := NewAuditBroker(l)
 	a1 := &NoopAudit{}
 	a2 := &NoopAudit{}
-	b.Register("foo", a1, nil)
-	b.Register("bar", a2, nil)
+	b.Register("foo", a1, nil, nil, nil)
+	b.Register("bar", a2, nil, nil, nil)
 
 	auth := &logical.Auth{
 		ClientToken: "foo",
@@ -270,8 +271,8 @@ func TestAuditBroker_LogResponse(t *testing.T) {
 	b := NewAuditBroker(l)
 	a1 := &NoopAudit{}
 	a2 := &NoopAudit{}
-	b.Register("foo", a1, nil)
-	b.Register("bar", a2, nil)
+	b.Register("foo", a1, nil, nil, nil)
+	b.Register("bar", a2, nil, nil, nil)
 
 	auth := &logical.Auth{
 		ClientToken: "foo",
@@ -332,3 +333,80 @@ func TestAuditBroker_LogResponse(t *testing.T) {
 		t.Fatalf("err: %v", err)
 	}
 }
+
+func TestAuditBroker_filter(t *testing.T) {
+	l := log.New(os.Stderr, "", log.LstdFlags)
+	b := NewAuditBroker(l)
+	all := &NoopAudit{}
+	filtered := &NoopAudit{}
+	filter, err := audit.ParseFilter(`not (operation == "read" and mount_path == "secret/") and path != "sys/health"`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	b.Register("all", all, nil, nil, nil)
+	b.Register("filtered", filtered, nil, nil, filter)
+
+	auth := &logical.Auth{Policies: []string{"default"}}
+	read := &logical.Request{
+		Operation:  logical.ReadOperation,
+		Path:       "secret/foo",
+		MountPoint: "secret/",
+	}
+	write := &logical.Request{
+		Operation:  logical.UpdateOperation,
+		Path:       "secret/foo",
+		MountPoint: "secret/",
+	}
+	for _, req := range []*logical.Request{read, write} {
+		if err := b.LogRequest(auth, req, nil); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if err := b.LogResponse(auth, req, nil, nil); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	if len(all.Req) != 2 || len(all.RespReq) != 2 {
+		t.Fatalf("bad: %d %d", len(all.Req), len(all.RespReq))
+	}
+	if len(filtered.Req) != 1 || filtered.Req[0] != write || len(filtered.RespReq) != 1 {
+		t.Fatalf("bad: %#v", filtered.Req)
+	}
+
+	// A request filtered out by the only backend that would log it does
+	// not fail when the others fail
+	all.ReqErr = fmt.Errorf("failed")
+	if err := b.LogRequest(auth, read, nil); !errwrap.Contains(err, "no audit backend succeeded in logging the request") {
+		t.Fatalf("err: %v", err)
+	}
+	b.Deregister("all")
+	if err := b.LogRequest(auth, read, nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestCore_EnableAudit_filter(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+	c.auditBackends["noop"] = func(config *audit.BackendConfig) (audit.Backend, error) {
+		return &NoopAudit{
+			Config: config,
+		}, nil
+	}
+
+	me := &MountEntry{
+		Table:   auditTableType,
+		Path:    "foo",
+		Type:    "noop",
+		Options: map[string]string{"filter": `operation ==`},
+	}
+	if err := c.enableAudit(me); err == nil || !strings.Contains(err.Error(), "invalid filter") {
+		t.Fatalf("expected invalid filter, got %v", err)
+	}
+
+	me.Options["filter"] = `operation != "read"`
+	if err := c.enableAudit(me); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if be := c.auditBroker.backends["foo/"]; be.filter == nil || be.filter.String() != `operation != "read"` {
+		t.Fatalf("bad: %#v", be)
+	}
+}
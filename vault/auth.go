@@ -96,6 +96,10 @@ func (c *Core) enableCredential(entry *MountEntry) error {
 	}
 	c.logger.Printf("[INFO] core: enabled credential backend '%s' type: %s",
 		entry.Path, entry.Type)
+	c.events.Publish(EventAuthEnabled, map[string]interface{}{
+		"path": entry.Path,
+		"type": entry.Type,
+	})
 	return nil
 }
 
@@ -153,6 +157,9 @@ func (c *Core) disableCredential(path string) error {
 		return err
 	}
 	c.logger.Printf("[INFO] core: disabled credential backend '%s'", path)
+	c.events.Publish(EventAuthDisabled, map[string]interface{}{
+		"path": path,
+	})
 	return nil
 }
 
@@ -1,10 +1,12 @@
 package vault
 
 import (
+	"context"
 	"errors"
 	"time"
 
 	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/physical"
 )
 
 var (
@@ -66,8 +68,9 @@ type SecurityBarrier interface {
 	Initialized() (bool, error)
 
 	// Initialize works only if the barrier has not been initialized
-	// and makes use of the given master key.
-	Initialize([]byte) error
+	// and makes use of the given master key. Values are encrypted with
+	// the given cipher, or the default one if it's empty.
+	Initialize(key []byte, cipher string) error
 
 	// GenerateKey is used to generate a new key
 	GenerateKey() ([]byte, error)
@@ -116,6 +119,15 @@ type SecurityBarrier interface {
 	// ActiveKeyInfo is used to inform details about the active key
 	ActiveKeyInfo() (*KeyInfo, error)
 
+	// DeriveKey derives a key for the given purpose from the encryption key
+	// of the given term, or of the active term if the term is zero. The term
+	// the key was derived from is returned along with it.
+	DeriveKey(term uint32, purpose []byte) ([]byte, uint32, error)
+
+	// TakeEncryptionCounts returns the number of values encrypted with
+	// each term since it was last called, and resets the counts
+	TakeEncryptionCounts() map[uint32]uint64
+
 	// Rekey is used to change the master key used to protect the keyring
 	Rekey([]byte) error
 
@@ -139,6 +151,28 @@ type BarrierStorage interface {
 	List(prefix string) ([]string, error)
 }
 
+// contextBarrierStorage is implemented by barriers that can trace their
+// operations as part of the request in the given context
+type contextBarrierStorage interface {
+	PutContext(ctx context.Context, entry *Entry) error
+	GetContext(ctx context.Context, key string) (*Entry, error)
+	DeleteContext(ctx context.Context, key string) error
+	ListContext(ctx context.Context, prefix string) ([]string, error)
+}
+
+// TxnEntry is an operation of a transaction on the barrier. Only the key of
+// the entry is used by a delete.
+type TxnEntry struct {
+	Operation physical.Operation
+	Entry     *Entry
+}
+
+// TransactionalStorage is implemented by barriers which can apply several
+// puts and deletes atomically, if the physical backend supports it
+type TransactionalStorage interface {
+	Transaction(txns []*TxnEntry) error
+}
+
 // Entry is used to represent data stored by the security barrier
 type Entry struct {
 	Key   string
@@ -157,4 +191,5 @@ func (e *Entry) Logical() *logical.StorageEntry {
 type KeyInfo struct {
 	Term        int
 	InstallTime time.Time
+	Cipher      string
 }
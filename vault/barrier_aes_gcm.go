@@ -2,19 +2,25 @@ package vault
 
 import (
 	"bytes"
+	"context"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
 	"crypto/subtle"
 	"encoding/binary"
 	"fmt"
+	"io"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/armon/go-metrics"
 	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/tracing"
 	"github.com/hashicorp/vault/physical"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
 )
 
 const (
@@ -32,6 +38,25 @@ const (
 	AESGCMVersion2 = 0x2
 )
 
+// Ciphers that encryption keys can use. The cipher is chosen when the
+// barrier is initialized and is kept by the keys installed on rotation.
+// ChaCha20-Poly1305 is faster than AES-GCM on platforms without AES
+// hardware support.
+const (
+	BarrierCipherAESGCM           = "aes-gcm"
+	BarrierCipherChaCha20Poly1305 = "chacha20-poly1305"
+)
+
+// ValidBarrierCipher checks if the given cipher can be used to initialize
+// the barrier. An empty cipher selects AES-GCM.
+func ValidBarrierCipher(name string) bool {
+	switch name {
+	case "", BarrierCipherAESGCM, BarrierCipherChaCha20Poly1305:
+		return true
+	}
+	return false
+}
+
 // barrierInit is the JSON encoded value stored
 type barrierInit struct {
 	Version int    // Version is the current format version
@@ -42,7 +67,8 @@ type barrierInit struct {
 // cipher core and the Galois Counter Mode block mode. It defaults to
 // the golang NONCE default value of 12 and a key size of 256
 // bit. AES-GCM is high performance, and provides both confidentiality
-// and integrity.
+// and integrity. Encryption keys may use ChaCha20-Poly1305 instead, while
+// the keyring is always protected with AES-GCM.
 type AESGCMBarrier struct {
 	backend physical.Backend
 
@@ -58,6 +84,11 @@ type AESGCMBarrier struct {
 	cache     map[uint32]cipher.AEAD
 	cacheLock sync.RWMutex
 
+	// encryptions counts the values written under each term since the
+	// counts were last taken
+	encryptions     map[uint32]uint64
+	encryptionsLock sync.Mutex
+
 	// currentAESGCMVersionByte is prefixed to a message to allow for
 	// future versioning of barrier implementations. It's var instead
 	// of const to allow for testing
@@ -97,14 +128,20 @@ func (b *AESGCMBarrier) Initialized() (bool, error) {
 }
 
 // Initialize works only if the barrier has not been initialized
-// and makes use of the given master key.
-func (b *AESGCMBarrier) Initialize(key []byte) error {
+// and makes use of the given master key. Values are encrypted
+// with the given cipher.
+func (b *AESGCMBarrier) Initialize(key []byte, cipherName string) error {
 	// Verify the key size
 	min, max := b.KeyLength()
 	if len(key) < min || len(key) > max {
 		return fmt.Errorf("Key size must be %d or %d", min, max)
 	}
 
+	// Verify the cipher
+	if !ValidBarrierCipher(cipherName) {
+		return fmt.Errorf("unsupported cipher %q", cipherName)
+	}
+
 	// Check if already initialized
 	if alreadyInit, err := b.Initialized(); err != nil {
 		return err
@@ -125,6 +162,7 @@ func (b *AESGCMBarrier) Initialize(key []byte) error {
 		Term:    1,
 		Version: 1,
 		Value:   encrypt,
+		Cipher:  cipherName,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create keyring: %v", err)
@@ -143,7 +181,7 @@ func (b *AESGCMBarrier) persistKeyring(keyring *Keyring) error {
 	}
 
 	// Create the AES-GCM
-	gcm, err := b.aeadFromKey(keyring.MasterKey())
+	gcm, err := b.aeadFromKey(keyring.MasterKey(), BarrierCipherAESGCM)
 	if err != nil {
 		return err
 	}
@@ -174,7 +212,7 @@ func (b *AESGCMBarrier) persistKeyring(keyring *Keyring) error {
 
 	// Encrypt the master key
 	activeKey := keyring.ActiveKey()
-	aead, err := b.aeadFromKey(activeKey.Value)
+	aead, err := b.aeadFromKey(activeKey.Value, activeKey.Cipher)
 	if err != nil {
 		return err
 	}
@@ -233,7 +271,7 @@ func (b *AESGCMBarrier) ReloadKeyring() error {
 	defer b.l.Unlock()
 
 	// Create the AES-GCM
-	gcm, err := b.aeadFromKey(b.keyring.MasterKey())
+	gcm, err := b.aeadFromKey(b.keyring.MasterKey(), BarrierCipherAESGCM)
 	if err != nil {
 		return err
 	}
@@ -323,7 +361,7 @@ func (b *AESGCMBarrier) Unseal(key []byte) error {
 	}
 
 	// Create the AES-GCM
-	gcm, err := b.aeadFromKey(key)
+	gcm, err := b.aeadFromKey(key, BarrierCipherAESGCM)
 	if err != nil {
 		return err
 	}
@@ -444,11 +482,12 @@ func (b *AESGCMBarrier) Rotate() (uint32, error) {
 	term := b.keyring.ActiveTerm()
 	newTerm := term + 1
 
-	// Add a new encryption key
+	// Add a new encryption key, using the same cipher
 	newKeyring, err := b.keyring.AddKey(&Key{
 		Term:    newTerm,
 		Version: 1,
 		Value:   encrypt,
+		Cipher:  b.keyring.ActiveKey().Cipher,
 	})
 	if err != nil {
 		return 0, fmt.Errorf("failed to add new encryption key: %v", err)
@@ -567,10 +606,49 @@ func (b *AESGCMBarrier) ActiveKeyInfo() (*KeyInfo, error) {
 	info := &KeyInfo{
 		Term:        int(term),
 		InstallTime: key.InstallTime,
+		Cipher:      key.Cipher,
+	}
+	if info.Cipher == "" {
+		info.Cipher = BarrierCipherAESGCM
 	}
 	return info, nil
 }
 
+// DeriveKey derives a key for the given purpose from the encryption key of
+// the given term using HKDF, so that the encryption key itself is never used
+// for anything else
+func (b *AESGCMBarrier) DeriveKey(term uint32, purpose []byte) ([]byte, uint32, error) {
+	b.l.RLock()
+	defer b.l.RUnlock()
+	if b.sealed {
+		return nil, 0, ErrBarrierSealed
+	}
+
+	if term == 0 {
+		term = b.keyring.ActiveTerm()
+	}
+	key := b.keyring.TermKey(term)
+	if key == nil {
+		return nil, 0, fmt.Errorf("no encryption key for term %d", term)
+	}
+
+	derived := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, key.Value, nil, purpose), derived); err != nil {
+		return nil, 0, err
+	}
+	return derived, term, nil
+}
+
+// TakeEncryptionCounts returns the number of values encrypted with each
+// term since it was last called
+func (b *AESGCMBarrier) TakeEncryptionCounts() map[uint32]uint64 {
+	b.encryptionsLock.Lock()
+	defer b.encryptionsLock.Unlock()
+	counts := b.encryptions
+	b.encryptions = nil
+	return counts
+}
+
 // Rekey is used to change the master key used to protect the keyring
 func (b *AESGCMBarrier) Rekey(key []byte) error {
 	b.l.Lock()
@@ -602,7 +680,19 @@ func (b *AESGCMBarrier) Rekey(key []byte) error {
 
 // Put is used to insert or update an entry
 func (b *AESGCMBarrier) Put(entry *Entry) error {
+	return b.PutContext(context.Background(), entry)
+}
+
+// PutContext is like Put, tracing the operation as part of the request in
+// ctx
+func (b *AESGCMBarrier) PutContext(ctx context.Context, entry *Entry) (err error) {
 	defer metrics.MeasureSince([]string{"barrier", "put"}, time.Now())
+	ctx, span := tracing.StartChildSpan(ctx, "barrier.put")
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+
 	b.l.RLock()
 	defer b.l.RUnlock()
 	if b.sealed {
@@ -619,12 +709,36 @@ func (b *AESGCMBarrier) Put(entry *Entry) error {
 		Key:   entry.Key,
 		Value: b.encrypt(entry.Key, term, primary, entry.Value),
 	}
-	return b.backend.Put(pe)
+
+	b.encryptionsLock.Lock()
+	if b.encryptions == nil {
+		b.encryptions = make(map[uint32]uint64)
+	}
+	b.encryptions[term]++
+	b.encryptionsLock.Unlock()
+
+	_, pspan := tracing.StartChildSpan(ctx, "physical.put")
+	err = b.backend.Put(pe)
+	pspan.SetError(err)
+	pspan.End()
+	return err
 }
 
 // Get is used to fetch an entry
 func (b *AESGCMBarrier) Get(key string) (*Entry, error) {
+	return b.GetContext(context.Background(), key)
+}
+
+// GetContext is like Get, tracing the operation as part of the request in
+// ctx
+func (b *AESGCMBarrier) GetContext(ctx context.Context, key string) (_ *Entry, err error) {
 	defer metrics.MeasureSince([]string{"barrier", "get"}, time.Now())
+	ctx, span := tracing.StartChildSpan(ctx, "barrier.get")
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+
 	b.l.RLock()
 	defer b.l.RUnlock()
 	if b.sealed {
@@ -632,7 +746,10 @@ func (b *AESGCMBarrier) Get(key string) (*Entry, error) {
 	}
 
 	// Read the key from the backend
+	_, pspan := tracing.StartChildSpan(ctx, "physical.get")
 	pe, err := b.backend.Get(key)
+	pspan.SetError(err)
+	pspan.End()
 	if err != nil {
 		return nil, err
 	} else if pe == nil {
@@ -655,30 +772,108 @@ func (b *AESGCMBarrier) Get(key string) (*Entry, error) {
 
 // Delete is used to permanently delete an entry
 func (b *AESGCMBarrier) Delete(key string) error {
+	return b.DeleteContext(context.Background(), key)
+}
+
+// DeleteContext is like Delete, tracing the operation as part of the
+// request in ctx
+func (b *AESGCMBarrier) DeleteContext(ctx context.Context, key string) (err error) {
 	defer metrics.MeasureSince([]string{"barrier", "delete"}, time.Now())
+	ctx, span := tracing.StartChildSpan(ctx, "barrier.delete")
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+
 	b.l.RLock()
 	defer b.l.RUnlock()
 	if b.sealed {
 		return ErrBarrierSealed
 	}
 
-	return b.backend.Delete(key)
+	_, pspan := tracing.StartChildSpan(ctx, "physical.delete")
+	err = b.backend.Delete(key)
+	pspan.SetError(err)
+	pspan.End()
+	return err
+}
+
+// Transaction is used to apply several puts and deletes atomically if the
+// physical backend supports it, or one by one otherwise
+func (b *AESGCMBarrier) Transaction(txns []*TxnEntry) error {
+	defer metrics.MeasureSince([]string{"barrier", "transaction"}, time.Now())
+
+	b.l.RLock()
+	defer b.l.RUnlock()
+	if b.sealed {
+		return ErrBarrierSealed
+	}
+
+	term := b.keyring.ActiveTerm()
+	primary, err := b.aeadForTerm(term)
+	if err != nil {
+		return err
+	}
+
+	ptxns := make([]*physical.TxnEntry, 0, len(txns))
+	var encryptions uint64
+	for _, txn := range txns {
+		if txn == nil || txn.Entry == nil {
+			return fmt.Errorf("transaction operation without an entry")
+		}
+		pe := &physical.Entry{
+			Key: txn.Entry.Key,
+		}
+		if txn.Operation == physical.PutOperation {
+			pe.Value = b.encrypt(txn.Entry.Key, term, primary, txn.Entry.Value)
+			encryptions++
+		}
+		ptxns = append(ptxns, &physical.TxnEntry{
+			Operation: txn.Operation,
+			Entry:     pe,
+		})
+	}
+
+	b.encryptionsLock.Lock()
+	if b.encryptions == nil {
+		b.encryptions = make(map[uint32]uint64)
+	}
+	b.encryptions[term] += encryptions
+	b.encryptionsLock.Unlock()
+
+	return physical.Transaction(b.backend, ptxns)
 }
 
 // List is used ot list all the keys under a given
 // prefix, up to the next prefix.
 func (b *AESGCMBarrier) List(prefix string) ([]string, error) {
+	return b.ListContext(context.Background(), prefix)
+}
+
+// ListContext is like List, tracing the operation as part of the request in
+// ctx
+func (b *AESGCMBarrier) ListContext(ctx context.Context, prefix string) (_ []string, err error) {
 	defer metrics.MeasureSince([]string{"barrier", "list"}, time.Now())
+	ctx, span := tracing.StartChildSpan(ctx, "barrier.list")
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+
 	b.l.RLock()
 	defer b.l.RUnlock()
 	if b.sealed {
 		return nil, ErrBarrierSealed
 	}
 
-	return b.backend.List(prefix)
+	_, pspan := tracing.StartChildSpan(ctx, "physical.list")
+	keys, err := b.backend.List(prefix)
+	pspan.SetError(err)
+	pspan.End()
+	return keys, err
 }
 
-// aeadForTerm returns the AES-GCM AEAD for the given term
+// aeadForTerm returns the AEAD for the given term
 func (b *AESGCMBarrier) aeadForTerm(term uint32) (cipher.AEAD, error) {
 	// Check for the keyring
 	keyring := b.keyring
@@ -701,7 +896,7 @@ func (b *AESGCMBarrier) aeadForTerm(term uint32) (cipher.AEAD, error) {
 	}
 
 	// Create a new aead
-	aead, err := b.aeadFromKey(key.Value)
+	aead, err := b.aeadFromKey(key.Value, key.Cipher)
 	if err != nil {
 		return nil, err
 	}
@@ -713,8 +908,21 @@ func (b *AESGCMBarrier) aeadForTerm(term uint32) (cipher.AEAD, error) {
 	return aead, nil
 }
 
-// aeadFromKey returns an AES-GCM AEAD using the given key.
-func (b *AESGCMBarrier) aeadFromKey(key []byte) (cipher.AEAD, error) {
+// aeadFromKey returns an AEAD of the given cipher using the given key.
+// Keys installed before ciphers could be chosen use AES-GCM.
+func (b *AESGCMBarrier) aeadFromKey(key []byte, cipherName string) (cipher.AEAD, error) {
+	switch cipherName {
+	case "", BarrierCipherAESGCM:
+	case BarrierCipherChaCha20Poly1305:
+		aead, err := chacha20poly1305.New(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create cipher: %v", err)
+		}
+		return aead, nil
+	default:
+		return nil, fmt.Errorf("unsupported cipher %q", cipherName)
+	}
+
 	// Create the AES cipher
 	aesCipher, err := aes.NewCipher(key)
 	if err != nil {
@@ -24,7 +24,7 @@ func mockBarrier(t *testing.T) (physical.Backend, SecurityBarrier, []byte) {
 
 	// Initialize and unseal
 	key, _ := b.GenerateKey()
-	b.Initialize(key)
+	b.Initialize(key, "")
 	b.Unseal(key)
 	return inm, b, key
 }
@@ -101,7 +101,7 @@ func TestAESGCMBarrier_BackwardsCompatible(t *testing.T) {
 
 	// Protect with master key
 	master, _ := b.GenerateKey()
-	gcm, _ := b.aeadFromKey(master)
+	gcm, _ := b.aeadFromKey(master, BarrierCipherAESGCM)
 	value := b.encrypt(barrierInitPath, initialKeyTerm, gcm, buf)
 
 	// Write to the physical backend
@@ -112,7 +112,7 @@ func TestAESGCMBarrier_BackwardsCompatible(t *testing.T) {
 	inm.Put(pe)
 
 	// Create a fake key
-	gcm, _ = b.aeadFromKey(encrypt)
+	gcm, _ = b.aeadFromKey(encrypt, BarrierCipherAESGCM)
 	pe = &physical.Entry{
 		Key:   "test/foo",
 		Value: b.encrypt("test/foo", initialKeyTerm, gcm, []byte("test")),
@@ -172,7 +172,7 @@ func TestAESGCMBarrier_Confidential(t *testing.T) {
 
 	// Initialize and unseal
 	key, _ := b.GenerateKey()
-	b.Initialize(key)
+	b.Initialize(key, "")
 	b.Unseal(key)
 
 	// Put a logical entry
@@ -209,7 +209,7 @@ func TestAESGCMBarrier_Integrity(t *testing.T) {
 
 	// Initialize and unseal
 	key, _ := b.GenerateKey()
-	b.Initialize(key)
+	b.Initialize(key, "")
 	b.Unseal(key)
 
 	// Put a logical entry
@@ -245,7 +245,7 @@ func TestAESGCMBarrier_MoveIntegrityV1(t *testing.T) {
 
 	// Initialize and unseal
 	key, _ := b.GenerateKey()
-	err = b.Initialize(key)
+	err = b.Initialize(key, "")
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -283,7 +283,7 @@ func TestAESGCMBarrier_MoveIntegrityV2(t *testing.T) {
 
 	// Initialize and unseal
 	key, _ := b.GenerateKey()
-	err = b.Initialize(key)
+	err = b.Initialize(key, "")
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -321,7 +321,7 @@ func TestAESGCMBarrier_UpgradeV1toV2(t *testing.T) {
 
 	// Initialize and unseal
 	key, _ := b.GenerateKey()
-	err = b.Initialize(key)
+	err = b.Initialize(key, "")
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
@@ -371,7 +371,7 @@ func TestEncrypt_Unique(t *testing.T) {
 	}
 
 	key, _ := b.GenerateKey()
-	b.Initialize(key)
+	b.Initialize(key, "")
 	b.Unseal(key)
 
 	if b.keyring == nil {
@@ -401,21 +401,167 @@ func TestInitialize_KeyLength(t *testing.T) {
 	middle := []byte("ThisIsASecretKeyAndMore")
 	short := []byte("Key")
 
-	err = b.Initialize(long)
+	err = b.Initialize(long, "")
 
 	if err == nil {
 		t.Fatalf("key length protection failed")
 	}
 
-	err = b.Initialize(middle)
+	err = b.Initialize(middle, "")
 
 	if err == nil {
 		t.Fatalf("key length protection failed")
 	}
 
-	err = b.Initialize(short)
+	err = b.Initialize(short, "")
 
 	if err == nil {
 		t.Fatalf("key length protection failed")
 	}
 }
+
+func TestAESGCMBarrier_DeriveKey(t *testing.T) {
+	_, b, _ := mockBarrier(t)
+
+	key1, term, err := b.DeriveKey(0, []byte("purpose"))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if term != 1 || len(key1) != 32 {
+		t.Fatalf("bad: term %d, key %x", term, key1)
+	}
+
+	// Derivation is deterministic and depends on the purpose
+	again, _, err := b.DeriveKey(1, []byte("purpose"))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	other, _, err := b.DeriveKey(1, []byte("other"))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !bytes.Equal(key1, again) || bytes.Equal(key1, other) {
+		t.Fatal("bad derived keys")
+	}
+
+	// Keys of older terms can still be derived after a rotation
+	if _, err := b.Rotate(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	key2, term, err := b.DeriveKey(0, []byte("purpose"))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if term != 2 || bytes.Equal(key1, key2) {
+		t.Fatalf("bad: term %d", term)
+	}
+	if again, _, err = b.DeriveKey(1, []byte("purpose")); err != nil || !bytes.Equal(key1, again) {
+		t.Fatalf("bad: %v", err)
+	}
+
+	if _, _, err := b.DeriveKey(3, []byte("purpose")); err == nil {
+		t.Fatal("expected error for unknown term")
+	}
+
+	b.Seal()
+	if _, _, err := b.DeriveKey(0, []byte("purpose")); err != ErrBarrierSealed {
+		t.Fatalf("expected sealed error, got %v", err)
+	}
+}
+
+func TestAESGCMBarrier_TakeEncryptionCounts(t *testing.T) {
+	inm := physical.NewInmem(logger)
+	b, err := NewAESGCMBarrier(inm)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	key, _ := b.GenerateKey()
+	b.Initialize(key, "")
+	b.Unseal(key)
+
+	for i := 0; i < 3; i++ {
+		if err := b.Put(&Entry{Key: "test", Value: []byte("test")}); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	if _, err := b.Rotate(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := b.Put(&Entry{Key: "test", Value: []byte("test")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	counts := b.TakeEncryptionCounts()
+	if len(counts) != 2 || counts[1] != 3 || counts[2] != 1 {
+		t.Fatalf("bad: %v", counts)
+	}
+	if counts := b.TakeEncryptionCounts(); len(counts) != 0 {
+		t.Fatalf("bad: %v", counts)
+	}
+}
+
+func TestAESGCMBarrier_ChaCha20Poly1305(t *testing.T) {
+	inm := physical.NewInmem(logger)
+	b, err := NewAESGCMBarrier(inm)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	key, _ := b.GenerateKey()
+	if err := b.Initialize(key, "des"); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := b.Initialize(key, BarrierCipherChaCha20Poly1305); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := b.Unseal(key); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	entry := &Entry{Key: "test", Value: []byte("test")}
+	if err := b.Put(entry); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := b.Rotate(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	info, err := b.ActiveKeyInfo()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if info.Term != 2 || info.Cipher != BarrierCipherChaCha20Poly1305 {
+		t.Fatalf("bad: %#v", info)
+	}
+	if err := b.Put(&Entry{Key: "other", Value: []byte("other")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// A new barrier reads the values written under both terms
+	b2, err := NewAESGCMBarrier(inm)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := b2.Unseal(key); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for _, k := range []string{"test", "other"} {
+		out, err := b2.Get(k)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if out == nil || string(out.Value) != k {
+			t.Fatalf("bad: %#v", out)
+		}
+	}
+
+	// The values are not readable as AES-GCM
+	pe, _ := inm.Get("test")
+	aead, err := b2.aeadFromKey(b2.keyring.TermKey(1).Value, BarrierCipherAESGCM)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	nonce := pe.Value[5 : 5+aead.NonceSize()]
+	if _, err := aead.Open(nil, nonce, pe.Value[5+aead.NonceSize():], []byte("test")); err == nil {
+		t.Fatal("expected error")
+	}
+}
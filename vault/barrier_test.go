@@ -66,12 +66,12 @@ func testBarrier(t *testing.T, b SecurityBarrier) {
 	}
 
 	// Initialize the vault
-	if err := b.Initialize(key); err != nil {
+	if err := b.Initialize(key, ""); err != nil {
 		t.Fatalf("err: %v", err)
 	}
 
 	// Double Initialize should fail
-	if err := b.Initialize(key); err != ErrBarrierAlreadyInit {
+	if err := b.Initialize(key, ""); err != ErrBarrierAlreadyInit {
 		t.Fatalf("err: %v", err)
 	}
 
@@ -243,7 +243,7 @@ func testBarrier(t *testing.T, b SecurityBarrier) {
 func testBarrier_Rotate(t *testing.T, b SecurityBarrier) {
 	// Initialize the barrier
 	key, _ := b.GenerateKey()
-	b.Initialize(key)
+	b.Initialize(key, "")
 	err := b.Unseal(key)
 	if err != nil {
 		t.Fatalf("err: %v", err)
@@ -349,7 +349,7 @@ func testBarrier_Rotate(t *testing.T, b SecurityBarrier) {
 func testBarrier_Rekey(t *testing.T, b SecurityBarrier) {
 	// Initialize the barrier
 	key, _ := b.GenerateKey()
-	b.Initialize(key)
+	b.Initialize(key, "")
 	err := b.Unseal(key)
 	if err != nil {
 		t.Fatalf("err: %v", err)
@@ -429,7 +429,7 @@ func testBarrier_Rekey(t *testing.T, b SecurityBarrier) {
 func testBarrier_Upgrade(t *testing.T, b1, b2 SecurityBarrier) {
 	// Initialize the barrier
 	key, _ := b1.GenerateKey()
-	b1.Initialize(key)
+	b1.Initialize(key, "")
 	err := b1.Unseal(key)
 	if err != nil {
 		t.Fatalf("err: %v", err)
@@ -500,7 +500,7 @@ func testBarrier_Upgrade(t *testing.T, b1, b2 SecurityBarrier) {
 func testBarrier_Upgrade_Rekey(t *testing.T, b1, b2 SecurityBarrier) {
 	// Initialize the barrier
 	key, _ := b1.GenerateKey()
-	b1.Initialize(key)
+	b1.Initialize(key, "")
 	err := b1.Unseal(key)
 	if err != nil {
 		t.Fatalf("err: %v", err)
@@ -1,10 +1,12 @@
 package vault
 
 import (
+	"context"
 	"fmt"
 	"strings"
 
 	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/physical"
 )
 
 // BarrierView wraps a SecurityBarrier and ensures all access is automatically
@@ -17,6 +19,10 @@ import (
 type BarrierView struct {
 	barrier BarrierStorage
 	prefix  string
+
+	// ctx is the context of the request the view is used for, if any, so
+	// that barrier operations are traced as part of the request
+	ctx context.Context
 }
 
 // NewBarrierView takes an underlying security barrier and returns
@@ -28,6 +34,26 @@ func NewBarrierView(barrier BarrierStorage, prefix string) *BarrierView {
 	}
 }
 
+// withContext returns a copy of the view used for the request with the
+// given context
+func (v *BarrierView) withContext(ctx context.Context) *BarrierView {
+	return &BarrierView{
+		barrier: v.barrier,
+		prefix:  v.prefix,
+		ctx:     ctx,
+	}
+}
+
+// contextBarrier returns the barrier as a contextBarrierStorage, if the view
+// has a context and the barrier supports it
+func (v *BarrierView) contextBarrier() (contextBarrierStorage, bool) {
+	if v.ctx == nil {
+		return nil, false
+	}
+	b, ok := v.barrier.(contextBarrierStorage)
+	return b, ok
+}
+
 // sanityCheck is used to perform a sanity check on a key
 func (v *BarrierView) sanityCheck(key string) error {
 	if strings.Contains(key, "..") {
@@ -41,6 +67,9 @@ func (v *BarrierView) List(prefix string) ([]string, error) {
 	if err := v.sanityCheck(prefix); err != nil {
 		return nil, err
 	}
+	if b, ok := v.contextBarrier(); ok {
+		return b.ListContext(v.ctx, v.expandKey(prefix))
+	}
 	return v.barrier.List(v.expandKey(prefix))
 }
 
@@ -49,7 +78,13 @@ func (v *BarrierView) Get(key string) (*logical.StorageEntry, error) {
 	if err := v.sanityCheck(key); err != nil {
 		return nil, err
 	}
-	entry, err := v.barrier.Get(v.expandKey(key))
+	var entry *Entry
+	var err error
+	if b, ok := v.contextBarrier(); ok {
+		entry, err = b.GetContext(v.ctx, v.expandKey(key))
+	} else {
+		entry, err = v.barrier.Get(v.expandKey(key))
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -75,6 +110,9 @@ func (v *BarrierView) Put(entry *logical.StorageEntry) error {
 		Key:   v.expandKey(entry.Key),
 		Value: entry.Value,
 	}
+	if b, ok := v.contextBarrier(); ok {
+		return b.PutContext(v.ctx, nested)
+	}
 	return v.barrier.Put(nested)
 }
 
@@ -83,13 +121,62 @@ func (v *BarrierView) Delete(key string) error {
 	if err := v.sanityCheck(key); err != nil {
 		return err
 	}
+	if b, ok := v.contextBarrier(); ok {
+		return b.DeleteContext(v.ctx, v.expandKey(key))
+	}
 	return v.barrier.Delete(v.expandKey(key))
 }
 
+// Transaction applies the operations on keys relative to the view
+// atomically, if the barrier and the physical backend support it
+func (v *BarrierView) Transaction(txns []*TxnEntry) error {
+	if len(txns) == 0 {
+		return nil
+	}
+
+	nested := make([]*TxnEntry, 0, len(txns))
+	for _, txn := range txns {
+		if txn == nil || txn.Entry == nil {
+			return fmt.Errorf("transaction operation without an entry")
+		}
+		if err := v.sanityCheck(txn.Entry.Key); err != nil {
+			return err
+		}
+		nested = append(nested, &TxnEntry{
+			Operation: txn.Operation,
+			Entry: &Entry{
+				Key:   v.expandKey(txn.Entry.Key),
+				Value: txn.Entry.Value,
+			},
+		})
+	}
+
+	if b, ok := v.barrier.(TransactionalStorage); ok {
+		return b.Transaction(nested)
+	}
+
+	// Fall back to applying the operations one by one
+	for _, txn := range nested {
+		var err error
+		switch txn.Operation {
+		case physical.PutOperation:
+			err = v.barrier.Put(txn.Entry)
+		case physical.DeleteOperation:
+			err = v.barrier.Delete(txn.Entry.Key)
+		default:
+			err = fmt.Errorf("unknown transaction operation %q", txn.Operation)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // SubView constructs a nested sub-view using the given prefix
 func (v *BarrierView) SubView(prefix string) *BarrierView {
 	sub := v.expandKey(prefix)
-	return &BarrierView{barrier: v.barrier, prefix: sub}
+	return &BarrierView{barrier: v.barrier, prefix: sub, ctx: v.ctx}
 }
 
 // expandKey is used to expand to the full key path with the prefix
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/physical"
 )
 
 func TestBarrierView_impl(t *testing.T) {
@@ -282,3 +283,52 @@ func TestBarrierView_ClearView(t *testing.T) {
 		t.Fatalf("have keys: %#v", out)
 	}
 }
+
+func TestBarrierView_Transaction(t *testing.T) {
+	inm, barrier, _ := mockBarrier(t)
+	view := NewBarrierView(barrier, "foo/")
+
+	if err := view.Put(&logical.StorageEntry{Key: "old", Value: []byte("old")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	err := view.Transaction([]*TxnEntry{
+		{Operation: physical.PutOperation, Entry: &Entry{Key: "new", Value: []byte("new")}},
+		{Operation: physical.DeleteOperation, Entry: &Entry{Key: "old"}},
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	out, err := view.Get("new")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out == nil || string(out.Value) != "new" {
+		t.Fatalf("bad: %#v", out)
+	}
+	if out, err := view.Get("old"); err != nil || out != nil {
+		t.Fatalf("expected deleted key, got %#v, %v", out, err)
+	}
+
+	// The values are encrypted under the prefix of the view
+	raw, err := inm.Get("foo/new")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if raw == nil || string(raw.Value) == "new" {
+		t.Fatalf("bad: %#v", raw)
+	}
+
+	// Keys outside of the view are rejected before anything is written
+	err = view.Transaction([]*TxnEntry{
+		{Operation: physical.DeleteOperation, Entry: &Entry{Key: "new"}},
+		{Operation: physical.PutOperation, Entry: &Entry{Key: "../bar", Value: []byte("bar")}},
+	})
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if out, err := view.Get("new"); err != nil || out == nil {
+		t.Fatalf("expected key to remain, got %#v, %v", out, err)
+	}
+}
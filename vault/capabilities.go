@@ -32,24 +32,16 @@ func (c *Core) Capabilities(token, path string) ([]string, error) {
 		return nil, &StatusBadRequest{Err: "invalid token"}
 	}
 
-	if te.Policies == nil {
+	tePolicies := c.tokenPolicies(te)
+	if tePolicies == nil {
 		return []string{DenyCapability}, nil
 	}
 
-	var policies []*Policy
-	for _, tePolicy := range te.Policies {
-		policy, err := c.policyStore.GetPolicy(tePolicy)
-		if err != nil {
-			return nil, err
-		}
-		policies = append(policies, policy)
-	}
-
-	if len(policies) == 0 {
+	if len(tePolicies) == 0 {
 		return []string{DenyCapability}, nil
 	}
 
-	acl, err := NewACL(policies)
+	acl, err := c.tokenACL(te)
 	if err != nil {
 		return nil, err
 	}
@@ -15,13 +15,17 @@ import (
 	mathrand "math/rand"
 	"net"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"golang.org/x/net/http2"
 
+	"github.com/armon/go-metrics"
 	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/helper/jsonutil"
 	"github.com/hashicorp/vault/helper/requestutil"
+	"github.com/hashicorp/vault/helper/strutil"
 )
 
 const (
@@ -48,6 +52,37 @@ type clusterKeyParams struct {
 type activeConnection struct {
 	*http.Client
 	clusterAddr string
+
+	// The compression type and payload encoding negotiated with the active
+	// node
+	compressionType string
+	encoding        string
+
+	// Whether the active node accepts streamed request bodies
+	streaming bool
+
+	// Set when requests are forwarded over a multiplexed session
+	mux *clusterMuxDialer
+
+	// Set when the active node requires forwarded requests to be signed,
+	// along with the barrier key term the signing key was derived from
+	signingKey   []byte
+	signingKeyID string
+
+	// Set when small forwarded requests are batched
+	batcher *forwardingBatcher
+}
+
+// close stops batching and releases idle connections and any multiplexed
+// session held by the connection
+func (a *activeConnection) close() {
+	if a.batcher != nil {
+		a.batcher.close()
+	}
+	a.Transport.(*http.Transport).CloseIdleConnections()
+	if a.mux != nil {
+		a.mux.Close()
+	}
 }
 
 // Structure representing the storage entry that holds cluster information
@@ -279,6 +314,15 @@ func (c *Core) startClusterListener() error {
 	if err != nil {
 		return err
 	}
+	if c.clusterForwardingSigning {
+		handler = c.verifyForwardedRequests(handler)
+	}
+	if c.perfStandbyEnabled {
+		mux := http.NewServeMux()
+		mux.HandleFunc(perfStandbyWALPath, c.handleWALFetch)
+		mux.Handle("/", handler)
+		handler = mux
+	}
 
 	tlsConfig, err := c.ClusterTLSConfig()
 	if err != nil {
@@ -286,6 +330,9 @@ func (c *Core) startClusterListener() error {
 		return err
 	}
 
+	c.clusterListenerShutdownCh = make(chan struct{})
+	c.clusterListenerShutdownSuccessCh = make(chan struct{})
+
 	tlsLns := make([]net.Listener, 0, len(lns))
 	for _, ln := range lns {
 		tlsLn := tls.NewListener(ln, tlsConfig)
@@ -294,13 +341,11 @@ func (c *Core) startClusterListener() error {
 			Handler: handler,
 		}
 		http2.ConfigureServer(server, nil)
+		server.TLSNextProto[clusterMuxALPN] = serveClusterMux(c.logger, c.clusterListenerShutdownCh)
 		c.logger.Printf("[TRACE] core/startClusterListener: serving cluster requests on %s", tlsLn.Addr())
 		go server.Serve(tlsLn)
 	}
 
-	c.clusterListenerShutdownCh = make(chan struct{})
-	c.clusterListenerShutdownSuccessCh = make(chan struct{})
-
 	go func() {
 		<-c.clusterListenerShutdownCh
 		c.logger.Printf("[TRACE] core/startClusterListener: shutting down listeners")
@@ -371,6 +416,7 @@ func (c *Core) ClusterTLSConfig() (*tls.Config, error) {
 		ClientCAs:  c.localClusterCertPool,
 		NextProtos: []string{
 			"h2",
+			clusterMuxALPN,
 		},
 	}
 
@@ -379,8 +425,11 @@ func (c *Core) ClusterTLSConfig() (*tls.Config, error) {
 
 // refreshRequestForwardingConnection ensures that the client/transport are
 // alive and that the current active address value matches the most
-// recently-known address.
-func (c *Core) refreshRequestForwardingConnection(clusterAddr string) error {
+// recently-known address. The compression types and encodings advertised by
+// the active node are used to negotiate how forwarded requests are encoded.
+func (c *Core) refreshRequestForwardingConnection(adv activeAdvertisement) error {
+	clusterAddr := adv.ClusterAddr
+
 	c.requestForwardingConnectionLock.Lock()
 	defer c.requestForwardingConnectionLock.Unlock()
 
@@ -395,6 +444,10 @@ func (c *Core) refreshRequestForwardingConnection(clusterAddr string) error {
 	// Leader() we'll have done a hash on the advertised info to ensure that we
 	// won't hit this function unnecessarily anyways.
 
+	if c.requestForwardingConnection != nil {
+		c.requestForwardingConnection.close()
+	}
+
 	// Disabled, potentially
 	if clusterAddr == "" {
 		c.requestForwardingConnection = nil
@@ -409,24 +462,67 @@ func (c *Core) refreshRequestForwardingConnection(clusterAddr string) error {
 	tp := &http.Transport{
 		TLSClientConfig: tlsConfig,
 	}
-	err = http2.ConfigureTransport(tp)
-	if err != nil {
-		c.logger.Printf("[ERR] core/refreshRequestForwardingConnection: error configuring transport: %v", err)
-		return err
+
+	// If the active node accepts multiplexed sessions, all forwarded requests
+	// share a single persistent connection; otherwise fall back to HTTP/2
+	var mux *clusterMuxDialer
+	if strutil.StrListContains(adv.ForwardingFeatures, clusterFeatureMux) {
+		mux, err = newClusterMuxDialer(clusterAddr, tlsConfig, c.logger)
+		if err != nil {
+			c.logger.Printf("[ERR] core/refreshRequestForwardingConnection: error creating multiplexed dialer: %v", err)
+			return err
+		}
+		tp.DialTLS = mux.DialTLS
+		tp.MaxIdleConnsPerHost = clusterMuxMaxStreams
+		tp.IdleConnTimeout = 90 * time.Second
+	} else {
+		err = http2.ConfigureTransport(tp)
+		if err != nil {
+			c.logger.Printf("[ERR] core/refreshRequestForwardingConnection: error configuring transport: %v", err)
+			return err
+		}
 	}
+
 	c.requestForwardingConnection = &activeConnection{
 		Client: &http.Client{
 			Transport: tp,
 		},
-		clusterAddr: clusterAddr,
+		clusterAddr:     clusterAddr,
+		compressionType: requestutil.NegotiateCompressionType(c.clusterForwardingCompression, adv.ForwardingCompression),
+		encoding:        requestutil.NegotiateEncoding("", adv.ForwardingEncodings),
+		streaming:       requestutil.NegotiateFeature(requestutil.FeatureStreaming, adv.ForwardingFeatures),
+		mux:             mux,
+	}
+
+	if strutil.StrListContains(adv.ForwardingFeatures, requestutil.FeatureSigning) {
+		signingKey, term, err := c.clusterForwardingSigningKey(0)
+		if err != nil {
+			c.logger.Printf("[ERR] core/refreshRequestForwardingConnection: error deriving forwarding signing key: %v", err)
+			c.requestForwardingConnection = nil
+			return err
+		}
+		c.requestForwardingConnection.signingKey = signingKey
+		c.requestForwardingConnection.signingKeyID = strconv.FormatUint(uint64(term), 10)
+	}
+
+	if c.clusterForwardingBatching && requestutil.NegotiateFeature(requestutil.FeatureBatching, adv.ForwardingFeatures) {
+		conn := c.requestForwardingConnection
+		conn.batcher = newForwardingBatcher(conn.Client, clusterAddr+"/cluster/local/forwarded-batch", &requestutil.ForwardingConfig{
+			CompressionType: conn.compressionType,
+			Encoding:        conn.encoding,
+			SigningKey:      conn.signingKey,
+			SigningKeyID:    conn.signingKeyID,
+		}, c.logger)
 	}
 
 	return nil
 }
 
 // ForwardRequest forwards a given request to the active node and returns the
-// response.
-func (c *Core) ForwardRequest(req *http.Request) (*http.Response, error) {
+// response, including the headers and trailers set by the active node.
+func (c *Core) ForwardRequest(req *http.Request) (*requestutil.ForwardedResponse, error) {
+	defer metrics.MeasureSince([]string{"core", "forward_request"}, time.Now())
+
 	c.requestForwardingConnectionLock.RLock()
 	defer c.requestForwardingConnectionLock.RUnlock()
 	if c.requestForwardingConnection == nil {
@@ -437,13 +533,35 @@ func (c *Core) ForwardRequest(req *http.Request) (*http.Response, error) {
 		return nil, ErrCannotForward
 	}
 
-	freq, err := requestutil.GenerateForwardedRequest(req, c.requestForwardingConnection.clusterAddr+"/cluster/local/forwarded-request")
+	if batcher := c.requestForwardingConnection.batcher; batcher != nil && batcher.canBatch(req) {
+		return batcher.Forward(req)
+	}
+
+	freq, err := requestutil.GenerateForwardedRequest(req, c.requestForwardingConnection.clusterAddr+"/cluster/local/forwarded-request", &requestutil.ForwardingConfig{
+		CompressionType: c.requestForwardingConnection.compressionType,
+		Encoding:        c.requestForwardingConnection.encoding,
+		Streaming:       c.requestForwardingConnection.streaming,
+		SigningKey:      c.requestForwardingConnection.signingKey,
+		SigningKeyID:    c.requestForwardingConnection.signingKeyID,
+	})
 	if err != nil {
 		c.logger.Printf("[ERR] core/ForwardRequest: error creating forwarded request: %v", err)
 		return nil, fmt.Errorf("error creating forwarding request")
 	}
 
-	return c.requestForwardingConnection.Do(freq)
+	resp, err := c.requestForwardingConnection.Do(freq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return requestutil.ParseForwardedResponse(resp)
+}
+
+// forwardedRequestParseConfig is used to parse requests forwarded to the
+// active node, and to read them when verifying their signatures
+var forwardedRequestParseConfig = &requestutil.ParseConfig{
+	SetRequestURI: true,
 }
 
 // WrapListenersForClustering takes in Vault's listeners and original HTTP
@@ -454,33 +572,83 @@ func WrapListenersForClustering(addrs []string, handler http.Handler, logger *lo
 	// This mux handles cluster functions (right now, only forwarded requests)
 	mux := http.NewServeMux()
 	mux.HandleFunc("/cluster/local/forwarded-request", func(w http.ResponseWriter, req *http.Request) {
-		freq, err := requestutil.ParseForwardedRequest(req)
+		freq, err := requestutil.ParseForwardedRequest(req, forwardedRequestParseConfig)
 		if err != nil {
 			if logger != nil {
 				logger.Printf("[ERR] http/ForwardedRequestHandler: error parsing forwarded request: %v", err)
 			}
 
-			w.Header().Add("Content-Type", "application/json")
-			w.WriteHeader(http.StatusInternalServerError)
-
-			type errorResponse struct {
-				Errors []string
-			}
-			resp := &errorResponse{
-				Errors: []string{
-					err.Error(),
-				},
-			}
-
-			enc := json.NewEncoder(w)
-			enc.Encode(resp)
+			respondForwardingError(w, err)
 			return
 		}
+		defer freq.Body.Close()
 
 		// To avoid the risk of a forward loop in some pathological condition,
 		// set the no-forward header
 		freq.Header.Set(IntNoForwardingHeaderName, "true")
-		handler.ServeHTTP(w, freq)
+
+		// Older standbys expect the response to be written directly
+		encoding, ok := requestutil.ForwardedResponseEncoding(req)
+		if !ok {
+			handler.ServeHTTP(w, freq)
+			return
+		}
+
+		rw := requestutil.NewForwardedResponseWriter()
+		handler.ServeHTTP(rw, freq)
+		if err := requestutil.WriteForwardedResponse(w, encoding, rw.Response()); err != nil && logger != nil {
+			logger.Printf("[ERR] http/ForwardedRequestHandler: error writing forwarded response: %v", err)
+		}
+	})
+
+	mux.HandleFunc("/cluster/local/forwarded-batch", func(w http.ResponseWriter, req *http.Request) {
+		reqs, err := requestutil.ParseForwardedBatch(req, forwardedRequestParseConfig)
+		if err != nil {
+			if logger != nil {
+				logger.Printf("[ERR] http/ForwardedBatchHandler: error parsing forwarded batch: %v", err)
+			}
+
+			respondForwardingError(w, err)
+			return
+		}
+
+		// The requests in a batch are independent, so they are handled
+		// concurrently
+		var l sync.Mutex
+		var wg sync.WaitGroup
+		responses := make(map[string]*requestutil.ForwardedResponse, len(reqs))
+		for _, breq := range reqs {
+			rw := requestutil.NewForwardedResponseWriter()
+			if breq.Err != nil {
+				respondForwardingError(rw, breq.Err)
+				l.Lock()
+				responses[breq.ID] = rw.Response()
+				l.Unlock()
+				continue
+			}
+
+			wg.Add(1)
+			go func(breq *requestutil.BatchedRequest) {
+				defer wg.Done()
+				defer breq.Request.Body.Close()
+
+				breq.Request.Header.Set(IntNoForwardingHeaderName, "true")
+				handler.ServeHTTP(rw, breq.Request)
+
+				l.Lock()
+				responses[breq.ID] = rw.Response()
+				l.Unlock()
+			}(breq)
+		}
+		wg.Wait()
+
+		encoding, ok := requestutil.ForwardedResponseEncoding(req)
+		if !ok {
+			encoding = requestutil.EncodingJSON
+		}
+		if err := requestutil.WriteForwardedBatchResponse(w, encoding, responses); err != nil && logger != nil {
+			logger.Printf("[ERR] http/ForwardedBatchHandler: error writing forwarded batch response: %v", err)
+		}
 	})
 
 	return func() ([]net.Listener, http.Handler, error) {
@@ -497,3 +665,70 @@ func WrapListenersForClustering(addrs []string, handler http.Handler, logger *lo
 		return ret, mux, nil
 	}
 }
+
+// clusterForwardingFeatures returns the forwarding features advertised by an
+// active node
+func (c *Core) clusterForwardingFeatures() []string {
+	features := make([]string, 0, len(requestutil.SupportedFeatures)+2)
+	features = append(features, requestutil.SupportedFeatures...)
+	features = append(features, clusterFeatureMux)
+	if c.clusterForwardingSigning {
+		features = append(features, requestutil.FeatureSigning)
+	}
+	return features
+}
+
+// clusterForwardingSigningKey derives the key used to sign forwarded
+// requests from the barrier encryption key of the given term, or of the
+// active term if it is zero. Unlike the cluster TLS key, which the active
+// node hands to standbys in its advertisement, the barrier keyring is only
+// available to unsealed nodes, so a forged request requires more than the
+// credentials of the cluster connection. Standbys sign with the term they
+// knew when connecting, which the active node can still derive after a
+// rotation.
+func (c *Core) clusterForwardingSigningKey(term uint32) ([]byte, uint32, error) {
+	return c.barrier.DeriveKey(term, []byte("vault-request-forwarding-signing"))
+}
+
+// verifyForwardedRequests wraps the cluster handler, rejecting forwarded
+// requests that are not signed with the forwarding signing key
+func (c *Core) verifyForwardedRequests(handler http.Handler) http.Handler {
+	verifier := requestutil.NewSignatureVerifier(0)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// The key ID is the barrier key term
+		term, err := strconv.ParseUint(requestutil.SigningKeyID(req), 10, 32)
+		if err != nil || term == 0 {
+			err = requestutil.UnauthorizedRequestError{Err: "forwarded request is not signed with a known key"}
+		} else {
+			var key []byte
+			key, _, err = c.clusterForwardingSigningKey(uint32(term))
+			if err == nil {
+				err = verifier.Verify(req, key, forwardedRequestParseConfig)
+			}
+		}
+		if err != nil {
+			c.logger.Printf("[ERR] core/verifyForwardedRequests: rejecting forwarded request from %s: %v", req.RemoteAddr, err)
+			respondForwardingError(w, err)
+			return
+		}
+		handler.ServeHTTP(w, req)
+	})
+}
+
+// respondForwardingError writes an error in response to a forwarded request
+func respondForwardingError(w http.ResponseWriter, err error) {
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(requestutil.ErrorStatusCode(err))
+
+	type errorResponse struct {
+		Errors []string
+	}
+	resp := &errorResponse{
+		Errors: []string{
+			err.Error(),
+		},
+	}
+
+	enc := json.NewEncoder(w)
+	enc.Encode(resp)
+}
@@ -0,0 +1,217 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/helper/requestutil"
+)
+
+const (
+	// The largest request body that is batched. Larger requests are
+	// forwarded individually.
+	clusterBatchMaxBodySize = 4 * 1024
+
+	// The maximum number of requests in a batch. A batch is sent as soon as
+	// it is full.
+	clusterBatchMaxRequests = 64
+
+	// How long the first request in a batch waits for others to join it
+	clusterBatchWait = 2 * time.Millisecond
+
+	// How long a batch may take to be answered by the active node
+	clusterBatchTimeout = 30 * time.Second
+)
+
+var (
+	errBatchMissingResponse = errors.New("active node did not respond to the batched request")
+	errBatcherClosed        = errors.New("request forwarding connection has been closed")
+)
+
+// forwardingBatcher coalesces small requests forwarded by a standby within
+// a short window into a single request to the active node, which reduces
+// per-request overhead when many small requests, such as token lookups,
+// arrive at once
+type forwardingBatcher struct {
+	client *http.Client
+	addr   string
+	config *requestutil.ForwardingConfig
+	logger *log.Logger
+
+	// Cancelled when the batcher is closed, aborting batches in flight
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	l       sync.Mutex
+	pending []*batchedForward
+	timer   *time.Timer
+	nextID  uint64
+	closed  bool
+}
+
+type batchedForward struct {
+	req    *requestutil.BatchedRequest
+	respCh chan batchedForwardResult
+}
+
+type batchedForwardResult struct {
+	resp *requestutil.ForwardedResponse
+	err  error
+}
+
+func newForwardingBatcher(client *http.Client, addr string, config *requestutil.ForwardingConfig, logger *log.Logger) *forwardingBatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &forwardingBatcher{
+		client: client,
+		addr:   addr,
+		config: config,
+		logger: logger,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// close stops the batcher when the connection to the active node is
+// replaced. Pending requests fail, as do batches in flight and any request
+// forwarded afterwards, so that nothing is sent over a stale connection.
+func (b *forwardingBatcher) close() {
+	b.l.Lock()
+	b.closed = true
+	batch := b.takeLocked()
+	b.l.Unlock()
+
+	b.cancel()
+	for _, f := range batch {
+		f.respCh <- batchedForwardResult{err: errBatcherClosed}
+	}
+}
+
+// canBatch returns whether the given request is small enough to be batched
+func (b *forwardingBatcher) canBatch(req *http.Request) bool {
+	return req.ContentLength >= 0 && req.ContentLength <= clusterBatchMaxBodySize
+}
+
+// Forward adds the request to the current batch and waits for its response
+func (b *forwardingBatcher) Forward(req *http.Request) (*requestutil.ForwardedResponse, error) {
+	// The body is read up front, since the batch may be sent after the
+	// request's handler has given up on it
+	if req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	f := &batchedForward{
+		req: &requestutil.BatchedRequest{
+			Request: req,
+		},
+		respCh: make(chan batchedForwardResult, 1),
+	}
+
+	b.l.Lock()
+	if b.closed {
+		b.l.Unlock()
+		return nil, errBatcherClosed
+	}
+	b.nextID++
+	f.req.ID = strconv.FormatUint(b.nextID, 10)
+	b.pending = append(b.pending, f)
+	switch {
+	case len(b.pending) >= clusterBatchMaxRequests:
+		batch := b.takeLocked()
+		go b.send(batch)
+	case b.timer == nil:
+		b.timer = time.AfterFunc(clusterBatchWait, b.flush)
+	}
+	b.l.Unlock()
+
+	select {
+	case result := <-f.respCh:
+		return result.resp, result.err
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	}
+}
+
+// takeLocked removes and returns the pending batch. The lock must be held.
+func (b *forwardingBatcher) takeLocked() []*batchedForward {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	batch := b.pending
+	b.pending = nil
+	return batch
+}
+
+// flush sends the pending batch once the batching window has passed
+func (b *forwardingBatcher) flush() {
+	b.l.Lock()
+	batch := b.takeLocked()
+	b.l.Unlock()
+
+	if len(batch) > 0 {
+		b.send(batch)
+	}
+}
+
+// send forwards the batch to the active node and hands each response to
+// the request waiting for it
+func (b *forwardingBatcher) send(batch []*batchedForward) {
+	defer metrics.MeasureSince([]string{"core", "forward_batch"}, time.Now())
+	metrics.AddSample([]string{"core", "forward_batch", "size"}, float32(len(batch)))
+
+	responses, err := b.do(batch)
+	if err != nil {
+		b.logger.Printf("[ERR] core/forwardingBatcher: error forwarding batch of %d requests: %v", len(batch), err)
+	}
+	for _, f := range batch {
+		switch {
+		case f.req.Err != nil:
+			f.respCh <- batchedForwardResult{err: f.req.Err}
+			continue
+		case err != nil:
+			f.respCh <- batchedForwardResult{err: err}
+			continue
+		}
+		resp, ok := responses[f.req.ID]
+		if !ok {
+			f.respCh <- batchedForwardResult{err: errBatchMissingResponse}
+			continue
+		}
+		f.respCh <- batchedForwardResult{resp: resp}
+	}
+}
+
+func (b *forwardingBatcher) do(batch []*batchedForward) (map[string]*requestutil.ForwardedResponse, error) {
+	reqs := make([]*requestutil.BatchedRequest, len(batch))
+	for i, f := range batch {
+		reqs[i] = f.req
+	}
+
+	freq, err := requestutil.GenerateForwardedBatch(reqs, b.addr, b.config)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(b.ctx, clusterBatchTimeout)
+	defer cancel()
+
+	resp, err := b.client.Do(freq.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return requestutil.ParseForwardedBatchResponse(resp)
+}
@@ -0,0 +1,180 @@
+package vault
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/helper/requestutil"
+)
+
+func TestClusterBatch_ForwardRequests(t *testing.T) {
+	for _, signing := range []bool{false, true} {
+		testClusterBatch_ForwardRequests(t, signing)
+	}
+}
+
+func testClusterBatch_ForwardRequests(t *testing.T, signing bool) {
+	var handled int32
+	handler := http.NewServeMux()
+	handler.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&handled, 1)
+		buf := new(bytes.Buffer)
+		buf.ReadFrom(req.Body)
+		w.Header().Set("X-Path", req.URL.Path)
+		w.WriteHeader(201)
+		w.Write(buf.Bytes())
+	})
+
+	cores := TestCluster(t, []http.Handler{handler, handler, handler}, &CoreConfig{
+		ClusterForwardingSigning:  signing,
+		ClusterForwardingBatching: true,
+	}, true)
+	for _, core := range cores {
+		defer core.CloseListeners()
+	}
+
+	TestWaitActive(t, cores[0].Core)
+
+	// Calling Leader refreshes the connection to the active node
+	standby := cores[1]
+	if isLeader, _, err := standby.Leader(); err != nil || isLeader {
+		t.Fatalf("expected standby, leader %t, err %v", isLeader, err)
+	}
+	standby.requestForwardingConnectionLock.RLock()
+	batcher := standby.requestForwardingConnection.batcher
+	standby.requestForwardingConnectionLock.RUnlock()
+	if batcher == nil {
+		t.Fatal("expected standby to batch forwarded requests")
+	}
+
+	start := atomic.LoadInt32(&handled)
+
+	const count = 100
+	var wg sync.WaitGroup
+	errCh := make(chan error, count)
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			path := fmt.Sprintf("/v1/secret/%d", i)
+			body := fmt.Sprintf(`{"value":%d}`, i)
+			req, err := http.NewRequest("PUT", "https://pushit.real.good:9281"+path, strings.NewReader(body))
+			if err != nil {
+				errCh <- err
+				return
+			}
+			req.Header.Add("X-Vault-Token", standby.Root)
+
+			resp, err := standby.ForwardRequest(req)
+			switch {
+			case err != nil:
+				errCh <- err
+			case resp.StatusCode != 201 || resp.Header.Get("X-Path") != path || string(resp.Body) != body:
+				errCh <- fmt.Errorf("bad response to %s: %d %v %s", path, resp.StatusCode, resp.Header, resp.Body)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errCh)
+	for err := range errCh {
+		t.Fatalf("signing=%t: %v", signing, err)
+	}
+
+	if n := atomic.LoadInt32(&handled) - start; n != count {
+		t.Fatalf("signing=%t: expected %d requests to be handled, got %d", signing, count, n)
+	}
+
+	// Large requests are forwarded individually
+	req, err := http.NewRequest("PUT", "https://pushit.real.good:9281/large", bytes.NewReader(make([]byte, 2*clusterBatchMaxBodySize)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batcher.canBatch(req) {
+		t.Fatal("large request should not be batched")
+	}
+	resp, err := standby.ForwardRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 201 || len(resp.Body) != 2*clusterBatchMaxBodySize {
+		t.Fatalf("bad response: %d, %d bytes", resp.StatusCode, len(resp.Body))
+	}
+}
+
+// blockingRoundTripper blocks every request until its context is done
+type blockingRoundTripper struct {
+	calls   int32
+	started chan struct{}
+}
+
+func (rt *blockingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if atomic.AddInt32(&rt.calls, 1) == 1 {
+		close(rt.started)
+	}
+	<-req.Context().Done()
+	return nil, req.Context().Err()
+}
+
+func TestClusterBatch_Close(t *testing.T) {
+	rt := &blockingRoundTripper{started: make(chan struct{})}
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	b := newForwardingBatcher(&http.Client{Transport: rt}, "https://bloopety.bloop:8201/cluster/local/forwarded-batch", &requestutil.ForwardingConfig{}, logger)
+
+	// A batch in flight is aborted
+	errCh := make(chan error, 1)
+	go func() {
+		req, _ := http.NewRequest("GET", "https://pushit.real.good:9281/v1/secret/foo", nil)
+		_, err := b.Forward(req)
+		errCh <- err
+	}()
+	select {
+	case <-rt.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("batch was never sent")
+	}
+	b.close()
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("batch in flight was not aborted")
+	}
+
+	// Nothing is sent once closed
+	req, _ := http.NewRequest("GET", "https://pushit.real.good:9281/v1/secret/foo", nil)
+	if _, err := b.Forward(req); err != errBatcherClosed {
+		t.Fatalf("expected closed error, got %v", err)
+	}
+	if n := atomic.LoadInt32(&rt.calls); n != 1 {
+		t.Fatalf("expected one batch to be sent, got %d", n)
+	}
+
+	// Pending requests fail and their timer is stopped
+	b = newForwardingBatcher(&http.Client{Transport: rt}, "https://bloopety.bloop:8201/cluster/local/forwarded-batch", &requestutil.ForwardingConfig{}, logger)
+	f := &batchedForward{
+		req:    &requestutil.BatchedRequest{ID: "1"},
+		respCh: make(chan batchedForwardResult, 1),
+	}
+	b.l.Lock()
+	b.pending = append(b.pending, f)
+	b.timer = time.AfterFunc(time.Hour, b.flush)
+	b.l.Unlock()
+	b.close()
+	if result := <-f.respCh; result.err != errBatcherClosed {
+		t.Fatalf("expected closed error, got %v", result.err)
+	}
+	if b.timer != nil || len(b.pending) != 0 {
+		t.Fatal("expected pending batch to be cleared")
+	}
+}
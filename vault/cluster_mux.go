@@ -0,0 +1,234 @@
+package vault
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/yamux"
+)
+
+const (
+	// The ALPN protocol used to establish a multiplexed forwarding session
+	// on the cluster port
+	clusterMuxALPN = "vault-mux"
+
+	// Advertised by active nodes that accept multiplexed forwarding sessions
+	clusterFeatureMux = "mux"
+
+	// The maximum number of streams a standby will have open to the active
+	// node at once. Requests beyond this wait for a stream to be released,
+	// which provides backpressure when the active node falls behind.
+	clusterMuxMaxStreams = 256
+
+	// How long a forwarded request waits for a free stream before failing
+	clusterMuxStreamWait = 30 * time.Second
+
+	// How long to wait when establishing a new session
+	clusterMuxDialTimeout = 10 * time.Second
+)
+
+func clusterMuxConfig() *yamux.Config {
+	config := yamux.DefaultConfig()
+	config.AcceptBacklog = clusterMuxMaxStreams
+	return config
+}
+
+// serveClusterMux is used as the TLSNextProto handler for clusterMuxALPN on
+// the cluster listeners. Each stream a standby opens within the session is
+// served as an ordinary HTTP/1.1 connection by the cluster handler. Sessions
+// are closed when shutdownCh is closed, since they outlive the listener that
+// accepted them.
+func serveClusterMux(logger *log.Logger, shutdownCh chan struct{}) func(*http.Server, *tls.Conn, http.Handler) {
+	return func(_ *http.Server, conn *tls.Conn, handler http.Handler) {
+		session, err := yamux.Server(conn, clusterMuxConfig())
+		if err != nil {
+			logger.Printf("[ERR] core/serveClusterMux: error creating session: %v", err)
+			conn.Close()
+			return
+		}
+		defer session.Close()
+
+		doneCh := make(chan struct{})
+		defer close(doneCh)
+		go func() {
+			select {
+			case <-shutdownCh:
+				session.Close()
+			case <-doneCh:
+			}
+		}()
+
+		logger.Printf("[TRACE] core/serveClusterMux: accepted forwarding session from %s", conn.RemoteAddr())
+		server := &http.Server{
+			Handler: handler,
+		}
+		server.Serve(session)
+	}
+}
+
+// clusterMuxDialer maintains a single TLS connection to the active node,
+// multiplexed with yamux, and hands out streams on it to an http.Transport.
+// This avoids connection and TLS setup for each forwarded request. A new
+// session is established transparently if the current one fails.
+type clusterMuxDialer struct {
+	addr      string
+	tlsConfig *tls.Config
+	logger    *log.Logger
+
+	sessionLock sync.Mutex
+	session     *yamux.Session
+
+	// Semaphore limiting the number of open streams
+	streams chan struct{}
+}
+
+func newClusterMuxDialer(clusterAddr string, tlsConfig *tls.Config, logger *log.Logger) (*clusterMuxDialer, error) {
+	u, err := url.Parse(clusterAddr)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing cluster address: %v", err)
+	}
+
+	muxTLSConfig := cloneTLSConfig(tlsConfig)
+	muxTLSConfig.NextProtos = []string{clusterMuxALPN}
+
+	return &clusterMuxDialer{
+		addr:      u.Host,
+		tlsConfig: muxTLSConfig,
+		logger:    logger,
+		streams:   make(chan struct{}, clusterMuxMaxStreams),
+	}, nil
+}
+
+// cloneTLSConfig returns a shallow copy of the configuration. tls.Config
+// cannot be copied by value as it contains a mutex, and has no Clone method
+// in the Go versions supported.
+func cloneTLSConfig(c *tls.Config) *tls.Config {
+	return &tls.Config{
+		Rand:                        c.Rand,
+		Time:                        c.Time,
+		Certificates:                c.Certificates,
+		NameToCertificate:           c.NameToCertificate,
+		GetCertificate:              c.GetCertificate,
+		RootCAs:                     c.RootCAs,
+		NextProtos:                  c.NextProtos,
+		ServerName:                  c.ServerName,
+		ClientAuth:                  c.ClientAuth,
+		ClientCAs:                   c.ClientCAs,
+		InsecureSkipVerify:          c.InsecureSkipVerify,
+		CipherSuites:                c.CipherSuites,
+		PreferServerCipherSuites:    c.PreferServerCipherSuites,
+		SessionTicketsDisabled:      c.SessionTicketsDisabled,
+		SessionTicketKey:            c.SessionTicketKey,
+		ClientSessionCache:          c.ClientSessionCache,
+		MinVersion:                  c.MinVersion,
+		MaxVersion:                  c.MaxVersion,
+		CurvePreferences:            c.CurvePreferences,
+		DynamicRecordSizingDisabled: c.DynamicRecordSizingDisabled,
+		Renegotiation:               c.Renegotiation,
+	}
+}
+
+// DialTLS opens a new stream on the session, establishing the session first
+// if necessary. It is suitable for use as http.Transport.DialTLS since the
+// session itself is already secured.
+func (m *clusterMuxDialer) DialTLS(network, addr string) (net.Conn, error) {
+	select {
+	case m.streams <- struct{}{}:
+	case <-time.After(clusterMuxStreamWait):
+		return nil, fmt.Errorf("timed out waiting for a forwarding stream")
+	}
+
+	session, err := m.getSession()
+	if err != nil {
+		<-m.streams
+		return nil, err
+	}
+
+	stream, err := session.Open()
+	if err != nil {
+		<-m.streams
+		return nil, err
+	}
+
+	return &clusterMuxStream{
+		Conn:    stream,
+		release: func() { <-m.streams },
+	}, nil
+}
+
+func (m *clusterMuxDialer) getSession() (*yamux.Session, error) {
+	m.sessionLock.Lock()
+	defer m.sessionLock.Unlock()
+
+	if m.session != nil && !m.session.IsClosed() {
+		return m.session, nil
+	}
+
+	conn, err := net.DialTimeout("tcp", m.addr, clusterMuxDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	// The session lock is held, so an active node that accepts the
+	// connection but never completes the handshake must not block the
+	// other requests forever
+	if err := conn.SetDeadline(time.Now().Add(clusterMuxDialTimeout)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	tlsConn := tls.Client(conn, m.tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if tlsConn.ConnectionState().NegotiatedProtocol != clusterMuxALPN {
+		tlsConn.Close()
+		return nil, fmt.Errorf("active node did not negotiate a multiplexed session")
+	}
+
+	session, err := yamux.Client(tlsConn, clusterMuxConfig())
+	if err != nil {
+		tlsConn.Close()
+		return nil, err
+	}
+
+	m.logger.Printf("[TRACE] core/clusterMuxDialer: established forwarding session to %s", m.addr)
+	m.session = session
+	return session, nil
+}
+
+// Close tears down the current session, if any
+func (m *clusterMuxDialer) Close() error {
+	m.sessionLock.Lock()
+	defer m.sessionLock.Unlock()
+
+	if m.session == nil {
+		return nil
+	}
+	err := m.session.Close()
+	m.session = nil
+	return err
+}
+
+// clusterMuxStream releases its slot in the dialer's semaphore when closed
+type clusterMuxStream struct {
+	net.Conn
+	release   func()
+	closeOnce sync.Once
+}
+
+func (s *clusterMuxStream) Close() error {
+	err := s.Conn.Close()
+	s.closeOnce.Do(s.release)
+	return err
+}
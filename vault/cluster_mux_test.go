@@ -0,0 +1,265 @@
+package vault
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testClusterMuxTLSConfig(t *testing.T) *tls.Config {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(certBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{
+			tls.Certificate{
+				Certificate: [][]byte{certBytes},
+				PrivateKey:  key,
+			},
+		},
+		RootCAs:    pool,
+		ServerName: "127.0.0.1",
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		ClientCAs:  pool,
+		NextProtos: []string{"h2", clusterMuxALPN},
+	}
+}
+
+func testClusterMuxServer(t *testing.T, tlsConfig *tls.Config, shutdownCh chan struct{}) (net.Listener, *int32) {
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sessions int32
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	serveMux := serveClusterMux(logger, shutdownCh)
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			w.Write(body)
+		}),
+		TLSNextProto: map[string]func(*http.Server, *tls.Conn, http.Handler){
+			clusterMuxALPN: func(s *http.Server, c *tls.Conn, h http.Handler) {
+				atomic.AddInt32(&sessions, 1)
+				serveMux(s, c, h)
+			},
+		},
+	}
+	go server.Serve(ln)
+
+	return ln, &sessions
+}
+
+func TestClusterMux_ForwardRequests(t *testing.T) {
+	tlsConfig := testClusterMuxTLSConfig(t)
+	shutdownCh := make(chan struct{})
+	ln, sessions := testClusterMuxServer(t, tlsConfig, shutdownCh)
+	defer ln.Close()
+	defer close(shutdownCh)
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	mux, err := newClusterMuxDialer("https://"+ln.Addr().String(), tlsConfig, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tp := &http.Transport{
+		TLSClientConfig:     tlsConfig,
+		DialTLS:             mux.DialTLS,
+		MaxIdleConnsPerHost: clusterMuxMaxStreams,
+	}
+	conn := &activeConnection{
+		Client:      &http.Client{Transport: tp},
+		clusterAddr: "https://" + ln.Addr().String(),
+		mux:         mux,
+	}
+	defer conn.close()
+
+	var wg sync.WaitGroup
+	errCh := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, err := conn.Get(conn.clusterAddr + "/")
+			if err != nil {
+				errCh <- err
+				return
+			}
+			ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+	close(errCh)
+	for err := range errCh {
+		t.Fatal(err)
+	}
+
+	if n := atomic.LoadInt32(sessions); n != 1 {
+		t.Fatalf("expected a single session, got %d", n)
+	}
+
+	// Closing the session should result in a new one being established
+	conn.close()
+	resp, err := conn.Get(conn.clusterAddr + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if n := atomic.LoadInt32(sessions); n != 2 {
+		t.Fatalf("expected a second session, got %d", n)
+	}
+}
+
+func TestClusterMux_Shutdown(t *testing.T) {
+	tlsConfig := testClusterMuxTLSConfig(t)
+	shutdownCh := make(chan struct{})
+	ln, _ := testClusterMuxServer(t, tlsConfig, shutdownCh)
+	defer ln.Close()
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	mux, err := newClusterMuxDialer("https://"+ln.Addr().String(), tlsConfig, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mux.Close()
+
+	session, err := mux.getSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	close(shutdownCh)
+	for i := 0; i < 50 && !session.IsClosed(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !session.IsClosed() {
+		t.Fatal("expected session to be closed on shutdown")
+	}
+}
+
+func TestClusterMux_NoNegotiation(t *testing.T) {
+	tlsConfig := testClusterMuxTLSConfig(t)
+	serverConfig := cloneTLSConfig(tlsConfig)
+	serverConfig.NextProtos = []string{"h2"}
+	ln, _ := testClusterMuxServer(t, serverConfig, make(chan struct{}))
+	defer ln.Close()
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	mux, err := newClusterMuxDialer("https://"+ln.Addr().String(), tlsConfig, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mux.DialTLS("tcp", ln.Addr().String()); err == nil {
+		t.Fatal("expected error when the server does not negotiate a session")
+	}
+	if len(mux.streams) != 0 {
+		t.Fatalf("expected stream slot to be released, %d held", len(mux.streams))
+	}
+}
+
+func TestClusterMux_HandshakeTimeout(t *testing.T) {
+	// The listener accepts connections but never answers the handshake
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	mux, err := newClusterMuxDialer("https://"+ln.Addr().String(), testClusterMuxTLSConfig(t), logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := mux.getSession()
+		errCh <- err
+	}()
+	select {
+	case err := <-errCh:
+		if err == nil {
+			t.Fatal("expected error")
+		}
+	case <-time.After(clusterMuxDialTimeout + 5*time.Second):
+		t.Fatal("handshake did not time out")
+	}
+}
+
+func TestClusterMux_Negotiated(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/core1", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Core-ID", "core1")
+		w.WriteHeader(201)
+		w.Write([]byte("core1"))
+	})
+
+	cores := TestCluster(t, []http.Handler{handler, handler, handler}, nil, true)
+	for _, core := range cores {
+		defer core.CloseListeners()
+	}
+
+	TestWaitActive(t, cores[0].Core)
+	testCluster_ForwardRequests(t, cores[1], "core1")
+
+	cores[1].requestForwardingConnectionLock.RLock()
+	mux := cores[1].requestForwardingConnection.mux
+	cores[1].requestForwardingConnectionLock.RUnlock()
+	if mux == nil {
+		t.Fatal("expected standby to forward over a multiplexed session")
+	}
+
+	mux.sessionLock.Lock()
+	session := mux.session
+	mux.sessionLock.Unlock()
+	if session == nil || session.IsClosed() {
+		t.Fatal("expected an open multiplexed session")
+	}
+}
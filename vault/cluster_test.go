@@ -160,16 +160,19 @@ func TestCluster_ForwardRequests(t *testing.T) {
 
 	handler1 := http.NewServeMux()
 	handler1.HandleFunc("/core1", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Core-ID", "core1")
 		w.WriteHeader(201)
 		w.Write([]byte("core1"))
 	})
 	handler2 := http.NewServeMux()
 	handler2.HandleFunc("/core2", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Core-ID", "core2")
 		w.WriteHeader(202)
 		w.Write([]byte("core2"))
 	})
 	handler3 := http.NewServeMux()
 	handler3.HandleFunc("/core3", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Core-ID", "core3")
 		w.WriteHeader(203)
 		w.Write([]byte("core3"))
 	})
@@ -296,6 +299,46 @@ func TestCluster_ForwardRequests(t *testing.T) {
 	testCluster_ForwardRequests(t, cores[1], "core3")
 }
 
+func TestCluster_ForwardRequestsSigned(t *testing.T) {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/core1", func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("X-Core-ID", "core1")
+		w.WriteHeader(201)
+		w.Write([]byte("core1"))
+	})
+
+	cores := TestCluster(t, []http.Handler{handler, handler, handler}, &CoreConfig{
+		ClusterForwardingSigning: true,
+	}, true)
+	for _, core := range cores {
+		defer core.CloseListeners()
+	}
+
+	TestWaitActive(t, cores[0].Core)
+
+	testCluster_ForwardRequests(t, cores[1], "core1")
+	testCluster_ForwardRequests(t, cores[2], "core1")
+
+	// The standbys should have picked up the requirement from the
+	// advertisement
+	cores[1].requestForwardingConnectionLock.RLock()
+	signingKey := cores[1].requestForwardingConnection.signingKey
+	signingKeyID := cores[1].requestForwardingConnection.signingKeyID
+	cores[1].requestForwardingConnectionLock.RUnlock()
+	if len(signingKey) == 0 || signingKeyID != "1" {
+		t.Fatal("expected standby to sign forwarded requests")
+	}
+
+	// The key is derived from the barrier keyring, not the cluster key
+	activeKey, _, err := cores[0].barrier.DeriveKey(1, []byte("vault-request-forwarding-signing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(signingKey, activeKey) {
+		t.Fatal("expected the standby and active node to derive the same key")
+	}
+}
+
 func testCluster_ForwardRequests(t *testing.T, c *TestClusterCore, remoteCoreID string) {
 	standby, err := c.Standby()
 	if err != nil {
@@ -328,15 +371,15 @@ func testCluster_ForwardRequests(t *testing.T, c *TestClusterCore, remoteCoreID
 	if resp == nil {
 		t.Fatal("nil resp")
 	}
-	defer resp.Body.Close()
 
-	body := bytes.NewBuffer(nil)
-	body.ReadFrom(resp.Body)
-
-	if body.String() != remoteCoreID {
-		t.Fatalf("expected %s, got %s", remoteCoreID, body.String())
+	body := string(resp.Body)
+	if body != remoteCoreID {
+		t.Fatalf("expected %s, got %s", remoteCoreID, body)
+	}
+	if resp.Header.Get("X-Core-ID") != remoteCoreID {
+		t.Fatalf("expected header %s, got %s", remoteCoreID, resp.Header.Get("X-Core-ID"))
 	}
-	switch body.String() {
+	switch body {
 	case "core1":
 		if resp.StatusCode != 201 {
 			t.Fatal("bad response")
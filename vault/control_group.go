@@ -0,0 +1,426 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/helper/duration"
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// coreControlGroupPath is used to store the pending control group
+	// requests, one entry per request keyed by the accessor of its
+	// wrapping token
+	coreControlGroupPath = "core/control-group/"
+
+	// controlGroupTokenMeta is the metadata key marking the wrapping tokens
+	// of control group requests
+	controlGroupTokenMeta = "control_group"
+
+	// defaultControlGroupTTL is how long a control group request stays
+	// pending if the control group sets no TTL
+	defaultControlGroupTTL = 24 * time.Hour
+)
+
+// ControlGroup holds the requests to a path until enough members of the
+// given identity groups approve them. The approved response is retrieved
+// by unwrapping the token returned for the request.
+type ControlGroup struct {
+	// GroupNames are the names of the identity groups whose members may
+	// approve the requests
+	GroupNames []string `hcl:"group_names" json:"group_names"`
+
+	// Approvals is the number of distinct entities that must approve a
+	// request
+	Approvals int `hcl:"approvals" json:"approvals"`
+
+	// TTL is how long a request stays pending, which is the TTL of its
+	// wrapping token
+	TTL    time.Duration `hcl:"-" json:"ttl"`
+	TTLHCL string        `hcl:"ttl" json:"-"`
+}
+
+// validate parses the TTL, defaults the number of approvals and checks
+// that the control group can be satisfied
+func (g *ControlGroup) validate() error {
+	if len(g.GroupNames) == 0 {
+		return fmt.Errorf("control_group requires group_names")
+	}
+	if g.Approvals < 0 {
+		return fmt.Errorf("control_group approvals cannot be negative")
+	}
+	if g.Approvals == 0 {
+		g.Approvals = 1
+	}
+
+	if g.TTLHCL != "" {
+		ttl, err := duration.ParseDurationSecond(g.TTLHCL)
+		if err != nil {
+			return fmt.Errorf("invalid control_group ttl: %v", err)
+		}
+		if ttl < 0 {
+			return fmt.Errorf("control_group ttl cannot be negative")
+		}
+		g.TTL = ttl
+	}
+	if g.TTL == 0 {
+		g.TTL = defaultControlGroupTTL
+	}
+	return nil
+}
+
+// mergeControlGroups combines the control groups of two policies for the
+// same path, either of which may be nil. A request is held if either
+// policy holds it, and the control group requiring the most approvals
+// applies.
+func mergeControlGroups(a, b *ControlGroup) *ControlGroup {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	case b.Approvals > a.Approvals:
+		return b
+	default:
+		return a
+	}
+}
+
+// ControlGroupRequest is a request held by a control group
+type ControlGroupRequest struct {
+	// Accessor is the accessor of the wrapping token of the request
+	Accessor string `json:"accessor"`
+
+	// The original request, which is run with the token of the requester
+	// once approved
+	Operation   logical.Operation      `json:"operation"`
+	Path        string                 `json:"path"`
+	Data        map[string]interface{} `json:"data"`
+	WrapTTL     time.Duration          `json:"wrap_ttl"`
+	ClientToken string                 `json:"client_token"`
+
+	// EntityID is the entity of the requester, if any, which cannot
+	// approve its own request
+	EntityID string `json:"entity_id"`
+
+	ControlGroup   *ControlGroup                `json:"control_group"`
+	Authorizations []*ControlGroupAuthorization `json:"authorizations"`
+
+	CreationTime time.Time `json:"creation_time"`
+	ExpireTime   time.Time `json:"expire_time"`
+}
+
+// ControlGroupAuthorization is the approval of a request by an entity
+type ControlGroupAuthorization struct {
+	EntityID string    `json:"entity_id"`
+	Time     time.Time `json:"time"`
+}
+
+// approved returns whether enough entities approved the request
+func (r *ControlGroupRequest) approved() bool {
+	return len(r.Authorizations) >= r.ControlGroup.Approvals
+}
+
+// authorizedBy returns whether the entity approved the request
+func (r *ControlGroupRequest) authorizedBy(entityID string) bool {
+	for _, authz := range r.Authorizations {
+		if authz.EntityID == entityID {
+			return true
+		}
+	}
+	return false
+}
+
+// controlGroupRequiredError is returned by checkToken when the request is
+// allowed, but must be approved through the control group before it is
+// run
+type controlGroupRequiredError struct {
+	controlGroup *ControlGroup
+}
+
+func (e *controlGroupRequiredError) Error() string {
+	return "request requires control group approval"
+}
+
+// controlGroupApprovedKey is the context key marking approved control
+// group requests, which are run without being held again
+type controlGroupApprovedKey struct{}
+
+// controlGroupApproved returns whether the request is an approved control
+// group request
+func controlGroupApproved(req *logical.Request) bool {
+	approved, _ := req.Context().Value(controlGroupApprovedKey{}).(bool)
+	return approved
+}
+
+// isControlGroupUnwrap returns whether the request unwraps the token of a
+// control group request
+func isControlGroupUnwrap(req *logical.Request, te *TokenEntry) bool {
+	return te != nil && te.Meta[controlGroupTokenMeta] != "" &&
+		req.Operation == logical.ReadOperation && req.Path == "cubbyhole/response"
+}
+
+// handleControlGroupRequest holds a request under a control group. It
+// returns a wrapping token, whose accessor is given to the approvers and
+// which is unwrapped to run the request once approved.
+func (c *Core) handleControlGroupRequest(req *logical.Request, auth *logical.Auth, te *TokenEntry, cg *ControlGroup) (*logical.Response, *logical.Auth, error) {
+	if err := c.auditBroker.LogRequest(auth, req, nil); err != nil {
+		c.logger.Printf("[ERR] core: failed to audit request with path (%s): %v",
+			req.Path, err)
+		return nil, auth, ErrInternalError
+	}
+
+	creationTime := time.Now()
+	wte := TokenEntry{
+		Path:           req.Path,
+		Policies:       []string{cubbyholeResponseWrappingPolicyName},
+		Meta:           map[string]string{controlGroupTokenMeta: "true"},
+		CreationTime:   creationTime.Unix(),
+		TTL:            cg.TTL,
+		NumUses:        1,
+		ExplicitMaxTTL: cg.TTL,
+	}
+	if err := c.tokenStore.create(&wte); err != nil {
+		c.logger.Printf("[ERR] core: failed to create control group wrapping token: %v", err)
+		return nil, auth, ErrInternalError
+	}
+
+	cgReq := &ControlGroupRequest{
+		Accessor:     wte.Accessor,
+		Operation:    req.Operation,
+		Path:         req.Path,
+		Data:         req.Data,
+		WrapTTL:      req.WrapTTL,
+		ClientToken:  req.ClientToken,
+		EntityID:     te.EntityID,
+		ControlGroup: cg,
+		CreationTime: creationTime,
+		ExpireTime:   creationTime.Add(cg.TTL),
+	}
+	if err := c.persistControlGroupRequest(cgReq); err != nil {
+		c.tokenStore.Revoke(wte.ID)
+		return nil, auth, ErrInternalError
+	}
+
+	wrapAuth := &logical.Auth{
+		ClientToken: wte.ID,
+		Policies:    wte.Policies,
+		LeaseOptions: logical.LeaseOptions{
+			TTL:       wte.TTL,
+			Renewable: false,
+		},
+	}
+	if err := c.expiration.RegisterAuth(wte.Path, wrapAuth); err != nil {
+		// Revoke since it's not yet being tracked for expiration
+		c.tokenStore.Revoke(wte.ID)
+		c.deleteControlGroupRequest(cgReq.Accessor)
+		c.logger.Printf("[ERR] core: failed to register control group wrapping token lease "+
+			"(request path: %s): %v", req.Path, err)
+		return nil, auth, ErrInternalError
+	}
+
+	return &logical.Response{
+		WrapInfo: &logical.WrapInfo{
+			TTL:          cg.TTL,
+			Token:        wte.ID,
+			Accessor:     wte.Accessor,
+			CreationTime: creationTime,
+		},
+	}, auth, nil
+}
+
+// handleControlGroupUnwrap runs an approved control group request, when
+// its wrapping token is unwrapped, and returns its response as if it had
+// been wrapped. The wrapping token is only used up once the request is
+// approved, so that it can be unwrapped after checking too early.
+func (c *Core) handleControlGroupUnwrap(req *logical.Request, auth *logical.Auth, te *TokenEntry) (retResp *logical.Response, retAuth *logical.Auth, retErr error) {
+	if err := c.auditBroker.LogRequest(auth, req, nil); err != nil {
+		c.logger.Printf("[ERR] core: failed to audit request with path (%s): %v",
+			req.Path, err)
+		return nil, auth, ErrInternalError
+	}
+
+	cgReq, err := c.ControlGroupRequest(te.Accessor)
+	if err != nil {
+		return nil, auth, ErrInternalError
+	}
+	if cgReq == nil {
+		return logical.ErrorResponse("control group request not found"), auth, logical.ErrInvalidRequest
+	}
+	if !cgReq.approved() {
+		return logical.ErrorResponse("control group request has not been approved"), auth, logical.ErrInvalidRequest
+	}
+
+	te, err = c.tokenStore.UseToken(te)
+	if err != nil {
+		c.logger.Printf("[ERR] core: failed to use token: %v", err)
+		return nil, nil, ErrInternalError
+	}
+	if te == nil {
+		return nil, nil, errutil.WithCode(errutil.CodeInvalidToken, logical.ErrPermissionDenied)
+	}
+	if te.NumUses == -1 {
+		defer func(id string) {
+			if err := c.tokenStore.Revoke(id); err != nil {
+				c.logger.Printf("[ERR] core: failed to revoke token: %v", err)
+				retResp = nil
+				retErr = multierror.Append(retErr, ErrInternalError)
+			}
+		}(te.ID)
+	}
+	if err := c.deleteControlGroupRequest(cgReq.Accessor); err != nil {
+		return nil, auth, ErrInternalError
+	}
+
+	// Run the request with the token of the requester, which must still
+	// be allowed to make it
+	origReq := &logical.Request{
+		ID:          req.ID,
+		Operation:   cgReq.Operation,
+		Path:        cgReq.Path,
+		Data:        cgReq.Data,
+		WrapTTL:     cgReq.WrapTTL,
+		ClientToken: cgReq.ClientToken,
+	}
+	origReq.SetContext(context.WithValue(req.Context(), controlGroupApprovedKey{}, true))
+	resp, _, err := c.handleRequest(origReq)
+	if err != nil {
+		return resp, auth, err
+	}
+	if resp == nil {
+		resp = &logical.Response{}
+	}
+
+	// Wrap the response again if the requester asked for it
+	if resp.WrapInfo != nil && resp.WrapInfo.TTL != 0 {
+		cubbyResp, err := c.wrapInCubbyhole(origReq, resp)
+		if cubbyResp != nil || err != nil {
+			return cubbyResp, auth, err
+		}
+		resp = &logical.Response{WrapInfo: resp.WrapInfo}
+	}
+
+	marshaledResponse, err := marshalWrappedResponse(origReq, resp)
+	if err != nil {
+		c.logger.Printf("[ERR] core: failed to marshal control group response: %v", err)
+		return nil, auth, ErrInternalError
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"response": marshaledResponse,
+		},
+	}, auth, nil
+}
+
+// ControlGroupRequest returns a pending control group request by the
+// accessor of its wrapping token, or nil if there is none or it expired
+func (c *Core) ControlGroupRequest(accessor string) (*ControlGroupRequest, error) {
+	if accessor == "" {
+		return nil, nil
+	}
+	raw, err := c.barrier.Get(coreControlGroupPath + accessor)
+	if err != nil {
+		c.logger.Printf("[ERR] core: failed to read control group request: %v", err)
+		return nil, err
+	}
+	if raw == nil {
+		return nil, nil
+	}
+
+	var cgReq ControlGroupRequest
+	if err := json.Unmarshal(raw.Value, &cgReq); err != nil {
+		c.logger.Printf("[ERR] core: failed to decode control group request: %v", err)
+		return nil, err
+	}
+
+	// Expired requests are removed lazily, as their wrapping token
+	// already expired
+	if time.Now().After(cgReq.ExpireTime) {
+		if err := c.deleteControlGroupRequest(accessor); err != nil {
+			return nil, err
+		}
+		return nil, nil
+	}
+	return &cgReq, nil
+}
+
+// AuthorizeControlGroupRequest records the approval of a pending control
+// group request by an entity, which must be a member of one of the groups
+// of the control group, and cannot be the requester
+func (c *Core) AuthorizeControlGroupRequest(accessor, entityID string) (*ControlGroupRequest, error) {
+	c.controlGroupLock.Lock()
+	defer c.controlGroupLock.Unlock()
+
+	cgReq, err := c.ControlGroupRequest(accessor)
+	if err != nil {
+		return nil, err
+	}
+	if cgReq == nil {
+		return nil, fmt.Errorf("control group request not found")
+	}
+
+	entity := c.identityStore.Entity(entityID)
+	if entity == nil {
+		return nil, logical.ErrPermissionDenied
+	}
+	if requester := c.identityStore.Entity(cgReq.EntityID); requester != nil && requester.ID == entity.ID {
+		return nil, fmt.Errorf("requesters cannot authorize their own requests")
+	}
+
+	member := false
+	groupIDs := c.identityStore.EntityGroupIDs(entity.ID)
+	for _, name := range cgReq.ControlGroup.GroupNames {
+		if group := c.identityStore.GroupByName(name); group != nil && strutil.StrListContains(groupIDs, group.ID) {
+			member = true
+			break
+		}
+	}
+	if !member {
+		return nil, logical.ErrPermissionDenied
+	}
+
+	if cgReq.authorizedBy(entity.ID) {
+		return cgReq, nil
+	}
+	cgReq.Authorizations = append(cgReq.Authorizations, &ControlGroupAuthorization{
+		EntityID: entity.ID,
+		Time:     time.Now(),
+	})
+	if err := c.persistControlGroupRequest(cgReq); err != nil {
+		return nil, err
+	}
+	return cgReq, nil
+}
+
+// persistControlGroupRequest stores a control group request
+func (c *Core) persistControlGroupRequest(cgReq *ControlGroupRequest) error {
+	buf, err := json.Marshal(cgReq)
+	if err != nil {
+		c.logger.Printf("[ERR] core: failed to encode control group request: %v", err)
+		return err
+	}
+	if err := c.barrier.Put(&Entry{
+		Key:   coreControlGroupPath + cgReq.Accessor,
+		Value: buf,
+	}); err != nil {
+		c.logger.Printf("[ERR] core: failed to persist control group request: %v", err)
+		return errwrap.Wrapf("failed to persist control group request: {{err}}", err)
+	}
+	return nil
+}
+
+// deleteControlGroupRequest removes a control group request
+func (c *Core) deleteControlGroupRequest(accessor string) error {
+	if err := c.barrier.Delete(coreControlGroupPath + accessor); err != nil {
+		c.logger.Printf("[ERR] core: failed to delete control group request: %v", err)
+		return err
+	}
+	return nil
+}
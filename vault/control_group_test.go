@@ -0,0 +1,225 @@
+package vault
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestPolicy_ParseControlGroup(t *testing.T) {
+	p, err := Parse(strings.TrimSpace(`
+path "secret/critical" {
+	capabilities = ["read"]
+	control_group = {
+		group_names = ["managers", "security"]
+		approvals = 2
+		ttl = "4h"
+	}
+}
+path "secret/sensitive" {
+	capabilities = ["read"]
+	control_group {
+		group_names = ["managers"]
+	}
+}
+`))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	cg := p.Paths[0].Permissions.ControlGroup
+	if len(cg.GroupNames) != 2 || cg.Approvals != 2 || cg.TTL != 4*time.Hour {
+		t.Fatalf("bad: %#v", cg)
+	}
+	cg = p.Paths[1].Permissions.ControlGroup
+	if len(cg.GroupNames) != 1 || cg.Approvals != 1 || cg.TTL != defaultControlGroupTTL {
+		t.Fatalf("bad: %#v", cg)
+	}
+
+	for _, rules := range []string{
+		`control_group = { approvals = 2 }`,
+		`control_group = { group_names = ["managers"], approvals = -1 }`,
+		`control_group = { group_names = ["managers"], ttl = "soon" }`,
+		`control_group = { group_names = ["managers"], quorum = 2 }`,
+	} {
+		_, err := Parse(`path "secret/critical" { capabilities = ["read"], ` + rules + ` }`)
+		if err == nil {
+			t.Fatalf("%s: expected error", rules)
+		}
+		if !strings.Contains(err.Error(), `path "secret/critical":`) {
+			t.Errorf("bad error: %s", err)
+		}
+	}
+}
+
+func TestACL_ControlGroup(t *testing.T) {
+	held, err := Parse(`path "secret/*" { capabilities = ["read"], control_group = { group_names = ["managers"], approvals = 2 } }`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	stricter, err := Parse(`path "secret/*" { capabilities = ["read"], control_group = { group_names = ["security"], approvals = 3 } }`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	open, err := Parse(`path "secret/*" { capabilities = ["read", "list"] }`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	acl, err := NewACL([]*Policy{open, held})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if cg := acl.ControlGroup("secret/foo"); cg == nil || cg.Approvals != 2 {
+		t.Fatalf("bad: %#v", cg)
+	}
+	if cg := acl.ControlGroup("sys/mounts"); cg != nil {
+		t.Fatalf("bad: %#v", cg)
+	}
+
+	acl, err = NewACL([]*Policy{held, stricter})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if cg := acl.ControlGroup("secret/foo"); cg == nil || cg.GroupNames[0] != "security" {
+		t.Fatalf("bad: %#v", cg)
+	}
+}
+
+func TestCore_ControlGroup(t *testing.T) {
+	c, _, root := testCoreIdentityLogin(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/auth/baz")
+	req.Data["type"] = "noop"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/policy/foo")
+	req.ClientToken = root
+	req.Data["rules"] = `
+path "secret/foo" {
+	capabilities = ["read"]
+	control_group = {
+		group_names = ["managers"]
+		approvals = 2
+	}
+}
+path "sys/control-group/authorize" {
+	capabilities = ["update"]
+}
+`
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "secret/foo")
+	req.ClientToken = root
+	req.Data["foo"] = "bar"
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Each mount ties its login to a distinct entity
+	requester := testCoreLogin(t, c, "auth/foo/login")
+	first := testCoreLogin(t, c, "auth/bar/login")
+	second := testCoreLogin(t, c, "auth/baz/login")
+	testCoreCreateGroup(t, c, root, map[string]interface{}{
+		"name":              "managers",
+		"member_entity_ids": first.EntityID + "," + second.EntityID,
+	})
+
+	req = logical.TestRequest(t, logical.ReadOperation, "secret/foo")
+	req.ClientToken = requester.ClientToken
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data != nil || resp.WrapInfo == nil || resp.WrapInfo.Token == "" || resp.WrapInfo.Accessor == "" {
+		t.Fatalf("bad: %#v", resp)
+	}
+	wrapInfo := resp.WrapInfo
+
+	unwrap := func() (*logical.Response, error) {
+		req := logical.TestRequest(t, logical.ReadOperation, "cubbyhole/response")
+		req.ClientToken = wrapInfo.Token
+		return c.HandleRequest(req)
+	}
+	authorize := func(token string) (*logical.Response, error) {
+		req := logical.TestRequest(t, logical.UpdateOperation, "sys/control-group/authorize")
+		req.ClientToken = token
+		req.Data["accessor"] = wrapInfo.Accessor
+		return c.HandleRequest(req)
+	}
+
+	// Unwrapping before approval does not use up the token
+	if _, err := unwrap(); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// Requesters and non-members cannot approve
+	if _, err := authorize(requester.ClientToken); err == nil {
+		t.Fatal("expected error")
+	}
+	testCoreMakeToken(t, c, root, "noentity", "", []string{"foo"})
+	if _, err := authorize("noentity"); err == nil {
+		t.Fatal("expected permission denied")
+	}
+
+	for i := 0; i < 2; i++ {
+		resp, err := authorize(first.ClientToken)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if resp.Data["approved"] != false {
+			t.Fatalf("bad: %#v", resp.Data)
+		}
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/control-group/request")
+	req.ClientToken = requester.ClientToken
+	req.Data["accessor"] = wrapInfo.Accessor
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["approved"] != false || resp.Data["request_path"] != "secret/foo" ||
+		resp.Data["request_entity_id"] != requester.EntityID ||
+		len(resp.Data["authorizations"].([]map[string]interface{})) != 1 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	resp, err = authorize(second.ClientToken)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["approved"] != true {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	resp, err = unwrap()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	var wrapped struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(resp.Data["response"].(string)), &wrapped); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if wrapped.Data["foo"] != "bar" {
+		t.Fatalf("bad: %#v", wrapped)
+	}
+
+	// The token is used up, and the request removed
+	if _, err := unwrap(); err == nil {
+		t.Fatal("expected error")
+	}
+	if cgReq, err := c.ControlGroupRequest(wrapInfo.Accessor); err != nil || cgReq != nil {
+		t.Fatalf("bad: %#v %v", cgReq, err)
+	}
+}
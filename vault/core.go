@@ -13,6 +13,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -21,9 +22,14 @@ import (
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/helper/cidrutil"
+	"github.com/hashicorp/vault/helper/compressutil"
 	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/logutil"
+	"github.com/hashicorp/vault/helper/metricsutil"
 	"github.com/hashicorp/vault/helper/mlock"
+	"github.com/hashicorp/vault/helper/requestutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/physical"
 	"github.com/hashicorp/vault/shamir"
@@ -53,16 +59,20 @@ const (
 	// leaderPrefixCleanDelay is how long to wait between deletions
 	// of orphaned leader keys, to prevent slamming the backend.
 	leaderPrefixCleanDelay = 200 * time.Millisecond
+
+	// DefaultMaxRequestSize is the default maximum size, in bytes, of the
+	// body of a request made over the HTTP API
+	DefaultMaxRequestSize = 32 * 1024 * 1024
 )
 
 var (
 	// ErrSealed is returned if an operation is performed on
 	// a sealed barrier. No operation is expected to succeed before unsealing
-	ErrSealed = errors.New("Vault is sealed")
+	ErrSealed = errutil.WithCode(errutil.CodeSealed, errors.New("Vault is sealed"))
 
 	// ErrStandby is returned if an operation is performed on
 	// a standby Vault. No operation is expected to succeed until active.
-	ErrStandby = errors.New("Vault is in standby mode")
+	ErrStandby = errutil.WithCode(errutil.CodeStandby, errors.New("Vault is in standby mode"))
 
 	// ErrAlreadyInit is returned if the core is already
 	// initialized. This prevents a re-initialization.
@@ -74,7 +84,7 @@ var (
 
 	// ErrInternalError is returned when we don't want to leak
 	// any information about an internal error
-	ErrInternalError = errors.New("internal error")
+	ErrInternalError = errutil.WithCode(errutil.CodeInternal, errors.New("internal error"))
 
 	// ErrHANotEnabled is returned if the operation only makes sense
 	// in an HA setting
@@ -115,6 +125,18 @@ type activeAdvertisement struct {
 	ClusterAddr      string           `json:"cluster_addr"`
 	ClusterCert      []byte           `json:"cluster_cert"`
 	ClusterKeyParams clusterKeyParams `json:"cluster_key_params"`
+
+	// The compression types the active node accepts for forwarded requests.
+	// Empty when advertised by a node that predates negotiation.
+	ForwardingCompression []string `json:"forwarding_compression,omitempty"`
+
+	// The payload encodings the active node accepts for forwarded requests.
+	// Empty when advertised by a node that predates negotiation.
+	ForwardingEncodings []string `json:"forwarding_encodings,omitempty"`
+
+	// Optional forwarding features the active node accepts, such as streamed
+	// request bodies
+	ForwardingFeatures []string `json:"forwarding_features,omitempty"`
 }
 
 // Core is used as the central manager of Vault activity. It is the primary point of
@@ -130,6 +152,40 @@ type Core struct {
 	// clusterAddr is the address we use for clustering
 	clusterAddr string
 
+	// clusterForwardingCompression is the preferred compression type for
+	// requests forwarded to the active node
+	clusterForwardingCompression string
+
+	// clusterForwardingSigning requires requests forwarded to this node to
+	// be signed when it is active
+	clusterForwardingSigning bool
+
+	// clusterForwardingBatching coalesces small requests forwarded to the
+	// active node into batches when this node is a standby
+	clusterForwardingBatching bool
+
+	// perfStandbyEnabled makes this node serve reads when it is a standby
+	perfStandbyEnabled bool
+
+	// perfStandbyPosition is the position in the write log of the active
+	// node this node caught up to as a performance standby
+	perfStandbyPosition walPosition
+
+	// storageCompression is the compression type used when persisting the
+	// mount tables. If empty, gzip is used.
+	storageCompression string
+
+	// maxRequestSize is the server-wide maximum size of a request body
+	maxRequestSize int64
+
+	// mlockStatus is the outcome of locking memory, or nil if mlock is
+	// disabled
+	mlockStatus *mlock.Status
+
+	// mlockWarnings are the problems found when locking memory that did
+	// not prevent startup because best-effort locking was requested
+	mlockWarnings []string
+
 	// physical backend is the un-trusted backend with durable data
 	physical physical.Backend
 
@@ -156,6 +212,7 @@ type Core struct {
 	sealed    bool
 
 	standby          bool
+	perfStandby      bool
 	standbyDoneCh    chan struct{}
 	standbyStopCh    chan struct{}
 	manualStepDownCh chan struct{}
@@ -179,6 +236,15 @@ type Core struct {
 	recoveryRekeyProgress [][]byte
 	rekeyLock             sync.RWMutex
 
+	// migrationSeal is the seal that the barrier can be migrated to, and
+	// the config and shares of a migration in progress. The shares are the
+	// unseal keys of the current seal, or its recovery keys if it supports
+	// them.
+	migrationSeal     Seal
+	migrationConfig   *sealMigrationConfig
+	migrationProgress [][]byte
+	migrationLock     sync.Mutex
+
 	// mounts is loaded after unseal since it is a protected
 	// configuration
 	mounts *MountTable
@@ -207,6 +273,124 @@ type Core struct {
 	// out into the configured audit backends
 	auditBroker *AuditBroker
 
+	// events is used to publish notifications of changes to subscribers
+	events *eventBroker
+
+	// admission limits the number of requests handled at once
+	admission *admissionController
+
+	// storageTimeouts bounds the operations of the physical backend. Nil if
+	// it is not configured.
+	storageTimeouts *physical.TimeoutBackend
+
+	// raft is the physical backend if it is the raft backend, which is
+	// bootstrapped on initialization and managed through sys/storage/raft
+	raft *physical.RaftBackend
+
+	// prometheusSink holds the telemetry served by sys/metrics. Nil if
+	// metrics are not exposed.
+	prometheusSink *metricsutil.PrometheusSink
+
+	// policyEngines are consulted for the requests the ACLs allow, and can
+	// deny them
+	policyEngines []PolicyEngine
+
+	// logRouter filters the log output and copies it to sinks. Nil if the
+	// log output cannot be reconfigured.
+	logRouter *logutil.Router
+
+	// corsConfig is the CORS configuration, which is loaded after unseal
+	// since it is a protected configuration
+	corsConfig *CORSConfig
+
+	// corsLock protects corsConfig
+	corsLock sync.RWMutex
+
+	// rotationConfig is the automatic key rotation policy and keyUsage the
+	// number of values encrypted with each key term, both loaded after
+	// unseal. keyUsageStoredTotal is the total usage last stored.
+	// rotationLock protects them.
+	rotationConfig      *KeyRotationConfig
+	keyUsage            map[uint32]uint64
+	keyUsageStoredTotal uint64
+	rotationLock        sync.Mutex
+
+	// rotationCh is used to stop the automatic key rotation
+	rotationCh chan struct{}
+
+	// snapshotConfigs and snapshotStatus are the automated snapshot
+	// configurations and their status by name, loaded after unseal. A map
+	// of configurations is never modified once in use; changes replace it
+	// instead. snapshotLock protects them.
+	snapshotConfigs map[string]*StorageSnapshotConfig
+	snapshotStatus  map[string]*StorageSnapshotStatus
+	snapshotLock    sync.Mutex
+
+	// snapshotStopCh is used to stop taking the automated snapshots, and
+	// snapshotDoneCh is closed once stopped
+	snapshotStopCh chan struct{}
+	snapshotDoneCh chan struct{}
+
+	// leaseQuotas and rateQuotas are the lease count and rate limit quotas
+	// by name, loaded after unseal. A map is never modified once in use;
+	// changes replace it instead.
+	leaseQuotas map[string]*LeaseCountQuota
+	rateQuotas  map[string]*RateLimitQuota
+
+	// quotaLock protects leaseQuotas and rateQuotas
+	quotaLock sync.RWMutex
+
+	// rateLimiter enforces the rate limit quotas
+	rateLimiter rateLimitQuotas
+
+	// endpointPolicies are the endpoint governing policies by name, loaded
+	// after unseal. A map is never modified once in use; changes replace it
+	// instead.
+	endpointPolicies   map[string]*EndpointPolicy
+	endpointPolicyLock sync.RWMutex
+
+	// mfaMethods and mfaEnforcements are the MFA methods and enforcements
+	// by name, loaded after unseal. A map is never modified once in use;
+	// changes replace it instead.
+	mfaMethods      map[string]*MFAMethod
+	mfaEnforcements map[string]*MFAEnforcement
+
+	// mfaLock protects mfaMethods and mfaEnforcements, and serializes the
+	// changes to the TOTP secrets
+	mfaLock sync.RWMutex
+
+	// namespaces are the namespaces by path, loaded after unseal. The map
+	// is never modified once in use; changes replace it instead.
+	namespaces    map[string]*Namespace
+	namespaceLock sync.RWMutex
+
+	// writeLog records the writes to the physical backend for the DR
+	// secondaries of a primary and the performance standbys
+	writeLog *writeLog
+
+	// drState is the DR replication state of the cluster, once drLoaded,
+	// and drSecondaries the secondaries of a primary, loaded after unseal.
+	// drLock also guards the status of a secondary and the progress of
+	// its failover token generation.
+	drLock             sync.RWMutex
+	drLoaded           bool
+	drState            *drLocalState
+	drSecondaries      map[string]*drSecondaryEntry
+	drStatus           drSecondaryStatus
+	drFailoverProgress [][]byte
+	drFailoverTokens   map[string]time.Time
+
+	// drRunLock guards the replication of a secondary, which runs until
+	// drStopCh is closed, and drSyncLock serializes its syncs
+	drRunLock  sync.Mutex
+	drStopCh   chan struct{}
+	drDoneCh   chan struct{}
+	drSyncLock sync.Mutex
+
+	// controlGroupLock serializes the changes to the pending control group
+	// requests
+	controlGroupLock sync.Mutex
+
 	// systemBarrierView is the barrier view for the system backend
 	systemBarrierView *BarrierView
 
@@ -223,6 +407,10 @@ type Core struct {
 	// token store is used to manage authentication tokens
 	tokenStore *TokenStore
 
+	// identity store is used to manage the entities tracking principals
+	// across auth mounts
+	identityStore *IdentityStore
+
 	// metricsCh is used to stop the metrics streaming
 	metricsCh chan struct{}
 
@@ -238,6 +426,16 @@ type Core struct {
 	// cachingDisabled indicates whether caches are disabled
 	cachingDisabled bool
 
+	// lazyMounts defers creating the backends of mounts until they are
+	// first used
+	lazyMounts bool
+
+	// lazyLeaseRestore restores the leases in the background after unseal
+	lazyLeaseRestore bool
+
+	// enableRaw mounts the sys/raw endpoints
+	enableRaw bool
+
 	//
 	// Cluster information
 	//
@@ -288,6 +486,9 @@ type CoreConfig struct {
 
 	Seal Seal `json:"seal" structs:"seal" mapstructure:"seal"`
 
+	// The seal to migrate the barrier to through sys/seal-migrate, if any
+	MigrationSeal Seal `json:"migration_seal" structs:"migration_seal" mapstructure:"migration_seal"`
+
 	Logger *log.Logger `json:"logger" structs:"logger" mapstructure:"logger"`
 
 	// Disables the LRU cache on the physical backend
@@ -296,9 +497,38 @@ type CoreConfig struct {
 	// Disables mlock syscall
 	DisableMlock bool `json:"disable_mlock" structs:"disable_mlock" mapstructure:"disable_mlock"`
 
+	// Defers creating the backends of mounts until they are first used,
+	// which makes unsealing faster when there are many mounts
+	LazyMounts bool `json:"lazy_mounts" structs:"lazy_mounts" mapstructure:"lazy_mounts"`
+
+	// Restores the leases in the background after unseal instead of
+	// waiting for them, which makes failover faster with many leases
+	LazyLeaseRestore bool `json:"lazy_lease_restore" structs:"lazy_lease_restore" mapstructure:"lazy_lease_restore"`
+
+	// Enables the sys/raw endpoints, which give direct access to the
+	// storage through the barrier
+	EnableRaw bool `json:"enable_raw" structs:"enable_raw" mapstructure:"enable_raw"`
+
+	// Turns failures to lock memory into warnings instead of errors
+	MlockBestEffort bool `json:"mlock_best_effort" structs:"mlock_best_effort" mapstructure:"mlock_best_effort"`
+
+	// The minimum memlock ulimit, in bytes, required at startup. Zero
+	// disables the check.
+	MlockMinLimit uint64 `json:"mlock_min_limit" structs:"mlock_min_limit" mapstructure:"mlock_min_limit"`
+
 	// Custom cache size of zero for default
 	CacheSize int `json:"cache_size" structs:"cache_size" mapstructure:"cache_size"`
 
+	// The limits of the cache beyond its number of entries: the total size
+	// of the cached values and how long they are cached, unlimited if zero
+	CacheMaxBytes int           `json:"cache_max_bytes" structs:"cache_max_bytes" mapstructure:"cache_max_bytes"`
+	CacheTTL      time.Duration `json:"cache_ttl" structs:"cache_ttl" mapstructure:"cache_ttl"`
+
+	// Whether the cache records the keys which do not exist, and the
+	// prefixes of the keys it never caches
+	CacheDisableNegative bool     `json:"cache_disable_negative" structs:"cache_disable_negative" mapstructure:"cache_disable_negative"`
+	CacheBypassPrefixes  []string `json:"cache_bypass_prefixes" structs:"cache_bypass_prefixes" mapstructure:"cache_bypass_prefixes"`
+
 	// Set as the leader address for HA
 	RedirectAddr string `json:"redirect_addr" structs:"redirect_addr" mapstructure:"redirect_addr"`
 
@@ -310,6 +540,42 @@ type CoreConfig struct {
 	MaxLeaseTTL time.Duration `json:"max_lease_ttl" structs:"max_lease_ttl" mapstructure:"max_lease_ttl"`
 
 	ClusterName string `json:"cluster_name" structs:"cluster_name" mapstructure:"cluster_name"`
+
+	// The preferred compression type for forwarded requests
+	ClusterForwardingCompression string `json:"cluster_forwarding_compression" structs:"cluster_forwarding_compression" mapstructure:"cluster_forwarding_compression"`
+
+	// Whether to require forwarded requests to be signed
+	ClusterForwardingSigning bool `json:"cluster_forwarding_signing" structs:"cluster_forwarding_signing" mapstructure:"cluster_forwarding_signing"`
+
+	// Whether to batch small forwarded requests
+	ClusterForwardingBatching bool `json:"cluster_forwarding_batching" structs:"cluster_forwarding_batching" mapstructure:"cluster_forwarding_batching"`
+
+	// Whether standbys serve reads
+	PerformanceStandby bool `json:"performance_standby" structs:"performance_standby" mapstructure:"performance_standby"`
+
+	// The compression type for the mount tables in storage
+	StorageCompression string `json:"storage_compression" structs:"storage_compression" mapstructure:"storage_compression"`
+
+	// The maximum size of a request body, in bytes. Zero for the default.
+	MaxRequestSize int64 `json:"max_request_size" structs:"max_request_size" mapstructure:"max_request_size"`
+
+	// The admission control of requests. Disabled if nil.
+	AdmissionControl *AdmissionControlConfig `json:"admission_control" structs:"admission_control" mapstructure:"admission_control"`
+
+	// The timeouts, retries and circuit breaker of the operations of the
+	// physical backend. Disabled if nil.
+	StorageTimeouts *physical.TimeoutConfig `json:"storage_timeouts" structs:"storage_timeouts" mapstructure:"storage_timeouts"`
+
+	// The sink whose telemetry is served by sys/metrics. Nil to disable the
+	// endpoint.
+	PrometheusSink *metricsutil.PrometheusSink `json:"-" structs:"-" mapstructure:"-"`
+
+	// The router of the log output, which is reconfigured by sys/loggers.
+	// Nil to disable the endpoints.
+	LogRouter *logutil.Router `json:"-" structs:"-" mapstructure:"-"`
+
+	// The policy engines consulted for the requests the ACLs allow
+	PolicyEngines []PolicyEngine `json:"-" structs:"-" mapstructure:"-"`
 }
 
 // NewCore is used to construct a new core
@@ -326,9 +592,19 @@ func NewCore(conf *CoreConfig) (*Core, error) {
 	if conf.MaxLeaseTTL == 0 {
 		conf.MaxLeaseTTL = maxLeaseTTL
 	}
+	if conf.MaxRequestSize == 0 {
+		conf.MaxRequestSize = DefaultMaxRequestSize
+	}
+	if conf.MaxRequestSize < 0 {
+		return nil, fmt.Errorf("max request size cannot be negative")
+	}
 	if conf.DefaultLeaseTTL > conf.MaxLeaseTTL {
 		return nil, fmt.Errorf("cannot have DefaultLeaseTTL larger than MaxLeaseTTL")
 	}
+	admission, err := newAdmissionController(conf.AdmissionControl)
+	if err != nil {
+		return nil, err
+	}
 
 	// Validate the advertise addr if its given to us
 	if conf.RedirectAddr != "" {
@@ -342,29 +618,97 @@ func NewCore(conf *CoreConfig) (*Core, error) {
 		}
 	}
 
-	// Wrap the backend in a cache unless disabled
-	if !conf.DisableCache {
-		_, isCache := conf.Physical.(*physical.Cache)
-		_, isInmem := conf.Physical.(*physical.InmemBackend)
-		if !isCache && !isInmem {
-			cache := physical.NewCache(conf.Physical, conf.CacheSize)
-			conf.Physical = cache
+	if conf.ClusterForwardingCompression != "" && !requestutil.ValidCompressionType(conf.ClusterForwardingCompression) {
+		return nil, fmt.Errorf("invalid cluster forwarding compression type %q", conf.ClusterForwardingCompression)
+	}
+
+	switch conf.StorageCompression {
+	case "", compressutil.CompressionTypeGzip, compressutil.CompressionTypeLzw, compressutil.CompressionTypeSnappy:
+	case compressutil.CompressionTypeZstd:
+		if !compressutil.ZstdSupported {
+			return nil, fmt.Errorf("storage compression type %q is not supported by this build", conf.StorageCompression)
 		}
+	default:
+		return nil, fmt.Errorf("invalid storage compression type %q", conf.StorageCompression)
 	}
 
+	// Make a default logger if not provided
+	if conf.Logger == nil {
+		conf.Logger = log.New(os.Stderr, "", log.LstdFlags)
+	}
+
+	// Backends which cache themselves or are in memory are not cached
+	_, isCache := conf.Physical.(*physical.Cache)
+	_, isInmem := conf.Physical.(*physical.InmemBackend)
+	raftBackend, _ := conf.Physical.(*physical.RaftBackend)
+
+	// Bound the operations of the backend, below the write log so that
+	// writes which failed are not replicated
+	var storageTimeouts *physical.TimeoutBackend
+	if conf.StorageTimeouts != nil {
+		storageTimeouts = physical.NewTimeoutBackend(conf.Physical, conf.StorageTimeouts, conf.Logger)
+		conf.Physical = storageTimeouts
+	}
+
+	// Record the writes reaching the backend for DR replication and the
+	// performance standbys. The log sits below the cache, so that only the
+	// cache needs purging.
+	writeLog := newWriteLog(conf.Physical)
+
+	// Wrap the backend in a cache unless disabled
+	conf.Physical = writeLog
+	if !conf.DisableCache && !isCache && !isInmem {
+		cache := physical.NewCacheWithConfig(writeLog, &physical.CacheConfig{
+			Size:                   conf.CacheSize,
+			MaxBytes:               conf.CacheMaxBytes,
+			TTL:                    conf.CacheTTL,
+			DisableNegativeCaching: conf.CacheDisableNegative,
+			BypassPrefixes:         conf.CacheBypassPrefixes,
+		})
+		conf.Physical = cache
+	}
+
+	var mlockStatus *mlock.Status
+	var mlockWarnings []string
 	if !conf.DisableMlock {
 		// Ensure our memory usage is locked into physical RAM
-		if err := mlock.LockMemory(); err != nil {
-			return nil, fmt.Errorf(
-				"Failed to lock memory: %v\n\n"+
-					"This usually means that the mlock syscall is not available.\n"+
-					"Vault uses mlock to prevent memory from being swapped to\n"+
-					"disk. This requires root privileges as well as a machine\n"+
-					"that supports mlock. Please enable mlock on your system or\n"+
-					"disable Vault from using it. To disable Vault from using it,\n"+
-					"set the `disable_mlock` configuration option in your configuration\n"+
-					"file.",
-				err)
+		var err error
+		mlockStatus, err = mlock.LockMemoryStatus()
+		if err != nil {
+			if !conf.MlockBestEffort {
+				return nil, fmt.Errorf(
+					"Failed to lock memory: %v\n\n"+
+						"This usually means that the mlock syscall is not available.\n"+
+						"Vault uses mlock to prevent memory from being swapped to\n"+
+						"disk. This requires root privileges as well as a machine\n"+
+						"that supports mlock. Please enable mlock on your system or\n"+
+						"disable Vault from using it. To disable Vault from using it,\n"+
+						"set the `disable_mlock` configuration option in your configuration\n"+
+						"file. To continue with memory only partially locked, set the\n"+
+						"`mlock_best_effort` configuration option.",
+					err)
+			}
+
+			if mlockStatus.Partial() {
+				mlockWarnings = append(mlockWarnings, fmt.Sprintf(
+					"memory is only partially locked (%d bytes locked); memory allocated after startup may be swapped to disk: %v",
+					mlockStatus.LockedBytes, err))
+			} else {
+				mlockWarnings = append(mlockWarnings, fmt.Sprintf(
+					"memory is not locked and may be swapped to disk: %v", err))
+			}
+		}
+
+		// A limit below what is needed means that allocations will fail
+		// once it is reached, which is better found out at startup
+		if conf.MlockMinLimit != 0 && mlockStatus.Limit != 0 && mlockStatus.Limit < conf.MlockMinLimit {
+			msg := fmt.Sprintf(
+				"memlock ulimit of %d bytes is lower than the configured minimum of %d bytes",
+				mlockStatus.Limit, conf.MlockMinLimit)
+			if !conf.MlockBestEffort {
+				return nil, fmt.Errorf("%s; raise the limit with `ulimit -l` or lower `mlock_min_limit`", msg)
+			}
+			mlockWarnings = append(mlockWarnings, msg)
 		}
 	}
 
@@ -374,33 +718,52 @@ func NewCore(conf *CoreConfig) (*Core, error) {
 		return nil, fmt.Errorf("barrier setup failed: %v", err)
 	}
 
-	// Make a default logger if not provided
-	if conf.Logger == nil {
-		conf.Logger = log.New(os.Stderr, "", log.LstdFlags)
-	}
-
 	// Setup the core
 	c := &Core{
-		redirectAddr:         conf.RedirectAddr,
-		clusterAddr:          conf.ClusterAddr,
-		physical:             conf.Physical,
-		seal:                 conf.Seal,
-		barrier:              barrier,
-		router:               NewRouter(),
-		sealed:               true,
-		standby:              true,
-		logger:               conf.Logger,
-		defaultLeaseTTL:      conf.DefaultLeaseTTL,
-		maxLeaseTTL:          conf.MaxLeaseTTL,
-		cachingDisabled:      conf.DisableCache,
-		clusterName:          conf.ClusterName,
-		localClusterCertPool: x509.NewCertPool(),
+		redirectAddr:                 conf.RedirectAddr,
+		clusterAddr:                  conf.ClusterAddr,
+		clusterForwardingCompression: conf.ClusterForwardingCompression,
+		clusterForwardingSigning:     conf.ClusterForwardingSigning,
+		clusterForwardingBatching:    conf.ClusterForwardingBatching,
+		perfStandbyEnabled:           conf.PerformanceStandby,
+		storageCompression:           conf.StorageCompression,
+		maxRequestSize:               conf.MaxRequestSize,
+		mlockStatus:                  mlockStatus,
+		mlockWarnings:                mlockWarnings,
+		events:                       newEventBroker(),
+		admission:                    admission,
+		storageTimeouts:              storageTimeouts,
+		prometheusSink:               conf.PrometheusSink,
+		logRouter:                    conf.LogRouter,
+		policyEngines:                conf.PolicyEngines,
+		physical:                     conf.Physical,
+		seal:                         conf.Seal,
+		migrationSeal:                conf.MigrationSeal,
+		barrier:                      barrier,
+		router:                       NewRouter(),
+		sealed:                       true,
+		standby:                      true,
+		logger:                       conf.Logger,
+		defaultLeaseTTL:              conf.DefaultLeaseTTL,
+		maxLeaseTTL:                  conf.MaxLeaseTTL,
+		cachingDisabled:              conf.DisableCache,
+		lazyMounts:                   conf.LazyMounts,
+		lazyLeaseRestore:             conf.LazyLeaseRestore,
+		enableRaw:                    conf.EnableRaw,
+		clusterName:                  conf.ClusterName,
+		localClusterCertPool:         x509.NewCertPool(),
+		writeLog:                     writeLog,
+		raft:                         raftBackend,
 	}
 
 	if conf.HAPhysical != nil && conf.HAPhysical.HAEnabled() {
 		c.ha = conf.HAPhysical
 	}
 
+	for _, warning := range mlockWarnings {
+		c.logger.Printf("[WARN] core: %s", warning)
+	}
+
 	// Setup the backends
 	logicalBackends := make(map[string]logical.Factory)
 	for k, f := range conf.LogicalBackends {
@@ -435,6 +798,15 @@ func NewCore(conf *CoreConfig) (*Core, error) {
 		c.seal = &DefaultSeal{}
 	}
 	c.seal.SetCore(c)
+	if c.migrationSeal != nil {
+		c.migrationSeal.SetCore(c)
+	}
+
+	// A DR secondary starts replicating from its primary. If the backend
+	// is not reachable yet, the state is loaded again on unseal.
+	if err := c.loadDRState(); err != nil {
+		c.logger.Printf("[WARN] core: %v", err)
+	}
 
 	// Attempt unsealing with stored keys; if there are no stored keys this
 	// returns nil, otherwise returns nil or an error
@@ -448,6 +820,8 @@ func NewCore(conf *CoreConfig) (*Core, error) {
 // problem. It is only used to gracefully quit in the case of HA so that failover
 // happens as quickly as possible.
 func (c *Core) Shutdown() error {
+	c.stopDRSecondary()
+
 	c.stateLock.Lock()
 	defer c.stateLock.Unlock()
 	if c.sealed {
@@ -480,11 +854,24 @@ func (c *Core) fetchACLandTokenEntry(req *logical.Request) (*ACL, *TokenEntry, e
 
 	// Ensure the token is valid
 	if te == nil {
+		return nil, nil, errutil.WithCode(errutil.CodeInvalidToken, logical.ErrPermissionDenied)
+	}
+
+	// Ensure the token is used from an allowed address. The token entry is
+	// not returned so that the uses of the token are not decremented.
+	if len(te.BoundCIDRs) > 0 {
+		if req.Connection == nil || !cidrutil.IPBelongsToCIDRs(req.Connection.RemoteAddr, te.BoundCIDRs) {
+			return nil, nil, errutil.WithCode(errutil.CodeInvalidToken, logical.ErrPermissionDenied)
+		}
+	}
+
+	// Tokens issued in a namespace can only be used in it and its children
+	if !c.tokenNamespaceAllows(te, req.Path) {
 		return nil, nil, logical.ErrPermissionDenied
 	}
 
 	// Construct the corresponding ACL object
-	acl, err := c.policyStore.ACL(te.Policies...)
+	acl, err := c.tokenACL(te)
 	if err != nil {
 		c.logger.Printf("[ERR] core: failed to construct ACL: %v", err)
 		return nil, nil, ErrInternalError
@@ -543,12 +930,32 @@ func (c *Core) checkToken(req *logical.Request) (*logical.Auth, *TokenEntry, err
 
 	// Check the standard non-root ACLs. Return the token entry if it's not
 	// allowed so we can decrement the use count.
-	allowed, rootPrivs := acl.AllowOperation(req.Operation, req.Path)
+	allowed, rootPrivs := acl.AllowRequest(req)
 	if !allowed {
-		return nil, te, logical.ErrPermissionDenied
+		return nil, te, errutil.WithCode(errutil.CodePolicyDenied, logical.ErrPermissionDenied)
 	}
 	if rootPath && !rootPrivs {
-		return nil, te, logical.ErrPermissionDenied
+		return nil, te, errutil.WithCode(errutil.CodePolicyDenied, logical.ErrPermissionDenied)
+	}
+
+	// The policy engines can deny what the ACL allows, except to root
+	if !acl.root && req.Operation != logical.HelpOperation {
+		if err := c.evaluatePolicyEngines(req, te); err != nil {
+			return nil, te, err
+		}
+	}
+
+	// Requests to paths under an MFA enforcement require second factors,
+	// except from root
+	if !acl.root && req.Operation != logical.HelpOperation {
+		if err := c.enforcePathMFA(req, te); err != nil {
+			return nil, te, err
+		}
+	}
+
+	// Batch tokens are not persisted, so they cannot own a cubbyhole
+	if te.Type == TokenTypeBatch && strings.HasPrefix(req.Path, "cubbyhole/") {
+		return nil, te, fmt.Errorf("batch tokens cannot use the cubbyhole")
 	}
 
 	// Create the auth response
@@ -557,6 +964,14 @@ func (c *Core) checkToken(req *logical.Request) (*logical.Auth, *TokenEntry, err
 		Policies:    te.Policies,
 		Metadata:    te.Meta,
 		DisplayName: te.DisplayName,
+		EntityID:    te.EntityID,
+	}
+
+	// Requests to paths under a control group are held until approved
+	if req.Operation != logical.HelpOperation && !controlGroupApproved(req) {
+		if cg := acl.ControlGroup(req.Path); cg != nil {
+			return auth, te, &controlGroupRequiredError{controlGroup: cg}
+		}
 	}
 	return auth, te, nil
 }
@@ -568,6 +983,76 @@ func (c *Core) Sealed() (bool, error) {
 	return c.sealed, nil
 }
 
+// MaxRequestSize returns the maximum size, in bytes, of the body of a
+// request to path. A limit set on the mount the path belongs to takes
+// precedence; otherwise listenerLimit is used if it is non-zero, and the
+// server-wide limit if not.
+func (c *Core) MaxRequestSize(path string, listenerLimit int64) int64 {
+	if entry := c.router.MatchingMountEntry(path); entry != nil && entry.Config.MaxRequestSize > 0 {
+		return entry.Config.MaxRequestSize
+	}
+	if listenerLimit > 0 {
+		return listenerLimit
+	}
+	return c.maxRequestSize
+}
+
+// MatchingMount returns the path of the mount that path belongs to, or an
+// empty string if there is none
+func (c *Core) MatchingMount(path string) string {
+	return c.router.MatchingMount(path)
+}
+
+// AuditRejectedRequest creates an audit entry for a request that was
+// rejected before it could be handled, such as one whose body is too
+// large. Nothing is logged while the core is sealed or in standby, as the
+// audit backends are not available then.
+func (c *Core) AuditRejectedRequest(req *logical.Request, reqErr error) error {
+	c.stateLock.RLock()
+	defer c.stateLock.RUnlock()
+	if c.sealed || c.standby {
+		return nil
+	}
+
+	if err := c.auditBroker.LogRequest(nil, req, reqErr); err != nil {
+		c.logger.Printf("[ERR] core: failed to audit rejected request (request path: %s): %v",
+			req.Path, err)
+		return ErrInternalError
+	}
+	return nil
+}
+
+// ValidToken returns whether the token exists. It returns false whenever
+// the token cannot be looked up, such as while sealed or in standby.
+func (c *Core) ValidToken(token string) bool {
+	c.stateLock.RLock()
+	defer c.stateLock.RUnlock()
+	if c.sealed || (c.standby && !c.perfStandby) || c.tokenStore == nil {
+		return false
+	}
+
+	te, err := c.tokenStore.Lookup(token)
+	return err == nil && te != nil
+}
+
+// MlockStatus returns the outcome of locking memory at startup, or nil if
+// mlock is disabled
+func (c *Core) MlockStatus() *mlock.Status {
+	return c.mlockStatus
+}
+
+// MlockWarnings returns the problems found when locking memory that were
+// tolerated because best-effort locking is enabled
+func (c *Core) MlockWarnings() []string {
+	return c.mlockWarnings
+}
+
+// StorageDegraded returns whether the circuit breaker of the physical
+// backend is open, failing storage operations without reaching the backend
+func (c *Core) StorageDegraded() bool {
+	return c.storageTimeouts != nil && c.storageTimeouts.Degraded()
+}
+
 // Standby checks if the Vault is in standby mode
 func (c *Core) Standby() (bool, error) {
 	c.stateLock.RLock()
@@ -597,7 +1082,7 @@ func (c *Core) Leader() (isLeader bool, leaderAddr string, err error) {
 			c.requestForwardingConnectionLock.Lock()
 			// Verify that the condition hasn't changed
 			if c.requestForwardingConnection != nil {
-				c.requestForwardingConnection.Transport.(*http.Transport).CloseIdleConnections()
+				c.requestForwardingConnection.close()
 			}
 			c.requestForwardingConnection = nil
 			c.requestForwardingConnectionLock.Unlock()
@@ -661,7 +1146,7 @@ func (c *Core) Leader() (isLeader bool, leaderAddr string, err error) {
 
 		// This will ensure that we both have a connection at the ready and that
 		// the address is the current known value
-		err = c.refreshRequestForwardingConnection(adv.ClusterAddr)
+		err = c.refreshRequestForwardingConnection(adv)
 		if err != nil {
 			return false, "", err
 		}
@@ -720,6 +1205,14 @@ func (c *Core) Unseal(key []byte) (bool, error) {
 		return false, ErrNotInit
 	}
 
+	// A DR secondary stays sealed while it replicates
+	if err := c.loadDRState(); err != nil {
+		return false, err
+	}
+	if c.drMode() == drModeSecondary {
+		return false, ErrDRSecondary
+	}
+
 	c.stateLock.Lock()
 	defer c.stateLock.Unlock()
 
@@ -765,6 +1258,16 @@ func (c *Core) Unseal(key []byte) (bool, error) {
 	}
 	c.logger.Printf("[INFO] core: vault is unsealed")
 
+	// Rejoin the raft cluster, which the node leaves while sealed
+	if c.raft != nil {
+		if err := c.raft.SetupCluster(); err != nil {
+			c.logger.Printf("[ERR] core: failed to start raft: %v", err)
+			c.barrier.Seal()
+			c.logger.Printf("[WARN] core: vault is sealed")
+			return false, err
+		}
+	}
+
 	// Do post-unseal setup if HA is not enabled
 	if c.ha == nil {
 		// We still need to set up cluster info even if it's not part of a
@@ -893,7 +1396,7 @@ func (c *Core) sealInitCommon(req *logical.Request) (retErr error) {
 		}
 		if te == nil {
 			// Token is no longer valid
-			retErr = multierror.Append(retErr, logical.ErrPermissionDenied)
+			retErr = multierror.Append(retErr, errutil.WithCode(errutil.CodeInvalidToken, logical.ErrPermissionDenied))
 			return retErr
 		}
 		if te.NumUses == -1 {
@@ -911,13 +1414,13 @@ func (c *Core) sealInitCommon(req *logical.Request) (retErr error) {
 	// Verify that this operation is allowed
 	allowed, rootPrivs := acl.AllowOperation(req.Operation, req.Path)
 	if !allowed {
-		retErr = multierror.Append(retErr, logical.ErrPermissionDenied)
+		retErr = multierror.Append(retErr, errutil.WithCode(errutil.CodePolicyDenied, logical.ErrPermissionDenied))
 		return retErr
 	}
 
 	// We always require root privileges for this operation
 	if !rootPrivs {
-		retErr = multierror.Append(retErr, logical.ErrPermissionDenied)
+		retErr = multierror.Append(retErr, errutil.WithCode(errutil.CodePolicyDenied, logical.ErrPermissionDenied))
 		return retErr
 	}
 
@@ -979,7 +1482,7 @@ func (c *Core) StepDown(req *logical.Request) (retErr error) {
 		}
 		if te == nil {
 			// Token has been revoked
-			retErr = multierror.Append(retErr, logical.ErrPermissionDenied)
+			retErr = multierror.Append(retErr, errutil.WithCode(errutil.CodeInvalidToken, logical.ErrPermissionDenied))
 			return retErr
 		}
 		if te.NumUses == -1 {
@@ -997,13 +1500,13 @@ func (c *Core) StepDown(req *logical.Request) (retErr error) {
 	// Verify that this operation is allowed
 	allowed, rootPrivs := acl.AllowOperation(req.Operation, req.Path)
 	if !allowed {
-		retErr = multierror.Append(retErr, logical.ErrPermissionDenied)
+		retErr = multierror.Append(retErr, errutil.WithCode(errutil.CodePolicyDenied, logical.ErrPermissionDenied))
 		return retErr
 	}
 
 	// We always require root privileges for this operation
 	if !rootPrivs {
-		retErr = multierror.Append(retErr, logical.ErrPermissionDenied)
+		retErr = multierror.Append(retErr, errutil.WithCode(errutil.CodePolicyDenied, logical.ErrPermissionDenied))
 		return retErr
 	}
 
@@ -1021,6 +1524,7 @@ func (c *Core) StepDown(req *logical.Request) (retErr error) {
 func (c *Core) sealInternal() error {
 	// Enable that we are sealed to prevent furthur transactions
 	c.sealed = true
+	c.events.Publish(EventSealed, nil)
 
 	// Do pre-seal teardown if HA is not enabled
 	if c.ha == nil {
@@ -1043,6 +1547,14 @@ func (c *Core) sealInternal() error {
 	}
 	c.logger.Printf("[INFO] core: vault is sealed")
 
+	// Leave the raft cluster so that another node takes over as the
+	// leader, unless the node replicates as a DR secondary while sealed
+	if c.raft != nil && c.drMode() != drModeSecondary {
+		if err := c.raft.TeardownCluster(); err != nil {
+			c.logger.Printf("[WARN] core: failed to stop raft: %v", err)
+		}
+	}
+
 	if c.ha != nil {
 		sd, ok := c.ha.(physical.ServiceDiscovery)
 		if ok {
@@ -1097,21 +1609,54 @@ func (c *Core) postUnseal() (retErr error) {
 	if err := c.setupPolicyStore(); err != nil {
 		return err
 	}
+	if err := c.setupIdentityStore(); err != nil {
+		return err
+	}
 	if err := c.loadCredentials(); err != nil {
 		return err
 	}
 	if err := c.setupCredentials(); err != nil {
 		return err
 	}
+	if err := c.loadNamespaces(); err != nil {
+		return err
+	}
 	if err := c.setupExpiration(); err != nil {
 		return err
 	}
+	if err := c.loadLeaseCountQuotas(); err != nil {
+		return err
+	}
+	if err := c.loadRateLimitQuotas(); err != nil {
+		return err
+	}
+	if err := c.loadEndpointPolicies(); err != nil {
+		return err
+	}
+	if err := c.loadMFA(); err != nil {
+		return err
+	}
+	if err := c.setupDRReplication(); err != nil {
+		return err
+	}
+	if err := c.setupPerformanceStandbyLog(); err != nil {
+		return err
+	}
 	if err := c.loadAudits(); err != nil {
 		return err
 	}
 	if err := c.setupAudits(); err != nil {
 		return err
 	}
+	if err := c.loadCORSConfig(); err != nil {
+		return err
+	}
+	if err := c.setupKeyRotation(); err != nil {
+		return err
+	}
+	if err := c.setupStorageSnapshots(); err != nil {
+		return err
+	}
 	if c.ha != nil {
 		if err := c.startClusterListener(); err != nil {
 			return err
@@ -1129,17 +1674,31 @@ func (c *Core) preSeal() error {
 	defer metrics.MeasureSince([]string{"core", "pre_seal"}, time.Now())
 	c.logger.Printf("[INFO] core: pre-seal teardown starting")
 
+	// Events are only published while active
+	c.events.closeAll()
+
+	c.teardownDRReplication()
+
 	// Clear any rekey progress
 	c.barrierRekeyConfig = nil
 	c.barrierRekeyProgress = nil
 	c.recoveryRekeyConfig = nil
 	c.recoveryRekeyProgress = nil
 
+	// Clear any seal migration progress
+	c.migrationConfig = nil
+	c.migrationProgress = nil
+
 	if c.metricsCh != nil {
 		close(c.metricsCh)
 		c.metricsCh = nil
 	}
+	c.teardownStorageSnapshots()
+
 	var result error
+	if err := c.stopKeyRotation(); err != nil {
+		result = multierror.Append(result, errwrap.Wrapf("[ERR] error stopping key rotation: {{err}}", err))
+	}
 	if c.ha != nil {
 		c.stopClusterListener()
 	}
@@ -1153,6 +1712,9 @@ func (c *Core) preSeal() error {
 	if err := c.teardownCredentials(); err != nil {
 		result = multierror.Append(result, errwrap.Wrapf("[ERR] error tearing down credentials: {{err}}", err))
 	}
+	if err := c.teardownIdentityStore(); err != nil {
+		result = multierror.Append(result, errwrap.Wrapf("[ERR] error tearing down identity store: {{err}}", err))
+	}
 	if err := c.teardownPolicyStore(); err != nil {
 		result = multierror.Append(result, errwrap.Wrapf("[ERR] error tearing down policy store: {{err}}", err))
 	}
@@ -1206,9 +1768,22 @@ func (c *Core) runStandby(doneCh, stopCh, manualStepDownCh chan struct{}) {
 			return
 		}
 
+		// Serve reads while waiting for the lock if enabled
+		var perfStandbyDoneCh, perfStandbyStopCh chan struct{}
+		if c.perfStandbyEnabled {
+			perfStandbyDoneCh = make(chan struct{})
+			perfStandbyStopCh = make(chan struct{})
+			go c.runPerformanceStandby(perfStandbyDoneCh, perfStandbyStopCh)
+		}
+
 		// Attempt the acquisition
 		leaderLostCh := c.acquireLock(lock, stopCh)
 
+		if perfStandbyStopCh != nil {
+			close(perfStandbyStopCh)
+			<-perfStandbyDoneCh
+		}
+
 		// Bail if we are being shutdown
 		if leaderLostCh == nil {
 			return
@@ -1259,10 +1834,12 @@ func (c *Core) runStandby(doneCh, stopCh, manualStepDownCh chan struct{}) {
 		select {
 		case <-leaderLostCh:
 			c.logger.Printf("[WARN] core: leadership lost, stopping active operation")
+			c.events.Publish(EventStepDown, nil)
 		case <-stopCh:
 			c.logger.Printf("[WARN] core: stopping active operation")
 		case <-manualStepDownCh:
 			c.logger.Printf("[WARN] core: stepping down from active operation to standby")
+			c.events.Publish(EventStepDown, nil)
 			manualStepDown = true
 		}
 
@@ -1407,6 +1984,10 @@ func (c *Core) advertiseLeader(uuid string, leaderLostCh <-chan struct{}) error
 		ClusterAddr:      c.clusterAddr,
 		ClusterCert:      c.localClusterCert,
 		ClusterKeyParams: keyParams,
+
+		ForwardingCompression: requestutil.SupportedCompressionTypes,
+		ForwardingEncodings:   requestutil.SupportedEncodings,
+		ForwardingFeatures:    c.clusterForwardingFeatures(),
 	}
 	val, err := jsonutil.EncodeJSON(adv)
 	if err != nil {
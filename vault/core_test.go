@@ -1,6 +1,7 @@
 package vault
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"reflect"
@@ -10,6 +11,7 @@ import (
 	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/go-uuid"
 	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/physical"
 )
@@ -19,6 +21,19 @@ var (
 	invalidKey = []byte("abcdefghijklmnopqrstuvwxyz")[:17]
 )
 
+func TestNewCore_badStorageCompression(t *testing.T) {
+	logger = log.New(os.Stderr, "", log.LstdFlags)
+	conf := &CoreConfig{
+		Physical:           physical.NewInmem(logger),
+		DisableMlock:       true,
+		StorageCompression: "bzip2",
+	}
+	_, err := NewCore(conf)
+	if err == nil {
+		t.Fatal("should error")
+	}
+}
+
 func TestNewCore_badRedirectAddr(t *testing.T) {
 	logger = log.New(os.Stderr, "", log.LstdFlags)
 	conf := &CoreConfig{
@@ -412,6 +427,9 @@ func TestCore_HandleRequest_InvalidToken(t *testing.T) {
 	if resp.Data["error"] != "permission denied" {
 		t.Fatalf("bad: %#v", resp)
 	}
+	if code := errutil.CodeOf(err); code != errutil.CodeInvalidToken {
+		t.Fatalf("bad: %s", code)
+	}
 }
 
 // Check that standard permissions work
@@ -503,6 +521,9 @@ func TestCore_HandleRequest_PermissionDenied(t *testing.T) {
 	if err == nil || !errwrap.Contains(err, logical.ErrPermissionDenied.Error()) {
 		t.Fatalf("err: %v, resp: %v", err, resp)
 	}
+	if code := errutil.CodeOf(err); code != errutil.CodePolicyDenied {
+		t.Fatalf("bad: %s", code)
+	}
 }
 
 // Check that standard permissions work
@@ -684,6 +705,137 @@ func TestCore_HandleLogin_Token(t *testing.T) {
 	}
 }
 
+func TestCore_MaxRequestSize(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	if size := c.MaxRequestSize("secret/foo", 0); size != DefaultMaxRequestSize {
+		t.Fatalf("bad: %d", size)
+	}
+	if size := c.MaxRequestSize("secret/foo", 1024); size != 1024 {
+		t.Fatalf("bad: %d", size)
+	}
+
+	// A mount's limit takes precedence over the listener's
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/mounts/secret/tune")
+	req.Data["max_request_size"] = 4096
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if size := c.MaxRequestSize("secret/foo", 1024); size != 4096 {
+		t.Fatalf("bad: %d", size)
+	}
+	if size := c.MaxRequestSize("cubbyhole/foo", 1024); size != 1024 {
+		t.Fatalf("bad: %d", size)
+	}
+}
+
+func TestCore_AuditMountOptions(t *testing.T) {
+	noop := &NoopAudit{}
+	c, _, root := TestCoreUnsealed(t)
+	c.auditBackends["noop"] = func(config *audit.BackendConfig) (audit.Backend, error) {
+		noop = &NoopAudit{
+			Config: config,
+		}
+		return noop, nil
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/audit/noop")
+	req.Data["type"] = "noop"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/mounts/secret/tune")
+	req.Data["audit_non_hmac_request_keys"] = "username, username,email"
+	req.Data["audit_elide_response_keys"] = "keys"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/mounts/secret/tune")
+	req.ClientToken = root
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if keys := resp.Data["audit_non_hmac_request_keys"]; !reflect.DeepEqual(keys, []string{"email", "username"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if _, ok := resp.Data["audit_non_hmac_response_keys"]; ok {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	for _, key := range []string{"foo", "bar"} {
+		req = logical.TestRequest(t, logical.UpdateOperation, "secret/"+key)
+		req.Data["username"] = "alice"
+		req.ClientToken = root
+		if _, err := c.HandleRequest(req); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	last := noop.Req[len(noop.Req)-1]
+	if last.MountPoint != "secret/" || !reflect.DeepEqual(last.AuditNonHMACRequestKeys, []string{"email", "username"}) {
+		t.Fatalf("bad: %#v", last)
+	}
+
+	// The list is elided in the audit logs only
+	req = logical.TestRequest(t, logical.ListOperation, "secret/")
+	req.ClientToken = root
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if keys := resp.Data["keys"]; !reflect.DeepEqual(keys, []string{"bar", "foo"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if audited := noop.Resp[len(noop.Resp)-1]; audited.Data["keys"] != 2 {
+		t.Fatalf("bad: %#v", audited.Data)
+	}
+}
+
+func TestCore_AuditRejectedRequest(t *testing.T) {
+	noop := &NoopAudit{}
+	c, _, root := TestCoreUnsealed(t)
+	c.auditBackends["noop"] = func(config *audit.BackendConfig) (audit.Backend, error) {
+		noop = &NoopAudit{
+			Config: config,
+		}
+		return noop, nil
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/audit/noop")
+	req.Data["type"] = "noop"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	numResp := len(noop.Resp)
+	req = &logical.Request{
+		Operation:   logical.UpdateOperation,
+		Path:        "secret/test",
+		ClientToken: root,
+	}
+	reqErr := fmt.Errorf("request body exceeds the size limit")
+	if err := c.AuditRejectedRequest(req, reqErr); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Only the request is logged, as there is no response
+	if len(noop.Req) != 1 || noop.Req[0].Path != "secret/test" {
+		t.Fatalf("bad: %#v", noop.Req)
+	}
+	if noop.ReqErrs[0] != reqErr {
+		t.Fatalf("bad: %v", noop.ReqErrs[0])
+	}
+	if len(noop.Resp) != numResp {
+		t.Fatalf("bad: %#v", noop.Resp)
+	}
+}
+
 func TestCore_HandleRequest_AuditTrail(t *testing.T) {
 	// Create a noop audit backend
 	noop := &NoopAudit{}
@@ -0,0 +1,148 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/strutil"
+)
+
+const (
+	// coreCORSConfigPath is used to store the CORS configuration
+	coreCORSConfigPath = "core/cors"
+)
+
+var (
+	// StdAllowedHeaders are the request headers that are always allowed in
+	// cross-origin requests, as the API relies on them
+	StdAllowedHeaders = []string{
+		"Content-Type",
+		"X-Requested-With",
+		"X-Vault-No-Request-Forwarding",
+		"X-Vault-Token",
+		"X-Vault-Wrap-TTL",
+	}
+
+	// errLoadCORSFailed if loading the CORS configuration encounters an
+	// error
+	errLoadCORSFailed = errors.New("failed to load CORS configuration")
+)
+
+// CORSConfig is the configuration of Cross-Origin Resource Sharing, which
+// allows browser-based applications served from other origins to use the
+// API. A CORSConfig is never modified once it is in use; changes replace it
+// instead.
+type CORSConfig struct {
+	Enabled bool `json:"enabled"`
+
+	// AllowedOrigins are the origins allowed to make cross-origin requests,
+	// in lower case. The single origin "*" allows any origin.
+	AllowedOrigins []string `json:"allowed_origins,omitempty"`
+
+	// AllowedHeaders are the request headers allowed in cross-origin
+	// requests, in addition to StdAllowedHeaders
+	AllowedHeaders []string `json:"allowed_headers,omitempty"`
+}
+
+// IsValidOrigin returns whether cross-origin requests from origin are
+// allowed
+func (c *CORSConfig) IsValidOrigin(origin string) bool {
+	if c == nil || !c.Enabled || origin == "" {
+		return false
+	}
+	if len(c.AllowedOrigins) == 1 && c.AllowedOrigins[0] == "*" {
+		return true
+	}
+	return strutil.StrListContains(c.AllowedOrigins, strings.ToLower(origin))
+}
+
+// AllAllowedHeaders returns the standard headers along with the configured
+// ones
+func (c *CORSConfig) AllAllowedHeaders() []string {
+	headers := append([]string{}, StdAllowedHeaders...)
+	for _, header := range c.AllowedHeaders {
+		if !strutil.StrListContains(headers, header) {
+			headers = append(headers, header)
+		}
+	}
+	return headers
+}
+
+// validate checks that the configuration can be used
+func (c *CORSConfig) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if len(c.AllowedOrigins) == 0 {
+		return fmt.Errorf("at least one allowed origin is required")
+	}
+	if len(c.AllowedOrigins) > 1 && strutil.StrListContains(c.AllowedOrigins, "*") {
+		return fmt.Errorf("the wildcard origin '*' cannot be combined with other origins")
+	}
+	for _, header := range c.AllowedHeaders {
+		if strings.ContainsAny(header, " ,:") {
+			return fmt.Errorf("invalid header name %q", header)
+		}
+	}
+	return nil
+}
+
+// CORSConfig returns the CORS configuration in use, or nil if it has not
+// been loaded yet. The configuration is loaded on unseal and kept once
+// sealed, so that browser-based applications can still unseal Vault.
+func (c *Core) CORSConfig() *CORSConfig {
+	c.corsLock.RLock()
+	defer c.corsLock.RUnlock()
+	return c.corsConfig
+}
+
+// setCORSConfig persists the given CORS configuration and starts using it
+func (c *Core) setCORSConfig(config *CORSConfig) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+
+	buf, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to encode CORS configuration: %v", err)
+	}
+
+	c.corsLock.Lock()
+	defer c.corsLock.Unlock()
+
+	if err := c.barrier.Put(&Entry{
+		Key:   coreCORSConfigPath,
+		Value: buf,
+	}); err != nil {
+		c.logger.Printf("[ERR] core: failed to persist CORS configuration: %v", err)
+		return err
+	}
+	c.corsConfig = config
+	return nil
+}
+
+// loadCORSConfig reads the CORS configuration from storage. CORS is
+// disabled if it has never been configured.
+func (c *Core) loadCORSConfig() error {
+	raw, err := c.barrier.Get(coreCORSConfigPath)
+	if err != nil {
+		c.logger.Printf("[ERR] core: failed to read CORS configuration: %v", err)
+		return errLoadCORSFailed
+	}
+
+	config := &CORSConfig{}
+	if raw != nil {
+		if err := jsonutil.DecodeJSON(raw.Value, config); err != nil {
+			c.logger.Printf("[ERR] core: failed to decode CORS configuration: %v", err)
+			return errLoadCORSFailed
+		}
+	}
+
+	c.corsLock.Lock()
+	c.corsConfig = config
+	c.corsLock.Unlock()
+	return nil
+}
@@ -0,0 +1,86 @@
+package vault
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCORSConfig_IsValidOrigin(t *testing.T) {
+	config := &CORSConfig{
+		Enabled:        true,
+		AllowedOrigins: []string{"http://www.example.com", "https://www.example.com"},
+	}
+	if !config.IsValidOrigin("https://WWW.example.com") {
+		t.Fatal("expected origin to be valid")
+	}
+	if config.IsValidOrigin("https://www.example.com:8443") {
+		t.Fatal("expected origin to be invalid")
+	}
+
+	config.AllowedOrigins = []string{"*"}
+	if !config.IsValidOrigin("https://www.example.com:8443") {
+		t.Fatal("expected origin to be valid")
+	}
+
+	config.Enabled = false
+	if config.IsValidOrigin("https://www.example.com") {
+		t.Fatal("expected origin to be invalid while disabled")
+	}
+
+	config = nil
+	if config.IsValidOrigin("https://www.example.com") {
+		t.Fatal("expected origin to be invalid without a configuration")
+	}
+}
+
+func TestCORSConfig_Validate(t *testing.T) {
+	bad := []*CORSConfig{
+		{Enabled: true},
+		{Enabled: true, AllowedOrigins: []string{"*", "https://www.example.com"}},
+		{Enabled: true, AllowedOrigins: []string{"*"}, AllowedHeaders: []string{"X-Foo: bar"}},
+	}
+	for _, config := range bad {
+		if err := config.validate(); err == nil {
+			t.Fatalf("expected error for %#v", config)
+		}
+	}
+
+	if err := (&CORSConfig{}).validate(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestCore_CORSConfig(t *testing.T) {
+	c, key, root := TestCoreUnsealed(t)
+	if config := c.CORSConfig(); config == nil || config.Enabled {
+		t.Fatalf("bad: %#v", config)
+	}
+
+	expected := &CORSConfig{
+		Enabled:        true,
+		AllowedOrigins: []string{"https://www.example.com"},
+		AllowedHeaders: []string{"X-Custom"},
+	}
+	if err := c.setCORSConfig(expected); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The configuration is kept while sealed, and reloaded on unseal
+	if err := c.Seal(root); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if config := c.CORSConfig(); !reflect.DeepEqual(config, expected) {
+		t.Fatalf("bad: %#v", config)
+	}
+	c.corsConfig = nil
+	if unseal, err := TestCoreUnseal(c, key); err != nil || !unseal {
+		t.Fatalf("err: %v", err)
+	}
+	if config := c.CORSConfig(); !reflect.DeepEqual(config, expected) {
+		t.Fatalf("bad: %#v", config)
+	}
+
+	if headers := expected.AllAllowedHeaders(); headers[len(headers)-1] != "X-Custom" || len(headers) != len(StdAllowedHeaders)+1 {
+		t.Fatalf("bad: %#v", headers)
+	}
+}
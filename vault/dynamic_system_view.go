@@ -36,7 +36,7 @@ func (d dynamicSystemView) SudoPrivilege(path string, token string) bool {
 	}
 
 	// Construct the corresponding ACL object
-	acl, err := d.core.policyStore.ACL(te.Policies...)
+	acl, err := d.core.tokenACL(te)
 	if err != nil {
 		d.core.logger.Printf("[ERR] failed to retrieve ACL for policies [%#v]: %s", te.Policies, err)
 		return false
@@ -70,7 +70,9 @@ func (d dynamicSystemView) Tainted() bool {
 	return d.mountEntry.Tainted
 }
 
-// CachingDisabled indicates whether to use caching behavior
+// CachingDisabled indicates whether to use caching behavior. Caches are
+// disabled on a performance standby, as they would go stale as the active
+// node writes.
 func (d dynamicSystemView) CachingDisabled() bool {
-	return d.core.cachingDisabled
+	return d.core.cachingDisabled || d.core.perfStandby
 }
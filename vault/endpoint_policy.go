@@ -0,0 +1,271 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/helper/cidrutil"
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// coreEndpointPolicyPath is used to store the endpoint governing
+	// policies, one entry per policy
+	coreEndpointPolicyPath = "core/policies/egp/"
+)
+
+var (
+	// errLoadEndpointPoliciesFailed if loading the endpoint governing
+	// policies encounters an error
+	errLoadEndpointPoliciesFailed = errors.New("failed to load endpoint governing policies")
+)
+
+// EndpointPolicy is an endpoint governing policy: it restricts every request
+// to its paths, whatever the token of the request and even without one.
+// Paths are exact request paths, or prefixes if they end with "*".
+type EndpointPolicy struct {
+	Name  string   `json:"name"`
+	Paths []string `json:"paths"`
+
+	// BoundCIDRs are the blocks the client address must belong to. If
+	// empty, the requests are allowed from any address.
+	BoundCIDRs []string `json:"bound_cidrs,omitempty"`
+
+	// RequireMFA requires the token of the request to come from a login
+	// verified with a second factor
+	RequireMFA bool `json:"require_mfa"`
+}
+
+// validate checks that the policy can be used, and normalizes its CIDR
+// blocks
+func (p *EndpointPolicy) validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("missing name")
+	}
+	if len(p.Paths) == 0 {
+		return fmt.Errorf("at least one path is required")
+	}
+	for _, path := range p.Paths {
+		if path == "" || path == "*" {
+			return fmt.Errorf("invalid path %q", path)
+		}
+	}
+	if len(p.BoundCIDRs) == 0 && !p.RequireMFA {
+		return fmt.Errorf("the policy must set bound_cidrs or require_mfa")
+	}
+
+	cidrs, err := cidrutil.ParseCIDRs(p.BoundCIDRs)
+	if err != nil {
+		return err
+	}
+	p.BoundCIDRs = cidrs
+	return nil
+}
+
+// matches returns whether the policy governs the given request path
+func (p *EndpointPolicy) matches(reqPath string) bool {
+	for _, path := range p.Paths {
+		if strings.HasSuffix(path, "*") {
+			if strings.HasPrefix(reqPath, strings.TrimSuffix(path, "*")) {
+				return true
+			}
+		} else if reqPath == path {
+			return true
+		}
+	}
+	return false
+}
+
+// endpointPolicyExempt returns whether a request is exempt from the
+// endpoint governing policies, which is the case of the requests managing
+// them so that a misconfigured policy can always be fixed
+func endpointPolicyExempt(req *logical.Request) bool {
+	return strings.HasPrefix(req.Path, "sys/policies/egp")
+}
+
+// CheckEndpointPolicies returns an error if an endpoint governing policy
+// denies the request. Rejections are audited, with the reasons recorded in
+// the request. Nothing is checked while the core is sealed or in standby,
+// as the policies are only loaded by the active node.
+func (c *Core) CheckEndpointPolicies(req *logical.Request) error {
+	if endpointPolicyExempt(req) {
+		return nil
+	}
+
+	c.endpointPolicyLock.RLock()
+	var matching []*EndpointPolicy
+	for _, p := range c.endpointPolicies {
+		if p.matches(req.Path) {
+			matching = append(matching, p)
+		}
+	}
+	c.endpointPolicyLock.RUnlock()
+	if len(matching) == 0 {
+		return nil
+	}
+
+	c.stateLock.RLock()
+	defer c.stateLock.RUnlock()
+	if c.sealed || c.standby {
+		return nil
+	}
+
+	var clientAddr string
+	if req.Connection != nil {
+		clientAddr = req.Connection.RemoteAddr
+	}
+
+	// The MFA method is only looked up if a policy requires it
+	var mfaMethod string
+	var mfaLookedUp bool
+
+	var reasons []string
+	for _, p := range matching {
+		if len(p.BoundCIDRs) > 0 && !cidrutil.IPBelongsToCIDRs(clientAddr, p.BoundCIDRs) {
+			reasons = append(reasons, fmt.Sprintf("egp %s: client address not allowed", p.Name))
+		}
+		if p.RequireMFA {
+			if !mfaLookedUp {
+				mfaLookedUp = true
+				if req.ClientToken != "" {
+					te, err := c.tokenStore.Lookup(req.ClientToken)
+					if err != nil {
+						c.logger.Printf("[ERR] core: failed to look up token: %v", err)
+						return ErrInternalError
+					}
+					if te != nil {
+						mfaMethod = te.Meta[mfaMethodMetaKey]
+					}
+				}
+			}
+			if mfaMethod == "" {
+				reasons = append(reasons, fmt.Sprintf("egp %s: MFA required", p.Name))
+			}
+		}
+	}
+	if len(reasons) == 0 {
+		return nil
+	}
+
+	metrics.IncrCounter([]string{"policy", "egp", "rejected"}, 1)
+	req.PolicyReasons = reasons
+	err := errutil.WithCode(errutil.CodePolicyDenied, logical.ErrPermissionDenied)
+	if auditErr := c.auditBroker.LogRequest(nil, req, err); auditErr != nil {
+		c.logger.Printf("[ERR] core: failed to audit request with path (%s): %v",
+			req.Path, auditErr)
+		return ErrInternalError
+	}
+	return err
+}
+
+// EndpointPolicy returns the named endpoint governing policy, or nil if it
+// does not exist
+func (c *Core) EndpointPolicy(name string) *EndpointPolicy {
+	c.endpointPolicyLock.RLock()
+	defer c.endpointPolicyLock.RUnlock()
+	return c.endpointPolicies[name]
+}
+
+// EndpointPolicyNames returns the names of the endpoint governing policies,
+// sorted
+func (c *Core) EndpointPolicyNames() []string {
+	c.endpointPolicyLock.RLock()
+	defer c.endpointPolicyLock.RUnlock()
+	names := make([]string, 0, len(c.endpointPolicies))
+	for name := range c.endpointPolicies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// setEndpointPolicy persists the given policy, replacing the policy with the
+// same name, and starts enforcing it
+func (c *Core) setEndpointPolicy(policy *EndpointPolicy) error {
+	if err := policy.validate(); err != nil {
+		return err
+	}
+
+	buf, err := json.Marshal(policy)
+	if err != nil {
+		return fmt.Errorf("failed to encode endpoint governing policy: %v", err)
+	}
+
+	c.endpointPolicyLock.Lock()
+	defer c.endpointPolicyLock.Unlock()
+
+	if err := c.barrier.Put(&Entry{
+		Key:   coreEndpointPolicyPath + policy.Name,
+		Value: buf,
+	}); err != nil {
+		c.logger.Printf("[ERR] core: failed to persist endpoint governing policy: %v", err)
+		return err
+	}
+
+	policies := make(map[string]*EndpointPolicy, len(c.endpointPolicies)+1)
+	for name, p := range c.endpointPolicies {
+		policies[name] = p
+	}
+	policies[policy.Name] = policy
+	c.endpointPolicies = policies
+	return nil
+}
+
+// deleteEndpointPolicy removes the named policy
+func (c *Core) deleteEndpointPolicy(name string) error {
+	c.endpointPolicyLock.Lock()
+	defer c.endpointPolicyLock.Unlock()
+
+	if err := c.barrier.Delete(coreEndpointPolicyPath + name); err != nil {
+		c.logger.Printf("[ERR] core: failed to delete endpoint governing policy: %v", err)
+		return err
+	}
+
+	policies := make(map[string]*EndpointPolicy, len(c.endpointPolicies))
+	for n, p := range c.endpointPolicies {
+		if n != name {
+			policies[n] = p
+		}
+	}
+	c.endpointPolicies = policies
+	return nil
+}
+
+// loadEndpointPolicies reads the endpoint governing policies and starts
+// enforcing them
+func (c *Core) loadEndpointPolicies() error {
+	names, err := c.barrier.List(coreEndpointPolicyPath)
+	if err != nil {
+		c.logger.Printf("[ERR] core: failed to list endpoint governing policies: %v", err)
+		return errLoadEndpointPoliciesFailed
+	}
+
+	policies := make(map[string]*EndpointPolicy, len(names))
+	for _, name := range names {
+		raw, err := c.barrier.Get(coreEndpointPolicyPath + name)
+		if err != nil {
+			c.logger.Printf("[ERR] core: failed to read endpoint governing policy %s: %v", name, err)
+			return errLoadEndpointPoliciesFailed
+		}
+		if raw == nil {
+			continue
+		}
+		policy := &EndpointPolicy{}
+		if err := jsonutil.DecodeJSON(raw.Value, policy); err != nil {
+			c.logger.Printf("[ERR] core: failed to decode endpoint governing policy %s: %v", name, err)
+			return errLoadEndpointPoliciesFailed
+		}
+		policies[policy.Name] = policy
+	}
+
+	c.endpointPolicyLock.Lock()
+	c.endpointPolicies = policies
+	c.endpointPolicyLock.Unlock()
+	return nil
+}
@@ -0,0 +1,174 @@
+package vault
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestEndpointPolicy_Validate(t *testing.T) {
+	cases := []struct {
+		Policy *EndpointPolicy
+		Valid  bool
+	}{
+		{&EndpointPolicy{Name: "seal", Paths: []string{"sys/seal"}, RequireMFA: true}, true},
+		{&EndpointPolicy{Name: "seal", Paths: []string{"sys/seal"}, BoundCIDRs: []string{"10.0.0.0/8"}}, true},
+		{&EndpointPolicy{Paths: []string{"sys/seal"}, RequireMFA: true}, false},
+		{&EndpointPolicy{Name: "seal", RequireMFA: true}, false},
+		{&EndpointPolicy{Name: "seal", Paths: []string{"*"}, RequireMFA: true}, false},
+		{&EndpointPolicy{Name: "seal", Paths: []string{"sys/seal"}}, false},
+		{&EndpointPolicy{Name: "seal", Paths: []string{"sys/seal"}, BoundCIDRs: []string{"10.0.0.0/33"}}, false},
+	}
+	for i, tc := range cases {
+		if err := tc.Policy.validate(); (err == nil) != tc.Valid {
+			t.Fatalf("%d: bad: %v", i, err)
+		}
+	}
+
+	p := &EndpointPolicy{Name: "seal", Paths: []string{"sys/seal"}, BoundCIDRs: []string{"127.0.0.1"}}
+	if err := p.validate(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(p.BoundCIDRs, []string{"127.0.0.1/32"}) {
+		t.Fatalf("bad: %#v", p.BoundCIDRs)
+	}
+}
+
+func TestEndpointPolicy_Matches(t *testing.T) {
+	p := &EndpointPolicy{Paths: []string{"sys/seal", "sys/rekey/*"}}
+	cases := map[string]bool{
+		"sys/seal":          true,
+		"sys/seal-status":   false,
+		"sys/rekey/init":    true,
+		"sys/rekey":         false,
+		"secret/sys/rekey/": false,
+	}
+	for path, expected := range cases {
+		if actual := p.matches(path); actual != expected {
+			t.Fatalf("%s: expected %v", path, expected)
+		}
+	}
+}
+
+func TestCore_EndpointPolicy(t *testing.T) {
+	noop := &NoopAudit{}
+	c, key, root := TestCoreUnsealed(t)
+	c.auditBackends["noop"] = func(config *audit.BackendConfig) (audit.Backend, error) {
+		noop = &NoopAudit{
+			Config: config,
+		}
+		return noop, nil
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/audit/noop")
+	req.Data["type"] = "noop"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/policies/egp/seal")
+	req.ClientToken = root
+	req.Data["paths"] = "sys/seal,/sys/step-down"
+	req.Data["bound_cidrs"] = "10.0.0.0/8"
+	req.Data["require_mfa"] = true
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "auth/token/create")
+	req.ClientToken = root
+	req.Data["id"] = "mfa"
+	req.Data["meta"] = map[string]interface{}{"mfa_method": "duo"}
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	check := func(path, token, addr string) (*logical.Request, error) {
+		req := &logical.Request{
+			Operation:   logical.UpdateOperation,
+			Path:        path,
+			ClientToken: token,
+			Connection:  &logical.Connection{RemoteAddr: addr},
+		}
+		return req, c.CheckEndpointPolicies(req)
+	}
+
+	if _, err := check("sys/seal", "mfa", "10.1.2.3"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Root tokens are not exempt
+	req, err := check("sys/seal", root, "10.1.2.3")
+	if errutil.CodeOf(err) != errutil.CodePolicyDenied {
+		t.Fatalf("expected policy denied, got %v", err)
+	}
+	if !reflect.DeepEqual(req.PolicyReasons, []string{"egp seal: MFA required"}) {
+		t.Fatalf("bad: %#v", req.PolicyReasons)
+	}
+	if noop.Req[len(noop.Req)-1] != req || noop.ReqErrs[len(noop.ReqErrs)-1] == nil {
+		t.Fatalf("rejection not audited")
+	}
+
+	req, err = check("sys/step-down", "", "192.168.1.1")
+	if errutil.CodeOf(err) != errutil.CodePolicyDenied {
+		t.Fatalf("expected policy denied, got %v", err)
+	}
+	if !reflect.DeepEqual(req.PolicyReasons, []string{
+		"egp seal: client address not allowed",
+		"egp seal: MFA required",
+	}) {
+		t.Fatalf("bad: %#v", req.PolicyReasons)
+	}
+
+	// Other paths and the policies themselves are not governed
+	if _, err := check("sys/mounts", "", "192.168.1.1"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := check("sys/policies/egp/seal", root, "192.168.1.1"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/policies/egp/seal")
+	req.ClientToken = root
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(resp.Data["paths"], []string{"sys/seal", "sys/step-down"}) ||
+		!reflect.DeepEqual(resp.Data["bound_cidrs"], []string{"10.0.0.0/8"}) ||
+		resp.Data["require_mfa"] != true {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Invalid policies are rejected
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/policies/egp/invalid")
+	req.ClientToken = root
+	req.Data["paths"] = "sys/seal"
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// The policy survives a restart
+	if err := c.Seal(root); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if unseal, err := TestCoreUnseal(c, key); err != nil || !unseal {
+		t.Fatalf("err: %v", err)
+	}
+	if names := c.EndpointPolicyNames(); !reflect.DeepEqual(names, []string{"seal"}) {
+		t.Fatalf("bad: %#v", names)
+	}
+
+	req = logical.TestRequest(t, logical.DeleteOperation, "sys/policies/egp/seal")
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := check("sys/seal", "", "192.168.1.1"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
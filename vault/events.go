@@ -0,0 +1,149 @@
+package vault
+
+import (
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+)
+
+const (
+	// EventLeaseExpired is published when a lease is revoked because it
+	// expired
+	EventLeaseExpired = "lease-expired"
+
+	// EventMountEnabled, EventMountDisabled, EventMountMoved and
+	// EventMountTuned are published on changes to the mount table
+	EventMountEnabled  = "mount-enabled"
+	EventMountDisabled = "mount-disabled"
+	EventMountMoved    = "mount-moved"
+	EventMountTuned    = "mount-tuned"
+
+	// EventAuthEnabled and EventAuthDisabled are published on changes to
+	// the auth table
+	EventAuthEnabled  = "auth-enabled"
+	EventAuthDisabled = "auth-disabled"
+
+	// EventPolicyUpdated and EventPolicyDeleted are published on changes
+	// to policies
+	EventPolicyUpdated = "policy-updated"
+	EventPolicyDeleted = "policy-deleted"
+
+	// EventSealed is published when the Vault is about to be sealed, and
+	// EventStepDown when the active node is about to step down. Both end
+	// all subscriptions.
+	EventSealed   = "sealed"
+	EventStepDown = "step-down"
+
+	// eventSubscriberBuffer is the number of events that are kept for a
+	// subscriber that has not received them yet. Events are dropped for
+	// subscribers that fall further behind.
+	eventSubscriberBuffer = 64
+)
+
+// Event is a notification of a change in the state of Vault
+type Event struct {
+	Type string                 `json:"type"`
+	Time time.Time              `json:"time"`
+	Data map[string]interface{} `json:"data,omitempty"`
+}
+
+// EventSubscription receives the events published after it was created,
+// until it is closed or the core stops being the active node
+type EventSubscription struct {
+	// Events is closed when the subscription ends
+	Events <-chan *Event
+
+	ch     chan *Event
+	broker *eventBroker
+}
+
+// Close ends the subscription
+func (s *EventSubscription) Close() {
+	s.broker.unsubscribe(s)
+}
+
+// eventBroker fans published events out to the subscribers. A nil
+// eventBroker discards all events.
+type eventBroker struct {
+	l           sync.Mutex
+	subscribers map[*EventSubscription]struct{}
+}
+
+func newEventBroker() *eventBroker {
+	return &eventBroker{
+		subscribers: make(map[*EventSubscription]struct{}),
+	}
+}
+
+// Publish sends an event of the given type to all subscribers. It never
+// blocks; subscribers whose buffer is full miss the event.
+func (b *eventBroker) Publish(eventType string, data map[string]interface{}) {
+	if b == nil {
+		return
+	}
+
+	event := &Event{
+		Type: eventType,
+		Time: time.Now().UTC(),
+		Data: data,
+	}
+
+	b.l.Lock()
+	defer b.l.Unlock()
+	for s := range b.subscribers {
+		select {
+		case s.ch <- event:
+		default:
+			metrics.IncrCounter([]string{"core", "events", "dropped"}, 1)
+		}
+	}
+}
+
+func (b *eventBroker) subscribe() *EventSubscription {
+	ch := make(chan *Event, eventSubscriberBuffer)
+	s := &EventSubscription{
+		Events: ch,
+		ch:     ch,
+		broker: b,
+	}
+
+	b.l.Lock()
+	b.subscribers[s] = struct{}{}
+	b.l.Unlock()
+	return s
+}
+
+func (b *eventBroker) unsubscribe(s *EventSubscription) {
+	b.l.Lock()
+	defer b.l.Unlock()
+	if _, ok := b.subscribers[s]; ok {
+		delete(b.subscribers, s)
+		close(s.ch)
+	}
+}
+
+// closeAll ends all subscriptions
+func (b *eventBroker) closeAll() {
+	b.l.Lock()
+	defer b.l.Unlock()
+	for s := range b.subscribers {
+		delete(b.subscribers, s)
+		close(s.ch)
+	}
+}
+
+// SubscribeEvents returns a subscription to the events published by the
+// core. Only the active node publishes events, so subscribing fails while
+// the core is sealed or in standby.
+func (c *Core) SubscribeEvents() (*EventSubscription, error) {
+	c.stateLock.RLock()
+	defer c.stateLock.RUnlock()
+	if c.sealed {
+		return nil, ErrSealed
+	}
+	if c.standby {
+		return nil, ErrStandby
+	}
+	return c.events.subscribe(), nil
+}
@@ -0,0 +1,106 @@
+package vault
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testNextEvent(t *testing.T, sub *EventSubscription) *Event {
+	select {
+	case event, ok := <-sub.Events:
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return event
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for event")
+	}
+	return nil
+}
+
+func TestEventBroker(t *testing.T) {
+	b := newEventBroker()
+	sub1 := b.subscribe()
+	sub2 := b.subscribe()
+
+	b.Publish(EventPolicyUpdated, map[string]interface{}{"name": "foo"})
+	for _, sub := range []*EventSubscription{sub1, sub2} {
+		event := testNextEvent(t, sub)
+		if event.Type != EventPolicyUpdated || event.Data["name"] != "foo" {
+			t.Fatalf("bad: %#v", event)
+		}
+	}
+
+	// Events are dropped once the buffer is full
+	for i := 0; i < eventSubscriberBuffer+10; i++ {
+		b.Publish(EventPolicyUpdated, nil)
+	}
+	if len(sub1.Events) != eventSubscriberBuffer {
+		t.Fatalf("bad: %d", len(sub1.Events))
+	}
+
+	sub1.Close()
+	sub1.Close()
+	if len(b.subscribers) != 1 {
+		t.Fatalf("bad: %d", len(b.subscribers))
+	}
+
+	b.closeAll()
+	for range sub2.Events {
+	}
+	if len(b.subscribers) != 0 {
+		t.Fatalf("bad: %d", len(b.subscribers))
+	}
+
+	// A nil broker discards events
+	var nilBroker *eventBroker
+	nilBroker.Publish(EventSealed, nil)
+}
+
+func TestCore_SubscribeEvents(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+	sub, err := c.SubscribeEvents()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	me := &MountEntry{
+		Table: mountTableType,
+		Path:  "foo",
+		Type:  "generic",
+	}
+	if err := c.mount(me); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	event := testNextEvent(t, sub)
+	expected := map[string]interface{}{
+		"path": "foo/",
+		"type": "generic",
+	}
+	if event.Type != EventMountEnabled || !reflect.DeepEqual(event.Data, expected) {
+		t.Fatalf("bad: %#v", event)
+	}
+
+	if err := c.unmount("foo"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if event := testNextEvent(t, sub); event.Type != EventMountDisabled {
+		t.Fatalf("bad: %#v", event)
+	}
+
+	// Sealing announces it and ends the subscription
+	if err := c.Seal(root); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if event := testNextEvent(t, sub); event.Type != EventSealed {
+		t.Fatalf("bad: %#v", event)
+	}
+	if _, ok := <-sub.Events; ok {
+		t.Fatal("expected subscription to be closed")
+	}
+
+	if _, err := c.SubscribeEvents(); err != ErrSealed {
+		t.Fatalf("expected sealed error, got: %v", err)
+	}
+}
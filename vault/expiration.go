@@ -6,8 +6,10 @@ import (
 	"log"
 	"os"
 	"path"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/armon/go-metrics"
@@ -41,6 +43,13 @@ const (
 
 	// defaultLeaseDuration is the default lease duration used when no lease is specified
 	defaultLeaseTTL = maxLeaseTTL
+
+	// restoreWorkers is the number of leases loaded at once when restoring
+	restoreWorkers = 64
+
+	// maxIrrevocableLeasesListed caps the number of irrevocable leases
+	// returned at once
+	maxIrrevocableLeasesListed = 10000
 )
 
 // ExpirationManager is used by the Core to manage leases. Secrets
@@ -54,8 +63,62 @@ type ExpirationManager struct {
 	tokenStore *TokenStore
 	logger     *log.Logger
 
+	// events is used to announce expired leases
+	events *eventBroker
+
 	pending     map[string]*time.Timer
 	pendingLock sync.Mutex
+
+	// pendingRoles holds the role of the pending leases of tokens issued
+	// for a role, and quotas the lease count quotas with the pending leases
+	// each one counts. They are protected by pendingLock.
+	pendingRoles map[string]string
+	quotas       []*leaseQuotaCount
+
+	// irrevocable are the leases whose revocation failed
+	// maxRevokeAttempts times, which are no longer retried. It's protected
+	// by pendingLock.
+	irrevocable map[string]*IrrevocableLease
+
+	// restoreTotal and restoreLoaded count the leases found and loaded by
+	// the restore, and restoreDone is set once it finished. They are
+	// accessed atomically.
+	restoreTotal  uint64
+	restoreLoaded uint64
+	restoreDone   uint32
+
+	// quitCh is closed by Stop to abort a restore in progress, and
+	// replaced so that the leases can be restored again
+	quitCh    chan struct{}
+	quitLock  sync.Mutex
+	restoreWG sync.WaitGroup
+
+	// tidying is set while a tidy is in progress. It's accessed atomically.
+	tidying uint32
+}
+
+// IrrevocableLease is a lease that could not be revoked when it expired.
+// It's kept until it is revoked or removed with revoke-force.
+type IrrevocableLease struct {
+	LeaseID    string
+	Path       string
+	ExpireTime time.Time
+	Error      string
+}
+
+// LeaseTidyResult lists the orphaned leases found by a tidy
+type LeaseTidyResult struct {
+	// Total is the number of leases scanned
+	Total int
+
+	// MissingMount are the leases issued by a mount that no longer exists
+	MissingMount []string
+
+	// RevokedToken are the leases of a token that no longer exists
+	RevokedToken []string
+
+	// Failed are the orphaned leases that could not be removed
+	Failed []string
 }
 
 // NewExpirationManager creates a new ExpirationManager that is backed
@@ -65,12 +128,15 @@ func NewExpirationManager(router *Router, view *BarrierView, ts *TokenStore, log
 		logger = log.New(os.Stderr, "", log.LstdFlags)
 	}
 	exp := &ExpirationManager{
-		router:     router,
-		idView:     view.SubView(leaseViewPrefix),
-		tokenView:  view.SubView(tokenViewPrefix),
-		tokenStore: ts,
-		logger:     logger,
-		pending:    make(map[string]*time.Timer),
+		router:       router,
+		idView:       view.SubView(leaseViewPrefix),
+		tokenView:    view.SubView(tokenViewPrefix),
+		tokenStore:   ts,
+		logger:       logger,
+		pending:      make(map[string]*time.Timer),
+		pendingRoles: make(map[string]string),
+		irrevocable:  make(map[string]*IrrevocableLease),
+		quitCh:       make(chan struct{}),
 	}
 	return exp
 }
@@ -85,18 +151,45 @@ func (c *Core) setupExpiration() error {
 
 	// Create the manager
 	mgr := NewExpirationManager(c.router, view, c.tokenStore, c.logger)
+	mgr.events = c.events
 	c.expiration = mgr
 
 	// Link the token store to this
 	c.tokenStore.SetExpirationManager(mgr)
 
-	// Restore the existing state
+	// Restore the existing state. Lazily, the leases are restored in the
+	// background while requests are served; their data is only read when
+	// they are renewed or revoked anyway.
+	if c.lazyLeaseRestore {
+		mgr.restoreWG.Add(1)
+		quitCh := mgr.quit()
+		go func() {
+			defer mgr.restoreWG.Done()
+			if err := mgr.restore(quitCh); err != nil {
+				c.logger.Printf("[ERR] expire: expiration state restore failed: %v", err)
+			}
+		}()
+		return nil
+	}
 	if err := c.expiration.Restore(); err != nil {
 		return fmt.Errorf("expiration state restore failed: %v", err)
 	}
 	return nil
 }
 
+// LeaseRestoreProgress returns how many leases the active node restored
+// since it was unsealed, out of how many, and whether it finished. ok is
+// false if the node is sealed or a standby.
+func (c *Core) LeaseRestoreProgress() (restored, total int, done, ok bool) {
+	c.stateLock.RLock()
+	defer c.stateLock.RUnlock()
+	if c.sealed || c.standby || c.expiration == nil {
+		return 0, 0, false, false
+	}
+	restored, total, done = c.expiration.RestoreProgress()
+	return restored, total, done, true
+}
+
 // stopExpiration is used to stop the expiration manager before
 // sealing the Vault.
 func (c *Core) stopExpiration() error {
@@ -111,66 +204,223 @@ func (c *Core) stopExpiration() error {
 	return nil
 }
 
-// Restore is used to recover the lease states when starting.
-// This is used after starting the vault.
+// Restore is used to recover the lease states when starting. The leases
+// are loaded in parallel.
 func (m *ExpirationManager) Restore() error {
-	m.pendingLock.Lock()
-	defer m.pendingLock.Unlock()
+	m.restoreWG.Add(1)
+	defer m.restoreWG.Done()
+	return m.restore(m.quit())
+}
+
+// quit returns the channel closed when the manager is stopped
+func (m *ExpirationManager) quit() <-chan struct{} {
+	m.quitLock.Lock()
+	defer m.quitLock.Unlock()
+	return m.quitCh
+}
+
+func (m *ExpirationManager) restore(quitCh <-chan struct{}) error {
+	defer metrics.MeasureSince([]string{"expire", "restore"}, time.Now())
+	atomic.StoreUint64(&m.restoreLoaded, 0)
+	atomic.StoreUint32(&m.restoreDone, 0)
+	defer atomic.StoreUint32(&m.restoreDone, 1)
 
 	// Accumulate existing leases
 	existing, err := CollectKeys(m.idView)
 	if err != nil {
 		return fmt.Errorf("failed to scan for leases: %v", err)
 	}
+	atomic.StoreUint64(&m.restoreTotal, uint64(len(existing)))
+
+	// Restore the leases with a pool of workers, stopping at the first
+	// error or when the manager is stopped
+	var wg sync.WaitGroup
+	var errLock sync.Mutex
+	var restoreErr error
+	leaseIDs := make(chan string)
+	abortCh := make(chan struct{})
+	for i := 0; i < restoreWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for leaseID := range leaseIDs {
+				if err := m.restoreEntry(leaseID); err != nil {
+					errLock.Lock()
+					if restoreErr == nil {
+						restoreErr = err
+						close(abortCh)
+					}
+					errLock.Unlock()
+					return
+				}
+				atomic.AddUint64(&m.restoreLoaded, 1)
+			}
+		}()
+	}
 
-	// Restore each key
+LOOP:
 	for _, leaseID := range existing {
-		// Load the entry
-		le, err := m.loadEntry(leaseID)
-		if err != nil {
-			return err
+		select {
+		case leaseIDs <- leaseID:
+		case <-abortCh:
+			break LOOP
+		case <-quitCh:
+			break LOOP
 		}
+	}
+	close(leaseIDs)
+	wg.Wait()
+	if restoreErr != nil {
+		return restoreErr
+	}
 
-		// If there is no entry, nothing to restore
-		if le == nil {
-			continue
-		}
+	m.pendingLock.Lock()
+	restored := len(m.pending)
+	m.pendingLock.Unlock()
+	if restored > 0 {
+		m.logger.Printf("[INFO] expire: restored %d leases", restored)
+	}
+	return nil
+}
 
-		// If there is no expiry time, don't do anything
-		if le.ExpireTime.IsZero() {
-			continue
-		}
+// restoreEntry sets up the revocation timer of a lease
+func (m *ExpirationManager) restoreEntry(leaseID string) error {
+	// Load the entry
+	le, err := m.loadEntry(leaseID)
+	if err != nil {
+		return err
+	}
 
-		// Determine the remaining time to expiration
-		expires := le.ExpireTime.Sub(time.Now())
-		if expires <= 0 {
-			expires = minRevokeDelay
-		}
+	// If there is no entry, nothing to restore
+	if le == nil {
+		return nil
+	}
 
-		// Setup revocation timer
-		m.pending[le.LeaseID] = time.AfterFunc(expires, func() {
-			m.expireID(le.LeaseID)
-		})
+	// If there is no expiry time, don't do anything
+	if le.ExpireTime.IsZero() {
+		return nil
 	}
-	if len(m.pending) > 0 {
-		m.logger.Printf("[INFO] expire: restored %d leases", len(m.pending))
+
+	// Irrevocable leases are only tracked
+	if le.RevokeErr != "" {
+		m.pendingLock.Lock()
+		m.irrevocable[le.LeaseID] = le.irrevocable()
+		m.pendingLock.Unlock()
+		return nil
+	}
+
+	// Determine the remaining time to expiration
+	expires := le.ExpireTime.Sub(time.Now())
+	if expires <= 0 {
+		expires = minRevokeDelay
+	}
+
+	// Setup revocation timer, unless the lease was renewed while restoring
+	// in the background
+	m.pendingLock.Lock()
+	defer m.pendingLock.Unlock()
+	if _, ok := m.pending[le.LeaseID]; ok {
+		return nil
 	}
+	m.addPending(le.LeaseID, leaseRole(le.Auth), time.AfterFunc(expires, func() {
+		m.expireID(le.LeaseID)
+	}))
 	return nil
 }
 
+// RestoreProgress returns how many leases have been restored out of those
+// found, and whether the restore finished
+func (m *ExpirationManager) RestoreProgress() (int, int, bool) {
+	return int(atomic.LoadUint64(&m.restoreLoaded)),
+		int(atomic.LoadUint64(&m.restoreTotal)),
+		atomic.LoadUint32(&m.restoreDone) == 1
+}
+
 // Stop is used to prevent further automatic revocations.
 // This must be called before sealing the view.
 func (m *ExpirationManager) Stop() error {
+	// Abort a restore in progress
+	m.quitLock.Lock()
+	close(m.quitCh)
+	m.quitCh = make(chan struct{})
+	m.quitLock.Unlock()
+	m.restoreWG.Wait()
+
 	// Stop all the pending expiration timers
 	m.pendingLock.Lock()
 	for _, timer := range m.pending {
 		timer.Stop()
 	}
 	m.pending = make(map[string]*time.Timer)
+	m.pendingRoles = make(map[string]string)
+	m.irrevocable = make(map[string]*IrrevocableLease)
+	for _, qc := range m.quotas {
+		qc.count = 0
+	}
 	m.pendingLock.Unlock()
 	return nil
 }
 
+// Tidy scans for the leases issued by a mount that no longer exists, or
+// belonging to a token that no longer exists, and removes them unless
+// dryRun is set. Leases of a missing mount are removed even though the
+// backend cannot revoke them; the others are revoked as usual.
+func (m *ExpirationManager) Tidy(dryRun bool) (*LeaseTidyResult, error) {
+	defer metrics.MeasureSince([]string{"expire", "tidy"}, time.Now())
+	if !atomic.CompareAndSwapUint32(&m.tidying, 0, 1) {
+		return nil, fmt.Errorf("a tidy is already in progress")
+	}
+	defer atomic.StoreUint32(&m.tidying, 0)
+
+	leaseIDs, err := CollectKeys(m.idView)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan for leases: %v", err)
+	}
+
+	result := &LeaseTidyResult{
+		Total: len(leaseIDs),
+	}
+	for _, leaseID := range leaseIDs {
+		le, err := m.loadEntry(leaseID)
+		if err != nil {
+			return nil, err
+		}
+		if le == nil {
+			continue
+		}
+
+		var force, skipToken bool
+		switch {
+		case m.router.MatchingMount(le.Path) == "":
+			result.MissingMount = append(result.MissingMount, leaseID)
+			force = true
+		case le.ClientToken != "":
+			te, err := m.tokenStore.Lookup(le.ClientToken)
+			if err != nil {
+				return nil, err
+			}
+			if te != nil {
+				continue
+			}
+			result.RevokedToken = append(result.RevokedToken, leaseID)
+			skipToken = true
+		default:
+			continue
+		}
+
+		if dryRun {
+			continue
+		}
+		if err := m.revokeCommon(leaseID, force, skipToken); err != nil {
+			m.logger.Printf("[ERR] expire: failed to tidy '%s': %v", leaseID, err)
+			result.Failed = append(result.Failed, leaseID)
+			continue
+		}
+		m.logger.Printf("[INFO] expire: tidied '%s'", leaseID)
+	}
+	return result, nil
+}
+
 // Revoke is used to revoke a secret named by the given LeaseID
 func (m *ExpirationManager) Revoke(leaseID string) error {
 	defer metrics.MeasureSince([]string{"expire", "revoke"}, time.Now())
@@ -218,8 +468,9 @@ func (m *ExpirationManager) revokeCommon(leaseID string, force, skipToken bool)
 	m.pendingLock.Lock()
 	if timer, ok := m.pending[leaseID]; ok {
 		timer.Stop()
-		delete(m.pending, leaseID)
+		m.removePending(leaseID)
 	}
+	delete(m.irrevocable, leaseID)
 	m.pendingLock.Unlock()
 	return nil
 }
@@ -538,14 +789,14 @@ func (m *ExpirationManager) updatePending(le *leaseEntry, leaseTotal time.Durati
 		timer := time.AfterFunc(leaseTotal, func() {
 			m.expireID(le.LeaseID)
 		})
-		m.pending[le.LeaseID] = timer
+		m.addPending(le.LeaseID, leaseRole(le.Auth), timer)
 		return
 	}
 
 	// Delete the timer if the expiration time is zero
 	if ok && leaseTotal == 0 {
 		timer.Stop()
-		delete(m.pending, le.LeaseID)
+		m.removePending(le.LeaseID)
 		return
 	}
 
@@ -555,23 +806,103 @@ func (m *ExpirationManager) updatePending(le *leaseEntry, leaseTotal time.Durati
 	}
 }
 
+// addPending records the timer of a lease and counts it in the quotas.
+// This must be called with pendingLock held.
+func (m *ExpirationManager) addPending(leaseID, role string, timer *time.Timer) {
+	m.pending[leaseID] = timer
+	if role != "" {
+		m.pendingRoles[leaseID] = role
+	}
+	m.countLease(leaseID, role, 1)
+}
+
+// removePending forgets the timer of a lease and uncounts it from the
+// quotas. This must be called with pendingLock held.
+func (m *ExpirationManager) removePending(leaseID string) {
+	if _, ok := m.pending[leaseID]; !ok {
+		return
+	}
+	role := m.pendingRoles[leaseID]
+	delete(m.pending, leaseID)
+	delete(m.pendingRoles, leaseID)
+	m.countLease(leaseID, role, -1)
+}
+
 // expireID is invoked when a given ID is expired
 func (m *ExpirationManager) expireID(leaseID string) {
 	// Clear from the pending expiration
 	m.pendingLock.Lock()
-	delete(m.pending, leaseID)
+	m.removePending(leaseID)
 	m.pendingLock.Unlock()
 
+	var err error
 	for attempt := uint(0); attempt < maxRevokeAttempts; attempt++ {
-		err := m.Revoke(leaseID)
+		err = m.Revoke(leaseID)
 		if err == nil {
 			m.logger.Printf("[INFO] expire: revoked '%s'", leaseID)
+			m.events.Publish(EventLeaseExpired, map[string]interface{}{
+				"lease_id": leaseID,
+			})
 			return
 		}
 		m.logger.Printf("[ERR] expire: failed to revoke '%s': %v", leaseID, err)
 		time.Sleep((1 << attempt) * revokeRetryBase)
 	}
-	m.logger.Printf("[ERR] expire: maximum revoke attempts for '%s' reached", leaseID)
+	m.logger.Printf("[ERR] expire: maximum revoke attempts for '%s' reached, marking it irrevocable", leaseID)
+	if err := m.markIrrevocable(leaseID, err); err != nil {
+		m.logger.Printf("[ERR] expire: failed to mark '%s' irrevocable: %v", leaseID, err)
+	}
+}
+
+// markIrrevocable records that a lease could not be revoked, so that it is
+// reported and no longer retried, including after a restart
+func (m *ExpirationManager) markIrrevocable(leaseID string, revokeErr error) error {
+	le, err := m.loadEntry(leaseID)
+	if err != nil {
+		return err
+	}
+	if le == nil {
+		return nil
+	}
+
+	le.RevokeErr = revokeErr.Error()
+	if err := m.persistEntry(le); err != nil {
+		return err
+	}
+
+	m.pendingLock.Lock()
+	m.irrevocable[leaseID] = le.irrevocable()
+	m.pendingLock.Unlock()
+	return nil
+}
+
+// LeaseCounts returns the number of leases pending expiration and of
+// irrevocable leases
+func (m *ExpirationManager) LeaseCounts() (int, int) {
+	m.pendingLock.Lock()
+	defer m.pendingLock.Unlock()
+	return len(m.pending), len(m.irrevocable)
+}
+
+// IrrevocableLeases returns the irrevocable leases sorted by ID, up to
+// maxIrrevocableLeasesListed of them, along with their total number
+func (m *ExpirationManager) IrrevocableLeases() ([]*IrrevocableLease, int) {
+	m.pendingLock.Lock()
+	leaseIDs := make([]string, 0, len(m.irrevocable))
+	for leaseID := range m.irrevocable {
+		leaseIDs = append(leaseIDs, leaseID)
+	}
+	sort.Strings(leaseIDs)
+	if len(leaseIDs) > maxIrrevocableLeasesListed {
+		leaseIDs = leaseIDs[:maxIrrevocableLeasesListed]
+	}
+	leases := make([]*IrrevocableLease, 0, len(leaseIDs))
+	for _, leaseID := range leaseIDs {
+		leases = append(leases, m.irrevocable[leaseID])
+	}
+	total := len(m.irrevocable)
+	m.pendingLock.Unlock()
+	return leases, total
 }
 
 // revokeEntry is used to attempt revocation of an internal entry
@@ -733,8 +1064,15 @@ func (m *ExpirationManager) lookupByToken(token string) ([]string, error) {
 func (m *ExpirationManager) emitMetrics() {
 	m.pendingLock.Lock()
 	num := len(m.pending)
+	var numTokens int
+	for leaseID := range m.pending {
+		if strings.HasPrefix(leaseID, "auth/") {
+			numTokens++
+		}
+	}
 	m.pendingLock.Unlock()
 	metrics.SetGauge([]string{"expire", "num_leases"}, float32(num))
+	metrics.SetGauge([]string{"token", "count"}, float32(numTokens))
 }
 
 // leaseEntry is used to structure the values the expiration
@@ -749,6 +1087,20 @@ type leaseEntry struct {
 	IssueTime       time.Time              `json:"issue_time"`
 	ExpireTime      time.Time              `json:"expire_time"`
 	LastRenewalTime time.Time              `json:"last_renewal_time"`
+
+	// RevokeErr is the last error of a lease that could not be revoked
+	// when it expired, which is no longer retried
+	RevokeErr string `json:"revoke_err,omitempty"`
+}
+
+// irrevocable returns the description of an irrevocable lease
+func (le *leaseEntry) irrevocable() *IrrevocableLease {
+	return &IrrevocableLease{
+		LeaseID:    le.LeaseID,
+		Path:       le.Path,
+		ExpireTime: le.ExpireTime,
+		Error:      le.RevokeErr,
+	}
 }
 
 // encode is used to JSON encode the lease entry
@@ -68,6 +68,9 @@ func TestExpiration_Restore(t *testing.T) {
 	if err != nil {
 		t.Fatalf("err: %v", err)
 	}
+	if restored, total, done := exp.RestoreProgress(); restored != 3 || total != 3 || !done {
+		t.Fatalf("bad: %d %d %t", restored, total, done)
+	}
 
 	// Ensure all are reaped
 	start := time.Now()
@@ -89,6 +92,95 @@ func TestExpiration_Restore(t *testing.T) {
 	}
 }
 
+func TestExpiration_Restore_renewed(t *testing.T) {
+	exp := mockExpiration(t)
+	req := &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "prod/aws/foo",
+	}
+	resp := &logical.Response{
+		Secret: &logical.Secret{
+			LeaseOptions: logical.LeaseOptions{
+				TTL: time.Hour,
+			},
+		},
+	}
+	id, err := exp.Register(req, resp)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := exp.Stop(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// A lease renewed before it is restored keeps its timer
+	timer := time.AfterFunc(time.Hour, func() {})
+	defer timer.Stop()
+	exp.pendingLock.Lock()
+	exp.pending[id] = timer
+	exp.pendingLock.Unlock()
+
+	if err := exp.Restore(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	exp.pendingLock.Lock()
+	defer exp.pendingLock.Unlock()
+	if len(exp.pending) != 1 || exp.pending[id] != timer {
+		t.Fatalf("bad: %v", exp.pending)
+	}
+}
+
+func TestCore_LazyLeaseRestore(t *testing.T) {
+	c, key, root := TestCoreUnsealed(t)
+	req := &logical.Request{
+		Operation:   logical.UpdateOperation,
+		Path:        "secret/foo",
+		Data:        map[string]interface{}{"ttl": "1h", "foo": "bar"},
+		ClientToken: root,
+	}
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req.Operation = logical.ReadOperation
+	req.Data = nil
+	for i := 0; i < 10; i++ {
+		if _, err := c.HandleRequest(req); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	if err := c.Seal(root); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, _, _, ok := c.LeaseRestoreProgress(); ok {
+		t.Fatal("should not report progress while sealed")
+	}
+
+	c.lazyLeaseRestore = true
+	if unseal, err := TestCoreUnseal(c, key); err != nil || !unseal {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The leases are restored in the background
+	start := time.Now()
+	for {
+		restored, total, done, ok := c.LeaseRestoreProgress()
+		if !ok {
+			t.Fatal("expected progress")
+		}
+		if done {
+			if restored != total || total < 10 {
+				t.Fatalf("bad: %d %d", restored, total)
+			}
+			break
+		}
+		if time.Now().Sub(start) > time.Second {
+			t.Fatal("restore did not complete")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
 func TestExpiration_Register(t *testing.T) {
 	exp := mockExpiration(t)
 	req := &logical.Request{
@@ -1048,3 +1140,147 @@ func badRenewFactory(conf *logical.BackendConfig) (logical.Backend, error) {
 
 	return be.Setup(conf)
 }
+
+func TestExpiration_Tidy(t *testing.T) {
+	_, ts, _, root := TestCoreWithTokenStore(t)
+	exp := ts.expiration
+	noop := &NoopBackend{}
+	_, barrier, _ := mockBarrier(t)
+	view := NewBarrierView(barrier, "logical/")
+	meUUID, err := uuid.GenerateUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp.router.Mount(noop, "prod/aws/", &MountEntry{UUID: meUUID}, view)
+
+	register := func(path, token string) string {
+		req := &logical.Request{
+			Operation:   logical.ReadOperation,
+			Path:        path,
+			ClientToken: token,
+		}
+		resp := &logical.Response{
+			Secret: &logical.Secret{
+				LeaseOptions: logical.LeaseOptions{
+					TTL: time.Hour,
+				},
+			},
+		}
+		leaseID, err := exp.Register(req, resp)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		return leaseID
+	}
+	live := register("prod/aws/foo", root)
+	noToken := register("prod/aws/bar", "")
+	missingMount := register("prod/gone/foo", root)
+	revokedToken := register("prod/aws/zip", "foobarbaz")
+
+	// A dry run only reports the orphaned leases
+	result, err := exp.Tidy(true)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expected := &LeaseTidyResult{
+		Total:        4,
+		MissingMount: []string{missingMount},
+		RevokedToken: []string{revokedToken},
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("bad: %#v", result)
+	}
+	if len(noop.Requests) != 0 {
+		t.Fatalf("bad: %v", noop.Requests)
+	}
+
+	result, err = exp.Tidy(false)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(result, expected) {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	// The lease of the revoked token was revoked by the backend
+	if len(noop.Requests) != 1 || noop.Requests[0].Operation != logical.RevokeOperation {
+		t.Fatalf("bad: %v", noop.Requests)
+	}
+
+	for _, leaseID := range []string{live, noToken, missingMount, revokedToken} {
+		le, err := exp.loadEntry(leaseID)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		kept := leaseID == live || leaseID == noToken
+		if (le != nil) != kept {
+			t.Fatalf("%s: expected kept %v, got %#v", leaseID, kept, le)
+		}
+	}
+}
+
+func TestExpiration_Irrevocable(t *testing.T) {
+	exp := mockExpiration(t)
+	noop := &NoopBackend{}
+	_, barrier, _ := mockBarrier(t)
+	view := NewBarrierView(barrier, "logical/")
+	meUUID, err := uuid.GenerateUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp.router.Mount(noop, "prod/aws/", &MountEntry{UUID: meUUID}, view)
+
+	req := &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      "prod/aws/foo",
+	}
+	resp := &logical.Response{
+		Secret: &logical.Secret{
+			LeaseOptions: logical.LeaseOptions{
+				TTL: time.Hour,
+			},
+		},
+	}
+	leaseID, err := exp.Register(req, resp)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Give up on revoking the lease as expireID does
+	exp.pendingLock.Lock()
+	exp.pending[leaseID].Stop()
+	exp.removePending(leaseID)
+	exp.pendingLock.Unlock()
+	if err := exp.markIrrevocable(leaseID, fmt.Errorf("backend unavailable")); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The lease stays irrevocable after a restart
+	if err := exp.Stop(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := exp.Restore(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if active, irrevocable := exp.LeaseCounts(); active != 0 || irrevocable != 1 {
+		t.Fatalf("bad: %d %d", active, irrevocable)
+	}
+	leases, total := exp.IrrevocableLeases()
+	if total != 1 || len(leases) != 1 {
+		t.Fatalf("bad: %d %#v", total, leases)
+	}
+	if leases[0].LeaseID != leaseID || leases[0].Path != "prod/aws/foo" || leases[0].Error != "backend unavailable" {
+		t.Fatalf("bad: %#v", leases[0])
+	}
+
+	// Revoking the lease once the backend works removes it
+	if err := exp.Revoke(leaseID); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(noop.Requests) != 1 || noop.Requests[0].Operation != logical.RevokeOperation {
+		t.Fatalf("bad: %v", noop.Requests)
+	}
+	if _, irrevocable := exp.LeaseCounts(); irrevocable != 0 {
+		t.Fatalf("bad: %d", irrevocable)
+	}
+}
@@ -0,0 +1,683 @@
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/physical"
+	"github.com/mitchellh/copystructure"
+)
+
+const (
+	// identitySubPath is the sub-path used for the identity store view.
+	// This is nested under the system view.
+	identitySubPath = "identity/"
+
+	// entityPrefix is the prefix of the entities in the identity store
+	// view, one entry per entity
+	entityPrefix = "entity/"
+)
+
+// Entity is the identity of a principal. It ties together the aliases of
+// the principal in the auth mounts it logs in through, so that the tokens
+// issued by any of them are tracked as one identity, and are granted the
+// policies of the entity.
+type Entity struct {
+	ID       string            `json:"id"`
+	Name     string            `json:"name"`
+	Policies []string          `json:"policies"`
+	Metadata map[string]string `json:"metadata"`
+	Aliases  []*EntityAlias    `json:"aliases"`
+
+	// MergedEntityIDs are the IDs of the entities merged into this one.
+	// The tokens tied to them are tied to this entity instead.
+	MergedEntityIDs []string `json:"merged_entity_ids,omitempty"`
+
+	// NamespaceID is the ID of the namespace the entity was created in,
+	// through a login to one of its auth mounts
+	NamespaceID string `json:"namespace_id,omitempty"`
+
+	CreationTime   time.Time `json:"creation_time"`
+	LastUpdateTime time.Time `json:"last_update_time"`
+}
+
+// EntityAlias is the identity of an entity within an auth mount, as
+// reported by the backend on login
+type EntityAlias struct {
+	ID        string            `json:"id"`
+	MountPath string            `json:"mount_path"`
+	MountType string            `json:"mount_type"`
+	Name      string            `json:"name"`
+	Metadata  map[string]string `json:"metadata"`
+
+	CreationTime   time.Time `json:"creation_time"`
+	LastUpdateTime time.Time `json:"last_update_time"`
+}
+
+// clone returns a deep copy of the entity, which can be handed out or
+// modified without holding the identity store lock
+func (e *Entity) clone() *Entity {
+	c, err := copystructure.Copy(e)
+	if err != nil {
+		// Entities only hold plain data, which can always be copied
+		panic(err)
+	}
+	return c.(*Entity)
+}
+
+// alias returns the alias with the given ID, or nil
+func (e *Entity) alias(id string) *EntityAlias {
+	for _, alias := range e.Aliases {
+		if alias.ID == id {
+			return alias
+		}
+	}
+	return nil
+}
+
+// aliasKey identifies an alias by the auth mount and its name within
+// the mount
+type aliasKey struct {
+	mountPath string
+	name      string
+}
+
+// IdentityStore keeps the entities, indexed by their name, aliases and the
+// IDs of the entities merged into them, and the groups of entities. The
+// entities and groups are all held in memory, and persisted on every
+// change.
+type IdentityStore struct {
+	view *BarrierView
+
+	lock     sync.RWMutex
+	entities map[string]*Entity
+	names    map[string]string   // entity name to entity ID
+	aliases  map[aliasKey]string // alias to entity ID
+	aliasIDs map[string]string   // alias ID to entity ID
+	merged   map[string]string   // merged entity ID to entity ID
+
+	groups        map[string]*Group
+	groupNames    map[string]string              // group name to group ID
+	groupAliases  map[aliasKey]string            // group alias to group ID
+	groupAliasIDs map[string]string              // group alias ID to group ID
+	memberships   map[string]map[string]struct{} // entity ID to group IDs
+}
+
+// NewIdentityStore creates an empty identity store persisting the entities
+// and groups to the given view
+func NewIdentityStore(view *BarrierView) *IdentityStore {
+	return &IdentityStore{
+		view:     view,
+		entities: make(map[string]*Entity),
+		names:    make(map[string]string),
+		aliases:  make(map[aliasKey]string),
+		aliasIDs: make(map[string]string),
+		merged:   make(map[string]string),
+
+		groups:        make(map[string]*Group),
+		groupNames:    make(map[string]string),
+		groupAliases:  make(map[aliasKey]string),
+		groupAliasIDs: make(map[string]string),
+		memberships:   make(map[string]map[string]struct{}),
+	}
+}
+
+// setupIdentityStore is used to initialize the identity store when
+// the vault is being unsealed
+func (c *Core) setupIdentityStore() error {
+	view := c.systemBarrierView.SubView(identitySubPath)
+
+	is := NewIdentityStore(view)
+	if err := is.load(); err != nil {
+		return errwrap.Wrapf("failed to load identity store: {{err}}", err)
+	}
+	c.identityStore = is
+	return nil
+}
+
+// teardownIdentityStore is used to reverse setupIdentityStore when the
+// vault is being sealed
+func (c *Core) teardownIdentityStore() error {
+	c.identityStore = nil
+	return nil
+}
+
+// tokenPolicies returns the policies granted to a token, which are its own
+// and those of its entity and of the groups of the entity. If the entity
+// was merged into another, the entity ID of the token is updated to the one
+// of the resulting entity.
+func (c *Core) tokenPolicies(te *TokenEntry) []string {
+	if te.EntityID == "" || c.identityStore == nil {
+		return te.Policies
+	}
+	entity := c.identityStore.Entity(te.EntityID)
+	if entity == nil {
+		return te.Policies
+	}
+	te.EntityID = entity.ID
+	policies := append(append([]string{}, te.Policies...), entity.Policies...)
+	return append(policies, c.identityStore.EntityGroupPolicies(entity.ID)...)
+}
+
+// tokenEntity returns the entity a token is tied to, or nil
+func (c *Core) tokenEntity(te *TokenEntry) *Entity {
+	if te.EntityID == "" || c.identityStore == nil {
+		return nil
+	}
+	return c.identityStore.Entity(te.EntityID)
+}
+
+// load reads all the entities and groups and indexes them
+func (is *IdentityStore) load() error {
+	ids, err := is.view.List(entityPrefix)
+	if err != nil {
+		return fmt.Errorf("failed to list entities: %v", err)
+	}
+
+	entities := make([]*Entity, 0, len(ids))
+	for _, id := range ids {
+		raw, err := is.view.Get(entityPrefix + id)
+		if err != nil {
+			return fmt.Errorf("failed to read entity %s: %v", id, err)
+		}
+		if raw == nil {
+			continue
+		}
+		entity := new(Entity)
+		if err := jsonutil.DecodeJSON(raw.Value, entity); err != nil {
+			return fmt.Errorf("failed to decode entity %s: %v", id, err)
+		}
+		entities = append(entities, entity)
+	}
+
+	groups, err := is.readGroups()
+	if err != nil {
+		return err
+	}
+
+	is.lock.Lock()
+	defer is.lock.Unlock()
+
+	// A merge persists the merged entity before removing the entities
+	// merged into it, so those may be left behind and are skipped
+	for _, entity := range entities {
+		for _, mergedID := range entity.MergedEntityIDs {
+			is.merged[mergedID] = entity.ID
+		}
+	}
+	for _, entity := range entities {
+		if _, ok := is.merged[entity.ID]; ok {
+			continue
+		}
+		is.index(entity)
+	}
+	for _, group := range groups {
+		is.indexGroup(group)
+	}
+	return nil
+}
+
+// index adds the entity to the indexes. This must be called with the lock
+// held.
+func (is *IdentityStore) index(entity *Entity) {
+	is.entities[entity.ID] = entity
+	is.names[entity.Name] = entity.ID
+	for _, alias := range entity.Aliases {
+		is.aliases[aliasKey{alias.MountPath, alias.Name}] = entity.ID
+		is.aliasIDs[alias.ID] = entity.ID
+	}
+	for _, mergedID := range entity.MergedEntityIDs {
+		is.merged[mergedID] = entity.ID
+	}
+}
+
+// unindex removes the entity from the indexes. This must be called with the
+// lock held.
+func (is *IdentityStore) unindex(entity *Entity) {
+	delete(is.entities, entity.ID)
+	delete(is.names, entity.Name)
+	for _, alias := range entity.Aliases {
+		delete(is.aliases, aliasKey{alias.MountPath, alias.Name})
+		delete(is.aliasIDs, alias.ID)
+	}
+	for _, mergedID := range entity.MergedEntityIDs {
+		delete(is.merged, mergedID)
+	}
+}
+
+// entityTxn returns the operation writing the entity to storage
+func entityTxn(entity *Entity) (*TxnEntry, error) {
+	buf, err := json.Marshal(entity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode entity: %v", err)
+	}
+	return &TxnEntry{
+		Operation: physical.PutOperation,
+		Entry: &Entry{
+			Key:   entityPrefix + entity.ID,
+			Value: buf,
+		},
+	}, nil
+}
+
+// replace persists the updated version of an entity and indexes it in
+// place of the current one. This must be called with the lock held.
+func (is *IdentityStore) replace(current, updated *Entity) error {
+	updated.LastUpdateTime = time.Now().UTC()
+	txn, err := entityTxn(updated)
+	if err != nil {
+		return err
+	}
+	if err := is.view.Put(txn.Entry.Logical()); err != nil {
+		return fmt.Errorf("failed to persist entity: %v", err)
+	}
+	if current != nil {
+		is.unindex(current)
+	}
+	is.index(updated)
+	return nil
+}
+
+// resolve returns the entity with the given ID, or the one it was merged
+// into. This must be called with the lock held.
+func (is *IdentityStore) resolve(id string) *Entity {
+	if entity, ok := is.entities[id]; ok {
+		return entity
+	}
+	if mergedID, ok := is.merged[id]; ok {
+		return is.entities[mergedID]
+	}
+	return nil
+}
+
+// validateIdentityPolicies sanitizes the policies of an entity or group
+// and checks that they can be attached to it
+func validateIdentityPolicies(policies []string) ([]string, error) {
+	policies = policyutil.SanitizePolicies(policies, false)
+	if strutil.StrListContains(policies, "root") {
+		return nil, fmt.Errorf("entities and groups cannot have the root policy")
+	}
+	return policies, nil
+}
+
+// Entity returns the entity with the given ID, or the one it was merged
+// into, or nil if there is none
+func (is *IdentityStore) Entity(id string) *Entity {
+	is.lock.RLock()
+	defer is.lock.RUnlock()
+	if entity := is.resolve(id); entity != nil {
+		return entity.clone()
+	}
+	return nil
+}
+
+// EntityByName returns the entity with the given name, or nil
+func (is *IdentityStore) EntityByName(name string) *Entity {
+	is.lock.RLock()
+	defer is.lock.RUnlock()
+	if id, ok := is.names[name]; ok {
+		return is.entities[id].clone()
+	}
+	return nil
+}
+
+// EntityIDs returns the IDs of all the entities, sorted
+func (is *IdentityStore) EntityIDs() []string {
+	is.lock.RLock()
+	defer is.lock.RUnlock()
+	ids := make([]string, 0, len(is.entities))
+	for id := range is.entities {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Alias returns the alias with the given ID and the ID of its entity, or
+// nil if there is none
+func (is *IdentityStore) Alias(id string) (*EntityAlias, string) {
+	is.lock.RLock()
+	defer is.lock.RUnlock()
+	entityID, ok := is.aliasIDs[id]
+	if !ok {
+		return nil, ""
+	}
+	return is.entities[entityID].clone().alias(id), entityID
+}
+
+// CreateEntity creates an entity without aliases. A name is generated if
+// none is given.
+func (is *IdentityStore) CreateEntity(name string, policies []string, metadata map[string]string) (*Entity, error) {
+	policies, err := validateIdentityPolicies(policies)
+	if err != nil {
+		return nil, err
+	}
+
+	is.lock.Lock()
+	defer is.lock.Unlock()
+
+	entity, err := is.newEntity(name)
+	if err != nil {
+		return nil, err
+	}
+	entity.Policies = policies
+	entity.Metadata = metadata
+
+	if err := is.replace(nil, entity); err != nil {
+		return nil, err
+	}
+	return entity.clone(), nil
+}
+
+// newEntity returns a new entity with a unique ID and name. This must be
+// called with the lock held.
+func (is *IdentityStore) newEntity(name string) (*Entity, error) {
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate entity ID: %v", err)
+	}
+	if name == "" {
+		name = "entity_" + id[:8]
+	}
+	if _, ok := is.names[name]; ok {
+		return nil, fmt.Errorf("an entity named %q already exists", name)
+	}
+
+	now := time.Now().UTC()
+	return &Entity{
+		ID:             id,
+		Name:           name,
+		Policies:       []string{},
+		CreationTime:   now,
+		LastUpdateTime: now,
+	}, nil
+}
+
+// UpdateEntity sets the name, policies and metadata of an entity. Empty
+// names and nil policies or metadata are left unchanged.
+func (is *IdentityStore) UpdateEntity(id, name string, policies []string, metadata map[string]string) (*Entity, error) {
+	if policies != nil {
+		var err error
+		if policies, err = validateIdentityPolicies(policies); err != nil {
+			return nil, err
+		}
+	}
+
+	is.lock.Lock()
+	defer is.lock.Unlock()
+
+	current, ok := is.entities[id]
+	if !ok {
+		return nil, fmt.Errorf("entity not found")
+	}
+
+	updated := current.clone()
+	if name != "" && name != current.Name {
+		if _, ok := is.names[name]; ok {
+			return nil, fmt.Errorf("an entity named %q already exists", name)
+		}
+		updated.Name = name
+	}
+	if policies != nil {
+		updated.Policies = policies
+	}
+	if metadata != nil {
+		updated.Metadata = metadata
+	}
+
+	if err := is.replace(current, updated); err != nil {
+		return nil, err
+	}
+	return updated.clone(), nil
+}
+
+// DeleteEntity removes an entity along with its aliases, and from its
+// groups. The tokens tied to it lose the policies of the entity.
+func (is *IdentityStore) DeleteEntity(id string) error {
+	is.lock.Lock()
+	defer is.lock.Unlock()
+
+	entity, ok := is.entities[id]
+	if !ok {
+		return nil
+	}
+	// The entity is deleted along with its memberships
+	err := is.replaceGroupMember([]string{id}, "", &TxnEntry{
+		Operation: physical.DeleteOperation,
+		Entry:     &Entry{Key: entityPrefix + id},
+	})
+	if err != nil {
+		return err
+	}
+	is.unindex(entity)
+	return nil
+}
+
+// CreateAlias ties the principal with the given name in an auth mount to an
+// existing entity, so that its logins are tracked as that entity rather
+// than a new one
+func (is *IdentityStore) CreateAlias(entityID, mountPath, mountType, name string, metadata map[string]string) (*EntityAlias, error) {
+	if name == "" {
+		return nil, fmt.Errorf("missing alias name")
+	}
+
+	is.lock.Lock()
+	defer is.lock.Unlock()
+
+	current, ok := is.entities[entityID]
+	if !ok {
+		return nil, fmt.Errorf("entity not found")
+	}
+	if otherID, ok := is.aliases[aliasKey{mountPath, name}]; ok {
+		return nil, fmt.Errorf("alias %q of mount %q is already tied to entity %s", name, mountPath, otherID)
+	}
+
+	alias, err := newEntityAlias(mountPath, mountType, name, metadata)
+	if err != nil {
+		return nil, err
+	}
+	updated := current.clone()
+	updated.Aliases = append(updated.Aliases, alias)
+
+	if err := is.replace(current, updated); err != nil {
+		return nil, err
+	}
+	return updated.alias(alias.ID), nil
+}
+
+// newEntityAlias returns a new alias with a unique ID
+func newEntityAlias(mountPath, mountType, name string, metadata map[string]string) (*EntityAlias, error) {
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate alias ID: %v", err)
+	}
+	now := time.Now().UTC()
+	return &EntityAlias{
+		ID:             id,
+		MountPath:      mountPath,
+		MountType:      mountType,
+		Name:           name,
+		Metadata:       metadata,
+		CreationTime:   now,
+		LastUpdateTime: now,
+	}, nil
+}
+
+// DeleteAlias removes an alias from its entity. The next login of the
+// principal creates a new entity.
+func (is *IdentityStore) DeleteAlias(id string) error {
+	is.lock.Lock()
+	defer is.lock.Unlock()
+
+	entityID, ok := is.aliasIDs[id]
+	if !ok {
+		return nil
+	}
+	current := is.entities[entityID]
+
+	updated := current.clone()
+	aliases := updated.Aliases[:0]
+	for _, alias := range updated.Aliases {
+		if alias.ID != id {
+			aliases = append(aliases, alias)
+		}
+	}
+	updated.Aliases = aliases
+
+	return is.replace(current, updated)
+}
+
+// EntityForAlias returns the entity the alias reported by the backend of an
+// auth mount on login is tied to, creating the entity if the principal
+// logs in for the first time. The metadata of the alias is updated.
+func (is *IdentityStore) EntityForAlias(namespaceID, mountPath, mountType string, alias *logical.Alias) (*Entity, error) {
+	if alias.Name == "" {
+		return nil, fmt.Errorf("missing alias name")
+	}
+	key := aliasKey{mountPath, alias.Name}
+
+	// Logins of known principals usually change nothing
+	is.lock.RLock()
+	if entityID, ok := is.aliases[key]; ok {
+		entity := is.entities[entityID]
+		if current := is.findAlias(entity, key); current != nil && sameMetadata(current.Metadata, alias.Metadata) {
+			is.lock.RUnlock()
+			return entity.clone(), nil
+		}
+	}
+	is.lock.RUnlock()
+
+	is.lock.Lock()
+	defer is.lock.Unlock()
+
+	var current, updated *Entity
+	if entityID, ok := is.aliases[key]; ok {
+		current = is.entities[entityID]
+		updated = current.clone()
+		entityAlias := is.findAlias(updated, key)
+		entityAlias.Metadata = alias.Metadata
+		entityAlias.LastUpdateTime = time.Now().UTC()
+	} else {
+		var err error
+		if updated, err = is.newEntity(""); err != nil {
+			return nil, err
+		}
+		updated.NamespaceID = namespaceID
+		entityAlias, err := newEntityAlias(mountPath, mountType, alias.Name, alias.Metadata)
+		if err != nil {
+			return nil, err
+		}
+		updated.Aliases = []*EntityAlias{entityAlias}
+	}
+
+	if err := is.replace(current, updated); err != nil {
+		return nil, err
+	}
+	return updated.clone(), nil
+}
+
+// findAlias returns the alias of the entity with the given key
+func (is *IdentityStore) findAlias(entity *Entity, key aliasKey) *EntityAlias {
+	for _, alias := range entity.Aliases {
+		if alias.MountPath == key.mountPath && alias.Name == key.name {
+			return alias
+		}
+	}
+	return nil
+}
+
+// sameMetadata returns whether two sets of metadata are equal, an empty set
+// being equal to a nil one
+func sameMetadata(a, b map[string]string) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// MergeEntities merges entities into another one, which takes over their
+// aliases, policies, groups and the metadata keys it does not have. The
+// merged entities are removed, and the tokens tied to them are tied to the
+// resulting entity instead.
+func (is *IdentityStore) MergeEntities(toID string, fromIDs []string) (*Entity, error) {
+	if len(fromIDs) == 0 {
+		return nil, fmt.Errorf("missing entities to merge")
+	}
+
+	is.lock.Lock()
+	defer is.lock.Unlock()
+
+	current, ok := is.entities[toID]
+	if !ok {
+		return nil, fmt.Errorf("entity %s not found", toID)
+	}
+
+	updated := current.clone()
+	var from []*Entity
+	for _, fromID := range strutil.RemoveDuplicates(fromIDs) {
+		if fromID == toID {
+			return nil, fmt.Errorf("an entity cannot be merged into itself")
+		}
+		entity, ok := is.entities[fromID]
+		if !ok {
+			return nil, fmt.Errorf("entity %s not found", fromID)
+		}
+		from = append(from, entity)
+
+		entity = entity.clone()
+		updated.Aliases = append(updated.Aliases, entity.Aliases...)
+		updated.Policies = append(updated.Policies, entity.Policies...)
+		for k, v := range entity.Metadata {
+			if _, ok := updated.Metadata[k]; ok {
+				continue
+			}
+			if updated.Metadata == nil {
+				updated.Metadata = make(map[string]string)
+			}
+			updated.Metadata[k] = v
+		}
+		updated.MergedEntityIDs = append(updated.MergedEntityIDs, entity.ID)
+		updated.MergedEntityIDs = append(updated.MergedEntityIDs, entity.MergedEntityIDs...)
+	}
+	updated.Policies = policyutil.SanitizePolicies(updated.Policies, false)
+	updated.LastUpdateTime = time.Now().UTC()
+
+	// The resulting entity is written, the merged entities deleted and the
+	// group memberships taken over in a single transaction
+	txn, err := entityTxn(updated)
+	if err != nil {
+		return nil, err
+	}
+	txns := []*TxnEntry{txn}
+	var mergedIDs []string
+	for _, entity := range from {
+		txns = append(txns, &TxnEntry{
+			Operation: physical.DeleteOperation,
+			Entry:     &Entry{Key: entityPrefix + entity.ID},
+		})
+		mergedIDs = append(mergedIDs, entity.ID)
+	}
+	if err := is.replaceGroupMember(mergedIDs, toID, txns...); err != nil {
+		return nil, err
+	}
+
+	// The resulting entity is indexed last, as unindexing the merged
+	// entities drops the aliases and merged IDs they share with it
+	is.unindex(current)
+	for _, entity := range from {
+		is.unindex(entity)
+	}
+	is.index(updated)
+
+	return updated.clone(), nil
+}
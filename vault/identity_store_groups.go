@@ -0,0 +1,508 @@
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/physical"
+	"github.com/mitchellh/copystructure"
+)
+
+const (
+	// groupPrefix is the prefix of the groups in the identity store view,
+	// one entry per group
+	groupPrefix = "group/"
+)
+
+const (
+	// GroupTypeInternal is the type of the groups whose members are managed
+	// by operators
+	GroupTypeInternal = "internal"
+
+	// GroupTypeExternal is the type of the groups mapped to a group of an
+	// auth backend, such as an LDAP group. Their members are the entities
+	// whose last login through the auth mount reported the group.
+	GroupTypeExternal = "external"
+)
+
+// Group is a set of entities, whose policies are granted to the tokens of
+// its members
+type Group struct {
+	ID       string            `json:"id"`
+	Name     string            `json:"name"`
+	Type     string            `json:"type"`
+	Policies []string          `json:"policies"`
+	Metadata map[string]string `json:"metadata"`
+
+	// MemberEntityIDs are the IDs of the entities of the group. They are
+	// set by operators for internal groups, and on login for external
+	// groups.
+	MemberEntityIDs []string `json:"member_entity_ids"`
+
+	// Alias maps an external group to the group of an auth backend
+	Alias *GroupAlias `json:"alias,omitempty"`
+
+	CreationTime   time.Time `json:"creation_time"`
+	LastUpdateTime time.Time `json:"last_update_time"`
+}
+
+// GroupAlias is the name of a group within an auth mount, as reported by the
+// backend on login
+type GroupAlias struct {
+	ID           string    `json:"id"`
+	MountPath    string    `json:"mount_path"`
+	MountType    string    `json:"mount_type"`
+	Name         string    `json:"name"`
+	CreationTime time.Time `json:"creation_time"`
+}
+
+// clone returns a deep copy of the group
+func (g *Group) clone() *Group {
+	c, err := copystructure.Copy(g)
+	if err != nil {
+		// Groups only hold plain data, which can always be copied
+		panic(err)
+	}
+	return c.(*Group)
+}
+
+// readGroups reads all the groups from storage
+func (is *IdentityStore) readGroups() ([]*Group, error) {
+	ids, err := is.view.List(groupPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups: %v", err)
+	}
+
+	groups := make([]*Group, 0, len(ids))
+	for _, id := range ids {
+		raw, err := is.view.Get(groupPrefix + id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read group %s: %v", id, err)
+		}
+		if raw == nil {
+			continue
+		}
+		group := new(Group)
+		if err := jsonutil.DecodeJSON(raw.Value, group); err != nil {
+			return nil, fmt.Errorf("failed to decode group %s: %v", id, err)
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// indexGroup adds the group to the indexes. Members that were merged into
+// another entity are replaced by it. This must be called with the lock
+// held.
+func (is *IdentityStore) indexGroup(group *Group) {
+	for i, entityID := range group.MemberEntityIDs {
+		if mergedID, ok := is.merged[entityID]; ok {
+			group.MemberEntityIDs[i] = mergedID
+		}
+	}
+	group.MemberEntityIDs = strutil.RemoveDuplicates(group.MemberEntityIDs)
+
+	is.groups[group.ID] = group
+	is.groupNames[group.Name] = group.ID
+	if group.Alias != nil {
+		is.groupAliases[aliasKey{group.Alias.MountPath, group.Alias.Name}] = group.ID
+		is.groupAliasIDs[group.Alias.ID] = group.ID
+	}
+	for _, entityID := range group.MemberEntityIDs {
+		if is.memberships[entityID] == nil {
+			is.memberships[entityID] = make(map[string]struct{})
+		}
+		is.memberships[entityID][group.ID] = struct{}{}
+	}
+}
+
+// unindexGroup removes the group from the indexes. This must be called with
+// the lock held.
+func (is *IdentityStore) unindexGroup(group *Group) {
+	delete(is.groups, group.ID)
+	delete(is.groupNames, group.Name)
+	if group.Alias != nil {
+		delete(is.groupAliases, aliasKey{group.Alias.MountPath, group.Alias.Name})
+		delete(is.groupAliasIDs, group.Alias.ID)
+	}
+	for _, entityID := range group.MemberEntityIDs {
+		delete(is.memberships[entityID], group.ID)
+		if len(is.memberships[entityID]) == 0 {
+			delete(is.memberships, entityID)
+		}
+	}
+}
+
+// replaceGroup persists the updated version of a group and indexes it in
+// place of the current one. This must be called with the lock held.
+func (is *IdentityStore) replaceGroup(current, updated *Group) error {
+	return is.replaceGroups([]*Group{current}, []*Group{updated})
+}
+
+// replaceGroups persists the updated versions of groups in a single
+// transaction, along with the given extra operations, and indexes them in
+// place of the current ones. This must be called with the lock held.
+func (is *IdentityStore) replaceGroups(current, updated []*Group, txns ...*TxnEntry) error {
+	now := time.Now().UTC()
+	for _, group := range updated {
+		group.LastUpdateTime = now
+		buf, err := json.Marshal(group)
+		if err != nil {
+			return fmt.Errorf("failed to encode group: %v", err)
+		}
+		txns = append(txns, &TxnEntry{
+			Operation: physical.PutOperation,
+			Entry: &Entry{
+				Key:   groupPrefix + group.ID,
+				Value: buf,
+			},
+		})
+	}
+	if err := is.view.Transaction(txns); err != nil {
+		return fmt.Errorf("failed to persist group: %v", err)
+	}
+
+	for i, group := range updated {
+		if current[i] != nil {
+			is.unindexGroup(current[i])
+		}
+		is.indexGroup(group)
+	}
+	return nil
+}
+
+// replaceGroupMember replaces the given entities with another one in the
+// groups they are members of, or removes them if newID is empty. The groups
+// are persisted in a single transaction along with the given extra
+// operations. This must be called with the lock held.
+func (is *IdentityStore) replaceGroupMember(oldIDs []string, newID string, txns ...*TxnEntry) error {
+	groupIDs := make(map[string]struct{})
+	for _, oldID := range oldIDs {
+		for groupID := range is.memberships[oldID] {
+			groupIDs[groupID] = struct{}{}
+		}
+	}
+
+	var current, updated []*Group
+	for groupID := range groupIDs {
+		group := is.groups[groupID].clone()
+		members := make([]string, 0, len(group.MemberEntityIDs))
+		for _, entityID := range group.MemberEntityIDs {
+			if !strutil.StrListContains(oldIDs, entityID) {
+				members = append(members, entityID)
+			}
+		}
+		if newID != "" {
+			members = append(members, newID)
+		}
+		group.MemberEntityIDs = members
+
+		current = append(current, is.groups[groupID])
+		updated = append(updated, group)
+	}
+	return is.replaceGroups(current, updated, txns...)
+}
+
+// resolveMembers returns the IDs of the entities with the given IDs, or of
+// those they were merged into, failing if one does not exist. This must be
+// called with the lock held.
+func (is *IdentityStore) resolveMembers(entityIDs []string) ([]string, error) {
+	members := make([]string, 0, len(entityIDs))
+	for _, entityID := range entityIDs {
+		entity := is.resolve(entityID)
+		if entity == nil {
+			return nil, fmt.Errorf("entity %s not found", entityID)
+		}
+		members = append(members, entity.ID)
+	}
+	return strutil.RemoveDuplicates(members), nil
+}
+
+// Group returns the group with the given ID, or nil
+func (is *IdentityStore) Group(id string) *Group {
+	is.lock.RLock()
+	defer is.lock.RUnlock()
+	if group, ok := is.groups[id]; ok {
+		return group.clone()
+	}
+	return nil
+}
+
+// GroupByName returns the group with the given name, or nil
+func (is *IdentityStore) GroupByName(name string) *Group {
+	is.lock.RLock()
+	defer is.lock.RUnlock()
+	if id, ok := is.groupNames[name]; ok {
+		return is.groups[id].clone()
+	}
+	return nil
+}
+
+// GroupIDs returns the IDs of all the groups, sorted
+func (is *IdentityStore) GroupIDs() []string {
+	is.lock.RLock()
+	defer is.lock.RUnlock()
+	ids := make([]string, 0, len(is.groups))
+	for id := range is.groups {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// EntityGroupIDs returns the IDs of the groups of an entity, sorted
+func (is *IdentityStore) EntityGroupIDs(entityID string) []string {
+	is.lock.RLock()
+	defer is.lock.RUnlock()
+	ids := make([]string, 0, len(is.memberships[entityID]))
+	for id := range is.memberships[entityID] {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// EntityGroupPolicies returns the policies of the groups of an entity
+func (is *IdentityStore) EntityGroupPolicies(entityID string) []string {
+	is.lock.RLock()
+	defer is.lock.RUnlock()
+	var policies []string
+	for id := range is.memberships[entityID] {
+		policies = append(policies, is.groups[id].Policies...)
+	}
+	return policies
+}
+
+// CreateGroup creates a group of the given type. A name is generated if
+// none is given. Only internal groups can be given members.
+func (is *IdentityStore) CreateGroup(name, typ string, policies []string, metadata map[string]string, members []string) (*Group, error) {
+	switch typ {
+	case "":
+		typ = GroupTypeInternal
+	case GroupTypeInternal, GroupTypeExternal:
+	default:
+		return nil, fmt.Errorf("invalid group type %q", typ)
+	}
+	if typ == GroupTypeExternal && len(members) > 0 {
+		return nil, fmt.Errorf("the members of external groups are set on login")
+	}
+	policies, err := validateIdentityPolicies(policies)
+	if err != nil {
+		return nil, err
+	}
+
+	is.lock.Lock()
+	defer is.lock.Unlock()
+
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate group ID: %v", err)
+	}
+	if name == "" {
+		name = "group_" + id[:8]
+	}
+	if _, ok := is.groupNames[name]; ok {
+		return nil, fmt.Errorf("a group named %q already exists", name)
+	}
+	if members, err = is.resolveMembers(members); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	group := &Group{
+		ID:              id,
+		Name:            name,
+		Type:            typ,
+		Policies:        policies,
+		Metadata:        metadata,
+		MemberEntityIDs: members,
+		CreationTime:    now,
+	}
+	if err := is.replaceGroup(nil, group); err != nil {
+		return nil, err
+	}
+	return group.clone(), nil
+}
+
+// UpdateGroup sets the name, policies, metadata and members of a group.
+// Empty names and nil policies, metadata or members are left unchanged.
+func (is *IdentityStore) UpdateGroup(id, name string, policies []string, metadata map[string]string, members []string) (*Group, error) {
+	if policies != nil {
+		var err error
+		if policies, err = validateIdentityPolicies(policies); err != nil {
+			return nil, err
+		}
+	}
+
+	is.lock.Lock()
+	defer is.lock.Unlock()
+
+	current, ok := is.groups[id]
+	if !ok {
+		return nil, fmt.Errorf("group not found")
+	}
+
+	updated := current.clone()
+	if name != "" && name != current.Name {
+		if _, ok := is.groupNames[name]; ok {
+			return nil, fmt.Errorf("a group named %q already exists", name)
+		}
+		updated.Name = name
+	}
+	if policies != nil {
+		updated.Policies = policies
+	}
+	if metadata != nil {
+		updated.Metadata = metadata
+	}
+	if members != nil {
+		if current.Type == GroupTypeExternal {
+			return nil, fmt.Errorf("the members of external groups are set on login")
+		}
+		var err error
+		if updated.MemberEntityIDs, err = is.resolveMembers(members); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := is.replaceGroup(current, updated); err != nil {
+		return nil, err
+	}
+	return updated.clone(), nil
+}
+
+// DeleteGroup removes a group along with its alias. Its members lose the
+// policies of the group.
+func (is *IdentityStore) DeleteGroup(id string) error {
+	is.lock.Lock()
+	defer is.lock.Unlock()
+
+	group, ok := is.groups[id]
+	if !ok {
+		return nil
+	}
+	if err := is.view.Delete(groupPrefix + id); err != nil {
+		return fmt.Errorf("failed to delete group: %v", err)
+	}
+	is.unindexGroup(group)
+	return nil
+}
+
+// GroupAlias returns the group alias with the given ID and the ID of its
+// group, or nil if there is none
+func (is *IdentityStore) GroupAlias(id string) (*GroupAlias, string) {
+	is.lock.RLock()
+	defer is.lock.RUnlock()
+	groupID, ok := is.groupAliasIDs[id]
+	if !ok {
+		return nil, ""
+	}
+	return is.groups[groupID].clone().Alias, groupID
+}
+
+// CreateGroupAlias maps an external group to the group with the given name
+// in an auth mount. A group has a single alias, which is replaced.
+func (is *IdentityStore) CreateGroupAlias(groupID, mountPath, mountType, name string) (*GroupAlias, error) {
+	if name == "" {
+		return nil, fmt.Errorf("missing alias name")
+	}
+
+	is.lock.Lock()
+	defer is.lock.Unlock()
+
+	current, ok := is.groups[groupID]
+	if !ok {
+		return nil, fmt.Errorf("group not found")
+	}
+	if current.Type != GroupTypeExternal {
+		return nil, fmt.Errorf("only external groups can have an alias")
+	}
+	if otherID, ok := is.groupAliases[aliasKey{mountPath, name}]; ok && otherID != groupID {
+		return nil, fmt.Errorf("group alias %q of mount %q is already tied to group %s", name, mountPath, otherID)
+	}
+
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate alias ID: %v", err)
+	}
+	updated := current.clone()
+	updated.Alias = &GroupAlias{
+		ID:           id,
+		MountPath:    mountPath,
+		MountType:    mountType,
+		Name:         name,
+		CreationTime: time.Now().UTC(),
+	}
+
+	// The members were reported by the previous alias
+	if current.Alias == nil || current.Alias.MountPath != mountPath || current.Alias.Name != name {
+		updated.MemberEntityIDs = []string{}
+	}
+
+	if err := is.replaceGroup(current, updated); err != nil {
+		return nil, err
+	}
+	return updated.clone().Alias, nil
+}
+
+// DeleteGroupAlias removes the alias of an external group, along with the
+// members it reported
+func (is *IdentityStore) DeleteGroupAlias(id string) error {
+	is.lock.Lock()
+	defer is.lock.Unlock()
+
+	groupID, ok := is.groupAliasIDs[id]
+	if !ok {
+		return nil
+	}
+	current := is.groups[groupID]
+
+	updated := current.clone()
+	updated.Alias = nil
+	updated.MemberEntityIDs = []string{}
+	return is.replaceGroup(current, updated)
+}
+
+// UpdateExternalGroups sets the external groups of an entity for an auth
+// mount to those mapped to the group names reported by the backend on
+// login. The entity is removed from the other external groups of the mount.
+func (is *IdentityStore) UpdateExternalGroups(entityID, mountPath string, groupNames []string) error {
+	is.lock.Lock()
+	defer is.lock.Unlock()
+
+	// Replacing groups changes the map, so the changes are collected first
+	var changed []*Group
+	for _, group := range is.groups {
+		if group.Alias == nil || group.Alias.MountPath != mountPath {
+			continue
+		}
+		reported := strutil.StrListContains(groupNames, group.Alias.Name)
+		if _, member := is.memberships[entityID][group.ID]; reported != member {
+			changed = append(changed, group)
+		}
+	}
+
+	updated := make([]*Group, 0, len(changed))
+	for _, current := range changed {
+		reported := strutil.StrListContains(groupNames, current.Alias.Name)
+		group := current.clone()
+		if reported {
+			group.MemberEntityIDs = append(group.MemberEntityIDs, entityID)
+		} else {
+			members := make([]string, 0, len(group.MemberEntityIDs))
+			for _, id := range group.MemberEntityIDs {
+				if id != entityID {
+					members = append(members, id)
+				}
+			}
+			group.MemberEntityIDs = members
+		}
+		updated = append(updated, group)
+	}
+	return is.replaceGroups(changed, updated)
+}
@@ -0,0 +1,237 @@
+package vault
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+// testCoreGroupLogin mounts a noop credential backend at auth/foo reporting
+// the alias "alice" and the given group aliases, which can be changed
+// through the returned backend
+func testCoreGroupLogin(t *testing.T, groups ...string) (*Core, *NoopBackend, []byte, string) {
+	var groupAliases []*logical.Alias
+	for _, group := range groups {
+		groupAliases = append(groupAliases, &logical.Alias{Name: group})
+	}
+	noop := &NoopBackend{
+		Login: []string{"login"},
+		Response: &logical.Response{
+			Auth: &logical.Auth{
+				Policies: []string{"foo"},
+				Alias: &logical.Alias{
+					Name: "alice",
+				},
+				GroupAliases: groupAliases,
+			},
+		},
+	}
+	c, key, root := TestCoreUnsealed(t)
+	c.credentialBackends["noop"] = func(*logical.BackendConfig) (logical.Backend, error) {
+		return noop, nil
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/auth/foo")
+	req.Data["type"] = "noop"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/policy/secrets")
+	req.ClientToken = root
+	req.Data["rules"] = `path "secret/*" { capabilities = ["read"] }`
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	return c, noop, key, root
+}
+
+// testCoreCreateGroup creates a group through the sys backend and returns
+// its ID
+func testCoreCreateGroup(t *testing.T, c *Core, root string, data map[string]interface{}) string {
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/identity/group")
+	req.ClientToken = root
+	req.Data = data
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	return resp.Data["id"].(string)
+}
+
+func testCoreReadSecret(t *testing.T, c *Core, token string) error {
+	req := logical.TestRequest(t, logical.ReadOperation, "secret/foo")
+	req.ClientToken = token
+	_, err := c.HandleRequest(req)
+	return err
+}
+
+func TestIdentityStore_InternalGroup(t *testing.T) {
+	c, _, key, root := testCoreGroupLogin(t)
+	auth := testCoreLogin(t, c, "auth/foo/login")
+	if err := testCoreReadSecret(t, c, auth.ClientToken); err == nil {
+		t.Fatal("expected permission denied")
+	}
+
+	groupID := testCoreCreateGroup(t, c, root, map[string]interface{}{
+		"name":              "ops",
+		"policies":          "secrets",
+		"member_entity_ids": auth.EntityID,
+	})
+	if err := testCoreReadSecret(t, c, auth.ClientToken); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req := logical.TestRequest(t, logical.ReadOperation, "sys/identity/entity/id/"+auth.EntityID)
+	req.ClientToken = root
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(resp.Data["group_ids"], []string{groupID}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Members must exist, and internal groups cannot have an alias
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/identity/group/id/"+groupID)
+	req.ClientToken = root
+	req.Data["member_entity_ids"] = "nonexistent"
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatal("expected error")
+	}
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/identity/group-alias")
+	req.ClientToken = root
+	req.Data["group_id"] = groupID
+	req.Data["mount_path"] = "foo"
+	req.Data["name"] = "ops"
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// The group survives a restart
+	if err := c.Seal(root); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if unseal, err := TestCoreUnseal(c, key); err != nil || !unseal {
+		t.Fatalf("err: %v", err)
+	}
+	group := c.identityStore.GroupByName("ops")
+	if group == nil || group.ID != groupID || !reflect.DeepEqual(group.MemberEntityIDs, []string{auth.EntityID}) {
+		t.Fatalf("bad: %#v", group)
+	}
+	if err := testCoreReadSecret(t, c, auth.ClientToken); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Removing the members revokes the policies of the group
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/identity/group/id/"+groupID)
+	req.ClientToken = root
+	req.Data["member_entity_ids"] = ""
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := testCoreReadSecret(t, c, auth.ClientToken); err == nil {
+		t.Fatal("expected permission denied")
+	}
+}
+
+func TestIdentityStore_ExternalGroup(t *testing.T) {
+	c, noop, _, root := testCoreGroupLogin(t, "admins", "devs")
+
+	groupID := testCoreCreateGroup(t, c, root, map[string]interface{}{
+		"name":     "admins",
+		"type":     "external",
+		"policies": "secrets",
+	})
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/identity/group-alias")
+	req.ClientToken = root
+	req.Data["group_id"] = groupID
+	req.Data["mount_path"] = "foo"
+	req.Data["name"] = "admins"
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	aliasID := resp.Data["id"].(string)
+
+	// The members of external groups are set on login
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/identity/group/id/"+groupID)
+	req.ClientToken = root
+	req.Data["member_entity_ids"] = "foo"
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatal("expected error")
+	}
+
+	auth := testCoreLogin(t, c, "auth/foo/login")
+	if err := testCoreReadSecret(t, c, auth.ClientToken); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	group := c.identityStore.Group(groupID)
+	if !reflect.DeepEqual(group.MemberEntityIDs, []string{auth.EntityID}) {
+		t.Fatalf("bad: %#v", group)
+	}
+
+	// The entity leaves the group once the backend stops reporting it
+	noop.Response.Auth.GroupAliases = nil
+	testCoreLogin(t, c, "auth/foo/login")
+	if err := testCoreReadSecret(t, c, auth.ClientToken); err == nil {
+		t.Fatal("expected permission denied")
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/identity/group-alias/id/"+aliasID)
+	req.ClientToken = root
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["group_id"] != groupID || resp.Data["mount_path"] != "auth/foo/" || resp.Data["mount_type"] != "noop" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
+
+func TestIdentityStore_GroupMerge(t *testing.T) {
+	c, _, _, root := testCoreGroupLogin(t)
+	auth := testCoreLogin(t, c, "auth/foo/login")
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/identity/entity")
+	req.ClientToken = root
+	req.Data["name"] = "bob"
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	bobID := resp.Data["id"].(string)
+
+	groupID := testCoreCreateGroup(t, c, root, map[string]interface{}{
+		"policies":          "secrets",
+		"member_entity_ids": bobID,
+	})
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/identity/entity/merge")
+	req.ClientToken = root
+	req.Data["from_entity_ids"] = bobID
+	req.Data["to_entity_id"] = auth.EntityID
+	if resp, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+
+	group := c.identityStore.Group(groupID)
+	if !reflect.DeepEqual(group.MemberEntityIDs, []string{auth.EntityID}) {
+		t.Fatalf("bad: %#v", group)
+	}
+	if err := testCoreReadSecret(t, c, auth.ClientToken); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Deleting the entity removes it from its groups
+	req = logical.TestRequest(t, logical.DeleteOperation, "sys/identity/entity/id/"+auth.EntityID)
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if group := c.identityStore.Group(groupID); len(group.MemberEntityIDs) != 0 {
+		t.Fatalf("bad: %#v", group)
+	}
+}
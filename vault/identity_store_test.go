@@ -0,0 +1,215 @@
+package vault
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+// testCoreIdentityLogin mounts a noop credential backend reporting the
+// given alias at both auth/foo and auth/bar
+func testCoreIdentityLogin(t *testing.T) (*Core, []byte, string) {
+	noop := &NoopBackend{
+		Login: []string{"login"},
+		Response: &logical.Response{
+			Auth: &logical.Auth{
+				Policies: []string{"foo"},
+				Alias: &logical.Alias{
+					Name: "alice",
+				},
+			},
+		},
+	}
+	c, key, root := TestCoreUnsealed(t)
+	c.credentialBackends["noop"] = func(*logical.BackendConfig) (logical.Backend, error) {
+		return noop, nil
+	}
+
+	for _, path := range []string{"foo", "bar"} {
+		req := logical.TestRequest(t, logical.UpdateOperation, "sys/auth/"+path)
+		req.Data["type"] = "noop"
+		req.ClientToken = root
+		if _, err := c.HandleRequest(req); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	return c, key, root
+}
+
+func testCoreLogin(t *testing.T, c *Core, path string) *logical.Auth {
+	resp, err := c.HandleRequest(&logical.Request{
+		Operation: logical.UpdateOperation,
+		Path:      path,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	// The noop backend returns the same auth on every login
+	auth := *resp.Auth
+	return &auth
+}
+
+func TestIdentityStore_Login(t *testing.T) {
+	c, _, root := testCoreIdentityLogin(t)
+
+	auth := testCoreLogin(t, c, "auth/foo/login")
+	if auth.EntityID == "" {
+		t.Fatalf("bad: %#v", auth)
+	}
+	if again := testCoreLogin(t, c, "auth/foo/login"); again.EntityID != auth.EntityID {
+		t.Fatalf("expected entity %s, got %s", auth.EntityID, again.EntityID)
+	}
+
+	entity := c.identityStore.Entity(auth.EntityID)
+	if entity == nil || len(entity.Aliases) != 1 {
+		t.Fatalf("bad: %#v", entity)
+	}
+	alias := entity.Aliases[0]
+	if alias.MountPath != "auth/foo/" || alias.MountType != "noop" || alias.Name != "alice" {
+		t.Fatalf("bad: %#v", alias)
+	}
+
+	// Tying the alias of the other mount to the entity makes its logins
+	// tracked as the same identity
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/identity/entity-alias")
+	req.ClientToken = root
+	req.Data["entity_id"] = auth.EntityID
+	req.Data["mount_path"] = "bar"
+	req.Data["name"] = "alice"
+	if resp, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	if other := testCoreLogin(t, c, "auth/bar/login"); other.EntityID != auth.EntityID {
+		t.Fatalf("expected entity %s, got %s", auth.EntityID, other.EntityID)
+	}
+
+	// Child tokens are tied to the same entity
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/policy/foo")
+	req.ClientToken = root
+	req.Data["rules"] = `path "auth/token/create" { capabilities = ["update"] }`
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req = logical.TestRequest(t, logical.UpdateOperation, "auth/token/create")
+	req.ClientToken = auth.ClientToken
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	req = logical.TestRequest(t, logical.ReadOperation, "auth/token/lookup-self")
+	req.ClientToken = resp.Auth.ClientToken
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["entity_id"] != auth.EntityID {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
+
+func TestIdentityStore_EntityPolicies(t *testing.T) {
+	c, _, root := testCoreIdentityLogin(t)
+	auth := testCoreLogin(t, c, "auth/foo/login")
+
+	readSecret := func() error {
+		req := logical.TestRequest(t, logical.ReadOperation, "secret/foo")
+		req.ClientToken = auth.ClientToken
+		_, err := c.HandleRequest(req)
+		return err
+	}
+	if err := readSecret(); err == nil {
+		t.Fatal("expected permission denied")
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/policy/secrets")
+	req.ClientToken = root
+	req.Data["rules"] = `path "secret/*" { capabilities = ["read"] }`
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/identity/entity/id/"+auth.EntityID)
+	req.ClientToken = root
+	req.Data["policies"] = "secrets"
+	req.Data["metadata"] = map[string]interface{}{"team": "ops"}
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := readSecret(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Entities cannot be granted root
+	req.Data["policies"] = "root"
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestIdentityStore_Merge(t *testing.T) {
+	c, key, root := testCoreIdentityLogin(t)
+
+	foo := testCoreLogin(t, c, "auth/foo/login")
+	bar := testCoreLogin(t, c, "auth/bar/login")
+	if foo.EntityID == bar.EntityID {
+		t.Fatalf("expected distinct entities, got %s", foo.EntityID)
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/identity/entity/id/"+bar.EntityID)
+	req.ClientToken = root
+	req.Data["policies"] = "bar"
+	req.Data["metadata"] = map[string]interface{}{"team": "ops"}
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/identity/entity/merge")
+	req.ClientToken = root
+	req.Data["from_entity_ids"] = bar.EntityID
+	req.Data["to_entity_id"] = foo.EntityID
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	if len(resp.Data["aliases"].([]map[string]interface{})) != 2 ||
+		!reflect.DeepEqual(resp.Data["policies"], []string{"bar"}) ||
+		!reflect.DeepEqual(resp.Data["merged_entity_ids"], []string{bar.EntityID}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// The merge survives a restart, and the token of the merged entity is
+	// tied to the resulting one
+	if err := c.Seal(root); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if unseal, err := TestCoreUnseal(c, key); err != nil || !unseal {
+		t.Fatalf("err: %v", err)
+	}
+
+	if ids := c.identityStore.EntityIDs(); !reflect.DeepEqual(ids, []string{foo.EntityID}) {
+		t.Fatalf("bad: %#v", ids)
+	}
+	if other := testCoreLogin(t, c, "auth/bar/login"); other.EntityID != foo.EntityID {
+		t.Fatalf("expected entity %s, got %s", foo.EntityID, other.EntityID)
+	}
+
+	te, err := c.tokenStore.Lookup(bar.ClientToken)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	policies := c.tokenPolicies(te)
+	if te.EntityID != foo.EntityID || !reflect.DeepEqual(policies, []string{"default", "foo", "bar"}) {
+		t.Fatalf("bad: %#v %#v", te, policies)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/identity/entity/id/"+bar.EntityID)
+	req.ClientToken = root
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["id"] != foo.EntityID || !reflect.DeepEqual(resp.Data["metadata"], map[string]string{"team": "ops"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
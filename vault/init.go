@@ -115,6 +115,14 @@ func (c *Core) Initialize(barrierConfig, recoveryConfig *SealConfig) (*InitResul
 		return nil, ErrAlreadyInit
 	}
 
+	// A raft node starts a new cluster, unless it has joined one
+	if c.raft != nil {
+		if err := c.raft.Bootstrap(); err != nil {
+			c.logger.Printf("[ERR] core: failed to bootstrap raft: %v", err)
+			return nil, fmt.Errorf("error bootstrapping raft: %v", err)
+		}
+	}
+
 	err = c.seal.Init()
 	if err != nil {
 		c.logger.Printf("[ERR] core: failed to initialize seal: %v", err)
@@ -152,7 +160,7 @@ func (c *Core) Initialize(barrierConfig, recoveryConfig *SealConfig) (*InitResul
 	}
 
 	// Initialize the barrier
-	if err := c.barrier.Initialize(barrierKey); err != nil {
+	if err := c.barrier.Initialize(barrierKey, barrierConfig.BarrierCipher); err != nil {
 		c.logger.Printf("[ERR] core: failed to initialize barrier: %v", err)
 		return nil, fmt.Errorf("failed to initialize barrier: %v", err)
 	}
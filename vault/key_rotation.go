@@ -0,0 +1,308 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/helper/jsonutil"
+)
+
+const (
+	// coreKeyRotationConfigPath is used to store the automatic key
+	// rotation policy
+	coreKeyRotationConfigPath = "core/rotation-config"
+
+	// coreKeyUsagePath is used to store the number of values encrypted with
+	// each key term
+	coreKeyUsagePath = "core/key-usage"
+
+	// minKeyRotationInterval is the shortest interval that can be
+	// configured
+	minKeyRotationInterval = time.Hour
+
+	// barrierKeyEncryptionLimit is the number of values after which a key
+	// is rotated even if automatic rotation is disabled. Both ciphers use
+	// random 96-bit nonces, for which NIST SP 800-38D allows 2^32
+	// encryptions per key; the margin covers the values encrypted between
+	// two checks.
+	barrierKeyEncryptionLimit = 1<<32 - 1<<28
+)
+
+var (
+	// keyRotationCheckInterval is how often the active node records the key
+	// usage and checks whether the key must be rotated. It's a var for
+	// testing.
+	keyRotationCheckInterval = time.Minute
+
+	// errLoadKeyRotationFailed if loading the key rotation policy or the
+	// key usage encounters an error
+	errLoadKeyRotationFailed = errors.New("failed to load key rotation configuration")
+)
+
+// KeyRotationConfig is the policy for rotating the encryption key of the
+// barrier automatically. The key is rotated once it encrypted
+// MaxOperations values or is older than Interval, whichever comes first;
+// a zero value disables that limit.
+type KeyRotationConfig struct {
+	Enabled       bool          `json:"enabled"`
+	MaxOperations uint64        `json:"max_operations"`
+	Interval      time.Duration `json:"interval"`
+}
+
+// validate checks that the configuration can be used
+func (c *KeyRotationConfig) validate() error {
+	if !c.Enabled {
+		return nil
+	}
+	if c.MaxOperations == 0 && c.Interval == 0 {
+		return fmt.Errorf("max_operations or interval must be set")
+	}
+	if c.Interval != 0 && c.Interval < minKeyRotationInterval {
+		return fmt.Errorf("interval must be at least %s", minKeyRotationInterval)
+	}
+	return nil
+}
+
+// KeyRotationConfig returns the automatic key rotation policy
+func (c *Core) KeyRotationConfig() *KeyRotationConfig {
+	c.rotationLock.Lock()
+	defer c.rotationLock.Unlock()
+	return c.rotationConfig
+}
+
+// setKeyRotationConfig persists the given policy and starts using it
+func (c *Core) setKeyRotationConfig(config *KeyRotationConfig) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+
+	buf, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to encode key rotation configuration: %v", err)
+	}
+
+	c.rotationLock.Lock()
+	defer c.rotationLock.Unlock()
+
+	if err := c.barrier.Put(&Entry{
+		Key:   coreKeyRotationConfigPath,
+		Value: buf,
+	}); err != nil {
+		c.logger.Printf("[ERR] core: failed to persist key rotation configuration: %v", err)
+		return err
+	}
+	c.rotationConfig = config
+	return nil
+}
+
+// KeyUsage returns the number of values encrypted with each key term,
+// including those not yet recorded
+func (c *Core) KeyUsage() map[uint32]uint64 {
+	c.rotationLock.Lock()
+	defer c.rotationLock.Unlock()
+	c.updateKeyUsage()
+
+	usage := make(map[uint32]uint64, len(c.keyUsage))
+	for term, count := range c.keyUsage {
+		usage[term] = count
+	}
+	return usage
+}
+
+// setupKeyRotation loads the key rotation policy and the key usage, and
+// starts checking whether the key must be rotated. Automatic rotation is
+// disabled if it has never been configured.
+func (c *Core) setupKeyRotation() error {
+	config := &KeyRotationConfig{}
+	raw, err := c.barrier.Get(coreKeyRotationConfigPath)
+	if err != nil {
+		c.logger.Printf("[ERR] core: failed to read key rotation configuration: %v", err)
+		return errLoadKeyRotationFailed
+	}
+	if raw != nil {
+		if err := jsonutil.DecodeJSON(raw.Value, config); err != nil {
+			c.logger.Printf("[ERR] core: failed to decode key rotation configuration: %v", err)
+			return errLoadKeyRotationFailed
+		}
+	}
+
+	usage := make(map[uint32]uint64)
+	raw, err = c.barrier.Get(coreKeyUsagePath)
+	if err != nil {
+		c.logger.Printf("[ERR] core: failed to read key usage: %v", err)
+		return errLoadKeyRotationFailed
+	}
+	if raw != nil {
+		if err := jsonutil.DecodeJSON(raw.Value, &usage); err != nil {
+			c.logger.Printf("[ERR] core: failed to decode key usage: %v", err)
+			return errLoadKeyRotationFailed
+		}
+	}
+
+	c.rotationLock.Lock()
+	c.rotationConfig = config
+	c.keyUsage = usage
+	c.keyUsageStoredTotal = c.keyUsageTotal()
+	c.rotationLock.Unlock()
+
+	c.rotationCh = make(chan struct{})
+	go c.runKeyRotation(c.rotationCh)
+	return nil
+}
+
+// stopKeyRotation stops the automatic key rotation and records the key
+// usage while the barrier is still unsealed
+func (c *Core) stopKeyRotation() error {
+	if c.rotationCh == nil {
+		return nil
+	}
+	close(c.rotationCh)
+	c.rotationCh = nil
+
+	c.rotationLock.Lock()
+	defer c.rotationLock.Unlock()
+	c.updateKeyUsage()
+	return c.persistKeyUsage()
+}
+
+// runKeyRotation periodically records the key usage and rotates the key
+// when the policy requires it, until stopCh is closed
+func (c *Core) runKeyRotation(stopCh chan struct{}) {
+	for {
+		select {
+		case <-time.After(keyRotationCheckInterval):
+			// Sealing may have started while waiting
+			select {
+			case <-stopCh:
+				return
+			default:
+			}
+			if err := c.checkKeyRotation(time.Now()); err != nil {
+				c.logger.Printf("[ERR] core: automatic key rotation failed: %v", err)
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// checkKeyRotation records the key usage, emits it as metrics and rotates
+// the key if the policy requires it at the given time, or if the key is
+// about to reach the encryption limit
+func (c *Core) checkKeyRotation(now time.Time) error {
+	c.rotationLock.Lock()
+	defer c.rotationLock.Unlock()
+
+	c.updateKeyUsage()
+	if c.keyUsageTotal() > c.keyUsageStoredTotal {
+		if err := c.persistKeyUsage(); err != nil {
+			return err
+		}
+	}
+	for term, count := range c.keyUsage {
+		metrics.SetGauge([]string{"barrier", "encryptions", strconv.FormatUint(uint64(term), 10)}, float32(count))
+	}
+
+	info, err := c.barrier.ActiveKeyInfo()
+	if err != nil {
+		return err
+	}
+	term := uint32(info.Term)
+
+	config := c.rotationConfig
+	enabled := config != nil && config.Enabled
+
+	var reason string
+	switch {
+	case c.keyUsage[term] >= barrierKeyEncryptionLimit:
+		c.logger.Printf("[WARN] core: encryption key of term %d reached the limit of %d values, forcing rotation",
+			term, uint64(barrierKeyEncryptionLimit))
+		reason = fmt.Sprintf("encrypted %d values", c.keyUsage[term])
+	case !enabled:
+		return nil
+	case config.MaxOperations != 0 && c.keyUsage[term] >= config.MaxOperations:
+		reason = fmt.Sprintf("encrypted %d values", c.keyUsage[term])
+	case config.Interval != 0 && !info.InstallTime.IsZero() && now.Sub(info.InstallTime) >= config.Interval:
+		reason = fmt.Sprintf("installed at %s", info.InstallTime.Format(time.RFC3339))
+	default:
+		return nil
+	}
+
+	c.logger.Printf("[INFO] core: rotating encryption key of term %d, which %s", term, reason)
+	if _, err := c.rotateBarrierKey(); err != nil {
+		return err
+	}
+	metrics.IncrCounter([]string{"barrier", "auto_rotate"}, 1)
+	return nil
+}
+
+// updateKeyUsage adds the values encrypted since the last update to the
+// key usage. The rotation lock must be held.
+func (c *Core) updateKeyUsage() {
+	counts := c.barrier.TakeEncryptionCounts()
+	if c.keyUsage == nil {
+		c.keyUsage = make(map[uint32]uint64)
+	}
+	for term, count := range counts {
+		c.keyUsage[term] += count
+	}
+}
+
+// keyUsageTotal returns the number of values encrypted with any key. The
+// rotation lock must be held.
+func (c *Core) keyUsageTotal() uint64 {
+	var total uint64
+	for _, count := range c.keyUsage {
+		total += count
+	}
+	return total
+}
+
+// persistKeyUsage stores the key usage. Storing it is an encryption
+// itself, which is counted so that it does not cause another store on the
+// next check. The rotation lock must be held.
+func (c *Core) persistKeyUsage() error {
+	buf, err := json.Marshal(c.keyUsage)
+	if err != nil {
+		return fmt.Errorf("failed to encode key usage: %v", err)
+	}
+	if err := c.barrier.Put(&Entry{
+		Key:   coreKeyUsagePath,
+		Value: buf,
+	}); err != nil {
+		return fmt.Errorf("failed to persist key usage: %v", err)
+	}
+	c.keyUsageStoredTotal = c.keyUsageTotal() + 1
+	return nil
+}
+
+// rotateBarrierKey installs a new encryption key and, in HA mode, creates
+// the upgrade path that lets standbys install it too
+func (c *Core) rotateBarrierKey() (uint32, error) {
+	newTerm, err := c.barrier.Rotate()
+	if err != nil {
+		c.logger.Printf("[ERR] core: failed to create new encryption key: %v", err)
+		return 0, err
+	}
+	c.logger.Printf("[INFO] core: installed new encryption key")
+
+	// In HA mode, we need to an upgrade path for the standby instances
+	if c.ha != nil {
+		// Create the upgrade path to the new term
+		if err := c.barrier.CreateUpgrade(newTerm); err != nil {
+			c.logger.Printf("[ERR] core: failed to create new upgrade for key term %d: %v", newTerm, err)
+		}
+
+		// Schedule the destroy of the upgrade path
+		time.AfterFunc(keyRotateGracePeriod, func() {
+			if err := c.barrier.DestroyUpgrade(newTerm); err != nil {
+				c.logger.Printf("[ERR] core: failed to destroy upgrade for key term %d: %v", newTerm, err)
+			}
+		})
+	}
+	return newTerm, nil
+}
@@ -0,0 +1,175 @@
+package vault
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestKeyRotationConfig_validate(t *testing.T) {
+	valid := []*KeyRotationConfig{
+		{},
+		{Enabled: false, Interval: time.Minute},
+		{Enabled: true, MaxOperations: 1},
+		{Enabled: true, Interval: time.Hour},
+	}
+	for _, config := range valid {
+		if err := config.validate(); err != nil {
+			t.Fatalf("err: %v: %#v", err, config)
+		}
+	}
+
+	invalid := []*KeyRotationConfig{
+		{Enabled: true},
+		{Enabled: true, MaxOperations: 1, Interval: time.Minute},
+	}
+	for _, config := range invalid {
+		if err := config.validate(); err == nil {
+			t.Fatalf("expected error: %#v", config)
+		}
+	}
+}
+
+func testKeyTerm(t *testing.T, c *Core) int {
+	info, err := c.barrier.ActiveKeyInfo()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	return info.Term
+}
+
+func TestCore_KeyRotation_maxOperations(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+	err := c.setKeyRotationConfig(&KeyRotationConfig{
+		Enabled:       true,
+		MaxOperations: 100,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if err := c.checkKeyRotation(time.Now()); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if term := testKeyTerm(t, c); term != 1 {
+		t.Fatalf("bad: %d", term)
+	}
+
+	for i := 0; i < 100; i++ {
+		if err := c.barrier.Put(&Entry{Key: fmt.Sprintf("test/%d", i), Value: []byte("test")}); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	if err := c.checkKeyRotation(time.Now()); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if term := testKeyTerm(t, c); term != 2 {
+		t.Fatalf("bad: %d", term)
+	}
+
+	// The new key starts unused
+	usage := c.KeyUsage()
+	if usage[1] < 100 || usage[2] != 0 {
+		t.Fatalf("bad: %v", usage)
+	}
+}
+
+func TestCore_KeyRotation_interval(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+	err := c.setKeyRotationConfig(&KeyRotationConfig{
+		Enabled:  true,
+		Interval: 24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if err := c.checkKeyRotation(time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if term := testKeyTerm(t, c); term != 1 {
+		t.Fatalf("bad: %d", term)
+	}
+
+	if err := c.checkKeyRotation(time.Now().Add(25 * time.Hour)); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if term := testKeyTerm(t, c); term != 2 {
+		t.Fatalf("bad: %d", term)
+	}
+
+	// Disabled policies are ignored
+	err = c.setKeyRotationConfig(&KeyRotationConfig{
+		Interval: 24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := c.checkKeyRotation(time.Now().Add(50 * time.Hour)); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if term := testKeyTerm(t, c); term != 2 {
+		t.Fatalf("bad: %d", term)
+	}
+}
+
+func TestCore_KeyRotation_encryptionLimit(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+
+	// The key is rotated at the limit even without a policy
+	c.rotationLock.Lock()
+	c.keyUsage[1] = barrierKeyEncryptionLimit - 1000
+	c.rotationLock.Unlock()
+	if err := c.checkKeyRotation(time.Now()); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if term := testKeyTerm(t, c); term != 1 {
+		t.Fatalf("bad: %d", term)
+	}
+
+	c.rotationLock.Lock()
+	c.keyUsage[1] = barrierKeyEncryptionLimit
+	c.rotationLock.Unlock()
+	if err := c.checkKeyRotation(time.Now()); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if term := testKeyTerm(t, c); term != 2 {
+		t.Fatalf("bad: %d", term)
+	}
+}
+
+func TestCore_KeyUsage(t *testing.T) {
+	c, key, root := TestCoreUnsealed(t)
+
+	if err := c.barrier.Put(&Entry{Key: "test", Value: []byte("test")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := c.checkKeyRotation(time.Now()); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	// The usage includes storing it, which does not cause another store
+	stored := c.KeyUsage()[1]
+	for i := 0; i < 3; i++ {
+		if err := c.checkKeyRotation(time.Now()); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	if usage := c.KeyUsage()[1]; usage != stored {
+		t.Fatalf("bad: %d, stored %d", usage, stored)
+	}
+
+	// The usage survives sealing
+	if err := c.barrier.Put(&Entry{Key: "test", Value: []byte("test")}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	before := c.KeyUsage()[1]
+	if err := c.Seal(root); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := TestCoreUnseal(c, TestKeyCopy(key)); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if usage := c.KeyUsage()[1]; usage <= before {
+		t.Fatalf("bad: %d, before sealing %d", usage, before)
+	}
+}
@@ -35,6 +35,10 @@ type Key struct {
 	Version     int
 	Value       []byte
 	InstallTime time.Time
+
+	// Cipher is the cipher the key is used with. Keys created before
+	// ciphers could be chosen have none and use AES-GCM.
+	Cipher string `json:",omitempty"`
 }
 
 // Serialize is used to create a byte encoded key
@@ -1,14 +1,25 @@
 package vault
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/helper/compressutil"
 	"github.com/hashicorp/vault/helper/duration"
+	"github.com/hashicorp/vault/helper/logutil"
+	"github.com/hashicorp/vault/helper/metricsutil"
+	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
 	"github.com/mitchellh/mapstructure"
@@ -23,8 +34,20 @@ var (
 )
 
 func NewSystemBackend(core *Core, config *logical.BackendConfig) logical.Backend {
+	return newSystemBackend(core, nil, config)
+}
+
+// NewNamespaceSystemBackend returns the system backend of a namespace. It
+// only has the endpoints acting on the namespace, such as its mounts and
+// policies.
+func NewNamespaceSystemBackend(core *Core, ns *Namespace, config *logical.BackendConfig) logical.Backend {
+	return newSystemBackend(core, ns, config)
+}
+
+func newSystemBackend(core *Core, ns *Namespace, config *logical.BackendConfig) logical.Backend {
 	b := &SystemBackend{
-		Core: core,
+		Core:      core,
+		namespace: ns,
 	}
 
 	b.Backend = &framework.Backend{
@@ -35,10 +58,41 @@ func NewSystemBackend(core *Core, config *logical.BackendConfig) logical.Backend
 				"auth/*",
 				"remount",
 				"revoke-prefix/*",
+				"leases/tidy",
+				"tokens/*",
+				"identity/*",
 				"audit",
 				"audit/*",
+				"audit-rotate-salt/*",
+				"raw",
 				"raw/*",
+				"raw-prefix",
+				"raw-prefix/*",
 				"rotate",
+				"rotate/config",
+				"config/cors",
+				"quotas/*",
+				"storage/snapshots/*",
+				"policies/egp",
+				"policies/egp/*",
+				"mfa/method",
+				"mfa/method/*",
+				"mfa/enforcement",
+				"mfa/enforcement/*",
+				"namespaces",
+				"namespaces/*",
+				"replication/dr/primary/enable",
+				"replication/dr/primary/disable",
+				"replication/dr/primary/secondary-token",
+				"replication/dr/primary/revoke-secondary",
+				"replication/dr/secondary/enable",
+				"storage/raft/*",
+				"loggers",
+				"loggers/*",
+			},
+
+			Unauthenticated: []string{
+				"replication/dr/primary/fetch",
 			},
 		},
 
@@ -164,6 +218,22 @@ func NewSystemBackend(core *Core, config *logical.BackendConfig) logical.Backend
 						Type:        framework.TypeString,
 						Description: strings.TrimSpace(sysHelp["tune_max_lease_ttl"][0]),
 					},
+					"max_request_size": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: strings.TrimSpace(sysHelp["tune_max_request_size"][0]),
+					},
+					"audit_non_hmac_request_keys": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["tune_audit_non_hmac_request_keys"][0]),
+					},
+					"audit_non_hmac_response_keys": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["tune_audit_non_hmac_response_keys"][0]),
+					},
+					"audit_elide_response_keys": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["tune_audit_elide_response_keys"][0]),
+					},
 				},
 				Callbacks: map[logical.Operation]framework.OperationFunc{
 					logical.ReadOperation:   b.handleAuthTuneRead,
@@ -189,6 +259,22 @@ func NewSystemBackend(core *Core, config *logical.BackendConfig) logical.Backend
 						Type:        framework.TypeString,
 						Description: strings.TrimSpace(sysHelp["tune_max_lease_ttl"][0]),
 					},
+					"max_request_size": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: strings.TrimSpace(sysHelp["tune_max_request_size"][0]),
+					},
+					"audit_non_hmac_request_keys": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["tune_audit_non_hmac_request_keys"][0]),
+					},
+					"audit_non_hmac_response_keys": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["tune_audit_non_hmac_response_keys"][0]),
+					},
+					"audit_elide_response_keys": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["tune_audit_elide_response_keys"][0]),
+					},
 				},
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -327,1455 +413,6492 @@ func NewSystemBackend(core *Core, config *logical.BackendConfig) logical.Backend
 			},
 
 			&framework.Path{
-				Pattern: "revoke-prefix/(?P<prefix>.+)",
+				Pattern: "leases/tidy$",
 
 				Fields: map[string]*framework.FieldSchema{
-					"prefix": &framework.FieldSchema{
-						Type:        framework.TypeString,
-						Description: strings.TrimSpace(sysHelp["revoke-prefix-path"][0]),
+					"dry_run": &framework.FieldSchema{
+						Type:        framework.TypeBool,
+						Description: strings.TrimSpace(sysHelp["leases_tidy_dry_run"][0]),
 					},
 				},
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
-					logical.UpdateOperation: b.handleRevokePrefix,
+					logical.UpdateOperation: b.handleLeasesTidy,
 				},
 
-				HelpSynopsis:    strings.TrimSpace(sysHelp["revoke-prefix"][0]),
-				HelpDescription: strings.TrimSpace(sysHelp["revoke-prefix"][1]),
+				HelpSynopsis:    strings.TrimSpace(sysHelp["leases/tidy"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["leases/tidy"][1]),
 			},
 
 			&framework.Path{
-				Pattern: "auth$",
+				Pattern: "leases/count$",
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
-					logical.ReadOperation: b.handleAuthTable,
+					logical.ReadOperation: b.handleLeasesCount,
 				},
 
-				HelpSynopsis:    strings.TrimSpace(sysHelp["auth-table"][0]),
-				HelpDescription: strings.TrimSpace(sysHelp["auth-table"][1]),
+				HelpSynopsis:    strings.TrimSpace(sysHelp["leases/count"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["leases/count"][1]),
 			},
 
 			&framework.Path{
-				Pattern: "auth/(?P<path>.+)",
+				Pattern: "leases/irrevocable$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleLeasesIrrevocable,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["leases/irrevocable"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["leases/irrevocable"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "tokens/accessors$",
+
+				Fields: tokenFilterFields(),
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleTokensAccessors,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["tokens/accessors"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["tokens/accessors"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "tokens/revoke$",
+
+				Fields: tokenRevokeFields(),
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleTokensRevoke,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["tokens/revoke"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["tokens/revoke"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "identity/entity$",
 
 				Fields: map[string]*framework.FieldSchema{
-					"path": &framework.FieldSchema{
+					"name": &framework.FieldSchema{
 						Type:        framework.TypeString,
-						Description: strings.TrimSpace(sysHelp["auth_path"][0]),
+						Description: strings.TrimSpace(sysHelp["entity_name"][0]),
 					},
-					"type": &framework.FieldSchema{
+					"policies": &framework.FieldSchema{
 						Type:        framework.TypeString,
-						Description: strings.TrimSpace(sysHelp["auth_type"][0]),
+						Description: strings.TrimSpace(sysHelp["entity_policies"][0]),
 					},
-					"description": &framework.FieldSchema{
-						Type:        framework.TypeString,
-						Description: strings.TrimSpace(sysHelp["auth_desc"][0]),
+					"metadata": &framework.FieldSchema{
+						Type:        framework.TypeMap,
+						Description: strings.TrimSpace(sysHelp["entity_metadata"][0]),
 					},
 				},
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
-					logical.UpdateOperation: b.handleEnableAuth,
-					logical.DeleteOperation: b.handleDisableAuth,
+					logical.UpdateOperation: b.handleEntityCreate,
 				},
 
-				HelpSynopsis:    strings.TrimSpace(sysHelp["auth"][0]),
-				HelpDescription: strings.TrimSpace(sysHelp["auth"][1]),
+				HelpSynopsis:    strings.TrimSpace(sysHelp["identity/entity"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["identity/entity"][1]),
 			},
 
 			&framework.Path{
-				Pattern: "policy$",
+				Pattern: "identity/entity/id/?$",
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
-					logical.ReadOperation: b.handlePolicyList,
-					logical.ListOperation: b.handlePolicyList,
+					logical.ListOperation: b.handleEntityList,
 				},
 
-				HelpSynopsis:    strings.TrimSpace(sysHelp["policy-list"][0]),
-				HelpDescription: strings.TrimSpace(sysHelp["policy-list"][1]),
+				HelpSynopsis:    strings.TrimSpace(sysHelp["identity/entity/id"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["identity/entity/id"][1]),
 			},
 
 			&framework.Path{
-				Pattern: "policy/(?P<name>.+)",
+				Pattern: "identity/entity/id/" + framework.GenericNameRegex("id"),
 
 				Fields: map[string]*framework.FieldSchema{
+					"id": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["entity_id"][0]),
+					},
 					"name": &framework.FieldSchema{
 						Type:        framework.TypeString,
-						Description: strings.TrimSpace(sysHelp["policy-name"][0]),
+						Description: strings.TrimSpace(sysHelp["entity_name"][0]),
 					},
-					"rules": &framework.FieldSchema{
+					"policies": &framework.FieldSchema{
 						Type:        framework.TypeString,
-						Description: strings.TrimSpace(sysHelp["policy-rules"][0]),
+						Description: strings.TrimSpace(sysHelp["entity_policies"][0]),
+					},
+					"metadata": &framework.FieldSchema{
+						Type:        framework.TypeMap,
+						Description: strings.TrimSpace(sysHelp["entity_metadata"][0]),
 					},
 				},
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
-					logical.ReadOperation:   b.handlePolicyRead,
-					logical.UpdateOperation: b.handlePolicySet,
-					logical.DeleteOperation: b.handlePolicyDelete,
+					logical.ReadOperation:   b.handleEntityRead,
+					logical.UpdateOperation: b.handleEntityUpdate,
+					logical.DeleteOperation: b.handleEntityDelete,
 				},
 
-				HelpSynopsis:    strings.TrimSpace(sysHelp["policy"][0]),
-				HelpDescription: strings.TrimSpace(sysHelp["policy"][1]),
+				HelpSynopsis:    strings.TrimSpace(sysHelp["identity/entity/id"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["identity/entity/id"][1]),
 			},
 
 			&framework.Path{
-				Pattern:         "seal-status$",
-				HelpSynopsis:    strings.TrimSpace(sysHelp["seal-status"][0]),
-				HelpDescription: strings.TrimSpace(sysHelp["seal-status"][1]),
-			},
+				Pattern: "identity/entity/name/" + framework.GenericNameRegex("name"),
 
-			&framework.Path{
-				Pattern:         "seal$",
-				HelpSynopsis:    strings.TrimSpace(sysHelp["seal"][0]),
-				HelpDescription: strings.TrimSpace(sysHelp["seal"][1]),
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["entity_name"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleEntityReadByName,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["identity/entity/name"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["identity/entity/name"][1]),
 			},
 
 			&framework.Path{
-				Pattern:         "unseal$",
-				HelpSynopsis:    strings.TrimSpace(sysHelp["unseal"][0]),
-				HelpDescription: strings.TrimSpace(sysHelp["unseal"][1]),
+				Pattern: "identity/entity/merge$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"from_entity_ids": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["entity_merge_from"][0]),
+					},
+					"to_entity_id": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["entity_merge_to"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleEntityMerge,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["identity/entity/merge"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["identity/entity/merge"][1]),
 			},
 
 			&framework.Path{
-				Pattern: "audit-hash/(?P<path>.+)",
+				Pattern: "identity/entity-alias$",
 
 				Fields: map[string]*framework.FieldSchema{
-					"path": &framework.FieldSchema{
+					"entity_id": &framework.FieldSchema{
 						Type:        framework.TypeString,
-						Description: strings.TrimSpace(sysHelp["audit_path"][0]),
+						Description: strings.TrimSpace(sysHelp["entity_id"][0]),
 					},
-
-					"input": &framework.FieldSchema{
-						Type: framework.TypeString,
+					"mount_path": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["alias_mount_path"][0]),
+					},
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["alias_name"][0]),
+					},
+					"metadata": &framework.FieldSchema{
+						Type:        framework.TypeMap,
+						Description: strings.TrimSpace(sysHelp["alias_metadata"][0]),
 					},
 				},
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
-					logical.UpdateOperation: b.handleAuditHash,
+					logical.UpdateOperation: b.handleEntityAliasCreate,
 				},
 
-				HelpSynopsis:    strings.TrimSpace(sysHelp["audit-hash"][0]),
-				HelpDescription: strings.TrimSpace(sysHelp["audit-hash"][1]),
+				HelpSynopsis:    strings.TrimSpace(sysHelp["identity/entity-alias"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["identity/entity-alias"][1]),
 			},
 
 			&framework.Path{
-				Pattern: "audit$",
+				Pattern: "identity/entity-alias/id/" + framework.GenericNameRegex("id"),
+
+				Fields: map[string]*framework.FieldSchema{
+					"id": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["alias_id"][0]),
+					},
+				},
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
-					logical.ReadOperation: b.handleAuditTable,
+					logical.ReadOperation:   b.handleEntityAliasRead,
+					logical.DeleteOperation: b.handleEntityAliasDelete,
 				},
 
-				HelpSynopsis:    strings.TrimSpace(sysHelp["audit-table"][0]),
-				HelpDescription: strings.TrimSpace(sysHelp["audit-table"][1]),
+				HelpSynopsis:    strings.TrimSpace(sysHelp["identity/entity-alias"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["identity/entity-alias"][1]),
 			},
 
 			&framework.Path{
-				Pattern: "audit/(?P<path>.+)",
+				Pattern: "identity/group$",
 
 				Fields: map[string]*framework.FieldSchema{
-					"path": &framework.FieldSchema{
+					"name": &framework.FieldSchema{
 						Type:        framework.TypeString,
-						Description: strings.TrimSpace(sysHelp["audit_path"][0]),
+						Description: strings.TrimSpace(sysHelp["group_name"][0]),
 					},
 					"type": &framework.FieldSchema{
 						Type:        framework.TypeString,
-						Description: strings.TrimSpace(sysHelp["audit_type"][0]),
+						Default:     GroupTypeInternal,
+						Description: strings.TrimSpace(sysHelp["group_type"][0]),
 					},
-					"description": &framework.FieldSchema{
+					"policies": &framework.FieldSchema{
 						Type:        framework.TypeString,
-						Description: strings.TrimSpace(sysHelp["audit_desc"][0]),
+						Description: strings.TrimSpace(sysHelp["group_policies"][0]),
 					},
-					"options": &framework.FieldSchema{
+					"metadata": &framework.FieldSchema{
 						Type:        framework.TypeMap,
-						Description: strings.TrimSpace(sysHelp["audit_opts"][0]),
+						Description: strings.TrimSpace(sysHelp["group_metadata"][0]),
+					},
+					"member_entity_ids": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["group_member_entity_ids"][0]),
 					},
 				},
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
-					logical.UpdateOperation: b.handleEnableAudit,
-					logical.DeleteOperation: b.handleDisableAudit,
+					logical.UpdateOperation: b.handleGroupCreate,
 				},
 
-				HelpSynopsis:    strings.TrimSpace(sysHelp["audit"][0]),
-				HelpDescription: strings.TrimSpace(sysHelp["audit"][1]),
+				HelpSynopsis:    strings.TrimSpace(sysHelp["identity/group"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["identity/group"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "identity/group/id/?$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.handleGroupList,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["identity/group/id"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["identity/group/id"][1]),
 			},
 
 			&framework.Path{
-				Pattern: "raw/(?P<path>.+)",
+				Pattern: "identity/group/id/" + framework.GenericNameRegex("id"),
 
 				Fields: map[string]*framework.FieldSchema{
-					"path": &framework.FieldSchema{
-						Type: framework.TypeString,
+					"id": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["group_id"][0]),
 					},
-					"value": &framework.FieldSchema{
-						Type: framework.TypeString,
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["group_name"][0]),
+					},
+					"policies": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["group_policies"][0]),
+					},
+					"metadata": &framework.FieldSchema{
+						Type:        framework.TypeMap,
+						Description: strings.TrimSpace(sysHelp["group_metadata"][0]),
+					},
+					"member_entity_ids": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["group_member_entity_ids"][0]),
 					},
 				},
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
-					logical.ReadOperation:   b.handleRawRead,
-					logical.UpdateOperation: b.handleRawWrite,
-					logical.DeleteOperation: b.handleRawDelete,
+					logical.ReadOperation:   b.handleGroupRead,
+					logical.UpdateOperation: b.handleGroupUpdate,
+					logical.DeleteOperation: b.handleGroupDelete,
 				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["identity/group/id"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["identity/group/id"][1]),
 			},
 
 			&framework.Path{
-				Pattern: "key-status$",
+				Pattern: "identity/group/name/" + framework.GenericNameRegex("name"),
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["group_name"][0]),
+					},
+				},
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
-					logical.ReadOperation: b.handleKeyStatus,
+					logical.ReadOperation: b.handleGroupReadByName,
 				},
 
-				HelpSynopsis:    strings.TrimSpace(sysHelp["key-status"][0]),
-				HelpDescription: strings.TrimSpace(sysHelp["key-status"][1]),
+				HelpSynopsis:    strings.TrimSpace(sysHelp["identity/group/name"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["identity/group/name"][1]),
 			},
 
 			&framework.Path{
-				Pattern: "rotate$",
+				Pattern: "identity/group-alias$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"group_id": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["group_id"][0]),
+					},
+					"mount_path": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["alias_mount_path"][0]),
+					},
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["group_alias_name"][0]),
+					},
+				},
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
-					logical.UpdateOperation: b.handleRotate,
+					logical.UpdateOperation: b.handleGroupAliasCreate,
 				},
 
-				HelpSynopsis:    strings.TrimSpace(sysHelp["rotate"][0]),
-				HelpDescription: strings.TrimSpace(sysHelp["rotate"][1]),
+				HelpSynopsis:    strings.TrimSpace(sysHelp["identity/group-alias"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["identity/group-alias"][1]),
 			},
-		},
-	}
 
-	b.Backend.Setup(config)
+			&framework.Path{
+				Pattern: "identity/group-alias/id/" + framework.GenericNameRegex("id"),
 
-	return b.Backend
-}
+				Fields: map[string]*framework.FieldSchema{
+					"id": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["alias_id"][0]),
+					},
+				},
 
-// SystemBackend implements logical.Backend and is used to interact with
-// the core of the system. This backend is hardcoded to exist at the "sys"
-// prefix. Conceptually it is similar to procfs on Linux.
-type SystemBackend struct {
-	Core    *Core
-	Backend *framework.Backend
-}
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handleGroupAliasRead,
+					logical.DeleteOperation: b.handleGroupAliasDelete,
+				},
 
-// handleCapabilitiesreturns the ACL capabilities of the token for a given path
-func (b *SystemBackend) handleCapabilities(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	capabilities, err := b.Core.Capabilities(d.Get("token").(string), d.Get("path").(string))
-	if err != nil {
-		return nil, err
-	}
+				HelpSynopsis:    strings.TrimSpace(sysHelp["identity/group-alias"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["identity/group-alias"][1]),
+			},
 
-	return &logical.Response{
-		Data: map[string]interface{}{
-			"capabilities": capabilities,
-		},
-	}, nil
-}
+			&framework.Path{
+				Pattern: "control-group/authorize$",
 
-// handleCapabilitiesAccessor returns the ACL capabilities of the token associted
-// with the given accessor for a given path.
-func (b *SystemBackend) handleCapabilitiesAccessor(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	accessor := d.Get("accessor").(string)
-	if accessor == "" {
-		return logical.ErrorResponse("missing accessor"), nil
-	}
+				Fields: map[string]*framework.FieldSchema{
+					"accessor": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["control_group_accessor"][0]),
+					},
+				},
 
-	aEntry, err := b.Core.tokenStore.lookupByAccessor(accessor)
-	if err != nil {
-		return nil, err
-	}
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleControlGroupAuthorize,
+				},
 
-	capabilities, err := b.Core.Capabilities(aEntry.TokenID, d.Get("path").(string))
-	if err != nil {
-		return nil, err
-	}
+				HelpSynopsis:    strings.TrimSpace(sysHelp["control-group/authorize"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["control-group/authorize"][1]),
+			},
 
-	return &logical.Response{
-		Data: map[string]interface{}{
-			"capabilities": capabilities,
-		},
-	}, nil
-}
+			&framework.Path{
+				Pattern: "control-group/request$",
 
-// handleRekeyRetrieve returns backed-up, PGP-encrypted unseal keys from a
-// rekey operation
-func (b *SystemBackend) handleRekeyRetrieve(
-	req *logical.Request,
-	data *framework.FieldData,
-	recovery bool) (*logical.Response, error) {
-	backup, err := b.Core.RekeyRetrieveBackup(recovery)
-	if err != nil {
-		return nil, fmt.Errorf("unable to look up backed-up keys: %v", err)
-	}
-	if backup == nil {
-		return logical.ErrorResponse("no backed-up keys found"), nil
-	}
+				Fields: map[string]*framework.FieldSchema{
+					"accessor": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["control_group_accessor"][0]),
+					},
+				},
 
-	keysB64 := map[string][]string{}
-	for k, v := range backup.Keys {
-		for _, j := range v {
-			currB64Keys := keysB64[k]
-			if currB64Keys == nil {
-				currB64Keys = []string{}
-			}
-			key, err := hex.DecodeString(j)
-			if err != nil {
-				return nil, fmt.Errorf("error decoding hex-encoded backup key: %v", err)
-			}
-			currB64Keys = append(currB64Keys, base64.StdEncoding.EncodeToString(key))
-			keysB64[k] = currB64Keys
-		}
-	}
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleControlGroupRequestRead,
+				},
 
-	// Format the status
-	resp := &logical.Response{
-		Data: map[string]interface{}{
-			"nonce":       backup.Nonce,
-			"keys":        backup.Keys,
-			"keys_base64": keysB64,
-		},
-	}
+				HelpSynopsis:    strings.TrimSpace(sysHelp["control-group/request"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["control-group/request"][1]),
+			},
 
-	return resp, nil
-}
+			&framework.Path{
+				Pattern: "revoke-prefix/(?P<prefix>.+)",
 
-func (b *SystemBackend) handleRekeyRetrieveBarrier(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	return b.handleRekeyRetrieve(req, data, false)
-}
+				Fields: map[string]*framework.FieldSchema{
+					"prefix": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["revoke-prefix-path"][0]),
+					},
+				},
 
-func (b *SystemBackend) handleRekeyRetrieveRecovery(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	return b.handleRekeyRetrieve(req, data, true)
-}
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleRevokePrefix,
+				},
 
-// handleRekeyDelete deletes backed-up, PGP-encrypted unseal keys from a rekey
-// operation
-func (b *SystemBackend) handleRekeyDelete(
-	req *logical.Request,
-	data *framework.FieldData,
-	recovery bool) (*logical.Response, error) {
-	err := b.Core.RekeyDeleteBackup(recovery)
-	if err != nil {
-		return nil, fmt.Errorf("error during deletion of backed-up keys: %v", err)
-	}
+				HelpSynopsis:    strings.TrimSpace(sysHelp["revoke-prefix"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["revoke-prefix"][1]),
+			},
 
-	return nil, nil
-}
-func (b *SystemBackend) handleRekeyDeleteBarrier(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	return b.handleRekeyDelete(req, data, false)
-}
+			&framework.Path{
+				Pattern: "auth$",
 
-func (b *SystemBackend) handleRekeyDeleteRecovery(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	return b.handleRekeyDelete(req, data, true)
-}
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleAuthTable,
+				},
 
-// handleMountTable handles the "mounts" endpoint to provide the mount table
-func (b *SystemBackend) handleMountTable(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	b.Core.mountsLock.RLock()
-	defer b.Core.mountsLock.RUnlock()
+				HelpSynopsis:    strings.TrimSpace(sysHelp["auth-table"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["auth-table"][1]),
+			},
 
-	resp := &logical.Response{
-		Data: make(map[string]interface{}),
-	}
+			&framework.Path{
+				Pattern: "auth/(?P<path>.+)",
 
-	for _, entry := range b.Core.mounts.Entries {
-		info := map[string]interface{}{
-			"type":        entry.Type,
-			"description": entry.Description,
-			"config": map[string]interface{}{
-				"default_lease_ttl": int64(entry.Config.DefaultLeaseTTL.Seconds()),
-				"max_lease_ttl":     int64(entry.Config.MaxLeaseTTL.Seconds()),
+				Fields: map[string]*framework.FieldSchema{
+					"path": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["auth_path"][0]),
+					},
+					"type": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["auth_type"][0]),
+					},
+					"description": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["auth_desc"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleEnableAuth,
+					logical.DeleteOperation: b.handleDisableAuth,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["auth"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["auth"][1]),
 			},
-		}
 
-		resp.Data[entry.Path] = info
-	}
+			&framework.Path{
+				Pattern: "policy$",
 
-	return resp, nil
-}
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handlePolicyList,
+					logical.ListOperation: b.handlePolicyList,
+				},
 
-// handleMount is used to mount a new path
-func (b *SystemBackend) handleMount(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	// Get all the options
-	path := data.Get("path").(string)
-	logicalType := data.Get("type").(string)
-	description := data.Get("description").(string)
+				HelpSynopsis:    strings.TrimSpace(sysHelp["policy-list"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["policy-list"][1]),
+			},
 
-	path = sanitizeMountPath(path)
+			&framework.Path{
+				Pattern: "policy/(?P<name>.+)",
 
-	var config MountConfig
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["policy-name"][0]),
+					},
+					"rules": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["policy-rules"][0]),
+					},
+				},
 
-	var apiConfig struct {
-		DefaultLeaseTTL string `json:"default_lease_ttl" structs:"default_lease_ttl" mapstructure:"default_lease_ttl"`
-		MaxLeaseTTL     string `json:"max_lease_ttl" structs:"max_lease_ttl" mapstructure:"max_lease_ttl"`
-	}
-	configMap := data.Get("config").(map[string]interface{})
-	if configMap != nil && len(configMap) != 0 {
-		err := mapstructure.Decode(configMap, &apiConfig)
-		if err != nil {
-			return logical.ErrorResponse(
-					"unable to convert given mount config information"),
-				logical.ErrInvalidRequest
-		}
-	}
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handlePolicyRead,
+					logical.UpdateOperation: b.handlePolicySet,
+					logical.DeleteOperation: b.handlePolicyDelete,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["policy"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["policy"][1]),
+			},
+
+			&framework.Path{
+				Pattern:         "seal-status$",
+				HelpSynopsis:    strings.TrimSpace(sysHelp["seal-status"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["seal-status"][1]),
+			},
+
+			&framework.Path{
+				Pattern:         "seal$",
+				HelpSynopsis:    strings.TrimSpace(sysHelp["seal"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["seal"][1]),
+			},
+
+			&framework.Path{
+				Pattern:         "unseal$",
+				HelpSynopsis:    strings.TrimSpace(sysHelp["unseal"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["unseal"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "audit-hash/(?P<path>.+)",
+
+				Fields: map[string]*framework.FieldSchema{
+					"path": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["audit_path"][0]),
+					},
+
+					"input": &framework.FieldSchema{
+						Type: framework.TypeString,
+					},
+
+					"version": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: strings.TrimSpace(sysHelp["audit_salt_version"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleAuditHash,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["audit-hash"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["audit-hash"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "audit-hash-verify/(?P<path>.+)",
+
+				Fields: map[string]*framework.FieldSchema{
+					"path": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["audit_path"][0]),
+					},
+
+					"input": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["audit_verify_input"][0]),
+					},
+
+					"hash": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["audit_verify_hash"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleAuditHashVerify,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["audit-hash-verify"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["audit-hash-verify"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "audit-rotate-salt/(?P<path>.+)",
+
+				Fields: map[string]*framework.FieldSchema{
+					"path": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["audit_path"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleAuditRotateSalt,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["audit-rotate-salt"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["audit-rotate-salt"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "audit-schema$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleAuditSchemaList,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["audit-schema"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["audit-schema"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "audit-schema/(?P<version>\\d+)",
+
+				Fields: map[string]*framework.FieldSchema{
+					"version": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: strings.TrimSpace(sysHelp["audit_schema_version"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleAuditSchemaRead,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["audit-schema"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["audit-schema"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "audit$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleAuditTable,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["audit-table"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["audit-table"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "audit/(?P<path>.+)",
+
+				Fields: map[string]*framework.FieldSchema{
+					"path": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["audit_path"][0]),
+					},
+					"type": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["audit_type"][0]),
+					},
+					"description": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["audit_desc"][0]),
+					},
+					"options": &framework.FieldSchema{
+						Type:        framework.TypeMap,
+						Description: strings.TrimSpace(sysHelp["audit_opts"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleEnableAudit,
+					logical.DeleteOperation: b.handleDisableAudit,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["audit"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["audit"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "key-status$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleKeyStatus,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["key-status"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["key-status"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "rotate$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleRotate,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["rotate"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["rotate"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "rotate/config$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"enabled": &framework.FieldSchema{
+						Type:        framework.TypeBool,
+						Description: strings.TrimSpace(sysHelp["rotation_enabled"][0]),
+					},
+					"max_operations": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: strings.TrimSpace(sysHelp["rotation_max_operations"][0]),
+					},
+					"interval": &framework.FieldSchema{
+						Type:        framework.TypeDurationSecond,
+						Description: strings.TrimSpace(sysHelp["rotation_interval"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handleRotationConfigRead,
+					logical.UpdateOperation: b.handleRotationConfigUpdate,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["rotate/config"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["rotate/config"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "config/cors$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"enabled": &framework.FieldSchema{
+						Type:        framework.TypeBool,
+						Default:     true,
+						Description: strings.TrimSpace(sysHelp["cors_enabled"][0]),
+					},
+					"allowed_origins": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["cors_allowed_origins"][0]),
+					},
+					"allowed_headers": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["cors_allowed_headers"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handleCORSRead,
+					logical.UpdateOperation: b.handleCORSUpdate,
+					logical.DeleteOperation: b.handleCORSDelete,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["config/cors"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["config/cors"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "quotas/lease-count/?$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.handleLeaseCountQuotaList,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["quotas/lease-count"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["quotas/lease-count"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "quotas/lease-count/" + framework.GenericNameRegex("name"),
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["quota_name"][0]),
+					},
+					"path": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["quota_path"][0]),
+					},
+					"role": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["quota_role"][0]),
+					},
+					"max_leases": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: strings.TrimSpace(sysHelp["quota_max_leases"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handleLeaseCountQuotaRead,
+					logical.UpdateOperation: b.handleLeaseCountQuotaUpdate,
+					logical.DeleteOperation: b.handleLeaseCountQuotaDelete,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["quotas/lease-count"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["quotas/lease-count"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "quotas/rate-limit/?$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.handleRateLimitQuotaList,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["quotas/rate-limit"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["quotas/rate-limit"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "quotas/rate-limit/" + framework.GenericNameRegex("name"),
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["quota_name"][0]),
+					},
+					"path": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["rate_quota_path"][0]),
+					},
+					"rate": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["rate_quota_rate"][0]),
+					},
+					"burst": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: strings.TrimSpace(sysHelp["rate_quota_burst"][0]),
+					},
+					"block_interval": &framework.FieldSchema{
+						Type:        framework.TypeDurationSecond,
+						Description: strings.TrimSpace(sysHelp["rate_quota_block_interval"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handleRateLimitQuotaRead,
+					logical.UpdateOperation: b.handleRateLimitQuotaUpdate,
+					logical.DeleteOperation: b.handleRateLimitQuotaDelete,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["quotas/rate-limit"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["quotas/rate-limit"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "storage/snapshots/config/?$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.handleStorageSnapshotConfigList,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["storage/snapshots/config"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["storage/snapshots/config"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "storage/snapshots/config/" + framework.GenericNameRegex("name"),
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["snapshot_name"][0]),
+					},
+					"interval": &framework.FieldSchema{
+						Type:        framework.TypeDurationSecond,
+						Description: strings.TrimSpace(sysHelp["snapshot_interval"][0]),
+					},
+					"retain": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: strings.TrimSpace(sysHelp["snapshot_retain"][0]),
+					},
+					"storage_type": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["snapshot_storage_type"][0]),
+					},
+					"path_prefix": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["snapshot_path_prefix"][0]),
+					},
+					"file_prefix": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["snapshot_file_prefix"][0]),
+					},
+					"aws_s3_bucket": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The S3 bucket, for the aws-s3 storage type.",
+					},
+					"aws_s3_region": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The region of the S3 bucket. Defaults to us-east-1.",
+					},
+					"aws_s3_endpoint": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The endpoint of an S3-compatible service.",
+					},
+					"aws_s3_force_path_style": &framework.FieldSchema{
+						Type:        framework.TypeBool,
+						Description: "Whether to use path-style S3 URLs.",
+					},
+					"aws_access_key_id": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The AWS access key. Defaults to the environment, the credentials file or the instance role.",
+					},
+					"aws_secret_access_key": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The AWS secret key.",
+					},
+					"google_gcs_bucket": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The Cloud Storage bucket, for the google-gcs storage type.",
+					},
+					"google_gcs_endpoint": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The endpoint of the Cloud Storage JSON API.",
+					},
+					"google_service_account_key_file": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The path to the JSON key file of a service account on the active node. Defaults to the application default credentials.",
+					},
+					"azure_container_name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The Azure Blob Storage container, for the azure-blob storage type.",
+					},
+					"azure_account_name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The Azure storage account name.",
+					},
+					"azure_account_key": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: "The Azure storage account key.",
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handleStorageSnapshotConfigRead,
+					logical.UpdateOperation: b.handleStorageSnapshotConfigUpdate,
+					logical.DeleteOperation: b.handleStorageSnapshotConfigDelete,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["storage/snapshots/config"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["storage/snapshots/config"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "storage/snapshots/status/" + framework.GenericNameRegex("name"),
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["snapshot_name"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleStorageSnapshotStatusRead,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["storage/snapshots/status"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["storage/snapshots/status"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "policies/egp/?$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.handleEndpointPolicyList,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["policies/egp"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["policies/egp"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "policies/egp/" + framework.GenericNameRegex("name"),
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["egp_name"][0]),
+					},
+					"paths": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["egp_paths"][0]),
+					},
+					"bound_cidrs": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["egp_bound_cidrs"][0]),
+					},
+					"require_mfa": &framework.FieldSchema{
+						Type:        framework.TypeBool,
+						Description: strings.TrimSpace(sysHelp["egp_require_mfa"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handleEndpointPolicyRead,
+					logical.UpdateOperation: b.handleEndpointPolicyUpdate,
+					logical.DeleteOperation: b.handleEndpointPolicyDelete,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["policies/egp"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["policies/egp"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "mfa/method/?$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.handleMFAMethodList,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["mfa/method"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["mfa/method"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "mfa/method/totp/" + framework.GenericNameRegex("name"),
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["mfa_method_name"][0]),
+					},
+					"issuer": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["mfa_totp_issuer"][0]),
+					},
+					"period": &framework.FieldSchema{
+						Type:        framework.TypeDurationSecond,
+						Description: strings.TrimSpace(sysHelp["mfa_totp_period"][0]),
+					},
+					"digits": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: strings.TrimSpace(sysHelp["mfa_totp_digits"][0]),
+					},
+					"algorithm": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["mfa_totp_algorithm"][0]),
+					},
+					"key_size": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: strings.TrimSpace(sysHelp["mfa_totp_key_size"][0]),
+					},
+					"skew": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: strings.TrimSpace(sysHelp["mfa_totp_skew"][0]),
+					},
+					"max_validation_attempts": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: strings.TrimSpace(sysHelp["mfa_totp_max_validation_attempts"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handleMFAMethodRead,
+					logical.UpdateOperation: b.handleMFAMethodUpdate(mfaTypeTOTP),
+					logical.DeleteOperation: b.handleMFAMethodDelete,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["mfa/method/totp"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["mfa/method/totp"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "mfa/method/totp/" + framework.GenericNameRegex("name") + "/admin-generate$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["mfa_method_name"][0]),
+					},
+					"entity_id": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["mfa_totp_entity_id"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleMFATOTPAdminGenerate,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["mfa/method/totp/admin"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["mfa/method/totp/admin"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "mfa/method/totp/" + framework.GenericNameRegex("name") + "/admin-destroy$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["mfa_method_name"][0]),
+					},
+					"entity_id": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["mfa_totp_entity_id"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleMFATOTPAdminDestroy,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["mfa/method/totp/admin"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["mfa/method/totp/admin"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "mfa/method/duo/" + framework.GenericNameRegex("name"),
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["mfa_method_name"][0]),
+					},
+					"username_format": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["mfa_username_format"][0]),
+					},
+					"integration_key": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["mfa_duo_integration_key"][0]),
+					},
+					"secret_key": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["mfa_duo_secret_key"][0]),
+					},
+					"api_hostname": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["mfa_duo_api_hostname"][0]),
+					},
+					"push_info": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["mfa_duo_push_info"][0]),
+					},
+					"use_passcode": &framework.FieldSchema{
+						Type:        framework.TypeBool,
+						Description: strings.TrimSpace(sysHelp["mfa_duo_use_passcode"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handleMFAMethodRead,
+					logical.UpdateOperation: b.handleMFAMethodUpdate(mfaTypeDuo),
+					logical.DeleteOperation: b.handleMFAMethodDelete,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["mfa/method/duo"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["mfa/method/duo"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "mfa/method/pingid/" + framework.GenericNameRegex("name"),
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["mfa_method_name"][0]),
+					},
+					"username_format": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["mfa_username_format"][0]),
+					},
+					"settings_file_base64": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["mfa_pingid_settings_file"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handleMFAMethodRead,
+					logical.UpdateOperation: b.handleMFAMethodUpdate(mfaTypePingID),
+					logical.DeleteOperation: b.handleMFAMethodDelete,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["mfa/method/pingid"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["mfa/method/pingid"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "mfa/totp/" + framework.GenericNameRegex("name") + "/generate$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["mfa_method_name"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleMFATOTPGenerate,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["mfa/totp/generate"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["mfa/totp/generate"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "mfa/enforcement/?$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.handleMFAEnforcementList,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["mfa/enforcement"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["mfa/enforcement"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "mfa/enforcement/" + framework.GenericNameRegex("name"),
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["mfa_enforcement_name"][0]),
+					},
+					"mfa_method_names": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["mfa_enforcement_method_names"][0]),
+					},
+					"auth_mounts": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["mfa_enforcement_auth_mounts"][0]),
+					},
+					"identity_entity_ids": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["mfa_enforcement_entity_ids"][0]),
+					},
+					"paths": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["mfa_enforcement_paths"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handleMFAEnforcementRead,
+					logical.UpdateOperation: b.handleMFAEnforcementUpdate,
+					logical.DeleteOperation: b.handleMFAEnforcementDelete,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["mfa/enforcement"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["mfa/enforcement"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "namespaces/?$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.handleNamespaceList,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["namespaces"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["namespaces"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "namespaces/" + framework.GenericNameRegex("path"),
+
+				Fields: map[string]*framework.FieldSchema{
+					"path": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["namespace_path"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handleNamespaceRead,
+					logical.UpdateOperation: b.handleNamespaceUpdate,
+					logical.DeleteOperation: b.handleNamespaceDelete,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["namespaces"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["namespaces"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "replication/dr/primary/enable$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleDRPrimaryEnable,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["replication/dr/primary"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["replication/dr/primary"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "replication/dr/primary/disable$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleDRPrimaryDisable,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["replication/dr/primary"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["replication/dr/primary"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "replication/dr/primary/secondary-token$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"id": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["dr_secondary_id"][0]),
+					},
+					"primary_api_addr": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["dr_primary_api_addr"][0]),
+					},
+					"mode": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["dr_path_filter_mode"][0]),
+					},
+					"paths": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["dr_path_filter_paths"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleDRSecondaryToken,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["replication/dr/primary"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["replication/dr/primary"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "replication/dr/primary/revoke-secondary$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"id": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["dr_secondary_id"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleDRRevokeSecondary,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["replication/dr/primary"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["replication/dr/primary"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "replication/dr/primary/fetch$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"id": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["dr_secondary_id"][0]),
+					},
+					"secret": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["dr_fetch_secret"][0]),
+					},
+					"epoch": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["dr_fetch_epoch"][0]),
+					},
+					"index": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Description: strings.TrimSpace(sysHelp["dr_fetch_index"][0]),
+					},
+					"cursor": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["dr_fetch_cursor"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleDRFetch,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["replication/dr/primary/fetch"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["replication/dr/primary/fetch"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "replication/dr/secondary/enable$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"token": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["dr_activation_token"][0]),
+					},
+					"primary_api_addr": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["dr_primary_api_addr"][0]),
+					},
+					"ca_cert": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["dr_ca_cert"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleDRSecondaryEnable,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["replication/dr/secondary"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["replication/dr/secondary"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "storage/raft/join$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"node_id": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["raft_node_id"][0]),
+					},
+					"address": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["raft_address"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleRaftJoin,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["storage/raft/join"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["storage/raft/join"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "storage/raft/configuration$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleRaftConfiguration,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["storage/raft/configuration"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["storage/raft/configuration"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "storage/raft/remove-peer$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"node_id": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["raft_node_id"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.UpdateOperation: b.handleRaftRemovePeer,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["storage/raft/remove-peer"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["storage/raft/remove-peer"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "storage/raft/snapshot$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handleRaftSnapshot,
+					logical.UpdateOperation: b.handleRaftRestore,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["storage/raft/snapshot"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["storage/raft/snapshot"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "events$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleEvents,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["events"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["events"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "metrics$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleMetrics,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["metrics"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["metrics"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "hsm-status$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation: b.handleHSMStatus,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["hsm-status"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["hsm-status"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "loggers$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"level": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["loggers_level"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handleLoggersRead,
+					logical.UpdateOperation: b.handleLoggersUpdate,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["loggers"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["loggers"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "loggers/sinks/?$",
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ListOperation: b.handleLogSinksList,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["loggers_sinks"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["loggers_sinks"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "loggers/sinks/(?P<name>.+)",
+
+				Fields: map[string]*framework.FieldSchema{
+					"name": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["loggers_sink_name"][0]),
+					},
+					"type": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["loggers_sink_type"][0]),
+					},
+					"level": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["loggers_sink_level"][0]),
+					},
+					"options": &framework.FieldSchema{
+						Type:        framework.TypeMap,
+						Description: strings.TrimSpace(sysHelp["loggers_sink_options"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handleLogSinkRead,
+					logical.UpdateOperation: b.handleLogSinkUpdate,
+					logical.DeleteOperation: b.handleLogSinkDelete,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["loggers_sinks"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["loggers_sinks"][1]),
+			},
+
+			&framework.Path{
+				Pattern: "loggers/(?P<subsystem>" + strings.Join(logutil.Subsystems, "|") + ")$",
+
+				Fields: map[string]*framework.FieldSchema{
+					"subsystem": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["loggers_subsystem_name"][0]),
+					},
+					"level": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Description: strings.TrimSpace(sysHelp["loggers_level"][0]),
+					},
+				},
+
+				Callbacks: map[logical.Operation]framework.OperationFunc{
+					logical.ReadOperation:   b.handleLoggerRead,
+					logical.UpdateOperation: b.handleLoggerUpdate,
+					logical.DeleteOperation: b.handleLoggerDelete,
+				},
+
+				HelpSynopsis:    strings.TrimSpace(sysHelp["loggers_subsystem"][0]),
+				HelpDescription: strings.TrimSpace(sysHelp["loggers_subsystem"][1]),
+			},
+		},
+	}
+
+	// The raw endpoints bypass the checks of the other endpoints, so they
+	// are only mounted if enabled in the configuration
+	if core.enableRaw {
+		b.Backend.Paths = append(b.Backend.Paths, b.rawPaths()...)
+	}
+
+	if ns != nil {
+		var paths []*framework.Path
+		for _, path := range b.Backend.Paths {
+			if strutil.StrListContains(namespaceSystemPatterns, path.Pattern) {
+				paths = append(paths, path)
+			}
+		}
+		b.Backend.Paths = paths
+		b.Backend.PathsSpecial = &logical.Paths{
+			Root: []string{
+				"auth/*",
+				"namespaces",
+				"namespaces/*",
+			},
+		}
+	}
+
+	b.Backend.Setup(config)
+
+	return b.Backend
+}
+
+// namespaceSystemPatterns are the patterns of the system endpoints the
+// namespaces have
+var namespaceSystemPatterns = []string{
+	"capabilities-self$",
+	"mounts$",
+	"mounts/(?P<path>.+?)/tune$",
+	"mounts/(?P<path>.+?)",
+	"auth$",
+	"auth/(?P<path>.+?)/tune$",
+	"auth/(?P<path>.+)",
+	"policy$",
+	"policy/(?P<name>.+)",
+	"namespaces/?$",
+	"namespaces/" + framework.GenericNameRegex("path"),
+}
+
+// SystemBackend implements logical.Backend and is used to interact with
+// the core of the system. This backend is hardcoded to exist at the "sys"
+// prefix. Conceptually it is similar to procfs on Linux.
+type SystemBackend struct {
+	Core    *Core
+	Backend *framework.Backend
+
+	// namespace is set for the system backend of a namespace, whose
+	// endpoints act on the namespace
+	namespace *Namespace
+}
+
+// policyStore returns the policy store of the namespace of the backend
+func (b *SystemBackend) policyStore() *PolicyStore {
+	if b.namespace != nil {
+		return b.namespace.policyStore
+	}
+	return b.Core.policyStore
+}
+
+// handleCapabilitiesreturns the ACL capabilities of the token for a given path
+func (b *SystemBackend) handleCapabilities(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	path := d.Get("path").(string)
+	if b.namespace != nil && path != "" {
+		path = namespaceRoutePath(b.namespace.Path, path)
+	}
+	capabilities, err := b.Core.Capabilities(d.Get("token").(string), path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"capabilities": capabilities,
+		},
+	}, nil
+}
+
+// handleCapabilitiesAccessor returns the ACL capabilities of the token associted
+// with the given accessor for a given path.
+func (b *SystemBackend) handleCapabilitiesAccessor(req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	accessor := d.Get("accessor").(string)
+	if accessor == "" {
+		return logical.ErrorResponse("missing accessor"), nil
+	}
+
+	aEntry, err := b.Core.tokenStore.lookupByAccessor(accessor)
+	if err != nil {
+		return nil, err
+	}
+
+	capabilities, err := b.Core.Capabilities(aEntry.TokenID, d.Get("path").(string))
+	if err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"capabilities": capabilities,
+		},
+	}, nil
+}
+
+// handleRekeyRetrieve returns backed-up, PGP-encrypted unseal keys from a
+// rekey operation
+func (b *SystemBackend) handleRekeyRetrieve(
+	req *logical.Request,
+	data *framework.FieldData,
+	recovery bool) (*logical.Response, error) {
+	backup, err := b.Core.RekeyRetrieveBackup(recovery)
+	if err != nil {
+		return nil, fmt.Errorf("unable to look up backed-up keys: %v", err)
+	}
+	if backup == nil {
+		return logical.ErrorResponse("no backed-up keys found"), nil
+	}
+
+	keysB64 := map[string][]string{}
+	for k, v := range backup.Keys {
+		for _, j := range v {
+			currB64Keys := keysB64[k]
+			if currB64Keys == nil {
+				currB64Keys = []string{}
+			}
+			key, err := hex.DecodeString(j)
+			if err != nil {
+				return nil, fmt.Errorf("error decoding hex-encoded backup key: %v", err)
+			}
+			currB64Keys = append(currB64Keys, base64.StdEncoding.EncodeToString(key))
+			keysB64[k] = currB64Keys
+		}
+	}
+
+	// Format the status
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"nonce":       backup.Nonce,
+			"keys":        backup.Keys,
+			"keys_base64": keysB64,
+		},
+	}
+
+	return resp, nil
+}
+
+func (b *SystemBackend) handleRekeyRetrieveBarrier(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.handleRekeyRetrieve(req, data, false)
+}
+
+func (b *SystemBackend) handleRekeyRetrieveRecovery(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.handleRekeyRetrieve(req, data, true)
+}
+
+// handleRekeyDelete deletes backed-up, PGP-encrypted unseal keys from a rekey
+// operation
+func (b *SystemBackend) handleRekeyDelete(
+	req *logical.Request,
+	data *framework.FieldData,
+	recovery bool) (*logical.Response, error) {
+	err := b.Core.RekeyDeleteBackup(recovery)
+	if err != nil {
+		return nil, fmt.Errorf("error during deletion of backed-up keys: %v", err)
+	}
+
+	return nil, nil
+}
+func (b *SystemBackend) handleRekeyDeleteBarrier(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.handleRekeyDelete(req, data, false)
+}
+
+func (b *SystemBackend) handleRekeyDeleteRecovery(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.handleRekeyDelete(req, data, true)
+}
+
+// handleMountTable handles the "mounts" endpoint to provide the mount table
+func (b *SystemBackend) handleMountTable(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.Core.mountsLock.RLock()
+	defer b.Core.mountsLock.RUnlock()
+
+	resp := &logical.Response{
+		Data: make(map[string]interface{}),
+	}
+
+	for _, entry := range b.Core.mounts.Entries {
+		// Only the mounts of the namespace of the backend are listed
+		if b.Core.mountNamespace(entry) != b.namespace {
+			continue
+		}
+
+		info := map[string]interface{}{
+			"type":        entry.Type,
+			"description": entry.Description,
+			"config": map[string]interface{}{
+				"default_lease_ttl": int64(entry.Config.DefaultLeaseTTL.Seconds()),
+				"max_lease_ttl":     int64(entry.Config.MaxLeaseTTL.Seconds()),
+				"max_request_size":  entry.Config.MaxRequestSize,
+			},
+		}
+
+		// Lazy mounts are only ready once their backend has been set up
+		ready, err := b.Core.router.MountState(entry.Path)
+		info["ready"] = ready
+		if err != nil {
+			info["setup_error"] = err.Error()
+		}
+
+		resp.Data[strings.TrimPrefix(entry.Path, namespacePath(b.namespace))] = info
+	}
+
+	return resp, nil
+}
+
+// handleMount is used to mount a new path
+func (b *SystemBackend) handleMount(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// Get all the options
+	path := data.Get("path").(string)
+	logicalType := data.Get("type").(string)
+	description := data.Get("description").(string)
+
+	path, err := b.Core.namespaceMountPath(b.namespace, sanitizeMountPath(path))
+	if err != nil {
+		return handleError(err)
+	}
+
+	var config MountConfig
+
+	var apiConfig struct {
+		DefaultLeaseTTL string `json:"default_lease_ttl" structs:"default_lease_ttl" mapstructure:"default_lease_ttl"`
+		MaxLeaseTTL     string `json:"max_lease_ttl" structs:"max_lease_ttl" mapstructure:"max_lease_ttl"`
+		MaxRequestSize  int64  `json:"max_request_size" structs:"max_request_size" mapstructure:"max_request_size"`
+	}
+	configMap := data.Get("config").(map[string]interface{})
+	if configMap != nil && len(configMap) != 0 {
+		err := mapstructure.Decode(configMap, &apiConfig)
+		if err != nil {
+			return logical.ErrorResponse(
+					"unable to convert given mount config information"),
+				logical.ErrInvalidRequest
+		}
+	}
+
+	switch apiConfig.DefaultLeaseTTL {
+	case "":
+	case "system":
+	default:
+		tmpDef, err := duration.ParseDurationSecond(apiConfig.DefaultLeaseTTL)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf(
+					"unable to parse default TTL of %s: %s", apiConfig.DefaultLeaseTTL, err)),
+				logical.ErrInvalidRequest
+		}
+		config.DefaultLeaseTTL = tmpDef
+	}
+
+	switch apiConfig.MaxLeaseTTL {
+	case "":
+	case "system":
+	default:
+		tmpMax, err := duration.ParseDurationSecond(apiConfig.MaxLeaseTTL)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf(
+					"unable to parse max TTL of %s: %s", apiConfig.MaxLeaseTTL, err)),
+				logical.ErrInvalidRequest
+		}
+		config.MaxLeaseTTL = tmpMax
+	}
+
+	if config.MaxLeaseTTL != 0 && config.DefaultLeaseTTL > config.MaxLeaseTTL {
+		return logical.ErrorResponse(
+				"given default lease TTL greater than given max lease TTL"),
+			logical.ErrInvalidRequest
+	}
+
+	if config.DefaultLeaseTTL > b.Core.maxLeaseTTL {
+		return logical.ErrorResponse(fmt.Sprintf(
+				"given default lease TTL greater than system max lease TTL of %d", int(b.Core.maxLeaseTTL.Seconds()))),
+			logical.ErrInvalidRequest
+	}
+
+	if apiConfig.MaxRequestSize < 0 {
+		return logical.ErrorResponse(
+				"given max request size cannot be negative"),
+			logical.ErrInvalidRequest
+	}
+	config.MaxRequestSize = apiConfig.MaxRequestSize
+
+	if logicalType == "" {
+		return logical.ErrorResponse(
+				"backend type must be specified as a string"),
+			logical.ErrInvalidRequest
+	}
+
+	// Create the mount entry
+	me := &MountEntry{
+		Table:       mountTableType,
+		Path:        path,
+		Type:        logicalType,
+		Description: description,
+		Config:      config,
+	}
+
+	// Attempt mount
+	if err := b.Core.mount(me); err != nil {
+		b.Backend.Logger().Printf("[ERR] sys: mount %s failed: %v", me.Path, err)
+		return handleError(err)
+	}
+
+	return nil, nil
+}
+
+// used to intercept an HTTPCodedError so it goes back to callee
+func handleError(
+	err error) (*logical.Response, error) {
+	switch err.(type) {
+	case logical.HTTPCodedError:
+		return logical.ErrorResponse(err.Error()), err
+	default:
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+}
+
+// handleUnmount is used to unmount a path
+func (b *SystemBackend) handleUnmount(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	suffix := strings.TrimPrefix(req.Path, "mounts/")
+	if len(suffix) == 0 {
+		return logical.ErrorResponse("path cannot be blank"), logical.ErrInvalidRequest
+	}
+
+	suffix, err := b.Core.namespaceMountPath(b.namespace, sanitizeMountPath(suffix))
+	if err != nil {
+		return handleError(err)
+	}
+
+	// Attempt unmount
+	if err := b.Core.unmount(suffix); err != nil {
+		b.Backend.Logger().Printf("[ERR] sys: unmount '%s' failed: %v", suffix, err)
+		return handleError(err)
+	}
+
+	return nil, nil
+}
+
+// handleRemount is used to remount a path
+func (b *SystemBackend) handleRemount(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// Get the paths
+	fromPath := data.Get("from").(string)
+	toPath := data.Get("to").(string)
+	if fromPath == "" || toPath == "" {
+		return logical.ErrorResponse(
+				"both 'from' and 'to' path must be specified as a string"),
+			logical.ErrInvalidRequest
+	}
+
+	fromPath = sanitizeMountPath(fromPath)
+	toPath = sanitizeMountPath(toPath)
+
+	// Attempt remount
+	if err := b.Core.remount(fromPath, toPath); err != nil {
+		b.Backend.Logger().Printf("[ERR] sys: remount '%s' to '%s' failed: %v", fromPath, toPath, err)
+		return handleError(err)
+	}
+
+	return nil, nil
+}
+
+// handleAuthTuneRead is used to get config settings on a auth path
+func (b *SystemBackend) handleAuthTuneRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	path := data.Get("path").(string)
+	if path == "" {
+		return logical.ErrorResponse(
+				"path must be specified as a string"),
+			logical.ErrInvalidRequest
+	}
+	return b.handleTuneReadCommon("auth/" + path)
+}
+
+// handleMountTuneRead is used to get config settings on a backend
+func (b *SystemBackend) handleMountTuneRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	path := data.Get("path").(string)
+	if path == "" {
+		return logical.ErrorResponse(
+				"path must be specified as a string"),
+			logical.ErrInvalidRequest
+	}
+
+	// This call will read both logical backend's configuration as well as auth backends'.
+	// Retaining this behavior for backward compatibility. If this behavior is not desired,
+	// an error can be returned if path has a prefix of "auth/".
+	return b.handleTuneReadCommon(path)
+}
+
+// handleTuneReadCommon returns the config settings of a path
+func (b *SystemBackend) handleTuneReadCommon(path string) (*logical.Response, error) {
+	path, err := b.namespaceTunePath(sanitizeMountPath(path))
+	if err != nil {
+		return handleError(err)
+	}
+
+	sysView := b.Core.router.MatchingSystemView(path)
+	if sysView == nil {
+		err := fmt.Errorf("[ERR] sys: cannot fetch sysview for path %s", path)
+		b.Backend.Logger().Print(err)
+		return handleError(err)
+	}
+
+	var config MountConfig
+	if mountEntry := b.Core.router.MatchingMountEntry(path); mountEntry != nil {
+		config = mountEntry.Config
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"default_lease_ttl": int(sysView.DefaultLeaseTTL().Seconds()),
+			"max_lease_ttl":     int(sysView.MaxLeaseTTL().Seconds()),
+			"max_request_size":  config.MaxRequestSize,
+		},
+	}
+
+	// The audit keys are only returned once tuned
+	if len(config.AuditNonHMACRequestKeys) > 0 {
+		resp.Data["audit_non_hmac_request_keys"] = config.AuditNonHMACRequestKeys
+	}
+	if len(config.AuditNonHMACResponseKeys) > 0 {
+		resp.Data["audit_non_hmac_response_keys"] = config.AuditNonHMACResponseKeys
+	}
+	if len(config.AuditElideResponseKeys) > 0 {
+		resp.Data["audit_elide_response_keys"] = config.AuditElideResponseKeys
+	}
+
+	return resp, nil
+}
+
+// handleAuthTuneWrite is used to set config settings on an auth path
+func (b *SystemBackend) handleAuthTuneWrite(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	path := data.Get("path").(string)
+	if path == "" {
+		return logical.ErrorResponse("path must be specified as a string"),
+			logical.ErrInvalidRequest
+	}
+	return b.handleTuneWriteCommon("auth/"+path, data)
+}
+
+// handleMountTuneWrite is used to set config settings on a backend
+func (b *SystemBackend) handleMountTuneWrite(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	path := data.Get("path").(string)
+	if path == "" {
+		return logical.ErrorResponse("path must be specified as a string"),
+			logical.ErrInvalidRequest
+	}
+	// This call will write both logical backend's configuration as well as auth backends'.
+	// Retaining this behavior for backward compatibility. If this behavior is not desired,
+	// an error can be returned if path has a prefix of "auth/".
+	return b.handleTuneWriteCommon(path, data)
+}
+
+// namespaceTunePath returns the full path of the mount or auth mount to
+// tune, given its path relative to the namespace of the backend
+func (b *SystemBackend) namespaceTunePath(path string) (string, error) {
+	if b.namespace == nil {
+		return path, nil
+	}
+	if strings.HasPrefix(path, credentialRoutePrefix) {
+		full, err := b.Core.namespaceMountPath(b.namespace, strings.TrimPrefix(path, credentialRoutePrefix))
+		if err != nil {
+			return "", err
+		}
+		return credentialRoutePrefix + full, nil
+	}
+	return b.Core.namespaceMountPath(b.namespace, path)
+}
+
+// handleTuneWriteCommon is used to set config settings on a path
+func (b *SystemBackend) handleTuneWriteCommon(
+	path string, data *framework.FieldData) (*logical.Response, error) {
+	path, err := b.namespaceTunePath(sanitizeMountPath(path))
+	if err != nil {
+		return handleError(err)
+	}
+
+	// Prevent protected paths from being changed
+	for _, p := range untunableMounts {
+		if strings.HasPrefix(path, p) {
+			err := fmt.Errorf("[ERR] core: cannot tune '%s'", path)
+			b.Backend.Logger().Print(err)
+			return handleError(err)
+		}
+	}
+
+	mountEntry := b.Core.router.MatchingMountEntry(path)
+	if mountEntry == nil {
+		err := fmt.Errorf("[ERR] sys: tune of path '%s' failed: no mount entry found", path)
+		b.Backend.Logger().Print(err)
+		return handleError(err)
+	}
+
+	var lock *sync.RWMutex
+	switch {
+	case strings.HasPrefix(path, "auth/"):
+		lock = &b.Core.authLock
+	default:
+		lock = &b.Core.mountsLock
+	}
+	locked := false
+
+	// Timing configuration parameters
+	{
+		var newDefault, newMax *time.Duration
+		defTTL := data.Get("default_lease_ttl").(string)
+		switch defTTL {
+		case "":
+		case "system":
+			tmpDef := time.Duration(0)
+			newDefault = &tmpDef
+		default:
+			tmpDef, err := duration.ParseDurationSecond(defTTL)
+			if err != nil {
+				return handleError(err)
+			}
+			newDefault = &tmpDef
+		}
+
+		maxTTL := data.Get("max_lease_ttl").(string)
+		switch maxTTL {
+		case "":
+		case "system":
+			tmpMax := time.Duration(0)
+			newMax = &tmpMax
+		default:
+			tmpMax, err := duration.ParseDurationSecond(maxTTL)
+			if err != nil {
+				return handleError(err)
+			}
+			newMax = &tmpMax
+		}
+
+		if newDefault != nil || newMax != nil {
+			if !locked {
+				lock.Lock()
+				defer lock.Unlock()
+				locked = true
+			}
+
+			if err := b.tuneMountTTLs(path, &mountEntry.Config, newDefault, newMax); err != nil {
+				b.Backend.Logger().Printf("[ERR] sys: tune of path '%s' failed: %v", path, err)
+				return handleError(err)
+			}
+		}
+	}
+
+	// Request size limit
+	if sizeRaw, ok := data.GetOk("max_request_size"); ok {
+		if !locked {
+			lock.Lock()
+			defer lock.Unlock()
+			locked = true
+		}
+
+		if err := b.tuneMountMaxRequestSize(path, &mountEntry.Config, int64(sizeRaw.(int))); err != nil {
+			b.Backend.Logger().Printf("[ERR] sys: tune of path '%s' failed: %v", path, err)
+			return handleError(err)
+		}
+	}
+
+	// Data keys handled specially by the audit backends
+	auditKeys := []struct {
+		field string
+		keys  *[]string
+	}{
+		{"audit_non_hmac_request_keys", &mountEntry.Config.AuditNonHMACRequestKeys},
+		{"audit_non_hmac_response_keys", &mountEntry.Config.AuditNonHMACResponseKeys},
+		{"audit_elide_response_keys", &mountEntry.Config.AuditElideResponseKeys},
+	}
+	for _, tune := range auditKeys {
+		raw, ok := data.GetOk(tune.field)
+		if !ok {
+			continue
+		}
+		if !locked {
+			lock.Lock()
+			defer lock.Unlock()
+			locked = true
+		}
+
+		if err := b.tuneMountAuditKeys(path, tune.keys, parseAuditKeys(raw.(string))); err != nil {
+			b.Backend.Logger().Printf("[ERR] sys: tune of path '%s' failed: %v", path, err)
+			return handleError(err)
+		}
+	}
+
+	// Only announce tunes that changed something
+	if locked {
+		b.Core.events.Publish(EventMountTuned, map[string]interface{}{
+			"path": path,
+		})
+	}
+
+	return nil, nil
+}
+
+// handleRenew is used to renew a lease with a given LeaseID
+func (b *SystemBackend) handleRenew(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// Get all the options
+	leaseID := data.Get("lease_id").(string)
+	if leaseID == "" {
+		leaseID = data.Get("url_lease_id").(string)
+	}
+	incrementRaw := data.Get("increment").(int)
+
+	// Convert the increment
+	increment := time.Duration(incrementRaw) * time.Second
+
+	// Invoke the expiration manager directly
+	resp, err := b.Core.expiration.Renew(leaseID, increment)
+	if err != nil {
+		b.Backend.Logger().Printf("[ERR] sys: renew '%s' failed: %v", leaseID, err)
+		return handleError(err)
+	}
+	return resp, err
+}
+
+// handleRevoke is used to revoke a given LeaseID
+func (b *SystemBackend) handleRevoke(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// Get all the options
+	leaseID := data.Get("lease_id").(string)
+
+	// Invoke the expiration manager directly
+	if err := b.Core.expiration.Revoke(leaseID); err != nil {
+		b.Backend.Logger().Printf("[ERR] sys: revoke '%s' failed: %v", leaseID, err)
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleRevokePrefix is used to revoke a prefix with many LeaseIDs
+func (b *SystemBackend) handleRevokePrefix(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.handleRevokePrefixCommon(req, data, false)
+}
+
+// handleRevokeForce is used to revoke a prefix with many LeaseIDs, ignoring errors
+func (b *SystemBackend) handleRevokeForce(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.handleRevokePrefixCommon(req, data, true)
+}
+
+// handleRevokePrefixCommon is used to revoke a prefix with many LeaseIDs
+func (b *SystemBackend) handleRevokePrefixCommon(
+	req *logical.Request, data *framework.FieldData, force bool) (*logical.Response, error) {
+	// Get all the options
+	prefix := data.Get("prefix").(string)
+
+	// Invoke the expiration manager directly
+	var err error
+	if force {
+		err = b.Core.expiration.RevokeForce(prefix)
+	} else {
+		err = b.Core.expiration.RevokePrefix(prefix)
+	}
+	if err != nil {
+		b.Backend.Logger().Printf("[ERR] sys: revoke prefix '%s' failed: %v", prefix, err)
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleLeasesTidy removes, or only reports, the leases of missing mounts
+// and revoked tokens
+func (b *SystemBackend) handleLeasesTidy(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	dryRun := data.Get("dry_run").(bool)
+	result, err := b.Core.expiration.Tidy(dryRun)
+	if err != nil {
+		b.Backend.Logger().Printf("[ERR] sys: lease tidy failed: %v", err)
+		return handleError(err)
+	}
+
+	nonNil := func(leaseIDs []string) []string {
+		if leaseIDs == nil {
+			return []string{}
+		}
+		return leaseIDs
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"dry_run":       dryRun,
+			"total_leases":  result.Total,
+			"missing_mount": nonNil(result.MissingMount),
+			"revoked_token": nonNil(result.RevokedToken),
+			"failed":        nonNil(result.Failed),
+		},
+	}, nil
+}
+
+// handleLeasesCount returns the number of active and irrevocable leases
+func (b *SystemBackend) handleLeasesCount(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	active, irrevocable := b.Core.expiration.LeaseCounts()
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"lease_count":             active,
+			"irrevocable_lease_count": irrevocable,
+		},
+	}, nil
+}
+
+// handleLeasesIrrevocable lists the irrevocable leases with the reason
+// their revocation failed
+func (b *SystemBackend) handleLeasesIrrevocable(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	leases, total := b.Core.expiration.IrrevocableLeases()
+
+	list := make([]map[string]interface{}, 0, len(leases))
+	for _, lease := range leases {
+		list = append(list, map[string]interface{}{
+			"lease_id":    lease.LeaseID,
+			"path":        lease.Path,
+			"expire_time": lease.ExpireTime,
+			"error":       lease.Error,
+		})
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"leases":      list,
+			"lease_count": total,
+		},
+	}, nil
+}
+
+// tokenFilterFields returns the fields selecting tokens by their
+// properties
+func tokenFilterFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"policy": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: strings.TrimSpace(sysHelp["tokens_policy"][0]),
+		},
+		"path_prefix": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: strings.TrimSpace(sysHelp["tokens_path_prefix"][0]),
+		},
+		"created_after": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: strings.TrimSpace(sysHelp["tokens_created_after"][0]),
+		},
+		"created_before": &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: strings.TrimSpace(sysHelp["tokens_created_before"][0]),
+		},
+		"min_ttl": &framework.FieldSchema{
+			Type:        framework.TypeDurationSecond,
+			Description: strings.TrimSpace(sysHelp["tokens_min_ttl"][0]),
+		},
+		"max_ttl": &framework.FieldSchema{
+			Type:        framework.TypeDurationSecond,
+			Description: strings.TrimSpace(sysHelp["tokens_max_ttl"][0]),
+		},
+	}
+}
+
+// tokenRevokeFields returns the token filter fields along with dry_run
+func tokenRevokeFields() map[string]*framework.FieldSchema {
+	fields := tokenFilterFields()
+	fields["dry_run"] = &framework.FieldSchema{
+		Type:        framework.TypeBool,
+		Description: strings.TrimSpace(sysHelp["tokens_dry_run"][0]),
+	}
+	return fields
+}
+
+// parseTokenFilter builds a token filter from the request fields
+func parseTokenFilter(data *framework.FieldData) (*TokenFilter, error) {
+	filter := &TokenFilter{
+		Policy:     data.Get("policy").(string),
+		PathPrefix: data.Get("path_prefix").(string),
+		MinTTL:     time.Duration(data.Get("min_ttl").(int)) * time.Second,
+		MaxTTL:     time.Duration(data.Get("max_ttl").(int)) * time.Second,
+	}
+
+	for field, t := range map[string]*time.Time{
+		"created_after":  &filter.CreatedAfter,
+		"created_before": &filter.CreatedBefore,
+	} {
+		raw := data.Get(field).(string)
+		if raw == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s, expected an RFC 3339 time: %v", field, err)
+		}
+		*t = parsed
+	}
+
+	if err := filter.validate(); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// handleTokensAccessors lists the accessors of the tokens matching the
+// filter, with the properties the filter applies to
+func (b *SystemBackend) handleTokensAccessors(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	filter, err := parseTokenFilter(data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	entries, warnings, err := b.Core.tokenStore.FilterTokens(filter)
+	if err != nil {
+		b.Backend.Logger().Printf("[ERR] sys: token filtering failed: %v", err)
+		return handleError(err)
+	}
+
+	list := make([]map[string]interface{}, 0, len(entries))
+	for _, te := range entries {
+		list = append(list, map[string]interface{}{
+			"accessor":      te.Accessor,
+			"path":          te.Path,
+			"policies":      te.Policies,
+			"display_name":  te.DisplayName,
+			"creation_time": te.CreationTime,
+			"creation_ttl":  int64(te.TTL.Seconds()),
+		})
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"tokens":      list,
+			"token_count": len(list),
+		},
+	}
+	for _, warning := range warnings {
+		resp.AddWarning(warning)
+	}
+	return resp, nil
+}
+
+// handleTokensRevoke revokes the tokens matching the filter, along with
+// their child tokens and leases
+func (b *SystemBackend) handleTokensRevoke(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	filter, err := parseTokenFilter(data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	if filter.empty() {
+		return logical.ErrorResponse("at least one filter is required"), logical.ErrInvalidRequest
+	}
+
+	dryRun := data.Get("dry_run").(bool)
+	result, warnings, err := b.Core.tokenStore.RevokeTokens(filter, dryRun)
+	if err != nil {
+		b.Backend.Logger().Printf("[ERR] sys: token revocation failed: %v", err)
+		return handleError(err)
+	}
+	if !dryRun {
+		b.Backend.Logger().Printf("[INFO] sys: revoked %d tokens by filter, %d failed",
+			len(result.Revoked), len(result.Failed))
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"dry_run": dryRun,
+			"revoked": result.Revoked,
+			"failed":  result.Failed,
+			"total":   len(result.Revoked) + len(result.Failed),
+		},
+	}
+	for _, warning := range warnings {
+		resp.AddWarning(warning)
+	}
+	return resp, nil
+}
+
+// entityResponse returns the response describing an entity
+func (b *SystemBackend) entityResponse(entity *Entity) *logical.Response {
+	aliases := make([]map[string]interface{}, 0, len(entity.Aliases))
+	for _, alias := range entity.Aliases {
+		aliases = append(aliases, entityAliasData(alias, entity.ID))
+	}
+	mergedIDs := entity.MergedEntityIDs
+	if mergedIDs == nil {
+		mergedIDs = []string{}
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"id":                entity.ID,
+			"name":              entity.Name,
+			"policies":          entity.Policies,
+			"metadata":          entity.Metadata,
+			"aliases":           aliases,
+			"merged_entity_ids": mergedIDs,
+			"group_ids":         b.Core.identityStore.EntityGroupIDs(entity.ID),
+			"creation_time":     entity.CreationTime,
+			"last_update_time":  entity.LastUpdateTime,
+		},
+	}
+	if entity.NamespaceID != "" {
+		resp.Data["namespace_id"] = entity.NamespaceID
+	}
+	return resp
+}
+
+// entityAliasData returns the data describing an alias of an entity
+func entityAliasData(alias *EntityAlias, entityID string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":               alias.ID,
+		"entity_id":        entityID,
+		"mount_path":       alias.MountPath,
+		"mount_type":       alias.MountType,
+		"name":             alias.Name,
+		"metadata":         alias.Metadata,
+		"creation_time":    alias.CreationTime,
+		"last_update_time": alias.LastUpdateTime,
+	}
+}
+
+// stringMetadata converts a map field to metadata, whose values must be
+// strings
+func stringMetadata(raw map[string]interface{}) (map[string]string, error) {
+	metadata := make(map[string]string, len(raw))
+	for k, v := range raw {
+		vStr, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("metadata must be string valued")
+		}
+		metadata[k] = vStr
+	}
+	return metadata, nil
+}
+
+// entityFields returns the policies and metadata given to create or update
+// an entity, which are nil when not given
+func entityFields(data *framework.FieldData) ([]string, map[string]string, error) {
+	var policies []string
+	if policiesRaw, ok := data.GetOk("policies"); ok {
+		// An empty list clears the policies
+		policies = strutil.ParseDedupAndSortStrings(policiesRaw.(string), ",")
+		if policies == nil {
+			policies = []string{}
+		}
+	}
+
+	var metadata map[string]string
+	if metadataRaw, ok := data.GetOk("metadata"); ok {
+		var err error
+		if metadata, err = stringMetadata(metadataRaw.(map[string]interface{})); err != nil {
+			return nil, nil, err
+		}
+	}
+	return policies, metadata, nil
+}
+
+// handleEntityCreate creates an entity without aliases
+func (b *SystemBackend) handleEntityCreate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	policies, metadata, err := entityFields(data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	entity, err := b.Core.identityStore.CreateEntity(data.Get("name").(string), policies, metadata)
+	if err != nil {
+		return handleError(err)
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"id":   entity.ID,
+			"name": entity.Name,
+		},
+	}, nil
+}
+
+// handleEntityList lists the IDs of the entities
+func (b *SystemBackend) handleEntityList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return logical.ListResponse(b.Core.identityStore.EntityIDs()), nil
+}
+
+// handleEntityRead returns an entity by ID. The ID of an entity merged into
+// another returns the resulting entity.
+func (b *SystemBackend) handleEntityRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	entity := b.Core.identityStore.Entity(data.Get("id").(string))
+	if entity == nil {
+		return nil, nil
+	}
+	return b.entityResponse(entity), nil
+}
+
+// handleEntityReadByName returns an entity by name
+func (b *SystemBackend) handleEntityReadByName(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	entity := b.Core.identityStore.EntityByName(data.Get("name").(string))
+	if entity == nil {
+		return nil, nil
+	}
+	return b.entityResponse(entity), nil
+}
+
+// handleEntityUpdate changes the given settings of an entity
+func (b *SystemBackend) handleEntityUpdate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	policies, metadata, err := entityFields(data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	entity, err := b.Core.identityStore.UpdateEntity(
+		data.Get("id").(string), data.Get("name").(string), policies, metadata)
+	if err != nil {
+		return handleError(err)
+	}
+	return b.entityResponse(entity), nil
+}
+
+// handleEntityDelete removes an entity and its aliases
+func (b *SystemBackend) handleEntityDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if err := b.Core.identityStore.DeleteEntity(data.Get("id").(string)); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleEntityMerge merges entities into another one
+func (b *SystemBackend) handleEntityMerge(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	toID := data.Get("to_entity_id").(string)
+	if toID == "" {
+		return logical.ErrorResponse("missing to_entity_id"), logical.ErrInvalidRequest
+	}
+	fromIDs := strutil.ParseDedupAndSortStrings(data.Get("from_entity_ids").(string), ",")
+	if len(fromIDs) == 0 {
+		return logical.ErrorResponse("missing from_entity_ids"), logical.ErrInvalidRequest
+	}
+
+	entity, err := b.Core.identityStore.MergeEntities(toID, fromIDs)
+	if err != nil {
+		return handleError(err)
+	}
+	b.Backend.Logger().Printf("[INFO] sys: merged entities %s into %s",
+		strings.Join(fromIDs, ", "), toID)
+	return b.entityResponse(entity), nil
+}
+
+// aliasMount returns the full path and the entry of the auth mount given to
+// create an alias, which may omit the "auth/" prefix
+func (b *SystemBackend) aliasMount(path string) (string, *MountEntry, error) {
+	mountPath := strings.TrimPrefix(path, "/")
+	if !strings.HasPrefix(mountPath, credentialRoutePrefix) {
+		mountPath = credentialRoutePrefix + mountPath
+	}
+	if !strings.HasSuffix(mountPath, "/") {
+		mountPath += "/"
+	}
+	mount := b.Core.router.MatchingMountEntry(mountPath)
+	if mount == nil || b.Core.router.MatchingMount(mountPath) != mountPath {
+		return "", nil, fmt.Errorf("no auth mount at %q", mountPath)
+	}
+	return mountPath, mount, nil
+}
+
+// handleEntityAliasCreate ties the principal with the given name in an auth
+// mount to an existing entity
+func (b *SystemBackend) handleEntityAliasCreate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	entityID := data.Get("entity_id").(string)
+	if entityID == "" {
+		return logical.ErrorResponse("missing entity_id"), logical.ErrInvalidRequest
+	}
+
+	mountPath, mount, err := b.aliasMount(data.Get("mount_path").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	metadata, err := stringMetadata(data.Get("metadata").(map[string]interface{}))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	alias, err := b.Core.identityStore.CreateAlias(
+		entityID, mountPath, mount.Type, data.Get("name").(string), metadata)
+	if err != nil {
+		return handleError(err)
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"id":        alias.ID,
+			"entity_id": entityID,
+		},
+	}, nil
+}
+
+// handleEntityAliasRead returns an alias of an entity
+func (b *SystemBackend) handleEntityAliasRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	alias, entityID := b.Core.identityStore.Alias(data.Get("id").(string))
+	if alias == nil {
+		return nil, nil
+	}
+	return &logical.Response{
+		Data: entityAliasData(alias, entityID),
+	}, nil
+}
+
+// handleEntityAliasDelete removes an alias from its entity
+func (b *SystemBackend) handleEntityAliasDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if err := b.Core.identityStore.DeleteAlias(data.Get("id").(string)); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// groupResponse returns the response describing a group
+func groupResponse(group *Group) *logical.Response {
+	var alias map[string]interface{}
+	if group.Alias != nil {
+		alias = groupAliasData(group.Alias, group.ID)
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"id":                group.ID,
+			"name":              group.Name,
+			"type":              group.Type,
+			"policies":          group.Policies,
+			"metadata":          group.Metadata,
+			"member_entity_ids": group.MemberEntityIDs,
+			"alias":             alias,
+			"creation_time":     group.CreationTime,
+			"last_update_time":  group.LastUpdateTime,
+		},
+	}
+}
+
+// groupAliasData returns the data describing the alias of a group
+func groupAliasData(alias *GroupAlias, groupID string) map[string]interface{} {
+	return map[string]interface{}{
+		"id":            alias.ID,
+		"group_id":      groupID,
+		"mount_path":    alias.MountPath,
+		"mount_type":    alias.MountType,
+		"name":          alias.Name,
+		"creation_time": alias.CreationTime,
+	}
+}
+
+// groupMembers returns the member entity IDs given to create or update a
+// group, which are nil when not given
+func groupMembers(data *framework.FieldData) []string {
+	membersRaw, ok := data.GetOk("member_entity_ids")
+	if !ok {
+		return nil
+	}
+	// An empty list clears the members
+	members := strutil.ParseDedupAndSortStrings(membersRaw.(string), ",")
+	if members == nil {
+		members = []string{}
+	}
+	return members
+}
+
+// handleGroupCreate creates an internal or external group
+func (b *SystemBackend) handleGroupCreate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	policies, metadata, err := entityFields(data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	group, err := b.Core.identityStore.CreateGroup(data.Get("name").(string),
+		data.Get("type").(string), policies, metadata, groupMembers(data))
+	if err != nil {
+		return handleError(err)
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"id":   group.ID,
+			"name": group.Name,
+		},
+	}, nil
+}
+
+// handleGroupList lists the IDs of the groups
+func (b *SystemBackend) handleGroupList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return logical.ListResponse(b.Core.identityStore.GroupIDs()), nil
+}
+
+// handleGroupRead returns a group by ID
+func (b *SystemBackend) handleGroupRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	group := b.Core.identityStore.Group(data.Get("id").(string))
+	if group == nil {
+		return nil, nil
+	}
+	return groupResponse(group), nil
+}
+
+// handleGroupReadByName returns a group by name
+func (b *SystemBackend) handleGroupReadByName(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	group := b.Core.identityStore.GroupByName(data.Get("name").(string))
+	if group == nil {
+		return nil, nil
+	}
+	return groupResponse(group), nil
+}
+
+// handleGroupUpdate changes the given settings of a group
+func (b *SystemBackend) handleGroupUpdate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	policies, metadata, err := entityFields(data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	group, err := b.Core.identityStore.UpdateGroup(data.Get("id").(string),
+		data.Get("name").(string), policies, metadata, groupMembers(data))
+	if err != nil {
+		return handleError(err)
+	}
+	return groupResponse(group), nil
+}
+
+// handleGroupDelete removes a group and its alias
+func (b *SystemBackend) handleGroupDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if err := b.Core.identityStore.DeleteGroup(data.Get("id").(string)); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleGroupAliasCreate maps an external group to the group with the given
+// name in an auth mount
+func (b *SystemBackend) handleGroupAliasCreate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	groupID := data.Get("group_id").(string)
+	if groupID == "" {
+		return logical.ErrorResponse("missing group_id"), logical.ErrInvalidRequest
+	}
+
+	mountPath, mount, err := b.aliasMount(data.Get("mount_path").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	alias, err := b.Core.identityStore.CreateGroupAlias(
+		groupID, mountPath, mount.Type, data.Get("name").(string))
+	if err != nil {
+		return handleError(err)
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"id":       alias.ID,
+			"group_id": groupID,
+		},
+	}, nil
+}
+
+// handleGroupAliasRead returns the alias of a group
+func (b *SystemBackend) handleGroupAliasRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	alias, groupID := b.Core.identityStore.GroupAlias(data.Get("id").(string))
+	if alias == nil {
+		return nil, nil
+	}
+	return &logical.Response{
+		Data: groupAliasData(alias, groupID),
+	}, nil
+}
+
+// handleGroupAliasDelete removes the alias of a group
+func (b *SystemBackend) handleGroupAliasDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if err := b.Core.identityStore.DeleteGroupAlias(data.Get("id").(string)); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleControlGroupAuthorize records the approval of a control group
+// request by the entity of the token
+func (b *SystemBackend) handleControlGroupAuthorize(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	accessor := data.Get("accessor").(string)
+	if accessor == "" {
+		return logical.ErrorResponse("missing accessor"), logical.ErrInvalidRequest
+	}
+
+	cgReq, err := b.Core.AuthorizeControlGroupRequest(accessor, req.EntityID)
+	switch {
+	case err == logical.ErrPermissionDenied:
+		return nil, err
+	case err != nil:
+		return handleError(err)
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"approved": cgReq.approved(),
+		},
+	}, nil
+}
+
+// handleControlGroupRequestRead returns the status of a control group
+// request
+func (b *SystemBackend) handleControlGroupRequestRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	accessor := data.Get("accessor").(string)
+	if accessor == "" {
+		return logical.ErrorResponse("missing accessor"), logical.ErrInvalidRequest
+	}
+
+	cgReq, err := b.Core.ControlGroupRequest(accessor)
+	if err != nil {
+		return nil, err
+	}
+	if cgReq == nil {
+		return logical.ErrorResponse("control group request not found"), logical.ErrInvalidRequest
+	}
+
+	authorizations := make([]map[string]interface{}, 0, len(cgReq.Authorizations))
+	for _, authz := range cgReq.Authorizations {
+		var entityName string
+		if entity := b.Core.identityStore.Entity(authz.EntityID); entity != nil {
+			entityName = entity.Name
+		}
+		authorizations = append(authorizations, map[string]interface{}{
+			"entity_id":   authz.EntityID,
+			"entity_name": entityName,
+			"time":        authz.Time,
+		})
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"approved":           cgReq.approved(),
+			"request_path":       cgReq.Path,
+			"request_operation":  string(cgReq.Operation),
+			"request_entity_id":  cgReq.EntityID,
+			"group_names":        cgReq.ControlGroup.GroupNames,
+			"approvals_required": cgReq.ControlGroup.Approvals,
+			"authorizations":     authorizations,
+			"creation_time":      cgReq.CreationTime,
+			"expire_time":        cgReq.ExpireTime,
+		},
+	}, nil
+}
+
+// handleAuthTable handles the "auth" endpoint to provide the auth table
+func (b *SystemBackend) handleAuthTable(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.Core.authLock.RLock()
+	defer b.Core.authLock.RUnlock()
+
+	resp := &logical.Response{
+		Data: make(map[string]interface{}),
+	}
+	for _, entry := range b.Core.auth.Entries {
+		// Only the auth mounts of the namespace of the backend are listed
+		if b.Core.mountNamespace(entry) != b.namespace {
+			continue
+		}
+
+		info := map[string]interface{}{
+			"type":        entry.Type,
+			"description": entry.Description,
+			"config": map[string]interface{}{
+				"default_lease_ttl": int64(entry.Config.DefaultLeaseTTL.Seconds()),
+				"max_lease_ttl":     int64(entry.Config.MaxLeaseTTL.Seconds()),
+			},
+		}
+		resp.Data[strings.TrimPrefix(entry.Path, namespacePath(b.namespace))] = info
+	}
+	return resp, nil
+}
+
+// handleEnableAuth is used to enable a new credential backend
+func (b *SystemBackend) handleEnableAuth(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// Get all the options
+	path := data.Get("path").(string)
+	logicalType := data.Get("type").(string)
+	description := data.Get("description").(string)
+
+	if logicalType == "" {
+		return logical.ErrorResponse(
+				"backend type must be specified as a string"),
+			logical.ErrInvalidRequest
+	}
+
+	path, err := b.Core.namespaceMountPath(b.namespace, sanitizeMountPath(path))
+	if err != nil {
+		return handleError(err)
+	}
+
+	// Create the mount entry
+	me := &MountEntry{
+		Table:       credentialTableType,
+		Path:        path,
+		Type:        logicalType,
+		Description: description,
+	}
+
+	// Attempt enabling
+	if err := b.Core.enableCredential(me); err != nil {
+		b.Backend.Logger().Printf("[ERR] sys: enable auth %s failed: %v", me.Path, err)
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleDisableAuth is used to disable a credential backend
+func (b *SystemBackend) handleDisableAuth(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	suffix := strings.TrimPrefix(req.Path, "auth/")
+	if len(suffix) == 0 {
+		return logical.ErrorResponse("path cannot be blank"), logical.ErrInvalidRequest
+	}
+
+	suffix, err := b.Core.namespaceMountPath(b.namespace, sanitizeMountPath(suffix))
+	if err != nil {
+		return handleError(err)
+	}
+
+	// Attempt disable
+	if err := b.Core.disableCredential(suffix); err != nil {
+		b.Backend.Logger().Printf("[ERR] sys: disable auth '%s' failed: %v", suffix, err)
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handlePolicyList handles the "policy" endpoint to provide the enabled policies
+func (b *SystemBackend) handlePolicyList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// Get all the configured policies
+	policies, err := b.policyStore().ListPolicies()
+
+	// Add the special "root" policy, which namespaces do not have
+	if b.namespace == nil {
+		policies = append(policies, "root")
+	}
+	resp := logical.ListResponse(policies)
+
+	// Backwords compatibility
+	resp.Data["policies"] = resp.Data["keys"]
+
+	return resp, err
+}
+
+// handlePolicyRead handles the "policy/<name>" endpoint to read a policy
+func (b *SystemBackend) handlePolicyRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	policy, err := b.policyStore().GetPolicy(name)
+	if err != nil {
+		return handleError(err)
+	}
+
+	if policy == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":  name,
+			"rules": policy.Raw,
+		},
+	}, nil
+}
+
+// handlePolicySet handles the "policy/<name>" endpoint to set a policy
+func (b *SystemBackend) handlePolicySet(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	rules := data.Get("rules").(string)
+
+	// Validate the rules parse
+	parse, err := Parse(rules)
+	if err != nil {
+		return handleError(err)
+	}
+
+	// Override the name
+	parse.Name = strings.ToLower(name)
+
+	// Update the policy
+	if err := b.policyStore().SetPolicy(parse); err != nil {
+		return handleError(err)
+	}
+	b.Core.events.Publish(EventPolicyUpdated, map[string]interface{}{
+		"name": parse.Name,
+	})
+	return nil, nil
+}
+
+// handlePolicyDelete handles the "policy/<name>" endpoint to delete a policy
+func (b *SystemBackend) handlePolicyDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+
+	if err := b.policyStore().DeletePolicy(name); err != nil {
+		return handleError(err)
+	}
+	b.Core.events.Publish(EventPolicyDeleted, map[string]interface{}{
+		"name": name,
+	})
+	return nil, nil
+}
+
+// handleAuditTable handles the "audit" endpoint to provide the audit table
+func (b *SystemBackend) handleAuditTable(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	b.Core.auditLock.RLock()
+	defer b.Core.auditLock.RUnlock()
+
+	resp := &logical.Response{
+		Data: make(map[string]interface{}),
+	}
+	for _, entry := range b.Core.audit.Entries {
+		info := map[string]interface{}{
+			"path":        entry.Path,
+			"type":        entry.Type,
+			"description": entry.Description,
+			"options":     entry.Options,
+		}
+		resp.Data[entry.Path] = info
+	}
+	return resp, nil
+}
+
+// handleAuditHash is used to fetch the hash of the given input data with the
+// specified audit backend's salt
+func (b *SystemBackend) handleAuditHash(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	path := data.Get("path").(string)
+	input := data.Get("input").(string)
+
+	// The inputs are a list, which the field schema has no type for
+	var inputs []string
+	if raw, ok := data.Raw["inputs"]; ok {
+		if err := mapstructure.Decode(raw, &inputs); err != nil {
+			return logical.ErrorResponse("the \"inputs\" parameter must be a list of strings"), nil
+		}
+		if len(inputs) == 0 {
+			return logical.ErrorResponse("the \"inputs\" parameter is empty"), nil
+		}
+		if input != "" {
+			return logical.ErrorResponse("only one of the \"input\" and \"inputs\" parameters can be given"), nil
+		}
+	} else if input == "" {
+		return logical.ErrorResponse("the \"input\" parameter is empty"), nil
+	}
+
+	version := data.Get("version").(int)
+	if version < 0 {
+		return logical.ErrorResponse("the \"version\" parameter cannot be negative"), nil
+	}
+
+	path = sanitizeMountPath(path)
+
+	if inputs == nil {
+		hash, err := b.Core.auditBroker.GetHashVersion(path, input, version)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"hash": hash,
+			},
+		}, nil
+	}
+
+	hashes := make([]string, len(inputs))
+	for i, input := range inputs {
+		hash, err := b.Core.auditBroker.GetHashVersion(path, input, version)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), nil
+		}
+		hashes[i] = hash
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"hashes": hashes,
+		},
+	}, nil
+}
+
+// handleAuditHashVerify is used to check whether a hash logged by the
+// specified audit backend is the hash of the given input
+func (b *SystemBackend) handleAuditHashVerify(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	path := data.Get("path").(string)
+	input := data.Get("input").(string)
+	if input == "" {
+		return logical.ErrorResponse("the \"input\" parameter is empty"), nil
+	}
+	hash := data.Get("hash").(string)
+	if hash == "" {
+		return logical.ErrorResponse("the \"hash\" parameter is empty"), nil
+	}
+
+	path = sanitizeMountPath(path)
+
+	valid, version, err := b.Core.auditBroker.VerifyHash(path, input, hash)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"valid":   valid,
+			"version": version,
+		},
+	}, nil
+}
+
+// handleAuditSchemaList is used to list the versions of the audit entry
+// format
+func (b *SystemBackend) handleAuditSchemaList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"current_version": audit.SchemaVersion,
+			"versions":        audit.SchemaVersions(),
+		},
+	}, nil
+}
+
+// handleAuditSchemaRead is used to return the JSON Schema of a version of
+// the audit entry format
+func (b *SystemBackend) handleAuditSchemaRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	version := data.Get("version").(int)
+	schema, err := audit.Schema(version)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"version": version,
+			"schema":  schema,
+		},
+	}, nil
+}
+
+// handleAuditRotateSalt is used to rotate the salt of the specified audit
+// backend
+func (b *SystemBackend) handleAuditRotateSalt(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	path := sanitizeMountPath(data.Get("path").(string))
+
+	version, err := b.Core.auditBroker.RotateSalt(path)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+	b.Backend.Logger().Printf("[INFO] sys: rotated salt of audit backend '%s' to version %d", path, version)
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"version": version,
+		},
+	}, nil
+}
+
+// handleEnableAudit is used to enable a new audit backend
+func (b *SystemBackend) handleEnableAudit(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// Get all the options
+	path := data.Get("path").(string)
+	backendType := data.Get("type").(string)
+	description := data.Get("description").(string)
+	options := data.Get("options").(map[string]interface{})
+
+	optionMap := make(map[string]string)
+	for k, v := range options {
+		vStr, ok := v.(string)
+		if !ok {
+			return logical.ErrorResponse("options must be string valued"),
+				logical.ErrInvalidRequest
+		}
+		optionMap[k] = vStr
+	}
+
+	// Create the mount entry
+	me := &MountEntry{
+		Table:       auditTableType,
+		Path:        path,
+		Type:        backendType,
+		Description: description,
+		Options:     optionMap,
+	}
+
+	// Attempt enabling
+	if err := b.Core.enableAudit(me); err != nil {
+		b.Backend.Logger().Printf("[ERR] sys: enable audit %s failed: %v", me.Path, err)
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleDisableAudit is used to disable an audit backend
+func (b *SystemBackend) handleDisableAudit(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	path := data.Get("path").(string)
+
+	// Attempt disable
+	if err := b.Core.disableAudit(path); err != nil {
+		b.Backend.Logger().Printf("[ERR] sys: disable audit '%s' failed: %v", path, err)
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// rawPaths returns the endpoints giving direct access to the storage
+// through the barrier
+func (b *SystemBackend) rawPaths() []*framework.Path {
+	return []*framework.Path{
+		&framework.Path{
+			Pattern: "raw(/(?P<path>.*))?",
+
+			Fields: map[string]*framework.FieldSchema{
+				"path": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: strings.TrimSpace(sysHelp["raw-path"][0]),
+				},
+				"value": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: "The value to write.",
+				},
+				"compressed": &framework.FieldSchema{
+					Type:        framework.TypeBool,
+					Description: "Compress the value before writing it, as Vault does for the mount tables.",
+				},
+				"encoding": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: `The encoding of the value written: empty for a string, or "base64" for binary data.`,
+				},
+			},
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ReadOperation:   b.handleRawRead,
+				logical.UpdateOperation: b.handleRawWrite,
+				logical.DeleteOperation: b.handleRawDelete,
+				logical.ListOperation:   b.handleRawList,
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["raw"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["raw"][1]),
+		},
+
+		&framework.Path{
+			Pattern: "raw-prefix(/(?P<prefix>.*))?",
+
+			Fields: map[string]*framework.FieldSchema{
+				"prefix": &framework.FieldSchema{
+					Type:        framework.TypeString,
+					Description: strings.TrimSpace(sysHelp["raw-prefix-path"][0]),
+				},
+			},
+
+			Callbacks: map[logical.Operation]framework.OperationFunc{
+				logical.ListOperation:   b.handleRawPrefixList,
+				logical.DeleteOperation: b.handleRawPrefixDelete,
+			},
+
+			HelpSynopsis:    strings.TrimSpace(sysHelp["raw-prefix"][0]),
+			HelpDescription: strings.TrimSpace(sysHelp["raw-prefix"][1]),
+		},
+	}
+}
+
+// rawProtected returns whether the path cannot be accessed through the raw
+// endpoints
+func rawProtected(path string) bool {
+	for _, p := range protectedPaths {
+		if strings.HasPrefix(path, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleRawRead is used to read directly from the barrier. Values stored
+// compressed are decompressed.
+func (b *SystemBackend) handleRawRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	path := data.Get("path").(string)
+	if path == "" {
+		return logical.ErrorResponse("missing path"), logical.ErrInvalidRequest
+	}
+
+	// Prevent access of protected paths
+	if rawProtected(path) {
+		err := fmt.Sprintf("cannot read '%s'", path)
+		return logical.ErrorResponse(err), logical.ErrInvalidRequest
+	}
+
+	entry, err := b.Core.barrier.Get(path)
+	if err != nil {
+		return handleError(err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	value := entry.Value
+	compressed := false
+	if len(value) > 0 {
+		decompressed, notCompressed, err := compressutil.Decompress(value)
+		if err != nil {
+			return handleError(err)
+		}
+		if !notCompressed {
+			value = decompressed
+			compressed = true
+		}
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"value":      string(value),
+			"compressed": compressed,
+		},
+	}
+	return resp, nil
+}
+
+// handleRawWrite is used to write directly to the barrier
+func (b *SystemBackend) handleRawWrite(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	path := data.Get("path").(string)
+	if path == "" {
+		return logical.ErrorResponse("missing path"), logical.ErrInvalidRequest
+	}
+
+	// Prevent access of protected paths
+	if rawProtected(path) {
+		err := fmt.Sprintf("cannot write '%s'", path)
+		return logical.ErrorResponse(err), logical.ErrInvalidRequest
+	}
+
+	value := []byte(data.Get("value").(string))
+	switch encoding := data.Get("encoding").(string); encoding {
+	case "":
+	case "base64":
+		decoded, err := base64.StdEncoding.DecodeString(string(value))
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("invalid base64 value: %v", err)), logical.ErrInvalidRequest
+		}
+		value = decoded
+	default:
+		return logical.ErrorResponse(fmt.Sprintf("unsupported encoding %q", encoding)), logical.ErrInvalidRequest
+	}
+
+	if data.Get("compressed").(bool) {
+		compressed, err := compressutil.Compress(value, &compressutil.CompressionConfig{
+			Type:                 compressutil.CompressionTypeGzip,
+			GzipCompressionLevel: gzip.BestCompression,
+		})
+		if err != nil {
+			return handleError(err)
+		}
+		value = compressed
+	}
+
+	entry := &Entry{
+		Key:   path,
+		Value: value,
+	}
+	if err := b.Core.barrier.Put(entry); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	return nil, nil
+}
+
+// handleRawDelete is used to delete directly from the barrier
+func (b *SystemBackend) handleRawDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	path := data.Get("path").(string)
+	if path == "" {
+		return logical.ErrorResponse("missing path"), logical.ErrInvalidRequest
+	}
+
+	// Prevent access of protected paths
+	if rawProtected(path) {
+		err := fmt.Sprintf("cannot delete '%s'", path)
+		return logical.ErrorResponse(err), logical.ErrInvalidRequest
+	}
+
+	if err := b.Core.barrier.Delete(path); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleRawList is used to list the keys under a prefix of the barrier,
+// one level deep
+func (b *SystemBackend) handleRawList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	path := data.Get("path").(string)
+	if path != "" && !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+
+	// Prevent access of protected paths
+	if rawProtected(path) {
+		err := fmt.Sprintf("cannot list '%s'", path)
+		return logical.ErrorResponse(err), logical.ErrInvalidRequest
+	}
+
+	keys, err := b.Core.barrier.List(path)
+	if err != nil {
+		return handleError(err)
+	}
+
+	// The keys of protected paths are left out when listing from the root
+	var visible []string
+	for _, key := range keys {
+		if !rawProtected(path + key) {
+			visible = append(visible, key)
+		}
+	}
+	return logical.ListResponse(visible), nil
+}
+
+// handleRawPrefixList is used to list all the keys under a prefix of the
+// barrier, recursively
+func (b *SystemBackend) handleRawPrefixList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	prefix := data.Get("prefix").(string)
+
+	// Prevent access of protected paths
+	if rawProtected(prefix) {
+		err := fmt.Sprintf("cannot list '%s'", prefix)
+		return logical.ErrorResponse(err), logical.ErrInvalidRequest
+	}
+
+	keys, err := CollectKeys(NewBarrierView(b.Core.barrier, prefix))
+	if err != nil {
+		return handleError(err)
+	}
+	var visible []string
+	for _, key := range keys {
+		if !rawProtected(prefix + key) {
+			visible = append(visible, key)
+		}
+	}
+	return logical.ListResponse(visible), nil
+}
+
+// handleRawPrefixDelete is used to delete all the keys under a prefix of the
+// barrier
+func (b *SystemBackend) handleRawPrefixDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	prefix := data.Get("prefix").(string)
+	if prefix == "" {
+		return logical.ErrorResponse("missing prefix"), logical.ErrInvalidRequest
+	}
+
+	// Prevent access of protected paths, including the prefixes holding
+	// them
+	for _, p := range protectedPaths {
+		if strings.HasPrefix(prefix, p) || strings.HasPrefix(p, prefix) {
+			err := fmt.Sprintf("cannot delete '%s'", prefix)
+			return logical.ErrorResponse(err), logical.ErrInvalidRequest
+		}
+	}
+
+	view := NewBarrierView(b.Core.barrier, prefix)
+	keys, err := CollectKeys(view)
+	if err != nil {
+		return handleError(err)
+	}
+	for _, key := range keys {
+		if err := view.Delete(key); err != nil {
+			return handleError(err)
+		}
+	}
+	b.Backend.Logger().Printf("[WARN] sys: deleted %d raw storage keys under %q", len(keys), prefix)
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"deleted": len(keys),
+		},
+	}, nil
+}
+
+// handleKeyStatus returns status information about the backend key
+func (b *SystemBackend) handleKeyStatus(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// Get the key info
+	info, err := b.Core.barrier.ActiveKeyInfo()
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"term":         info.Term,
+			"install_time": info.InstallTime.Format(time.RFC3339Nano),
+			"encryptions":  b.Core.KeyUsage()[uint32(info.Term)],
+			"cipher":       info.Cipher,
+		},
+	}
+	return resp, nil
+}
+
+// handleRotationConfigRead returns the automatic key rotation policy
+func (b *SystemBackend) handleRotationConfigRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config := b.Core.KeyRotationConfig()
+	if config == nil {
+		config = &KeyRotationConfig{}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"enabled":        config.Enabled,
+			"max_operations": config.MaxOperations,
+			"interval":       int64(config.Interval.Seconds()),
+		},
+	}, nil
+}
+
+// handleRotationConfigUpdate changes the given settings of the automatic
+// key rotation policy
+func (b *SystemBackend) handleRotationConfigUpdate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config := &KeyRotationConfig{}
+	if current := b.Core.KeyRotationConfig(); current != nil {
+		*config = *current
+	}
+
+	if enabledRaw, ok := data.GetOk("enabled"); ok {
+		config.Enabled = enabledRaw.(bool)
+	}
+	if maxOpsRaw, ok := data.GetOk("max_operations"); ok {
+		maxOps := maxOpsRaw.(int)
+		if maxOps < 0 {
+			return logical.ErrorResponse("max_operations cannot be negative"), logical.ErrInvalidRequest
+		}
+		config.MaxOperations = uint64(maxOps)
+	}
+	if intervalRaw, ok := data.GetOk("interval"); ok {
+		interval := intervalRaw.(int)
+		if interval < 0 {
+			return logical.ErrorResponse("interval cannot be negative"), logical.ErrInvalidRequest
+		}
+		config.Interval = time.Duration(interval) * time.Second
+	}
+	if err := config.validate(); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	if err := b.Core.setKeyRotationConfig(config); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// handleRotate is used to trigger a key rotation
+func (b *SystemBackend) handleRotate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// Rotate to the new term
+	if _, err := b.Core.rotateBarrierKey(); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleCORSRead returns the CORS configuration
+func (b *SystemBackend) handleCORSRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config := b.Core.CORSConfig()
+	if config == nil {
+		config = &CORSConfig{}
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"enabled": config.Enabled,
+		},
+	}
+	if config.Enabled {
+		resp.Data["allowed_origins"] = config.AllowedOrigins
+		resp.Data["allowed_headers"] = config.AllAllowedHeaders()
+	}
+	return resp, nil
+}
+
+// handleCORSUpdate replaces the CORS configuration
+func (b *SystemBackend) handleCORSUpdate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config := &CORSConfig{
+		Enabled: data.Get("enabled").(bool),
+	}
+	if config.Enabled {
+		config.AllowedOrigins = strutil.ParseDedupAndSortStrings(data.Get("allowed_origins").(string), ",")
+		for _, header := range strutil.ParseDedupAndSortStrings(data.Get("allowed_headers").(string), ",") {
+			config.AllowedHeaders = append(config.AllowedHeaders, http.CanonicalHeaderKey(header))
+		}
+	}
+	if err := config.validate(); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	if err := b.Core.setCORSConfig(config); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// handleCORSDelete disables CORS
+func (b *SystemBackend) handleCORSDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if err := b.Core.setCORSConfig(&CORSConfig{}); err != nil {
+		return nil, err
+	}
+	return nil, nil
+}
+
+// handleEvents only authorizes subscribing to events; the stream itself is
+// served by the HTTP layer
+func (b *SystemBackend) handleEvents(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return nil, nil
+}
+
+// handleMetrics returns the telemetry of this node in the Prometheus text
+// exposition format
+func (b *SystemBackend) handleMetrics(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	sink := b.Core.prometheusSink
+	if sink == nil {
+		return logical.ErrorResponse("metrics are not enabled"), logical.ErrInvalidRequest
+	}
+
+	var buf bytes.Buffer
+	if _, err := sink.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+
+	return &logical.Response{
+		Stream: &logical.ResponseStream{
+			ContentType: metricsutil.PrometheusContentType,
+			Body:        ioutil.NopCloser(&buf),
+		},
+	}, nil
+}
+
+// handleHSMStatus reports whether the HSM of a PKCS#11 seal is reachable
+// and holds the configured key
+func (b *SystemBackend) handleHSMStatus(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	status, err := b.Core.HSMStatus()
+	if err != nil {
+		return logical.ErrorResponse("seal is not backed by an HSM"), logical.ErrInvalidRequest
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"connected":     status.Connected,
+			"lib":           status.Lib,
+			"slot":          status.Slot,
+			"token_label":   status.TokenLabel,
+			"manufacturer":  status.Manufacturer,
+			"model":         status.Model,
+			"serial_number": status.SerialNumber,
+			"key_label":     status.KeyLabel,
+			"key_found":     status.KeyFound,
+			"error":         status.Error,
+		},
+	}, nil
+}
+
+// logRouter returns the router of the server's log output, or an error
+// response if the log output cannot be reconfigured
+func (b *SystemBackend) logRouter() (*logutil.Router, *logical.Response, error) {
+	router := b.Core.logRouter
+	if router == nil {
+		return nil, logical.ErrorResponse("log reconfiguration is not enabled"), logical.ErrInvalidRequest
+	}
+	return router, nil, nil
+}
+
+// handleLoggersRead returns the default log level and the levels of the
+// subsystems
+func (b *SystemBackend) handleLoggersRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	router, resp, err := b.logRouter()
+	if router == nil {
+		return resp, err
+	}
+
+	subsystems := make(map[string]interface{}, len(logutil.Subsystems))
+	for name, level := range router.SubsystemLevels() {
+		subsystems[name] = level
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"level":      router.Level(),
+			"subsystems": subsystems,
+			"sinks":      router.SinkNames(),
+		},
+	}, nil
+}
+
+// handleLoggersUpdate sets the default log level
+func (b *SystemBackend) handleLoggersUpdate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	router, resp, err := b.logRouter()
+	if router == nil {
+		return resp, err
+	}
+
+	level := data.Get("level").(string)
+	if err := router.SetLevel(level); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	b.Backend.Logger().Printf("[INFO] sys: log level set to %s", level)
+	return nil, nil
+}
+
+// handleLoggerRead returns the log level of a subsystem
+func (b *SystemBackend) handleLoggerRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	router, resp, err := b.logRouter()
+	if router == nil {
+		return resp, err
+	}
+
+	subsystem := data.Get("subsystem").(string)
+	level, ok := router.SubsystemLevels()[subsystem]
+	if !ok {
+		level = router.Level()
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"level":   level,
+			"default": !ok,
+		},
+	}, nil
+}
+
+// handleLoggerUpdate sets the log level of a subsystem
+func (b *SystemBackend) handleLoggerUpdate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	router, resp, err := b.logRouter()
+	if router == nil {
+		return resp, err
+	}
+
+	subsystem := data.Get("subsystem").(string)
+	level := data.Get("level").(string)
+	if level == "" {
+		return logical.ErrorResponse("missing level"), logical.ErrInvalidRequest
+	}
+	if err := router.SetSubsystemLevel(subsystem, level); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	b.Backend.Logger().Printf("[INFO] sys: log level of %s set to %s", subsystem, level)
+	return nil, nil
+}
+
+// handleLoggerDelete reverts a subsystem to the default log level
+func (b *SystemBackend) handleLoggerDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	router, resp, err := b.logRouter()
+	if router == nil {
+		return resp, err
+	}
+
+	subsystem := data.Get("subsystem").(string)
+	if err := router.SetSubsystemLevel(subsystem, ""); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	return nil, nil
+}
+
+// handleLogSinksList lists the names of the log sinks
+func (b *SystemBackend) handleLogSinksList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	router, resp, err := b.logRouter()
+	if router == nil {
+		return resp, err
+	}
+
+	return logical.ListResponse(router.SinkNames()), nil
+}
+
+// handleLogSinkRead returns the configuration of a log sink
+func (b *SystemBackend) handleLogSinkRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	router, resp, err := b.logRouter()
+	if router == nil {
+		return resp, err
+	}
+
+	config, ok := router.Sinks()[data.Get("name").(string)]
+	if !ok {
+		return nil, nil
+	}
+
+	options := make(map[string]interface{}, len(config.Options))
+	for k, v := range config.Options {
+		options[k] = v
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"type":    config.Type,
+			"level":   config.Level,
+			"options": options,
+		},
+	}, nil
+}
+
+// handleLogSinkUpdate creates or replaces a log sink
+func (b *SystemBackend) handleLogSinkUpdate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	router, resp, err := b.logRouter()
+	if router == nil {
+		return resp, err
+	}
+
+	name := data.Get("name").(string)
+	options := data.Get("options").(map[string]interface{})
+
+	optionMap := make(map[string]string)
+	for k, v := range options {
+		vStr, ok := v.(string)
+		if !ok {
+			return logical.ErrorResponse("options must be string valued"),
+				logical.ErrInvalidRequest
+		}
+		optionMap[k] = vStr
+	}
+
+	config := &logutil.SinkConfig{
+		Type:    data.Get("type").(string),
+		Level:   data.Get("level").(string),
+		Options: optionMap,
+	}
+	if err := router.AddSink(name, config); err != nil {
+		b.Backend.Logger().Printf("[ERR] sys: adding log sink %s failed: %v", name, err)
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+
+	b.Backend.Logger().Printf("[INFO] sys: added %s log sink %s", config.Type, name)
+	return nil, nil
+}
+
+// handleLogSinkDelete removes a log sink
+func (b *SystemBackend) handleLogSinkDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	router, resp, err := b.logRouter()
+	if router == nil {
+		return resp, err
+	}
+
+	name := data.Get("name").(string)
+	if err := router.RemoveSink(name); err != nil {
+		b.Backend.Logger().Printf("[ERR] sys: closing log sink %s failed: %v", name, err)
+	}
+	return nil, nil
+}
+
+// handleLeaseCountQuotaList lists the names of the lease count quotas
+func (b *SystemBackend) handleLeaseCountQuotaList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return logical.ListResponse(b.Core.LeaseCountQuotaNames()), nil
+}
+
+// handleLeaseCountQuotaRead returns a lease count quota and the number of
+// active leases it counts
+func (b *SystemBackend) handleLeaseCountQuotaRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	quota := b.Core.LeaseCountQuota(name)
+	if quota == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":          quota.Name,
+			"path":          quota.Path,
+			"role":          quota.Role,
+			"max_leases":    quota.MaxLeases,
+			"active_leases": b.Core.LeaseCountQuotaUsage(name),
+		},
+	}, nil
+}
+
+// handleLeaseCountQuotaUpdate creates a lease count quota or changes the
+// given settings of an existing one
+func (b *SystemBackend) handleLeaseCountQuotaUpdate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	quota := &LeaseCountQuota{Name: name}
+	if current := b.Core.LeaseCountQuota(name); current != nil {
+		*quota = *current
+	}
+
+	if pathRaw, ok := data.GetOk("path"); ok {
+		quota.Path = strings.TrimPrefix(pathRaw.(string), "/")
+		if quota.Path != "" && !strings.HasSuffix(quota.Path, "/") {
+			quota.Path += "/"
+		}
+	}
+	if roleRaw, ok := data.GetOk("role"); ok {
+		quota.Role = roleRaw.(string)
+	}
+	if maxLeasesRaw, ok := data.GetOk("max_leases"); ok {
+		quota.MaxLeases = maxLeasesRaw.(int)
+	}
+
+	if err := b.Core.setLeaseCountQuota(quota); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	return nil, nil
+}
+
+// handleLeaseCountQuotaDelete removes a lease count quota
+func (b *SystemBackend) handleLeaseCountQuotaDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if err := b.Core.deleteLeaseCountQuota(data.Get("name").(string)); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleRateLimitQuotaList lists the names of the rate limit quotas
+func (b *SystemBackend) handleRateLimitQuotaList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return logical.ListResponse(b.Core.RateLimitQuotaNames()), nil
+}
+
+// handleRateLimitQuotaRead returns a rate limit quota
+func (b *SystemBackend) handleRateLimitQuotaRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	quota := b.Core.RateLimitQuota(data.Get("name").(string))
+	if quota == nil {
+		return nil, nil
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":           quota.Name,
+			"path":           quota.Path,
+			"rate":           quota.Rate,
+			"burst":          quota.Burst,
+			"block_interval": int64(quota.BlockInterval.Seconds()),
+		},
+	}, nil
+}
+
+// handleRateLimitQuotaUpdate creates a rate limit quota or changes the
+// given settings of an existing one
+func (b *SystemBackend) handleRateLimitQuotaUpdate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	quota := &RateLimitQuota{Name: name}
+	if current := b.Core.RateLimitQuota(name); current != nil {
+		*quota = *current
+	}
+
+	if pathRaw, ok := data.GetOk("path"); ok {
+		quota.Path = strings.TrimPrefix(pathRaw.(string), "/")
+	}
+	if rateRaw, ok := data.GetOk("rate"); ok {
+		rate, err := strconv.ParseFloat(rateRaw.(string), 64)
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("invalid rate: %v", err)), logical.ErrInvalidRequest
+		}
+		quota.Rate = rate
+	}
+	if burstRaw, ok := data.GetOk("burst"); ok {
+		quota.Burst = burstRaw.(int)
+	}
+	if blockRaw, ok := data.GetOk("block_interval"); ok {
+		quota.BlockInterval = time.Duration(blockRaw.(int)) * time.Second
+	}
+
+	if err := b.Core.setRateLimitQuota(quota); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	return nil, nil
+}
+
+// handleRateLimitQuotaDelete removes a rate limit quota
+func (b *SystemBackend) handleRateLimitQuotaDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if err := b.Core.deleteRateLimitQuota(data.Get("name").(string)); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleStorageSnapshotConfigList lists the names of the automated
+// snapshot configurations
+func (b *SystemBackend) handleStorageSnapshotConfigList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return logical.ListResponse(b.Core.StorageSnapshotConfigNames()), nil
+}
+
+// handleStorageSnapshotConfigRead returns an automated snapshot
+// configuration, without its secrets
+func (b *SystemBackend) handleStorageSnapshotConfigRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config := b.Core.StorageSnapshotConfig(data.Get("name").(string))
+	if config == nil {
+		return nil, nil
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"name":         config.Name,
+			"interval":     int64(config.Interval.Seconds()),
+			"retain":       config.Retain,
+			"storage_type": config.StorageType,
+			"path_prefix":  config.PathPrefix,
+			"file_prefix":  config.FilePrefix,
+		},
+	}
+	switch config.StorageType {
+	case "aws-s3":
+		resp.Data["aws_s3_bucket"] = config.AWSS3Bucket
+		resp.Data["aws_s3_region"] = config.AWSS3Region
+		resp.Data["aws_s3_endpoint"] = config.AWSS3Endpoint
+		resp.Data["aws_s3_force_path_style"] = config.AWSS3ForcePathStyle
+		resp.Data["aws_access_key_id"] = config.AWSAccessKeyID
+	case "google-gcs":
+		resp.Data["google_gcs_bucket"] = config.GoogleGCSBucket
+		resp.Data["google_gcs_endpoint"] = config.GoogleGCSEndpoint
+		resp.Data["google_service_account_key_file"] = config.GoogleServiceAccountKeyFile
+	case "azure-blob":
+		resp.Data["azure_container_name"] = config.AzureContainerName
+		resp.Data["azure_account_name"] = config.AzureAccountName
+	}
+	return resp, nil
+}
+
+// handleStorageSnapshotConfigUpdate creates an automated snapshot
+// configuration or changes the given settings of an existing one
+func (b *SystemBackend) handleStorageSnapshotConfigUpdate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	config := &StorageSnapshotConfig{
+		Name:       name,
+		Retain:     1,
+		FilePrefix: "vault-snapshot",
+	}
+	if current := b.Core.StorageSnapshotConfig(name); current != nil {
+		*config = *current
+	}
+
+	if intervalRaw, ok := data.GetOk("interval"); ok {
+		config.Interval = time.Duration(intervalRaw.(int)) * time.Second
+	}
+	if retainRaw, ok := data.GetOk("retain"); ok {
+		config.Retain = retainRaw.(int)
+	}
+	for field, value := range map[string]*string{
+		"storage_type":                    &config.StorageType,
+		"path_prefix":                     &config.PathPrefix,
+		"file_prefix":                     &config.FilePrefix,
+		"aws_s3_bucket":                   &config.AWSS3Bucket,
+		"aws_s3_region":                   &config.AWSS3Region,
+		"aws_s3_endpoint":                 &config.AWSS3Endpoint,
+		"aws_access_key_id":               &config.AWSAccessKeyID,
+		"aws_secret_access_key":           &config.AWSSecretAccessKey,
+		"google_gcs_bucket":               &config.GoogleGCSBucket,
+		"google_gcs_endpoint":             &config.GoogleGCSEndpoint,
+		"google_service_account_key_file": &config.GoogleServiceAccountKeyFile,
+		"azure_container_name":            &config.AzureContainerName,
+		"azure_account_name":              &config.AzureAccountName,
+		"azure_account_key":               &config.AzureAccountKey,
+	} {
+		if raw, ok := data.GetOk(field); ok {
+			*value = raw.(string)
+		}
+	}
+	if pathStyleRaw, ok := data.GetOk("aws_s3_force_path_style"); ok {
+		config.AWSS3ForcePathStyle = pathStyleRaw.(bool)
+	}
+
+	if err := b.Core.setStorageSnapshotConfig(config); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	return nil, nil
+}
+
+// handleStorageSnapshotConfigDelete removes an automated snapshot
+// configuration
+func (b *SystemBackend) handleStorageSnapshotConfigDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if err := b.Core.deleteStorageSnapshotConfig(data.Get("name").(string)); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleStorageSnapshotStatusRead returns the status of the automated
+// snapshots of a configuration
+func (b *SystemBackend) handleStorageSnapshotStatusRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	status := b.Core.StorageSnapshotStatus(name)
+	if status == nil {
+		return nil, nil
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"last_snapshot_start":  "",
+			"last_snapshot_end":    "",
+			"last_snapshot_url":    status.LastSnapshotURL,
+			"last_snapshot_sha256": status.LastSnapshotSHA256,
+			"last_snapshot_keys":   status.LastSnapshotKeys,
+			"last_snapshot_error":  status.LastSnapshotError,
+			"consecutive_errors":   status.ConsecutiveErrors,
+			"next_snapshot_start":  "",
+		},
+	}
+	if !status.LastSnapshotStart.IsZero() {
+		resp.Data["last_snapshot_start"] = status.LastSnapshotStart.Format(time.RFC3339Nano)
+		resp.Data["last_snapshot_end"] = status.LastSnapshotEnd.Format(time.RFC3339Nano)
+		if config := b.Core.StorageSnapshotConfig(name); config != nil {
+			resp.Data["next_snapshot_start"] = status.LastSnapshotStart.Add(config.Interval).Format(time.RFC3339Nano)
+		}
+	}
+	return resp, nil
+}
+
+// handleEndpointPolicyList lists the names of the endpoint governing
+// policies
+func (b *SystemBackend) handleEndpointPolicyList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return logical.ListResponse(b.Core.EndpointPolicyNames()), nil
+}
+
+// handleEndpointPolicyRead returns an endpoint governing policy
+func (b *SystemBackend) handleEndpointPolicyRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	policy := b.Core.EndpointPolicy(data.Get("name").(string))
+	if policy == nil {
+		return nil, nil
+	}
+
+	boundCIDRs := policy.BoundCIDRs
+	if boundCIDRs == nil {
+		boundCIDRs = []string{}
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":        policy.Name,
+			"paths":       policy.Paths,
+			"bound_cidrs": boundCIDRs,
+			"require_mfa": policy.RequireMFA,
+		},
+	}, nil
+}
+
+// handleEndpointPolicyUpdate creates an endpoint governing policy or changes
+// the given settings of an existing one
+func (b *SystemBackend) handleEndpointPolicyUpdate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	policy := &EndpointPolicy{Name: name}
+	if current := b.Core.EndpointPolicy(name); current != nil {
+		*policy = *current
+	}
+
+	if pathsRaw, ok := data.GetOk("paths"); ok {
+		policy.Paths = nil
+		for _, path := range strutil.ParseDedupAndSortStrings(pathsRaw.(string), ",") {
+			policy.Paths = append(policy.Paths, strings.TrimPrefix(path, "/"))
+		}
+		sort.Strings(policy.Paths)
+	}
+	if cidrsRaw, ok := data.GetOk("bound_cidrs"); ok {
+		policy.BoundCIDRs = strutil.ParseDedupAndSortStrings(cidrsRaw.(string), ",")
+	}
+	if mfaRaw, ok := data.GetOk("require_mfa"); ok {
+		policy.RequireMFA = mfaRaw.(bool)
+	}
+
+	if err := b.Core.setEndpointPolicy(policy); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	return nil, nil
+}
+
+// handleEndpointPolicyDelete removes an endpoint governing policy
+func (b *SystemBackend) handleEndpointPolicyDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if err := b.Core.deleteEndpointPolicy(data.Get("name").(string)); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleMFAMethodList lists the names of the MFA methods
+func (b *SystemBackend) handleMFAMethodList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return logical.ListResponse(b.Core.MFAMethodNames()), nil
+}
+
+// handleMFAMethodRead returns an MFA method, without its secrets
+func (b *SystemBackend) handleMFAMethodRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	method := b.Core.MFAMethod(data.Get("name").(string))
+	if method == nil || !strings.HasPrefix(req.Path, "mfa/method/"+method.Type+"/") {
+		return nil, nil
+	}
+
+	respData := map[string]interface{}{
+		"name": method.Name,
+		"type": method.Type,
+	}
+	switch method.Type {
+	case mfaTypeTOTP:
+		respData["issuer"] = method.TOTP.Issuer
+		respData["period"] = int64(method.TOTP.Period.Seconds())
+		respData["digits"] = method.TOTP.Digits
+		respData["algorithm"] = method.TOTP.Algorithm
+		respData["key_size"] = method.TOTP.KeySize
+		respData["skew"] = method.TOTP.Skew
+		respData["max_validation_attempts"] = method.TOTP.maxValidationAttempts()
+	case mfaTypeDuo:
+		respData["username_format"] = method.UsernameFormat
+		respData["integration_key"] = method.Duo.IntegrationKey
+		respData["api_hostname"] = method.Duo.APIHostname
+		respData["push_info"] = method.Duo.PushInfo
+		respData["use_passcode"] = method.Duo.UsePasscode
+	case mfaTypePingID:
+		respData["username_format"] = method.UsernameFormat
+		respData["idp_url"] = method.PingID.IDPURL
+		respData["admin_url"] = method.PingID.AdminURL
+		respData["authenticator_id"] = method.PingID.AuthenticatorID
+		respData["org_alias"] = method.PingID.OrgAlias
+		respData["use_signature"] = method.PingID.UseSignature
+	}
+	return &logical.Response{
+		Data: respData,
+	}, nil
+}
+
+// handleMFAMethodUpdate returns the handler creating an MFA method of the
+// given type, or changing the given settings of an existing one
+func (b *SystemBackend) handleMFAMethodUpdate(mfaType string) framework.OperationFunc {
+	return func(req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+		name := data.Get("name").(string)
+		method := &MFAMethod{Name: name, Type: mfaType}
+		if current := b.Core.MFAMethod(name); current != nil && current.Type == mfaType {
+			*method = *current
+		}
+
+		if formatRaw, ok := data.GetOk("username_format"); ok {
+			method.UsernameFormat = formatRaw.(string)
+		}
+
+		switch mfaType {
+		case mfaTypeTOTP:
+			config := &TOTPConfig{}
+			if method.TOTP != nil {
+				*config = *method.TOTP
+			}
+			if issuerRaw, ok := data.GetOk("issuer"); ok {
+				config.Issuer = issuerRaw.(string)
+			}
+			if periodRaw, ok := data.GetOk("period"); ok {
+				config.Period = time.Duration(periodRaw.(int)) * time.Second
+			}
+			if digitsRaw, ok := data.GetOk("digits"); ok {
+				config.Digits = digitsRaw.(int)
+			}
+			if algorithmRaw, ok := data.GetOk("algorithm"); ok {
+				config.Algorithm = strings.ToUpper(algorithmRaw.(string))
+			}
+			if keySizeRaw, ok := data.GetOk("key_size"); ok {
+				config.KeySize = keySizeRaw.(int)
+			}
+			if skewRaw, ok := data.GetOk("skew"); ok {
+				config.Skew = skewRaw.(int)
+			}
+			if attemptsRaw, ok := data.GetOk("max_validation_attempts"); ok {
+				config.MaxValidationAttempts = attemptsRaw.(int)
+			}
+			method.TOTP = config
+
+		case mfaTypeDuo:
+			config := &DuoConfig{}
+			if method.Duo != nil {
+				*config = *method.Duo
+			}
+			if ikeyRaw, ok := data.GetOk("integration_key"); ok {
+				config.IntegrationKey = ikeyRaw.(string)
+			}
+			if skeyRaw, ok := data.GetOk("secret_key"); ok {
+				config.SecretKey = skeyRaw.(string)
+			}
+			if hostRaw, ok := data.GetOk("api_hostname"); ok {
+				config.APIHostname = hostRaw.(string)
+			}
+			if pushInfoRaw, ok := data.GetOk("push_info"); ok {
+				config.PushInfo = pushInfoRaw.(string)
+			}
+			if passcodeRaw, ok := data.GetOk("use_passcode"); ok {
+				config.UsePasscode = passcodeRaw.(bool)
+			}
+			method.Duo = config
+
+		case mfaTypePingID:
+			if settingsRaw, ok := data.GetOk("settings_file_base64"); ok {
+				config, err := parsePingIDSettings(settingsRaw.(string))
+				if err != nil {
+					return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+				}
+				method.PingID = config
+			}
+		}
+
+		if err := b.Core.setMFAMethod(method); err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+		return nil, nil
+	}
+}
+
+// handleMFAMethodDelete removes an MFA method
+func (b *SystemBackend) handleMFAMethodDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	method := b.Core.MFAMethod(name)
+	if method == nil || !strings.HasPrefix(req.Path, "mfa/method/"+method.Type+"/") {
+		return nil, nil
+	}
+	if err := b.Core.deleteMFAMethod(name); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleMFATOTPGenerate generates the TOTP secret of the entity of the
+// caller
+func (b *SystemBackend) handleMFATOTPGenerate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if req.EntityID == "" {
+		return logical.ErrorResponse("the token is not tied to an identity entity"), logical.ErrInvalidRequest
+	}
+	return b.mfaTOTPGenerate(data.Get("name").(string), req.EntityID)
+}
+
+// handleMFATOTPAdminGenerate generates the TOTP secret of an entity
+func (b *SystemBackend) handleMFATOTPAdminGenerate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return b.mfaTOTPGenerate(data.Get("name").(string), data.Get("entity_id").(string))
+}
+
+// mfaTOTPGenerate generates the TOTP secret of an entity for a method
+func (b *SystemBackend) mfaTOTPGenerate(name, entityID string) (*logical.Response, error) {
+	entity := b.Core.identityStore.Entity(entityID)
+	if entity == nil {
+		return logical.ErrorResponse("entity not found"), logical.ErrInvalidRequest
+	}
+	url, err := b.Core.generateTOTPSecret(name, entity)
+	if err != nil {
+		return handleError(err)
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"url": url,
+		},
+	}, nil
+}
+
+// handleMFATOTPAdminDestroy removes the TOTP secret of an entity
+func (b *SystemBackend) handleMFATOTPAdminDestroy(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	entityID := data.Get("entity_id").(string)
+	if entityID == "" {
+		return logical.ErrorResponse("entity_id is required"), logical.ErrInvalidRequest
+	}
+	if err := b.Core.destroyTOTPSecret(data.Get("name").(string), entityID); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleMFAEnforcementList lists the names of the MFA enforcements
+func (b *SystemBackend) handleMFAEnforcementList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return logical.ListResponse(b.Core.MFAEnforcementNames()), nil
+}
+
+// handleMFAEnforcementRead returns an MFA enforcement
+func (b *SystemBackend) handleMFAEnforcementRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	enforcement := b.Core.MFAEnforcement(data.Get("name").(string))
+	if enforcement == nil {
+		return nil, nil
+	}
+
+	nonNil := func(list []string) []string {
+		if list == nil {
+			return []string{}
+		}
+		return list
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"name":                enforcement.Name,
+			"mfa_method_names":    enforcement.MethodNames,
+			"auth_mounts":         nonNil(enforcement.AuthMounts),
+			"identity_entity_ids": nonNil(enforcement.EntityIDs),
+			"paths":               nonNil(enforcement.Paths),
+		},
+	}, nil
+}
+
+// handleMFAEnforcementUpdate creates an MFA enforcement or changes the given
+// settings of an existing one
+func (b *SystemBackend) handleMFAEnforcementUpdate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name := data.Get("name").(string)
+	enforcement := &MFAEnforcement{Name: name}
+	if current := b.Core.MFAEnforcement(name); current != nil {
+		*enforcement = *current
+	}
+
+	if namesRaw, ok := data.GetOk("mfa_method_names"); ok {
+		enforcement.MethodNames = strutil.ParseDedupAndSortStrings(namesRaw.(string), ",")
+	}
+	if mountsRaw, ok := data.GetOk("auth_mounts"); ok {
+		enforcement.AuthMounts = strutil.ParseDedupAndSortStrings(mountsRaw.(string), ",")
+	}
+	if entityIDsRaw, ok := data.GetOk("identity_entity_ids"); ok {
+		enforcement.EntityIDs = strutil.ParseDedupAndSortStrings(entityIDsRaw.(string), ",")
+	}
+	if pathsRaw, ok := data.GetOk("paths"); ok {
+		enforcement.Paths = nil
+		for _, path := range strutil.ParseDedupAndSortStrings(pathsRaw.(string), ",") {
+			enforcement.Paths = append(enforcement.Paths, strings.TrimPrefix(path, "/"))
+		}
+		sort.Strings(enforcement.Paths)
+	}
+
+	if err := b.Core.setMFAEnforcement(enforcement); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	return nil, nil
+}
+
+// handleMFAEnforcementDelete removes an MFA enforcement
+func (b *SystemBackend) handleMFAEnforcementDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if err := b.Core.deleteMFAEnforcement(data.Get("name").(string)); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleNamespaceList lists the names of the namespaces directly under the
+// namespace of the backend
+func (b *SystemBackend) handleNamespaceList(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	return logical.ListResponse(b.Core.namespaceChildren(b.namespace)), nil
+}
+
+// handleNamespaceRead returns a child namespace
+func (b *SystemBackend) handleNamespaceRead(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	ns := b.Core.Namespace(b.childNamespacePath(data))
+	if ns == nil {
+		return nil, nil
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"id":   ns.ID,
+			"path": strings.TrimPrefix(ns.Path, namespacePath(b.namespace)),
+		},
+	}, nil
+}
+
+// handleNamespaceUpdate creates a child namespace if it does not exist
+func (b *SystemBackend) handleNamespaceUpdate(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if b.Core.Namespace(b.childNamespacePath(data)) != nil {
+		return nil, nil
+	}
+	if _, err := b.Core.createNamespace(b.namespace, data.Get("path").(string)); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleNamespaceDelete removes a child namespace
+func (b *SystemBackend) handleNamespaceDelete(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	ns := b.Core.Namespace(b.childNamespacePath(data))
+	if ns == nil {
+		return nil, nil
+	}
+	if err := b.Core.deleteNamespace(ns); err != nil {
+		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+	}
+	return nil, nil
+}
+
+// childNamespacePath returns the full path of the child namespace named by
+// the request
+func (b *SystemBackend) childNamespacePath(data *framework.FieldData) string {
+	return namespacePath(b.namespace) + data.Get("path").(string) + "/"
+}
+
+// handleDRPrimaryEnable makes the cluster a DR primary
+func (b *SystemBackend) handleDRPrimaryEnable(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if err := b.Core.enableDRPrimary(); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleDRPrimaryDisable stops replicating to the DR secondaries
+func (b *SystemBackend) handleDRPrimaryDisable(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	if err := b.Core.disableDRPrimary(); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleDRSecondaryToken registers a DR secondary and returns its
+// activation token
+func (b *SystemBackend) handleDRSecondaryToken(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	id := data.Get("id").(string)
+	if id == "" {
+		return logical.ErrorResponse("id is required"), logical.ErrInvalidRequest
+	}
+
+	var filter *PathFilter
+	modeRaw, modeOk := data.GetOk("mode")
+	pathsRaw, pathsOk := data.GetOk("paths")
+	if modeOk || pathsOk {
+		filter = &PathFilter{}
+		if modeOk {
+			filter.Mode = modeRaw.(string)
+		}
+		if pathsOk {
+			filter.Paths = strutil.ParseDedupAndSortStrings(pathsRaw.(string), ",")
+		}
+		if err := filter.validate(); err != nil {
+			return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
+		}
+	}
+
+	token, err := b.Core.drSecondaryToken(id, data.Get("primary_api_addr").(string), filter)
+	if err != nil {
+		return handleError(err)
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"token": token,
+		},
+	}, nil
+}
+
+// handleDRRevokeSecondary removes a DR secondary
+func (b *SystemBackend) handleDRRevokeSecondary(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	id := data.Get("id").(string)
+	if id == "" {
+		return logical.ErrorResponse("id is required"), logical.ErrInvalidRequest
+	}
+
+	if err := b.Core.revokeDRSecondary(id); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleRaftJoin adds a node to the raft cluster
+func (b *SystemBackend) handleRaftJoin(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	nodeID := data.Get("node_id").(string)
+	if nodeID == "" {
+		return logical.ErrorResponse("node_id is required"), logical.ErrInvalidRequest
+	}
+	address := data.Get("address").(string)
+	if address == "" {
+		return logical.ErrorResponse("address is required"), logical.ErrInvalidRequest
+	}
+
+	if err := b.Core.raftJoin(nodeID, address); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleRaftConfiguration returns the nodes of the raft cluster
+func (b *SystemBackend) handleRaftConfiguration(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	peers, err := b.Core.raftPeers()
+	if err != nil {
+		return handleError(err)
+	}
+
+	servers := make([]map[string]interface{}, 0, len(peers))
+	for _, peer := range peers {
+		servers = append(servers, map[string]interface{}{
+			"node_id": peer.NodeID,
+			"address": peer.Address,
+			"leader":  peer.Leader,
+			"voter":   peer.Voter,
+		})
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"servers": servers,
+		},
+	}, nil
+}
+
+// handleRaftRemovePeer removes a node from the raft cluster
+func (b *SystemBackend) handleRaftRemovePeer(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	nodeID := data.Get("node_id").(string)
+	if nodeID == "" {
+		return logical.ErrorResponse("node_id is required"), logical.ErrInvalidRequest
+	}
+
+	if err := b.Core.raftRemovePeer(nodeID); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleRaftSnapshot streams a snapshot of the raft storage
+func (b *SystemBackend) handleRaftSnapshot(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	snapshot, err := b.Core.raftSnapshot()
+	if err != nil {
+		return handleError(err)
+	}
+
+	return &logical.Response{
+		Stream: &logical.ResponseStream{
+			ContentType: "application/octet-stream",
+			Body:        snapshot,
+		},
+	}, nil
+}
+
+// handleRaftRestore replaces the data of the raft cluster with the
+// snapshot in the body of the request
+func (b *SystemBackend) handleRaftRestore(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	body, ok := req.Data[logical.HTTPRawBody].([]byte)
+	if !ok || len(body) == 0 {
+		return logical.ErrorResponse("the snapshot must be sent as an application/octet-stream body"), logical.ErrInvalidRequest
+	}
+
+	if err := b.Core.raftRestore(bytes.NewReader(body)); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+// handleDRFetch returns the changes a DR secondary has not replicated yet
+func (b *SystemBackend) handleDRFetch(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	resp, err := b.Core.drFetch(
+		data.Get("id").(string),
+		data.Get("secret").(string),
+		data.Get("epoch").(string),
+		uint64(data.Get("index").(int)),
+		data.Get("cursor").(string))
+	if err != nil {
+		return nil, logical.ErrPermissionDenied
+	}
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"epoch":   resp.Epoch,
+			"index":   resp.Index,
+			"full":    resp.Full,
+			"more":    resp.More,
+			"cursor":  resp.Cursor,
+			"entries": resp.Entries,
+		},
+	}, nil
+}
+
+// handleDRSecondaryEnable makes the cluster a DR secondary
+func (b *SystemBackend) handleDRSecondaryEnable(
+	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	token := data.Get("token").(string)
+	if token == "" {
+		return logical.ErrorResponse("token is required"), logical.ErrInvalidRequest
+	}
+
+	if err := b.Core.enableDRSecondary(token, data.Get("primary_api_addr").(string), data.Get("ca_cert").(string)); err != nil {
+		return handleError(err)
+	}
+	return nil, nil
+}
+
+func sanitizeMountPath(path string) string {
+	if !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+
+	if strings.HasPrefix(path, "/") {
+		path = path[1:]
+	}
+
+	return path
+}
+
+const sysHelpRoot = `
+The system backend is built-in to Vault and cannot be remounted or
+unmounted. It contains the paths that are used to configure Vault itself
+as well as perform core operations.
+`
+
+// sysHelp is all the help text for the sys backend.
+var sysHelp = map[string][2]string{
+	"init": {
+		"Initializes or returns the initialization status of the Vault.",
+		`
+This path responds to the following HTTP methods.
+
+    GET /
+        Returns the initialization status of the Vault.
+
+    POST /
+        Initializes a new vault.
+		`,
+	},
+	"generate-root": {
+		"Reads, generates, or deletes a root token regeneration process.",
+		`
+This path responds to multiple HTTP methods which change the behavior. Those
+HTTP methods are listed below.
+
+    GET /attempt
+        Reads the configuration and progress of the current root generation
+        attempt.
+
+    POST /attempt
+        Initializes a new root generation attempt. Only a single root generation
+        attempt can take place at a time. One (and only one) of otp or pgp_key
+        are required.
+
+    DELETE /attempt
+        Cancels any in-progress root generation attempt. This clears any
+        progress made. This must be called to change the OTP or PGP key being
+        used.
+		`,
+	},
+	"seal-status": {
+		"Returns the seal status of the Vault.",
+		`
+This path responds to the following HTTP methods.
+
+    GET /
+        Returns the seal status of the Vault. This is an unauthenticated
+        endpoint.
+		`,
+	},
+	"seal": {
+		"Seals the Vault.",
+		`
+This path responds to the following HTTP methods.
+
+    PUT /
+        Seals the Vault.
+		`,
+	},
+	"unseal": {
+		"Unseals the Vault.",
+		`
+This path responds to the following HTTP methods.
+
+    PUT /
+        Unseals the Vault.
+		`,
+	},
+	"mounts": {
+		"List the currently mounted backends.",
+		`
+This path responds to the following HTTP methods.
+
+    GET /
+        Lists all the mounted secret backends.
+
+    GET /<mount point>
+        Get information about the mount at the specified path.
+
+    POST /<mount point>
+        Mount a new secret backend to the mount point in the URL.
+
+    POST /<mount point>/tune
+        Tune configuration parameters for the given mount point.
+
+    DELETE /<mount point>
+        Unmount the specified mount point.
+		`,
+	},
+
+	"mount": {
+		`Mount a new backend at a new path.`,
+		`
+Mount a backend at a new path. A backend can be mounted multiple times at
+multiple paths in order to configure multiple separately configured backends.
+Example: you might have an AWS backend for the east coast, and one for the
+west coast.
+		`,
+	},
+
+	"mount_path": {
+		`The path to mount to. Example: "aws/east"`,
+		"",
+	},
+
+	"mount_type": {
+		`The type of the backend. Example: "passthrough"`,
+		"",
+	},
+
+	"mount_desc": {
+		`User-friendly description for this mount.`,
+		"",
+	},
+
+	"mount_config": {
+		`Configuration for this mount, such as default_lease_ttl
+and max_lease_ttl.`,
+	},
+
+	"tune_default_lease_ttl": {
+		`The default lease TTL for this mount.`,
+	},
+
+	"tune_max_request_size": {
+		`The maximum size of a request body for this mount, in bytes. If 0, the listener or server-wide limit is used.`,
+	},
+
+	"tune_audit_non_hmac_request_keys": {
+		`Comma-separated list of keys of the request data whose values the audit backends log without hashing them.`,
+	},
+
+	"tune_audit_non_hmac_response_keys": {
+		`Comma-separated list of keys of the response data whose values the audit backends log without hashing them.`,
+	},
+
+	"tune_audit_elide_response_keys": {
+		`Comma-separated list of keys of the response data whose values the audit backends replace by their size, such as the keys of list responses.`,
+	},
+
+	"tune_max_lease_ttl": {
+		`The max lease TTL for this mount.`,
+	},
+
+	"remount": {
+		"Move the mount point of an already-mounted backend.",
+		`
+This path responds to the following HTTP methods.
+
+    POST /sys/remount
+        Changes the mount point of an already-mounted backend.
+		`,
+	},
+
+	"auth_tune": {
+		"Tune the configuration parameters for an auth path.",
+		`Read and write the 'default-lease-ttl' and 'max-lease-ttl' values of
+the auth path, its maximum request size and its audit options.`,
+	},
+
+	"mount_tune": {
+		"Tune backend configuration parameters for this mount.",
+		`Read and write the 'default-lease-ttl' and 'max-lease-ttl' values of
+the mount, its maximum request size and its audit options.`,
+	},
+
+	"renew": {
+		"Renew a lease on a secret",
+		`
+When a secret is read, it may optionally include a lease interval
+and a boolean indicating if renew is possible. For secrets that support
+lease renewal, this endpoint is used to extend the validity of the
+lease and to prevent an automatic revocation.
+		`,
+	},
+
+	"lease_id": {
+		"The lease identifier to renew. This is included with a lease.",
+		"",
+	},
+
+	"increment": {
+		"The desired increment in seconds to the lease",
+		"",
+	},
+
+	"revoke": {
+		"Revoke a leased secret immediately",
+		`
+When a secret is generated with a lease, it is automatically revoked
+at the end of the lease period if not renewed. However, in some cases
+you may want to force an immediate revocation. This endpoint can be
+used to revoke the secret with the given Lease ID.
+		`,
+	},
+
+	"revoke-prefix": {
+		"Revoke all secrets generated in a given prefix",
+		`
+Revokes all the secrets generated under a given mount prefix. As
+an example, "prod/aws/" might be the AWS logical backend, and due to
+a change in the "ops" policy, we may want to invalidate all the secrets
+generated. We can do a revoke prefix at "prod/aws/ops" to revoke all
+the ops secrets. This does a prefix match on the Lease IDs and revokes
+all matching leases.
+		`,
+	},
+
+	"revoke-prefix-path": {
+		`The path to revoke keys under. Example: "prod/aws/ops"`,
+		"",
+	},
+
+	"raw": {
+		"Read, write, list and delete the entries of the storage.",
+		`
+This endpoint gives direct access to the storage through the barrier, for
+emergency repairs. The paths are storage paths, not the logical paths of the
+mounts. Values stored compressed are decompressed when read, and can be
+written compressed with the "compressed" parameter. The entries under core/
+cannot be accessed.
+
+This endpoint requires sudo capability and is only available if the server
+is configured with raw_storage_endpoint.
+		`,
+	},
+
+	"raw-path": {
+		`The storage path of the entry, or the prefix to list.`,
+		"",
+	},
+
+	"raw-prefix": {
+		"List or delete all the entries of the storage under a prefix.",
+		`
+Listing returns every key under the prefix, recursively, relative to the
+prefix. Deleting removes all of them. The entries under core/ cannot be
+accessed.
+
+This endpoint requires sudo capability and is only available if the server
+is configured with raw_storage_endpoint.
+		`,
+	},
+
+	"raw-prefix-path": {
+		`The storage prefix to list or delete under.`,
+		"",
+	},
+
+	"revoke-force": {
+		"Revoke all secrets generated in a given prefix, ignoring errors.",
+		`
+See the path help for 'revoke-prefix'; this behaves the same, except that it
+ignores errors encountered during revocation. This can be used in certain
+recovery situations; for instance, when you want to unmount a backend, but it
+is impossible to fix revocation errors and these errors prevent the unmount
+from proceeding. This is a DANGEROUS operation as it removes Vault's oversight
+of external secrets. Access to this prefix should be tightly controlled.
+		`,
+	},
+
+	"leases/tidy": {
+		"Remove the leases of missing mounts and revoked tokens.",
+		`
+This path responds to the following HTTP methods.
+
+    POST /
+        Scans all the leases for those issued by a mount that no longer
+        exists or belonging to a token that no longer exists, and removes
+        them. Leases of missing mounts are removed without revocation by
+        their backend; the others are revoked as usual, and kept if that
+        fails. With dry_run, the leases are only reported.
+		`,
+	},
+
+	"leases/count": {
+		"Count the active and irrevocable leases.",
+		`
+This path responds to the following HTTP methods.
+
+    GET /
+        Returns the number of leases pending expiration, and the number of
+        irrevocable leases.
+		`,
+	},
+
+	"leases/irrevocable": {
+		"List the leases that could not be revoked.",
+		`
+This path responds to the following HTTP methods.
+
+    GET /
+        Returns the leases whose revocation failed every time it was
+        attempted when they expired, with the last error.
+
+Irrevocable leases are no longer revoked automatically. Once the cause of
+the failures is fixed, they can be revoked through the revoke endpoint,
+or removed regardless of errors through revoke-force.
+		`,
+	},
+
+	"tokens/accessors": {
+		"List the accessors of the tokens matching a filter.",
+		`
+This path responds to the following HTTP methods.
+
+    POST /
+        Returns the accessors of the tokens matching all the given filters,
+        along with their path, policies, display name, creation time and
+        creation TTL. Without filters, all the tokens are listed.
+
+Batch tokens are not kept in storage and are never listed.
+		`,
+	},
+
+	"tokens/revoke": {
+		"Revoke the tokens matching a filter.",
+		`
+This path responds to the following HTTP methods.
+
+    POST /
+        Revokes the tokens matching all the given filters, along with their
+        child tokens and leases, and returns their accessors. At least one
+        filter is required. With dry_run, the tokens are only reported.
+
+For instance, the tokens issued by a compromised auth mount can be revoked
+at once by filtering on the path prefix of the mount, such as
+"auth/github/".
+		`,
+	},
+
+	"tokens_policy": {
+		"Only select the tokens with this policy.",
+		"",
+	},
+
+	"tokens_path_prefix": {
+		`Only select the tokens created on a path with this prefix, such as "auth/github/".`,
+		"",
+	},
+
+	"tokens_created_after": {
+		"Only select the tokens created at or after this RFC 3339 time.",
+		"",
+	},
+
+	"tokens_created_before": {
+		"Only select the tokens created before this RFC 3339 time.",
+		"",
+	},
+
+	"tokens_min_ttl": {
+		"Only select the tokens created with at least this TTL. Tokens without a TTL always match.",
+		"",
+	},
+
+	"tokens_max_ttl": {
+		"Only select the tokens created with at most this TTL. Tokens without a TTL never match.",
+		"",
+	},
+
+	"tokens_dry_run": {
+		"Only report the tokens that would be revoked.",
+		"",
+	},
+
+	"identity/entity": {
+		"Create an identity entity.",
+		`
+This path responds to the following HTTP methods.
+
+    POST /
+        Creates an entity with the given name, policies and metadata, and
+        returns its ID. A name is generated if none is given.
+
+Entities are usually created on the first login of a principal through an
+auth backend reporting aliases. Creating one beforehand, along with its
+aliases, ties the logins of the principal through several auth mounts to
+the same entity from the start.
+		`,
+	},
+
+	"identity/entity/id": {
+		"Read, update or delete an identity entity by ID.",
+		`
+This path responds to the following HTTP methods.
+
+    LIST /
+        Returns the IDs of the entities.
+
+    GET /<id>
+        Returns the entity with its aliases. The ID of an entity merged into
+        another one returns the resulting entity.
+
+    POST /<id>
+        Changes the given name, policies or metadata of the entity.
+
+    DELETE /<id>
+        Removes the entity and its aliases. The tokens tied to the entity
+        lose its policies.
+
+The policies of an entity are granted to all the tokens tied to it, in
+addition to the policies of the tokens.
+		`,
+	},
+
+	"identity/entity/name": {
+		"Read an identity entity by name.",
+		`
+This path responds to the following HTTP methods.
+
+    GET /<name>
+        Returns the entity with its aliases.
+		`,
+	},
+
+	"identity/entity/merge": {
+		"Merge identity entities into another one.",
+		`
+This path responds to the following HTTP methods.
+
+    POST /
+        Merges the entities into the target entity, which takes over their
+        aliases and policies, as well as the metadata keys it does not
+        have. The merged entities are removed; the tokens tied to them are
+        tied to the target entity instead.
+		`,
+	},
+
+	"identity/entity-alias": {
+		"Create, read or delete the aliases of identity entities.",
+		`
+This path responds to the following HTTP methods.
+
+    POST /
+        Ties the principal with the given name in an auth mount to an
+        existing entity, so that its logins are tracked as that entity.
+
+    GET /id/<id>
+        Returns the alias.
+
+    DELETE /id/<id>
+        Removes the alias from its entity. The next login of the principal
+        creates a new entity.
+
+An alias identifies a principal within an auth mount, such as a user name.
+Its name is the one reported by the backend on login.
+		`,
+	},
+
+	"entity_id": {
+		"The ID of the entity.",
+		"",
+	},
+
+	"entity_name": {
+		"The unique name of the entity.",
+		"",
+	},
+
+	"entity_policies": {
+		"Comma-separated list of policies granted to the tokens of the entity.",
+		"",
+	},
+
+	"entity_metadata": {
+		"String-valued metadata of the entity.",
+		"",
+	},
+
+	"entity_merge_from": {
+		"Comma-separated list of the IDs of the entities to merge.",
+		"",
+	},
+
+	"entity_merge_to": {
+		"The ID of the entity to merge into.",
+		"",
+	},
+
+	"alias_id": {
+		"The ID of the alias.",
+		"",
+	},
+
+	"alias_mount_path": {
+		`The path of the auth mount of the alias, such as "auth/github/".`,
+		"",
+	},
+
+	"alias_name": {
+		"The name of the principal within the auth mount, as reported by its backend.",
+		"",
+	},
+
+	"alias_metadata": {
+		"String-valued metadata of the alias, replaced by the backend on login.",
+		"",
+	},
+
+	"identity/group": {
+		"Create an identity group.",
+		`
+This path responds to the following HTTP methods.
+
+    POST /
+        Creates a group with the given name, type, policies, metadata and
+        members, and returns its ID. A name is generated if none is given.
+
+The policies of a group are granted to the tokens of all its members, in
+addition to the policies of the tokens and of their entity. The members of
+internal groups are managed through this API. The members of external
+groups are the entities whose last login through the auth mount of the
+group alias reported the group, such as an LDAP group or a GitHub team.
+		`,
+	},
+
+	"identity/group/id": {
+		"Read, update or delete an identity group by ID.",
+		`
+This path responds to the following HTTP methods.
+
+    LIST /
+        Returns the IDs of the groups.
+
+    GET /<id>
+        Returns the group with its members and alias.
+
+    POST /<id>
+        Changes the given name, policies, metadata or members of the
+        group. The members of external groups cannot be changed.
+
+    DELETE /<id>
+        Removes the group and its alias. Its members lose its policies.
+		`,
+	},
+
+	"identity/group/name": {
+		"Read an identity group by name.",
+		`
+This path responds to the following HTTP methods.
+
+    GET /<name>
+        Returns the group with its members and alias.
+		`,
+	},
+
+	"identity/group-alias": {
+		"Create, read or delete the aliases of external identity groups.",
+		`
+This path responds to the following HTTP methods.
+
+    POST /
+        Maps an external group to the group with the given name in an auth
+        mount. A group has a single alias, which is replaced.
+
+    GET /id/<id>
+        Returns the alias.
+
+    DELETE /id/<id>
+        Removes the alias from its group, along with the members it
+        reported.
+		`,
+	},
+
+	"group_id": {
+		"The ID of the group.",
+		"",
+	},
+
+	"group_name": {
+		"The unique name of the group.",
+		"",
+	},
+
+	"group_type": {
+		`The type of the group, "internal" or "external".`,
+		"",
+	},
+
+	"group_policies": {
+		"Comma-separated list of policies granted to the tokens of the members of the group.",
+		"",
+	},
+
+	"group_metadata": {
+		"String-valued metadata of the group.",
+		"",
+	},
+
+	"group_member_entity_ids": {
+		"Comma-separated list of the IDs of the entities of an internal group.",
+		"",
+	},
+
+	"group_alias_name": {
+		"The name of the group within the auth mount, as reported by its backend.",
+		"",
+	},
+
+	"control-group/authorize": {
+		"Approve a request held by a control group.",
+		`
+This path responds to the following HTTP methods.
+
+    POST /
+        Records the approval of the request by the entity of the token,
+        which must be a member of one of the groups of the control group.
+        Requesters cannot approve their own requests.
+		`,
+	},
+
+	"control-group/request": {
+		"Check the status of a request held by a control group.",
+		`
+This path responds to the following HTTP methods.
+
+    POST /
+        Returns the path and requester of the request, the approvals it got
+        and whether it is approved. Once approved, the request is run by
+        unwrapping its wrapping token.
+		`,
+	},
+
+	"control_group_accessor": {
+		"The accessor of the wrapping token of the request.",
+		"",
+	},
+
+	"leases_tidy_dry_run": {
+		"Only report the leases that would be removed.",
+		"",
+	},
+
+	"revoke-force-path": {
+		`The path to revoke keys under. Example: "prod/aws/ops"`,
+		"",
+	},
+
+	"auth-table": {
+		"List the currently enabled credential backends.",
+		`
+This path responds to the following HTTP methods.
+
+    GET /
+        List the currently enabled credential backends: the name, the type of
+        the backend, and a user friendly description of the purpose for the
+        credential backend.
+
+    POST /<mount point>
+        Enable a new auth backend.
+
+    DELETE /<mount point>
+        Disable the auth backend at the given mount point.
+		`,
+	},
+
+	"auth": {
+		`Enable a new credential backend with a name.`,
+		`
+Enable a credential mechanism at a new path. A backend can be mounted multiple times at
+multiple paths in order to configure multiple separately configured backends.
+Example: you might have an OAuth backend for GitHub, and one for Google Apps.
+		`,
+	},
+
+	"auth_path": {
+		`The path to mount to. Cannot be delimited. Example: "user"`,
+		"",
+	},
+
+	"auth_type": {
+		`The type of the backend. Example: "userpass"`,
+		"",
+	},
+
+	"auth_desc": {
+		`User-friendly description for this crential backend.`,
+		"",
+	},
+
+	"policy-list": {
+		`List the configured access control policies.`,
+		`
+This path responds to the following HTTP methods.
+
+    GET /
+        List the names of the configured access control policies.
+
+    GET /<name>
+        Retrieve the rules for the named policy.
+
+    PUT /<name>
+        Add or update a policy.
+
+    DELETE /<name>
+        Delete the policy with the given name.
+		`,
+	},
+
+	"policy": {
+		`Read, Modify, or Delete an access control policy.`,
+		`
+Read the rules of an existing policy, create or update the rules of a policy,
+or delete a policy.
+		`,
+	},
+
+	"policy-name": {
+		`The name of the policy. Example: "ops"`,
+		"",
+	},
+
+	"policy-rules": {
+		`The rules of the policy. Either given in HCL or JSON format.`,
+		"",
+	},
+
+	"audit-hash": {
+		"The hash of the given string via the given audit backend",
+		`
+Either a single string is given as "input", returning its "hash", or a list
+of strings is given as "inputs", returning their "hashes" in the same order.
+		`,
+	},
+
+	"audit-hash-verify": {
+		"Check whether a hash logged by the given audit backend is the hash of the given string.",
+		`
+The input is hashed with the version of the backend's salt the hash was
+computed with, which is read from the hash itself, and compared with it.
+		`,
+	},
+
+	"audit_verify_input": {
+		`The string to check the hash against.`,
+		"",
+	},
+
+	"audit_verify_hash": {
+		`The hash as found in the audit log, such as "hmac-sha256:<hmac>".`,
+		"",
+	},
+
+	"audit-rotate-salt": {
+		"Rotate the salt of the given audit backend.",
+		`
+Values are hashed with a new salt from then on. Previous versions of the
+salt are retained, and values logged with them can be looked up by giving
+their version to the audit-hash endpoint.
+		`,
+	},
+
+	"audit_salt_version": {
+		`The version of the salt to hash with. Defaults to the current version.`,
+		"",
+	},
+
+	"audit-schema": {
+		"Return the JSON Schema of the audit entry format.",
+		`
+Each audit entry includes the version of its format as "schema_version".
+Reading this path lists the versions a schema is available for and the
+version currently written. Reading a version returns its JSON Schema, so that
+log pipelines can validate entries and update their parsing when the version
+changes.
+		`,
+	},
+
+	"audit_schema_version": {
+		`The version of the audit entry format.`,
+		"",
+	},
+
+	"audit-table": {
+		"List the currently enabled audit backends.",
+		`
+This path responds to the following HTTP methods.
+
+    GET /
+        List the currently enabled audit backends.
+
+    PUT /<path>
+        Enable an audit backend at the given path.
+
+    DELETE /<path>
+        Disable the given audit backend.
+		`,
+	},
+
+	"audit_path": {
+		`The name of the backend. Cannot be delimited. Example: "mysql"`,
+		"",
+	},
+
+	"audit_type": {
+		`The type of the backend. Example: "mysql"`,
+		"",
+	},
 
-	switch apiConfig.DefaultLeaseTTL {
-	case "":
-	case "system":
-	default:
-		tmpDef, err := duration.ParseDurationSecond(apiConfig.DefaultLeaseTTL)
-		if err != nil {
-			return logical.ErrorResponse(fmt.Sprintf(
-					"unable to parse default TTL of %s: %s", apiConfig.DefaultLeaseTTL, err)),
-				logical.ErrInvalidRequest
-		}
-		config.DefaultLeaseTTL = tmpDef
-	}
+	"audit_desc": {
+		`User-friendly description for this audit backend.`,
+		"",
+	},
 
-	switch apiConfig.MaxLeaseTTL {
-	case "":
-	case "system":
-	default:
-		tmpMax, err := duration.ParseDurationSecond(apiConfig.MaxLeaseTTL)
-		if err != nil {
-			return logical.ErrorResponse(fmt.Sprintf(
-					"unable to parse max TTL of %s: %s", apiConfig.MaxLeaseTTL, err)),
-				logical.ErrInvalidRequest
-		}
-		config.MaxLeaseTTL = tmpMax
-	}
+	"audit_opts": {
+		`Configuration options for the audit backend.`,
+		"",
+	},
 
-	if config.MaxLeaseTTL != 0 && config.DefaultLeaseTTL > config.MaxLeaseTTL {
-		return logical.ErrorResponse(
-				"given default lease TTL greater than given max lease TTL"),
-			logical.ErrInvalidRequest
-	}
+	"audit": {
+		`Enable or disable audit backends.`,
+		`
+Enable a new audit backend or disable an existing backend.
+		`,
+	},
 
-	if config.DefaultLeaseTTL > b.Core.maxLeaseTTL {
-		return logical.ErrorResponse(fmt.Sprintf(
-				"given default lease TTL greater than system max lease TTL of %d", int(b.Core.maxLeaseTTL.Seconds()))),
-			logical.ErrInvalidRequest
-	}
+	"key-status": {
+		"Provides information about the backend encryption key.",
+		`
+		Provides the current backend encryption key term, installation time
+		and the number of values encrypted with it.
+		`,
+	},
 
-	if logicalType == "" {
-		return logical.ErrorResponse(
-				"backend type must be specified as a string"),
-			logical.ErrInvalidRequest
-	}
+	"rotate": {
+		"Rotates the backend encryption key used to persist data.",
+		`
+		Rotate generates a new encryption key which is used to encrypt all
+		data going to the storage backend. The old encryption keys are kept so
+		that data encrypted using those keys can still be decrypted.
+		`,
+	},
 
-	// Create the mount entry
-	me := &MountEntry{
-		Table:       mountTableType,
-		Path:        path,
-		Type:        logicalType,
-		Description: description,
-		Config:      config,
-	}
+	"rotate/config": {
+		"Configures or returns the automatic rotation of the encryption key.",
+		`
+This path responds to the following HTTP methods.
 
-	// Attempt mount
-	if err := b.Core.mount(me); err != nil {
-		b.Backend.Logger().Printf("[ERR] sys: mount %s failed: %v", me.Path, err)
-		return handleError(err)
-	}
+    GET /
+        Returns the automatic key rotation policy.
 
-	return nil, nil
-}
+    POST /
+        Changes the given settings of the policy.
 
-// used to intercept an HTTPCodedError so it goes back to callee
-func handleError(
-	err error) (*logical.Response, error) {
-	switch err.(type) {
-	case logical.HTTPCodedError:
-		return logical.ErrorResponse(err.Error()), err
-	default:
-		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
-	}
-}
+Once enabled, the active node rotates the encryption key when it has
+encrypted max_operations values or is older than interval, whichever
+comes first. The check runs every minute.
+		`,
+	},
 
-// handleUnmount is used to unmount a path
-func (b *SystemBackend) handleUnmount(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	suffix := strings.TrimPrefix(req.Path, "mounts/")
-	if len(suffix) == 0 {
-		return logical.ErrorResponse("path cannot be blank"), logical.ErrInvalidRequest
-	}
+	"rotation_enabled": {
+		"Whether the encryption key is rotated automatically.",
+		"",
+	},
 
-	suffix = sanitizeMountPath(suffix)
+	"rotation_max_operations": {
+		`The number of values encrypted with a key after which it is rotated.
+Zero disables the limit.`,
+		"",
+	},
 
-	// Attempt unmount
-	if err := b.Core.unmount(suffix); err != nil {
-		b.Backend.Logger().Printf("[ERR] sys: unmount '%s' failed: %v", suffix, err)
-		return handleError(err)
-	}
+	"rotation_interval": {
+		`The age after which a key is rotated, such as "720h". It must be at least
+an hour; zero disables the limit.`,
+		"",
+	},
 
-	return nil, nil
-}
+	"config/cors": {
+		"Configures or returns the CORS settings.",
+		`
+This path responds to the following HTTP methods.
 
-// handleRemount is used to remount a path
-func (b *SystemBackend) handleRemount(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	// Get the paths
-	fromPath := data.Get("from").(string)
-	toPath := data.Get("to").(string)
-	if fromPath == "" || toPath == "" {
-		return logical.ErrorResponse(
-				"both 'from' and 'to' path must be specified as a string"),
-			logical.ErrInvalidRequest
-	}
+    GET /
+        Returns the CORS configuration.
 
-	fromPath = sanitizeMountPath(fromPath)
-	toPath = sanitizeMountPath(toPath)
+    POST /
+        Sets the CORS configuration, replacing the existing one.
 
-	// Attempt remount
-	if err := b.Core.remount(fromPath, toPath); err != nil {
-		b.Backend.Logger().Printf("[ERR] sys: remount '%s' to '%s' failed: %v", fromPath, toPath, err)
-		return handleError(err)
-	}
+    DELETE /
+        Disables CORS.
 
-	return nil, nil
-}
+Once enabled, browser-based applications served from one of the allowed
+origins can make requests to the API directly.
+		`,
+	},
 
-// handleAuthTuneRead is used to get config settings on a auth path
-func (b *SystemBackend) handleAuthTuneRead(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	path := data.Get("path").(string)
-	if path == "" {
-		return logical.ErrorResponse(
-				"path must be specified as a string"),
-			logical.ErrInvalidRequest
-	}
-	return b.handleTuneReadCommon("auth/" + path)
-}
+	"cors_enabled": {
+		"Whether CORS is enabled. Defaults to true.",
+		"",
+	},
 
-// handleMountTuneRead is used to get config settings on a backend
-func (b *SystemBackend) handleMountTuneRead(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	path := data.Get("path").(string)
-	if path == "" {
-		return logical.ErrorResponse(
-				"path must be specified as a string"),
-			logical.ErrInvalidRequest
-	}
+	"cors_allowed_origins": {
+		`A comma-separated list of the origins allowed to make cross-origin requests,
+or "*" to allow any origin.`,
+		"",
+	},
 
-	// This call will read both logical backend's configuration as well as auth backends'.
-	// Retaining this behavior for backward compatibility. If this behavior is not desired,
-	// an error can be returned if path has a prefix of "auth/".
-	return b.handleTuneReadCommon(path)
-}
+	"cors_allowed_headers": {
+		`A comma-separated list of request headers to allow in cross-origin requests,
+in addition to the ones the API requires.`,
+		"",
+	},
 
-// handleTuneReadCommon returns the config settings of a path
-func (b *SystemBackend) handleTuneReadCommon(path string) (*logical.Response, error) {
-	path = sanitizeMountPath(path)
+	"events": {
+		"Streams notifications of changes as server-sent events.",
+		`
+This path responds to the following HTTP methods.
 
-	sysView := b.Core.router.MatchingSystemView(path)
-	if sysView == nil {
-		err := fmt.Errorf("[ERR] sys: cannot fetch sysview for path %s", path)
-		b.Backend.Logger().Print(err)
-		return handleError(err)
-	}
+    GET /
+        Streams lease expirations, mount and auth table changes, policy
+        changes, and sealing or stepping down of the active node, until
+        the client disconnects or the active node stops being active.
 
-	resp := &logical.Response{
-		Data: map[string]interface{}{
-			"default_lease_ttl": int(sysView.DefaultLeaseTTL().Seconds()),
-			"max_lease_ttl":     int(sysView.MaxLeaseTTL().Seconds()),
-		},
-	}
+Only the active node serves the stream. Reading this path is only used to
+check that the token is allowed to subscribe.
+		`,
+	},
 
-	return resp, nil
-}
+	"loggers": {
+		"Configure the log output of the server at runtime.",
+		`
+This path responds to the following HTTP methods.
 
-// handleAuthTuneWrite is used to set config settings on an auth path
-func (b *SystemBackend) handleAuthTuneWrite(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	path := data.Get("path").(string)
-	if path == "" {
-		return logical.ErrorResponse("path must be specified as a string"),
-			logical.ErrInvalidRequest
-	}
-	return b.handleTuneWriteCommon("auth/"+path, data)
-}
+    GET /
+        Returns the default log level, the levels set for subsystems and
+        the names of the log sinks.
 
-// handleMountTuneWrite is used to set config settings on a backend
-func (b *SystemBackend) handleMountTuneWrite(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	path := data.Get("path").(string)
-	if path == "" {
-		return logical.ErrorResponse("path must be specified as a string"),
-			logical.ErrInvalidRequest
-	}
-	// This call will write both logical backend's configuration as well as auth backends'.
-	// Retaining this behavior for backward compatibility. If this behavior is not desired,
-	// an error can be returned if path has a prefix of "auth/".
-	return b.handleTuneWriteCommon(path, data)
-}
+    POST /
+        Sets the default log level.
 
-// handleTuneWriteCommon is used to set config settings on a path
-func (b *SystemBackend) handleTuneWriteCommon(
-	path string, data *framework.FieldData) (*logical.Response, error) {
-	path = sanitizeMountPath(path)
+    GET /<subsystem>
+        Returns the log level of a subsystem.
 
-	// Prevent protected paths from being changed
-	for _, p := range untunableMounts {
-		if strings.HasPrefix(path, p) {
-			err := fmt.Errorf("[ERR] core: cannot tune '%s'", path)
-			b.Backend.Logger().Print(err)
-			return handleError(err)
-		}
-	}
+    POST /<subsystem>
+        Sets the log level of a subsystem.
 
-	mountEntry := b.Core.router.MatchingMountEntry(path)
-	if mountEntry == nil {
-		err := fmt.Errorf("[ERR] sys: tune of path '%s' failed: no mount entry found", path)
-		b.Backend.Logger().Print(err)
-		return handleError(err)
-	}
+    DELETE /<subsystem>
+        Reverts a subsystem to the default log level.
 
-	var lock *sync.RWMutex
-	switch {
-	case strings.HasPrefix(path, "auth/"):
-		lock = &b.Core.authLock
-	default:
-		lock = &b.Core.mountsLock
-	}
+Changes only apply to the node that handles the request, and are lost
+when it restarts.
+		`,
+	},
+
+	"loggers_level": {
+		`The log level: one of "trace", "debug", "info", "warn" or "err".`,
+		"",
+	},
 
-	// Timing configuration parameters
-	{
-		var newDefault, newMax *time.Duration
-		defTTL := data.Get("default_lease_ttl").(string)
-		switch defTTL {
-		case "":
-		case "system":
-			tmpDef := time.Duration(0)
-			newDefault = &tmpDef
-		default:
-			tmpDef, err := duration.ParseDurationSecond(defTTL)
-			if err != nil {
-				return handleError(err)
-			}
-			newDefault = &tmpDef
-		}
+	"loggers_subsystem_name": {
+		`The subsystem: one of "core", "expiration", "audit" or "physical".`,
+		"",
+	},
 
-		maxTTL := data.Get("max_lease_ttl").(string)
-		switch maxTTL {
-		case "":
-		case "system":
-			tmpMax := time.Duration(0)
-			newMax = &tmpMax
-		default:
-			tmpMax, err := duration.ParseDurationSecond(maxTTL)
-			if err != nil {
-				return handleError(err)
-			}
-			newMax = &tmpMax
-		}
+	"loggers_subsystem": {
+		"Configure the log level of a subsystem.",
+		`
+This path responds to the following HTTP methods.
 
-		if newDefault != nil || newMax != nil {
-			lock.Lock()
-			defer lock.Unlock()
+    GET /
+        Returns the log level of the subsystem, and whether it is the
+        default level.
 
-			if err := b.tuneMountTTLs(path, &mountEntry.Config, newDefault, newMax); err != nil {
-				b.Backend.Logger().Printf("[ERR] sys: tune of path '%s' failed: %v", path, err)
-				return handleError(err)
-			}
-		}
-	}
+    POST /
+        Sets the log level of the subsystem.
 
-	return nil, nil
-}
+    DELETE /
+        Reverts the subsystem to the default log level.
+		`,
+	},
 
-// handleRenew is used to renew a lease with a given LeaseID
-func (b *SystemBackend) handleRenew(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	// Get all the options
-	leaseID := data.Get("lease_id").(string)
-	if leaseID == "" {
-		leaseID = data.Get("url_lease_id").(string)
-	}
-	incrementRaw := data.Get("increment").(int)
+	"quotas/lease-count": {
+		"Configures the quotas on the number of active leases.",
+		`
+This path responds to the following HTTP methods.
 
-	// Convert the increment
-	increment := time.Duration(incrementRaw) * time.Second
+    LIST /
+        Returns the names of the lease count quotas.
 
-	// Invoke the expiration manager directly
-	resp, err := b.Core.expiration.Renew(leaseID, increment)
-	if err != nil {
-		b.Backend.Logger().Printf("[ERR] sys: renew '%s' failed: %v", leaseID, err)
-		return handleError(err)
-	}
-	return resp, err
-}
+    GET /<name>
+        Returns a lease count quota and the number of active leases it
+        counts.
 
-// handleRevoke is used to revoke a given LeaseID
-func (b *SystemBackend) handleRevoke(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	// Get all the options
-	leaseID := data.Get("lease_id").(string)
+    POST /<name>
+        Creates a lease count quota or changes the given settings of an
+        existing one.
 
-	// Invoke the expiration manager directly
-	if err := b.Core.expiration.Revoke(leaseID); err != nil {
-		b.Backend.Logger().Printf("[ERR] sys: revoke '%s' failed: %v", leaseID, err)
-		return handleError(err)
-	}
-	return nil, nil
-}
+    DELETE /<name>
+        Removes a lease count quota.
 
-// handleRevokePrefix is used to revoke a prefix with many LeaseIDs
-func (b *SystemBackend) handleRevokePrefix(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	return b.handleRevokePrefixCommon(req, data, false)
-}
+A lease count quota caps the number of active leases issued under a path,
+including the tokens issued by an auth mount. Once the cap is reached,
+requests under the path that could issue a lease are rejected until
+leases expire or are revoked.
+		`,
+	},
 
-// handleRevokeForce is used to revoke a prefix with many LeaseIDs, ignoring errors
-func (b *SystemBackend) handleRevokeForce(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	return b.handleRevokePrefixCommon(req, data, true)
-}
+	"quotas/rate-limit": {
+		"Configures the quotas on the rate of requests.",
+		`
+This path responds to the following HTTP methods.
 
-// handleRevokePrefixCommon is used to revoke a prefix with many LeaseIDs
-func (b *SystemBackend) handleRevokePrefixCommon(
-	req *logical.Request, data *framework.FieldData, force bool) (*logical.Response, error) {
-	// Get all the options
-	prefix := data.Get("prefix").(string)
+    LIST /
+        Returns the names of the rate limit quotas.
 
-	// Invoke the expiration manager directly
-	var err error
-	if force {
-		err = b.Core.expiration.RevokeForce(prefix)
-	} else {
-		err = b.Core.expiration.RevokePrefix(prefix)
-	}
-	if err != nil {
-		b.Backend.Logger().Printf("[ERR] sys: revoke prefix '%s' failed: %v", prefix, err)
-		return handleError(err)
-	}
-	return nil, nil
-}
+    GET /<name>
+        Returns a rate limit quota.
 
-// handleAuthTable handles the "auth" endpoint to provide the auth table
-func (b *SystemBackend) handleAuthTable(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	b.Core.authLock.RLock()
-	defer b.Core.authLock.RUnlock()
+    POST /<name>
+        Creates a rate limit quota or changes the given settings of an
+        existing one.
 
-	resp := &logical.Response{
-		Data: make(map[string]interface{}),
-	}
-	for _, entry := range b.Core.auth.Entries {
-		info := map[string]interface{}{
-			"type":        entry.Type,
-			"description": entry.Description,
-			"config": map[string]interface{}{
-				"default_lease_ttl": int64(entry.Config.DefaultLeaseTTL.Seconds()),
-				"max_lease_ttl":     int64(entry.Config.MaxLeaseTTL.Seconds()),
-			},
-		}
-		resp.Data[entry.Path] = info
-	}
-	return resp, nil
-}
+    DELETE /<name>
+        Removes a rate limit quota.
 
-// handleEnableAuth is used to enable a new credential backend
-func (b *SystemBackend) handleEnableAuth(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	// Get all the options
-	path := data.Get("path").(string)
-	logicalType := data.Get("type").(string)
-	description := data.Get("description").(string)
+A rate limit quota limits the rate of the requests under a path, all
+clients included. Requests beyond the rate are rejected and audited. The
+requests to sys/quotas are exempt, so that a quota can always be changed.
+		`,
+	},
 
-	if logicalType == "" {
-		return logical.ErrorResponse(
-				"backend type must be specified as a string"),
-			logical.ErrInvalidRequest
-	}
+	"storage/snapshots/config": {
+		"Configures the automated snapshots of the storage.",
+		`
+This path responds to the following HTTP methods.
 
-	path = sanitizeMountPath(path)
+    LIST /
+        Returns the names of the automated snapshot configurations.
 
-	// Create the mount entry
-	me := &MountEntry{
-		Table:       credentialTableType,
-		Path:        path,
-		Type:        logicalType,
-		Description: description,
-	}
+    GET /<name>
+        Returns an automated snapshot configuration, without its secrets.
 
-	// Attempt enabling
-	if err := b.Core.enableCredential(me); err != nil {
-		b.Backend.Logger().Printf("[ERR] sys: enable auth %s failed: %v", me.Path, err)
-		return handleError(err)
-	}
-	return nil, nil
-}
+    POST /<name>
+        Creates an automated snapshot configuration or changes the given
+        settings of an existing one.
 
-// handleDisableAuth is used to disable a credential backend
-func (b *SystemBackend) handleDisableAuth(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	suffix := strings.TrimPrefix(req.Path, "auth/")
-	if len(suffix) == 0 {
-		return logical.ErrorResponse("path cannot be blank"), logical.ErrInvalidRequest
-	}
+    DELETE /<name>
+        Removes an automated snapshot configuration. The snapshots already
+        taken are kept.
+
+The active node takes a snapshot of the storage every interval and uploads
+it to a local directory, S3, Cloud Storage or Azure Blob Storage, then
+removes the oldest snapshots of the configuration beyond the retained
+number. A snapshot is a gzipped tar archive of the storage entries, still
+encrypted by the barrier, with their SHA-256 checksums.
+		`,
+	},
 
-	suffix = sanitizeMountPath(suffix)
+	"storage/snapshots/status": {
+		"Returns the status of the automated snapshots of a configuration.",
+		`
+Returns when the last snapshot was taken, where it was uploaded and its
+SHA-256 checksum, or the error it failed with, and when the next snapshot
+is due.
+		`,
+	},
 
-	// Attempt disable
-	if err := b.Core.disableCredential(suffix); err != nil {
-		b.Backend.Logger().Printf("[ERR] sys: disable auth '%s' failed: %v", suffix, err)
-		return handleError(err)
-	}
-	return nil, nil
-}
+	"snapshot_name": {
+		"The name of the automated snapshot configuration.",
+		"",
+	},
 
-// handlePolicyList handles the "policy" endpoint to provide the enabled policies
-func (b *SystemBackend) handlePolicyList(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	// Get all the configured policies
-	policies, err := b.Core.policyStore.ListPolicies()
+	"snapshot_interval": {
+		"The time between snapshots, in seconds or as a duration string.",
+		"",
+	},
 
-	// Add the special "root" policy
-	policies = append(policies, "root")
-	resp := logical.ListResponse(policies)
+	"snapshot_retain": {
+		"The number of snapshots to keep. Defaults to 1.",
+		"",
+	},
 
-	// Backwords compatibility
-	resp.Data["policies"] = resp.Data["keys"]
+	"snapshot_storage_type": {
+		"Where the snapshots are uploaded: local, aws-s3, google-gcs or azure-blob.",
+		"",
+	},
 
-	return resp, err
-}
+	"snapshot_path_prefix": {
+		"The directory of the snapshots for the local storage type, and the prefix of their object names otherwise.",
+		"",
+	},
 
-// handlePolicyRead handles the "policy/<name>" endpoint to read a policy
-func (b *SystemBackend) handlePolicyRead(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	name := data.Get("name").(string)
+	"snapshot_file_prefix": {
+		`The prefix of the names of the snapshots, followed by the time they
+were taken. Defaults to "vault-snapshot".`,
+		"",
+	},
 
-	policy, err := b.Core.policyStore.GetPolicy(name)
-	if err != nil {
-		return handleError(err)
-	}
+	"policies/egp": {
+		"Configures the endpoint governing policies.",
+		`
+This path responds to the following HTTP methods.
 
-	if policy == nil {
-		return nil, nil
-	}
+    LIST /
+        Returns the names of the endpoint governing policies.
 
-	return &logical.Response{
-		Data: map[string]interface{}{
-			"name":  name,
-			"rules": policy.Raw,
-		},
-	}, nil
-}
+    GET /<name>
+        Returns an endpoint governing policy.
 
-// handlePolicySet handles the "policy/<name>" endpoint to set a policy
-func (b *SystemBackend) handlePolicySet(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	name := data.Get("name").(string)
-	rules := data.Get("rules").(string)
+    POST /<name>
+        Creates an endpoint governing policy or changes the given settings
+        of an existing one.
 
-	// Validate the rules parse
-	parse, err := Parse(rules)
-	if err != nil {
-		return handleError(err)
-	}
+    DELETE /<name>
+        Removes an endpoint governing policy.
+
+An endpoint governing policy restricts every request to its paths, whatever
+the token of the request and even without one, such as the requests to
+sys/seal. It can require the client address to belong to a set of CIDR
+blocks, and the token to come from a login verified with MFA. Rejections
+are audited. The requests to sys/policies/egp are exempt, so that a policy
+can always be changed.
+		`,
+	},
 
-	// Override the name
-	parse.Name = strings.ToLower(name)
+	"egp_name": {
+		"The name of the endpoint governing policy.",
+		"",
+	},
 
-	// Update the policy
-	if err := b.Core.policyStore.SetPolicy(parse); err != nil {
-		return handleError(err)
-	}
-	return nil, nil
-}
+	"egp_paths": {
+		`Comma-separated list of the request paths the policy applies to, such
+as "sys/seal". Paths ending with "*" are prefixes, such as "sys/rekey/*".`,
+		"",
+	},
 
-// handlePolicyDelete handles the "policy/<name>" endpoint to delete a policy
-func (b *SystemBackend) handlePolicyDelete(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	name := data.Get("name").(string)
+	"egp_bound_cidrs": {
+		`Comma-separated list of the CIDR blocks the client address must belong
+to. By default, requests are allowed from any address.`,
+		"",
+	},
 
-	if err := b.Core.policyStore.DeletePolicy(name); err != nil {
-		return handleError(err)
-	}
-	return nil, nil
-}
+	"egp_require_mfa": {
+		`Whether the token of the request must come from a login verified with
+MFA. Requests without a token are then rejected.`,
+		"",
+	},
 
-// handleAuditTable handles the "audit" endpoint to provide the audit table
-func (b *SystemBackend) handleAuditTable(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	b.Core.auditLock.RLock()
-	defer b.Core.auditLock.RUnlock()
+	"mfa/method": {
+		"Configures the MFA methods.",
+		`
+This path responds to the following HTTP methods.
 
-	resp := &logical.Response{
-		Data: make(map[string]interface{}),
-	}
-	for _, entry := range b.Core.audit.Entries {
-		info := map[string]interface{}{
-			"path":        entry.Path,
-			"type":        entry.Type,
-			"description": entry.Description,
-			"options":     entry.Options,
-		}
-		resp.Data[entry.Path] = info
-	}
-	return resp, nil
-}
+    LIST /
+        Returns the names of the MFA methods of all types.
 
-// handleAuditHash is used to fetch the hash of the given input data with the
-// specified audit backend's salt
-func (b *SystemBackend) handleAuditHash(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	path := data.Get("path").(string)
-	input := data.Get("input").(string)
-	if input == "" {
-		return logical.ErrorResponse("the \"input\" parameter is empty"), nil
-	}
+    GET /<type>/<name>
+        Returns an MFA method, without its secrets.
 
-	path = sanitizeMountPath(path)
+    POST /<type>/<name>
+        Creates an MFA method or changes the given settings of an existing
+        one.
 
-	hash, err := b.Core.auditBroker.GetHash(path, input)
-	if err != nil {
-		return logical.ErrorResponse(err.Error()), nil
-	}
+    DELETE /<type>/<name>
+        Removes an MFA method, which must not be used by an enforcement.
 
-	return &logical.Response{
-		Data: map[string]interface{}{
-			"hash": hash,
-		},
-	}, nil
-}
+The supported types are "totp", "duo" and "pingid". An MFA method is only
+required for the logins and requests targeted by an MFA enforcement.
+		`,
+	},
 
-// handleEnableAudit is used to enable a new audit backend
-func (b *SystemBackend) handleEnableAudit(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	// Get all the options
-	path := data.Get("path").(string)
-	backendType := data.Get("type").(string)
-	description := data.Get("description").(string)
-	options := data.Get("options").(map[string]interface{})
+	"mfa/method/totp": {
+		"Configures a TOTP MFA method.",
+		`
+A TOTP method validates the time-based one-time passcodes of an
+authenticator app. Each entity has its own secret for the method, which it
+generates through sys/mfa/totp/<name>/generate. A passcode is only accepted
+once, and the secret is locked after too many invalid passcodes in a row.
+		`,
+	},
 
-	optionMap := make(map[string]string)
-	for k, v := range options {
-		vStr, ok := v.(string)
-		if !ok {
-			return logical.ErrorResponse("options must be string valued"),
-				logical.ErrInvalidRequest
-		}
-		optionMap[k] = vStr
-	}
+	"mfa/method/totp/admin": {
+		"Manages the TOTP secrets of entities.",
+		`
+This path responds to the following HTTP methods.
 
-	// Create the mount entry
-	me := &MountEntry{
-		Table:       auditTableType,
-		Path:        path,
-		Type:        backendType,
-		Description: description,
-		Options:     optionMap,
-	}
+    POST /admin-generate
+        Generates the TOTP secret of an entity, and returns the otpauth URL
+        to enroll it in an authenticator app.
 
-	// Attempt enabling
-	if err := b.Core.enableAudit(me); err != nil {
-		b.Backend.Logger().Printf("[ERR] sys: enable audit %s failed: %v", me.Path, err)
-		return handleError(err)
-	}
-	return nil, nil
-}
+    POST /admin-destroy
+        Removes the TOTP secret of an entity, so that a new one can be
+        generated.
+		`,
+	},
 
-// handleDisableAudit is used to disable an audit backend
-func (b *SystemBackend) handleDisableAudit(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	path := data.Get("path").(string)
+	"mfa/method/duo": {
+		"Configures a Duo MFA method.",
+		`
+A Duo method authenticates users with the Duo Auth API, through a push
+notification or a passcode.
+		`,
+	},
 
-	// Attempt disable
-	if err := b.Core.disableAudit(path); err != nil {
-		b.Backend.Logger().Printf("[ERR] sys: disable audit '%s' failed: %v", path, err)
-		return handleError(err)
-	}
-	return nil, nil
-}
+	"mfa/method/pingid": {
+		"Configures a PingID MFA method.",
+		`
+A PingID method authenticates users with PingID, through a notification
+the user approves. It is configured with the settings file of the PingID
+tenant.
+		`,
+	},
 
-// handleRawRead is used to read directly from the barrier
-func (b *SystemBackend) handleRawRead(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	path := data.Get("path").(string)
+	"mfa/totp/generate": {
+		"Generates the TOTP secret of the caller.",
+		`
+Generates the secret of the entity of the token for a TOTP method, and
+returns the otpauth URL to enroll it in an authenticator app. A secret that
+was already generated must be destroyed by an administrator first.
+		`,
+	},
 
-	// Prevent access of protected paths
-	for _, p := range protectedPaths {
-		if strings.HasPrefix(path, p) {
-			err := fmt.Sprintf("cannot read '%s'", path)
-			return logical.ErrorResponse(err), logical.ErrInvalidRequest
-		}
-	}
+	"mfa/enforcement": {
+		"Configures the MFA enforcements.",
+		`
+This path responds to the following HTTP methods.
 
-	entry, err := b.Core.barrier.Get(path)
-	if err != nil {
-		return handleError(err)
-	}
-	if entry == nil {
-		return nil, nil
-	}
-	resp := &logical.Response{
-		Data: map[string]interface{}{
-			"value": string(entry.Value),
-		},
-	}
-	return resp, nil
-}
+    LIST /
+        Returns the names of the MFA enforcements.
 
-// handleRawWrite is used to write directly to the barrier
-func (b *SystemBackend) handleRawWrite(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	path := data.Get("path").(string)
+    GET /<name>
+        Returns an MFA enforcement.
 
-	// Prevent access of protected paths
-	for _, p := range protectedPaths {
-		if strings.HasPrefix(path, p) {
-			err := fmt.Sprintf("cannot write '%s'", path)
-			return logical.ErrorResponse(err), logical.ErrInvalidRequest
-		}
-	}
+    POST /<name>
+        Creates an MFA enforcement or changes the given settings of an
+        existing one.
 
-	value := data.Get("value").(string)
-	entry := &Entry{
-		Key:   path,
-		Value: []byte(value),
-	}
-	if err := b.Core.barrier.Put(entry); err != nil {
-		return logical.ErrorResponse(err.Error()), logical.ErrInvalidRequest
-	}
-	return nil, nil
-}
+    DELETE /<name>
+        Removes an MFA enforcement.
 
-// handleRawDelete is used to delete directly from the barrier
-func (b *SystemBackend) handleRawDelete(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	path := data.Get("path").(string)
+An MFA enforcement requires each of its MFA methods for the logins through
+its auth mounts and the logins of its entities, or all the logins if it
+sets neither. If it sets paths, the methods are instead required on the
+requests to these paths made with the tokens of these logins. The
+credentials are given in the X-Vault-MFA header.
+		`,
+	},
 
-	// Prevent access of protected paths
-	for _, p := range protectedPaths {
-		if strings.HasPrefix(path, p) {
-			err := fmt.Sprintf("cannot delete '%s'", path)
-			return logical.ErrorResponse(err), logical.ErrInvalidRequest
-		}
-	}
+	"namespaces": {
+		"Configures the child namespaces.",
+		`
+This path responds to the following HTTP methods.
 
-	if err := b.Core.barrier.Delete(path); err != nil {
-		return handleError(err)
-	}
-	return nil, nil
-}
+    LIST /
+        Returns the names of the namespaces directly under this namespace.
 
-// handleKeyStatus returns status information about the backend key
-func (b *SystemBackend) handleKeyStatus(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	// Get the key info
-	info, err := b.Core.barrier.ActiveKeyInfo()
-	if err != nil {
-		return nil, err
-	}
+    GET /<path>
+        Returns a child namespace.
 
-	resp := &logical.Response{
-		Data: map[string]interface{}{
-			"term":         info.Term,
-			"install_time": info.InstallTime.Format(time.RFC3339Nano),
-		},
-	}
-	return resp, nil
-}
+    POST /<path>
+        Creates a child namespace.
 
-// handleRotate is used to trigger a key rotation
-func (b *SystemBackend) handleRotate(
-	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	// Rotate to the new term
-	newTerm, err := b.Core.barrier.Rotate()
-	if err != nil {
-		b.Backend.Logger().Printf("[ERR] sys: failed to create new encryption key: %v", err)
-		return handleError(err)
-	}
-	b.Backend.Logger().Printf("[INFO] sys: installed new encryption key")
+    DELETE /<path>
+        Removes a child namespace, which must not have mounts, auth mounts
+        or namespaces of its own.
+
+A namespace is an isolated tree of mounts, auth mounts, policies and tokens
+living under its path. Requests are made in a namespace by prefixing their
+path with the path of the namespace, or by giving it in the
+X-Vault-Namespace header. Tokens issued in a namespace can only be used in
+it and its children.
+		`,
+	},
 
-	// In HA mode, we need to an upgrade path for the standby instances
-	if b.Core.ha != nil {
-		// Create the upgrade path to the new term
-		if err := b.Core.barrier.CreateUpgrade(newTerm); err != nil {
-			b.Backend.Logger().Printf("[ERR] sys: failed to create new upgrade for key term %d: %v", newTerm, err)
-		}
+	"replication/dr/primary": {
+		"Configures the cluster as a DR replication primary.",
+		`
+This path responds to the following HTTP methods.
 
-		// Schedule the destroy of the upgrade path
-		time.AfterFunc(keyRotateGracePeriod, func() {
-			if err := b.Core.barrier.DestroyUpgrade(newTerm); err != nil {
-				b.Backend.Logger().Printf("[ERR] sys: failed to destroy upgrade for key term %d: %v", newTerm, err)
-			}
-		})
-	}
-	return nil, nil
-}
+    POST /enable
+        Makes the cluster a DR primary.
 
-func sanitizeMountPath(path string) string {
-	if !strings.HasSuffix(path, "/") {
-		path += "/"
-	}
+    POST /disable
+        Stops replicating to the secondaries, and removes them.
 
-	if strings.HasPrefix(path, "/") {
-		path = path[1:]
-	}
+    POST /secondary-token
+        Registers a secondary and returns its activation token. A path
+        filter can restrict the mounts replicated to it.
 
-	return path
-}
+    POST /revoke-secondary
+        Removes a secondary, which can no longer replicate.
 
-const sysHelpRoot = `
-The system backend is built-in to Vault and cannot be remounted or
-unmounted. It contains the paths that are used to configure Vault itself
-as well as perform core operations.
-`
+A DR secondary replicates all the data of its primary, including the tokens
+and leases. It stays sealed until it is promoted, which requires a failover
+token generated with the unseal keys of the primary.
+		`,
+	},
 
-// sysHelp is all the help text for the sys backend.
-var sysHelp = map[string][2]string{
-	"init": {
-		"Initializes or returns the initialization status of the Vault.",
+	"replication/dr/primary/fetch": {
+		"Returns the changes a DR secondary has not replicated yet.",
+		`
+The secondary gives the epoch and index it has replicated up to, and gets
+the current values of the entries written since, in batches. If the
+primary no longer has the writes since that position, it returns all the
+replicated entries instead.
+		`,
+	},
+
+	"replication/dr/secondary": {
+		"Configures the cluster as a DR replication secondary.",
 		`
 This path responds to the following HTTP methods.
 
-    GET /
-        Returns the initialization status of the Vault.
+    POST /enable
+        Makes the cluster a DR secondary of the primary of the activation
+        token.
+
+The cluster is sealed, and its data is replaced with the data of the
+primary. It is then unsealed with the unseal keys of the primary once it is
+promoted.
+		`,
+	},
+
+	"dr_secondary_id": {
+		"The ID of the DR secondary.",
+		"",
+	},
+
+	"dr_primary_api_addr": {
+		`The API address the secondary reaches the primary at. Defaults to the
+redirect address of the primary node.`,
+		"",
+	},
+
+	"dr_path_filter_mode": {
+		`The mode of the path filter of the secondary: "allow" to only replicate
+the mounts under the paths, or "deny" to replicate all the mounts but those.`,
+		"",
+	},
+
+	"dr_path_filter_paths": {
+		`Comma-separated list of the paths of the path filter, such as
+"secret/", "auth/userpass/" or "ns1/".`,
+		"",
+	},
+
+	"dr_fetch_secret": {
+		"The secret of the activation token of the secondary.",
+		"",
+	},
+
+	"dr_fetch_epoch": {
+		"The epoch of the writes the secondary replicated.",
+		"",
+	},
 
-    POST /
-        Initializes a new vault.
-		`,
+	"dr_fetch_index": {
+		"The index of the last write the secondary replicated.",
+		"",
 	},
-	"generate-root": {
-		"Reads, generates, or deletes a root token regeneration process.",
-		`
-This path responds to multiple HTTP methods which change the behavior. Those
-HTTP methods are listed below.
 
-    GET /attempt
-        Reads the configuration and progress of the current root generation
-        attempt.
+	"dr_fetch_cursor": {
+		"The last key of the previous page of a full sync in progress.",
+		"",
+	},
 
-    POST /attempt
-        Initializes a new root generation attempt. Only a single root generation
-        attempt can take place at a time. One (and only one) of otp or pgp_key
-        are required.
+	"dr_activation_token": {
+		"The activation token returned by the primary for the secondary.",
+		"",
+	},
 
-    DELETE /attempt
-        Cancels any in-progress root generation attempt. This clears any
-        progress made. This must be called to change the OTP or PGP key being
-        used.
-		`,
+	"dr_ca_cert": {
+		"PEM-encoded CA certificate verifying the TLS certificate of the primary.",
+		"",
 	},
-	"seal-status": {
-		"Returns the seal status of the Vault.",
+
+	"storage/raft/join": {
+		"Adds a node to the raft cluster.",
 		`
 This path responds to the following HTTP methods.
 
-    GET /
-        Returns the seal status of the Vault. This is an unauthenticated
-        endpoint.
+    POST /
+        Adds the node with the given ID and raft address as a voter.
+
+The node must be running with the raft storage and no raft state. It
+receives the data of the cluster, and is then unsealed with the unseal keys
+of the cluster. This path is called on the active node.
 		`,
 	},
-	"seal": {
-		"Seals the Vault.",
+
+	"storage/raft/configuration": {
+		"Returns the nodes of the raft cluster.",
 		`
 This path responds to the following HTTP methods.
 
-    PUT /
-        Seals the Vault.
+    GET /
+        Returns the ID and raft address of each node, and whether it is the
+        leader and a voter.
 		`,
 	},
-	"unseal": {
-		"Unseals the Vault.",
+
+	"storage/raft/remove-peer": {
+		"Removes a node from the raft cluster.",
 		`
 This path responds to the following HTTP methods.
 
-    PUT /
-        Unseals the Vault.
+    POST /
+        Removes the node with the given ID, such as a node which was lost
+        and will not come back.
 		`,
 	},
-	"mounts": {
-		"List the currently mounted backends.",
+
+	"storage/raft/snapshot": {
+		"Saves and restores snapshots of the raft storage.",
 		`
 This path responds to the following HTTP methods.
 
     GET /
-        Lists all the mounted secret backends.
-
-    GET /<mount point>
-        Get information about the mount at the specified path.
-
-    POST /<mount point>
-        Mount a new secret backend to the mount point in the URL.
+        Returns a snapshot of the data of the cluster.
 
-    POST /<mount point>/tune
-        Tune configuration parameters for the given mount point.
+    POST /
+        Replaces the data of the cluster with the snapshot sent as an
+        application/octet-stream body.
 
-    DELETE /<mount point>
-        Unmount the specified mount point.
+After a restore the active node is sealed, and is unsealed with the unseal
+keys of the cluster the snapshot was taken of.
 		`,
 	},
 
-	"mount": {
-		`Mount a new backend at a new path.`,
-		`
-Mount a backend at a new path. A backend can be mounted multiple times at
-multiple paths in order to configure multiple separately configured backends.
-Example: you might have an AWS backend for the east coast, and one for the
-west coast.
-		`,
+	"raft_node_id": {
+		"The raft ID of the node.",
+		"",
 	},
 
-	"mount_path": {
-		`The path to mount to. Example: "aws/east"`,
+	"raft_address": {
+		"The address the raft traffic of the node is sent to.",
 		"",
 	},
 
-	"mount_type": {
-		`The type of the backend. Example: "passthrough"`,
+	"namespace_path": {
+		"The name of the child namespace.",
 		"",
 	},
 
-	"mount_desc": {
-		`User-friendly description for this mount.`,
+	"mfa_method_name": {
+		"The name of the MFA method.",
 		"",
 	},
 
-	"mount_config": {
-		`Configuration for this mount, such as default_lease_ttl
-and max_lease_ttl.`,
+	"mfa_username_format": {
+		`The template of the name of the user at the MFA service, such as
+"{{identity.entity.metadata.email}}". Defaults to the name of the entity.`,
+		"",
 	},
 
-	"tune_default_lease_ttl": {
-		`The default lease TTL for this mount.`,
+	"mfa_totp_issuer": {
+		"The name of the service shown by authenticator apps.",
+		"",
 	},
 
-	"tune_max_lease_ttl": {
-		`The max lease TTL for this mount.`,
+	"mfa_totp_period": {
+		"How long a passcode is valid. Defaults to 30 seconds.",
+		"",
 	},
 
-	"remount": {
-		"Move the mount point of an already-mounted backend.",
-		`
-This path responds to the following HTTP methods.
-
-    POST /sys/remount
-        Changes the mount point of an already-mounted backend.
-		`,
+	"mfa_totp_digits": {
+		"The number of digits of a passcode, 6 or 8. Defaults to 6.",
+		"",
 	},
 
-	"auth_tune": {
-		"Tune the configuration parameters for an auth path.",
-		`Read and write the 'default-lease-ttl' and 'max-lease-ttl' values of
-the auth path.`,
+	"mfa_totp_algorithm": {
+		`The hash function of the passcodes: "SHA1", "SHA256" or "SHA512".
+Defaults to "SHA1".`,
+		"",
 	},
 
-	"mount_tune": {
-		"Tune backend configuration parameters for this mount.",
-		`Read and write the 'default-lease-ttl' and 'max-lease-ttl' values of
-the mount.`,
+	"mfa_totp_key_size": {
+		"The size of the secrets, in bytes. Defaults to 20.",
+		"",
 	},
 
-	"renew": {
-		"Renew a lease on a secret",
-		`
-When a secret is read, it may optionally include a lease interval
-and a boolean indicating if renew is possible. For secrets that support
-lease renewal, this endpoint is used to extend the validity of the
-lease and to prevent an automatic revocation.
-		`,
+	"mfa_totp_skew": {
+		`The number of periods before and after the current one whose passcodes
+are accepted as well, 0 or 1. Defaults to 0.`,
+		"",
 	},
 
-	"lease_id": {
-		"The lease identifier to renew. This is included with a lease.",
+	"mfa_totp_max_validation_attempts": {
+		`The number of invalid passcodes in a row after which the secret of an
+entity is locked, until it is destroyed and generated again. Defaults to 5.`,
 		"",
 	},
 
-	"increment": {
-		"The desired increment in seconds to the lease",
+	"mfa_totp_entity_id": {
+		"The ID of the identity entity.",
 		"",
 	},
 
-	"revoke": {
-		"Revoke a leased secret immediately",
-		`
-When a secret is generated with a lease, it is automatically revoked
-at the end of the lease period if not renewed. However, in some cases
-you may want to force an immediate revocation. This endpoint can be
-used to revoke the secret with the given Lease ID.
-		`,
+	"mfa_duo_integration_key": {
+		"The integration key of the Duo application.",
+		"",
 	},
 
-	"revoke-prefix": {
-		"Revoke all secrets generated in a given prefix",
-		`
-Revokes all the secrets generated under a given mount prefix. As
-an example, "prod/aws/" might be the AWS logical backend, and due to
-a change in the "ops" policy, we may want to invalidate all the secrets
-generated. We can do a revoke prefix at "prod/aws/ops" to revoke all
-the ops secrets. This does a prefix match on the Lease IDs and revokes
-all matching leases.
-		`,
+	"mfa_duo_secret_key": {
+		"The secret key of the Duo application.",
+		"",
 	},
 
-	"revoke-prefix-path": {
-		`The path to revoke keys under. Example: "prod/aws/ops"`,
+	"mfa_duo_api_hostname": {
+		"The API hostname of the Duo application.",
 		"",
 	},
 
-	"revoke-force": {
-		"Revoke all secrets generated in a given prefix, ignoring errors.",
-		`
-See the path help for 'revoke-prefix'; this behaves the same, except that it
-ignores errors encountered during revocation. This can be used in certain
-recovery situations; for instance, when you want to unmount a backend, but it
-is impossible to fix revocation errors and these errors prevent the unmount
-from proceeding. This is a DANGEROUS operation as it removes Vault's oversight
-of external secrets. Access to this prefix should be tightly controlled.
-		`,
+	"mfa_duo_push_info": {
+		"URL-encoded key/value pairs sent along with push notifications.",
+		"",
 	},
 
-	"revoke-force-path": {
-		`The path to revoke keys under. Example: "prod/aws/ops"`,
+	"mfa_duo_use_passcode": {
+		"Whether users must give a passcode instead of approving a push notification.",
 		"",
 	},
 
-	"auth-table": {
-		"List the currently enabled credential backends.",
-		`
-This path responds to the following HTTP methods.
-
-    GET /
-        List the currently enabled credential backends: the name, the type of
-        the backend, and a user friendly description of the purpose for the
-        credential backend.
-
-    POST /<mount point>
-        Enable a new auth backend.
-
-    DELETE /<mount point>
-        Disable the auth backend at the given mount point.
-		`,
+	"mfa_pingid_settings_file": {
+		"The settings file of the PingID tenant, base64 encoded.",
+		"",
 	},
 
-	"auth": {
-		`Enable a new credential backend with a name.`,
-		`
-Enable a credential mechanism at a new path. A backend can be mounted multiple times at
-multiple paths in order to configure multiple separately configured backends.
-Example: you might have an OAuth backend for GitHub, and one for Google Apps.
-		`,
+	"mfa_enforcement_name": {
+		"The name of the MFA enforcement.",
+		"",
 	},
 
-	"auth_path": {
-		`The path to mount to. Cannot be delimited. Example: "user"`,
+	"mfa_enforcement_method_names": {
+		"Comma-separated list of the MFA methods required, each of them.",
 		"",
 	},
 
-	"auth_type": {
-		`The type of the backend. Example: "userpass"`,
+	"mfa_enforcement_auth_mounts": {
+		`Comma-separated list of the auth mounts whose logins are targeted, such
+as "userpass/".`,
 		"",
 	},
 
-	"auth_desc": {
-		`User-friendly description for this crential backend.`,
+	"mfa_enforcement_entity_ids": {
+		"Comma-separated list of the IDs of the identity entities whose logins are targeted.",
 		"",
 	},
 
-	"policy-list": {
-		`List the configured access control policies.`,
-		`
-This path responds to the following HTTP methods.
+	"mfa_enforcement_paths": {
+		`Comma-separated list of the request paths the MFA methods are required
+on, instead of at login. Paths ending with "*" are prefixes.`,
+		"",
+	},
 
-    GET /
-        List the names of the configured access control policies.
+	"quota_name": {
+		"The name of the quota.",
+		"",
+	},
 
-    GET /<name>
-        Retrieve the rules for the named policy.
+	"rate_quota_path": {
+		`The prefix of the request paths the quota applies to, such as a mount
+like "secret/". By default, the quota applies to all requests.`,
+		"",
+	},
 
-    PUT /<name>
-        Add or update a policy.
+	"rate_quota_rate": {
+		"The number of requests allowed per second on average.",
+		"",
+	},
 
-    DELETE /<name>
-        Delete the policy with the given name.
-		`,
+	"rate_quota_burst": {
+		`The number of requests allowed in a burst. Defaults to one second's
+worth of requests.`,
+		"",
 	},
 
-	"policy": {
-		`Read, Modify, or Delete an access control policy.`,
-		`
-Read the rules of an existing policy, create or update the rules of a policy,
-or delete a policy.
-		`,
+	"rate_quota_block_interval": {
+		`How long all requests under the path are rejected once the rate is
+exceeded. By default, requests are allowed again as soon as the rate allows.`,
+		"",
 	},
 
-	"policy-name": {
-		`The name of the policy. Example: "ops"`,
+	"quota_path": {
+		`The path the quota applies to, such as a mount like "aws/" or the path
+of a role like "aws/creds/deploy". By default, the quota applies to all
+the leases.`,
 		"",
 	},
 
-	"policy-rules": {
-		`The rules of the policy. Either given in HCL or JSON format.`,
+	"quota_role": {
+		`The role of the auth mount given as path the quota applies to. Only the
+tokens issued for that role are counted.`,
 		"",
 	},
 
-	"audit-hash": {
-		"The hash of the given string via the given audit backend",
+	"quota_max_leases": {
+		"The maximum number of active leases.",
 		"",
 	},
 
-	"audit-table": {
-		"List the currently enabled audit backends.",
+	"loggers_sinks": {
+		"Add or remove destinations of the log output.",
 		`
 This path responds to the following HTTP methods.
 
-    GET /
-        List the currently enabled audit backends.
+    LIST /
+        Returns the names of the log sinks.
 
-    PUT /<path>
-        Enable an audit backend at the given path.
+    GET /<name>
+        Returns the configuration of a log sink.
 
-    DELETE /<path>
-        Disable the given audit backend.
+    POST /<name>
+        Creates or replaces a log sink, which receives the log messages in
+        addition to the standard error of the server.
+
+    DELETE /<name>
+        Removes a log sink.
 		`,
 	},
 
-	"audit_path": {
-		`The name of the backend. Cannot be delimited. Example: "mysql"`,
+	"loggers_sink_name": {
+		"The name of the log sink.",
 		"",
 	},
 
-	"audit_type": {
-		`The type of the backend. Example: "mysql"`,
+	"loggers_sink_type": {
+		`The type of the log sink: "file" or "syslog".`,
 		"",
 	},
 
-	"audit_desc": {
-		`User-friendly description for this audit backend.`,
+	"loggers_sink_level": {
+		`The minimum level of the messages sent to the sink. By default, the
+sink receives the same messages as the standard error of the server.`,
 		"",
 	},
 
-	"audit_opts": {
-		`Configuration options for the audit backend.`,
+	"loggers_sink_options": {
+		`Configuration options for the sink: "path" for a file sink, and
+"facility" and "tag" for a syslog sink.`,
 		"",
 	},
 
-	"audit": {
-		`Enable or disable audit backends.`,
+	"metrics": {
+		"Export the telemetry of the active node in Prometheus format.",
 		`
-Enable a new audit backend or disable an existing backend.
-		`,
-	},
+This path responds to the following HTTP methods.
 
-	"key-status": {
-		"Provides information about the backend encryption key.",
-		`
-		Provides the current backend encryption key term and installation time.
+    GET /
+        Returns the gauges, counters and timings collected since the
+        server started, in the Prometheus text exposition format.
+
+Requests to a standby node are forwarded, so the metrics are always those
+of the active node. Timings are summaries of their values in milliseconds.
 		`,
 	},
 
-	"rotate": {
-		"Rotates the backend encryption key used to persist data.",
+	"hsm-status": {
+		"Report the connectivity of the HSM that seals the Vault.",
 		`
-		Rotate generates a new encryption key which is used to encrypt all
-		data going to the storage backend. The old encryption keys are kept so
-		that data encrypted using those keys can still be decrypted.
+This path responds to the following HTTP methods.
+
+    GET /
+        Returns the token the PKCS#11 seal is connected to, whether a
+        session with it can be opened and whether it holds the key
+        that wraps the master key.
+
+Requests to a standby node are forwarded, so the status is that of the
+HSM as seen by the active node. The request fails if the seal does not
+use an HSM.
 		`,
 	},
 
@@ -2,6 +2,7 @@ package vault
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 )
@@ -79,3 +80,79 @@ func (b *SystemBackend) tuneMountTTLs(path string, meConfig *MountConfig, newDef
 
 	return nil
 }
+
+// tuneMountMaxRequestSize is used to set the maximum request size of a
+// mount point. A size of zero removes the override.
+func (b *SystemBackend) tuneMountMaxRequestSize(path string, meConfig *MountConfig, newSize int64) error {
+	if newSize < 0 {
+		return fmt.Errorf("max request size cannot be negative")
+	}
+	if newSize == meConfig.MaxRequestSize {
+		return nil
+	}
+
+	origSize := meConfig.MaxRequestSize
+	meConfig.MaxRequestSize = newSize
+
+	// Update the mount table
+	var err error
+	switch {
+	case strings.HasPrefix(path, "auth/"):
+		err = b.Core.persistAuth(b.Core.auth)
+	default:
+		err = b.Core.persistMounts(b.Core.mounts)
+	}
+	if err != nil {
+		meConfig.MaxRequestSize = origSize
+		return fmt.Errorf("failed to update mount table, rolling back max request size change")
+	}
+
+	b.Core.logger.Printf("[INFO] core: tuned '%s'", path)
+
+	return nil
+}
+
+// tuneMountAuditKeys is used to set one of the lists of data keys the audit
+// backends handle specially for a mount point. An empty list removes it.
+func (b *SystemBackend) tuneMountAuditKeys(path string, keys *[]string, newKeys []string) error {
+	if strings.Join(*keys, ",") == strings.Join(newKeys, ",") {
+		return nil
+	}
+
+	origKeys := *keys
+	*keys = newKeys
+
+	// Update the mount table
+	var err error
+	switch {
+	case strings.HasPrefix(path, "auth/"):
+		err = b.Core.persistAuth(b.Core.auth)
+	default:
+		err = b.Core.persistMounts(b.Core.mounts)
+	}
+	if err != nil {
+		*keys = origKeys
+		return fmt.Errorf("failed to update mount table, rolling back audit keys change")
+	}
+
+	b.Core.logger.Printf("[INFO] core: tuned '%s'", path)
+
+	return nil
+}
+
+// parseAuditKeys parses a comma-separated list of data keys, returning them
+// sorted and deduplicated. Unlike policy names, keys are case sensitive.
+func parseAuditKeys(raw string) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, key := range strings.Split(raw, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
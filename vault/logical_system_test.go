@@ -1,15 +1,23 @@
 package vault
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/fatih/structs"
 	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/helper/logutil"
+	"github.com/hashicorp/vault/helper/metricsutil"
 	"github.com/hashicorp/vault/helper/salt"
+	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
 )
 
@@ -18,10 +26,37 @@ func TestSystemBackend_RootPaths(t *testing.T) {
 		"auth/*",
 		"remount",
 		"revoke-prefix/*",
+		"leases/tidy",
+		"tokens/*",
+		"identity/*",
 		"audit",
 		"audit/*",
+		"audit-rotate-salt/*",
+		"raw",
 		"raw/*",
+		"raw-prefix",
+		"raw-prefix/*",
 		"rotate",
+		"rotate/config",
+		"config/cors",
+		"quotas/*",
+		"storage/snapshots/*",
+		"policies/egp",
+		"policies/egp/*",
+		"mfa/method",
+		"mfa/method/*",
+		"mfa/enforcement",
+		"mfa/enforcement/*",
+		"namespaces",
+		"namespaces/*",
+		"replication/dr/primary/enable",
+		"replication/dr/primary/disable",
+		"replication/dr/primary/secondary-token",
+		"replication/dr/primary/revoke-secondary",
+		"replication/dr/secondary/enable",
+		"storage/raft/*",
+		"loggers",
+		"loggers/*",
 	}
 
 	b := testSystemBackend(t)
@@ -48,7 +83,9 @@ func TestSystemBackend_mounts(t *testing.T) {
 			"config": map[string]interface{}{
 				"default_lease_ttl": resp.Data["secret/"].(map[string]interface{})["config"].(map[string]interface{})["default_lease_ttl"].(int64),
 				"max_lease_ttl":     resp.Data["secret/"].(map[string]interface{})["config"].(map[string]interface{})["max_lease_ttl"].(int64),
+				"max_request_size":  int64(0),
 			},
+			"ready": true,
 		},
 		"sys/": map[string]interface{}{
 			"type":        "system",
@@ -56,7 +93,9 @@ func TestSystemBackend_mounts(t *testing.T) {
 			"config": map[string]interface{}{
 				"default_lease_ttl": resp.Data["sys/"].(map[string]interface{})["config"].(map[string]interface{})["default_lease_ttl"].(int64),
 				"max_lease_ttl":     resp.Data["sys/"].(map[string]interface{})["config"].(map[string]interface{})["max_lease_ttl"].(int64),
+				"max_request_size":  int64(0),
 			},
+			"ready": true,
 		},
 		"cubbyhole/": map[string]interface{}{
 			"description": "per-token private secret storage",
@@ -64,7 +103,9 @@ func TestSystemBackend_mounts(t *testing.T) {
 			"config": map[string]interface{}{
 				"default_lease_ttl": resp.Data["cubbyhole/"].(map[string]interface{})["config"].(map[string]interface{})["default_lease_ttl"].(int64),
 				"max_lease_ttl":     resp.Data["cubbyhole/"].(map[string]interface{})["config"].(map[string]interface{})["max_lease_ttl"].(int64),
+				"max_request_size":  int64(0),
 			},
+			"ready": true,
 		},
 	}
 	if !reflect.DeepEqual(resp.Data, exp) {
@@ -837,6 +878,219 @@ func TestSystemBackend_auditHash(t *testing.T) {
 	}
 }
 
+func TestSystemBackend_auditRotateSalt(t *testing.T) {
+	c, b, _ := testCoreSystemBackend(t)
+	c.auditBackends["noop"] = func(config *audit.BackendConfig) (audit.Backend, error) {
+		view := &logical.InmemStorage{}
+		view.Put(&logical.StorageEntry{
+			Key:   "salt",
+			Value: []byte("foo"),
+		})
+		var err error
+		config.Salt, err = salt.NewSalt(view, &salt.Config{
+			HMAC:     sha256.New,
+			HMACType: "hmac-sha256",
+		})
+		if err != nil {
+			t.Fatalf("error getting new salt: %v", err)
+		}
+		return &NoopAudit{
+			Config: config,
+		}, nil
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "audit/foo")
+	req.Data["type"] = "noop"
+	if _, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "audit-rotate-salt/foo")
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["version"] != 2 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	hash := func(version int) string {
+		req := logical.TestRequest(t, logical.UpdateOperation, "audit-hash/foo")
+		req.Data["input"] = "bar"
+		if version != 0 {
+			req.Data["version"] = version
+		}
+		resp, err := b.HandleRequest(req)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if resp.IsError() {
+			return ""
+		}
+		return resp.Data["hash"].(string)
+	}
+
+	// The current version is tagged, while values logged before the
+	// rotation can still be looked up
+	current := hash(0)
+	if !strings.HasPrefix(current, "hmac-sha256:v2:") || hash(2) != current {
+		t.Fatalf("bad hash back: %s", current)
+	}
+	if hash(1) != "hmac-sha256:f9320baf0249169e73850cd6156ded0106e2bb6ad8cab01b7bbbebe6d1065317" {
+		t.Fatalf("bad hash back: %s", hash(1))
+	}
+	if hash(3) != "" {
+		t.Fatal("expected error for unknown version")
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "audit-rotate-salt/bar")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !resp.IsError() {
+		t.Fatalf("expected error for unknown backend: %#v", resp)
+	}
+}
+
+func TestSystemBackend_auditHashBatchVerify(t *testing.T) {
+	c, b, _ := testCoreSystemBackend(t)
+	c.auditBackends["noop"] = func(config *audit.BackendConfig) (audit.Backend, error) {
+		view := &logical.InmemStorage{}
+		view.Put(&logical.StorageEntry{
+			Key:   "salt",
+			Value: []byte("foo"),
+		})
+		var err error
+		config.Salt, err = salt.NewSalt(view, &salt.Config{
+			HMAC:     sha256.New,
+			HMACType: "hmac-sha256",
+		})
+		if err != nil {
+			t.Fatalf("error getting new salt: %v", err)
+		}
+		return &NoopAudit{
+			Config: config,
+		}, nil
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "audit/foo")
+	req.Data["type"] = "noop"
+	if _, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "audit-hash/foo")
+	req.Data["inputs"] = []interface{}{"bar", "baz", "bar"}
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	hashes, ok := resp.Data["hashes"].([]string)
+	if !ok || len(hashes) != 3 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	barHash := "hmac-sha256:f9320baf0249169e73850cd6156ded0106e2bb6ad8cab01b7bbbebe6d1065317"
+	if hashes[0] != barHash || hashes[2] != barHash || hashes[1] == barHash {
+		t.Fatalf("bad: %#v", hashes)
+	}
+
+	for _, data := range []map[string]interface{}{
+		{"inputs": []interface{}{}},
+		{"inputs": []interface{}{1}},
+		{"inputs": []interface{}{"bar"}, "input": "bar"},
+	} {
+		req = logical.TestRequest(t, logical.UpdateOperation, "audit-hash/foo")
+		req.Data = data
+		resp, err = b.HandleRequest(req)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if !resp.IsError() {
+			t.Fatalf("expected error for %#v", data)
+		}
+	}
+
+	// Hashes from before and after a rotation can be verified
+	req = logical.TestRequest(t, logical.UpdateOperation, "audit-rotate-salt/foo")
+	if _, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req = logical.TestRequest(t, logical.UpdateOperation, "audit-hash/foo")
+	req.Data["input"] = "bar"
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	rotatedHash := resp.Data["hash"].(string)
+
+	verify := func(input, hash string) *logical.Response {
+		req := logical.TestRequest(t, logical.UpdateOperation, "audit-hash-verify/foo")
+		req.Data["input"] = input
+		req.Data["hash"] = hash
+		resp, err := b.HandleRequest(req)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		return resp
+	}
+	cases := []struct {
+		input   string
+		hash    string
+		valid   bool
+		version int
+	}{
+		{"bar", barHash, true, 1},
+		{"baz", barHash, false, 1},
+		{"bar", rotatedHash, true, 2},
+		{"baz", rotatedHash, false, 2},
+	}
+	for _, tc := range cases {
+		resp := verify(tc.input, tc.hash)
+		if resp.IsError() || resp.Data["valid"] != tc.valid || resp.Data["version"] != tc.version {
+			t.Fatalf("bad: %s %s: %#v", tc.input, tc.hash, resp.Data)
+		}
+	}
+	if resp := verify("bar", "hmac-sha256:v9:abc"); !resp.IsError() {
+		t.Fatalf("expected error for unknown version: %#v", resp.Data)
+	}
+}
+
+func TestSystemBackend_auditSchema(t *testing.T) {
+	b := testSystemBackend(t)
+
+	req := logical.TestRequest(t, logical.ReadOperation, "audit-schema")
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["current_version"] != audit.SchemaVersion {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if !reflect.DeepEqual(resp.Data["versions"], audit.SchemaVersions()) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "audit-schema/1")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	schema, ok := resp.Data["schema"].(map[string]interface{})
+	if !ok || resp.Data["version"] != 1 || schema["definitions"] == nil {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "audit-schema/99")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !resp.IsError() {
+		t.Fatalf("expected error for unknown version: %#v", resp.Data)
+	}
+}
+
 func TestSystemBackend_enableAudit_invalid(t *testing.T) {
 	b := testSystemBackend(t)
 	req := logical.TestRequest(t, logical.UpdateOperation, "audit/foo")
@@ -1024,6 +1278,144 @@ func TestSystemBackend_rawDelete(t *testing.T) {
 	}
 }
 
+func TestSystemBackend_rawDisabled(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+	c.enableRaw = false
+	b := NewSystemBackend(c, &logical.BackendConfig{
+		Logger: c.logger,
+		System: logical.StaticSystemView{},
+	})
+
+	req := logical.TestRequest(t, logical.ReadOperation, "raw/sys/policy/default")
+	_, err := b.HandleRequest(req)
+	if err != logical.ErrUnsupportedPath {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestSystemBackend_rawCompressed(t *testing.T) {
+	c, b, _ := testCoreSystemBackend(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "raw/test/compressed")
+	req.Data["value"] = "foo"
+	req.Data["compressed"] = true
+	if _, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	entry, err := c.barrier.Get("test/compressed")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if entry == nil || bytes.Equal(entry.Value, []byte("foo")) {
+		t.Fatalf("expected compressed value, got %#v", entry)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "raw/test/compressed")
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["value"] != "foo" || resp.Data["compressed"] != true {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Binary values are written base64 encoded
+	req = logical.TestRequest(t, logical.UpdateOperation, "raw/test/binary")
+	req.Data["value"] = "AAEC"
+	req.Data["encoding"] = "base64"
+	if _, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	entry, err = c.barrier.Get("test/binary")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if entry == nil || !bytes.Equal(entry.Value, []byte{0, 1, 2}) {
+		t.Fatalf("bad: %#v", entry)
+	}
+}
+
+func TestSystemBackend_rawList(t *testing.T) {
+	c, b, _ := testCoreSystemBackend(t)
+
+	for _, key := range []string{"test/a", "test/b/c", "test/b/d/e", "other/f"} {
+		if err := c.barrier.Put(&Entry{Key: key, Value: []byte("bar")}); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	req := logical.TestRequest(t, logical.ListOperation, "raw/test")
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(resp.Data["keys"], []string{"a", "b/"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// The protected paths are left out from the root
+	req = logical.TestRequest(t, logical.ListOperation, "raw")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if strutil.StrListContains(resp.Data["keys"].([]string), "core/") {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	req = logical.TestRequest(t, logical.ListOperation, "raw/core")
+	if _, err := b.HandleRequest(req); err != logical.ErrInvalidRequest {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.ListOperation, "raw-prefix/test/")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	keys := resp.Data["keys"].([]string)
+	sort.Strings(keys)
+	if !reflect.DeepEqual(keys, []string{"a", "b/c", "b/d/e"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
+
+func TestSystemBackend_rawPrefixDelete(t *testing.T) {
+	c, b, _ := testCoreSystemBackend(t)
+
+	for _, key := range []string{"test/a", "test/b/c", "other/d"} {
+		if err := c.barrier.Put(&Entry{Key: key, Value: []byte("bar")}); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	// Prefixes holding protected paths cannot be deleted
+	for _, prefix := range []string{"", "co", "core/"} {
+		req := logical.TestRequest(t, logical.DeleteOperation, "raw-prefix/"+prefix)
+		if _, err := b.HandleRequest(req); err != logical.ErrInvalidRequest {
+			t.Fatalf("prefix %q: err: %v", prefix, err)
+		}
+	}
+
+	req := logical.TestRequest(t, logical.DeleteOperation, "raw-prefix/test/")
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["deleted"] != 2 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	keys, err := c.barrier.List("test/")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("bad: %v", keys)
+	}
+	if entry, _ := c.barrier.Get("other/d"); entry == nil {
+		t.Fatalf("deleted key outside of the prefix")
+	}
+}
+
 func TestSystemBackend_keyStatus(t *testing.T) {
 	b := testSystemBackend(t)
 	req := logical.TestRequest(t, logical.ReadOperation, "key-status")
@@ -1032,10 +1424,16 @@ func TestSystemBackend_keyStatus(t *testing.T) {
 		t.Fatalf("err: %v", err)
 	}
 
+	if resp.Data["encryptions"].(uint64) == 0 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
 	exp := map[string]interface{}{
-		"term": 1,
+		"term":   1,
+		"cipher": BarrierCipherAESGCM,
 	}
 	delete(resp.Data, "install_time")
+	delete(resp.Data, "encryptions")
 	if !reflect.DeepEqual(resp.Data, exp) {
 		t.Fatalf("got: %#v expect: %#v", resp.Data, exp)
 	}
@@ -1060,7 +1458,9 @@ func TestSystemBackend_rotate(t *testing.T) {
 	}
 
 	exp := map[string]interface{}{
-		"term": 2,
+		"term":        2,
+		"encryptions": uint64(0),
+		"cipher":      BarrierCipherAESGCM,
 	}
 	delete(resp.Data, "install_time")
 	if !reflect.DeepEqual(resp.Data, exp) {
@@ -1068,6 +1468,279 @@ func TestSystemBackend_rotate(t *testing.T) {
 	}
 }
 
+func TestSystemBackend_rotateConfig(t *testing.T) {
+	c, b, _ := testCoreSystemBackend(t)
+
+	req := logical.TestRequest(t, logical.ReadOperation, "rotate/config")
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	exp := map[string]interface{}{
+		"enabled":        false,
+		"max_operations": uint64(0),
+		"interval":       int64(0),
+	}
+	if !reflect.DeepEqual(resp.Data, exp) {
+		t.Fatalf("got: %#v expect: %#v", resp.Data, exp)
+	}
+
+	// Enabling requires a limit
+	req = logical.TestRequest(t, logical.UpdateOperation, "rotate/config")
+	req.Data["enabled"] = true
+	resp, err = b.HandleRequest(req)
+	if err != logical.ErrInvalidRequest {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+
+	req.Data["interval"] = "10m"
+	resp, err = b.HandleRequest(req)
+	if err != logical.ErrInvalidRequest {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+
+	req.Data["interval"] = "720h"
+	req.Data["max_operations"] = 1000000
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+
+	// Updates only change the given settings
+	req = logical.TestRequest(t, logical.UpdateOperation, "rotate/config")
+	req.Data["max_operations"] = 0
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+
+	exp = map[string]interface{}{
+		"enabled":        true,
+		"max_operations": uint64(0),
+		"interval":       int64(720 * 60 * 60),
+	}
+	req = logical.TestRequest(t, logical.ReadOperation, "rotate/config")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(resp.Data, exp) {
+		t.Fatalf("got: %#v expect: %#v", resp.Data, exp)
+	}
+
+	// The policy is persisted
+	if err := c.stopKeyRotation(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := c.setupKeyRotation(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if config := c.KeyRotationConfig(); !config.Enabled || config.Interval != 720*time.Hour {
+		t.Fatalf("bad: %#v", config)
+	}
+}
+
+func TestSystemBackend_metrics(t *testing.T) {
+	c, b, _ := testCoreSystemBackend(t)
+
+	// Without a sink the endpoint is disabled
+	req := logical.TestRequest(t, logical.ReadOperation, "metrics")
+	resp, err := b.HandleRequest(req)
+	if err != logical.ErrInvalidRequest {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+
+	c.prometheusSink = metricsutil.NewPrometheusSink("")
+	c.prometheusSink.IncrCounter([]string{"vault", "core", "forward_request"}, 1)
+
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp == nil || resp.Stream == nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	defer resp.Stream.Body.Close()
+	if resp.Stream.ContentType != metricsutil.PrometheusContentType {
+		t.Fatalf("bad: %q", resp.Stream.ContentType)
+	}
+	body, err := ioutil.ReadAll(resp.Stream.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(body), "vault_core_forward_request_total 1\n") {
+		t.Fatalf("bad: %s", body)
+	}
+}
+
+func TestSystemBackend_loggers(t *testing.T) {
+	c, b, _ := testCoreSystemBackend(t)
+
+	// Without a router the endpoints are disabled
+	req := logical.TestRequest(t, logical.ReadOperation, "loggers")
+	resp, err := b.HandleRequest(req)
+	if err != logical.ErrInvalidRequest {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+
+	router, err := logutil.NewRouter(ioutil.Discard, "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.logRouter = router
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "loggers")
+	req.Data["level"] = "warn"
+	if resp, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "loggers/physical")
+	req.Data["level"] = "trace"
+	if resp, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "loggers/physical")
+	req.Data["level"] = "loud"
+	if _, err := b.HandleRequest(req); err != logical.ErrInvalidRequest {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "loggers/physical")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	exp := map[string]interface{}{
+		"level":   "trace",
+		"default": false,
+	}
+	if !reflect.DeepEqual(resp.Data, exp) {
+		t.Fatalf("got: %#v expect: %#v", resp.Data, exp)
+	}
+
+	dir, err := ioutil.TempDir("", "vault-loggers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "loggers/sinks/debug")
+	req.Data["type"] = "file"
+	req.Data["level"] = "debug"
+	req.Data["options"] = map[string]interface{}{
+		"path": filepath.Join(dir, "vault.log"),
+	}
+	if resp, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "loggers")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	exp = map[string]interface{}{
+		"level": "warn",
+		"subsystems": map[string]interface{}{
+			"physical": "trace",
+		},
+		"sinks": []string{"debug"},
+	}
+	if !reflect.DeepEqual(resp.Data, exp) {
+		t.Fatalf("got: %#v expect: %#v", resp.Data, exp)
+	}
+
+	req = logical.TestRequest(t, logical.DeleteOperation, "loggers/sinks/debug")
+	if resp, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	req = logical.TestRequest(t, logical.DeleteOperation, "loggers/physical")
+	if resp, err := b.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "loggers/physical")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	exp = map[string]interface{}{
+		"level":   "warn",
+		"default": true,
+	}
+	if !reflect.DeepEqual(resp.Data, exp) {
+		t.Fatalf("got: %#v expect: %#v", resp.Data, exp)
+	}
+	if len(router.Sinks()) != 0 {
+		t.Fatalf("bad: %#v", router.Sinks())
+	}
+}
+
+func TestSystemBackend_hsmStatus(t *testing.T) {
+	c, b, _ := testCoreSystemBackend(t)
+
+	// The default seal has no HSM
+	req := logical.TestRequest(t, logical.ReadOperation, "hsm-status")
+	resp, err := b.HandleRequest(req)
+	if err != logical.ErrInvalidRequest {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+
+	client := newFakePKCS11Client()
+	client.GenerateKey("vault")
+	c.seal = newPKCS11Seal(client, "vault", false)
+
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["connected"] != true || resp.Data["key_found"] != true ||
+		resp.Data["key_label"] != "vault" || resp.Data["model"] != "SoftHSM v2" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
+
+func TestSystemBackend_leasesCount(t *testing.T) {
+	core, b, root := testCoreSystemBackend(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "secret/foo")
+	req.Data["foo"] = "bar"
+	req.Data["lease"] = "1h"
+	req.ClientToken = root
+	if _, err := core.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req = logical.TestRequest(t, logical.ReadOperation, "secret/foo")
+	req.ClientToken = root
+	if _, err := core.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "leases/count")
+	resp, err := b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	exp := map[string]interface{}{
+		"lease_count":             1,
+		"irrevocable_lease_count": 0,
+	}
+	if !reflect.DeepEqual(resp.Data, exp) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "leases/irrevocable")
+	resp, err = b.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["lease_count"] != 0 || len(resp.Data["leases"].([]map[string]interface{})) != 0 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
+
 func testSystemBackend(t *testing.T) logical.Backend {
 	c, _, _ := TestCoreUnsealed(t)
 	bc := &logical.BackendConfig{
@@ -0,0 +1,481 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// coreMFAMethodPath is used to store the MFA methods, one entry per
+	// method
+	coreMFAMethodPath = "core/mfa/method/"
+
+	// coreMFAEnforcementPath is used to store the MFA enforcements, one
+	// entry per enforcement
+	coreMFAEnforcementPath = "core/mfa/enforcement/"
+
+	// The types of MFA methods
+	mfaTypeTOTP   = "totp"
+	mfaTypeDuo    = "duo"
+	mfaTypePingID = "pingid"
+
+	// defaultMFAUsernameFormat is the name of the user at the Duo and
+	// PingID services if the method does not set a format
+	defaultMFAUsernameFormat = "{{identity.entity.name}}"
+)
+
+var (
+	// errLoadMFAFailed if loading the MFA methods and enforcements
+	// encounters an error
+	errLoadMFAFailed = errors.New("failed to load MFA configuration")
+)
+
+// MFAMethod is the configuration of a second factor users can be required
+// to provide. Only the configuration of its type is set.
+type MFAMethod struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+
+	// UsernameFormat is a template of the name of the user at the Duo or
+	// PingID service, interpolated with the entity like the paths of
+	// policies
+	UsernameFormat string `json:"username_format,omitempty"`
+
+	TOTP   *TOTPConfig   `json:"totp,omitempty"`
+	Duo    *DuoConfig    `json:"duo,omitempty"`
+	PingID *PingIDConfig `json:"pingid,omitempty"`
+}
+
+// validate checks that the method can be used, and sets the defaults of its
+// configuration
+func (m *MFAMethod) validate() error {
+	if m.Name == "" {
+		return fmt.Errorf("missing name")
+	}
+	if m.Type != mfaTypeTOTP {
+		if m.UsernameFormat == "" {
+			m.UsernameFormat = defaultMFAUsernameFormat
+		}
+		if err := validatePathTemplate(m.UsernameFormat); err != nil {
+			return fmt.Errorf("invalid username_format: %v", err)
+		}
+	}
+
+	switch m.Type {
+	case mfaTypeTOTP:
+		if m.TOTP == nil {
+			return fmt.Errorf("missing TOTP configuration")
+		}
+		return m.TOTP.validate()
+	case mfaTypeDuo:
+		if m.Duo == nil {
+			return fmt.Errorf("missing Duo configuration")
+		}
+		return m.Duo.validate()
+	case mfaTypePingID:
+		if m.PingID == nil {
+			return fmt.Errorf("missing PingID configuration")
+		}
+		return m.PingID.validate()
+	default:
+		return fmt.Errorf("unsupported MFA type %q", m.Type)
+	}
+}
+
+// username returns the name of the entity at the Duo or PingID service
+func (m *MFAMethod) username(entity *Entity) (string, error) {
+	username, ok := interpolatePathTemplate(m.UsernameFormat, entity)
+	if !ok {
+		return "", fmt.Errorf("MFA method %q cannot determine the username", m.Name)
+	}
+	return username, nil
+}
+
+// MFAEnforcement requires the MFA methods of MethodNames, each of them, for
+// the logins through AuthMounts and the logins of the entities of
+// EntityIDs. If neither is set, all the logins are targeted. If Paths are
+// set, the methods are required on the requests to these paths made with
+// the tokens of the targeted logins, instead of at login. Paths are exact
+// request paths, or prefixes if they end with "*".
+type MFAEnforcement struct {
+	Name        string   `json:"name"`
+	MethodNames []string `json:"mfa_method_names"`
+	AuthMounts  []string `json:"auth_mounts,omitempty"`
+	EntityIDs   []string `json:"identity_entity_ids,omitempty"`
+	Paths       []string `json:"paths,omitempty"`
+}
+
+// validate checks that the enforcement can be used, and normalizes its
+// auth mounts
+func (e *MFAEnforcement) validate() error {
+	if e.Name == "" {
+		return fmt.Errorf("missing name")
+	}
+	if len(e.MethodNames) == 0 {
+		return fmt.Errorf("at least one MFA method is required")
+	}
+	for i, mount := range e.AuthMounts {
+		mount = strings.Trim(mount, "/")
+		if !strings.HasPrefix(mount+"/", credentialRoutePrefix) {
+			mount = credentialRoutePrefix + mount
+		}
+		if mount == strings.TrimSuffix(credentialRoutePrefix, "/") {
+			return fmt.Errorf("invalid auth mount %q", e.AuthMounts[i])
+		}
+		e.AuthMounts[i] = mount + "/"
+	}
+	for _, path := range e.Paths {
+		if path == "" || path == "*" {
+			return fmt.Errorf("invalid path %q", path)
+		}
+	}
+	return nil
+}
+
+// targets returns whether the enforcement applies to the logins through
+// the given auth mount by the given entity
+func (e *MFAEnforcement) targets(mountPath, entityID string) bool {
+	if len(e.AuthMounts) == 0 && len(e.EntityIDs) == 0 {
+		return true
+	}
+	if strutil.StrListContains(e.AuthMounts, mountPath) {
+		return true
+	}
+	return entityID != "" && strutil.StrListContains(e.EntityIDs, entityID)
+}
+
+// matches returns whether the enforcement applies to requests to the given
+// path
+func (e *MFAEnforcement) matches(reqPath string) bool {
+	for _, path := range e.Paths {
+		if strings.HasSuffix(path, "*") {
+			if strings.HasPrefix(reqPath, strings.TrimSuffix(path, "*")) {
+				return true
+			}
+		} else if reqPath == path {
+			return true
+		}
+	}
+	return false
+}
+
+// mfaError is returned when the MFA validation of a request fails. It is a
+// permission denied error, with the reason as message.
+func mfaError(err error) error {
+	return errwrap.Wrap(errutil.WithCode(errutil.CodeMFARequired,
+		fmt.Errorf("MFA validation failed: %v", err)), logical.ErrPermissionDenied)
+}
+
+// enforceLoginMFA validates the MFA credentials of a login through the
+// given auth mount by the given entity, if an enforcement targets it
+func (c *Core) enforceLoginMFA(req *logical.Request, mountPath, entityID string) error {
+	c.mfaLock.RLock()
+	var methodNames []string
+	for _, e := range c.mfaEnforcements {
+		if len(e.Paths) == 0 && e.targets(mountPath, entityID) {
+			methodNames = append(methodNames, e.MethodNames...)
+		}
+	}
+	c.mfaLock.RUnlock()
+
+	return c.validateMFA(req, methodNames, entityID)
+}
+
+// enforcePathMFA validates the MFA credentials of a request made with the
+// given token, if an enforcement targets the token and the request path
+func (c *Core) enforcePathMFA(req *logical.Request, te *TokenEntry) error {
+	c.mfaLock.RLock()
+	var methodNames []string
+	if len(c.mfaEnforcements) > 0 {
+		mountPath := c.router.MatchingMount(te.Path)
+		for _, e := range c.mfaEnforcements {
+			if e.matches(req.Path) && e.targets(mountPath, te.EntityID) {
+				methodNames = append(methodNames, e.MethodNames...)
+			}
+		}
+	}
+	c.mfaLock.RUnlock()
+
+	return c.validateMFA(req, methodNames, te.EntityID)
+}
+
+// validateMFA validates the credentials of the request for each of the
+// given methods, and records the methods validated in the request
+func (c *Core) validateMFA(req *logical.Request, methodNames []string, entityID string) error {
+	if len(methodNames) == 0 {
+		return nil
+	}
+
+	var entity *Entity
+	if entityID != "" && c.identityStore != nil {
+		entity = c.identityStore.Entity(entityID)
+	}
+
+	req.MFAValidated = nil
+	seen := make(map[string]bool, len(methodNames))
+	for _, name := range methodNames {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		method := c.MFAMethod(name)
+		if method == nil {
+			c.logger.Printf("[ERR] core: MFA method %s not found", name)
+			return ErrInternalError
+		}
+		creds, ok := req.MFACreds[name]
+		if !ok {
+			return mfaError(fmt.Errorf("MFA method %q is required", name))
+		}
+		var passcode string
+		if len(creds) > 0 {
+			passcode = creds[0]
+		}
+
+		var err error
+		switch method.Type {
+		case mfaTypeTOTP:
+			err = c.validateTOTP(method, entity, passcode)
+		case mfaTypeDuo:
+			err = c.validateDuo(req, method, entity, passcode)
+		case mfaTypePingID:
+			err = c.validatePingID(method, entity)
+		}
+		if err != nil {
+			if err == ErrInternalError {
+				return err
+			}
+			return mfaError(err)
+		}
+		req.MFAValidated = append(req.MFAValidated, name)
+	}
+	return nil
+}
+
+// MFAMethod returns the named MFA method, or nil if it does not exist
+func (c *Core) MFAMethod(name string) *MFAMethod {
+	c.mfaLock.RLock()
+	defer c.mfaLock.RUnlock()
+	return c.mfaMethods[name]
+}
+
+// MFAMethodNames returns the names of the MFA methods, sorted
+func (c *Core) MFAMethodNames() []string {
+	c.mfaLock.RLock()
+	defer c.mfaLock.RUnlock()
+	names := make([]string, 0, len(c.mfaMethods))
+	for name := range c.mfaMethods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// MFAEnforcement returns the named MFA enforcement, or nil if it does not
+// exist
+func (c *Core) MFAEnforcement(name string) *MFAEnforcement {
+	c.mfaLock.RLock()
+	defer c.mfaLock.RUnlock()
+	return c.mfaEnforcements[name]
+}
+
+// MFAEnforcementNames returns the names of the MFA enforcements, sorted
+func (c *Core) MFAEnforcementNames() []string {
+	c.mfaLock.RLock()
+	defer c.mfaLock.RUnlock()
+	names := make([]string, 0, len(c.mfaEnforcements))
+	for name := range c.mfaEnforcements {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// setMFAMethod persists the given method, replacing the method with the
+// same name, which must be of the same type
+func (c *Core) setMFAMethod(method *MFAMethod) error {
+	if err := method.validate(); err != nil {
+		return err
+	}
+
+	buf, err := json.Marshal(method)
+	if err != nil {
+		return fmt.Errorf("failed to encode MFA method: %v", err)
+	}
+
+	c.mfaLock.Lock()
+	defer c.mfaLock.Unlock()
+
+	if current := c.mfaMethods[method.Name]; current != nil && current.Type != method.Type {
+		return fmt.Errorf("MFA method %q already exists with type %q", method.Name, current.Type)
+	}
+
+	if err := c.barrier.Put(&Entry{
+		Key:   coreMFAMethodPath + method.Name,
+		Value: buf,
+	}); err != nil {
+		c.logger.Printf("[ERR] core: failed to persist MFA method: %v", err)
+		return err
+	}
+
+	methods := make(map[string]*MFAMethod, len(c.mfaMethods)+1)
+	for name, m := range c.mfaMethods {
+		methods[name] = m
+	}
+	methods[method.Name] = method
+	c.mfaMethods = methods
+	return nil
+}
+
+// deleteMFAMethod removes the named method, which must not be used by an
+// enforcement. The TOTP secrets generated for it are removed as well.
+func (c *Core) deleteMFAMethod(name string) error {
+	c.mfaLock.Lock()
+	defer c.mfaLock.Unlock()
+
+	for _, e := range c.mfaEnforcements {
+		if strutil.StrListContains(e.MethodNames, name) {
+			return fmt.Errorf("MFA method %q is used by enforcement %q", name, e.Name)
+		}
+	}
+
+	if err := c.barrier.Delete(coreMFAMethodPath + name); err != nil {
+		c.logger.Printf("[ERR] core: failed to delete MFA method: %v", err)
+		return err
+	}
+	if err := c.deleteTOTPSecrets(name); err != nil {
+		return err
+	}
+
+	methods := make(map[string]*MFAMethod, len(c.mfaMethods))
+	for n, m := range c.mfaMethods {
+		if n != name {
+			methods[n] = m
+		}
+	}
+	c.mfaMethods = methods
+	return nil
+}
+
+// setMFAEnforcement persists the given enforcement, replacing the
+// enforcement with the same name, and starts enforcing it
+func (c *Core) setMFAEnforcement(enforcement *MFAEnforcement) error {
+	if err := enforcement.validate(); err != nil {
+		return err
+	}
+
+	buf, err := json.Marshal(enforcement)
+	if err != nil {
+		return fmt.Errorf("failed to encode MFA enforcement: %v", err)
+	}
+
+	c.mfaLock.Lock()
+	defer c.mfaLock.Unlock()
+
+	for _, name := range enforcement.MethodNames {
+		if c.mfaMethods[name] == nil {
+			return fmt.Errorf("MFA method %q does not exist", name)
+		}
+	}
+
+	if err := c.barrier.Put(&Entry{
+		Key:   coreMFAEnforcementPath + enforcement.Name,
+		Value: buf,
+	}); err != nil {
+		c.logger.Printf("[ERR] core: failed to persist MFA enforcement: %v", err)
+		return err
+	}
+
+	enforcements := make(map[string]*MFAEnforcement, len(c.mfaEnforcements)+1)
+	for name, e := range c.mfaEnforcements {
+		enforcements[name] = e
+	}
+	enforcements[enforcement.Name] = enforcement
+	c.mfaEnforcements = enforcements
+	return nil
+}
+
+// deleteMFAEnforcement removes the named enforcement
+func (c *Core) deleteMFAEnforcement(name string) error {
+	c.mfaLock.Lock()
+	defer c.mfaLock.Unlock()
+
+	if err := c.barrier.Delete(coreMFAEnforcementPath + name); err != nil {
+		c.logger.Printf("[ERR] core: failed to delete MFA enforcement: %v", err)
+		return err
+	}
+
+	enforcements := make(map[string]*MFAEnforcement, len(c.mfaEnforcements))
+	for n, e := range c.mfaEnforcements {
+		if n != name {
+			enforcements[n] = e
+		}
+	}
+	c.mfaEnforcements = enforcements
+	return nil
+}
+
+// loadMFA reads the MFA methods and enforcements and starts enforcing them
+func (c *Core) loadMFA() error {
+	names, err := c.barrier.List(coreMFAMethodPath)
+	if err != nil {
+		c.logger.Printf("[ERR] core: failed to list MFA methods: %v", err)
+		return errLoadMFAFailed
+	}
+	methods := make(map[string]*MFAMethod, len(names))
+	for _, name := range names {
+		raw, err := c.barrier.Get(coreMFAMethodPath + name)
+		if err != nil {
+			c.logger.Printf("[ERR] core: failed to read MFA method %s: %v", name, err)
+			return errLoadMFAFailed
+		}
+		if raw == nil {
+			continue
+		}
+		method := &MFAMethod{}
+		if err := jsonutil.DecodeJSON(raw.Value, method); err != nil {
+			c.logger.Printf("[ERR] core: failed to decode MFA method %s: %v", name, err)
+			return errLoadMFAFailed
+		}
+		methods[method.Name] = method
+	}
+
+	names, err = c.barrier.List(coreMFAEnforcementPath)
+	if err != nil {
+		c.logger.Printf("[ERR] core: failed to list MFA enforcements: %v", err)
+		return errLoadMFAFailed
+	}
+	enforcements := make(map[string]*MFAEnforcement, len(names))
+	for _, name := range names {
+		raw, err := c.barrier.Get(coreMFAEnforcementPath + name)
+		if err != nil {
+			c.logger.Printf("[ERR] core: failed to read MFA enforcement %s: %v", name, err)
+			return errLoadMFAFailed
+		}
+		if raw == nil {
+			continue
+		}
+		enforcement := &MFAEnforcement{}
+		if err := jsonutil.DecodeJSON(raw.Value, enforcement); err != nil {
+			c.logger.Printf("[ERR] core: failed to decode MFA enforcement %s: %v", name, err)
+			return errLoadMFAFailed
+		}
+		enforcements[enforcement.Name] = enforcement
+	}
+
+	c.mfaLock.Lock()
+	c.mfaMethods = methods
+	c.mfaEnforcements = enforcements
+	c.mfaLock.Unlock()
+	return nil
+}
@@ -0,0 +1,116 @@
+package vault
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/duosecurity/duo_api_golang"
+	"github.com/duosecurity/duo_api_golang/authapi"
+	"github.com/hashicorp/vault/logical"
+)
+
+// DuoConfig is the configuration of a Duo method, which uses the Duo Auth
+// API of an application
+type DuoConfig struct {
+	IntegrationKey string `json:"integration_key"`
+	SecretKey      string `json:"secret_key"`
+	APIHostname    string `json:"api_hostname"`
+
+	// PushInfo is sent along with push notifications, as URL-encoded
+	// key/value pairs
+	PushInfo string `json:"push_info,omitempty"`
+
+	// UsePasscode requires users to give a passcode instead of approving a
+	// push notification
+	UsePasscode bool `json:"use_passcode"`
+}
+
+// validate checks the configuration
+func (d *DuoConfig) validate() error {
+	if d.IntegrationKey == "" || d.SecretKey == "" || d.APIHostname == "" {
+		return fmt.Errorf("integration_key, secret_key and api_hostname are required")
+	}
+	if _, err := url.ParseQuery(d.PushInfo); err != nil {
+		return fmt.Errorf("invalid push_info: %v", err)
+	}
+	return nil
+}
+
+// validateDuo authenticates the user of the entity with Duo, with the given
+// passcode or, if there is none, with a push notification
+func (c *Core) validateDuo(req *logical.Request, method *MFAMethod, entity *Entity, passcode string) error {
+	username, err := method.username(entity)
+	if err != nil {
+		return err
+	}
+	if method.Duo.UsePasscode && passcode == "" {
+		return fmt.Errorf("MFA method %q requires a passcode", method.Name)
+	}
+
+	client := authapi.NewAuthApi(*duoapi.NewDuoApi(
+		method.Duo.IntegrationKey,
+		method.Duo.SecretKey,
+		method.Duo.APIHostname,
+		"vault",
+	))
+
+	var ipAddr string
+	if req.Connection != nil {
+		ipAddr = req.Connection.RemoteAddr
+	}
+
+	preauth, err := client.Preauth(authapi.PreauthUsername(username), authapi.PreauthIpAddr(ipAddr))
+	if err != nil || preauth == nil {
+		c.logger.Printf("[ERR] core: failed to call Duo preauth: %v", err)
+		return fmt.Errorf("could not call Duo preauth")
+	}
+	if preauth.StatResult.Stat != "OK" {
+		return fmt.Errorf("could not look up Duo user information: %s", duoStatMessage(preauth.StatResult))
+	}
+	switch preauth.Response.Result {
+	case "allow":
+		return nil
+	case "auth":
+	case "enroll":
+		return fmt.Errorf("%s (%s)", preauth.Response.Status_Msg, preauth.Response.Enroll_Portal_Url)
+	default:
+		return fmt.Errorf("%s", preauth.Response.Status_Msg)
+	}
+
+	options := []func(*url.Values){authapi.AuthUsername(username), authapi.AuthIpAddr(ipAddr)}
+	factor := "push"
+	if passcode != "" {
+		factor = "passcode"
+		options = append(options, authapi.AuthPasscode(passcode))
+	} else {
+		options = append(options, authapi.AuthDevice("auto"))
+		if method.Duo.PushInfo != "" {
+			options = append(options, authapi.AuthPushinfo(method.Duo.PushInfo))
+		}
+	}
+
+	result, err := client.Auth(factor, options...)
+	if err != nil || result == nil {
+		c.logger.Printf("[ERR] core: failed to call Duo auth: %v", err)
+		return fmt.Errorf("could not call Duo auth")
+	}
+	if result.StatResult.Stat != "OK" {
+		return fmt.Errorf("could not authenticate Duo user: %s", duoStatMessage(result.StatResult))
+	}
+	if result.Response.Result != "allow" {
+		return fmt.Errorf("%s", result.Response.Status_Msg)
+	}
+	return nil
+}
+
+// duoStatMessage returns the error message of a failed Duo API call
+func duoStatMessage(stat authapi.StatResult) string {
+	var msg string
+	if stat.Message != nil {
+		msg = *stat.Message
+	}
+	if stat.Message_Detail != nil {
+		msg += " (" + *stat.Message_Detail + ")"
+	}
+	return msg
+}
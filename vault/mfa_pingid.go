@@ -0,0 +1,197 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+)
+
+const (
+	// pingIDAuthPath is the path of the PingID API authenticating a user
+	// online, relative to the IdP URL
+	pingIDAuthPath = "/rest/4/authonline/do"
+
+	// pingIDTimeout is how long a user has to approve a PingID
+	// authentication
+	pingIDTimeout = 60 * time.Second
+)
+
+// PingIDConfig is the configuration of a PingID method, read from the
+// settings file of the PingID tenant
+type PingIDConfig struct {
+	IDPURL          string `json:"idp_url"`
+	AdminURL        string `json:"admin_url"`
+	AuthenticatorID string `json:"authenticator_id"`
+	OrgAlias        string `json:"org_alias"`
+	UseSignature    bool   `json:"use_signature"`
+
+	// Token and Key authenticate the calls to the PingID API. Key is base64
+	// encoded.
+	Token string `json:"token"`
+	Key   string `json:"use_base64_key"`
+}
+
+// parsePingIDSettings parses the base64 encoded settings file of a PingID
+// tenant, which is a Java properties file
+func parsePingIDSettings(encoded string) (*PingIDConfig, error) {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid settings file: %v", err)
+	}
+
+	config := &PingIDConfig{}
+	for _, line := range strings.Split(string(raw), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		// Values escape the colons of URLs
+		value := strings.Replace(strings.TrimSpace(parts[1]), `\:`, ":", -1)
+		switch strings.TrimSpace(parts[0]) {
+		case "idp_url":
+			config.IDPURL = value
+		case "admin_url":
+			config.AdminURL = value
+		case "authenticator_id":
+			config.AuthenticatorID = value
+		case "org_alias":
+			config.OrgAlias = value
+		case "use_signature":
+			config.UseSignature = value == "true"
+		case "token":
+			config.Token = value
+		case "use_base64_key":
+			config.Key = value
+		}
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// validate checks the configuration
+func (p *PingIDConfig) validate() error {
+	if p.IDPURL == "" || p.OrgAlias == "" || p.Token == "" || p.Key == "" {
+		return fmt.Errorf("the settings file must set idp_url, org_alias, token and use_base64_key")
+	}
+	if _, err := base64.StdEncoding.DecodeString(p.Key); err != nil {
+		return fmt.Errorf("invalid use_base64_key: %v", err)
+	}
+	return nil
+}
+
+// sign returns the JWT of the given claims, signed with the key of the
+// tenant
+func (p *PingIDConfig) sign(claims interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{
+		"alg":       "HS256",
+		"org_alias": p.OrgAlias,
+		"token":     p.Token,
+	})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + p.signature(signed), nil
+}
+
+// signature returns the signature of the signed part of a JWT
+func (p *PingIDConfig) signature(signed string) string {
+	key, _ := base64.StdEncoding.DecodeString(p.Key)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signed))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verify returns the payload of a JWT returned by the PingID API, checking
+// its signature if the tenant signs its responses
+func (p *PingIDConfig) verify(token string) ([]byte, error) {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed PingID response")
+	}
+	if p.UseSignature && !hmac.Equal([]byte(parts[2]), []byte(p.signature(parts[0]+"."+parts[1]))) {
+		return nil, fmt.Errorf("invalid signature of PingID response")
+	}
+	return base64.RawURLEncoding.DecodeString(parts[1])
+}
+
+// validatePingID authenticates the user of the entity with PingID, which
+// notifies the user's device and waits for the user to approve
+func (c *Core) validatePingID(method *MFAMethod, entity *Entity) error {
+	username, err := method.username(entity)
+	if err != nil {
+		return err
+	}
+	config := method.PingID
+
+	body, err := config.sign(map[string]interface{}{
+		"reqHeader": map[string]interface{}{
+			"locale":    "en",
+			"orgAlias":  config.OrgAlias,
+			"secretKey": config.Token,
+			"timestamp": time.Now().Format("2006-01-02 15:04:05.000"),
+			"version":   "4.9",
+		},
+		"reqBody": map[string]interface{}{
+			"spAlias":  "web",
+			"userName": username,
+		},
+	})
+	if err != nil {
+		c.logger.Printf("[ERR] core: failed to sign PingID request: %v", err)
+		return ErrInternalError
+	}
+
+	client := cleanhttp.DefaultClient()
+	client.Timeout = pingIDTimeout
+	resp, err := client.Post(strings.TrimSuffix(config.IDPURL, "/")+pingIDAuthPath,
+		"application/json", bytes.NewBufferString(body))
+	if err != nil {
+		c.logger.Printf("[ERR] core: failed to call PingID: %v", err)
+		return fmt.Errorf("could not call PingID")
+	}
+	defer resp.Body.Close()
+	raw, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		c.logger.Printf("[ERR] core: failed to read PingID response: %v", err)
+		return fmt.Errorf("could not call PingID")
+	}
+
+	payload, err := config.verify(string(raw))
+	if err != nil {
+		return err
+	}
+	var result struct {
+		ResponseBody struct {
+			ErrorID  int64  `json:"errorId"`
+			ErrorMsg string `json:"errorMsg"`
+		} `json:"responseBody"`
+	}
+	if err := json.Unmarshal(payload, &result); err != nil {
+		return fmt.Errorf("malformed PingID response: %v", err)
+	}
+	if result.ResponseBody.ErrorID != 200 {
+		return fmt.Errorf("PingID authentication failed: %s", result.ResponseBody.ErrorMsg)
+	}
+	return nil
+}
@@ -0,0 +1,403 @@
+package vault
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestTOTPConfig_Code(t *testing.T) {
+	// Test vectors of RFC 6238
+	keys := map[string][]byte{
+		"SHA1":   []byte("12345678901234567890"),
+		"SHA256": []byte("12345678901234567890123456789012"),
+		"SHA512": []byte("1234567890123456789012345678901234567890123456789012345678901234"),
+	}
+	cases := []struct {
+		Algorithm string
+		Time      int64
+		Code      string
+	}{
+		{"SHA1", 59, "94287082"},
+		{"SHA256", 59, "46119246"},
+		{"SHA512", 59, "90693936"},
+		{"SHA1", 1111111109, "07081804"},
+		{"SHA256", 1234567890, "91819424"},
+		{"SHA512", 20000000000, "47863826"},
+	}
+	for _, tc := range cases {
+		config := &TOTPConfig{Issuer: "Vault", Digits: 8, Algorithm: tc.Algorithm}
+		if err := config.validate(); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if code := config.code(keys[tc.Algorithm], time.Unix(tc.Time, 0), 0); code != tc.Code {
+			t.Fatalf("%s at %d: expected %s, got %s", tc.Algorithm, tc.Time, tc.Code, code)
+		}
+	}
+}
+
+func TestMFAMethod_Validate(t *testing.T) {
+	cases := []struct {
+		Method *MFAMethod
+		Valid  bool
+	}{
+		{&MFAMethod{Name: "totp", Type: mfaTypeTOTP, TOTP: &TOTPConfig{Issuer: "Vault"}}, true},
+		{&MFAMethod{Name: "totp", Type: mfaTypeTOTP, TOTP: &TOTPConfig{}}, false},
+		{&MFAMethod{Name: "totp", Type: mfaTypeTOTP, TOTP: &TOTPConfig{Issuer: "Vault", Digits: 7}}, false},
+		{&MFAMethod{Name: "totp", Type: mfaTypeTOTP, TOTP: &TOTPConfig{Issuer: "Vault", Algorithm: "MD5"}}, false},
+		{&MFAMethod{Name: "totp", Type: mfaTypeTOTP, TOTP: &TOTPConfig{Issuer: "Vault", Skew: 2}}, false},
+		{&MFAMethod{Name: "totp", Type: mfaTypeTOTP}, false},
+		{&MFAMethod{Type: mfaTypeTOTP, TOTP: &TOTPConfig{Issuer: "Vault"}}, false},
+		{&MFAMethod{Name: "duo", Type: mfaTypeDuo, Duo: &DuoConfig{IntegrationKey: "ikey", SecretKey: "skey", APIHostname: "api.duo.com"}}, true},
+		{&MFAMethod{Name: "duo", Type: mfaTypeDuo, Duo: &DuoConfig{IntegrationKey: "ikey", APIHostname: "api.duo.com"}}, false},
+		{&MFAMethod{Name: "duo", Type: mfaTypeDuo, UsernameFormat: "{{identity.entity.bad}}", Duo: &DuoConfig{IntegrationKey: "ikey", SecretKey: "skey", APIHostname: "api.duo.com"}}, false},
+		{&MFAMethod{Name: "sms", Type: "sms"}, false},
+	}
+	for i, tc := range cases {
+		if err := tc.Method.validate(); (err == nil) != tc.Valid {
+			t.Fatalf("%d: bad: %v", i, err)
+		}
+	}
+
+	m := &MFAMethod{Name: "duo", Type: mfaTypeDuo, Duo: &DuoConfig{IntegrationKey: "ikey", SecretKey: "skey", APIHostname: "api.duo.com"}}
+	if err := m.validate(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	username, err := m.username(&Entity{Name: "alice"})
+	if err != nil || username != "alice" {
+		t.Fatalf("bad: %s %v", username, err)
+	}
+}
+
+func TestParsePingIDSettings(t *testing.T) {
+	settings := strings.Join([]string{
+		"#Auto-Generated from PingOne",
+		"use_base64_key=a2V5",
+		"use_signature=true",
+		"token=tok",
+		`idp_url=https\://idpxnyl3m.pingidentity.com/pingid`,
+		"org_alias=org",
+	}, "\n")
+	config, err := parsePingIDSettings(base64.StdEncoding.EncodeToString([]byte(settings)))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expected := &PingIDConfig{
+		IDPURL:       "https://idpxnyl3m.pingidentity.com/pingid",
+		OrgAlias:     "org",
+		UseSignature: true,
+		Token:        "tok",
+		Key:          "a2V5",
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Fatalf("bad: %#v", config)
+	}
+
+	// Responses are verified with the key of the tenant
+	signed, err := config.sign(map[string]string{"foo": "bar"})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if payload, err := config.verify(signed); err != nil || string(payload) != `{"foo":"bar"}` {
+		t.Fatalf("bad: %s %v", payload, err)
+	}
+	if _, err := config.verify(signed + "x"); err == nil {
+		t.Fatalf("expected signature error")
+	}
+
+	if _, err := parsePingIDSettings(base64.StdEncoding.EncodeToString([]byte("token=tok"))); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestMFAEnforcement_Targets(t *testing.T) {
+	e := &MFAEnforcement{Name: "foo", MethodNames: []string{"totp"}, AuthMounts: []string{"foo", "/auth/bar/"}}
+	if err := e.validate(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(e.AuthMounts, []string{"auth/foo/", "auth/bar/"}) {
+		t.Fatalf("bad: %#v", e.AuthMounts)
+	}
+	if !e.targets("auth/foo/", "") || e.targets("auth/baz/", "") {
+		t.Fatalf("bad targets")
+	}
+
+	e = &MFAEnforcement{Name: "foo", MethodNames: []string{"totp"}, EntityIDs: []string{"alice"}}
+	if !e.targets("auth/foo/", "alice") || e.targets("auth/foo/", "bob") {
+		t.Fatalf("bad targets")
+	}
+
+	// Enforcements without mounts nor entities target all the logins
+	e = &MFAEnforcement{Name: "foo", MethodNames: []string{"totp"}}
+	if !e.targets("auth/foo/", "") {
+		t.Fatalf("bad targets")
+	}
+
+	e = &MFAEnforcement{Name: "foo", MethodNames: []string{"totp"}, Paths: []string{"secret/foo", "sys/*"}}
+	cases := map[string]bool{
+		"secret/foo":     true,
+		"secret/foo/bar": false,
+		"sys/mounts":     true,
+		"auth/sys/":      false,
+	}
+	for path, expected := range cases {
+		if actual := e.matches(path); actual != expected {
+			t.Fatalf("%s: expected %v", path, expected)
+		}
+	}
+
+	if err := (&MFAEnforcement{Name: "foo"}).validate(); err == nil {
+		t.Fatalf("expected error")
+	}
+	if err := (&MFAEnforcement{Name: "foo", MethodNames: []string{"totp"}, Paths: []string{"*"}}).validate(); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestCore_MFA(t *testing.T) {
+	c, _, root := testCoreIdentityLogin(t)
+	noop := &NoopAudit{}
+	c.auditBackends["noop"] = func(config *audit.BackendConfig) (audit.Backend, error) {
+		noop = &NoopAudit{
+			Config: config,
+		}
+		return noop, nil
+	}
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/audit/noop")
+	req.Data["type"] = "noop"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	entityID := testCoreLogin(t, c, "auth/foo/login").EntityID
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/mfa/method/totp/totp")
+	req.ClientToken = root
+	req.Data["issuer"] = "Vault"
+	req.Data["skew"] = 1
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// A method cannot be redefined with another type
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/mfa/method/duo/totp")
+	req.ClientToken = root
+	req.Data["integration_key"] = "ikey"
+	req.Data["secret_key"] = "skey"
+	req.Data["api_hostname"] = "api.duo.com"
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/mfa/method/totp/totp/admin-generate")
+	req.ClientToken = root
+	req.Data["entity_id"] = entityID
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	u, err := url.Parse(resp.Data["url"].(string))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	secret := u.Query().Get("secret")
+	key, err := base32.StdEncoding.DecodeString(secret + strings.Repeat("=", (8-len(secret)%8)%8))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Secrets are only generated once
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/mfa/enforcement/foo")
+	req.ClientToken = root
+	req.Data["mfa_method_names"] = "totp"
+	req.Data["auth_mounts"] = "foo"
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Methods used by an enforcement cannot be deleted
+	req = logical.TestRequest(t, logical.DeleteOperation, "sys/mfa/method/totp/totp")
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	login := func(path string, creds map[string][]string) (*logical.Response, error) {
+		return c.HandleRequest(&logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      path,
+			MFACreds:  creds,
+		})
+	}
+
+	if _, err := login("auth/foo/login", nil); errutil.CodeOf(err) != errutil.CodeMFARequired {
+		t.Fatalf("expected MFA required, got %v", err)
+	}
+	_, err = login("auth/foo/login", map[string][]string{"totp": []string{"000000x"}})
+	if errutil.CodeOf(err) != errutil.CodeMFARequired {
+		t.Fatalf("expected MFA required, got %v", err)
+	}
+
+	config := c.MFAMethod("totp").TOTP
+	passcode := config.code(key, time.Now(), 0)
+	resp, err = login("auth/foo/login", map[string][]string{"totp": []string{passcode}})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Auth.Metadata[mfaMethodMetaKey] != "totp" {
+		t.Fatalf("bad: %#v", resp.Auth.Metadata)
+	}
+	lastReq := noop.RespReq[len(noop.RespReq)-1]
+	if !reflect.DeepEqual(lastReq.MFAValidated, []string{"totp"}) {
+		t.Fatalf("bad: %#v", lastReq.MFAValidated)
+	}
+
+	// Other mounts are not targeted
+	if _, err := login("auth/bar/login", nil); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Requiring the method on paths instead of at login
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/mfa/enforcement/foo")
+	req.ClientToken = root
+	req.Data["paths"] = "sys/capabilities-self"
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	token := testCoreLogin(t, c, "auth/foo/login").ClientToken
+
+	capabilities := func(creds map[string][]string) error {
+		req := logical.TestRequest(t, logical.UpdateOperation, "sys/capabilities-self")
+		req.ClientToken = token
+		req.Data["token"] = token
+		req.Data["path"] = "secret/foo"
+		req.MFACreds = creds
+		_, err := c.HandleRequest(req)
+		return err
+	}
+	if err := capabilities(nil); errutil.CodeOf(err) != errutil.CodeMFARequired {
+		t.Fatalf("expected MFA required, got %v", err)
+	}
+	if err := capabilities(map[string][]string{"totp": []string{passcode}}); errutil.CodeOf(err) != errutil.CodeMFARequired {
+		t.Fatalf("expected the used passcode to be rejected, got %v", err)
+	}
+	if err := capabilities(map[string][]string{"totp": []string{config.code(key, time.Now(), 1)}}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The configuration survives a restart
+	c.mfaMethods = nil
+	c.mfaEnforcements = nil
+	if err := c.loadMFA(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(c.MFAEnforcementNames(), []string{"foo"}) {
+		t.Fatalf("bad: %#v", c.MFAEnforcementNames())
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/mfa/enforcement/foo")
+	req.ClientToken = root
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(resp.Data["auth_mounts"], []string{"auth/foo/"}) ||
+		!reflect.DeepEqual(resp.Data["paths"], []string{"sys/capabilities-self"}) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	req = logical.TestRequest(t, logical.DeleteOperation, "sys/mfa/enforcement/foo")
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	req = logical.TestRequest(t, logical.DeleteOperation, "sys/mfa/method/totp/totp")
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if c.MFAMethod("totp") != nil {
+		t.Fatalf("method not deleted")
+	}
+	if entries, _ := c.barrier.List(coreMFATOTPSecretPath + "totp/"); len(entries) != 0 {
+		t.Fatalf("secrets not deleted: %v", entries)
+	}
+}
+
+func TestCore_ValidateTOTP(t *testing.T) {
+	c, _, _ := testCoreIdentityLogin(t)
+	entity := c.identityStore.Entity(testCoreLogin(t, c, "auth/foo/login").EntityID)
+	method := &MFAMethod{
+		Name: "totp",
+		Type: mfaTypeTOTP,
+		TOTP: &TOTPConfig{
+			Issuer:                "Vault",
+			Skew:                  1,
+			MaxValidationAttempts: 2,
+		},
+	}
+	if err := c.setMFAMethod(method); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	secretKey := func() []byte {
+		if _, err := c.generateTOTPSecret("totp", entity); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		raw, err := c.barrier.Get(totpSecretKey("totp", entity.ID))
+		if err != nil || raw == nil {
+			t.Fatalf("err: %v", err)
+		}
+		var secret totpSecret
+		if err := jsonutil.DecodeJSON(raw.Value, &secret); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		return secret.Key
+	}
+	key := secretKey()
+
+	// A passcode is only accepted once, and passcodes of the periods
+	// before the last one accepted are rejected as well
+	if err := c.validateTOTP(method, entity, method.TOTP.code(key, time.Now(), 0)); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := c.validateTOTP(method, entity, method.TOTP.code(key, time.Now(), 0)); err == nil {
+		t.Fatalf("expected error")
+	}
+	if err := c.validateTOTP(method, entity, method.TOTP.code(key, time.Now(), -1)); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	// The secret is locked after too many invalid passcodes in a row,
+	// until it is generated again
+	for i := 0; i < 2; i++ {
+		if err := c.validateTOTP(method, entity, "000000x"); err == nil {
+			t.Fatalf("expected error")
+		}
+	}
+	if err := c.validateTOTP(method, entity, method.TOTP.code(key, time.Now(), 1)); err == nil {
+		t.Fatalf("expected error")
+	}
+
+	if err := c.destroyTOTPSecret("totp", entity.ID); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	key = secretKey()
+	if err := c.validateTOTP(method, entity, method.TOTP.code(key, time.Now(), 0)); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
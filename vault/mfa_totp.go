@@ -0,0 +1,335 @@
+package vault
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/helper/jsonutil"
+)
+
+const (
+	// coreMFATOTPSecretPath is used to store the TOTP secrets, one entry
+	// per method and entity
+	coreMFATOTPSecretPath = "core/mfa/totp-secret/"
+
+	// totpDefaultMaxValidationAttempts is the default number of invalid
+	// passcodes in a row after which the secret of an entity is locked
+	totpDefaultMaxValidationAttempts = 5
+)
+
+// totpAlgorithms are the hash functions TOTP codes can be computed with
+var totpAlgorithms = map[string]func() hash.Hash{
+	"SHA1":   sha1.New,
+	"SHA256": sha256.New,
+	"SHA512": sha512.New,
+}
+
+// TOTPConfig is the configuration of a TOTP method. Each entity has its own
+// secret, generated for the method.
+type TOTPConfig struct {
+	// Issuer is the name of the service shown by authenticator apps
+	Issuer string `json:"issuer"`
+
+	// Period is how long a code is valid
+	Period time.Duration `json:"period"`
+
+	// Digits is the number of digits of a code, 6 or 8
+	Digits int `json:"digits"`
+
+	// Algorithm is the hash function of the codes
+	Algorithm string `json:"algorithm"`
+
+	// KeySize is the size of the secrets, in bytes
+	KeySize int `json:"key_size"`
+
+	// Skew is the number of periods before and after the current one whose
+	// codes are accepted as well, 0 or 1
+	Skew int `json:"skew"`
+
+	// MaxValidationAttempts is the number of invalid passcodes in a row
+	// after which the secret of an entity is locked, until it is destroyed
+	// and generated again
+	MaxValidationAttempts int `json:"max_validation_attempts"`
+}
+
+// validate checks the configuration and sets its defaults
+func (t *TOTPConfig) validate() error {
+	if t.Issuer == "" {
+		return fmt.Errorf("issuer is required")
+	}
+	if t.Period == 0 {
+		t.Period = 30 * time.Second
+	}
+	if t.Period < time.Second {
+		return fmt.Errorf("period must be at least one second")
+	}
+	if t.Digits == 0 {
+		t.Digits = 6
+	}
+	if t.Digits != 6 && t.Digits != 8 {
+		return fmt.Errorf("digits must be 6 or 8")
+	}
+	if t.Algorithm == "" {
+		t.Algorithm = "SHA1"
+	}
+	if _, ok := totpAlgorithms[t.Algorithm]; !ok {
+		return fmt.Errorf("unsupported algorithm %q", t.Algorithm)
+	}
+	if t.KeySize == 0 {
+		t.KeySize = 20
+	}
+	if t.KeySize < 10 {
+		return fmt.Errorf("key_size must be at least 10 bytes")
+	}
+	if t.Skew < 0 || t.Skew > 1 {
+		return fmt.Errorf("skew must be 0 or 1")
+	}
+	if t.MaxValidationAttempts == 0 {
+		t.MaxValidationAttempts = totpDefaultMaxValidationAttempts
+	}
+	if t.MaxValidationAttempts < 1 {
+		return fmt.Errorf("max_validation_attempts must be at least 1")
+	}
+	return nil
+}
+
+// maxValidationAttempts returns the number of invalid passcodes in a row
+// after which a secret is locked. Methods stored before the setting existed
+// get the default.
+func (t *TOTPConfig) maxValidationAttempts() int {
+	if t.MaxValidationAttempts == 0 {
+		return totpDefaultMaxValidationAttempts
+	}
+	return t.MaxValidationAttempts
+}
+
+// counter returns the time step of the period containing now, offset by
+// the given number of periods
+func (t *TOTPConfig) counter(now time.Time, offset int) int64 {
+	return now.Unix()/int64(t.Period/time.Second) + int64(offset)
+}
+
+// code returns the TOTP code of the key for the period containing now,
+// offset by the given number of periods, as defined in RFC 6238
+func (t *TOTPConfig) code(key []byte, now time.Time, offset int) string {
+	return t.counterCode(key, t.counter(now, offset))
+}
+
+// counterCode returns the TOTP code of the key for a time step
+func (t *TOTPConfig) counterCode(key []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+
+	mac := hmac.New(totpAlgorithms[t.Algorithm], key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	// Dynamic truncation, as defined in RFC 4226
+	i := sum[len(sum)-1] & 0xf
+	value := binary.BigEndian.Uint32(sum[i:i+4]) & 0x7fffffff
+	mod := uint32(1)
+	for d := 0; d < t.Digits; d++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", t.Digits, value%mod)
+}
+
+// totpSecret is the TOTP secret of an entity for a method, along with the
+// state of its validations
+type totpSecret struct {
+	Key []byte `json:"key"`
+
+	// LastCounter is the time step of the last passcode accepted, so that
+	// a passcode cannot be used twice
+	LastCounter int64 `json:"last_counter,omitempty"`
+
+	// FailedAttempts is the number of invalid passcodes given in a row
+	FailedAttempts int `json:"failed_attempts,omitempty"`
+}
+
+// totpSecretKey is the storage key of the secret of an entity for a method
+func totpSecretKey(methodName, entityID string) string {
+	return coreMFATOTPSecretPath + methodName + "/" + entityID
+}
+
+// validateTOTP checks a TOTP code against the secret of the entity. Each
+// passcode is only accepted once, and the secret is locked after too many
+// invalid passcodes in a row.
+func (c *Core) validateTOTP(method *MFAMethod, entity *Entity, passcode string) error {
+	if entity == nil {
+		return fmt.Errorf("MFA method %q requires an identity entity", method.Name)
+	}
+	if passcode == "" {
+		return fmt.Errorf("MFA method %q requires a passcode", method.Name)
+	}
+
+	// The validations of a secret are serialized, so that a passcode is
+	// not accepted by two requests at once
+	c.mfaLock.Lock()
+	defer c.mfaLock.Unlock()
+
+	key := totpSecretKey(method.Name, entity.ID)
+	raw, err := c.barrier.Get(key)
+	if err != nil {
+		c.logger.Printf("[ERR] core: failed to read TOTP secret: %v", err)
+		return ErrInternalError
+	}
+	if raw == nil {
+		return fmt.Errorf("no TOTP secret was generated for MFA method %q", method.Name)
+	}
+	var secret totpSecret
+	if err := jsonutil.DecodeJSON(raw.Value, &secret); err != nil {
+		c.logger.Printf("[ERR] core: failed to decode TOTP secret: %v", err)
+		return ErrInternalError
+	}
+
+	if secret.FailedAttempts >= method.TOTP.maxValidationAttempts() {
+		return fmt.Errorf("too many invalid passcodes for MFA method %q, the TOTP secret must be generated again", method.Name)
+	}
+
+	now := time.Now()
+	var accepted int64
+	var reused bool
+	for offset := -method.TOTP.Skew; offset <= method.TOTP.Skew; offset++ {
+		counter := method.TOTP.counter(now, offset)
+		code := method.TOTP.counterCode(secret.Key, counter)
+		if subtle.ConstantTimeCompare([]byte(code), []byte(passcode)) != 1 {
+			continue
+		}
+		if counter <= secret.LastCounter {
+			reused = true
+			continue
+		}
+		accepted = counter
+	}
+
+	// A passcode that was already used is not a guess, so it does not
+	// count towards the lock
+	if reused && accepted == 0 {
+		return fmt.Errorf("passcode for MFA method %q was already used", method.Name)
+	}
+	if accepted == 0 {
+		secret.FailedAttempts++
+	} else {
+		secret.LastCounter = accepted
+		secret.FailedAttempts = 0
+	}
+
+	buf, err := json.Marshal(&secret)
+	if err != nil {
+		return fmt.Errorf("failed to encode TOTP secret: %v", err)
+	}
+	if err := c.barrier.Put(&Entry{
+		Key:   key,
+		Value: buf,
+	}); err != nil {
+		c.logger.Printf("[ERR] core: failed to persist TOTP secret: %v", err)
+		return ErrInternalError
+	}
+
+	if accepted == 0 {
+		return fmt.Errorf("invalid passcode for MFA method %q", method.Name)
+	}
+	return nil
+}
+
+// generateTOTPSecret generates the secret of the entity for a TOTP method,
+// and returns the otpauth URL to enroll it in an authenticator app. A
+// secret that was already generated must be destroyed first.
+func (c *Core) generateTOTPSecret(methodName string, entity *Entity) (string, error) {
+	method := c.MFAMethod(methodName)
+	if method == nil || method.Type != mfaTypeTOTP {
+		return "", fmt.Errorf("TOTP method %q does not exist", methodName)
+	}
+
+	c.mfaLock.Lock()
+	defer c.mfaLock.Unlock()
+
+	key := totpSecretKey(methodName, entity.ID)
+	existing, err := c.barrier.Get(key)
+	if err != nil {
+		c.logger.Printf("[ERR] core: failed to read TOTP secret: %v", err)
+		return "", ErrInternalError
+	}
+	if existing != nil {
+		return "", fmt.Errorf("a TOTP secret was already generated for the entity")
+	}
+
+	secret := totpSecret{Key: make([]byte, method.TOTP.KeySize)}
+	if _, err := rand.Read(secret.Key); err != nil {
+		return "", fmt.Errorf("failed to generate TOTP secret: %v", err)
+	}
+	buf, err := json.Marshal(&secret)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode TOTP secret: %v", err)
+	}
+	if err := c.barrier.Put(&Entry{
+		Key:   key,
+		Value: buf,
+	}); err != nil {
+		c.logger.Printf("[ERR] core: failed to persist TOTP secret: %v", err)
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("secret", strings.TrimRight(base32.StdEncoding.EncodeToString(secret.Key), "="))
+	params.Set("issuer", method.TOTP.Issuer)
+	params.Set("algorithm", method.TOTP.Algorithm)
+	params.Set("digits", strconv.Itoa(method.TOTP.Digits))
+	params.Set("period", strconv.Itoa(int(method.TOTP.Period/time.Second)))
+	account := entity.Name
+	if account == "" {
+		account = entity.ID
+	}
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + method.TOTP.Issuer + ":" + account,
+		RawQuery: params.Encode(),
+	}
+	return u.String(), nil
+}
+
+// destroyTOTPSecret removes the secret of the entity for a TOTP method, so
+// that a new one can be generated
+func (c *Core) destroyTOTPSecret(methodName, entityID string) error {
+	c.mfaLock.Lock()
+	defer c.mfaLock.Unlock()
+
+	if err := c.barrier.Delete(totpSecretKey(methodName, entityID)); err != nil {
+		c.logger.Printf("[ERR] core: failed to delete TOTP secret: %v", err)
+		return err
+	}
+	return nil
+}
+
+// deleteTOTPSecrets removes the secrets generated for a method. This must
+// be called with mfaLock held.
+func (c *Core) deleteTOTPSecrets(methodName string) error {
+	prefix := coreMFATOTPSecretPath + methodName + "/"
+	entityIDs, err := c.barrier.List(prefix)
+	if err != nil {
+		c.logger.Printf("[ERR] core: failed to list TOTP secrets: %v", err)
+		return err
+	}
+	for _, entityID := range entityIDs {
+		if err := c.barrier.Delete(prefix + entityID); err != nil {
+			c.logger.Printf("[ERR] core: failed to delete TOTP secret: %v", err)
+			return err
+		}
+	}
+	return nil
+}
@@ -6,10 +6,13 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/compressutil"
 	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
 )
 
@@ -30,6 +33,10 @@ const (
 	// mountTableType is the value we expect to find for the mount table and
 	// corresponding entries
 	mountTableType = "mounts"
+
+	// mountSetupParallelism is the number of backends that are created at
+	// once when the mounts are set up
+	mountSetupParallelism = 16
 )
 
 var (
@@ -139,8 +146,15 @@ type MountEntry struct {
 
 // MountConfig is used to hold settable options
 type MountConfig struct {
-	DefaultLeaseTTL time.Duration `json:"default_lease_ttl" structs:"default_lease_ttl" mapstructure:"default_lease_ttl"` // Override for global default
-	MaxLeaseTTL     time.Duration `json:"max_lease_ttl" structs:"max_lease_ttl" mapstructure:"max_lease_ttl"`             // Override for global default
+	DefaultLeaseTTL time.Duration `json:"default_lease_ttl" structs:"default_lease_ttl" mapstructure:"default_lease_ttl"`        // Override for global default
+	MaxLeaseTTL     time.Duration `json:"max_lease_ttl" structs:"max_lease_ttl" mapstructure:"max_lease_ttl"`                    // Override for global default
+	MaxRequestSize  int64         `json:"max_request_size,omitempty" structs:"max_request_size" mapstructure:"max_request_size"` // Override for global and listener limits
+
+	// The keys of the request and response data the audit backends log
+	// without hashing, and of the response data they log the size of
+	AuditNonHMACRequestKeys  []string `json:"audit_non_hmac_request_keys,omitempty" structs:"audit_non_hmac_request_keys" mapstructure:"audit_non_hmac_request_keys"`
+	AuditNonHMACResponseKeys []string `json:"audit_non_hmac_response_keys,omitempty" structs:"audit_non_hmac_response_keys" mapstructure:"audit_non_hmac_response_keys"`
+	AuditElideResponseKeys   []string `json:"audit_elide_response_keys,omitempty" structs:"audit_elide_response_keys" mapstructure:"audit_elide_response_keys"`
 }
 
 // Returns a deep copy of the mount entry
@@ -215,6 +229,10 @@ func (c *Core) mount(me *MountEntry) error {
 		return err
 	}
 	c.logger.Printf("[INFO] core: mounted '%s' type: %s", me.Path, me.Type)
+	c.events.Publish(EventMountEnabled, map[string]interface{}{
+		"path": me.Path,
+		"type": me.Type,
+	})
 	return nil
 }
 
@@ -279,6 +297,9 @@ func (c *Core) unmount(path string) error {
 		return err
 	}
 	c.logger.Printf("[INFO] core: unmounted '%s'", path)
+	c.events.Publish(EventMountDisabled, map[string]interface{}{
+		"path": path,
+	})
 	return nil
 }
 
@@ -388,6 +409,10 @@ func (c *Core) remount(src, dst string) error {
 	}
 
 	c.logger.Printf("[INFO] core: remounted '%s' to '%s'", src, dst)
+	c.events.Publish(EventMountMoved, map[string]interface{}{
+		"from": src,
+		"to":   dst,
+	})
 	return nil
 }
 
@@ -487,8 +512,15 @@ func (c *Core) persistMounts(table *MountTable) error {
 		}
 	}
 
-	// Encode the mount table into JSON and compress it (lzw).
-	compressedBytes, err := jsonutil.EncodeJSONAndCompress(table, nil)
+	// Encode the mount table into JSON and compress it, using gzip unless
+	// configured otherwise
+	var compressionConfig *compressutil.CompressionConfig
+	if c.storageCompression != "" {
+		compressionConfig = &compressutil.CompressionConfig{
+			Type: c.storageCompression,
+		}
+	}
+	compressedBytes, err := jsonutil.EncodeJSONAndCompress(table, compressionConfig)
 	if err != nil {
 		c.logger.Printf("[ERR] core: failed to encode and/or compress the mount table: %v", err)
 		return err
@@ -509,49 +541,73 @@ func (c *Core) persistMounts(table *MountTable) error {
 }
 
 // setupMounts is invoked after we've loaded the mount table to
-// initialize the logical backends and setup the router
+// initialize the logical backends and setup the router. The backends are
+// created in parallel; with lazy mounts, only the system and cubbyhole
+// backends are created now and the others on first use.
 func (c *Core) setupMounts() error {
 	c.mountsLock.Lock()
 	defer c.mountsLock.Unlock()
 
-	var backend logical.Backend
-	var view *BarrierView
-	var err error
+	entries := c.mounts.Entries
+	views := make([]*BarrierView, len(entries))
+	backends := make([]logical.Backend, len(entries))
+	errs := make([]error, len(entries))
 
-	for _, entry := range c.mounts.Entries {
-		// Initialize the backend, special casing for system
+	sem := make(chan struct{}, mountSetupParallelism)
+	var wg sync.WaitGroup
+	for i, entry := range entries {
+		// Create a barrier view using the UUID, special casing for system
 		barrierPath := backendBarrierPrefix + entry.UUID + "/"
 		if entry.Type == "system" {
 			barrierPath = systemBarrierPrefix
 		}
+		views[i] = NewBarrierView(c.barrier, barrierPath)
 
-		// Create a barrier view using the UUID
-		view = NewBarrierView(c.barrier, barrierPath)
+		if c.lazyMounts && !strutil.StrListContains(singletonMounts, entry.Type) {
+			continue
+		}
 
-		// Initialize the backend
 		// Create the new backend
-		backend, err = c.newLogicalBackend(entry.Type, c.mountEntrySysView(entry), view, nil)
-		if err != nil {
+		wg.Add(1)
+		go func(i int, entry *MountEntry) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			backends[i], errs[i] = c.newLogicalBackend(entry.Type, c.mountEntrySysView(entry), views[i], nil)
+		}(i, entry)
+	}
+	wg.Wait()
+
+	for i, entry := range entries {
+		if errs[i] != nil {
 			c.logger.Printf(
 				"[ERR] core: failed to create mount entry %s: %v",
-				entry.Path, err)
+				entry.Path, errs[i])
 			return errLoadMountsFailed
 		}
 
-		switch entry.Type {
-		case "system":
-			c.systemBarrierView = view
-		case "cubbyhole":
-			ch := backend.(*CubbyholeBackend)
-			ch.saltUUID = entry.UUID
-			ch.storageView = view
+		view, backend := views[i], backends[i]
+		var err error
+		if backend == nil {
+			err = c.router.MountLazy(c.lazyMountFactory(entry, view), entry.Path, entry, view)
+		} else {
+			switch entry.Type {
+			case "system":
+				c.systemBarrierView = view
+			case "cubbyhole":
+				ch := backend.(*CubbyholeBackend)
+				ch.saltUUID = entry.UUID
+				ch.storageView = view
+			}
+			err = c.router.Mount(backend, entry.Path, entry, view)
 		}
 
 		// Mount the backend
-		err = c.router.Mount(backend, entry.Path, entry, view)
 		if err != nil {
 			c.logger.Printf("[ERR] core: failed to mount entry %s: %v", entry.Path, err)
 			return errLoadMountsFailed
+		} else if backend == nil {
+			c.logger.Printf("[INFO] core: mounted backend of type %s at %s, deferring setup until first use", entry.Type, entry.Path)
 		} else {
 			c.logger.Printf("[INFO] core: mounted backend of type %s at %s", entry.Type, entry.Path)
 		}
@@ -564,6 +620,20 @@ func (c *Core) setupMounts() error {
 	return nil
 }
 
+// lazyMountFactory returns the function that creates the backend of a lazy
+// mount on first use
+func (c *Core) lazyMountFactory(entry *MountEntry, view *BarrierView) func() (logical.Backend, error) {
+	return func() (logical.Backend, error) {
+		backend, err := c.newLogicalBackend(entry.Type, c.mountEntrySysView(entry), view, nil)
+		if err != nil {
+			c.logger.Printf("[ERR] core: failed to set up backend of type %s at %s: %v", entry.Type, entry.Path, err)
+			return nil, err
+		}
+		c.logger.Printf("[INFO] core: set up backend of type %s at %s", entry.Type, entry.Path)
+		return backend, nil
+	}
+}
+
 // unloadMounts is used before we seal the vault to reset the mounts to
 // their unloaded state, calling Cleanup if defined. This is reversed by load and setup mounts.
 func (c *Core) unloadMounts() error {
@@ -576,7 +646,9 @@ func (c *Core) unloadMounts() error {
 			prefix := e.Path
 			b, ok := c.router.root.Get(prefix)
 			if ok {
-				b.(*routeEntry).backend.Cleanup()
+				if backend := b.(*routeEntry).loaded(); backend != nil {
+					backend.Cleanup()
+				}
 			}
 		}
 	}
@@ -78,6 +78,129 @@ func TestCore_Mount(t *testing.T) {
 	}
 }
 
+func TestCore_Mount_Lazy(t *testing.T) {
+	c, key, root := TestCoreUnsealed(t)
+	c.logicalBackends["noop"] = func(*logical.BackendConfig) (logical.Backend, error) {
+		return &NoopBackend{}, nil
+	}
+	me := &MountEntry{
+		Table: mountTableType,
+		Path:  "test/",
+		Type:  "noop",
+	}
+	if err := c.mount(me); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Start a second core with same physical that sets up mounts lazily
+	var created int
+	conf := &CoreConfig{
+		Physical:     c.physical,
+		DisableMlock: true,
+		LazyMounts:   true,
+		LogicalBackends: map[string]logical.Factory{
+			"noop": func(*logical.BackendConfig) (logical.Backend, error) {
+				created++
+				return &NoopBackend{}, nil
+			},
+		},
+	}
+	c2, err := NewCore(conf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	unseal, err := TestCoreUnseal(c2, key)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !unseal {
+		t.Fatalf("should be unsealed")
+	}
+
+	// Only the required backends are set up
+	for path, exp := range map[string]bool{"test/": false, "secret/": false, "sys/": true, "cubbyhole/": true} {
+		if ready, _ := c2.router.MountState(path); ready != exp {
+			t.Fatalf("bad: %s: %t", path, ready)
+		}
+	}
+	if created != 0 {
+		t.Fatalf("bad: %d", created)
+	}
+
+	// The backend is set up by the first request
+	req := &logical.Request{
+		Operation:   logical.ReadOperation,
+		Path:        "test/foo",
+		ClientToken: root,
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := c2.HandleRequest(req); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	if ready, _ := c2.router.MountState("test/"); !ready || created != 1 {
+		t.Fatalf("bad: %t %d", ready, created)
+	}
+
+	// Readiness is reported by sys/mounts
+	resp, err := c2.HandleRequest(&logical.Request{
+		Operation:   logical.ReadOperation,
+		Path:        "sys/mounts",
+		ClientToken: root,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !resp.Data["test/"].(map[string]interface{})["ready"].(bool) || resp.Data["secret/"].(map[string]interface{})["ready"].(bool) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+}
+
+func TestCore_Mount_StorageCompression(t *testing.T) {
+	c, key, _ := TestCoreUnsealed(t)
+	compressionType, canary := compressutil.CompressionTypeSnappy, compressutil.CompressionCanarySnappy
+	if compressutil.ZstdSupported {
+		compressionType, canary = compressutil.CompressionTypeZstd, compressutil.CompressionCanaryZstd
+	}
+	c.storageCompression = compressionType
+
+	me := &MountEntry{
+		Table: mountTableType,
+		Path:  "foo",
+		Type:  "generic",
+	}
+	if err := c.mount(me); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	raw, err := c.barrier.Get(coreMountConfigPath)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if raw == nil || raw.Value[0] != canary {
+		t.Fatalf("expected mount table to be compressed with %s", compressionType)
+	}
+
+	// The table is read regardless of the configured type
+	c2, err := NewCore(&CoreConfig{
+		Physical:     c.physical,
+		DisableMlock: true,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	unseal, err := TestCoreUnseal(c2, key)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !unseal {
+		t.Fatalf("should be unsealed")
+	}
+	if !reflect.DeepEqual(c.mounts, c2.mounts) {
+		t.Fatalf("mismatch: %v %v", c.mounts, c2.mounts)
+	}
+}
+
 func TestCore_Unmount(t *testing.T) {
 	c, key, _ := TestCoreUnsealed(t)
 	err := c.unmount("secret")
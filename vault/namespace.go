@@ -0,0 +1,463 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// coreNamespacePath is used to store the namespaces, one entry per
+	// namespace keyed by its ID
+	coreNamespacePath = "core/namespaces/"
+
+	// namespaceSubPath is the sub-path of the system view holding the data
+	// of the namespaces, such as their policies
+	namespaceSubPath = "namespaces/"
+)
+
+var (
+	// errLoadNamespacesFailed if loading the namespaces encounters an error
+	errLoadNamespacesFailed = errors.New("failed to load namespaces")
+
+	// namespaceReservedNames cannot be used as namespace names, as the
+	// requests to these paths are not routed to a child namespace
+	namespaceReservedNames = []string{
+		"auth",
+		"cubbyhole",
+		"sys",
+	}
+
+	// namespaceSharedPaths are the paths served by the root namespace
+	// whatever the namespace of the request, as they only act on the
+	// token of the request
+	namespaceSharedPaths = []string{
+		"auth/token/",
+		"cubbyhole",
+	}
+)
+
+// Namespace is an isolated tree of mounts, auth mounts, policies and
+// tokens. Everything in a namespace lives under its path, such as
+// "ns1/ns2/", except its auth mounts which are routed under "auth/ns1/ns2/".
+// A request in a namespace uses paths relative to it, and the tokens issued
+// in a namespace can only be used in it and its children.
+type Namespace struct {
+	ID   string `json:"id"`
+	Path string `json:"path"`
+
+	// policyStore holds the policies of the namespace
+	policyStore *PolicyStore
+}
+
+// namespacePath returns the path of the namespace, the empty string for the
+// root namespace
+func namespacePath(ns *Namespace) string {
+	if ns == nil {
+		return ""
+	}
+	return ns.Path
+}
+
+// namespaceSharedPath returns whether requests to the path are served by
+// the root namespace whatever their namespace
+func namespaceSharedPath(path string) bool {
+	for _, prefix := range namespaceSharedPaths {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// namespaceRoutePath returns the path a path relative to the namespace of
+// the given path is routed to
+func namespaceRoutePath(nsPath, path string) string {
+	switch {
+	case nsPath == "", namespaceSharedPath(path):
+		return path
+	case strings.HasPrefix(path, credentialRoutePrefix):
+		return credentialRoutePrefix + nsPath + strings.TrimPrefix(path, credentialRoutePrefix)
+	default:
+		return nsPath + path
+	}
+}
+
+// namespacePolicy returns the policy with its paths, which are relative to
+// the namespace of the given path, translated to the paths they are routed
+// to
+func namespacePolicy(nsPath string, p *Policy) *Policy {
+	translated := &Policy{
+		Name:  p.Name,
+		Raw:   p.Raw,
+		Paths: make([]*PathCapabilities, 0, len(p.Paths)),
+	}
+	for _, pc := range p.Paths {
+		prefixes := []string{namespaceRoutePath(nsPath, pc.Prefix)}
+
+		// Globs covering the auth mounts of the namespace, such as "*",
+		// must also cover the paths they are routed to
+		if pc.Glob && len(pc.Prefix) < len(credentialRoutePrefix) &&
+			strings.HasPrefix(credentialRoutePrefix, pc.Prefix) {
+			prefixes = append(prefixes, credentialRoutePrefix+nsPath)
+		}
+
+		for _, prefix := range prefixes {
+			tpc := *pc
+			tpc.Prefix = prefix
+			if tpc.Pattern != nil {
+				tpc.Pattern = nil
+				if err := tpc.compile(); err != nil {
+					continue
+				}
+			}
+			translated.Paths = append(translated.Paths, &tpc)
+		}
+	}
+	return translated
+}
+
+// namespaceByPath returns the namespace of the given path, which is the
+// namespace with the longest path prefixing it, or nil for the root
+// namespace. This must be called with namespaceLock held.
+func (c *Core) namespaceByPath(path string) *Namespace {
+	var match *Namespace
+	for nsPath, ns := range c.namespaces {
+		if strings.HasPrefix(path, nsPath) && (match == nil || len(nsPath) > len(match.Path)) {
+			match = ns
+		}
+	}
+	return match
+}
+
+// namespaceByID returns the namespace with the given ID, or nil if it does
+// not exist. This must be called with namespaceLock held.
+func (c *Core) namespaceByID(id string) *Namespace {
+	for _, ns := range c.namespaces {
+		if ns.ID == id {
+			return ns
+		}
+	}
+	return nil
+}
+
+// resolveNamespace returns the namespace of the request path, and the path
+// relative to it. Paths already routed to the auth mounts of a namespace,
+// such as "auth/ns1/userpass/login", are resolved to that namespace.
+func (c *Core) resolveNamespace(path string) (*Namespace, string) {
+	c.namespaceLock.RLock()
+	defer c.namespaceLock.RUnlock()
+
+	ns := c.namespaceByPath(path)
+	rel := strings.TrimPrefix(path, namespacePath(ns))
+	if strings.HasPrefix(rel, credentialRoutePrefix) && !namespaceSharedPath(rel) {
+		full := namespacePath(ns) + strings.TrimPrefix(rel, credentialRoutePrefix)
+		if authNS := c.namespaceByPath(full); authNS != nil && authNS != ns {
+			ns = authNS
+			rel = credentialRoutePrefix + strings.TrimPrefix(full, authNS.Path)
+		}
+	}
+	return ns, rel
+}
+
+// namespaceRequestPath returns the path a request path is routed to. This
+// makes the path of requests in a namespace, such as
+// "ns1/auth/userpass/login", the same as the path the router expects, such
+// as "auth/ns1/userpass/login".
+func (c *Core) namespaceRequestPath(path string) string {
+	ns, rel := c.resolveNamespace(path)
+	return namespaceRoutePath(namespacePath(ns), rel)
+}
+
+// Namespace returns the namespace with the given path, such as "ns1/ns2/",
+// or nil if it does not exist
+func (c *Core) Namespace(path string) *Namespace {
+	c.namespaceLock.RLock()
+	defer c.namespaceLock.RUnlock()
+	return c.namespaces[path]
+}
+
+// namespaceChildren returns the names of the namespaces directly under the
+// given namespace, sorted
+func (c *Core) namespaceChildren(parent *Namespace) []string {
+	c.namespaceLock.RLock()
+	defer c.namespaceLock.RUnlock()
+
+	prefix := namespacePath(parent)
+	var names []string
+	for nsPath := range c.namespaces {
+		if !strings.HasPrefix(nsPath, prefix) || nsPath == prefix {
+			continue
+		}
+		name := strings.TrimPrefix(nsPath, prefix)
+		if strings.Count(name, "/") == 1 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// tokenNamespace returns the namespace the token was issued in, nil for
+// the root namespace. It returns false if the namespace no longer exists.
+func (c *Core) tokenNamespace(te *TokenEntry) (*Namespace, bool) {
+	if te.NamespaceID == "" {
+		return nil, true
+	}
+	c.namespaceLock.RLock()
+	defer c.namespaceLock.RUnlock()
+	ns := c.namespaceByID(te.NamespaceID)
+	return ns, ns != nil
+}
+
+// tokenACL returns the ACL of the token, built from the policies of the
+// namespace it was issued in. Tokens of a deleted namespace are granted
+// nothing.
+func (c *Core) tokenACL(te *TokenEntry) (*ACL, error) {
+	ns, ok := c.tokenNamespace(te)
+	if !ok {
+		return NewACL(nil)
+	}
+	policyStore := c.policyStore
+	if ns != nil {
+		policyStore = ns.policyStore
+	}
+	return policyStore.EntityACL(c.tokenEntity(te), c.tokenPolicies(te)...)
+}
+
+// tokenNamespaceAllows returns whether the token can be used for a request
+// to the given routed path: tokens issued in a namespace can only be used
+// in it and its children
+func (c *Core) tokenNamespaceAllows(te *TokenEntry, path string) bool {
+	if te.NamespaceID == "" || namespaceSharedPath(path) {
+		return true
+	}
+	tokenNS, ok := c.tokenNamespace(te)
+	if !ok {
+		return false
+	}
+	reqNS, _ := c.resolveNamespace(path)
+	return reqNS != nil && strings.HasPrefix(reqNS.Path, tokenNS.Path)
+}
+
+// namespaceMountPath returns the full path of a mount, given its path
+// relative to the namespace. The path must not belong to a child namespace.
+func (c *Core) namespaceMountPath(ns *Namespace, path string) (string, error) {
+	if ns != nil {
+		for _, p := range protectedMounts {
+			if strings.HasPrefix(path, p) {
+				return "", logical.CodedError(403, fmt.Sprintf("cannot mount '%s'", path))
+			}
+		}
+	}
+
+	full := namespacePath(ns) + path
+	c.namespaceLock.RLock()
+	owner := c.namespaceByPath(full)
+	c.namespaceLock.RUnlock()
+	if owner != ns {
+		return "", fmt.Errorf("path '%s' belongs to namespace '%s'", path, strings.TrimPrefix(owner.Path, namespacePath(ns)))
+	}
+	return full, nil
+}
+
+// mountNamespace returns the namespace of a mount or auth mount, nil for
+// the root namespace
+func (c *Core) mountNamespace(entry *MountEntry) *Namespace {
+	c.namespaceLock.RLock()
+	defer c.namespaceLock.RUnlock()
+	return c.namespaceByPath(entry.Path)
+}
+
+// createNamespace creates the namespace with the given name under the
+// parent namespace
+func (c *Core) createNamespace(parent *Namespace, name string) (*Namespace, error) {
+	if name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("invalid namespace name %q", name)
+	}
+	if strutil.StrListContains(namespaceReservedNames, name) {
+		return nil, fmt.Errorf("namespace name %q is reserved", name)
+	}
+	path := namespacePath(parent) + name + "/"
+
+	// The namespace must not capture the paths of existing mounts
+	if match := c.router.MatchingMount(path); match != "" {
+		return nil, logical.CodedError(409, fmt.Sprintf("existing mount at %s", match))
+	}
+	if c.mountsUnder(path) {
+		return nil, logical.CodedError(409, fmt.Sprintf("existing mounts under %s", path))
+	}
+
+	id, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	ns := &Namespace{
+		ID:   id,
+		Path: path,
+	}
+	buf, err := json.Marshal(ns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode namespace: %v", err)
+	}
+
+	c.namespaceLock.Lock()
+	defer c.namespaceLock.Unlock()
+
+	if c.namespaces[path] != nil {
+		return nil, logical.CodedError(409, fmt.Sprintf("namespace %s already exists", path))
+	}
+	if c.namespaceByPath(path) != parent {
+		return nil, fmt.Errorf("parent namespace no longer exists")
+	}
+
+	if err := c.barrier.Put(&Entry{
+		Key:   coreNamespacePath + ns.ID,
+		Value: buf,
+	}); err != nil {
+		c.logger.Printf("[ERR] core: failed to persist namespace: %v", err)
+		return nil, err
+	}
+	if err := c.setupNamespace(ns); err != nil {
+		return nil, err
+	}
+	if err := ns.policyStore.createDefaultPolicy(); err != nil {
+		return nil, err
+	}
+
+	namespaces := make(map[string]*Namespace, len(c.namespaces)+1)
+	for p, n := range c.namespaces {
+		namespaces[p] = n
+	}
+	namespaces[path] = ns
+	c.namespaces = namespaces
+	c.logger.Printf("[INFO] core: created namespace %s", path)
+	return ns, nil
+}
+
+// deleteNamespace removes a namespace, which must not have child
+// namespaces, mounts nor auth mounts. The tokens issued in the namespace
+// are then granted nothing.
+func (c *Core) deleteNamespace(ns *Namespace) error {
+	if c.mountsUnder(ns.Path) {
+		return fmt.Errorf("namespace %s still has mounts", ns.Path)
+	}
+
+	c.namespaceLock.Lock()
+	defer c.namespaceLock.Unlock()
+
+	for p := range c.namespaces {
+		if p != ns.Path && strings.HasPrefix(p, ns.Path) {
+			return fmt.Errorf("namespace %s still has child namespaces", ns.Path)
+		}
+	}
+
+	if err := c.router.Unmount(ns.Path + "sys/"); err != nil {
+		return err
+	}
+	if err := ClearView(ns.policyStore.view); err != nil {
+		c.logger.Printf("[ERR] core: failed to delete namespace policies: %v", err)
+		return err
+	}
+	if err := c.barrier.Delete(coreNamespacePath + ns.ID); err != nil {
+		c.logger.Printf("[ERR] core: failed to delete namespace: %v", err)
+		return err
+	}
+
+	namespaces := make(map[string]*Namespace, len(c.namespaces))
+	for p, n := range c.namespaces {
+		if p != ns.Path {
+			namespaces[p] = n
+		}
+	}
+	c.namespaces = namespaces
+	c.logger.Printf("[INFO] core: deleted namespace %s", ns.Path)
+	return nil
+}
+
+// mountsUnder returns whether there are mounts or auth mounts under the
+// given path
+func (c *Core) mountsUnder(path string) bool {
+	c.mountsLock.RLock()
+	for _, entry := range c.mounts.Entries {
+		if strings.HasPrefix(entry.Path, path) {
+			c.mountsLock.RUnlock()
+			return true
+		}
+	}
+	c.mountsLock.RUnlock()
+
+	c.authLock.RLock()
+	defer c.authLock.RUnlock()
+	for _, entry := range c.auth.Entries {
+		if strings.HasPrefix(entry.Path, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// setupNamespace creates the policy store of a namespace and mounts its
+// system backend
+func (c *Core) setupNamespace(ns *Namespace) error {
+	view := c.systemBarrierView.SubView(namespaceSubPath + ns.ID + "/")
+	ns.policyStore = NewPolicyStore(view.SubView(policySubPath), &dynamicSystemView{core: c})
+	ns.policyStore.namespacePath = ns.Path
+
+	me := &MountEntry{
+		Table:       mountTableType,
+		Path:        ns.Path + "sys/",
+		Type:        "system",
+		Description: "system endpoints of the namespace",
+		UUID:        ns.ID,
+	}
+	backend := NewNamespaceSystemBackend(c, ns, &logical.BackendConfig{
+		StorageView: view,
+		Logger:      c.logger,
+		System:      c.mountEntrySysView(me),
+	})
+	return c.router.Mount(backend, me.Path, me, view)
+}
+
+// loadNamespaces reads the namespaces and sets them up
+func (c *Core) loadNamespaces() error {
+	ids, err := c.barrier.List(coreNamespacePath)
+	if err != nil {
+		c.logger.Printf("[ERR] core: failed to list namespaces: %v", err)
+		return errLoadNamespacesFailed
+	}
+
+	namespaces := make(map[string]*Namespace, len(ids))
+	for _, id := range ids {
+		raw, err := c.barrier.Get(coreNamespacePath + id)
+		if err != nil {
+			c.logger.Printf("[ERR] core: failed to read namespace %s: %v", id, err)
+			return errLoadNamespacesFailed
+		}
+		if raw == nil {
+			continue
+		}
+		ns := &Namespace{}
+		if err := jsonutil.DecodeJSON(raw.Value, ns); err != nil {
+			c.logger.Printf("[ERR] core: failed to decode namespace %s: %v", id, err)
+			return errLoadNamespacesFailed
+		}
+		if err := c.setupNamespace(ns); err != nil {
+			c.logger.Printf("[ERR] core: failed to set up namespace %s: %v", ns.Path, err)
+			return errLoadNamespacesFailed
+		}
+		namespaces[ns.Path] = ns
+	}
+
+	c.namespaceLock.Lock()
+	c.namespaces = namespaces
+	c.namespaceLock.Unlock()
+	return nil
+}
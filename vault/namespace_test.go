@@ -0,0 +1,335 @@
+package vault
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestNamespaceRoutePath(t *testing.T) {
+	cases := []struct {
+		NSPath string
+		Path   string
+		Route  string
+	}{
+		{"", "secret/foo", "secret/foo"},
+		{"ns1/", "secret/foo", "ns1/secret/foo"},
+		{"ns1/ns2/", "sys/mounts", "ns1/ns2/sys/mounts"},
+		{"ns1/", "auth/userpass/login/bob", "auth/ns1/userpass/login/bob"},
+		{"ns1/", "auth/token/lookup-self", "auth/token/lookup-self"},
+		{"ns1/", "cubbyhole/foo", "cubbyhole/foo"},
+	}
+	for _, tc := range cases {
+		if route := namespaceRoutePath(tc.NSPath, tc.Path); route != tc.Route {
+			t.Fatalf("%s in %q: expected %s, got %s", tc.Path, tc.NSPath, tc.Route, route)
+		}
+	}
+}
+
+func TestNamespacePolicy(t *testing.T) {
+	policy, err := Parse(`
+path "secret/*" {
+	capabilities = ["read"]
+}
+path "auth/userpass/*" {
+	capabilities = ["update"]
+}
+path "*" {
+	capabilities = ["list"]
+}
+`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	acl, err := NewACL([]*Policy{namespacePolicy("ns1/", policy)})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	cases := []struct {
+		Op      logical.Operation
+		Path    string
+		Allowed bool
+	}{
+		{logical.ReadOperation, "ns1/secret/foo", true},
+		{logical.ReadOperation, "secret/foo", false},
+		{logical.UpdateOperation, "auth/ns1/userpass/login/bob", true},
+		{logical.UpdateOperation, "auth/userpass/login/bob", false},
+		{logical.ListOperation, "ns1/other/", true},
+		{logical.ListOperation, "auth/ns1/other/", true},
+		{logical.ListOperation, "other/", false},
+	}
+	for _, tc := range cases {
+		allowed, _ := acl.AllowOperation(tc.Op, tc.Path)
+		if allowed != tc.Allowed {
+			t.Fatalf("%s %s: expected %v, got %v", tc.Op, tc.Path, tc.Allowed, allowed)
+		}
+	}
+}
+
+// testNamespaceRequest makes a request with the given token, failing the
+// test on error
+func testNamespaceRequest(t *testing.T, c *Core, token string, op logical.Operation, path string, data map[string]interface{}) *logical.Response {
+	req := logical.TestRequest(t, op, path)
+	req.ClientToken = token
+	req.Data = data
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("%s %s: err: %v %#v", op, path, err, resp)
+	}
+	return resp
+}
+
+func TestNamespace_Isolation(t *testing.T) {
+	c, key, root := testCoreIdentityLogin(t)
+
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "sys/namespaces/ns1", nil)
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "ns1/sys/namespaces/ns2", nil)
+
+	resp := testNamespaceRequest(t, c, root, logical.ListOperation, "sys/namespaces", nil)
+	if keys := resp.Data["keys"].([]string); !reflect.DeepEqual(keys, []string{"ns1/"}) {
+		t.Fatalf("bad: %v", keys)
+	}
+	resp = testNamespaceRequest(t, c, root, logical.ReadOperation, "ns1/sys/namespaces/ns2", nil)
+	if resp.Data["path"] != "ns2/" || resp.Data["id"] == "" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Set up a mount, an auth mount and a policy in ns1
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "ns1/sys/mounts/secret", map[string]interface{}{
+		"type": "generic",
+	})
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "ns1/sys/auth/foo", map[string]interface{}{
+		"type": "noop",
+	})
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "ns1/sys/policy/foo", map[string]interface{}{
+		"rules": `path "secret/*" { capabilities = ["create", "read", "update"] }`,
+	})
+
+	resp = testNamespaceRequest(t, c, root, logical.ReadOperation, "ns1/sys/mounts", nil)
+	if _, ok := resp.Data["secret/"]; !ok || len(resp.Data) != 1 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	resp = testNamespaceRequest(t, c, root, logical.ReadOperation, "sys/mounts", nil)
+	if _, ok := resp.Data["ns1/secret/"]; ok {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	resp = testNamespaceRequest(t, c, root, logical.ReadOperation, "ns1/sys/policy", nil)
+	if keys := resp.Data["keys"].([]string); !reflect.DeepEqual(keys, []string{"default", "foo"}) {
+		t.Fatalf("bad: %v", keys)
+	}
+
+	// Log in to ns1, getting the policies of ns1
+	auth := testCoreLogin(t, c, "ns1/auth/foo/login")
+	te, err := c.tokenStore.Lookup(auth.ClientToken)
+	if err != nil || te == nil {
+		t.Fatalf("err: %v", err)
+	}
+	if ns := c.Namespace("ns1/"); ns == nil || te.NamespaceID != ns.ID {
+		t.Fatalf("bad: %#v", te)
+	}
+
+	data := map[string]interface{}{"value": "bar"}
+	testNamespaceRequest(t, c, auth.ClientToken, logical.UpdateOperation, "ns1/secret/foo", data)
+	resp = testNamespaceRequest(t, c, root, logical.ReadOperation, "ns1/secret/foo", nil)
+	if resp.Data["value"] != "bar" {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// The token cannot leave its namespace
+	for _, path := range []string{"secret/foo", "sys/mounts", "ns1/sys/namespaces/ns2"} {
+		req := logical.TestRequest(t, logical.ReadOperation, path)
+		req.ClientToken = auth.ClientToken
+		if _, err := c.HandleRequest(req); err == nil || !errwrap.Contains(err, logical.ErrPermissionDenied.Error()) {
+			t.Fatalf("%s: expected permission denied, got %v", path, err)
+		}
+	}
+	testNamespaceRequest(t, c, auth.ClientToken, logical.ReadOperation, "auth/token/lookup-self", nil)
+
+	// The namespaces survive a restart
+	if err := c.Seal(root); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if unseal, err := TestCoreUnseal(c, key); err != nil || !unseal {
+		t.Fatalf("err: %v", err)
+	}
+	resp = testNamespaceRequest(t, c, auth.ClientToken, logical.ReadOperation, "ns1/secret/foo", nil)
+	if resp.Data["value"] != "bar" {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if c.Namespace("ns1/ns2/") == nil {
+		t.Fatalf("missing namespace ns1/ns2/")
+	}
+
+	// A namespace is removed once it is empty
+	req := logical.TestRequest(t, logical.DeleteOperation, "sys/namespaces/ns1")
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatalf("expected error deleting namespace with mounts")
+	}
+	testNamespaceRequest(t, c, root, logical.DeleteOperation, "ns1/sys/namespaces/ns2", nil)
+	testNamespaceRequest(t, c, root, logical.DeleteOperation, "ns1/sys/mounts/secret", nil)
+	testNamespaceRequest(t, c, root, logical.DeleteOperation, "ns1/sys/auth/foo", nil)
+	testNamespaceRequest(t, c, root, logical.DeleteOperation, "sys/namespaces/ns1", nil)
+	if c.Namespace("ns1/") != nil {
+		t.Fatalf("namespace ns1/ not deleted")
+	}
+
+	// The tokens of the namespace are then granted nothing
+	req = logical.TestRequest(t, logical.ReadOperation, "auth/token/lookup-self")
+	req.ClientToken = auth.ClientToken
+	if _, err := c.HandleRequest(req); err == nil || !errwrap.Contains(err, logical.ErrPermissionDenied.Error()) {
+		t.Fatalf("expected permission denied, got %v", err)
+	}
+}
+
+func TestNamespace_TokenStoreIsolation(t *testing.T) {
+	c, _, root := testCoreIdentityLogin(t)
+
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "sys/namespaces/ns1", nil)
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "ns1/sys/auth/foo", map[string]interface{}{
+		"type": "noop",
+	})
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "ns1/sys/policy/foo", map[string]interface{}{
+		"rules": `path "auth/token/*" { capabilities = ["create", "read", "update", "delete", "list", "sudo"] }`,
+	})
+	auth := testCoreLogin(t, c, "ns1/auth/foo/login")
+
+	// A role written in ns1 is neither visible nor usable from the root
+	// namespace
+	testNamespaceRequest(t, c, auth.ClientToken, logical.UpdateOperation, "ns1/auth/token/roles/escalate", map[string]interface{}{
+		"allowed_policies": "root",
+	})
+	resp := testNamespaceRequest(t, c, auth.ClientToken, logical.ReadOperation, "auth/token/roles/escalate", nil)
+	if resp == nil || resp.Data["name"] != "escalate" {
+		t.Fatalf("bad: %#v", resp)
+	}
+	resp = testNamespaceRequest(t, c, auth.ClientToken, logical.ListOperation, "auth/token/roles", nil)
+	if keys := resp.Data["keys"].([]string); !reflect.DeepEqual(keys, []string{"escalate"}) {
+		t.Fatalf("bad: %v", keys)
+	}
+
+	resp = testNamespaceRequest(t, c, root, logical.ReadOperation, "auth/token/roles/escalate", nil)
+	if resp != nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+	resp = testNamespaceRequest(t, c, root, logical.ListOperation, "auth/token/roles", nil)
+	if keys, ok := resp.Data["keys"].([]string); ok && len(keys) != 0 {
+		t.Fatalf("bad: %v", keys)
+	}
+	req := logical.TestRequest(t, logical.UpdateOperation, "auth/token/create/escalate")
+	req.ClientToken = root
+	resp, err := c.HandleRequest(req)
+	if err == nil && (resp == nil || !resp.IsError()) {
+		t.Fatalf("expected error, got %#v", resp)
+	}
+
+	// The accessors of the tokens of another namespace are invalid
+	rootEntry, err := c.tokenStore.Lookup(root)
+	if err != nil || rootEntry == nil {
+		t.Fatalf("err: %v", err)
+	}
+	nsEntry, err := c.tokenStore.Lookup(auth.ClientToken)
+	if err != nil || nsEntry == nil {
+		t.Fatalf("err: %v", err)
+	}
+	for _, path := range []string{"auth/token/lookup-accessor", "auth/token/revoke-accessor"} {
+		req := logical.TestRequest(t, logical.UpdateOperation, path)
+		req.ClientToken = auth.ClientToken
+		req.Data["accessor"] = rootEntry.Accessor
+		if _, err := c.HandleRequest(req); err == nil {
+			t.Fatalf("%s: expected error", path)
+		}
+
+		req = logical.TestRequest(t, logical.UpdateOperation, path)
+		req.ClientToken = root
+		req.Data["accessor"] = nsEntry.Accessor
+		if _, err := c.HandleRequest(req); err == nil {
+			t.Fatalf("%s: expected error", path)
+		}
+	}
+	resp = testNamespaceRequest(t, c, auth.ClientToken, logical.ListOperation, "auth/token/accessors", nil)
+	if keys := resp.Data["keys"].([]string); !reflect.DeepEqual(keys, []string{nsEntry.Accessor}) {
+		t.Fatalf("bad: %v", keys)
+	}
+	testNamespaceRequest(t, c, root, logical.ReadOperation, "auth/token/lookup-self", nil)
+}
+
+func TestNamespace_MountTune(t *testing.T) {
+	c, _, root := testCoreIdentityLogin(t)
+
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "sys/namespaces/ns1", nil)
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "ns1/sys/mounts/secret", map[string]interface{}{
+		"type": "generic",
+	})
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "ns1/sys/auth/foo", map[string]interface{}{
+		"type": "noop",
+	})
+
+	// The tune endpoints tune the mounts of the namespace rather than
+	// create mounts at their paths
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "ns1/sys/mounts/secret/tune", map[string]interface{}{
+		"default_lease_ttl": "1h",
+	})
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "ns1/sys/auth/foo/tune", map[string]interface{}{
+		"default_lease_ttl": "2h",
+	})
+
+	resp := testNamespaceRequest(t, c, root, logical.ReadOperation, "ns1/sys/mounts", nil)
+	if _, ok := resp.Data["secret/"]; !ok || len(resp.Data) != 1 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	resp = testNamespaceRequest(t, c, root, logical.ReadOperation, "ns1/sys/auth", nil)
+	if _, ok := resp.Data["foo/"]; !ok || len(resp.Data) != 1 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	for _, path := range []string{"ns1/sys/mounts/secret/tune", "sys/mounts/ns1/secret/tune"} {
+		resp := testNamespaceRequest(t, c, root, logical.ReadOperation, path, nil)
+		if resp.Data["default_lease_ttl"] != 3600 {
+			t.Fatalf("%s: bad: %#v", path, resp.Data)
+		}
+	}
+
+	// The TTLs of the noop backend are static, so the auth mounts are
+	// checked in the mount table
+	if me := c.router.MatchingMountEntry("auth/ns1/foo/"); me == nil || me.Config.DefaultLeaseTTL != 2*time.Hour {
+		t.Fatalf("bad: %#v", me)
+	}
+	if me := c.router.MatchingMountEntry("auth/foo/"); me == nil || me.Config.DefaultLeaseTTL != 0 {
+		t.Fatalf("bad: %#v", me)
+	}
+	testNamespaceRequest(t, c, root, logical.ReadOperation, "ns1/sys/auth/foo/tune", nil)
+	testNamespaceRequest(t, c, root, logical.ReadOperation, "ns1/sys/mounts/auth/foo/tune", nil)
+}
+
+func TestNamespace_Create_Invalid(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "sys/mounts/taken", map[string]interface{}{
+		"type": "generic",
+	})
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "sys/mounts/under/mount", map[string]interface{}{
+		"type": "generic",
+	})
+
+	for _, name := range []string{"sys", "auth", "cubbyhole", "taken", "under"} {
+		req := logical.TestRequest(t, logical.UpdateOperation, "sys/namespaces/"+name)
+		req.ClientToken = root
+		if _, err := c.HandleRequest(req); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+
+	// Mounts cannot be created in a child namespace from its parent
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "sys/namespaces/ns1", nil)
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/mounts/ns1/secret")
+	req.ClientToken = root
+	req.Data["type"] = "generic"
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatalf("expected error")
+	}
+}
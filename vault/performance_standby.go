@@ -0,0 +1,535 @@
+package vault
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/physical"
+)
+
+const (
+	// perfStandbyWALPath is the path of the cluster listener serving the
+	// write log of the active node to the performance standbys
+	perfStandbyWALPath = "/cluster/local/wal"
+
+	// perfStandbyWALWait is how long the active node holds a fetch from a
+	// performance standby waiting for a write
+	perfStandbyWALWait = 10 * time.Second
+
+	// perfStandbyRetryInterval is how long a performance standby waits
+	// after failing to fetch the write log of the active node
+	perfStandbyRetryInterval = time.Second
+)
+
+var (
+	// errPerformanceStandbyReadOnly is returned when writing to storage on a
+	// performance standby, which only the active node writes to
+	errPerformanceStandbyReadOnly = errors.New("cannot write to storage on a performance standby")
+
+	// perfStandbyMountTypes are the types of secret mounts whose reads a
+	// performance standby serves. Reads on other mounts may issue leases or
+	// have effects outside of Vault, so they are forwarded to the active
+	// node. Reads on auth mounts are always served.
+	perfStandbyMountTypes = map[string]bool{
+		"cubbyhole": true,
+		"generic":   true,
+		"kv":        true,
+		"pki":       true,
+		"system":    true,
+		"transit":   true,
+	}
+
+	// perfStandbyForwardedSysPaths are the system paths whose reads depend
+	// on state only the active node has
+	perfStandbyForwardedSysPaths = []string{
+		"sys/leases/",
+		"sys/storage/snapshots/",
+	}
+
+	// perfStandbyReloadPrefixes are the storage paths holding state that a
+	// performance standby keeps in memory, which it loads again when the
+	// active node writes to them
+	perfStandbyReloadPrefixes = []string{
+		coreAuditConfigPath,
+		coreAuthConfigPath,
+		coreMountConfigPath,
+		"core/cors",
+		"core/keyring",
+		"core/master",
+		"core/mfa/enforcement/",
+		"core/mfa/method/",
+		"core/namespaces/",
+		"core/policies/egp/",
+		"core/quotas/",
+		systemBarrierPrefix + identitySubPath,
+	}
+)
+
+// walFetchResponse is returned by the active node to a performance standby
+// fetching its write log
+type walFetchResponse struct {
+	Epoch string `json:"epoch"`
+	Index uint64 `json:"index"`
+
+	// Full is set when the log does not go back to the position of the
+	// standby, which must then drop everything it cached
+	Full bool `json:"full"`
+
+	// More is set when there are more writes to fetch at once
+	More bool `json:"more"`
+
+	// Keys are the keys written since the position of the standby
+	Keys []string `json:"keys,omitempty"`
+}
+
+// PerformanceStandby returns whether the node is a performance standby
+// serving reads
+func (c *Core) PerformanceStandby() bool {
+	c.stateLock.RLock()
+	defer c.stateLock.RUnlock()
+	return c.standby && c.perfStandby
+}
+
+// performanceStandbyServes returns whether a performance standby serves the
+// request itself rather than forwarding it to the active node. The state
+// lock must be held.
+func (c *Core) performanceStandbyServes(req *logical.Request) bool {
+	if !c.perfStandby {
+		return false
+	}
+	switch req.Operation {
+	case logical.ReadOperation, logical.ListOperation:
+	default:
+		return false
+	}
+	if req.WrapTTL != 0 {
+		return false
+	}
+
+	// Validating TOTP passcodes records their use, which only the active
+	// node can write
+	if len(req.MFACreds) > 0 {
+		return false
+	}
+
+	entry := c.router.MatchingMountEntry(req.Path)
+	if entry == nil {
+		return false
+	}
+	if entry.Table == credentialTableType {
+		return true
+	}
+	if entry.Type == "system" {
+		for _, prefix := range perfStandbyForwardedSysPaths {
+			if strings.HasPrefix(req.Path, prefix) {
+				return false
+			}
+		}
+	}
+	return perfStandbyMountTypes[entry.Type]
+}
+
+// setupPerformanceStandbyLog starts recording the writes of the active node
+// for the performance standbys, unless already recording for DR replication
+func (c *Core) setupPerformanceStandbyLog() error {
+	if !c.perfStandbyEnabled || c.ha == nil {
+		return nil
+	}
+	if epoch, _ := c.writeLog.position(); epoch != "" {
+		return nil
+	}
+	return c.writeLog.start()
+}
+
+// setupPerformanceStandby loads the state a standby needs to serve reads,
+// with storage made read-only. The state lock must be held.
+func (c *Core) setupPerformanceStandby() (retErr error) {
+	c.logger.Printf("[INFO] core: performance standby setup starting")
+	defer func() {
+		if retErr != nil {
+			c.teardownPerformanceStandby()
+		}
+	}()
+
+	// Set first, so that the backends set up disable their caches, which
+	// would go stale as the active node writes
+	c.perfStandby = true
+	c.writeLog.setReadOnly(true)
+	if cache, ok := c.physical.(*physical.Cache); ok {
+		cache.Purge()
+	}
+
+	if err := c.barrier.ReloadMasterKey(); err != nil {
+		return err
+	}
+	if err := c.barrier.ReloadKeyring(); err != nil {
+		return err
+	}
+	if err := c.loadMounts(); err != nil {
+		return err
+	}
+	if err := c.setupMounts(); err != nil {
+		return err
+	}
+	if err := c.setupPolicyStore(); err != nil {
+		return err
+	}
+	if err := c.setupIdentityStore(); err != nil {
+		return err
+	}
+	if err := c.loadCredentials(); err != nil {
+		return err
+	}
+	if err := c.setupCredentials(); err != nil {
+		return err
+	}
+	if err := c.loadNamespaces(); err != nil {
+		return err
+	}
+
+	// The expiration manager reads the leases of tokens, but does not
+	// restore them, as only the active node revokes leases
+	c.metricsMutex.Lock()
+	c.expiration = NewExpirationManager(c.router, c.systemBarrierView.SubView(expirationSubPath), c.tokenStore, c.logger)
+	c.tokenStore.SetExpirationManager(c.expiration)
+	c.metricsMutex.Unlock()
+
+	if err := c.loadLeaseCountQuotas(); err != nil {
+		return err
+	}
+	if err := c.loadRateLimitQuotas(); err != nil {
+		return err
+	}
+	if err := c.loadEndpointPolicies(); err != nil {
+		return err
+	}
+	if err := c.loadMFA(); err != nil {
+		return err
+	}
+	if err := c.loadAudits(); err != nil {
+		return err
+	}
+	if err := c.setupAudits(); err != nil {
+		return err
+	}
+	if err := c.loadCORSConfig(); err != nil {
+		return err
+	}
+	c.logger.Printf("[INFO] core: performance standby setup complete")
+	return nil
+}
+
+// teardownPerformanceStandby reverses setupPerformanceStandby. The state
+// lock must be held.
+func (c *Core) teardownPerformanceStandby() error {
+	var result error
+	if err := c.teardownAudits(); err != nil {
+		result = multierror.Append(result, errwrap.Wrapf("[ERR] error tearing down audits: {{err}}", err))
+	}
+	if err := c.stopExpiration(); err != nil {
+		result = multierror.Append(result, errwrap.Wrapf("[ERR] error stopping expiration: {{err}}", err))
+	}
+	if err := c.teardownCredentials(); err != nil {
+		result = multierror.Append(result, errwrap.Wrapf("[ERR] error tearing down credentials: {{err}}", err))
+	}
+	if err := c.teardownIdentityStore(); err != nil {
+		result = multierror.Append(result, errwrap.Wrapf("[ERR] error tearing down identity store: {{err}}", err))
+	}
+	if err := c.teardownPolicyStore(); err != nil {
+		result = multierror.Append(result, errwrap.Wrapf("[ERR] error tearing down policy store: {{err}}", err))
+	}
+	if err := c.unloadMounts(); err != nil {
+		result = multierror.Append(result, errwrap.Wrapf("[ERR] error unloading mounts: {{err}}", err))
+	}
+
+	c.perfStandby = false
+	c.perfStandbyPosition.set("", 0)
+	c.writeLog.setReadOnly(false)
+	if cache, ok := c.physical.(*physical.Cache); ok {
+		cache.Purge()
+	}
+	return result
+}
+
+// WriteLogState returns the state token of the last write made on the
+// active node, which a client sends with a read to a performance standby to
+// read its own writes. It is empty if the node is not recording its writes.
+func (c *Core) WriteLogState() string {
+	epoch, index := c.writeLog.position()
+	if epoch == "" {
+		return ""
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%d", epoch, index)))
+}
+
+// WaitForWriteLogState waits up to timeout for a performance standby to catch
+// up to the state token of a write made on the active node. It returns
+// false if the standby did not, or if the token is from another active node.
+func (c *Core) WaitForWriteLogState(state string, timeout time.Duration) bool {
+	raw, err := base64.RawURLEncoding.DecodeString(state)
+	if err != nil {
+		return false
+	}
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return false
+	}
+	index, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return false
+	}
+	return c.perfStandbyPosition.wait(parts[0], index, timeout)
+}
+
+// walPosition is the position in the write log of the active node that a
+// performance standby caught up to
+type walPosition struct {
+	l     sync.Mutex
+	epoch string
+	index uint64
+
+	// updateCh is closed on the next update
+	updateCh chan struct{}
+}
+
+func (p *walPosition) set(epoch string, index uint64) {
+	p.l.Lock()
+	defer p.l.Unlock()
+	p.epoch = epoch
+	p.index = index
+	if p.updateCh != nil {
+		close(p.updateCh)
+		p.updateCh = nil
+	}
+}
+
+// wait waits up to timeout for the position to reach the given one
+func (p *walPosition) wait(epoch string, index uint64, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		p.l.Lock()
+		if p.epoch == epoch && p.index >= index {
+			p.l.Unlock()
+			return true
+		}
+		if p.updateCh == nil {
+			p.updateCh = make(chan struct{})
+		}
+		ch := p.updateCh
+		p.l.Unlock()
+
+		select {
+		case <-ch:
+		case <-timer.C:
+			return false
+		}
+	}
+}
+
+// runPerformanceStandby serves reads on a standby until stopCh is closed.
+// It follows the write log of the active node, dropping the cached entries
+// written and loading again the state kept in memory when it changes. If
+// the log cannot be followed, reads are forwarded until it can again.
+func (c *Core) runPerformanceStandby(doneCh, stopCh chan struct{}) {
+	defer close(doneCh)
+	c.logger.Printf("[INFO] core: entering performance standby mode")
+
+	var loaded bool
+	var epoch string
+	var index uint64
+	defer func() {
+		if loaded {
+			c.stateLock.Lock()
+			c.teardownPerformanceStandby()
+			c.stateLock.Unlock()
+		}
+	}()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		default:
+		}
+
+		resp, err := c.fetchWAL(stopCh, epoch, index)
+		if err == nil && resp.Epoch == "" {
+			err = fmt.Errorf("active node is not recording its writes")
+		}
+		if err != nil {
+			select {
+			case <-stopCh:
+				return
+			default:
+			}
+			c.logger.Printf("[WARN] core: failed to fetch the write log of the active node: %v", err)
+
+			// Stale state must not be served
+			if loaded {
+				c.stateLock.Lock()
+				c.teardownPerformanceStandby()
+				c.stateLock.Unlock()
+				loaded = false
+			}
+			select {
+			case <-stopCh:
+				return
+			case <-time.After(perfStandbyRetryInterval):
+			}
+			continue
+		}
+
+		reload := resp.Full
+		if !resp.Full {
+			cache, _ := c.physical.(*physical.Cache)
+			for _, key := range resp.Keys {
+				if cache != nil {
+					cache.Invalidate(key)
+				}
+				for _, prefix := range perfStandbyReloadPrefixes {
+					if strings.HasPrefix(key, prefix) {
+						reload = true
+					}
+				}
+			}
+		}
+		if reload || !loaded {
+			c.stateLock.Lock()
+			if loaded {
+				c.teardownPerformanceStandby()
+			}
+			err := c.setupPerformanceStandby()
+			c.stateLock.Unlock()
+			loaded = err == nil
+			if err != nil {
+				c.logger.Printf("[ERR] core: performance standby setup failed: %v", err)
+				epoch, index = "", 0
+				select {
+				case <-stopCh:
+					return
+				case <-time.After(perfStandbyRetryInterval):
+				}
+				continue
+			}
+		}
+		epoch, index = resp.Epoch, resp.Index
+		c.perfStandbyPosition.set(epoch, index)
+	}
+}
+
+// fetchWAL fetches the keys written on the active node since the given
+// position, waiting for a write if there is none yet
+func (c *Core) fetchWAL(stopCh <-chan struct{}, epoch string, index uint64) (*walFetchResponse, error) {
+	// Looking up the leader refreshes the connection to the active node
+	if _, _, err := c.Leader(); err != nil {
+		return nil, err
+	}
+	c.requestForwardingConnectionLock.RLock()
+	conn := c.requestForwardingConnection
+	c.requestForwardingConnectionLock.RUnlock()
+	if conn == nil || conn.clusterAddr == "" {
+		return nil, ErrCannotForward
+	}
+
+	query := url.Values{}
+	query.Set("epoch", epoch)
+	query.Set("index", strconv.FormatUint(index, 10))
+	req, err := http.NewRequest("GET", conn.clusterAddr+perfStandbyWALPath+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), perfStandbyWALWait+30*time.Second)
+	defer cancel()
+	go func() {
+		select {
+		case <-stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	httpResp, err := conn.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("active node returned status %d", httpResp.StatusCode)
+	}
+
+	var resp walFetchResponse
+	if err := jsonutil.DecodeJSONFromReader(httpResp.Body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// handleWALFetch serves the write log of the active node to a performance
+// standby. The standby is authenticated by the cluster TLS connection.
+func (c *Core) handleWALFetch(w http.ResponseWriter, r *http.Request) {
+	c.stateLock.RLock()
+	active := !c.sealed && !c.standby
+	c.stateLock.RUnlock()
+	if !active {
+		respondForwardingError(w, fmt.Errorf("node is not active"))
+		return
+	}
+
+	epoch := r.URL.Query().Get("epoch")
+	index, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64)
+	resp := c.walSince(epoch, index, perfStandbyWALWait, r.Context().Done())
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// walSince returns the keys written since the given position, waiting up to
+// wait for a write if there is none yet
+func (c *Core) walSince(epoch string, index uint64, wait time.Duration, doneCh <-chan struct{}) *walFetchResponse {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for {
+		// The channel is taken first so that no write is missed
+		ch := c.writeLog.waitCh()
+		keys, last, ok := c.writeLog.since(epoch, index)
+		if !ok {
+			resp := &walFetchResponse{Full: true}
+			resp.Epoch, resp.Index = c.writeLog.position()
+			return resp
+		}
+		if len(keys) > 0 {
+			_, current := c.writeLog.position()
+			return &walFetchResponse{
+				Epoch: epoch,
+				Index: last,
+				More:  last < current,
+				Keys:  keys,
+			}
+		}
+
+		select {
+		case <-ch:
+		case <-timer.C:
+			return &walFetchResponse{Epoch: epoch, Index: index}
+		case <-doneCh:
+			return &walFetchResponse{Epoch: epoch, Index: index}
+		}
+	}
+}
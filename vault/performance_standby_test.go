@@ -0,0 +1,175 @@
+package vault
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/physical"
+)
+
+func TestPerformanceStandby(t *testing.T) {
+	handler := http.NewServeMux()
+	cores := TestCluster(t, []http.Handler{handler, handler, handler}, &CoreConfig{
+		PerformanceStandby: true,
+	}, true)
+	for _, core := range cores {
+		defer core.CloseListeners()
+	}
+
+	active, standby := cores[0], cores[1]
+	TestWaitActive(t, active.Core)
+	root := active.Root
+
+	testNamespaceRequest(t, active.Core, root, logical.UpdateOperation, "secret/foo", map[string]interface{}{
+		"value": "bar",
+	})
+	testPerfStandbyWait(t, standby.PerformanceStandby)
+	if active.PerformanceStandby() {
+		t.Fatalf("active node is a performance standby")
+	}
+
+	// Reads are served on the standby, writes are not
+	resp := testNamespaceRequest(t, standby.Core, root, logical.ReadOperation, "secret/foo", nil)
+	if resp.Data["value"] != "bar" {
+		t.Fatalf("bad: %#v", resp)
+	}
+	req := logical.TestRequest(t, logical.UpdateOperation, "secret/foo")
+	req.ClientToken = root
+	if _, err := standby.HandleRequest(req); err != ErrStandby {
+		t.Fatalf("expected ErrStandby, got %v", err)
+	}
+
+	// Wrapped reads and reads of the leases are forwarded
+	req = logical.TestRequest(t, logical.ReadOperation, "secret/foo")
+	req.ClientToken = root
+	req.WrapTTL = time.Minute
+	if _, err := standby.HandleRequest(req); err != ErrStandby {
+		t.Fatalf("expected ErrStandby, got %v", err)
+	}
+	req = logical.TestRequest(t, logical.ListOperation, "sys/leases/lookup/")
+	req.ClientToken = root
+	if _, err := standby.HandleRequest(req); err != ErrStandby {
+		t.Fatalf("expected ErrStandby, got %v", err)
+	}
+
+	// A mount made on the active node is loaded by the standby
+	testNamespaceRequest(t, active.Core, root, logical.UpdateOperation, "sys/mounts/kv", map[string]interface{}{
+		"type": "generic",
+	})
+	testNamespaceRequest(t, active.Core, root, logical.UpdateOperation, "kv/baz", map[string]interface{}{
+		"value": "qux",
+	})
+	testPerfStandbyWait(t, func() bool {
+		req := logical.TestRequest(t, logical.ReadOperation, "kv/baz")
+		req.ClientToken = root
+		resp, err := standby.HandleRequest(req)
+		return err == nil && resp != nil && resp.Data["value"] == "qux"
+	})
+
+	// The standby stops serving reads once sealed
+	if err := standby.Seal(root); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if standby.PerformanceStandby() {
+		t.Fatalf("sealed node is a performance standby")
+	}
+}
+
+func TestPerformanceStandby_ReadOnly(t *testing.T) {
+	l := newWriteLog(physical.NewInmem(nil))
+	l.setReadOnly(true)
+	if err := l.Put(&physical.Entry{Key: "foo"}); err != errPerformanceStandbyReadOnly {
+		t.Fatalf("expected read-only error, got %v", err)
+	}
+	if err := l.Delete("foo"); err != errPerformanceStandbyReadOnly {
+		t.Fatalf("expected read-only error, got %v", err)
+	}
+	if !errwrap.Contains(errwrap.Wrapf("wrapped: {{err}}", errPerformanceStandbyReadOnly), errPerformanceStandbyReadOnly.Error()) {
+		t.Fatalf("expected wrapped error to match")
+	}
+
+	l.setReadOnly(false)
+	if err := l.Put(&physical.Entry{Key: "foo"}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestCore_WALSince(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+	if err := c.writeLog.start(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	epoch, index := c.writeLog.position()
+
+	// An unknown position requires a full sync
+	resp := c.walSince("unknown", 0, 0, nil)
+	if !resp.Full || resp.Epoch != epoch || resp.Index != index {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// Nothing written yet, the fetch waits until it times out
+	resp = c.walSince(epoch, index, 50*time.Millisecond, nil)
+	if resp.Full || len(resp.Keys) != 0 || resp.Index != index {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// A write made while waiting is returned at once
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		c.physical.Put(&physical.Entry{Key: "foo", Value: []byte("bar")})
+	}()
+	resp = c.walSince(epoch, index, 10*time.Second, nil)
+	if resp.Full || len(resp.Keys) != 1 || resp.Keys[0] != "foo" || resp.Index != index+1 {
+		t.Fatalf("bad: %#v", resp)
+	}
+}
+
+func TestCore_WaitForWriteLogState(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+	if state := c.WriteLogState(); state != "" {
+		t.Fatalf("expected no state, got %q", state)
+	}
+	if err := c.writeLog.start(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	c.physical.Put(&physical.Entry{Key: "foo", Value: []byte("bar")})
+	state := c.WriteLogState()
+	epoch, index := c.writeLog.position()
+
+	if c.WaitForWriteLogState("invalid", time.Millisecond) {
+		t.Fatalf("expected invalid state to fail")
+	}
+	if c.WaitForWriteLogState(state, 10*time.Millisecond) {
+		t.Fatalf("expected state not caught up to fail")
+	}
+
+	// Catching up while waiting
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		c.perfStandbyPosition.set(epoch, index-1)
+		c.perfStandbyPosition.set(epoch, index)
+	}()
+	if !c.WaitForWriteLogState(state, 10*time.Second) {
+		t.Fatalf("expected state to be caught up")
+	}
+
+	// A state of another active node is never caught up to
+	c.perfStandbyPosition.set("other", index+1)
+	if c.WaitForWriteLogState(state, 10*time.Millisecond) {
+		t.Fatalf("expected state of another epoch to fail")
+	}
+}
+
+// testPerfStandbyWait waits for the condition to hold
+func testPerfStandbyWait(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
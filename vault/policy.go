@@ -7,6 +7,7 @@ import (
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/hcl"
 	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/vault/helper/policyutil"
 )
 
 const (
@@ -18,6 +19,7 @@ const (
 	ListCapability   = "list"
 	SudoCapability   = "sudo"
 	RootCapability   = "root"
+	PatchCapability  = "patch"
 
 	// Backwards compatibility
 	OldDenyPathPolicy  = "deny"
@@ -34,6 +36,7 @@ const (
 	DeleteCapabilityInt
 	ListCapabilityInt
 	SudoCapabilityInt
+	PatchCapabilityInt
 )
 
 var (
@@ -45,6 +48,7 @@ var (
 		DeleteCapability: DeleteCapabilityInt,
 		ListCapability:   ListCapabilityInt,
 		SudoCapability:   SudoCapabilityInt,
+		PatchCapability:  PatchCapabilityInt,
 	}
 )
 
@@ -63,6 +67,25 @@ type PathCapabilities struct {
 	Capabilities       []string
 	CapabilitiesBitmap uint32 `hcl:"-"`
 	Glob               bool
+
+	// SegmentWildcards enables matching "+" path segments, such as in
+	// "secret/+/config", against any single segment. Without it a "+"
+	// segment is matched literally, as it was before segment wildcards
+	// were supported.
+	SegmentWildcards bool `hcl:"segment_wildcards"`
+
+	// Pattern is set if segment wildcards are enabled and the path
+	// contains any, in which case Prefix is the full path
+	Pattern *policyutil.PathPattern `hcl:"-"`
+
+	// Templated is set if the path interpolates identity fields, such as
+	// "secret/{{identity.entity.name}}/*". Prefix is then the full path
+	// template, which is compiled once interpolated for a token.
+	Templated bool `hcl:"-"`
+
+	// Permissions restricts the parameters of the writes to the path and
+	// the wrapping of the responses, or is nil if there are no restrictions
+	Permissions *PathPermissions `hcl:"-"`
 }
 
 // Parse is used to parse the specified ACL rules into an
@@ -117,10 +140,20 @@ func parsePaths(result *Policy, list *ast.ObjectList) error {
 		valid := []string{
 			"policy",
 			"capabilities",
+			"segment_wildcards",
+			"allowed_parameters",
+			"denied_parameters",
+			"required_parameters",
+			"min_wrapping_ttl",
+			"max_wrapping_ttl",
+			"control_group",
 		}
 		if err := checkHCLKeys(item.Val, valid); err != nil {
 			return multierror.Prefix(err, fmt.Sprintf("path %q:", key))
 		}
+		if err := checkControlGroupHCLKeys(item.Val); err != nil {
+			return multierror.Prefix(err, fmt.Sprintf("path %q:", key))
+		}
 
 		var pc PathCapabilities
 		pc.Prefix = key
@@ -128,15 +161,30 @@ func parsePaths(result *Policy, list *ast.ObjectList) error {
 			return multierror.Prefix(err, fmt.Sprintf("path %q:", key))
 		}
 
+		var perms PathPermissions
+		if err := hcl.DecodeObject(&perms, item.Val); err != nil {
+			return multierror.Prefix(err, fmt.Sprintf("path %q:", key))
+		}
+		if err := perms.validate(); err != nil {
+			return fmt.Errorf("path %q: %v", key, err)
+		}
+		if !perms.empty() {
+			pc.Permissions = &perms
+		}
+
 		// Strip a leading '/' as paths in Vault start after the / in the API path
 		if len(pc.Prefix) > 0 && pc.Prefix[0] == '/' {
 			pc.Prefix = pc.Prefix[1:]
 		}
 
-		// Strip the glob character if found
-		if strings.HasSuffix(pc.Prefix, "*") {
-			pc.Prefix = strings.TrimSuffix(pc.Prefix, "*")
-			pc.Glob = true
+		// Templated paths are compiled once interpolated
+		if strings.Contains(pc.Prefix, templateStart) {
+			if err := validatePathTemplate(pc.Prefix); err != nil {
+				return fmt.Errorf("path %q: %v", key, err)
+			}
+			pc.Templated = true
+		} else if err := pc.compile(); err != nil {
+			return fmt.Errorf("path %q: %v", key, err)
 		}
 
 		// Map old-style policies into capabilities
@@ -164,7 +212,7 @@ func parsePaths(result *Policy, list *ast.ObjectList) error {
 				pc.Capabilities = []string{DenyCapability}
 				pc.CapabilitiesBitmap = DenyCapabilityInt
 				goto PathFinished
-			case CreateCapability, ReadCapability, UpdateCapability, DeleteCapability, ListCapability, SudoCapability:
+			case CreateCapability, ReadCapability, UpdateCapability, DeleteCapability, ListCapability, SudoCapability, PatchCapability:
 				pc.CapabilitiesBitmap |= cap2Int[cap]
 			default:
 				return fmt.Errorf("path %q: invalid capability '%s'", key, cap)
@@ -180,6 +228,47 @@ func parsePaths(result *Policy, list *ast.ObjectList) error {
 	return nil
 }
 
+// compile parses the segment wildcards and the glob of the path
+func (pc *PathCapabilities) compile() error {
+	// Paths with segment wildcards are matched as patterns
+	if pc.SegmentWildcards {
+		pattern, err := policyutil.ParsePathPattern(pc.Prefix)
+		if err != nil {
+			return err
+		}
+		if pattern.HasSegmentWildcards() {
+			pc.Pattern = pattern
+		}
+	}
+
+	// Strip the glob character if found
+	if strings.HasSuffix(pc.Prefix, "*") && pc.Pattern == nil {
+		pc.Prefix = strings.TrimSuffix(pc.Prefix, "*")
+		pc.Glob = true
+	}
+	return nil
+}
+
+// checkControlGroupHCLKeys checks the keys of the control group of a path,
+// if it has one
+func checkControlGroupHCLKeys(node ast.Node) error {
+	obj, ok := node.(*ast.ObjectType)
+	if !ok {
+		return nil
+	}
+	valid := []string{
+		"group_names",
+		"approvals",
+		"ttl",
+	}
+	for _, item := range obj.List.Filter("control_group").Items {
+		if err := checkHCLKeys(item.Val, valid); err != nil {
+			return multierror.Prefix(err, "control_group:")
+		}
+	}
+	return nil
+}
+
 func checkHCLKeys(node ast.Node, valid []string) error {
 	var list *ast.ObjectList
 	switch n := node.(type) {
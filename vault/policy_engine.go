@@ -0,0 +1,113 @@
+package vault
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+// mfaMethodMetaKey is the token metadata key naming the MFA method the
+// login was verified with, as set by the MFA wrapper of auth backends
+const mfaMethodMetaKey = "mfa_method"
+
+// PolicyEngine evaluates requests against rules beyond the ACL policies,
+// such as rules written in an embedded policy language. The engines are
+// consulted for the requests the ACL allows, so they can only restrict
+// access. Root tokens are not subject to them.
+type PolicyEngine interface {
+	// Name identifies the engine in the reasons of its decisions
+	Name() string
+
+	// Evaluate decides whether the request is allowed. An error denies the
+	// request.
+	Evaluate(*PolicyInput) (*PolicyDecision, error)
+}
+
+// PolicyInput is the request and the token metadata given to the policy
+// engines
+type PolicyInput struct {
+	Operation logical.Operation
+	Path      string
+	Data      map[string]interface{}
+
+	// ClientIP is the address of the client, or nil if unknown
+	ClientIP net.IP
+
+	// Time is when the request is being evaluated
+	Time time.Time
+
+	// MFA is set if the login of the token was verified with a second
+	// factor, with MFAMethod
+	MFA       bool
+	MFAMethod string
+
+	// The token of the request
+	DisplayName   string
+	EntityID      string
+	Policies      []string
+	TokenMetadata map[string]string
+}
+
+// PolicyDecision is the decision of a policy engine on a request. The
+// reasons are recorded in the audit logs, whether the request is allowed
+// or not.
+type PolicyDecision struct {
+	Allowed bool
+	Reasons []string
+}
+
+// evaluatePolicyEngines consults the policy engines on a request the ACL
+// allows, and records the reasons of their decisions in the request. The
+// request is denied if any engine denies it or fails.
+func (c *Core) evaluatePolicyEngines(req *logical.Request, te *TokenEntry) error {
+	if len(c.policyEngines) == 0 {
+		return nil
+	}
+
+	input := &PolicyInput{
+		Operation:     req.Operation,
+		Path:          req.Path,
+		Data:          req.Data,
+		Time:          time.Now(),
+		MFAMethod:     te.Meta[mfaMethodMetaKey],
+		DisplayName:   te.DisplayName,
+		EntityID:      te.EntityID,
+		Policies:      c.tokenPolicies(te),
+		TokenMetadata: te.Meta,
+	}
+	input.MFA = input.MFAMethod != ""
+	if req.Connection != nil {
+		input.ClientIP = net.ParseIP(req.Connection.RemoteAddr)
+	}
+
+	allowed := true
+	req.PolicyReasons = nil
+	for _, engine := range c.policyEngines {
+		decision, err := engine.Evaluate(input)
+		if err != nil {
+			c.logger.Printf("[ERR] core: policy engine %s failed (request path: %s): %v",
+				engine.Name(), req.Path, err)
+			req.PolicyReasons = append(req.PolicyReasons,
+				fmt.Sprintf("%s: evaluation failed: %v", engine.Name(), err))
+			allowed = false
+			continue
+		}
+		if decision == nil {
+			continue
+		}
+		for _, reason := range decision.Reasons {
+			req.PolicyReasons = append(req.PolicyReasons, engine.Name()+": "+reason)
+		}
+		if !decision.Allowed {
+			allowed = false
+		}
+	}
+
+	if !allowed {
+		return errutil.WithCode(errutil.CodePolicyDenied, logical.ErrPermissionDenied)
+	}
+	return nil
+}
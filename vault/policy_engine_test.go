@@ -0,0 +1,129 @@
+package vault
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/audit"
+	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+// testPolicyEngine denies the requests to secret/denied and fails on the
+// requests to secret/broken
+type testPolicyEngine struct {
+	inputs []*PolicyInput
+}
+
+func (e *testPolicyEngine) Name() string {
+	return "test"
+}
+
+func (e *testPolicyEngine) Evaluate(input *PolicyInput) (*PolicyDecision, error) {
+	e.inputs = append(e.inputs, input)
+	switch input.Path {
+	case "secret/denied":
+		return &PolicyDecision{Reasons: []string{"outside change window"}}, nil
+	case "secret/broken":
+		return nil, fmt.Errorf("rule error")
+	}
+	return &PolicyDecision{Allowed: true, Reasons: []string{"within change window"}}, nil
+}
+
+func TestCore_PolicyEngine(t *testing.T) {
+	engine := &testPolicyEngine{}
+	noop := &NoopAudit{}
+	c, _, root := TestCoreUnsealed(t)
+	c.policyEngines = []PolicyEngine{engine}
+	c.auditBackends["noop"] = func(config *audit.BackendConfig) (audit.Backend, error) {
+		noop = &NoopAudit{
+			Config: config,
+		}
+		return noop, nil
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/audit/noop")
+	req.Data["type"] = "noop"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/policy/secrets")
+	req.ClientToken = root
+	req.Data["rules"] = `path "secret/*" { capabilities = ["create", "read", "update"] }`
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "auth/token/create")
+	req.ClientToken = root
+	req.Data["id"] = "child"
+	req.Data["policies"] = []string{"secrets"}
+	req.Data["meta"] = map[string]interface{}{"mfa_method": "duo"}
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Root tokens are not subject to the engines
+	if len(engine.inputs) != 0 {
+		t.Fatalf("bad: %#v", engine.inputs)
+	}
+
+	write := func(path string) (*logical.Request, error) {
+		req := logical.TestRequest(t, logical.UpdateOperation, path)
+		req.ClientToken = "child"
+		req.Data["foo"] = "bar"
+		req.Connection = &logical.Connection{RemoteAddr: "127.0.0.1"}
+		_, err := c.HandleRequest(req)
+		return req, err
+	}
+
+	req, err := write("secret/foo")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(engine.inputs) != 1 {
+		t.Fatalf("bad: %#v", engine.inputs)
+	}
+	input := engine.inputs[0]
+	if input.Path != "secret/foo" || input.Operation != logical.CreateOperation ||
+		input.ClientIP.String() != "127.0.0.1" || !input.MFA || input.MFAMethod != "duo" ||
+		!strutil.StrListContains(input.Policies, "secrets") || input.Time.IsZero() {
+		t.Fatalf("bad: %#v", input)
+	}
+	if noop.Req[len(noop.Req)-1] != req ||
+		!reflect.DeepEqual(req.PolicyReasons, []string{"test: within change window"}) {
+		t.Fatalf("bad: %#v", req.PolicyReasons)
+	}
+
+	req, err = write("secret/denied")
+	if err == nil {
+		t.Fatal("expected permission denied")
+	}
+	if noop.Req[len(noop.Req)-1] != req || noop.ReqErrs[len(noop.ReqErrs)-1] == nil ||
+		!reflect.DeepEqual(req.PolicyReasons, []string{"test: outside change window"}) {
+		t.Fatalf("bad: %#v", req.PolicyReasons)
+	}
+
+	// Failing engines deny the request
+	req, err = write("secret/broken")
+	if err == nil {
+		t.Fatal("expected permission denied")
+	}
+	if !reflect.DeepEqual(req.PolicyReasons, []string{"test: evaluation failed: rule error"}) {
+		t.Fatalf("bad: %#v", req.PolicyReasons)
+	}
+
+	// Requests the ACL denies do not reach the engines
+	engine.inputs = nil
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/mounts")
+	req.ClientToken = "child"
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatal("expected permission denied")
+	}
+	if len(engine.inputs) != 0 {
+		t.Fatalf("bad: %#v", engine.inputs)
+	}
+}
@@ -0,0 +1,248 @@
+package vault
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/helper/duration"
+	"github.com/hashicorp/vault/helper/strutil"
+)
+
+// parameterWildcard is the parameter name standing for all the parameters
+// not listed in allowed_parameters or denied_parameters
+const parameterWildcard = "*"
+
+// PathPermissions restricts the requests to a path beyond its capabilities.
+//
+// The parameters of writes are restricted by name and value. A parameter
+// name maps to the values it may or may not take, and an empty list of
+// values stands for any value. Values are compared by their string form, as
+// numbers decoded from requests and from policies have different types.
+//
+// The responses can be required to be wrapped, with a TTL within bounds,
+// and the requests can be held until approved through a control group.
+type PathPermissions struct {
+	// AllowedParameters are the only parameters that may be written, unless
+	// it is nil
+	AllowedParameters map[string][]string `hcl:"allowed_parameters"`
+
+	// DeniedParameters are the parameters that may not be written, which
+	// takes precedence over AllowedParameters
+	DeniedParameters map[string][]string `hcl:"denied_parameters"`
+
+	// RequiredParameters are the parameters that must be written
+	RequiredParameters []string `hcl:"required_parameters"`
+
+	// MinWrappingTTL and MaxWrappingTTL bound the TTL of the wrapping token
+	// of the responses. If either is set, responses must be wrapped.
+	MinWrappingTTL time.Duration `hcl:"-"`
+	MaxWrappingTTL time.Duration `hcl:"-"`
+
+	MinWrappingTTLHCL string `hcl:"min_wrapping_ttl"`
+	MaxWrappingTTLHCL string `hcl:"max_wrapping_ttl"`
+
+	// ControlGroup holds the requests until approved, unless it is nil
+	ControlGroup *ControlGroup `hcl:"control_group"`
+}
+
+// empty returns whether the permissions restrict nothing
+func (p *PathPermissions) empty() bool {
+	return p.AllowedParameters == nil && len(p.DeniedParameters) == 0 && len(p.RequiredParameters) == 0 &&
+		p.MinWrappingTTL == 0 && p.MaxWrappingTTL == 0 && p.ControlGroup == nil
+}
+
+// validate parses the wrapping TTLs and checks that the permissions are
+// consistent
+func (p *PathPermissions) validate() error {
+	for _, name := range p.RequiredParameters {
+		if name == parameterWildcard {
+			return fmt.Errorf("%q cannot be a required parameter", parameterWildcard)
+		}
+	}
+
+	var err error
+	if p.MinWrappingTTLHCL != "" {
+		if p.MinWrappingTTL, err = duration.ParseDurationSecond(p.MinWrappingTTLHCL); err != nil {
+			return fmt.Errorf("invalid min_wrapping_ttl: %v", err)
+		}
+	}
+	if p.MaxWrappingTTLHCL != "" {
+		if p.MaxWrappingTTL, err = duration.ParseDurationSecond(p.MaxWrappingTTLHCL); err != nil {
+			return fmt.Errorf("invalid max_wrapping_ttl: %v", err)
+		}
+	}
+	if p.MinWrappingTTL < 0 || p.MaxWrappingTTL < 0 {
+		return fmt.Errorf("wrapping TTLs cannot be negative")
+	}
+	if p.MaxWrappingTTL != 0 && p.MinWrappingTTL > p.MaxWrappingTTL {
+		return fmt.Errorf("min_wrapping_ttl cannot be greater than max_wrapping_ttl")
+	}
+
+	if p.ControlGroup != nil {
+		return p.ControlGroup.validate()
+	}
+	return nil
+}
+
+// allowsWrapping returns whether a response wrapped with the given TTL, or
+// not wrapped if it is zero, satisfies the permissions
+func (p *PathPermissions) allowsWrapping(wrapTTL time.Duration) bool {
+	if p.MinWrappingTTL == 0 && p.MaxWrappingTTL == 0 {
+		return true
+	}
+	if wrapTTL <= 0 || wrapTTL < p.MinWrappingTTL {
+		return false
+	}
+	return p.MaxWrappingTTL == 0 || wrapTTL <= p.MaxWrappingTTL
+}
+
+// allows returns whether the request data satisfies the permissions
+func (p *PathPermissions) allows(data map[string]interface{}) bool {
+	for _, name := range p.RequiredParameters {
+		if _, ok := data[name]; !ok {
+			return false
+		}
+	}
+
+	for name, value := range data {
+		denied, ok := p.DeniedParameters[name]
+		if !ok {
+			denied, ok = p.DeniedParameters[parameterWildcard]
+		}
+		if ok && (len(denied) == 0 || anyParameterValueIn(value, denied)) {
+			return false
+		}
+
+		if p.AllowedParameters == nil {
+			continue
+		}
+		allowed, ok := p.AllowedParameters[name]
+		if !ok {
+			allowed, ok = p.AllowedParameters[parameterWildcard]
+		}
+		if !ok || (len(allowed) > 0 && !allParameterValuesIn(value, allowed)) {
+			return false
+		}
+	}
+	return true
+}
+
+// parameterValues returns the values of a request parameter, which are the
+// elements of lists
+func parameterValues(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		return v
+	case []string:
+		values := make([]interface{}, 0, len(v))
+		for _, s := range v {
+			values = append(values, s)
+		}
+		return values
+	}
+	return []interface{}{value}
+}
+
+// parameterValueIn returns whether a value is in a list of policy values
+func parameterValueIn(value interface{}, values []string) bool {
+	return strutil.StrListContains(values, fmt.Sprint(value))
+}
+
+// anyParameterValueIn returns whether any value of a request parameter is
+// in a list of policy values
+func anyParameterValueIn(value interface{}, values []string) bool {
+	for _, v := range parameterValues(value) {
+		if parameterValueIn(v, values) {
+			return true
+		}
+	}
+	return false
+}
+
+// allParameterValuesIn returns whether all the values of a request
+// parameter are in a list of policy values
+func allParameterValuesIn(value interface{}, values []string) bool {
+	for _, v := range parameterValues(value) {
+		if !parameterValueIn(v, values) {
+			return false
+		}
+	}
+	return true
+}
+
+// mergePathPermissions combines the permissions of two policies for the
+// same path, either of which may be nil. Allowed and required parameters
+// are combined permissively, as either policy grants access on its own,
+// while denied parameters always apply. Wrapping is required if either
+// policy requires it, within the widest bounds they set, and so is the
+// approval of a control group.
+func mergePathPermissions(a, b *PathPermissions) *PathPermissions {
+	if a == nil && b == nil {
+		return nil
+	}
+	if a == nil {
+		a = &PathPermissions{}
+	}
+	if b == nil {
+		b = &PathPermissions{}
+	}
+
+	merged := &PathPermissions{
+		DeniedParameters: mergeParameterValues(a.DeniedParameters, b.DeniedParameters),
+	}
+	if a.AllowedParameters != nil && b.AllowedParameters != nil {
+		merged.AllowedParameters = mergeParameterValues(a.AllowedParameters, b.AllowedParameters)
+	}
+	for _, name := range a.RequiredParameters {
+		if strutil.StrListContains(b.RequiredParameters, name) {
+			merged.RequiredParameters = append(merged.RequiredParameters, name)
+		}
+	}
+
+	merged.MinWrappingTTL = mergeWrappingTTL(a.MinWrappingTTL, b.MinWrappingTTL, false)
+	merged.MaxWrappingTTL = mergeWrappingTTL(a.MaxWrappingTTL, b.MaxWrappingTTL, true)
+	merged.ControlGroup = mergeControlGroups(a.ControlGroup, b.ControlGroup)
+
+	if merged.empty() {
+		return nil
+	}
+	return merged
+}
+
+// mergeParameterValues returns the union of two parameter maps. A parameter
+// with any value in either map takes any value.
+func mergeParameterValues(a, b map[string][]string) map[string][]string {
+	if a == nil && b == nil {
+		return nil
+	}
+	merged := make(map[string][]string, len(a)+len(b))
+	for _, params := range []map[string][]string{a, b} {
+		for name, values := range params {
+			existing, ok := merged[name]
+			switch {
+			case !ok:
+				merged[name] = values
+			case len(existing) == 0 || len(values) == 0:
+				merged[name] = []string{}
+			default:
+				merged[name] = append(append([]string{}, existing...), values...)
+			}
+		}
+	}
+	return merged
+}
+
+// mergeWrappingTTL combines the wrapping TTL bounds of two policies, either
+// of which may be unset, keeping the lower minimum or the greater maximum
+func mergeWrappingTTL(a, b time.Duration, max bool) time.Duration {
+	switch {
+	case a == 0:
+		return b
+	case b == 0:
+		return a
+	case (a > b) == max:
+		return a
+	default:
+		return b
+	}
+}
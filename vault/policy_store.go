@@ -63,6 +63,10 @@ path "sys/renew" {
 path "sys/renew/*" {
     capabilities = ["update"]
 }
+
+path "sys/control-group/request" {
+    capabilities = ["update"]
+}
 `
 )
 
@@ -81,6 +85,11 @@ var (
 type PolicyStore struct {
 	view *BarrierView
 	lru  *lru.TwoQueueCache
+
+	// namespacePath is set if the store holds the policies of a namespace,
+	// whose paths are relative to the namespace. There is no root policy
+	// in a namespace.
+	namespacePath string
 }
 
 // PolicyEntry is used to store a policy by name
@@ -174,6 +183,9 @@ func (ps *PolicyStore) setPolicyInternal(p *Policy) error {
 
 	if ps.lru != nil {
 		// Update the LRU cache
+		if ps.namespacePath != "" {
+			p = namespacePolicy(ps.namespacePath, p)
+		}
 		ps.lru.Add(p.Name, p)
 	}
 	return nil
@@ -190,7 +202,7 @@ func (ps *PolicyStore) GetPolicy(name string) (*Policy, error) {
 	}
 
 	// Special case the root policy
-	if name == "root" {
+	if name == "root" && ps.namespacePath == "" {
 		p := &Policy{Name: "root"}
 		if ps.lru != nil {
 			ps.lru.Add(p.Name, p)
@@ -235,6 +247,12 @@ func (ps *PolicyStore) GetPolicy(name string) (*Policy, error) {
 		policy = p
 	}
 
+	// The paths of the policies of a namespace are enforced where the
+	// requests in the namespace are routed to
+	if ps.namespacePath != "" {
+		policy = namespacePolicy(ps.namespacePath, policy)
+	}
+
 	if ps.lru != nil {
 		// Update the LRU cache
 		ps.lru.Add(name, policy)
@@ -292,6 +310,13 @@ func (ps *PolicyStore) DeletePolicy(name string) error {
 // ACL is used to return an ACL which is built using the
 // named policies.
 func (ps *PolicyStore) ACL(names ...string) (*ACL, error) {
+	return ps.EntityACL(nil, names...)
+}
+
+// EntityACL is used to return an ACL which is built using the named
+// policies, with their templated paths interpolated for the given entity.
+// Templated paths grant nothing without an entity.
+func (ps *PolicyStore) EntityACL(entity *Entity, names ...string) (*ACL, error) {
 	// Fetch the policies
 	var policy []*Policy
 	for _, name := range names {
@@ -299,6 +324,9 @@ func (ps *PolicyStore) ACL(names ...string) (*ACL, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to get policy '%s': %v", name, err)
 		}
+		if p != nil {
+			p = p.resolveTemplates(entity)
+		}
 		policy = append(policy, p)
 	}
 
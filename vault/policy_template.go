@@ -0,0 +1,150 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// templateStart and templateEnd delimit the identity fields
+	// interpolated in the paths of policies
+	templateStart = "{{"
+	templateEnd   = "}}"
+
+	// templateMetadataPrefix is the prefix of the template fields naming a
+	// metadata key of the entity
+	templateMetadataPrefix = "identity.entity.metadata."
+)
+
+// templateFields are the template fields besides entity metadata
+var templateFields = map[string]func(*Entity) string{
+	"identity.entity.id":   func(e *Entity) string { return e.ID },
+	"identity.entity.name": func(e *Entity) string { return e.Name },
+}
+
+// parsePathTemplate splits a path template into the literal parts and the
+// names of the fields between them, so that there is one more part than
+// fields
+func parsePathTemplate(tmpl string) ([]string, []string, error) {
+	var parts, fields []string
+	for {
+		start := strings.Index(tmpl, templateStart)
+		if start < 0 {
+			if strings.Contains(tmpl, templateEnd) {
+				return nil, nil, fmt.Errorf("unmatched %q", templateEnd)
+			}
+			return append(parts, tmpl), fields, nil
+		}
+		end := strings.Index(tmpl[start:], templateEnd)
+		if end < 0 {
+			return nil, nil, fmt.Errorf("unterminated %q", templateStart)
+		}
+		end += start
+
+		if strings.Contains(tmpl[:start], templateEnd) {
+			return nil, nil, fmt.Errorf("unmatched %q", templateEnd)
+		}
+		parts = append(parts, tmpl[:start])
+		fields = append(fields, strings.TrimSpace(tmpl[start+len(templateStart):end]))
+		tmpl = tmpl[end+len(templateEnd):]
+	}
+}
+
+// validatePathTemplate checks that a path template only references known
+// fields
+func validatePathTemplate(tmpl string) error {
+	_, fields, err := parsePathTemplate(tmpl)
+	if err != nil {
+		return err
+	}
+	for _, field := range fields {
+		if _, ok := templateFields[field]; ok {
+			continue
+		}
+		if strings.HasPrefix(field, templateMetadataPrefix) && len(field) > len(templateMetadataPrefix) {
+			continue
+		}
+		return fmt.Errorf("invalid template field %q", field)
+	}
+	return nil
+}
+
+// interpolatePathTemplate replaces the fields of a path template with the
+// values of the entity. It returns false if the template cannot be
+// resolved, because there is no entity, a metadata key is missing or a
+// value could match other paths than the template intends to.
+func interpolatePathTemplate(tmpl string, entity *Entity) (string, bool) {
+	if entity == nil {
+		return "", false
+	}
+	parts, fields, err := parsePathTemplate(tmpl)
+	if err != nil {
+		return "", false
+	}
+
+	path := parts[0]
+	for i, field := range fields {
+		var value string
+		if f, ok := templateFields[field]; ok {
+			value = f(entity)
+		} else {
+			value = entity.Metadata[strings.TrimPrefix(field, templateMetadataPrefix)]
+		}
+		if !validTemplateValue(value) {
+			return "", false
+		}
+		path += value + parts[i+1]
+	}
+	return path, true
+}
+
+// validTemplateValue returns whether a value can be interpolated in a path.
+// Values spanning several segments or containing wildcards would grant
+// access beyond the space of the entity.
+func validTemplateValue(value string) bool {
+	if value == "" || value == "." || value == ".." {
+		return false
+	}
+	return !strings.ContainsAny(value, "/*+{}")
+}
+
+// resolveTemplates returns the policy with its templated paths interpolated
+// for the entity. Paths that cannot be resolved are dropped, so they grant
+// nothing. The policy itself is left untouched, as it may be cached.
+func (p *Policy) resolveTemplates(entity *Entity) *Policy {
+	templated := false
+	for _, pc := range p.Paths {
+		if pc.Templated {
+			templated = true
+			break
+		}
+	}
+	if !templated {
+		return p
+	}
+
+	resolved := &Policy{
+		Name:  p.Name,
+		Raw:   p.Raw,
+		Paths: make([]*PathCapabilities, 0, len(p.Paths)),
+	}
+	for _, pc := range p.Paths {
+		if !pc.Templated {
+			resolved.Paths = append(resolved.Paths, pc)
+			continue
+		}
+
+		path, ok := interpolatePathTemplate(pc.Prefix, entity)
+		if !ok {
+			continue
+		}
+		rpc := *pc
+		rpc.Prefix = path
+		rpc.Templated = false
+		if err := rpc.compile(); err != nil {
+			continue
+		}
+		resolved.Paths = append(resolved.Paths, &rpc)
+	}
+	return resolved
+}
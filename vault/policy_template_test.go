@@ -0,0 +1,143 @@
+package vault
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestPolicy_ParseBadTemplate(t *testing.T) {
+	for _, path := range []string{
+		"secret/{{identity.entity.name}",
+		"secret/{{identity.entity.password}}/*",
+		"secret/{{identity.entity.metadata.}}/*",
+		"secret/}}{{identity.entity.name}}",
+	} {
+		_, err := Parse(`path "` + path + `" { capabilities = ["read"] }`)
+		if err == nil {
+			t.Fatalf("%s: expected error", path)
+		}
+		if !strings.Contains(err.Error(), `path "`+path+`":`) {
+			t.Errorf("bad error: %s", err)
+		}
+	}
+}
+
+func TestPolicy_ResolveTemplates(t *testing.T) {
+	p, err := Parse(strings.TrimSpace(`
+path "secret/shared" {
+	capabilities = ["read"]
+}
+path "secret/{{identity.entity.name}}/*" {
+	capabilities = ["create", "read"]
+}
+path "secret/teams/{{ identity.entity.metadata.team }}/+/config" {
+	segment_wildcards = true
+	capabilities = ["read"]
+}
+`))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !p.Paths[1].Templated || p.Paths[1].Glob || p.Paths[1].Prefix != "secret/{{identity.entity.name}}/*" {
+		t.Fatalf("bad: %#v", p.Paths[1])
+	}
+
+	// Without an entity, only the plain paths remain
+	if resolved := p.resolveTemplates(nil); len(resolved.Paths) != 1 {
+		t.Fatalf("bad: %#v", resolved.Paths)
+	}
+
+	resolved := p.resolveTemplates(&Entity{
+		Name:     "alice",
+		Metadata: map[string]string{"team": "ops"},
+	})
+	if len(resolved.Paths) != 3 {
+		t.Fatalf("bad: %#v", resolved.Paths)
+	}
+	if pc := resolved.Paths[1]; pc.Prefix != "secret/alice/" || !pc.Glob {
+		t.Fatalf("bad: %#v", pc)
+	}
+	if pc := resolved.Paths[2]; pc.Prefix != "secret/teams/ops/+/config" || pc.Pattern == nil {
+		t.Fatalf("bad: %#v", pc)
+	}
+
+	// The policy itself is left untouched
+	if !p.Paths[1].Templated || p.Paths[1].Prefix != "secret/{{identity.entity.name}}/*" {
+		t.Fatalf("bad: %#v", p.Paths[1])
+	}
+
+	// Values that would escape the space of the entity drop the path
+	for _, team := range []string{"", "..", "ops/admin", "*", "+"} {
+		resolved := p.resolveTemplates(&Entity{
+			Name:     "alice",
+			Metadata: map[string]string{"team": team},
+		})
+		if len(resolved.Paths) != 2 {
+			t.Fatalf("%q: bad: %#v", team, resolved.Paths)
+		}
+	}
+}
+
+func TestCore_TemplatedPolicy(t *testing.T) {
+	c, _, root := testCoreIdentityLogin(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/policy/foo")
+	req.ClientToken = root
+	req.Data["rules"] = `path "secret/{{identity.entity.name}}/*" { capabilities = ["create", "read", "update"] }`
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	auth := testCoreLogin(t, c, "auth/foo/login")
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/identity/entity/id/"+auth.EntityID)
+	req.ClientToken = root
+	req.Data["name"] = "alice"
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	write := func(token, path string) error {
+		req := logical.TestRequest(t, logical.UpdateOperation, path)
+		req.ClientToken = token
+		req.Data["foo"] = "bar"
+		_, err := c.HandleRequest(req)
+		return err
+	}
+	if err := write(auth.ClientToken, "secret/alice/foo"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := write(auth.ClientToken, "secret/bob/foo"); err == nil {
+		t.Fatal("expected permission denied")
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/capabilities")
+	req.ClientToken = root
+	req.Data["token"] = auth.ClientToken
+	req.Data["path"] = "secret/alice/foo"
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(resp.Data["capabilities"].([]string)) != 3 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Tokens without an entity are granted nothing by the template
+	testCoreMakeToken(t, c, root, "noentity", "", []string{"foo"})
+	if err := write("noentity", "secret/alice/foo"); err == nil {
+		t.Fatal("expected permission denied")
+	}
+
+	// Renaming the entity moves its space
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/identity/entity/id/"+auth.EntityID)
+	req.ClientToken = root
+	req.Data["name"] = "bob"
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := write(auth.ClientToken, "secret/bob/foo"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
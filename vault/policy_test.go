@@ -4,6 +4,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 var rawPolicy = strings.TrimSpace(`
@@ -52,7 +53,7 @@ func TestPolicy_Parse(t *testing.T) {
 		&PathCapabilities{"", "deny",
 			[]string{
 				"deny",
-			}, DenyCapabilityInt, true},
+			}, DenyCapabilityInt, true, false, nil, false, nil},
 		&PathCapabilities{"stage/", "sudo",
 			[]string{
 				"create",
@@ -62,22 +63,22 @@ func TestPolicy_Parse(t *testing.T) {
 				"list",
 				"sudo",
 			}, CreateCapabilityInt | ReadCapabilityInt | UpdateCapabilityInt |
-				DeleteCapabilityInt | ListCapabilityInt | SudoCapabilityInt, true},
+				DeleteCapabilityInt | ListCapabilityInt | SudoCapabilityInt, true, false, nil, false, nil},
 		&PathCapabilities{"prod/version", "read",
 			[]string{
 				"read",
 				"list",
-			}, ReadCapabilityInt | ListCapabilityInt, false},
+			}, ReadCapabilityInt | ListCapabilityInt, false, false, nil, false, nil},
 		&PathCapabilities{"foo/bar", "read",
 			[]string{
 				"read",
 				"list",
-			}, ReadCapabilityInt | ListCapabilityInt, false},
+			}, ReadCapabilityInt | ListCapabilityInt, false, false, nil, false, nil},
 		&PathCapabilities{"foo/bar", "",
 			[]string{
 				"create",
 				"sudo",
-			}, CreateCapabilityInt | SudoCapabilityInt, false},
+			}, CreateCapabilityInt | SudoCapabilityInt, false, false, nil, false, nil},
 	}
 	if !reflect.DeepEqual(p.Paths, expect) {
 		t.Errorf("expected \n\n%#v\n\n to be \n\n%#v\n\n", p.Paths, expect)
@@ -148,3 +149,107 @@ path "/" {
 		t.Errorf("bad error: %s", err)
 	}
 }
+
+func TestPolicy_ParseBadSegmentWildcards(t *testing.T) {
+	_, err := Parse(strings.TrimSpace(`
+path "secret/+a/config" {
+	segment_wildcards = true
+	capabilities = ["read"]
+}
+`))
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+
+	if !strings.Contains(err.Error(), `path "secret/+a/config":`) {
+		t.Errorf("bad error: %s", err)
+	}
+
+	// Without segment wildcards the same path is literal
+	p, err := Parse(strings.TrimSpace(`
+path "secret/+a/config" {
+	capabilities = ["read"]
+}
+`))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if p.Paths[0].Prefix != "secret/+a/config" || p.Paths[0].Pattern != nil {
+		t.Fatalf("bad: %#v", p.Paths[0])
+	}
+}
+
+func TestPolicy_ParseParameters(t *testing.T) {
+	p, err := Parse(strings.TrimSpace(`
+path "db/creds/app" {
+	capabilities = ["update"]
+	allowed_parameters = {
+		"password" = []
+		"ttl" = ["1h", 3600]
+	}
+	denied_parameters = {
+		"username" = []
+	}
+	required_parameters = ["password"]
+}
+path "db/other" {
+	capabilities = ["update"]
+}
+`))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	expect := &PathPermissions{
+		AllowedParameters: map[string][]string{
+			"password": []string{},
+			"ttl":      []string{"1h", "3600"},
+		},
+		DeniedParameters: map[string][]string{
+			"username": []string{},
+		},
+		RequiredParameters: []string{"password"},
+	}
+	if !reflect.DeepEqual(p.Paths[0].Permissions, expect) {
+		t.Fatalf("expected \n\n%#v\n\n to be \n\n%#v\n\n", p.Paths[0].Permissions, expect)
+	}
+	if p.Paths[1].Permissions != nil {
+		t.Fatalf("bad: %#v", p.Paths[1].Permissions)
+	}
+
+	_, err = Parse(strings.TrimSpace(`
+path "db/creds/app" {
+	capabilities = ["update"]
+	required_parameters = ["*"]
+}
+`))
+	if err == nil || !strings.Contains(err.Error(), `path "db/creds/app":`) {
+		t.Fatalf("bad error: %v", err)
+	}
+}
+
+func TestPolicy_ParseWrappingTTL(t *testing.T) {
+	p, err := Parse(strings.TrimSpace(`
+path "pki/issue/web" {
+	capabilities = ["update"]
+	min_wrapping_ttl = 60
+	max_wrapping_ttl = "1h"
+}
+`))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	perms := p.Paths[0].Permissions
+	if perms == nil || perms.MinWrappingTTL != time.Minute || perms.MaxWrappingTTL != time.Hour {
+		t.Fatalf("bad: %#v", perms)
+	}
+
+	for _, rules := range []string{
+		`path "a" { capabilities = ["read"] min_wrapping_ttl = "soon" }`,
+		`path "a" { capabilities = ["read"] min_wrapping_ttl = "1h" max_wrapping_ttl = "1m" }`,
+	} {
+		if _, err := Parse(rules); err == nil || !strings.Contains(err.Error(), `path "a":`) {
+			t.Fatalf("%s: bad error: %v", rules, err)
+		}
+	}
+}
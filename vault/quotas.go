@@ -0,0 +1,261 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// coreLeaseCountQuotaPath is used to store the lease count quotas, one
+	// entry per quota
+	coreLeaseCountQuotaPath = "core/quotas/lease-count/"
+)
+
+var (
+	// errLoadLeaseCountQuotasFailed if loading the lease count quotas
+	// encounters an error
+	errLoadLeaseCountQuotasFailed = errors.New("failed to load lease count quotas")
+)
+
+// LeaseCountQuota caps the number of active leases issued under Path,
+// which is a prefix of the request paths such as a mount or the path of a
+// role of a secret backend. If Role is set, only the tokens issued by the
+// auth mount at Path for that role are counted.
+type LeaseCountQuota struct {
+	Name      string `json:"name"`
+	Path      string `json:"path"`
+	Role      string `json:"role,omitempty"`
+	MaxLeases int    `json:"max_leases"`
+}
+
+// validate checks that the quota can be used
+func (q *LeaseCountQuota) validate() error {
+	if q.Name == "" {
+		return fmt.Errorf("missing name")
+	}
+	if q.MaxLeases <= 0 {
+		return fmt.Errorf("max_leases must be positive")
+	}
+	if q.Role != "" && !strings.HasPrefix(q.Path, credentialRoutePrefix) {
+		return fmt.Errorf("a role can only be given for an auth mount")
+	}
+	return nil
+}
+
+// matches returns whether the quota counts the lease with the given ID and
+// role. The ID can also be the prefix of the leases a request would issue.
+func (q *LeaseCountQuota) matches(leaseID, role string) bool {
+	if !strings.HasPrefix(leaseID, q.Path) {
+		return false
+	}
+	return q.Role == "" || q.Role == role
+}
+
+// leaseQuotaCount is a lease count quota with the number of pending leases
+// it counts
+type leaseQuotaCount struct {
+	quota *LeaseCountQuota
+	count int
+}
+
+// leaseRole returns the role the token of an auth lease was issued for, as
+// reported by the auth backend, or the empty string
+func leaseRole(auth *logical.Auth) string {
+	if auth == nil {
+		return ""
+	}
+	if role := auth.Metadata["role"]; role != "" {
+		return role
+	}
+	role, _ := auth.InternalData["role_name"].(string)
+	return role
+}
+
+// setLeaseQuotas replaces the lease count quotas and counts the pending
+// leases of each one
+func (m *ExpirationManager) setLeaseQuotas(quotas []*LeaseCountQuota) {
+	m.pendingLock.Lock()
+	defer m.pendingLock.Unlock()
+
+	counts := make([]*leaseQuotaCount, 0, len(quotas))
+	for _, quota := range quotas {
+		qc := &leaseQuotaCount{quota: quota}
+		for leaseID := range m.pending {
+			if quota.matches(leaseID, m.pendingRoles[leaseID]) {
+				qc.count++
+			}
+		}
+		counts = append(counts, qc)
+	}
+	m.quotas = counts
+}
+
+// leaseQuotaUsage returns the number of pending leases counted by the
+// named quota
+func (m *ExpirationManager) leaseQuotaUsage(name string) int {
+	m.pendingLock.Lock()
+	defer m.pendingLock.Unlock()
+	for _, qc := range m.quotas {
+		if qc.quota.Name == name {
+			return qc.count
+		}
+	}
+	return 0
+}
+
+// checkLeaseQuotas returns an error if a lease issued at the given path for
+// the given role would exceed a lease count quota
+func (m *ExpirationManager) checkLeaseQuotas(reqPath, role string) error {
+	m.pendingLock.Lock()
+	defer m.pendingLock.Unlock()
+
+	// Leases are issued under the request path
+	prefix := strings.TrimSuffix(reqPath, "/") + "/"
+	for _, qc := range m.quotas {
+		if qc.quota.matches(prefix, role) && qc.count >= qc.quota.MaxLeases {
+			return errutil.WithCode(errutil.CodeLeaseQuotaExceeded, fmt.Errorf(
+				"lease count quota %q exceeded: %d leases are active out of %d allowed",
+				qc.quota.Name, qc.count, qc.quota.MaxLeases))
+		}
+	}
+	return nil
+}
+
+// countLease updates the quotas for a lease that became pending or was
+// removed. This must be called with pendingLock held.
+func (m *ExpirationManager) countLease(leaseID, role string, delta int) {
+	for _, qc := range m.quotas {
+		if qc.quota.matches(leaseID, role) {
+			qc.count += delta
+		}
+	}
+}
+
+// LeaseCountQuota returns the named lease count quota, or nil if it does
+// not exist
+func (c *Core) LeaseCountQuota(name string) *LeaseCountQuota {
+	c.quotaLock.RLock()
+	defer c.quotaLock.RUnlock()
+	return c.leaseQuotas[name]
+}
+
+// LeaseCountQuotaNames returns the names of the lease count quotas, sorted
+func (c *Core) LeaseCountQuotaNames() []string {
+	c.quotaLock.RLock()
+	defer c.quotaLock.RUnlock()
+	names := make([]string, 0, len(c.leaseQuotas))
+	for name := range c.leaseQuotas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LeaseCountQuotaUsage returns the number of active leases counted by the
+// named quota
+func (c *Core) LeaseCountQuotaUsage(name string) int {
+	return c.expiration.leaseQuotaUsage(name)
+}
+
+// setLeaseCountQuota persists the given quota, replacing the quota with the
+// same name, and starts enforcing it
+func (c *Core) setLeaseCountQuota(quota *LeaseCountQuota) error {
+	if err := quota.validate(); err != nil {
+		return err
+	}
+
+	buf, err := json.Marshal(quota)
+	if err != nil {
+		return fmt.Errorf("failed to encode lease count quota: %v", err)
+	}
+
+	c.quotaLock.Lock()
+	defer c.quotaLock.Unlock()
+
+	if err := c.barrier.Put(&Entry{
+		Key:   coreLeaseCountQuotaPath + quota.Name,
+		Value: buf,
+	}); err != nil {
+		c.logger.Printf("[ERR] core: failed to persist lease count quota: %v", err)
+		return err
+	}
+
+	quotas := make(map[string]*LeaseCountQuota, len(c.leaseQuotas)+1)
+	for name, q := range c.leaseQuotas {
+		quotas[name] = q
+	}
+	quotas[quota.Name] = quota
+	c.applyLeaseCountQuotas(quotas)
+	return nil
+}
+
+// deleteLeaseCountQuota removes the named quota
+func (c *Core) deleteLeaseCountQuota(name string) error {
+	c.quotaLock.Lock()
+	defer c.quotaLock.Unlock()
+
+	if err := c.barrier.Delete(coreLeaseCountQuotaPath + name); err != nil {
+		c.logger.Printf("[ERR] core: failed to delete lease count quota: %v", err)
+		return err
+	}
+
+	quotas := make(map[string]*LeaseCountQuota, len(c.leaseQuotas))
+	for n, q := range c.leaseQuotas {
+		if n != name {
+			quotas[n] = q
+		}
+	}
+	c.applyLeaseCountQuotas(quotas)
+	return nil
+}
+
+// applyLeaseCountQuotas starts enforcing the given quotas. This must be
+// called with quotaLock held.
+func (c *Core) applyLeaseCountQuotas(quotas map[string]*LeaseCountQuota) {
+	list := make([]*LeaseCountQuota, 0, len(quotas))
+	for _, q := range quotas {
+		list = append(list, q)
+	}
+	c.expiration.setLeaseQuotas(list)
+	c.leaseQuotas = quotas
+}
+
+// loadLeaseCountQuotas reads the lease count quotas and starts enforcing
+// them. This must be called after the expiration manager is set up.
+func (c *Core) loadLeaseCountQuotas() error {
+	names, err := c.barrier.List(coreLeaseCountQuotaPath)
+	if err != nil {
+		c.logger.Printf("[ERR] core: failed to list lease count quotas: %v", err)
+		return errLoadLeaseCountQuotasFailed
+	}
+
+	quotas := make(map[string]*LeaseCountQuota, len(names))
+	for _, name := range names {
+		raw, err := c.barrier.Get(coreLeaseCountQuotaPath + name)
+		if err != nil {
+			c.logger.Printf("[ERR] core: failed to read lease count quota %s: %v", name, err)
+			return errLoadLeaseCountQuotasFailed
+		}
+		if raw == nil {
+			continue
+		}
+		quota := &LeaseCountQuota{}
+		if err := jsonutil.DecodeJSON(raw.Value, quota); err != nil {
+			c.logger.Printf("[ERR] core: failed to decode lease count quota %s: %v", name, err)
+			return errLoadLeaseCountQuotasFailed
+		}
+		quotas[quota.Name] = quota
+	}
+
+	c.quotaLock.Lock()
+	c.applyLeaseCountQuotas(quotas)
+	c.quotaLock.Unlock()
+	return nil
+}
@@ -0,0 +1,283 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// coreRateLimitQuotaPath is used to store the rate limit quotas, one
+	// entry per quota
+	coreRateLimitQuotaPath = "core/quotas/rate-limit/"
+)
+
+var (
+	// errLoadRateLimitQuotasFailed if loading the rate limit quotas
+	// encounters an error
+	errLoadRateLimitQuotasFailed = errors.New("failed to load rate limit quotas")
+)
+
+// RateLimitQuota limits the rate of the requests under Path, which is a
+// prefix of the request paths such as a mount; an empty Path applies to all
+// requests. Requests are allowed at Rate per second on average, with
+// bursts of up to Burst requests. Once a request is rejected, all requests
+// under Path are rejected for BlockInterval, if set.
+type RateLimitQuota struct {
+	Name          string        `json:"name"`
+	Path          string        `json:"path"`
+	Rate          float64       `json:"rate"`
+	Burst         int           `json:"burst,omitempty"`
+	BlockInterval time.Duration `json:"block_interval,omitempty"`
+}
+
+// validate checks that the quota can be used
+func (q *RateLimitQuota) validate() error {
+	if q.Name == "" {
+		return fmt.Errorf("missing name")
+	}
+	if q.Rate <= 0 || math.IsInf(q.Rate, 0) || math.IsNaN(q.Rate) {
+		return fmt.Errorf("rate must be positive")
+	}
+	if q.Burst < 0 {
+		return fmt.Errorf("burst cannot be negative")
+	}
+	if q.BlockInterval < 0 {
+		return fmt.Errorf("block_interval cannot be negative")
+	}
+	return nil
+}
+
+// burst returns the size of the bucket, which defaults to one second's
+// worth of requests
+func (q *RateLimitQuota) burst() float64 {
+	if q.Burst > 0 {
+		return float64(q.Burst)
+	}
+	return math.Max(1, math.Ceil(q.Rate))
+}
+
+// rateLimitState is the token bucket of a rate limit quota
+type rateLimitState struct {
+	quota        *RateLimitQuota
+	tokens       float64
+	last         time.Time
+	blockedUntil time.Time
+}
+
+// newRateLimitState returns the state of a quota with a full bucket
+func newRateLimitState(quota *RateLimitQuota, now time.Time) *rateLimitState {
+	return &rateLimitState{
+		quota:  quota,
+		tokens: quota.burst(),
+		last:   now,
+	}
+}
+
+// refill adds the tokens accumulated since the bucket was last used
+func (s *rateLimitState) refill(now time.Time) {
+	elapsed := now.Sub(s.last).Seconds()
+	if elapsed > 0 {
+		s.tokens = math.Min(s.quota.burst(), s.tokens+elapsed*s.quota.Rate)
+	}
+	s.last = now
+}
+
+// rateLimitQuotas enforces a set of rate limit quotas
+type rateLimitQuotas struct {
+	l      sync.Mutex
+	states map[string]*rateLimitState
+}
+
+// set replaces the quotas. The buckets of the quotas that did not change
+// are kept.
+func (r *rateLimitQuotas) set(quotas map[string]*RateLimitQuota, now time.Time) {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	states := make(map[string]*rateLimitState, len(quotas))
+	for name, quota := range quotas {
+		if s, ok := r.states[name]; ok && *s.quota == *quota {
+			states[name] = s
+			continue
+		}
+		states[name] = newRateLimitState(quota, now)
+	}
+	r.states = states
+}
+
+// allow takes a token from the bucket of every quota that applies to the
+// request path. If any of them is empty or blocked, no tokens are taken,
+// and an error naming the quota is returned.
+func (r *rateLimitQuotas) allow(reqPath string, now time.Time) error {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	var matching []*rateLimitState
+	for _, s := range r.states {
+		if strings.HasPrefix(reqPath, s.quota.Path) {
+			matching = append(matching, s)
+		}
+	}
+
+	for _, s := range matching {
+		s.refill(now)
+		if now.Before(s.blockedUntil) || s.tokens < 1 {
+			if s.quota.BlockInterval > 0 && !now.Before(s.blockedUntil) {
+				s.blockedUntil = now.Add(s.quota.BlockInterval)
+			}
+			return errutil.WithCode(errutil.CodeRateLimited, fmt.Errorf(
+				"rate limit quota %q exceeded", s.quota.Name))
+		}
+	}
+
+	for _, s := range matching {
+		s.tokens--
+	}
+	return nil
+}
+
+// rateLimitQuotaExempt returns whether a request is exempt from the rate
+// limit quotas, which is the case of the requests managing them so that a
+// misconfigured quota can always be fixed
+func rateLimitQuotaExempt(req *logical.Request) bool {
+	return strings.HasPrefix(req.Path, "sys/quotas/")
+}
+
+// checkRateLimitQuotas returns an error if a rate limit quota rejects the
+// request. Rejections are audited.
+func (c *Core) checkRateLimitQuotas(req *logical.Request) error {
+	if rateLimitQuotaExempt(req) {
+		return nil
+	}
+
+	err := c.rateLimiter.allow(req.Path, time.Now())
+	if err == nil {
+		return nil
+	}
+
+	metrics.IncrCounter([]string{"quota", "rate_limit", "rejected"}, 1)
+	if auditErr := c.auditBroker.LogRequest(nil, req, err); auditErr != nil {
+		c.logger.Printf("[ERR] core: failed to audit request with path (%s): %v",
+			req.Path, auditErr)
+		return ErrInternalError
+	}
+	return err
+}
+
+// RateLimitQuota returns the named rate limit quota, or nil if it does not
+// exist
+func (c *Core) RateLimitQuota(name string) *RateLimitQuota {
+	c.quotaLock.RLock()
+	defer c.quotaLock.RUnlock()
+	return c.rateQuotas[name]
+}
+
+// RateLimitQuotaNames returns the names of the rate limit quotas, sorted
+func (c *Core) RateLimitQuotaNames() []string {
+	c.quotaLock.RLock()
+	defer c.quotaLock.RUnlock()
+	names := make([]string, 0, len(c.rateQuotas))
+	for name := range c.rateQuotas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// setRateLimitQuota persists the given quota, replacing the quota with the
+// same name, and starts enforcing it
+func (c *Core) setRateLimitQuota(quota *RateLimitQuota) error {
+	if err := quota.validate(); err != nil {
+		return err
+	}
+
+	buf, err := json.Marshal(quota)
+	if err != nil {
+		return fmt.Errorf("failed to encode rate limit quota: %v", err)
+	}
+
+	c.quotaLock.Lock()
+	defer c.quotaLock.Unlock()
+
+	if err := c.barrier.Put(&Entry{
+		Key:   coreRateLimitQuotaPath + quota.Name,
+		Value: buf,
+	}); err != nil {
+		c.logger.Printf("[ERR] core: failed to persist rate limit quota: %v", err)
+		return err
+	}
+
+	quotas := make(map[string]*RateLimitQuota, len(c.rateQuotas)+1)
+	for name, q := range c.rateQuotas {
+		quotas[name] = q
+	}
+	quotas[quota.Name] = quota
+	c.rateLimiter.set(quotas, time.Now())
+	c.rateQuotas = quotas
+	return nil
+}
+
+// deleteRateLimitQuota removes the named quota
+func (c *Core) deleteRateLimitQuota(name string) error {
+	c.quotaLock.Lock()
+	defer c.quotaLock.Unlock()
+
+	if err := c.barrier.Delete(coreRateLimitQuotaPath + name); err != nil {
+		c.logger.Printf("[ERR] core: failed to delete rate limit quota: %v", err)
+		return err
+	}
+
+	quotas := make(map[string]*RateLimitQuota, len(c.rateQuotas))
+	for n, q := range c.rateQuotas {
+		if n != name {
+			quotas[n] = q
+		}
+	}
+	c.rateLimiter.set(quotas, time.Now())
+	c.rateQuotas = quotas
+	return nil
+}
+
+// loadRateLimitQuotas reads the rate limit quotas and starts enforcing them
+func (c *Core) loadRateLimitQuotas() error {
+	names, err := c.barrier.List(coreRateLimitQuotaPath)
+	if err != nil {
+		c.logger.Printf("[ERR] core: failed to list rate limit quotas: %v", err)
+		return errLoadRateLimitQuotasFailed
+	}
+
+	quotas := make(map[string]*RateLimitQuota, len(names))
+	for _, name := range names {
+		raw, err := c.barrier.Get(coreRateLimitQuotaPath + name)
+		if err != nil {
+			c.logger.Printf("[ERR] core: failed to read rate limit quota %s: %v", name, err)
+			return errLoadRateLimitQuotasFailed
+		}
+		if raw == nil {
+			continue
+		}
+		quota := &RateLimitQuota{}
+		if err := jsonutil.DecodeJSON(raw.Value, quota); err != nil {
+			c.logger.Printf("[ERR] core: failed to decode rate limit quota %s: %v", name, err)
+			return errLoadRateLimitQuotasFailed
+		}
+		quotas[quota.Name] = quota
+	}
+
+	c.quotaLock.Lock()
+	c.rateLimiter.set(quotas, time.Now())
+	c.rateQuotas = quotas
+	c.quotaLock.Unlock()
+	return nil
+}
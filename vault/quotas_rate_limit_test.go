@@ -0,0 +1,134 @@
+package vault
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestRateLimitQuotas_Allow(t *testing.T) {
+	var r rateLimitQuotas
+	now := time.Now()
+	r.set(map[string]*RateLimitQuota{
+		"secret": &RateLimitQuota{Name: "secret", Path: "secret/", Rate: 1, Burst: 2},
+		"global": &RateLimitQuota{Name: "global", Rate: 10, Burst: 3},
+	}, now)
+
+	// The burst of the most restrictive quota is used up
+	for i := 0; i < 2; i++ {
+		if err := r.allow("secret/foo", now); err != nil {
+			t.Fatalf("%d: err: %v", i, err)
+		}
+	}
+	err := r.allow("secret/foo", now)
+	if errutil.CodeOf(err) != errutil.CodeRateLimited {
+		t.Fatalf("expected rate limit error, got %v", err)
+	}
+
+	// The rejected request did not use up the global quota
+	if err := r.allow("cubbyhole/foo", now); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := r.allow("cubbyhole/foo", now); err == nil {
+		t.Fatal("expected rate limit error")
+	}
+
+	// Tokens are added back over time
+	now = now.Add(time.Second)
+	if err := r.allow("secret/foo", now); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// Unchanged quotas keep their bucket
+	r.set(map[string]*RateLimitQuota{
+		"secret": &RateLimitQuota{Name: "secret", Path: "secret/", Rate: 1, Burst: 2},
+	}, now)
+	if err := r.allow("secret/foo", now); err == nil {
+		t.Fatal("expected rate limit error")
+	}
+}
+
+func TestRateLimitQuotas_BlockInterval(t *testing.T) {
+	var r rateLimitQuotas
+	now := time.Now()
+	r.set(map[string]*RateLimitQuota{
+		"secret": &RateLimitQuota{Name: "secret", Path: "secret/", Rate: 1, BlockInterval: time.Minute},
+	}, now)
+
+	if err := r.allow("secret/foo", now); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := r.allow("secret/foo", now); err == nil {
+		t.Fatal("expected rate limit error")
+	}
+
+	// The bucket refilled, but requests stay blocked
+	now = now.Add(30 * time.Second)
+	if err := r.allow("secret/foo", now); err == nil {
+		t.Fatal("expected rate limit error")
+	}
+
+	now = now.Add(31 * time.Second)
+	if err := r.allow("secret/foo", now); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestCore_RateLimitQuota(t *testing.T) {
+	c, key, root := TestCoreUnsealed(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/quotas/rate-limit/secrets")
+	req.Data["path"] = "secret/"
+	req.Data["rate"] = "0.001"
+	req.Data["burst"] = 1
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	readSecret := func() error {
+		req := logical.TestRequest(t, logical.ReadOperation, "secret/foo")
+		req.ClientToken = root
+		_, err := c.HandleRequest(req)
+		return err
+	}
+	if err := readSecret(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := readSecret(); errutil.CodeOf(err) != errutil.CodeRateLimited {
+		t.Fatalf("expected rate limit error, got %v", err)
+	}
+
+	// Other paths and the quotas themselves are not limited
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/quotas/rate-limit/secrets")
+	req.ClientToken = root
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["rate"] != 0.001 || resp.Data["burst"] != 1 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// The quota survives a restart
+	if err := c.Seal(root); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if unseal, err := TestCoreUnseal(c, key); err != nil || !unseal {
+		t.Fatalf("err: %v", err)
+	}
+	if quota := c.RateLimitQuota("secrets"); quota == nil || quota.Path != "secret/" {
+		t.Fatalf("bad: %#v", quota)
+	}
+
+	req = logical.TestRequest(t, logical.DeleteOperation, "sys/quotas/rate-limit/secrets")
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := readSecret(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+package vault
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/helper/errutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestLeaseCountQuota_Validate(t *testing.T) {
+	cases := []struct {
+		Quota LeaseCountQuota
+		Valid bool
+	}{
+		{LeaseCountQuota{Name: "foo", MaxLeases: 10}, true},
+		{LeaseCountQuota{Name: "foo", Path: "secret/", MaxLeases: 10}, true},
+		{LeaseCountQuota{Name: "foo", Path: "auth/foo/", Role: "web", MaxLeases: 10}, true},
+		{LeaseCountQuota{Path: "secret/", MaxLeases: 10}, false},
+		{LeaseCountQuota{Name: "foo", Path: "secret/"}, false},
+		{LeaseCountQuota{Name: "foo", Path: "secret/", Role: "web", MaxLeases: 10}, false},
+	}
+
+	for i, tc := range cases {
+		if err := tc.Quota.validate(); (err == nil) != tc.Valid {
+			t.Fatalf("%d: expected valid %v, got %v", i, tc.Valid, err)
+		}
+	}
+}
+
+func TestLeaseCountQuota_Matches(t *testing.T) {
+	quota := &LeaseCountQuota{Path: "auth/foo/", Role: "web"}
+	if !quota.matches("auth/foo/login/abcd", "web") {
+		t.Fatal("expected match")
+	}
+	if quota.matches("auth/foo/login/abcd", "db") {
+		t.Fatal("expected no match for another role")
+	}
+	if quota.matches("auth/foobar/login/abcd", "web") {
+		t.Fatal("expected no match for another mount")
+	}
+
+	quota = &LeaseCountQuota{}
+	if !quota.matches("secret/foo/abcd", "") {
+		t.Fatal("expected match")
+	}
+}
+
+func TestCore_LeaseCountQuota(t *testing.T) {
+	c, key, root := TestCoreUnsealed(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "secret/foo")
+	req.Data["lease"] = "1h"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	readSecret := func() error {
+		req := logical.TestRequest(t, logical.ReadOperation, "secret/foo")
+		req.ClientToken = root
+		_, err := c.HandleRequest(req)
+		return err
+	}
+	if err := readSecret(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The existing lease is counted
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/quotas/lease-count/secrets")
+	req.Data["path"] = "secret"
+	req.Data["max_leases"] = 2
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := readSecret(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if count := c.LeaseCountQuotaUsage("secrets"); count != 2 {
+		t.Fatalf("bad: %d", count)
+	}
+
+	err := readSecret()
+	if errutil.CodeOf(err) != errutil.CodeLeaseQuotaExceeded {
+		t.Fatalf("expected quota error, got %v", err)
+	}
+
+	// Other mounts are not limited
+	req = logical.TestRequest(t, logical.UpdateOperation, "cubbyhole/foo")
+	req.Data["bar"] = "baz"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The quota and the count survive a restart
+	if err := c.Seal(root); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if unseal, err := TestCoreUnseal(c, key); err != nil || !unseal {
+		t.Fatalf("err: %v", err)
+	}
+	if quota := c.LeaseCountQuota("secrets"); quota == nil || quota.Path != "secret/" || quota.MaxLeases != 2 {
+		t.Fatalf("bad: %#v", quota)
+	}
+	if count := c.LeaseCountQuotaUsage("secrets"); count != 2 {
+		t.Fatalf("bad: %d", count)
+	}
+
+	// Revoking the leases makes room again
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/revoke-prefix/secret")
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if count := c.LeaseCountQuotaUsage("secrets"); count != 0 {
+		t.Fatalf("bad: %d", count)
+	}
+	if err := readSecret(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.DeleteOperation, "sys/quotas/lease-count/secrets")
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if names := c.LeaseCountQuotaNames(); len(names) != 0 {
+		t.Fatalf("bad: %v", names)
+	}
+}
+
+func TestCore_LeaseCountQuota_Role(t *testing.T) {
+	noop := &NoopBackend{
+		Login: []string{"login"},
+		Response: &logical.Response{
+			Auth: &logical.Auth{
+				Policies: []string{"default"},
+				Metadata: map[string]string{
+					"role": "web",
+				},
+			},
+		},
+	}
+	c, _, root := TestCoreUnsealed(t)
+	c.credentialBackends["noop"] = func(conf *logical.BackendConfig) (logical.Backend, error) {
+		return noop, nil
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/auth/foo")
+	req.Data["type"] = "noop"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if err := c.setLeaseCountQuota(&LeaseCountQuota{
+		Name:      "web",
+		Path:      "auth/foo/",
+		Role:      "web",
+		MaxLeases: 1,
+	}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	login := func() error {
+		_, err := c.HandleRequest(&logical.Request{
+			Path: "auth/foo/login",
+		})
+		return err
+	}
+	if err := login(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := login(); errutil.CodeOf(err) != errutil.CodeLeaseQuotaExceeded {
+		t.Fatalf("expected quota error, got %v", err)
+	}
+
+	// Logins for other roles are not limited
+	noop.Response.Auth.Metadata["role"] = "db"
+	if err := login(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if count := c.LeaseCountQuotaUsage("web"); count != 1 {
+		t.Fatalf("bad: %d", count)
+	}
+}
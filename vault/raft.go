@@ -0,0 +1,93 @@
+package vault
+
+import (
+	"errors"
+	"io"
+
+	"github.com/hashicorp/vault/physical"
+)
+
+var (
+	// errRaftNotInUse is returned by the raft operations when the storage
+	// is not the raft backend
+	errRaftNotInUse = errors.New("raft storage is not in use")
+)
+
+// raftPeers returns the nodes of the raft cluster
+func (c *Core) raftPeers() ([]physical.RaftPeer, error) {
+	if c.raft == nil {
+		return nil, errRaftNotInUse
+	}
+	return c.raft.Peers()
+}
+
+// raftJoin adds a node to the raft cluster. The node must be running
+// without any raft state, and receives the data of the cluster, so that it
+// can be unsealed with the unseal keys of the cluster.
+func (c *Core) raftJoin(nodeID, address string) error {
+	if c.raft == nil {
+		return errRaftNotInUse
+	}
+	if err := c.raft.AddPeer(nodeID, address); err != nil {
+		c.logger.Printf("[ERR] core: failed to add raft peer: %v", err)
+		return err
+	}
+	c.logger.Printf("[INFO] core: added raft peer %s at %s", nodeID, address)
+	return nil
+}
+
+// raftRemovePeer removes a node from the raft cluster, such as a node which
+// was lost
+func (c *Core) raftRemovePeer(nodeID string) error {
+	if c.raft == nil {
+		return errRaftNotInUse
+	}
+	if err := c.raft.RemovePeer(nodeID); err != nil {
+		c.logger.Printf("[ERR] core: failed to remove raft peer: %v", err)
+		return err
+	}
+	c.logger.Printf("[INFO] core: removed raft peer %s", nodeID)
+	return nil
+}
+
+// raftSnapshot returns a reader of a snapshot of the raft storage, which is
+// taken as it is read
+func (c *Core) raftSnapshot() (io.ReadCloser, error) {
+	if c.raft == nil {
+		return nil, errRaftNotInUse
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(c.raft.Snapshot(pw))
+	}()
+	return pr, nil
+}
+
+// raftRestore replaces the data of the raft cluster with a snapshot. The
+// node is then sealed, as its in-memory state no longer matches the data,
+// and is unsealed with the unseal keys of the cluster the snapshot was
+// taken of.
+func (c *Core) raftRestore(snapshot io.Reader) error {
+	if c.raft == nil {
+		return errRaftNotInUse
+	}
+	if err := c.raft.Restore(snapshot); err != nil {
+		c.logger.Printf("[ERR] core: failed to restore raft snapshot: %v", err)
+		return err
+	}
+	c.logger.Printf("[INFO] core: restored raft snapshot")
+
+	// The request restoring the snapshot holds the state lock, so the node
+	// is sealed once it completes
+	go func() {
+		c.stateLock.Lock()
+		defer c.stateLock.Unlock()
+		if !c.sealed {
+			if err := c.sealInternal(); err != nil {
+				c.logger.Printf("[ERR] core: failed to seal after the raft restore: %v", err)
+			}
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,224 @@
+package vault
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/physical"
+)
+
+func testRaftCore(t *testing.T, nodeID, redirectAddr string) (*Core, *physical.RaftBackend, func()) {
+	dir, err := ioutil.TempDir("", "vault")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	b, err := physical.NewBackend("raft", logger, map[string]string{
+		"path":    dir,
+		"node_id": nodeID,
+		"address": "127.0.0.1:0",
+	})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("err: %v", err)
+	}
+	raftBackend := b.(*physical.RaftBackend)
+
+	core, err := NewCore(&CoreConfig{
+		Physical:     raftBackend,
+		HAPhysical:   raftBackend,
+		RedirectAddr: redirectAddr,
+		DisableMlock: true,
+	})
+	if err != nil {
+		raftBackend.Close()
+		os.RemoveAll(dir)
+		t.Fatalf("err: %v", err)
+	}
+	return core, raftBackend, func() {
+		core.Shutdown()
+		raftBackend.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestCore_Raft(t *testing.T) {
+	core, _, cleanup := testRaftCore(t, "node1", "http://127.0.0.1:8200")
+	defer cleanup()
+	core2, raft2, cleanup2 := testRaftCore(t, "node2", "http://127.0.0.1:8300")
+	defer cleanup2()
+	core3, raft3, cleanup3 := testRaftCore(t, "node3", "http://127.0.0.1:8400")
+	defer cleanup3()
+
+	key, root := TestCoreInit(t, core)
+	if _, err := TestCoreUnseal(core, TestKeyCopy(key)); err != nil {
+		t.Fatalf("unseal err: %s", err)
+	}
+	TestWaitActive(t, core)
+
+	// Join the other nodes, which receive the data of the cluster and are
+	// unsealed with its keys
+	for _, node := range []struct {
+		id   string
+		core *Core
+		raft *physical.RaftBackend
+	}{
+		{"node2", core2, raft2},
+		{"node3", core3, raft3},
+	} {
+		req := logical.TestRequest(t, logical.UpdateOperation, "sys/storage/raft/join")
+		req.ClientToken = root
+		req.Data["node_id"] = node.id
+		req.Data["address"] = node.raft.Address()
+		if _, err := core.HandleRequest(req); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+
+		var init bool
+		for i := 0; i < 50 && !init; i++ {
+			time.Sleep(100 * time.Millisecond)
+			var err error
+			if init, err = node.core.Initialized(); err != nil {
+				t.Fatalf("err: %v", err)
+			}
+		}
+		if !init {
+			t.Fatalf("the joined node should be initialized")
+		}
+
+		if _, err := TestCoreUnseal(node.core, TestKeyCopy(key)); err != nil {
+			t.Fatalf("unseal err: %s", err)
+		}
+		standby, err := node.core.Standby()
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if !standby {
+			t.Fatalf("should be standby")
+		}
+	}
+
+	var advertise string
+	for i := 0; i < 50 && advertise == ""; i++ {
+		var err error
+		if _, advertise, err = core2.Leader(); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if advertise != "http://127.0.0.1:8200" {
+		t.Fatalf("bad advertise: %v", advertise)
+	}
+
+	req := logical.TestRequest(t, logical.ReadOperation, "sys/storage/raft/configuration")
+	req.ClientToken = root
+	resp, err := core.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	servers := resp.Data["servers"].([]map[string]interface{})
+	if len(servers) != 3 || servers[0]["node_id"] != "node1" || servers[0]["leader"] != true ||
+		servers[1]["node_id"] != "node2" || servers[1]["leader"] != false ||
+		servers[2]["node_id"] != "node3" || servers[2]["leader"] != false {
+		t.Fatalf("bad: %#v", servers)
+	}
+
+	// Take a snapshot, write a secret and go back to the snapshot
+	req = logical.TestRequest(t, logical.ReadOperation, "sys/storage/raft/snapshot")
+	req.ClientToken = root
+	resp, err = core.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	var snapshot bytes.Buffer
+	if _, err := io.Copy(&snapshot, resp.Stream.Body); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	resp.Stream.Body.Close()
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "secret/foo")
+	req.ClientToken = root
+	req.Data["value"] = "bar"
+	if _, err := core.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/storage/raft/snapshot")
+	req.ClientToken = root
+	req.Data[logical.HTTPRawBody] = snapshot.Bytes()
+	if _, err := core.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The node is sealed after the restore, and another node takes over
+	var active *Core
+	for i := 0; i < 100 && active == nil; i++ {
+		time.Sleep(100 * time.Millisecond)
+		for _, c := range []*Core{core2, core3} {
+			if standby, err := c.Standby(); err == nil && !standby {
+				active = c
+			}
+		}
+	}
+	if active == nil {
+		t.Fatalf("no node took over")
+	}
+	sealed, err := core.Sealed()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !sealed {
+		t.Fatalf("should be sealed")
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "secret/foo")
+	req.ClientToken = root
+	resp, err = active.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp != nil {
+		t.Fatalf("bad: %#v", resp)
+	}
+
+	// Remove the sealed node
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/storage/raft/remove-peer")
+	req.ClientToken = root
+	req.Data["node_id"] = "node1"
+	if _, err := active.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	peers, err := active.raftPeers()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(peers) != 2 {
+		t.Fatalf("bad: %#v", peers)
+	}
+	for _, peer := range peers {
+		if peer.NodeID == "node1" {
+			t.Fatalf("bad: %#v", peers)
+		}
+	}
+}
+
+func TestCore_RaftNotInUse(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	req := logical.TestRequest(t, logical.ReadOperation, "sys/storage/raft/configuration")
+	req.ClientToken = root
+	resp, err := c.HandleRequest(req)
+	if err == nil {
+		t.Fatalf("expected error")
+	}
+	if resp == nil || resp.Data["error"] != errRaftNotInUse.Error() {
+		t.Fatalf("bad: %#v", resp)
+	}
+}
@@ -402,6 +402,8 @@ func (c *Core) BarrierRekeyUpdate(key []byte, nonce string) (*RekeyResult, error
 	c.logger.Printf("[INFO] core: security barrier rekeyed (shares: %d, threshold: %d)",
 		c.barrierRekeyConfig.SecretShares, c.barrierRekeyConfig.SecretThreshold)
 
+	// The cipher chosen at initialization does not change
+	c.barrierRekeyConfig.BarrierCipher = existingConfig.BarrierCipher
 	if err := c.seal.SetBarrierConfig(c.barrierRekeyConfig); err != nil {
 		c.logger.Printf("[ERR] core: error saving rekey seal configuration: %v", err)
 		return nil, fmt.Errorf("failed to save rekey seal configuration: %v", err)
@@ -0,0 +1,1063 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/physical"
+	"github.com/hashicorp/vault/shamir"
+)
+
+const (
+	// drLocalStatePath holds the DR replication state of the cluster. It
+	// is stored in the physical backend, outside of the barrier, so that a
+	// sealed secondary can replicate, and is never replicated itself.
+	drLocalStatePath = "core/replication-local/dr"
+
+	// drLockPath is the HA lock held by the node of a secondary cluster
+	// replicating from the primary
+	drLockPath = "core/replication-local/dr-lock"
+
+	// drSecondaryPrefix is used to store the secondaries of a primary, one
+	// entry per secondary keyed by its ID
+	drSecondaryPrefix = "core/replication/dr/secondaries/"
+
+	drModePrimary   = "primary"
+	drModeSecondary = "secondary"
+
+	// drSyncInterval is how often a secondary fetches from its primary
+	drSyncInterval = time.Second
+
+	// drFetchTimeout is how long a fetch from the primary may take
+	drFetchTimeout = 60 * time.Second
+
+	// drFailoverTokenTTL is how long a failover token can be used to
+	// promote a secondary
+	drFailoverTokenTTL = 15 * time.Minute
+)
+
+var (
+	// drLocalPrefixes are the physical paths that are not replicated, as
+	// they hold the state of each cluster
+	drLocalPrefixes = []string{
+		"core/replication-local/",
+		coreLockPath,
+	}
+
+	// ErrDRSecondary is returned when unsealing a DR secondary, which
+	// replicates the primary until it is promoted
+	ErrDRSecondary = errors.New("cannot unseal a DR secondary, it must be promoted first")
+
+	errNotDRPrimary   = errors.New("cluster is not a DR primary")
+	errNotDRSecondary = errors.New("cluster is not a DR secondary")
+	errDREnabled      = errors.New("DR replication is already enabled")
+)
+
+// drReplicated returns whether the physical key is replicated
+func drReplicated(key string) bool {
+	for _, prefix := range drLocalPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// drLocalState is the DR replication state of a cluster
+type drLocalState struct {
+	Mode string `json:"mode"`
+
+	// The settings of a secondary, and the position it replicated the
+	// primary up to
+	PrimaryAPIAddr string `json:"primary_api_addr,omitempty"`
+	SecondaryID    string `json:"secondary_id,omitempty"`
+	Secret         string `json:"secret,omitempty"`
+	CACert         string `json:"ca_cert,omitempty"`
+	Epoch          string `json:"epoch,omitempty"`
+	Index          uint64 `json:"index,omitempty"`
+
+	// The last key replicated by a full sync in progress, after which the
+	// next page of the full sync starts
+	FullSyncCursor string `json:"full_sync_cursor,omitempty"`
+}
+
+// drSecondaryEntry is a secondary registered on a primary
+type drSecondaryEntry struct {
+	ID         string `json:"id"`
+	SecretHash string `json:"secret_hash"`
+
+	// PathFilter, if set, selects the mounts replicated to the secondary
+	PathFilter *PathFilter `json:"path_filter,omitempty"`
+}
+
+// drActivationToken is given to a secondary to replicate from the primary
+type drActivationToken struct {
+	PrimaryAPIAddr string `json:"primary_api_addr"`
+	ID             string `json:"id"`
+	Secret         string `json:"secret"`
+}
+
+// drFetchResponse is returned by the primary to a secondary. Entries are
+// the current values of the keys written since the position of the
+// secondary or, if Full is set, a page of the replicated entries in key
+// order. Cursor is the last key of a page that is followed by more.
+type drFetchResponse struct {
+	Epoch   string     `json:"epoch"`
+	Index   uint64     `json:"index"`
+	Full    bool       `json:"full"`
+	More    bool       `json:"more"`
+	Cursor  string     `json:"cursor,omitempty"`
+	Entries []*drEntry `json:"entries"`
+}
+
+// drEntry is a replicated physical entry. The value is base64 encoded.
+type drEntry struct {
+	Key     string `json:"key"`
+	Value   string `json:"value,omitempty"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// DRReplicationStatus is the DR replication status of the cluster
+type DRReplicationStatus struct {
+	Mode string `json:"mode"`
+
+	// Set on a primary
+	Epoch       string   `json:"epoch,omitempty"`
+	Index       uint64   `json:"index,omitempty"`
+	Secondaries []string `json:"secondaries,omitempty"`
+
+	// Set on a secondary
+	PrimaryAPIAddr string    `json:"primary_api_addr,omitempty"`
+	State          string    `json:"state,omitempty"`
+	LastRemoteIdx  uint64    `json:"last_remote_index,omitempty"`
+	LastSync       time.Time `json:"last_sync,omitempty"`
+	LastError      string    `json:"last_error,omitempty"`
+}
+
+// DRFailoverTokenResult is the result of a failover token generation
+// update
+type DRFailoverTokenResult struct {
+	Progress      int
+	Required      int
+	FailoverToken string
+}
+
+// physicalKeys returns all the keys under the prefix of the backend
+func physicalKeys(b physical.Backend, prefix string) ([]string, error) {
+	children, err := b.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, child := range children {
+		if strings.HasSuffix(child, "/") {
+			sub, err := physicalKeys(b, prefix+child)
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, sub...)
+		} else {
+			keys = append(keys, prefix+child)
+		}
+	}
+	return keys, nil
+}
+
+// drReplicatedKeys returns, in order, up to limit replicated keys of the
+// backend that sort after the given key and, if until is set, not after
+// until. A limit of zero returns all of them. The returned boolean is
+// whether keys were left out because of the limit. If filter is set, only
+// the keys and directories it returns true for are walked.
+func drReplicatedKeys(b physical.Backend, after, until string, limit int, filter func(string) bool) ([]string, bool, error) {
+	var keys []string
+	var more, done bool
+	var walk func(prefix string) error
+	walk = func(prefix string) error {
+		children, err := b.List(prefix)
+		if err != nil {
+			return err
+		}
+		sort.Strings(children)
+
+		for _, child := range children {
+			if more || done {
+				return nil
+			}
+			key := prefix + child
+
+			// Keys are walked in order, so the walk stops at the first
+			// one past until
+			if until != "" && key > until {
+				done = true
+				return nil
+			}
+
+			if filter != nil && !filter(key) {
+				continue
+			}
+
+			if strings.HasSuffix(child, "/") {
+				// Skip the directories holding only keys before after
+				if key < after && !strings.HasPrefix(after, key) {
+					continue
+				}
+				if err := walk(key); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if key <= after || !drReplicated(key) {
+				continue
+			}
+			if limit > 0 && len(keys) == limit {
+				more = true
+				return nil
+			}
+			keys = append(keys, key)
+		}
+		return nil
+	}
+
+	if err := walk(""); err != nil {
+		return nil, false, err
+	}
+	return keys, more, nil
+}
+
+// drPathFilter returns the filter of the keys replicated to a secondary
+// given the storage prefixes of the mounts left out, nil if none are
+func drPathFilter(prefixes []string) func(string) bool {
+	if len(prefixes) == 0 {
+		return nil
+	}
+	return func(key string) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(key, prefix) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// drHashSecret returns the hash stored for the secret of a secondary
+func drHashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadDRState reads the DR replication state of the cluster unless already
+// loaded, and starts replicating if it is a secondary
+func (c *Core) loadDRState() error {
+	c.drLock.Lock()
+	if c.drLoaded {
+		c.drLock.Unlock()
+		return nil
+	}
+
+	raw, err := c.physical.Get(drLocalStatePath)
+	if err != nil {
+		c.drLock.Unlock()
+		return fmt.Errorf("failed to read DR replication state: %v", err)
+	}
+	var state *drLocalState
+	if raw != nil {
+		state = &drLocalState{}
+		if err := jsonutil.DecodeJSON(raw.Value, state); err != nil {
+			c.drLock.Unlock()
+			return fmt.Errorf("failed to decode DR replication state: %v", err)
+		}
+	}
+	c.drState = state
+	c.drLoaded = true
+	c.drLock.Unlock()
+
+	if state != nil && state.Mode == drModeSecondary {
+		c.startDRSecondary()
+	}
+	return nil
+}
+
+// persistDRState stores the DR replication state of the cluster, removing
+// it if nil. The drLock must be held.
+func (c *Core) persistDRState(state *drLocalState) error {
+	if state == nil {
+		if err := c.physical.Delete(drLocalStatePath); err != nil {
+			c.logger.Printf("[ERR] core: failed to delete DR replication state: %v", err)
+			return err
+		}
+		c.drState = nil
+		return nil
+	}
+
+	buf, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode DR replication state: %v", err)
+	}
+	if err := c.physical.Put(&physical.Entry{
+		Key:   drLocalStatePath,
+		Value: buf,
+	}); err != nil {
+		c.logger.Printf("[ERR] core: failed to persist DR replication state: %v", err)
+		return err
+	}
+	c.drState = state
+	return nil
+}
+
+// drMode returns the DR replication mode of the cluster, the empty string
+// if it is not replicated
+func (c *Core) drMode() string {
+	c.drLock.RLock()
+	defer c.drLock.RUnlock()
+	if c.drState == nil {
+		return ""
+	}
+	return c.drState.Mode
+}
+
+// setupDRReplication loads the secondaries of a primary and starts
+// recording the writes for them
+func (c *Core) setupDRReplication() error {
+	if c.drMode() != drModePrimary {
+		return nil
+	}
+
+	ids, err := c.barrier.List(drSecondaryPrefix)
+	if err != nil {
+		c.logger.Printf("[ERR] core: failed to list DR secondaries: %v", err)
+		return err
+	}
+	secondaries := make(map[string]*drSecondaryEntry, len(ids))
+	for _, id := range ids {
+		raw, err := c.barrier.Get(drSecondaryPrefix + id)
+		if err != nil {
+			c.logger.Printf("[ERR] core: failed to read DR secondary %s: %v", id, err)
+			return err
+		}
+		if raw == nil {
+			continue
+		}
+		entry := &drSecondaryEntry{}
+		if err := jsonutil.DecodeJSON(raw.Value, entry); err != nil {
+			c.logger.Printf("[ERR] core: failed to decode DR secondary %s: %v", id, err)
+			return err
+		}
+		secondaries[entry.ID] = entry
+	}
+
+	c.drLock.Lock()
+	c.drSecondaries = secondaries
+	c.drLock.Unlock()
+	return c.writeLog.start()
+}
+
+// teardownDRReplication stops recording the writes for the secondaries
+func (c *Core) teardownDRReplication() {
+	c.writeLog.stop()
+	c.drLock.Lock()
+	c.drSecondaries = nil
+	c.drLock.Unlock()
+}
+
+// enableDRPrimary makes the cluster a DR primary
+func (c *Core) enableDRPrimary() error {
+	c.drLock.Lock()
+	defer c.drLock.Unlock()
+
+	if c.drState != nil {
+		return errDREnabled
+	}
+	if err := c.persistDRState(&drLocalState{Mode: drModePrimary}); err != nil {
+		return err
+	}
+	c.drSecondaries = make(map[string]*drSecondaryEntry)
+	c.logger.Printf("[INFO] core: enabled DR primary")
+	return c.writeLog.start()
+}
+
+// disableDRPrimary stops replicating to the secondaries, removing them
+func (c *Core) disableDRPrimary() error {
+	c.drLock.Lock()
+	defer c.drLock.Unlock()
+
+	if c.drState == nil || c.drState.Mode != drModePrimary {
+		return errNotDRPrimary
+	}
+	for id := range c.drSecondaries {
+		if err := c.barrier.Delete(drSecondaryPrefix + id); err != nil {
+			c.logger.Printf("[ERR] core: failed to delete DR secondary: %v", err)
+			return err
+		}
+	}
+	if err := c.persistDRState(nil); err != nil {
+		return err
+	}
+	c.drSecondaries = nil
+
+	// The performance standbys still follow the log
+	if !c.perfStandbyEnabled || c.ha == nil {
+		c.writeLog.stop()
+	}
+	c.logger.Printf("[INFO] core: disabled DR primary")
+	return nil
+}
+
+// drSecondaryToken registers a secondary on the primary and returns its
+// activation token. The primary is reached at the given API address, by
+// default the redirect address of the node. If the path filter is set,
+// only the mounts it selects are replicated to the secondary.
+func (c *Core) drSecondaryToken(id, apiAddr string, filter *PathFilter) (string, error) {
+	if apiAddr == "" {
+		apiAddr = c.redirectAddr
+	}
+	if apiAddr == "" {
+		return "", fmt.Errorf("primary_api_addr is required when the node has no redirect address")
+	}
+
+	secret, err := uuid.GenerateUUID()
+	if err != nil {
+		return "", err
+	}
+	entry := &drSecondaryEntry{
+		ID:         id,
+		SecretHash: drHashSecret(secret),
+		PathFilter: filter,
+	}
+	buf, err := json.Marshal(entry)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode DR secondary: %v", err)
+	}
+
+	c.drLock.Lock()
+	defer c.drLock.Unlock()
+
+	if c.drState == nil || c.drState.Mode != drModePrimary {
+		return "", errNotDRPrimary
+	}
+	if _, ok := c.drSecondaries[id]; ok {
+		return "", fmt.Errorf("secondary %q already exists", id)
+	}
+	if err := c.barrier.Put(&Entry{
+		Key:   drSecondaryPrefix + id,
+		Value: buf,
+	}); err != nil {
+		c.logger.Printf("[ERR] core: failed to persist DR secondary: %v", err)
+		return "", err
+	}
+	c.drSecondaries[id] = entry
+
+	token, err := json.Marshal(&drActivationToken{
+		PrimaryAPIAddr: apiAddr,
+		ID:             id,
+		Secret:         secret,
+	})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// revokeDRSecondary removes a secondary, which can no longer replicate
+func (c *Core) revokeDRSecondary(id string) error {
+	c.drLock.Lock()
+	defer c.drLock.Unlock()
+
+	if c.drState == nil || c.drState.Mode != drModePrimary {
+		return errNotDRPrimary
+	}
+	if err := c.barrier.Delete(drSecondaryPrefix + id); err != nil {
+		c.logger.Printf("[ERR] core: failed to delete DR secondary: %v", err)
+		return err
+	}
+	delete(c.drSecondaries, id)
+	return nil
+}
+
+// drFetch returns the changes since the position of a secondary: the
+// current values of the keys written since, or all the replicated entries
+// if the log of the primary does not go back to that position. A full sync
+// is returned in pages of at most writeLogBatchSize entries, the secondary
+// fetching the next page with the cursor of the previous one. The data of
+// the mounts left out by the path filter of the secondary is not returned.
+func (c *Core) drFetch(id, secret, epoch string, index uint64, cursor string) (*drFetchResponse, error) {
+	c.drLock.RLock()
+	entry, ok := c.drSecondaries[id]
+	c.drLock.RUnlock()
+	if !ok || subtle.ConstantTimeCompare([]byte(entry.SecretHash), []byte(drHashSecret(secret))) != 1 {
+		return nil, fmt.Errorf("unknown secondary or invalid secret")
+	}
+
+	// The filtered mounts are looked up on each fetch, so that the mounts
+	// created since are filtered too
+	filter := drPathFilter(c.pathFilterPrefixes(entry.PathFilter))
+
+	resp := &drFetchResponse{}
+	var keys []string
+	var incremental bool
+	if cursor == "" {
+		var last uint64
+		keys, last, incremental = c.writeLog.since(epoch, index)
+		if incremental {
+			resp.Epoch = epoch
+			resp.Index = last
+			_, current := c.writeLog.position()
+			resp.More = last < current
+		}
+	}
+	if !incremental {
+		// The position is taken before listing the first page and kept for
+		// the following ones, so that the writes made during the full sync
+		// are fetched again once it completes
+		resp.Full = true
+		if cursor == "" {
+			resp.Epoch, resp.Index = c.writeLog.position()
+		} else {
+			resp.Epoch, resp.Index = epoch, index
+		}
+
+		var err error
+		keys, resp.More, err = drReplicatedKeys(c.physical, cursor, "", writeLogBatchSize, filter)
+		if err != nil {
+			return nil, err
+		}
+		if resp.More {
+			resp.Cursor = keys[len(keys)-1]
+		}
+	}
+
+	resp.Entries = make([]*drEntry, 0, len(keys))
+	for _, key := range keys {
+		if filter != nil && !filter(key) {
+			continue
+		}
+		pe, err := c.physical.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		if pe == nil {
+			if !resp.Full {
+				resp.Entries = append(resp.Entries, &drEntry{Key: key, Deleted: true})
+			}
+			continue
+		}
+		resp.Entries = append(resp.Entries, &drEntry{
+			Key:   key,
+			Value: base64.StdEncoding.EncodeToString(pe.Value),
+		})
+	}
+	return resp, nil
+}
+
+// enableDRSecondary makes the cluster a DR secondary of the primary of the
+// activation token. The cluster is sealed, and its data is replaced with
+// the data of the primary.
+func (c *Core) enableDRSecondary(token, apiAddr, caCert string) error {
+	if c.seal.StoredKeysSupported() || c.seal.RecoveryKeySupported() {
+		return fmt.Errorf("DR secondaries must use the shamir seal")
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return fmt.Errorf("invalid activation token: %v", err)
+	}
+	activation := &drActivationToken{}
+	if err := jsonutil.DecodeJSON(raw, activation); err != nil {
+		return fmt.Errorf("invalid activation token: %v", err)
+	}
+	if apiAddr == "" {
+		apiAddr = activation.PrimaryAPIAddr
+	}
+	if caCert != "" && !x509.NewCertPool().AppendCertsFromPEM([]byte(caCert)) {
+		return fmt.Errorf("invalid ca_cert")
+	}
+
+	c.drLock.Lock()
+	defer c.drLock.Unlock()
+
+	if c.drState != nil {
+		return errDREnabled
+	}
+	if err := c.persistDRState(&drLocalState{
+		Mode:           drModeSecondary,
+		PrimaryAPIAddr: apiAddr,
+		SecondaryID:    activation.ID,
+		Secret:         activation.Secret,
+		CACert:         caCert,
+	}); err != nil {
+		return err
+	}
+	c.logger.Printf("[INFO] core: enabled DR secondary of %s", apiAddr)
+
+	// The request enabling the secondary holds the state lock, so the
+	// cluster is sealed once it completes
+	go func() {
+		c.stateLock.Lock()
+		if !c.sealed {
+			if err := c.sealInternal(); err != nil {
+				c.logger.Printf("[ERR] core: failed to seal DR secondary: %v", err)
+			}
+		}
+		c.stateLock.Unlock()
+		c.startDRSecondary()
+	}()
+	return nil
+}
+
+// startDRSecondary starts replicating from the primary
+func (c *Core) startDRSecondary() {
+	c.drRunLock.Lock()
+	defer c.drRunLock.Unlock()
+	if c.drStopCh != nil {
+		return
+	}
+
+	// The secondary writes what it replicates while sealed, which raft only
+	// accepts while it runs
+	if c.raft != nil {
+		if err := c.raft.SetupCluster(); err != nil {
+			c.logger.Printf("[ERR] core: failed to start raft: %v", err)
+		}
+	}
+
+	c.drStopCh = make(chan struct{})
+	c.drDoneCh = make(chan struct{})
+	go c.runDRSecondary(c.drStopCh, c.drDoneCh)
+}
+
+// stopDRSecondary stops replicating from the primary
+func (c *Core) stopDRSecondary() {
+	c.drRunLock.Lock()
+	defer c.drRunLock.Unlock()
+	if c.drStopCh == nil {
+		return
+	}
+	close(c.drStopCh)
+	<-c.drDoneCh
+	c.drStopCh = nil
+	c.drDoneCh = nil
+}
+
+// runDRSecondary replicates from the primary until stopCh is closed. In HA
+// mode, only the node holding the DR lock replicates.
+func (c *Core) runDRSecondary(stopCh, doneCh chan struct{}) {
+	defer close(doneCh)
+	c.logger.Printf("[INFO] core: starting DR replication")
+
+	for {
+		var lock physical.Lock
+		var lostCh <-chan struct{}
+		if c.ha != nil {
+			var err error
+			lock, err = c.ha.LockWith(drLockPath, "replicating")
+			if err == nil {
+				lostCh, err = lock.Lock(stopCh)
+			}
+			if err != nil {
+				c.logger.Printf("[ERR] core: failed to acquire DR lock: %v", err)
+				select {
+				case <-stopCh:
+					return
+				case <-time.After(drSyncInterval):
+					continue
+				}
+			}
+			if lostCh == nil {
+				return
+			}
+		}
+
+		lost := c.replicateDR(stopCh, lostCh)
+		if lock != nil {
+			lock.Unlock()
+		}
+		if !lost {
+			c.logger.Printf("[INFO] core: stopped DR replication")
+			return
+		}
+	}
+}
+
+// replicateDR syncs with the primary until stopCh or lostCh is closed,
+// returning whether lostCh was
+func (c *Core) replicateDR(stopCh <-chan struct{}, lostCh <-chan struct{}) bool {
+	for {
+		wait := drSyncInterval
+		more, err := c.drSync()
+		if err != nil {
+			c.logger.Printf("[ERR] core: DR replication failed: %v", err)
+		} else if more {
+			wait = 0
+		}
+
+		select {
+		case <-stopCh:
+			return false
+		case <-lostCh:
+			return true
+		case <-time.After(wait):
+		}
+	}
+}
+
+// drSync applies the changes fetched from the primary, returning whether
+// there are more to fetch
+func (c *Core) drSync() (bool, error) {
+	c.drSyncLock.Lock()
+	defer c.drSyncLock.Unlock()
+
+	c.drLock.RLock()
+	var state drLocalState
+	if c.drState != nil {
+		state = *c.drState
+	}
+	c.drLock.RUnlock()
+	if state.Mode != drModeSecondary {
+		return false, errNotDRSecondary
+	}
+
+	resp, err := c.drFetchPrimary(&state)
+	if err == nil {
+		err = c.drApply(resp, state.FullSyncCursor)
+	}
+
+	c.drLock.Lock()
+	defer c.drLock.Unlock()
+	if err != nil {
+		c.drStatus.State = "error"
+		c.drStatus.LastError = err.Error()
+		return false, err
+	}
+	if c.drState == nil || c.drState.SecondaryID != state.SecondaryID {
+		return false, errNotDRSecondary
+	}
+	if resp.Full && !resp.More {
+		c.logger.Printf("[INFO] core: DR replication completed a full sync")
+	}
+	if resp.Epoch != state.Epoch || resp.Index != state.Index || resp.Cursor != state.FullSyncCursor {
+		state.Epoch = resp.Epoch
+		state.Index = resp.Index
+		state.FullSyncCursor = resp.Cursor
+		if err := c.persistDRState(&state); err != nil {
+			return false, err
+		}
+	}
+	c.drStatus.State = "stream"
+	if resp.Full && resp.More {
+		c.drStatus.State = "full-sync"
+	}
+	c.drStatus.LastError = ""
+	c.drStatus.LastSync = time.Now()
+	return resp.More, nil
+}
+
+// drFetchPrimary fetches the changes since the position of the secondary
+// from the primary
+func (c *Core) drFetchPrimary(state *drLocalState) (*drFetchResponse, error) {
+	client := cleanhttp.DefaultClient()
+	client.Timeout = drFetchTimeout
+	if state.CACert != "" {
+		pool := x509.NewCertPool()
+		pool.AppendCertsFromPEM([]byte(state.CACert))
+		client.Transport.(*http.Transport).TLSClientConfig = &tls.Config{
+			RootCAs: pool,
+		}
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"id":     state.SecondaryID,
+		"secret": state.Secret,
+		"epoch":  state.Epoch,
+		"index":  state.Index,
+		"cursor": state.FullSyncCursor,
+	})
+	if err != nil {
+		return nil, err
+	}
+	url := strings.TrimSuffix(state.PrimaryAPIAddr, "/") + "/v1/sys/replication/dr/primary/fetch"
+	httpResp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	raw, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Data   *drFetchResponse `json:"data"`
+		Errors []string         `json:"errors"`
+	}
+	if err := jsonutil.DecodeJSON(raw, &result); err != nil {
+		return nil, fmt.Errorf("invalid response from primary (status %d): %v", httpResp.StatusCode, err)
+	}
+	if httpResp.StatusCode != http.StatusOK || result.Data == nil {
+		return nil, fmt.Errorf("primary returned status %d: %s", httpResp.StatusCode, strings.Join(result.Errors, ", "))
+	}
+	return result.Data, nil
+}
+
+// drApply writes the entries fetched from the primary. A page of a full
+// sync also deletes the replicated entries the primary does not have among
+// the keys it covers, from after the given cursor to the cursor of the
+// page, or to the last key if it is the last page.
+func (c *Core) drApply(resp *drFetchResponse, cursor string) error {
+	if resp.Full {
+		c.drLock.Lock()
+		c.drStatus.State = "full-sync"
+		c.drLock.Unlock()
+
+		existing, _, err := drReplicatedKeys(c.physical, cursor, resp.Cursor, 0, nil)
+		if err != nil {
+			return err
+		}
+		keep := make(map[string]struct{}, len(resp.Entries))
+		for _, entry := range resp.Entries {
+			keep[entry.Key] = struct{}{}
+		}
+		for _, key := range existing {
+			if _, ok := keep[key]; ok {
+				continue
+			}
+			if err := c.physical.Delete(key); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, entry := range resp.Entries {
+		if !drReplicated(entry.Key) {
+			continue
+		}
+		if entry.Deleted {
+			if err := c.physical.Delete(entry.Key); err != nil {
+				return err
+			}
+		} else {
+			value, err := base64.StdEncoding.DecodeString(entry.Value)
+			if err != nil {
+				return fmt.Errorf("invalid value of %s: %v", entry.Key, err)
+			}
+			if err := c.physical.Put(&physical.Entry{
+				Key:   entry.Key,
+				Value: value,
+			}); err != nil {
+				return err
+			}
+		}
+
+		// The seal configuration of the primary replaces the one cached
+		if entry.Key == barrierSealConfigPath {
+			if seal, ok := c.seal.(*DefaultSeal); ok {
+				seal.clearConfig()
+			}
+		}
+	}
+	return nil
+}
+
+// DRReplicationStatus returns the DR replication status of the cluster
+func (c *Core) DRReplicationStatus() *DRReplicationStatus {
+	c.drLock.RLock()
+	defer c.drLock.RUnlock()
+
+	status := &DRReplicationStatus{
+		Mode: "disabled",
+	}
+	if c.drState == nil {
+		return status
+	}
+	status.Mode = c.drState.Mode
+
+	switch c.drState.Mode {
+	case drModePrimary:
+		status.Epoch, status.Index = c.writeLog.position()
+		status.Secondaries = []string{}
+		for id := range c.drSecondaries {
+			status.Secondaries = append(status.Secondaries, id)
+		}
+		sort.Strings(status.Secondaries)
+	case drModeSecondary:
+		status.PrimaryAPIAddr = c.drState.PrimaryAPIAddr
+		status.LastRemoteIdx = c.drState.Index
+		status.State = c.drStatus.State
+		if status.State == "" {
+			status.State = "connecting"
+		}
+		status.LastSync = c.drStatus.LastSync
+		status.LastError = c.drStatus.LastError
+	}
+	return status
+}
+
+// DRFailoverTokenProgress returns the number of key shares given to
+// generate a failover token, and the number required
+func (c *Core) DRFailoverTokenProgress() (int, int, error) {
+	if c.drMode() != drModeSecondary {
+		return 0, 0, errNotDRSecondary
+	}
+	config, err := c.seal.BarrierConfig()
+	if err != nil {
+		return 0, 0, err
+	}
+	if config == nil {
+		return 0, 0, ErrNotInit
+	}
+
+	c.drLock.RLock()
+	defer c.drLock.RUnlock()
+	return len(c.drFailoverProgress), config.SecretThreshold, nil
+}
+
+// DRFailoverTokenUpdate adds a share of the unseal key of the primary to
+// generate a failover token. Once there are enough shares, the key is
+// checked against the replicated data and a failover token is returned.
+func (c *Core) DRFailoverTokenUpdate(key []byte) (*DRFailoverTokenResult, error) {
+	min, max := c.barrier.KeyLength()
+	max += shamir.ShareOverhead
+	if len(key) < min {
+		return nil, &ErrInvalidKey{fmt.Sprintf("key is shorter than minimum %d bytes", min)}
+	}
+	if len(key) > max {
+		return nil, &ErrInvalidKey{fmt.Sprintf("key is longer than maximum %d bytes", max)}
+	}
+
+	if c.drMode() != drModeSecondary {
+		return nil, errNotDRSecondary
+	}
+	config, err := c.seal.BarrierConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, ErrNotInit
+	}
+
+	// The state lock keeps the cluster sealed while the key is checked
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	c.drLock.Lock()
+	defer c.drLock.Unlock()
+
+	for _, existing := range c.drFailoverProgress {
+		if bytes.Equal(existing, key) {
+			return &DRFailoverTokenResult{
+				Progress: len(c.drFailoverProgress),
+				Required: config.SecretThreshold,
+			}, nil
+		}
+	}
+	c.drFailoverProgress = append(c.drFailoverProgress, key)
+	result := &DRFailoverTokenResult{
+		Progress: len(c.drFailoverProgress),
+		Required: config.SecretThreshold,
+	}
+	if len(c.drFailoverProgress) < config.SecretThreshold {
+		return result, nil
+	}
+
+	var masterKey []byte
+	if config.SecretThreshold == 1 {
+		masterKey = c.drFailoverProgress[0]
+	} else {
+		masterKey, err = shamir.Combine(c.drFailoverProgress)
+	}
+	c.drFailoverProgress = nil
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute master key: %v", err)
+	}
+	defer memzero(masterKey)
+
+	// Check the key against the replicated keyring
+	if err := c.barrier.Unseal(masterKey); err != nil {
+		c.logger.Printf("[ERR] core: failover token generation aborted, master key verification failed: %v", err)
+		return nil, err
+	}
+	if err := c.barrier.Seal(); err != nil {
+		return nil, err
+	}
+
+	token, err := uuid.GenerateUUID()
+	if err != nil {
+		return nil, err
+	}
+	if c.drFailoverTokens == nil {
+		c.drFailoverTokens = make(map[string]time.Time)
+	}
+	c.drFailoverTokens[drHashSecret(token)] = time.Now().Add(drFailoverTokenTTL)
+	c.logger.Printf("[INFO] core: generated DR failover token")
+
+	result.FailoverToken = token
+	return result, nil
+}
+
+// DRFailoverTokenCancel clears the key shares given to generate a failover
+// token
+func (c *Core) DRFailoverTokenCancel() error {
+	c.drLock.Lock()
+	defer c.drLock.Unlock()
+	c.drFailoverProgress = nil
+	return nil
+}
+
+// PromoteDRSecondary stops replicating and makes the secondary the primary,
+// given a failover token. The cluster is then unsealed with the keys of
+// the former primary.
+func (c *Core) PromoteDRSecondary(token string) error {
+	c.drLock.Lock()
+	if c.drState == nil || c.drState.Mode != drModeSecondary {
+		c.drLock.Unlock()
+		return errNotDRSecondary
+	}
+	expiry, ok := c.drFailoverTokens[drHashSecret(token)]
+	if !ok || time.Now().After(expiry) {
+		c.drLock.Unlock()
+		return fmt.Errorf("invalid or expired failover token")
+	}
+	c.drLock.Unlock()
+
+	// Replication is stopped before the state changes, so that nothing is
+	// written afterwards
+	c.stopDRSecondary()
+
+	c.drLock.Lock()
+	defer c.drLock.Unlock()
+	if err := c.persistDRState(&drLocalState{Mode: drModePrimary}); err != nil {
+		c.startDRSecondary()
+		return err
+	}
+	c.drFailoverTokens = nil
+	c.drFailoverProgress = nil
+	c.drStatus = drSecondaryStatus{}
+	if seal, ok := c.seal.(*DefaultSeal); ok {
+		seal.clearConfig()
+	}
+	c.logger.Printf("[INFO] core: promoted DR secondary to primary")
+	return nil
+}
+
+// drSecondaryStatus is the replication status of a secondary
+type drSecondaryStatus struct {
+	State     string
+	LastSync  time.Time
+	LastError string
+}
@@ -0,0 +1,378 @@
+package vault
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/logical"
+	"github.com/hashicorp/vault/physical"
+)
+
+// testDRPrimaryServer serves the fetch endpoint of a DR primary
+func testDRPrimaryServer(t *testing.T, c *Core) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var data map[string]interface{}
+		if err := jsonutil.DecodeJSONFromReader(r.Body, &data); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		req := logical.TestRequest(t, logical.UpdateOperation, "sys/replication/dr/primary/fetch")
+		req.Data = data
+		resp, err := c.HandleRequest(req)
+		if err != nil {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"errors": []string{err.Error()},
+			})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": resp.Data,
+		})
+	}))
+}
+
+func TestDRReplication(t *testing.T) {
+	primary, key, root := TestCoreUnsealed(t)
+	server := testDRPrimaryServer(t, primary)
+	defer server.Close()
+
+	testNamespaceRequest(t, primary, root, logical.UpdateOperation, "secret/foo", map[string]interface{}{
+		"value": "bar",
+	})
+	testNamespaceRequest(t, primary, root, logical.UpdateOperation, "sys/replication/dr/primary/enable", nil)
+	resp := testNamespaceRequest(t, primary, root, logical.UpdateOperation, "sys/replication/dr/primary/secondary-token", map[string]interface{}{
+		"id":               "dr1",
+		"primary_api_addr": server.URL,
+	})
+	token := resp.Data["token"].(string)
+
+	// Enabling the secondary seals it
+	secondary, _, secondaryRoot := TestCoreUnsealed(t)
+	defer secondary.Shutdown()
+	testNamespaceRequest(t, secondary, secondaryRoot, logical.UpdateOperation, "sys/replication/dr/secondary/enable", map[string]interface{}{
+		"token": token,
+	})
+	testDRWait(t, func() bool {
+		status := secondary.DRReplicationStatus()
+		return status.State == "stream" && status.LastRemoteIdx > 0
+	})
+	if sealed, _ := secondary.Sealed(); !sealed {
+		t.Fatalf("secondary is not sealed")
+	}
+	if status := secondary.DRReplicationStatus(); status.Mode != drModeSecondary || status.PrimaryAPIAddr != server.URL {
+		t.Fatalf("bad: %#v", status)
+	}
+	if status := primary.DRReplicationStatus(); !reflect.DeepEqual(status.Secondaries, []string{"dr1"}) {
+		t.Fatalf("bad: %#v", status)
+	}
+
+	// Writes made after the full sync are streamed, tokens included
+	testNamespaceRequest(t, primary, root, logical.UpdateOperation, "secret/baz", map[string]interface{}{
+		"value": "qux",
+	})
+	resp = testNamespaceRequest(t, primary, root, logical.UpdateOperation, "auth/token/create", nil)
+	child := resp.Auth.ClientToken
+	if _, err := secondary.drSync(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The secondary cannot be unsealed until it is promoted
+	if _, err := secondary.Unseal(TestKeyCopy(key)); err != ErrDRSecondary {
+		t.Fatalf("expected ErrDRSecondary, got %v", err)
+	}
+	if err := secondary.PromoteDRSecondary("invalid"); err == nil {
+		t.Fatalf("expected error promoting with an invalid token")
+	}
+
+	// The failover token is generated with the keys of the primary
+	result, err := secondary.DRFailoverTokenUpdate(TestKeyCopy(key))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if result.FailoverToken == "" || result.Progress != 1 || result.Required != 1 {
+		t.Fatalf("bad: %#v", result)
+	}
+	if err := secondary.PromoteDRSecondary(result.FailoverToken); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if unseal, err := TestCoreUnseal(secondary, TestKeyCopy(key)); err != nil || !unseal {
+		t.Fatalf("err: %v", err)
+	}
+
+	resp = testNamespaceRequest(t, secondary, root, logical.ReadOperation, "secret/foo", nil)
+	if resp.Data["value"] != "bar" {
+		t.Fatalf("bad: %#v", resp)
+	}
+	resp = testNamespaceRequest(t, secondary, child, logical.ReadOperation, "secret/baz", nil)
+	if resp.Data["value"] != "qux" {
+		t.Fatalf("bad: %#v", resp)
+	}
+	if status := secondary.DRReplicationStatus(); status.Mode != drModePrimary {
+		t.Fatalf("bad: %#v", status)
+	}
+}
+
+func TestDRReplication_RevokeSecondary(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "sys/replication/dr/primary/enable", nil)
+	resp := testNamespaceRequest(t, c, root, logical.UpdateOperation, "sys/replication/dr/primary/secondary-token", map[string]interface{}{
+		"id":               "dr1",
+		"primary_api_addr": "https://127.0.0.1:8200",
+	})
+
+	activation := &drActivationToken{}
+	raw, err := base64.RawURLEncoding.DecodeString(resp.Data["token"].(string))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := jsonutil.DecodeJSON(raw, activation); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/replication/dr/primary/fetch")
+	req.Data = map[string]interface{}{
+		"id":     "dr1",
+		"secret": activation.Secret,
+	}
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["full"] != true {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "sys/replication/dr/primary/revoke-secondary", map[string]interface{}{
+		"id": "dr1",
+	})
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatalf("expected error fetching as a revoked secondary")
+	}
+}
+
+func TestDRReplication_PathFilter(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "sys/mounts/other", map[string]interface{}{
+		"type": "generic",
+	})
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "secret/foo", map[string]interface{}{
+		"value": "bar",
+	})
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "other/foo", map[string]interface{}{
+		"value": "bar",
+	})
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "sys/replication/dr/primary/enable", nil)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/replication/dr/primary/secondary-token")
+	req.ClientToken = root
+	req.Data = map[string]interface{}{
+		"id":    "dr1",
+		"mode":  "foo",
+		"paths": "other/",
+	}
+	if resp, err := c.HandleRequest(req); err == nil || !resp.IsError() {
+		t.Fatalf("expected error with an invalid mode: %#v", resp)
+	}
+
+	resp := testNamespaceRequest(t, c, root, logical.UpdateOperation, "sys/replication/dr/primary/secondary-token", map[string]interface{}{
+		"id":               "dr1",
+		"primary_api_addr": "https://127.0.0.1:8200",
+		"mode":             "deny",
+		"paths":            "other",
+	})
+	activation := &drActivationToken{}
+	raw, err := base64.RawURLEncoding.DecodeString(resp.Data["token"].(string))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := jsonutil.DecodeJSON(raw, activation); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	var secretPrefix, otherPrefix string
+	for _, entry := range c.mounts.Entries {
+		switch entry.Path {
+		case "secret/":
+			secretPrefix = backendBarrierPrefix + entry.UUID + "/"
+		case "other/":
+			otherPrefix = backendBarrierPrefix + entry.UUID + "/"
+		}
+	}
+	fetched := func(fetch *drFetchResponse) (secret, other bool) {
+		for _, entry := range fetch.Entries {
+			secret = secret || strings.HasPrefix(entry.Key, secretPrefix)
+			other = other || strings.HasPrefix(entry.Key, otherPrefix)
+		}
+		return secret, other
+	}
+
+	// The full sync leaves out the data of the filtered mount, but not the
+	// mount table
+	var epoch, cursor string
+	var index uint64
+	var secret, other, mounts bool
+	for {
+		fetch, err := c.drFetch("dr1", activation.Secret, epoch, index, cursor)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		s, o := fetched(fetch)
+		secret, other = secret || s, other || o
+		for _, entry := range fetch.Entries {
+			mounts = mounts || entry.Key == coreMountConfigPath
+		}
+		epoch, index, cursor = fetch.Epoch, fetch.Index, fetch.Cursor
+		if !fetch.More {
+			break
+		}
+	}
+	if !secret || other || !mounts {
+		t.Fatalf("bad: secret %v, other %v, mounts %v", secret, other, mounts)
+	}
+
+	// So do the writes streamed since
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "secret/baz", map[string]interface{}{
+		"value": "qux",
+	})
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "other/baz", map[string]interface{}{
+		"value": "qux",
+	})
+	fetch, err := c.drFetch("dr1", activation.Secret, epoch, index, "")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if fetch.Full {
+		t.Fatalf("bad: %#v", fetch)
+	}
+	if secret, other := fetched(fetch); !secret || other {
+		t.Fatalf("bad: secret %v, other %v", secret, other)
+	}
+}
+
+func TestDRReplication_FullSyncPages(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "sys/replication/dr/primary/enable", nil)
+	resp := testNamespaceRequest(t, c, root, logical.UpdateOperation, "sys/replication/dr/primary/secondary-token", map[string]interface{}{
+		"id":               "dr1",
+		"primary_api_addr": "https://127.0.0.1:8200",
+	})
+	activation := &drActivationToken{}
+	raw, err := base64.RawURLEncoding.DecodeString(resp.Data["token"].(string))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := jsonutil.DecodeJSON(raw, activation); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	for i := 0; i < 2*writeLogBatchSize; i++ {
+		if err := c.physical.Put(&physical.Entry{
+			Key:   fmt.Sprintf("test/%d/%04d", i%3, i),
+			Value: []byte("value"),
+		}); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	expected, _, err := drReplicatedKeys(c.physical, "", "", 0, nil)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The full sync is fetched in pages of keys in order, all at the
+	// position the full sync started from
+	var keys []string
+	var epoch, cursor string
+	var index uint64
+	for pages := 1; ; pages++ {
+		fetch, err := c.drFetch("dr1", activation.Secret, epoch, index, cursor)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if !fetch.Full || len(fetch.Entries) > writeLogBatchSize || (pages > 1 && (fetch.Epoch != epoch || fetch.Index != index)) {
+			t.Fatalf("bad: page %d: %#v", pages, fetch)
+		}
+		for _, entry := range fetch.Entries {
+			keys = append(keys, entry.Key)
+		}
+		if !fetch.More {
+			if fetch.Cursor != "" || pages != 3 {
+				t.Fatalf("bad: page %d: %#v", pages, fetch)
+			}
+			break
+		}
+		if fetch.Cursor != keys[len(keys)-1] {
+			t.Fatalf("bad: page %d: cursor %q", pages, fetch.Cursor)
+		}
+		epoch, index, cursor = fetch.Epoch, fetch.Index, fetch.Cursor
+	}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Fatalf("bad: fetched %d keys, expected %d", len(keys), len(expected))
+	}
+
+	// Once the full sync completes, the writes made since it started are
+	// fetched from the log
+	fetch, err := c.drFetch("dr1", activation.Secret, epoch, index, "")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if fetch.Full || fetch.Epoch != epoch {
+		t.Fatalf("bad: %#v", fetch)
+	}
+}
+
+func TestDRReplication_ApplyFullSyncPage(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+	for _, key := range []string{"test/a", "test/b", "test/c", "test/d"} {
+		if err := c.physical.Put(&physical.Entry{Key: key, Value: []byte("old")}); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+
+	// Only the keys the page covers, after test/a up to its cursor, are
+	// deleted if the primary does not have them
+	if err := c.drApply(&drFetchResponse{
+		Full:   true,
+		More:   true,
+		Cursor: "test/c",
+		Entries: []*drEntry{
+			{Key: "test/b", Value: base64.StdEncoding.EncodeToString([]byte("new"))},
+		},
+	}, "test/a"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	for key, expected := range map[string]string{
+		"test/a": "old",
+		"test/b": "new",
+		"test/c": "",
+		"test/d": "old",
+	} {
+		pe, err := c.physical.Get(key)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if (expected == "") != (pe == nil) || (pe != nil && string(pe.Value) != expected) {
+			t.Fatalf("bad: %s: %#v", key, pe)
+		}
+	}
+}
+
+// testDRWait waits for the condition to hold
+func testDRWait(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(10 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
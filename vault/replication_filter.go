@@ -0,0 +1,117 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/helper/strutil"
+)
+
+const (
+	// pathFilterAllow only replicates the mounts under the paths of the
+	// filter
+	pathFilterAllow = "allow"
+
+	// pathFilterDeny replicates all the mounts but those under the paths of
+	// the filter
+	pathFilterDeny = "deny"
+)
+
+var (
+	// pathFilterAlwaysReplicated are the types of the mounts replicated
+	// whatever the filter, as the secondary cannot serve requests without
+	// them. These are types, not paths.
+	pathFilterAlwaysReplicated = []string{
+		"cubbyhole",
+		"system",
+		"token",
+	}
+)
+
+// PathFilter selects the mounts and auth mounts replicated to a secondary.
+// Paths are request paths, such as "secret/", "auth/userpass/" or, for the
+// mounts of a namespace, "ns1/secret/" and "ns1/auth/userpass/". A path
+// covers the mounts under it, so "ns1/" covers all the mounts of the
+// namespace.
+type PathFilter struct {
+	Mode  string   `json:"mode"`
+	Paths []string `json:"paths"`
+}
+
+// validate checks the filter, and sanitizes its paths to end with a slash
+func (f *PathFilter) validate() error {
+	switch f.Mode {
+	case pathFilterAllow, pathFilterDeny:
+	default:
+		return fmt.Errorf("invalid path filter mode %q, must be %q or %q", f.Mode, pathFilterAllow, pathFilterDeny)
+	}
+	if len(f.Paths) == 0 {
+		return fmt.Errorf("path filter requires at least one path")
+	}
+	for i, path := range f.Paths {
+		path = strings.TrimPrefix(path, "/")
+		if path == "" {
+			return fmt.Errorf("invalid path filter path %q", f.Paths[i])
+		}
+		if !strings.HasSuffix(path, "/") {
+			path += "/"
+		}
+		f.Paths[i] = path
+	}
+	return nil
+}
+
+// filtered returns whether the mount at the given request path is left out
+// by the filter
+func (f *PathFilter) filtered(path string) bool {
+	var covered bool
+	for _, prefix := range f.Paths {
+		if strings.HasPrefix(path, prefix) {
+			covered = true
+			break
+		}
+	}
+	if f.Mode == pathFilterAllow {
+		return !covered
+	}
+	return covered
+}
+
+// pathFilterPrefixes returns the storage prefixes of the mounts and auth
+// mounts left out by the filter
+func (c *Core) pathFilterPrefixes(f *PathFilter) []string {
+	if f == nil {
+		return nil
+	}
+
+	c.mountsLock.RLock()
+	mounts := append([]*MountEntry(nil), c.mounts.Entries...)
+	c.mountsLock.RUnlock()
+
+	c.authLock.RLock()
+	auths := append([]*MountEntry(nil), c.auth.Entries...)
+	c.authLock.RUnlock()
+
+	var prefixes []string
+	for _, entry := range mounts {
+		if strutil.StrListContains(pathFilterAlwaysReplicated, entry.Type) {
+			continue
+		}
+		if f.filtered(entry.Path) {
+			prefixes = append(prefixes, backendBarrierPrefix+entry.UUID+"/")
+		}
+	}
+	for _, entry := range auths {
+		if strutil.StrListContains(pathFilterAlwaysReplicated, entry.Type) {
+			continue
+		}
+
+		// Auth mounts are filtered by their path in their namespace
+		nsPath := namespacePath(c.mountNamespace(entry))
+		path := nsPath + credentialRoutePrefix + strings.TrimPrefix(entry.Path, nsPath)
+		if f.filtered(path) {
+			prefixes = append(prefixes, credentialBarrierPrefix+entry.UUID+"/")
+		}
+	}
+	return prefixes
+}
@@ -0,0 +1,92 @@
+package vault
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestPathFilter_Validate(t *testing.T) {
+	f := &PathFilter{Mode: pathFilterDeny, Paths: []string{"secret", "/auth/foo/"}}
+	if err := f.validate(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(f.Paths, []string{"secret/", "auth/foo/"}) {
+		t.Fatalf("bad: %#v", f.Paths)
+	}
+
+	for _, f := range []*PathFilter{
+		{Mode: "foo", Paths: []string{"secret/"}},
+		{Mode: pathFilterAllow},
+		{Mode: pathFilterAllow, Paths: []string{"/"}},
+	} {
+		if err := f.validate(); err == nil {
+			t.Fatalf("%#v: expected error", f)
+		}
+	}
+}
+
+func TestCore_PathFilterPrefixes(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "sys/namespaces/ns1", nil)
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "sys/mounts/other", map[string]interface{}{
+		"type": "generic",
+	})
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "ns1/sys/mounts/secret", map[string]interface{}{
+		"type": "generic",
+	})
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "sys/auth/foo", map[string]interface{}{
+		"type": "noop",
+	})
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "ns1/sys/auth/foo", map[string]interface{}{
+		"type": "noop",
+	})
+
+	prefix := func(path string) string {
+		for _, entry := range c.mounts.Entries {
+			if entry.Path == path {
+				return backendBarrierPrefix + entry.UUID + "/"
+			}
+		}
+		for _, entry := range c.auth.Entries {
+			if credentialRoutePrefix+entry.Path == path {
+				return credentialBarrierPrefix + entry.UUID + "/"
+			}
+		}
+		t.Fatalf("no mount at %s", path)
+		return ""
+	}
+
+	for _, tc := range []struct {
+		filter   *PathFilter
+		expected []string
+	}{
+		{
+			nil,
+			nil,
+		},
+		{
+			&PathFilter{Mode: pathFilterDeny, Paths: []string{"other/", "auth/foo/"}},
+			[]string{prefix("other/"), prefix("auth/foo/")},
+		},
+		{
+			&PathFilter{Mode: pathFilterDeny, Paths: []string{"ns1/"}},
+			[]string{prefix("ns1/secret/"), prefix("auth/ns1/foo/")},
+		},
+		{
+			// The system, token and cubbyhole mounts are always replicated
+			&PathFilter{Mode: pathFilterAllow, Paths: []string{"secret/", "ns1/auth/foo/"}},
+			[]string{prefix("other/"), prefix("ns1/secret/"), prefix("auth/foo/")},
+		},
+	} {
+		actual := c.pathFilterPrefixes(tc.filter)
+		sort.Strings(actual)
+		sort.Strings(tc.expected)
+		if !reflect.DeepEqual(actual, tc.expected) {
+			t.Fatalf("%#v: bad: %#v, expected %#v", tc.filter, actual, tc.expected)
+		}
+	}
+}
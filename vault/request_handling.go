@@ -6,23 +6,57 @@ import (
 	"time"
 
 	"github.com/armon/go-metrics"
+	"github.com/hashicorp/errwrap"
 	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/helper/errutil"
 	"github.com/hashicorp/vault/helper/policyutil"
 	"github.com/hashicorp/vault/helper/strutil"
+	"github.com/hashicorp/vault/helper/tracing"
 	"github.com/hashicorp/vault/logical"
 )
 
 // HandleRequest is used to handle a new incoming request
 func (c *Core) HandleRequest(req *logical.Request) (resp *logical.Response, err error) {
+	ctx, span := tracing.StartSpan(req.Context(), "vault.handle_request")
+	span.SetAttribute("vault.operation", string(req.Operation))
+	span.SetAttribute("vault.path", req.Path)
+	defer func() {
+		span.SetError(err)
+		span.End()
+	}()
+	req.SetContext(ctx)
+
+	// Wait for admission before taking the state lock, so that queued
+	// requests never hold up sealing
+	done, err := c.admission.admit(requestAdmissionClass(req))
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
 	c.stateLock.RLock()
 	defer c.stateLock.RUnlock()
 	if c.sealed {
 		return nil, ErrSealed
 	}
-	if c.standby {
+	if c.standby && !c.perfStandby {
+		return nil, ErrStandby
+	}
+
+	// Requests in a namespace are routed to the paths of the namespace
+	req.Path = c.namespaceRequestPath(req.Path)
+
+	// A performance standby serves the reads it can, and has the others
+	// forwarded to the active node
+	if c.standby && !c.performanceStandbyServes(req) {
 		return nil, ErrStandby
 	}
 
+	// Reject requests beyond a rate limit quota before doing any work
+	if err := c.checkRateLimitQuotas(req); err != nil {
+		return nil, err
+	}
+
 	// Allowing writing to a path ending in / makes it extremely difficult to
 	// understand user intent for the filesystem-like backends (generic,
 	// cubbyhole) -- did they want a key named foo/ or did they want to write
@@ -31,10 +65,20 @@ func (c *Core) HandleRequest(req *logical.Request) (resp *logical.Response, err
 	// backends. Basically, it's all just terrible, so don't allow it.
 	if strings.HasSuffix(req.Path, "/") &&
 		(req.Operation == logical.UpdateOperation ||
-			req.Operation == logical.CreateOperation) {
+			req.Operation == logical.CreateOperation ||
+			req.Operation == logical.PatchOperation) {
 		return logical.ErrorResponse("cannot write to a path ending in '/'"), nil
 	}
 
+	// Record the mount serving the request and its audit options for the
+	// audit backends, which log the request before it is routed
+	req.MountPoint = c.router.MatchingMount(req.Path)
+	if entry := c.router.MatchingMountEntry(req.Path); entry != nil {
+		req.AuditNonHMACRequestKeys = entry.Config.AuditNonHMACRequestKeys
+		req.AuditNonHMACResponseKeys = entry.Config.AuditNonHMACResponseKeys
+		req.AuditElideResponseKeys = entry.Config.AuditElideResponseKeys
+	}
+
 	var auth *logical.Auth
 	if c.router.LoginPath(req.Path) {
 		resp, auth, err = c.handleLoginRequest(req)
@@ -42,6 +86,12 @@ func (c *Core) HandleRequest(req *logical.Request) (resp *logical.Response, err
 		resp, auth, err = c.handleRequest(req)
 	}
 
+	// A read served on a performance standby that turns out to write to
+	// storage is forwarded to the active node
+	if c.standby && err != nil && errwrap.Contains(err, errPerformanceStandbyReadOnly.Error()) {
+		return nil, ErrStandby
+	}
+
 	// Ensure we don't leak internal data
 	if resp != nil {
 		if resp.Secret != nil {
@@ -53,8 +103,16 @@ func (c *Core) HandleRequest(req *logical.Request) (resp *logical.Response, err
 	}
 
 	// We are wrapping if there is anything to wrap (not a nil response) and a
-	// TTL was specified for the token
-	wrapping := resp != nil && resp.WrapInfo != nil && resp.WrapInfo.TTL != 0
+	// TTL was specified for the token. Responses held by a control group
+	// already carry their wrapping token.
+	wrapping := resp != nil && resp.WrapInfo != nil && resp.WrapInfo.TTL != 0 && resp.WrapInfo.Token == ""
+
+	// A stream cannot be stored in the cubbyhole without reading it into
+	// memory, which is what streaming is meant to avoid
+	if wrapping && resp.Stream != nil {
+		resp.Stream.Body.Close()
+		return logical.ErrorResponse("streamed responses cannot be wrapped"), logical.ErrInvalidRequest
+	}
 
 	if wrapping {
 		cubbyResp, err := c.wrapInCubbyhole(req, resp)
@@ -90,6 +148,22 @@ func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, r
 
 	// Validate the token
 	auth, te, ctErr := c.checkToken(req)
+
+	// Using up a limited use token or holding a request for a control group
+	// writes to storage, which only the active node does
+	if c.standby {
+		_, cgRequired := ctErr.(*controlGroupRequiredError)
+		if cgRequired || (te != nil && te.NumUses != 0) {
+			return nil, nil, ErrStandby
+		}
+	}
+
+	// The wrapping token of a control group request is only used up once
+	// the request is approved
+	if ctErr == nil && isControlGroupUnwrap(req, te) {
+		return c.handleControlGroupUnwrap(req, auth, te)
+	}
+
 	// We run this logic first because we want to decrement the use count even in the case of an error
 	if te != nil {
 		// Attempt to use the token (decrement NumUses)
@@ -102,7 +176,7 @@ func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, r
 		}
 		if te == nil {
 			// Token has been revoked by this point
-			retErr = multierror.Append(retErr, logical.ErrPermissionDenied)
+			retErr = multierror.Append(retErr, errutil.WithCode(errutil.CodeInvalidToken, logical.ErrPermissionDenied))
 			return nil, nil, retErr
 		}
 		if te.NumUses == -1 {
@@ -126,12 +200,16 @@ func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, r
 			}(te.ID)
 		}
 	}
+	// Requests held by a control group are stored until approved
+	if cgErr, ok := ctErr.(*controlGroupRequiredError); ok {
+		return c.handleControlGroupRequest(req, auth, te, cgErr.controlGroup)
+	}
 	if ctErr != nil {
 		// If it is an internal error we return that, otherwise we
 		// return invalid request so that the status codes can be correct
 		var errType error
-		switch ctErr {
-		case ErrInternalError, logical.ErrPermissionDenied:
+		switch {
+		case ctErr == ErrInternalError, errwrap.Contains(ctErr, logical.ErrPermissionDenied.Error()):
 			errType = ctErr
 		default:
 			errType = logical.ErrInvalidRequest
@@ -148,8 +226,9 @@ func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, r
 		return logical.ErrorResponse(ctErr.Error()), nil, retErr
 	}
 
-	// Attach the display name
+	// Attach the display name and entity
 	req.DisplayName = auth.DisplayName
+	req.EntityID = auth.EntityID
 
 	// Create an audit trail of the request
 	if err := c.auditBroker.LogRequest(auth, req, nil); err != nil {
@@ -159,6 +238,15 @@ func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, r
 		return nil, auth, retErr
 	}
 
+	// Reject requests that could issue a lease beyond a lease count quota,
+	// before the backend creates the secret
+	if leaseQuotaApplies(req) {
+		if err := c.expiration.checkLeaseQuotas(req.Path, ""); err != nil {
+			retErr = multierror.Append(retErr, err)
+			return nil, auth, retErr
+		}
+	}
+
 	// Route the request
 	resp, err := c.router.Route(req)
 	if resp != nil {
@@ -210,6 +298,9 @@ func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, r
 			}
 		}
 
+		if registerLease && c.standby {
+			return nil, auth, ErrStandby
+		}
 		if registerLease {
 			leaseID, err := c.expiration.Register(req, resp)
 			if err != nil {
@@ -244,6 +335,11 @@ func (c *Core) handleRequest(req *logical.Request) (retResp *logical.Response, r
 			return nil, nil, retErr
 		}
 
+		// Batch tokens have no lease
+		if te.Type == TokenTypeBatch {
+			return resp, auth, retErr
+		}
+
 		if err := c.expiration.RegisterAuth(te.Path, resp.Auth); err != nil {
 			c.logger.Printf("[ERR] core: failed to register token lease "+
 				"(request path: %s): %v", req.Path, err)
@@ -309,6 +405,22 @@ func (c *Core) handleLoginRequest(req *logical.Request) (*logical.Response, *log
 			return logical.ErrorResponse("authentication backends cannot create root tokens"), nil, logical.ErrInvalidRequest
 		}
 
+		if !validTokenType(auth.TokenType) {
+			c.logger.Printf("[ERR] core: invalid token type %q for login path "+
+				"(request path: %s)", auth.TokenType, req.Path)
+			return nil, nil, ErrInternalError
+		}
+		batch := auth.TokenType == TokenTypeBatch
+
+		// Reject the login if its token would exceed a lease count quota.
+		// This is only known once the backend reported the role. Batch
+		// tokens have no lease, so they are not limited.
+		if !batch {
+			if err := c.expiration.checkLeaseQuotas(req.Path, leaseRole(auth)); err != nil {
+				return nil, nil, err
+			}
+		}
+
 		// Determine the source of the login
 		source := c.router.MatchingMount(req.Path)
 		source = strings.TrimPrefix(source, credentialRoutePrefix)
@@ -343,9 +455,68 @@ func (c *Core) handleLoginRequest(req *logical.Request) (*logical.Response, *log
 			CreationTime: time.Now().Unix(),
 			TTL:          auth.TTL,
 		}
+		if batch {
+			te.Type = TokenTypeBatch
+			auth.Renewable = false
+			auth.Period = 0
+		}
 
 		te.Policies = policyutil.SanitizePolicies(te.Policies, true)
 
+		// The token belongs to the namespace of the auth mount, whose
+		// policies it is granted
+		loginNS, _ := c.resolveNamespace(req.Path)
+		if loginNS != nil {
+			te.NamespaceID = loginNS.ID
+		}
+
+		// Tie the token to the entity of the authenticated principal, if the
+		// backend could identify it
+		if auth.Alias != nil && auth.Alias.Name != "" {
+			mount := c.router.MatchingMountEntry(req.Path)
+			if mount == nil {
+				c.logger.Printf("[ERR] core: unable to look up mount for login path"+
+					"(request path: %s)", req.Path)
+				return nil, nil, ErrInternalError
+			}
+			mountPath := c.router.MatchingMount(req.Path)
+			entity, err := c.identityStore.EntityForAlias(te.NamespaceID, mountPath, mount.Type, auth.Alias)
+			if err != nil {
+				c.logger.Printf("[ERR] core: failed to resolve entity "+
+					"(request path: %s): %v", req.Path, err)
+				return nil, nil, ErrInternalError
+			}
+			te.EntityID = entity.ID
+			auth.EntityID = entity.ID
+
+			var groupNames []string
+			for _, groupAlias := range auth.GroupAliases {
+				groupNames = append(groupNames, groupAlias.Name)
+			}
+			if err := c.identityStore.UpdateExternalGroups(entity.ID, mountPath, groupNames); err != nil {
+				c.logger.Printf("[ERR] core: failed to update external groups "+
+					"(request path: %s): %v", req.Path, err)
+				return nil, nil, ErrInternalError
+			}
+		}
+
+		// Logins targeted by an MFA enforcement require second factors
+		// before the token is issued. The methods validated are recorded
+		// in the token metadata, so that policies can require them.
+		if err := c.enforceLoginMFA(req, c.router.MatchingMount(req.Path), te.EntityID); err != nil {
+			if err == ErrInternalError {
+				return nil, nil, err
+			}
+			return logical.ErrorResponse(err.Error()), nil, err
+		}
+		if len(req.MFAValidated) > 0 && te.Meta[mfaMethodMetaKey] == "" {
+			if te.Meta == nil {
+				te.Meta = make(map[string]string)
+				auth.Metadata = te.Meta
+			}
+			te.Meta[mfaMethodMetaKey] = strings.Join(req.MFAValidated, ",")
+		}
+
 		if err := c.tokenStore.create(&te); err != nil {
 			c.logger.Printf("[ERR] core: failed to create token: %v", err)
 			return nil, auth, ErrInternalError
@@ -356,11 +527,14 @@ func (c *Core) handleLoginRequest(req *logical.Request) (*logical.Response, *log
 		auth.Accessor = te.Accessor
 		auth.Policies = te.Policies
 
-		// Register with the expiration manager
-		if err := c.expiration.RegisterAuth(te.Path, auth); err != nil {
-			c.logger.Printf("[ERR] core: failed to register token lease "+
-				"(request path: %s): %v", req.Path, err)
-			return nil, auth, ErrInternalError
+		// Register with the expiration manager, unless it is a batch token
+		// which has no lease
+		if !batch {
+			if err := c.expiration.RegisterAuth(te.Path, auth); err != nil {
+				c.logger.Printf("[ERR] core: failed to register token lease "+
+					"(request path: %s): %v", req.Path, err)
+				return nil, auth, ErrInternalError
+			}
 		}
 
 		// Attach the display name, might be used by audit backends
@@ -370,6 +544,17 @@ func (c *Core) handleLoginRequest(req *logical.Request) (*logical.Response, *log
 	return resp, auth, err
 }
 
+// leaseQuotaApplies returns whether lease count quotas are checked before
+// the request is routed, which is the case of the requests that could issue
+// a lease
+func leaseQuotaApplies(req *logical.Request) bool {
+	switch req.Operation {
+	case logical.ReadOperation, logical.CreateOperation, logical.UpdateOperation:
+		return !strings.HasPrefix(req.Path, "sys/")
+	}
+	return false
+}
+
 func (c *Core) wrapInCubbyhole(req *logical.Request, resp *logical.Response) (*logical.Response, error) {
 	// If we are wrapping, the first part (performed in this functions) happens
 	// before auditing so that resp.WrapInfo.Token can contain the HMAC'd
@@ -391,6 +576,7 @@ func (c *Core) wrapInCubbyhole(req *logical.Request, resp *logical.Response) (*l
 	}
 
 	resp.WrapInfo.Token = te.ID
+	resp.WrapInfo.Accessor = te.Accessor
 	resp.WrapInfo.CreationTime = creationTime
 
 	// This will only be non-nil if this response contains a token, so in that
@@ -399,19 +585,7 @@ func (c *Core) wrapInCubbyhole(req *logical.Request, resp *logical.Response) (*l
 		resp.WrapInfo.WrappedAccessor = resp.Auth.Accessor
 	}
 
-	httpResponse := logical.SanitizeResponse(resp)
-
-	// Add the unique identifier of the original request to the response
-	httpResponse.RequestID = req.ID
-
-	// Because of the way that JSON encodes (likely just in Go) we actually get
-	// mixed-up values for ints if we simply put this object in the response
-	// and encode the whole thing; so instead we marshal it first, then store
-	// the string response. This actually ends up making it easier on the
-	// client side, too, as it becomes a straight read-string-pass-to-unmarshal
-	// operation.
-
-	marshaledResponse, err := json.Marshal(httpResponse)
+	marshaledResponse, err := marshalWrappedResponse(req, resp)
 	if err != nil {
 		c.logger.Printf("[ERR] core: failed to marshal wrapped response: %v", err)
 		return nil, ErrInternalError
@@ -422,7 +596,7 @@ func (c *Core) wrapInCubbyhole(req *logical.Request, resp *logical.Response) (*l
 		Path:        "cubbyhole/response",
 		ClientToken: te.ID,
 		Data: map[string]interface{}{
-			"response": string(marshaledResponse),
+			"response": marshaledResponse,
 		},
 	}
 
@@ -459,3 +633,24 @@ func (c *Core) wrapInCubbyhole(req *logical.Request, resp *logical.Response) (*l
 
 	return nil, nil
 }
+
+// marshalWrappedResponse encodes a response as it is stored in the
+// cubbyhole of its wrapping token
+func marshalWrappedResponse(req *logical.Request, resp *logical.Response) (string, error) {
+	httpResponse := logical.SanitizeResponse(resp)
+
+	// Add the unique identifier of the original request to the response
+	httpResponse.RequestID = req.ID
+
+	// Because of the way that JSON encodes (likely just in Go) we actually get
+	// mixed-up values for ints if we simply put this object in the response
+	// and encode the whole thing; so instead we marshal it first, then store
+	// the string response. This actually ends up making it easier on the
+	// client side, too, as it becomes a straight read-string-pass-to-unmarshal
+	// operation.
+	marshaledResponse, err := json.Marshal(httpResponse)
+	if err != nil {
+		return "", err
+	}
+	return string(marshaledResponse), nil
+}
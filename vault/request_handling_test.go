@@ -6,6 +6,7 @@ import (
 
 	"github.com/hashicorp/go-uuid"
 	credUserpass "github.com/hashicorp/vault/builtin/credential/userpass"
+	"github.com/hashicorp/vault/helper/tracing"
 	"github.com/hashicorp/vault/logical"
 )
 
@@ -136,3 +137,47 @@ func TestRequestHandling_LoginWrapping(t *testing.T) {
 		t.Fatalf("bad: %#v", resp)
 	}
 }
+
+func TestRequestHandling_Tracing(t *testing.T) {
+	core, _, root := TestCoreUnsealed(t)
+
+	exporter, done := tracing.TestGlobalTracer(t)
+	req := &logical.Request{
+		Operation:   logical.UpdateOperation,
+		Path:        "secret/foo",
+		Data:        map[string]interface{}{"foo": "bar"},
+		ClientToken: root,
+	}
+	if _, err := core.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	done()
+
+	spans := make(map[string]*tracing.SpanData)
+	for _, span := range exporter.Spans() {
+		spans[span.Name] = span
+	}
+
+	// The write to the generic backend is traced down to the physical
+	// backend
+	chain := []string{"vault.handle_request", "vault.route", "barrier.put", "physical.put"}
+	for i, name := range chain {
+		span, ok := spans[name]
+		if !ok {
+			t.Fatalf("missing %s span: %#v", name, spans)
+		}
+		if i == 0 {
+			if span.Attributes["vault.path"] != "secret/foo" {
+				t.Fatalf("bad: %#v", span)
+			}
+			continue
+		}
+		parent := spans[chain[i-1]]
+		if span.TraceID != parent.TraceID || span.ParentSpanID != parent.SpanID {
+			t.Fatalf("%s is not a child of %s", name, parent.Name)
+		}
+	}
+	if spans["vault.route"].Attributes["vault.mount_point"] != "secret/" {
+		t.Fatalf("bad: %#v", spans["vault.route"])
+	}
+}
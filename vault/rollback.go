@@ -116,6 +116,10 @@ func (m *RollbackManager) triggerRollbacks() {
 		if e.Table == credentialTableType {
 			path = "auth/" + path
 		}
+		// Lazy mounts that have not been used have nothing to roll back
+		if ready, _ := m.router.MountState(path); !ready {
+			continue
+		}
 		if _, ok := m.inflight[path]; !ok {
 			m.startRollback(path)
 		}
@@ -4,11 +4,13 @@ import (
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/armon/go-metrics"
 	"github.com/armon/go-radix"
 	"github.com/hashicorp/vault/helper/salt"
+	"github.com/hashicorp/vault/helper/tracing"
 	"github.com/hashicorp/vault/logical"
 )
 
@@ -35,6 +37,53 @@ type routeEntry struct {
 	storageView *BarrierView
 	rootPaths   *radix.Tree
 	loginPaths  *radix.Tree
+
+	// factory creates the backend of a mount that is set up lazily. It is
+	// called on first use, and again on the next use if it fails. ready is
+	// set once the backend exists, so that routing does not need the lock.
+	factory   func() (logical.Backend, error)
+	ready     uint32
+	setupErr  error
+	setupLock sync.Mutex
+}
+
+// load creates the backend if the mount is set up lazily and it has not
+// been created yet. The backend and special paths must only be used after
+// load succeeded.
+func (re *routeEntry) load() error {
+	if atomic.LoadUint32(&re.ready) == 1 {
+		return nil
+	}
+
+	re.setupLock.Lock()
+	defer re.setupLock.Unlock()
+	if re.backend != nil {
+		return nil
+	}
+
+	backend, err := re.factory()
+	if err != nil {
+		re.setupErr = err
+		return err
+	}
+	paths := backend.SpecialPaths()
+	if paths == nil {
+		paths = new(logical.Paths)
+	}
+	re.rootPaths = pathsToRadix(paths.Root)
+	re.loginPaths = pathsToRadix(paths.Unauthenticated)
+	re.backend = backend
+	re.factory = nil
+	re.setupErr = nil
+	atomic.StoreUint32(&re.ready, 1)
+	return nil
+}
+
+// loaded returns the backend if it has been created, without creating it
+func (re *routeEntry) loaded() logical.Backend {
+	re.setupLock.Lock()
+	defer re.setupLock.Unlock()
+	return re.backend
 }
 
 // SaltID is used to apply a salt and hash to an ID to make sure its not reversible
@@ -67,12 +116,49 @@ func (r *Router) Mount(backend logical.Backend, prefix string, mountEntry *Mount
 		storageView: storageView,
 		rootPaths:   pathsToRadix(paths.Root),
 		loginPaths:  pathsToRadix(paths.Unauthenticated),
+		ready:       1,
 	}
 	r.root.Insert(prefix, re)
 
 	return nil
 }
 
+// MountLazy is like Mount, but the backend is only created with the given
+// factory when the mount is first used
+func (r *Router) MountLazy(factory func() (logical.Backend, error), prefix string, mountEntry *MountEntry, storageView *BarrierView) error {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	// Check if this is a nested mount
+	if existing, _, ok := r.root.LongestPrefix(prefix); ok && existing != "" {
+		return fmt.Errorf("cannot mount under existing mount '%s'", existing)
+	}
+
+	re := &routeEntry{
+		mountEntry:  mountEntry,
+		storageView: storageView,
+		factory:     factory,
+	}
+	r.root.Insert(prefix, re)
+	return nil
+}
+
+// MountState returns whether the backend of the mount at the given prefix
+// has been created, and why the last attempt failed if it has not
+func (r *Router) MountState(prefix string) (bool, error) {
+	r.l.RLock()
+	raw, ok := r.root.Get(prefix)
+	r.l.RUnlock()
+	if !ok {
+		return false, fmt.Errorf("no mount at '%s'", prefix)
+	}
+	re := raw.(*routeEntry)
+
+	re.setupLock.Lock()
+	defer re.setupLock.Unlock()
+	return re.backend != nil, re.setupErr
+}
+
 // Unmount is used to remove a logical backend from a given prefix
 func (r *Router) Unmount(prefix string) error {
 	r.l.Lock()
@@ -81,7 +167,9 @@ func (r *Router) Unmount(prefix string) error {
 	// Call backend's Cleanup routine
 	re, ok := r.root.Get(prefix)
 	if ok {
-		re.(*routeEntry).backend.Cleanup()
+		if backend := re.(*routeEntry).loaded(); backend != nil {
+			backend.Cleanup()
+		}
 	}
 	r.root.Delete(prefix)
 	return nil
@@ -168,7 +256,11 @@ func (r *Router) MatchingBackend(path string) logical.Backend {
 	if !ok {
 		return nil
 	}
-	return raw.(*routeEntry).backend
+	re := raw.(*routeEntry)
+	if err := re.load(); err != nil {
+		return nil
+	}
+	return re.backend
 }
 
 // MatchingSystemView returns the SystemView used for a path
@@ -179,7 +271,11 @@ func (r *Router) MatchingSystemView(path string) logical.SystemView {
 	if !ok {
 		return nil
 	}
-	return raw.(*routeEntry).backend.System()
+	re := raw.(*routeEntry)
+	if err := re.load(); err != nil {
+		return nil
+	}
+	return re.backend.System()
 }
 
 // Route is used to route a given request
@@ -222,16 +318,32 @@ func (r *Router) routeCommon(req *logical.Request, existenceCheck bool) (*logica
 		}
 	}
 
+	// Create the backend if this is the first use of a lazy mount
+	if err := re.load(); err != nil {
+		return nil, false, false, fmt.Errorf("failed to set up backend at '%s': %v", mount, err)
+	}
+
 	// Adjust the path to exclude the routing prefix
 	original := req.Path
+	originalMountPoint := req.MountPoint
 	req.Path = strings.TrimPrefix(req.Path, mount)
 	req.MountPoint = mount
 	if req.Path == "/" {
 		req.Path = ""
 	}
 
+	// Trace the request as it is handled by the backend
+	originalCtx := req.Context()
+	ctx, span := tracing.StartChildSpan(originalCtx, "vault.route")
+	span.SetAttribute("vault.mount_point", mount)
+	defer span.End()
+	req.SetContext(ctx)
+
 	// Attach the storage view for the request
 	req.Storage = re.storageView
+	if span != nil {
+		req.Storage = re.storageView.withContext(ctx)
+	}
 
 	// Hash the request token unless this is the token backend
 	clientToken := req.ClientToken
@@ -251,22 +363,30 @@ func (r *Router) routeCommon(req *logical.Request, existenceCheck bool) (*logica
 	// Cache the identifier of the request
 	originalReqID := req.ID
 
+	// The MFA credentials are not for the backends to see
+	mfaCreds := req.MFACreds
+	req.MFACreds = nil
+
 	// Reset the request before returning
 	defer func() {
 		req.Path = original
-		req.MountPoint = ""
+		req.MountPoint = originalMountPoint
 		req.Connection = originalConn
 		req.ID = originalReqID
+		req.MFACreds = mfaCreds
 		req.Storage = nil
 		req.ClientToken = clientToken
+		req.SetContext(originalCtx)
 	}()
 
 	// Invoke the backend
 	if existenceCheck {
 		ok, exists, err := re.backend.HandleExistenceCheck(req)
+		span.SetError(err)
 		return nil, ok, exists, err
 	} else {
 		resp, err := re.backend.HandleRequest(req)
+		span.SetError(err)
 		return resp, false, false, err
 	}
 }
@@ -280,6 +400,9 @@ func (r *Router) RootPath(path string) bool {
 		return false
 	}
 	re := raw.(*routeEntry)
+	if err := re.load(); err != nil {
+		return false
+	}
 
 	// Trim to get remaining path
 	remain := strings.TrimPrefix(path, mount)
@@ -309,6 +432,9 @@ func (r *Router) LoginPath(path string) bool {
 		return false
 	}
 	re := raw.(*routeEntry)
+	if err := re.load(); err != nil {
+		return false
+	}
 
 	// Trim to get remaining path
 	remain := strings.TrimPrefix(path, mount)
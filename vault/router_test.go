@@ -114,6 +114,68 @@ func TestRouter_Mount(t *testing.T) {
 	}
 }
 
+func TestRouter_MountLazy(t *testing.T) {
+	r := NewRouter()
+	_, barrier, _ := mockBarrier(t)
+	view := NewBarrierView(barrier, "logical/")
+
+	meUUID, err := uuid.GenerateUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := &NoopBackend{Login: []string{"login"}}
+	var calls int
+	factory := func() (logical.Backend, error) {
+		calls++
+		if calls == 1 {
+			return nil, fmt.Errorf("unavailable")
+		}
+		return n, nil
+	}
+	if err := r.MountLazy(factory, "prod/aws/", &MountEntry{UUID: meUUID}, view); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := r.MountLazy(factory, "prod/aws/", &MountEntry{UUID: meUUID}, view); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// The backend is not created by mounting
+	if ready, err := r.MountState("prod/aws/"); ready || err != nil || calls != 0 {
+		t.Fatalf("bad: %t %v %d", ready, err, calls)
+	}
+	if path := r.MatchingMount("prod/aws/foo"); path != "prod/aws/" {
+		t.Fatalf("bad: %s", path)
+	}
+
+	// A failure is reported and retried on the next use
+	req := &logical.Request{
+		Path: "prod/aws/foo",
+	}
+	if _, err := r.Route(req); err == nil || !strings.Contains(err.Error(), "unavailable") {
+		t.Fatalf("err: %v", err)
+	}
+	if ready, err := r.MountState("prod/aws/"); ready || err == nil {
+		t.Fatalf("bad: %t %v", ready, err)
+	}
+	if !r.LoginPath("prod/aws/login") {
+		t.Fatal("expected login path")
+	}
+	if ready, err := r.MountState("prod/aws/"); !ready || err != nil {
+		t.Fatalf("bad: %t %v", ready, err)
+	}
+
+	if _, err := r.Route(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if calls != 2 || len(n.Paths) != 1 || n.Paths[0] != "foo" {
+		t.Fatalf("bad: %d %v", calls, n.Paths)
+	}
+
+	if _, err := r.MountState("stage/aws/"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
 func TestRouter_Unmount(t *testing.T) {
 	r := NewRouter()
 	_, barrier, _ := mockBarrier(t)
@@ -49,6 +49,12 @@ type Seal interface {
 	VerifyRecoveryKey([]byte) error
 }
 
+// sealHealthChecker is implemented by seals that depend on an external
+// service, such as a key management service, to unseal
+type sealHealthChecker interface {
+	Health() *SealHealth
+}
+
 type DefaultSeal struct {
 	config *SealConfig
 	core   *Core
@@ -102,16 +108,70 @@ func (d *DefaultSeal) BarrierConfig() (*SealConfig, error) {
 		return nil, err
 	}
 
+	conf, err := readBarrierConfig(d.core, d.BarrierType())
+	if err != nil || conf == nil {
+		return nil, err
+	}
+
+	d.config = conf
+	return d.config.Clone(), nil
+}
+
+func (d *DefaultSeal) SetBarrierConfig(config *SealConfig) error {
+	if err := d.checkCore(); err != nil {
+		return err
+	}
+
+	config.Type = d.BarrierType()
+	if err := writeBarrierConfig(d.core, config); err != nil {
+		return err
+	}
+
+	d.config = config.Clone()
+
+	return nil
+}
+
+// clearConfig drops the cached barrier configuration, which is read again
+// from storage on next use
+func (d *DefaultSeal) clearConfig() {
+	d.config = nil
+}
+
+func (d *DefaultSeal) RecoveryType() string {
+	return "unsupported"
+}
+
+func (d *DefaultSeal) RecoveryConfig() (*SealConfig, error) {
+	return nil, fmt.Errorf("recovery not supported")
+}
+
+func (d *DefaultSeal) SetRecoveryConfig(config *SealConfig) error {
+	return fmt.Errorf("recovery not supported")
+}
+
+func (d *DefaultSeal) VerifyRecoveryKey([]byte) error {
+	return fmt.Errorf("recovery not supported")
+}
+
+func (d *DefaultSeal) SetRecoveryKey(key []byte) error {
+	return fmt.Errorf("recovery not supported")
+}
+
+// readBarrierConfig reads the barrier seal configuration from the physical
+// backend and checks that it belongs to a seal of the given type. If the seal
+// configuration is missing, Vault is not initialized and nil is returned.
+func readBarrierConfig(core *Core, barrierType string) (*SealConfig, error) {
 	// Fetch the core configuration
-	pe, err := d.core.physical.Get(barrierSealConfigPath)
+	pe, err := core.physical.Get(barrierSealConfigPath)
 	if err != nil {
-		d.core.logger.Printf("[ERR] core: failed to read seal configuration: %v", err)
+		core.logger.Printf("[ERR] core: failed to read seal configuration: %v", err)
 		return nil, fmt.Errorf("failed to check seal configuration: %v", err)
 	}
 
 	// If the seal configuration is missing, we are not initialized
 	if pe == nil {
-		d.core.logger.Printf("[INFO] core: seal configuration missing, not initialized")
+		core.logger.Printf("[INFO] core: seal configuration missing, not initialized")
 		return nil, nil
 	}
 
@@ -119,37 +179,33 @@ func (d *DefaultSeal) BarrierConfig() (*SealConfig, error) {
 
 	// Decode the barrier entry
 	if err := jsonutil.DecodeJSON(pe.Value, &conf); err != nil {
-		d.core.logger.Printf("[ERR] core: failed to decode seal configuration: %v", err)
+		core.logger.Printf("[ERR] core: failed to decode seal configuration: %v", err)
 		return nil, fmt.Errorf("failed to decode seal configuration: %v", err)
 	}
 
-	switch conf.Type {
-	// This case should not be valid for other types as only this is the default
-	case "":
-		conf.Type = d.BarrierType()
-	case d.BarrierType():
+	switch {
+	// Configurations written before seal types existed can only belong to
+	// the default seal
+	case conf.Type == "" && barrierType == "shamir":
+		conf.Type = barrierType
+	case conf.Type == barrierType:
 	default:
-		d.core.logger.Printf("[ERR] core: barrier seal type of %s does not match loaded type of %s", conf.Type, d.BarrierType())
-		return nil, fmt.Errorf("barrier seal type of %s does not match loaded type of %s", conf.Type, d.BarrierType())
+		core.logger.Printf("[ERR] core: barrier seal type of %s does not match loaded type of %s", conf.Type, barrierType)
+		return nil, fmt.Errorf("barrier seal type of %s does not match loaded type of %s", conf.Type, barrierType)
 	}
 
 	// Check for a valid seal configuration
 	if err := conf.Validate(); err != nil {
-		d.core.logger.Printf("[ERR] core: invalid seal configuration: %v", err)
+		core.logger.Printf("[ERR] core: invalid seal configuration: %v", err)
 		return nil, fmt.Errorf("seal validation failed: %v", err)
 	}
 
-	d.config = &conf
-	return d.config.Clone(), nil
+	return &conf, nil
 }
 
-func (d *DefaultSeal) SetBarrierConfig(config *SealConfig) error {
-	if err := d.checkCore(); err != nil {
-		return err
-	}
-
-	config.Type = d.BarrierType()
-
+// writeBarrierConfig stores the barrier seal configuration in plaintext in
+// the physical backend
+func writeBarrierConfig(core *Core, config *SealConfig) error {
 	// Encode the seal configuration
 	buf, err := json.Marshal(config)
 	if err != nil {
@@ -162,36 +218,14 @@ func (d *DefaultSeal) SetBarrierConfig(config *SealConfig) error {
 		Value: buf,
 	}
 
-	if err := d.core.physical.Put(pe); err != nil {
-		d.core.logger.Printf("[ERR] core: failed to write seal configuration: %v", err)
+	if err := core.physical.Put(pe); err != nil {
+		core.logger.Printf("[ERR] core: failed to write seal configuration: %v", err)
 		return fmt.Errorf("failed to write seal configuration: %v", err)
 	}
 
-	d.config = config.Clone()
-
 	return nil
 }
 
-func (d *DefaultSeal) RecoveryType() string {
-	return "unsupported"
-}
-
-func (d *DefaultSeal) RecoveryConfig() (*SealConfig, error) {
-	return nil, fmt.Errorf("recovery not supported")
-}
-
-func (d *DefaultSeal) SetRecoveryConfig(config *SealConfig) error {
-	return fmt.Errorf("recovery not supported")
-}
-
-func (d *DefaultSeal) VerifyRecoveryKey([]byte) error {
-	return fmt.Errorf("recovery not supported")
-}
-
-func (d *DefaultSeal) SetRecoveryKey(key []byte) error {
-	return fmt.Errorf("recovery not supported")
-}
-
 // SealConfig is used to describe the seal configuration
 type SealConfig struct {
 	// The type, for sanity checking
@@ -222,6 +256,10 @@ type SealConfig struct {
 
 	// How many keys to store, for seals that support storage.
 	StoredShares int `json:"stored_shares"`
+
+	// BarrierCipher is the cipher the barrier encrypts with, chosen at
+	// initialization. It is empty for AES-GCM.
+	BarrierCipher string `json:"barrier_cipher,omitempty"`
 }
 
 // Validate is used to sanity check the seal configuration
@@ -247,6 +285,9 @@ func (s *SealConfig) Validate() error {
 	if s.StoredShares > s.SecretShares {
 		return fmt.Errorf("stored keys cannot be larger than shares")
 	}
+	if !ValidBarrierCipher(s.BarrierCipher) {
+		return fmt.Errorf("unsupported barrier cipher %q", s.BarrierCipher)
+	}
 	if len(s.PGPKeys) > 0 && len(s.PGPKeys) != s.SecretShares-s.StoredShares {
 		return fmt.Errorf("count mismatch between number of provided PGP keys and number of shares")
 	}
@@ -273,6 +314,7 @@ func (s *SealConfig) Clone() *SealConfig {
 		Nonce:           s.Nonce,
 		Backup:          s.Backup,
 		StoredShares:    s.StoredShares,
+		BarrierCipher:   s.BarrierCipher,
 	}
 	if len(s.PGPKeys) > 0 {
 		ret.PGPKeys = make([]string, len(s.PGPKeys))
@@ -304,3 +346,16 @@ func (s *SealAccess) RecoveryKeySupported() bool {
 func (s *SealAccess) RecoveryConfig() (*SealConfig, error) {
 	return s.seal.RecoveryConfig()
 }
+
+func (s *SealAccess) BarrierType() string {
+	return s.seal.BarrierType()
+}
+
+// Health returns the health of the external service the seal depends on,
+// or nil if the seal does not depend on one
+func (s *SealAccess) Health() *SealHealth {
+	if hc, ok := s.seal.(sealHealthChecker); ok {
+		return hc.Health()
+	}
+	return nil
+}
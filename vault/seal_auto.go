@@ -0,0 +1,473 @@
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/physical"
+)
+
+const (
+	// sealStoredKeysPath is the path used to store the unseal keys of seals
+	// that support stored keys. The value is encrypted by the seal itself,
+	// so it is stored outside the barrier.
+	sealStoredKeysPath = "core/seal-stored-keys"
+
+	// sealHealthCheckInterval is how long the result of a health check of
+	// an auto seal's key service is reused
+	sealHealthCheckInterval = time.Minute
+)
+
+// sealKeyWrapper encrypts the data keys of an AutoSeal with a key held by
+// an external key management service
+type sealKeyWrapper interface {
+	// KeyID returns the identifier of the key version that Wrap currently
+	// uses
+	KeyID() (string, error)
+
+	// Wrap encrypts a data key, returning the identifier of the key version
+	// that was used
+	Wrap(plaintext []byte) ([]byte, string, error)
+
+	// Unwrap decrypts a data key encrypted by Wrap with the given key
+	// version, which may no longer be the current one
+	Unwrap(ciphertext []byte, keyID string) ([]byte, error)
+}
+
+// autoSealStoredKeys is the format of the entry at sealStoredKeysPath. The
+// unseal keys are encrypted with a random data key, which is in turn
+// encrypted by the key service (envelope encryption).
+type autoSealStoredKeys struct {
+	// KeyID identifies the key version that wrapped the data key
+	KeyID string `json:"key_id"`
+
+	WrappedKey []byte `json:"wrapped_key"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// SealHealth is the result of the last check of the key service of a seal
+type SealHealth struct {
+	Healthy     bool
+	LastChecked time.Time
+	Error       string
+}
+
+// AutoSeal is a seal that protects the master key with an external key
+// management service. The unseal keys are stored in the physical backend,
+// encrypted under a key of the service, which allows Vault to unseal itself
+// on startup. Recovery keys take the place of unseal keys for operations
+// that require a quorum of operators.
+type AutoSeal struct {
+	barrierType string
+	wrapper     sealKeyWrapper
+
+	core *Core
+
+	l      sync.Mutex
+	config *SealConfig
+	keyID  string
+
+	healthLock sync.Mutex
+	health     *SealHealth
+}
+
+func newAutoSeal(barrierType string, wrapper sealKeyWrapper) *AutoSeal {
+	return &AutoSeal{
+		barrierType: barrierType,
+		wrapper:     wrapper,
+	}
+}
+
+func (s *AutoSeal) checkCore() error {
+	if s.core == nil {
+		return fmt.Errorf("seal does not have a core set")
+	}
+	return nil
+}
+
+func (s *AutoSeal) SetCore(core *Core) {
+	s.core = core
+}
+
+// Init verifies that the configured key is usable
+func (s *AutoSeal) Init() error {
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.keyID = ""
+	_, err := s.currentKeyID()
+	return err
+}
+
+// Finalize releases the resources of wrappers that hold a connection open,
+// such as a session with an HSM
+func (s *AutoSeal) Finalize() error {
+	if c, ok := s.wrapper.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+func (s *AutoSeal) BarrierType() string {
+	return s.barrierType
+}
+
+func (s *AutoSeal) StoredKeysSupported() bool {
+	return true
+}
+
+func (s *AutoSeal) RecoveryKeySupported() bool {
+	return true
+}
+
+func (s *AutoSeal) RecoveryType() string {
+	return "shamir"
+}
+
+// currentKeyID returns the identifier of the key version that new data
+// keys are wrapped with. The result is cached; the lock must be held.
+func (s *AutoSeal) currentKeyID() (string, error) {
+	if s.keyID != "" {
+		return s.keyID, nil
+	}
+
+	keyID, err := s.wrapper.KeyID()
+	s.recordHealth(err)
+	if err != nil {
+		return "", err
+	}
+
+	s.keyID = keyID
+	return s.keyID, nil
+}
+
+// Health returns the health of the key service, checking it again if the
+// last result is older than sealHealthCheckInterval
+func (s *AutoSeal) Health() *SealHealth {
+	s.healthLock.Lock()
+	health := s.health
+	s.healthLock.Unlock()
+
+	if health == nil || time.Since(health.LastChecked) > sealHealthCheckInterval {
+		_, err := s.wrapper.KeyID()
+		s.recordHealth(err)
+	}
+
+	s.healthLock.Lock()
+	defer s.healthLock.Unlock()
+	ret := *s.health
+	return &ret
+}
+
+func (s *AutoSeal) recordHealth(err error) {
+	health := &SealHealth{
+		Healthy:     err == nil,
+		LastChecked: time.Now(),
+	}
+	if err != nil {
+		health.Error = err.Error()
+	}
+
+	s.healthLock.Lock()
+	s.health = health
+	s.healthLock.Unlock()
+}
+
+func (s *AutoSeal) SetStoredKeys(keys [][]byte) error {
+	if err := s.checkCore(); err != nil {
+		return err
+	}
+
+	s.l.Lock()
+	defer s.l.Unlock()
+	return s.setStoredKeys(keys)
+}
+
+func (s *AutoSeal) setStoredKeys(keys [][]byte) error {
+	defer metrics.MeasureSince([]string{"seal", s.barrierType, "encrypt"}, time.Now())
+
+	buf, err := json.Marshal(keys)
+	if err != nil {
+		return fmt.Errorf("failed to encode stored keys: %v", err)
+	}
+
+	// Encrypt the keys with a fresh data key
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return fmt.Errorf("failed to generate data key: %v", err)
+	}
+	ciphertext, err := autoSealEncrypt(dataKey, buf)
+	if err != nil {
+		return err
+	}
+
+	// Wrap the data key with the key service
+	wrapped, keyID, err := s.wrapper.Wrap(dataKey)
+	s.recordHealth(err)
+	if err != nil {
+		return fmt.Errorf("error encrypting data key: %v", err)
+	}
+
+	buf, err = json.Marshal(&autoSealStoredKeys{
+		KeyID:      keyID,
+		WrappedKey: wrapped,
+		Ciphertext: ciphertext,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode stored keys: %v", err)
+	}
+
+	pe := &physical.Entry{
+		Key:   sealStoredKeysPath,
+		Value: buf,
+	}
+	if err := s.core.physical.Put(pe); err != nil {
+		s.core.logger.Printf("[ERR] core: failed to write stored keys: %v", err)
+		return fmt.Errorf("failed to write stored keys: %v", err)
+	}
+
+	return nil
+}
+
+func (s *AutoSeal) GetStoredKeys() ([][]byte, error) {
+	if err := s.checkCore(); err != nil {
+		return nil, err
+	}
+
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	pe, err := s.core.physical.Get(sealStoredKeysPath)
+	if err != nil {
+		s.core.logger.Printf("[ERR] core: failed to read stored keys: %v", err)
+		return nil, fmt.Errorf("failed to read stored keys: %v", err)
+	}
+	if pe == nil {
+		return nil, nil
+	}
+
+	var entry autoSealStoredKeys
+	if err := jsonutil.DecodeJSON(pe.Value, &entry); err != nil {
+		return nil, fmt.Errorf("failed to decode stored keys: %v", err)
+	}
+
+	keys, err := s.decryptStoredKeys(&entry)
+	if err != nil {
+		return nil, err
+	}
+
+	// If the key has changed since the keys were stored, wrap them with
+	// the new key. The previous key is only needed until then.
+	current, err := s.currentKeyID()
+	if err != nil {
+		s.core.logger.Printf("[WARN] core: unable to check seal key for rotation: %v", err)
+		return keys, nil
+	}
+	if entry.KeyID != current {
+		s.core.logger.Printf("[INFO] core: seal key changed from %s to %s, re-encrypting stored keys", entry.KeyID, current)
+		if err := s.setStoredKeys(keys); err != nil {
+			s.core.logger.Printf("[ERR] core: failed to re-encrypt stored keys: %v", err)
+		}
+	}
+
+	return keys, nil
+}
+
+func (s *AutoSeal) decryptStoredKeys(entry *autoSealStoredKeys) ([][]byte, error) {
+	defer metrics.MeasureSince([]string{"seal", s.barrierType, "decrypt"}, time.Now())
+
+	dataKey, err := s.wrapper.Unwrap(entry.WrappedKey, entry.KeyID)
+	s.recordHealth(err)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting data key: %v", err)
+	}
+
+	buf, err := autoSealDecrypt(dataKey, entry.Ciphertext)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys [][]byte
+	if err := jsonutil.DecodeJSON(buf, &keys); err != nil {
+		return nil, fmt.Errorf("failed to decode stored keys: %v", err)
+	}
+	return keys, nil
+}
+
+func (s *AutoSeal) BarrierConfig() (*SealConfig, error) {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if s.config != nil {
+		return s.config.Clone(), nil
+	}
+
+	if err := s.checkCore(); err != nil {
+		return nil, err
+	}
+
+	conf, err := readBarrierConfig(s.core, s.BarrierType())
+	if err != nil || conf == nil {
+		return nil, err
+	}
+
+	s.config = conf
+	return s.config.Clone(), nil
+}
+
+func (s *AutoSeal) SetBarrierConfig(config *SealConfig) error {
+	if err := s.checkCore(); err != nil {
+		return err
+	}
+
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	config.Type = s.BarrierType()
+	if err := writeBarrierConfig(s.core, config); err != nil {
+		return err
+	}
+
+	s.config = config.Clone()
+
+	return nil
+}
+
+func (s *AutoSeal) RecoveryConfig() (*SealConfig, error) {
+	if err := s.checkCore(); err != nil {
+		return nil, err
+	}
+
+	entry, err := s.core.barrier.Get(recoverySealConfigPath)
+	if err != nil {
+		s.core.logger.Printf("[ERR] core: failed to read recovery seal configuration: %v", err)
+		return nil, fmt.Errorf("failed to read recovery seal configuration: %v", err)
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	var conf SealConfig
+	if err := jsonutil.DecodeJSON(entry.Value, &conf); err != nil {
+		s.core.logger.Printf("[ERR] core: failed to decode recovery seal configuration: %v", err)
+		return nil, fmt.Errorf("failed to decode recovery seal configuration: %v", err)
+	}
+	if conf.Type != s.RecoveryType() {
+		return nil, fmt.Errorf("recovery seal type of %s does not match expected type of %s", conf.Type, s.RecoveryType())
+	}
+
+	return &conf, nil
+}
+
+func (s *AutoSeal) SetRecoveryConfig(config *SealConfig) error {
+	if err := s.checkCore(); err != nil {
+		return err
+	}
+
+	config.Type = s.RecoveryType()
+	buf, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to encode recovery seal configuration: %v", err)
+	}
+
+	if err := s.core.barrier.Put(&Entry{
+		Key:   recoverySealConfigPath,
+		Value: buf,
+	}); err != nil {
+		s.core.logger.Printf("[ERR] core: failed to write recovery seal configuration: %v", err)
+		return fmt.Errorf("failed to write recovery seal configuration: %v", err)
+	}
+
+	return nil
+}
+
+func (s *AutoSeal) SetRecoveryKey(key []byte) error {
+	if err := s.checkCore(); err != nil {
+		return err
+	}
+
+	if err := s.core.barrier.Put(&Entry{
+		Key:   recoveryKeyPath,
+		Value: key,
+	}); err != nil {
+		s.core.logger.Printf("[ERR] core: failed to write recovery key: %v", err)
+		return fmt.Errorf("failed to write recovery key: %v", err)
+	}
+
+	return nil
+}
+
+func (s *AutoSeal) VerifyRecoveryKey(key []byte) error {
+	if err := s.checkCore(); err != nil {
+		return err
+	}
+
+	entry, err := s.core.barrier.Get(recoveryKeyPath)
+	if err != nil {
+		s.core.logger.Printf("[ERR] core: failed to read recovery key: %v", err)
+		return fmt.Errorf("failed to read recovery key: %v", err)
+	}
+	if entry == nil {
+		return fmt.Errorf("no recovery key found")
+	}
+
+	if subtle.ConstantTimeCompare(entry.Value, key) != 1 {
+		return fmt.Errorf("recovery key verification failed")
+	}
+
+	return nil
+}
+
+// autoSealEncrypt encrypts the plaintext with AES-GCM under the given data
+// key, prefixing the result with the nonce
+func autoSealEncrypt(key, plaintext []byte) ([]byte, error) {
+	gcm, err := autoSealAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %v", err)
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// autoSealDecrypt reverses autoSealEncrypt
+func autoSealDecrypt(key, ciphertext []byte) ([]byte, error) {
+	gcm, err := autoSealAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, fmt.Errorf("stored keys ciphertext is too short")
+	}
+	nonce := ciphertext[:gcm.NonceSize()]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext[gcm.NonceSize():], nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt stored keys: %v", err)
+	}
+	return plaintext, nil
+}
+
+func autoSealAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize GCM mode: %v", err)
+	}
+	return gcm, nil
+}
@@ -0,0 +1,180 @@
+package vault
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/shamir"
+)
+
+// testAutoSeal initializes a core with the given seal and checks that it
+// unseals with its stored keys and recovery keys. rotate changes the key
+// of the service, keeping the previous one usable until retire is called.
+func testAutoSeal(t *testing.T, seal *AutoSeal, rotate, retire func()) {
+	c := TestCoreWithSeal(t, seal)
+
+	// Stored keys require a recovery configuration
+	barrierConf := &SealConfig{
+		SecretShares:    1,
+		SecretThreshold: 1,
+		StoredShares:    1,
+	}
+	if _, err := c.Initialize(barrierConf, nil); err == nil {
+		t.Fatal("expected error")
+	}
+
+	recoveryConf := &SealConfig{
+		SecretShares:    3,
+		SecretThreshold: 2,
+	}
+	res, err := c.Initialize(barrierConf, recoveryConf)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(res.SecretShares) != 0 || len(res.RecoveryShares) != 3 {
+		t.Fatalf("bad: %#v", res)
+	}
+
+	conf, err := seal.BarrierConfig()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if conf.Type != seal.BarrierType() || conf.StoredShares != 1 {
+		t.Fatalf("bad: %#v", conf)
+	}
+
+	// The unseal key must not be stored in plaintext
+	keyID, err := seal.wrapper.KeyID()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	entry := testAutoSealStoredKeys(t, c)
+	if entry.KeyID != keyID || len(entry.Ciphertext) == 0 {
+		t.Fatalf("bad: %#v", entry)
+	}
+
+	// Auto-unseal
+	if err := c.UnsealWithStoredKeys(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if sealed, err := c.Sealed(); err != nil || sealed {
+		t.Fatalf("bad: %v %v", sealed, err)
+	}
+
+	// Recovery keys replace unseal keys for operator quorum
+	rconf, err := seal.RecoveryConfig()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if rconf.Type != "shamir" || rconf.SecretShares != 3 || rconf.SecretThreshold != 2 {
+		t.Fatalf("bad: %#v", rconf)
+	}
+	recoveryKey, err := shamir.Combine(res.RecoveryShares[:2])
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := seal.VerifyRecoveryKey(recoveryKey); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := seal.VerifyRecoveryKey(res.RecoveryShares[0]); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// Rotate the key, as if it had changed across a restart; the stored
+	// keys are wrapped with the new key on the next unseal
+	if err := c.Seal(res.RootToken); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	rotate()
+	seal.keyID = ""
+
+	if err := c.UnsealWithStoredKeys(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	newKeyID, err := seal.wrapper.KeyID()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if newKeyID == keyID {
+		t.Fatalf("key was not rotated: %s", keyID)
+	}
+	if entry := testAutoSealStoredKeys(t, c); entry.KeyID != newKeyID {
+		t.Fatalf("stored keys were not re-encrypted: %#v", entry)
+	}
+
+	// The old key is no longer needed
+	retire()
+	if err := c.Seal(res.RootToken); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := c.UnsealWithStoredKeys(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if sealed, err := c.Sealed(); err != nil || sealed {
+		t.Fatalf("bad: %v %v", sealed, err)
+	}
+}
+
+func testAutoSealStoredKeys(t *testing.T, c *Core) *autoSealStoredKeys {
+	pe, err := c.physical.Get(sealStoredKeysPath)
+	if err != nil || pe == nil {
+		t.Fatalf("bad: %v %v", pe, err)
+	}
+	var entry autoSealStoredKeys
+	if err := jsonutil.DecodeJSON(pe.Value, &entry); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	return &entry
+}
+
+// fakeSealKeyWrapper fails KeyID calls while err is set
+type fakeSealKeyWrapper struct {
+	err   error
+	calls int
+}
+
+func (w *fakeSealKeyWrapper) KeyID() (string, error) {
+	w.calls++
+	return "key", w.err
+}
+
+func (w *fakeSealKeyWrapper) Wrap(plaintext []byte) ([]byte, string, error) {
+	return plaintext, "key", w.err
+}
+
+func (w *fakeSealKeyWrapper) Unwrap(ciphertext []byte, keyID string) ([]byte, error) {
+	return ciphertext, w.err
+}
+
+func TestAutoSeal_Health(t *testing.T) {
+	wrapper := &fakeSealKeyWrapper{}
+	seal := newAutoSeal("fake", wrapper)
+
+	health := seal.Health()
+	if !health.Healthy || health.Error != "" || health.LastChecked.IsZero() {
+		t.Fatalf("bad: %#v", health)
+	}
+
+	// Results are reused within the check interval
+	wrapper.err = fmt.Errorf("service unavailable")
+	if health := seal.Health(); !health.Healthy || wrapper.calls != 1 {
+		t.Fatalf("bad: %#v %d", health, wrapper.calls)
+	}
+
+	// Failures of other calls are recorded
+	if err := seal.Init(); err == nil {
+		t.Fatal("expected error")
+	}
+	health = seal.Health()
+	if health.Healthy || health.Error != "service unavailable" {
+		t.Fatalf("bad: %#v", health)
+	}
+
+	// Stale results are checked again
+	seal.health.LastChecked = seal.health.LastChecked.Add(-2 * sealHealthCheckInterval)
+	wrapper.err = nil
+	if health := seal.Health(); !health.Healthy {
+		t.Fatalf("bad: %#v", health)
+	}
+}
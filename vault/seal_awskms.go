@@ -0,0 +1,134 @@
+package vault
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/hashicorp/vault/helper/awsutil"
+)
+
+const (
+	// awsKMSEncryptionContextKey and awsKMSEncryptionContextValue form the
+	// encryption context bound to every data key wrapped by KMS, so that a
+	// wrapped key cannot be decrypted for any other purpose
+	awsKMSEncryptionContextKey   = "vault"
+	awsKMSEncryptionContextValue = "seal-stored-keys"
+)
+
+// awsKMSClient is the subset of the KMS API used by the seal. It is an
+// interface so that tests can substitute a fake service.
+type awsKMSClient interface {
+	Encrypt(*awsutil.KMSEncryptInput) (*awsutil.KMSEncryptOutput, error)
+	Decrypt(*awsutil.KMSDecryptInput) (*awsutil.KMSDecryptOutput, error)
+	DescribeKey(*awsutil.KMSDescribeKeyInput) (*awsutil.KMSDescribeKeyOutput, error)
+}
+
+// awsKMSWrapper wraps data keys with an AWS KMS customer master key. Keys
+// are identified by their ARN.
+type awsKMSWrapper struct {
+	client awsKMSClient
+	keyID  string
+}
+
+// NewAWSKMSSeal creates a seal from the server configuration of a seal
+// block of type "awskms". Credentials can be provided in the configuration,
+// sourced from the environment, AWS credential files or by IAM role.
+func NewAWSKMSSeal(conf map[string]string) (*AutoSeal, error) {
+	keyID := os.Getenv("VAULT_AWSKMS_SEAL_KEY_ID")
+	if keyID == "" {
+		keyID = conf["kms_key_id"]
+		if keyID == "" {
+			return nil, fmt.Errorf("'kms_key_id' must be set")
+		}
+	}
+
+	endpoint := os.Getenv("AWS_KMS_ENDPOINT")
+	if endpoint == "" {
+		endpoint = conf["endpoint"]
+	}
+	region := os.Getenv("AWS_DEFAULT_REGION")
+	if region == "" {
+		region = conf["region"]
+		if region == "" {
+			region = "us-east-1"
+		}
+	}
+
+	credsConfig := &awsutil.CredentialsConfig{
+		AccessKey:    conf["access_key"],
+		SecretKey:    conf["secret_key"],
+		SessionToken: conf["session_token"],
+	}
+	creds, err := credsConfig.GenerateCredentialChain()
+	if err != nil {
+		return nil, err
+	}
+
+	client := awsutil.NewKMS(session.New(&aws.Config{
+		Credentials: creds,
+		Endpoint:    aws.String(endpoint),
+		Region:      aws.String(region),
+	}))
+
+	return newAutoSeal("awskms", &awsKMSWrapper{
+		client: client,
+		keyID:  keyID,
+	}), nil
+}
+
+func (w *awsKMSWrapper) encryptionContext() map[string]*string {
+	return map[string]*string{
+		awsKMSEncryptionContextKey: aws.String(awsKMSEncryptionContextValue),
+	}
+}
+
+// KeyID resolves the configured key ID, which may be an alias, to the ARN
+// of the customer master key
+func (w *awsKMSWrapper) KeyID() (string, error) {
+	out, err := w.client.DescribeKey(&awsutil.KMSDescribeKeyInput{
+		KeyId: aws.String(w.keyID),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error describing KMS key %s: %v", w.keyID, err)
+	}
+	if out.KeyMetadata == nil || out.KeyMetadata.Arn == nil {
+		return "", fmt.Errorf("no metadata returned for KMS key %s", w.keyID)
+	}
+	if out.KeyMetadata.Enabled != nil && !*out.KeyMetadata.Enabled {
+		return "", fmt.Errorf("KMS key %s is not enabled", w.keyID)
+	}
+	return *out.KeyMetadata.Arn, nil
+}
+
+func (w *awsKMSWrapper) Wrap(plaintext []byte) ([]byte, string, error) {
+	out, err := w.client.Encrypt(&awsutil.KMSEncryptInput{
+		KeyId:             aws.String(w.keyID),
+		Plaintext:         plaintext,
+		EncryptionContext: w.encryptionContext(),
+	})
+	if err != nil {
+		return nil, "", fmt.Errorf("error encrypting with KMS: %v", err)
+	}
+
+	var keyID string
+	if out.KeyId != nil {
+		keyID = *out.KeyId
+	}
+	return out.CiphertextBlob, keyID, nil
+}
+
+// Unwrap decrypts with KMS. The customer master key is identified by the
+// ciphertext itself, so this works even if the configured key has since
+// changed.
+func (w *awsKMSWrapper) Unwrap(ciphertext []byte, keyID string) ([]byte, error) {
+	out, err := w.client.Decrypt(&awsutil.KMSDecryptInput{
+		CiphertextBlob:    ciphertext,
+		EncryptionContext: w.encryptionContext(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting with KMS: %v", err)
+	}
+	return out.Plaintext, nil
+}
@@ -0,0 +1,111 @@
+package vault
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/hashicorp/vault/helper/awsutil"
+)
+
+// fakeKMS is an in-memory stand-in for the KMS API. Ciphertext blobs are
+// opaque handles to plaintexts it remembers.
+type fakeKMS struct {
+	// keys maps key IDs and aliases to key ARNs
+	keys map[string]string
+
+	blobs map[string]fakeKMSBlob
+}
+
+type fakeKMSBlob struct {
+	arn       string
+	plaintext []byte
+	context   map[string]*string
+}
+
+func newFakeKMS() *fakeKMS {
+	return &fakeKMS{
+		keys:  make(map[string]string),
+		blobs: make(map[string]fakeKMSBlob),
+	}
+}
+
+func (f *fakeKMS) Encrypt(input *awsutil.KMSEncryptInput) (*awsutil.KMSEncryptOutput, error) {
+	arn, ok := f.keys[*input.KeyId]
+	if !ok {
+		return nil, fmt.Errorf("key %s not found", *input.KeyId)
+	}
+	handle := fmt.Sprintf("blob-%d", len(f.blobs))
+	f.blobs[handle] = fakeKMSBlob{
+		arn:       arn,
+		plaintext: input.Plaintext,
+		context:   input.EncryptionContext,
+	}
+	return &awsutil.KMSEncryptOutput{
+		CiphertextBlob: []byte(handle),
+		KeyId:          aws.String(arn),
+	}, nil
+}
+
+func (f *fakeKMS) Decrypt(input *awsutil.KMSDecryptInput) (*awsutil.KMSDecryptOutput, error) {
+	blob, ok := f.blobs[string(input.CiphertextBlob)]
+	if !ok {
+		return nil, fmt.Errorf("invalid ciphertext")
+	}
+	if !reflect.DeepEqual(blob.context, input.EncryptionContext) {
+		return nil, fmt.Errorf("encryption context mismatch")
+	}
+	var found bool
+	for _, arn := range f.keys {
+		found = found || arn == blob.arn
+	}
+	if !found {
+		return nil, fmt.Errorf("key %s has been deleted", blob.arn)
+	}
+	return &awsutil.KMSDecryptOutput{
+		Plaintext: blob.plaintext,
+		KeyId:     aws.String(blob.arn),
+	}, nil
+}
+
+func (f *fakeKMS) DescribeKey(input *awsutil.KMSDescribeKeyInput) (*awsutil.KMSDescribeKeyOutput, error) {
+	arn, ok := f.keys[*input.KeyId]
+	if !ok {
+		return nil, fmt.Errorf("key %s not found", *input.KeyId)
+	}
+	return &awsutil.KMSDescribeKeyOutput{
+		KeyMetadata: &awsutil.KMSKeyMetadata{
+			Arn:     aws.String(arn),
+			Enabled: aws.Bool(true),
+		},
+	}, nil
+}
+
+func TestAWSKMSSeal(t *testing.T) {
+	kms := newFakeKMS()
+	kms.keys["alias/vault"] = "arn:aws:kms:us-east-1:123456789012:key/one"
+	seal := newAutoSeal("awskms", &awsKMSWrapper{client: kms, keyID: "alias/vault"})
+
+	testAutoSeal(t, seal, func() {
+		// Point the alias at a new key, keeping the old one available
+		kms.keys["alias/vault"] = "arn:aws:kms:us-east-1:123456789012:key/two"
+		kms.keys["old"] = "arn:aws:kms:us-east-1:123456789012:key/one"
+	}, func() {
+		delete(kms.keys, "old")
+	})
+}
+
+func TestAWSKMSSeal_BarrierConfigType(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+
+	kms := newFakeKMS()
+	kms.keys["alias/vault"] = "arn:aws:kms:us-east-1:123456789012:key/one"
+	seal := newAutoSeal("awskms", &awsKMSWrapper{client: kms, keyID: "alias/vault"})
+	seal.SetCore(c)
+
+	// A Vault initialized with the default seal cannot be opened by KMS
+	if _, err := seal.BarrierConfig(); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,130 @@
+package vault
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/hashicorp/vault/helper/azureutil"
+)
+
+// azureKeyVaultNameRegex matches valid names of vaults and keys
+var azureKeyVaultNameRegex = regexp.MustCompile("^[0-9a-zA-Z-]+$")
+
+// azureKeyVaultClient is the subset of the Key Vault API used by the seal.
+// It is an interface so that tests can substitute a fake service.
+type azureKeyVaultClient interface {
+	CurrentKeyID(name string) (string, error)
+	WrapKey(kid string, value []byte) ([]byte, string, error)
+	UnwrapKey(kid string, value []byte) ([]byte, error)
+}
+
+// azureKeyVaultWrapper wraps data keys with an Azure Key Vault key. Keys
+// are identified by their key identifier, which includes the version.
+type azureKeyVaultWrapper struct {
+	client  azureKeyVaultClient
+	keyName string
+}
+
+// NewAzureKeyVaultSeal creates a seal from the server configuration of a
+// seal block of type "azurekeyvault". Credentials are those of a service
+// principal, or the managed identity of the virtual machine.
+func NewAzureKeyVaultSeal(conf map[string]string) (*AutoSeal, error) {
+	vaultName := os.Getenv("VAULT_AZUREKEYVAULT_VAULT_NAME")
+	if vaultName == "" {
+		vaultName = conf["vault_name"]
+		if vaultName == "" {
+			return nil, fmt.Errorf("'vault_name' must be set")
+		}
+	}
+	if !azureKeyVaultNameRegex.MatchString(vaultName) {
+		return nil, fmt.Errorf("invalid vault name %q", vaultName)
+	}
+
+	keyName := os.Getenv("VAULT_AZUREKEYVAULT_KEY_NAME")
+	if keyName == "" {
+		keyName = conf["key_name"]
+		if keyName == "" {
+			return nil, fmt.Errorf("'key_name' must be set")
+		}
+	}
+	if !azureKeyVaultNameRegex.MatchString(keyName) {
+		return nil, fmt.Errorf("invalid key name %q", keyName)
+	}
+
+	envName := os.Getenv("AZURE_ENVIRONMENT")
+	if envName == "" {
+		envName = conf["environment"]
+	}
+	env, err := azureutil.EnvironmentFromName(envName)
+	if err != nil {
+		return nil, err
+	}
+
+	tenantID := os.Getenv("AZURE_TENANT_ID")
+	if tenantID == "" {
+		tenantID = conf["tenant_id"]
+	}
+	clientID := os.Getenv("AZURE_CLIENT_ID")
+	if clientID == "" {
+		clientID = conf["client_id"]
+	}
+	clientSecret := os.Getenv("AZURE_CLIENT_SECRET")
+	if clientSecret == "" {
+		clientSecret = conf["client_secret"]
+	}
+
+	credsConfig := &azureutil.CredentialsConfig{
+		Environment:  env,
+		TenantID:     tenantID,
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Resource:     env.KeyVaultResource,
+	}
+	src, err := credsConfig.TokenSource()
+	if err != nil {
+		return nil, err
+	}
+
+	vaultURL := fmt.Sprintf("https://%s.%s", vaultName, env.KeyVaultDNSSuffix)
+	return newAutoSeal("azurekeyvault", &azureKeyVaultWrapper{
+		client:  azureutil.NewKeyVault(vaultURL, src),
+		keyName: keyName,
+	}), nil
+}
+
+// KeyID returns the identifier of the current version of the key
+func (w *azureKeyVaultWrapper) KeyID() (string, error) {
+	kid, err := w.client.CurrentKeyID(w.keyName)
+	if err != nil {
+		return "", fmt.Errorf("error getting key %s: %v", w.keyName, err)
+	}
+	return kid, nil
+}
+
+func (w *azureKeyVaultWrapper) Wrap(plaintext []byte) ([]byte, string, error) {
+	kid, err := w.KeyID()
+	if err != nil {
+		return nil, "", err
+	}
+
+	wrapped, kid, err := w.client.WrapKey(kid, plaintext)
+	if err != nil {
+		return nil, "", fmt.Errorf("error wrapping key with Key Vault: %v", err)
+	}
+	return wrapped, kid, nil
+}
+
+// Unwrap decrypts with the key version that wrapped the data key, which
+// must still be enabled
+func (w *azureKeyVaultWrapper) Unwrap(ciphertext []byte, keyID string) ([]byte, error) {
+	if keyID == "" {
+		return nil, fmt.Errorf("no key identifier stored with the wrapped key")
+	}
+
+	plaintext, err := w.client.UnwrapKey(keyID, ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("error unwrapping key with Key Vault: %v", err)
+	}
+	return plaintext, nil
+}
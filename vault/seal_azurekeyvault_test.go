@@ -0,0 +1,101 @@
+package vault
+
+import (
+	"fmt"
+	"testing"
+)
+
+// fakeKeyVault is an in-memory stand-in for the Key Vault API. Wrapped keys
+// are opaque handles to keys it remembers.
+type fakeKeyVault struct {
+	// current maps key names to the identifier of their current version
+	current map[string]string
+
+	// disabled holds versions that can no longer unwrap
+	disabled map[string]bool
+
+	blobs map[string]fakeKeyVaultBlob
+}
+
+type fakeKeyVaultBlob struct {
+	kid   string
+	value []byte
+}
+
+func (f *fakeKeyVault) CurrentKeyID(name string) (string, error) {
+	kid, ok := f.current[name]
+	if !ok {
+		return "", fmt.Errorf("key %s not found", name)
+	}
+	return kid, nil
+}
+
+func (f *fakeKeyVault) WrapKey(kid string, value []byte) ([]byte, string, error) {
+	if f.disabled[kid] {
+		return nil, "", fmt.Errorf("key %s is disabled", kid)
+	}
+	handle := fmt.Sprintf("blob-%d", len(f.blobs))
+	f.blobs[handle] = fakeKeyVaultBlob{
+		kid:   kid,
+		value: value,
+	}
+	return []byte(handle), kid, nil
+}
+
+func (f *fakeKeyVault) UnwrapKey(kid string, value []byte) ([]byte, error) {
+	blob, ok := f.blobs[string(value)]
+	if !ok || blob.kid != kid {
+		return nil, fmt.Errorf("invalid wrapped key")
+	}
+	if f.disabled[kid] {
+		return nil, fmt.Errorf("key %s is disabled", kid)
+	}
+	return blob.value, nil
+}
+
+func TestAzureKeyVaultSeal(t *testing.T) {
+	kid := "https://example.vault.azure.net/keys/unseal/"
+	kv := &fakeKeyVault{
+		current: map[string]string{
+			"unseal": kid + "one",
+		},
+		disabled: make(map[string]bool),
+		blobs:    make(map[string]fakeKeyVaultBlob),
+	}
+	seal := newAutoSeal("azurekeyvault", &azureKeyVaultWrapper{client: kv, keyName: "unseal"})
+
+	testAutoSeal(t, seal, func() {
+		kv.current["unseal"] = kid + "two"
+	}, func() {
+		kv.disabled[kid+"one"] = true
+	})
+}
+
+func TestNewAzureKeyVaultSeal_config(t *testing.T) {
+	bad := []map[string]string{
+		{"key_name": "unseal"},
+		{"vault_name": "example"},
+		{"vault_name": "example.evil.com/", "key_name": "unseal"},
+		{"vault_name": "example", "key_name": "unseal", "environment": "AzureMoonCloud"},
+		{"vault_name": "example", "key_name": "unseal", "client_secret": "secret"},
+	}
+	for _, conf := range bad {
+		if _, err := NewAzureKeyVaultSeal(conf); err == nil {
+			t.Fatalf("expected error for %#v", conf)
+		}
+	}
+
+	seal, err := NewAzureKeyVaultSeal(map[string]string{
+		"vault_name":    "example",
+		"key_name":      "unseal",
+		"tenant_id":     "tenant",
+		"client_id":     "client",
+		"client_secret": "secret",
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if seal.BarrierType() != "azurekeyvault" {
+		t.Fatalf("bad: %s", seal.BarrierType())
+	}
+}
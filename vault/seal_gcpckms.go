@@ -0,0 +1,123 @@
+package vault
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hashicorp/vault/helper/gcputil"
+)
+
+// gcpCKMSAdditionalData is the additional authenticated data bound to every
+// data key wrapped by Cloud KMS, so that a wrapped key cannot be decrypted
+// for any other purpose
+var gcpCKMSAdditionalData = []byte("vault/seal-stored-keys")
+
+// gcpCKMSClient is the subset of the Cloud KMS API used by the seal. It is
+// an interface so that tests can substitute a fake service.
+type gcpCKMSClient interface {
+	Encrypt(name string, plaintext, aad []byte) ([]byte, string, error)
+	Decrypt(name string, ciphertext, aad []byte) ([]byte, error)
+	PrimaryVersion(name string) (string, error)
+}
+
+// gcpCKMSWrapper wraps data keys with a Google Cloud KMS crypto key. Keys
+// are identified by the name of the crypto key version.
+type gcpCKMSWrapper struct {
+	client    gcpCKMSClient
+	cryptoKey string
+}
+
+// NewGCPCKMSSeal creates a seal from the server configuration of a seal
+// block of type "gcpckms". Credentials are read from a service account key
+// file, or are those of the Compute Engine instance.
+func NewGCPCKMSSeal(conf map[string]string) (*AutoSeal, error) {
+	credentials := os.Getenv("GOOGLE_CREDENTIALS")
+	if credentials == "" {
+		credentials = conf["credentials"]
+	}
+
+	project := os.Getenv("GOOGLE_PROJECT")
+	if project == "" {
+		project = conf["project"]
+	}
+	if project == "" && credentials != "" {
+		key, err := gcputil.ReadServiceAccountKey(credentials)
+		if err != nil {
+			return nil, err
+		}
+		project = key.ProjectID
+	}
+	if project == "" {
+		return nil, fmt.Errorf("'project' must be set")
+	}
+
+	region := os.Getenv("GOOGLE_REGION")
+	if region == "" {
+		region = conf["region"]
+		if region == "" {
+			region = "global"
+		}
+	}
+
+	keyRing := os.Getenv("VAULT_GCPCKMS_SEAL_KEY_RING")
+	if keyRing == "" {
+		keyRing = conf["key_ring"]
+		if keyRing == "" {
+			return nil, fmt.Errorf("'key_ring' must be set")
+		}
+	}
+
+	cryptoKey := os.Getenv("VAULT_GCPCKMS_SEAL_CRYPTO_KEY")
+	if cryptoKey == "" {
+		cryptoKey = conf["crypto_key"]
+		if cryptoKey == "" {
+			return nil, fmt.Errorf("'crypto_key' must be set")
+		}
+	}
+
+	credsConfig := &gcputil.CredentialsConfig{
+		CredentialsFile: credentials,
+		Scopes:          []string{gcputil.CloudKMSScope},
+	}
+	src, err := credsConfig.TokenSource()
+	if err != nil {
+		return nil, err
+	}
+
+	return newAutoSeal("gcpckms", &gcpCKMSWrapper{
+		client:    gcputil.NewCloudKMS(conf["endpoint"], src),
+		cryptoKey: gcputil.CryptoKeyName(project, region, keyRing, cryptoKey),
+	}), nil
+}
+
+// KeyID returns the name of the primary version of the crypto key
+func (w *gcpCKMSWrapper) KeyID() (string, error) {
+	version, err := w.client.PrimaryVersion(w.cryptoKey)
+	if err != nil {
+		return "", fmt.Errorf("error getting crypto key %s: %v", w.cryptoKey, err)
+	}
+	return version, nil
+}
+
+func (w *gcpCKMSWrapper) Wrap(plaintext []byte) ([]byte, string, error) {
+	ciphertext, version, err := w.client.Encrypt(w.cryptoKey, plaintext, gcpCKMSAdditionalData)
+	if err != nil {
+		return nil, "", fmt.Errorf("error encrypting with Cloud KMS: %v", err)
+	}
+	return ciphertext, version, nil
+}
+
+// Unwrap decrypts with the crypto key of the given version. The version is
+// identified by the ciphertext itself.
+func (w *gcpCKMSWrapper) Unwrap(ciphertext []byte, keyID string) ([]byte, error) {
+	cryptoKey := w.cryptoKey
+	if keyID != "" {
+		cryptoKey = gcputil.CryptoKeyFromVersion(keyID)
+	}
+
+	plaintext, err := w.client.Decrypt(cryptoKey, ciphertext, gcpCKMSAdditionalData)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting with Cloud KMS: %v", err)
+	}
+	return plaintext, nil
+}
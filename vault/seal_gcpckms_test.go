@@ -0,0 +1,81 @@
+package vault
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/gcputil"
+)
+
+// fakeCloudKMS is an in-memory stand-in for the Cloud KMS API. Ciphertexts
+// are opaque handles to plaintexts it remembers.
+type fakeCloudKMS struct {
+	// primary maps crypto keys to the name of their primary version
+	primary map[string]string
+
+	// disabled holds versions that can no longer decrypt
+	disabled map[string]bool
+
+	blobs map[string]fakeCloudKMSBlob
+}
+
+type fakeCloudKMSBlob struct {
+	version   string
+	plaintext []byte
+	aad       []byte
+}
+
+func (f *fakeCloudKMS) Encrypt(name string, plaintext, aad []byte) ([]byte, string, error) {
+	version, ok := f.primary[name]
+	if !ok {
+		return nil, "", fmt.Errorf("crypto key %s not found", name)
+	}
+	handle := fmt.Sprintf("blob-%d", len(f.blobs))
+	f.blobs[handle] = fakeCloudKMSBlob{
+		version:   version,
+		plaintext: plaintext,
+		aad:       aad,
+	}
+	return []byte(handle), version, nil
+}
+
+func (f *fakeCloudKMS) Decrypt(name string, ciphertext, aad []byte) ([]byte, error) {
+	blob, ok := f.blobs[string(ciphertext)]
+	if !ok || gcputil.CryptoKeyFromVersion(blob.version) != name {
+		return nil, fmt.Errorf("invalid ciphertext")
+	}
+	if !bytes.Equal(blob.aad, aad) {
+		return nil, fmt.Errorf("additional authenticated data mismatch")
+	}
+	if f.disabled[blob.version] {
+		return nil, fmt.Errorf("crypto key version %s is disabled", blob.version)
+	}
+	return blob.plaintext, nil
+}
+
+func (f *fakeCloudKMS) PrimaryVersion(name string) (string, error) {
+	version, ok := f.primary[name]
+	if !ok {
+		return "", fmt.Errorf("crypto key %s not found", name)
+	}
+	return version, nil
+}
+
+func TestGCPCKMSSeal(t *testing.T) {
+	cryptoKey := gcputil.CryptoKeyName("project", "global", "vault", "unseal")
+	kms := &fakeCloudKMS{
+		primary: map[string]string{
+			cryptoKey: cryptoKey + "/cryptoKeyVersions/1",
+		},
+		disabled: make(map[string]bool),
+		blobs:    make(map[string]fakeCloudKMSBlob),
+	}
+	seal := newAutoSeal("gcpckms", &gcpCKMSWrapper{client: kms, cryptoKey: cryptoKey})
+
+	testAutoSeal(t, seal, func() {
+		kms.primary[cryptoKey] = cryptoKey + "/cryptoKeyVersions/2"
+	}, func() {
+		kms.disabled[cryptoKey+"/cryptoKeyVersions/1"] = true
+	})
+}
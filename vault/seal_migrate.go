@@ -0,0 +1,373 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/pgpkeys"
+	"github.com/hashicorp/vault/shamir"
+)
+
+// sealMigrationConfig is the configuration of a seal migration in progress
+type sealMigrationConfig struct {
+	Nonce          string
+	BarrierConfig  *SealConfig
+	RecoveryConfig *SealConfig
+}
+
+// SealMigrationStatus describes the seal migration in progress, if any
+type SealMigrationStatus struct {
+	// Started is false if no migration is in progress, in which case only
+	// the type and threshold fields are set
+	Started bool
+	Nonce   string
+
+	// Type is the barrier type of the seal being migrated to
+	Type string
+
+	// BarrierConfig and RecoveryConfig are the configurations that the
+	// barrier will have after the migration
+	BarrierConfig  *SealConfig
+	RecoveryConfig *SealConfig
+
+	// Progress is the number of shares provided so far, out of Required.
+	// RecoveryKeys is true if the shares are recovery keys rather than
+	// unseal keys.
+	Progress     int
+	Required     int
+	RecoveryKeys bool
+}
+
+// SealMigrationResult is returned once a seal migration completes, with the
+// new unseal keys that are not stored by the new seal, and the new recovery
+// keys if the new seal supports them
+type SealMigrationResult struct {
+	Type           string
+	SecretShares   [][]byte
+	RecoveryShares [][]byte
+}
+
+// SealMigrationStatus returns the status of the seal migration
+func (c *Core) SealMigrationStatus() (*SealMigrationStatus, error) {
+	c.stateLock.RLock()
+	defer c.stateLock.RUnlock()
+	if c.sealed {
+		return nil, ErrSealed
+	}
+	if c.standby {
+		return nil, ErrStandby
+	}
+	if c.migrationSeal == nil {
+		return nil, fmt.Errorf("no seal to migrate to is configured")
+	}
+
+	c.migrationLock.Lock()
+	defer c.migrationLock.Unlock()
+
+	required, err := c.sealMigrationThreshold()
+	if err != nil {
+		return nil, err
+	}
+
+	status := &SealMigrationStatus{
+		Type:         c.migrationSeal.BarrierType(),
+		Progress:     len(c.migrationProgress),
+		Required:     required,
+		RecoveryKeys: c.seal.RecoveryKeySupported(),
+	}
+	if c.migrationConfig != nil {
+		status.Started = true
+		status.Nonce = c.migrationConfig.Nonce
+		status.BarrierConfig = c.migrationConfig.BarrierConfig.Clone()
+		if c.migrationConfig.RecoveryConfig != nil {
+			status.RecoveryConfig = c.migrationConfig.RecoveryConfig.Clone()
+		}
+	}
+	return status, nil
+}
+
+// sealMigrationThreshold returns the number of shares of the current seal
+// that authorize a migration
+func (c *Core) sealMigrationThreshold() (int, error) {
+	var config *SealConfig
+	var err error
+	if c.seal.RecoveryKeySupported() {
+		config, err = c.seal.RecoveryConfig()
+	} else {
+		config, err = c.seal.BarrierConfig()
+	}
+	if err != nil {
+		return 0, err
+	}
+	if config == nil {
+		return 0, ErrNotInit
+	}
+	return config.SecretThreshold, nil
+}
+
+// SealMigrationInit starts migrating the barrier to the configured
+// migration seal. The barrier config is that of the new seal, and the
+// recovery config is required if the new seal supports recovery keys.
+func (c *Core) SealMigrationInit(barrierConfig, recoveryConfig *SealConfig) error {
+	c.stateLock.RLock()
+	defer c.stateLock.RUnlock()
+	if c.sealed {
+		return ErrSealed
+	}
+	if c.standby {
+		return ErrStandby
+	}
+
+	target := c.migrationSeal
+	if target == nil {
+		return fmt.Errorf("no seal to migrate to is configured")
+	}
+
+	if barrierConfig.StoredShares > 0 {
+		if !target.StoredKeysSupported() {
+			return fmt.Errorf("storing keys not supported by the %s seal", target.BarrierType())
+		}
+		if len(barrierConfig.PGPKeys) > 0 {
+			return fmt.Errorf("PGP key encryption not supported when using stored keys")
+		}
+	}
+	if barrierConfig.Backup {
+		return fmt.Errorf("key backup not supported when migrating seals")
+	}
+	if err := barrierConfig.Validate(); err != nil {
+		c.logger.Printf("[ERR] core: invalid seal migration configuration: %v", err)
+		return fmt.Errorf("invalid seal migration configuration: %v", err)
+	}
+
+	if target.RecoveryKeySupported() {
+		if recoveryConfig == nil {
+			return fmt.Errorf("recovery configuration must be supplied")
+		}
+		if recoveryConfig.StoredShares > 0 {
+			return fmt.Errorf("stored shares not supported by recovery key")
+		}
+		if err := recoveryConfig.Validate(); err != nil {
+			c.logger.Printf("[ERR] core: invalid recovery configuration: %v", err)
+			return fmt.Errorf("invalid recovery configuration: %v", err)
+		}
+	} else {
+		recoveryConfig = nil
+	}
+
+	c.migrationLock.Lock()
+	defer c.migrationLock.Unlock()
+
+	// Prevent concurrent migrations
+	if c.migrationConfig != nil {
+		return fmt.Errorf("seal migration already in progress")
+	}
+
+	nonce, err := uuid.GenerateUUID()
+	if err != nil {
+		return err
+	}
+
+	c.migrationConfig = &sealMigrationConfig{
+		Nonce:         nonce,
+		BarrierConfig: barrierConfig.Clone(),
+	}
+	if recoveryConfig != nil {
+		c.migrationConfig.RecoveryConfig = recoveryConfig.Clone()
+	}
+
+	c.logger.Printf("[INFO] core: seal migration to %s initialized (nonce: %s, shares: %d, threshold: %d)",
+		target.BarrierType(), nonce, barrierConfig.SecretShares, barrierConfig.SecretThreshold)
+	return nil
+}
+
+// SealMigrationCancel cancels the seal migration in progress
+func (c *Core) SealMigrationCancel() error {
+	c.stateLock.RLock()
+	defer c.stateLock.RUnlock()
+	if c.sealed {
+		return ErrSealed
+	}
+	if c.standby {
+		return ErrStandby
+	}
+
+	c.migrationLock.Lock()
+	defer c.migrationLock.Unlock()
+
+	c.migrationConfig = nil
+	c.migrationProgress = nil
+	return nil
+}
+
+// SealMigrationUpdate provides a share of the unseal key of the current
+// seal, or of its recovery key if it supports recovery keys. Once enough
+// shares are provided, a new master key is generated and split according
+// to the new configuration, the shares to store are stored by the new
+// seal, and the keyring is re-encrypted with the new master key. The Vault
+// stays unsealed throughout, and the new seal replaces the current one.
+func (c *Core) SealMigrationUpdate(key []byte, nonce string) (*SealMigrationResult, error) {
+	// The seal is swapped once the migration completes, so no other
+	// operation may use it meanwhile
+	c.stateLock.Lock()
+	defer c.stateLock.Unlock()
+	if c.sealed {
+		return nil, ErrSealed
+	}
+	if c.standby {
+		return nil, ErrStandby
+	}
+
+	// Verify the key length
+	min, max := c.barrier.KeyLength()
+	max += shamir.ShareOverhead
+	if len(key) < min {
+		return nil, &ErrInvalidKey{fmt.Sprintf("key is shorter than minimum %d bytes", min)}
+	}
+	if len(key) > max {
+		return nil, &ErrInvalidKey{fmt.Sprintf("key is longer than maximum %d bytes", max)}
+	}
+
+	c.migrationLock.Lock()
+	defer c.migrationLock.Unlock()
+
+	// Ensure a migration is in progress
+	if c.migrationConfig == nil {
+		return nil, fmt.Errorf("no seal migration in progress")
+	}
+	if nonce != c.migrationConfig.Nonce {
+		return nil, fmt.Errorf("incorrect nonce supplied; nonce for this seal migration is %s", c.migrationConfig.Nonce)
+	}
+
+	threshold, err := c.sealMigrationThreshold()
+	if err != nil {
+		return nil, err
+	}
+
+	// Check if we already have this piece
+	for _, existing := range c.migrationProgress {
+		if bytes.Equal(existing, key) {
+			return nil, nil
+		}
+	}
+	c.migrationProgress = append(c.migrationProgress, key)
+
+	// Check if we don't have enough keys to unlock
+	if len(c.migrationProgress) < threshold {
+		c.logger.Printf("[DEBUG] core: cannot migrate seal, have %d of %d keys",
+			len(c.migrationProgress), threshold)
+		return nil, nil
+	}
+
+	// Recover the key
+	var combined []byte
+	if threshold == 1 {
+		combined = c.migrationProgress[0]
+	} else {
+		combined, err = shamir.Combine(c.migrationProgress)
+	}
+	c.migrationProgress = nil
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute key: %v", err)
+	}
+
+	if c.seal.RecoveryKeySupported() {
+		err = c.seal.VerifyRecoveryKey(combined)
+	} else {
+		err = c.barrier.VerifyMaster(combined)
+	}
+	if err != nil {
+		c.logger.Printf("[ERR] core: seal migration aborted, key verification failed: %v", err)
+		return nil, err
+	}
+
+	return c.migrateSeal()
+}
+
+// migrateSeal performs the migration once it has been authorized. The
+// state and migration locks must be held.
+func (c *Core) migrateSeal() (*SealMigrationResult, error) {
+	target := c.migrationSeal
+	barrierConfig := c.migrationConfig.BarrierConfig
+	recoveryConfig := c.migrationConfig.RecoveryConfig
+
+	if err := target.Init(); err != nil {
+		c.logger.Printf("[ERR] core: failed to initialize seal: %v", err)
+		return nil, fmt.Errorf("error initializing seal: %v", err)
+	}
+
+	// The PGP keys apply to the shares that are returned, so the shares to
+	// store are split off first. Storing keys with PGP keys is refused when
+	// the migration is initialized.
+	pgpKeys := barrierConfig.PGPKeys
+	splitConfig := barrierConfig.Clone()
+	splitConfig.PGPKeys = nil
+	masterKey, unsealKeys, err := c.generateShares(splitConfig)
+	if err != nil {
+		c.logger.Printf("[ERR] core: %v", err)
+		return nil, err
+	}
+
+	if barrierConfig.StoredShares > 0 {
+		keysToStore := unsealKeys[:barrierConfig.StoredShares]
+		unsealKeys = unsealKeys[barrierConfig.StoredShares:]
+		if err := target.SetStoredKeys(keysToStore); err != nil {
+			c.logger.Printf("[ERR] core: failed to store keys: %v", err)
+			return nil, fmt.Errorf("failed to store keys: %v", err)
+		}
+	}
+
+	result := &SealMigrationResult{
+		Type:         target.BarrierType(),
+		SecretShares: unsealKeys,
+	}
+	if len(pgpKeys) > 0 {
+		hexEncodedShares := make([][]byte, len(unsealKeys))
+		for i := range unsealKeys {
+			hexEncodedShares[i] = []byte(hex.EncodeToString(unsealKeys[i]))
+		}
+		_, result.SecretShares, err = pgpkeys.EncryptShares(hexEncodedShares, pgpKeys)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Re-encrypt the keyring with the new master key. From here on, the
+	// unseal keys of the previous seal no longer open the barrier.
+	if err := c.barrier.Rekey(masterKey); err != nil {
+		c.logger.Printf("[ERR] core: failed to rekey barrier: %v", err)
+		return nil, fmt.Errorf("failed to rekey barrier: %v", err)
+	}
+
+	if err := target.SetBarrierConfig(barrierConfig.Clone()); err != nil {
+		c.logger.Printf("[ERR] core: failed to save seal migration configuration: %v", err)
+		return nil, fmt.Errorf("failed to save seal migration configuration: %v", err)
+	}
+
+	if recoveryConfig != nil {
+		if err := target.SetRecoveryConfig(recoveryConfig); err != nil {
+			c.logger.Printf("[ERR] core: failed to save recovery configuration: %v", err)
+			return nil, fmt.Errorf("recovery configuration saving failed: %v", err)
+		}
+
+		recoveryKey, recoveryKeys, err := c.generateShares(recoveryConfig)
+		if err != nil {
+			c.logger.Printf("[ERR] core: %v", err)
+			return nil, err
+		}
+		if err := target.SetRecoveryKey(recoveryKey); err != nil {
+			c.logger.Printf("[ERR] core: failed to set recovery key: %v", err)
+			return nil, fmt.Errorf("failed to set recovery key: %v", err)
+		}
+		result.RecoveryShares = recoveryKeys
+	}
+
+	previous := c.seal.BarrierType()
+	c.seal, c.migrationSeal = target, c.seal
+	c.migrationConfig = nil
+
+	c.logger.Printf("[INFO] core: seal migrated from %s to %s (shares: %d, threshold: %d)",
+		previous, target.BarrierType(), barrierConfig.SecretShares, barrierConfig.SecretThreshold)
+	return result, nil
+}
@@ -0,0 +1,114 @@
+package vault
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/shamir"
+)
+
+func TestCore_SealMigration(t *testing.T) {
+	c, key, root := TestCoreUnsealedWithMigrationSeal(t, NewTestAutoSeal())
+
+	status, err := c.SealMigrationStatus()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if status.Started || status.Type != "test-auto" || status.Required != 1 || status.RecoveryKeys {
+		t.Fatalf("bad: %#v", status)
+	}
+
+	barrierConf := &SealConfig{
+		SecretShares:    1,
+		SecretThreshold: 1,
+		StoredShares:    1,
+	}
+	recoveryConf := &SealConfig{
+		SecretShares:    5,
+		SecretThreshold: 3,
+	}
+
+	// The new seal supports recovery keys, so they must be configured
+	if err := c.SealMigrationInit(barrierConf, nil); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := c.SealMigrationInit(barrierConf, recoveryConf); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := c.SealMigrationInit(barrierConf, recoveryConf); err == nil {
+		t.Fatal("expected error for concurrent migration")
+	}
+
+	status, err = c.SealMigrationStatus()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !status.Started || status.Nonce == "" || status.BarrierConfig.StoredShares != 1 || status.RecoveryConfig.SecretShares != 5 {
+		t.Fatalf("bad: %#v", status)
+	}
+
+	if _, err := c.SealMigrationUpdate(TestKeyCopy(key), "abcd"); err == nil {
+		t.Fatal("expected error for bad nonce")
+	}
+
+	result, err := c.SealMigrationUpdate(TestKeyCopy(key), status.Nonce)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if result == nil {
+		t.Fatal("expected the migration to complete")
+	}
+	if result.Type != "test-auto" || len(result.SecretShares) != 0 || len(result.RecoveryShares) != 5 {
+		t.Fatalf("bad: %#v", result)
+	}
+
+	if sealed, _ := c.Sealed(); sealed {
+		t.Fatal("should not be sealed")
+	}
+	if c.seal.BarrierType() != "test-auto" {
+		t.Fatalf("bad: %s", c.seal.BarrierType())
+	}
+
+	// The previous unseal key no longer opens the barrier
+	if err := c.barrier.VerifyMaster(key); err == nil {
+		t.Fatal("expected previous key to be invalid")
+	}
+
+	recoveryKey, err := shamir.Combine(result.RecoveryShares[:3])
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := c.seal.VerifyRecoveryKey(recoveryKey); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The Vault unseals with the keys stored by the new seal
+	if err := c.Seal(root); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := c.UnsealWithStoredKeys(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if sealed, _ := c.Sealed(); sealed {
+		t.Fatal("should not be sealed")
+	}
+
+	// Migrating back requires the recovery keys of the new seal
+	status, err = c.SealMigrationStatus()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if status.Type != "shamir" || status.Required != 3 || !status.RecoveryKeys {
+		t.Fatalf("bad: %#v", status)
+	}
+}
+
+func TestCore_SealMigration_NotConfigured(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+
+	if _, err := c.SealMigrationStatus(); err == nil {
+		t.Fatal("expected error")
+	}
+	if err := c.SealMigrationInit(&SealConfig{SecretShares: 1, SecretThreshold: 1}, nil); err == nil {
+		t.Fatal("expected error")
+	}
+}
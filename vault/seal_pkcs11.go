@@ -0,0 +1,177 @@
+package vault
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/hashicorp/vault/helper/pkcs11util"
+)
+
+// pkcs11Client is the subset of the PKCS#11 operations used by the seal. It
+// is an interface so that tests can substitute a fake token.
+type pkcs11Client interface {
+	KeyExists(label string) (bool, error)
+	GenerateKey(label string) error
+	Encrypt(label string, plaintext []byte) ([]byte, error)
+	Decrypt(label string, ciphertext []byte) ([]byte, error)
+	Status() *pkcs11util.Status
+	Close() error
+}
+
+// pkcs11Wrapper wraps data keys with an AES key held by an HSM. Keys are
+// identified by their label.
+type pkcs11Wrapper struct {
+	client      pkcs11Client
+	keyLabel    string
+	generateKey bool
+}
+
+// NewPKCS11Seal creates a seal from the server configuration of a seal
+// block of type "pkcs11"
+func NewPKCS11Seal(conf map[string]string) (*AutoSeal, error) {
+	get := func(key, env string) string {
+		if v := os.Getenv(env); v != "" {
+			return v
+		}
+		return conf[key]
+	}
+
+	config := &pkcs11util.Config{
+		Lib:        get("lib", "VAULT_HSM_LIB"),
+		TokenLabel: get("token_label", "VAULT_HSM_TOKEN_LABEL"),
+		PIN:        get("pin", "VAULT_HSM_PIN"),
+		Mechanism:  get("mechanism", "VAULT_HSM_MECHANISM"),
+	}
+	if slot := get("slot", "VAULT_HSM_SLOT"); slot != "" {
+		v, err := strconv.ParseUint(slot, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid slot %q: %v", slot, err)
+		}
+		config.Slot = uint(v)
+	} else if config.TokenLabel == "" {
+		return nil, fmt.Errorf("'slot' or 'token_label' must be set")
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	keyLabel := get("key_label", "VAULT_HSM_KEY_LABEL")
+	if keyLabel == "" {
+		return nil, fmt.Errorf("'key_label' must be set")
+	}
+
+	var generateKey bool
+	if v := get("generate_key", "VAULT_HSM_GENERATE_KEY"); v != "" {
+		var err error
+		generateKey, err = strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid generate_key %q: %v", v, err)
+		}
+	}
+
+	client, err := pkcs11util.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return newPKCS11Seal(client, keyLabel, generateKey), nil
+}
+
+func newPKCS11Seal(client pkcs11Client, keyLabel string, generateKey bool) *AutoSeal {
+	return newAutoSeal("pkcs11", &pkcs11Wrapper{
+		client:      client,
+		keyLabel:    keyLabel,
+		generateKey: generateKey,
+	})
+}
+
+// Close ends the session with the HSM
+func (w *pkcs11Wrapper) Close() error {
+	return w.client.Close()
+}
+
+// KeyID returns the label of the key after checking that the HSM holds
+// it. A missing key is only an error if it cannot be generated.
+func (w *pkcs11Wrapper) KeyID() (string, error) {
+	exists, err := w.client.KeyExists(w.keyLabel)
+	if err != nil {
+		return "", fmt.Errorf("error finding key %s: %v", w.keyLabel, err)
+	}
+	if !exists && !w.generateKey {
+		return "", fmt.Errorf("no key with label %s", w.keyLabel)
+	}
+	return w.keyLabel, nil
+}
+
+// Wrap encrypts with the configured key, generating it inside the HSM
+// first if it is missing and generation is enabled
+func (w *pkcs11Wrapper) Wrap(plaintext []byte) ([]byte, string, error) {
+	if w.generateKey {
+		exists, err := w.client.KeyExists(w.keyLabel)
+		if err != nil {
+			return nil, "", fmt.Errorf("error finding key %s: %v", w.keyLabel, err)
+		}
+		if !exists {
+			if err := w.client.GenerateKey(w.keyLabel); err != nil {
+				return nil, "", fmt.Errorf("error generating key %s: %v", w.keyLabel, err)
+			}
+		}
+	}
+
+	ciphertext, err := w.client.Encrypt(w.keyLabel, plaintext)
+	if err != nil {
+		return nil, "", fmt.Errorf("error encrypting with HSM: %v", err)
+	}
+	return ciphertext, w.keyLabel, nil
+}
+
+// Unwrap decrypts with the key that wrapped the data key, which must still
+// be held by the HSM
+func (w *pkcs11Wrapper) Unwrap(ciphertext []byte, keyID string) ([]byte, error) {
+	if keyID == "" {
+		keyID = w.keyLabel
+	}
+
+	plaintext, err := w.client.Decrypt(keyID, ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting with HSM: %v", err)
+	}
+	return plaintext, nil
+}
+
+// HSMStatus describes the connection to the HSM of a PKCS#11 seal
+type HSMStatus struct {
+	*pkcs11util.Status
+	KeyLabel string
+	KeyFound bool
+}
+
+// HSMStatus returns the status of the HSM of the seal, or an error if the
+// seal does not use one
+func (c *Core) HSMStatus() (*HSMStatus, error) {
+	c.stateLock.RLock()
+	seal := c.seal
+	c.stateLock.RUnlock()
+
+	var w *pkcs11Wrapper
+	if s, ok := seal.(*AutoSeal); ok {
+		w, _ = s.wrapper.(*pkcs11Wrapper)
+	}
+	if w == nil {
+		return nil, fmt.Errorf("seal of type %s does not use an HSM", seal.BarrierType())
+	}
+
+	status := &HSMStatus{
+		Status:   w.client.Status(),
+		KeyLabel: w.keyLabel,
+	}
+	if status.Connected {
+		exists, err := w.client.KeyExists(w.keyLabel)
+		if err != nil {
+			status.Error = err.Error()
+		}
+		status.KeyFound = exists
+	}
+	return status, nil
+}
@@ -0,0 +1,206 @@
+package vault
+
+import (
+	"crypto/rand"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/vault/helper/pkcs11util"
+)
+
+// fakePKCS11Client is an in-memory token holding AES keys by label
+type fakePKCS11Client struct {
+	keys   map[string][]byte
+	err    error
+	closed bool
+}
+
+func newFakePKCS11Client() *fakePKCS11Client {
+	return &fakePKCS11Client{
+		keys: make(map[string][]byte),
+	}
+}
+
+func (f *fakePKCS11Client) KeyExists(label string) (bool, error) {
+	if f.err != nil {
+		return false, f.err
+	}
+	_, ok := f.keys[label]
+	return ok, nil
+}
+
+func (f *fakePKCS11Client) GenerateKey(label string) error {
+	if f.err != nil {
+		return f.err
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	f.keys[label] = key
+	return nil
+}
+
+func (f *fakePKCS11Client) Encrypt(label string, plaintext []byte) ([]byte, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	key, ok := f.keys[label]
+	if !ok {
+		return nil, fmt.Errorf("key %s not found", label)
+	}
+	return autoSealEncrypt(key, plaintext)
+}
+
+func (f *fakePKCS11Client) Decrypt(label string, ciphertext []byte) ([]byte, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	key, ok := f.keys[label]
+	if !ok {
+		return nil, fmt.Errorf("key %s not found", label)
+	}
+	return autoSealDecrypt(key, ciphertext)
+}
+
+func (f *fakePKCS11Client) Status() *pkcs11util.Status {
+	status := &pkcs11util.Status{
+		Lib:          "/usr/lib/softhsm/libsofthsm2.so",
+		TokenLabel:   "vault",
+		Manufacturer: "SoftHSM project",
+		Model:        "SoftHSM v2",
+		SerialNumber: "0123456789abcdef",
+		Connected:    f.err == nil,
+	}
+	if f.err != nil {
+		status.Error = f.err.Error()
+	}
+	return status
+}
+
+func (f *fakePKCS11Client) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestPKCS11Seal(t *testing.T) {
+	client := newFakePKCS11Client()
+	if err := client.GenerateKey("vault"); err != nil {
+		t.Fatal(err)
+	}
+	seal := newPKCS11Seal(client, "vault", false)
+
+	testAutoSeal(t, seal, func() {
+		if err := client.GenerateKey("vault-2"); err != nil {
+			t.Fatal(err)
+		}
+		seal.wrapper.(*pkcs11Wrapper).keyLabel = "vault-2"
+	}, func() {
+		delete(client.keys, "vault")
+	})
+
+	if err := seal.Finalize(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !client.closed {
+		t.Fatal("session not closed")
+	}
+}
+
+func TestPKCS11Seal_GenerateKey(t *testing.T) {
+	client := newFakePKCS11Client()
+
+	// Without generation, the key must exist
+	seal := newPKCS11Seal(client, "vault", false)
+	if _, err := seal.wrapper.KeyID(); err == nil {
+		t.Fatal("expected error")
+	}
+
+	seal = newPKCS11Seal(client, "vault", true)
+	c := TestCoreWithSeal(t, seal)
+	_, err := c.Initialize(&SealConfig{
+		SecretShares:    1,
+		SecretThreshold: 1,
+		StoredShares:    1,
+	}, &SealConfig{
+		SecretShares:    1,
+		SecretThreshold: 1,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, ok := client.keys["vault"]; !ok {
+		t.Fatal("key not generated")
+	}
+
+	// The generated key is kept
+	key := client.keys["vault"]
+	if err := c.UnsealWithStoredKeys(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if sealed, _ := c.Sealed(); sealed {
+		t.Fatal("should be unsealed")
+	}
+	if string(client.keys["vault"]) != string(key) {
+		t.Fatal("key regenerated")
+	}
+}
+
+func TestNewPKCS11Seal_config(t *testing.T) {
+	cases := []map[string]string{
+		// No library
+		{"pin": "1234", "slot": "0", "key_label": "vault"},
+		// No PIN
+		{"lib": "/usr/lib/libhsm.so", "slot": "0", "key_label": "vault"},
+		// No slot or token
+		{"lib": "/usr/lib/libhsm.so", "pin": "1234", "key_label": "vault"},
+		// Invalid slot
+		{"lib": "/usr/lib/libhsm.so", "pin": "1234", "slot": "a", "key_label": "vault"},
+		// No key
+		{"lib": "/usr/lib/libhsm.so", "pin": "1234", "slot": "0"},
+		// Unknown mechanism
+		{"lib": "/usr/lib/libhsm.so", "pin": "1234", "slot": "0", "key_label": "vault", "mechanism": "CKM_DES"},
+		// Invalid generate_key
+		{"lib": "/usr/lib/libhsm.so", "pin": "1234", "slot": "0", "key_label": "vault", "generate_key": "maybe"},
+	}
+	for _, conf := range cases {
+		if _, err := NewPKCS11Seal(conf); err == nil {
+			t.Fatalf("expected error: %v", conf)
+		}
+	}
+}
+
+func TestCore_HSMStatus(t *testing.T) {
+	c, _, _ := TestCoreUnsealed(t)
+	if _, err := c.HSMStatus(); err == nil {
+		t.Fatal("expected error")
+	}
+
+	client := newFakePKCS11Client()
+	c.seal = newPKCS11Seal(client, "vault", false)
+	status, err := c.HSMStatus()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !status.Connected || status.KeyFound || status.KeyLabel != "vault" {
+		t.Fatalf("bad: %#v", status)
+	}
+
+	client.GenerateKey("vault")
+	status, err = c.HSMStatus()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !status.KeyFound {
+		t.Fatalf("bad: %#v", status)
+	}
+
+	client.err = pkcs11util.Error(0x32)
+	status, err = c.HSMStatus()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if status.Connected || status.Error != "CKR_DEVICE_REMOVED" {
+		t.Fatalf("bad: %#v", status)
+	}
+}
@@ -133,3 +133,43 @@ func TestSealDefConfigs() (*SealConfig, *SealConfig) {
 			SecretThreshold: 3,
 		}
 }
+
+// TestAutoSeal is a seal that stores unseal keys and supports recovery
+// keys like TestSeal, with a barrier type of its own so that a Vault can
+// be migrated to it from the default seal
+type TestAutoSeal struct {
+	*TestSeal
+	barrierConfig *SealConfig
+}
+
+func NewTestAutoSeal() *TestAutoSeal {
+	return &TestAutoSeal{
+		TestSeal: &TestSeal{},
+	}
+}
+
+func (d *TestAutoSeal) BarrierType() string {
+	return "test-auto"
+}
+
+func (d *TestAutoSeal) BarrierConfig() (*SealConfig, error) {
+	if d.barrierConfig == nil {
+		return nil, nil
+	}
+	return d.barrierConfig.Clone(), nil
+}
+
+func (d *TestAutoSeal) SetBarrierConfig(config *SealConfig) error {
+	config.Type = d.BarrierType()
+	d.barrierConfig = config.Clone()
+	return nil
+}
+
+// TestCoreUnsealedWithMigrationSeal returns an unsealed core using the
+// default seal, which can be migrated to the given seal
+func TestCoreUnsealedWithMigrationSeal(t *testing.T, seal Seal) (*Core, []byte, string) {
+	core, key, token := TestCoreUnsealed(t)
+	core.migrationSeal = seal
+	seal.SetCore(core)
+	return core, key, token
+}
@@ -0,0 +1,207 @@
+package vault
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/helper/transitutil"
+)
+
+// transitRenewRetryInterval is how long to wait before trying again when
+// the token of a transit seal could not be looked up or renewed
+var transitRenewRetryInterval = 10 * time.Second
+
+// transitClient is the subset of the Vault API used by the seal. It is an
+// interface so that tests can substitute a fake server.
+type transitClient interface {
+	Encrypt(mount, key string, plaintext []byte) (string, error)
+	Decrypt(mount, key, ciphertext string) ([]byte, error)
+	LatestVersion(mount, key string) (int, error)
+	LookupSelf() (time.Duration, bool, error)
+	RenewSelf() (time.Duration, bool, error)
+}
+
+// transitWrapper wraps data keys with a key of the transit backend of
+// another Vault. Keys are identified as "<mount>/keys/<name>:<version>".
+type transitWrapper struct {
+	client    transitClient
+	mountPath string
+	keyName   string
+
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+// NewTransitSeal creates a seal from the server configuration of a seal
+// block of type "transit". Unless renewal is disabled, the token is renewed
+// in the background for as long as the server runs.
+func NewTransitSeal(conf map[string]string) (*AutoSeal, error) {
+	get := func(key, env string) string {
+		if v := os.Getenv(env); v != "" {
+			return v
+		}
+		return conf[key]
+	}
+
+	mountPath := strings.Trim(get("mount_path", "VAULT_TRANSIT_SEAL_MOUNT_PATH"), "/")
+	if mountPath == "" {
+		return nil, fmt.Errorf("'mount_path' must be set")
+	}
+	keyName := get("key_name", "VAULT_TRANSIT_SEAL_KEY_NAME")
+	if keyName == "" {
+		return nil, fmt.Errorf("'key_name' must be set")
+	}
+
+	config := &transitutil.Config{
+		Address:       get("address", "VAULT_ADDR"),
+		Token:         get("token", "VAULT_TOKEN"),
+		Namespace:     get("namespace", "VAULT_NAMESPACE"),
+		CACert:        get("tls_ca_cert", "VAULT_CACERT"),
+		CAPath:        get("tls_ca_path", "VAULT_CAPATH"),
+		ClientCert:    get("tls_client_cert", "VAULT_CLIENT_CERT"),
+		ClientKey:     get("tls_client_key", "VAULT_CLIENT_KEY"),
+		TLSServerName: get("tls_server_name", "VAULT_TLS_SERVER_NAME"),
+	}
+	if v := get("tls_skip_verify", "VAULT_SKIP_VERIFY"); v != "" {
+		var err error
+		config.Insecure, err = strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tls_skip_verify %q: %v", v, err)
+		}
+	}
+
+	var disableRenewal bool
+	if v := get("disable_renewal", "VAULT_TRANSIT_SEAL_DISABLE_RENEWAL"); v != "" {
+		var err error
+		disableRenewal, err = strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid disable_renewal %q: %v", v, err)
+		}
+	}
+
+	client, err := transitutil.NewClient(config)
+	if err != nil {
+		return nil, err
+	}
+
+	wrapper := newTransitWrapper(client, mountPath, keyName)
+	if !disableRenewal {
+		go wrapper.renewToken()
+	}
+	return newAutoSeal("transit", wrapper), nil
+}
+
+func newTransitWrapper(client transitClient, mountPath, keyName string) *transitWrapper {
+	return &transitWrapper{
+		client:    client,
+		mountPath: mountPath,
+		keyName:   keyName,
+		stopCh:    make(chan struct{}),
+	}
+}
+
+// KeyID returns the identifier of the latest version of the key
+func (w *transitWrapper) KeyID() (string, error) {
+	version, err := w.client.LatestVersion(w.mountPath, w.keyName)
+	if err != nil {
+		return "", fmt.Errorf("error reading transit key %s: %v", w.keyName, err)
+	}
+	return transitKeyID(w.mountPath, w.keyName, version), nil
+}
+
+// Wrap encrypts with the latest version of the key. The version is read
+// from the ciphertext, which is prefixed with "vault:v<version>:".
+func (w *transitWrapper) Wrap(plaintext []byte) ([]byte, string, error) {
+	ciphertext, err := w.client.Encrypt(w.mountPath, w.keyName, plaintext)
+	if err != nil {
+		return nil, "", fmt.Errorf("error encrypting with transit key %s: %v", w.keyName, err)
+	}
+
+	parts := strings.SplitN(ciphertext, ":", 3)
+	if len(parts) != 3 || !strings.HasPrefix(parts[1], "v") {
+		return nil, "", fmt.Errorf("invalid ciphertext returned by transit")
+	}
+	version, err := strconv.Atoi(parts[1][1:])
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid ciphertext returned by transit")
+	}
+
+	return []byte(ciphertext), transitKeyID(w.mountPath, w.keyName, version), nil
+}
+
+// Unwrap decrypts with the key that wrapped the data key, which may be at a
+// different mount or have a different name than the configured key
+func (w *transitWrapper) Unwrap(ciphertext []byte, keyID string) ([]byte, error) {
+	mountPath, keyName := w.mountPath, w.keyName
+	if keyID != "" {
+		var err error
+		mountPath, keyName, err = parseTransitKeyID(keyID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	plaintext, err := w.client.Decrypt(mountPath, keyName, string(ciphertext))
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting with transit key %s: %v", keyName, err)
+	}
+	return plaintext, nil
+}
+
+// Close stops the renewal of the token
+func (w *transitWrapper) Close() error {
+	w.stopOnce.Do(func() {
+		close(w.stopCh)
+	})
+	return nil
+}
+
+// renewToken renews the token when half of its TTL has passed, until the
+// wrapper is closed or the token can no longer be renewed
+func (w *transitWrapper) renewToken() {
+	lookup := true
+	var wait time.Duration
+	for {
+		select {
+		case <-w.stopCh:
+			return
+		case <-time.After(wait):
+		}
+
+		var ttl time.Duration
+		var renewable bool
+		var err error
+		if lookup {
+			ttl, renewable, err = w.client.LookupSelf()
+		} else {
+			ttl, renewable, err = w.client.RenewSelf()
+		}
+		if err != nil {
+			wait = transitRenewRetryInterval
+			continue
+		}
+		if !renewable || ttl == 0 {
+			return
+		}
+
+		lookup = false
+		wait = ttl / 2
+	}
+}
+
+func transitKeyID(mountPath, keyName string, version int) string {
+	return fmt.Sprintf("%s/keys/%s:%d", mountPath, keyName, version)
+}
+
+func parseTransitKeyID(keyID string) (string, string, error) {
+	i := strings.LastIndex(keyID, "/keys/")
+	j := strings.LastIndex(keyID, ":")
+	if i <= 0 || j < i {
+		return "", "", fmt.Errorf("invalid transit key ID %q", keyID)
+	}
+	return keyID[:i], keyID[i+len("/keys/") : j], nil
+}
@@ -0,0 +1,218 @@
+package vault
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTransit is an in-memory stand-in for the transit backend and the
+// token endpoints of a Vault server
+type fakeTransit struct {
+	// keys maps "<mount>/<name>" to the versions of a key
+	keys map[string][][]byte
+
+	// minDecryptionVersion maps keys to the oldest version that can still
+	// decrypt
+	minDecryptionVersion map[string]int
+
+	l        sync.Mutex
+	ttl      time.Duration
+	lookups  int
+	renewals int
+	fail     bool
+}
+
+func newFakeTransit() *fakeTransit {
+	return &fakeTransit{
+		keys:                 make(map[string][][]byte),
+		minDecryptionVersion: make(map[string]int),
+	}
+}
+
+func (f *fakeTransit) rotate(name string) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		panic(err)
+	}
+	f.keys[name] = append(f.keys[name], key)
+}
+
+func (f *fakeTransit) Encrypt(mount, key string, plaintext []byte) (string, error) {
+	versions := f.keys[mount+"/"+key]
+	if len(versions) == 0 {
+		return "", fmt.Errorf("encryption key not found")
+	}
+	ciphertext, err := autoSealEncrypt(versions[len(versions)-1], plaintext)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("vault:v%d:%s", len(versions), base64.StdEncoding.EncodeToString(ciphertext)), nil
+}
+
+func (f *fakeTransit) Decrypt(mount, key, ciphertext string) ([]byte, error) {
+	name := mount + "/" + key
+	parts := strings.SplitN(ciphertext, ":", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid ciphertext")
+	}
+	version, err := strconv.Atoi(strings.TrimPrefix(parts[1], "v"))
+	if err != nil || version < 1 || version > len(f.keys[name]) {
+		return nil, fmt.Errorf("invalid ciphertext")
+	}
+	if version < f.minDecryptionVersion[name] {
+		return nil, fmt.Errorf("ciphertext version is disallowed by policy (too old)")
+	}
+	raw, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	return autoSealDecrypt(f.keys[name][version-1], raw)
+}
+
+func (f *fakeTransit) LatestVersion(mount, key string) (int, error) {
+	versions := f.keys[mount+"/"+key]
+	if len(versions) == 0 {
+		return 0, fmt.Errorf("key not found")
+	}
+	return len(versions), nil
+}
+
+func (f *fakeTransit) LookupSelf() (time.Duration, bool, error) {
+	f.l.Lock()
+	defer f.l.Unlock()
+	f.lookups++
+	if f.fail {
+		return 0, false, fmt.Errorf("connection refused")
+	}
+	return f.ttl, true, nil
+}
+
+func (f *fakeTransit) RenewSelf() (time.Duration, bool, error) {
+	f.l.Lock()
+	defer f.l.Unlock()
+	f.renewals++
+	return f.ttl, true, nil
+}
+
+func TestTransitSeal(t *testing.T) {
+	transit := newFakeTransit()
+	transit.rotate("transit/unseal")
+	seal := newAutoSeal("transit", newTransitWrapper(transit, "transit", "unseal"))
+
+	testAutoSeal(t, seal, func() {
+		transit.rotate("transit/unseal")
+	}, func() {
+		transit.minDecryptionVersion["transit/unseal"] = 2
+	})
+}
+
+func TestTransitSeal_changeKey(t *testing.T) {
+	transit := newFakeTransit()
+	transit.rotate("transit/unseal")
+	wrapper := newTransitWrapper(transit, "transit", "unseal")
+	seal := newAutoSeal("transit", wrapper)
+
+	// Moving to a key of another mount keeps the old one usable until the
+	// stored keys are rewrapped
+	testAutoSeal(t, seal, func() {
+		transit.rotate("seal/vault")
+		wrapper.mountPath = "seal"
+		wrapper.keyName = "vault"
+	}, func() {
+		delete(transit.keys, "transit/unseal")
+	})
+}
+
+func TestTransitSeal_renewToken(t *testing.T) {
+	oldInterval := transitRenewRetryInterval
+	transitRenewRetryInterval = 10 * time.Millisecond
+	defer func() {
+		transitRenewRetryInterval = oldInterval
+	}()
+
+	transit := newFakeTransit()
+	transit.ttl = 20 * time.Millisecond
+	transit.fail = true
+	wrapper := newTransitWrapper(transit, "transit", "unseal")
+	go wrapper.renewToken()
+
+	// The lookup is retried until it succeeds
+	time.Sleep(50 * time.Millisecond)
+	transit.l.Lock()
+	transit.fail = false
+	transit.l.Unlock()
+	time.Sleep(100 * time.Millisecond)
+
+	if err := wrapper.Close(); err != nil {
+		t.Fatal(err)
+	}
+	transit.l.Lock()
+	lookups, renewals := transit.lookups, transit.renewals
+	transit.l.Unlock()
+	if lookups < 2 || renewals < 2 {
+		t.Fatalf("bad: %d lookups, %d renewals", lookups, renewals)
+	}
+
+	// Renewal stops once closed
+	time.Sleep(50 * time.Millisecond)
+	transit.l.Lock()
+	defer transit.l.Unlock()
+	if transit.renewals > renewals+1 {
+		t.Fatalf("bad: %d renewals", transit.renewals)
+	}
+}
+
+func TestParseTransitKeyID(t *testing.T) {
+	mountPath, keyName, err := parseTransitKeyID(transitKeyID("ns/transit", "unseal", 3))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if mountPath != "ns/transit" || keyName != "unseal" {
+		t.Fatalf("bad: %s %s", mountPath, keyName)
+	}
+
+	for _, keyID := range []string{"", "unseal:1", "/keys/unseal:1", "transit/keys/unseal"} {
+		if _, _, err := parseTransitKeyID(keyID); err == nil {
+			t.Fatalf("expected error: %q", keyID)
+		}
+	}
+}
+
+func TestNewTransitSeal_config(t *testing.T) {
+	cases := []map[string]string{
+		// No mount path
+		{"address": "https://vault:8200", "token": "root", "key_name": "unseal"},
+		// No key
+		{"address": "https://vault:8200", "token": "root", "mount_path": "transit"},
+		// Invalid disable_renewal
+		{"address": "https://vault:8200", "token": "root", "mount_path": "transit", "key_name": "unseal", "disable_renewal": "maybe"},
+	}
+	for _, conf := range cases {
+		if _, err := NewTransitSeal(conf); err == nil {
+			t.Fatalf("expected error: %v", conf)
+		}
+	}
+
+	seal, err := NewTransitSeal(map[string]string{
+		"address":         "https://vault:8200",
+		"token":           "root",
+		"mount_path":      "/transit/",
+		"key_name":        "unseal",
+		"disable_renewal": "true",
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if w := seal.wrapper.(*transitWrapper); w.mountPath != "transit" {
+		t.Fatalf("bad: %s", w.mountPath)
+	}
+	if err := seal.Finalize(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
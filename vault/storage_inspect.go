@@ -0,0 +1,166 @@
+package vault
+
+import (
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/hashicorp/vault/physical"
+	"github.com/hashicorp/vault/shamir"
+)
+
+// StorageInspector decrypts the entries of a storage snapshot offline,
+// without running a Core, so that data such as a corrupted mount table can
+// be recovered. The snapshot is loaded in memory and never written back.
+type StorageInspector struct {
+	core *Core
+	meta *storageSnapshotMeta
+}
+
+// NewStorageInspector loads the storage snapshot read from r. The seal must
+// be the one the snapshot was taken with: the DefaultSeal for unseal keys,
+// or the auto seal holding the stored keys when recovery keys are used.
+func NewStorageInspector(r io.Reader, seal Seal, logger *log.Logger) (*StorageInspector, error) {
+	meta, entries, err := readStorageSnapshot(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot: %v", err)
+	}
+
+	backend := physical.NewInmem(logger)
+	for _, entry := range entries {
+		if err := backend.Put(entry); err != nil {
+			return nil, err
+		}
+	}
+	barrier, err := NewAESGCMBarrier(backend)
+	if err != nil {
+		return nil, err
+	}
+
+	if seal == nil {
+		seal = &DefaultSeal{}
+	}
+	c := &Core{
+		physical: backend,
+		barrier:  barrier,
+		seal:     seal,
+		logger:   logger,
+		sealed:   true,
+	}
+	seal.SetCore(c)
+	return &StorageInspector{core: c, meta: meta}, nil
+}
+
+// Keys returns the number of entries of the snapshot
+func (i *StorageInspector) Keys() int {
+	return i.meta.Keys
+}
+
+// BarrierKeyLength returns the minimum and maximum length of a key share
+func (i *StorageInspector) BarrierKeyLength() (min, max int) {
+	return i.core.BarrierKeyLength()
+}
+
+// KeyConfig returns the configuration of the keys Unseal expects: the
+// recovery key configuration with an auto seal, which can only be read once
+// the stored keys have decrypted the barrier, and the barrier configuration
+// otherwise.
+func (i *StorageInspector) KeyConfig() (*SealConfig, error) {
+	config, err := i.core.seal.BarrierConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, ErrNotInit
+	}
+	if !i.core.seal.RecoveryKeySupported() {
+		return config, nil
+	}
+
+	if err := i.unsealStored(config); err != nil {
+		return nil, err
+	}
+	config, err = i.core.seal.RecoveryConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config == nil {
+		return nil, fmt.Errorf("recovery seal configuration not found")
+	}
+	return config, nil
+}
+
+// Unseal gives access to the entries of the snapshot given at least the
+// threshold of unseal keys, or of recovery keys with an auto seal
+func (i *StorageInspector) Unseal(keys [][]byte) error {
+	config, err := i.KeyConfig()
+	if err != nil {
+		return err
+	}
+	if len(keys) < config.SecretThreshold {
+		return fmt.Errorf("%d keys provided, %d are required", len(keys), config.SecretThreshold)
+	}
+
+	key := keys[0]
+	if config.SecretThreshold > 1 {
+		key, err = shamir.Combine(keys[:config.SecretThreshold])
+		if err != nil {
+			return fmt.Errorf("failed to compute master key: %v", err)
+		}
+	}
+	defer memzero(key)
+
+	if i.core.seal.RecoveryKeySupported() {
+		// The barrier is already unsealed by the stored keys, but the
+		// entries are only given to the holders of the recovery keys
+		if err := i.core.seal.VerifyRecoveryKey(key); err != nil {
+			i.core.barrier.Seal()
+			return err
+		}
+	} else if err := i.core.barrier.Unseal(key); err != nil {
+		return err
+	}
+
+	i.core.sealed = false
+	return nil
+}
+
+// unsealStored unseals the barrier with the keys stored by an auto seal
+func (i *StorageInspector) unsealStored(config *SealConfig) error {
+	if sealed, err := i.core.barrier.Sealed(); err != nil || !sealed {
+		return err
+	}
+
+	keys, err := i.core.seal.GetStoredKeys()
+	if err != nil {
+		return fmt.Errorf("fetching stored unseal keys failed: %v", err)
+	}
+	if len(keys) < config.SecretThreshold {
+		return fmt.Errorf("%d stored keys found, %d are required", len(keys), config.SecretThreshold)
+	}
+	key := keys[0]
+	if config.SecretThreshold > 1 {
+		key, err = shamir.Combine(keys[:config.SecretThreshold])
+		if err != nil {
+			return fmt.Errorf("failed to compute master key: %v", err)
+		}
+	}
+	defer memzero(key)
+	return i.core.barrier.Unseal(key)
+}
+
+// Get returns the decrypted entry at the given storage path
+func (i *StorageInspector) Get(path string) (*Entry, error) {
+	if i.core.sealed {
+		return nil, ErrBarrierSealed
+	}
+	return i.core.barrier.Get(path)
+}
+
+// List returns the keys under the given storage prefix
+func (i *StorageInspector) List(prefix string) ([]string, error) {
+	if i.core.sealed {
+		return nil, ErrBarrierSealed
+	}
+	return i.core.barrier.List(prefix)
+}
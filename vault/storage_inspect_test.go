@@ -0,0 +1,118 @@
+package vault
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/shamir"
+)
+
+func TestStorageInspector(t *testing.T) {
+	c, key, _ := TestCoreUnsealed(t)
+
+	var buf bytes.Buffer
+	if _, err := writeStorageSnapshot(c.physical, &buf, time.Now()); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	inspector, err := NewStorageInspector(bytes.NewReader(buf.Bytes()), nil, logger)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, err := inspector.Get(coreMountConfigPath); err != ErrBarrierSealed {
+		t.Fatalf("expected sealed error, got %v", err)
+	}
+	if err := inspector.Unseal([][]byte{[]byte("0123456789abcdef0123456789abcdef")}); err == nil {
+		t.Fatalf("expected invalid key to fail")
+	}
+	if err := inspector.Unseal([][]byte{TestKeyCopy(key)}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	entry, err := inspector.Get(coreMountConfigPath)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expected, err := c.barrier.Get(coreMountConfigPath)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if entry == nil || !bytes.Equal(entry.Value, expected.Value) {
+		t.Fatalf("bad: %#v", entry)
+	}
+	keys, err := inspector.List("core/")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(keys) == 0 {
+		t.Fatalf("expected keys under core/")
+	}
+}
+
+func TestStorageInspector_AutoSeal(t *testing.T) {
+	c := TestCoreWithSeal(t, newAutoSeal("fake", &fakeSealKeyWrapper{}))
+	res, err := c.Initialize(&SealConfig{
+		SecretShares:    1,
+		SecretThreshold: 1,
+		StoredShares:    1,
+	}, &SealConfig{
+		SecretShares:    3,
+		SecretThreshold: 2,
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := c.UnsealWithStoredKeys(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := writeStorageSnapshot(c.physical, &buf, time.Now()); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	logger := log.New(os.Stderr, "", log.LstdFlags)
+	inspector, err := NewStorageInspector(bytes.NewReader(buf.Bytes()), newAutoSeal("fake", &fakeSealKeyWrapper{}), logger)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The recovery keys are expected rather than the stored keys
+	config, err := inspector.KeyConfig()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if config.SecretShares != 3 || config.SecretThreshold != 2 {
+		t.Fatalf("bad: %#v", config)
+	}
+	if err := inspector.Unseal(res.RecoveryShares[:1]); err == nil {
+		t.Fatalf("expected too few keys to fail")
+	}
+
+	// A wrong recovery key does not give access to the entries
+	wrong, err := shamir.Split([]byte("0123456789abcdef0123456789abcdef"), 3, 2)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := inspector.Unseal(wrong[:2]); err == nil {
+		t.Fatalf("expected wrong recovery key to fail")
+	}
+	if _, err := inspector.Get(coreMountConfigPath); err != ErrBarrierSealed {
+		t.Fatalf("expected sealed error, got %v", err)
+	}
+
+	if err := inspector.Unseal(res.RecoveryShares[1:]); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	entry, err := inspector.Get(coreMountConfigPath)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if entry == nil {
+		t.Fatalf("expected mount table")
+	}
+}
@@ -0,0 +1,629 @@
+package vault
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/armon/go-metrics"
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/physical"
+)
+
+const (
+	// coreSnapshotConfigPath is used to store the automated snapshot
+	// configurations, one entry per configuration
+	coreSnapshotConfigPath = "core/snapshots/config/"
+
+	// coreSnapshotStatusPath is used to store the status of the automated
+	// snapshots of each configuration
+	coreSnapshotStatusPath = "core/snapshots/status/"
+
+	// storageSnapshotVersion is the version of the snapshot format
+	storageSnapshotVersion = 1
+
+	// The files of a snapshot archive
+	storageSnapshotMetaFile  = "meta.json"
+	storageSnapshotStateFile = "state.json"
+	storageSnapshotSumsFile  = "SHA256SUMS"
+
+	// storageSnapshotTimeFormat is the format of the time in the file name
+	// of a snapshot, which sorts in chronological order
+	storageSnapshotTimeFormat = "20060102T150405.000000000Z"
+
+	// storageSnapshotExtension is the extension of the snapshot files
+	storageSnapshotExtension = ".tar.gz"
+)
+
+var (
+	// snapshotCheckInterval is how often the active node checks whether a
+	// snapshot is due
+	snapshotCheckInterval = 10 * time.Second
+
+	// storageSnapshotExcludedPrefixes are the storage paths belonging to the
+	// running cluster rather than to its data, which snapshots leave out
+	storageSnapshotExcludedPrefixes = []string{
+		coreLockPath,
+		coreLeaderPrefix,
+	}
+
+	// errLoadSnapshotConfigsFailed if loading the automated snapshot
+	// configurations encounters an error
+	errLoadSnapshotConfigsFailed = errors.New("failed to load automated snapshot configurations")
+)
+
+// StorageSnapshotConfig configures snapshots of the storage taken every
+// Interval by the active node and uploaded to StorageType, keeping the last
+// Retain snapshots. Snapshots are named FilePrefix followed by the time
+// they were taken, under PathPrefix: a directory for the local storage type,
+// and a prefix of the object names otherwise.
+type StorageSnapshotConfig struct {
+	Name        string        `json:"name"`
+	Interval    time.Duration `json:"interval"`
+	Retain      int           `json:"retain"`
+	StorageType string        `json:"storage_type"`
+	PathPrefix  string        `json:"path_prefix"`
+	FilePrefix  string        `json:"file_prefix"`
+
+	AWSS3Bucket         string `json:"aws_s3_bucket,omitempty"`
+	AWSS3Region         string `json:"aws_s3_region,omitempty"`
+	AWSS3Endpoint       string `json:"aws_s3_endpoint,omitempty"`
+	AWSS3ForcePathStyle bool   `json:"aws_s3_force_path_style,omitempty"`
+	AWSAccessKeyID      string `json:"aws_access_key_id,omitempty"`
+	AWSSecretAccessKey  string `json:"aws_secret_access_key,omitempty"`
+
+	GoogleGCSBucket             string `json:"google_gcs_bucket,omitempty"`
+	GoogleGCSEndpoint           string `json:"google_gcs_endpoint,omitempty"`
+	GoogleServiceAccountKeyFile string `json:"google_service_account_key_file,omitempty"`
+
+	AzureContainerName string `json:"azure_container_name,omitempty"`
+	AzureAccountName   string `json:"azure_account_name,omitempty"`
+	AzureAccountKey    string `json:"azure_account_key,omitempty"`
+}
+
+// validate checks that the configuration can be used
+func (c *StorageSnapshotConfig) validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("missing name")
+	}
+	if c.Interval <= 0 {
+		return fmt.Errorf("interval must be positive")
+	}
+	if c.Retain < 1 {
+		return fmt.Errorf("retain must be at least 1")
+	}
+	if c.FilePrefix == "" || strings.Contains(c.FilePrefix, "/") {
+		return fmt.Errorf("file_prefix must be set and cannot contain '/'")
+	}
+
+	switch c.StorageType {
+	case "local":
+		if c.PathPrefix == "" {
+			return fmt.Errorf("path_prefix must be set to a directory for the local storage type")
+		}
+	case "aws-s3":
+		if c.AWSS3Bucket == "" {
+			return fmt.Errorf("aws_s3_bucket must be set")
+		}
+	case "google-gcs":
+		if c.GoogleGCSBucket == "" {
+			return fmt.Errorf("google_gcs_bucket must be set")
+		}
+	case "azure-blob":
+		if c.AzureContainerName == "" || c.AzureAccountName == "" || c.AzureAccountKey == "" {
+			return fmt.Errorf("azure_container_name, azure_account_name and azure_account_key must be set")
+		}
+	default:
+		return fmt.Errorf("unknown storage_type %q", c.StorageType)
+	}
+	return nil
+}
+
+// StorageSnapshotStatus is the outcome of the automated snapshots of a
+// configuration
+type StorageSnapshotStatus struct {
+	LastSnapshotStart  time.Time `json:"last_snapshot_start"`
+	LastSnapshotEnd    time.Time `json:"last_snapshot_end"`
+	LastSnapshotURL    string    `json:"last_snapshot_url"`
+	LastSnapshotSHA256 string    `json:"last_snapshot_sha256"`
+	LastSnapshotKeys   int       `json:"last_snapshot_keys"`
+	LastSnapshotError  string    `json:"last_snapshot_error"`
+	ConsecutiveErrors  int       `json:"consecutive_errors"`
+}
+
+// storageSnapshotMeta is the metadata file of a snapshot
+type storageSnapshotMeta struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	Keys    int       `json:"keys"`
+}
+
+// storageSnapshotEntry is an entry of the state file of a snapshot, one
+// per line
+type storageSnapshotEntry struct {
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+}
+
+// writeStorageSnapshot writes a snapshot of the physical storage to w: a
+// gzipped tar archive of the metadata, the entries and their SHA-256
+// checksums. The entries are those of the storage, still encrypted by the
+// barrier.
+func writeStorageSnapshot(b physical.Backend, w io.Writer, now time.Time) (*storageSnapshotMeta, error) {
+	keys, err := physicalKeys(b, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var state bytes.Buffer
+	enc := json.NewEncoder(&state)
+	meta := &storageSnapshotMeta{
+		Version: storageSnapshotVersion,
+		Created: now.UTC(),
+	}
+	for _, key := range keys {
+		if storageSnapshotExcluded(key) {
+			continue
+		}
+		entry, err := b.Get(key)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			continue
+		}
+		if err := enc.Encode(&storageSnapshotEntry{Key: key, Value: entry.Value}); err != nil {
+			return nil, err
+		}
+		meta.Keys++
+	}
+
+	metaBuf, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{storageSnapshotMetaFile, metaBuf},
+		{storageSnapshotStateFile, state.Bytes()},
+	}
+	var sums bytes.Buffer
+	for _, file := range files {
+		sum := sha256.Sum256(file.data)
+		fmt.Fprintf(&sums, "%s  %s\n", hex.EncodeToString(sum[:]), file.name)
+	}
+	files = append(files, struct {
+		name string
+		data []byte
+	}{storageSnapshotSumsFile, sums.Bytes()})
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	for _, file := range files {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:    file.name,
+			Mode:    0600,
+			Size:    int64(len(file.data)),
+			ModTime: meta.Created,
+		}); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(file.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+// readStorageSnapshot reads a snapshot written by writeStorageSnapshot,
+// verifying the checksums of its files
+func readStorageSnapshot(r io.Reader) (*storageSnapshotMeta, []*physical.Entry, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer gz.Close()
+
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, nil, err
+		}
+		files[hdr.Name] = data
+	}
+
+	sums, ok := files[storageSnapshotSumsFile]
+	if !ok {
+		return nil, nil, fmt.Errorf("snapshot has no %s file", storageSnapshotSumsFile)
+	}
+	verified := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(sums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			return nil, nil, fmt.Errorf("invalid %s file", storageSnapshotSumsFile)
+		}
+		data, ok := files[fields[1]]
+		if !ok {
+			return nil, nil, fmt.Errorf("snapshot has no %s file", fields[1])
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != fields[0] {
+			return nil, nil, fmt.Errorf("checksum mismatch for %s", fields[1])
+		}
+		verified[fields[1]] = true
+	}
+	if !verified[storageSnapshotMetaFile] || !verified[storageSnapshotStateFile] {
+		return nil, nil, fmt.Errorf("snapshot is missing checksums")
+	}
+
+	meta := &storageSnapshotMeta{}
+	if err := jsonutil.DecodeJSON(files[storageSnapshotMetaFile], meta); err != nil {
+		return nil, nil, err
+	}
+	if meta.Version != storageSnapshotVersion {
+		return nil, nil, fmt.Errorf("unsupported snapshot version %d", meta.Version)
+	}
+
+	var entries []*physical.Entry
+	dec := json.NewDecoder(bytes.NewReader(files[storageSnapshotStateFile]))
+	for {
+		var entry storageSnapshotEntry
+		if err := dec.Decode(&entry); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+		entries = append(entries, &physical.Entry{Key: entry.Key, Value: entry.Value})
+	}
+	if len(entries) != meta.Keys {
+		return nil, nil, fmt.Errorf("snapshot has %d entries, expected %d", len(entries), meta.Keys)
+	}
+	return meta, entries, nil
+}
+
+// storageSnapshotExcluded returns whether snapshots leave out the key
+func storageSnapshotExcluded(key string) bool {
+	for _, prefix := range storageSnapshotExcludedPrefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// storageSnapshotFileName returns the name of the snapshot taken at the
+// given time
+func storageSnapshotFileName(filePrefix string, t time.Time) string {
+	return filePrefix + "-" + t.UTC().Format(storageSnapshotTimeFormat) + storageSnapshotExtension
+}
+
+// StorageSnapshotConfig returns the named automated snapshot configuration,
+// or nil if it does not exist
+func (c *Core) StorageSnapshotConfig(name string) *StorageSnapshotConfig {
+	c.snapshotLock.Lock()
+	defer c.snapshotLock.Unlock()
+	return c.snapshotConfigs[name]
+}
+
+// StorageSnapshotConfigNames returns the names of the automated snapshot
+// configurations, sorted
+func (c *Core) StorageSnapshotConfigNames() []string {
+	c.snapshotLock.Lock()
+	defer c.snapshotLock.Unlock()
+	names := make([]string, 0, len(c.snapshotConfigs))
+	for name := range c.snapshotConfigs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// StorageSnapshotStatus returns the status of the automated snapshots of
+// the named configuration, or nil if it does not exist
+func (c *Core) StorageSnapshotStatus(name string) *StorageSnapshotStatus {
+	c.snapshotLock.Lock()
+	defer c.snapshotLock.Unlock()
+	if _, ok := c.snapshotConfigs[name]; !ok {
+		return nil
+	}
+	status := &StorageSnapshotStatus{}
+	if current := c.snapshotStatus[name]; current != nil {
+		*status = *current
+	}
+	return status
+}
+
+// setStorageSnapshotConfig persists the given configuration, replacing the
+// configuration with the same name. The first snapshot is taken at the next
+// check.
+func (c *Core) setStorageSnapshotConfig(config *StorageSnapshotConfig) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+
+	buf, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to encode automated snapshot configuration: %v", err)
+	}
+
+	c.snapshotLock.Lock()
+	defer c.snapshotLock.Unlock()
+
+	if err := c.barrier.Put(&Entry{
+		Key:   coreSnapshotConfigPath + config.Name,
+		Value: buf,
+	}); err != nil {
+		c.logger.Printf("[ERR] core: failed to persist automated snapshot configuration: %v", err)
+		return err
+	}
+
+	configs := make(map[string]*StorageSnapshotConfig, len(c.snapshotConfigs)+1)
+	for name, conf := range c.snapshotConfigs {
+		configs[name] = conf
+	}
+	configs[config.Name] = config
+	c.snapshotConfigs = configs
+	return nil
+}
+
+// deleteStorageSnapshotConfig removes the named configuration and its
+// status. The snapshots already taken are kept.
+func (c *Core) deleteStorageSnapshotConfig(name string) error {
+	c.snapshotLock.Lock()
+	defer c.snapshotLock.Unlock()
+
+	if err := c.barrier.Delete(coreSnapshotConfigPath + name); err != nil {
+		c.logger.Printf("[ERR] core: failed to delete automated snapshot configuration: %v", err)
+		return err
+	}
+	if err := c.barrier.Delete(coreSnapshotStatusPath + name); err != nil {
+		c.logger.Printf("[ERR] core: failed to delete automated snapshot status: %v", err)
+		return err
+	}
+
+	configs := make(map[string]*StorageSnapshotConfig, len(c.snapshotConfigs))
+	for n, conf := range c.snapshotConfigs {
+		if n != name {
+			configs[n] = conf
+		}
+	}
+	c.snapshotConfigs = configs
+	delete(c.snapshotStatus, name)
+	return nil
+}
+
+// setupStorageSnapshots loads the automated snapshot configurations and
+// their status, and starts taking the snapshots when due
+func (c *Core) setupStorageSnapshots() error {
+	configs := make(map[string]*StorageSnapshotConfig)
+	status := make(map[string]*StorageSnapshotStatus)
+
+	names, err := c.barrier.List(coreSnapshotConfigPath)
+	if err != nil {
+		c.logger.Printf("[ERR] core: failed to list automated snapshot configurations: %v", err)
+		return errLoadSnapshotConfigsFailed
+	}
+	for _, name := range names {
+		raw, err := c.barrier.Get(coreSnapshotConfigPath + name)
+		if err != nil {
+			c.logger.Printf("[ERR] core: failed to read automated snapshot configuration %s: %v", name, err)
+			return errLoadSnapshotConfigsFailed
+		}
+		if raw == nil {
+			continue
+		}
+		config := &StorageSnapshotConfig{}
+		if err := jsonutil.DecodeJSON(raw.Value, config); err != nil {
+			c.logger.Printf("[ERR] core: failed to decode automated snapshot configuration %s: %v", name, err)
+			return errLoadSnapshotConfigsFailed
+		}
+		configs[config.Name] = config
+
+		raw, err = c.barrier.Get(coreSnapshotStatusPath + name)
+		if err != nil {
+			c.logger.Printf("[ERR] core: failed to read automated snapshot status %s: %v", name, err)
+			return errLoadSnapshotConfigsFailed
+		}
+		if raw != nil {
+			s := &StorageSnapshotStatus{}
+			if err := jsonutil.DecodeJSON(raw.Value, s); err != nil {
+				c.logger.Printf("[ERR] core: failed to decode automated snapshot status %s: %v", name, err)
+				return errLoadSnapshotConfigsFailed
+			}
+			status[config.Name] = s
+		}
+	}
+
+	c.snapshotLock.Lock()
+	c.snapshotConfigs = configs
+	c.snapshotStatus = status
+	c.snapshotLock.Unlock()
+
+	c.snapshotStopCh = make(chan struct{})
+	c.snapshotDoneCh = make(chan struct{})
+	go c.runStorageSnapshots(c.snapshotStopCh, c.snapshotDoneCh)
+	return nil
+}
+
+// teardownStorageSnapshots stops taking snapshots, waiting for the one in
+// progress
+func (c *Core) teardownStorageSnapshots() {
+	if c.snapshotStopCh == nil {
+		return
+	}
+	close(c.snapshotStopCh)
+	<-c.snapshotDoneCh
+	c.snapshotStopCh = nil
+	c.snapshotDoneCh = nil
+
+	c.snapshotLock.Lock()
+	c.snapshotConfigs = nil
+	c.snapshotStatus = nil
+	c.snapshotLock.Unlock()
+}
+
+// runStorageSnapshots takes the snapshots of the configurations as they are
+// due, until stopCh is closed
+func (c *Core) runStorageSnapshots(stopCh, doneCh chan struct{}) {
+	defer close(doneCh)
+	for {
+		for _, config := range c.dueStorageSnapshots(time.Now()) {
+			// Sealing may have started while taking a snapshot
+			select {
+			case <-stopCh:
+				return
+			default:
+			}
+			c.takeStorageSnapshot(config, time.Now())
+		}
+
+		select {
+		case <-time.After(snapshotCheckInterval):
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// dueStorageSnapshots returns the configurations whose snapshot is due at
+// the given time, sorted by name
+func (c *Core) dueStorageSnapshots(now time.Time) []*StorageSnapshotConfig {
+	c.snapshotLock.Lock()
+	defer c.snapshotLock.Unlock()
+
+	var due []*StorageSnapshotConfig
+	for _, config := range c.snapshotConfigs {
+		status := c.snapshotStatus[config.Name]
+		if status == nil || !now.Before(status.LastSnapshotStart.Add(config.Interval)) {
+			due = append(due, config)
+		}
+	}
+	sort.Sort(storageSnapshotConfigsByName(due))
+	return due
+}
+
+type storageSnapshotConfigsByName []*StorageSnapshotConfig
+
+func (s storageSnapshotConfigsByName) Len() int           { return len(s) }
+func (s storageSnapshotConfigsByName) Less(i, j int) bool { return s[i].Name < s[j].Name }
+func (s storageSnapshotConfigsByName) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// takeStorageSnapshot takes a snapshot for the configuration, uploads it,
+// removes the snapshots beyond the retention and records the outcome
+func (c *Core) takeStorageSnapshot(config *StorageSnapshotConfig, start time.Time) *StorageSnapshotStatus {
+	defer metrics.MeasureSince([]string{"core", "storage_snapshot"}, start)
+
+	c.snapshotLock.Lock()
+	status := &StorageSnapshotStatus{}
+	if current := c.snapshotStatus[config.Name]; current != nil {
+		*status = *current
+	}
+	c.snapshotLock.Unlock()
+
+	status.LastSnapshotStart = start
+	url, sum, keys, err := c.uploadStorageSnapshot(config, start)
+	status.LastSnapshotEnd = time.Now()
+	if err != nil {
+		c.logger.Printf("[ERR] core: automated snapshot %s failed: %v", config.Name, err)
+		metrics.IncrCounter([]string{"core", "storage_snapshot", "error"}, 1)
+		status.LastSnapshotError = err.Error()
+		status.ConsecutiveErrors++
+	} else {
+		c.logger.Printf("[INFO] core: automated snapshot %s taken: %s", config.Name, url)
+		status.LastSnapshotURL = url
+		status.LastSnapshotSHA256 = sum
+		status.LastSnapshotKeys = keys
+		status.LastSnapshotError = ""
+		status.ConsecutiveErrors = 0
+	}
+
+	buf, err := json.Marshal(status)
+	if err == nil {
+		err = c.barrier.Put(&Entry{
+			Key:   coreSnapshotStatusPath + config.Name,
+			Value: buf,
+		})
+	}
+	if err != nil {
+		c.logger.Printf("[ERR] core: failed to persist automated snapshot status: %v", err)
+	}
+
+	// The configuration may have been removed meanwhile
+	c.snapshotLock.Lock()
+	if _, ok := c.snapshotConfigs[config.Name]; ok {
+		c.snapshotStatus[config.Name] = status
+	}
+	c.snapshotLock.Unlock()
+	return status
+}
+
+// uploadStorageSnapshot takes and uploads a snapshot, returning its
+// location, its SHA-256 checksum and its number of entries
+func (c *Core) uploadStorageSnapshot(config *StorageSnapshotConfig, start time.Time) (string, string, int, error) {
+	storage, err := newSnapshotStorage(config)
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	var buf bytes.Buffer
+	hash := sha256.New()
+	meta, err := writeStorageSnapshot(c.physical, io.MultiWriter(&buf, hash), start)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("failed to take snapshot: %v", err)
+	}
+
+	url, err := storage.upload(storageSnapshotFileName(config.FilePrefix, start), buf.Bytes())
+	if err != nil {
+		return "", "", 0, fmt.Errorf("failed to upload snapshot: %v", err)
+	}
+
+	// Only the snapshots named by this configuration are removed
+	names, err := storage.list()
+	if err != nil {
+		return "", "", 0, fmt.Errorf("failed to list snapshots: %v", err)
+	}
+	var snapshots []string
+	for _, name := range names {
+		if strings.HasPrefix(name, config.FilePrefix+"-") && strings.HasSuffix(name, storageSnapshotExtension) {
+			snapshots = append(snapshots, name)
+		}
+	}
+	sort.Strings(snapshots)
+	for len(snapshots) > config.Retain {
+		if err := storage.delete(snapshots[0]); err != nil {
+			return "", "", 0, fmt.Errorf("failed to remove snapshot %s: %v", snapshots[0], err)
+		}
+		snapshots = snapshots[1:]
+	}
+
+	return url, hex.EncodeToString(hash.Sum(nil)), meta.Keys, nil
+}
@@ -0,0 +1,279 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/hashicorp/vault/helper/awsutil"
+	"github.com/hashicorp/vault/helper/gcputil"
+)
+
+// snapshotAzureBlockSize is the size of the blocks in which snapshots are
+// uploaded to Azure, the maximum size of a block
+const snapshotAzureBlockSize = 4 * 1024 * 1024
+
+// snapshotStorage is where the automated snapshots are uploaded. The names
+// are relative to the path prefix of the configuration.
+type snapshotStorage interface {
+	// upload stores the snapshot and returns its location
+	upload(name string, data []byte) (string, error)
+
+	// list returns the names of the stored files
+	list() ([]string, error)
+
+	// delete removes the named file
+	delete(name string) error
+}
+
+// newSnapshotStorage returns the storage of the configuration
+func newSnapshotStorage(config *StorageSnapshotConfig) (snapshotStorage, error) {
+	switch config.StorageType {
+	case "local":
+		return &localSnapshotStorage{dir: config.PathPrefix}, nil
+
+	case "aws-s3":
+		credsConfig := &awsutil.CredentialsConfig{
+			AccessKey: config.AWSAccessKeyID,
+			SecretKey: config.AWSSecretAccessKey,
+		}
+		creds, err := credsConfig.GenerateCredentialChain()
+		if err != nil {
+			return nil, err
+		}
+		region := config.AWSS3Region
+		if region == "" {
+			region = "us-east-1"
+		}
+		return &s3SnapshotStorage{
+			client: s3.New(session.New(&aws.Config{
+				Credentials:      creds,
+				Endpoint:         aws.String(config.AWSS3Endpoint),
+				Region:           aws.String(region),
+				S3ForcePathStyle: aws.Bool(config.AWSS3ForcePathStyle),
+			})),
+			bucket: config.AWSS3Bucket,
+			prefix: config.PathPrefix,
+		}, nil
+
+	case "google-gcs":
+		credsConfig := &gcputil.CredentialsConfig{
+			CredentialsFile: config.GoogleServiceAccountKeyFile,
+			Scopes:          []string{gcputil.CloudStorageScope},
+		}
+		src, err := credsConfig.TokenSource()
+		if err != nil {
+			return nil, err
+		}
+		return &gcsSnapshotStorage{
+			client: gcputil.NewCloudStorage(config.GoogleGCSEndpoint, src),
+			bucket: config.GoogleGCSBucket,
+			prefix: config.PathPrefix,
+		}, nil
+
+	case "azure-blob":
+		client, err := storage.NewBasicClient(config.AzureAccountName, config.AzureAccountKey)
+		if err != nil {
+			return nil, err
+		}
+		return &azureSnapshotStorage{
+			client:    client.GetBlobService(),
+			container: config.AzureContainerName,
+			prefix:    config.PathPrefix,
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown storage_type %q", config.StorageType)
+}
+
+// localSnapshotStorage stores the snapshots in a directory of the active
+// node
+type localSnapshotStorage struct {
+	dir string
+}
+
+func (s *localSnapshotStorage) upload(name string, data []byte) (string, error) {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return "", err
+	}
+
+	// Write to a temporary file first so that a partial snapshot is never
+	// taken for a complete one
+	f, err := ioutil.TempFile(s.dir, ".tmp-"+name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+
+	path := filepath.Join(s.dir, name)
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return path, nil
+}
+
+func (s *localSnapshotStorage) list() ([]string, error) {
+	infos, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var names []string
+	for _, info := range infos {
+		if !info.IsDir() {
+			names = append(names, info.Name())
+		}
+	}
+	return names, nil
+}
+
+func (s *localSnapshotStorage) delete(name string) error {
+	return os.Remove(filepath.Join(s.dir, name))
+}
+
+// s3SnapshotStorage stores the snapshots in an S3 bucket
+type s3SnapshotStorage struct {
+	client *s3.S3
+	bucket string
+	prefix string
+}
+
+func (s *s3SnapshotStorage) upload(name string, data []byte) (string, error) {
+	_, err := s.client.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + name),
+		Body:   bytes.NewReader(data),
+	})
+	if err != nil {
+		return "", err
+	}
+	return "s3://" + s.bucket + "/" + s.prefix + name, nil
+}
+
+func (s *s3SnapshotStorage) list() ([]string, error) {
+	var names []string
+	err := s.client.ListObjectsPages(&s3.ListObjectsInput{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.prefix),
+	}, func(page *s3.ListObjectsOutput, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			names = append(names, strings.TrimPrefix(*obj.Key, s.prefix))
+		}
+		return true
+	})
+	return names, err
+}
+
+func (s *s3SnapshotStorage) delete(name string) error {
+	_, err := s.client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.prefix + name),
+	})
+	return err
+}
+
+// gcsSnapshotStorage stores the snapshots in a Google Cloud Storage bucket
+type gcsSnapshotStorage struct {
+	client *gcputil.CloudStorage
+	bucket string
+	prefix string
+}
+
+func (s *gcsSnapshotStorage) upload(name string, data []byte) (string, error) {
+	if err := s.client.Upload(s.bucket, s.prefix+name, bytes.NewReader(data), int64(len(data))); err != nil {
+		return "", err
+	}
+	return "gs://" + s.bucket + "/" + s.prefix + name, nil
+}
+
+func (s *gcsSnapshotStorage) list() ([]string, error) {
+	objects, err := s.client.List(s.bucket, s.prefix)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(objects))
+	for _, object := range objects {
+		names = append(names, strings.TrimPrefix(object, s.prefix))
+	}
+	return names, nil
+}
+
+func (s *gcsSnapshotStorage) delete(name string) error {
+	return s.client.Delete(s.bucket, s.prefix+name)
+}
+
+// azureSnapshotStorage stores the snapshots in an Azure Blob Storage
+// container
+type azureSnapshotStorage struct {
+	client    storage.BlobStorageClient
+	container string
+	prefix    string
+}
+
+func (s *azureSnapshotStorage) upload(name string, data []byte) (string, error) {
+	var blocks []storage.Block
+	for i := 0; i == 0 || len(data) > 0; i++ {
+		n := len(data)
+		if n > snapshotAzureBlockSize {
+			n = snapshotAzureBlockSize
+		}
+		blockID := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%08d", i)))
+		if err := s.client.PutBlock(s.container, s.prefix+name, blockID, data[:n]); err != nil {
+			return "", err
+		}
+		blocks = append(blocks, storage.Block{ID: blockID, Status: storage.BlockStatusUncommitted})
+		data = data[n:]
+	}
+	if err := s.client.PutBlockList(s.container, s.prefix+name, blocks); err != nil {
+		return "", err
+	}
+	return s.client.GetBlobURL(s.container, s.prefix+name), nil
+}
+
+func (s *azureSnapshotStorage) list() ([]string, error) {
+	var names []string
+	var marker string
+	for {
+		resp, err := s.client.ListBlobs(s.container, storage.ListBlobsParameters{
+			Prefix: s.prefix,
+			Marker: marker,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, blob := range resp.Blobs {
+			names = append(names, strings.TrimPrefix(blob.Name, s.prefix))
+		}
+		if resp.NextMarker == "" {
+			return names, nil
+		}
+		marker = resp.NextMarker
+	}
+}
+
+func (s *azureSnapshotStorage) delete(name string) error {
+	return s.client.DeleteBlob(s.container, s.prefix+name, nil)
+}
@@ -0,0 +1,145 @@
+package vault
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/errwrap"
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestStorageSnapshot(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "secret/foo", map[string]interface{}{
+		"value": "bar",
+	})
+
+	var buf bytes.Buffer
+	meta, err := writeStorageSnapshot(c.physical, &buf, time.Now())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	_, entries, err := readStorageSnapshot(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(entries) != meta.Keys || len(entries) == 0 {
+		t.Fatalf("bad: %d entries, %d keys", len(entries), meta.Keys)
+	}
+	for _, entry := range entries {
+		if storageSnapshotExcluded(entry.Key) {
+			t.Fatalf("excluded key %s in snapshot", entry.Key)
+		}
+		stored, err := c.physical.Get(entry.Key)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if stored == nil || !bytes.Equal(stored.Value, entry.Value) {
+			t.Fatalf("bad entry %s", entry.Key)
+		}
+	}
+
+	// A corrupted snapshot is rejected
+	var corrupted bytes.Buffer
+	if _, err := writeStorageSnapshot(c.physical, &corrupted, time.Now()); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if _, _, err := readStorageSnapshot(bytes.NewReader(corrupted.Bytes()[:corrupted.Len()/2])); err == nil {
+		t.Fatalf("expected truncated snapshot to fail")
+	}
+}
+
+func TestStorageSnapshot_Scheduled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-snapshot")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, _, root := TestCoreUnsealed(t)
+
+	// Invalid configurations are rejected
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/storage/snapshots/config/daily")
+	req.ClientToken = root
+	req.Data = map[string]interface{}{
+		"interval":     "1s",
+		"storage_type": "ftp",
+	}
+	if _, err := c.HandleRequest(req); err == nil || !errwrap.Contains(err, logical.ErrInvalidRequest.Error()) {
+		t.Fatalf("expected invalid request, got %v", err)
+	}
+
+	// A file the configuration does not own is kept
+	if err := ioutil.WriteFile(filepath.Join(dir, "other.tar.gz"), []byte("other"), 0600); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	testNamespaceRequest(t, c, root, logical.UpdateOperation, "sys/storage/snapshots/config/daily", map[string]interface{}{
+		"interval":     "1s",
+		"retain":       2,
+		"storage_type": "local",
+		"path_prefix":  dir,
+	})
+	resp := testNamespaceRequest(t, c, root, logical.ReadOperation, "sys/storage/snapshots/config/daily", nil)
+	if resp.Data["file_prefix"] != "vault-snapshot" || resp.Data["interval"] != int64(1) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// The first snapshot is taken at once
+	testPerfStandbyWait(t, func() bool {
+		status := c.StorageSnapshotStatus("daily")
+		return status != nil && !status.LastSnapshotEnd.IsZero()
+	})
+
+	// Two more snapshots, of which the oldest is removed
+	config := c.StorageSnapshotConfig("daily")
+	c.takeStorageSnapshot(config, time.Now().Add(time.Second))
+	status := c.takeStorageSnapshot(config, time.Now().Add(2*time.Second))
+	if status.LastSnapshotError != "" || status.ConsecutiveErrors != 0 {
+		t.Fatalf("bad: %#v", status)
+	}
+
+	resp = testNamespaceRequest(t, c, root, logical.ReadOperation, "sys/storage/snapshots/status/daily", nil)
+	if resp.Data["last_snapshot_url"] != status.LastSnapshotURL || resp.Data["next_snapshot_start"] == "" {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Sealing stops the snapshots
+	if err := c.Seal(root); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if c.snapshotStopCh != nil {
+		t.Fatalf("snapshots not stopped")
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "vault-snapshot-*"+storageSnapshotExtension))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(files) != 2 || files[1] != status.LastSnapshotURL {
+		t.Fatalf("bad: %v", files)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "other.tar.gz")); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The last snapshot matches its recorded checksum
+	data, err := ioutil.ReadFile(files[1])
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != status.LastSnapshotSHA256 {
+		t.Fatalf("checksum mismatch")
+	}
+	if _, _, err := readStorageSnapshot(bytes.NewReader(data)); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
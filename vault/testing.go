@@ -8,11 +8,13 @@ import (
 	"crypto/x509"
 	"encoding/pem"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
 	"os"
 	"os/exec"
+	"strings"
 	"testing"
 	"time"
 
@@ -118,6 +120,7 @@ func TestCoreWithSeal(t *testing.T, testSeal Seal) *Core {
 		LogicalBackends:    logicalBackends,
 		CredentialBackends: noopBackends,
 		DisableMlock:       true,
+		EnableRaw:          true,
 		Logger:             logger,
 	}
 	if testSeal != nil {
@@ -218,6 +221,16 @@ func TestKeyCopy(key []byte) []byte {
 	return result
 }
 
+// TestCoreStorageSnapshot returns a snapshot of the storage of the core, as
+// written by the automated snapshots.
+func TestCoreStorageSnapshot(t *testing.T, core *Core) []byte {
+	var buf bytes.Buffer
+	if _, err := writeStorageSnapshot(core.physical, &buf, time.Now()); err != nil {
+		t.Fatalf("err: %s", err)
+	}
+	return buf.Bytes()
+}
+
 var testLogicalBackends = map[string]logical.Factory{}
 
 // Starts the test server which responds to SSH authentication.
@@ -329,7 +342,7 @@ type noopAudit struct {
 }
 
 func (n *noopAudit) GetHash(data string) string {
-	return n.Config.Salt.GetIdentifiedHMAC(data)
+	return audit.HashString(n.Config.Salt, data)
 }
 
 func (n *noopAudit) LogRequest(a *logical.Auth, r *logical.Request, e error) error {
@@ -343,6 +356,15 @@ func (n *noopAudit) LogResponse(a *logical.Auth, r *logical.Request, re *logical
 type rawHTTP struct{}
 
 func (n *rawHTTP) HandleRequest(req *logical.Request) (*logical.Response, error) {
+	if req.Path == "stream" {
+		return &logical.Response{
+			Stream: &logical.ResponseStream{
+				ContentType: "plain/text",
+				Body:        ioutil.NopCloser(strings.NewReader(strings.Repeat("hello world", 10000))),
+			},
+		}, nil
+	}
+
 	return &logical.Response{
 		Data: map[string]interface{}{
 			logical.HTTPStatusCode:  200,
@@ -612,6 +634,10 @@ func TestCluster(t *testing.T, handlers []http.Handler, base *CoreConfig, unseal
 				coreConfig.AuditBackends[k] = v
 			}
 		}
+
+		coreConfig.ClusterForwardingSigning = base.ClusterForwardingSigning
+		coreConfig.ClusterForwardingBatching = base.ClusterForwardingBatching
+		coreConfig.PerformanceStandby = base.PerformanceStandby
 	}
 
 	c1, err := NewCore(coreConfig)
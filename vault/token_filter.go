@@ -0,0 +1,172 @@
+package vault
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/helper/strutil"
+)
+
+// TokenFilter selects the tokens of the token store by their properties.
+// The zero value of a field matches all the tokens.
+type TokenFilter struct {
+	// Policy is a policy the tokens must have
+	Policy string
+
+	// PathPrefix is a prefix of the path the tokens were created on, such
+	// as "auth/github/" for the tokens issued by a mount
+	PathPrefix string
+
+	// CreatedAfter and CreatedBefore bound the creation time of the tokens
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+
+	// MinTTL and MaxTTL bound the TTL the tokens were created with. Tokens
+	// without a TTL never expire, so they are above any MinTTL and never
+	// below MaxTTL.
+	MinTTL time.Duration
+	MaxTTL time.Duration
+}
+
+// empty returns whether the filter matches all the tokens
+func (f *TokenFilter) empty() bool {
+	return *f == TokenFilter{}
+}
+
+// validate checks that the bounds of the filter are consistent
+func (f *TokenFilter) validate() error {
+	if f.MinTTL < 0 || f.MaxTTL < 0 {
+		return fmt.Errorf("TTL bounds cannot be negative")
+	}
+	if f.MaxTTL != 0 && f.MinTTL > f.MaxTTL {
+		return fmt.Errorf("min_ttl cannot be greater than max_ttl")
+	}
+	if !f.CreatedAfter.IsZero() && !f.CreatedBefore.IsZero() && !f.CreatedAfter.Before(f.CreatedBefore) {
+		return fmt.Errorf("created_after must be before created_before")
+	}
+	return nil
+}
+
+// matches returns whether the token entry is selected by the filter
+func (f *TokenFilter) matches(te *TokenEntry) bool {
+	if f.Policy != "" && !strutil.StrListContains(te.Policies, f.Policy) {
+		return false
+	}
+	if !strings.HasPrefix(te.Path, f.PathPrefix) {
+		return false
+	}
+
+	created := time.Unix(te.CreationTime, 0)
+	if !f.CreatedAfter.IsZero() && created.Before(f.CreatedAfter) {
+		return false
+	}
+	if !f.CreatedBefore.IsZero() && !created.Before(f.CreatedBefore) {
+		return false
+	}
+
+	if f.MinTTL != 0 && te.TTL != 0 && te.TTL < f.MinTTL {
+		return false
+	}
+	if f.MaxTTL != 0 && (te.TTL == 0 || te.TTL > f.MaxTTL) {
+		return false
+	}
+	return true
+}
+
+// TokenRevokeResult is the result of revoking the tokens selected by a
+// filter
+type TokenRevokeResult struct {
+	// Revoked are the accessors of the revoked tokens, or of the tokens
+	// that would be revoked in a dry run
+	Revoked []string
+
+	// Failed maps the accessors of the tokens that could not be revoked to
+	// the error
+	Failed map[string]string
+}
+
+// FilterTokens returns the entries of the tokens selected by the filter,
+// sorted by accessor. The tokens are found through the accessor index, so
+// batch tokens are never returned. Unreadable accessor entries are skipped
+// and reported as warnings.
+func (ts *TokenStore) FilterTokens(filter *TokenFilter) ([]*TokenEntry, []string, error) {
+	saltedAccessors, err := ts.view.List(accessorPrefix)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list accessors: %v", err)
+	}
+
+	var entries []*TokenEntry
+	var warnings []string
+	for _, saltedAccessor := range saltedAccessors {
+		aEntry, err := ts.lookupBySaltedAccessor(saltedAccessor)
+		if err != nil {
+			warnings = append(warnings, "Found an accessor entry that could not be successfully decoded")
+			continue
+		}
+		if aEntry.TokenID == "" {
+			continue
+		}
+
+		te, err := ts.Lookup(aEntry.TokenID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if te == nil || !filter.matches(te) {
+			continue
+		}
+		entries = append(entries, te)
+	}
+
+	sort.Sort(tokensByAccessor(entries))
+	return entries, warnings, nil
+}
+
+// RevokeTokens revokes the tokens selected by the filter, along with their
+// child tokens. With dryRun, the tokens are only reported. The filter must
+// not be empty so that all the tokens cannot be revoked by mistake.
+func (ts *TokenStore) RevokeTokens(filter *TokenFilter, dryRun bool) (*TokenRevokeResult, []string, error) {
+	if filter.empty() {
+		return nil, nil, fmt.Errorf("at least one filter is required")
+	}
+
+	entries, warnings, err := ts.FilterTokens(filter)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := &TokenRevokeResult{
+		Revoked: []string{},
+		Failed:  map[string]string{},
+	}
+	for _, te := range entries {
+		if !dryRun {
+			// The token may have been revoked along with a parent that
+			// matched the filter as well
+			current, err := ts.Lookup(te.ID)
+			if err != nil {
+				result.Failed[te.Accessor] = err.Error()
+				continue
+			}
+			if current == nil {
+				result.Revoked = append(result.Revoked, te.Accessor)
+				continue
+			}
+
+			if err := ts.RevokeTree(te.ID); err != nil {
+				result.Failed[te.Accessor] = err.Error()
+				continue
+			}
+		}
+		result.Revoked = append(result.Revoked, te.Accessor)
+	}
+	return result, warnings, nil
+}
+
+// tokensByAccessor sorts token entries by accessor
+type tokensByAccessor []*TokenEntry
+
+func (t tokensByAccessor) Len() int           { return len(t) }
+func (t tokensByAccessor) Less(i, j int) bool { return t[i].Accessor < t[j].Accessor }
+func (t tokensByAccessor) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
@@ -0,0 +1,144 @@
+package vault
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestTokenFilter_Matches(t *testing.T) {
+	now := time.Now()
+	te := &TokenEntry{
+		Path:         "auth/github/login",
+		Policies:     []string{"default", "dev"},
+		CreationTime: now.Unix(),
+		TTL:          time.Hour,
+	}
+
+	cases := []struct {
+		filter TokenFilter
+		match  bool
+	}{
+		{TokenFilter{}, true},
+		{TokenFilter{Policy: "dev"}, true},
+		{TokenFilter{Policy: "ops"}, false},
+		{TokenFilter{PathPrefix: "auth/github/"}, true},
+		{TokenFilter{PathPrefix: "auth/ldap/"}, false},
+		{TokenFilter{CreatedAfter: now.Add(-time.Minute)}, true},
+		{TokenFilter{CreatedAfter: now.Add(time.Minute)}, false},
+		{TokenFilter{CreatedBefore: now.Add(time.Minute)}, true},
+		{TokenFilter{CreatedBefore: now.Add(-time.Minute)}, false},
+		{TokenFilter{MinTTL: time.Minute}, true},
+		{TokenFilter{MinTTL: 2 * time.Hour}, false},
+		{TokenFilter{MaxTTL: time.Hour}, true},
+		{TokenFilter{MaxTTL: time.Minute}, false},
+		{TokenFilter{Policy: "dev", PathPrefix: "auth/ldap/"}, false},
+	}
+	for i, c := range cases {
+		if c.filter.matches(te) != c.match {
+			t.Fatalf("%d: expected match %t for %#v", i, c.match, c.filter)
+		}
+	}
+
+	// Tokens without a TTL are above any minimum and below no maximum
+	te.TTL = 0
+	if !(&TokenFilter{MinTTL: time.Hour}).matches(te) {
+		t.Fatal("expected match")
+	}
+	if (&TokenFilter{MaxTTL: time.Hour}).matches(te) {
+		t.Fatal("expected no match")
+	}
+}
+
+func TestSystemBackend_TokensRevoke(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+	ts := c.tokenStore
+
+	create := func(path string, policies []string) *TokenEntry {
+		te := &TokenEntry{
+			Path:         path,
+			Policies:     policies,
+			CreationTime: time.Now().Unix(),
+		}
+		if err := ts.create(te); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		return te
+	}
+	github1 := create("auth/github/login", []string{"dev"})
+	github2 := create("auth/github/login", []string{"ops"})
+	ldap := create("auth/ldap/login/bob", []string{"dev"})
+
+	accessors := func(tokens ...*TokenEntry) []string {
+		var list []string
+		for _, te := range tokens {
+			list = append(list, te.Accessor)
+		}
+		sort.Strings(list)
+		return list
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/tokens/accessors")
+	req.ClientToken = root
+	req.Data["policy"] = "dev"
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	var listed []string
+	for _, token := range resp.Data["tokens"].([]map[string]interface{}) {
+		listed = append(listed, token["accessor"].(string))
+	}
+	if !reflect.DeepEqual(listed, accessors(github1, ldap)) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Revocation requires a filter
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/tokens/revoke")
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatal("expected error")
+	}
+
+	// A dry run revokes nothing
+	req.Data["path_prefix"] = "auth/github/"
+	req.Data["dry_run"] = true
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(resp.Data["revoked"], accessors(github1, github2)) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	if te, err := ts.Lookup(github1.ID); err != nil || te == nil {
+		t.Fatalf("bad: %#v %v", te, err)
+	}
+
+	req.Data["dry_run"] = false
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(resp.Data["revoked"], accessors(github1, github2)) || resp.Data["total"] != 2 {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+	for _, te := range []*TokenEntry{github1, github2} {
+		if out, err := ts.Lookup(te.ID); err != nil || out != nil {
+			t.Fatalf("bad: %#v %v", out, err)
+		}
+	}
+	if te, err := ts.Lookup(ldap.ID); err != nil || te == nil {
+		t.Fatalf("bad: %#v %v", te, err)
+	}
+
+	// Inconsistent bounds are rejected
+	req = logical.TestRequest(t, logical.UpdateOperation, "sys/tokens/accessors")
+	req.ClientToken = root
+	req.Data["created_after"] = "yesterday"
+	if _, err := c.HandleRequest(req); err == nil {
+		t.Fatal("expected error")
+	}
+}
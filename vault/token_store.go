@@ -1,6 +1,7 @@
 package vault
 
 import (
+	"crypto/cipher"
 	"encoding/json"
 	"fmt"
 	"regexp"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/armon/go-metrics"
 	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/helper/cidrutil"
 	"github.com/hashicorp/vault/helper/duration"
 	"github.com/hashicorp/vault/helper/jsonutil"
 	"github.com/hashicorp/vault/helper/locksutil"
@@ -18,6 +20,7 @@ import (
 	"github.com/hashicorp/vault/helper/strutil"
 	"github.com/hashicorp/vault/logical"
 	"github.com/hashicorp/vault/logical/framework"
+	"github.com/hashicorp/vault/physical"
 	"github.com/mitchellh/mapstructure"
 )
 
@@ -40,6 +43,10 @@ const (
 
 	// rolesPrefix is the prefix used to store role information
 	rolesPrefix = "roles/"
+
+	// namespaceRolesPrefix is the prefix used to store the roles of the
+	// namespaces, under the ID of their namespace
+	namespaceRolesPrefix = "namespace-roles/"
 )
 
 var (
@@ -66,6 +73,9 @@ type TokenStore struct {
 	policyLookupFunc func(string) (*Policy, error)
 
 	tokenLocks map[string]*sync.RWMutex
+
+	batchLock sync.Mutex
+	batchGCM  cipher.AEAD
 }
 
 // NewTokenStore is used to construct a token store that is
@@ -184,6 +194,24 @@ func NewTokenStore(c *Core, config *logical.BackendConfig) (*TokenStore, error)
 						Default:     true,
 						Description: tokenRenewableHelp,
 					},
+
+					"token_type": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Default:     TokenTypeService,
+						Description: tokenTypeHelp,
+					},
+
+					"bound_cidrs": &framework.FieldSchema{
+						Type:        framework.TypeString,
+						Default:     "",
+						Description: tokenBoundCIDRsHelp,
+					},
+
+					"num_uses": &framework.FieldSchema{
+						Type:        framework.TypeInt,
+						Default:     0,
+						Description: tokenNumUsesHelp,
+					},
 				},
 
 				Callbacks: map[logical.Operation]framework.OperationFunc{
@@ -478,6 +506,20 @@ type TokenEntry struct {
 	// through the create endpoint; periods managed by roles or other auth
 	// backends are subject to those renewal rules.
 	Period time.Duration `json:"period" mapstructure:"period" structs:"period"`
+
+	// The type of the token, TokenTypeService if empty
+	Type string `json:"type,omitempty" mapstructure:"type" structs:"type"`
+
+	// If set, the CIDR blocks the token can be used from
+	BoundCIDRs []string `json:"bound_cidrs,omitempty" mapstructure:"bound_cidrs" structs:"bound_cidrs"`
+
+	// If set, the identity entity the token is tied to, whose policies are
+	// granted to the token
+	EntityID string `json:"entity_id,omitempty" mapstructure:"entity_id" structs:"entity_id"`
+
+	// If set, the ID of the namespace the token was issued in, whose
+	// policies are granted to the token
+	NamespaceID string `json:"namespace_id,omitempty" mapstructure:"namespace_id" structs:"namespace_id"`
 }
 
 // tsRoleEntry contains token store role information
@@ -509,6 +551,18 @@ type tsRoleEntry struct {
 	// If set, the token entry will have an explicit maximum TTL set, rather
 	// than deferring to role/mount values
 	ExplicitMaxTTL time.Duration `json:"explicit_max_ttl" mapstructure:"explicit_max_ttl" structs:"explicit_max_ttl"`
+
+	// The type of the tokens created using this role, TokenTypeService if
+	// empty
+	TokenType string `json:"token_type" mapstructure:"token_type" structs:"token_type"`
+
+	// If set, tokens created using this role can only be used from these
+	// CIDR blocks
+	BoundCIDRs []string `json:"bound_cidrs" mapstructure:"bound_cidrs" structs:"bound_cidrs"`
+
+	// If non-zero, the maximum number of uses of the tokens created using
+	// this role
+	NumUses int `json:"num_uses" mapstructure:"num_uses" structs:"num_uses"`
 }
 
 type accessorEntry struct {
@@ -544,6 +598,10 @@ func (ts *TokenStore) rootToken() (*TokenEntry, error) {
 
 func (ts *TokenStore) tokenStoreAccessorList(
 	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
+	nsID, err := ts.callerNamespaceID(req)
+	if err != nil {
+		return nil, err
+	}
 	entries, err := ts.view.List(accessorPrefix)
 	if err != nil {
 		return nil, err
@@ -560,7 +618,16 @@ func (ts *TokenStore) tokenStoreAccessorList(
 		}
 		if aEntry.TokenID == "" {
 			resp.AddWarning(fmt.Sprintf("Found an accessor entry missing a token: %v", aEntry.AccessorID))
-		} else {
+			continue
+		}
+
+		// Only the accessors of the tokens of the namespace of the caller
+		// are listed
+		te, err := ts.Lookup(aEntry.TokenID)
+		if err != nil {
+			return nil, err
+		}
+		if te != nil && te.NamespaceID == nsID {
 			ret = append(ret, aEntry.AccessorID)
 		}
 	}
@@ -572,14 +639,15 @@ func (ts *TokenStore) tokenStoreAccessorList(
 }
 
 // createAccessor is used to create an identifier for the token ID.
-// A storage index, mapping the accessor to the token ID is also created.
-func (ts *TokenStore) createAccessor(entry *TokenEntry) error {
+// It returns the storage index mapping the accessor to the token ID, which
+// is written along with the token.
+func (ts *TokenStore) createAccessor(entry *TokenEntry) (*TxnEntry, error) {
 	defer metrics.MeasureSince([]string{"token", "createAccessor"}, time.Now())
 
 	// Create a random accessor
 	accessorUUID, err := uuid.GenerateUUID()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	entry.Accessor = accessorUUID
 
@@ -592,20 +660,23 @@ func (ts *TokenStore) createAccessor(entry *TokenEntry) error {
 	}
 	aEntryBytes, err := jsonutil.EncodeJSON(aEntry)
 	if err != nil {
-		return fmt.Errorf("failed to marshal accessor index entry: %v", err)
+		return nil, fmt.Errorf("failed to marshal accessor index entry: %v", err)
 	}
 
-	le := &logical.StorageEntry{Key: path, Value: aEntryBytes}
-	if err := ts.view.Put(le); err != nil {
-		return fmt.Errorf("failed to persist accessor index entry: %v", err)
-	}
-	return nil
+	return &TxnEntry{
+		Operation: physical.PutOperation,
+		Entry:     &Entry{Key: path, Value: aEntryBytes},
+	}, nil
 }
 
 // Create is used to create a new token entry. The entry is assigned
 // a newly generated ID if not provided.
 func (ts *TokenStore) create(entry *TokenEntry) error {
 	defer metrics.MeasureSince([]string{"token", "create"}, time.Now())
+	if entry.Type == TokenTypeBatch {
+		return ts.createBatch(entry)
+	}
+
 	// Generate an ID if necessary
 	if entry.ID == "" {
 		entryUUID, err := uuid.GenerateUUID()
@@ -617,12 +688,12 @@ func (ts *TokenStore) create(entry *TokenEntry) error {
 
 	entry.Policies = policyutil.SanitizePolicies(entry.Policies, false)
 
-	err := ts.createAccessor(entry)
+	accessorIndex, err := ts.createAccessor(entry)
 	if err != nil {
 		return err
 	}
 
-	return ts.storeCommon(entry, true)
+	return ts.storeCommon(entry, true, accessorIndex)
 }
 
 // Store is used to store an updated token entry without writing the
@@ -633,8 +704,9 @@ func (ts *TokenStore) store(entry *TokenEntry) error {
 }
 
 // storeCommon handles the actual storage of an entry, possibly generating
-// secondary indexes
-func (ts *TokenStore) storeCommon(entry *TokenEntry, writeSecondary bool) error {
+// secondary indexes. The entry is written in a single transaction with its
+// indexes and the given extra operations.
+func (ts *TokenStore) storeCommon(entry *TokenEntry, writeSecondary bool, txns ...*TxnEntry) error {
 	saltedId := ts.SaltID(entry.ID)
 
 	// Marshal the entry
@@ -645,8 +717,9 @@ func (ts *TokenStore) storeCommon(entry *TokenEntry, writeSecondary bool) error
 
 	if writeSecondary {
 		// Write the secondary index if necessary. This is done before the
-		// primary index because we'd rather have a dangling pointer with
-		// a missing primary instead of missing the parent index and potentially
+		// primary index because, should the backend not support
+		// transactions, we'd rather have a dangling pointer with a missing
+		// primary instead of missing the parent index and potentially
 		// escaping the revocation chain.
 		if entry.Parent != "" {
 			// Ensure the parent exists
@@ -659,18 +732,19 @@ func (ts *TokenStore) storeCommon(entry *TokenEntry, writeSecondary bool) error
 			}
 
 			// Create the index entry
-			path := parentPrefix + ts.SaltID(entry.Parent) + "/" + saltedId
-			le := &logical.StorageEntry{Key: path}
-			if err := ts.view.Put(le); err != nil {
-				return fmt.Errorf("failed to persist entry: %v", err)
-			}
+			txns = append(txns, &TxnEntry{
+				Operation: physical.PutOperation,
+				Entry:     &Entry{Key: parentPrefix + ts.SaltID(entry.Parent) + "/" + saltedId},
+			})
 		}
 	}
 
 	// Write the primary ID
-	path := lookupPrefix + saltedId
-	le := &logical.StorageEntry{Key: path, Value: enc}
-	if err := ts.view.Put(le); err != nil {
+	txns = append(txns, &TxnEntry{
+		Operation: physical.PutOperation,
+		Entry:     &Entry{Key: lookupPrefix + saltedId, Value: enc},
+	})
+	if err := ts.view.Transaction(txns); err != nil {
 		return fmt.Errorf("failed to persist entry: %v", err)
 	}
 	return nil
@@ -763,6 +837,11 @@ func (ts *TokenStore) Lookup(id string) (*TokenEntry, error) {
 		return nil, fmt.Errorf("cannot lookup blank token")
 	}
 
+	// Batch tokens carry their own entry
+	if IsBatchToken(id) {
+		return ts.lookupBatch(id)
+	}
+
 	lock := ts.getTokenLock(id)
 	lock.RLock()
 	defer lock.RUnlock()
@@ -805,6 +884,9 @@ func (ts *TokenStore) Revoke(id string) error {
 	if id == "" {
 		return fmt.Errorf("cannot revoke blank token")
 	}
+	if IsBatchToken(id) {
+		return fmt.Errorf("batch tokens cannot be revoked")
+	}
 
 	return ts.revokeSalted(ts.SaltID(id))
 }
@@ -818,26 +900,26 @@ func (ts *TokenStore) revokeSalted(saltedId string) error {
 		return err
 	}
 
-	// Nuke the primary key first
-	path := lookupPrefix + saltedId
-	if ts.view.Delete(path); err != nil {
-		return fmt.Errorf("failed to delete entry: %v", err)
-	}
-
-	// Clear the secondary index if any
+	// Nuke the primary key first, along with the secondary index and the
+	// accessor index if any
+	txns := []*TxnEntry{{
+		Operation: physical.DeleteOperation,
+		Entry:     &Entry{Key: lookupPrefix + saltedId},
+	}}
 	if entry != nil && entry.Parent != "" {
-		path := parentPrefix + ts.SaltID(entry.Parent) + "/" + saltedId
-		if ts.view.Delete(path); err != nil {
-			return fmt.Errorf("failed to delete entry: %v", err)
-		}
+		txns = append(txns, &TxnEntry{
+			Operation: physical.DeleteOperation,
+			Entry:     &Entry{Key: parentPrefix + ts.SaltID(entry.Parent) + "/" + saltedId},
+		})
 	}
-
-	// Clear the accessor index if any
 	if entry != nil && entry.Accessor != "" {
-		path := accessorPrefix + ts.SaltID(entry.Accessor)
-		if ts.view.Delete(path); err != nil {
-			return fmt.Errorf("failed to delete entry: %v", err)
-		}
+		txns = append(txns, &TxnEntry{
+			Operation: physical.DeleteOperation,
+			Entry:     &Entry{Key: accessorPrefix + ts.SaltID(entry.Accessor)},
+		})
+	}
+	if err := ts.view.Transaction(txns); err != nil {
+		return fmt.Errorf("failed to delete entry: %v", err)
 	}
 
 	// Revoke all secrets under this token
@@ -864,6 +946,9 @@ func (ts *TokenStore) RevokeTree(id string) error {
 	if id == "" {
 		return fmt.Errorf("cannot revoke blank token")
 	}
+	if IsBatchToken(id) {
+		return fmt.Errorf("batch tokens cannot be revoked")
+	}
 
 	// Get the salted ID
 	saltedId := ts.SaltID(id)
@@ -905,7 +990,11 @@ func (ts *TokenStore) revokeTreeSalted(saltedId string) error {
 func (ts *TokenStore) handleCreateAgainstRole(
 	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
 	name := d.Get("role_name").(string)
-	roleEntry, err := ts.tokenStoreRole(name)
+	nsID, err := ts.callerNamespaceID(req)
+	if err != nil {
+		return nil, err
+	}
+	roleEntry, err := ts.tokenStoreRole(nsID, name)
 	if err != nil {
 		return nil, err
 	}
@@ -920,6 +1009,40 @@ func (ts *TokenStore) lookupByAccessor(accessor string) (accessorEntry, error) {
 	return ts.lookupBySaltedAccessor(ts.SaltID(accessor))
 }
 
+// lookupCallerAccessor looks up an accessor of a token of the namespace of
+// the caller. The accessors of the tokens of other namespaces are invalid.
+func (ts *TokenStore) lookupCallerAccessor(req *logical.Request, accessor string) (accessorEntry, error) {
+	nsID, err := ts.callerNamespaceID(req)
+	if err != nil {
+		return accessorEntry{}, err
+	}
+	aEntry, err := ts.lookupByAccessor(accessor)
+	if err != nil {
+		return accessorEntry{}, err
+	}
+	te, err := ts.Lookup(aEntry.TokenID)
+	if err != nil {
+		return accessorEntry{}, fmt.Errorf("failed to look up token using accessor index: %s", err)
+	}
+	if te != nil && te.NamespaceID != nsID {
+		return accessorEntry{}, &StatusBadRequest{Err: "invalid accessor"}
+	}
+	return aEntry, nil
+}
+
+// callerNamespaceID returns the ID of the namespace of the token of the
+// request, the empty string for the root namespace
+func (ts *TokenStore) callerNamespaceID(req *logical.Request) (string, error) {
+	te, err := ts.Lookup(req.ClientToken)
+	if err != nil {
+		return "", err
+	}
+	if te == nil {
+		return "", logical.ErrPermissionDenied
+	}
+	return te.NamespaceID, nil
+}
+
 func (ts *TokenStore) lookupBySaltedAccessor(saltedAccessor string) (accessorEntry, error) {
 	entry, err := ts.view.Get(accessorPrefix + saltedAccessor)
 	var aEntry accessorEntry
@@ -963,7 +1086,7 @@ func (ts *TokenStore) handleUpdateLookupAccessor(req *logical.Request, data *fra
 		}
 	}
 
-	aEntry, err := ts.lookupByAccessor(accessor)
+	aEntry, err := ts.lookupCallerAccessor(req, accessor)
 	if err != nil {
 		return nil, err
 	}
@@ -1011,7 +1134,7 @@ func (ts *TokenStore) handleUpdateRevokeAccessor(req *logical.Request, data *fra
 		}
 	}
 
-	aEntry, err := ts.lookupByAccessor(accessor)
+	aEntry, err := ts.lookupCallerAccessor(req, accessor)
 	if err != nil {
 		return nil, err
 	}
@@ -1053,6 +1176,13 @@ func (ts *TokenStore) handleCreateCommon(
 			logical.ErrInvalidRequest
 	}
 
+	// A batch token cannot create a new token, since it could not be
+	// revoked along with its parent
+	if parent.Type == TokenTypeBatch {
+		return logical.ErrorResponse("batch tokens cannot create child tokens"),
+			logical.ErrInvalidRequest
+	}
+
 	// Check if the client token has sudo/root privileges for the requested path
 	isSudo := ts.System().SudoPrivilege(req.MountPoint+req.Path, req.ClientToken)
 
@@ -1070,6 +1200,8 @@ func (ts *TokenStore) handleCreateCommon(
 		DisplayName     string `mapstructure:"display_name"`
 		NumUses         int    `mapstructure:"num_uses"`
 		Period          string
+		Type            string
+		BoundCIDRs      interface{} `mapstructure:"bound_cidrs"`
 	}
 	if err := mapstructure.WeakDecode(req.Data, &data); err != nil {
 		return logical.ErrorResponse(fmt.Sprintf(
@@ -1082,6 +1214,24 @@ func (ts *TokenStore) handleCreateCommon(
 			logical.ErrInvalidRequest
 	}
 
+	// The type of the token is the one of the role, if any
+	tokenType := data.Type
+	if role != nil {
+		roleType := role.TokenType
+		if roleType == "" {
+			roleType = TokenTypeService
+		}
+		if tokenType != "" && tokenType != roleType {
+			return logical.ErrorResponse(fmt.Sprintf("token type must be %q for this role", roleType)),
+				logical.ErrInvalidRequest
+		}
+		tokenType = roleType
+	}
+	if !validTokenType(tokenType) {
+		return logical.ErrorResponse(fmt.Sprintf("invalid token type %q", tokenType)),
+			logical.ErrInvalidRequest
+	}
+
 	// Setup the token entry
 	te := TokenEntry{
 		Parent: req.ClientToken,
@@ -1102,6 +1252,30 @@ func (ts *TokenStore) handleCreateCommon(
 		renewable = *data.Renewable
 	}
 
+	// The CIDR blocks are given as a list or a comma-separated string
+	var boundCIDRsList []string
+	switch raw := data.BoundCIDRs.(type) {
+	case nil:
+	case string:
+		boundCIDRsList = strings.Split(raw, ",")
+	default:
+		if err := mapstructure.WeakDecode(raw, &boundCIDRsList); err != nil {
+			return logical.ErrorResponse(fmt.Sprintf(
+				"Error decoding request: %s", err)), logical.ErrInvalidRequest
+		}
+	}
+	boundCIDRs, err := cidrutil.ParseCIDRs(boundCIDRsList)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("invalid bound_cidrs: %v", err)), logical.ErrInvalidRequest
+	}
+	te.BoundCIDRs = boundCIDRs
+
+	// Batch tokens have no lease to renew
+	if tokenType == TokenTypeBatch {
+		te.Type = TokenTypeBatch
+		renewable = false
+	}
+
 	// If the role is not nil, we add the role name as part of the token's
 	// path. This makes it much easier to later revoke tokens that were issued
 	// by a role (using revoke-prefix). Users can further specify a PathSuffix
@@ -1119,6 +1293,15 @@ func (ts *TokenStore) handleCreateCommon(
 		if role.PathSuffix != "" {
 			te.Path = fmt.Sprintf("%s/%s", te.Path, role.PathSuffix)
 		}
+
+		// The role's CIDR blocks cannot be escaped
+		if len(role.BoundCIDRs) > 0 {
+			if len(te.BoundCIDRs) > 0 {
+				return logical.ErrorResponse("bound_cidrs cannot be specified when the role sets them"),
+					logical.ErrInvalidRequest
+			}
+			te.BoundCIDRs = role.BoundCIDRs
+		}
 	}
 
 	// Attach the given display name if any
@@ -1135,6 +1318,10 @@ func (ts *TokenStore) handleCreateCommon(
 			return logical.ErrorResponse("root or sudo privileges required to specify token id"),
 				logical.ErrInvalidRequest
 		}
+		if IsBatchToken(data.ID) {
+			return logical.ErrorResponse(fmt.Sprintf("token id cannot begin with %q", batchTokenPrefix)),
+				logical.ErrInvalidRequest
+		}
 		te.ID = data.ID
 	}
 
@@ -1205,6 +1392,24 @@ func (ts *TokenStore) handleCreateCommon(
 		return logical.ErrorResponse("root tokens may not be created without parent token being root"), logical.ErrInvalidRequest
 	}
 
+	// Child tokens act on behalf of the same identity as their parent
+	te.EntityID = parent.EntityID
+
+	// Child tokens belong to the namespace of their parent
+	te.NamespaceID = parent.NamespaceID
+
+	// A token bound to CIDR blocks cannot create tokens escaping them unless
+	// the client has root or sudo privileges
+	if len(parent.BoundCIDRs) > 0 {
+		switch {
+		case len(te.BoundCIDRs) == 0:
+			te.BoundCIDRs = parent.BoundCIDRs
+		case !isSudo && !strutil.EquivalentSlices(te.BoundCIDRs, parent.BoundCIDRs):
+			return logical.ErrorResponse("root or sudo privileges required to change the bound CIDR blocks of child tokens"),
+				logical.ErrInvalidRequest
+		}
+	}
+
 	//
 	// NOTE: Do not modify policies below this line. We need the checks above
 	// to be the last checks as they must look at the final policy set.
@@ -1306,6 +1511,17 @@ func (ts *TokenStore) handleCreateCommon(
 				resp.AddWarning(fmt.Sprintf("Period specified both during creation call and in role; using the lesser value of %d seconds", int64(periodToUse.Seconds())))
 			}
 		}
+		if role.NumUses != 0 {
+			switch {
+			case te.NumUses == 0:
+				te.NumUses = role.NumUses
+			default:
+				if role.NumUses < te.NumUses {
+					te.NumUses = role.NumUses
+				}
+				resp.AddWarning(fmt.Sprintf("Number of uses specified both during creation call and in role; using the lesser value of %d", te.NumUses))
+			}
+		}
 	}
 
 	sysView := ts.System()
@@ -1373,9 +1589,13 @@ func (ts *TokenStore) handleCreateCommon(
 		},
 		ClientToken: te.ID,
 		Accessor:    te.Accessor,
+		TokenType:   te.Type,
+		EntityID:    te.EntityID,
 	}
 
-	if ts.policyLookupFunc != nil {
+	// The policies of a namespace are not in the policy store of the root
+	// namespace
+	if ts.policyLookupFunc != nil && te.NamespaceID == "" {
 		for _, p := range te.Policies {
 			policy, err := ts.policyLookupFunc(p)
 			if err != nil {
@@ -1507,6 +1727,7 @@ func (ts *TokenStore) handleLookup(
 			"creation_ttl":     int64(out.TTL.Seconds()),
 			"ttl":              int64(0),
 			"explicit_max_ttl": int64(out.ExplicitMaxTTL.Seconds()),
+			"type":             TokenTypeService,
 		},
 	}
 
@@ -1520,6 +1741,23 @@ func (ts *TokenStore) handleLookup(
 	if out.Period != 0 {
 		resp.Data["period"] = int64(out.Period.Seconds())
 	}
+	if len(out.BoundCIDRs) > 0 {
+		resp.Data["bound_cidrs"] = out.BoundCIDRs
+	}
+	if out.EntityID != "" {
+		resp.Data["entity_id"] = out.EntityID
+	}
+	if out.NamespaceID != "" {
+		resp.Data["namespace_id"] = out.NamespaceID
+	}
+
+	// Batch tokens have no lease, their TTL is part of the token
+	if out.Type == TokenTypeBatch {
+		resp.Data["type"] = TokenTypeBatch
+		resp.Data["ttl"] = int64(out.batchExpireTime().Sub(time.Now().Round(time.Second)).Seconds())
+		resp.Data["renewable"] = false
+		return resp, nil
+	}
 
 	// Fetch the last renewal time
 	leaseTimes, err := ts.expiration.FetchLeaseTimesByToken(out.Path, out.ID)
@@ -1575,6 +1813,9 @@ func (ts *TokenStore) handleRenew(
 	if te == nil {
 		return logical.ErrorResponse("token not found"), logical.ErrInvalidRequest
 	}
+	if te.Type == TokenTypeBatch {
+		return logical.ErrorResponse("batch tokens cannot be renewed"), logical.ErrInvalidRequest
+	}
 
 	// Renew the token and its children
 	return ts.expiration.RenewToken(req, te.Path, te.ID, increment)
@@ -1634,7 +1875,7 @@ func (ts *TokenStore) authRenew(
 		return f(req, d)
 	}
 
-	role, err := ts.tokenStoreRole(te.Role)
+	role, err := ts.tokenStoreRole(te.NamespaceID, te.Role)
 	if err != nil {
 		return nil, fmt.Errorf("error looking up role %s: %s", te.Role, err)
 	}
@@ -1666,8 +1907,18 @@ func (ts *TokenStore) authRenew(
 	return f(req, d)
 }
 
-func (ts *TokenStore) tokenStoreRole(name string) (*tsRoleEntry, error) {
-	entry, err := ts.view.Get(fmt.Sprintf("%s%s", rolesPrefix, name))
+// tokenStoreRolePath returns the storage path of a role of the given
+// namespace. Each namespace has its own roles, so that a role cannot be
+// used outside of the namespace it was written in.
+func tokenStoreRolePath(nsID, name string) string {
+	if nsID == "" {
+		return rolesPrefix + name
+	}
+	return namespaceRolesPrefix + nsID + "/" + name
+}
+
+func (ts *TokenStore) tokenStoreRole(nsID, name string) (*tsRoleEntry, error) {
+	entry, err := ts.view.Get(tokenStoreRolePath(nsID, name))
 	if err != nil {
 		return nil, err
 	}
@@ -1685,7 +1936,11 @@ func (ts *TokenStore) tokenStoreRole(name string) (*tsRoleEntry, error) {
 
 func (ts *TokenStore) tokenStoreRoleList(
 	req *logical.Request, d *framework.FieldData) (*logical.Response, error) {
-	entries, err := ts.view.List(rolesPrefix)
+	nsID, err := ts.callerNamespaceID(req)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := ts.view.List(tokenStoreRolePath(nsID, ""))
 	if err != nil {
 		return nil, err
 	}
@@ -1700,7 +1955,11 @@ func (ts *TokenStore) tokenStoreRoleList(
 
 func (ts *TokenStore) tokenStoreRoleDelete(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	err := ts.view.Delete(fmt.Sprintf("%s%s", rolesPrefix, data.Get("role_name").(string)))
+	nsID, err := ts.callerNamespaceID(req)
+	if err != nil {
+		return nil, err
+	}
+	err = ts.view.Delete(tokenStoreRolePath(nsID, data.Get("role_name").(string)))
 	if err != nil {
 		return nil, err
 	}
@@ -1710,7 +1969,11 @@ func (ts *TokenStore) tokenStoreRoleDelete(
 
 func (ts *TokenStore) tokenStoreRoleRead(
 	req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	role, err := ts.tokenStoreRole(data.Get("role_name").(string))
+	nsID, err := ts.callerNamespaceID(req)
+	if err != nil {
+		return nil, err
+	}
+	role, err := ts.tokenStoreRole(nsID, data.Get("role_name").(string))
 	if err != nil {
 		return nil, err
 	}
@@ -1728,9 +1991,20 @@ func (ts *TokenStore) tokenStoreRoleRead(
 			"orphan":              role.Orphan,
 			"path_suffix":         role.PathSuffix,
 			"renewable":           role.Renewable,
+			"token_type":          role.TokenType,
+			"bound_cidrs":         role.BoundCIDRs,
+			"num_uses":            role.NumUses,
 		},
 	}
 
+	if role.BoundCIDRs == nil {
+		resp.Data["bound_cidrs"] = []string{}
+	}
+
+	if role.TokenType == "" {
+		resp.Data["token_type"] = TokenTypeService
+	}
+
 	return resp, nil
 }
 
@@ -1739,7 +2013,11 @@ func (ts *TokenStore) tokenStoreRoleExistenceCheck(req *logical.Request, data *f
 	if name == "" {
 		return false, fmt.Errorf("role name cannot be empty")
 	}
-	role, err := ts.tokenStoreRole(name)
+	nsID, err := ts.callerNamespaceID(req)
+	if err != nil {
+		return false, err
+	}
+	role, err := ts.tokenStoreRole(nsID, name)
 	if err != nil {
 		return false, err
 	}
@@ -1753,7 +2031,11 @@ func (ts *TokenStore) tokenStoreRoleCreateUpdate(
 	if name == "" {
 		return logical.ErrorResponse("role name cannot be empty"), nil
 	}
-	entry, err := ts.tokenStoreRole(name)
+	nsID, err := ts.callerNamespaceID(req)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := ts.tokenStoreRole(nsID, name)
 	if err != nil {
 		return nil, err
 	}
@@ -1791,6 +2073,45 @@ func (ts *TokenStore) tokenStoreRoleCreateUpdate(
 		entry.Renewable = data.Get("renewable").(bool)
 	}
 
+	tokenTypeStr, ok := data.GetOk("token_type")
+	if ok {
+		entry.TokenType = tokenTypeStr.(string)
+	} else if req.Operation == logical.CreateOperation {
+		entry.TokenType = data.Get("token_type").(string)
+	}
+	if !validTokenType(entry.TokenType) {
+		return logical.ErrorResponse(fmt.Sprintf(
+			"invalid token type %q", entry.TokenType)), nil
+	}
+	if entry.TokenType == TokenTypeBatch && entry.Period != 0 {
+		return logical.ErrorResponse("batch tokens cannot be periodic"), nil
+	}
+
+	boundCIDRsStr, ok := data.GetOk("bound_cidrs")
+	if !ok && req.Operation == logical.CreateOperation {
+		boundCIDRsStr, ok = data.Get("bound_cidrs"), true
+	}
+	if ok {
+		boundCIDRs, err := cidrutil.ParseCIDRs(strings.Split(boundCIDRsStr.(string), ","))
+		if err != nil {
+			return logical.ErrorResponse(fmt.Sprintf("invalid bound_cidrs: %v", err)), nil
+		}
+		entry.BoundCIDRs = boundCIDRs
+	}
+
+	numUsesInt, ok := data.GetOk("num_uses")
+	if ok {
+		entry.NumUses = numUsesInt.(int)
+	} else if req.Operation == logical.CreateOperation {
+		entry.NumUses = data.Get("num_uses").(int)
+	}
+	if entry.NumUses < 0 {
+		return logical.ErrorResponse("num_uses cannot be negative"), nil
+	}
+	if entry.TokenType == TokenTypeBatch && entry.NumUses != 0 {
+		return logical.ErrorResponse("batch tokens cannot have a limited number of uses"), nil
+	}
+
 	var resp *logical.Response
 
 	explicitMaxTTLInt, ok := data.GetOk("explicit_max_ttl")
@@ -1850,7 +2171,7 @@ func (ts *TokenStore) tokenStoreRoleCreateUpdate(
 	}
 
 	// Store it
-	jsonEntry, err := logical.StorageEntryJSON(fmt.Sprintf("%s%s", rolesPrefix, name), entry)
+	jsonEntry, err := logical.StorageEntryJSON(tokenStoreRolePath(nsID, name), entry)
 	if err != nil {
 		return nil, err
 	}
@@ -1910,6 +2231,18 @@ no effect on the token being renewed.`
 	tokenRenewableHelp = `Tokens created via this role will be
 renewable or not according to this value.
 Defaults to "true".`
+	tokenTypeHelp = `The type of the tokens created via this
+role, either "service" or "batch". Batch
+tokens are not persisted and cannot be
+renewed, revoked or create child tokens.
+Defaults to "service".`
+	tokenBoundCIDRsHelp = `If set, tokens created via this role
+can only be used from these CIDR blocks.
+The parameter is a comma-delimited string
+of CIDR blocks or IP addresses.`
+	tokenNumUsesHelp = `If set, tokens created via this role
+can only be used this number of times.
+Defaults to 0, which has no limit.`
 	tokenListAccessorsHelp = `List token accessors, which can then be
 be used to iterate and discover their properities
 or revoke them. Because this can be used to
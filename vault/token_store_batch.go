@@ -0,0 +1,200 @@
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/helper/jsonutil"
+	"github.com/hashicorp/vault/helper/policyutil"
+	"github.com/hashicorp/vault/logical"
+)
+
+const (
+	// batchTokenPrefix is the prefix of the ID of batch tokens, which
+	// distinguishes them from the tokens kept in storage
+	batchTokenPrefix = "b."
+
+	// batchKeyPath is the path of the key encrypting batch tokens, under
+	// the token store view
+	batchKeyPath = "batch-key"
+
+	// batchKeySize is the size of the AES key encrypting batch tokens
+	batchKeySize = 32
+)
+
+const (
+	// TokenTypeService is the type of the tokens kept in storage, which can
+	// be renewed, revoked and create child tokens
+	TokenTypeService = "service"
+
+	// TokenTypeBatch is the type of the tokens carrying their own encrypted
+	// entry. They are not persisted and have no lease, so they cannot be
+	// renewed nor revoked, and expire at the end of their TTL.
+	TokenTypeBatch = "batch"
+)
+
+// validTokenType returns whether typ names a token type; the empty string
+// stands for the default type
+func validTokenType(typ string) bool {
+	switch typ {
+	case "", TokenTypeService, TokenTypeBatch:
+		return true
+	}
+	return false
+}
+
+// IsBatchToken returns whether the given token ID is the one of a batch
+// token
+func IsBatchToken(id string) bool {
+	return strings.HasPrefix(id, batchTokenPrefix)
+}
+
+// batchAEAD returns the cipher encrypting batch tokens, generating and
+// persisting its key the first time
+func (ts *TokenStore) batchAEAD() (cipher.AEAD, error) {
+	ts.batchLock.Lock()
+	defer ts.batchLock.Unlock()
+
+	if ts.batchGCM != nil {
+		return ts.batchGCM, nil
+	}
+
+	raw, err := ts.view.Get(batchKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read batch token key: %v", err)
+	}
+
+	var key []byte
+	if raw != nil {
+		key = raw.Value
+	} else {
+		key = make([]byte, batchKeySize)
+		if _, err := rand.Read(key); err != nil {
+			return nil, fmt.Errorf("failed to generate batch token key: %v", err)
+		}
+		if err := ts.view.Put(&logical.StorageEntry{
+			Key:   batchKeyPath,
+			Value: key,
+		}); err != nil {
+			return nil, fmt.Errorf("failed to persist batch token key: %v", err)
+		}
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create batch token cipher: %v", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create batch token cipher: %v", err)
+	}
+	ts.batchGCM = gcm
+	return gcm, nil
+}
+
+// createBatch sets the ID of a batch token entry to its encrypted
+// contents. Nothing is written to storage, and the entry has no accessor.
+func (ts *TokenStore) createBatch(entry *TokenEntry) error {
+	if entry.ID != "" {
+		return fmt.Errorf("batch tokens cannot have a custom ID")
+	}
+	if entry.NumUses != 0 {
+		return fmt.Errorf("batch tokens cannot have a limited number of uses")
+	}
+	if entry.Period != 0 {
+		return fmt.Errorf("batch tokens cannot be periodic")
+	}
+	if entry.TTL <= 0 {
+		return fmt.Errorf("batch tokens must have a TTL")
+	}
+
+	entry.Policies = policyutil.SanitizePolicies(entry.Policies, false)
+	entry.Accessor = ""
+
+	// A batch token with a parent lives no longer than its parent, whose
+	// existence is checked whenever the batch token is used
+	if entry.Parent != "" {
+		parent, err := ts.Lookup(entry.Parent)
+		if err != nil {
+			return fmt.Errorf("failed to lookup parent: %v", err)
+		}
+		if parent == nil {
+			return fmt.Errorf("parent token not found")
+		}
+	}
+
+	gcm, err := ts.batchAEAD()
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode entry: %v", err)
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %v", err)
+	}
+	sealed := gcm.Seal(nonce, nonce, plaintext, []byte(batchTokenPrefix))
+
+	entry.ID = batchTokenPrefix + base64.RawURLEncoding.EncodeToString(sealed)
+	return nil
+}
+
+// lookupBatch decrypts the entry of a batch token. A nil entry is returned
+// for tokens that cannot be decrypted, have expired or whose parent was
+// revoked.
+func (ts *TokenStore) lookupBatch(id string) (*TokenEntry, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(id, batchTokenPrefix))
+	if err != nil {
+		return nil, nil
+	}
+
+	gcm, err := ts.batchAEAD()
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, nil
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, []byte(batchTokenPrefix))
+	if err != nil {
+		return nil, nil
+	}
+
+	entry := new(TokenEntry)
+	if err := jsonutil.DecodeJSON(plaintext, entry); err != nil {
+		return nil, fmt.Errorf("failed to decode entry: %v", err)
+	}
+	entry.ID = id
+
+	if !time.Now().Before(entry.batchExpireTime()) {
+		return nil, nil
+	}
+
+	if entry.Parent != "" {
+		parent, err := ts.Lookup(entry.Parent)
+		if err != nil {
+			return nil, fmt.Errorf("failed to lookup parent: %v", err)
+		}
+		if parent == nil {
+			return nil, nil
+		}
+	}
+
+	return entry, nil
+}
+
+// batchExpireTime returns the time a batch token expires
+func (te *TokenEntry) batchExpireTime() time.Time {
+	return time.Unix(te.CreationTime, 0).Add(te.TTL)
+}
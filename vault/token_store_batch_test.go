@@ -0,0 +1,183 @@
+package vault
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/logical"
+)
+
+func TestTokenStore_BatchToken(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	// A parent the batch token is tied to
+	testCoreMakeToken(t, c, root, "parent", "", []string{"root"})
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "auth/token/create")
+	req.ClientToken = "parent"
+	req.Data["type"] = "batch"
+	req.Data["ttl"] = "1h"
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	batch := resp.Auth.ClientToken
+	if !IsBatchToken(batch) || resp.Auth.Accessor != "" || resp.Auth.Renewable {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+
+	// Nothing is persisted for the token
+	entry, err := c.tokenStore.lookupSalted(c.tokenStore.SaltID(batch))
+	if err != nil || entry != nil {
+		t.Fatalf("bad: %#v %v", entry, err)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "secret/foo")
+	req.Data["bar"] = "baz"
+	req.ClientToken = batch
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "auth/token/lookup-self")
+	req.ClientToken = batch
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.Data["type"] != TokenTypeBatch || resp.Data["ttl"].(int64) <= 0 || resp.Data["renewable"] != false {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Batch tokens cannot create tokens, use the cubbyhole, be renewed or
+	// be revoked
+	for _, path := range []string{
+		"auth/token/create",
+		"cubbyhole/foo",
+		"auth/token/renew-self",
+		"auth/token/revoke-self",
+	} {
+		req = logical.TestRequest(t, logical.UpdateOperation, path)
+		req.Data["bar"] = "baz"
+		req.ClientToken = batch
+		if _, err := c.HandleRequest(req); err == nil {
+			t.Fatalf("%s: expected error", path)
+		}
+	}
+
+	// Revoking the parent invalidates the token
+	if err := c.tokenStore.RevokeTree("parent"); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if entry, err := c.tokenStore.Lookup(batch); err != nil || entry != nil {
+		t.Fatalf("bad: %#v %v", entry, err)
+	}
+}
+
+func TestTokenStore_BatchToken_Expired(t *testing.T) {
+	_, ts, _, _ := TestCoreWithTokenStore(t)
+
+	te := &TokenEntry{
+		Path:         "auth/token/create",
+		Policies:     []string{"default"},
+		CreationTime: time.Now().Add(-2 * time.Hour).Unix(),
+		TTL:          time.Hour,
+		Type:         TokenTypeBatch,
+	}
+	if err := ts.create(te); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if entry, err := ts.Lookup(te.ID); err != nil || entry != nil {
+		t.Fatalf("bad: %#v %v", entry, err)
+	}
+
+	// Tampered tokens are not found
+	tampered := te.ID[:len(te.ID)-2] + "AA"
+	if tampered == te.ID {
+		tampered = te.ID[:len(te.ID)-2] + "BB"
+	}
+	if entry, err := ts.Lookup(tampered); err != nil || entry != nil {
+		t.Fatalf("bad: %#v %v", entry, err)
+	}
+}
+
+func TestTokenStore_BatchToken_Role(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "auth/token/roles/batch")
+	req.ClientToken = root
+	req.Data["token_type"] = "batch"
+	if resp, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "auth/token/create/batch")
+	req.ClientToken = root
+	req.Data["policies"] = []string{"default"}
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	if !IsBatchToken(resp.Auth.ClientToken) {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+
+	// The role decides of the type
+	req.Data["type"] = "service"
+	if resp, err := c.HandleRequest(req); err == nil {
+		t.Fatalf("expected error: %#v", resp)
+	}
+
+	// Batch roles cannot be periodic
+	req = logical.TestRequest(t, logical.UpdateOperation, "auth/token/roles/batch")
+	req.ClientToken = root
+	req.Data["period"] = 300
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp == nil || !resp.IsError() {
+		t.Fatalf("expected error: %#v", resp)
+	}
+}
+
+func TestCore_HandleLogin_BatchToken(t *testing.T) {
+	noop := &NoopBackend{
+		Login: []string{"login"},
+		Response: &logical.Response{
+			Auth: &logical.Auth{
+				Policies:  []string{"foo"},
+				TokenType: TokenTypeBatch,
+			},
+		},
+	}
+	c, _, root := TestCoreUnsealed(t)
+	c.credentialBackends["noop"] = func(*logical.BackendConfig) (logical.Backend, error) {
+		return noop, nil
+	}
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "sys/auth/foo")
+	req.Data["type"] = "noop"
+	req.ClientToken = root
+	if _, err := c.HandleRequest(req); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	resp, err := c.HandleRequest(&logical.Request{
+		Path: "auth/foo/login",
+	})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !IsBatchToken(resp.Auth.ClientToken) {
+		t.Fatalf("bad: %#v", resp.Auth)
+	}
+
+	te, err := c.tokenStore.Lookup(resp.Auth.ClientToken)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if te == nil || te.Path != "auth/foo/login" || te.Parent != "" {
+		t.Fatalf("bad: %#v", te)
+	}
+}
@@ -93,6 +93,7 @@ func TestTokenStore_HandleRequest_LookupAccessor(t *testing.T) {
 	}
 
 	req := logical.TestRequest(t, logical.UpdateOperation, "lookup-accessor/"+out.Accessor)
+	req.ClientToken = root
 
 	resp, err := ts.HandleRequest(req)
 	if err != nil {
@@ -124,6 +125,7 @@ func TestTokenStore_HandleRequest_ListAccessors(t *testing.T) {
 	ts.revokeSalted(ts.SaltID(root))
 
 	req := logical.TestRequest(t, logical.ListOperation, "accessors")
+	req.ClientToken = "token1"
 
 	resp, err := ts.HandleRequest(req)
 	if err != nil {
@@ -201,6 +203,7 @@ func TestTokenStore_HandleRequest_RevokeAccessor(t *testing.T) {
 	}
 
 	req := logical.TestRequest(t, logical.UpdateOperation, "revoke-accessor/"+out.Accessor)
+	req.ClientToken = root
 
 	_, err = ts.HandleRequest(req)
 	if err != nil {
@@ -1162,6 +1165,7 @@ func TestTokenStore_HandleRequest_Lookup(t *testing.T) {
 		"creation_ttl":     int64(0),
 		"ttl":              int64(0),
 		"explicit_max_ttl": int64(0),
+		"type":             "service",
 	}
 
 	if resp.Data["creation_time"].(int64) == 0 {
@@ -1198,6 +1202,7 @@ func TestTokenStore_HandleRequest_Lookup(t *testing.T) {
 		"ttl":              int64(3600),
 		"explicit_max_ttl": int64(0),
 		"renewable":        true,
+		"type":             "service",
 	}
 
 	if resp.Data["creation_time"].(int64) == 0 {
@@ -1240,6 +1245,7 @@ func TestTokenStore_HandleRequest_Lookup(t *testing.T) {
 		"ttl":              int64(3600),
 		"explicit_max_ttl": int64(0),
 		"renewable":        true,
+		"type":             "service",
 	}
 
 	if resp.Data["creation_time"].(int64) == 0 {
@@ -1304,6 +1310,7 @@ func TestTokenStore_HandleRequest_LookupSelf(t *testing.T) {
 		"creation_ttl":     int64(0),
 		"ttl":              int64(0),
 		"explicit_max_ttl": int64(0),
+		"type":             "service",
 	}
 
 	if resp.Data["creation_time"].(int64) == 0 {
@@ -1456,6 +1463,9 @@ func TestTokenStore_RoleCRUD(t *testing.T) {
 		"path_suffix":         "happenin",
 		"explicit_max_ttl":    int64(0),
 		"renewable":           true,
+		"token_type":          "service",
+		"bound_cidrs":         []string{},
+		"num_uses":            0,
 	}
 
 	if !reflect.DeepEqual(expected, resp.Data) {
@@ -1500,6 +1510,9 @@ func TestTokenStore_RoleCRUD(t *testing.T) {
 		"path_suffix":         "happenin",
 		"explicit_max_ttl":    int64(0),
 		"renewable":           false,
+		"token_type":          "service",
+		"bound_cidrs":         []string{},
+		"num_uses":            0,
 	}
 
 	if !reflect.DeepEqual(expected, resp.Data) {
@@ -1537,6 +1550,9 @@ func TestTokenStore_RoleCRUD(t *testing.T) {
 		"path_suffix":         "happenin",
 		"period":              int64(0),
 		"renewable":           false,
+		"token_type":          "service",
+		"bound_cidrs":         []string{},
+		"num_uses":            0,
 	}
 
 	if !reflect.DeepEqual(expected, resp.Data) {
@@ -2464,3 +2480,189 @@ func TestTokenStore_Periodic(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenStore_BoundCIDRs(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "auth/token/create")
+	req.ClientToken = root
+	req.Data["bound_cidrs"] = "10.0.0.0/8, 192.168.1.10"
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	token := resp.Auth.ClientToken
+
+	readSecret := func(remoteAddr string) error {
+		req := logical.TestRequest(t, logical.ReadOperation, "secret/foo")
+		req.ClientToken = token
+		if remoteAddr != "" {
+			req.Connection = &logical.Connection{RemoteAddr: remoteAddr}
+		}
+		_, err := c.HandleRequest(req)
+		return err
+	}
+	for _, addr := range []string{"10.1.2.3", "192.168.1.10"} {
+		if err := readSecret(addr); err != nil {
+			t.Fatalf("%s: err: %v", addr, err)
+		}
+	}
+	for _, addr := range []string{"192.168.1.11", "127.0.0.1", ""} {
+		if err := readSecret(addr); err == nil {
+			t.Fatalf("%q: expected error", addr)
+		}
+	}
+
+	req = logical.TestRequest(t, logical.ReadOperation, "auth/token/lookup-self")
+	req.ClientToken = token
+	req.Connection = &logical.Connection{RemoteAddr: "10.1.2.3"}
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	expected := []string{"10.0.0.0/8", "192.168.1.10/32"}
+	if !reflect.DeepEqual(resp.Data["bound_cidrs"], expected) {
+		t.Fatalf("bad: %#v", resp.Data)
+	}
+
+	// Child tokens are bound to the same blocks
+	req = logical.TestRequest(t, logical.UpdateOperation, "auth/token/create")
+	req.ClientToken = token
+	req.Connection = &logical.Connection{RemoteAddr: "10.1.2.3"}
+	resp, err = c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	child, err := c.tokenStore.Lookup(resp.Auth.ClientToken)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !reflect.DeepEqual(child.BoundCIDRs, expected) {
+		t.Fatalf("bad: %#v", child)
+	}
+
+	req = logical.TestRequest(t, logical.UpdateOperation, "auth/token/create")
+	req.ClientToken = root
+	req.Data["bound_cidrs"] = []string{"10.0.0.0/33"}
+	if resp, err := c.HandleRequest(req); err == nil {
+		t.Fatalf("expected error: %#v", resp)
+	}
+}
+
+func TestTokenStore_RoleBoundCIDRsNumUses(t *testing.T) {
+	_, ts, _, root := TestCoreWithTokenStore(t)
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "roles/test")
+	req.ClientToken = root
+	req.Data = map[string]interface{}{
+		"bound_cidrs": "10.0.0.0/8",
+		"num_uses":    5,
+	}
+	resp, err := ts.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+
+	req.Path = "create/test"
+	req.Data = map[string]interface{}{}
+	resp, err = ts.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	out, err := ts.Lookup(resp.Auth.ClientToken)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out.NumUses != 5 || !reflect.DeepEqual(out.BoundCIDRs, []string{"10.0.0.0/8"}) {
+		t.Fatalf("bad: %#v", out)
+	}
+
+	// The lesser number of uses is used
+	req.Data = map[string]interface{}{
+		"num_uses": 10,
+	}
+	resp, err = ts.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	if len(resp.Warnings()) != 1 {
+		t.Fatalf("expected a warning: %#v", resp)
+	}
+	out, err = ts.Lookup(resp.Auth.ClientToken)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out.NumUses != 5 {
+		t.Fatalf("bad: %#v", out)
+	}
+
+	// The role's CIDR blocks cannot be overridden
+	req.Data = map[string]interface{}{
+		"bound_cidrs": "0.0.0.0/0",
+	}
+	resp, err = ts.HandleRequest(req)
+	if err == nil {
+		t.Fatalf("expected error: %#v", resp)
+	}
+}
+
+func TestTokenStore_RoleDelegation(t *testing.T) {
+	c, _, root := TestCoreUnsealed(t)
+
+	// The creator can only use the role
+	policy, err := Parse(`
+name = "creator"
+path "auth/token/create/app" {
+	capabilities = ["update"]
+}
+`)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if err := c.policyStore.SetPolicy(policy); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	testCoreMakeToken(t, c, root, "creator", "", []string{"creator"})
+
+	req := logical.TestRequest(t, logical.UpdateOperation, "auth/token/roles/app")
+	req.ClientToken = root
+	req.Data = map[string]interface{}{
+		"allowed_policies": "app",
+		"orphan":           true,
+		"period":           "1h",
+		"path_suffix":      "rev1",
+	}
+	if resp, err := c.HandleRequest(req); err != nil || resp.IsError() {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+
+	// Periodic orphan tokens are created without sudo
+	req = logical.TestRequest(t, logical.UpdateOperation, "auth/token/create/app")
+	req.ClientToken = "creator"
+	resp, err := c.HandleRequest(req)
+	if err != nil {
+		t.Fatalf("err: %v %v", err, resp)
+	}
+	out, err := c.tokenStore.Lookup(resp.Auth.ClientToken)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if out.Parent != "" || out.TTL != time.Hour || out.Path != "auth/token/create/app/rev1" ||
+		!reflect.DeepEqual(out.Policies, []string{"app", "default"}) {
+		t.Fatalf("bad: %#v", out)
+	}
+
+	// Policies outside of the role are denied
+	req.Data["policies"] = []string{"creator"}
+	if resp, err := c.HandleRequest(req); err == nil {
+		t.Fatalf("expected error: %#v", resp)
+	}
+
+	// Creating such a token directly requires sudo
+	req = logical.TestRequest(t, logical.UpdateOperation, "auth/token/create")
+	req.ClientToken = "creator"
+	req.Data["period"] = "1h"
+	if resp, err := c.HandleRequest(req); err == nil {
+		t.Fatalf("expected error: %#v", resp)
+	}
+}
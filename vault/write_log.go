@@ -0,0 +1,199 @@
+package vault
+
+import (
+	"sync"
+
+	"github.com/hashicorp/go-uuid"
+	"github.com/hashicorp/vault/physical"
+)
+
+const (
+	// writeLogSize is the number of writes the active node keeps in memory.
+	// A DR secondary or performance standby further behind does a full sync.
+	writeLogSize = 65536
+
+	// writeLogBatchSize is the maximum number of keys returned by a fetch
+	// following the log. A node further behind fetches again at once.
+	writeLogBatchSize = 512
+)
+
+// writeLog records the keys written to the physical backend so that DR
+// secondaries and performance standbys can fetch the changes since their
+// last sync. It only records while started on the active node, under an
+// epoch changing each time it starts recording.
+type writeLog struct {
+	physical.Backend
+
+	l       sync.RWMutex
+	epoch   string
+	first   uint64
+	entries []string
+
+	// notifyCh is closed on the next write recorded
+	notifyCh chan struct{}
+
+	// readOnly rejects the writes of a performance standby
+	readOnly bool
+}
+
+func newWriteLog(b physical.Backend) *writeLog {
+	return &writeLog{
+		Backend: b,
+	}
+}
+
+func (l *writeLog) Put(entry *physical.Entry) error {
+	if l.isReadOnly() {
+		return errPerformanceStandbyReadOnly
+	}
+	if err := l.Backend.Put(entry); err != nil {
+		return err
+	}
+	l.record(entry.Key)
+	return nil
+}
+
+func (l *writeLog) Delete(key string) error {
+	if l.isReadOnly() {
+		return errPerformanceStandbyReadOnly
+	}
+	if err := l.Backend.Delete(key); err != nil {
+		return err
+	}
+	l.record(key)
+	return nil
+}
+
+func (l *writeLog) Transaction(txns []*physical.TxnEntry) error {
+	if l.isReadOnly() {
+		return errPerformanceStandbyReadOnly
+	}
+	err := physical.Transaction(l.Backend, txns)
+
+	// The keys are recorded even if the transaction failed, since a backend
+	// without transactions may have applied some of the operations. Syncing
+	// a key which did not change is harmless.
+	for _, txn := range txns {
+		if txn != nil && txn.Entry != nil {
+			l.record(txn.Entry.Key)
+		}
+	}
+	return err
+}
+
+func (l *writeLog) record(key string) {
+	if !drReplicated(key) {
+		return
+	}
+
+	l.l.Lock()
+	defer l.l.Unlock()
+	if l.epoch == "" {
+		return
+	}
+	l.entries = append(l.entries, key)
+	if len(l.entries) > 2*writeLogSize {
+		drop := len(l.entries) - writeLogSize
+		l.entries = append([]string(nil), l.entries[drop:]...)
+		l.first += uint64(drop)
+	}
+	l.notify()
+}
+
+// notify wakes up the fetches waiting for a write. The lock must be held.
+func (l *writeLog) notify() {
+	if l.notifyCh != nil {
+		close(l.notifyCh)
+		l.notifyCh = nil
+	}
+}
+
+// waitCh returns a channel closed on the next write recorded, or when the
+// log stops
+func (l *writeLog) waitCh() <-chan struct{} {
+	l.l.Lock()
+	defer l.l.Unlock()
+	if l.notifyCh == nil {
+		l.notifyCh = make(chan struct{})
+	}
+	return l.notifyCh
+}
+
+func (l *writeLog) isReadOnly() bool {
+	l.l.RLock()
+	defer l.l.RUnlock()
+	return l.readOnly
+}
+
+// setReadOnly rejects the writes to the backend while the node is a
+// performance standby
+func (l *writeLog) setReadOnly(readOnly bool) {
+	l.l.Lock()
+	defer l.l.Unlock()
+	l.readOnly = readOnly
+}
+
+// start starts recording under a new epoch
+func (l *writeLog) start() error {
+	epoch, err := uuid.GenerateUUID()
+	if err != nil {
+		return err
+	}
+
+	l.l.Lock()
+	defer l.l.Unlock()
+	l.epoch = epoch
+	l.first = 1
+	l.entries = nil
+	return nil
+}
+
+// stop stops recording
+func (l *writeLog) stop() {
+	l.l.Lock()
+	defer l.l.Unlock()
+	l.epoch = ""
+	l.entries = nil
+	l.notify()
+}
+
+// position returns the epoch and the index of the last write recorded
+func (l *writeLog) position() (string, uint64) {
+	l.l.RLock()
+	defer l.l.RUnlock()
+	if l.epoch == "" {
+		return "", 0
+	}
+	return l.epoch, l.first + uint64(len(l.entries)) - 1
+}
+
+// since returns the distinct keys written after the given position, up to
+// writeLogBatchSize keys, and the index of the last write they cover. It
+// returns false if the log does not go back to the position.
+func (l *writeLog) since(epoch string, index uint64) ([]string, uint64, bool) {
+	l.l.RLock()
+	defer l.l.RUnlock()
+
+	if l.epoch == "" || epoch != l.epoch {
+		return nil, 0, false
+	}
+	last := l.first + uint64(len(l.entries)) - 1
+	if index+1 < l.first || index > last {
+		return nil, 0, false
+	}
+
+	var keys []string
+	seen := make(map[string]struct{})
+	for i := index + 1 - l.first; i < uint64(len(l.entries)); i++ {
+		key := l.entries[i]
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		if len(keys) == writeLogBatchSize {
+			return keys, l.first + i - 1, true
+		}
+		seen[key] = struct{}{}
+		keys = append(keys, key)
+	}
+	return keys, last, true
+}
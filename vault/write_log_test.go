@@ -0,0 +1,72 @@
+package vault
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/vault/physical"
+)
+
+func TestWriteLog_Since(t *testing.T) {
+	l := newWriteLog(physical.NewInmem(nil))
+
+	// Nothing is recorded until started
+	l.Put(&physical.Entry{Key: "foo"})
+	if epoch, index := l.position(); epoch != "" || index != 0 {
+		t.Fatalf("bad: %s %d", epoch, index)
+	}
+
+	if err := l.start(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	epoch, _ := l.position()
+	l.Put(&physical.Entry{Key: "foo"})
+	l.Put(&physical.Entry{Key: "bar"})
+	l.Delete("foo")
+	l.Put(&physical.Entry{Key: coreLockPath})
+
+	keys, last, ok := l.since(epoch, 0)
+	if !ok || last != 3 || !reflect.DeepEqual(keys, []string{"foo", "bar"}) {
+		t.Fatalf("bad: %v %d %v", keys, last, ok)
+	}
+	keys, last, ok = l.since(epoch, 2)
+	if !ok || last != 3 || !reflect.DeepEqual(keys, []string{"foo"}) {
+		t.Fatalf("bad: %v %d %v", keys, last, ok)
+	}
+	keys, last, ok = l.since(epoch, 3)
+	if !ok || last != 3 || len(keys) != 0 {
+		t.Fatalf("bad: %v %d %v", keys, last, ok)
+	}
+
+	// Positions the log does not cover require a full sync
+	if _, _, ok := l.since(epoch, 4); ok {
+		t.Fatalf("expected full sync past the log")
+	}
+	if _, _, ok := l.since("other", 0); ok {
+		t.Fatalf("expected full sync from another epoch")
+	}
+	l.stop()
+	if _, _, ok := l.since(epoch, 0); ok {
+		t.Fatalf("expected full sync once stopped")
+	}
+}
+
+func TestWriteLog_Since_Batch(t *testing.T) {
+	l := newWriteLog(physical.NewInmem(nil))
+	if err := l.start(); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	epoch, _ := l.position()
+	for i := 0; i < writeLogBatchSize+10; i++ {
+		l.Put(&physical.Entry{Key: "foo/" + string(rune('a'+i%26)) + string(rune('a'+i/26))})
+	}
+
+	keys, last, ok := l.since(epoch, 0)
+	if !ok || len(keys) != writeLogBatchSize || last != writeLogBatchSize {
+		t.Fatalf("bad: %d %d %v", len(keys), last, ok)
+	}
+	keys, last, ok = l.since(epoch, last)
+	if !ok || len(keys) != 10 || last != writeLogBatchSize+10 {
+		t.Fatalf("bad: %d %d %v", len(keys), last, ok)
+	}
+}